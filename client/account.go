@@ -0,0 +1,252 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	accountPath             = "/v1/account"
+	accountSubscriptionPath = "/v1/account/subscription"
+	accountStatsPath        = "/v1/account/stats"
+	accountLimitsPath       = "/v1/account/limits"
+	accountMaxResponseBytes = 1024 * 1024 // Accounts may hold many subscriptions and tokens
+	accountAnonymousUser    = "*"         // Username returned for anonymous users, same as user.Everyone
+)
+
+// Account is the account of a user on a ntfy server, as returned by Client.Account. It only contains
+// the fields needed to sync subscriptions across devices.
+type Account struct {
+	// Username is the name of the logged-in user.
+	Username string `json:"username"`
+	// SyncTopic is the topic on which the server publishes an event whenever the account changes.
+	SyncTopic string `json:"sync_topic"`
+	// Subscriptions is the list of topics stored in the account, shared by the web app, the mobile apps and the CLI.
+	Subscriptions []*AccountSubscription `json:"subscriptions"`
+}
+
+// AccountSubscription is a topic subscription stored in an account.
+type AccountSubscription struct {
+	// BaseURL is the base URL of the server of the topic, e.g. https://ntfy.sh.
+	BaseURL string `json:"base_url"`
+	// Topic is the topic name.
+	Topic string `json:"topic"`
+	// DisplayName is the optional display name of the subscription.
+	DisplayName *string `json:"display_name,omitempty"`
+}
+
+// TopicStats are statistics about a topic reserved by the user, as returned by Client.TopicStats. Message
+// counts and sizes only include messages that are still in the server's message cache.
+type TopicStats struct {
+	// Topic is the topic name.
+	Topic string `json:"topic"`
+	// Messages is the number of cached messages.
+	Messages int `json:"messages"`
+	// MessagesPerDay is the number of messages published in the last 24 hours.
+	MessagesPerDay int `json:"messages_per_day"`
+	// LastActivity is the Unix time of the last message or subscription, or 0 if unknown.
+	LastActivity int64 `json:"last_activity"`
+	// CacheBytes is the size of the cached messages in bytes.
+	CacheBytes int64 `json:"cache_bytes"`
+	// AttachmentBytes is the size of the attachments that have not expired, in bytes.
+	AttachmentBytes int64 `json:"attachment_bytes"`
+	// Subscribers is the number of currently connected subscribers.
+	Subscribers int `json:"subscribers"`
+}
+
+// Limits is the current rate limiting state of the caller, as returned by Client.Limits. It helps to find out
+// why the server responds with HTTP 429 (too many requests).
+type Limits struct {
+	// Visitor is the ID the server uses for rate limiting, e.g. "ip:1.2.3.4" for anonymous users, or "user:u_..."
+	Visitor string `json:"visitor"`
+	// Basis describes where the limits come from: "ip" (server config), "tier" (the user's tier) or "guest" (guest token).
+	Basis string `json:"basis"`
+	// Exempt is true if the caller's IP address is exempt from the request and message limits.
+	Exempt bool `json:"exempt,omitempty"`
+	// Requests is the limit of (almost) all requests, including publishing.
+	Requests *Limit `json:"requests"`
+	// Messages is the daily message limit.
+	Messages *Limit `json:"messages"`
+	// Emails is the limit of e-mail notifications.
+	Emails *Limit `json:"emails"`
+	// Calls is the daily phone call limit.
+	Calls *Limit `json:"calls"`
+	// Subscriptions is the limit of concurrent subscriptions.
+	Subscriptions *Limit `json:"subscriptions"`
+	// AttachmentBandwidth is the daily attachment bandwidth limit, in bytes.
+	AttachmentBandwidth *Limit `json:"attachment_bandwidth"`
+	// AuthFailures is the limit of failed logins, only set for anonymous users.
+	AuthFailures *Limit `json:"auth_failures,omitempty"`
+	// Banned lists temporary bans, or is nil if the caller is not banned.
+	Banned *LimitBans `json:"banned,omitempty"`
+}
+
+// Limit is the state of a single limit, see Limits.
+type Limit struct {
+	// Limit is the daily limit, or the burst (number of events allowed at once) of rate limits.
+	Limit int64 `json:"limit"`
+	// Used is the number of events since the last daily reset.
+	Used int64 `json:"used"`
+	// Remaining is the number of events that are currently allowed.
+	Remaining int64 `json:"remaining"`
+	// Algorithm is the rate limiting algorithm, e.g. "token-bucket", or empty for daily limits.
+	Algorithm string `json:"algorithm,omitempty"`
+	// Next is the Unix time at which the next event is allowed, or 0 if events are currently allowed.
+	Next int64 `json:"next,omitempty"`
+	// Reset is the Unix time at which the limit is reset (daily limits) or fully replenished (rate limits), or 0.
+	Reset int64 `json:"reset,omitempty"`
+}
+
+// LimitBans lists the temporary bans of the caller, see Limits.
+type LimitBans struct {
+	// Firebase is the Unix time until which messages are not forwarded to Firebase (Android push), or 0.
+	Firebase int64 `json:"firebase,omitempty"`
+	// Login is the Unix time until which logins are blocked after too many failed attempts, or 0.
+	Login int64 `json:"login,omitempty"`
+}
+
+// TopicURL returns the full URL of the subscribed topic, e.g. https://ntfy.sh/mytopic
+func (s *AccountSubscription) TopicURL() string {
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(s.BaseURL, "/"), s.Topic)
+}
+
+// Account retrieves the account of the user on the server with the given base URL. An auth option
+// (e.g. WithBearerAuth or WithBasicAuth) must be passed, since anonymous users do not have an account.
+//
+// Parameters:
+//   - baseURL: The base URL of the server, e.g. https://ntfy.sh.
+//   - options: Optional configuration for the request, typically the credentials.
+//
+// Returns:
+//   - The account, or an error if the request failed or the user is not logged in.
+func (c *Client) Account(baseURL string, options ...RequestOption) (*Account, error) {
+	req, err := newAccountRequest(http.MethodGet, strings.TrimSuffix(baseURL, "/")+accountPath, nil, options)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var account Account
+	if err := json.NewDecoder(io.LimitReader(resp.Body, accountMaxResponseBytes)).Decode(&account); err != nil {
+		return nil, err
+	} else if account.Username == "" || account.Username == accountAnonymousUser {
+		return nil, errors.New("not logged in, no credentials given or server does not support accounts")
+	}
+	return &account, nil
+}
+
+// AddAccountSubscription stores a subscription in the account of the user on the server with the given base
+// URL, so that it shows up in the web app and mobile apps of the user. Adding a subscription that already
+// exists in the account is not an error.
+//
+// Parameters:
+//   - baseURL: The base URL of the server holding the account, e.g. https://ntfy.sh.
+//   - subscription: The subscription to add.
+//   - options: Optional configuration for the request, typically the credentials.
+//
+// Returns:
+//   - An error if the request failed.
+func (c *Client) AddAccountSubscription(baseURL string, subscription *AccountSubscription, options ...RequestOption) error {
+	body, err := json.Marshal(subscription)
+	if err != nil {
+		return err
+	}
+	req, err := newAccountRequest(http.MethodPost, strings.TrimSuffix(baseURL, "/")+accountSubscriptionPath, bytes.NewReader(body), options)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// TopicStats retrieves statistics for the topics reserved by the user on the server with the given base URL.
+// An auth option (e.g. WithBearerAuth or WithBasicAuth) must be passed.
+//
+// Parameters:
+//   - baseURL: The base URL of the server, e.g. https://ntfy.sh.
+//   - options: Optional configuration for the request, typically the credentials.
+//
+// Returns:
+//   - The statistics of each reserved topic, or an error if the request failed.
+func (c *Client) TopicStats(baseURL string, options ...RequestOption) ([]*TopicStats, error) {
+	req, err := newAccountRequest(http.MethodGet, strings.TrimSuffix(baseURL, "/")+accountStatsPath, nil, options)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var stats struct {
+		Topics []*TopicStats `json:"topics"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, accountMaxResponseBytes)).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return stats.Topics, nil
+}
+
+// Limits retrieves the current rate limiting state of the caller on the server with the given base URL, i.e.
+// the remaining requests, messages, e-mails, etc., when they are replenished, and temporary bans. Credentials
+// are optional: without them, the limits of the caller's IP address are returned.
+//
+// Parameters:
+//   - baseURL: The base URL of the server, e.g. https://ntfy.sh.
+//   - options: Optional configuration for the request, typically the credentials.
+//
+// Returns:
+//   - The limits, or an error if the request failed.
+func (c *Client) Limits(baseURL string, options ...RequestOption) (*Limits, error) {
+	req, err := newAccountRequest(http.MethodGet, strings.TrimSuffix(baseURL, "/")+accountLimitsPath, nil, options)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var limits Limits
+	if err := json.NewDecoder(io.LimitReader(resp.Body, accountMaxResponseBytes)).Decode(&limits); err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+func newAccountRequest(method, url string, body io.Reader, options []RequestOption) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		if err := option(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
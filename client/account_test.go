@@ -0,0 +1,80 @@
+package client_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"heckel.io/ntfy/v2/user"
+)
+
+func TestClient_Account_AddSubscription(t *testing.T) {
+	conf := server.NewConfig()
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthUsers = []*user.User{
+		{Name: "philuser", Hash: "$2a$10$U4WSIYY6evyGmZaraavM2e2JeVG6EMGUKN1uUwufUeeRd4Jpg6cGC", Role: user.RoleUser}, // philuser:philpass
+	}
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	c := client.New(newTestConfig(port))
+	auth := client.WithBasicAuth("philuser", "philpass")
+
+	account, err := c.Account(baseURL, auth)
+	require.Nil(t, err)
+	require.Equal(t, "philuser", account.Username)
+	require.Regexp(t, `^st_`, account.SyncTopic)
+	require.Empty(t, account.Subscriptions)
+
+	subscription := &client.AccountSubscription{BaseURL: "https://ntfy.sh", Topic: "mytopic"}
+	require.Nil(t, c.AddAccountSubscription(baseURL, subscription, auth))
+	require.Nil(t, c.AddAccountSubscription(baseURL, subscription, auth)) // Already exists, not an error
+
+	account, err = c.Account(baseURL, auth)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(account.Subscriptions))
+	require.Equal(t, "https://ntfy.sh/mytopic", account.Subscriptions[0].TopicURL())
+
+	// Anonymous users and wrong credentials
+	_, err = c.Account(baseURL)
+	require.Error(t, err)
+	_, err = c.Account(baseURL, client.WithBasicAuth("philuser", "wrong"))
+	require.Error(t, err)
+}
+
+func TestClient_Limits(t *testing.T) {
+	conf := server.NewConfig()
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthUsers = []*user.User{
+		{Name: "philuser", Hash: "$2a$10$U4WSIYY6evyGmZaraavM2e2JeVG6EMGUKN1uUwufUeeRd4Jpg6cGC", Role: user.RoleUser}, // philuser:philpass
+	}
+	conf.VisitorMessageDailyLimit = 10
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	c := client.New(newTestConfig(port))
+
+	_, err := c.Publish(baseURL+"/mytopic", "some message")
+	require.Nil(t, err)
+
+	limits, err := c.Limits(baseURL)
+	require.Nil(t, err)
+	require.Equal(t, "ip:127.0.0.1", limits.Visitor)
+	require.Equal(t, "ip", limits.Basis)
+	require.Equal(t, int64(10), limits.Messages.Limit)
+	require.Equal(t, int64(1), limits.Messages.Used)
+	require.Equal(t, int64(9), limits.Messages.Remaining)
+	require.NotNil(t, limits.AuthFailures)
+	require.Nil(t, limits.Banned)
+
+	limits, err = c.Limits(baseURL, client.WithBasicAuth("philuser", "philpass"))
+	require.Nil(t, err)
+	require.Equal(t, "ip:127.0.0.1", limits.Visitor) // Users without tier share the limits of their IP address
+
+	_, err = c.Limits(baseURL, client.WithBasicAuth("philuser", "wrongpass"))
+	require.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	ackURLRegex = regexp.MustCompile(`^(https?://.+)/ack/([-_A-Za-z0-9]+)$`)
+)
+
+// Ack acknowledges a message, so that it is no longer escalated (see escalation policies in the server docs),
+// or a claimed message, so that it is not handed out again. The ID is either the message ID, or the claim
+// returned when claiming the message.
+//
+// A topic can be either a full URL, a short URL or a short name, see Subscribe for details.
+//
+// Parameters:
+//   - topic: The topic of the message, e.g. "mytopic" or "https://ntfy.sh/mytopic".
+//   - id: The message ID or claim to acknowledge.
+//   - options: Optional configuration for the request, typically the credentials.
+//
+// Returns:
+//   - An *Error if the server rejected the request (e.g. HTTP 404 if the message was already acknowledged),
+//     or an error if the request failed.
+func (c *Client) Ack(topic, id string, options ...RequestOption) error {
+	topicURL, err := c.expandTopicURL(topic)
+	if err != nil {
+		return err
+	}
+	req, err := newAccountRequest(http.MethodPost, fmt.Sprintf("%s/ack/%s", topicURL, id), nil, options)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// AckTarget returns the topic URL and the message ID to pass to Client.Ack if the message asks to be
+// acknowledged, i.e. if it has an "http" action that acknowledges a message. Escalated messages have such
+// an action, and it refers to the original message, which may have been published to a different topic.
+//
+// Returns:
+//   - The topic URL and the message ID, and true if the message asks to be acknowledged.
+func (m *Message) AckTarget() (topicURL, id string, ok bool) {
+	for _, action := range m.Actions {
+		if action.Action != "http" || (action.Method != "" && !strings.EqualFold(action.Method, http.MethodPost)) {
+			continue
+		}
+		if matches := ackURLRegex.FindStringSubmatch(action.URL); matches != nil {
+			return matches[1], matches[2], true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,75 @@
+package client_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestClient_Ack(t *testing.T) {
+	conf := server.NewConfig()
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthUsers = []*user.User{
+		{Name: "philuser", Hash: "$2a$10$U4WSIYY6evyGmZaraavM2e2JeVG6EMGUKN1uUwufUeeRd4Jpg6cGC", Role: user.RoleAdmin}, // philuser:philpass
+	}
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	c := client.New(newTestConfig(port))
+	auth := client.WithBasicAuth("philuser", "philpass")
+
+	for _, r := range []struct{ method, path, body string }{
+		{http.MethodPost, "/v1/account/reservation", `{"topic":"alerts","everyone":"deny-all"}`},
+		{http.MethodPut, "/v1/account/reservation/alerts/escalation", `{"min_priority":4,"steps":[{"after":"5m","priority":5}]}`},
+	} {
+		req, _ := http.NewRequest(r.method, baseURL+r.path, strings.NewReader(r.body))
+		req.Header.Set("Authorization", util.BasicAuth("philuser", "philpass"))
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	m, err := c.Publish("alerts", "disk full", client.WithPriority("5"), auth)
+	require.Nil(t, err)
+	require.Nil(t, c.Ack("alerts", m.ID, auth))
+
+	// Already acknowledged
+	var httpErr *client.Error
+	err = c.Ack("alerts", m.ID, auth)
+	require.True(t, errors.As(err, &httpErr))
+	require.Equal(t, 40405, httpErr.Code)
+
+	// Not allowed
+	require.True(t, errors.Is(c.Ack("alerts", m.ID), client.ErrForbidden))
+}
+
+func TestMessage_AckTarget(t *testing.T) {
+	m := &client.Message{
+		Actions: []*client.Action{
+			{Action: "view", Label: "Open", URL: "https://ntfy.example.com/alerts/ack/rBWeMW5r5Vhq"},
+			{Action: "http", Label: "Acknowledge", URL: "https://ntfy.example.com/alerts/ack/rBWeMW5r5Vhq", Method: "POST"},
+		},
+	}
+	topicURL, id, ok := m.AckTarget()
+	require.True(t, ok)
+	require.Equal(t, "https://ntfy.example.com/alerts", topicURL)
+	require.Equal(t, "rBWeMW5r5Vhq", id)
+
+	m.Actions[1].Method = "PUT"
+	_, _, ok = m.AckTarget()
+	require.False(t, ok)
+	m.Actions = nil
+	_, _, ok = m.AckTarget()
+	require.False(t, ok)
+}
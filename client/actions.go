@@ -0,0 +1,111 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Action types, see Action.Action
+const (
+	ActionView      = "view"
+	ActionBroadcast = "broadcast"
+	ActionHTTP      = "http"
+)
+
+const (
+	actionsMax = 3 // Must match the server's limit
+)
+
+// ViewAction returns an action button that opens the given URL, e.g. a website or an app link.
+//
+// Parameters:
+//   - label: The label of the action button.
+//   - url: The URL to open.
+func ViewAction(label, url string) *Action {
+	return &Action{Action: ActionView, Label: label, URL: url}
+}
+
+// HTTPAction returns an action button that sends an HTTP request to the given URL. The request is a POST
+// request without body, unless Method, Headers or Body are set on the returned action.
+//
+// Parameters:
+//   - label: The label of the action button.
+//   - url: The URL to send the request to.
+func HTTPAction(label, url string) *Action {
+	return &Action{Action: ActionHTTP, Label: label, URL: url}
+}
+
+// BroadcastAction returns an action button that sends an Android broadcast intent (io.heckel.ntfy.USER_ACTION,
+// unless Intent is set on the returned action) with the given extras. This only works on Android.
+//
+// Parameters:
+//   - label: The label of the action button.
+//   - extras: The intent extras, may be nil.
+func BroadcastAction(label string, extras map[string]string) *Action {
+	return &Action{Action: ActionBroadcast, Label: label, Extras: extras}
+}
+
+// WithActionBuilders adds action buttons to the notification. Unlike WithActions, which takes the actions
+// definition as a string, the actions are sent as a JSON array in the X-Actions header, so labels, URLs and bodies
+// may contain any characters. See https://ntfy.sh/docs/publish/#action-buttons for details.
+//
+// Parameters:
+//   - actions: The actions, e.g. created with ViewAction, HTTPAction or BroadcastAction.
+func WithActionBuilders(actions ...*Action) PublishOption {
+	return func(r *http.Request) error {
+		if len(actions) == 0 {
+			return nil
+		}
+		value, err := encodeActions(actions)
+		if err != nil {
+			return err
+		}
+		r.Header.Set("X-Actions", value)
+		return nil
+	}
+}
+
+// encodeActions validates the actions and encodes them as a JSON array that is safe to use as a header value
+func encodeActions(actions []*Action) (string, error) {
+	if len(actions) > actionsMax {
+		return "", fmt.Errorf("only %d actions allowed", actionsMax)
+	}
+	for _, action := range actions {
+		if action == nil {
+			return "", errors.New("action must not be nil")
+		} else if action.Action != ActionView && action.Action != ActionBroadcast && action.Action != ActionHTTP {
+			return "", fmt.Errorf("invalid action type '%s', must be '%s', '%s' or '%s'", action.Action, ActionView, ActionBroadcast, ActionHTTP)
+		} else if action.Label == "" {
+			return "", errors.New("action label is required")
+		} else if action.Action != ActionBroadcast && action.URL == "" {
+			return "", fmt.Errorf("action URL is required for action '%s'", action.Action)
+		}
+	}
+	b, err := json.Marshal(actions)
+	if err != nil {
+		return "", err
+	}
+	return escapeNonASCII(string(b)), nil
+}
+
+// escapeNonASCII replaces all non-ASCII characters in a JSON string with \u escapes, so that the JSON can be
+// sent in an HTTP header without being mangled by proxies
+func escapeNonASCII(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			sb.WriteRune(r)
+		} else if r > 0xFFFF {
+			r1, r2 := utf16.EncodeRune(r)
+			fmt.Fprintf(&sb, `\u%04x\u%04x`, r1, r2)
+		} else {
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		}
+	}
+	return sb.String()
+}
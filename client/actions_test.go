@@ -0,0 +1,82 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestClient_Publish_WithActionBuilders(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	door := client.HTTPAction("Close \"door\"; now", "https://api.example.com/door?a=1,b=2")
+	door.Method = "PUT"
+	door.Headers = map[string]string{"Authorization": "Bearer abc"}
+	door.Body = `{"state": "closed", "by": "Zoë 🚪"}`
+	door.Clear = true
+	msg, err := c.Publish("mytopic", "Garage door open", client.WithActionBuilders(
+		client.ViewAction("Öffnen, bitte", "https://example.com/?x=1;y=2"),
+		door,
+		client.BroadcastAction("Take picture", map[string]string{"camera": "front"}),
+	))
+	require.Nil(t, err)
+	require.Equal(t, 3, len(msg.Actions))
+
+	messages, err := c.Poll("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	actions := messages[0].Actions
+	require.Equal(t, 3, len(actions))
+	require.Equal(t, "view", actions[0].Action)
+	require.Equal(t, "Öffnen, bitte", actions[0].Label)
+	require.Equal(t, "https://example.com/?x=1;y=2", actions[0].URL)
+	require.Equal(t, "http", actions[1].Action)
+	require.Equal(t, "Close \"door\"; now", actions[1].Label)
+	require.Equal(t, "https://api.example.com/door?a=1,b=2", actions[1].URL)
+	require.Equal(t, "PUT", actions[1].Method)
+	require.Equal(t, map[string]string{"Authorization": "Bearer abc"}, actions[1].Headers)
+	require.Equal(t, `{"state": "closed", "by": "Zoë 🚪"}`, actions[1].Body)
+	require.True(t, actions[1].Clear)
+	require.Equal(t, "broadcast", actions[2].Action)
+	require.Equal(t, map[string]string{"camera": "front"}, actions[2].Extras)
+}
+
+func TestClient_Publish_WithActionBuilders_HeaderIsASCII(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Actions")
+		w.Write([]byte(`{"id":"abc","event":"message","topic":"mytopic","message":"hi"}`))
+	}))
+	defer server.Close()
+	c := client.New(&client.Config{DefaultHost: server.URL})
+
+	_, err := c.Publish("mytopic", "hi", client.WithActionBuilders(client.ViewAction("Zoë 🚪", "https://example.com")))
+	require.Nil(t, err)
+	require.Equal(t, `[{"id":"","action":"view","label":"Zo\u00eb \ud83d\udeaa","clear":false,"url":"https://example.com"}]`, header)
+
+	_, err = c.Publish("mytopic", "hi", client.WithActionBuilders())
+	require.Nil(t, err)
+	require.Equal(t, "", header)
+}
+
+func TestClient_Publish_WithActionBuilders_Invalid(t *testing.T) {
+	c := client.New(&client.Config{DefaultHost: "http://127.0.0.1:1"})
+	view := client.ViewAction("Open", "https://example.com")
+	for _, actions := range [][]*client.Action{
+		{view, view, view, view},
+		{nil},
+		{client.ViewAction("", "https://example.com")},
+		{client.ViewAction("Open", "")},
+		{client.HTTPAction("Open", "")},
+		{{Action: "unknown", Label: "Open"}},
+	} {
+		_, err := c.Publish("mytopic", "hi", client.WithActionBuilders(actions...))
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+// configAuth returns an option that adds the credentials from the config to a request to the given topic URL, or
+// nil if there are none. The credentials of a matching subscription in Config.Subscribe take precedence over the
+// default credentials (Config.DefaultToken, or Config.DefaultUser and Config.DefaultPassword); a token takes
+// precedence over a username and password. A subscription with an empty token (or an empty username and password)
+// explicitly disables authentication for its topic.
+func (c *Client) configAuth(topicURL string) RequestOption {
+	for _, s := range c.config.Subscribe {
+		if s.Topic == "" {
+			continue
+		} else if u, err := c.expandTopicsURL(s.Topic); err != nil || u != topicURL {
+			continue
+		}
+		if (s.Token != nil && *s.Token == "") || (s.User != nil && *s.User == "" && s.Password != nil && *s.Password == "") {
+			return WithEmptyAuth()
+		} else if s.Token != nil {
+			return WithBearerToken(*s.Token)
+		} else if s.User != nil && *s.User != "" && s.Password != nil {
+			return WithBasicAuth(*s.User, *s.Password)
+		}
+		break
+	}
+	if c.config.DefaultToken != "" {
+		return WithBearerToken(c.config.DefaultToken)
+	} else if c.config.DefaultUser != "" && c.config.DefaultPassword != nil {
+		return WithBasicAuth(c.config.DefaultUser, *c.config.DefaultPassword)
+	}
+	return nil
+}
+
+// withConfigAuth returns the options, preceded by the credentials from the config (see configAuth), so that
+// explicit options such as WithBasicAuth, WithBearerToken or WithEmptyAuth override them
+func (c *Client) withConfigAuth(topicURL string, options []RequestOption) []RequestOption {
+	auth := c.configAuth(topicURL)
+	if auth == nil {
+		return options
+	}
+	return append([]RequestOption{auth}, options...)
+}
@@ -0,0 +1,88 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestClient_ConfigAuth(t *testing.T) {
+	var mu sync.Mutex
+	authorization := make(map[string]string) // Method + topic -> Authorization header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/") {
+			http.NotFound(w, r) // Capabilities are not advertised
+			return
+		}
+		topic := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/json")
+		mu.Lock()
+		authorization[r.Method+" "+topic] = r.Header.Get("Authorization")
+		mu.Unlock()
+		w.Write([]byte(`{"id":"m1","event":"message","topic":"` + topic + `","message":"hi"}` + "\n"))
+	}))
+	defer server.Close()
+	auth := func(key string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		return authorization[key]
+	}
+
+	token, empty := "tk_subscription", ""
+	conf := &client.Config{
+		DefaultHost:     server.URL,
+		DefaultUser:     "phil",
+		DefaultPassword: util.String("mypass"),
+		Subscribe: []client.Subscribe{
+			{Topic: "private", Token: &token},
+			{Topic: "public", Token: &empty},
+			{Topic: "plain"}, // No credentials, uses the default credentials
+		},
+	}
+	c := client.New(conf)
+	basicAuth := util.BasicAuth("phil", "mypass")
+
+	// Default credentials, for publishing and polling
+	_, err := c.Publish("mytopic", "hi")
+	require.Nil(t, err)
+	require.Equal(t, basicAuth, auth("POST mytopic"))
+	_, err = c.Poll("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, basicAuth, auth("GET mytopic"))
+	_, err = c.Publish("plain", "hi")
+	require.Nil(t, err)
+	require.Equal(t, basicAuth, auth("POST plain"))
+
+	// Subscription credentials win, and an empty token disables auth
+	_, err = c.Publish("private", "hi")
+	require.Nil(t, err)
+	require.Equal(t, "Bearer tk_subscription", auth("POST private"))
+	_, err = c.Poll(server.URL + "/private")
+	require.Nil(t, err)
+	require.Equal(t, "Bearer tk_subscription", auth("GET private"))
+	_, err = c.Publish("public", "hi")
+	require.Nil(t, err)
+	require.Equal(t, "", auth("POST public"))
+
+	// Explicit options win over the config
+	_, err = c.Publish("mytopic", "hi", client.WithBearerToken("tk_explicit"))
+	require.Nil(t, err)
+	require.Equal(t, "Bearer tk_explicit", auth("POST mytopic"))
+	_, err = c.Publish("private", "hi", client.WithBasicAuth("ben", "benpass"))
+	require.Nil(t, err)
+	require.Equal(t, util.BasicAuth("ben", "benpass"), auth("POST private"))
+	_, err = c.Poll("mytopic", client.WithEmptyAuth())
+	require.Nil(t, err)
+	require.Equal(t, "", auth("GET mytopic"))
+
+	// Default token takes precedence over the default user
+	conf.DefaultToken = "tk_default"
+	_, err = c.Publish("mytopic", "hi")
+	require.Nil(t, err)
+	require.Equal(t, "Bearer tk_default", auth("POST mytopic"))
+}
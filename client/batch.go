@@ -0,0 +1,82 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrBatchIncomplete is returned by PublishBatch if at least one message could not be published
+var ErrBatchIncomplete = errors.New("not all messages could be published")
+
+// PublishRequest is a message to publish with PublishBatch
+type PublishRequest struct {
+	// Topic is the topic to publish to, see Publish for the accepted formats.
+	Topic string
+	// Message is the message body.
+	Message string
+	// Options are the publish options of the message, e.g. WithTitle or WithPriority.
+	Options []PublishOption
+}
+
+// PublishResult is the result of publishing a message with PublishBatch
+type PublishResult struct {
+	// Message is the published message, or nil if publishing failed.
+	Message *Message
+	// Err is the error if publishing failed, e.g. an *Error if the server rejected the message.
+	Err error
+}
+
+// PublishBatch publishes many messages concurrently, with up to Config.PublishParallelism requests at a time.
+// Each message is published like with Publish, and a failed message does not stop the others. The results are
+// returned in the order of the requests.
+//
+// Parameters:
+//   - requests: The messages to publish.
+//
+// Returns:
+//   - The result of each message, and ErrBatchIncomplete (with the number of failed messages) if at least
+//     one message could not be published. Check PublishResult.Err for the individual errors.
+//
+// Example:
+//
+//	results, err := c.PublishBatch([]client.PublishRequest{
+//	  {Topic: "alerts", Message: "disk full", Options: []client.PublishOption{client.WithPriority("high")}},
+//	  {Topic: "backups", Message: "backup done"},
+//	})
+func (c *Client) PublishBatch(requests []PublishRequest) ([]PublishResult, error) {
+	parallelism := c.config.PublishParallelism
+	if parallelism <= 0 {
+		parallelism = DefaultPublishParallelism
+	}
+	results := make([]PublishResult, len(requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism && i < len(requests); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				r := requests[index]
+				m, err := c.Publish(r.Topic, r.Message, r.Options...)
+				results[index] = PublishResult{Message: m, Err: err}
+			}
+		}()
+	}
+	for i := range requests {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		c.config.Logger.Debug("Batch publish: %d of %d message(s) failed", failed, len(requests))
+		return results, fmt.Errorf("%w: %d of %d message(s) failed", ErrBatchIncomplete, failed, len(requests))
+	}
+	return results, nil
+}
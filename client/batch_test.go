@@ -0,0 +1,81 @@
+package client_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestClient_PublishBatch(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	requests := make([]client.PublishRequest, 0)
+	for i := 0; i < 20; i++ {
+		requests = append(requests, client.PublishRequest{Topic: "mytopic", Message: fmt.Sprintf("message %d", i)})
+	}
+	requests[5] = client.PublishRequest{Topic: "invalid topic", Message: "fails"}
+	requests[7].Options = []client.PublishOption{client.WithPriority("invalid")}
+	requests[9].Options = []client.PublishOption{client.WithTitle("a title"), client.WithPriority("high")}
+
+	results, err := c.PublishBatch(requests)
+	require.ErrorIs(t, err, client.ErrBatchIncomplete)
+	require.ErrorContains(t, err, "2 of 20 message(s) failed")
+	require.Equal(t, 20, len(results))
+	for i, result := range results {
+		if i == 5 || i == 7 {
+			require.Error(t, result.Err)
+			require.Nil(t, result.Message)
+			continue
+		}
+		require.Nil(t, result.Err)
+		require.Equal(t, fmt.Sprintf("message %d", i), result.Message.Message) // Same order as the requests
+	}
+	var httpErr *client.Error
+	require.True(t, errors.As(results[7].Err, &httpErr))
+	require.Equal(t, 40007, httpErr.Code)
+	require.Equal(t, "a title", results[9].Message.Title)
+
+	messages, err := c.Poll("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 18, len(messages))
+
+	results, err = c.PublishBatch(nil)
+	require.Nil(t, err)
+	require.Empty(t, results)
+}
+
+func TestClient_PublishBatch_Parallelism(t *testing.T) {
+	var current, max atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := current.Add(1); n > max.Load() {
+			max.Store(n)
+		}
+		time.Sleep(50 * time.Millisecond)
+		current.Add(-1)
+		w.Write([]byte(`{"id":"abcdefghijkl","time":1700000000,"event":"message","topic":"mytopic","message":"ok"}`))
+	}))
+	defer server.Close()
+
+	conf := client.NewConfig()
+	conf.PublishParallelism = 3
+	c := client.New(conf)
+	requests := make([]client.PublishRequest, 10)
+	for i := range requests {
+		requests[i] = client.PublishRequest{Topic: server.URL + "/mytopic", Message: "ok"}
+	}
+	results, err := c.PublishBatch(requests)
+	require.Nil(t, err)
+	require.Equal(t, 10, len(results))
+	require.LessOrEqual(t, max.Load(), int32(3))
+	require.Greater(t, max.Load(), int32(1))
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Capabilities advertised by the server via /v1/capabilities, see Client.Capabilities
+const (
+	CapabilityAttachments   = "attachments"
+	CapabilityEmail         = "email"
+	CapabilityCalls         = "calls"
+	CapabilityMarkdown      = "markdown"
+	CapabilityTemplates     = "templates"
+	CapabilityActions       = "actions"
+	CapabilityScheduled     = "scheduled"
+	CapabilityWebPush       = "web-push"
+	CapabilityAccessControl = "access-control"
+	CapabilityChunked       = "chunked"
+	CapabilityUploads       = "uploads"
+)
+
+const (
+	capabilitiesPath = "/v1/capabilities"
+)
+
+// capabilityHeaders maps publish headers to the capability the server needs to handle them. If the server
+// does not advertise the capability, the header is removed before publishing, see Client.PublishReader.
+var capabilityHeaders = map[string]string{
+	"X-Email":    CapabilityEmail,
+	"X-Call":     CapabilityCalls,
+	"X-Markdown": CapabilityMarkdown,
+	"X-Template": CapabilityTemplates,
+	"X-Actions":  CapabilityActions,
+	"X-Delay":    CapabilityScheduled,
+}
+
+// Capabilities describes the features supported by a server, as returned by Client.Capabilities
+type Capabilities struct {
+	// Version is the version of the server, if it reports it.
+	Version string `json:"version"`
+	// Capabilities is the list of supported features, e.g. CapabilityAttachments.
+	Capabilities []string `json:"capabilities"`
+	// MessageSizeLimit is the max size of a message body in bytes; larger bodies are treated as attachments.
+	MessageSizeLimit int `json:"message_size_limit"`
+	// MessageChunkedSizeLimit is the max size of a message published in chunks, see CapabilityChunked.
+	MessageChunkedSizeLimit int `json:"message_chunked_size_limit"`
+	// WebPushPublicKey is the VAPID public key of the server, if it supports Web Push, see CapabilityWebPush.
+	WebPushPublicKey string `json:"web_push_public_key"`
+
+	advertised bool // False for servers that do not support capability negotiation (older servers)
+}
+
+// Has returns true if the server supports the given capability. Servers that do not advertise their
+// capabilities (older servers) are assumed to support everything, so that requests are sent unchanged.
+func (c *Capabilities) Has(capability string) bool {
+	if !c.advertised {
+		return true
+	}
+	return util.Contains(c.Capabilities, capability)
+}
+
+// Advertised returns true if the server advertised its capabilities, i.e. if it supports capability negotiation
+func (c *Capabilities) Advertised() bool {
+	return c.advertised
+}
+
+// Capabilities queries the features supported by the server of the given topic. The result is cached per
+// server for the lifetime of the client. If the server does not support capability negotiation (e.g. because
+// it is older), the returned Capabilities report every capability as supported, see Capabilities.Has.
+//
+// A topic can be either a full URL, a short URL or a short name, see Subscribe for details.
+//
+// Parameters:
+//   - topic: A topic on the server to query, e.g. "mytopic" or "https://ntfy.sh/mytopic".
+//
+// Returns:
+//   - The capabilities of the server, or an error if the server could not be reached.
+func (c *Client) Capabilities(topic string) (*Capabilities, error) {
+	topicURL, err := c.expandTopicURL(topic)
+	if err != nil {
+		return nil, err
+	}
+	return c.capabilitiesForTopicURL(topicURL)
+}
+
+func (c *Client) capabilitiesForTopicURL(topicURL string) (*Capabilities, error) {
+	return c.capabilitiesForBaseURL(topicURL[:strings.LastIndex(topicURL, "/")])
+}
+
+func (c *Client) capabilitiesForBaseURL(baseURL string) (*Capabilities, error) {
+	c.mu.Lock()
+	capabilities, ok := c.capabilities[baseURL]
+	c.mu.Unlock()
+	if ok {
+		return capabilities, nil
+	}
+	capabilities, err := fetchCapabilities(c.httpClient, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.capabilities[baseURL] = capabilities
+	c.mu.Unlock()
+	return capabilities, nil
+}
+
+func fetchCapabilities(httpClient *http.Client, baseURL string) (*Capabilities, error) {
+	resp, err := httpClient.Get(baseURL + capabilitiesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return &Capabilities{}, nil // Older server, does not support negotiation
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from %s: HTTP %d", baseURL+capabilitiesPath, resp.StatusCode)
+	}
+	var capabilities Capabilities
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&capabilities); err != nil || capabilities.Capabilities == nil {
+		return &Capabilities{}, nil // Not an ntfy server, or a server that does not support negotiation
+	}
+	capabilities.advertised = true
+	return &capabilities, nil
+}
+
+// adaptToCapabilities removes the headers of req that the server of topicURL does not support (see
+// capabilityHeaders), and logs a warning for each of them. Attachments cannot be left out, so uploading
+// an attachment to a server that does not support them fails early, before the upload.
+func (c *Client) adaptToCapabilities(topicURL string, req *http.Request) error {
+	if !needsCapabilities(req) {
+		return nil
+	}
+	capabilities, err := c.capabilitiesForTopicURL(topicURL)
+	if err != nil {
+		c.config.Logger.Debug("%s Cannot determine server capabilities, publishing unchanged: %s", util.ShortTopicURL(topicURL), err.Error())
+		return nil
+	}
+	for header, capability := range capabilityHeaders {
+		if req.Header.Get(header) != "" && !capabilities.Has(capability) {
+			c.config.Logger.Warn("%s Server does not support %s, ignoring %s header", util.ShortTopicURL(topicURL), capability, header)
+			req.Header.Del(header)
+		}
+	}
+	if isAttachmentUpload(req) && !capabilities.Has(CapabilityAttachments) {
+		return errors.New("server does not support attachments")
+	}
+	return nil
+}
+
+func needsCapabilities(req *http.Request) bool {
+	for header := range capabilityHeaders {
+		if req.Header.Get(header) != "" {
+			return true
+		}
+	}
+	return isAttachmentUpload(req)
+}
+
+func isAttachmentUpload(req *http.Request) bool {
+	return req.Header.Get("X-Filename") != "" && req.Header.Get("X-Attach") == ""
+}
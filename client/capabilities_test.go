@@ -0,0 +1,81 @@
+package client_test
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_Capabilities(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	capabilities, err := c.Capabilities("mytopic")
+	require.Nil(t, err)
+	require.True(t, capabilities.Advertised())
+	require.True(t, capabilities.Has(client.CapabilityAttachments))
+	require.True(t, capabilities.Has(client.CapabilityMarkdown))
+	require.False(t, capabilities.Has(client.CapabilityEmail))
+	require.False(t, capabilities.Has(client.CapabilityAccessControl))
+}
+
+func TestClient_Publish_AdaptToCapabilities(t *testing.T) {
+	s, err := server.New(
+		server.WithListenHTTP("127.0.0.1:0"),
+		server.WithCacheFile(filepath.Join(t.TempDir(), "cache.db")),
+	)
+	require.Nil(t, err)
+	require.Nil(t, s.Start())
+	defer s.Stop()
+	c := client.New(client.NewConfig())
+	topicURL := fmt.Sprintf("http://%s/mytopic", s.Addr().String())
+
+	// Email is not supported, so the header is left out instead of failing
+	m, err := c.Publish(topicURL, "some message", client.WithEmail("phil@example.com"), client.WithMarkdown())
+	require.Nil(t, err)
+	require.Equal(t, "some message", m.Message)
+
+	// Attachments are not supported, so the upload fails before sending the body
+	_, err = c.Publish(topicURL, "some file", client.WithFilename("file.txt"))
+	require.EqualError(t, err, "server does not support attachments")
+
+	// External attachments do not need the attachment cache
+	m, err = c.Publish(topicURL, "some message", client.WithAttach("https://example.com/file.jpg"), client.WithFilename("file.jpg"))
+	require.Nil(t, err)
+	require.Equal(t, "https://example.com/file.jpg", m.Attachment.URL)
+}
+
+func TestClient_Publish_OldServerWithoutCapabilities(t *testing.T) {
+	var capabilityRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/capabilities" {
+			capabilityRequests.Add(1)
+			http.NotFound(w, r)
+			return
+		}
+		require.Equal(t, "phil@example.com", r.Header.Get("X-Email")) // Sent unchanged
+		w.Write([]byte(`{"id":"abc","event":"message","topic":"mytopic","message":"some message"}`))
+	}))
+	defer server.Close()
+	c := client.New(client.NewConfig())
+
+	for i := 0; i < 2; i++ {
+		m, err := c.Publish(server.URL+"/mytopic", "some message", client.WithEmail("phil@example.com"))
+		require.Nil(t, err)
+		require.Equal(t, "some message", m.Message)
+	}
+	require.Equal(t, int32(1), capabilityRequests.Load()) // Cached
+
+	capabilities, err := c.Capabilities(server.URL + "/mytopic")
+	require.Nil(t, err)
+	require.False(t, capabilities.Advertised())
+	require.True(t, capabilities.Has(client.CapabilityEmail))
+}
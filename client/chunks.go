@@ -0,0 +1,75 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"heckel.io/ntfy/v2/util"
+)
+
+const (
+	chunkIDLength = 16
+
+	// chunkThreshold is the default message size limit of the server. Messages up to this size are always
+	// published as is, so that capabilities only need to be queried for larger messages.
+	chunkThreshold = 4096
+)
+
+// chunkedCapabilities returns the capabilities of the server if the message should be published in chunks, or nil
+// if it should be published in one piece, because it is small enough, the server does not support chunked messages
+// (see CapabilityChunked), the message is too large even for chunks, or the message is an attachment upload.
+func (c *Client) chunkedCapabilities(topic, message string, options []PublishOption) *Capabilities {
+	if len(message) <= chunkThreshold {
+		return nil
+	}
+	topicURL, err := c.expandTopicURL(topic)
+	if err != nil {
+		return nil
+	}
+	req, err := http.NewRequest("POST", topicURL, nil)
+	if err != nil {
+		return nil
+	}
+	for _, option := range options {
+		if err := option(req); err != nil {
+			return nil
+		}
+	}
+	if isAttachmentUpload(req) || req.Header.Get("X-Attach") != "" {
+		return nil
+	}
+	capabilities, err := c.capabilitiesForTopicURL(topicURL)
+	if err != nil || !capabilities.Advertised() || !capabilities.Has(CapabilityChunked) {
+		return nil
+	} else if capabilities.MessageSizeLimit <= 0 || len(message) <= capabilities.MessageSizeLimit || len(message) > capabilities.MessageChunkedSizeLimit {
+		return nil
+	}
+	return capabilities
+}
+
+// publishChunked splits the message into chunks of the server's message size limit, and publishes them with a
+// random chunk ID. The options are passed along with every chunk. The server publishes the reassembled message
+// when the last chunk arrives, and returns it in the response to that chunk.
+func (c *Client) publishChunked(topic, message string, capabilities *Capabilities, options []PublishOption) (*Message, error) {
+	id := util.RandomString(chunkIDLength)
+	chunkSize := capabilities.MessageSizeLimit
+	count := (len(message) + chunkSize - 1) / chunkSize
+	responseLimit := 6*capabilities.MessageChunkedSizeLimit + maxResponseBytes // JSON escaping grows each byte by up to 6x
+	c.config.Logger.Debug("%s Publishing message of %d bytes in %d chunks", util.ShortTopicURL(topic), len(message), count)
+	var m *Message
+	for i := 0; i < count; i++ {
+		chunk := message[i*chunkSize : min((i+1)*chunkSize, len(message))]
+		chunkOptions := append(options[:len(options):len(options)],
+			WithHeader("X-Chunk-ID", id),
+			WithHeader("X-Chunk-Index", strconv.Itoa(i+1)),
+			WithHeader("X-Chunk-Count", strconv.Itoa(count)),
+		)
+		var err error
+		m, err = c.publishReader(topic, strings.NewReader(chunk), responseLimit, chunkOptions...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -7,10 +7,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/quic-go/quic-go/http3"
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/util"
 	"io"
 	"net/http"
+	"os"
+	"path"
 	"regexp"
 	"strings"
 	"sync"
@@ -22,20 +25,40 @@ const (
 	MessageEvent = "message"
 )
 
+// Transports used by Subscribe and Poll, see WithTransport
+const (
+	// TransportJSON receives messages via a streaming HTTP connection (default).
+	TransportJSON = "json"
+	// TransportWS receives messages via a WebSocket connection.
+	TransportWS = "ws"
+)
+
 const (
 	maxResponseBytes = 4096
+	longPollParam    = "wait" // See WithLongPoll
 )
 
 var (
-	topicRegex = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`) // Same as in server/server.go
+	topicRegex          = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`) // Same as in server/server.go
+	errKeepaliveTimeout = errors.New("no keepalive received")
 )
 
+// ErrClientClosed is returned when subscribing with a client that was closed, see Client.Close
+var ErrClientClosed = errors.New("client is closed")
+
 // Client is the ntfy client that can be used to publish and subscribe to ntfy topics.
 type Client struct {
 	// Messages is a channel that receives new messages for subscribed topics.
 	Messages      chan *Message
 	config        *Config
 	subscriptions map[string]*subscription
+	capabilities  map[string]*Capabilities // Server base URL -> capabilities, see Capabilities
+	httpClient    *http.Client
+	queue         *publishQueue // Only set if Config.QueueDir is set
+	stats         *clientStats   // See Stats
+	closed        bool           // True after Close, protected by mu
+	done          chan struct{}  // Closed by Close
+	wg            sync.WaitGroup // Running subscriptions, see Close
 	mu            sync.Mutex
 }
 
@@ -63,6 +86,19 @@ type Message struct { // TODO combine with server.message
 	Icon       string
 	// Attachment contains information about an attachment, if present.
 	Attachment *Attachment
+	// Actions is a list of action buttons, if present (see https://ntfy.sh/docs/publish/#action-buttons).
+	Actions    []*Action
+	// ContentType is the content type of the message body, empty for plain text, or "text/markdown".
+	ContentType string `json:"content_type"`
+	// Markdown is true if the message body is formatted as Markdown, i.e. if ContentType is "text/markdown".
+	Markdown   bool `json:"-"`
+	// Expires is the time at which the message is deleted from the server cache, 0 if it is not cached.
+	Expires    int64
+	// Metadata contains the custom key/value fields of the message, if any (see WithMetadata).
+	Metadata   map[string]string
+	// Resume is the opaque resume token of the message, which can be passed to WithSince to continue right after
+	// this message. It is only set for messages received by subscriptions and polls, and empty for older servers.
+	Resume     string
 
 	// Additional fields
 	
@@ -72,6 +108,9 @@ type Message struct { // TODO combine with server.message
 	SubscriptionID string
 	// Raw is the raw JSON representation of the message.
 	Raw            string
+
+	httpClient    *http.Client // HTTP client the message was received with, see DownloadAttachment
+	authorization string       // Authorization header the message was received with, see DownloadAttachment
 }
 
 // Attachment represents a message attachment.
@@ -90,6 +129,30 @@ type Attachment struct {
 	Owner   string `json:"-"` 
 }
 
+// Action represents an action button of a message.
+type Action struct {
+	// ID is the unique identifier of the action.
+	ID      string            `json:"id"`
+	// Action is the type of the action: "view", "broadcast" or "http".
+	Action  string            `json:"action"`
+	// Label is the label of the action button.
+	Label   string            `json:"label"`
+	// Clear is true if the notification should be cleared after the action was executed successfully.
+	Clear   bool              `json:"clear"`
+	// URL is the URL to open ("view") or to send the request to ("http").
+	URL     string            `json:"url,omitempty"`
+	// Method is the HTTP method of an "http" action, POST if empty.
+	Method  string            `json:"method,omitempty"`
+	// Headers are the HTTP headers of an "http" action.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is the HTTP body of an "http" action.
+	Body    string            `json:"body,omitempty"`
+	// Intent is the Android intent name of a "broadcast" action.
+	Intent  string            `json:"intent,omitempty"`
+	// Extras are the Android intent extras of a "broadcast" action.
+	Extras  map[string]string `json:"extras,omitempty"`
+}
+
 type subscription struct {
 	ID       string
 	topicURL string
@@ -104,16 +167,68 @@ type subscription struct {
 // Returns:
 //   - A new Client instance.
 func New(config *Config) *Client {
-	return &Client{
+	stats := newClientStats(config.StatsHook)
+	c := &Client{
 		Messages:      make(chan *Message, 50), // Allow reading a few messages
 		config:        config,
 		subscriptions: make(map[string]*subscription),
+		capabilities:  make(map[string]*Capabilities),
+		httpClient:    newHTTPClient(config, stats),
+		stats:         stats,
+		done:          make(chan struct{}),
+	}
+	if config.QueueDir != "" {
+		c.queue = newPublishQueue(c, config.QueueDir)
+	}
+	return c
+}
+
+// newHTTPClient returns the HTTP client used for all requests, a copy of Config.HTTPClient if set. The transport is
+// Config.Transport if set, or the transport of Config.HTTPClient. Otherwise, if Config.HTTP3 is set, requests are
+// sent via HTTP/3 (QUIC), which only works for https:// servers that listen for HTTP/3. The TLS settings (see
+// Config.TLSConfig) only apply to the latter two cases; if they are invalid, all requests fail. Requests to unix://
+// URLs are always sent via the Unix socket (see unixTransport). If Config.TraceWriter is set, all requests and
+// responses are dumped to it. The body bytes of all requests and responses are counted in stats.
+func newHTTPClient(config *Config, stats *clientStats) *http.Client {
+	httpClient := &http.Client{}
+	if config.HTTPClient != nil {
+		*httpClient = *config.HTTPClient
+	}
+	transport := httpClient.Transport
+	if config.Transport != nil {
+		transport = config.Transport
+	} else if transport == nil {
+		tlsConfig, err := config.TLSConfig()
+		if err != nil {
+			transport = &errorTransport{err: err}
+		} else if config.HTTP3 {
+			transport = &http3.Transport{TLSClientConfig: tlsConfig}
+		} else if tlsConfig != nil {
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.TLSClientConfig = tlsConfig
+			transport = t
+		} else {
+			transport = http.DefaultTransport
+		}
 	}
+	transport = newUnixTransport(transport)
+	if config.TraceWriter != nil {
+		transport = newTracingTransport(transport, config.TraceWriter)
+	}
+	httpClient.Transport = newStatsTransport(transport, stats)
+	return httpClient
 }
 
 // Publish sends a message to a specific topic, optionally using options.
 // See PublishReader for details.
 //
+// If the message is larger than the message size limit of the server, and the server supports chunked messages
+// (see CapabilityChunked), the message is split into chunks that the server reassembles, so that it is delivered
+// as a regular message rather than as an attachment.
+//
+// If Config.QueueDir is set and the server cannot be reached (or responds with a 5xx error), the message is
+// written to the queue directory and retried in the background, and the error wraps ErrQueued, see QueueDir.
+//
 // Parameters:
 //   - topic: The topic to publish to.
 //   - message: The message content.
@@ -122,6 +237,11 @@ func New(config *Config) *Client {
 // Returns:
 //   - The published Message object, or an error if the request failed.
 func (c *Client) Publish(topic, message string, options ...PublishOption) (*Message, error) {
+	if capabilities := c.chunkedCapabilities(topic, message, options); capabilities != nil {
+		return c.publishChunked(topic, message, capabilities, options)
+	} else if c.queue != nil {
+		return c.publishOrQueue(topic, message, options)
+	}
 	return c.PublishReader(topic, strings.NewReader(message), options...)
 }
 
@@ -134,44 +254,95 @@ func (c *Client) Publish(topic, message string, options ...PublishOption) (*Mess
 // To pass title, priority and tags, check out WithTitle, WithPriority, WithTagsList, WithDelay, WithNoCache,
 // WithNoFirebase, and the generic WithHeader.
 //
+// To retry the request if the server cannot be reached, use WithRetry. The body must be an io.Seeker
+// (e.g. a file) or a *strings.Reader, *bytes.Reader or *bytes.Buffer, so it can be sent again.
+//
+// Options that require a server feature (e.g. WithEmail or WithMarkdown) are left out if the server advertises
+// that it does not support the feature, see Capabilities.
+//
 // Parameters:
 //   - topic: The topic to publish to.
 //   - body: The message body as an io.Reader.
 //   - options: Optional configuration for the publish request.
 //
 // Returns:
-//   - The published Message object, or an error if the request failed.
+//   - The published Message object, or an error if the request failed. If the server rejected the message,
+//     the error is an *Error, e.g. ErrForbidden or ErrTooManyRequests.
 func (c *Client) PublishReader(topic string, body io.Reader, options ...PublishOption) (*Message, error) {
-	topicURL, err := c.expandTopicURL(topic)
+	return c.publishReader(topic, body, maxResponseBytes, options...)
+}
+
+func (c *Client) publishReader(topic string, body io.Reader, responseLimit int, options ...PublishOption) (*Message, error) {
+	req, topicURL, err := c.newPublishRequest(topic, body, options)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("POST", topicURL, body)
+	return c.sendPublishRequest(req, topicURL, responseLimit)
+}
+
+// newPublishRequest creates the request to publish a message, with all options applied
+func (c *Client) newPublishRequest(topic string, body io.Reader, options []PublishOption) (req *http.Request, topicURL string, err error) {
+	topicURL, err = c.expandTopicURL(topic)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	options = c.withConfigAuth(topicURL, options)
+	req, err = http.NewRequest("POST", topicURL, body)
+	if err != nil {
+		return nil, "", err
+	}
+	if f, ok := body.(*os.File); ok && req.ContentLength == 0 {
+		if stat, err := f.Stat(); err == nil && stat.Mode().IsRegular() {
+			req.ContentLength = stat.Size() // Allows the server to reject files that are too large early
+		}
 	}
 	for _, option := range options {
 		if err := option(req); err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
-	log.Debug("%s Publishing message with headers %s", util.ShortTopicURL(topicURL), req.Header)
-	resp, err := http.DefaultClient.Do(req)
+	if err := c.adaptToCapabilities(topicURL, req); err != nil {
+		return nil, "", err
+	}
+	prepareRetry(req, body)
+	return req, topicURL, nil
+}
+
+// sendPublishRequest sends a request created by newPublishRequest, and parses the published message. The
+// request is retried if it has a retry policy, see WithRetry.
+func (c *Client) sendPublishRequest(req *http.Request, topicURL string, responseLimit int) (*Message, error) {
+	if policy, ok := req.Context().Value(retryContextKey{}).(*retryPolicy); ok {
+		return c.sendPublishRequestWithRetry(req, topicURL, responseLimit, policy)
+	}
+	return c.sendPublishRequestOnce(req, topicURL, responseLimit)
+}
+
+func (c *Client) sendPublishRequestOnce(req *http.Request, topicURL string, responseLimit int) (*Message, error) {
+	httpClient, err := networkHTTPClient(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	c.config.Logger.Debug("%s Publishing message with headers %s", util.ShortTopicURL(topicURL), req.Header)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	b, err := io.ReadAll(io.LimitReader(resp.Body, int64(responseLimit)))
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New(strings.TrimSpace(string(b)))
+		return nil, newError(resp, b)
 	}
 	m, err := toMessage(string(b), topicURL, "")
 	if err != nil {
 		return nil, err
 	}
+	m.httpClient, m.authorization = httpClient, req.Header.Get("Authorization")
+	if m.Event == MessageEvent {
+		c.stats.messagePublished(topicURL) // Chunks of a chunked message are not counted
+	}
 	return m, nil
 }
 
@@ -183,34 +354,25 @@ func (c *Client) PublishReader(topic string, body io.Reader, options ...PublishO
 // config (e.g. mytopic -> https://ntfy.sh/mytopic).
 //
 // By default, all messages will be returned, but you can change this behavior using a SubscribeOption.
-// See WithSince, WithSinceAll, WithSinceUnixTime, WithScheduled, and the generic WithQueryParam.
+// See WithSince, WithSinceAll, WithSinceUnixTime, WithScheduled, WithLimit, and the generic WithQueryParam.
+// To poll topics with many messages without holding them all in memory, use PollFunc or PollPages.
+//
+// Multiple topics can be polled at once by separating them with commas, see Subscribe.
 //
 // Parameters:
-//   - topic: The topic to poll.
+//   - topic: The topic to poll, or a comma-separated list of topics.
 //   - options: Optional configuration for the poll request.
 //
 // Returns:
-//   - A list of messages, or an error if the request failed.
+//   - A list of messages, or an error if the request failed. If the server rejected the request,
+//     the error is an *Error, e.g. ErrUnauthorized or ErrForbidden.
 func (c *Client) Poll(topic string, options ...SubscribeOption) ([]*Message, error) {
-	topicURL, err := c.expandTopicURL(topic)
-	if err != nil {
-		return nil, err
-	}
-	ctx := context.Background()
 	messages := make([]*Message, 0)
-	msgChan := make(chan *Message)
-	errChan := make(chan error)
-	log.Debug("%s Polling from topic", util.ShortTopicURL(topicURL))
-	options = append(options, WithPoll())
-	go func() {
-		err := performSubscribeRequest(ctx, msgChan, topicURL, "", options...)
-		close(msgChan)
-		errChan <- err
-	}()
-	for m := range msgChan {
+	err := c.PollFunc(topic, func(m *Message) error {
 		messages = append(messages, m)
-	}
-	return messages, <-errChan
+		return nil
+	}, options...)
+	return messages, err
 }
 
 // Subscribe subscribes to a topic to listen for newly incoming messages. The method starts a connection in the
@@ -220,13 +382,17 @@ func (c *Client) Poll(topic string, options ...SubscribeOption) ([]*Message, err
 // (e.g. myhost.lan -> https://myhost.lan), or a short name which is expanded using the default host in the
 // config (e.g. mytopic -> https://ntfy.sh/mytopic).
 //
+// To subscribe to multiple topics on the same server via a single connection, separate the topics with commas
+// (e.g. mytopic1,mytopic2 or https://myhost.lan/mytopic1,mytopic2), or use SubscribeTopics. The TopicURL of
+// each received message is the URL of the topic the message was published to.
+//
 // By default, only new messages will be returned, but you can change this behavior using a SubscribeOption.
 // See WithSince, WithSinceAll, WithSinceUnixTime, WithScheduled, and the generic WithQueryParam.
 //
 // The method returns a unique subscriptionID that can be used in Unsubscribe.
 //
 // Parameters:
-//   - topic: The topic to subscribe to.
+//   - topic: The topic to subscribe to, or a comma-separated list of topics.
 //   - options: Optional configuration for the subscription.
 //
 // Returns:
@@ -240,22 +406,46 @@ func (c *Client) Poll(topic string, options ...SubscribeOption) ([]*Message, err
 //	  fmt.Printf("New message: %s", m.Message)
 //	}
 func (c *Client) Subscribe(topic string, options ...SubscribeOption) (string, error) {
-	topicURL, err := c.expandTopicURL(topic)
+	return c.SubscribeContext(context.Background(), topic, options...)
+}
+
+// SubscribeContext subscribes to a topic like Subscribe, but ties the lifetime of the subscription to ctx: once
+// ctx is canceled, the subscription ends, just like after Unsubscribe.
+//
+// Parameters:
+//   - ctx: The context of the subscription.
+//   - topic: The topic to subscribe to, or a comma-separated list of topics.
+//   - options: Optional configuration for the subscription.
+//
+// Returns:
+//   - A subscription ID, or an error if the subscription failed (ErrClientClosed if the client was closed).
+func (c *Client) SubscribeContext(ctx context.Context, topic string, options ...SubscribeOption) (string, error) {
+	topicURL, err := c.expandTopicsURL(topic)
 	if err != nil {
 		return "", err
 	}
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	subscriptionID := util.RandomString(10)
-	log.Debug("%s Subscribing to topic", util.ShortTopicURL(topicURL))
-	ctx, cancel := context.WithCancel(context.Background())
-	c.subscriptions[subscriptionID] = &subscription{
-		ID:       subscriptionID,
-		topicURL: topicURL,
-		cancel:   cancel,
+	c.config.Logger.Debug("%s Subscribing to topic", util.ShortTopicURL(topicURL))
+	options = c.withConfigAuth(topicURL, options)
+	return c.startSubscription(ctx, topicURL, func(ctx context.Context, subscriptionID string, stats *subscriptionStats) {
+		handleSubscribeConnLoop(ctx, c.httpClient, c.config.Logger, c.Messages, c.config.Middlewares, stats, topicURL, subscriptionID, c.keepaliveTimeout(), options...)
+	})
+}
+
+// SubscribeTopics subscribes to multiple topics via a single connection, see Subscribe. All topics must be
+// on the same server.
+//
+// Parameters:
+//   - topics: The topics to subscribe to, in any of the formats accepted by Subscribe.
+//   - options: Optional configuration for the subscription.
+//
+// Returns:
+//   - A subscription ID, or an error if the subscription failed.
+func (c *Client) SubscribeTopics(topics []string, options ...SubscribeOption) (string, error) {
+	topic, err := c.joinTopics(topics)
+	if err != nil {
+		return "", err
 	}
-	go handleSubscribeConnLoop(ctx, c.Messages, topicURL, subscriptionID, options...)
-	return subscriptionID, nil
+	return c.Subscribe(topic, options...)
 }
 
 // Unsubscribe unsubscribes from a topic that has been previously subscribed to using the unique
@@ -274,8 +464,77 @@ func (c *Client) Unsubscribe(subscriptionID string) {
 	sub.cancel()
 }
 
+// Close cancels all subscriptions and waits for them to end, including the handlers of SubscribeFunc that are still
+// running. It then closes the Messages channel; messages that were received before can still be read from it.
+// Queued messages (see Config.QueueDir) are no longer retried, but stay in the queue directory.
+//
+// After Close, subscribing returns ErrClientClosed. Publishing is still possible. Calling Close more than once
+// has no effect.
+//
+// Returns:
+//   - Always nil; the error is returned to satisfy io.Closer.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	for subscriptionID, sub := range c.subscriptions {
+		delete(c.subscriptions, subscriptionID)
+		sub.cancel()
+	}
+	close(c.done)
+	c.mu.Unlock()
+	c.wg.Wait()
+	close(c.Messages)
+	return nil
+}
+
+// startSubscription registers a new subscription and calls run in a goroutine. The context passed to run is
+// derived from ctx, and is canceled by Unsubscribe and Close. The subscription (and its stats) is removed once run
+// returns.
+func (c *Client) startSubscription(ctx context.Context, topicURL string, run func(ctx context.Context, subscriptionID string, stats *subscriptionStats)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return "", ErrClientClosed
+	}
+	subscriptionID := util.RandomString(10)
+	ctx, cancel := context.WithCancel(ctx)
+	c.subscriptions[subscriptionID] = &subscription{
+		ID:       subscriptionID,
+		topicURL: topicURL,
+		cancel:   cancel,
+	}
+	stats := c.stats.addSubscription(subscriptionID, topicURL)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer c.stats.removeSubscription(subscriptionID)
+		run(ctx, subscriptionID, stats)
+		cancel()
+		c.mu.Lock()
+		delete(c.subscriptions, subscriptionID) // No-op after Unsubscribe or Close
+		c.mu.Unlock()
+	}()
+	return subscriptionID, nil
+}
+
+// TopicURL expands a topic to a full topic URL, e.g. mytopic -> https://ntfy.sh/mytopic. See Subscribe for
+// the accepted formats.
+//
+// Parameters:
+//   - topic: The topic name, short URL or full URL.
+//
+// Returns:
+//   - The full topic URL, or an error if the topic name is invalid.
+func (c *Client) TopicURL(topic string) (string, error) {
+	return c.expandTopicURL(topic)
+}
+
 func (c *Client) expandTopicURL(topic string) (string, error) {
-	if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") {
+	if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") || isUnixURL(topic) {
 		return topic, nil
 	} else if strings.Contains(topic, "/") {
 		return fmt.Sprintf("https://%s", topic), nil
@@ -286,59 +545,205 @@ func (c *Client) expandTopicURL(topic string) (string, error) {
 	return fmt.Sprintf("%s/%s", c.config.DefaultHost, topic), nil
 }
 
-func handleSubscribeConnLoop(ctx context.Context, msgChan chan *Message, topicURL, subcriptionID string, options ...SubscribeOption) {
+// expandTopicsURL is like expandTopicURL, but also accepts a comma-separated list of topics on the same
+// server, e.g. mytopic1,mytopic2 -> https://ntfy.sh/mytopic1,mytopic2
+func (c *Client) expandTopicsURL(topics string) (string, error) {
+	if !strings.Contains(topics, ",") {
+		return c.expandTopicURL(topics)
+	} else if strings.Contains(topics, "/") {
+		topicURL, err := c.expandTopicURL(topics) // Full or short URL, e.g. https://myhost.lan/mytopic1,mytopic2
+		if err != nil {
+			return "", err
+		}
+		for _, name := range strings.Split(topicURL[strings.LastIndex(topicURL, "/")+1:], ",") {
+			if !topicRegex.MatchString(name) {
+				return "", fmt.Errorf("invalid topic name: %s", name)
+			}
+		}
+		return topicURL, nil
+	}
+	return c.joinTopics(strings.Split(topics, ","))
+}
+
+// joinTopics expands the topics and joins them into a single multi-topic URL. All topics must be on the same
+// server, e.g. [mytopic1, https://ntfy.sh/mytopic2] -> https://ntfy.sh/mytopic1,mytopic2
+func (c *Client) joinTopics(topics []string) (string, error) {
+	if len(topics) == 0 {
+		return "", errors.New("no topics given")
+	}
+	var baseURL string
+	names := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		topicURL, err := c.expandTopicURL(strings.TrimSpace(topic))
+		if err != nil {
+			return "", err
+		}
+		i := strings.LastIndex(topicURL, "/")
+		base, name := topicURL[:i], topicURL[i+1:]
+		if !topicRegex.MatchString(name) {
+			return "", fmt.Errorf("invalid topic name: %s", name)
+		} else if baseURL != "" && base != baseURL {
+			return "", fmt.Errorf("topics must be on the same server: %s, %s", baseURL, base)
+		}
+		baseURL = base
+		names = append(names, name)
+	}
+	return fmt.Sprintf("%s/%s", baseURL, strings.Join(names, ",")), nil
+}
+
+// messageTopicURL returns the URL of the topic a message was published to. For multi-topic subscriptions
+// (e.g. https://ntfy.sh/mytopic1,mytopic2), this is the URL of the message's topic (e.g. https://ntfy.sh/mytopic2).
+func messageTopicURL(topicURL, topic string) string {
+	i := strings.LastIndex(topicURL, "/")
+	if i == -1 || !strings.Contains(topicURL[i+1:], ",") || !topicRegex.MatchString(topic) {
+		return topicURL
+	}
+	return fmt.Sprintf("%s/%s", topicURL[:i], topic)
+}
+
+// keepaliveTimeout returns the keepalive timeout for subscriptions, or 0 if it is disabled, see Config.KeepaliveTimeout
+func (c *Client) keepaliveTimeout() time.Duration {
+	if c.config.KeepaliveTimeout < 0 {
+		return 0
+	} else if c.config.KeepaliveTimeout == 0 {
+		return DefaultKeepaliveTimeout
+	}
+	return c.config.KeepaliveTimeout
+}
+
+func handleSubscribeConnLoop(ctx context.Context, httpClient *http.Client, logger *log.Logger, msgChan chan *Message, middlewares []MessageMiddleware, stats *subscriptionStats, topicURL, subcriptionID string, keepaliveTimeout time.Duration, options ...SubscribeOption) {
+	var cursor string // Resume token (or ID) of the last received message, used as since marker when reconnecting
 	for {
-		// TODO The retry logic is crude and may lose messages. It should record the last message like the
-		//      Android client, use since=, and do incremental backoff too
-		if err := performSubscribeRequest(ctx, msgChan, topicURL, subcriptionID, options...); err != nil {
-			log.Warn("%s Connection failed: %s", util.ShortTopicURL(topicURL), err.Error())
+		longPoll, err := performSubscribeRequest(ctx, httpClient, logger, msgChan, middlewares, stats, topicURL, subcriptionID, &cursor, keepaliveTimeout, options...)
+		if errors.Is(err, errKeepaliveTimeout) && ctx.Err() == nil {
+			logger.Warn("%s No keepalive received within %s, reconnecting", util.ShortTopicURL(topicURL), keepaliveTimeout)
+			stats.reconnected(err)
+			continue // Reconnect immediately, the connection was likely dropped silently
+		} else if err != nil {
+			logger.Warn("%s Connection failed: %s", util.ShortTopicURL(topicURL), err.Error())
+		} else if longPoll && ctx.Err() == nil {
+			continue // Immediately start the next long poll request
 		}
 		select {
 		case <-ctx.Done():
-			log.Info("%s Connection exited", util.ShortTopicURL(topicURL))
+			logger.Info("%s Connection exited", util.ShortTopicURL(topicURL))
 			return
 		case <-time.After(10 * time.Second): // TODO Add incremental backoff
+			stats.reconnected(err)
 		}
 	}
 }
 
-func performSubscribeRequest(ctx context.Context, msgChan chan *Message, topicURL string, subscriptionID string, options ...SubscribeOption) error {
+// performSubscribeRequest performs a single subscribe (or poll) request, and sends the received messages to msgChan,
+// after passing them through the middlewares (see MessageMiddleware). Received messages are counted in stats.
+// If cursor is set, it is the resume token (see Message.Resume) of the last received message: it is used as since
+// marker, so that a subscription continues exactly where the previous connection left off, and it is updated with
+// each received message. For long poll requests (see WithLongPoll) without a cursor, only new messages are
+// requested, just like for streaming subscriptions. The returned bool is true if the request was a long poll request.
+//
+// If keepaliveTimeout is set, streaming requests are canceled with errKeepaliveTimeout if nothing was received
+// within that time, not even a keepalive event (see Config.KeepaliveTimeout). Poll requests are not affected.
+func performSubscribeRequest(ctx context.Context, httpClient *http.Client, logger *log.Logger, msgChan chan *Message, middlewares []MessageMiddleware, stats *subscriptionStats, topicURL string, subscriptionID string, cursor *string, keepaliveTimeout time.Duration, options ...SubscribeOption) (bool, error) {
 	streamURL := fmt.Sprintf("%s/json", topicURL)
-	log.Debug("%s Listening to %s", util.ShortTopicURL(topicURL), streamURL)
+	logger.Debug("%s Listening to %s", util.ShortTopicURL(topicURL), streamURL)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
 	for _, option := range options {
 		if err := option(req); err != nil {
-			return err
+			return false, err
 		}
 	}
-	resp, err := http.DefaultClient.Do(req)
+	httpClient, err = networkHTTPClient(httpClient, req)
 	if err != nil {
-		return err
+		return false, err
+	}
+	q := req.URL.Query()
+	longPoll := cursor != nil && q.Get(longPollParam) != ""
+	if cursor != nil && *cursor != "" {
+		q.Set("since", *cursor)
+		req.URL.RawQuery = q.Encode()
+	} else if longPoll && q.Get("since") == "" {
+		q.Set("since", "none")
+		req.URL.RawQuery = q.Encode()
+	}
+	if path.Base(req.URL.Path) == TransportWS {
+		if longPoll {
+			return false, errors.New("long polling cannot be used with the WebSocket transport")
+		}
+		return false, performWebSocketRequest(ctx, httpClient, logger, msgChan, middlewares, stats, req, topicURL, subscriptionID, cursor, keepaliveTimeout)
+	}
+	limit, delivered := pollLimit(req), 0
+	var watchdog *time.Timer
+	if keepaliveTimeout > 0 && !longPoll && q.Get("poll") == "" {
+		watchdog = time.AfterFunc(keepaliveTimeout, func() {
+			cancel(errKeepaliveTimeout)
+		})
+		defer watchdog.Stop()
+	}
+	resp, err := httpClient.Do(req)
+	if errors.Is(context.Cause(ctx), errKeepaliveTimeout) {
+		return longPoll, errKeepaliveTimeout
+	} else if err != nil {
+		return longPoll, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
 		if err != nil {
-			return err
+			return longPoll, err
 		}
-		return errors.New(strings.TrimSpace(string(b)))
+		return longPoll, newError(resp, b)
 	}
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
+		if watchdog != nil {
+			watchdog.Stop() // Restarted below, so that slow consumers of msgChan don't trigger it
+		}
 		messageJSON := scanner.Text()
 		m, err := toMessage(messageJSON, topicURL, subscriptionID)
 		if err != nil {
-			return err
+			return longPoll, err
 		}
-		log.Trace("%s Message received: %s", util.ShortTopicURL(topicURL), messageJSON)
+		m.httpClient, m.authorization = httpClient, req.Header.Get("Authorization")
+		logger.Trace("%s Message received: %s", util.ShortTopicURL(topicURL), messageJSON)
 		if m.Event == MessageEvent {
-			msgChan <- m
+			updateCursor(cursor, m)
+			if m = applyMiddlewares(logger, middlewares, m); m != nil {
+				stats.messageReceived(m.TopicURL)
+				select {
+				case msgChan <- m:
+				case <-ctx.Done():
+					return longPoll, nil // Unsubscribed while blocked, see Client.Close
+				}
+				if delivered++; limit > 0 && delivered >= limit {
+					return longPoll, nil // Closes the connection, see WithLimit
+				}
+			}
+		}
+		if watchdog != nil {
+			watchdog.Reset(keepaliveTimeout)
 		}
 	}
-	return nil
+	if errors.Is(context.Cause(ctx), errKeepaliveTimeout) {
+		return longPoll, errKeepaliveTimeout
+	}
+	return longPoll, nil
+}
+
+// updateCursor sets the cursor (if any) to the resume token of the message, or to its ID if the server did not send
+// a token (older servers)
+func updateCursor(cursor *string, m *Message) {
+	if cursor == nil {
+		return
+	} else if m.Resume != "" {
+		*cursor = m.Resume
+	} else {
+		*cursor = m.ID
+	}
 }
 
 func toMessage(s, topicURL, subscriptionID string) (*Message, error) {
@@ -346,8 +751,15 @@ func toMessage(s, topicURL, subscriptionID string) (*Message, error) {
 	if err := json.NewDecoder(strings.NewReader(s)).Decode(&m); err != nil {
 		return nil, err
 	}
-	m.TopicURL = topicURL
+	m.TopicURL = messageTopicURL(topicURL, m.Topic)
 	m.SubscriptionID = subscriptionID
+	m.Markdown = m.ContentType == "text/markdown"
 	m.Raw = s
 	return m, nil
 }
+
+// responseError reads the body of an unexpected server response, and returns it as an *Error
+func responseError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	return newError(resp, b)
+}
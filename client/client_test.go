@@ -1,12 +1,23 @@
 package client_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/require"
 	"heckel.io/ntfy/v2/client"
 	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/server"
 	"heckel.io/ntfy/v2/test"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -71,6 +82,103 @@ func TestClient_Publish_Subscribe(t *testing.T) {
 	require.Nil(t, msg)
 }
 
+func TestClient_Subscribe_MultipleTopics(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	subscriptionID, err := c.SubscribeTopics([]string{"mytopic1", fmt.Sprintf("http://127.0.0.1:%d/mytopic2", port)})
+	require.Nil(t, err)
+	time.Sleep(time.Second)
+
+	_, err = c.Publish("mytopic1", "message 1")
+	require.Nil(t, err)
+	_, err = c.Publish("mytopic2", "message 2")
+	require.Nil(t, err)
+	_, err = c.Publish("mytopic3", "not subscribed")
+	require.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+
+	msg := nextMessage(c)
+	require.NotNil(t, msg)
+	require.Equal(t, "message 1", msg.Message)
+	require.Equal(t, fmt.Sprintf("http://127.0.0.1:%d/mytopic1", port), msg.TopicURL)
+	require.Equal(t, subscriptionID, msg.SubscriptionID)
+	msg = nextMessage(c)
+	require.NotNil(t, msg)
+	require.Equal(t, "message 2", msg.Message)
+	require.Equal(t, fmt.Sprintf("http://127.0.0.1:%d/mytopic2", port), msg.TopicURL)
+	require.Nil(t, nextMessage(c))
+	c.Unsubscribe(subscriptionID)
+
+	messages, err := c.Poll("mytopic1,mytopic3")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "message 1", messages[0].Message)
+	require.Equal(t, "not subscribed", messages[1].Message)
+	require.Equal(t, fmt.Sprintf("http://127.0.0.1:%d/mytopic3", port), messages[1].TopicURL)
+
+	messages, err = c.Poll(fmt.Sprintf("http://127.0.0.1:%d/mytopic2,mytopic3", port))
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+}
+
+func TestClient_Subscribe_MultipleTopics_Invalid(t *testing.T) {
+	c := client.New(newTestConfig(1))
+	_, err := c.SubscribeTopics([]string{"mytopic1", "https://other.example.com/mytopic2"})
+	require.Error(t, err)
+	_, err = c.SubscribeTopics(nil)
+	require.Error(t, err)
+	_, err = c.Subscribe("mytopic1,invalid topic")
+	require.Error(t, err)
+	_, err = c.Subscribe("https://ntfy.sh/mytopic1,")
+	require.Error(t, err)
+}
+
+func TestClient_Publish_Subscribe_WebSocket(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	_, err := c.Publish("mytopic", "an old message")
+	require.Nil(t, err)
+
+	subscriptionID, err := c.Subscribe("mytopic", client.WithTransport(client.TransportWS), client.WithSinceAll())
+	require.Nil(t, err)
+	time.Sleep(time.Second)
+
+	_, err = c.Publish("mytopic", "a new message", client.WithTitle("some title"))
+	require.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+
+	msg := nextMessage(c)
+	require.NotNil(t, msg)
+	require.Equal(t, "an old message", msg.Message)
+	require.Equal(t, subscriptionID, msg.SubscriptionID)
+
+	msg = nextMessage(c)
+	require.NotNil(t, msg)
+	require.Equal(t, "a new message", msg.Message)
+	require.Equal(t, "some title", msg.Title)
+	require.Equal(t, fmt.Sprintf("http://127.0.0.1:%d/mytopic", port), msg.TopicURL)
+
+	c.Unsubscribe(subscriptionID)
+	time.Sleep(200 * time.Millisecond)
+	_, err = c.Publish("mytopic", "a message that won't be received")
+	require.Nil(t, err)
+	require.Nil(t, nextMessage(c))
+
+	// Polling via WebSocket
+	messages, err := c.Poll("mytopic", client.WithTransport(client.TransportWS))
+	require.Nil(t, err)
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, "a message that won't be received", messages[2].Message)
+
+	// Invalid combinations
+	_, err = c.Poll("mytopic", client.WithTransport("sse"))
+	require.EqualError(t, err, "invalid transport sse, must be json or ws")
+}
+
 func TestClient_Publish_Poll(t *testing.T) {
 	s, port := test.StartServer(t)
 	defer test.StopServer(t, s, port)
@@ -101,12 +209,235 @@ func TestClient_Publish_Poll(t *testing.T) {
 	require.Equal(t, "some delayed message", messages[1].Message)
 }
 
+func TestClient_Publish_Poll_MessageFields(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	msg, err := c.Publish("mytopic", "**some** message", client.WithMarkdown(),
+		client.WithActions("view, Open, https://example.com; http, Close door, https://api.example.com/door, method=PUT, body=close, headers.X-Key=abc"))
+	require.Nil(t, err)
+	require.Equal(t, "text/markdown", msg.ContentType)
+	require.True(t, msg.Markdown)
+	require.True(t, msg.Expires > time.Now().Unix())
+
+	messages, err := c.Poll("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	m := messages[0]
+	require.Equal(t, "text/markdown", m.ContentType)
+	require.True(t, m.Markdown)
+	require.Equal(t, msg.Expires, m.Expires)
+	require.Equal(t, 2, len(m.Actions))
+	require.Equal(t, "view", m.Actions[0].Action)
+	require.Equal(t, "Open", m.Actions[0].Label)
+	require.Equal(t, "https://example.com", m.Actions[0].URL)
+	require.Equal(t, "http", m.Actions[1].Action)
+	require.Equal(t, "PUT", m.Actions[1].Method)
+	require.Equal(t, "close", m.Actions[1].Body)
+	require.Equal(t, map[string]string{"X-Key": "abc"}, m.Actions[1].Headers)
+
+	msg, err = c.Publish("mytopic", "plain message")
+	require.Nil(t, err)
+	require.Equal(t, "", msg.ContentType)
+	require.False(t, msg.Markdown)
+	require.Nil(t, msg.Actions)
+}
+
+func TestClient_Publish_Chunked(t *testing.T) {
+	conf := server.NewConfig()
+	conf.MessageChunkedSizeLimit = 64 * 1024
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	message := strings.Repeat("a long line from a log file\n", 500) + "the end"
+	msg, err := c.Publish("mytopic", message, client.WithTitle("Logs"))
+	require.Nil(t, err)
+	require.Equal(t, client.MessageEvent, msg.Event)
+	require.Equal(t, "Logs", msg.Title)
+	require.Equal(t, message, msg.Message)
+	require.Nil(t, msg.Attachment)
+
+	messages, err := c.Poll("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, message, messages[0].Message)
+}
+
+func TestClient_Logger(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	var out bytes.Buffer
+	conf := newTestConfig(port)
+	conf.Logger = log.NewLogger(&out)
+	conf.Logger.SetLevel(log.DebugLevel)
+	conf.Logger.DisableDates()
+	c := client.New(conf)
+
+	_, err := c.Publish("mytopic", "some message")
+	require.Nil(t, err)
+	require.Contains(t, out.String(), fmt.Sprintf("DEBUG 127.0.0.1:%d/mytopic Publishing message with headers", port))
+}
+
+func TestClient_Transport(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	transport := &countingTransport{}
+	conf := newTestConfig(port)
+	conf.Transport = transport
+	c := client.New(conf)
+
+	_, err := c.Publish("mytopic", "some message")
+	require.Nil(t, err)
+	messages, err := c.Poll("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.True(t, transport.requests.Load() >= 2)
+}
+
+func TestClient_HTTPClient(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	transport := &countingTransport{}
+	conf := newTestConfig(port)
+	conf.HTTPClient = &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	c := client.New(conf)
+
+	_, err := c.Publish("mytopic", "some message")
+	require.Nil(t, err)
+	require.True(t, transport.requests.Load() >= 1)
+
+	// Transport takes precedence over the transport of HTTPClient
+	otherTransport := &countingTransport{}
+	conf.Transport = otherTransport
+	before := transport.requests.Load()
+	_, err = client.New(conf).Publish("mytopic", "another message")
+	require.Nil(t, err)
+	require.Equal(t, before, transport.requests.Load())
+	require.True(t, otherTransport.requests.Load() >= 1)
+}
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
 func newTestConfig(port int) *client.Config {
 	c := client.NewConfig()
 	c.DefaultHost = fmt.Sprintf("http://127.0.0.1:%d", port)
 	return c
 }
 
+func TestClient_Publish_Subscribe_LongPoll(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	_, err := c.Publish("mytopic", "old message")
+	require.Nil(t, err)
+	subscriptionID, _ := c.Subscribe("mytopic", client.WithLongPoll(2*time.Second))
+	time.Sleep(time.Second)
+
+	// Messages are received across several long poll requests, without gaps or duplicates
+	for i := 1; i <= 3; i++ {
+		_, err := c.Publish("mytopic", fmt.Sprintf("message %d", i))
+		require.Nil(t, err)
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(3 * time.Second) // Spans at least one long poll timeout
+	_, err = c.Publish("mytopic", "message 4")
+	require.Nil(t, err)
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 1; i <= 4; i++ {
+		msg := nextMessage(c)
+		require.NotNil(t, msg)
+		require.Equal(t, fmt.Sprintf("message %d", i), msg.Message)
+	}
+	require.Nil(t, nextMessage(c))
+	c.Unsubscribe(subscriptionID)
+}
+
+func TestClient_Subscribe_KeepaliveTimeout(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := connections.Add(1)
+		w.Write([]byte(`{"id":"o1","event":"open","topic":"mytopic"}` + "\n"))
+		w.(http.Flusher).Flush()
+		if n == 1 {
+			<-r.Context().Done() // Half-open connection: nothing is sent anymore
+			return
+		}
+		w.Write([]byte(fmt.Sprintf(`{"id":"m%d","event":"message","topic":"mytopic","message":"after reconnect"}`, n) + "\n"))
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+				w.Write([]byte(`{"id":"k1","event":"keepalive","topic":"mytopic"}` + "\n"))
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer server.Close()
+	c := client.New(&client.Config{DefaultHost: server.URL, KeepaliveTimeout: 300 * time.Millisecond})
+
+	subscriptionID, err := c.Subscribe("mytopic")
+	require.Nil(t, err)
+	defer c.Unsubscribe(subscriptionID)
+
+	// Reconnects immediately after the timeout, and then stays connected thanks to the keepalive events
+	select {
+	case m := <-c.Messages:
+		require.Equal(t, "after reconnect", m.Message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received after reconnect")
+	}
+	time.Sleep(time.Second)
+	require.Equal(t, int32(2), connections.Load())
+	require.Nil(t, nextMessage(c))
+}
+
+func TestClient_Subscribe_ResumeAfterReconnect(t *testing.T) {
+	var connections atomic.Int32
+	sinces := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := connections.Add(1)
+		if n > 2 {
+			<-r.Context().Done()
+			return
+		}
+		sinces <- r.URL.Query().Get("since")
+		w.Write([]byte(fmt.Sprintf(`{"id":"m%d","event":"message","topic":"mytopic","message":"message %d","resume":"token%d"}`, n, n, n) + "\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // Half-open connection, see KeepaliveTimeout
+	}))
+	defer server.Close()
+	c := client.New(&client.Config{DefaultHost: server.URL, KeepaliveTimeout: 300 * time.Millisecond})
+
+	subscriptionID, err := c.Subscribe("mytopic", client.WithSinceAll())
+	require.Nil(t, err)
+	defer c.Unsubscribe(subscriptionID)
+
+	// The reconnect continues after the last received message, instead of using the original since marker
+	for i := 1; i <= 2; i++ {
+		select {
+		case m := <-c.Messages:
+			require.Equal(t, fmt.Sprintf("token%d", i), m.Resume)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message received")
+		}
+	}
+	require.Equal(t, "all", <-sinces)
+	require.Equal(t, "token1", <-sinces)
+}
+
 func nextMessage(c *client.Client) *client.Message {
 	select {
 	case m := <-c.Messages:
@@ -115,3 +446,177 @@ func nextMessage(c *client.Client) *client.Message {
 		return nil
 	}
 }
+
+func TestClient_Publish_Poll_Errors(t *testing.T) {
+	conf := server.NewConfig()
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthDefault = user.PermissionReadWrite
+	conf.VisitorRequestLimitBurst = 3
+	conf.AttachmentFileSizeLimit = 100
+	conf.BaseURL = "http://127.0.0.1:12345" // Required for attachments
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	// Unauthorized, with ntfy error details
+	_, err := c.Publish("mytopic", "some message", client.WithBasicAuth("phil", "wrong"))
+	require.ErrorIs(t, err, client.ErrUnauthorized)
+	require.NotErrorIs(t, err, client.ErrForbidden)
+	var httpErr *client.Error
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, 401, httpErr.HTTPCode)
+	require.Equal(t, 40101, httpErr.Code)
+	require.Equal(t, "unauthorized", httpErr.Message)
+	require.Contains(t, err.Error(), `"code":40101`) // Raw body, as before
+
+	// Entity too large
+	_, err = c.Publish("mytopic", strings.Repeat("x", 5000))
+	require.ErrorIs(t, err, client.ErrEntityTooLarge)
+	require.ErrorIs(t, err, &client.Error{HTTPCode: 413, Code: 41301})
+	require.NotErrorIs(t, err, &client.Error{HTTPCode: 413, Code: 41302})
+
+	// Too many requests, also when polling
+	for i := 0; i < 5; i++ {
+		if _, err = c.Poll("mytopic"); err != nil {
+			break
+		}
+	}
+	require.ErrorIs(t, err, client.ErrTooManyRequests)
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, 42901, httpErr.Code)
+}
+
+func TestClient_Publish_Poll_Metadata(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	msg, err := c.Publish("mytopic", "Deployment finished", client.WithMetadata("env", "prod"), client.WithMetadata("build-id", "4711"))
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"env": "prod", "build-id": "4711"}, msg.Metadata)
+	_, err = c.Publish("mytopic", "Deployment failed", client.WithMetadata("env", "staging"))
+	require.Nil(t, err)
+
+	messages, err := c.Poll("mytopic", client.WithMetadataFilter("env", "prod"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "Deployment finished", messages[0].Message)
+	require.Equal(t, "4711", messages[0].Metadata["build-id"])
+}
+
+func TestClient_Publish_Poll_Filters(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	low, err := c.Publish("mytopic", "low", client.WithPriority("low"), client.WithTitle("backup"))
+	require.Nil(t, err)
+	_, err = c.Publish("mytopic", "default", client.WithTags([]string{"db", "prod"}))
+	require.Nil(t, err)
+	_, err = c.Publish("mytopic", "high", client.WithPriority("high"), client.WithTags([]string{"db"}))
+	require.Nil(t, err)
+	_, err = c.Publish("mytopic", "urgent", client.WithPriority("urgent"))
+	require.Nil(t, err)
+
+	pollMessages := func(options ...client.SubscribeOption) []string {
+		messages, err := c.Poll("mytopic", options...)
+		require.Nil(t, err)
+		return util.Map(messages, func(m *client.Message) string { return m.Message })
+	}
+	require.Equal(t, []string{"low"}, pollMessages(client.WithIDFilter(low.ID)))
+	require.Equal(t, []string{"low"}, pollMessages(client.WithTitleFilter("backup")))
+	require.Equal(t, []string{"high"}, pollMessages(client.WithMessageFilter("high")))
+	require.Equal(t, []string{"default", "high"}, pollMessages(client.WithTagsFilter("db")))
+	require.Equal(t, []string{"default"}, pollMessages(client.WithTagsFilter("db", "prod")))
+	require.Equal(t, []string{"default"}, pollMessages(client.WithPriorityFilter(3)))
+	require.Equal(t, []string{"low", "urgent"}, pollMessages(client.WithPriorityFilter(2, 5)))
+	require.Equal(t, []string{"default", "high", "urgent"}, pollMessages(client.WithPriorityRangeFilter(3, 5)))
+	require.Equal(t, []string{"high"}, pollMessages(client.WithPriorityRangeFilter(4, 5), client.WithTagsFilter("db")))
+
+	require.Equal(t, []string{"low", "default", "high", "urgent"}, pollMessages(client.WithPriorityFilter()))
+	require.Equal(t, []string{"low", "default", "high", "urgent"}, pollMessages(client.WithTagsFilter()))
+
+	r, err := http.NewRequest("GET", "http://localhost/mytopic/json", nil)
+	require.Nil(t, err)
+	require.Nil(t, client.WithPriorityFilter()(r))
+	require.False(t, r.URL.Query().Has("priority")) // No-op without priorities
+
+	_, err = c.Poll("mytopic", client.WithPriorityFilter(6))
+	require.Error(t, err)
+	_, err = c.Poll("mytopic", client.WithPriorityFilter(0, 3))
+	require.Error(t, err)
+	_, err = c.Poll("mytopic", client.WithPriorityRangeFilter(5, 4))
+	require.Error(t, err)
+}
+
+func TestClient_Close(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 100; i++ { // More than fit in the Messages channel
+			w.Write([]byte(fmt.Sprintf(`{"id":"m%d","event":"message","topic":"mytopic","message":"message %d"}`, i, i) + "\n"))
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	c := client.New(&client.Config{DefaultHost: server.URL})
+
+	_, err := c.Subscribe("mytopic")
+	require.Nil(t, err)
+	handlerStarted, handlerDone := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	_, err = c.SubscribeFunc("mytopic", func(m *client.Message) {
+		once.Do(func() {
+			close(handlerStarted)
+			time.Sleep(300 * time.Millisecond)
+			close(handlerDone)
+		})
+	})
+	require.Nil(t, err)
+	<-handlerStarted
+	require.Eventually(t, func() bool {
+		return len(c.Messages) == cap(c.Messages)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Close does not block on the full Messages channel, and waits for running handlers
+	require.Nil(t, c.Close())
+	select {
+	case <-handlerDone:
+	default:
+		t.Fatal("Close returned before the handler finished")
+	}
+	count := 0
+	for range c.Messages { // Channel is closed, buffered messages can still be read
+		count++
+	}
+	require.Equal(t, 50, count)
+
+	_, err = c.Subscribe("mytopic")
+	require.ErrorIs(t, err, client.ErrClientClosed)
+	require.Nil(t, c.Close())
+}
+
+func TestClient_SubscribeContext(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := c.SubscribeContext(ctx, "mytopic")
+	require.Nil(t, err)
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = c.Publish("mytopic", "message 1")
+	require.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+	msg := nextMessage(c)
+	require.NotNil(t, msg)
+	require.Equal(t, "message 1", msg.Message)
+
+	cancel()
+	time.Sleep(200 * time.Millisecond)
+	_, err = c.Publish("mytopic", "message 2")
+	require.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+	require.Nil(t, nextMessage(c))
+}
@@ -1,30 +1,131 @@
 package client
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	// DefaultBaseURL is the base URL used to expand short topic names
 	DefaultBaseURL = "https://ntfy.sh"
+
+	// DefaultHandlerWorkers is the default number of handler goroutines per subscription, see Config.HandlerWorkers
+	DefaultHandlerWorkers = 4
+
+	// DefaultPublishParallelism is the default number of concurrent requests of Client.PublishBatch, see Config.PublishParallelism
+	DefaultPublishParallelism = 8
+
+	// DefaultQueueRetryInterval is the default interval after which queued messages are first retried, see Config.QueueRetryInterval
+	DefaultQueueRetryInterval = 5 * time.Second
+
+	// DefaultKeepaliveTimeout is the default time after which a subscription is reconnected if nothing (not even a
+	// keepalive event) was received, see Config.KeepaliveTimeout. It is twice the server's default keepalive-interval.
+	DefaultKeepaliveTimeout = 90 * time.Second
+)
+
+// Environment variables that override the fields of the client config, see Config.ApplyEnv
+const (
+	EnvDefaultHost      = "NTFY_DEFAULT_HOST"
+	EnvDefaultUser      = "NTFY_DEFAULT_USER"
+	EnvDefaultPassword  = "NTFY_DEFAULT_PASSWORD"
+	EnvDefaultToken     = "NTFY_DEFAULT_TOKEN"
+	EnvDefaultCommand   = "NTFY_DEFAULT_COMMAND"
+	EnvSubscribe        = "NTFY_SUBSCRIBE"
+	EnvHTTP3            = "NTFY_HTTP3"
+	EnvSync             = "NTFY_SYNC"
+	EnvCommandEnv       = "NTFY_COMMAND_ENV"
+	EnvKeepaliveTimeout = "NTFY_KEEPALIVE_TIMEOUT"
+	EnvCACert           = "NTFY_CACERT"
+	EnvClientCert       = "NTFY_CERT"
+	EnvClientKey        = "NTFY_KEY"
+	EnvInsecure         = "NTFY_INSECURE"
 )
 
 // Config is the config struct for a Client.
 type Config struct {
 	// DefaultHost is the default ntfy server to use.
 	DefaultHost     string      `yaml:"default-host"`
-	// DefaultUser is the default username for authentication.
+	// DefaultUser is the default username for authentication. It is used (together with DefaultPassword) for all
+	// publish and subscribe requests, unless DefaultToken or the credentials of a subscription are set, see Subscribe.
 	DefaultUser     string      `yaml:"default-user"`
 	// DefaultPassword is the default password for authentication.
 	DefaultPassword *string     `yaml:"default-password"`
-	// DefaultToken is the default access token for authentication.
+	// DefaultToken is the default access token for authentication. It takes precedence over DefaultUser.
 	DefaultToken    string      `yaml:"default-token"`
 	// DefaultCommand is the default command to execute when a message is received.
 	DefaultCommand  string      `yaml:"default-command"`
-	// Subscribe is a list of topics to subscribe to.
+	// Subscribe is a list of topics to subscribe to. The credentials of an entry (User/Password or Token) are used for
+	// all publish and subscribe requests to its topic, instead of the default credentials.
 	Subscribe       []Subscribe `yaml:"subscribe"`
+	// HTTP3 enables HTTP/3 (QUIC) for all requests. The server must listen for HTTP/3 (listen-http3).
+	HTTP3           bool        `yaml:"http3"`
+	// CACert is the path to a PEM file with CA certificates that are trusted in addition to the system's CAs, e.g.
+	// for a self-hosted server with a certificate from a private CA. See Config.TLSConfig.
+	CACert          string      `yaml:"cacert"`
+	// ClientCert is the path to a PEM file with a client certificate, sent to servers that require mutual TLS (mTLS).
+	// If ClientKey is not set, the file must contain the private key as well.
+	ClientCert      string      `yaml:"cert"`
+	// ClientKey is the path to a PEM file with the private key of ClientCert.
+	ClientKey       string      `yaml:"key"`
+	// Insecure disables the verification of the server's TLS certificate. This makes connections vulnerable to
+	// man-in-the-middle attacks, so it should only be used for testing.
+	Insecure        bool        `yaml:"insecure"`
+	// Sync syncs the subscriptions of "ntfy subscribe" with the account of the default user on the default host,
+	// so that topics added in the web app or mobile apps are subscribed to as well, and vice versa.
+	Sync            bool        `yaml:"sync"`
+	// CommandEnv is the list of environment variables that are passed to commands, in addition to the NTFY_* message
+	// variables. Names may contain wildcards (e.g. LC_*). If nil, the entire environment is passed.
+	CommandEnv      []string    `yaml:"command-env"`
+	// KeepaliveTimeout is the time after which a subscription is torn down and reconnected if nothing was received,
+	// not even a keepalive event, e.g. because the connection was silently dropped (half-open). It should be larger
+	// than the server's keepalive-interval. If zero, DefaultKeepaliveTimeout is used; if negative, it is disabled.
+	KeepaliveTimeout time.Duration `yaml:"keepalive-timeout"`
+	// Notify configures how desktop notifications ("ntfy subscribe --notify") are displayed, by message priority. Keys
+	// are priorities (1-5, or names like "high" or "urgent").
+	Notify          map[string]*NotifyOptions `yaml:"notify"`
+	// Logger is the logger used by the client. If nil, the client logs using the global log package state.
+	Logger          *log.Logger `yaml:"-"`
+	// TraceWriter, if set, receives a dump of all HTTP requests and responses (similar to "curl -v"), with credentials redacted.
+	TraceWriter     io.Writer   `yaml:"-"`
+	// HTTPClient, if set, is the HTTP client used for all requests instead of a default client, e.g. to set
+	// a cookie jar or a redirect policy. The client is copied, so later changes to it have no effect. Note that
+	// Timeout also applies to subscriptions, which are long-lived connections that reconnect when they time out.
+	HTTPClient      *http.Client `yaml:"-"`
+	// Transport, if set, is the transport used for all requests, e.g. to set a proxy, TLS settings or connection
+	// pooling limits. It takes precedence over the transport of HTTPClient, over HTTP3 and over the TLS settings
+	// (CACert, ClientCert, ClientKey and Insecure), which are then ignored.
+	Transport       http.RoundTripper `yaml:"-"`
+	// HandlerWorkers is the number of goroutines that call the handler of a subscription created with
+	// Client.SubscribeFunc. If zero, DefaultHandlerWorkers is used. With more than one worker, handlers are called
+	// concurrently, and messages may be handled out of order; set it to 1 to handle messages one after another.
+	HandlerWorkers  int         `yaml:"-"`
+	// PublishParallelism is the max number of messages that Client.PublishBatch publishes concurrently. If zero,
+	// DefaultPublishParallelism is used.
+	PublishParallelism int      `yaml:"-"`
+	// QueueDir, if set, is a directory in which messages are stored if Client.Publish fails because the server
+	// cannot be reached (or responds with a 5xx error). Queued messages are retried in the background, in order,
+	// until they are published or rejected by the server, and survive restarts: they are retried when a client
+	// is created with the same directory. Files are only readable by the current user, since they contain the
+	// credentials of the message.
+	QueueDir        string      `yaml:"-"`
+	// QueueRetryInterval is the interval after which queued messages are first retried (see QueueDir). It is
+	// doubled after every failed attempt, up to 5 minutes. If zero, DefaultQueueRetryInterval is used.
+	QueueRetryInterval time.Duration `yaml:"-"`
+	// Middlewares is a list of functions that process every received message in order, before it is delivered
+	// (Client.Subscribe, Client.SubscribeFunc and Client.Poll), e.g. to decrypt, decompress, validate or enrich
+	// messages. See MessageMiddleware.
+	Middlewares     []MessageMiddleware `yaml:"-"`
+	// StatsHook, if set, is notified of all events that are counted in Client.Stats, e.g. to export them as
+	// Prometheus metrics. See StatsHook.
+	StatsHook       StatsHook   `yaml:"-"`
 }
 
 // Subscribe is the struct for a Subscription within Config.
@@ -41,6 +142,27 @@ type Subscribe struct {
 	Command  string            `yaml:"command"`
 	// If is a map of conditions that must be met for the command to execute (not fully implemented in this struct definition but implied).
 	If       map[string]string `yaml:"if"`
+	// CommandEnv overrides Config.CommandEnv for this subscription, if set.
+	CommandEnv []string        `yaml:"command-env"`
+	// Env is a map of static environment variables that are passed to the command, e.g. for credentials or paths.
+	Env      map[string]string `yaml:"env"`
+	// Notify overrides Config.Notify for this subscription, per priority. Unset fields fall back to Config.Notify.
+	Notify   map[string]*NotifyOptions `yaml:"notify"`
+	// Network configures the proxy, source address and DNS servers of this subscription (keys "proxy",
+	// "bind-address", "bind-interface" and "dns"), e.g. if the server is only reachable via a VPN.
+	Network  Network           `yaml:",inline"`
+}
+
+// NotifyOptions configures how desktop notifications ("ntfy subscribe --notify") of a priority are displayed.
+// Unset fields fall back to the defaults of the priority.
+type NotifyOptions struct {
+	// Urgency is the urgency level of the notification: "low" (no popup, only in the notification center),
+	// "normal" or "critical" (breaks through do not disturb, if supported by the OS).
+	Urgency *string `yaml:"urgency"`
+	// Sound is the notification sound: "default", "none" (silent), or an OS-specific sound name.
+	Sound   *string `yaml:"sound"`
+	// Sticky keeps the notification on screen until it is dismissed.
+	Sticky  *bool   `yaml:"sticky"`
 }
 
 // NewConfig creates a new Config struct for a Client with default values.
@@ -58,7 +180,9 @@ func NewConfig() *Config {
 	}
 }
 
-// LoadConfig loads the Client config from a yaml file.
+// LoadConfig loads the Client config from a yaml file. Credentials (default-user, default-password,
+// default-token, and the user, password, token and env values of subscriptions) may be references to secrets, e.g.
+// file:///run/secrets/ntfy_token or env://NTFY_TOKEN, which are resolved here. See util.ResolveSecret.
 //
 // Parameters:
 //   - filename: The path to the YAML configuration file.
@@ -75,5 +199,116 @@ func LoadConfig(filename string) (*Config, error) {
 	if err := yaml.Unmarshal(b, c); err != nil {
 		return nil, err
 	}
+	if err := c.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("invalid credentials in %s: %w", filename, err)
+	}
 	return c, nil
 }
+
+// resolveSecrets resolves the secret references in all credential fields, see LoadConfig
+func (c *Config) resolveSecrets() error {
+	secrets := []*string{&c.DefaultUser, c.DefaultPassword, &c.DefaultToken}
+	for i := range c.Subscribe {
+		s := &c.Subscribe[i]
+		secrets = append(secrets, s.User, s.Password, s.Token)
+	}
+	for _, secret := range secrets {
+		if secret == nil {
+			continue
+		}
+		resolved, err := util.ResolveSecret(*secret)
+		if err != nil {
+			return err
+		}
+		*secret = resolved
+	}
+	for _, s := range c.Subscribe {
+		for name, value := range s.Env {
+			resolved, err := util.ResolveSecret(value)
+			if err != nil {
+				return err
+			}
+			s.Env[name] = resolved
+		}
+	}
+	return nil
+}
+
+// ApplyEnv overrides the config fields with the values of the NTFY_* environment variables (see EnvDefaultHost,
+// etc.), if they are set. Empty variables are ignored, except for NTFY_DEFAULT_PASSWORD, which may be set to an
+// empty password, and NTFY_COMMAND_ENV, a comma-separated list of variable names which may be empty to pass no
+// variables at all. NTFY_SUBSCRIBE is a JSON array of subscriptions (e.g. [{"topic":"alerts","command":"..."}]),
+// using the same fields as the "subscribe" section in client.yml, and replaces all subscriptions from the file.
+//
+// Returns:
+//   - An error if NTFY_SUBSCRIBE, NTFY_HTTP3, NTFY_SYNC, NTFY_KEEPALIVE_TIMEOUT or NTFY_INSECURE cannot be parsed.
+func (c *Config) ApplyEnv() error {
+	if host := os.Getenv(EnvDefaultHost); host != "" {
+		c.DefaultHost = host
+	}
+	if user := os.Getenv(EnvDefaultUser); user != "" {
+		c.DefaultUser = user
+	}
+	if password, ok := os.LookupEnv(EnvDefaultPassword); ok {
+		c.DefaultPassword = &password
+	}
+	if token := os.Getenv(EnvDefaultToken); token != "" {
+		c.DefaultToken = token
+	}
+	if command := os.Getenv(EnvDefaultCommand); command != "" {
+		c.DefaultCommand = command
+	}
+	if commandEnv, ok := os.LookupEnv(EnvCommandEnv); ok {
+		c.CommandEnv = make([]string, 0)
+		for _, name := range strings.Split(commandEnv, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				c.CommandEnv = append(c.CommandEnv, name)
+			}
+		}
+	}
+	if subscribe := os.Getenv(EnvSubscribe); subscribe != "" {
+		var subscriptions []Subscribe
+		if err := yaml.Unmarshal([]byte(subscribe), &subscriptions); err != nil { // JSON is valid YAML, so the yaml tags apply
+			return fmt.Errorf("invalid %s: %w", EnvSubscribe, err)
+		}
+		c.Subscribe = subscriptions
+	}
+	if http3 := os.Getenv(EnvHTTP3); http3 != "" {
+		enabled, err := strconv.ParseBool(http3)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvHTTP3, err)
+		}
+		c.HTTP3 = enabled
+	}
+	if sync := os.Getenv(EnvSync); sync != "" {
+		enabled, err := strconv.ParseBool(sync)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvSync, err)
+		}
+		c.Sync = enabled
+	}
+	if cacert := os.Getenv(EnvCACert); cacert != "" {
+		c.CACert = cacert
+	}
+	if cert := os.Getenv(EnvClientCert); cert != "" {
+		c.ClientCert = cert
+	}
+	if key := os.Getenv(EnvClientKey); key != "" {
+		c.ClientKey = key
+	}
+	if insecure := os.Getenv(EnvInsecure); insecure != "" {
+		enabled, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvInsecure, err)
+		}
+		c.Insecure = enabled
+	}
+	if keepaliveTimeout := os.Getenv(EnvKeepaliveTimeout); keepaliveTimeout != "" {
+		timeout, err := time.ParseDuration(keepaliveTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvKeepaliveTimeout, err)
+		}
+		c.KeepaliveTimeout = timeout
+	}
+	return nil
+}
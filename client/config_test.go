@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestConfig_Load(t *testing.T) {
@@ -25,7 +26,17 @@ subscribe:
     command: notify-send -i /usr/share/ntfy/logo.png "Important" "$m"
     if:
             priority: high,urgent
+    command-env: [PATH, LC_*]
+    env:
+      BACKUP_DIR: /var/backups
+    notify:
+      urgent:
+        sound: none
+        sticky: false
   - topic: defaults
+notify:
+  5:
+    urgency: critical
 `), 0600))
 
 	conf, err := client.LoadConfig(filename)
@@ -44,7 +55,15 @@ subscribe:
 	require.Equal(t, "alerts", conf.Subscribe[2].Topic)
 	require.Equal(t, `notify-send -i /usr/share/ntfy/logo.png "Important" "$m"`, conf.Subscribe[2].Command)
 	require.Equal(t, "high,urgent", conf.Subscribe[2].If["priority"])
+	require.Equal(t, []string{"PATH", "LC_*"}, conf.Subscribe[2].CommandEnv)
+	require.Equal(t, "/var/backups", conf.Subscribe[2].Env["BACKUP_DIR"])
+	require.Equal(t, "none", *conf.Subscribe[2].Notify["urgent"].Sound)
+	require.False(t, *conf.Subscribe[2].Notify["urgent"].Sticky)
+	require.Nil(t, conf.Subscribe[2].Notify["urgent"].Urgency)
+	require.Equal(t, "critical", *conf.Notify["5"].Urgency)
 	require.Equal(t, "defaults", conf.Subscribe[3].Topic)
+	require.Nil(t, conf.Subscribe[3].CommandEnv)
+	require.Nil(t, conf.CommandEnv)
 }
 
 func TestConfig_EmptyPassword(t *testing.T) {
@@ -138,3 +157,105 @@ subscribe:
 	require.Nil(t, conf.Subscribe[0].Password)
 	require.Nil(t, conf.Subscribe[0].Token)
 }
+
+func TestConfig_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "token"), []byte("tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2\n"), 0600))
+	t.Setenv("TEST_NTFY_PASSWORD", "mypass")
+	t.Setenv("TEST_NTFY_API_KEY", "api-key")
+	filename := filepath.Join(dir, "client.yml")
+	require.Nil(t, os.WriteFile(filename, []byte(`
+default-host: http://localhost
+default-token: file://`+filepath.Join(dir, "token")+`
+subscribe:
+  - topic: mytopic
+    user: phil
+    password: env://TEST_NTFY_PASSWORD
+    env:
+      API_KEY: env://TEST_NTFY_API_KEY
+`), 0600))
+
+	conf, err := client.LoadConfig(filename)
+	require.Nil(t, err)
+	require.Equal(t, "tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2", conf.DefaultToken)
+	require.Equal(t, "phil", *conf.Subscribe[0].User)
+	require.Equal(t, "mypass", *conf.Subscribe[0].Password)
+	require.Equal(t, "api-key", conf.Subscribe[0].Env["API_KEY"])
+
+	require.Nil(t, os.WriteFile(filename, []byte("default-password: env://TEST_NTFY_NOT_SET\n"), 0600))
+	_, err = client.LoadConfig(filename)
+	require.ErrorContains(t, err, "TEST_NTFY_NOT_SET is not set")
+}
+
+func TestConfig_ApplyEnv(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "client.yml")
+	require.Nil(t, os.WriteFile(filename, []byte(`
+default-host: http://localhost
+default-user: philipp
+default-command: echo file
+subscribe:
+  - topic: from-file
+`), 0600))
+
+	t.Setenv("NTFY_DEFAULT_HOST", "https://ntfy.example.com")
+	t.Setenv("NTFY_DEFAULT_PASSWORD", "")
+	t.Setenv("NTFY_DEFAULT_TOKEN", "tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2")
+	t.Setenv("NTFY_DEFAULT_COMMAND", "")
+	t.Setenv("NTFY_SUBSCRIBE", `[{"topic":"alerts","command":"echo $m","if":{"priority":"high,urgent"}},{"topic":"mytopic","user":"phil","password":""}]`)
+	t.Setenv("NTFY_HTTP3", "true")
+	t.Setenv("NTFY_SYNC", "1")
+	t.Setenv("NTFY_COMMAND_ENV", "PATH, HOME,")
+	t.Setenv("NTFY_KEEPALIVE_TIMEOUT", "2m")
+	t.Setenv("NTFY_CACERT", "/etc/ntfy/ca.pem")
+	t.Setenv("NTFY_CERT", "/etc/ntfy/client.pem")
+	t.Setenv("NTFY_KEY", "/etc/ntfy/client.key")
+	t.Setenv("NTFY_INSECURE", "false")
+	conf, err := client.LoadConfig(filename)
+	require.Nil(t, err)
+	require.Nil(t, conf.ApplyEnv())
+	require.Equal(t, "https://ntfy.example.com", conf.DefaultHost)
+	require.Equal(t, "philipp", conf.DefaultUser) // Not set
+	require.Equal(t, "", *conf.DefaultPassword)   // Empty password is allowed
+	require.Equal(t, "tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2", conf.DefaultToken)
+	require.Equal(t, "echo file", conf.DefaultCommand) // Empty is ignored
+	require.Equal(t, 2, len(conf.Subscribe))
+	require.Equal(t, "alerts", conf.Subscribe[0].Topic)
+	require.Equal(t, "echo $m", conf.Subscribe[0].Command)
+	require.Equal(t, "high,urgent", conf.Subscribe[0].If["priority"])
+	require.Nil(t, conf.Subscribe[0].User)
+	require.Equal(t, "mytopic", conf.Subscribe[1].Topic)
+	require.Equal(t, "phil", *conf.Subscribe[1].User)
+	require.Equal(t, "", *conf.Subscribe[1].Password)
+	require.True(t, conf.HTTP3)
+	require.True(t, conf.Sync)
+	require.Equal(t, []string{"PATH", "HOME"}, conf.CommandEnv)
+	require.Equal(t, 2*time.Minute, conf.KeepaliveTimeout)
+	require.Equal(t, "/etc/ntfy/ca.pem", conf.CACert)
+	require.Equal(t, "/etc/ntfy/client.pem", conf.ClientCert)
+	require.Equal(t, "/etc/ntfy/client.key", conf.ClientKey)
+	require.False(t, conf.Insecure)
+}
+
+func TestConfig_ApplyEnv_InvalidSubscribe(t *testing.T) {
+	t.Setenv("NTFY_SUBSCRIBE", `[{"topic": `)
+	conf := client.NewConfig()
+	require.Error(t, conf.ApplyEnv())
+}
+
+func TestConfig_ApplyEnv_InvalidHTTP3(t *testing.T) {
+	t.Setenv("NTFY_HTTP3", "maybe")
+	conf := client.NewConfig()
+	require.EqualError(t, conf.ApplyEnv(), `invalid NTFY_HTTP3: strconv.ParseBool: parsing "maybe": invalid syntax`)
+}
+
+func TestConfig_ApplyEnv_InvalidKeepaliveTimeout(t *testing.T) {
+	t.Setenv("NTFY_KEEPALIVE_TIMEOUT", "soon")
+	conf := client.NewConfig()
+	require.EqualError(t, conf.ApplyEnv(), `invalid NTFY_KEEPALIVE_TIMEOUT: time: invalid duration "soon"`)
+}
+
+func TestConfig_ApplyEnv_InvalidInsecure(t *testing.T) {
+	t.Setenv("NTFY_INSECURE", "sure")
+	conf := client.NewConfig()
+	require.EqualError(t, conf.ApplyEnv(), `invalid NTFY_INSECURE: strconv.ParseBool: parsing "sure": invalid syntax`)
+}
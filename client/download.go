@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Errors returned by DownloadAttachment
+var (
+	ErrNoAttachment          = errors.New("message has no attachment")
+	ErrAttachmentExpired     = errors.New("attachment expired")
+	ErrAttachmentSizeInvalid = errors.New("attachment size does not match")
+)
+
+// DownloadAttachment downloads the attachment of the message, and writes it to w.
+//
+// The attachment is downloaded with the HTTP client and the credentials (see WithBasicAuth and WithBearerAuth)
+// of the request the message was received with, i.e. of the Subscribe, Poll or Publish call. Credentials are
+// only sent if the attachment is hosted on the server of the topic, and never to external attachment URLs.
+//
+// Parameters:
+//   - ctx: The context of the download request.
+//   - w: The writer to write the attachment to.
+//
+// Returns:
+//   - ErrNoAttachment if the message has no attachment, ErrAttachmentExpired if the attachment has expired,
+//     ErrAttachmentSizeInvalid if the server sent more or fewer bytes than the attachment size, an *Error
+//     if the server rejected the request, or an error if the download failed.
+func (m *Message) DownloadAttachment(ctx context.Context, w io.Writer) error {
+	return m.downloadAttachment(ctx, m.httpClient, w)
+}
+
+// DownloadAttachment downloads the attachment of the message to a file in destDir, and returns the path of
+// the file. The file is named after the attachment (see Attachment.Name), or after the message ID if the
+// attachment has no name. An existing file with the same name is replaced, but only once the download is
+// complete. See Message.DownloadAttachment for details.
+//
+// Parameters:
+//   - m: The message with the attachment, e.g. received via Subscribe or Poll.
+//   - destDir: The directory to download the attachment to.
+//
+// Returns:
+//   - The path of the downloaded file, or an error if the download failed.
+func (c *Client) DownloadAttachment(m *Message, destDir string) (string, error) {
+	if m.Attachment == nil {
+		return "", ErrNoAttachment
+	}
+	filename := filepath.Base(m.Attachment.Name)
+	if filename == "." || filename == ".." || filename == string(filepath.Separator) {
+		filename = m.ID
+	}
+	httpClient := m.httpClient
+	if httpClient == nil {
+		httpClient = c.httpClient
+	}
+	f, err := os.CreateTemp(destDir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name()) // No-op after rename
+	if err := m.downloadAttachment(context.Background(), httpClient, f); err != nil {
+		f.Close()
+		return "", err
+	} else if err := f.Close(); err != nil {
+		return "", err
+	}
+	filename = filepath.Join(destDir, filename)
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+func (m *Message) downloadAttachment(ctx context.Context, httpClient *http.Client, w io.Writer) error {
+	if m.Attachment == nil || m.Attachment.URL == "" {
+		return ErrNoAttachment
+	} else if m.Attachment.Expires > 0 && time.Now().Unix() >= m.Attachment.Expires {
+		return ErrAttachmentExpired
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.Attachment.URL, nil)
+	if err != nil {
+		return err
+	}
+	if m.authorization != "" && sameOrigin(m.TopicURL, m.Attachment.URL) {
+		req.Header.Set("Authorization", m.authorization)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	size := m.Attachment.Size
+	if size > 0 && resp.ContentLength >= 0 && resp.ContentLength != size {
+		return fmt.Errorf("%w: expected %d bytes, server sent %d bytes", ErrAttachmentSizeInvalid, size, resp.ContentLength)
+	}
+	body := io.Reader(resp.Body)
+	if size > 0 {
+		body = io.LimitReader(resp.Body, size+1) // Read one more byte to detect attachments that are too large
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return err
+	} else if size > 0 && n != size {
+		return fmt.Errorf("%w: expected %d bytes, got %d bytes", ErrAttachmentSizeInvalid, size, n)
+	}
+	return nil
+}
+
+// sameOrigin returns true if both URLs have the same scheme and host (including the port)
+func sameOrigin(topicURL, attachmentURL string) bool {
+	u1, err := url.Parse(topicURL)
+	if err != nil {
+		return false
+	}
+	u2, err := url.Parse(attachmentURL)
+	if err != nil {
+		return false
+	}
+	return u1.Scheme == u2.Scheme && u1.Host == u2.Host
+}
@@ -0,0 +1,109 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestClient_DownloadAttachment(t *testing.T) {
+	conf := server.NewConfig()
+	conf.CacheFile = filepath.Join(t.TempDir(), "cache.db")
+	conf.AttachmentCacheDir = t.TempDir()
+	s, err := server.New(server.WithConfig(conf))
+	require.Nil(t, err)
+
+	// Record the Authorization header of attachment downloads
+	var mu sync.Mutex
+	var fileAuth []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/file/") {
+			mu.Lock()
+			fileAuth = append(fileAuth, r.Header.Get("Authorization"))
+			mu.Unlock()
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	conf.BaseURL = ts.URL
+
+	content := util.RandomString(5000)
+	c := client.New(client.NewConfig())
+	_, err = c.PublishReader(ts.URL+"/mytopic", strings.NewReader(content), client.WithFilename("report.txt"))
+	require.Nil(t, err)
+	messages, err := c.Poll(ts.URL+"/mytopic", client.WithBearerAuth("tk_1234"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	m := messages[0]
+
+	// Download to writer, with the credentials of the poll request
+	var buf bytes.Buffer
+	require.Nil(t, m.DownloadAttachment(context.Background(), &buf))
+	require.Equal(t, content, buf.String())
+
+	// Download to directory
+	dir := t.TempDir()
+	filename, err := c.DownloadAttachment(m, dir)
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, "report.txt"), filename)
+	b, err := os.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, content, string(b))
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries)) // No leftover temp files
+
+	mu.Lock()
+	require.Equal(t, []string{"Bearer tk_1234", "Bearer tk_1234"}, fileAuth)
+	mu.Unlock()
+
+	// Size mismatch, expired attachment, no attachment
+	m.Attachment.Size++
+	require.True(t, errors.Is(m.DownloadAttachment(context.Background(), &buf), client.ErrAttachmentSizeInvalid))
+	m.Attachment.Expires = time.Now().Add(-time.Minute).Unix()
+	require.Equal(t, client.ErrAttachmentExpired, m.DownloadAttachment(context.Background(), &buf))
+	m.Attachment = nil
+	_, err = c.DownloadAttachment(m, dir)
+	require.Equal(t, client.ErrNoAttachment, err)
+}
+
+func TestClient_DownloadAttachment_ExternalURL_NoCredentials(t *testing.T) {
+	var auth string
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte("external file"))
+	}))
+	defer external.Close()
+
+	conf := server.NewConfig()
+	conf.CacheFile = filepath.Join(t.TempDir(), "cache.db")
+	s, err := server.New(server.WithConfig(conf))
+	require.Nil(t, err)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := client.New(client.NewConfig())
+	_, err = c.Publish(ts.URL+"/mytopic", "external", client.WithAttach(external.URL+"/file.txt"))
+	require.Nil(t, err)
+	messages, err := c.Poll(ts.URL+"/mytopic", client.WithBasicAuth("phil", "mypass"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+
+	var buf bytes.Buffer
+	require.Nil(t, messages[0].DownloadAttachment(context.Background(), &buf))
+	require.Equal(t, "external file", buf.String())
+	require.Empty(t, auth)
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Errors returned if the server responds with the corresponding HTTP status code. Use errors.Is to check for
+// them, and errors.As with *Error to get the ntfy error code and message, e.g.
+//
+//	var httpErr *client.Error
+//	if errors.Is(err, client.ErrTooManyRequests) { ... }
+//	if errors.As(err, &httpErr) && httpErr.Code == 42908 { ... }
+var (
+	ErrUnauthorized    = &Error{HTTPCode: http.StatusUnauthorized}
+	ErrForbidden       = &Error{HTTPCode: http.StatusForbidden}
+	ErrTooManyRequests = &Error{HTTPCode: http.StatusTooManyRequests}
+	ErrEntityTooLarge  = &Error{HTTPCode: http.StatusRequestEntityTooLarge}
+)
+
+// Error is returned if the server responds with an unexpected HTTP status code. If the response contains a
+// ntfy error (e.g. {"code":42901,"http":429,"error":"limit reached: too many requests"}), Code, Message and
+// Link are set as well.
+type Error struct {
+	HTTPCode int    `json:"http"`  // HTTP status code, e.g. 429
+	Code     int    `json:"code"`  // ntfy error code, e.g. 42901, or 0 if the response did not contain a ntfy error
+	Message  string `json:"error"` // Error message, e.g. "limit reached: too many requests"
+	Link     string `json:"link"`  // Link to the documentation, if any
+	body     string // Raw response body
+	status   string // HTTP status, e.g. "429 Too Many Requests"
+}
+
+// newError creates an Error from an unexpected server response and its (already read) body
+func newError(resp *http.Response, body []byte) *Error {
+	e := &Error{}
+	trimmed := strings.TrimSpace(string(body))
+	if err := json.Unmarshal([]byte(trimmed), e); err != nil {
+		e = &Error{} // Not a ntfy error, e.g. an HTML error page of a proxy
+	}
+	e.HTTPCode = resp.StatusCode
+	e.body = trimmed
+	e.status = resp.Status
+	return e
+}
+
+// Error returns the raw response body, or the HTTP status if the response has no body. The body is returned
+// as is (and not just the message) to stay compatible with earlier versions of the client.
+func (e *Error) Error() string {
+	if e.body != "" {
+		return e.body
+	} else if e.status != "" {
+		return fmt.Sprintf("unexpected response from server: %s", e.status)
+	}
+	return fmt.Sprintf("unexpected response from server: %d %s", e.HTTPCode, http.StatusText(e.HTTPCode))
+}
+
+// Is returns true if target is an *Error with the same HTTP status code, and either the same ntfy error code,
+// or no ntfy error code. This allows errors.Is(err, ErrTooManyRequests) to match all 429 responses.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.HTTPCode == e.HTTPCode && (t.Code == 0 || t.Code == e.Code)
+}
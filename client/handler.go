@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"heckel.io/ntfy/v2/util"
+)
+
+// SubscribeFunc subscribes to a topic like Subscribe, but calls handler for every incoming message instead of
+// sending it to the Messages channel. Handlers are called by a pool of Config.HandlerWorkers goroutines, so a
+// slow handler does not hold up the connection. If a handler panics, the panic is recovered and logged, and
+// the subscription continues.
+//
+// The method returns a unique subscriptionID that can be used in Unsubscribe. After Unsubscribe, messages that
+// were received but not yet handled are dropped. Client.Close waits for running handlers to return.
+//
+// Parameters:
+//   - topic: The topic to subscribe to.
+//   - handler: The function called for every incoming message.
+//   - options: Optional configuration for the subscription.
+//
+// Returns:
+//   - A subscription ID, or an error if the subscription failed.
+//
+// Example:
+//
+//	c := client.New(client.NewConfig())
+//	subscriptionID, _ := c.SubscribeFunc("mytopic", func(m *client.Message) {
+//	  fmt.Printf("New message: %s", m.Message)
+//	})
+func (c *Client) SubscribeFunc(topic string, handler func(*Message), options ...SubscribeOption) (string, error) {
+	topicURL, err := c.expandTopicsURL(topic)
+	if err != nil {
+		return "", err
+	}
+	workers := c.config.HandlerWorkers
+	if workers <= 0 {
+		workers = DefaultHandlerWorkers
+	}
+	c.config.Logger.Debug("%s Subscribing to topic with %d handler worker(s)", util.ShortTopicURL(topicURL), workers)
+	return c.startSubscription(context.Background(), topicURL, func(ctx context.Context, subscriptionID string, stats *subscriptionStats) {
+		msgChan := make(chan *Message, 50)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.handleMessages(ctx, msgChan, handler)
+			}()
+		}
+		handleSubscribeConnLoop(ctx, c.httpClient, c.config.Logger, msgChan, c.config.Middlewares, stats, topicURL, subscriptionID, c.keepaliveTimeout(), options...)
+		close(msgChan) // Stops the workers
+		wg.Wait()      // Waits for running handlers, see Close
+	})
+}
+
+// handleMessages calls handler for the messages received on msgChan, until msgChan is closed. Once the
+// subscription is cancelled, the remaining messages are drained without calling the handler, so that the
+// connection loop is never blocked.
+func (c *Client) handleMessages(ctx context.Context, msgChan <-chan *Message, handler func(*Message)) {
+	for m := range msgChan {
+		if ctx.Err() != nil {
+			continue
+		}
+		c.handleMessage(m, handler)
+	}
+}
+
+func (c *Client) handleMessage(m *Message, handler func(*Message)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.config.Logger.Error("%s Message handler panicked for message %s: %v\n%s", util.ShortTopicURL(m.TopicURL), m.ID, r, debug.Stack())
+		}
+	}()
+	handler(m)
+}
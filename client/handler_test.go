@@ -0,0 +1,85 @@
+package client_test
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestClient_SubscribeFunc(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	var mu sync.Mutex
+	received := make([]string, 0)
+	subscriptionID, err := c.SubscribeFunc("mytopic", func(m *client.Message) {
+		if m.Message == "panic" {
+			panic("handler failed")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, m.Message)
+	})
+	require.Nil(t, err)
+	time.Sleep(500 * time.Millisecond)
+
+	// A panicking handler does not stop the subscription
+	for _, message := range []string{"message 1", "panic", "message 2", "message 3"} {
+		_, err := c.Publish("mytopic", message)
+		require.Nil(t, err)
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 3
+	}, 5*time.Second, 50*time.Millisecond)
+	mu.Lock()
+	sort.Strings(received) // Handlers run concurrently
+	require.Equal(t, []string{"message 1", "message 2", "message 3"}, received)
+	mu.Unlock()
+	require.Nil(t, nextMessage(c)) // Not sent to the Messages channel
+
+	// No more messages after unsubscribing
+	c.Unsubscribe(subscriptionID)
+	time.Sleep(200 * time.Millisecond)
+	_, err = c.Publish("mytopic", "message 4")
+	require.Nil(t, err)
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	require.Equal(t, 3, len(received))
+	mu.Unlock()
+}
+
+func TestClient_SubscribeFunc_SingleWorker_InOrder(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	conf := newTestConfig(port)
+	conf.HandlerWorkers = 1
+	c := client.New(conf)
+
+	received := make(chan string, 10)
+	_, err := c.SubscribeFunc("mytopic", func(m *client.Message) {
+		received <- m.Message
+	})
+	require.Nil(t, err)
+	time.Sleep(500 * time.Millisecond)
+	for i := 1; i <= 5; i++ {
+		_, err := c.Publish("mytopic", fmt.Sprintf("message %d", i))
+		require.Nil(t, err)
+	}
+	for i := 1; i <= 5; i++ {
+		select {
+		case message := <-received:
+			require.Equal(t, fmt.Sprintf("message %d", i), message)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+}
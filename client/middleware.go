@@ -0,0 +1,48 @@
+package client
+
+import (
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+)
+
+// MessageMiddleware processes a received message before it is delivered to the Messages channel (Subscribe), to the
+// handler (SubscribeFunc), or returned by Poll, e.g. to decrypt, decompress, validate or enrich messages. Middlewares
+// are registered via Config.Middlewares, and are called in order, each with the message returned by the previous one.
+//
+// A middleware may modify the message in place, or return a different message. If it returns nil, the message is
+// dropped silently. If it returns an error, the message is dropped and the error is logged; the subscription
+// continues with the next message.
+//
+// Middlewares are called from the goroutine that reads the subscription's connection, so slow middlewares hold up
+// the subscription. Middlewares of different subscriptions may be called concurrently.
+//
+// Example:
+//
+//	config := client.NewConfig()
+//	config.Middlewares = []client.MessageMiddleware{
+//	  func(m *client.Message) (*client.Message, error) {
+//	    if m.Priority < 4 {
+//	      return nil, nil // Drop low priority messages
+//	    }
+//	    m.Title = strings.ToUpper(m.Title)
+//	    return m, nil
+//	  },
+//	}
+type MessageMiddleware func(m *Message) (*Message, error)
+
+// applyMiddlewares passes the message through all middlewares, and returns the resulting message, or nil if it
+// was dropped by one of them
+func applyMiddlewares(logger *log.Logger, middlewares []MessageMiddleware, m *Message) *Message {
+	for _, middleware := range middlewares {
+		id, topicURL := m.ID, m.TopicURL
+		var err error
+		if m, err = middleware(m); err != nil {
+			logger.Warn("%s Message %s dropped by middleware: %s", util.ShortTopicURL(topicURL), id, err.Error())
+			return nil
+		} else if m == nil {
+			logger.Debug("%s Message %s dropped by middleware", util.ShortTopicURL(topicURL), id)
+			return nil
+		}
+	}
+	return m
+}
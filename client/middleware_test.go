@@ -0,0 +1,79 @@
+package client_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestClient_Middlewares_Poll(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	config := newTestConfig(port)
+	config.Middlewares = []client.MessageMiddleware{
+		func(m *client.Message) (*client.Message, error) {
+			if m.Message == "drop" {
+				return nil, nil
+			} else if m.Message == "fail" {
+				return nil, errors.New("invalid message")
+			}
+			m.Message = strings.ToUpper(m.Message)
+			return m, nil
+		},
+		func(m *client.Message) (*client.Message, error) {
+			m.Title = "enriched " + m.Message // Sees the result of the previous middleware
+			return m, nil
+		},
+	}
+	c := client.New(config)
+
+	for _, message := range []string{"message 1", "drop", "fail", "message 2"} {
+		_, err := c.Publish("mytopic", message)
+		require.Nil(t, err)
+	}
+	messages, err := c.Poll("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "MESSAGE 1", messages[0].Message)
+	require.Equal(t, "enriched MESSAGE 1", messages[0].Title)
+	require.Equal(t, "MESSAGE 2", messages[1].Message)
+}
+
+func TestClient_Middlewares_Subscribe(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	config := newTestConfig(port)
+	config.Middlewares = []client.MessageMiddleware{
+		func(m *client.Message) (*client.Message, error) {
+			if m.Priority < 4 {
+				return nil, nil
+			}
+			return m, nil
+		},
+	}
+	c := client.New(config)
+
+	for _, transport := range []string{client.TransportJSON, client.TransportWS} {
+		subscriptionID, err := c.Subscribe("mytopic", client.WithTransport(transport))
+		require.Nil(t, err)
+		time.Sleep(500 * time.Millisecond)
+
+		_, err = c.Publish("mytopic", "low", client.WithPriority("low"))
+		require.Nil(t, err)
+		_, err = c.Publish("mytopic", "urgent", client.WithPriority("urgent"))
+		require.Nil(t, err)
+		time.Sleep(200 * time.Millisecond)
+
+		m := nextMessage(c)
+		require.NotNil(t, m, transport)
+		require.Equal(t, "urgent", m.Message, transport)
+		require.Nil(t, nextMessage(c), transport)
+		c.Unsubscribe(subscriptionID)
+		time.Sleep(200 * time.Millisecond)
+	}
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	networkDialTimeout = 30 * time.Second
+	networkKeepAlive   = 30 * time.Second
+	networkDNSPort     = "53"
+)
+
+// networkContextKey is the context key of the Network of a request, see WithNetwork
+type networkContextKey struct{}
+
+// networkTransports caches the transports of networks, so that connections are reused across requests
+var (
+	networkTransports   = make(map[string]*http.Transport)
+	networkTransportsMu sync.Mutex
+)
+
+// Network configures how a client connects to the server, e.g. on multi-homed hosts or with split-tunnel VPNs,
+// where different servers are reachable over different networks. See WithNetwork.
+type Network struct {
+	// Proxy is the URL of the proxy server, e.g. http://proxy.lan:3128 or socks5://127.0.0.1:1080.
+	Proxy string `yaml:"proxy"`
+	// BindAddress is the local (source) IP address of connections, e.g. 10.8.0.2.
+	BindAddress string `yaml:"bind-address"`
+	// BindInterface is the network interface of connections, e.g. eth1 or wg0. Its first IPv4 address (or IPv6
+	// address, if it has no IPv4 address) is used as source address; it is looked up for every connection.
+	BindInterface string `yaml:"bind-interface"`
+	// DNS is the list of DNS servers used to resolve the server's host name, e.g. 10.8.0.1 or 10.8.0.1:53.
+	DNS []string `yaml:"dns"`
+}
+
+// IsZero returns true if no network settings are set, i.e. if the default network is used
+func (n *Network) IsZero() bool {
+	return n == nil || (n.Proxy == "" && n.BindAddress == "" && n.BindInterface == "" && len(n.DNS) == 0)
+}
+
+// Validate checks the network settings, so that errors are reported before connecting
+func (n *Network) Validate() error {
+	if n.IsZero() {
+		return nil
+	}
+	if n.Proxy != "" {
+		u, err := url.Parse(n.Proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid proxy URL %s", n.Proxy)
+		} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			return fmt.Errorf("invalid proxy URL %s: scheme must be http, https or socks5", n.Proxy)
+		}
+	}
+	if n.BindAddress != "" && n.BindInterface != "" {
+		return errors.New("cannot set both bind-address and bind-interface")
+	} else if n.BindAddress != "" && net.ParseIP(n.BindAddress) == nil {
+		return fmt.Errorf("invalid bind address %s", n.BindAddress)
+	}
+	for _, server := range n.DNS {
+		host := server
+		if h, _, err := net.SplitHostPort(server); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid DNS server %s, must be an IP address", server)
+		}
+	}
+	return nil
+}
+
+// WithNetwork sends the request via the given network, e.g. via a proxy or from a specific network interface,
+// instead of the network of the client. If the client has a custom transport (see Config.Transport), it is
+// not used for the request.
+func WithNetwork(network *Network) RequestOption {
+	return func(r *http.Request) error {
+		if network.IsZero() {
+			return nil
+		} else if err := network.Validate(); err != nil {
+			return err
+		}
+		*r = *r.WithContext(context.WithValue(r.Context(), networkContextKey{}, network))
+		return nil
+	}
+}
+
+// networkHTTPClient returns a copy of httpClient that uses the transport of the network of the request (see
+// WithNetwork), or httpClient itself if the request has no network. Stats (see Stats), tracing (see
+// Config.TraceWriter) and the TLS settings (see Config.TLSConfig) are retained. Networks do not apply to requests
+// to unix:// URLs.
+func networkHTTPClient(httpClient *http.Client, req *http.Request) (*http.Client, error) {
+	network, ok := req.Context().Value(networkContextKey{}).(*Network)
+	if !ok || req.URL.Scheme == unixScheme {
+		return httpClient, nil
+	}
+	transport, err := network.transport(transportTLSConfig(httpClient.Transport))
+	if err != nil {
+		return nil, err
+	}
+	c := *httpClient
+	c.Transport = replaceBaseTransport(httpClient.Transport, transport)
+	return &c, nil
+}
+
+// replaceBaseTransport returns a copy of the stats and tracing transports that wrap transport (if any), wrapping base
+// instead. The Unix socket transport is dropped, since networks do not apply to unix:// URLs.
+func replaceBaseTransport(transport http.RoundTripper, base http.RoundTripper) http.RoundTripper {
+	switch t := transport.(type) {
+	case *statsTransport:
+		return newStatsTransport(replaceBaseTransport(t.next, base), t.stats)
+	case *tracingTransport:
+		return newTracingTransport(replaceBaseTransport(t.next, base), t.w)
+	}
+	return base
+}
+
+// transport returns the (cached) transport of the network, using the TLS settings of the client (see Config.TLSConfig)
+func (n *Network) transport(tlsConfig *tls.Config) (*http.Transport, error) {
+	key := fmt.Sprintf("%s|%s|%s|%s|%p", n.Proxy, n.BindAddress, n.BindInterface, strings.Join(n.DNS, ","), tlsConfig)
+	networkTransportsMu.Lock()
+	defer networkTransportsMu.Unlock()
+	if t, ok := networkTransports[key]; ok {
+		return t, nil
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	if n.Proxy != "" {
+		proxyURL, err := url.Parse(n.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+	t.DialContext = n.dialContext
+	t.TLSClientConfig = tlsConfig
+	networkTransports[key] = t
+	return t, nil
+}
+
+// dialContext connects from the bind address or interface (if any), and resolves host names via the
+// DNS servers (if any). DNS queries are sent from the same address.
+func (n *Network) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer, err := n.dialer(network)
+	if err != nil {
+		return nil, err
+	}
+	if len(n.DNS) > 0 {
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				dnsDialer, err := n.dialer(network)
+				if err != nil {
+					return nil, err
+				}
+				var conn net.Conn
+				for _, server := range n.DNS {
+					if _, _, err := net.SplitHostPort(server); err != nil {
+						server = net.JoinHostPort(server, networkDNSPort)
+					}
+					if conn, err = dnsDialer.DialContext(ctx, network, server); err == nil {
+						return conn, nil
+					}
+				}
+				return nil, err
+			},
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+func (n *Network) dialer(network string) (*net.Dialer, error) {
+	dialer := &net.Dialer{
+		Timeout:   networkDialTimeout,
+		KeepAlive: networkKeepAlive,
+	}
+	ip, err := n.localIP()
+	if err != nil {
+		return nil, err
+	} else if ip != nil && strings.HasPrefix(network, "udp") {
+		dialer.LocalAddr = &net.UDPAddr{IP: ip}
+	} else if ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return dialer, nil
+}
+
+// localIP returns the source IP address of connections, or nil if it is not set
+func (n *Network) localIP() (net.IP, error) {
+	if n.BindAddress != "" {
+		return net.ParseIP(n.BindAddress), nil
+	} else if n.BindInterface == "" {
+		return nil, nil
+	}
+	iface, err := net.InterfaceByName(n.BindInterface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var ipv6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		} else if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		} else if ipv6 == nil {
+			ipv6 = ipNet.IP
+		}
+	}
+	if ipv6 == nil {
+		return nil, fmt.Errorf("network interface %s has no usable IP address", n.BindInterface)
+	}
+	return ipv6, nil
+}
@@ -0,0 +1,85 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestNetwork_Validate(t *testing.T) {
+	require.Nil(t, (&client.Network{}).Validate())
+	require.Nil(t, (&client.Network{Proxy: "socks5://127.0.0.1:1080", BindAddress: "10.8.0.2", DNS: []string{"10.8.0.1", "[fd00::1]:53"}}).Validate())
+	require.Error(t, (&client.Network{Proxy: "ftp://proxy.lan"}).Validate())
+	require.Error(t, (&client.Network{Proxy: "proxy.lan:3128"}).Validate())
+	require.Error(t, (&client.Network{BindAddress: "10.8.0.2", BindInterface: "wg0"}).Validate())
+	require.Error(t, (&client.Network{BindAddress: "not-an-ip"}).Validate())
+	require.Error(t, (&client.Network{DNS: []string{"dns.example.com"}}).Validate())
+}
+
+func TestClient_Poll_WithNetwork_Proxy(t *testing.T) {
+	var proxiedURL string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURL = r.URL.String() // Absolute URL, since this is a proxy request
+		w.Write([]byte(`{"id":"abcdefghijkl","time":1700000000,"event":"message","topic":"mytopic","message":"via proxy"}` + "\n"))
+	}))
+	defer proxy.Close()
+
+	c := client.New(client.NewConfig())
+	messages, err := c.Poll("http://ntfy.invalid/mytopic", client.WithNetwork(&client.Network{Proxy: proxy.URL}))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "via proxy", messages[0].Message)
+	require.Equal(t, "http://ntfy.invalid/mytopic/json?poll=1", proxiedURL)
+}
+
+func TestClient_Publish_WithNetwork_BindAddress(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	m, err := c.Publish("mytopic", "from loopback", client.WithNetwork(&client.Network{BindAddress: "127.0.0.1"}))
+	require.Nil(t, err)
+	require.Equal(t, "from loopback", m.Message)
+
+	// Source address that is not on this host
+	_, err = c.Publish("mytopic", "from elsewhere", client.WithNetwork(&client.Network{BindAddress: "192.0.2.1"}))
+	require.Error(t, err)
+
+	// Invalid settings are rejected before connecting
+	_, err = c.Publish("mytopic", "invalid", client.WithNetwork(&client.Network{BindAddress: "not-an-ip"}))
+	require.ErrorContains(t, err, "invalid bind address")
+}
+
+func TestClient_Poll_WithNetwork_DNS(t *testing.T) {
+	c := client.New(client.NewConfig())
+	_, err := c.Poll("http://ntfy.invalid/mytopic", client.WithNetwork(&client.Network{DNS: []string{"127.0.0.1:1"}})) // Nothing listens there
+	require.Error(t, err)
+}
+
+func TestConfig_Load_Network(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "client.yml")
+	require.Nil(t, os.WriteFile(filename, []byte(`
+subscribe:
+  - topic: intranet.example.com/alerts
+    bind-interface: wg0
+    dns: [10.8.0.1]
+  - topic: ntfy.example.com/builds
+    proxy: socks5://127.0.0.1:1080
+    bind-address: 192.168.1.20
+  - topic: mytopic
+`), 0600))
+	conf, err := client.LoadConfig(filename)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(conf.Subscribe))
+	require.Equal(t, "wg0", conf.Subscribe[0].Network.BindInterface)
+	require.Equal(t, []string{"10.8.0.1"}, conf.Subscribe[0].Network.DNS)
+	require.Equal(t, "socks5://127.0.0.1:1080", conf.Subscribe[1].Network.Proxy)
+	require.Equal(t, "192.168.1.20", conf.Subscribe[1].Network.BindAddress)
+	require.True(t, conf.Subscribe[2].Network.IsZero())
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"heckel.io/ntfy/v2/util"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 )
@@ -59,6 +60,16 @@ func WithTags(tags []string) PublishOption {
 	return WithTagsList(strings.Join(tags, ","))
 }
 
+// WithMetadata adds a custom key/value field to a message, which is stored and delivered with the message, and can
+// be used to filter messages when subscribing (see WithMetadataFilter). It can be passed multiple times.
+//
+// Parameters:
+//   - key: The metadata key, i.e. lowercase letters, digits, dashes and underscores (max. 32 characters).
+//   - value: The metadata value (max. 256 bytes).
+func WithMetadata(key, value string) PublishOption {
+	return WithHeader("X-Meta-"+key, value)
+}
+
 // WithDelay instructs the server to send the message at a later date. The delay parameter can be a
 // Unix timestamp, a duration string or a natural langage string. See https://ntfy.sh/docs/publish/#scheduled-delivery
 // for details.
@@ -124,6 +135,25 @@ func WithFilename(filename string) PublishOption {
 	return WithHeader("X-Filename", filename)
 }
 
+// WithProgress reports the progress of uploading the message body, e.g. a file attachment. If the size of the
+// body is not known (e.g. when reading from stdin), the total passed to fn is -1 until the upload is complete.
+//
+// Parameters:
+//   - fn: The callback, called with the number of bytes uploaded so far and the total number of bytes.
+func WithProgress(fn util.ProgressFunc) PublishOption {
+	return func(r *http.Request) error {
+		if r.Body == nil || r.Body == http.NoBody {
+			return nil
+		}
+		total := r.ContentLength
+		if total == 0 {
+			total = -1 // Unknown, see http.Request.ContentLength
+		}
+		r.Body = util.NewProgressReader(r.Body, total, fn)
+		return nil
+	}
+}
+
 // WithEmail instructs the server to also send the message to the given e-mail address.
 //
 // Parameters:
@@ -132,7 +162,8 @@ func WithEmail(email string) PublishOption {
 	return WithHeader("X-Email", email)
 }
 
-// WithBasicAuth adds the Authorization header for basic auth to the request.
+// WithBasicAuth adds the Authorization header for basic auth to the request. It overrides the credentials from the
+// config (see Config.DefaultUser and Config.Subscribe), which are otherwise added automatically.
 //
 // Parameters:
 //   - user: The username.
@@ -141,15 +172,25 @@ func WithBasicAuth(user, pass string) PublishOption {
 	return WithHeader("Authorization", util.BasicAuth(user, pass))
 }
 
-// WithBearerAuth adds the Authorization header for Bearer auth to the request.
+// WithBearerToken adds the Authorization header for Bearer auth (e.g. with an access token, tk_...) to the request. It
+// overrides the credentials from the config (see Config.DefaultToken and Config.Subscribe), which are otherwise added
+// automatically.
 //
 // Parameters:
 //   - token: The bearer token.
-func WithBearerAuth(token string) PublishOption {
+func WithBearerToken(token string) PublishOption {
 	return WithHeader("Authorization", fmt.Sprintf("Bearer %s", token))
 }
 
-// WithEmptyAuth clears the Authorization header.
+// WithBearerAuth is the same as WithBearerToken.
+//
+// Parameters:
+//   - token: The bearer token.
+func WithBearerAuth(token string) PublishOption {
+	return WithBearerToken(token)
+}
+
+// WithEmptyAuth clears the Authorization header, e.g. to send a request without the credentials from the config.
 func WithEmptyAuth() PublishOption {
 	return RemoveHeader("Authorization")
 }
@@ -165,10 +206,11 @@ func WithNoFirebase() PublishOption {
 }
 
 // WithSince limits the number of messages returned from the server. The parameter since can be a Unix
-// timestamp (see WithSinceUnixTime), a duration (WithSinceDuration) the word "all" (see WithSinceAll).
+// timestamp (see WithSinceUnixTime), a duration (WithSinceDuration) the word "all" (see WithSinceAll), a message
+// ID, or the resume token of a message (see Message.Resume) to continue right after that message.
 //
 // Parameters:
-//   - since: The time specifier.
+//   - since: The time specifier, message ID or resume token.
 func WithSince(since string) SubscribeOption {
 	return WithQueryParam("since", since)
 }
@@ -200,6 +242,33 @@ func WithPoll() SubscribeOption {
 	return WithQueryParam("poll", "1")
 }
 
+// WithLongPoll instructs Subscribe to use long polling instead of a streaming connection. Each request waits up to
+// the given duration for new messages, and the next request continues after the last received message. This is
+// meant for networks in which proxies or other middleboxes break streaming HTTP connections. The server limits
+// the wait time to 5 minutes.
+//
+// Parameters:
+//   - wait: The maximum time each long poll request waits for new messages, e.g. 30 * time.Second.
+func WithLongPoll(wait time.Duration) SubscribeOption {
+	return WithQueryParam(longPollParam, wait.String())
+}
+
+// WithTransport selects how Subscribe and Poll receive messages: TransportJSON (default) uses a streaming HTTP
+// connection to the /json endpoint, and TransportWS uses a WebSocket connection to the /ws endpoint. WebSockets
+// are meant for networks in which proxies kill long-lived HTTP streams. They cannot be combined with WithLongPoll.
+//
+// Parameters:
+//   - transport: The transport, TransportJSON or TransportWS.
+func WithTransport(transport string) SubscribeOption {
+	return func(r *http.Request) error {
+		if transport != TransportJSON && transport != TransportWS {
+			return fmt.Errorf("invalid transport %s, must be %s or %s", transport, TransportJSON, TransportWS)
+		}
+		r.URL.Path = path.Join(path.Dir(r.URL.Path), transport)
+		return nil
+	}
+}
+
 // WithScheduled instructs the server to also return messages that have not been sent yet, i.e. delayed/scheduled
 // messages (see WithDelay). The messages will have a future date.
 func WithScheduled() SubscribeOption {
@@ -231,21 +300,77 @@ func WithTitleFilter(title string) SubscribeOption {
 	return WithQueryParam("title", title)
 }
 
-// WithPriorityFilter instructs the server to only return messages with the matching priority. Not that messages
-// without priority also implicitly match priority 3.
+// WithIDFilter instructs the server to only return the message with the given ID.
+//
+// Parameters:
+//   - id: The message ID to match.
+func WithIDFilter(id string) SubscribeOption {
+	return WithQueryParam("id", id)
+}
+
+// WithPriorityFilter instructs the server to only return messages with any of the given priorities. Note that
+// messages without priority also implicitly match priority 3. Without priorities, the option does nothing.
 //
 // Parameters:
-//   - priority: The priority level to match.
-func WithPriorityFilter(priority int) SubscribeOption {
-	return WithQueryParam("priority", fmt.Sprintf("%d", priority))
+//   - priorities: The priority levels to match (1-5).
+func WithPriorityFilter(priorities ...int) SubscribeOption {
+	return func(r *http.Request) error {
+		if len(priorities) == 0 {
+			return nil
+		}
+		values := make([]string, 0, len(priorities))
+		for _, priority := range priorities {
+			if priority < 1 || priority > 5 {
+				return fmt.Errorf("invalid priority %d, must be between 1 and 5", priority)
+			}
+			values = append(values, fmt.Sprintf("%d", priority))
+		}
+		return WithQueryParam("priority", strings.Join(values, ","))(r)
+	}
+}
+
+// WithPriorityRangeFilter instructs the server to only return messages with a priority between min and max
+// (inclusive), e.g. WithPriorityRangeFilter(4, 5) for high and urgent messages. Note that messages without
+// priority also implicitly match priority 3.
+//
+// Parameters:
+//   - min: The minimum priority level (1-5).
+//   - max: The maximum priority level (1-5).
+func WithPriorityRangeFilter(min, max int) SubscribeOption {
+	return func(r *http.Request) error {
+		if min > max {
+			return fmt.Errorf("invalid priority range %d-%d, min must not be larger than max", min, max)
+		}
+		priorities := make([]int, 0)
+		for priority := min; priority <= max; priority++ {
+			priorities = append(priorities, priority)
+		}
+		return WithPriorityFilter(priorities...)(r)
+	}
 }
 
 // WithTagsFilter instructs the server to only return messages that contain all of the given tags.
+// If no tags are passed, this option is a no-op.
+//
+// Parameters:
+//   - tags: The tags to match.
+func WithTagsFilter(tags ...string) SubscribeOption {
+	return func(r *http.Request) error {
+		if len(tags) == 0 {
+			return nil
+		}
+		return WithQueryParam("tags", strings.Join(tags, ","))(r)
+	}
+}
+
+// WithMetadataFilter instructs the server to only return messages with the given metadata value (see WithMetadata).
+// It can be passed multiple times, in which case messages must match all of them.
 //
 // Parameters:
-//   - tags: The list of tags to match.
-func WithTagsFilter(tags []string) SubscribeOption {
-	return WithQueryParam("tags", strings.Join(tags, ","))
+//   - key: The metadata key.
+//   - value: The metadata value to match.
+func WithMetadataFilter(key, value string) SubscribeOption {
+	return WithQueryParam("meta-"+strings.ToLower(key), value)
 }
 
 // WithHeader is a generic option to add headers to a request.
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"slices"
+	"strings"
+
+	"heckel.io/ntfy/v2/util"
+)
+
+// pollLimitContextKey is the context key of the message limit of a poll request, see WithLimit
+type pollLimitContextKey struct{}
+
+// WithLimit limits the number of messages returned by Client.Poll (and Client.PollFunc) to the first n messages.
+// Once n messages are received, the connection is closed, so the remaining messages are neither transferred nor
+// held in memory. Messages dropped by a middleware (see Config.Middlewares) do not count towards the limit. To read
+// all messages in chunks of n messages, use Client.PollPages.
+//
+// Parameters:
+//   - n: The max number of messages, must be positive.
+func WithLimit(n int) SubscribeOption {
+	return func(r *http.Request) error {
+		if n <= 0 {
+			return errors.New("limit must be positive")
+		}
+		*r = *r.WithContext(context.WithValue(r.Context(), pollLimitContextKey{}, n))
+		return nil
+	}
+}
+
+// pollLimit returns the message limit of the request (see WithLimit), or 0 if it has none. The limit only applies to
+// poll requests, not to subscriptions.
+func pollLimit(req *http.Request) int {
+	limit, ok := req.Context().Value(pollLimitContextKey{}).(int)
+	if !ok || req.URL.Query().Get("poll") == "" {
+		return 0
+	}
+	return limit
+}
+
+// PollFunc is like Poll, but passes the messages to the handler one by one as they are received, instead of
+// returning them all at once, so that even topics with a large number of cached messages can be polled with
+// bounded memory. If the handler returns an error, polling is stopped and the error is returned.
+//
+// Parameters:
+//   - topic: The topic to poll, or a comma-separated list of topics.
+//   - handler: The function called for every message, in the order in which the messages were received.
+//   - options: Optional configuration for the poll request, see Poll.
+//
+// Returns:
+//   - An error if the request failed, or the error returned by the handler.
+func (c *Client) PollFunc(topic string, handler func(m *Message) error, options ...SubscribeOption) error {
+	topicURL, err := c.expandTopicsURL(topic)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgChan := make(chan *Message)
+	errChan := make(chan error, 1)
+	c.config.Logger.Debug("%s Polling from topic", util.ShortTopicURL(topicURL))
+	options = append(slices.Clone(c.withConfigAuth(topicURL, options)), WithPoll())
+	go func() {
+		_, err := performSubscribeRequest(ctx, c.httpClient, c.config.Logger, msgChan, c.config.Middlewares, c.stats.poll(topicURL), topicURL, "", nil, 0, options...)
+		close(msgChan)
+		errChan <- err
+	}()
+	var handlerErr error
+	for m := range msgChan {
+		if handlerErr != nil {
+			continue // Drain until the request is canceled
+		} else if handlerErr = handler(m); handlerErr != nil {
+			cancel()
+		}
+	}
+	if err := <-errChan; handlerErr == nil {
+		return err
+	}
+	return handlerErr
+}
+
+// PollCursor reads the messages of a topic page by page, see Client.PollPages
+type PollCursor struct {
+	client   *Client
+	topic    string
+	pageSize int
+	options  []SubscribeOption
+	lastID   string // ID of the last message of the previous page, empty before the first page
+	done     bool
+}
+
+// PollPages returns a cursor that polls a topic page by page, with at most pageSize messages per page, so that
+// topics with a large number of cached messages can be read without loading all messages at once. Each page is a
+// separate poll request that continues after the last message of the previous page. The options (e.g. WithSince
+// or filters) apply to all pages.
+//
+// Only a single topic can be paginated, since the pages of multiple topics may overlap.
+//
+// Example:
+//
+//	cursor := c.PollPages("mytopic", 100, client.WithSinceAll())
+//	for m, err := range cursor.All() {
+//	  if err != nil {
+//	    return err
+//	  }
+//	  fmt.Println(m.Message)
+//	}
+//
+// Parameters:
+//   - topic: The topic to poll.
+//   - pageSize: The max number of messages per page.
+//   - options: Optional configuration for the poll requests, see Poll.
+//
+// Returns:
+//   - A cursor, see PollCursor.Next and PollCursor.All.
+func (c *Client) PollPages(topic string, pageSize int, options ...SubscribeOption) *PollCursor {
+	return &PollCursor{
+		client:   c,
+		topic:    topic,
+		pageSize: pageSize,
+		options:  options,
+	}
+}
+
+// Next polls the next page of messages. Once all messages have been read, it returns an empty page.
+//
+// Returns:
+//   - The messages of the next page (empty if there are no more messages), or an error if the request failed.
+//     After an error, Next can be called again to retry the page.
+func (p *PollCursor) Next() ([]*Message, error) {
+	if strings.Contains(p.topic, ",") {
+		return nil, errors.New("pagination is not supported for multiple topics")
+	} else if p.done {
+		return make([]*Message, 0), nil
+	}
+	options := append(slices.Clone(p.options), WithLimit(p.pageSize))
+	if p.lastID != "" {
+		options = append(options, withSinceID(p.lastID))
+	}
+	messages, err := p.client.Poll(p.topic, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) < p.pageSize {
+		p.done = true
+	}
+	if len(messages) > 0 {
+		p.lastID = messages[len(messages)-1].ID
+	}
+	return messages, nil
+}
+
+// All returns an iterator over the messages of all remaining pages. Iteration stops after the first error.
+func (p *PollCursor) All() iter.Seq2[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		for {
+			messages, err := p.Next()
+			if err != nil {
+				yield(nil, err)
+				return
+			} else if len(messages) == 0 {
+				return
+			}
+			for _, m := range messages {
+				if !yield(m, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// withSinceID replaces the since parameter of the request with the given message ID, see PollCursor.Next
+func withSinceID(id string) SubscribeOption {
+	return func(r *http.Request) error {
+		q := r.URL.Query()
+		q.Set("since", id)
+		r.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
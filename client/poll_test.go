@@ -0,0 +1,98 @@
+package client_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestClient_Poll_Limit(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+	for i := 1; i <= 5; i++ {
+		_, err := c.Publish("mytopic", fmt.Sprintf("message %d", i))
+		require.Nil(t, err)
+	}
+
+	for _, transport := range []string{client.TransportJSON, client.TransportWS} {
+		messages, err := c.Poll("mytopic", client.WithLimit(2), client.WithTransport(transport))
+		require.Nil(t, err)
+		require.Equal(t, 2, len(messages), transport)
+		require.Equal(t, "message 1", messages[0].Message)
+		require.Equal(t, "message 2", messages[1].Message)
+	}
+
+	_, err := c.Poll("mytopic", client.WithLimit(0))
+	require.Error(t, err)
+}
+
+func TestClient_PollFunc(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+	for i := 1; i <= 3; i++ {
+		_, err := c.Publish("mytopic", fmt.Sprintf("message %d", i))
+		require.Nil(t, err)
+	}
+
+	received := make([]string, 0)
+	err := c.PollFunc("mytopic", func(m *client.Message) error {
+		received = append(received, m.Message)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"message 1", "message 2", "message 3"}, received)
+
+	// Handler error stops polling
+	errStop := errors.New("stop")
+	received = make([]string, 0)
+	err = c.PollFunc("mytopic", func(m *client.Message) error {
+		received = append(received, m.Message)
+		return errStop
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, []string{"message 1"}, received)
+}
+
+func TestClient_PollPages(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+	for i := 1; i <= 7; i++ {
+		_, err := c.Publish("mytopic", fmt.Sprintf("message %d", i))
+		require.Nil(t, err)
+	}
+
+	cursor := c.PollPages("mytopic", 3)
+	for _, expected := range []int{3, 3, 1, 0, 0} {
+		messages, err := cursor.Next()
+		require.Nil(t, err)
+		require.Equal(t, expected, len(messages))
+	}
+
+	received := make([]string, 0)
+	for m, err := range c.PollPages("mytopic", 2).All() {
+		require.Nil(t, err)
+		received = append(received, m.Message)
+	}
+	require.Equal(t, 7, len(received))
+	for i, message := range received {
+		require.Equal(t, fmt.Sprintf("message %d", i+1), message)
+	}
+
+	// Exactly one full page
+	messages := make([]*client.Message, 0)
+	for m, err := range c.PollPages("mytopic", 7).All() {
+		require.Nil(t, err)
+		messages = append(messages, m)
+	}
+	require.Equal(t, 7, len(messages))
+
+	_, err := c.PollPages("mytopic,othertopic", 3).Next()
+	require.Error(t, err)
+}
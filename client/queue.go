@@ -0,0 +1,248 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"heckel.io/ntfy/v2/util"
+)
+
+// ErrQueued is returned by Publish if the message could not be published, but was written to the queue
+// directory to be retried in the background, see Config.QueueDir. The error also wraps the publish error.
+var ErrQueued = errors.New("message queued for retry")
+
+const (
+	queueFileSuffix       = ".json"
+	queueMaxRetryInterval = 5 * time.Minute
+)
+
+// publishQueue is the persistent outbox of a client, see Config.QueueDir. Every message is stored in its own
+// file, named after the time it was queued, so that messages are retried in order.
+type publishQueue struct {
+	client  *Client
+	dir     string
+	running bool       // True if the retry goroutine is running
+	mu      sync.Mutex // Protects running
+	flushMu sync.Mutex // Makes sure that messages are only sent once, see flush
+}
+
+// queuedMessage is a message in the queue. It contains the publish request with all options applied, and
+// the network of the request, if any (see WithNetwork).
+type queuedMessage struct {
+	TopicURL string      `json:"topic_url"`
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header"`
+	Body     string      `json:"body"`
+	Network  *Network    `json:"network,omitempty"`
+	Queued   int64       `json:"queued"` // Unix time
+}
+
+func newPublishQueue(c *Client, dir string) *publishQueue {
+	q := &publishQueue{
+		client: c,
+		dir:    dir,
+	}
+	if filenames, err := q.filenames(); err == nil && len(filenames) > 0 {
+		c.config.Logger.Debug("Found %d queued message(s) in %s, retrying in the background", len(filenames), dir)
+		q.start()
+	}
+	return q
+}
+
+// FlushQueue publishes all queued messages immediately, instead of waiting for the next background retry,
+// see Config.QueueDir. Messages are published in order, and rejected messages (e.g. HTTP 403) are removed
+// from the queue.
+//
+// Returns:
+//   - The number of messages that are still queued, and the error of the first message that could not be
+//     published (if any). If Config.QueueDir is not set, 0 and nil are returned.
+func (c *Client) FlushQueue() (int, error) {
+	if c.queue == nil {
+		return 0, nil
+	}
+	return c.queue.flush()
+}
+
+// publishOrQueue publishes a message, and writes it to the queue if the server cannot be reached
+func (c *Client) publishOrQueue(topic, message string, options []PublishOption) (*Message, error) {
+	req, topicURL, err := c.newPublishRequest(topic, strings.NewReader(message), options)
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get(idempotencyKeyHeader) == "" {
+		req.Header.Set(idempotencyKeyHeader, util.RandomString(idempotencyKeyLength)) // Do not publish twice if a retry succeeds after a timeout
+	}
+	entry := &queuedMessage{
+		TopicURL: topicURL,
+		URL:      req.URL.String(),
+		Header:   req.Header.Clone(),
+		Body:     message,
+		Queued:   time.Now().Unix(),
+	}
+	if network, ok := req.Context().Value(networkContextKey{}).(*Network); ok {
+		entry.Network = network
+	}
+	m, err := c.sendPublishRequest(req, topicURL, maxResponseBytes)
+	if err == nil || !retryable(err) {
+		return m, err
+	}
+	if qerr := c.queue.add(entry); qerr != nil {
+		return nil, fmt.Errorf("cannot queue message: %s, publish failed: %w", qerr.Error(), err)
+	}
+	c.config.Logger.Debug("%s Cannot publish message, queued for retry: %s", util.ShortTopicURL(topicURL), err.Error())
+	return nil, fmt.Errorf("%w: %w", ErrQueued, err)
+}
+
+// add writes a message to the queue, and starts the retry goroutine if it is not running
+func (q *publishQueue) add(entry *queuedMessage) error {
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(q.dir, fmt.Sprintf("%020d-%s%s", time.Now().UnixNano(), util.RandomString(8), queueFileSuffix))
+	if err := os.WriteFile(filename+".tmp", b, 0600); err != nil {
+		return err
+	} else if err := os.Rename(filename+".tmp", filename); err != nil { // Do not retry partially written messages
+		return err
+	}
+	q.start()
+	return nil
+}
+
+func (q *publishQueue) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running {
+		return
+	}
+	q.running = true
+	go q.run()
+}
+
+// run retries the queued messages with exponential backoff, and stops once the queue is empty. The queue is
+// checked while holding the lock, so that a message added concurrently either is seen, or restarts the goroutine.
+func (q *publishQueue) run() {
+	initial := q.client.config.QueueRetryInterval
+	if initial <= 0 {
+		initial = DefaultQueueRetryInterval
+	}
+	interval := initial
+	for {
+		select {
+		case <-time.After(interval):
+		case <-q.client.done:
+			q.mu.Lock()
+			q.running = false
+			q.mu.Unlock()
+			return // Client closed, see Client.Close
+		}
+		if _, err := q.flush(); err != nil {
+			interval = min(interval*2, queueMaxRetryInterval)
+			q.client.config.Logger.Debug("Cannot publish queued messages, retrying in %s: %s", interval, err.Error())
+		} else {
+			interval = initial
+		}
+		q.mu.Lock()
+		if filenames, err := q.filenames(); err != nil || len(filenames) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+	}
+}
+
+// flush publishes the queued messages in order, and stops at the first message that cannot be published because
+// the server cannot be reached. Messages that are rejected by the server are removed, since retrying them is futile.
+func (q *publishQueue) flush() (int, error) {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+	filenames, err := q.filenames()
+	if err != nil {
+		return 0, err
+	}
+	for i, filename := range filenames {
+		entry, err := readQueuedMessage(filename)
+		if err != nil {
+			q.client.config.Logger.Warn("Removing invalid queued message %s: %s", filename, err.Error())
+		} else if _, err := q.client.publishQueuedMessage(entry); err != nil && retryable(err) {
+			return len(filenames) - i, err
+		} else if err != nil {
+			q.client.config.Logger.Warn("%s Queued message rejected by server, removing it: %s", util.ShortTopicURL(entry.TopicURL), err.Error())
+		}
+		if err := os.Remove(filename); err != nil {
+			return len(filenames) - i, err
+		}
+	}
+	return 0, nil
+}
+
+// filenames returns the files of the queued messages, oldest first
+func (q *publishQueue) filenames() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	filenames := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), queueFileSuffix) {
+			filenames = append(filenames, filepath.Join(q.dir, entry.Name()))
+		}
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+func (c *Client) publishQueuedMessage(entry *queuedMessage) (*Message, error) {
+	req, err := http.NewRequest(http.MethodPost, entry.URL, strings.NewReader(entry.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = entry.Header
+	if entry.Network != nil {
+		if err := WithNetwork(entry.Network)(req); err != nil {
+			return nil, err
+		}
+	}
+	c.config.Logger.Debug("%s Publishing message queued at %s", util.ShortTopicURL(entry.TopicURL), time.Unix(entry.Queued, 0).Format(time.RFC3339))
+	return c.sendPublishRequest(req, entry.TopicURL, maxResponseBytes)
+}
+
+func readQueuedMessage(filename string) (*queuedMessage, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entry queuedMessage
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, err
+	} else if entry.URL == "" || entry.TopicURL == "" {
+		return nil, errors.New("topic URL missing")
+	}
+	return &entry, nil
+}
+
+// retryable returns true if publishing failed because the server could not be reached, or responded with
+// a server error (e.g. a proxy responding with HTTP 502). Messages rejected by the server are not retried.
+func retryable(err error) bool {
+	var httpErr *Error
+	var urlErr *url.Error
+	if errors.As(err, &httpErr) {
+		return httpErr.HTTPCode >= http.StatusInternalServerError
+	}
+	return errors.As(err, &urlErr)
+}
@@ -0,0 +1,156 @@
+package client_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestClient_Publish_Queue_FlushInOrder(t *testing.T) {
+	var up atomic.Bool
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, fmt.Sprintf("%s %s", r.Header.Get("X-Title"), body))
+		mu.Unlock()
+		fmt.Fprintf(w, `{"id":"abcdefghijkl","time":1700000000,"event":"message","topic":"mytopic","message":"%s"}`, body)
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "queue")
+	conf := client.NewConfig()
+	conf.QueueDir = dir
+	conf.QueueRetryInterval = time.Hour // Only flush manually
+	c := client.New(conf)
+
+	for i := 1; i <= 3; i++ {
+		m, err := c.Publish(server.URL+"/mytopic", fmt.Sprintf("message %d", i), client.WithTitle(fmt.Sprintf("title %d", i)))
+		require.ErrorIs(t, err, client.ErrQueued)
+		require.Nil(t, m)
+		var httpErr *client.Error
+		require.True(t, errors.As(err, &httpErr))
+		require.Equal(t, http.StatusBadGateway, httpErr.HTTPCode)
+	}
+	files, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(files))
+	info, err := files[0].Info()
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	remaining, err := c.FlushQueue()
+	require.Equal(t, 3, remaining)
+	require.Error(t, err)
+
+	up.Store(true)
+	remaining, err = c.FlushQueue()
+	require.Nil(t, err)
+	require.Equal(t, 0, remaining)
+	require.Equal(t, []string{"title 1 message 1", "title 2 message 2", "title 3 message 3"}, received)
+	files, err = os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Empty(t, files)
+}
+
+func TestClient_Publish_Queue_RetryInBackground(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+
+	var requests atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		req, _ := http.NewRequest(r.Method, fmt.Sprintf("http://127.0.0.1:%d%s", port, r.URL.Path), r.Body)
+		req.Header = r.Header
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	conf := newTestConfig(port)
+	conf.QueueDir = t.TempDir()
+	conf.QueueRetryInterval = 10 * time.Millisecond
+	c := client.New(conf)
+	_, err := c.Publish(proxy.URL+"/mytopic", "hello", client.WithPriority("high"))
+	require.ErrorIs(t, err, client.ErrQueued)
+
+	var messages []*client.Message
+	require.Eventually(t, func() bool {
+		messages, err = c.Poll("mytopic")
+		return err == nil && len(messages) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Equal(t, "hello", messages[0].Message)
+	require.Equal(t, 4, messages[0].Priority)
+	require.GreaterOrEqual(t, requests.Load(), int32(4))
+}
+
+func TestClient_Publish_Queue_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	conf := client.NewConfig()
+	conf.QueueDir = dir
+	conf.QueueRetryInterval = time.Hour
+	_, err := client.New(conf).Publish("http://127.0.0.1:1/mytopic", "offline") // Connection refused
+	require.ErrorIs(t, err, client.ErrQueued)
+
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	files, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(files))
+	b, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(filepath.Join(dir, files[0].Name()), []byte(strings.ReplaceAll(string(b), "127.0.0.1:1", fmt.Sprintf("127.0.0.1:%d", port))), 0600))
+
+	// A new client with the same queue directory retries the message in the background
+	conf = newTestConfig(port)
+	conf.QueueDir = dir
+	conf.QueueRetryInterval = 10 * time.Millisecond
+	c := client.New(conf)
+	require.Eventually(t, func() bool {
+		messages, err := c.Poll("mytopic")
+		return err == nil && len(messages) == 1 && messages[0].Message == "offline"
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestClient_Publish_Queue_RejectedNotQueued(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	conf := newTestConfig(port)
+	conf.QueueDir = t.TempDir()
+	c := client.New(conf)
+
+	_, err := c.Publish("mytopic", "invalid", client.WithPriority("invalid"))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, client.ErrQueued)
+	files, err := os.ReadDir(conf.QueueDir)
+	require.Nil(t, err)
+	require.Empty(t, files)
+
+	m, err := c.Publish("mytopic", "valid")
+	require.Nil(t, err)
+	require.Equal(t, "valid", m.Message)
+}
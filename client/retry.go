@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"heckel.io/ntfy/v2/util"
+)
+
+const (
+	idempotencyKeyHeader = "X-Idempotency-Key"
+	idempotencyKeyLength = 32
+)
+
+// retryContextKey is the context key of the retryPolicy of a request, see WithRetry
+type retryContextKey struct{}
+
+// retryPolicy is the retry policy of a publish request, see WithRetry
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+	getBody  func() (io.ReadCloser, error) // Returns the body to send again, nil if the body cannot be sent again
+	body     io.Closer                     // The original body, closed after the last attempt (see prepareRetry)
+}
+
+// WithRetry retries publishing the message if the server cannot be reached (e.g. because of a network error),
+// or responds with a 5xx error (e.g. a proxy responding with HTTP 502). Messages rejected by the server (e.g.
+// HTTP 400 or 403) are not retried. Between attempts, the client waits for backoff, which is doubled after
+// every attempt.
+//
+// The request is sent with an idempotency key (X-Idempotency-Key, unless set via WithIdempotencyKey), so that
+// the server does not publish the message twice if an attempt failed after the message was published, e.g.
+// because the connection was lost before the response arrived.
+//
+// Parameters:
+//   - attempts: The max number of attempts, including the first one, e.g. 3.
+//   - backoff: The time to wait before the first retry, e.g. 1s.
+func WithRetry(attempts int, backoff time.Duration) PublishOption {
+	return func(r *http.Request) error {
+		if attempts < 1 {
+			return errors.New("invalid retry policy, attempts must be at least 1")
+		} else if backoff < 0 {
+			return errors.New("invalid retry policy, backoff must not be negative")
+		}
+		if r.Header.Get(idempotencyKeyHeader) == "" {
+			r.Header.Set(idempotencyKeyHeader, util.RandomString(idempotencyKeyLength))
+		}
+		*r = *r.WithContext(context.WithValue(r.Context(), retryContextKey{}, &retryPolicy{
+			attempts: attempts,
+			backoff:  backoff,
+		}))
+		return nil
+	}
+}
+
+// WithIdempotencyKey sets the idempotency key of the message. If a message with the same key was already
+// published to the topic (by the same user or IP address) within the last hour, the server returns the
+// original message instead of publishing it again. Keys may contain up to 64 letters, digits, dashes and
+// underscores, e.g. a UUID. See WithRetry to retry with a random key.
+func WithIdempotencyKey(key string) PublishOption {
+	return WithHeader(idempotencyKeyHeader, key)
+}
+
+// prepareRetry makes sure that the body of a request with a retry policy can be sent again. Bodies created
+// from a *strings.Reader, *bytes.Reader or *bytes.Buffer can always be sent again (see http.NewRequest). For
+// other bodies that implement io.Seeker (e.g. files), the body is rewound before it is sent again, and it is
+// not closed until the last attempt is finished.
+func prepareRetry(req *http.Request, body io.Reader) {
+	policy, ok := req.Context().Value(retryContextKey{}).(*retryPolicy)
+	if !ok {
+		return
+	} else if req.GetBody != nil {
+		policy.getBody = req.GetBody
+		return
+	} else if req.Body == nil || req.Body == http.NoBody {
+		policy.getBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		return
+	}
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return // Cannot send the body again, the request is not retried
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return // E.g. a pipe
+	}
+	policy.getBody = func() (io.ReadCloser, error) {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(seeker), nil
+	}
+	policy.body = req.Body
+	req.Body = io.NopCloser(req.Body) // The HTTP client closes the body after sending it
+}
+
+func (c *Client) sendPublishRequestWithRetry(req *http.Request, topicURL string, responseLimit int, policy *retryPolicy) (*Message, error) {
+	if policy.body != nil {
+		defer policy.body.Close()
+	}
+	backoff := policy.backoff
+	for attempt := 1; ; attempt++ {
+		m, err := c.sendPublishRequestOnce(req, topicURL, responseLimit)
+		if err == nil || !retryable(err) || attempt >= policy.attempts {
+			return m, err
+		} else if policy.getBody == nil {
+			c.config.Logger.Debug("%s Publishing failed, cannot retry because the body cannot be sent again: %s", util.ShortTopicURL(topicURL), err.Error())
+			return m, err
+		}
+		c.config.Logger.Debug("%s Publishing failed (attempt %d of %d), retrying in %s: %s", util.ShortTopicURL(topicURL), attempt, policy.attempts, backoff, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+		body, err := policy.getBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+}
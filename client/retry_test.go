@@ -0,0 +1,120 @@
+package client_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+// newFlakyServer returns a server that fails the first failures requests with HTTP 503, and records the
+// idempotency key and body of all requests
+func newFlakyServer(t *testing.T, failures int) (*httptest.Server, func() (keys []string, bodies []string)) {
+	var mu sync.Mutex
+	var keys, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		keys = append(keys, r.Header.Get("X-Idempotency-Key"))
+		bodies = append(bodies, string(body))
+		attempt := len(keys)
+		mu.Unlock()
+		if attempt <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"abcdefghijkl","time":1700000000,"event":"message","topic":"mytopic","message":"%s"}`, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() ([]string, []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return keys, bodies
+	}
+}
+
+func TestClient_Publish_WithRetry(t *testing.T) {
+	server, requests := newFlakyServer(t, 2)
+	c := client.New(client.NewConfig())
+
+	m, err := c.Publish(server.URL+"/mytopic", "some message", client.WithRetry(3, 10*time.Millisecond))
+	require.Nil(t, err)
+	require.Equal(t, "some message", m.Message)
+
+	keys, bodies := requests()
+	require.Equal(t, 3, len(keys))
+	require.NotEmpty(t, keys[0])
+	require.Equal(t, []string{keys[0], keys[0], keys[0]}, keys)
+	require.Equal(t, []string{"some message", "some message", "some message"}, bodies)
+}
+
+func TestClient_Publish_WithRetry_GiveUp(t *testing.T) {
+	server, requests := newFlakyServer(t, 5)
+	c := client.New(client.NewConfig())
+
+	_, err := c.Publish(server.URL+"/mytopic", "some message", client.WithRetry(2, time.Millisecond))
+	require.Error(t, err)
+	keys, _ := requests()
+	require.Equal(t, 2, len(keys))
+
+	_, err = c.Publish(server.URL+"/mytopic", "some message", client.WithRetry(0, time.Millisecond))
+	require.Error(t, err)
+	keys, _ = requests()
+	require.Equal(t, 2, len(keys))
+}
+
+func TestClient_Publish_WithRetry_NotRetryable(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	c := client.New(client.NewConfig())
+
+	_, err := c.Publish(server.URL+"/mytopic", "some message", client.WithRetry(3, time.Millisecond))
+	require.Error(t, err)
+	require.Equal(t, int32(1), attempts.Load())
+}
+
+func TestClient_PublishReader_WithRetry_File(t *testing.T) {
+	server, requests := newFlakyServer(t, 1)
+	c := client.New(client.NewConfig())
+
+	filename := filepath.Join(t.TempDir(), "message.txt")
+	require.Nil(t, os.WriteFile(filename, []byte("message from a file"), 0600))
+	f, err := os.Open(filename)
+	require.Nil(t, err)
+	defer f.Close()
+
+	_, err = c.PublishReader(server.URL+"/mytopic", f, client.WithRetry(2, time.Millisecond), client.WithIdempotencyKey("my-key"))
+	require.Nil(t, err)
+	keys, bodies := requests()
+	require.Equal(t, []string{"my-key", "my-key"}, keys)
+	require.Equal(t, []string{"message from a file", "message from a file"}, bodies)
+}
+
+func TestClient_Publish_WithIdempotencyKey_RealServer(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	m1, err := c.Publish("mytopic", "some message", client.WithIdempotencyKey("abc"))
+	require.Nil(t, err)
+	m2, err := c.Publish("mytopic", "some message", client.WithIdempotencyKey("abc"))
+	require.Nil(t, err)
+	require.Equal(t, m1.ID, m2.ID)
+	m3, err := c.Publish("mytopic", "some message", client.WithIdempotencyKey("def"))
+	require.Nil(t, err)
+	require.NotEqual(t, m1.ID, m3.ID)
+}
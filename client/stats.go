@@ -0,0 +1,232 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains the counters of a client since it was created, see Client.Stats
+type Stats struct {
+	// MessagesPublished is the number of messages that were published successfully, including queued messages (see
+	// Config.QueueDir) once they are published.
+	MessagesPublished int64
+	// MessagesReceived is the number of messages received by subscriptions and polls (after the middlewares, see
+	// Config.Middlewares).
+	MessagesReceived int64
+	// Reconnects is the number of times a subscription had to reconnect, e.g. because the connection failed.
+	Reconnects int64
+	// BytesSent is the number of HTTP request body bytes sent.
+	BytesSent int64
+	// BytesReceived is the number of HTTP response body (and WebSocket message) bytes received.
+	BytesReceived int64
+	// Subscriptions contains the counters of the active subscriptions, by subscription ID.
+	Subscriptions map[string]*SubscriptionStats
+}
+
+// SubscriptionStats contains the counters of a single subscription, see Stats
+type SubscriptionStats struct {
+	// ID is the subscription ID, as returned by Client.Subscribe.
+	ID string
+	// TopicURL is the URL of the subscribed topic(s).
+	TopicURL string
+	// MessagesReceived is the number of messages received by the subscription.
+	MessagesReceived int64
+	// Reconnects is the number of times the subscription had to reconnect.
+	Reconnects int64
+	// LastError is the last connection error of the subscription, or nil if there was none.
+	LastError error
+	// LastErrorTime is the time of LastError.
+	LastErrorTime time.Time
+}
+
+// StatsHook is notified of the events that are counted in Stats as they happen, e.g. to export them as Prometheus
+// metrics (see Config.StatsHook). The methods are called synchronously from the client's goroutines, possibly
+// concurrently, so they must be fast and safe for concurrent use.
+//
+// Example:
+//
+//	type prometheusHook struct{ received *prometheus.CounterVec }
+//
+//	func (h *prometheusHook) MessageReceived(topicURL string) {
+//	  h.received.WithLabelValues(topicURL).Inc()
+//	}
+//	// ... and the other methods
+type StatsHook interface {
+	// MessagePublished is called after a message was published successfully.
+	MessagePublished(topicURL string)
+	// MessageReceived is called for every message that is received by a subscription or poll. The topic URL is
+	// the URL of the message's topic, see Message.TopicURL.
+	MessageReceived(topicURL string)
+	// Reconnected is called before a subscription reconnects, with the error that ended the previous connection
+	// (or nil if the server closed it).
+	Reconnected(topicURL string, err error)
+	// BytesTransferred is called whenever body bytes are sent or received.
+	BytesTransferred(sent, received int64)
+}
+
+// Stats returns a snapshot of the client's counters, see Stats and Config.StatsHook
+//
+// Returns:
+//   - The counters of the client and its active subscriptions.
+func (c *Client) Stats() *Stats {
+	return c.stats.snapshot()
+}
+
+// clientStats counts the events of a client, and forwards them to the hook, if any
+type clientStats struct {
+	messagesPublished atomic.Int64
+	messagesReceived  atomic.Int64
+	reconnects        atomic.Int64
+	bytesSent         atomic.Int64
+	bytesReceived     atomic.Int64
+	hook              StatsHook                     // May be nil
+	subscriptions     map[string]*subscriptionStats // Subscription ID -> stats, protected by mu
+	mu                sync.Mutex
+}
+
+// subscriptionStats counts the events of a single subscription (or poll request), and of its client
+type subscriptionStats struct {
+	client           *clientStats
+	id               string
+	topicURL         string
+	messagesReceived atomic.Int64
+	reconnects       atomic.Int64
+	lastError        error     // Protected by mu
+	lastErrorTime    time.Time // Protected by mu
+	mu               sync.Mutex
+}
+
+func newClientStats(hook StatsHook) *clientStats {
+	return &clientStats{
+		hook:          hook,
+		subscriptions: make(map[string]*subscriptionStats),
+	}
+}
+
+// addSubscription registers the stats of a new subscription, which are included in the snapshot until removed
+func (s *clientStats) addSubscription(id, topicURL string) *subscriptionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := &subscriptionStats{client: s, id: id, topicURL: topicURL}
+	s.subscriptions[id] = sub
+	return sub
+}
+
+func (s *clientStats) removeSubscription(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscriptions, id)
+}
+
+// poll returns stats for a poll request, which count towards the client stats, but are not included in the snapshot
+func (s *clientStats) poll(topicURL string) *subscriptionStats {
+	return &subscriptionStats{client: s, topicURL: topicURL}
+}
+
+func (s *clientStats) messagePublished(topicURL string) {
+	s.messagesPublished.Add(1)
+	if s.hook != nil {
+		s.hook.MessagePublished(topicURL)
+	}
+}
+
+func (s *clientStats) bytesTransferred(sent, received int64) {
+	s.bytesSent.Add(sent)
+	s.bytesReceived.Add(received)
+	if s.hook != nil {
+		s.hook.BytesTransferred(sent, received)
+	}
+}
+
+func (s *clientStats) snapshot() *Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := &Stats{
+		MessagesPublished: s.messagesPublished.Load(),
+		MessagesReceived:  s.messagesReceived.Load(),
+		Reconnects:        s.reconnects.Load(),
+		BytesSent:         s.bytesSent.Load(),
+		BytesReceived:     s.bytesReceived.Load(),
+		Subscriptions:     make(map[string]*SubscriptionStats),
+	}
+	for id, sub := range s.subscriptions {
+		sub.mu.Lock()
+		stats.Subscriptions[id] = &SubscriptionStats{
+			ID:               sub.id,
+			TopicURL:         sub.topicURL,
+			MessagesReceived: sub.messagesReceived.Load(),
+			Reconnects:       sub.reconnects.Load(),
+			LastError:        sub.lastError,
+			LastErrorTime:    sub.lastErrorTime,
+		}
+		sub.mu.Unlock()
+	}
+	return stats
+}
+
+func (s *subscriptionStats) messageReceived(topicURL string) {
+	s.messagesReceived.Add(1)
+	s.client.messagesReceived.Add(1)
+	if s.client.hook != nil {
+		s.client.hook.MessageReceived(topicURL)
+	}
+}
+
+// reconnected counts a reconnect of the subscription, and records the error that ended the previous connection
+func (s *subscriptionStats) reconnected(err error) {
+	s.reconnects.Add(1)
+	s.client.reconnects.Add(1)
+	if err != nil {
+		s.mu.Lock()
+		s.lastError, s.lastErrorTime = err, time.Now()
+		s.mu.Unlock()
+	}
+	if s.client.hook != nil {
+		s.client.hook.Reconnected(s.topicURL, err)
+	}
+}
+
+// statsTransport is an http.RoundTripper that counts the body bytes of all requests and responses, see Stats
+type statsTransport struct {
+	next  http.RoundTripper
+	stats *clientStats
+}
+
+var _ http.RoundTripper = (*statsTransport)(nil)
+
+func newStatsTransport(next http.RoundTripper, stats *clientStats) *statsTransport {
+	return &statsTransport{
+		next:  next,
+		stats: stats,
+	}
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.WithContext(req.Context()) // Shallow copy, a RoundTripper must not modify the request
+		req.Body = &countingReadCloser{ReadCloser: req.Body, count: func(n int64) { t.stats.bytesTransferred(n, 0) }}
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingReadCloser{ReadCloser: resp.Body, count: func(n int64) { t.stats.bytesTransferred(0, n) }}
+	return resp, nil
+}
+
+// countingReadCloser calls count with the number of bytes of every read
+type countingReadCloser struct {
+	io.ReadCloser
+	count func(n int64)
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.count(int64(n))
+	}
+	return n, err
+}
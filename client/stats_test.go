@@ -0,0 +1,111 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+)
+
+type testStatsHook struct {
+	published, received, reconnects int
+	sent, bytesReceived             int64
+	mu                              sync.Mutex
+}
+
+func (h *testStatsHook) MessagePublished(topicURL string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.published++
+}
+
+func (h *testStatsHook) MessageReceived(topicURL string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.received++
+}
+
+func (h *testStatsHook) Reconnected(topicURL string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reconnects++
+}
+
+func (h *testStatsHook) BytesTransferred(sent, received int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sent += sent
+	h.bytesReceived += received
+}
+
+func TestClient_Stats(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	hook := &testStatsHook{}
+	conf := newTestConfig(port)
+	conf.StatsHook = hook
+	c := client.New(conf)
+
+	subscriptionID, err := c.Subscribe("mytopic")
+	require.Nil(t, err)
+	time.Sleep(500 * time.Millisecond)
+	_, err = c.Publish("mytopic", "some message")
+	require.Nil(t, err)
+	_, err = c.Publish("mytopic", "another message")
+	require.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+	messages, err := c.Poll("mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+
+	stats := c.Stats()
+	require.Equal(t, int64(2), stats.MessagesPublished)
+	require.Equal(t, int64(4), stats.MessagesReceived) // 2 via subscription, 2 via poll
+	require.Equal(t, int64(0), stats.Reconnects)
+	require.Greater(t, stats.BytesSent, int64(0))
+	require.Greater(t, stats.BytesReceived, int64(0))
+	require.Equal(t, 1, len(stats.Subscriptions))
+	require.Equal(t, subscriptionID, stats.Subscriptions[subscriptionID].ID)
+	require.Equal(t, int64(2), stats.Subscriptions[subscriptionID].MessagesReceived)
+	require.Nil(t, stats.Subscriptions[subscriptionID].LastError)
+
+	hook.mu.Lock()
+	require.Equal(t, 2, hook.published)
+	require.Equal(t, 4, hook.received)
+	require.Equal(t, stats.BytesSent, hook.sent)
+	hook.mu.Unlock()
+
+	c.Unsubscribe(subscriptionID)
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, 0, len(c.Stats().Subscriptions))
+}
+
+func TestClient_Stats_Reconnect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // Never send anything, so the keepalive timeout triggers
+	}))
+	defer server.Close()
+	hook := &testStatsHook{}
+	c := client.New(&client.Config{DefaultHost: server.URL, KeepaliveTimeout: 200 * time.Millisecond, StatsHook: hook})
+	defer c.Close()
+
+	subscriptionID, err := c.Subscribe("mytopic")
+	require.Nil(t, err)
+	require.Eventually(t, func() bool {
+		return c.Stats().Reconnects >= 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	stats := c.Stats().Subscriptions[subscriptionID]
+	require.GreaterOrEqual(t, stats.Reconnects, int64(2))
+	require.ErrorContains(t, stats.LastError, "keepalive")
+	require.False(t, stats.LastErrorTime.IsZero())
+	hook.mu.Lock()
+	require.GreaterOrEqual(t, hook.reconnects, 2)
+	hook.mu.Unlock()
+}
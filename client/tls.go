@@ -0,0 +1,91 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSConfig returns the TLS configuration for the CACert, ClientCert, ClientKey and Insecure fields, or nil if none
+// of them are set. The CA certificates are trusted in addition to the system's CAs.
+//
+// Returns:
+//   - The TLS configuration, or an error if the certificate or key files cannot be read or parsed.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if c.CACert == "" && c.ClientCert == "" && c.ClientKey == "" && !c.Insecure {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+	}
+	if c.CACert != "" {
+		b, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificate file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no PEM certificates found in CA certificate file %s", c.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.ClientCert != "" {
+		keyFile := c.ClientKey
+		if keyFile == "" {
+			keyFile = c.ClientCert // Certificate and key in one file
+		}
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else if c.ClientKey != "" {
+		return nil, errors.New("client key is set, but client certificate is not")
+	}
+	return tlsConfig, nil
+}
+
+// baseTransport returns the given transport, or the transport it wraps if it is a stats transport (see Stats), a
+// tracing transport (see Config.TraceWriter) or a Unix socket transport (see unixTransport)
+func baseTransport(transport http.RoundTripper) http.RoundTripper {
+	if t, ok := transport.(*statsTransport); ok {
+		transport = t.next
+	}
+	if t, ok := transport.(*tracingTransport); ok {
+		transport = t.next
+	}
+	if t, ok := transport.(*unixTransport); ok {
+		transport = t.next
+	}
+	return transport
+}
+
+// transportTLSConfig returns the TLS configuration of the given transport, if it is an *http.Transport, or nil
+func transportTLSConfig(transport http.RoundTripper) *tls.Config {
+	if t, ok := baseTransport(transport).(*http.Transport); ok {
+		return t.TLSClientConfig
+	}
+	return nil
+}
+
+// errorTransport is an http.RoundTripper that fails all requests with the same error. It is used if the transport
+// of a client cannot be created (e.g. because the TLS certificates cannot be loaded, see Config.TLSConfig), since
+// New cannot return an error.
+type errorTransport struct {
+	err error
+}
+
+var _ http.RoundTripper = (*errorTransport)(nil)
+
+func (t *errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, t.err
+}
@@ -0,0 +1,140 @@
+package client_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+)
+
+func TestClient_Publish_TLS_CACert(t *testing.T) {
+	certFile, keyFile, cert := newTestCertificate(t)
+	server := newTestTLSServer(t, cert, nil)
+
+	// Unknown CA
+	c := client.New(&client.Config{DefaultHost: server.URL})
+	_, err := c.Publish("mytopic", "hi")
+	require.Error(t, err)
+
+	// Trusted CA
+	c = client.New(&client.Config{DefaultHost: server.URL, CACert: certFile})
+	msg, err := c.Publish("mytopic", "hi")
+	require.Nil(t, err)
+	require.Equal(t, "hi", msg.Message)
+
+	// Insecure
+	c = client.New(&client.Config{DefaultHost: server.URL, Insecure: true})
+	_, err = c.Publish("mytopic", "hi")
+	require.Nil(t, err)
+
+	// Not a certificate
+	c = client.New(&client.Config{DefaultHost: server.URL, CACert: keyFile})
+	_, err = c.Publish("mytopic", "hi")
+	require.ErrorContains(t, err, "no PEM certificates found")
+}
+
+func TestClient_Publish_TLS_ClientCert(t *testing.T) {
+	certFile, keyFile, cert := newTestCertificate(t)
+	server := newTestTLSServer(t, cert, cert.Leaf)
+
+	// No client certificate
+	c := client.New(&client.Config{DefaultHost: server.URL, CACert: certFile})
+	_, err := c.Publish("mytopic", "hi")
+	require.Error(t, err)
+
+	// Certificate and key in separate files
+	c = client.New(&client.Config{DefaultHost: server.URL, CACert: certFile, ClientCert: certFile, ClientKey: keyFile})
+	_, err = c.Publish("mytopic", "hi")
+	require.Nil(t, err)
+
+	// Certificate and key in one file
+	certAndKey, err := os.ReadFile(certFile)
+	require.Nil(t, err)
+	key, err := os.ReadFile(keyFile)
+	require.Nil(t, err)
+	combinedFile := filepath.Join(t.TempDir(), "combined.pem")
+	require.Nil(t, os.WriteFile(combinedFile, append(certAndKey, key...), 0600))
+	c = client.New(&client.Config{DefaultHost: server.URL, CACert: certFile, ClientCert: combinedFile})
+	_, err = c.Publish("mytopic", "hi")
+	require.Nil(t, err)
+}
+
+func TestConfig_TLSConfig(t *testing.T) {
+	certFile, keyFile, _ := newTestCertificate(t)
+
+	tlsConfig, err := (&client.Config{}).TLSConfig()
+	require.Nil(t, err)
+	require.Nil(t, tlsConfig)
+
+	tlsConfig, err = (&client.Config{CACert: certFile, ClientCert: certFile, ClientKey: keyFile, Insecure: true}).TLSConfig()
+	require.Nil(t, err)
+	require.NotNil(t, tlsConfig.RootCAs)
+	require.Equal(t, 1, len(tlsConfig.Certificates))
+	require.True(t, tlsConfig.InsecureSkipVerify)
+
+	_, err = (&client.Config{ClientKey: keyFile}).TLSConfig()
+	require.Error(t, err)
+	_, err = (&client.Config{ClientCert: certFile}).TLSConfig() // Key missing
+	require.Error(t, err)
+	_, err = (&client.Config{CACert: filepath.Join(t.TempDir(), "does-not-exist.pem")}).TLSConfig()
+	require.Error(t, err)
+}
+
+func newTestTLSServer(t *testing.T, cert *tls.Certificate, clientCA *x509.Certificate) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"abc","event":"message","topic":"mytopic","message":"hi"}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{*cert}}
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA)
+		server.TLS.ClientCAs = pool
+		server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestCertificate creates a self-signed certificate for 127.0.0.1 that can be used as server and client
+// certificate, and writes the certificate and key to PEM files
+func newTestCertificate(t *testing.T) (certFile, keyFile string, cert *tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ntfy test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.Nil(t, err)
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+	tlsCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.Nil(t, err)
+	return certFile, keyFile, &tlsCert
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	traceRedacted = "<redacted>"
+)
+
+// traceRedactedHeaders are the headers whose values are replaced in the trace output, since they carry credentials
+var traceRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// tracingTransport is an http.RoundTripper that dumps all requests and responses to a writer, similar to "curl -v".
+// Request lines are prefixed with "> ", response lines with "< ", and bodies are written as they are sent or
+// received, so that streaming subscriptions can be traced as well. Credentials are redacted.
+type tracingTransport struct {
+	next http.RoundTripper
+	w    io.Writer
+	mu   sync.Mutex // Protects w, since requests (e.g. multiple subscriptions) may run concurrently
+}
+
+var _ http.RoundTripper = (*tracingTransport)(nil)
+
+func newTracingTransport(next http.RoundTripper, w io.Writer) *tracingTransport {
+	return &tracingTransport{
+		next: next,
+		w:    w,
+	}
+}
+
+// RoundTrip dumps the request, sends it via the underlying transport, and dumps the response
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	redacted := redactRequest(req)
+	dump, err := httputil.DumpRequestOut(redacted, false)
+	if err != nil {
+		return nil, err
+	}
+	t.write(prefixLines(dump, "> "))
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.WithContext(req.Context()) // Shallow copy, a RoundTripper must not modify the request
+		req.Body = &tracingReadCloser{ReadCloser: req.Body, t: t}
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.write([]byte(fmt.Sprintf("\n* Request failed: %s\n", err.Error())))
+		return nil, err
+	}
+	dump, err = httputil.DumpResponse(redactResponse(resp), false)
+	if err != nil {
+		return nil, err
+	}
+	t.write(append([]byte("\n"), prefixLines(dump, "< ")...))
+	resp.Body = &tracingReadCloser{ReadCloser: resp.Body, t: t}
+	return resp, nil
+}
+
+func (t *tracingTransport) write(b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.w.Write(b) // Errors are ignored, tracing must not break requests
+}
+
+// tracingReadCloser writes everything that is read from the body to the trace output
+type tracingReadCloser struct {
+	io.ReadCloser
+	t *tracingTransport
+}
+
+func (r *tracingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.t.write(p[:n])
+	}
+	return n, err
+}
+
+// redactRequest returns a copy of the request with all credentials in headers and the "auth" query parameter
+// replaced. The body is shared with the original request, so it must not be read.
+func redactRequest(req *http.Request) *http.Request {
+	redacted := req.Clone(req.Context())
+	redactHeaders(redacted.Header)
+	if redacted.URL.User != nil {
+		redacted.URL.User = url.User(redacted.URL.User.Username())
+	}
+	if query := redacted.URL.Query(); query.Has("auth") {
+		query.Set("auth", traceRedacted)
+		redacted.URL.RawQuery = query.Encode()
+	}
+	return redacted
+}
+
+// redactResponse returns a shallow copy of the response without body, with all credentials in headers replaced
+func redactResponse(resp *http.Response) *http.Response {
+	redacted := *resp
+	redacted.Body = nil
+	redacted.Header = resp.Header.Clone()
+	redactHeaders(redacted.Header)
+	return &redacted
+}
+
+// redactHeaders replaces the values of all credential headers. For the Authorization header, the scheme
+// (e.g. "Basic" or "Bearer") is kept, since it is useful for debugging.
+func redactHeaders(header http.Header) {
+	for _, name := range traceRedactedHeaders {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		redacted := make([]string, len(values))
+		for i, value := range values {
+			if scheme, _, found := strings.Cut(value, " "); found && strings.HasSuffix(name, "Authorization") {
+				redacted[i] = scheme + " " + traceRedacted
+			} else {
+				redacted[i] = traceRedacted
+			}
+		}
+		header[name] = redacted
+	}
+}
+
+// prefixLines prefixes each line of the dump with the given prefix, and normalizes line endings
+func prefixLines(dump []byte, prefix string) []byte {
+	lines := strings.Split(strings.TrimRight(string(dump), "\r\n"), "\r\n")
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(prefix)
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,37 @@
+package client_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/test"
+	"testing"
+)
+
+func TestClient_TraceWriter(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	var trace bytes.Buffer
+	conf := newTestConfig(port)
+	conf.TraceWriter = &trace
+	c := client.New(conf)
+
+	topicURL := fmt.Sprintf("http://127.0.0.1:%d/mytopic", port)
+	_, err := c.Publish(topicURL, "some message", client.WithBasicAuth("phil", "mypass"), client.WithTitle("some title"))
+	require.Nil(t, err)
+	messages, err := c.Poll(topicURL, client.WithBearerAuth("tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+
+	out := trace.String()
+	require.Contains(t, out, "> POST /mytopic HTTP/1.1\n")
+	require.Contains(t, out, "> X-Title: some title\n")
+	require.Contains(t, out, "> Authorization: Basic <redacted>\n")
+	require.Contains(t, out, "> Authorization: Bearer <redacted>\n")
+	require.Contains(t, out, "> GET /mytopic/json?")
+	require.Contains(t, out, "< HTTP/1.1 200 OK\n")
+	require.Contains(t, out, "some message") // Request and response bodies
+	require.NotContains(t, out, "mypass")
+	require.NotContains(t, out, "tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2")
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Servers that listen on a Unix domain socket (listen-unix) can be reached via unix:// URLs, e.g. with the default
+// host unix:///run/ntfy.sock, the topic mytopic is expanded to unix:///run/ntfy.sock/mytopic. The socket path is the
+// shortest prefix of the URL path that is a Unix socket, and the rest of the path is the HTTP path. The Host header
+// is set to the host of the URL (e.g. unix://ntfy.example.com/run/ntfy.sock), or to "localhost" if it has none.
+
+const (
+	unixScheme     = "unix"
+	unixSocketHost = "localhost" // Synthetic Host header, see unixSocketURL
+)
+
+// unixTransports caches the transports of Unix sockets, so that connections are reused across requests
+var (
+	unixTransports   = make(map[string]*http.Transport)
+	unixTransportsMu sync.Mutex
+)
+
+// unixTransport is an http.RoundTripper that sends requests to unix:// URLs via the Unix socket, and all other
+// requests via the next transport
+type unixTransport struct {
+	next http.RoundTripper
+}
+
+var _ http.RoundTripper = (*unixTransport)(nil)
+
+func newUnixTransport(next http.RoundTripper) *unixTransport {
+	return &unixTransport{next: next}
+}
+
+func (t *unixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != unixScheme {
+		return t.next.RoundTrip(req)
+	}
+	socketPath, u, err := unixSocketURL(req.URL, "http")
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.URL, r.Host = u, u.Host
+	return unixSocketTransport(socketPath).RoundTrip(r)
+}
+
+// unixSocketURL splits a unix:// URL into the path of the Unix socket and the URL of the request that is sent over
+// it, using the given scheme (http or ws), e.g. unix:///run/ntfy.sock/mytopic/json -> /run/ntfy.sock and
+// http://localhost/mytopic/json
+func unixSocketURL(u *url.URL, scheme string) (string, *url.URL, error) {
+	for i := 1; i <= len(u.Path); i++ {
+		if i < len(u.Path) && u.Path[i] != '/' {
+			continue
+		}
+		if stat, err := os.Stat(u.Path[:i]); err == nil && stat.Mode()&os.ModeSocket != 0 {
+			host := u.Host
+			if host == "" {
+				host = unixSocketHost
+			}
+			path := u.Path[i:]
+			if path == "" {
+				path = "/"
+			}
+			return u.Path[:i], &url.URL{Scheme: scheme, Host: host, Path: path, RawQuery: u.RawQuery}, nil
+		}
+	}
+	return "", nil, fmt.Errorf("invalid URL %s: no Unix socket found in path", u.String())
+}
+
+// unixSocketTransport returns the (cached) transport that dials the given Unix socket
+func unixSocketTransport(socketPath string) *http.Transport {
+	unixTransportsMu.Lock()
+	defer unixTransportsMu.Unlock()
+	if t, ok := unixTransports[socketPath]; ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = unixSocketDialContext(socketPath)
+	unixTransports[socketPath] = t
+	return t
+}
+
+// unixSocketDialContext returns a dial function that connects to the given Unix socket, regardless of the address
+func unixSocketDialContext(socketPath string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socketPath)
+	}
+}
+
+// isUnixURL returns true if the given URL is a unix:// URL
+func isUnixURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, unixScheme+"://")
+}
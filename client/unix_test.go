@@ -0,0 +1,51 @@
+package client_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestClient_UnixSocket(t *testing.T) {
+	conf := server.NewConfig()
+	conf.ListenUnix = filepath.Join(t.TempDir(), "ntfy.sock")
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	c := client.New(&client.Config{DefaultHost: "unix://" + conf.ListenUnix})
+
+	for _, transport := range []string{client.TransportJSON, client.TransportWS} {
+		subscriptionID, err := c.Subscribe("mytopic", client.WithTransport(transport))
+		require.Nil(t, err)
+		time.Sleep(500 * time.Millisecond)
+
+		msg, err := c.Publish("mytopic", "hi via "+transport)
+		require.Nil(t, err)
+		require.Equal(t, "unix://"+conf.ListenUnix+"/mytopic", msg.TopicURL)
+		time.Sleep(200 * time.Millisecond)
+
+		m := nextMessage(c)
+		require.NotNil(t, m, transport)
+		require.Equal(t, "hi via "+transport, m.Message)
+		c.Unsubscribe(subscriptionID)
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// Full topic URL
+	messages, err := c.Poll("unix://" + conf.ListenUnix + "/mytopic")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+}
+
+func TestClient_UnixSocket_NoSocket(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "not-a-socket")
+	require.Nil(t, os.WriteFile(file, []byte("hi"), 0600))
+	c := client.New(&client.Config{DefaultHost: "unix://" + file})
+	_, err := c.Publish("mytopic", "hi")
+	require.ErrorContains(t, err, "no Unix socket found in path")
+}
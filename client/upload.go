@@ -0,0 +1,201 @@
+package client
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"heckel.io/ntfy/v2/util"
+)
+
+const (
+	uploadsPath      = "/v1/uploads"
+	tusVersion       = "1.0.0"
+	tusContentType   = "application/offset+octet-stream"
+	uploadMaxRetries = 5
+	uploadRetryDelay = time.Second // Multiplied by the attempt number
+)
+
+// PublishFile uploads a file as attachment and publishes it to a topic, optionally using options.
+//
+// If the server supports resumable uploads (see CapabilityUploads), the file is uploaded via the tus protocol
+// first, and then published with the X-Upload header. If the connection breaks during the upload, the client
+// asks the server how much of the file it received, and resumes from there instead of starting from zero. It
+// gives up after a few failed attempts. If WithProgress is passed, the progress starts over with the remaining
+// bytes after a resume.
+//
+// If the server does not support resumable uploads, or the file is not a regular file (e.g. a pipe), the file
+// is uploaded as the request body, see PublishReader.
+//
+// For regular files, the attachment filename is set to the name of the file, unless WithFilename is passed.
+//
+// Parameters:
+//   - topic: The topic to publish to.
+//   - file: The file to upload.
+//   - options: Optional configuration for the publish request (e.g., WithFilename, WithTitle).
+//
+// Returns:
+//   - The published Message object, or an error if the upload or the request failed.
+func (c *Client) PublishFile(topic string, file *os.File, options ...PublishOption) (*Message, error) {
+	topicURL, err := c.expandTopicURL(topic)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		return c.PublishReader(topic, file, options...)
+	}
+	options = append([]PublishOption{WithFilename(filepath.Base(file.Name()))}, options...) // Explicit WithFilename wins
+	capabilities, err := c.capabilitiesForTopicURL(topicURL)
+	if err != nil || !capabilities.Advertised() || !capabilities.Has(CapabilityUploads) {
+		return c.PublishReader(topic, file, options...)
+	}
+	baseURL := topicURL[:strings.LastIndex(topicURL, "/")]
+	uploadURL, err := c.upload(baseURL, file, stat.Size(), c.withConfigAuth(topicURL, options))
+	if err != nil {
+		return nil, err
+	}
+	uploadID := uploadURL[strings.LastIndex(uploadURL, "/")+1:]
+	return c.PublishReader(topic, nil, append(options[:len(options):len(options)], WithHeader("X-Upload", uploadID))...)
+}
+
+// PublishFilePath opens the file at the given path, and uploads it as attachment to a topic, see PublishFile.
+// Pass WithProgress to be notified about the upload progress, e.g. to display a progress bar for large files.
+//
+// Parameters:
+//   - topic: The topic to publish to.
+//   - path: The path of the file to upload.
+//   - options: Optional configuration for the publish request (e.g., WithProgress, WithTitle).
+//
+// Returns:
+//   - The published Message object, or an error if the file cannot be opened, or the upload or the request failed.
+func (c *Client) PublishFilePath(topic, path string, options ...PublishOption) (*Message, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return c.PublishFile(topic, file, options...)
+}
+
+// upload creates a tus upload for the file, and sends the file until the server has received all of it,
+// resuming after failed requests. It returns the URL of the upload.
+func (c *Client) upload(baseURL string, file *os.File, size int64, options []PublishOption) (string, error) {
+	uploadURL, err := c.createUpload(baseURL, size, options)
+	if err != nil {
+		return "", err
+	}
+	c.config.Logger.Debug("%s Uploading %d bytes to %s", util.ShortTopicURL(baseURL), size, uploadURL)
+	var offset int64
+	var attempts int
+	for offset < size {
+		newOffset, retry, err := c.patchUpload(uploadURL, file, offset, size, options)
+		if err == nil {
+			offset = newOffset
+			continue
+		}
+		attempts++
+		if !retry || attempts > uploadMaxRetries {
+			return "", err
+		}
+		c.config.Logger.Warn("%s Upload interrupted at %d of %d bytes, resuming: %s", util.ShortTopicURL(baseURL), offset, size, err.Error())
+		time.Sleep(time.Duration(attempts) * uploadRetryDelay)
+		if newOffset, err := c.headUpload(uploadURL, options); err == nil {
+			offset = newOffset
+		}
+	}
+	return uploadURL, nil
+}
+
+func (c *Client) createUpload(baseURL string, size int64, options []PublishOption) (string, error) {
+	req, err := c.newUploadRequest(http.MethodPost, baseURL+uploadsPath, nil, options)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	if filename := req.Header.Get("X-Filename"); filename != "" {
+		req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(filename)))
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", responseError(resp)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || location.String() == "" {
+		return "", errors.New("invalid upload location returned by server")
+	}
+	return req.URL.ResolveReference(location).String(), nil
+}
+
+// patchUpload sends the file from the given offset, and returns the new offset. If the request fails, retry
+// indicates whether the upload can be resumed, e.g. after a network error.
+func (c *Client) patchUpload(uploadURL string, file *os.File, offset, size int64, options []PublishOption) (newOffset int64, retry bool, err error) {
+	req, err := c.newUploadRequest(http.MethodPatch, uploadURL, io.NewSectionReader(file, offset, size-offset), options)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.Header.Set("Content-Type", tusContentType)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		retry = resp.StatusCode == http.StatusConflict || resp.StatusCode >= 500
+		return 0, retry, responseError(resp)
+	}
+	newOffset, err = strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || newOffset <= offset {
+		return 0, true, errors.New("upload did not make progress")
+	}
+	return newOffset, false, nil
+}
+
+// headUpload asks the server for the current offset of the upload
+func (c *Client) headUpload(uploadURL string, options []PublishOption) (int64, error) {
+	req, err := c.newUploadRequest(http.MethodHead, uploadURL, nil, options)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected response from server: %s", resp.Status)
+	}
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// newUploadRequest creates a tus request. The publish options are applied to it as well, so that the
+// authentication headers are sent along.
+func (c *Client) newUploadRequest(method, uploadURL string, body io.Reader, options []PublishOption) (*http.Request, error) {
+	req, err := http.NewRequest(method, uploadURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if section, ok := body.(*io.SectionReader); ok {
+		req.ContentLength = section.Size() // Allows WithProgress to report the total
+	}
+	for _, option := range options {
+		if err := option(req); err != nil {
+			return nil, err
+		}
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	return req, nil
+}
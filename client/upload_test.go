@@ -0,0 +1,114 @@
+package client_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestClient_PublishFile_Resumable(t *testing.T) {
+	conf := server.NewConfig()
+	conf.CacheFile = filepath.Join(t.TempDir(), "cache.db")
+	conf.AttachmentCacheDir = t.TempDir()
+	s, err := server.New(server.WithConfig(conf))
+	require.Nil(t, err)
+
+	// The first PATCH request breaks after 3000 bytes, so the client has to resume the upload
+	var patches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch && patches.Add(1) == 1 {
+			r.Body = io.NopCloser(io.MultiReader(io.LimitReader(r.Body, 3000), iotest.ErrReader(errors.New("connection reset"))))
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	conf.BaseURL = ts.URL
+
+	content := util.RandomString(10000)
+	filename := filepath.Join(t.TempDir(), "backup.txt")
+	require.Nil(t, os.WriteFile(filename, []byte(content), 0600))
+	file, err := os.Open(filename)
+	require.Nil(t, err)
+	defer file.Close()
+
+	c := client.New(client.NewConfig())
+	m, err := c.PublishFile(ts.URL+"/mytopic", file, client.WithFilename("backup.txt"), client.WithTitle("Backup"))
+	require.Nil(t, err)
+	require.Equal(t, int32(2), patches.Load())
+	require.Equal(t, "Backup", m.Title)
+	require.Equal(t, "backup.txt", m.Attachment.Name)
+	require.Equal(t, int64(10000), m.Attachment.Size)
+
+	resp, err := http.Get(m.Attachment.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, content, string(b))
+}
+
+func TestClient_PublishFile_NotSupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/capabilities" {
+			w.Write([]byte(`{"capabilities":["attachments"]}`))
+			return
+		}
+		require.Equal(t, "/mytopic", r.URL.Path) // No tus requests
+		b, _ := io.ReadAll(r.Body)
+		require.Equal(t, "file content", string(b))
+		w.Write([]byte(`{"id":"abc","event":"message","topic":"mytopic","attachment":{"name":"file.txt","url":"https://example.com/file/abc.txt"}}`))
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	require.Nil(t, os.WriteFile(filename, []byte("file content"), 0600))
+	file, err := os.Open(filename)
+	require.Nil(t, err)
+	defer file.Close()
+
+	c := client.New(client.NewConfig())
+	m, err := c.PublishFile(server.URL+"/mytopic", file, client.WithFilename("file.txt"))
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(m.Attachment.URL, "/file/abc.txt"))
+}
+
+func TestClient_PublishFilePath_Progress(t *testing.T) {
+	conf := server.NewConfig()
+	conf.CacheFile = filepath.Join(t.TempDir(), "cache.db")
+	conf.AttachmentCacheDir = t.TempDir()
+	s, err := server.New(server.WithConfig(conf))
+	require.Nil(t, err)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	conf.BaseURL = ts.URL
+
+	filename := filepath.Join(t.TempDir(), "report.pdf")
+	require.Nil(t, os.WriteFile(filename, []byte(util.RandomString(50000)), 0600))
+
+	var lastSent, lastTotal atomic.Int64
+	c := client.New(client.NewConfig())
+	m, err := c.PublishFilePath(ts.URL+"/mytopic", filename, client.WithProgress(func(sent, total int64) {
+		lastSent.Store(sent)
+		lastTotal.Store(total)
+	}))
+	require.Nil(t, err)
+	require.Equal(t, "report.pdf", m.Attachment.Name) // Filename set automatically
+	require.Equal(t, int64(50000), m.Attachment.Size)
+	require.Equal(t, int64(50000), lastSent.Load())
+	require.Equal(t, int64(50000), lastTotal.Load())
+
+	_, err = c.PublishFilePath(ts.URL+"/mytopic", filepath.Join(t.TempDir(), "does-not-exist"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
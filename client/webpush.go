@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	webPushPath = "/v1/webpush"
+)
+
+// WebPushSubscription is a browser's Web Push subscription, registered with a ntfy server via
+// Client.RegisterWebPush. Once registered, the server delivers messages on the given topics to the
+// browser via Web Push, even if no page of the web application is open.
+type WebPushSubscription struct {
+	// Endpoint is the push service URL of the browser, e.g. https://fcm.googleapis.com/fcm/send/...
+	Endpoint string `json:"endpoint"`
+	// Auth is the authentication secret of the subscription (base64url-encoded).
+	Auth string `json:"auth"`
+	// P256dh is the public key of the subscription (base64url-encoded).
+	P256dh string `json:"p256dh"`
+	// Topics is the list of topics to deliver via Web Push, e.g. "mytopic".
+	Topics []string `json:"topics"`
+}
+
+// ParseWebPushSubscription parses the JSON representation of a browser's PushSubscription (as returned by
+// PushSubscription.toJSON() in JavaScript), and returns a WebPushSubscription for the given topics.
+//
+// Parameters:
+//   - subscription: The JSON of the browser's push subscription, e.g. {"endpoint":"...","keys":{"p256dh":"...","auth":"..."}}.
+//   - topics: The topics to deliver via Web Push.
+//
+// Returns:
+//   - The subscription, or an error if the JSON is invalid or incomplete.
+func ParseWebPushSubscription(subscription []byte, topics ...string) (*WebPushSubscription, error) {
+	var browserSubscription struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			Auth   string `json:"auth"`
+			P256dh string `json:"p256dh"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(subscription, &browserSubscription); err != nil {
+		return nil, err
+	} else if browserSubscription.Endpoint == "" || browserSubscription.Keys.Auth == "" || browserSubscription.Keys.P256dh == "" {
+		return nil, errors.New("invalid push subscription: endpoint, auth and p256dh key are required")
+	}
+	return &WebPushSubscription{
+		Endpoint: browserSubscription.Endpoint,
+		Auth:     browserSubscription.Keys.Auth,
+		P256dh:   browserSubscription.Keys.P256dh,
+		Topics:   topics,
+	}, nil
+}
+
+// WebPushPublicKey returns the VAPID public key of the server with the given base URL. Web applications pass
+// it to the browser's PushManager.subscribe() as applicationServerKey, so that the resulting subscription can
+// be registered via RegisterWebPush.
+//
+// Parameters:
+//   - baseURL: The base URL of the server, e.g. https://ntfy.sh.
+//
+// Returns:
+//   - The public key, or an error if the server could not be reached or does not support Web Push.
+func (c *Client) WebPushPublicKey(baseURL string) (string, error) {
+	capabilities, err := c.capabilitiesForBaseURL(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return "", err
+	} else if !capabilities.Has(CapabilityWebPush) || capabilities.WebPushPublicKey == "" {
+		return "", errors.New("server does not support web push")
+	}
+	return capabilities.WebPushPublicKey, nil
+}
+
+// RegisterWebPush registers the given Web Push subscription with the server with the given base URL, so that
+// messages on the subscription's topics are delivered to the browser via Web Push. Registering an endpoint that is
+// already registered replaces its topics, so registering it with no topics stops delivery.
+//
+// If the server uses access control, the user needs read access to all topics, so an auth option (e.g.
+// WithBearerAuth or WithBasicAuth) should be passed. Subscriptions that have not been updated for a while
+// are removed by the server, so web applications should re-register them periodically.
+//
+// Parameters:
+//   - baseURL: The base URL of the server, e.g. https://ntfy.sh.
+//   - subscription: The subscription to register, e.g. as returned by ParseWebPushSubscription.
+//   - options: Optional configuration for the request, typically the credentials.
+//
+// Returns:
+//   - An error if the request failed, e.g. because the push service endpoint is not allowed.
+func (c *Client) RegisterWebPush(baseURL string, subscription *WebPushSubscription, options ...RequestOption) error {
+	return c.webPushRequest(http.MethodPost, baseURL, subscription, options)
+}
+
+// UnregisterWebPush removes the Web Push subscription with the given endpoint from the server with the given
+// base URL, e.g. when the user disables browser notifications.
+//
+// Parameters:
+//   - baseURL: The base URL of the server, e.g. https://ntfy.sh.
+//   - endpoint: The push service URL of the subscription, see WebPushSubscription.Endpoint.
+//   - options: Optional configuration for the request, typically the credentials.
+//
+// Returns:
+//   - An error if the request failed.
+func (c *Client) UnregisterWebPush(baseURL, endpoint string, options ...RequestOption) error {
+	return c.webPushRequest(http.MethodDelete, baseURL, &WebPushSubscription{Endpoint: endpoint}, options)
+}
+
+func (c *Client) webPushRequest(method, baseURL string, subscription *WebPushSubscription, options []RequestOption) error {
+	body, err := json.Marshal(subscription)
+	if err != nil {
+		return err
+	}
+	req, err := newAccountRequest(method, strings.TrimSuffix(baseURL, "/")+webPushPath, bytes.NewReader(body), options)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build !nowebpush
+
+package client_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestClient_WebPush_RegisterUnregister(t *testing.T) {
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	require.Nil(t, err)
+	conf := server.NewConfig()
+	conf.BaseURL = "http://127.0.0.1"
+	conf.WebPushFile = filepath.Join(t.TempDir(), "webpush.db")
+	conf.WebPushEmailAddress = "testing@example.com"
+	conf.WebPushPrivateKey = privateKey
+	conf.WebPushPublicKey = publicKey
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	c := client.New(newTestConfig(port))
+
+	key, err := c.WebPushPublicKey(baseURL)
+	require.Nil(t, err)
+	require.Equal(t, publicKey, key)
+
+	subscription, err := client.ParseWebPushSubscription([]byte(`{"endpoint":"https://updates.push.services.mozilla.com/wpush/v1/AAABBCCCDDD","expirationTime":null,"keys":{"p256dh":"p256dh-key","auth":"auth-key"}}`), "mytopic")
+	require.Nil(t, err)
+	require.Equal(t, "https://updates.push.services.mozilla.com/wpush/v1/AAABBCCCDDD", subscription.Endpoint)
+	require.Equal(t, "auth-key", subscription.Auth)
+	require.Equal(t, "p256dh-key", subscription.P256dh)
+	require.Equal(t, []string{"mytopic"}, subscription.Topics)
+
+	require.Nil(t, c.RegisterWebPush(baseURL, subscription))
+	subscription.Topics = []string{"mytopic", "othertopic"}
+	require.Nil(t, c.RegisterWebPush(baseURL, subscription))
+	require.Nil(t, c.UnregisterWebPush(baseURL, subscription.Endpoint))
+
+	// Endpoints of unknown push services are rejected by the server
+	subscription.Endpoint = "https://push.example.com/wpush"
+	require.ErrorContains(t, c.RegisterWebPush(baseURL, subscription), "40039")
+}
+
+func TestClient_WebPush_NotSupported(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	c := client.New(newTestConfig(port))
+
+	_, err := c.WebPushPublicKey(fmt.Sprintf("http://127.0.0.1:%d", port))
+	require.ErrorContains(t, err, "server does not support web push")
+
+	_, err = client.ParseWebPushSubscription([]byte(`{"endpoint":"https://updates.push.services.mozilla.com/wpush/v1/AAABBCCCDDD"}`))
+	require.ErrorContains(t, err, "p256dh key are required")
+}
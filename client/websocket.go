@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+)
+
+const (
+	webSocketWriteWait = 10 * time.Second
+)
+
+// performWebSocketRequest subscribes (or polls) via a WebSocket connection to the /ws endpoint, see WithTransport,
+// and sends the received messages to msgChan, after passing them through the middlewares. The URL, query parameters
+// and headers (e.g. authentication) are taken from req. The cursor (if any) is updated with each received message,
+// see performSubscribeRequest. It returns when the connection is closed, or when ctx is canceled.
+//
+// The server sends a ping every keepalive-interval (default: 45s). If keepaliveTimeout is set and nothing (not even
+// a ping) was received within that time, the connection is considered dead, and errKeepaliveTimeout is returned.
+func performWebSocketRequest(ctx context.Context, httpClient *http.Client, logger *log.Logger, msgChan chan *Message, middlewares []MessageMiddleware, stats *subscriptionStats, req *http.Request, topicURL, subscriptionID string, cursor *string, keepaliveTimeout time.Duration) error {
+	wsURL := *req.URL
+	dialer := newWebSocketDialer(httpClient)
+	if wsURL.Scheme == unixScheme {
+		socketPath, u, err := unixSocketURL(req.URL, "ws")
+		if err != nil {
+			return err
+		}
+		wsURL = *u
+		dialer.Proxy, dialer.NetDialContext = nil, unixSocketDialContext(socketPath)
+	} else if wsURL.Scheme == "https" {
+		wsURL.Scheme = "wss"
+	} else {
+		wsURL.Scheme = "ws"
+	}
+	logger.Debug("%s Listening to %s via WebSocket", util.ShortTopicURL(topicURL), wsURL.String())
+	if t, ok := baseTransport(httpClient.Transport).(*errorTransport); ok {
+		return t.err
+	}
+	conn, resp, err := dialer.DialContext(ctx, wsURL.String(), req.Header)
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			return responseError(resp)
+		}
+		return err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(webSocketWriteWait))
+			conn.Close()
+		case <-done:
+		}
+	}()
+	conn.SetPingHandler(func(appData string) error {
+		logger.Trace("%s WebSocket ping received", util.ShortTopicURL(topicURL))
+		if err := conn.SetReadDeadline(readDeadline(keepaliveTimeout)); err != nil {
+			return err
+		}
+		err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(webSocketWriteWait))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		} else if e, ok := err.(net.Error); ok && e.Timeout() {
+			return nil
+		}
+		return err
+	})
+	limit, delivered := pollLimit(req), 0
+	for {
+		if err := conn.SetReadDeadline(readDeadline(keepaliveTimeout)); err != nil {
+			return err
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				return nil // Canceled, or closed by the server (e.g. after polling)
+			} else if e, ok := err.(net.Error); ok && e.Timeout() {
+				return errKeepaliveTimeout
+			}
+			return err
+		}
+		stats.client.bytesTransferred(0, int64(len(data)))
+		messageJSON := strings.TrimSpace(string(data))
+		m, err := toMessage(messageJSON, topicURL, subscriptionID)
+		if err != nil {
+			return err
+		}
+		m.httpClient, m.authorization = httpClient, req.Header.Get("Authorization")
+		logger.Trace("%s Message received: %s", util.ShortTopicURL(topicURL), messageJSON)
+		if m.Event == MessageEvent {
+			updateCursor(cursor, m)
+			if m = applyMiddlewares(logger, middlewares, m); m != nil {
+				stats.messageReceived(m.TopicURL)
+				select {
+				case msgChan <- m:
+				case <-ctx.Done():
+					return nil
+				}
+				if delivered++; limit > 0 && delivered >= limit {
+					return nil // Closes the connection, see WithLimit
+				}
+			}
+		}
+	}
+}
+
+// readDeadline returns the read deadline for the given keepalive timeout, or no deadline if it is zero
+func readDeadline(keepaliveTimeout time.Duration) time.Time {
+	if keepaliveTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(keepaliveTimeout)
+}
+
+// newWebSocketDialer returns a WebSocket dialer that uses the proxy and TLS settings of the HTTP client's
+// transport (see Config.HTTPClient, Config.Transport and Config.TLSConfig), if it is an *http.Transport
+func newWebSocketDialer(httpClient *http.Client) *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+	if t, ok := baseTransport(httpClient.Transport).(*http.Transport); ok {
+		dialer.Proxy = t.Proxy
+		dialer.TLSClientConfig = t.TLSClientConfig
+		dialer.NetDialContext = t.DialContext
+	}
+	return &dialer
+}
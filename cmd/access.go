@@ -8,6 +8,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
+	"time"
 )
 
 func init() {
@@ -21,6 +22,7 @@ const (
 var flagsAccess = append(
 	append([]cli.Flag{}, flagsUser...),
 	&cli.BoolFlag{Name: "reset", Aliases: []string{"r"}, Usage: "reset access for user (and topic)"},
+	&cli.StringFlag{Name: "expires", Aliases: []string{"e"}, Usage: "time at which the access expires, e.g. '24h' or a Unix timestamp"},
 )
 
 var cmdAccess = &cli.Command{
@@ -44,6 +46,8 @@ Usage:
   ntfy access                            # Shows access control list (alias: 'ntfy user list')
   ntfy access USERNAME                   # Shows access control entries for USERNAME
   ntfy access USERNAME TOPIC PERMISSION  # Allow/deny access for USERNAME to TOPIC
+  ntfy access --expires=EXPIRES USERNAME TOPIC PERMISSION
+                                         # Allow/deny access for USERNAME to TOPIC until EXPIRES
 
 Arguments:
   USERNAME     an existing user, as created with 'ntfy user add', or "everyone"/"*"
@@ -61,6 +65,7 @@ Examples:
   ntfy access phil mytopic rw        # Allow read-write access to mytopic for user phil
   ntfy access everyone mytopic rw    # Allow anonymous read-write access to mytopic
   ntfy access everyone "up*" write   # Allow anonymous write-only access to topics "up..." 
+  ntfy access -e 24h ben alerts ro   # Allow read-only access to alerts for user ben for 24 hours
   ntfy access --reset                # Reset entire access control list
   ntfy access --reset phil           # Reset all access for user phil
   ntfy access --reset phil mytopic   # Reset access for user phil and topic mytopic
@@ -93,6 +98,8 @@ func execUserAccess(c *cli.Context) error {
 	if reset {
 		if perms != "" {
 			return errors.New("too many arguments, please check 'ntfy access --help' for usage details")
+		} else if c.String("expires") != "" {
+			return errors.New("cannot use --expires with --reset")
 		}
 		return resetAccess(c, manager, username, topic)
 	} else if perms == "" {
@@ -101,7 +108,16 @@ func execUserAccess(c *cli.Context) error {
 		}
 		return showAccess(c, manager, username)
 	}
-	return changeAccess(c, manager, username, topic, perms)
+	var expires time.Time
+	if c.String("expires") != "" {
+		expires, err = util.ParseFutureTime(c.String("expires"), time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid expires: %s", c.String("expires"))
+		} else if !expires.After(time.Now()) {
+			return fmt.Errorf("expires must be in the future: %s", c.String("expires"))
+		}
+	}
+	return changeAccess(c, manager, username, topic, perms, expires)
 }
 
 // changeAccess updates the access permissions for a user on a specific topic.
@@ -112,10 +128,11 @@ func execUserAccess(c *cli.Context) error {
 //   - username: The name of the user.
 //   - topic: The topic to change access for.
 //   - perms: The new permission string (e.g., "read-write", "read-only").
+//   - expires: The time at which the access expires, or zero if it does not expire.
 //
 // Returns:
 //   - An error if the user or topic is invalid, or if the update fails.
-func changeAccess(c *cli.Context, manager *user.Manager, username string, topic string, perms string) error {
+func changeAccess(c *cli.Context, manager *user.Manager, username string, topic string, perms string, expires time.Time) error {
 	if !util.Contains([]string{"", "read-write", "rw", "read-only", "read", "ro", "write-only", "write", "wo", "none", "deny"}, perms) {
 		return errors.New("permission must be one of: read-write, read-only, write-only, or deny (or the aliases: read, ro, write, wo, none)")
 	}
@@ -131,17 +148,21 @@ func changeAccess(c *cli.Context, manager *user.Manager, username string, topic
 	} else if u.Role == user.RoleAdmin {
 		return fmt.Errorf("user %s is an admin user, access control entries have no effect", username)
 	}
-	if err := manager.AllowAccess(username, topic, permission); err != nil {
+	if err := manager.AllowAccessUntil(username, topic, permission, expires); err != nil {
 		return err
 	}
+	until := ""
+	if !expires.IsZero() {
+		until = fmt.Sprintf(" until %s", expires.Format(time.RFC1123))
+	}
 	if permission.IsReadWrite() {
-		fmt.Fprintf(c.App.Writer, "granted read-write access to topic %s\n\n", topic)
+		fmt.Fprintf(c.App.Writer, "granted read-write access to topic %s%s\n\n", topic, until)
 	} else if permission.IsRead() {
-		fmt.Fprintf(c.App.Writer, "granted read-only access to topic %s\n\n", topic)
+		fmt.Fprintf(c.App.Writer, "granted read-only access to topic %s%s\n\n", topic, until)
 	} else if permission.IsWrite() {
-		fmt.Fprintf(c.App.Writer, "granted write-only access to topic %s\n\n", topic)
+		fmt.Fprintf(c.App.Writer, "granted write-only access to topic %s%s\n\n", topic, until)
 	} else {
-		fmt.Fprintf(c.App.Writer, "revoked all access to topic %s\n\n", topic)
+		fmt.Fprintf(c.App.Writer, "revoked all access to topic %s%s\n\n", topic, until)
 	}
 	return showUserAccess(c, manager, username)
 }
@@ -289,27 +310,40 @@ func showUsers(c *cli.Context, manager *user.Manager, users []*user.User) error
 		if u.Tier != nil {
 			tier = u.Tier.Name
 		}
+		if u.Tier != nil && !u.TierExpires.IsZero() {
+			tier += fmt.Sprintf(", expires %s", u.TierExpires.Format(time.RFC1123))
+		}
 		provisioned := ""
 		if u.Provisioned {
 			provisioned = ", server config"
 		}
-		fmt.Fprintf(c.App.Writer, "user %s (role: %s, tier: %s%s)\n", u.Name, u.Role, tier, provisioned)
+		passwordExpired := ""
+		if u.PasswordExpired {
+			passwordExpired = ", password expired"
+		}
+		displayName := ""
+		if u.DisplayName() != "" {
+			displayName = fmt.Sprintf(" %q", u.DisplayName())
+		}
+		fmt.Fprintf(c.App.Writer, "user %s%s (role: %s, tier: %s%s%s)\n", u.Name, displayName, u.Role, tier, provisioned, passwordExpired)
 		if u.Role == user.RoleAdmin {
 			fmt.Fprintf(c.App.Writer, "- read-write access to all topics (admin role)\n")
 		} else if len(grants) > 0 {
 			for _, grant := range grants {
-				grantProvisioned := ""
+				grantSuffix := ""
 				if grant.Provisioned {
-					grantProvisioned = " (server config)"
+					grantSuffix = " (server config)"
+				} else if !grant.Expires.IsZero() {
+					grantSuffix = fmt.Sprintf(" (expires %s)", grant.Expires.Format(time.RFC1123))
 				}
 				if grant.Permission.IsReadWrite() {
-					fmt.Fprintf(c.App.Writer, "- read-write access to topic %s%s\n", grant.TopicPattern, grantProvisioned)
+					fmt.Fprintf(c.App.Writer, "- read-write access to topic %s%s\n", grant.TopicPattern, grantSuffix)
 				} else if grant.Permission.IsRead() {
-					fmt.Fprintf(c.App.Writer, "- read-only access to topic %s%s\n", grant.TopicPattern, grantProvisioned)
+					fmt.Fprintf(c.App.Writer, "- read-only access to topic %s%s\n", grant.TopicPattern, grantSuffix)
 				} else if grant.Permission.IsWrite() {
-					fmt.Fprintf(c.App.Writer, "- write-only access to topic %s%s\n", grant.TopicPattern, grantProvisioned)
+					fmt.Fprintf(c.App.Writer, "- write-only access to topic %s%s\n", grant.TopicPattern, grantSuffix)
 				} else {
-					fmt.Fprintf(c.App.Writer, "- no access to topic %s%s\n", grant.TopicPattern, grantProvisioned)
+					fmt.Fprintf(c.App.Writer, "- no access to topic %s%s\n", grant.TopicPattern, grantSuffix)
 				}
 			}
 		} else {
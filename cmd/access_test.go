@@ -76,6 +76,24 @@ user * (role: anonymous, tier: none)
 	}))
 }
 
+func TestCLI_Access_Grant_Expires(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("benpass\nbenpass")
+	require.Nil(t, runUserCommand(app, conf, "add", "ben"))
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, runAccessCommand(app, conf, "--expires=24h", "ben", "incident", "ro"))
+	require.Contains(t, stdout.String(), "granted read-only access to topic incident until ")
+	require.Regexp(t, `- read-only access to topic incident \(expires .+\)`, stdout.String())
+
+	app, _, _, _ = newTestApp()
+	require.EqualError(t, runAccessCommand(app, conf, "--expires=invalid", "ben", "incident", "ro"), "invalid expires: invalid")
+	require.EqualError(t, runAccessCommand(app, conf, "--expires=24h", "--reset", "ben", "incident"), "cannot use --expires with --reset")
+}
+
 func runAccessCommand(app *cli.App, conf *server.Config, args ...string) error {
 	userArgs := []string{
 		"ntfy",
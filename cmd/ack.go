@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/client"
+)
+
+func init() {
+	commands = append(commands, cmdAck)
+}
+
+var flagsAck = append(
+	append(append([]cli.Flag{}, flagsDefault...), flagsTLS...),
+	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG"}, Usage: "client config file"},
+	&cli.StringFlag{Name: "user", Aliases: []string{"u"}, EnvVars: []string{"NTFY_USER"}, Usage: "username[:password] used to auth against the server"},
+	&cli.StringFlag{Name: "token", Aliases: []string{"k"}, EnvVars: []string{"NTFY_TOKEN"}, Usage: "access token used to auth against the server"},
+	&cli.BoolFlag{Name: "quiet", Aliases: []string{"q"}, Usage: "do not print anything on success"},
+)
+
+var cmdAck = &cli.Command{
+	Name:      "ack",
+	Usage:     "Acknowledge messages, so they are no longer escalated",
+	UsageText: "ntfy ack [OPTIONS..] TOPIC ID...",
+	Action:    execAck,
+	Category:  categoryClient,
+	Flags:     flagsAck,
+	Before:    initLogFunc,
+	Description: `Acknowledge one or more messages of a topic. If the topic has an escalation policy,
+acknowledged messages are no longer escalated. ID is either a message ID, or the claim
+returned when claiming a message from a work queue.
+
+Escalated messages have an "Acknowledge" action. 'ntfy subscribe' prints the matching
+'ntfy ack' command for them to stderr, and passes $NTFY_ACK_TOPIC and $NTFY_ACK_ID to
+commands, see 'ntfy subscribe --help'.
+
+Examples:
+  ntfy ack alerts rBWeMW5r5Vhq                  # Acknowledge message on ntfy.sh/alerts
+  ntfy ack -u phil:mypass home.lan/alerts 4sT8yVMhLiDb s8yWmkuDLgEP
+
+` + clientCommandDescriptionSuffix,
+}
+
+func execAck(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() < 2 {
+		return errors.New("must specify topic and at least one message ID, type 'ntfy ack --help' for help")
+	} else if c.String("user") != "" && c.String("token") != "" {
+		return errors.New("cannot set both --user and --token")
+	}
+	var options []client.RequestOption
+	auth, err := clientAuthOption(c, conf)
+	if err != nil {
+		return err
+	} else if auth != nil {
+		options = append(options, auth)
+	}
+	cl := client.New(conf)
+	topic := c.Args().Get(0)
+	for _, id := range c.Args().Slice()[1:] {
+		if err := cl.Ack(topic, id, options...); err != nil {
+			return fmt.Errorf("cannot acknowledge %s: %w", id, err)
+		}
+		if !c.Bool("quiet") {
+			fmt.Fprintf(c.App.Writer, "message %s acknowledged\n", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestCLI_Ack(t *testing.T) {
+	conf := server.NewConfig()
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthUsers = []*user.User{
+		{Name: "philuser", Hash: "$2a$10$U4WSIYY6evyGmZaraavM2e2JeVG6EMGUKN1uUwufUeeRd4Jpg6cGC", Role: user.RoleAdmin}, // philuser:philpass
+	}
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	for _, r := range []struct{ method, path, body string }{
+		{http.MethodPost, "/v1/account/reservation", `{"topic":"alerts","everyone":"deny-all"}`},
+		{http.MethodPut, "/v1/account/reservation/alerts/escalation", `{"steps":[{"after":"5m","priority":5}]}`},
+	} {
+		req, _ := http.NewRequest(r.method, baseURL+r.path, strings.NewReader(r.body))
+		req.Header.Set("Authorization", util.BasicAuth("philuser", "philpass"))
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "publish", "--user", "philuser:philpass", baseURL + "/alerts", "disk full"}))
+	m := toMessage(t, stdout.String())
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "ack", "--user", "philuser:philpass", baseURL + "/alerts", m.ID}))
+	require.Equal(t, fmt.Sprintf("message %s acknowledged\n", m.ID), stdout.String())
+
+	app, _, _, _ = newTestApp()
+	err := app.Run([]string{"ntfy", "ack", "--user", "philuser:philpass", baseURL + "/alerts", m.ID})
+	require.ErrorContains(t, err, "40405")
+
+	app, _, _, _ = newTestApp()
+	require.Error(t, app.Run([]string{"ntfy", "ack", baseURL + "/alerts"}))
+}
+
+func TestCLI_Subscribe_Poll_AckTarget(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	topicURL := fmt.Sprintf("http://127.0.0.1:%d/alerts", port)
+
+	app, _, _, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "publish", "--actions", fmt.Sprintf("http, Acknowledge, %s/ack/rBWeMW5r5Vhq, method=POST", topicURL), topicURL, "disk full"}))
+	app, _, _, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "publish", topicURL, "all good"}))
+
+	app, _, stdout, stderr := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "subscribe", "--poll", topicURL}))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	m := toMessage(t, lines[0])
+	require.Equal(t, fmt.Sprintf("Message %s asks to be acknowledged, run: ntfy ack %s rBWeMW5r5Vhq\n", m.ID, topicURL), stderr.String())
+}
@@ -2,12 +2,19 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/urfave/cli/v2"
 	"github.com/urfave/cli/v2/altsrc"
 	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"net"
+	"net/url"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -15,20 +22,49 @@ const (
 	categoryServer = "Server commands"
 )
 
+const (
+	syslogTag         = "ntfy"
+	syslogDefaultPort = "514"
+)
+
 var commands = make([]*cli.Command, 0)
 
 var flagsDefault = []cli.Flag{
 	&cli.BoolFlag{Name: "debug", Aliases: []string{"d"}, EnvVars: []string{"NTFY_DEBUG"}, Usage: "enable debug logging"},
 	&cli.BoolFlag{Name: "trace", EnvVars: []string{"NTFY_TRACE"}, Usage: "enable tracing (very verbose, be careful)"},
+	&cli.BoolFlag{Name: "trace-http", Aliases: []string{"trace_http"}, EnvVars: []string{"NTFY_TRACE_HTTP"}, Usage: "dump outgoing HTTP requests and responses to stderr, with credentials redacted (client commands only)"},
 	&cli.BoolFlag{Name: "no-log-dates", Aliases: []string{"no_log_dates"}, EnvVars: []string{"NTFY_NO_LOG_DATES"}, Usage: "disable the date/time prefix"},
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-level", Aliases: []string{"log_level"}, Value: log.InfoLevel.String(), EnvVars: []string{"NTFY_LOG_LEVEL"}, Usage: "set log level"}),
 	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "log-level-overrides", Aliases: []string{"log_level_overrides"}, EnvVars: []string{"NTFY_LOG_LEVEL_OVERRIDES"}, Usage: "set log level overrides"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "log-sampling", Aliases: []string{"log_sampling"}, EnvVars: []string{"NTFY_LOG_SAMPLING"}, Usage: "sample or rate limit log events, e.g. \"tag=publish -> 1/100\" or \"message=Connection failed -> 10/1m\""}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "log-redact-fields", Aliases: []string{"log_redact_fields"}, EnvVars: []string{"NTFY_LOG_REDACT_FIELDS"}, Usage: "mask these fields in logs, in addition to password, token, authorization and auth"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-format", Aliases: []string{"log_format"}, Value: log.TextFormat.String(), EnvVars: []string{"NTFY_LOG_FORMAT"}, Usage: "set log format"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-color", Aliases: []string{"log_color"}, Value: log.ColorAuto.String(), EnvVars: []string{"NTFY_LOG_COLOR"}, Usage: "colorize text logs: auto (if logging to a terminal), always or never"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-file", Aliases: []string{"log_file"}, EnvVars: []string{"NTFY_LOG_FILE"}, Usage: "set log file, default is STDOUT"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-file-max-size", Aliases: []string{"log_file_max_size"}, EnvVars: []string{"NTFY_LOG_FILE_MAX_SIZE"}, Usage: "rotate log file when it reaches this size (e.g. 100M), default is no limit"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-file-max-age", Aliases: []string{"log_file_max_age"}, EnvVars: []string{"NTFY_LOG_FILE_MAX_AGE"}, Usage: "rotate log file when it reaches this age (e.g. 1d), default is no limit"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "log-file-max-backups", Aliases: []string{"log_file_max_backups"}, EnvVars: []string{"NTFY_LOG_FILE_MAX_BACKUPS"}, Usage: "number of rotated log files to keep, default is all"}),
+	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "log-file-compress", Aliases: []string{"log_file_compress"}, EnvVars: []string{"NTFY_LOG_FILE_COMPRESS"}, Usage: "compress rotated log files with gzip"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-syslog", Aliases: []string{"log_syslog"}, EnvVars: []string{"NTFY_LOG_SYSLOG"}, Usage: "send logs to syslog, either \"local\", or a remote server, e.g. udp://host:514 or tcp://host:514"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-notify-topic", Aliases: []string{"log_notify_topic"}, EnvVars: []string{"NTFY_LOG_NOTIFY_TOPIC"}, Usage: "publish error logs to this ntfy topic URL, e.g. https://ntfy.sh/mytopic"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-notify-token", Aliases: []string{"log_notify_token"}, EnvVars: []string{"NTFY_LOG_NOTIFY_TOKEN"}, Usage: "access token to publish error logs with, see log-notify-topic"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-notify-interval", Aliases: []string{"log_notify_interval"}, Value: util.FormatDuration(log.DefaultNotifyInterval), EnvVars: []string{"NTFY_LOG_NOTIFY_INTERVAL"}, Usage: "minimum interval between error log notifications, errors in between are batched"}),
+	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "log-journald", Aliases: []string{"log_journald"}, EnvVars: []string{"NTFY_LOG_JOURNALD"}, Usage: "send logs to the systemd journal, with log fields as journal fields"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "log-outputs", Aliases: []string{"log_outputs"}, EnvVars: []string{"NTFY_LOG_OUTPUTS"}, Usage: "additional log outputs with their own format and level, e.g. \"file:/var/log/ntfy.json format=json level=debug\""}),
+}
+
+// flagsTLS are the TLS flags of the client commands, read in loadConfig
+var flagsTLS = []cli.Flag{
+	&cli.StringFlag{Name: "cacert", EnvVars: []string{"NTFY_CACERT"}, Usage: "PEM file with CA certificates to trust in addition to the system CAs, e.g. for a private CA"},
+	&cli.StringFlag{Name: "cert", EnvVars: []string{"NTFY_CERT"}, Usage: "PEM file with a client certificate (mTLS), may contain the private key as well"},
+	&cli.StringFlag{Name: "key", EnvVars: []string{"NTFY_KEY"}, Usage: "PEM file with the private key of the client certificate"},
+	&cli.BoolFlag{Name: "insecure", EnvVars: []string{"NTFY_INSECURE"}, Usage: "do not verify the server's TLS certificate (insecure, for testing only)"},
 }
 
 var (
 	logLevelOverrideRegex = regexp.MustCompile(`(?i)^([^=\s]+)(?:\s*=\s*(\S+))?\s*->\s*(TRACE|DEBUG|INFO|WARN|ERROR)$`)
+	logSamplingRegex      = regexp.MustCompile(`^(?i:(tag|message))\s*=\s*(.+?)\s*->\s*(\d+)\s*/\s*(\S+)$`)
+	logOutputRegex        = regexp.MustCompile(`^(stderr|stdout|journald|file:\S+|syslog:\S+)(?:\s+format=(?i:(text|json)))?(?:\s+level=(?i:(TRACE|DEBUG|INFO|WARN|ERROR)))?$`)
 )
 
 // New creates a new CLI application.
@@ -61,6 +97,7 @@ func New() *cli.App {
 func initLogFunc(c *cli.Context) error {
 	log.SetLevel(log.ToLevel(c.String("log-level")))
 	log.SetFormat(log.ToFormat(c.String("log-format")))
+	log.SetColorMode(log.ToColorMode(c.String("log-color")))
 	if c.Bool("trace") {
 		log.SetLevel(log.TraceLevel)
 	} else if c.Bool("debug") {
@@ -72,17 +109,177 @@ func initLogFunc(c *cli.Context) error {
 	if err := applyLogLevelOverrides(c.StringSlice("log-level-overrides")); err != nil {
 		return err
 	}
-	logFile := c.String("log-file")
-	if logFile != "" {
-		w, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	log.ResetSampleRules()
+	if err := applyLogSampleRules(c.StringSlice("log-sampling")); err != nil {
+		return err
+	}
+	log.SetRedactedFields(c.StringSlice("log-redact-fields"))
+	log.ResetOutputs()
+	var writers []io.Writer // The first writer is the main output, all others get a copy
+	if logFile := c.String("log-file"); logFile != "" {
+		rotateConfig, err := parseLogRotateConfig(c)
+		if err != nil {
+			return err
+		}
+		w, err := log.NewRotatingFile(logFile, rotateConfig)
 		if err != nil {
 			return err
 		}
-		log.SetOutput(w)
+		writers = append(writers, w)
+	}
+	if logSyslog := c.String("log-syslog"); logSyslog != "" {
+		w, err := newSyslogWriter(logSyslog)
+		if err != nil {
+			return err
+		}
+		writers = append(writers, w)
+	}
+	if c.Bool("log-journald") {
+		w, err := log.NewJournaldWriter(syslogTag)
+		if err != nil {
+			return err
+		}
+		writers = append(writers, w)
+	}
+	for i, w := range writers {
+		if i == 0 {
+			log.SetOutput(w)
+		} else {
+			log.AddOutput(w, log.CurrentFormat(), log.CurrentLevel())
+		}
+	}
+	for _, spec := range c.StringSlice("log-outputs") {
+		if err := addLogOutput(c, spec); err != nil {
+			return err
+		}
+	}
+	if topicURL := c.String("log-notify-topic"); topicURL != "" {
+		interval, err := util.ParseDuration(c.String("log-notify-interval"))
+		if err != nil {
+			return fmt.Errorf("invalid log-notify-interval: %w", err)
+		}
+		w, err := log.NewNotifyWriter(&log.NotifyConfig{
+			TopicURL: topicURL,
+			Token:    c.String("log-notify-token"),
+			Interval: interval,
+		})
+		if err != nil {
+			return fmt.Errorf("invalid log-notify-topic: %w", err)
+		}
+		log.AddOutput(w, log.TextFormat, log.ErrorLevel)
 	}
 	return nil
 }
 
+// addLogOutput parses an entry of the log-outputs option and adds it as an additional log output. Entries
+// have the format "<target> [format=<text|json>] [level=<level>]", where target is "stderr", "stdout",
+// "journald", "file:<path>" or "syslog:<local|url>". Format and level default to log-format and log-level.
+// Files are rotated according to the log-file-* options.
+//
+// Parameters:
+//   - c: The CLI context.
+//   - spec: The log output entry, e.g. "file:/var/log/ntfy.json format=json level=debug".
+//
+// Returns:
+//   - An error if the entry is invalid, or if the output cannot be opened.
+func addLogOutput(c *cli.Context, spec string) error {
+	m := logOutputRegex.FindStringSubmatch(strings.TrimSpace(spec))
+	if m == nil {
+		return fmt.Errorf(`invalid log output "%s", must be "<target> [format=<format>] [level=<level>]", e.g. "file:/var/log/ntfy.json format=json level=debug"`, spec)
+	}
+	target, format, level := m[1], log.CurrentFormat(), log.CurrentLevel()
+	if m[2] != "" {
+		format = log.ToFormat(m[2])
+	}
+	if m[3] != "" {
+		level = log.ToLevel(m[3])
+	}
+	var w io.Writer
+	switch {
+	case target == "stderr":
+		w = os.Stderr
+	case target == "stdout":
+		w = os.Stdout
+	case strings.HasPrefix(target, "file:"):
+		rotateConfig, err := parseLogRotateConfig(c)
+		if err != nil {
+			return err
+		}
+		w, err = log.NewRotatingFile(strings.TrimPrefix(target, "file:"), rotateConfig)
+		if err != nil {
+			return err
+		}
+	case target == "journald":
+		var err error
+		w, err = log.NewJournaldWriter(syslogTag)
+		if err != nil {
+			return err
+		}
+	default:
+		var err error
+		w, err = newSyslogWriter(strings.TrimPrefix(target, "syslog:"))
+		if err != nil {
+			return err
+		}
+	}
+	log.AddOutput(w, format, level)
+	return nil
+}
+
+// newSyslogWriter creates a syslog writer from the log-syslog option, which is either "local" for the local
+// syslog daemon, or a URL of a remote syslog server, e.g. udp://host:514 or tcp://host:514.
+//
+// Parameters:
+//   - target: The value of the log-syslog option.
+//
+// Returns:
+//   - The syslog writer, or an error if the option is invalid or the connection fails.
+func newSyslogWriter(target string) (*log.SyslogWriter, error) {
+	if target == "local" {
+		return log.NewSyslogWriter("", "", syslogTag)
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("invalid log-syslog value %s, must be \"local\", or udp://host:port or tcp://host:port", target)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), syslogDefaultPort)
+	}
+	return log.NewSyslogWriter(u.Scheme, host, syslogTag)
+}
+
+// parseLogRotateConfig parses the log file rotation options. If no option is set, the log file is never rotated.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - The rotation config, or an error if any of the options is invalid.
+func parseLogRotateConfig(c *cli.Context) (*log.RotateConfig, error) {
+	config := &log.RotateConfig{
+		MaxBackups: c.Int("log-file-max-backups"),
+		Compress:   c.Bool("log-file-compress"),
+	}
+	var err error
+	if maxSize := c.String("log-file-max-size"); maxSize != "" {
+		config.MaxSize, err = util.ParseSize(maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log-file-max-size: %w", err)
+		}
+	}
+	if maxAge := c.String("log-file-max-age"); maxAge != "" {
+		config.MaxAge, err = util.ParseDuration(maxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log-file-max-age: %w", err)
+		}
+	}
+	if config.MaxBackups < 0 {
+		return nil, errors.New("log-file-max-backups must not be negative")
+	}
+	return config, nil
+}
+
 // applyLogLevelOverrides parses and applies log level overrides.
 //
 // Parameters:
@@ -105,3 +302,45 @@ func applyLogLevelOverrides(rawOverrides []string) error {
 	}
 	return nil
 }
+
+// applyLogSampleRules parses and applies log sampling and rate limiting rules.
+//
+// Parameters:
+//   - rawRules: A slice of rule strings in the format "tag=value -> 1/N" to log only 1 of N matching events, or
+//     "tag=value -> N/duration" to log at most N matching events per duration. Instead of "tag", "message" can be
+//     used to match the message template, e.g. "message=Connection failed: %s -> 10/1m".
+//
+// Returns:
+//   - An error if any rule string is invalid.
+func applyLogSampleRules(rawRules []string) error {
+	for _, rawRule := range rawRules {
+		m := logSamplingRegex.FindStringSubmatch(strings.TrimSpace(rawRule))
+		if m == nil {
+			return fmt.Errorf(`invalid log sampling rule "%s", must be "tag=value -> 1/N" or "tag=value -> N/duration", e.g. "tag=publish -> 1/100"`, rawRule)
+		}
+		rule := &log.SampleRule{}
+		if strings.EqualFold(m[1], "tag") {
+			rule.Tag = m[2]
+		} else {
+			rule.Message = m[2]
+		}
+		count, err := strconv.Atoi(m[3])
+		if err != nil || count < 1 {
+			return fmt.Errorf(`invalid log sampling rule "%s", count must be at least 1`, rawRule)
+		}
+		if every, err := strconv.Atoi(m[4]); err == nil {
+			if count != 1 || every < 1 {
+				return fmt.Errorf(`invalid log sampling rule "%s", sampling must be in the format 1/N`, rawRule)
+			}
+			rule.Every = every
+		} else {
+			interval, err := util.ParseDuration(m[4])
+			if err != nil || interval <= 0 {
+				return fmt.Errorf(`invalid log sampling rule "%s", rate limit must be in the format N/duration, e.g. 10/1m`, rawRule)
+			}
+			rule.Limit, rule.Interval = count, interval
+		}
+		log.AddSampleRule(rule)
+	}
+	return nil
+}
@@ -3,21 +3,58 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
 	"heckel.io/ntfy/v2/client"
 	"heckel.io/ntfy/v2/log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
 
-// This only contains helpers so far
-
 func TestMain(m *testing.M) {
 	log.SetLevel(log.ErrorLevel)
 	os.Exit(m.Run())
 }
 
+func TestCLI_LogOutputs(t *testing.T) {
+	t.Cleanup(log.ResetOutputs)
+	filename := filepath.Join(t.TempDir(), "ntfy.json")
+	app, _, _, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "--log-level=ERROR", "--log-outputs=file:" + filename + " format=json level=debug", "webpush", "keys"}))
+	log.Tag("test").Debug("debug message")
+	log.Trace("trace message")
+	contents, err := os.ReadFile(filename)
+	require.Nil(t, err)
+	require.Contains(t, string(contents), `"level":"DEBUG","message":"debug message","tag":"test"}`)
+	require.NotContains(t, string(contents), "trace message")
+
+	app, _, _, _ = newTestApp()
+	require.Error(t, app.Run([]string{"ntfy", "--log-level=ERROR", "--log-outputs=file:" + filename + " level=verbose", "webpush", "keys"}))
+}
+
+func TestCLI_LogNotify(t *testing.T) {
+	t.Cleanup(log.ResetOutputs)
+	app, _, _, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "--log-notify-topic=https://ntfy.example.com/alerts", "--log-notify-interval=5m", "webpush", "keys"}))
+
+	app, _, _, _ = newTestApp()
+	require.Error(t, app.Run([]string{"ntfy", "--log-notify-topic=ntfy.example.com", "webpush", "keys"}))
+
+	app, _, _, _ = newTestApp()
+	require.Error(t, app.Run([]string{"ntfy", "--log-notify-topic=https://ntfy.example.com/alerts", "--log-notify-interval=often", "webpush", "keys"}))
+}
+
+func TestCLI_LogSampling(t *testing.T) {
+	t.Cleanup(log.ResetSampleRules)
+	require.Nil(t, applyLogSampleRules([]string{"tag=publish -> 1/100", "message=Connection failed: %s -> 10/1m"}))
+	require.Error(t, applyLogSampleRules([]string{"tag=publish -> 2/100"}))
+	require.Error(t, applyLogSampleRules([]string{"tag=publish -> 10/forever"}))
+	require.Error(t, applyLogSampleRules([]string{"visitor_ip=1.2.3.4 -> 1/10"}))
+	require.Error(t, applyLogSampleRules([]string{"tag=publish"}))
+}
+
 func newTestApp() (*cli.App, *bytes.Buffer, *bytes.Buffer, *bytes.Buffer) {
 	var stdin, stdout, stderr bytes.Buffer
 	app := New()
@@ -0,0 +1,106 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/util"
+)
+
+func init() {
+	commands = append(commands, cmdAttachmentGC)
+}
+
+var flagsAttachmentGC = append(
+	append([]cli.Flag{}, flagsDefault...),
+	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG_FILE"}, Value: server.DefaultConfigFile, DefaultText: server.DefaultConfigFile, Usage: "config file"},
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "cache-file", Aliases: []string{"cache_file", "C"}, EnvVars: []string{"NTFY_CACHE_FILE"}, Usage: "cache file used for message caching"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-cache-dir", Aliases: []string{"attachment_cache_dir"}, EnvVars: []string{"NTFY_ATTACHMENT_CACHE_DIR"}, Usage: "cache directory for attached files"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-total-size-limit", Aliases: []string{"attachment_total_size_limit", "A"}, EnvVars: []string{"NTFY_ATTACHMENT_TOTAL_SIZE_LIMIT"}, Value: util.FormatSize(server.DefaultAttachmentTotalSizeLimit), Usage: "limit of the on-disk attachment cache"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "attachment-gc-strategies", Aliases: []string{"attachment_gc_strategies", "s"}, EnvVars: []string{"NTFY_ATTACHMENT_GC_STRATEGIES"}, Usage: "strategies used to delete attachments (expired, orphans, size; default: expired)"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-gc-size-limit", Aliases: []string{"attachment_gc_size_limit"}, EnvVars: []string{"NTFY_ATTACHMENT_GC_SIZE_LIMIT"}, Usage: "size the attachment cache is reduced to by the size strategy (default: 90% of attachment-total-size-limit)"}),
+	&cli.BoolFlag{Name: "dry-run", Aliases: []string{"n"}, Usage: "only show which attachments would be deleted"},
+)
+
+var cmdAttachmentGC = &cli.Command{
+	Name:      "attachment-gc",
+	Usage:     "Delete attachments using the garbage collection strategies",
+	UsageText: "ntfy attachment-gc [OPTIONS..]",
+	Action:    execAttachmentGC,
+	Category:  categoryServer,
+	Flags:     flagsAttachmentGC,
+	Before:    initConfigFileInputSourceFunc("config", flagsAttachmentGC, initLogFunc),
+	Description: `Run the attachment garbage collection once, and print a report of the deleted attachments.
+The server runs the garbage collection periodically (see manager-interval), so this command is
+mostly useful with --dry-run, to see which attachments a (new) configuration would delete.
+
+The following strategies are supported, and always run in this order:
+  expired   Delete attachments after attachment-expiry-duration (default)
+  orphans   Delete files without message in the message cache (if older than 1h), and
+            mark attachments whose file is missing as deleted
+  size      If the attachment cache is larger than attachment-gc-size-limit, delete the attachments
+            of the least recently used topics (oldest first) until it is below the limit
+
+The cache file, the attachment cache directory and the strategies are read from the server
+config file, or can be passed as flags. The command can be run while the server is running.
+
+Examples:
+  ntfy attachment-gc --dry-run                                 # Show what the configured strategies would delete
+  ntfy attachment-gc -n -s size --attachment-gc-size-limit 1G  # Show what a 1G size limit would delete
+  ntfy attachment-gc -s orphans                                # Delete orphaned attachment files
+`,
+}
+
+func execAttachmentGC(c *cli.Context) error {
+	conf := server.NewConfig()
+	conf.CacheFile = c.String("cache-file")
+	conf.AttachmentCacheDir = c.String("attachment-cache-dir")
+	if conf.CacheFile == "" || conf.AttachmentCacheDir == "" {
+		return errors.New("cache-file and attachment-cache-dir must be set, see 'ntfy attachment-gc --help'")
+	}
+	totalSizeLimit, err := util.ParseSize(c.String("attachment-total-size-limit"))
+	if err != nil {
+		return fmt.Errorf("invalid attachment total size limit: %s", c.String("attachment-total-size-limit"))
+	}
+	strategies, sizeLimit, err := parseAttachmentGCOptions(c.StringSlice("attachment-gc-strategies"), c.String("attachment-gc-size-limit"), totalSizeLimit)
+	if err != nil {
+		return err
+	}
+	conf.AttachmentTotalSizeLimit = totalSizeLimit
+	conf.AttachmentGCStrategies = strategies
+	conf.AttachmentGCSizeLimit = sizeLimit
+	report, err := server.CollectAttachments(conf, c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+	return printAttachmentGCReport(c, report)
+}
+
+func printAttachmentGCReport(c *cli.Context, report *server.AttachmentGCReport) error {
+	action := "deleted"
+	if report.DryRun {
+		action = "would delete"
+	}
+	if len(report.Items) > 0 {
+		w := tabwriter.NewWriter(c.App.Writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTOPIC\tSIZE\tSTRATEGY\tREASON")
+		for _, item := range report.Items {
+			topic := item.Topic
+			if topic == "" {
+				topic = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", item.ID, topic, util.FormatSizeHuman(item.Size), item.Strategy, item.Reason)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(c.App.Writer, "%s %d attachment(s), attachment cache size %s -> %s\n", action, len(report.Items), util.FormatSizeHuman(report.SizeBefore), util.FormatSizeHuman(report.SizeAfter))
+	return nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestCLI_AttachmentGC(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "server-dummy.yml")
+	require.Nil(t, os.WriteFile(configFile, []byte(""), 0600)) // Dummy config file to avoid lookup of real server.yml
+	conf := server.NewConfig()
+	conf.CacheFile = filepath.Join(t.TempDir(), "cache.db")
+	conf.AttachmentCacheDir = t.TempDir()
+	conf.BaseURL = "http://127.0.0.1"
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+
+	req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://127.0.0.1:%d/mytopic", port), strings.NewReader("attached file"))
+	req.Header.Set("Filename", "file.txt")
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+
+	orphan := filepath.Join(conf.AttachmentCacheDir, "orphan000001")
+	require.Nil(t, os.WriteFile(orphan, []byte("orphaned"), 0600))
+	require.Nil(t, os.Chtimes(orphan, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour)))
+
+	args := []string{"ntfy", "attachment-gc", "--config=" + configFile, "--cache-file=" + conf.CacheFile, "--attachment-cache-dir=" + conf.AttachmentCacheDir}
+
+	// Dry run with size limit: attachment would be evicted, but nothing is deleted
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run(append(args, "--dry-run", "--attachment-gc-strategies=orphans,size", "--attachment-gc-size-limit=1")))
+	require.Contains(t, stdout.String(), "orphan000001  -        8 bytes   orphans   no message")
+	require.Contains(t, stdout.String(), "mytopic  13 bytes  size      cache size limit exceeded")
+	require.Contains(t, stdout.String(), "would delete 2 attachment(s), attachment cache size 21 bytes -> 0 bytes")
+	require.FileExists(t, orphan)
+
+	// Delete orphans only
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run(append(args, "-s", "orphans")))
+	require.Contains(t, stdout.String(), "deleted 1 attachment(s), attachment cache size 21 bytes -> 13 bytes")
+	require.NoFileExists(t, orphan)
+
+	// Invalid strategy
+	app, _, _, _ = newTestApp()
+	require.EqualError(t, app.Run(append(args, "-s", "lru")), "invalid attachment-gc-strategies: lru, must be one of expired, orphans, size")
+}
@@ -0,0 +1,379 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/util"
+)
+
+const (
+	backupVersion          = 1
+	backupManifestFile     = "manifest.json"
+	backupCacheFile        = "cache.db"
+	backupAuthFile         = "user.db"
+	backupWebPushFile      = "webpush.db"
+	backupAttachmentsDir   = "attachments/"
+	backupRestoreTmpSuffix = ".restore"
+)
+
+var (
+	backupAttachmentNameRegex = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+)
+
+// backupManifest is the first entry of a backup archive, and describes its contents
+type backupManifest struct {
+	Version     int      `json:"version"`
+	Time        int64    `json:"time"`
+	Databases   []string `json:"databases"`   // Names of the database snapshots, e.g. cache.db
+	Attachments bool     `json:"attachments"` // True if attachment files are included
+}
+
+func init() {
+	commands = append(commands, cmdBackup, cmdRestore)
+}
+
+// backupFlags returns the flags for the server files that are backed up or restored. They are read
+// from the server config file, so that "ntfy backup" and "ntfy restore" work without any arguments.
+func backupFlags(flags ...cli.Flag) []cli.Flag {
+	return append(
+		append([]cli.Flag{}, flagsDefault...),
+		append([]cli.Flag{
+			&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG_FILE"}, Value: server.DefaultConfigFile, DefaultText: server.DefaultConfigFile, Usage: "config file"},
+			altsrc.NewStringFlag(&cli.StringFlag{Name: "cache-file", Aliases: []string{"cache_file", "C"}, EnvVars: []string{"NTFY_CACHE_FILE"}, Usage: "cache file used for message caching"}),
+			altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-file", Aliases: []string{"auth_file", "H"}, EnvVars: []string{"NTFY_AUTH_FILE"}, Usage: "auth database file used for access control"}),
+			altsrc.NewStringFlag(&cli.StringFlag{Name: "web-push-file", Aliases: []string{"web_push_file"}, EnvVars: []string{"NTFY_WEB_PUSH_FILE"}, Usage: "file used to store web push subscriptions"}),
+			altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-cache-dir", Aliases: []string{"attachment_cache_dir"}, EnvVars: []string{"NTFY_ATTACHMENT_CACHE_DIR"}, Usage: "cache directory for attached files"}),
+		}, flags...)...,
+	)
+}
+
+var flagsBackup = backupFlags(
+	&cli.BoolFlag{Name: "attachments", Aliases: []string{"a"}, Usage: "also back up the attached files (may be large)"},
+)
+
+var flagsRestore = backupFlags(
+	&cli.BoolFlag{Name: "force", Aliases: []string{"f"}, Usage: "overwrite existing files"},
+)
+
+var cmdBackup = &cli.Command{
+	Name:      "backup",
+	Usage:     "Back up the server state to a file",
+	UsageText: "ntfy backup [OPTIONS..] FILE",
+	Action:    execBackup,
+	Category:  categoryServer,
+	Flags:     flagsBackup,
+	Before:    initConfigFileInputSourceFunc("config", flagsBackup, initLogFunc),
+	Description: `Back up the message cache, the user database and the web push database into a
+single archive (tar.gz), e.g. for disaster recovery, or to move a server to a new machine.
+
+The backup can be taken while the server is running: each database is copied as a
+consistent snapshot, including all data written up to that point. The metadata of all
+attachments is part of the message cache. With --attachments, the attached files
+themselves are included as well.
+
+The files to back up are read from the server config file (cache-file, auth-file,
+web-push-file, attachment-cache-dir), or can be passed as flags. Use 'ntfy restore'
+to restore a backup.
+
+Examples:
+  ntfy backup ntfy-backup.tar.gz                 # Back up the databases configured in /etc/ntfy/server.yml
+  ntfy backup --attachments ntfy-backup.tar.gz   # Also back up the attached files
+`,
+}
+
+var cmdRestore = &cli.Command{
+	Name:      "restore",
+	Usage:     "Restore the server state from a backup file",
+	UsageText: "ntfy restore [OPTIONS..] FILE",
+	Action:    execRestore,
+	Category:  categoryServer,
+	Flags:     flagsRestore,
+	Before:    initConfigFileInputSourceFunc("config", flagsRestore, initLogFunc),
+	Description: `Restore a backup created with 'ntfy backup'. The server must be stopped while
+restoring, and should be started once the restore is complete.
+
+The databases and attached files are restored to the locations in the server config file
+(cache-file, auth-file, web-push-file, attachment-cache-dir), or the locations passed as
+flags, so they may differ from the locations on the server the backup was taken on. Parts
+of the backup without a configured location are skipped. Existing files are not overwritten,
+unless --force is passed.
+
+Make sure that the restored files are owned by the user the server runs as, e.g. by
+running 'chown -R ntfy:ntfy /var/cache/ntfy /var/lib/ntfy' after restoring.
+
+Examples:
+  ntfy restore ntfy-backup.tar.gz           # Restore to the locations in /etc/ntfy/server.yml
+  ntfy restore --force ntfy-backup.tar.gz   # Overwrite existing databases
+`,
+}
+
+func execBackup(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("backup file missing, see 'ntfy backup --help'")
+	}
+	filename := c.Args().Get(0)
+	databases := backupDatabases(c)
+	attachmentCacheDir := c.String("attachment-cache-dir")
+	withAttachments := c.Bool("attachments") && attachmentCacheDir != ""
+	if len(databases) == 0 && !withAttachments {
+		return errors.New("nothing to back up, set cache-file, auth-file, web-push-file or attachment-cache-dir")
+	}
+	tmpDir, err := os.MkdirTemp("", "ntfy-backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	manifest := &backupManifest{
+		Version:     backupVersion,
+		Time:        time.Now().Unix(),
+		Databases:   make([]string, 0),
+		Attachments: withAttachments,
+	}
+	snapshots := make(map[string]string)
+	for name, dbFile := range databases {
+		snapshot := filepath.Join(tmpDir, name)
+		if err := snapshotDatabase(dbFile, snapshot); err != nil {
+			return fmt.Errorf("cannot back up %s: %w", dbFile, err)
+		}
+		snapshots[name] = snapshot
+		manifest.Databases = append(manifest.Databases, name)
+	}
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, backupManifestFile, int64(len(manifestBytes)), strings.NewReader(string(manifestBytes))); err != nil {
+		return err
+	}
+	for _, name := range manifest.Databases {
+		if err := writeTarFile(tw, name, snapshots[name]); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "backed up %s\n", databases[name])
+	}
+	if withAttachments {
+		count, err := backupAttachments(tw, attachmentCacheDir)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "backed up %d attachment(s) from %s\n", count, attachmentCacheDir)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	} else if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func execRestore(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("backup file missing, see 'ntfy restore --help'")
+	}
+	filename := c.Args().Get(0)
+	databases := backupDatabases(c)
+	attachmentCacheDir := c.String("attachment-cache-dir")
+	force := c.Bool("force")
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("invalid backup file: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	manifest, err := readBackupManifest(tr)
+	if err != nil {
+		return err
+	}
+	for _, name := range manifest.Databases {
+		if dbFile, ok := databases[name]; ok && util.FileExists(dbFile) && !force {
+			return fmt.Errorf("%s already exists, pass --force to overwrite it", dbFile)
+		}
+	}
+	attachments := 0
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid backup file: %w", err)
+		}
+		if strings.HasPrefix(header.Name, backupAttachmentsDir) {
+			if attachmentCacheDir == "" {
+				continue
+			}
+			name := strings.TrimPrefix(header.Name, backupAttachmentsDir)
+			if !backupAttachmentNameRegex.MatchString(name) {
+				return fmt.Errorf("invalid backup file: unexpected attachment %s", header.Name)
+			}
+			if err := restoreFile(filepath.Join(attachmentCacheDir, name), tr); err != nil {
+				return err
+			}
+			attachments++
+			continue
+		}
+		dbFile, ok := databases[header.Name]
+		if !ok {
+			fmt.Fprintf(c.App.ErrWriter, "skipping %s, no location configured for it\n", header.Name)
+			continue
+		}
+		// Stale write-ahead log files of the old database would be applied to the restored database
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if err := os.Remove(dbFile + suffix); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := restoreFile(dbFile, tr); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "restored %s\n", dbFile)
+	}
+	if manifest.Attachments && attachmentCacheDir == "" {
+		fmt.Fprintln(c.App.ErrWriter, "skipping attachments, attachment-cache-dir not set")
+	} else if manifest.Attachments {
+		fmt.Fprintf(c.App.Writer, "restored %d attachment(s) to %s\n", attachments, attachmentCacheDir)
+	}
+	return nil
+}
+
+// backupDatabases returns the database files to back up or restore, keyed by their name in the backup archive
+func backupDatabases(c *cli.Context) map[string]string {
+	databases := make(map[string]string)
+	if cacheFile := c.String("cache-file"); cacheFile != "" {
+		databases[backupCacheFile] = cacheFile
+	}
+	if authFile := c.String("auth-file"); authFile != "" {
+		databases[backupAuthFile] = authFile
+	}
+	if webPushFile := c.String("web-push-file"); webPushFile != "" {
+		databases[backupWebPushFile] = webPushFile
+	}
+	return databases
+}
+
+// snapshotDatabase writes a consistent copy of the SQLite database to snapshotFilename, using "VACUUM INTO".
+// This works while the server is writing to the database, and includes the contents of the write-ahead log.
+func snapshotDatabase(filename, snapshotFilename string) error {
+	if !util.FileExists(filename) {
+		return fmt.Errorf("database %s does not exist", filename)
+	}
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("VACUUM INTO ?", snapshotFilename)
+	return err
+}
+
+// backupAttachments adds all attached files to the archive. Files that are deleted while the backup is
+// running (e.g. because they expired) are skipped.
+func backupAttachments(tw *tar.Writer, dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !backupAttachmentNameRegex.MatchString(entry.Name()) {
+			continue
+		}
+		if err := writeTarFile(tw, backupAttachmentsDir+entry.Name(), filepath.Join(dir, entry.Name())); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func readBackupManifest(tr *tar.Reader) (*backupManifest, error) {
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup file: %w", err)
+	} else if header.Name != backupManifestFile {
+		return nil, errors.New("invalid backup file: manifest missing")
+	}
+	var manifest backupManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup file: %w", err)
+	} else if manifest.Version != backupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+func writeTarFile(tw *tar.Writer, name, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return writeTarEntry(tw, name, stat.Size(), f)
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tw, r, size)
+	return err
+}
+
+// restoreFile writes the file to a temporary file first, and then renames it, so that a failed restore
+// does not leave a partially written database behind
+func restoreFile(filename string, r io.Reader) error {
+	tmpFilename := filename + backupRestoreTmpSuffix
+	f, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmpFilename)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"heckel.io/ntfy/v2/user"
+)
+
+func TestCLI_BackupRestore(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "server-dummy.yml")
+	require.Nil(t, os.WriteFile(configFile, []byte(""), 0600)) // Dummy config file to avoid lookup of real server.yml
+	conf := server.NewConfig()
+	conf.CacheFile = filepath.Join(t.TempDir(), "cache.db")
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthDefault = user.PermissionReadWrite
+	conf.AuthUsers = []*user.User{
+		{Name: "philuser", Hash: "$2a$10$U4WSIYY6evyGmZaraavM2e2JeVG6EMGUKN1uUwufUeeRd4Jpg6cGC", Role: user.RoleUser}, // philuser:philpass
+	}
+	conf.AttachmentCacheDir = t.TempDir()
+	conf.BaseURL = "http://127.0.0.1"
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+
+	publish := func(body string, headers map[string]string) {
+		req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://127.0.0.1:%d/mytopic", port), strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		resp.Body.Close()
+	}
+	publish("first message", nil)
+	publish("attached file", map[string]string{"Filename": "file.txt"})
+
+	// Backup while the server is running
+	backupFile := filepath.Join(t.TempDir(), "backup.tar.gz")
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "backup", "--config=" + configFile, "--cache-file=" + conf.CacheFile, "--auth-file=" + conf.AuthFile, "--attachment-cache-dir=" + conf.AttachmentCacheDir, "--attachments", backupFile}))
+	require.Contains(t, stdout.String(), "backed up "+conf.CacheFile)
+	require.Contains(t, stdout.String(), "backed up 1 attachment(s)")
+
+	// Restore to different locations
+	restoreDir := t.TempDir()
+	restoreAttachmentDir := t.TempDir()
+	restoreArgs := []string{"ntfy", "restore", "--config=" + configFile, "--cache-file=" + filepath.Join(restoreDir, "cache.db"), "--auth-file=" + filepath.Join(restoreDir, "user.db"), "--attachment-cache-dir=" + restoreAttachmentDir, backupFile}
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run(restoreArgs))
+	require.Contains(t, stdout.String(), "restored 1 attachment(s)")
+
+	cacheDB, err := sql.Open("sqlite3", filepath.Join(restoreDir, "cache.db"))
+	require.Nil(t, err)
+	defer cacheDB.Close()
+	var messages int
+	require.Nil(t, cacheDB.QueryRow(`SELECT COUNT(*) FROM messages WHERE topic = 'mytopic'`).Scan(&messages))
+	require.Equal(t, 2, messages)
+	var attachmentID string
+	require.Nil(t, cacheDB.QueryRow(`SELECT mid FROM messages WHERE attachment_name = 'file.txt'`).Scan(&attachmentID))
+	contents, err := os.ReadFile(filepath.Join(restoreAttachmentDir, attachmentID))
+	require.Nil(t, err)
+	require.Equal(t, "attached file", string(contents))
+
+	userDB, err := sql.Open("sqlite3", filepath.Join(restoreDir, "user.db"))
+	require.Nil(t, err)
+	defer userDB.Close()
+	var users int
+	require.Nil(t, userDB.QueryRow(`SELECT COUNT(*) FROM user WHERE user = 'philuser'`).Scan(&users))
+	require.Equal(t, 1, users)
+
+	// Existing files are only overwritten with --force
+	app, _, _, _ = newTestApp()
+	require.ErrorContains(t, app.Run(restoreArgs), "already exists")
+	app, _, _, _ = newTestApp()
+	require.Nil(t, app.Run(append(restoreArgs[:2], append([]string{"--force"}, restoreArgs[2:]...)...)))
+}
@@ -0,0 +1,530 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/time/rate"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/util"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	commands = append(commands, cmdBench)
+}
+
+const (
+	benchTitlePrefix       = "bench "         // Title prefix of benchmark messages, followed by the publish time in Unix nanoseconds
+	benchAttachmentName    = "bench.bin"      // Filename of benchmark attachments
+	benchSubscribeTimeout  = 10 * time.Second // Max time to wait for all subscribers to be connected
+	benchDrainTimeout      = 5 * time.Second  // Max time to wait for outstanding messages after publishing has finished
+	benchDrainPollInterval = 50 * time.Millisecond
+)
+
+var flagsBench = append(
+	append(append([]cli.Flag{}, flagsDefault...), flagsTLS...),
+	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG"}, Usage: "client config file"},
+	&cli.StringFlag{Name: "user", Aliases: []string{"u"}, EnvVars: []string{"NTFY_USER"}, Usage: "username[:password] used to auth against the server"},
+	&cli.StringFlag{Name: "token", Aliases: []string{"k"}, EnvVars: []string{"NTFY_TOKEN"}, Usage: "access token used to auth against the server"},
+	&cli.IntFlag{Name: "publishers", Aliases: []string{"P"}, Value: 10, Usage: "number of concurrent publishers"},
+	&cli.IntFlag{Name: "subscribers", Aliases: []string{"S"}, Value: 1, Usage: "number of subscribers, spread across all topics"},
+	&cli.IntFlag{Name: "topics", Aliases: []string{"t"}, Value: 1, Usage: "number of topics to publish to, e.g. TOPIC-1, TOPIC-2, ..."},
+	&cli.Int64Flag{Name: "messages", Aliases: []string{"n"}, Value: 0, Usage: "total number of messages to publish, default is no limit (see --duration)"},
+	&cli.StringFlag{Name: "duration", Aliases: []string{"D"}, Value: "10s", Usage: "max duration of the benchmark"},
+	&cli.Float64Flag{Name: "rate", Aliases: []string{"r"}, Value: 0, Usage: "max messages per second across all publishers, default is no limit"},
+	&cli.StringFlag{Name: "message-size", Aliases: []string{"message_size", "s"}, Value: "100", Usage: "size of the message body, e.g. 100 or 2K"},
+	&cli.Float64Flag{Name: "attachment-ratio", Aliases: []string{"attachment_ratio"}, Value: 0, Usage: "share of messages sent with an attachment, between 0 and 1"},
+	&cli.StringFlag{Name: "attachment-size", Aliases: []string{"attachment_size"}, Value: "10K", Usage: "size of attachments, e.g. 10K or 1M"},
+	&cli.BoolFlag{Name: "json", Aliases: []string{"j"}, Usage: "print report as JSON"},
+)
+
+var cmdBench = &cli.Command{
+	Name:      "bench",
+	Usage:     "Generate publish/subscribe load against a ntfy server",
+	UsageText: "ntfy bench [OPTIONS..] TOPIC",
+	Action:    execBench,
+	Category:  categoryClient,
+	Flags:     flagsBench,
+	Before:    initLogFunc,
+	Description: `Publish messages to one or more topics with a number of concurrent publishers, receive them
+with a number of subscribers, and report throughput, latency percentiles and errors. This is meant
+for capacity planning of self-hosted servers.
+
+Publish latency is the time it takes for a publish request to complete. Delivery latency is the time
+between starting a publish request and a subscriber receiving the message.
+
+Please note that the benchmark is subject to the server's rate limits. To measure the capacity of the
+server, exempt the benchmarking host from the request limit (visitor-request-limit-exempt-hosts) and
+raise the subscription limit (visitor-subscription-limit), or use a user with a tier that has high
+limits. Please do not run benchmarks against ntfy.sh.
+
+Examples:
+  ntfy bench myserver.com/bench                          # Publish for 10s with 10 publishers, 1 subscriber
+  ntfy bench -n 10000 -P 50 -S 100 myserver.com/bench    # Publish 10,000 messages with 50 publishers, 100 subscribers
+  ntfy bench -t 10 -r 500 -D 1m myserver.com/bench       # Publish 500 messages per second for 1m to 10 topics
+  ntfy bench --attachment-ratio 0.1 myserver.com/bench   # Send 10% of messages with a 10K attachment
+  ntfy bench --json -s 2K myserver.com/bench             # Publish 2K messages, print report as JSON
+
+` + clientCommandDescriptionSuffix,
+}
+
+// benchOptions defines the load generated by runBench
+type benchOptions struct {
+	topicURLs       []string
+	publishers      int
+	subscribers     int
+	messages        int64 // Zero means no limit
+	duration        time.Duration
+	rate            float64 // Zero means no limit
+	messageSize     int64
+	attachmentRatio float64
+	attachmentSize  int64
+	auth            []client.RequestOption
+}
+
+// benchReport is the result of a benchmark, printed as text or JSON
+type benchReport struct {
+	URL             string         `json:"url"`
+	Publishers      int            `json:"publishers"`
+	Subscribers     int            `json:"subscribers"`
+	Topics          int            `json:"topics"`
+	MessageSize     int64          `json:"message_size"`
+	AttachmentRatio float64        `json:"attachment_ratio"`
+	AttachmentSize  int64          `json:"attachment_size,omitempty"`
+	Duration        float64        `json:"duration"` // Seconds
+	Published       int64          `json:"published"`
+	PublishFailed   int64          `json:"publish_failed"`
+	PublishedBytes  int64          `json:"published_bytes"`
+	PublishRate     float64        `json:"publish_rate"` // Messages per second
+	PublishLatency  *benchLatency  `json:"publish_latency,omitempty"`
+	Expected        int64          `json:"expected"`
+	Received        int64          `json:"received"`
+	DeliveryLatency *benchLatency  `json:"delivery_latency,omitempty"`
+	Errors          map[string]int `json:"errors,omitempty"`
+}
+
+// benchLatency describes a latency distribution, in milliseconds
+type benchLatency struct {
+	Min float64 `json:"min"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// benchStats collects the results of a running benchmark
+type benchStats struct {
+	published         int64
+	publishFailed     int64
+	publishedBytes    int64
+	expected          int64
+	received          int64
+	publishLatencies  []time.Duration
+	deliveryLatencies []time.Duration
+	errors            map[string]int
+	mu                sync.Mutex
+}
+
+// execBench is the entry point for the `ntfy bench` command.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if the arguments are invalid, or if the benchmark could not be started.
+func execBench(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	user := c.String("user")
+	token := c.String("token")
+	publishers := c.Int("publishers")
+	subscribers := c.Int("subscribers")
+	topics := c.Int("topics")
+	messages := c.Int64("messages")
+	durationStr := c.String("duration")
+	maxRate := c.Float64("rate")
+	messageSizeStr := c.String("message-size")
+	attachmentRatio := c.Float64("attachment-ratio")
+	attachmentSizeStr := c.String("attachment-size")
+	jsonOutput := c.Bool("json")
+
+	// Checks
+	if c.NArg() < 1 {
+		return errors.New("must specify topic, type 'ntfy bench --help' for help")
+	} else if user != "" && token != "" {
+		return errors.New("cannot set both --user and --token")
+	} else if publishers < 1 || subscribers < 0 || topics < 1 || messages < 0 || maxRate < 0 {
+		return errors.New("--publishers and --topics must be at least 1, --subscribers, --messages and --rate must not be negative")
+	} else if attachmentRatio < 0 || attachmentRatio > 1 {
+		return errors.New("--attachment-ratio must be between 0 and 1")
+	}
+	duration, err := util.ParseDuration(durationStr)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("invalid duration: %s", durationStr)
+	}
+	messageSize, err := util.ParseSize(messageSizeStr)
+	if err != nil || messageSize < 0 {
+		return fmt.Errorf("invalid message size: %s", messageSizeStr)
+	}
+	attachmentSize, err := util.ParseSize(attachmentSizeStr)
+	if err != nil || attachmentSize < 1 {
+		return fmt.Errorf("invalid attachment size: %s", attachmentSizeStr)
+	}
+
+	// Auth
+	var auth []client.RequestOption
+	if token != "" {
+		auth = append(auth, client.WithBearerAuth(token))
+	} else if user != "" {
+		var pass string
+		parts := strings.SplitN(user, ":", 2)
+		if len(parts) == 2 {
+			user = parts[0]
+			pass = parts[1]
+		} else {
+			fmt.Fprint(c.App.ErrWriter, "Enter Password: ")
+			p, err := util.ReadPassword(c.App.Reader)
+			if err != nil {
+				return err
+			}
+			pass = string(p)
+			fmt.Fprintf(c.App.ErrWriter, "\r%s\r", strings.Repeat(" ", 20))
+		}
+		auth = append(auth, client.WithBasicAuth(user, pass))
+	} else if conf.DefaultToken != "" {
+		auth = append(auth, client.WithBearerAuth(conf.DefaultToken))
+	} else if conf.DefaultUser != "" && conf.DefaultPassword != nil {
+		auth = append(auth, client.WithBasicAuth(conf.DefaultUser, *conf.DefaultPassword))
+	}
+
+	// Run benchmark
+	cl := client.New(conf)
+	topicURL, err := cl.TopicURL(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	topicURLs := []string{topicURL}
+	if topics > 1 {
+		topicURLs = make([]string, topics)
+		for i := range topicURLs {
+			topicURLs[i] = fmt.Sprintf("%s-%d", topicURL, i+1)
+		}
+	}
+	if !jsonOutput {
+		fmt.Fprintf(c.App.ErrWriter, "Benchmarking %s with %d publisher(s) and %d subscriber(s) ...\n", util.ShortTopicURL(topicURL), publishers, subscribers)
+	}
+	report, err := runBench(c.Context, cl, &benchOptions{
+		topicURLs:       topicURLs,
+		publishers:      publishers,
+		subscribers:     subscribers,
+		messages:        messages,
+		duration:        duration,
+		rate:            maxRate,
+		messageSize:     messageSize,
+		attachmentRatio: attachmentRatio,
+		attachmentSize:  attachmentSize,
+		auth:            auth,
+	})
+	if err != nil {
+		return err
+	}
+	report.URL = topicURL
+	if jsonOutput {
+		return json.NewEncoder(c.App.Writer).Encode(report)
+	}
+	printBenchReport(c.App.Writer, report)
+	return nil
+}
+
+// runBench connects all subscribers, then publishes messages until the number of messages has been published
+// or the duration has passed, and finally waits for the subscribers to receive all published messages.
+func runBench(ctx context.Context, cl *client.Client, opts *benchOptions) (*benchReport, error) {
+	stats := &benchStats{errors: make(map[string]int)}
+
+	// Connect subscribers, and wait until they're all connected
+	subscribersPerTopic := make(map[string]int64)
+	subscribeCtx, cancelSubscribers := context.WithCancel(ctx)
+	defer cancelSubscribers()
+	var connected, done sync.WaitGroup
+	for i := 0; i < opts.subscribers; i++ {
+		topicURL := opts.topicURLs[i%len(opts.topicURLs)]
+		subscribersPerTopic[topicURL]++
+		connected.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			benchSubscribe(subscribeCtx, topicURL, opts.auth, stats, connected.Done)
+		}()
+	}
+	allConnected := make(chan struct{})
+	go func() {
+		connected.Wait()
+		close(allConnected)
+	}()
+	select {
+	case <-allConnected:
+	case <-time.After(benchSubscribeTimeout):
+		return nil, fmt.Errorf("subscribers did not connect within %s", benchSubscribeTimeout)
+	}
+
+	// Publish messages
+	publishCtx, cancelPublishers := context.WithTimeout(ctx, opts.duration)
+	defer cancelPublishers()
+	var limiter *rate.Limiter
+	if opts.rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.rate), 1)
+	}
+	message := strings.Repeat("x", int(opts.messageSize))
+	attachment := strings.Repeat("x", int(opts.attachmentSize))
+	var next atomic.Int64
+	var publishers sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < opts.publishers; i++ {
+		publishers.Add(1)
+		go func() {
+			defer publishers.Done()
+			for publishCtx.Err() == nil {
+				n := next.Add(1) - 1
+				if opts.messages > 0 && n >= opts.messages {
+					return
+				} else if limiter != nil && limiter.Wait(publishCtx) != nil {
+					return
+				}
+				topicURL := opts.topicURLs[n%int64(len(opts.topicURLs))]
+				body, options := message, opts.auth
+				if benchWithAttachment(n, opts.attachmentRatio) {
+					body, options = attachment, append(options, client.WithFilename(benchAttachmentName))
+				}
+				benchPublish(cl, topicURL, body, subscribersPerTopic[topicURL], options, stats)
+			}
+		}()
+	}
+	publishers.Wait()
+	elapsed := time.Since(start)
+
+	// Wait for outstanding messages, then disconnect subscribers
+	drainStart := time.Now()
+	for time.Since(drainStart) < benchDrainTimeout && ctx.Err() == nil && !stats.drained() {
+		time.Sleep(benchDrainPollInterval)
+	}
+	cancelSubscribers()
+	done.Wait()
+
+	// Create report
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	report := &benchReport{
+		Publishers:      opts.publishers,
+		Subscribers:     opts.subscribers,
+		Topics:          len(opts.topicURLs),
+		MessageSize:     opts.messageSize,
+		AttachmentRatio: opts.attachmentRatio,
+		Duration:        elapsed.Seconds(),
+		Published:       stats.published,
+		PublishFailed:   stats.publishFailed,
+		PublishedBytes:  stats.publishedBytes,
+		PublishRate:     float64(stats.published) / elapsed.Seconds(),
+		PublishLatency:  newBenchLatency(stats.publishLatencies),
+		Expected:        stats.expected,
+		Received:        util.Min(stats.received, stats.expected),
+		DeliveryLatency: newBenchLatency(stats.deliveryLatencies),
+		Errors:          stats.errors,
+	}
+	if opts.attachmentRatio > 0 {
+		report.AttachmentSize = opts.attachmentSize
+	}
+	return report, nil
+}
+
+// drained returns true if the subscribers have received all published messages
+func (s *benchStats) drained() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received >= s.expected
+}
+
+// benchWithAttachment returns true if the n-th message should be sent with an attachment, so that the
+// given ratio of messages has an attachment, evenly spread across all messages
+func benchWithAttachment(n int64, ratio float64) bool {
+	return math.Floor(float64(n+1)*ratio) > math.Floor(float64(n)*ratio)
+}
+
+// benchPublish publishes a single message, and records its latency or error
+func benchPublish(cl *client.Client, topicURL, body string, subscribers int64, options []client.RequestOption, stats *benchStats) {
+	start := time.Now()
+	options = append(options, client.WithTitle(benchTitlePrefix+strconv.FormatInt(start.UnixNano(), 10)))
+	stats.mu.Lock()
+	stats.expected += subscribers // Before publishing, since subscribers may receive the message before we return
+	stats.mu.Unlock()
+	_, err := cl.PublishReader(topicURL, strings.NewReader(body), options...)
+	latency := time.Since(start)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if err != nil {
+		stats.expected -= subscribers
+		stats.publishFailed++
+		stats.errors["publish: "+benchErrorKey(err)]++
+		return
+	}
+	stats.published++
+	stats.publishedBytes += int64(len(body))
+	stats.publishLatencies = append(stats.publishLatencies, latency)
+}
+
+// benchSubscribe subscribes to the given topic, and records the delivery latency of all benchmark messages until
+// the context is canceled. Unlike the client's Subscribe, it reports when the subscription has been established
+// (via the open event), and does not reconnect.
+func benchSubscribe(ctx context.Context, topicURL string, auth []client.RequestOption, stats *benchStats, connected func()) {
+	var once sync.Once
+	defer once.Do(connected)
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, topicURL+"/json", nil)
+		if err != nil {
+			return err
+		}
+		for _, option := range auth {
+			if err := option(req); err != nil {
+				return err
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return errors.New(strings.TrimSpace(string(b)))
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var m struct {
+				Event string `json:"event"`
+				Title string `json:"title"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+				return err
+			}
+			if m.Event == "open" {
+				once.Do(connected)
+				continue
+			}
+			published, ok := strings.CutPrefix(m.Title, benchTitlePrefix)
+			if m.Event != client.MessageEvent || !ok {
+				continue
+			}
+			publishedNanos, err := strconv.ParseInt(published, 10, 64)
+			if err != nil {
+				continue
+			}
+			latency := time.Since(time.Unix(0, publishedNanos))
+			stats.mu.Lock()
+			stats.received++
+			stats.deliveryLatencies = append(stats.deliveryLatencies, latency)
+			stats.mu.Unlock()
+		}
+		return scanner.Err()
+	}()
+	if err != nil && ctx.Err() == nil {
+		stats.mu.Lock()
+		stats.errors["subscribe: "+benchErrorKey(err)]++
+		stats.mu.Unlock()
+	}
+}
+
+// benchErrorKey returns a short description of an error that is the same for errors of the same kind, so
+// that errors can be counted, e.g. "HTTP 429: limit reached: too many requests" or "connection refused"
+func benchErrorKey(err error) string {
+	var httpErr struct {
+		HTTPCode int    `json:"http"`
+		Error    string `json:"error"`
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	if json.Unmarshal([]byte(err.Error()), &httpErr) == nil && httpErr.HTTPCode > 0 {
+		return fmt.Sprintf("HTTP %d: %s", httpErr.HTTPCode, httpErr.Error)
+	} else if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	} else if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// newBenchLatency calculates the latency distribution of the given latencies, or returns nil if there are none
+func newBenchLatency(latencies []time.Duration) *benchLatency {
+	if len(latencies) == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return float64(sorted[util.Max(i, 0)]) / float64(time.Millisecond)
+	}
+	return &benchLatency{
+		Min: percentile(0),
+		P50: percentile(0.5),
+		P90: percentile(0.9),
+		P99: percentile(0.99),
+		Max: percentile(1),
+	}
+}
+
+// printBenchReport prints the benchmark report in a human-readable format
+func printBenchReport(w io.Writer, r *benchReport) {
+	fmt.Fprintf(w, "Topics:           %d, message size %s", r.Topics, util.FormatSizeHuman(r.MessageSize))
+	if r.AttachmentRatio > 0 {
+		fmt.Fprintf(w, ", %.0f%% with %s attachment", r.AttachmentRatio*100, util.FormatSizeHuman(r.AttachmentSize))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Published:        %d message(s) in %.1fs, %d failed\n", r.Published, r.Duration, r.PublishFailed)
+	fmt.Fprintf(w, "Throughput:       %.1f messages/s, %s/s\n", r.PublishRate, util.FormatSizeHuman(int64(float64(r.PublishedBytes)/r.Duration)))
+	if r.PublishLatency != nil {
+		fmt.Fprintf(w, "Publish latency:  %s\n", r.PublishLatency)
+	}
+	if r.Subscribers > 0 {
+		percent := 100.0
+		if r.Expected > 0 {
+			percent = float64(r.Received) * 100 / float64(r.Expected)
+		}
+		fmt.Fprintf(w, "Received:         %d of %d message(s) (%.1f%%)\n", r.Received, r.Expected, percent)
+		if r.DeliveryLatency != nil {
+			fmt.Fprintf(w, "Delivery latency: %s\n", r.DeliveryLatency)
+		}
+	}
+	if len(r.Errors) > 0 {
+		keys := make([]string, 0, len(r.Errors))
+		for key := range r.Errors {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return r.Errors[keys[i]] > r.Errors[keys[j]] || (r.Errors[keys[i]] == r.Errors[keys[j]] && keys[i] < keys[j])
+		})
+		fmt.Fprintln(w, "Errors:")
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %6dx %s\n", r.Errors[key], key)
+		}
+	}
+}
+
+// String returns the latency distribution in a human-readable format
+func (l *benchLatency) String() string {
+	return fmt.Sprintf("min %.1fms, p50 %.1fms, p90 %.1fms, p99 %.1fms, max %.1fms", l.Min, l.P50, l.P90, l.P99, l.Max)
+}
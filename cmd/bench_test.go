@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"strings"
+	"testing"
+)
+
+func TestCLI_Bench(t *testing.T) {
+	conf := server.NewConfig()
+	conf.BaseURL = "http://127.0.0.1"
+	conf.VisitorRequestLimitBurst = 1000
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	topic := fmt.Sprintf("http://127.0.0.1:%d/bench", port)
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "bench", "--json", "-n", "20", "-P", "4", "-S", "3", "-t", "2", "--attachment-ratio", "0.25", topic}))
+	var report benchReport
+	require.Nil(t, json.Unmarshal([]byte(stdout.String()), &report))
+	require.Equal(t, topic, report.URL)
+	require.Equal(t, int64(20), report.Published)
+	require.Equal(t, int64(0), report.PublishFailed)
+	require.Equal(t, int64(15*100+5*10*1024), report.PublishedBytes) // 15 messages, 5 attachments
+	require.Equal(t, int64(20*3/2), report.Expected)                 // bench-1 has 2 subscribers, bench-2 has 1
+	require.Equal(t, report.Expected, report.Received)
+	require.NotNil(t, report.PublishLatency)
+	require.NotNil(t, report.DeliveryLatency)
+	require.Empty(t, report.Errors)
+}
+
+func TestCLI_Bench_Errors(t *testing.T) {
+	conf := server.NewConfig()
+	conf.VisitorRequestLimitBurst = 5
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	topic := fmt.Sprintf("http://127.0.0.1:%d/bench", port)
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "bench", "-n", "10", "-P", "1", "-S", "0", topic}))
+	output := stdout.String()
+	require.Contains(t, output, "message(s) in")
+	require.Contains(t, output, "Errors:")
+	require.Contains(t, output, "x publish: HTTP 429: limit reached: too many requests")
+	require.False(t, strings.Contains(output, "Received:"))
+}
+
+func TestBenchWithAttachment(t *testing.T) {
+	count := 0
+	for n := int64(0); n < 100; n++ {
+		if benchWithAttachment(n, 0.1) {
+			count++
+		}
+	}
+	require.Equal(t, 10, count)
+	require.False(t, benchWithAttachment(0, 0))
+	require.True(t, benchWithAttachment(0, 1))
+}
@@ -9,6 +9,23 @@ import (
 	"os"
 )
 
+// credentialFlags are the options whose values (or list entries) may be references to secrets, e.g.
+// file:///run/secrets/... or env://..., which are resolved when the config file is loaded. See util.ResolveSecret.
+var credentialFlags = []string{
+	"auth-users",
+	"auth-tokens",
+	"upstream-access-token",
+	"smtp-sender-user",
+	"smtp-sender-pass",
+	"email-providers",
+	"twilio-auth-token",
+	"hmac-topics",
+	"outbound-webhooks",
+	"stripe-secret-key",
+	"stripe-webhook-key",
+	"web-push-private-key",
+}
+
 // initConfigFileInputSourceFunc is like altsrc.InitInputSourceWithContext and altsrc.NewYamlSourceFromFlagFunc, but checks
 // if the config flag is exists and only loads it if it does. If the flag is set and the file exists, it fails.
 //
@@ -46,7 +63,8 @@ func initConfigFileInputSourceFunc(configFlag string, flags []cli.Flag, next cli
 // newYamlSourceFromFile creates a new Yaml InputSourceContext from a filepath.
 //
 // This function also maps aliases, so a .yml file can contain short options, or options with underscores
-// instead of dashes. See https://github.com/binwiederhier/ntfy/issues/255.
+// instead of dashes. See https://github.com/binwiederhier/ntfy/issues/255. References to secrets in credential
+// options are resolved, see credentialFlags.
 //
 // Parameters:
 //   - file: The path to the YAML configuration file.
@@ -71,5 +89,34 @@ func newYamlSourceFromFile(file string, flags []cli.Flag) (altsrc.InputSourceCon
 			}
 		}
 	}
+	for _, flagName := range credentialFlags {
+		if err := resolveSecretValue(rawConfig, flagName); err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", flagName, file, err)
+		}
+	}
 	return altsrc.NewMapInputSource(file, rawConfig), nil
 }
+
+// resolveSecretValue resolves the secret references in the value of the given option, which is either a string or
+// a list of strings. Other values are left untouched.
+func resolveSecretValue(rawConfig map[any]any, flagName string) error {
+	switch value := rawConfig[flagName].(type) {
+	case string:
+		secret, err := util.ResolveSecret(value)
+		if err != nil {
+			return err
+		}
+		rawConfig[flagName] = secret
+	case []any:
+		for i, entry := range value {
+			if s, ok := entry.(string); ok {
+				secret, err := util.ResolveSecret(s)
+				if err != nil {
+					return err
+				}
+				value[i] = secret
+			}
+		}
+	}
+	return nil
+}
@@ -36,3 +36,46 @@ K: /some/file.pem
 	require.Nil(t, err)
 	require.Equal(t, "/some/file.pem", keyFile)
 }
+
+func TestNewYamlSourceFromFile_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "smtp_pass"), []byte("smtp-s3cr3t\n"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "admin_token"), []byte("tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2"), 0600))
+	t.Setenv("TEST_NTFY_STRIPE_KEY", "sk_test_1234")
+	filename := filepath.Join(dir, "server.yml")
+	contents := `
+smtp-sender-pass: file://` + filepath.Join(dir, "smtp_pass") + `
+stripe_secret_key: env://TEST_NTFY_STRIPE_KEY
+auth-tokens:
+  - "phil:file://` + filepath.Join(dir, "admin_token") + `"
+  - file://` + filepath.Join(dir, "admin_token") + `
+base-url: file://not-a-credential
+`
+	require.Nil(t, os.WriteFile(filename, []byte(contents), 0600))
+
+	ctx, err := newYamlSourceFromFile(filename, flagsServe)
+	require.Nil(t, err)
+
+	smtpSenderPass, err := ctx.String("smtp-sender-pass")
+	require.Nil(t, err)
+	require.Equal(t, "smtp-s3cr3t", smtpSenderPass)
+
+	stripeSecretKey, err := ctx.String("stripe-secret-key") // Alias!
+	require.Nil(t, err)
+	require.Equal(t, "sk_test_1234", stripeSecretKey)
+
+	authTokens, err := ctx.StringSlice("auth-tokens")
+	require.Nil(t, err)
+	require.Equal(t, []string{"phil:file://" + filepath.Join(dir, "admin_token"), "tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2"}, authTokens) // Only entire values are resolved
+
+	baseURL, err := ctx.String("base-url")
+	require.Nil(t, err)
+	require.Equal(t, "file://not-a-credential", baseURL)
+}
+
+func TestNewYamlSourceFromFile_SecretsMissing(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "server.yml")
+	require.Nil(t, os.WriteFile(filename, []byte("twilio-auth-token: env://TEST_NTFY_NOT_SET\n"), 0600))
+	_, err := newYamlSourceFromFile(filename, flagsServe)
+	require.ErrorContains(t, err, "invalid twilio-auth-token")
+}
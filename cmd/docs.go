@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	docsManSection  = 1
+	docsManDir      = "man"
+	docsExamplesDir = "examples"
+)
+
+var (
+	docsExamplesRegex = regexp.MustCompile(`^\s*Examples:\s*$`)
+	docsCommentRegex  = regexp.MustCompile(`^(.+?)\s{2,}#\s*(.+)$`)
+)
+
+func init() {
+	commands = append(commands, cmdGenerateDocs)
+}
+
+var flagsGenerateDocs = append(
+	append([]cli.Flag{}, flagsDefault...),
+	&cli.StringFlag{Name: "output-dir", Aliases: []string{"o"}, Value: "build/cli-docs", Usage: "directory to write man pages and examples to"},
+)
+
+var cmdGenerateDocs = &cli.Command{
+	Name:      "generate-docs",
+	Usage:     "Generate man pages and shell examples from the CLI commands",
+	UsageText: "ntfy generate-docs [--output-dir=DIR]",
+	Action:    execGenerateDocs,
+	Flags:     flagsGenerateDocs,
+	Before:    initLogFunc,
+	Hidden:    true,
+	Description: `Generate man pages and shell examples for all commands, so that the documentation
+is always in sync with the commands and their flags. This command is used at build time.
+
+The following files are written to the output directory:
+  man/ntfy.1                 Overview of all commands and their flags
+  man/ntfy-COMMAND.1         Man page of a command and its subcommands
+  examples/ntfy-COMMAND.sh   Examples of a command and its subcommands (if any)
+
+Examples are taken from the "Examples:" section of the command descriptions.
+
+Examples:
+  ntfy generate-docs                        # Write to build/cli-docs
+  ntfy generate-docs -o /usr/share/ntfy     # Write to /usr/share/ntfy`,
+}
+
+// execGenerateDocs writes the man pages and example snippets of all visible commands to the output directory.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if a man page cannot be rendered, or if a file cannot be written.
+func execGenerateDocs(c *cli.Context) error {
+	dir := c.String("output-dir")
+	for _, subdir := range []string{docsManDir, docsExamplesDir} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+			return err
+		}
+	}
+	man, err := c.App.ToManWithSection(docsManSection)
+	if err != nil {
+		return err
+	}
+	if err := writeDocsFile(c, filepath.Join(dir, docsManDir, fmt.Sprintf("%s.%d", c.App.Name, docsManSection)), man); err != nil {
+		return err
+	}
+	for _, command := range c.App.VisibleCommands() {
+		if command.Name == "help" {
+			continue
+		}
+		name := fmt.Sprintf("%s-%s", c.App.Name, command.Name)
+		man, err := commandManPage(name, command)
+		if err != nil {
+			return err
+		}
+		if err := writeDocsFile(c, filepath.Join(dir, docsManDir, fmt.Sprintf("%s.%d", name, docsManSection)), man); err != nil {
+			return err
+		}
+		if examples := commandExamples(c.App.Name, command); examples != "" {
+			if err := writeDocsFile(c, filepath.Join(dir, docsExamplesDir, name+".sh"), examples); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// commandManPage renders the man page of a command, including its subcommands. The description is rendered
+// as preformatted text, since it is formatted for the terminal, not as Markdown.
+func commandManPage(name string, command *cli.Command) (string, error) {
+	app := &cli.App{
+		Name:        name,
+		Usage:       command.Usage,
+		UsageText:   command.UsageText,
+		Description: preformatted(command.Description),
+		Flags:       command.Flags,
+		Commands:    command.Subcommands,
+	}
+	return app.ToManWithSection(docsManSection)
+}
+
+// commandExamples returns a shell snippet with the examples of a command and its subcommands, or an empty string
+// if there are none. Trailing comments are moved to the line above the example, and duplicate examples are removed.
+func commandExamples(appName string, command *cli.Command) string {
+	var lines []string
+	seen := make(map[string]bool)
+	for _, example := range descriptionExamples(command) {
+		line, comment := example, ""
+		if m := docsCommentRegex.FindStringSubmatch(example); m != nil {
+			line, comment = m[1], strings.TrimSpace(m[2])
+		}
+		if seen[line] {
+			continue
+		}
+		seen[line] = true
+		lines = append(lines, "")
+		if comment != "" {
+			lines = append(lines, "# "+comment)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	header := []string{
+		"#!/bin/sh",
+		fmt.Sprintf("# %s %s: %s", appName, command.Name, command.Usage),
+		fmt.Sprintf("# Generated by '%s generate-docs', do not edit.", appName),
+	}
+	return strings.Join(append(header, lines...), "\n") + "\n"
+}
+
+// descriptionExamples returns the example lines from the "Examples:" sections of the description of a command
+// and its subcommands. A section ends at the first empty line.
+func descriptionExamples(command *cli.Command) []string {
+	var examples []string
+	inExamples := false
+	for _, line := range strings.Split(command.Description, "\n") {
+		if docsExamplesRegex.MatchString(line) {
+			inExamples = true
+		} else if strings.TrimSpace(line) == "" {
+			inExamples = false
+		} else if inExamples {
+			examples = append(examples, strings.TrimSpace(line))
+		}
+	}
+	for _, subcommand := range command.Subcommands {
+		if !subcommand.Hidden {
+			examples = append(examples, descriptionExamples(subcommand)...)
+		}
+	}
+	return examples
+}
+
+func preformatted(s string) string {
+	if s == "" {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "    " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func writeDocsFile(c *cli.Context, filename, content string) error {
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.ErrWriter, "Wrote %s\n", filename)
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestCLI_GenerateDocs(t *testing.T) {
+	dir := t.TempDir()
+	app, _, _, stderr := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "generate-docs", "--output-dir", dir}))
+	require.Contains(t, stderr.String(), filepath.Join(dir, "man", "ntfy-publish.1"))
+
+	// Man pages are generated for all visible commands, and contain their flags
+	man, err := os.ReadFile(filepath.Join(dir, "man", "ntfy-publish.1"))
+	require.Nil(t, err)
+	require.Contains(t, string(man), ".TH ntfy-publish 1")
+	require.Contains(t, string(man), "--priority")
+	require.FileExists(t, filepath.Join(dir, "man", "ntfy.1"))
+	require.NoFileExists(t, filepath.Join(dir, "man", "ntfy-generate-docs.1"))
+	require.NoFileExists(t, filepath.Join(dir, "man", "ntfy-help.1"))
+
+	// Examples are taken from the descriptions, with the comment above the example
+	examples, err := os.ReadFile(filepath.Join(dir, "examples", "ntfy-publish.sh"))
+	require.Nil(t, err)
+	require.Contains(t, string(examples), "# Send simple message\nntfy publish mytopic This is my message\n")
+	require.NoFileExists(t, filepath.Join(dir, "examples", "ntfy-webpush.sh"))
+}
+
+func TestCLI_GenerateDocs_Hidden(t *testing.T) {
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "--help"}))
+	require.NotContains(t, stdout.String(), "generate-docs")
+}
+
+func TestCommandExamples(t *testing.T) {
+	command := &cli.Command{
+		Name:  "tier",
+		Usage: "Manage tiers",
+		Description: `Manage tiers.
+
+Examples:
+  ntfy tier add pro                  # Add tier "pro"
+  ntfy tier list
+
+This is not an example`,
+		Subcommands: []*cli.Command{
+			{Name: "add", Description: "Examples:\n  ntfy tier add pro    # Add tier with code \"pro\"\n  ntfy tier add --name=Pro pro"},
+			{Name: "secret", Hidden: true, Description: "Examples:\n  ntfy tier secret"},
+		},
+	}
+	require.Equal(t, `#!/bin/sh
+# ntfy tier: Manage tiers
+# Generated by 'ntfy generate-docs', do not edit.
+
+# Add tier "pro"
+ntfy tier add pro
+
+ntfy tier list
+
+ntfy tier add --name=Pro pro
+`, commandExamples("ntfy", command))
+	require.Equal(t, "", commandExamples("ntfy", &cli.Command{Name: "help"}))
+}
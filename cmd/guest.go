@@ -0,0 +1,219 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+	"time"
+)
+
+func init() {
+	commands = append(commands, cmdGuest)
+}
+
+var flagsGuest = append([]cli.Flag{}, flagsUser...)
+
+var cmdGuest = &cli.Command{
+	Name:      "guest",
+	Usage:     "Create, list or delete topic-scoped guest tokens",
+	UsageText: "ntfy guest [list|add|remove] ...",
+	Flags:     flagsGuest,
+	Before:    initConfigFileInputSourceFunc("config", flagsGuest, initLogFunc),
+	Category:  categoryServer,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "add",
+			Aliases:   []string{"a"},
+			Usage:     "Create a new guest token",
+			UsageText: "ntfy guest add [--access=..] [--messages-limit=..] [--expires=<duration>] [--label=..] [--owner=USERNAME] TOPIC",
+			Action:    execGuestAdd,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "access", Aliases: []string{"a"}, Value: "write-only", Usage: "access granted to the topic (read-write, read-only or write-only)"},
+				&cli.Int64Flag{Name: "messages-limit", Aliases: []string{"m"}, Value: user.DefaultGuestTokenMessageLimit, Usage: "number of messages the guest can publish per day"},
+				&cli.StringFlag{Name: "expires", Aliases: []string{"e"}, Value: "", Usage: "guest token expires after"},
+				&cli.StringFlag{Name: "label", Aliases: []string{"l"}, Value: "", Usage: "guest token label"},
+				&cli.StringFlag{Name: "owner", Aliases: []string{"o"}, Value: "", Usage: "user who reserved the topic; the guest token is removed along with the reservation"},
+			},
+			Description: `Create a new guest token for a single topic.
+
+Guest tokens allow devices to publish to (or subscribe to) exactly one topic without a user
+account. They have their own, very low rate limits: by default, a guest can publish 100 messages
+per day, and cannot send emails, make phone calls or upload attachments.
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Examples:
+  ntfy guest add sensors                      # Create write-only guest token for topic "sensors"
+  ntfy guest add --expires=30d sensors        # Create guest token which expires in 30 days
+  ntfy guest add -m 10 -l thermostat sensors  # Allow 10 messages per day, label "thermostat"
+  ntfy guest add --access=read-only alerts    # Create guest token that can only subscribe
+  ntfy guest add --owner=phil sensors         # Tie guest token to phil's reservation of "sensors"`,
+		},
+		{
+			Name:      "remove",
+			Aliases:   []string{"del", "rm"},
+			Usage:     "Removes a guest token",
+			UsageText: "ntfy guest remove TOKEN",
+			Action:    execGuestDel,
+			Description: `Remove a guest token from the ntfy user database.
+
+Example:
+  ntfy guest del gt_b5tzoqy5ynfxlpbo9zuh3fe1xwzhe`,
+		},
+		{
+			Name:      "list",
+			Aliases:   []string{"l"},
+			Usage:     "Shows a list of guest tokens",
+			UsageText: "ntfy guest list [USERNAME]",
+			Action:    execGuestList,
+			Description: `Shows a list of all guest tokens, or of all guest tokens created by the given user.
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.`,
+		},
+	},
+	Description: `Manage topic-scoped guest tokens.
+
+Guest tokens allow devices to publish to (or subscribe to) exactly one topic without a user
+account. They have their own, very low rate limits, and can optionally expire. Users can also
+create guest tokens for their own reserved topics via the API.
+
+This is a server-only command. It directly manages the user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Examples:
+  ntfy guest list                         # Shows list of all guest tokens
+  ntfy guest list phil                    # Shows list of guest tokens created by user phil
+  ntfy guest add sensors                  # Create write-only guest token for topic "sensors"
+  ntfy guest add --expires=30d sensors    # Create guest token which expires in 30 days
+  ntfy guest remove gt_b5tzoqy5ynf...     # Delete guest token`,
+}
+
+// execGuestAdd creates a new guest token for a topic.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if the arguments are invalid, or the guest token creation fails.
+func execGuestAdd(c *cli.Context) error {
+	topic := c.Args().Get(0)
+	owner := c.String("owner")
+	messagesLimit := c.Int64("messages-limit")
+	if topic == "" {
+		return errors.New("topic expected, type 'ntfy guest add --help' for help")
+	} else if !user.AllowedTopic(topic) {
+		return errors.New("topic name not allowed")
+	} else if owner == userEveryone || owner == user.Everyone {
+		return errors.New("owner not allowed")
+	} else if messagesLimit <= 0 {
+		return errors.New("messages limit must be positive")
+	}
+	permission, err := user.ParsePermission(c.String("access"))
+	if err != nil || permission == user.PermissionDenyAll {
+		return errors.New("access must be read-write, read-only or write-only")
+	}
+	var expires time.Time
+	if c.String("expires") != "" {
+		expires, err = util.ParseFutureTime(c.String("expires"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	guest, err := manager.CreateGuestToken(owner, topic, permission, c.String("label"), messagesLimit, expires)
+	if errors.Is(err, user.ErrUnauthorized) {
+		return fmt.Errorf("user %s does not exist or has not reserved topic %s", owner, topic)
+	} else if err != nil {
+		return err
+	}
+	if expires.IsZero() {
+		fmt.Fprintf(c.App.Writer, "guest token %s created for topic %s (%s), never expires\n", guest.Token, topic, permission.String())
+	} else {
+		fmt.Fprintf(c.App.Writer, "guest token %s created for topic %s (%s), expires %v\n", guest.Token, topic, permission.String(), expires.Format(time.UnixDate))
+	}
+	return nil
+}
+
+// execGuestDel removes an existing guest token.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if the guest token does not exist, or deletion fails.
+func execGuestDel(c *cli.Context) error {
+	token := c.Args().Get(0)
+	if token == "" {
+		return errors.New("guest token expected, type 'ntfy guest remove --help' for help")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.RemoveGuestToken("", token); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "guest token %s removed\n", token)
+	return nil
+}
+
+// execGuestList lists all guest tokens, or the guest tokens created by a specific user.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if listing guest tokens fails.
+func execGuestList(c *cli.Context) error {
+	username := c.Args().Get(0)
+	if username == userEveryone || username == user.Everyone {
+		return errors.New("username not allowed")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	var guests []*user.GuestToken
+	if username != "" {
+		if _, err := manager.User(username); errors.Is(err, user.ErrUserNotFound) {
+			return fmt.Errorf("user %s does not exist", username)
+		} else if err != nil {
+			return err
+		}
+		guests, err = manager.GuestTokens(username)
+	} else {
+		guests, err = manager.AllGuestTokens()
+	}
+	if err != nil {
+		return err
+	}
+	if len(guests) == 0 {
+		fmt.Fprintf(c.App.Writer, "no guest tokens\n")
+		return nil
+	}
+	for _, g := range guests {
+		var label, owner, expires string
+		if g.Label != "" {
+			label = fmt.Sprintf(" (%s)", g.Label)
+		}
+		if g.Owner != "" {
+			owner = fmt.Sprintf(", owned by %s", g.Owner)
+		}
+		if g.Expires.IsZero() {
+			expires = "never expires"
+		} else {
+			expires = fmt.Sprintf("expires %s", g.Expires.Format(time.RFC822))
+		}
+		fmt.Fprintf(c.App.Writer, "- %s%s, %s access to topic %s, %d messages per day, %s%s\n", g.Token, label, g.Permission.String(), g.Topic, g.MessageLimit, expires, owner)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"regexp"
+	"testing"
+)
+
+func TestCLI_Guest_AddListRemove(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, runGuestCommand(app, conf, "add", "--label", "thermostat", "--messages-limit", "10", "sensors"))
+	require.Regexp(t, `guest token gt_\w+ created for topic sensors \(write-only\), never expires`, stdout.String())
+	token := regexp.MustCompile(`gt_\w+`).FindString(stdout.String())
+
+	app, _, _, _ = newTestApp()
+	require.Error(t, runGuestCommand(app, conf, "add", "--owner", "phil", "sensors")) // phil does not own "sensors"
+	app, _, _, _ = newTestApp()
+	require.Error(t, runGuestCommand(app, conf, "add", "--access", "deny-all", "sensors"))
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runGuestCommand(app, conf, "list"))
+	require.Equal(t, fmt.Sprintf("- %s (thermostat), write-only access to topic sensors, 10 messages per day, never expires\n", token), stdout.String())
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runGuestCommand(app, conf, "remove", token))
+	require.Equal(t, fmt.Sprintf("guest token %s removed\n", token), stdout.String())
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runGuestCommand(app, conf, "list"))
+	require.Equal(t, "no guest tokens\n", stdout.String())
+}
+
+func runGuestCommand(app *cli.App, conf *server.Config, args ...string) error {
+	userArgs := []string{
+		"ntfy",
+		"--log-level=ERROR",
+		"guest",
+		"--config=" + conf.File, // Dummy config file to avoid lookups of real file
+		"--auth-file=" + conf.AuthFile,
+	}
+	return app.Run(append(userArgs, args...))
+}
@@ -0,0 +1,175 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/util"
+)
+
+const (
+	healthcheckPath           = "/v1/health"
+	healthcheckDefaultTimeout = "5s"
+)
+
+func init() {
+	commands = append(commands, cmdHealthcheck)
+}
+
+var flagsHealthcheck = append(
+	append([]cli.Flag{}, flagsDefault...),
+	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG_FILE"}, Value: server.DefaultConfigFile, DefaultText: server.DefaultConfigFile, Usage: "config file"},
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "listen-http", Aliases: []string{"listen_http", "l"}, EnvVars: []string{"NTFY_LISTEN_HTTP"}, Value: server.DefaultListenHTTP, Usage: "ip:port used as HTTP listen address"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "listen-https", Aliases: []string{"listen_https", "L"}, EnvVars: []string{"NTFY_LISTEN_HTTPS"}, Usage: "ip:port used as HTTPS listen address"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "listen-unix", Aliases: []string{"listen_unix", "U"}, EnvVars: []string{"NTFY_LISTEN_UNIX"}, Usage: "listen on unix socket path"}),
+	&cli.StringFlag{Name: "url", Aliases: []string{"u"}, EnvVars: []string{"NTFY_HEALTHCHECK_URL"}, Usage: "probe this health endpoint URL instead of the local listen address, e.g. http://localhost:8080/v1/health"},
+	&cli.StringFlag{Name: "timeout", Aliases: []string{"t"}, EnvVars: []string{"NTFY_HEALTHCHECK_TIMEOUT"}, Value: healthcheckDefaultTimeout, Usage: "fail if the server does not respond within this duration"},
+)
+
+var cmdHealthcheck = &cli.Command{
+	Name:      "healthcheck",
+	Usage:     "Check if the local ntfy server is healthy",
+	UsageText: "ntfy healthcheck [OPTIONS..]",
+	Action:    execHealthcheck,
+	Category:  categoryServer,
+	Flags:     flagsHealthcheck,
+	Before:    initConfigFileInputSourceFunc("config", flagsHealthcheck, initLogFunc),
+	Description: `Probe the health endpoint (/v1/health) of the local ntfy server, and exit with
+status 0 if the server is healthy, or 1 otherwise. This is meant to be used for Docker
+or Kubernetes health checks, so that curl or wget are not needed in the image.
+
+The server address is read from the same config file, environment variables and flags
+as "ntfy serve": the unix socket (listen-unix) is probed if set, otherwise the HTTP
+address (listen-http), otherwise the HTTPS address (listen-https). Wildcard addresses
+such as ":80" or "0.0.0.0:80" are probed via localhost. For HTTPS, the certificate is
+not verified, since it is typically not issued for localhost.
+
+Examples:
+  ntfy healthcheck                                 # Probe the server configured in /etc/ntfy/server.yml
+  ntfy healthcheck --listen-http=:8080             # Probe http://127.0.0.1:8080/v1/health
+  ntfy healthcheck --url=https://ntfy.example.com  # Probe https://ntfy.example.com/v1/health
+
+Docker Compose example:
+  healthcheck:
+    test: ["CMD", "ntfy", "healthcheck"]
+    interval: 60s
+    timeout: 10s
+`,
+}
+
+// execHealthcheck probes the health endpoint of the local server, and returns an error if it is
+// not reachable or reports that it is unhealthy. Returning an error makes ntfy exit with status 1.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if the server is not healthy.
+func execHealthcheck(c *cli.Context) error {
+	timeout, err := util.ParseDuration(c.String("timeout"))
+	if err != nil {
+		return fmt.Errorf("invalid timeout: %w", err)
+	}
+	rawURL, httpClient, err := healthcheckClient(c.String("url"), c.String("listen-http"), c.String("listen-https"), c.String("listen-unix"))
+	if err != nil {
+		return err
+	}
+	httpClient.Timeout = timeout
+	resp, err := httpClient.Get(rawURL)
+	if err != nil {
+		return fmt.Errorf("server is unhealthy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server is unhealthy: %s returned HTTP %d", rawURL, resp.StatusCode)
+	}
+	var health struct {
+		Healthy bool `json:"healthy"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return fmt.Errorf("server is unhealthy: invalid response from %s: %w", rawURL, err)
+	} else if !health.Healthy {
+		return fmt.Errorf("server is unhealthy: %s reported healthy=false", rawURL)
+	}
+	fmt.Fprintf(c.App.Writer, "Server is healthy (%s)\n", rawURL)
+	return nil
+}
+
+// healthcheckClient determines the health endpoint URL to probe, and an HTTP client to probe it with.
+//
+// Parameters:
+//   - rawURL: The URL or base URL passed via --url, if any. Takes precedence over the listen addresses.
+//   - listenHTTP: The HTTP listen address of the server, e.g. ":80".
+//   - listenHTTPS: The HTTPS listen address of the server, e.g. ":443".
+//   - listenUnix: The unix socket path of the server, e.g. "/var/run/ntfy.sock".
+//
+// Returns:
+//   - The health endpoint URL, e.g. "http://127.0.0.1:80/v1/health".
+//   - An HTTP client that connects to the server, e.g. via the unix socket.
+//   - An error if no address is configured, or an address is invalid.
+func healthcheckClient(rawURL, listenHTTP, listenHTTPS, listenUnix string) (string, *http.Client, error) {
+	if rawURL != "" {
+		return healthcheckURL(rawURL), &http.Client{}, nil
+	} else if listenUnix != "" {
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", listenUnix)
+			},
+		}
+		return "http://localhost" + healthcheckPath, &http.Client{Transport: transport}, nil
+	} else if listenHTTP != "" {
+		addr, err := healthcheckLocalAddr(listenHTTP)
+		if err != nil {
+			return "", nil, err
+		}
+		return "http://" + addr + healthcheckPath, &http.Client{}, nil
+	} else if listenHTTPS != "" {
+		addr, err := healthcheckLocalAddr(listenHTTPS)
+		if err != nil {
+			return "", nil, err
+		}
+		transport := &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // Certificate is not issued for localhost
+		}
+		return "https://" + addr + healthcheckPath, &http.Client{Transport: transport}, nil
+	}
+	return "", nil, errors.New("no listen address configured, set listen-http, listen-https, listen-unix or --url")
+}
+
+// healthcheckURL appends the health endpoint path to rawURL, unless it already contains a path
+func healthcheckURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Path != "" && u.Path != "/") {
+		return rawURL
+	}
+	u.Path = healthcheckPath
+	return u.String()
+}
+
+// healthcheckLocalAddr converts a listen address to an address that can be connected to locally, e.g.
+// ":80" to "127.0.0.1:80", or "[::]:80" to "[::1]:80". Specific addresses are returned as is.
+func healthcheckLocalAddr(listen string) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %s: %w", listen, err)
+	}
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
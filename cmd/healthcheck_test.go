@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCLI_Healthcheck_HTTP(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "healthcheck", fmt.Sprintf("--listen-http=:%d", port)}))
+	require.Equal(t, fmt.Sprintf("Server is healthy (http://127.0.0.1:%d/v1/health)\n", port), stdout.String())
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "healthcheck", "--url", fmt.Sprintf("http://localhost:%d", port)}))
+	require.Contains(t, stdout.String(), fmt.Sprintf("http://localhost:%d/v1/health", port))
+}
+
+func TestCLI_Healthcheck_ConfigFile_Unix(t *testing.T) {
+	conf := server.NewConfig()
+	conf.ListenUnix = filepath.Join(t.TempDir(), "ntfy.sock")
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+
+	configFile := filepath.Join(t.TempDir(), "server.yml")
+	require.Nil(t, os.WriteFile(configFile, []byte("listen-http: \":1\"\nlisten-unix: "+conf.ListenUnix+"\n"), 0600))
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "healthcheck", "--config", configFile}))
+	require.Equal(t, "Server is healthy (http://localhost/v1/health)\n", stdout.String())
+}
+
+func TestCLI_Healthcheck_Unhealthy(t *testing.T) {
+	s, port := test.StartServer(t)
+	test.StopServer(t, s, port)
+
+	app, _, stdout, _ := newTestApp()
+	err := app.Run([]string{"ntfy", "healthcheck", "--timeout=1s", fmt.Sprintf("--listen-http=127.0.0.1:%d", port)})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "server is unhealthy")
+	require.Empty(t, stdout.String())
+
+	app, _, _, _ = newTestApp()
+	require.Error(t, app.Run([]string{"ntfy", "healthcheck", "--listen-http="}))
+}
+
+func TestHealthcheckLocalAddr(t *testing.T) {
+	for listen, expected := range map[string]string{
+		":80":           "127.0.0.1:80",
+		"0.0.0.0:8080":  "127.0.0.1:8080",
+		"[::]:443":      "[::1]:443",
+		"10.0.1.1:2586": "10.0.1.1:2586",
+	} {
+		addr, err := healthcheckLocalAddr(listen)
+		require.Nil(t, err)
+		require.Equal(t, expected, addr)
+	}
+	_, err := healthcheckLocalAddr("80")
+	require.Error(t, err)
+}
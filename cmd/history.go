@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/util"
+)
+
+func init() {
+	commands = append(commands, cmdHistory)
+}
+
+const (
+	historyFormatTable = "table"
+	historyFormatJSON  = "json"
+	historyFormatCSV   = "csv"
+
+	historyMessageMaxLength = 60 // Max length of the message column in table format
+)
+
+var (
+	historyFilterRegex = regexp.MustCompile(`(?i)^\s*([a-z]+)\s*(>=|<=|!=|=|>|<|~)\s*(.*?)\s*$`)
+)
+
+var flagsHistory = append(
+	append(append([]cli.Flag{}, flagsDefault...), flagsTLS...),
+	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG"}, Usage: "client config file"},
+	&cli.StringFlag{Name: "since", Aliases: []string{"s"}, Value: "all", Usage: "show messages since `SINCE` (duration, e.g. 24h, Unix timestamp, message ID, or all)"},
+	&cli.StringSliceFlag{Name: "filter", Aliases: []string{"f"}, Usage: "only show messages matching `FILTER`, e.g. priority>=4, tags=warning or title~backup (can be repeated)"},
+	&cli.StringFlag{Name: "format", Aliases: []string{"o"}, Value: historyFormatTable, Usage: "output format: table, json or csv"},
+	&cli.StringFlag{Name: "user", Aliases: []string{"u"}, EnvVars: []string{"NTFY_USER"}, Usage: "username[:password] used to auth against the server"},
+	&cli.StringFlag{Name: "token", Aliases: []string{"k"}, EnvVars: []string{"NTFY_TOKEN"}, Usage: "access token used to auth against the server"},
+)
+
+var cmdHistory = &cli.Command{
+	Name:      "history",
+	Usage:     "Show the cached messages of one or more topics",
+	UsageText: "ntfy history [OPTIONS..] TOPIC...",
+	Action:    execHistory,
+	Category:  categoryClient,
+	Flags:     flagsHistory,
+	Before:    initLogFunc,
+	Description: `Show the messages of one or more topics that are still in the server's message cache,
+like the message log of the web app. Messages of multiple topics are merged and sorted by time.
+
+Messages can be narrowed down with one or more --filter expressions, which are applied locally.
+A filter has the form FIELD OPERATOR VALUE, and all filters must match:
+
+  Field              Operators            Example
+  ------------------ -------------------- ------------------------------------
+  priority, prio     = != > >= < <=       priority>=4, prio=high
+  tags, tag          = != ~               tags=warning, tag!=test, tags~disk
+  title, message     = != ~               title~backup, message!=ok
+  topic              = != ~               topic=alerts
+
+The ~ operator matches if the field contains the value (case-insensitive). Messages without
+priority are treated as priority 3 (default).
+
+The output format can be a table (default), JSON (one message per line, like 'ntfy subscribe'),
+or CSV, e.g. to import the messages into a spreadsheet.
+
+Examples:
+  ntfy history mytopic                                  # Show all cached messages of ntfy.sh/mytopic
+  ntfy history --since 24h --filter priority>=4 alerts  # Show important messages of the last day
+  ntfy history -f tags=warning -f 'title~disk' alerts   # Combine filters
+  ntfy history -o csv alerts backups > messages.csv     # Export messages of two topics as CSV
+` + clientCommandDescriptionSuffix,
+}
+
+// historyFilter is a single --filter expression, e.g. priority>=4
+type historyFilter struct {
+	field    string
+	operator string
+	value    string
+	priority int // Parsed value, if field is "priority"
+}
+
+func execHistory(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() == 0 {
+		return errors.New("must specify at least one topic, type 'ntfy history --help' for help")
+	} else if c.String("user") != "" && c.String("token") != "" {
+		return errors.New("cannot set both --user and --token")
+	}
+	format := c.String("format")
+	if format != historyFormatTable && format != historyFormatJSON && format != historyFormatCSV {
+		return fmt.Errorf("invalid format %q, must be table, json or csv", format)
+	}
+	filters, err := parseHistoryFilters(c.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
+	options := []client.SubscribeOption{client.WithSince(c.String("since"))}
+	auth, err := clientAuthOption(c, conf)
+	if err != nil {
+		return err
+	} else if auth != nil {
+		options = append(options, auth)
+	}
+	cl := client.New(conf)
+	messages := make([]*client.Message, 0)
+	for _, topic := range c.Args().Slice() {
+		polled, err := cl.Poll(topic, options...)
+		if err != nil {
+			return err
+		}
+		for _, m := range polled {
+			if m.Event == client.MessageEvent && matchesHistoryFilters(m, filters) {
+				messages = append(messages, m)
+			}
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Time < messages[j].Time
+	})
+	switch format {
+	case historyFormatJSON:
+		for _, m := range messages {
+			fmt.Fprintln(c.App.Writer, strings.TrimSpace(m.Raw))
+		}
+		return nil
+	case historyFormatCSV:
+		return printHistoryCSV(c, messages)
+	default:
+		return printHistoryTable(c, messages)
+	}
+}
+
+func printHistoryTable(c *cli.Context, messages []*client.Message) error {
+	if len(messages) == 0 {
+		fmt.Fprintln(c.App.Writer, "no messages")
+		return nil
+	}
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTOPIC\tPRIORITY\tTAGS\tTITLE\tMESSAGE")
+	for _, m := range messages {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", time.Unix(m.Time, 0).Format("2006-01-02 15:04:05"), m.Topic, historyPriority(m), strings.Join(m.Tags, ","), historyOneLine(m.Title), historyOneLine(m.Message))
+	}
+	return w.Flush()
+}
+
+func printHistoryCSV(c *cli.Context, messages []*client.Message) error {
+	w := csv.NewWriter(c.App.Writer)
+	if err := w.Write([]string{"id", "time", "topic", "priority", "tags", "title", "message", "click", "attachment"}); err != nil {
+		return err
+	}
+	for _, m := range messages {
+		attachment := ""
+		if m.Attachment != nil {
+			attachment = m.Attachment.URL
+		}
+		record := []string{m.ID, time.Unix(m.Time, 0).UTC().Format(time.RFC3339), m.Topic, strconv.Itoa(historyPriority(m)), strings.Join(m.Tags, ","), m.Title, m.Message, m.Click, attachment}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func parseHistoryFilters(expressions []string) ([]*historyFilter, error) {
+	filters := make([]*historyFilter, 0)
+	for _, expression := range expressions {
+		matches := historyFilterRegex.FindStringSubmatch(expression)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid filter %q, must be FIELD OPERATOR VALUE, e.g. priority>=4", expression)
+		}
+		filter := &historyFilter{field: strings.ToLower(matches[1]), operator: matches[2], value: matches[3]}
+		switch filter.field {
+		case "priority", "prio":
+			priority, err := util.ParsePriority(filter.value)
+			if err != nil || priority == 0 {
+				return nil, fmt.Errorf("invalid filter %q: %s", expression, util.DescribeInvalidPriority(filter.value))
+			}
+			filter.field, filter.priority = "priority", priority
+		case "tags", "tag":
+			if filter.operator != "=" && filter.operator != "!=" && filter.operator != "~" {
+				return nil, fmt.Errorf("invalid filter %q: tags can only be compared with =, != or ~", expression)
+			}
+			filter.field = "tags"
+		case "title", "message", "topic":
+			if filter.operator != "=" && filter.operator != "!=" && filter.operator != "~" {
+				return nil, fmt.Errorf("invalid filter %q: %s can only be compared with =, != or ~", expression, filter.field)
+			}
+		default:
+			return nil, fmt.Errorf("invalid filter %q: unknown field %q, must be priority, tags, title, message or topic", expression, filter.field)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func matchesHistoryFilters(m *client.Message, filters []*historyFilter) bool {
+	for _, filter := range filters {
+		if !filter.matches(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *historyFilter) matches(m *client.Message) bool {
+	switch f.field {
+	case "priority":
+		priority := historyPriority(m)
+		switch f.operator {
+		case "=":
+			return priority == f.priority
+		case "!=":
+			return priority != f.priority
+		case ">":
+			return priority > f.priority
+		case ">=":
+			return priority >= f.priority
+		case "<":
+			return priority < f.priority
+		case "<=":
+			return priority <= f.priority
+		}
+		return false
+	case "tags":
+		found := false
+		for _, tag := range m.Tags {
+			if (f.operator == "~" && strings.Contains(strings.ToLower(tag), strings.ToLower(f.value))) || strings.EqualFold(tag, f.value) {
+				found = true
+				break
+			}
+		}
+		return found == (f.operator != "!=")
+	case "title":
+		return matchesHistoryString(m.Title, f.operator, f.value)
+	case "message":
+		return matchesHistoryString(m.Message, f.operator, f.value)
+	case "topic":
+		return matchesHistoryString(m.Topic, f.operator, f.value)
+	}
+	return false
+}
+
+func matchesHistoryString(s, operator, value string) bool {
+	switch operator {
+	case "=":
+		return strings.EqualFold(s, value)
+	case "!=":
+		return !strings.EqualFold(s, value)
+	case "~":
+		return strings.Contains(strings.ToLower(s), strings.ToLower(value))
+	}
+	return false
+}
+
+func historyPriority(m *client.Message) int {
+	if m.Priority == 0 {
+		return 3
+	}
+	return m.Priority
+}
+
+func historyOneLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) > historyMessageMaxLength {
+		return string([]rune(s)[:historyMessageMaxLength-3]) + "..."
+	}
+	return s
+}
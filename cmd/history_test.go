@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/test"
+)
+
+func TestCLI_History(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	alerts := fmt.Sprintf("http://127.0.0.1:%d/alerts", port)
+	backups := fmt.Sprintf("http://127.0.0.1:%d/backups", port)
+
+	for _, args := range [][]string{
+		{"--priority", "high", "--tags", "warning,disk", "--title", "Disk full", alerts, "sda1 is 99% full"},
+		{alerts, "all good"},
+		{"--priority", "urgent", backups, "backup failed\nsee logs"},
+	} {
+		app, _, _, _ := newTestApp()
+		require.Nil(t, app.Run(append([]string{"ntfy", "publish"}, args...)))
+	}
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "history", "--filter", "priority>=4", alerts, backups}))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Equal(t, 3, len(lines))
+	require.Regexp(t, `^TIME\s+TOPIC\s+PRIORITY\s+TAGS\s+TITLE\s+MESSAGE$`, lines[0])
+	require.Regexp(t, `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\s+alerts\s+4\s+warning,disk\s+Disk full\s+sda1 is 99% full$`, lines[1])
+	require.Regexp(t, `\s+backups\s+5\s+backup failed see logs$`, lines[2])
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "history", "-f", "tags=WARNING", "-f", "title~disk", "--format", "json", alerts}))
+	m := toMessage(t, stdout.String())
+	require.Equal(t, "sda1 is 99% full", m.Message)
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "history", "--filter", "prio=default", "-o", "csv", alerts, backups}))
+	records, err := csv.NewReader(strings.NewReader(stdout.String())).ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(records))
+	require.Equal(t, []string{"id", "time", "topic", "priority", "tags", "title", "message", "click", "attachment"}, records[0])
+	require.Equal(t, []string{"alerts", "3", "", "", "all good"}, records[1][2:7])
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "history", "--filter", "message=nope", alerts}))
+	require.Equal(t, "no messages\n", stdout.String())
+}
+
+func TestCLI_History_InvalidFilter(t *testing.T) {
+	app, _, _, _ := newTestApp()
+	require.EqualError(t, app.Run([]string{"ntfy", "history", "--filter", "prio>=hihg", "mytopic"}), `invalid filter "prio>=hihg": unknown priority "hihg", did you mean "high"?`)
+	app, _, _, _ = newTestApp()
+	require.EqualError(t, app.Run([]string{"ntfy", "history", "--filter", "sender=phil", "mytopic"}), `invalid filter "sender=phil": unknown field "sender", must be priority, tags, title, message or topic`)
+	app, _, _, _ = newTestApp()
+	require.EqualError(t, app.Run([]string{"ntfy", "history", "--filter", "tags>warning", "mytopic"}), `invalid filter "tags>warning": tags can only be compared with =, != or ~`)
+	app, _, _, _ = newTestApp()
+	require.EqualError(t, app.Run([]string{"ntfy", "history", "--format", "xml", "mytopic"}), `invalid format "xml", must be table, json or csv`)
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/util"
+)
+
+func init() {
+	commands = append(commands, cmdLimits)
+}
+
+var flagsLimits = append(
+	append(append([]cli.Flag{}, flagsDefault...), flagsTLS...),
+	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG"}, Usage: "client config file"},
+	&cli.StringFlag{Name: "user", Aliases: []string{"u"}, EnvVars: []string{"NTFY_USER"}, Usage: "username[:password] used to auth against the server"},
+	&cli.StringFlag{Name: "token", Aliases: []string{"k"}, EnvVars: []string{"NTFY_TOKEN"}, Usage: "access token used to auth against the server"},
+)
+
+var cmdLimits = &cli.Command{
+	Name:      "limits",
+	Usage:     "Show your current rate limits and remaining budget",
+	UsageText: "ntfy limits [OPTIONS..] [SERVER]",
+	Action:    execLimits,
+	Category:  categoryClient,
+	Flags:     flagsLimits,
+	Before:    initLogFunc,
+	Description: `Show the current rate limiting state of your visitor on a ntfy server, e.g. to find out
+why the server responds with "429 Too Many Requests".
+
+For each limit, the used and remaining budget, the max (the daily limit, or the burst of
+rate limits), the rate limiting algorithm, when the next request is allowed (if the limit
+is exhausted), and when the limit is reset or fully replenished are shown. Temporary bans
+(e.g. after too many failed logins) are listed below the table.
+
+Without credentials, the limits of your IP address are shown. If SERVER is not given, the
+default host from the config file is used. Credentials are taken from --user/--token, or
+from the default-user/default-token in the config file.
+
+Examples:
+  ntfy limits                               # Show limits of your IP address on the default host
+  ntfy limits -u phil:mypass ntfy.example.com
+`,
+}
+
+func execLimits(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() > 1 {
+		return errors.New("too many arguments, see 'ntfy limits --help'")
+	}
+	baseURL := conf.DefaultHost
+	if c.NArg() == 1 {
+		baseURL = expandServerURL(c.Args().Get(0))
+	}
+	auth, err := clientAuthOption(c, conf)
+	if err != nil {
+		return err
+	}
+	options := make([]client.RequestOption, 0)
+	if auth != nil {
+		options = append(options, auth)
+	}
+	cl := client.New(conf)
+	limits, err := cl.Limits(baseURL, options...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "visitor %s, limits based on %s\n\n", limits.Visitor, limits.Basis)
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LIMIT\tUSED\tREMAINING\tMAX\tALGORITHM\tNEXT ALLOWED\tRESET")
+	printLimit(w, "requests", limits.Requests, false)
+	printLimit(w, "messages", limits.Messages, false)
+	printLimit(w, "emails", limits.Emails, false)
+	printLimit(w, "calls", limits.Calls, false)
+	printLimit(w, "subscriptions", limits.Subscriptions, false)
+	printLimit(w, "attachment bandwidth", limits.AttachmentBandwidth, true)
+	printLimit(w, "auth failures", limits.AuthFailures, false)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if limits.Exempt {
+		fmt.Fprintln(c.App.Writer, "\nyour IP address is exempt from the request and message limits")
+	}
+	if limits.Banned != nil && limits.Banned.Firebase > 0 {
+		fmt.Fprintf(c.App.Writer, "\nmessages are not forwarded to Firebase (Android push) until %s\n", formatLimitTime(limits.Banned.Firebase))
+	}
+	if limits.Banned != nil && limits.Banned.Login > 0 {
+		fmt.Fprintf(c.App.Writer, "\nlogins are blocked after too many failed attempts until %s\n", formatLimitTime(limits.Banned.Login))
+	}
+	return nil
+}
+
+func printLimit(w *tabwriter.Writer, name string, l *client.Limit, bytes bool) {
+	if l == nil {
+		return
+	}
+	algorithm := l.Algorithm
+	if algorithm == "" {
+		algorithm = "-"
+	}
+	used, remaining, limit := fmt.Sprintf("%d", l.Used), fmt.Sprintf("%d", l.Remaining), fmt.Sprintf("%d", l.Limit)
+	if bytes {
+		used, remaining, limit = util.FormatSizeHuman(l.Used), util.FormatSizeHuman(l.Remaining), util.FormatSizeHuman(l.Limit)
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, used, remaining, limit, algorithm, formatLimitTime(l.Next), formatLimitTime(l.Reset))
+}
+
+// formatLimitTime formats a Unix time as a duration relative to now, e.g. "in 1m30s", or "-" if it is not set
+func formatLimitTime(unixTime int64) string {
+	if unixTime == 0 {
+		return "-"
+	}
+	d := time.Until(time.Unix(unixTime, 0)).Round(time.Second)
+	if d <= 0 {
+		return "now"
+	}
+	return "in " + d.String()
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"heckel.io/ntfy/v2/user"
+)
+
+func TestCLI_Limits(t *testing.T) {
+	conf := server.NewConfig()
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthUsers = []*user.User{
+		{Name: "philuser", Hash: "$2a$10$U4WSIYY6evyGmZaraavM2e2JeVG6EMGUKN1uUwufUeeRd4Jpg6cGC", Role: user.RoleAdmin}, // philuser:philpass
+	}
+	conf.VisitorRequestLimitBurst = 2
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	// Exhaust the request limit
+	for i := 0; i < 3; i++ {
+		app, _, _, _ := newTestApp()
+		_ = app.Run([]string{"ntfy", "publish", baseURL + "/mytopic", "hi"})
+	}
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "limits", baseURL}))
+	lines := strings.Split(stdout.String(), "\n")
+	require.Equal(t, "visitor ip:127.0.0.1, limits based on ip", lines[0])
+	require.Regexp(t, `^LIMIT\s+USED\s+REMAINING\s+MAX\s+ALGORITHM\s+NEXT ALLOWED\s+RESET$`, lines[2])
+	require.Regexp(t, `^requests\s+2\s+0\s+2\s+token-bucket\s+in \S+\s+in \S+$`, lines[3])
+	require.Regexp(t, `^messages\s+2\s+\d+\s+\d+\s+-\s+-\s+in \S+$`, lines[4])
+	require.Contains(t, stdout.String(), "auth failures")
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "limits", "--user", "philuser:philpass", baseURL}))
+	require.Contains(t, stdout.String(), "visitor ip:127.0.0.1, limits based on ip") // Users without tier share the limits of their IP address
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -20,12 +21,12 @@ func init() {
 }
 
 var flagsPublish = append(
-	append([]cli.Flag{}, flagsDefault...),
+	append(append([]cli.Flag{}, flagsDefault...), flagsTLS...),
 	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG"}, Usage: "client config file"},
 	&cli.StringFlag{Name: "title", Aliases: []string{"t"}, EnvVars: []string{"NTFY_TITLE"}, Usage: "message title"},
 	&cli.StringFlag{Name: "message", Aliases: []string{"m"}, EnvVars: []string{"NTFY_MESSAGE"}, Usage: "message body"},
-	&cli.StringFlag{Name: "priority", Aliases: []string{"p"}, EnvVars: []string{"NTFY_PRIORITY"}, Usage: "priority of the message (1=min, 2=low, 3=default, 4=high, 5=max)"},
-	&cli.StringFlag{Name: "tags", Aliases: []string{"tag", "T"}, EnvVars: []string{"NTFY_TAGS"}, Usage: "comma separated list of tags and emojis"},
+	&cli.StringFlag{Name: "priority", Aliases: []string{"p"}, EnvVars: []string{"NTFY_PRIORITY"}, Usage: "priority of the message (1=min, 2=low, 3=default, 4=high, 5=max, or e.g. urgent, meh)"},
+	&cli.StringFlag{Name: "tags", Aliases: []string{"tag", "T"}, EnvVars: []string{"NTFY_TAGS"}, Usage: "comma or space separated list of tags and emojis (e.g. warning,skull or 'warning :tada:')"},
 	&cli.StringFlag{Name: "delay", Aliases: []string{"at", "in", "D"}, EnvVars: []string{"NTFY_DELAY"}, Usage: "delay/schedule message"},
 	&cli.StringFlag{Name: "click", Aliases: []string{"U"}, EnvVars: []string{"NTFY_CLICK"}, Usage: "URL to open when notification is clicked"},
 	&cli.StringFlag{Name: "icon", Aliases: []string{"i"}, EnvVars: []string{"NTFY_ICON"}, Usage: "URL to use as notification icon"},
@@ -35,6 +36,8 @@ var flagsPublish = append(
 	&cli.StringFlag{Name: "template", Aliases: []string{"tpl"}, EnvVars: []string{"NTFY_TEMPLATE"}, Usage: "use templates to transform JSON message body"},
 	&cli.StringFlag{Name: "filename", Aliases: []string{"name", "n"}, EnvVars: []string{"NTFY_FILENAME"}, Usage: "filename for the attachment"},
 	&cli.StringFlag{Name: "file", Aliases: []string{"f"}, EnvVars: []string{"NTFY_FILE"}, Usage: "file to upload as an attachment"},
+	&cli.BoolFlag{Name: "progress", EnvVars: []string{"NTFY_PROGRESS"}, Usage: "show upload progress of --file attachments"},
+	&cli.StringSliceFlag{Name: "meta", Usage: "custom metadata field as `KEY=VALUE`, stored and delivered with the message (can be repeated)"},
 	&cli.StringFlag{Name: "email", Aliases: []string{"mail", "e"}, EnvVars: []string{"NTFY_EMAIL"}, Usage: "also send to e-mail address"},
 	&cli.StringFlag{Name: "user", Aliases: []string{"u"}, EnvVars: []string{"NTFY_USER"}, Usage: "username[:password] used to auth against the server"},
 	&cli.StringFlag{Name: "token", Aliases: []string{"k"}, EnvVars: []string{"NTFY_TOKEN"}, Usage: "access token used to auth against the server"},
@@ -63,6 +66,7 @@ Examples:
   ntfy send myserver.com/mytopic "This is my message"     # Send message to different default host
   ntfy pub -p high backups "Backups failed"               # Send high priority message
   ntfy pub --tags=warning,skull backups "Backups failed"  # Add tags/emojis to message
+  ntfy pub -p urgent -T "rotating_light fire" prod Down!  # Priority and tags in plain words
   ntfy pub --delay=10s delayed_topic Laterzz              # Delay message by 10s
   ntfy pub --at=8:30am delayed_topic Laterzz              # Send message at 8:30am
   ntfy pub -e phil@example.com alerts 'App is down!'      # Also send email to phil@example.com
@@ -70,6 +74,7 @@ Examples:
   ntfy pub --icon="http://some.tld/icon.png" 'Icon!'      # Send notification with custom icon
   ntfy pub --attach="http://some.tld/file.zip" files      # Send ZIP archive from URL as attachment
   ntfy pub --file=flower.jpg flowers 'Nice!'              # Send image.jpg as attachment
+  ntfy pub --progress --file=backup.tgz backups           # Show upload progress of large attachments
   echo 'message' | ntfy publish mytopic                   # Send message from stdin
   ntfy pub -u phil:mypass secret Psst                     # Publish with username/password
   ntfy pub --wait-pid 1234 mytopic                        # Wait for process 1234 to exit before publishing
@@ -112,11 +117,13 @@ func execPublish(c *cli.Context) error {
 	filename := c.String("filename")
 	file := c.String("file")
 	email := c.String("email")
+	meta := c.StringSlice("meta")
 	user := c.String("user")
 	token := c.String("token")
 	noCache := c.Bool("no-cache")
 	noFirebase := c.Bool("no-firebase")
 	quiet := c.Bool("quiet")
+	progress := c.Bool("progress")
 	pid := c.Int("wait-pid")
 
 	// Checks
@@ -134,10 +141,14 @@ func execPublish(c *cli.Context) error {
 		options = append(options, client.WithTitle(title))
 	}
 	if priority != "" {
-		options = append(options, client.WithPriority(priority))
+		p, err := util.ParsePriority(priority)
+		if err != nil {
+			return errors.New(util.DescribeInvalidPriority(priority))
+		}
+		options = append(options, client.WithPriority(strconv.Itoa(p))) // Numbers are understood by older servers too
 	}
 	if tags != "" {
-		options = append(options, client.WithTagsList(tags))
+		options = append(options, client.WithTags(util.SplitTags(tags)))
 	}
 	if delay != "" {
 		options = append(options, client.WithDelay(delay))
@@ -166,6 +177,13 @@ func execPublish(c *cli.Context) error {
 	if email != "" {
 		options = append(options, client.WithEmail(email))
 	}
+	for _, field := range meta {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid metadata field %q, must be KEY=VALUE", field)
+		}
+		options = append(options, client.WithMetadata(strings.TrimSpace(key), strings.TrimSpace(value)))
+	}
 	if noCache {
 		options = append(options, client.WithNoCache())
 	}
@@ -211,9 +229,8 @@ func execPublish(c *cli.Context) error {
 		}
 	}
 	var body io.Reader
-	if file == "" {
-		body = strings.NewReader(message)
-	} else {
+	var bodyFile *os.File
+	if file != "" {
 		if message != "" {
 			options = append(options, client.WithMessage(message))
 		}
@@ -226,14 +243,28 @@ func execPublish(c *cli.Context) error {
 			if filename == "" {
 				options = append(options, client.WithFilename(filepath.Base(file)))
 			}
-			body, err = os.Open(file)
+			bodyFile, err = os.Open(file)
 			if err != nil {
 				return err
 			}
+			defer bodyFile.Close()
+			body = bodyFile
 		}
 	}
+	if file != "" && progress {
+		options = append(options, client.WithProgress(func(transferred, total int64) {
+			printUploadProgress(c.App.ErrWriter, transferred, total)
+		}))
+	}
 	cl := client.New(conf)
-	m, err := cl.PublishReader(topic, body, options...)
+	var m *client.Message
+	if file == "" {
+		m, err = cl.Publish(topic, message, options...) // Splits large messages into chunks, if supported by the server
+	} else if bodyFile != nil {
+		m, err = cl.PublishFile(topic, bodyFile, options...) // Resumable upload, if supported by the server
+	} else {
+		m, err = cl.PublishReader(topic, body, options...)
+	}
 	if err != nil {
 		return err
 	}
@@ -392,3 +423,20 @@ func isStdinRedirected() bool {
 	}
 	return (stat.Mode() & os.ModeCharDevice) == 0
 }
+
+// printUploadProgress prints the progress of an attachment upload, overwriting the previous progress line.
+// Once the upload is complete, the line is terminated with a newline.
+func printUploadProgress(w io.Writer, transferred, total int64) {
+	if total < 0 {
+		fmt.Fprintf(w, "\rUploading ... %s", util.FormatSizeHuman(transferred))
+		return
+	}
+	percent := int64(100)
+	if total > 0 {
+		percent = transferred * 100 / total
+	}
+	fmt.Fprintf(w, "\rUploading ... %d%% (%s / %s)", percent, util.FormatSizeHuman(transferred), util.FormatSizeHuman(total))
+	if transferred >= total {
+		fmt.Fprintln(w)
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
 	"heckel.io/ntfy/v2/test"
 	"heckel.io/ntfy/v2/util"
 	"net/http"
@@ -34,6 +35,22 @@ func TestCLI_Publish_Subscribe_Poll_Real_Server(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestCLI_Publish_Subscribe_Poll_DefaultHostFromEnv(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	t.Setenv("NTFY_DEFAULT_HOST", fmt.Sprintf("http://127.0.0.1:%d", port))
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "publish", "mytopic", "message via env config"}))
+	m := toMessage(t, stdout.String())
+	require.Equal(t, "message via env config", m.Message)
+
+	app2, _, stdout, _ := newTestApp()
+	require.Nil(t, app2.Run([]string{"ntfy", "subscribe", "--poll", "mytopic"}))
+	m = toMessage(t, stdout.String())
+	require.Equal(t, "message via env config", m.Message)
+}
+
 func TestCLI_Publish_Subscribe_Poll(t *testing.T) {
 	s, port := test.StartServer(t)
 	defer test.StopServer(t, s, port)
@@ -50,6 +67,24 @@ func TestCLI_Publish_Subscribe_Poll(t *testing.T) {
 	require.Equal(t, "some message", m.Message)
 }
 
+func TestCLI_Publish_TraceHTTP(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	topic := fmt.Sprintf("http://127.0.0.1:%d/mytopic", port)
+
+	app, _, stdout, stderr := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "--trace-http", "publish", "--user", "phil:mypass", topic, "some message"}))
+	require.Equal(t, "some message", toMessage(t, stdout.String()).Message)
+	require.Contains(t, stderr.String(), "> POST /mytopic HTTP/1.1\n")
+	require.Contains(t, stderr.String(), "> Authorization: Basic <redacted>\n")
+	require.Contains(t, stderr.String(), "< HTTP/1.1 200 OK\n")
+	require.NotContains(t, stderr.String(), "mypass")
+
+	app2, _, _, stderr := newTestApp()
+	require.Nil(t, app2.Run([]string{"ntfy", "subscribe", "--poll", "--trace-http", topic}))
+	require.Contains(t, stderr.String(), "> GET /mytopic/json?poll=1")
+}
+
 func TestCLI_Publish_All_The_Things(t *testing.T) {
 	s, port := test.StartServer(t)
 	defer test.StopServer(t, s, port)
@@ -88,6 +123,41 @@ func TestCLI_Publish_All_The_Things(t *testing.T) {
 	require.Equal(t, "https://ntfy.sh/static/img/ntfy.png", m.Icon)
 }
 
+func TestCLI_Publish_PriorityAndTagAliases(t *testing.T) {
+	s, port := test.StartServer(t)
+	defer test.StopServer(t, s, port)
+	topic := fmt.Sprintf("http://127.0.0.1:%d/mytopic", port)
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "publish", "--priority", "meh", "--tags", "warning  :skull: ", topic, "some message"}))
+	m := toMessage(t, stdout.String())
+	require.Equal(t, 2, m.Priority)
+	require.Equal(t, []string{"warning", "skull"}, m.Tags)
+
+	app, _, _, _ = newTestApp()
+	err := app.Run([]string{"ntfy", "publish", "--priority", "hihg", topic, "some message"})
+	require.EqualError(t, err, `unknown priority "hihg", did you mean "high"?`)
+}
+
+func TestCLI_Publish_File_Progress(t *testing.T) {
+	conf := server.NewConfig()
+	conf.BaseURL = "http://127.0.0.1"
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	topic := fmt.Sprintf("http://127.0.0.1:%d/mytopic", port)
+	filename := filepath.Join(t.TempDir(), "image.png")
+	content := append([]byte("\x89PNG\r\n\x1a\n"), []byte(strings.Repeat("x", 100000))...)
+	require.Nil(t, os.WriteFile(filename, content, 0600))
+
+	app, _, stdout, stderr := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "publish", "--progress", "--file", filename, topic}))
+	m := toMessage(t, stdout.String())
+	require.Equal(t, "image.png", m.Attachment.Name)
+	require.Equal(t, "image/png", m.Attachment.Type)
+	require.Equal(t, int64(len(content)), m.Attachment.Size)
+	require.True(t, strings.HasSuffix(stderr.String(), "Uploading ... 100% (97.7 KB / 97.7 KB)\n"))
+}
+
 func TestCLI_Publish_Wait_PID_And_Cmd(t *testing.T) {
 	s, port := test.StartServer(t)
 	defer test.StopServer(t, s, port)
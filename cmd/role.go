@@ -0,0 +1,301 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/user"
+	"strings"
+)
+
+func init() {
+	commands = append(commands, cmdRole)
+}
+
+var flagsRole = append([]cli.Flag{}, flagsUser...)
+
+var cmdRole = &cli.Command{
+	Name:      "role",
+	Usage:     "Manage/show custom roles",
+	UsageText: "ntfy role [list|add|change|remove] ...",
+	Flags:     flagsRole,
+	Before:    initConfigFileInputSourceFunc("config", flagsUser, initLogFunc),
+	Category:  categoryServer,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "add",
+			Aliases:   []string{"a"},
+			Usage:     "Adds a new custom role",
+			UsageText: "ntfy role add [--ignore-exists] ROLE [CAPABILITY ...]",
+			Action:    execRoleAdd,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "ignore-exists", Usage: "if the role already exists, perform no action and exit"},
+			},
+			Description: `Add a new custom role to the ntfy user database.
+
+Custom roles can be assigned to users via 'ntfy user add --role=ROLE' or 'ntfy user change-role'.
+Users with a custom role are regular users, i.e. they are subject to access control entries and
+tier limits, but they are granted additional capabilities:
+
+- users-read: list users, their tiers and access control entries via the API
+- users-write: add, change and remove regular users via the API
+- access-write: grant and revoke access to topics for any user via the API
+- impersonate: act on behalf of regular users via the X-Impersonate header (audit logged)
+- log-level: temporarily change the server's log level via the API
+- stats-read: view detailed server stats and list the reservations of all users via the API
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Examples:
+  ntfy role add auditor users-read                 # Add role that can only list users
+  ntfy role add operator users-read access-write   # Add role that can manage topic access
+`,
+		},
+		{
+			Name:      "change",
+			Aliases:   []string{"ch"},
+			Usage:     "Changes the capabilities of a custom role",
+			UsageText: "ntfy role change ROLE [CAPABILITY ...]",
+			Action:    execRoleChange,
+			Description: `Replaces the capabilities of an existing custom role.
+
+All users with this role are affected immediately. Pass no capabilities to remove all capabilities
+from the role.
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Examples:
+  ntfy role change operator access-write   # Only allow role "operator" to manage topic access
+  ntfy role change operator                # Remove all capabilities from role "operator"
+`,
+		},
+		{
+			Name:      "remove",
+			Aliases:   []string{"del", "rm"},
+			Usage:     "Removes a custom role",
+			UsageText: "ntfy role remove ROLE",
+			Action:    execRoleDel,
+			Description: `Remove a custom role from the ntfy user database.
+
+You cannot remove a role if there are users with that role. Use "ntfy user change-role"
+to switch their role first.
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Example:
+  ntfy role del operator
+`,
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"l"},
+			Usage:   "Shows a list of custom roles",
+			Action:  execRoleList,
+			Description: `Shows a list of all custom roles and their capabilities.
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+`,
+		},
+	},
+	Description: `Manage custom roles of the ntfy server.
+
+The command allows you to add/remove/change custom roles in the ntfy user database. Apart from
+the built-in roles 'admin' and 'user', custom roles can be used to delegate some administrative
+tasks to users, e.g. an "operator" that can manage topic access, but not users, or an "auditor"
+with read-only access to the list of users.
+
+This is a server-only command. It directly manages the user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Examples:
+  ntfy role add operator users-read access-write   # Add custom role "operator"
+  ntfy role change operator access-write           # Change capabilities of role "operator"
+  ntfy role del operator                           # Delete role "operator"
+`,
+}
+
+// execRoleAdd adds a new custom role to the system.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if adding the role fails (e.g., role already exists).
+func execRoleAdd(c *cli.Context) error {
+	role, err := parseRoleArgs(c, "add")
+	if err != nil {
+		return err
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if existing, _ := manager.Role(role.Name); existing != nil {
+		if c.Bool("ignore-exists") {
+			fmt.Fprintf(c.App.Writer, "role %s already exists (exited successfully)\n", role.Name)
+			return nil
+		}
+		return fmt.Errorf("role %s already exists", role.Name)
+	}
+	if err := manager.AddRole(role); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "role added\n\n")
+	printRole(c, role)
+	return nil
+}
+
+// execRoleChange replaces the capabilities of an existing custom role.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if the role is not found or updating fails.
+func execRoleChange(c *cli.Context) error {
+	role, err := parseRoleArgs(c, "change")
+	if err != nil {
+		return err
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if err := manager.UpdateRole(role); errors.Is(err, user.ErrRoleNotFound) {
+		return fmt.Errorf("role %s does not exist", role.Name)
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "role updated\n\n")
+	printRole(c, role)
+	return nil
+}
+
+// execRoleDel removes a custom role from the system.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if the role is not found, still in use, or deletion fails.
+func execRoleDel(c *cli.Context) error {
+	name := user.Role(c.Args().Get(0))
+	if name == "" {
+		return errors.New("role expected, type 'ntfy role del --help' for help")
+	} else if !user.AllowedCustomRole(name) {
+		return fmt.Errorf("role %s cannot be removed", name)
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if _, err := manager.Role(name); errors.Is(err, user.ErrRoleNotFound) {
+		return fmt.Errorf("role %s does not exist", name)
+	}
+	if err := manager.RemoveRole(name); errors.Is(err, user.ErrRoleInUse) {
+		return fmt.Errorf("role %s is still assigned to users, use 'ntfy user change-role' to change their role first", name)
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "role %s removed\n", name)
+	return nil
+}
+
+// execRoleList lists all custom roles.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if listing roles fails.
+func execRoleList(c *cli.Context) error {
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	roles, err := manager.Roles()
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		printRole(c, role)
+	}
+	return nil
+}
+
+// parseRoleArgs parses the role name and capabilities from the command line arguments.
+//
+// Parameters:
+//   - c: The CLI context.
+//   - command: The name of the subcommand, used in error messages.
+//
+// Returns:
+//   - The parsed CustomRole, or an error if the arguments are invalid.
+func parseRoleArgs(c *cli.Context, command string) (*user.CustomRole, error) {
+	name := user.Role(c.Args().Get(0))
+	if name == "" {
+		return nil, fmt.Errorf("role expected, type 'ntfy role %s --help' for help", command)
+	} else if !user.AllowedCustomRole(name) {
+		return nil, errors.New("role must consist only of lowercase letters, numbers, dashes and underscores, and cannot be 'admin', 'user' or 'anonymous'")
+	}
+	capabilities := make([]user.Capability, 0)
+	for _, arg := range c.Args().Tail() {
+		capability := user.Capability(arg)
+		if !user.AllowedCapability(capability) {
+			return nil, fmt.Errorf("invalid capability %s, allowed capabilities are: %s", arg, formatCapabilities(user.Capabilities))
+		}
+		capabilities = append(capabilities, capability)
+	}
+	return &user.CustomRole{
+		Name:         name,
+		Capabilities: capabilities,
+	}, nil
+}
+
+// checkRoleExists returns an error if the given role is a custom role that does not exist.
+//
+// Parameters:
+//   - manager: The user manager.
+//   - role: The role to check.
+//
+// Returns:
+//   - An error if the role does not exist.
+func checkRoleExists(manager *user.Manager, role user.Role) error {
+	if role == user.RoleAdmin || role == user.RoleUser {
+		return nil
+	}
+	if _, err := manager.Role(role); errors.Is(err, user.ErrRoleNotFound) {
+		return fmt.Errorf("role %s does not exist, use 'ntfy role add' to create it", role)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// printRole prints the details of a custom role to stdout.
+//
+// Parameters:
+//   - c: The CLI context.
+//   - role: The role to print.
+func printRole(c *cli.Context, role *user.CustomRole) {
+	capabilities := "(none)"
+	if len(role.Capabilities) > 0 {
+		capabilities = formatCapabilities(role.Capabilities)
+	}
+	fmt.Fprintf(c.App.Writer, "role %s\n", role.Name)
+	fmt.Fprintf(c.App.Writer, "- Capabilities: %s\n", capabilities)
+}
+
+func formatCapabilities(capabilities []user.Capability) string {
+	s := make([]string, len(capabilities))
+	for i, c := range capabilities {
+		s[i] = string(c)
+	}
+	return strings.Join(s, ", ")
+}
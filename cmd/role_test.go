@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"testing"
+)
+
+func TestCLI_Role_AddListChangeDelete(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, runRoleCommand(app, conf, "add", "operator", "users-read", "access-write"))
+	require.Contains(t, stdout.String(), "role added\n\nrole operator\n- Capabilities: users-read, access-write")
+
+	err := runRoleCommand(app, conf, "add", "operator")
+	require.NotNil(t, err)
+	require.Equal(t, "role operator already exists", err.Error())
+
+	err = runRoleCommand(app, conf, "add", "admin")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "cannot be 'admin', 'user' or 'anonymous'")
+
+	err = runRoleCommand(app, conf, "add", "auditor", "launch-rockets")
+	require.NotNil(t, err)
+	require.Equal(t, "invalid capability launch-rockets, allowed capabilities are: users-read, users-write, access-write, impersonate, log-level, stats-read", err.Error())
+
+	// Assign role to user
+	app, stdin, stdout, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "--role=operator", "phil"))
+	require.Contains(t, stdout.String(), "user phil added with role operator")
+
+	app, _, _, _ = newTestApp()
+	err = runUserCommand(app, conf, "change-role", "phil", "auditor")
+	require.NotNil(t, err)
+	require.Equal(t, "role auditor does not exist, use 'ntfy role add' to create it", err.Error())
+
+	// Change and list
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runRoleCommand(app, conf, "change", "operator"))
+	require.Contains(t, stdout.String(), "role updated\n\nrole operator\n- Capabilities: (none)")
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runRoleCommand(app, conf, "list"))
+	require.Equal(t, "role operator\n- Capabilities: (none)\n", stdout.String())
+
+	// Cannot remove role while in use
+	app, _, _, _ = newTestApp()
+	err = runRoleCommand(app, conf, "remove", "operator")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "role operator is still assigned to users")
+
+	app, _, _, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "change-role", "phil", "user"))
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runRoleCommand(app, conf, "remove", "operator"))
+	require.Contains(t, stdout.String(), "role operator removed")
+}
+
+func runRoleCommand(app *cli.App, conf *server.Config, args ...string) error {
+	userArgs := []string{
+		"ntfy",
+		"--log-level=ERROR",
+		"role",
+		"--config=" + conf.File, // Dummy config file to avoid lookups of real file
+		"--auth-file=" + conf.AuthFile,
+		"--auth-default-access=" + conf.AuthDefault.String(),
+	}
+	return app.Run(append(userArgs, args...))
+}
@@ -35,33 +35,50 @@ var flagsServe = append(
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "base-url", Aliases: []string{"base_url", "B"}, EnvVars: []string{"NTFY_BASE_URL"}, Usage: "externally visible base URL for this host (e.g. https://ntfy.sh)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "listen-http", Aliases: []string{"listen_http", "l"}, EnvVars: []string{"NTFY_LISTEN_HTTP"}, Value: server.DefaultListenHTTP, Usage: "ip:port used as HTTP listen address"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "listen-https", Aliases: []string{"listen_https", "L"}, EnvVars: []string{"NTFY_LISTEN_HTTPS"}, Usage: "ip:port used as HTTPS listen address"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "listen-http3", Aliases: []string{"listen_http3"}, EnvVars: []string{"NTFY_LISTEN_HTTP3"}, Usage: "ip:port used as HTTP/3 (QUIC, UDP) listen address"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "listen-unix", Aliases: []string{"listen_unix", "U"}, EnvVars: []string{"NTFY_LISTEN_UNIX"}, Usage: "listen on unix socket path"}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "listen-unix-mode", Aliases: []string{"listen_unix_mode"}, EnvVars: []string{"NTFY_LISTEN_UNIX_MODE"}, DefaultText: "system default", Usage: "file permissions of unix socket, e.g. 0700"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "key-file", Aliases: []string{"key_file", "K"}, EnvVars: []string{"NTFY_KEY_FILE"}, Usage: "private key file, if listen-https is set"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "cert-file", Aliases: []string{"cert_file", "E"}, EnvVars: []string{"NTFY_CERT_FILE"}, Usage: "certificate file, if listen-https is set"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "acme-domains", Aliases: []string{"acme_domains"}, EnvVars: []string{"NTFY_ACME_DOMAINS"}, Usage: "domains to automatically request TLS certificates for via ACME (e.g. Let's Encrypt), instead of key-file/cert-file"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "acme-email", Aliases: []string{"acme_email"}, EnvVars: []string{"NTFY_ACME_EMAIL"}, Usage: "contact email address for the ACME account, used for expiry notices"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "acme-cache-dir", Aliases: []string{"acme_cache_dir"}, EnvVars: []string{"NTFY_ACME_CACHE_DIR"}, Usage: "directory to store ACME account keys and certificates in"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "acme-directory-url", Aliases: []string{"acme_directory_url"}, EnvVars: []string{"NTFY_ACME_DIRECTORY_URL"}, Usage: "ACME directory URL, defaults to Let's Encrypt"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "firebase-key-file", Aliases: []string{"firebase_key_file", "F"}, EnvVars: []string{"NTFY_FIREBASE_KEY_FILE"}, Usage: "Firebase credentials file; if set additionally publish to FCM topic"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "cache-file", Aliases: []string{"cache_file", "C"}, EnvVars: []string{"NTFY_CACHE_FILE"}, Usage: "cache file used for message caching"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "cache-duration", Aliases: []string{"cache_duration", "b"}, EnvVars: []string{"NTFY_CACHE_DURATION"}, Value: util.FormatDuration(server.DefaultCacheDuration), Usage: "buffer messages for this time to allow `since` requests"}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "cache-batch-size", Aliases: []string{"cache_batch_size"}, EnvVars: []string{"NTFY_BATCH_SIZE"}, Usage: "max size of messages to batch together when writing to message cache (if zero, writes are synchronous)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "cache-batch-timeout", Aliases: []string{"cache_batch_timeout"}, EnvVars: []string{"NTFY_CACHE_BATCH_TIMEOUT"}, Value: util.FormatDuration(server.DefaultCacheBatchTimeout), Usage: "timeout for batched async writes to the message cache (if zero, writes are synchronous)"}),
+	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "cache-expiration-events", Aliases: []string{"cache_expiration_events"}, EnvVars: []string{"NTFY_CACHE_EXPIRATION_EVENTS"}, Value: false, Usage: "send an event to subscribers when a cached message or attachment expires"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "cache-startup-queries", Aliases: []string{"cache_startup_queries"}, EnvVars: []string{"NTFY_CACHE_STARTUP_QUERIES"}, Usage: "queries run when the cache database is initialized"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-file", Aliases: []string{"auth_file", "H"}, EnvVars: []string{"NTFY_AUTH_FILE"}, Usage: "auth database file used for access control"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-startup-queries", Aliases: []string{"auth_startup_queries"}, EnvVars: []string{"NTFY_AUTH_STARTUP_QUERIES"}, Usage: "queries run when the auth database is initialized"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-default-access", Aliases: []string{"auth_default_access", "p"}, EnvVars: []string{"NTFY_AUTH_DEFAULT_ACCESS"}, Value: "read-write", Usage: "default permissions if no matching entries in the auth database are found"}),
 	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "auth-users", Aliases: []string{"auth_users"}, EnvVars: []string{"NTFY_AUTH_USERS"}, Usage: "pre-provisioned declarative users"}),
 	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "auth-access", Aliases: []string{"auth_access"}, EnvVars: []string{"NTFY_AUTH_ACCESS"}, Usage: "pre-provisioned declarative access control entries"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "auth-access-templates", Aliases: []string{"auth_access_templates"}, EnvVars: []string{"NTFY_AUTH_ACCESS_TEMPLATES"}, Usage: "access control entries applied to new users, e.g. 'user-<username>-*:rw'"}),
 	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "auth-tokens", Aliases: []string{"auth_tokens"}, EnvVars: []string{"NTFY_AUTH_TOKENS"}, Usage: "pre-provisioned declarative access tokens"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "auth-bcrypt-cost", Aliases: []string{"auth_bcrypt_cost"}, EnvVars: []string{"NTFY_AUTH_BCRYPT_COST"}, Value: user.DefaultUserPasswordBcryptCost, Usage: "bcrypt cost of password hashes; weaker hashes are re-hashed when users log in"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-cache-ttl", Aliases: []string{"auth_cache_ttl"}, EnvVars: []string{"NTFY_AUTH_CACHE_TTL"}, Value: util.FormatDuration(user.DefaultUserAuthCacheTTL), Usage: "duration for which verified username/password combinations are cached in memory (if zero, the cache is disabled)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-cache-dir", Aliases: []string{"attachment_cache_dir"}, EnvVars: []string{"NTFY_ATTACHMENT_CACHE_DIR"}, Usage: "cache directory for attached files"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-total-size-limit", Aliases: []string{"attachment_total_size_limit", "A"}, EnvVars: []string{"NTFY_ATTACHMENT_TOTAL_SIZE_LIMIT"}, Value: util.FormatSize(server.DefaultAttachmentTotalSizeLimit), Usage: "limit of the on-disk attachment cache"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-file-size-limit", Aliases: []string{"attachment_file_size_limit", "Y"}, EnvVars: []string{"NTFY_ATTACHMENT_FILE_SIZE_LIMIT"}, Value: util.FormatSize(server.DefaultAttachmentFileSizeLimit), Usage: "per-file attachment size limit (e.g. 300k, 2M, 100M)"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "attachment-gc-strategies", Aliases: []string{"attachment_gc_strategies"}, EnvVars: []string{"NTFY_ATTACHMENT_GC_STRATEGIES"}, Usage: "strategies used to delete attachments (expired, orphans, size; default: expired)"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-gc-size-limit", Aliases: []string{"attachment_gc_size_limit"}, EnvVars: []string{"NTFY_ATTACHMENT_GC_SIZE_LIMIT"}, Usage: "size the attachment cache is reduced to by the size strategy (default: 90% of attachment-total-size-limit)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "attachment-expiry-duration", Aliases: []string{"attachment_expiry_duration", "X"}, EnvVars: []string{"NTFY_ATTACHMENT_EXPIRY_DURATION"}, Value: util.FormatDuration(server.DefaultAttachmentExpiryDuration), Usage: "duration after which uploaded attachments will be deleted (e.g. 3h, 20h)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "template-dir", Aliases: []string{"template_dir"}, EnvVars: []string{"NTFY_TEMPLATE_DIR"}, Value: server.DefaultTemplateDir, Usage: "directory to load named message templates from"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "default-language", Aliases: []string{"default_language"}, EnvVars: []string{"NTFY_DEFAULT_LANGUAGE"}, Value: server.DefaultLanguage, Usage: "language of emails, phone calls and error messages, if not set by the user or client (e.g. en, de, fr)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "keepalive-interval", Aliases: []string{"keepalive_interval", "k"}, EnvVars: []string{"NTFY_KEEPALIVE_INTERVAL"}, Value: util.FormatDuration(server.DefaultKeepaliveInterval), Usage: "interval of keepalive messages"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "manager-interval", Aliases: []string{"manager_interval", "m"}, EnvVars: []string{"NTFY_MANAGER_INTERVAL"}, Value: util.FormatDuration(server.DefaultManagerInterval), Usage: "interval of for message pruning and stats printing"}),
 	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "disallowed-topics", Aliases: []string{"disallowed_topics"}, EnvVars: []string{"NTFY_DISALLOWED_TOPICS"}, Usage: "topics that are not allowed to be used"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "web-root", Aliases: []string{"web_root"}, EnvVars: []string{"NTFY_WEB_ROOT"}, Value: "/", Usage: "sets root of the web app (e.g. /, or /app), or disables it (disable)"}),
 	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "enable-signup", Aliases: []string{"enable_signup"}, EnvVars: []string{"NTFY_ENABLE_SIGNUP"}, Value: false, Usage: "allows users to sign up via the web app, or API"}),
 	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "enable-login", Aliases: []string{"enable_login"}, EnvVars: []string{"NTFY_ENABLE_LOGIN"}, Value: false, Usage: "allows users to log in via the web app, or API"}),
+	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "enable-password-reset", Aliases: []string{"enable_password_reset"}, EnvVars: []string{"NTFY_ENABLE_PASSWORD_RESET"}, Value: false, Usage: "allows users to reset their password via email, using the web app, or API"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "tier-expiry-grace-period", Aliases: []string{"tier_expiry_grace_period"}, EnvVars: []string{"NTFY_TIER_EXPIRY_GRACE_PERIOD"}, Value: "0", Usage: "time after a tier expired before the user is downgraded"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "tier-expiry-downgrade-tier", Aliases: []string{"tier_expiry_downgrade_tier"}, EnvVars: []string{"NTFY_TIER_EXPIRY_DOWNGRADE_TIER"}, Usage: "tier code users are downgraded to when their tier expires (default: no tier)"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "tier-expiry-warning-duration", Aliases: []string{"tier_expiry_warning_duration"}, EnvVars: []string{"NTFY_TIER_EXPIRY_WARNING_DURATION"}, Value: util.FormatDuration(server.DefaultTierExpiryWarningDuration), Usage: "warn users via email this long before their tier expires"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "tier-expiry-webhook-url", Aliases: []string{"tier_expiry_webhook_url"}, EnvVars: []string{"NTFY_TIER_EXPIRY_WEBHOOK_URL"}, Usage: "URL to POST tier expiry events to, e.g. for billing systems"}),
 	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "enable-reservations", Aliases: []string{"enable_reservations"}, EnvVars: []string{"NTFY_ENABLE_RESERVATIONS"}, Value: false, Usage: "allows users to reserve topics (if their tier allows it)"}),
 	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "require-login", Aliases: []string{"require_login"}, EnvVars: []string{"NTFY_REQUIRE_LOGIN"}, Value: false, Usage: "all actions via the web app requires a login"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "upstream-base-url", Aliases: []string{"upstream_base_url"}, EnvVars: []string{"NTFY_UPSTREAM_BASE_URL"}, Value: "", Usage: "forward poll request to an upstream server, this is needed for iOS push notifications for self-hosted servers"}),
@@ -69,38 +86,60 @@ var flagsServe = append(
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "smtp-sender-addr", Aliases: []string{"smtp_sender_addr"}, EnvVars: []string{"NTFY_SMTP_SENDER_ADDR"}, Usage: "SMTP server address (host:port) for outgoing emails"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "smtp-sender-user", Aliases: []string{"smtp_sender_user"}, EnvVars: []string{"NTFY_SMTP_SENDER_USER"}, Usage: "SMTP user (if e-mail sending is enabled)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "smtp-sender-pass", Aliases: []string{"smtp_sender_pass"}, EnvVars: []string{"NTFY_SMTP_SENDER_PASS"}, Usage: "SMTP password (if e-mail sending is enabled)"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "email-providers", Aliases: []string{"email_providers"}, EnvVars: []string{"NTFY_EMAIL_PROVIDERS"}, Usage: "API-based or SMTP providers for outgoing emails, tried in order, e.g. \"ses:us-east-1 access-key=... secret-key=... rate=14/1s\""}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "smtp-sender-from", Aliases: []string{"smtp_sender_from"}, EnvVars: []string{"NTFY_SMTP_SENDER_FROM"}, Usage: "SMTP sender address (if e-mail sending is enabled)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "smtp-server-listen", Aliases: []string{"smtp_server_listen"}, EnvVars: []string{"NTFY_SMTP_SERVER_LISTEN"}, Usage: "SMTP server address (ip:port) for incoming emails, e.g. :25"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "smtp-server-domain", Aliases: []string{"smtp_server_domain"}, EnvVars: []string{"NTFY_SMTP_SERVER_DOMAIN"}, Usage: "SMTP domain for incoming e-mail, e.g. ntfy.sh"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "smtp-server-addr-prefix", Aliases: []string{"smtp_server_addr_prefix"}, EnvVars: []string{"NTFY_SMTP_SERVER_ADDR_PREFIX"}, Usage: "SMTP email address prefix for topics to prevent spam (e.g. 'ntfy-')"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "smtp-server-html-format", Aliases: []string{"smtp_server_html_format"}, EnvVars: []string{"NTFY_SMTP_SERVER_HTML_FORMAT"}, Value: server.SMTPServerHTMLFormatText, Usage: "format of incoming HTML emails: 'text' (strip HTML tags) or 'markdown' (convert to Markdown)"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "syslog-listen", Aliases: []string{"syslog_listen"}, EnvVars: []string{"NTFY_SYSLOG_LISTEN"}, Usage: "UDP address (ip:port) of the syslog listener for incoming syslog datagrams, e.g. :514"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "syslog-rules", Aliases: []string{"syslog_rules"}, EnvVars: []string{"NTFY_SYSLOG_RULES"}, Usage: "rules mapping syslog datagrams to topics, first match wins, e.g. \"network-alerts facility=local0 severity=warning from=10.0.0.0/8\""}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "snmp-trap-listen", Aliases: []string{"snmp_trap_listen"}, EnvVars: []string{"NTFY_SNMP_TRAP_LISTEN"}, Usage: "UDP address (ip:port) of the SNMP trap listener for incoming SNMPv1/v2c traps, e.g. :162"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "snmp-trap-rules", Aliases: []string{"snmp_trap_rules"}, EnvVars: []string{"NTFY_SNMP_TRAP_RULES"}, Usage: "rules mapping SNMP traps to topics, first match wins, e.g. \"ups oid=1.3.6.1.4.1.318 community=public priority=5\""}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "snmp-trap-oid-names", Aliases: []string{"snmp_trap_oid_names"}, EnvVars: []string{"NTFY_SNMP_TRAP_OID_NAMES"}, Usage: "names of SNMP OIDs, used as trap titles and variable names, e.g. \"1.3.6.1.4.1.318.0.5=UPS on battery\""}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "twilio-account", Aliases: []string{"twilio_account"}, EnvVars: []string{"NTFY_TWILIO_ACCOUNT"}, Usage: "Twilio account SID, used for phone calls, e.g. AC123..."}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "twilio-auth-token", Aliases: []string{"twilio_auth_token"}, EnvVars: []string{"NTFY_TWILIO_AUTH_TOKEN"}, Usage: "Twilio auth token"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "twilio-phone-number", Aliases: []string{"twilio_phone_number"}, EnvVars: []string{"NTFY_TWILIO_PHONE_NUMBER"}, Usage: "Twilio number to use for outgoing calls"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "twilio-verify-service", Aliases: []string{"twilio_verify_service"}, EnvVars: []string{"NTFY_TWILIO_VERIFY_SERVICE"}, Usage: "Twilio Verify service ID, used for phone number verification"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "message-size-limit", Aliases: []string{"message_size_limit"}, EnvVars: []string{"NTFY_MESSAGE_SIZE_LIMIT"}, Value: util.FormatSize(server.DefaultMessageSizeLimit), Usage: "size limit for the message (see docs for limitations)"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "message-chunked-size-limit", Aliases: []string{"message_chunked_size_limit"}, EnvVars: []string{"NTFY_MESSAGE_CHUNKED_SIZE_LIMIT"}, Value: "0", Usage: "size limit for messages published in chunks, 0 disables chunked messages"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "message-delay-limit", Aliases: []string{"message_delay_limit"}, EnvVars: []string{"NTFY_MESSAGE_DELAY_LIMIT"}, Value: util.FormatDuration(server.DefaultMessageDelayMax), Usage: "max duration a message can be scheduled into the future"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "publish-routes", Aliases: []string{"publish_routes"}, EnvVars: []string{"NTFY_PUBLISH_ROUTES"}, Usage: "rules routing messages to other topics based on their content, first match wins, e.g. \"alerts alerts-db match=postgres\""}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "overload-fanout-threshold", Aliases: []string{"overload_fanout_threshold"}, EnvVars: []string{"NTFY_OVERLOAD_FANOUT_THRESHOLD"}, Value: 0, Usage: "number of messages waiting to be delivered to subscribers after which low-priority messages are rejected (0 = disabled)"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "overload-cache-threshold", Aliases: []string{"overload_cache_threshold"}, EnvVars: []string{"NTFY_OVERLOAD_CACHE_THRESHOLD"}, Value: 0, Usage: "number of messages waiting to be written to the message cache after which low-priority messages are rejected (0 = disabled)"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "hmac-topics", Aliases: []string{"hmac_topics"}, EnvVars: []string{"NTFY_HMAC_TOPICS"}, Usage: "topics that only accept messages signed with a shared secret, e.g. \"deployments <secret>\""}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "hmac-clock-skew", Aliases: []string{"hmac_clock_skew"}, EnvVars: []string{"NTFY_HMAC_CLOCK_SKEW"}, Value: util.FormatDuration(server.DefaultHMACClockSkew), Usage: "max. difference between the timestamp of a signed message and the server time"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "outbound-webhooks", Aliases: []string{"outbound_webhooks"}, EnvVars: []string{"NTFY_OUTBOUND_WEBHOOKS"}, Usage: "forward the messages of a topic to other services via HTTP POST, e.g. \"alerts https://hooks.slack.com/... template=slack\""}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "global-topic-limit", Aliases: []string{"global_topic_limit", "T"}, EnvVars: []string{"NTFY_GLOBAL_TOPIC_LIMIT"}, Value: server.DefaultTotalTopicLimit, Usage: "total number of topics allowed"}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-subscription-limit", Aliases: []string{"visitor_subscription_limit"}, EnvVars: []string{"NTFY_VISITOR_SUBSCRIPTION_LIMIT"}, Value: server.DefaultVisitorSubscriptionLimit, Usage: "number of subscriptions per visitor"}),
 	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "visitor-subscriber-rate-limiting", Aliases: []string{"visitor_subscriber_rate_limiting"}, EnvVars: []string{"NTFY_VISITOR_SUBSCRIBER_RATE_LIMITING"}, Value: false, Usage: "enables subscriber-based rate limiting"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "visitor-attachment-total-size-limit", Aliases: []string{"visitor_attachment_total_size_limit"}, EnvVars: []string{"NTFY_VISITOR_ATTACHMENT_TOTAL_SIZE_LIMIT"}, Value: util.FormatSize(server.DefaultVisitorAttachmentTotalSizeLimit), Usage: "total storage limit used for attachments per visitor"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "visitor-attachment-daily-bandwidth-limit", Aliases: []string{"visitor_attachment_daily_bandwidth_limit"}, EnvVars: []string{"NTFY_VISITOR_ATTACHMENT_DAILY_BANDWIDTH_LIMIT"}, Value: "500M", Usage: "total daily attachment download/upload bandwidth limit per visitor"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "visitor-attachment-allowed-types", Aliases: []string{"visitor_attachment_allowed_types"}, EnvVars: []string{"NTFY_VISITOR_ATTACHMENT_ALLOWED_TYPES"}, Usage: "allowed attachment MIME types for visitors without a tier, e.g. image/*,application/pdf (default: all)"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "visitor-attachment-denied-types", Aliases: []string{"visitor_attachment_denied_types"}, EnvVars: []string{"NTFY_VISITOR_ATTACHMENT_DENIED_TYPES"}, Usage: "denied attachment MIME types for visitors without a tier, e.g. video/*"}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-request-limit-burst", Aliases: []string{"visitor_request_limit_burst"}, EnvVars: []string{"NTFY_VISITOR_REQUEST_LIMIT_BURST"}, Value: server.DefaultVisitorRequestLimitBurst, Usage: "initial limit of requests per visitor"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "visitor-request-limit-replenish", Aliases: []string{"visitor_request_limit_replenish"}, EnvVars: []string{"NTFY_VISITOR_REQUEST_LIMIT_REPLENISH"}, Value: util.FormatDuration(server.DefaultVisitorRequestLimitReplenish), Usage: "interval at which burst limit is replenished (one per x)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "visitor-request-limit-exempt-hosts", Aliases: []string{"visitor_request_limit_exempt_hosts"}, EnvVars: []string{"NTFY_VISITOR_REQUEST_LIMIT_EXEMPT_HOSTS"}, Value: "", Usage: "hostnames and/or IP addresses of hosts that will be exempt from the visitor request limit"}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-message-daily-limit", Aliases: []string{"visitor_message_daily_limit"}, EnvVars: []string{"NTFY_VISITOR_MESSAGE_DAILY_LIMIT"}, Value: server.DefaultVisitorMessageDailyLimit, Usage: "max messages per visitor per day, derived from request limit if unset"}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-email-limit-burst", Aliases: []string{"visitor_email_limit_burst"}, EnvVars: []string{"NTFY_VISITOR_EMAIL_LIMIT_BURST"}, Value: server.DefaultVisitorEmailLimitBurst, Usage: "initial limit of e-mails per visitor"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "visitor-email-limit-replenish", Aliases: []string{"visitor_email_limit_replenish"}, EnvVars: []string{"NTFY_VISITOR_EMAIL_LIMIT_REPLENISH"}, Value: util.FormatDuration(server.DefaultVisitorEmailLimitReplenish), Usage: "interval at which burst limit is replenished (one per x)"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-account-creation-limit-burst", Aliases: []string{"visitor_account_creation_limit_burst"}, EnvVars: []string{"NTFY_VISITOR_ACCOUNT_CREATION_LIMIT_BURST"}, Value: server.DefaultVisitorAccountCreationLimitBurst, Usage: "initial limit of account creations per visitor"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-auth-failure-limit-burst", Aliases: []string{"visitor_auth_failure_limit_burst"}, EnvVars: []string{"NTFY_VISITOR_AUTH_FAILURE_LIMIT_BURST"}, Value: server.DefaultVisitorAuthFailureLimitBurst, Usage: "initial limit of failed login attempts per visitor"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-password-reset-limit-burst", Aliases: []string{"visitor_password_reset_limit_burst"}, EnvVars: []string{"NTFY_VISITOR_PASSWORD_RESET_LIMIT_BURST"}, Value: server.DefaultVisitorPasswordResetLimitBurst, Usage: "initial limit of password reset e-mails per visitor"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "visitor-rate-limit-algorithm", Aliases: []string{"visitor_rate_limit_algorithm"}, EnvVars: []string{"NTFY_VISITOR_RATE_LIMIT_ALGORITHM"}, Usage: "rate limiting algorithm (token-bucket, sliding-window or gcra), for all or individual limits, e.g. \"gcra\" or \"request=sliding-window\""}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-prefix-bits-ipv4", Aliases: []string{"visitor_prefix_bits_ipv4"}, EnvVars: []string{"NTFY_VISITOR_PREFIX_BITS_IPV4"}, Value: server.DefaultVisitorPrefixBitsIPv4, Usage: "number of bits of the IPv4 address to use for rate limiting (default: 32, full address)"}),
 	altsrc.NewIntFlag(&cli.IntFlag{Name: "visitor-prefix-bits-ipv6", Aliases: []string{"visitor_prefix_bits_ipv6"}, EnvVars: []string{"NTFY_VISITOR_PREFIX_BITS_IPV6"}, Value: server.DefaultVisitorPrefixBitsIPv6, Usage: "number of bits of the IPv6 address to use for rate limiting (default: 64, /64 subnet)"}),
 	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "behind-proxy", Aliases: []string{"behind_proxy", "P"}, EnvVars: []string{"NTFY_BEHIND_PROXY"}, Value: false, Usage: "if set, use forwarded header (e.g. X-Forwarded-For, X-Client-IP) to determine visitor IP address (for rate limiting)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "proxy-forwarded-header", Aliases: []string{"proxy_forwarded_header"}, EnvVars: []string{"NTFY_PROXY_FORWARDED_HEADER"}, Value: "X-Forwarded-For", Usage: "use specified header to determine visitor IP address (for rate limiting)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "proxy-trusted-hosts", Aliases: []string{"proxy_trusted_hosts"}, EnvVars: []string{"NTFY_PROXY_TRUSTED_HOSTS"}, Value: "", Usage: "comma-separated list of trusted IP addresses, hosts, or CIDRs to remove from forwarded header"}),
+	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "proxy-protocol", Aliases: []string{"proxy_protocol"}, EnvVars: []string{"NTFY_PROXY_PROTOCOL"}, Value: false, Usage: "if set, accept the PROXY protocol (v1/v2) header on the HTTP(S) and SMTP listeners to determine visitor IP address (for rate limiting)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "stripe-secret-key", Aliases: []string{"stripe_secret_key"}, EnvVars: []string{"NTFY_STRIPE_SECRET_KEY"}, Value: "", Usage: "key used for the Stripe API communication, this enables payments"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "stripe-webhook-key", Aliases: []string{"stripe_webhook_key"}, EnvVars: []string{"NTFY_STRIPE_WEBHOOK_KEY"}, Value: "", Usage: "key required to validate the authenticity of incoming webhooks from Stripe"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "billing-contact", Aliases: []string{"billing_contact"}, EnvVars: []string{"NTFY_BILLING_CONTACT"}, Value: "", Usage: "e-mail or website to display in upgrade dialog (only if payments are enabled)"}),
 	altsrc.NewBoolFlag(&cli.BoolFlag{Name: "enable-metrics", Aliases: []string{"enable_metrics"}, EnvVars: []string{"NTFY_ENABLE_METRICS"}, Value: false, Usage: "if set, Prometheus metrics are exposed via the /metrics endpoint"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "metrics-listen-http", Aliases: []string{"metrics_listen_http"}, EnvVars: []string{"NTFY_METRICS_LISTEN_HTTP"}, Usage: "ip:port used to expose the metrics endpoint (implicitly enables metrics)"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "profile-listen-http", Aliases: []string{"profile_listen_http"}, EnvVars: []string{"NTFY_PROFILE_LISTEN_HTTP"}, Usage: "ip:port used to expose the profiling endpoints (implicitly enables profiling)"}),
+	altsrc.NewStringFlag(&cli.StringFlag{Name: "log-level-revert-after", Aliases: []string{"log_level_revert_after"}, EnvVars: []string{"NTFY_LOG_LEVEL_REVERT_AFTER"}, Value: util.FormatDuration(server.DefaultLogLevelRevertAfter), Usage: "duration after which a log level changed at runtime (via SIGUSR1/SIGUSR2 or API) is reverted"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "web-push-public-key", Aliases: []string{"web_push_public_key"}, EnvVars: []string{"NTFY_WEB_PUSH_PUBLIC_KEY"}, Usage: "public key used for web push notifications"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "web-push-private-key", Aliases: []string{"web_push_private_key"}, EnvVars: []string{"NTFY_WEB_PUSH_PRIVATE_KEY"}, Usage: "private key used for web push notifications"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "web-push-file", Aliases: []string{"web_push_file"}, EnvVars: []string{"NTFY_WEB_PUSH_FILE"}, Usage: "file used to store web push subscriptions"}),
@@ -146,10 +185,15 @@ func execServe(c *cli.Context) error {
 	baseURL := strings.TrimSuffix(c.String("base-url"), "/")
 	listenHTTP := c.String("listen-http")
 	listenHTTPS := c.String("listen-https")
+	listenHTTP3 := c.String("listen-http3")
 	listenUnix := c.String("listen-unix")
 	listenUnixMode := c.Int("listen-unix-mode")
 	keyFile := c.String("key-file")
 	certFile := c.String("cert-file")
+	acmeDomains := c.StringSlice("acme-domains")
+	acmeEmail := c.String("acme-email")
+	acmeCacheDir := c.String("acme-cache-dir")
+	acmeDirectoryURL := c.String("acme-directory-url")
 	firebaseKeyFile := c.String("firebase-key-file")
 	webPushPrivateKey := c.String("web-push-private-key")
 	webPushPublicKey := c.String("web-push-public-key")
@@ -163,17 +207,24 @@ func execServe(c *cli.Context) error {
 	cacheStartupQueries := c.String("cache-startup-queries")
 	cacheBatchSize := c.Int("cache-batch-size")
 	cacheBatchTimeoutStr := c.String("cache-batch-timeout")
+	cacheExpirationEvents := c.Bool("cache-expiration-events")
 	authFile := c.String("auth-file")
 	authStartupQueries := c.String("auth-startup-queries")
 	authDefaultAccess := c.String("auth-default-access")
 	authUsersRaw := c.StringSlice("auth-users")
 	authAccessRaw := c.StringSlice("auth-access")
 	authTokensRaw := c.StringSlice("auth-tokens")
+	authAccessTemplatesRaw := c.StringSlice("auth-access-templates")
+	authBcryptCost := c.Int("auth-bcrypt-cost")
+	authCacheTTLStr := c.String("auth-cache-ttl")
 	attachmentCacheDir := c.String("attachment-cache-dir")
 	attachmentTotalSizeLimitStr := c.String("attachment-total-size-limit")
 	attachmentFileSizeLimitStr := c.String("attachment-file-size-limit")
 	attachmentExpiryDurationStr := c.String("attachment-expiry-duration")
+	attachmentGCStrategiesRaw := c.StringSlice("attachment-gc-strategies")
+	attachmentGCSizeLimitStr := c.String("attachment-gc-size-limit")
 	templateDir := c.String("template-dir")
+	defaultLanguage := c.String("default-language")
 	keepaliveIntervalStr := c.String("keepalive-interval")
 	managerIntervalStr := c.String("manager-interval")
 	disallowedTopics := c.StringSlice("disallowed-topics")
@@ -181,50 +232,81 @@ func execServe(c *cli.Context) error {
 	enableSignup := c.Bool("enable-signup")
 	enableLogin := c.Bool("enable-login")
 	requireLogin := c.Bool("require-login")
+	enablePasswordReset := c.Bool("enable-password-reset")
 	enableReservations := c.Bool("enable-reservations")
+	tierExpiryGracePeriodStr := c.String("tier-expiry-grace-period")
+	tierExpiryDowngradeTier := c.String("tier-expiry-downgrade-tier")
+	tierExpiryWarningDurationStr := c.String("tier-expiry-warning-duration")
+	tierExpiryWebhookURL := c.String("tier-expiry-webhook-url")
 	upstreamBaseURL := c.String("upstream-base-url")
 	upstreamAccessToken := c.String("upstream-access-token")
 	smtpSenderAddr := c.String("smtp-sender-addr")
 	smtpSenderUser := c.String("smtp-sender-user")
 	smtpSenderPass := c.String("smtp-sender-pass")
 	smtpSenderFrom := c.String("smtp-sender-from")
+	emailProvidersRaw := c.StringSlice("email-providers")
 	smtpServerListen := c.String("smtp-server-listen")
 	smtpServerDomain := c.String("smtp-server-domain")
 	smtpServerAddrPrefix := c.String("smtp-server-addr-prefix")
+	smtpServerHTMLFormat := c.String("smtp-server-html-format")
+	syslogListen := c.String("syslog-listen")
+	syslogRulesRaw := c.StringSlice("syslog-rules")
+	snmpTrapListen := c.String("snmp-trap-listen")
+	snmpTrapRulesRaw := c.StringSlice("snmp-trap-rules")
+	snmpTrapOIDNamesRaw := c.StringSlice("snmp-trap-oid-names")
 	twilioAccount := c.String("twilio-account")
 	twilioAuthToken := c.String("twilio-auth-token")
 	twilioPhoneNumber := c.String("twilio-phone-number")
 	twilioVerifyService := c.String("twilio-verify-service")
 	messageSizeLimitStr := c.String("message-size-limit")
+	messageChunkedSizeLimitStr := c.String("message-chunked-size-limit")
 	messageDelayLimitStr := c.String("message-delay-limit")
+	publishRoutesRaw := c.StringSlice("publish-routes")
+	overloadFanoutThreshold := c.Int("overload-fanout-threshold")
+	overloadCacheThreshold := c.Int("overload-cache-threshold")
+	hmacTopicsRaw := c.StringSlice("hmac-topics")
+	hmacClockSkewStr := c.String("hmac-clock-skew")
+	outboundWebhooksRaw := c.StringSlice("outbound-webhooks")
 	totalTopicLimit := c.Int("global-topic-limit")
 	visitorSubscriptionLimit := c.Int("visitor-subscription-limit")
 	visitorSubscriberRateLimiting := c.Bool("visitor-subscriber-rate-limiting")
 	visitorAttachmentTotalSizeLimitStr := c.String("visitor-attachment-total-size-limit")
 	visitorAttachmentDailyBandwidthLimitStr := c.String("visitor-attachment-daily-bandwidth-limit")
+	visitorAttachmentAllowedTypesRaw := c.StringSlice("visitor-attachment-allowed-types")
+	visitorAttachmentDeniedTypesRaw := c.StringSlice("visitor-attachment-denied-types")
 	visitorRequestLimitBurst := c.Int("visitor-request-limit-burst")
 	visitorRequestLimitReplenishStr := c.String("visitor-request-limit-replenish")
 	visitorRequestLimitExemptHosts := util.SplitNoEmpty(c.String("visitor-request-limit-exempt-hosts"), ",")
 	visitorMessageDailyLimit := c.Int("visitor-message-daily-limit")
 	visitorEmailLimitBurst := c.Int("visitor-email-limit-burst")
 	visitorEmailLimitReplenishStr := c.String("visitor-email-limit-replenish")
+	visitorAccountCreationLimitBurst := c.Int("visitor-account-creation-limit-burst")
+	visitorAuthFailureLimitBurst := c.Int("visitor-auth-failure-limit-burst")
+	visitorPasswordResetLimitBurst := c.Int("visitor-password-reset-limit-burst")
+	visitorRateLimitAlgorithmsRaw := c.StringSlice("visitor-rate-limit-algorithm")
 	visitorPrefixBitsIPv4 := c.Int("visitor-prefix-bits-ipv4")
 	visitorPrefixBitsIPv6 := c.Int("visitor-prefix-bits-ipv6")
 	behindProxy := c.Bool("behind-proxy")
 	proxyForwardedHeader := c.String("proxy-forwarded-header")
 	proxyTrustedHosts := util.SplitNoEmpty(c.String("proxy-trusted-hosts"), ",")
+	proxyProtocol := c.Bool("proxy-protocol")
 	stripeSecretKey := c.String("stripe-secret-key")
 	stripeWebhookKey := c.String("stripe-webhook-key")
 	billingContact := c.String("billing-contact")
 	metricsListenHTTP := c.String("metrics-listen-http")
 	enableMetrics := c.Bool("enable-metrics") || metricsListenHTTP != ""
 	profileListenHTTP := c.String("profile-listen-http")
+	logLevelRevertAfterStr := c.String("log-level-revert-after")
 
 	// Convert durations
 	cacheDuration, err := util.ParseDuration(cacheDurationStr)
 	if err != nil {
 		return fmt.Errorf("invalid cache duration: %s", cacheDurationStr)
 	}
+	authCacheTTL, err := util.ParseDuration(authCacheTTLStr)
+	if err != nil {
+		return fmt.Errorf("invalid auth cache TTL: %s", authCacheTTLStr)
+	}
 	cacheBatchTimeout, err := util.ParseDuration(cacheBatchTimeoutStr)
 	if err != nil {
 		return fmt.Errorf("invalid cache batch timeout: %s", cacheBatchTimeoutStr)
@@ -245,6 +327,18 @@ func execServe(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("invalid message delay limit: %s", messageDelayLimitStr)
 	}
+	hmacClockSkew, err := util.ParseDuration(hmacClockSkewStr)
+	if err != nil {
+		return fmt.Errorf("invalid HMAC clock skew: %s", hmacClockSkewStr)
+	}
+	tierExpiryGracePeriod, err := util.ParseDuration(tierExpiryGracePeriodStr)
+	if err != nil {
+		return fmt.Errorf("invalid tier expiry grace period: %s", tierExpiryGracePeriodStr)
+	}
+	tierExpiryWarningDuration, err := util.ParseDuration(tierExpiryWarningDurationStr)
+	if err != nil {
+		return fmt.Errorf("invalid tier expiry warning duration: %s", tierExpiryWarningDurationStr)
+	}
 	visitorRequestLimitReplenish, err := util.ParseDuration(visitorRequestLimitReplenishStr)
 	if err != nil {
 		return fmt.Errorf("invalid visitor request limit replenish: %s", visitorRequestLimitReplenishStr)
@@ -253,6 +347,10 @@ func execServe(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("invalid visitor email limit replenish: %s", visitorEmailLimitReplenishStr)
 	}
+	visitorRateLimitAlgorithm, visitorRateLimitAlgorithms, err := parseVisitorRateLimitAlgorithms(visitorRateLimitAlgorithmsRaw)
+	if err != nil {
+		return err
+	}
 	webPushExpiryDuration, err := util.ParseDuration(webPushExpiryDurationStr)
 	if err != nil {
 		return fmt.Errorf("invalid web push expiry duration: %s", webPushExpiryDurationStr)
@@ -261,12 +359,20 @@ func execServe(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("invalid web push expiry warning duration: %s", webPushExpiryWarningDurationStr)
 	}
+	logLevelRevertAfter, err := util.ParseDuration(logLevelRevertAfterStr)
+	if err != nil || logLevelRevertAfter <= 0 {
+		return fmt.Errorf("invalid log level revert after duration: %s", logLevelRevertAfterStr)
+	}
 
 	// Convert sizes to bytes
 	messageSizeLimit, err := util.ParseSize(messageSizeLimitStr)
 	if err != nil {
 		return fmt.Errorf("invalid message size limit: %s", messageSizeLimitStr)
 	}
+	messageChunkedSizeLimit, err := util.ParseSize(messageChunkedSizeLimitStr)
+	if err != nil {
+		return fmt.Errorf("invalid message chunked size limit: %s", messageChunkedSizeLimitStr)
+	}
 	attachmentTotalSizeLimit, err := util.ParseSize(attachmentTotalSizeLimitStr)
 	if err != nil {
 		return fmt.Errorf("invalid attachment total size limit: %s", attachmentTotalSizeLimitStr)
@@ -275,6 +381,62 @@ func execServe(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("invalid attachment file size limit: %s", attachmentFileSizeLimitStr)
 	}
+	emailProviders := make([]*server.EmailProvider, 0)
+	for _, spec := range emailProvidersRaw {
+		provider, err := server.ParseEmailProvider(spec)
+		if err != nil {
+			return err
+		}
+		emailProviders = append(emailProviders, provider)
+	}
+	syslogRules := make([]*server.SyslogRule, 0)
+	for _, spec := range syslogRulesRaw {
+		rule, err := server.ParseSyslogRule(spec)
+		if err != nil {
+			return err
+		}
+		syslogRules = append(syslogRules, rule)
+	}
+	publishRoutes := make([]*server.PublishRoute, 0)
+	for _, spec := range publishRoutesRaw {
+		route, err := server.ParsePublishRoute(spec)
+		if err != nil {
+			return err
+		}
+		publishRoutes = append(publishRoutes, route)
+	}
+	hmacTopics := make([]*server.HMACTopic, 0)
+	for _, spec := range hmacTopicsRaw {
+		topic, err := server.ParseHMACTopic(spec)
+		if err != nil {
+			return err
+		}
+		hmacTopics = append(hmacTopics, topic)
+	}
+	outboundWebhooks := make([]*server.OutboundWebhook, 0)
+	for _, spec := range outboundWebhooksRaw {
+		webhook, err := server.ParseOutboundWebhook(spec)
+		if err != nil {
+			return err
+		}
+		outboundWebhooks = append(outboundWebhooks, webhook)
+	}
+	snmpTrapRules := make([]*server.SNMPTrapRule, 0)
+	for _, spec := range snmpTrapRulesRaw {
+		rule, err := server.ParseSNMPTrapRule(spec)
+		if err != nil {
+			return err
+		}
+		snmpTrapRules = append(snmpTrapRules, rule)
+	}
+	snmpTrapOIDNames, err := server.ParseSNMPTrapOIDNames(snmpTrapOIDNamesRaw)
+	if err != nil {
+		return err
+	}
+	attachmentGCStrategies, attachmentGCSizeLimit, err := parseAttachmentGCOptions(attachmentGCStrategiesRaw, attachmentGCSizeLimitStr, attachmentTotalSizeLimit)
+	if err != nil {
+		return err
+	}
 	visitorAttachmentTotalSizeLimit, err := util.ParseSize(visitorAttachmentTotalSizeLimitStr)
 	if err != nil {
 		return fmt.Errorf("invalid visitor attachment total size limit: %s", visitorAttachmentTotalSizeLimitStr)
@@ -285,6 +447,14 @@ func execServe(c *cli.Context) error {
 	} else if visitorAttachmentDailyBandwidthLimit > math.MaxInt {
 		return fmt.Errorf("config option visitor-attachment-daily-bandwidth-limit must be lower than %d", math.MaxInt)
 	}
+	visitorAttachmentAllowedTypes, err := parseContentTypePatterns(strings.Join(visitorAttachmentAllowedTypesRaw, ","))
+	if err != nil {
+		return fmt.Errorf("invalid visitor-attachment-allowed-types: %w", err)
+	}
+	visitorAttachmentDeniedTypes, err := parseContentTypePatterns(strings.Join(visitorAttachmentDeniedTypesRaw, ","))
+	if err != nil {
+		return fmt.Errorf("invalid visitor-attachment-denied-types: %w", err)
+	}
 
 	// Check values
 	if firebaseKeyFile != "" && !util.FileExists(firebaseKeyFile) {
@@ -303,12 +473,30 @@ func execServe(c *cli.Context) error {
 		return errors.New("if set, key file must exist")
 	} else if certFile != "" && !util.FileExists(certFile) {
 		return errors.New("if set, certificate file must exist")
-	} else if listenHTTPS != "" && (keyFile == "" || certFile == "") {
-		return errors.New("if listen-https is set, both key-file and cert-file must be set")
-	} else if smtpSenderAddr != "" && (baseURL == "" || smtpSenderFrom == "") {
-		return errors.New("if smtp-sender-addr is set, base-url, and smtp-sender-from must also be set")
+	} else if len(acmeDomains) > 0 && (keyFile != "" || certFile != "") {
+		return errors.New("if acme-domains is set, key-file and cert-file must not be set")
+	} else if len(acmeDomains) > 0 && listenHTTPS == "" {
+		return errors.New("if acme-domains is set, listen-https must also be set")
+	} else if len(acmeDomains) > 0 && acmeCacheDir == "" {
+		return errors.New("if acme-domains is set, acme-cache-dir must also be set")
+	} else if len(acmeDomains) == 0 && (acmeEmail != "" || acmeCacheDir != "" || acmeDirectoryURL != "") {
+		return errors.New("if acme-email, acme-cache-dir or acme-directory-url is set, acme-domains must also be set")
+	} else if listenHTTPS != "" && len(acmeDomains) == 0 && (keyFile == "" || certFile == "") {
+		return errors.New("if listen-https is set, both key-file and cert-file (or acme-domains) must be set")
+	} else if listenHTTP3 != "" && len(acmeDomains) == 0 && (keyFile == "" || certFile == "") {
+		return errors.New("if listen-http3 is set, both key-file and cert-file (or acme-domains) must be set")
+	} else if !server.IsSupportedLanguage(defaultLanguage) {
+		return fmt.Errorf("if set, default-language must be a supported language, e.g. en, de or fr: %s", defaultLanguage)
+	} else if (smtpSenderAddr != "" || len(emailProvidersRaw) > 0) && (baseURL == "" || smtpSenderFrom == "") {
+		return errors.New("if smtp-sender-addr or email-providers is set, base-url, and smtp-sender-from must also be set")
 	} else if smtpServerListen != "" && smtpServerDomain == "" {
 		return errors.New("if smtp-server-listen is set, smtp-server-domain must also be set")
+	} else if smtpServerHTMLFormat != server.SMTPServerHTMLFormatText && smtpServerHTMLFormat != server.SMTPServerHTMLFormatMarkdown {
+		return errors.New("if set, smtp-server-html-format must be 'text' or 'markdown'")
+	} else if syslogListen != "" && len(syslogRulesRaw) == 0 {
+		return errors.New("if syslog-listen is set, syslog-rules must also be set")
+	} else if snmpTrapListen != "" && len(snmpTrapRulesRaw) == 0 {
+		return errors.New("if snmp-trap-listen is set, snmp-trap-rules must also be set")
 	} else if attachmentCacheDir != "" && baseURL == "" {
 		return errors.New("if attachment-cache-dir is set, base-url must also be set")
 	} else if baseURL != "" {
@@ -334,12 +522,22 @@ func execServe(c *cli.Context) error {
 		return errors.New("cannot set enable-signup without also setting enable-login")
 	} else if requireLogin && !enableLogin {
 		return errors.New("cannot set require-login without also setting enable-login")
+	} else if enablePasswordReset && (!enableLogin || (smtpSenderAddr == "" && len(emailProvidersRaw) == 0) || baseURL == "") {
+		return errors.New("if enable-password-reset is set, enable-login, smtp-sender-addr (or email-providers), and base-url must also be set")
+	} else if authBcryptCost < user.DefaultUserPasswordBcryptCost || authBcryptCost > user.MaxUserPasswordBcryptCost {
+		return fmt.Errorf("if set, auth-bcrypt-cost must be between %d and %d", user.DefaultUserPasswordBcryptCost, user.MaxUserPasswordBcryptCost)
+	} else if tierExpiryWebhookURL != "" && !strings.HasPrefix(tierExpiryWebhookURL, "http://") && !strings.HasPrefix(tierExpiryWebhookURL, "https://") {
+		return errors.New("if set, tier-expiry-webhook-url must start with http:// or https://")
 	} else if !payments.Available && (stripeSecretKey != "" || stripeWebhookKey != "") {
 		return errors.New("cannot set stripe-secret-key or stripe-webhook-key, support for payments is not available in this build (nopayments)")
 	} else if stripeSecretKey != "" && (stripeWebhookKey == "" || baseURL == "") {
 		return errors.New("if stripe-secret-key is set, stripe-webhook-key and base-url must also be set")
 	} else if twilioAccount != "" && (twilioAuthToken == "" || twilioPhoneNumber == "" || twilioVerifyService == "" || baseURL == "" || authFile == "") {
 		return errors.New("if twilio-account is set, twilio-auth-token, twilio-phone-number, twilio-verify-service, base-url, and auth-file must also be set")
+	} else if messageChunkedSizeLimit > 0 && messageChunkedSizeLimit <= messageSizeLimit {
+		return errors.New("if message-chunked-size-limit is set, it must be greater than message-size-limit")
+	} else if messageChunkedSizeLimit > 5*1024*1024 {
+		return errors.New("message-chunked-size-limit cannot be higher than 5M")
 	} else if messageSizeLimit > server.DefaultMessageSizeLimit {
 		log.Warn("message-size-limit is greater than 4K, this is not recommended and largely untested, and may lead to issues with some clients")
 		if messageSizeLimit > 5*1024*1024 {
@@ -355,6 +553,10 @@ func execServe(c *cli.Context) error {
 		return errors.New("visitor-prefix-bits-ipv4 must be between 1 and 32")
 	} else if visitorPrefixBitsIPv6 < 1 || visitorPrefixBitsIPv6 > 128 {
 		return errors.New("visitor-prefix-bits-ipv6 must be between 1 and 128")
+	} else if overloadFanoutThreshold < 0 || overloadCacheThreshold < 0 {
+		return errors.New("overload-fanout-threshold and overload-cache-threshold cannot be negative")
+	} else if len(hmacTopics) > 0 && hmacClockSkew <= 0 {
+		return errors.New("if hmac-topics is set, hmac-clock-skew must be positive")
 	}
 
 	// Backwards compatibility
@@ -385,6 +587,10 @@ func execServe(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	authAccessTemplates, err := parseAccessTemplates(authAccessTemplatesRaw)
+	if err != nil {
+		return err
+	}
 
 	// Special case: Unset default
 	if listenHTTP == "-" {
@@ -396,7 +602,7 @@ func execServe(c *cli.Context) error {
 	for _, host := range visitorRequestLimitExemptHosts {
 		prefixes, err := parseIPHostPrefix(host)
 		if err != nil {
-			log.Warn("cannot resolve host %s: %s, ignoring visitor request exemption", host, err.Error())
+			log.Err(err).Warn("cannot resolve host %s, ignoring visitor request exemption", host)
 			continue
 		}
 		visitorRequestLimitExemptPrefixes = append(visitorRequestLimitExemptPrefixes, prefixes...)
@@ -426,27 +632,39 @@ func execServe(c *cli.Context) error {
 	conf.BaseURL = baseURL
 	conf.ListenHTTP = listenHTTP
 	conf.ListenHTTPS = listenHTTPS
+	conf.ListenHTTP3 = listenHTTP3
 	conf.ListenUnix = listenUnix
 	conf.ListenUnixMode = fs.FileMode(listenUnixMode)
 	conf.KeyFile = keyFile
 	conf.CertFile = certFile
+	conf.ACMEDomains = acmeDomains
+	conf.ACMEEmail = acmeEmail
+	conf.ACMECacheDir = acmeCacheDir
+	conf.ACMEDirectoryURL = acmeDirectoryURL
 	conf.FirebaseKeyFile = firebaseKeyFile
 	conf.CacheFile = cacheFile
 	conf.CacheDuration = cacheDuration
 	conf.CacheStartupQueries = cacheStartupQueries
 	conf.CacheBatchSize = cacheBatchSize
 	conf.CacheBatchTimeout = cacheBatchTimeout
+	conf.CacheExpirationEvents = cacheExpirationEvents
 	conf.AuthFile = authFile
 	conf.AuthStartupQueries = authStartupQueries
 	conf.AuthDefault = authDefault
 	conf.AuthUsers = authUsers
 	conf.AuthAccess = authAccess
 	conf.AuthTokens = authTokens
+	conf.AuthAccessTemplates = authAccessTemplates
+	conf.AuthBcryptCost = authBcryptCost
+	conf.AuthCacheTTL = authCacheTTL
 	conf.AttachmentCacheDir = attachmentCacheDir
 	conf.AttachmentTotalSizeLimit = attachmentTotalSizeLimit
 	conf.AttachmentFileSizeLimit = attachmentFileSizeLimit
 	conf.AttachmentExpiryDuration = attachmentExpiryDuration
+	conf.AttachmentGCStrategies = attachmentGCStrategies
+	conf.AttachmentGCSizeLimit = attachmentGCSizeLimit
 	conf.TemplateDir = templateDir
+	conf.DefaultLanguage = defaultLanguage
 	conf.KeepaliveInterval = keepaliveInterval
 	conf.ManagerInterval = managerInterval
 	conf.DisallowedTopics = disallowedTopics
@@ -457,41 +675,69 @@ func execServe(c *cli.Context) error {
 	conf.SMTPSenderUser = smtpSenderUser
 	conf.SMTPSenderPass = smtpSenderPass
 	conf.SMTPSenderFrom = smtpSenderFrom
+	conf.EmailProviders = emailProviders
 	conf.SMTPServerListen = smtpServerListen
 	conf.SMTPServerDomain = smtpServerDomain
 	conf.SMTPServerAddrPrefix = smtpServerAddrPrefix
+	conf.SMTPServerHTMLFormat = smtpServerHTMLFormat
+	conf.SyslogListen = syslogListen
+	conf.SyslogRules = syslogRules
+	conf.SNMPTrapListen = snmpTrapListen
+	conf.SNMPTrapRules = snmpTrapRules
+	conf.SNMPTrapOIDNames = snmpTrapOIDNames
 	conf.TwilioAccount = twilioAccount
 	conf.TwilioAuthToken = twilioAuthToken
 	conf.TwilioPhoneNumber = twilioPhoneNumber
 	conf.TwilioVerifyService = twilioVerifyService
 	conf.MessageSizeLimit = int(messageSizeLimit)
+	conf.MessageChunkedSizeLimit = int(messageChunkedSizeLimit)
 	conf.MessageDelayMax = messageDelayLimit
+	conf.PublishRoutes = publishRoutes
+	conf.OverloadFanoutThreshold = overloadFanoutThreshold
+	conf.OverloadCacheThreshold = overloadCacheThreshold
+	conf.HMACTopics = hmacTopics
+	conf.HMACClockSkew = hmacClockSkew
+	conf.OutboundWebhooks = outboundWebhooks
 	conf.TotalTopicLimit = totalTopicLimit
 	conf.VisitorSubscriptionLimit = visitorSubscriptionLimit
 	conf.VisitorSubscriberRateLimiting = visitorSubscriberRateLimiting
 	conf.VisitorAttachmentTotalSizeLimit = visitorAttachmentTotalSizeLimit
 	conf.VisitorAttachmentDailyBandwidthLimit = visitorAttachmentDailyBandwidthLimit
+	conf.VisitorAttachmentAllowedTypes = visitorAttachmentAllowedTypes
+	conf.VisitorAttachmentDeniedTypes = visitorAttachmentDeniedTypes
 	conf.VisitorRequestLimitBurst = visitorRequestLimitBurst
 	conf.VisitorRequestLimitReplenish = visitorRequestLimitReplenish
 	conf.VisitorRequestExemptPrefixes = visitorRequestLimitExemptPrefixes
 	conf.VisitorMessageDailyLimit = visitorMessageDailyLimit
 	conf.VisitorEmailLimitBurst = visitorEmailLimitBurst
 	conf.VisitorEmailLimitReplenish = visitorEmailLimitReplenish
+	conf.VisitorAccountCreationLimitBurst = visitorAccountCreationLimitBurst
+	conf.VisitorAuthFailureLimitBurst = visitorAuthFailureLimitBurst
+	conf.VisitorPasswordResetLimitBurst = visitorPasswordResetLimitBurst
+	conf.VisitorRateLimitAlgorithm = visitorRateLimitAlgorithm
+	conf.VisitorRateLimitAlgorithms = visitorRateLimitAlgorithms
 	conf.VisitorPrefixBitsIPv4 = visitorPrefixBitsIPv4
 	conf.VisitorPrefixBitsIPv6 = visitorPrefixBitsIPv6
 	conf.BehindProxy = behindProxy
 	conf.ProxyForwardedHeader = proxyForwardedHeader
 	conf.ProxyTrustedPrefixes = trustedProxyPrefixes
+	conf.ProxyProtocol = proxyProtocol
 	conf.StripeSecretKey = stripeSecretKey
 	conf.StripeWebhookKey = stripeWebhookKey
 	conf.BillingContact = billingContact
 	conf.EnableSignup = enableSignup
 	conf.EnableLogin = enableLogin
 	conf.RequireLogin = requireLogin
+	conf.EnablePasswordReset = enablePasswordReset
 	conf.EnableReservations = enableReservations
+	conf.TierExpiryGracePeriod = tierExpiryGracePeriod
+	conf.TierExpiryDowngradeTier = tierExpiryDowngradeTier
+	conf.TierExpiryWarningDuration = tierExpiryWarningDuration
+	conf.TierExpiryWebhookURL = tierExpiryWebhookURL
 	conf.EnableMetrics = enableMetrics
 	conf.MetricsListenHTTP = metricsListenHTTP
 	conf.ProfileListenHTTP = profileListenHTTP
+	conf.LogLevelRevertAfter = logLevelRevertAfter
 	conf.WebPushPrivateKey = webPushPrivateKey
 	conf.WebPushPublicKey = webPushPublicKey
 	conf.WebPushFile = webPushFile
@@ -503,9 +749,10 @@ func execServe(c *cli.Context) error {
 
 	// Set up hot-reloading of config
 	go sigHandlerConfigReload(config)
+	go sigHandlerLogLevel(logLevelRevertAfter)
 
 	// Run server
-	s, err := server.New(conf)
+	s, err := server.New(server.WithConfig(conf))
 	if err != nil {
 		log.Fatal("%s", err.Error())
 	} else if err := s.Run(); err != nil {
@@ -526,11 +773,11 @@ func sigHandlerConfigReload(config string) {
 		log.Info("Partially hot reloading configuration ...")
 		inputSource, err := newYamlSourceFromFile(config, flagsServe)
 		if err != nil {
-			log.Warn("Hot reload failed: %s", err.Error())
+			log.Err(err).Warn("Hot reload failed")
 			continue
 		}
 		if err := reloadLogLevel(inputSource); err != nil {
-			log.Warn("Reloading log level failed: %s", err.Error())
+			log.Err(err).Warn("Reloading log level failed")
 		}
 	}
 }
@@ -569,6 +816,80 @@ func parseIPHostPrefix(host string) (prefixes []netip.Prefix, err error) {
 	return
 }
 
+// parseVisitorRateLimitAlgorithms parses a list of rate limiting algorithms, either in the format "algorithm"
+// (applies to all visitor rate limits), or "limit=algorithm" (applies to one limit, e.g. "request=gcra").
+//
+// Parameters:
+//   - algorithmsRaw: A slice of algorithm strings.
+//
+// Returns:
+//   - algorithm: The algorithm for all limits, server.DefaultVisitorRateLimitAlgorithm if not set.
+//   - algorithms: A map of limit type (e.g. server.VisitorRateLimitRequest) to algorithm.
+//   - err: An error if parsing fails.
+func parseVisitorRateLimitAlgorithms(algorithmsRaw []string) (util.RateAlgorithm, map[string]util.RateAlgorithm, error) {
+	algorithm := server.DefaultVisitorRateLimitAlgorithm
+	algorithms := make(map[string]util.RateAlgorithm)
+	for _, line := range algorithmsRaw {
+		limit, algorithmStr, found := strings.Cut(line, "=")
+		if !found {
+			algorithmStr, limit = limit, ""
+		}
+		a, err := util.ParseRateAlgorithm(algorithmStr)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid visitor-rate-limit-algorithm: %s, %s", line, err.Error())
+		}
+		limit = strings.TrimSpace(limit)
+		if limit == "" {
+			algorithm = a
+		} else if !util.Contains(server.VisitorRateLimitTypes, limit) {
+			return "", nil, fmt.Errorf("invalid visitor-rate-limit-algorithm: %s, limit must be one of %s", line, strings.Join(server.VisitorRateLimitTypes, ", "))
+		} else {
+			algorithms[limit] = a
+		}
+	}
+	return algorithm, algorithms, nil
+}
+
+// parseAttachmentGCOptions parses the attachment garbage collection strategies and the size limit of the size strategy.
+// Strategies may be passed as a list, or as a comma-separated string, e.g. "expired,size".
+//
+// Parameters:
+//   - strategiesRaw: A slice of strategy strings, server default if empty.
+//   - sizeLimitStr: The target size of the size strategy, e.g. "4G", or empty for the server default.
+//   - totalSizeLimit: The attachment-total-size-limit, which the size limit must not exceed.
+//
+// Returns:
+//   - strategies: The strategies, e.g. server.AttachmentGCStrategyExpired.
+//   - sizeLimit: The size limit in bytes, or zero if not set.
+//   - err: An error if parsing fails.
+func parseAttachmentGCOptions(strategiesRaw []string, sizeLimitStr string, totalSizeLimit int64) ([]string, int64, error) {
+	strategies := make([]string, 0)
+	for _, line := range strategiesRaw {
+		for _, strategy := range util.SplitNoEmpty(line, ",") {
+			strategy = strings.TrimSpace(strategy)
+			if !util.Contains(server.AttachmentGCStrategies, strategy) {
+				return nil, 0, fmt.Errorf("invalid attachment-gc-strategies: %s, must be one of %s", strategy, strings.Join(server.AttachmentGCStrategies, ", "))
+			} else if !util.Contains(strategies, strategy) {
+				strategies = append(strategies, strategy)
+			}
+		}
+	}
+	if len(strategies) == 0 {
+		strategies = server.NewConfig().AttachmentGCStrategies
+	}
+	var sizeLimit int64
+	if sizeLimitStr != "" {
+		var err error
+		sizeLimit, err = util.ParseSize(sizeLimitStr)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid attachment gc size limit: %s", sizeLimitStr)
+		} else if sizeLimit > totalSizeLimit {
+			return nil, 0, errors.New("if set, attachment-gc-size-limit must not be larger than attachment-total-size-limit")
+		}
+	}
+	return strategies, sizeLimit, nil
+}
+
 // parseUsers parses a list of user strings in the format "name:hash:role".
 //
 // Parameters:
@@ -592,7 +913,7 @@ func parseUsers(usersRaw []string) ([]*user.User, error) {
 		} else if err := user.ValidPasswordHash(passwordHash, user.DefaultUserPasswordBcryptCost); err != nil {
 			return nil, fmt.Errorf("invalid auth-users: %s, password hash invalid, %s", userLine, err.Error())
 		} else if !user.AllowedRole(role) {
-			return nil, fmt.Errorf("invalid auth-users: %s, role %s is not allowed, allowed roles are 'admin' or 'user'", userLine, role)
+			return nil, fmt.Errorf("invalid auth-users: %s, role %s is not allowed, allowed roles are 'admin', 'user' or a custom role", userLine, role)
 		}
 		users = append(users, &user.User{
 			Name:        username,
@@ -632,7 +953,7 @@ func parseAccess(users []*user.User, accessRaw []string) (map[string][]*user.Gra
 				return nil, fmt.Errorf("invalid auth-access: %s, user %s is not provisioned", accessLine, username)
 			} else if !user.AllowedUsername(username) {
 				return nil, fmt.Errorf("invalid auth-access: %s, username %s invalid", accessLine, username)
-			} else if u.Role != user.RoleUser {
+			} else if !u.IsUser() {
 				return nil, fmt.Errorf("invalid auth-access: %s, user %s is not a regular user, only regular users can have ACL entries", accessLine, username)
 			}
 		}
@@ -656,6 +977,38 @@ func parseAccess(users []*user.User, accessRaw []string) (map[string][]*user.Gra
 	return access, nil
 }
 
+// parseAccessTemplates parses a list of access template strings in the format "topic-pattern:permission".
+// The topic pattern may contain the "<username>" placeholder, which is replaced with the name of the new user.
+//
+// Parameters:
+//   - templatesRaw: A slice of access template strings.
+//
+// Returns:
+//   - templates: A slice of Grants.
+//   - err: An error if parsing fails.
+func parseAccessTemplates(templatesRaw []string) ([]*user.Grant, error) {
+	templates := make([]*user.Grant, 0)
+	for _, templateLine := range templatesRaw {
+		parts := strings.Split(templateLine, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid auth-access-templates: %s, expected format: 'topic:permission'", templateLine)
+		}
+		topic := strings.TrimSpace(parts[0])
+		if !user.AllowedAccessTemplate(topic) {
+			return nil, fmt.Errorf("invalid auth-access-templates: %s, topic pattern %s invalid", templateLine, topic)
+		}
+		permission, err := user.ParsePermission(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth-access-templates: %s, permission %s invalid, %s", templateLine, parts[1], err.Error())
+		}
+		templates = append(templates, &user.Grant{
+			TopicPattern: topic,
+			Permission:   permission,
+		})
+	}
+	return templates, nil
+}
+
 // parseTokens parses a list of token strings in the format "user:token[:label]".
 //
 // Parameters:
@@ -701,7 +1054,7 @@ func parseTokens(users []*user.User, tokensRaw []string) (map[string][]*user.Tok
 	return tokens, nil
 }
 
-// reloadLogLevel updates the log level based on the configuration source.
+// reloadLogLevel updates the log level, level overrides and sampling rules based on the configuration source.
 //
 // Parameters:
 //   - inputSource: The source of configuration values.
@@ -721,6 +1074,19 @@ func reloadLogLevel(inputSource altsrc.InputSourceContext) error {
 	if err := applyLogLevelOverrides(overrides); err != nil {
 		return fmt.Errorf("cannot load log level overrides (2): %s", err.Error())
 	}
+	sampling, err := inputSource.StringSlice("log-sampling")
+	if err != nil {
+		return fmt.Errorf("cannot load log sampling rules (1): %s", err.Error())
+	}
+	log.ResetSampleRules()
+	if err := applyLogSampleRules(sampling); err != nil {
+		return fmt.Errorf("cannot load log sampling rules (2): %s", err.Error())
+	}
+	redactFields, err := inputSource.StringSlice("log-redact-fields")
+	if err != nil {
+		return fmt.Errorf("cannot load log redact fields: %s", err.Error())
+	}
+	log.SetRedactedFields(redactFields)
 	log.SetLevel(log.ToLevel(newLevelStr))
 	if len(overrides) > 0 {
 		log.Info("Log level is %v, %d override(s) in place", strings.ToUpper(newLevelStr), len(overrides))
@@ -13,6 +13,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
 	"heckel.io/ntfy/v2/test"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
@@ -62,6 +63,18 @@ func TestParseUsers_Success(t *testing.T) {
 			input:    []string{},
 			expected: []*user.User{},
 		},
+		{
+			name:  "user with custom role",
+			input: []string{"alice:$2a$10$RYUYAsl5zOnAIp6fH7BPX.Eug0rUfEUk92r8WiVusb0VK.vGojWBe:operator"},
+			expected: []*user.User{
+				{
+					Name:        "alice",
+					Hash:        "$2a$10$RYUYAsl5zOnAIp6fH7BPX.Eug0rUfEUk92r8WiVusb0VK.vGojWBe",
+					Role:        "operator",
+					Provisioned: true,
+				},
+			},
+		},
 		{
 			name:  "user with special characters in name",
 			input: []string{"alice.test+123@example.com:$2a$10$RYUYAsl5zOnAIp6fH7BPX.Eug0rUfEUk92r8WiVusb0VK.vGojWBe:user"},
@@ -120,8 +133,8 @@ func TestParseUsers_Errors(t *testing.T) {
 		},
 		{
 			name:  "invalid role",
-			input: []string{"alice:$2a$10$320YlQeaMghYZsvtu9jzfOQZS32FysWY/T9qu5NWqcIh.DN.u5P5S:invalid"},
-			error: "invalid auth-users: alice:$2a$10$320YlQeaMghYZsvtu9jzfOQZS32FysWY/T9qu5NWqcIh.DN.u5P5S:invalid, role invalid is not allowed, allowed roles are 'admin' or 'user'",
+			input: []string{"alice:$2a$10$320YlQeaMghYZsvtu9jzfOQZS32FysWY/T9qu5NWqcIh.DN.u5P5S:anonymous"},
+			error: "invalid auth-users: alice:$2a$10$320YlQeaMghYZsvtu9jzfOQZS32FysWY/T9qu5NWqcIh.DN.u5P5S:anonymous, role anonymous is not allowed, allowed roles are 'admin', 'user' or a custom role",
 		},
 		{
 			name:  "empty username",
@@ -307,6 +320,67 @@ func TestParseAccess_Errors(t *testing.T) {
 	}
 }
 
+func TestParseAccessTemplates_Success(t *testing.T) {
+	templates, err := parseAccessTemplates([]string{"user-<username>-*:rw", " alerts-<username> : read-only "})
+	require.Nil(t, err)
+	require.Equal(t, []*user.Grant{
+		{TopicPattern: "user-<username>-*", Permission: user.PermissionReadWrite},
+		{TopicPattern: "alerts-<username>", Permission: user.PermissionRead},
+	}, templates)
+}
+
+func TestParseAccessTemplates_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		error string
+	}{
+		{
+			name:  "invalid format",
+			input: []string{"alice:topic:rw"},
+			error: "invalid auth-access-templates: alice:topic:rw, expected format: 'topic:permission'",
+		},
+		{
+			name:  "invalid topic pattern",
+			input: []string{"user-<name>:rw"},
+			error: "invalid auth-access-templates: user-<name>:rw, topic pattern user-<name> invalid",
+		},
+		{
+			name:  "invalid permission",
+			input: []string{"user-<username>:invalid"},
+			error: "invalid auth-access-templates: user-<username>:invalid, permission invalid invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseAccessTemplates(tt.input)
+			require.Error(t, err)
+			require.Nil(t, result)
+			assert.Contains(t, err.Error(), tt.error)
+		})
+	}
+}
+
+func TestParseVisitorRateLimitAlgorithms(t *testing.T) {
+	algorithm, algorithms, err := parseVisitorRateLimitAlgorithms(nil)
+	require.Nil(t, err)
+	require.Equal(t, util.RateAlgorithmTokenBucket, algorithm)
+	require.Empty(t, algorithms)
+
+	algorithm, algorithms, err = parseVisitorRateLimitAlgorithms([]string{"gcra", "request=sliding-window", " auth-failure = token_bucket "})
+	require.Nil(t, err)
+	require.Equal(t, util.RateAlgorithmGCRA, algorithm)
+	require.Equal(t, map[string]util.RateAlgorithm{
+		server.VisitorRateLimitRequest:     util.RateAlgorithmSlidingWindow,
+		server.VisitorRateLimitAuthFailure: util.RateAlgorithmTokenBucket,
+	}, algorithms)
+
+	_, _, err = parseVisitorRateLimitAlgorithms([]string{"leaky-bucket"})
+	require.ErrorContains(t, err, "invalid visitor-rate-limit-algorithm: leaky-bucket")
+	_, _, err = parseVisitorRateLimitAlgorithms([]string{"messages=gcra"})
+	require.ErrorContains(t, err, "invalid visitor-rate-limit-algorithm: messages=gcra, limit must be one of request, email")
+}
+
 func TestParseTokens_Success(t *testing.T) {
 	users := []*user.User{
 		{Name: "alice"},
@@ -0,0 +1,30 @@
+//go:build !noserver && !windows
+
+package cmd
+
+import (
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// sigHandlerLogLevel watches for SIGUSR1 and SIGUSR2 signals, and temporarily sets the log level to DEBUG
+// (SIGUSR1) or TRACE (SIGUSR2). The previous log level is restored after the given duration.
+//
+// Parameters:
+//   - revertAfter: The duration after which the previous log level is restored.
+func sigHandlerLogLevel(revertAfter time.Duration) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	for sig := range sigs {
+		level, name := log.DebugLevel, "SIGUSR1"
+		if sig == syscall.SIGUSR2 {
+			level, name = log.TraceLevel, "SIGUSR2"
+		}
+		log.SetTemporaryLevel(level, revertAfter)
+		log.Info("Log level temporarily set to %s for %s (%s)", level.String(), util.FormatDuration(revertAfter), name)
+	}
+}
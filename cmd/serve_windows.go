@@ -0,0 +1,13 @@
+//go:build !noserver
+
+package cmd
+
+import (
+	"time"
+)
+
+// sigHandlerLogLevel is a no-op on Windows, because there are no SIGUSR1 and SIGUSR2 signals. The log level
+// can still be changed at runtime via the API.
+func sigHandlerLogLevel(_ time.Duration) {
+	// Nothing to see here
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/util"
+)
+
+func init() {
+	commands = append(commands, cmdStats)
+}
+
+var flagsStats = append(
+	append(append([]cli.Flag{}, flagsDefault...), flagsTLS...),
+	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG"}, Usage: "client config file"},
+	&cli.StringFlag{Name: "user", Aliases: []string{"u"}, EnvVars: []string{"NTFY_USER"}, Usage: "username[:password] used to auth against the server"},
+	&cli.StringFlag{Name: "token", Aliases: []string{"k"}, EnvVars: []string{"NTFY_TOKEN"}, Usage: "access token used to auth against the server"},
+)
+
+var cmdStats = &cli.Command{
+	Name:      "stats",
+	Usage:     "Show statistics for your reserved topics",
+	UsageText: "ntfy stats [OPTIONS..] [SERVER]",
+	Action:    execStats,
+	Category:  categoryClient,
+	Flags:     flagsStats,
+	Before:    initLogFunc,
+	Description: `Show statistics for the topics you reserved on a ntfy server, e.g. to find topics
+that are no longer used, or that use up a lot of attachment storage.
+
+For each topic, the number of cached messages, the number of messages in the last 24 hours,
+the last activity (last message or subscription), the size of the cached messages and
+attachments, and the number of connected subscribers are shown. Only messages that are still
+in the server's message cache are counted.
+
+If SERVER is not given, the default host from the config file is used. Credentials are
+taken from --user/--token, or from the default-user/default-token in the config file.
+
+Examples:
+  ntfy stats -u phil:mypass                 # Show stats for the topics of phil on the default host
+  ntfy stats -k tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2 ntfy.example.com
+`,
+}
+
+func execStats(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() > 1 {
+		return errors.New("too many arguments, see 'ntfy stats --help'")
+	}
+	baseURL := conf.DefaultHost
+	if c.NArg() == 1 {
+		baseURL = expandServerURL(c.Args().Get(0))
+	}
+	auth, err := clientAuthOption(c, conf)
+	if err != nil {
+		return err
+	} else if auth == nil {
+		return errors.New("credentials required, pass --user or --token, or set default-user or default-token in the config file")
+	}
+	cl := client.New(conf)
+	stats, err := cl.TopicStats(baseURL, auth)
+	if err != nil {
+		return err
+	}
+	if len(stats) == 0 {
+		fmt.Fprintln(c.App.Writer, "no reserved topics")
+		return nil
+	}
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tMESSAGES\tLAST 24H\tLAST ACTIVITY\tCACHE SIZE\tATTACHMENTS\tSUBSCRIBERS")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%d\n", s.Topic, s.Messages, s.MessagesPerDay, formatLastActivity(s.LastActivity), util.FormatSizeHuman(s.CacheBytes), util.FormatSizeHuman(s.AttachmentBytes), s.Subscribers)
+	}
+	return w.Flush()
+}
+
+func clientAuthOption(c *cli.Context, conf *client.Config) (client.RequestOption, error) {
+	user, token := c.String("user"), c.String("token")
+	if token != "" {
+		return client.WithBearerAuth(token), nil
+	} else if user != "" {
+		var pass string
+		parts := strings.SplitN(user, ":", 2)
+		if len(parts) == 2 {
+			user = parts[0]
+			pass = parts[1]
+		} else {
+			fmt.Fprint(c.App.ErrWriter, "Enter Password: ")
+			p, err := util.ReadPassword(c.App.Reader)
+			if err != nil {
+				return nil, err
+			}
+			pass = string(p)
+			fmt.Fprintf(c.App.ErrWriter, "\r%s\r", strings.Repeat(" ", 20))
+		}
+		return client.WithBasicAuth(user, pass), nil
+	} else if conf.DefaultToken != "" {
+		return client.WithBearerAuth(conf.DefaultToken), nil
+	} else if conf.DefaultUser != "" && conf.DefaultPassword != nil {
+		return client.WithBasicAuth(conf.DefaultUser, *conf.DefaultPassword), nil
+	}
+	return nil, nil
+}
+
+func formatLastActivity(unixTime int64) string {
+	if unixTime == 0 {
+		return "-"
+	}
+	return time.Unix(unixTime, 0).Format("2006-01-02 15:04")
+}
+
+func expandServerURL(server string) string {
+	if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") && !strings.HasPrefix(server, "unix://") {
+		server = "https://" + server
+	}
+	return strings.TrimSuffix(server, "/")
+}
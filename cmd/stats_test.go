@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestCLI_Stats(t *testing.T) {
+	conf := server.NewConfig()
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthUsers = []*user.User{
+		{Name: "philuser", Hash: "$2a$10$U4WSIYY6evyGmZaraavM2e2JeVG6EMGUKN1uUwufUeeRd4Jpg6cGC", Role: user.RoleAdmin}, // philuser:philpass
+	}
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "stats", "--user", "philuser:philpass", baseURL}))
+	require.Equal(t, "no reserved topics\n", stdout.String())
+
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/v1/account/reservation", strings.NewReader(`{"topic":"backups","everyone":"deny-all"}`))
+	req.Header.Set("Authorization", util.BasicAuth("philuser", "philpass"))
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+
+	app, _, _, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "publish", "--user", "philuser:philpass", baseURL + "/backups", "backup done"}))
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "stats", "--user", "philuser:philpass", baseURL}))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	require.Regexp(t, `^TOPIC\s+MESSAGES\s+LAST 24H\s+LAST ACTIVITY\s+CACHE SIZE\s+ATTACHMENTS\s+SUBSCRIBERS$`, lines[0])
+	require.Regexp(t, `^backups\s+1\s+1\s+\d{4}-\d{2}-\d{2} \d{2}:\d{2}\s+11 bytes\s+0 bytes\s+0$`, lines[1])
+
+	// Credentials are required
+	app, _, _, _ = newTestApp()
+	require.Error(t, app.Run([]string{"ntfy", "stats", baseURL}))
+}
@@ -10,9 +10,12 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"time"
 )
 
 func init() {
@@ -26,14 +29,17 @@ const (
 )
 
 var flagsSubscribe = append(
-	append([]cli.Flag{}, flagsDefault...),
-	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, Usage: "client config file"},
+	append(append([]cli.Flag{}, flagsDefault...), flagsTLS...),
+	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG"}, Usage: "client config file"},
 	&cli.StringFlag{Name: "since", Aliases: []string{"s"}, Usage: "return events since `SINCE` (Unix timestamp, or all)"},
 	&cli.StringFlag{Name: "user", Aliases: []string{"u"}, EnvVars: []string{"NTFY_USER"}, Usage: "username[:password] used to auth against the server"},
 	&cli.StringFlag{Name: "token", Aliases: []string{"k"}, EnvVars: []string{"NTFY_TOKEN"}, Usage: "access token used to auth against the server"},
 	&cli.BoolFlag{Name: "from-config", Aliases: []string{"from_config", "C"}, Usage: "read subscriptions from config file (service mode)"},
 	&cli.BoolFlag{Name: "poll", Aliases: []string{"p"}, Usage: "return events and exit, do not listen for new events"},
 	&cli.BoolFlag{Name: "scheduled", Aliases: []string{"sched", "S"}, Usage: "also return scheduled/delayed events"},
+	&cli.StringFlag{Name: "long-poll", Aliases: []string{"long_poll"}, Usage: "use long polling instead of a streaming connection, waiting up to `WAIT` (e.g. 30s) per request"},
+	&cli.BoolFlag{Name: "notify", Aliases: []string{"n"}, Usage: "display messages without command as desktop notifications, with action buttons (Windows only)"},
+	&cli.BoolFlag{Name: "sync", Usage: "sync subscriptions with your account on the default host (like the web app and mobile apps)"},
 )
 
 var cmdSubscribe = &cli.Command{
@@ -56,8 +62,11 @@ ntfy subscribe TOPIC
   Examples:
     ntfy subscribe mytopic            # Prints JSON for incoming messages for ntfy.sh/mytopic
     ntfy sub home.lan/backups         # Subscribe to topic on different server
+    ntfy sub mytopic1,mytopic2        # Subscribe to multiple topics via a single connection
     ntfy sub --poll home.lan/backups  # Just query for latest messages and exit
     ntfy sub -u phil:mypass secret    # Subscribe with username/password
+    ntfy sub --long-poll=30s mytopic  # Use long polling, e.g. if a proxy breaks streaming connections
+    ntfy sub --notify mytopic         # Display desktop notifications with action buttons (Windows only)
   
 ntfy subscribe TOPIC COMMAND
   This executes COMMAND for every incoming messages. The message fields are passed to the
@@ -73,10 +82,16 @@ ntfy subscribe TOPIC COMMAND
     $NTFY_PRIORITY  $priority, $prio, $p  Message priority (1=min, 5=max)
     $NTFY_TAGS      $tags, $tag, $ta      Message tags (comma separated list)
     $NTFY_RAW       $raw                  Raw JSON message
+    $NTFY_ACK_TOPIC                       Topic URL to acknowledge the message on (if it asks for it)
+    $NTFY_ACK_ID                          Message ID to acknowledge (if it asks for it), see 'ntfy ack'
 
   Examples:
     ntfy sub mytopic 'notify-send "$m"'    # Execute command for incoming messages
     ntfy sub topic1 myscript.sh            # Execute script for incoming messages
+    ntfy sub alerts 'test -z "$NTFY_ACK_ID" || ntfy ack "$NTFY_ACK_TOPIC" "$NTFY_ACK_ID"'
+
+  Escalated messages (see escalation policies) ask to be acknowledged. Without COMMAND, the
+  'ntfy ack' command to acknowledge them is printed to stderr.
 
 ntfy subscribe --from-config
   Service mode (used in ntfy-client.service). This reads the config file and sets up 
@@ -85,6 +100,11 @@ ntfy subscribe --from-config
   Examples: 
     ntfy sub --from-config                           # Read topics from config file
     ntfy sub --config=myclient.yml --from-config     # Read topics from alternate config file
+    ntfy sub --from-config --sync                    # Also subscribe to the topics of your account
+
+  With --sync (or "sync: true" in the config file), the topics stored in your account on the
+  default host are subscribed to as well, and followed as you add or remove them in the web app
+  or mobile apps. Topics from the config file are added to your account.
 
 ` + clientCommandDescriptionSuffix,
 }
@@ -110,13 +130,21 @@ func execSubscribe(c *cli.Context) error {
 	token := c.String("token")
 	poll := c.Bool("poll")
 	scheduled := c.Bool("scheduled")
+	longPoll := c.String("long-poll")
 	fromConfig := c.Bool("from-config")
+	sync := c.Bool("sync") || conf.Sync
 	topic := c.Args().Get(0)
 	command := c.Args().Get(1)
 
 	// Checks
 	if user != "" && token != "" {
 		return errors.New("cannot set both --user and --token")
+	} else if c.Bool("notify") && !notifySupported {
+		return errors.New(`--notify is only supported on Windows, use a command like 'notify-send "$m"' instead`)
+	} else if err := validateNotifyOptions(conf); err != nil {
+		return err
+	} else if err := validateNetworkOptions(conf); err != nil {
+		return err
 	}
 
 	if !fromConfig {
@@ -126,8 +154,9 @@ func execSubscribe(c *cli.Context) error {
 	if since != "" {
 		options = append(options, client.WithSince(since))
 	}
+	var auth client.SubscribeOption
 	if token != "" {
-		options = append(options, client.WithBearerAuth(token))
+		auth = client.WithBearerAuth(token)
 	} else if user != "" {
 		var pass string
 		parts := strings.SplitN(user, ":", 2)
@@ -143,24 +172,48 @@ func execSubscribe(c *cli.Context) error {
 			pass = string(p)
 			fmt.Fprintf(c.App.ErrWriter, "\r%s\r", strings.Repeat(" ", 20))
 		}
-		options = append(options, client.WithBasicAuth(user, pass))
+		auth = client.WithBasicAuth(user, pass)
 	} else if conf.DefaultToken != "" {
-		options = append(options, client.WithBearerAuth(conf.DefaultToken))
+		auth = client.WithBearerAuth(conf.DefaultToken)
 	} else if conf.DefaultUser != "" && conf.DefaultPassword != nil {
-		options = append(options, client.WithBasicAuth(conf.DefaultUser, *conf.DefaultPassword))
+		auth = client.WithBasicAuth(conf.DefaultUser, *conf.DefaultPassword)
+	}
+	if auth != nil {
+		options = append(options, auth)
 	}
 	if scheduled {
 		options = append(options, client.WithScheduled())
 	}
-	if topic == "" && len(conf.Subscribe) == 0 {
+	if longPoll != "" {
+		if poll {
+			return errors.New("cannot set both --poll and --long-poll")
+		}
+		wait, err := util.ParseDuration(longPoll)
+		if err != nil {
+			return err
+		}
+		options = append(options, client.WithLongPoll(wait))
+	}
+	var syncAuth client.SubscribeOption
+	if sync {
+		if poll {
+			return errors.New("cannot set both --poll and --sync")
+		} else if auth == nil {
+			return errors.New("--sync requires credentials, set --user, --token, or default-user/default-token in the config file")
+		}
+		syncAuth = auth
+	}
+	if topic == "" && len(conf.Subscribe) == 0 && !sync {
 		return errors.New("must specify topic, type 'ntfy subscribe --help' for help")
 	}
 
 	// Execute poll or subscribe
 	if poll {
-		return doPoll(c, cl, conf, topic, command, options...)
+		err := doPoll(c, cl, conf, topic, command, options...)
+		notifications.Wait() // Wait for clicks on action buttons, see notifyMessage
+		return err
 	}
-	return doSubscribe(c, cl, conf, topic, command, options...)
+	return doSubscribe(c, cl, conf, topic, command, syncAuth, options...)
 }
 
 // doPoll polls for messages from one or more topics.
@@ -178,15 +231,19 @@ func execSubscribe(c *cli.Context) error {
 //   - An error if polling fails.
 func doPoll(c *cli.Context, cl *client.Client, conf *client.Config, topic, command string, options ...client.SubscribeOption) error {
 	for _, s := range conf.Subscribe { // may be nil
+		topicOptions := append(make([]client.SubscribeOption, 0), options...)
 		if auth := maybeAddAuthHeader(s, conf); auth != nil {
-			options = append(options, auth)
+			topicOptions = append(topicOptions, auth)
 		}
-		if err := doPollSingle(c, cl, s.Topic, s.Command, options...); err != nil {
+		if !s.Network.IsZero() {
+			topicOptions = append(topicOptions, client.WithNetwork(&s.Network))
+		}
+		if err := doPollSingle(c, cl, s.Topic, s.Command, newMessageHandler(conf, &s), topicOptions...); err != nil {
 			return err
 		}
 	}
 	if topic != "" {
-		if err := doPollSingle(c, cl, topic, command, options...); err != nil {
+		if err := doPollSingle(c, cl, topic, command, newMessageHandler(conf, nil), options...); err != nil {
 			return err
 		}
 	}
@@ -200,17 +257,18 @@ func doPoll(c *cli.Context, cl *client.Client, conf *client.Config, topic, comma
 //   - cl: The ntfy client.
 //   - topic: The topic to poll.
 //   - command: The command to execute for each message.
+//   - handler: The settings of the subscription, see messageHandler.
 //   - options: Subscribe options.
 //
 // Returns:
 //   - An error if polling fails.
-func doPollSingle(c *cli.Context, cl *client.Client, topic, command string, options ...client.SubscribeOption) error {
+func doPollSingle(c *cli.Context, cl *client.Client, topic, command string, handler *messageHandler, options ...client.SubscribeOption) error {
 	messages, err := cl.Poll(topic, options...)
 	if err != nil {
 		return err
 	}
 	for _, m := range messages {
-		printMessageOrRunCommand(c, m, command)
+		printMessageOrRunCommand(c, m, command, handler)
 	}
 	return nil
 }
@@ -223,12 +281,16 @@ func doPollSingle(c *cli.Context, cl *client.Client, topic, command string, opti
 //   - conf: The client configuration.
 //   - topic: The command-line topic (optional).
 //   - command: The command to execute for each message (optional).
+//   - syncAuth: The credentials used to sync subscriptions with the account on the default host (optional, see accountSync).
 //   - options: Default subscribe options.
 //
 // Returns:
 //   - An error if subscription setup fails.
-func doSubscribe(c *cli.Context, cl *client.Client, conf *client.Config, topic, command string, options ...client.SubscribeOption) error {
-	cmds := make(map[string]string)    // Subscription ID -> command
+func doSubscribe(c *cli.Context, cl *client.Client, conf *client.Config, topic, command string, syncAuth client.SubscribeOption, options ...client.SubscribeOption) error {
+	cmds := make(map[string]string)              // Subscription ID -> command
+	handlers := make(map[string]*messageHandler) // Subscription ID -> handler, for subscriptions from the config file
+	defaultHandler := newMessageHandler(conf, nil)
+	localTopics := make([]string, 0)
 	for _, s := range conf.Subscribe { // May be nil
 		topicOptions := append(make([]client.SubscribeOption, 0), options...)
 		for filter, value := range s.If {
@@ -238,6 +300,9 @@ func doSubscribe(c *cli.Context, cl *client.Client, conf *client.Config, topic,
 		if auth := maybeAddAuthHeader(s, conf); auth != nil {
 			topicOptions = append(topicOptions, auth)
 		}
+		if !s.Network.IsZero() {
+			topicOptions = append(topicOptions, client.WithNetwork(&s.Network))
+		}
 
 		subscriptionID, err := cl.Subscribe(s.Topic, topicOptions...)
 		if err != nil {
@@ -250,6 +315,8 @@ func doSubscribe(c *cli.Context, cl *client.Client, conf *client.Config, topic,
 		} else {
 			cmds[subscriptionID] = ""
 		}
+		handlers[subscriptionID] = newMessageHandler(conf, &s)
+		localTopics = append(localTopics, s.Topic)
 	}
 	if topic != "" {
 		subscriptionID, err := cl.Subscribe(topic, options...)
@@ -257,14 +324,51 @@ func doSubscribe(c *cli.Context, cl *client.Client, conf *client.Config, topic,
 			return err
 		}
 		cmds[subscriptionID] = command
+		localTopics = append(localTopics, topic)
+	}
+	var sync *accountSync
+	var resync <-chan time.Time
+	if syncAuth != nil {
+		sync = newAccountSync(cl, conf, cmds, syncAuth, options...)
+		if err := sync.Start(localTopics); err != nil {
+			return err
+		}
+		ticker := time.NewTicker(accountSyncInterval)
+		defer ticker.Stop()
+		resync = ticker.C
 	}
-	for m := range cl.Messages {
-		cmd, ok := cmds[m.SubscriptionID]
-		if !ok {
-			continue
+	for {
+		select {
+		case m, ok := <-cl.Messages:
+			if !ok {
+				return nil
+			} else if sync != nil && sync.IsSyncEvent(m) {
+				sync.Sync()
+				continue
+			}
+			cmd, ok := cmds[m.SubscriptionID]
+			if !ok {
+				continue
+			}
+			handler, ok := handlers[m.SubscriptionID]
+			if !ok {
+				handler = defaultHandler // Command-line topic and topics from the account
+			}
+			log.Debug("%s Dispatching received message: %s", logMessagePrefix(m), m.Raw)
+			printMessageOrRunCommand(c, m, cmd, handler)
+		case <-resync:
+			sync.Sync() // In case a sync event was missed, e.g. while the connection was down
+		}
+	}
+}
+
+// validateNetworkOptions checks the network settings (proxy, bind address, DNS servers) of the
+// subscriptions in the config file, so that errors are reported on startup rather than on every reconnect.
+func validateNetworkOptions(conf *client.Config) error {
+	for _, s := range conf.Subscribe {
+		if err := s.Network.Validate(); err != nil {
+			return fmt.Errorf("subscription %s: %w", s.Topic, err)
 		}
-		log.Debug("%s Dispatching received message: %s", logMessagePrefix(m), m.Raw)
-		printMessageOrRunCommand(c, m, cmd)
 	}
 	return nil
 }
@@ -301,18 +405,55 @@ func maybeAddAuthHeader(s client.Subscribe, conf *client.Config) client.Subscrib
 	return nil
 }
 
-// printMessageOrRunCommand either prints the message to stdout or executes the associated command.
+// messageHandler holds the per-subscription settings used to handle incoming messages
+type messageHandler struct {
+	environ []string                // Environment of the command, see commandEnviron
+	notify  map[int]*notifySettings // Priority -> desktop notification settings, see resolveNotifySettings
+}
+
+// newMessageHandler returns the message handler for the given subscription.
+//
+// Parameters:
+//   - conf: The client configuration.
+//   - s: The subscription, or nil for the command-line topic and topics from the account.
+//
+// Returns:
+//   - The message handler.
+func newMessageHandler(conf *client.Config, s *client.Subscribe) *messageHandler {
+	return &messageHandler{
+		environ: commandEnviron(conf, s),
+		notify:  resolveNotifySettings(conf, s),
+	}
+}
+
+// notifySettings returns the desktop notification settings for the given message priority
+func (h *messageHandler) notifySettings(priority int) *notifySettings {
+	if settings, ok := h.notify[priority]; ok {
+		return settings
+	}
+	return h.notify[3] // Messages without priority
+}
+
+// printMessageOrRunCommand either prints the message to stdout (or displays it as desktop notification,
+// if --notify is set) or executes the associated command.
 //
 // Parameters:
 //   - c: The CLI context.
 //   - m: The received message.
 //   - command: The command string (optional).
-func printMessageOrRunCommand(c *cli.Context, m *client.Message, command string) {
+//   - handler: The settings of the subscription, see messageHandler.
+func printMessageOrRunCommand(c *cli.Context, m *client.Message, command string, handler *messageHandler) {
 	if command != "" {
-		runCommand(c, command, m)
+		runCommand(c, command, handler.environ, m)
+	} else if c.Bool("notify") {
+		notifications.Add(1)
+		go notifyMessage(m, handler.notifySettings(m.Priority))
 	} else {
 		log.Debug("%s Printing raw message", logMessagePrefix(m))
 		fmt.Fprintln(c.App.Writer, m.Raw)
+		if topicURL, id, ok := m.AckTarget(); ok {
+			fmt.Fprintf(c.App.ErrWriter, "Message %s asks to be acknowledged, run: ntfy ack %s %s\n", m.ID, topicURL, id)
+		}
 	}
 }
 
@@ -321,9 +462,10 @@ func printMessageOrRunCommand(c *cli.Context, m *client.Message, command string)
 // Parameters:
 //   - c: The CLI context.
 //   - command: The command to execute.
+//   - environ: The environment of the command, see commandEnviron.
 //   - m: The message triggering the command.
-func runCommand(c *cli.Context, command string, m *client.Message) {
-	if err := runCommandInternal(c, command, m); err != nil {
+func runCommand(c *cli.Context, command string, environ []string, m *client.Message) {
+	if err := runCommandInternal(c, command, environ, m); err != nil {
 		log.Warn("%s Command failed: %s", logMessagePrefix(m), err.Error())
 	}
 }
@@ -333,11 +475,12 @@ func runCommand(c *cli.Context, command string, m *client.Message) {
 // Parameters:
 //   - c: The CLI context.
 //   - script: The script content.
+//   - environ: The environment of the command, see commandEnviron.
 //   - m: The message.
 //
 // Returns:
 //   - An error if script creation or execution fails.
-func runCommandInternal(c *cli.Context, script string, m *client.Message) error {
+func runCommandInternal(c *cli.Context, script string, environ []string, m *client.Message) error {
 	scriptFile := fmt.Sprintf("%s/ntfy-subscribe-%s.%s", os.TempDir(), util.RandomString(10), scriptExt)
 	log.Debug("%s Running command '%s' via temporary script %s", logMessagePrefix(m), script, scriptFile)
 	script = scriptHeader + script
@@ -350,18 +493,20 @@ func runCommandInternal(c *cli.Context, script string, m *client.Message) error
 	cmd.Stdin = c.App.Reader
 	cmd.Stdout = c.App.Writer
 	cmd.Stderr = c.App.ErrWriter
-	cmd.Env = envVars(m)
+	cmd.Env = envVars(environ, m)
 	return cmd.Run()
 }
 
-// envVars creates a list of environment variables based on the message fields.
+// envVars creates a list of environment variables based on the message fields. The message
+// variables are appended to the given environment, so they take precedence over it.
 //
 // Parameters:
+//   - environ: The environment of the command, see commandEnviron.
 //   - m: The message.
 //
 // Returns:
 //   - A slice of strings in "KEY=VALUE" format.
-func envVars(m *client.Message) []string {
+func envVars(environ []string, m *client.Message) []string {
 	env := make([]string, 0)
 	env = append(env, envVar(m.ID, "NTFY_ID", "id")...)
 	env = append(env, envVar(m.Topic, "NTFY_TOPIC", "topic")...)
@@ -371,11 +516,66 @@ func envVars(m *client.Message) []string {
 	env = append(env, envVar(fmt.Sprintf("%d", m.Priority), "NTFY_PRIORITY", "priority", "prio", "p")...)
 	env = append(env, envVar(strings.Join(m.Tags, ","), "NTFY_TAGS", "tags", "tag", "ta")...)
 	env = append(env, envVar(m.Raw, "NTFY_RAW", "raw")...)
+	ackTopic, ackID, _ := m.AckTarget()
+	env = append(env, envVar(ackTopic, "NTFY_ACK_TOPIC")...)
+	env = append(env, envVar(ackID, "NTFY_ACK_ID")...)
 	sort.Strings(env)
 	if log.IsTrace() {
 		log.Trace("%s With environment:\n%s", logMessagePrefix(m), strings.Join(env, "\n"))
 	}
-	return append(os.Environ(), env...)
+	return append(append(make([]string, 0, len(environ)+len(env)), environ...), env...)
+}
+
+// commandEnviron returns the environment in which commands for the given subscription are executed,
+// without the NTFY_* message variables (see envVars). If an allowlist is configured (see client.Config.CommandEnv,
+// which may be overridden per subscription), only the listed variables of the current environment are passed;
+// otherwise the entire environment is passed. The static variables of the subscription (see client.Subscribe.Env)
+// are added on top.
+//
+// Parameters:
+//   - conf: The client configuration.
+//   - s: The subscription, or nil for the command-line topic and topics from the account.
+//
+// Returns:
+//   - A slice of strings in "KEY=VALUE" format.
+func commandEnviron(conf *client.Config, s *client.Subscribe) []string {
+	allowlist := conf.CommandEnv
+	if s != nil && s.CommandEnv != nil {
+		allowlist = s.CommandEnv
+	}
+	environ := make([]string, 0)
+	for _, v := range os.Environ() {
+		name, _, _ := strings.Cut(v, "=")
+		if allowlist == nil || commandEnvAllowed(allowlist, name) {
+			environ = append(environ, v)
+		}
+	}
+	if s != nil {
+		extra := make([]string, 0, len(s.Env))
+		for name, value := range s.Env {
+			extra = append(extra, fmt.Sprintf("%s=%s", name, value))
+		}
+		sort.Strings(extra)
+		environ = append(environ, extra...)
+	}
+	return environ
+}
+
+// commandEnvAllowed returns true if the environment variable with the given name matches
+// one of the names or wildcard patterns (e.g. LC_*) in the allowlist.
+func commandEnvAllowed(allowlist []string, name string) bool {
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name) // Environment variable names are case-insensitive on Windows
+	}
+	for _, pattern := range allowlist {
+		if runtime.GOOS == "windows" {
+			pattern = strings.ToUpper(pattern)
+		}
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
 }
 
 // envVar creates multiple environment variable strings for the same value.
@@ -395,7 +595,10 @@ func envVar(value string, vars ...string) []string {
 }
 
 // loadConfig loads the client configuration from the file specified in the context
-// or from the default location.
+// or from the default location, and applies the NTFY_* environment variable overrides
+// (see client.Config.ApplyEnv). Command line flags take precedence over both. If --trace-http
+// is set, all HTTP requests and responses are dumped to stderr. The TLS settings (--cacert, --cert,
+// --key and --insecure) are validated, so that invalid files are reported before connecting.
 //
 // Parameters:
 //   - c: The CLI context.
@@ -403,6 +606,46 @@ func envVar(value string, vars ...string) []string {
 // Returns:
 //   - A Config object or an error.
 func loadConfig(c *cli.Context) (*client.Config, error) {
+	conf, err := loadConfigFile(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.ApplyEnv(); err != nil {
+		return nil, err
+	}
+	for _, ctx := range c.Lineage() { // Global flag, may be set before or after the command name
+		if ctx.Bool("trace-http") {
+			conf.TraceWriter = c.App.ErrWriter
+			break
+		}
+	}
+	if cacert := c.String("cacert"); cacert != "" {
+		conf.CACert = cacert
+	}
+	if cert := c.String("cert"); cert != "" {
+		conf.ClientCert = cert
+	}
+	if key := c.String("key"); key != "" {
+		conf.ClientKey = key
+	}
+	if c.Bool("insecure") {
+		conf.Insecure = true
+	}
+	if _, err := conf.TLSConfig(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// loadConfigFile loads the client configuration from the file specified in the context
+// or from the default location.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - A Config object or an error.
+func loadConfigFile(c *cli.Context) (*client.Config, error) {
 	filename := c.String("config")
 	if filename != "" {
 		return client.LoadConfig(filename)
@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Desktop notifications (ntfy subscribe --notify) are shown as Windows toast notifications. Toasts are
+// displayed via a PowerShell script, so no additional libraries are required. The message's "view" actions
+// are mapped to buttons that open the URL, and "http" actions to buttons that report back to ntfy, which then
+// sends the HTTP request. "broadcast" actions are Android-only and are skipped.
+//
+// The urgency, sound and sticky behavior of the notifications depend on the message priority, see
+// defaultNotifySettings, and can be configured in client.yml (see client.Config.Notify).
+
+const (
+	toastAppID             = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+	toastActionPrefix      = "ntfy-action:"
+	toastActionTimeout     = 10 * time.Minute // How long to wait for a click on an "http" action button
+	toastHTTPActionTimeout = 15 * time.Second
+)
+
+const (
+	notifyUrgencyLow      = "low"      // No popup, only shown in the notification center
+	notifyUrgencyNormal   = "normal"   // Popup
+	notifyUrgencyCritical = "critical" // Popup that breaks through do not disturb (Windows 11)
+	notifySoundDefault    = "default"
+	notifySoundNone       = "none"
+)
+
+// notifySettings configures how a desktop notification is displayed, see client.NotifyOptions
+type notifySettings struct {
+	urgency string
+	sound   string
+	sticky  bool
+}
+
+// defaultNotifySettings are the notification settings per priority, if nothing is configured
+// in client.yml. They follow the behavior of the Android app: min and low priority messages are
+// silent, and max priority messages stay on screen until dismissed.
+var defaultNotifySettings = map[int]notifySettings{
+	1: {urgency: notifyUrgencyLow, sound: notifySoundNone},
+	2: {urgency: notifyUrgencyNormal, sound: notifySoundNone},
+	3: {urgency: notifyUrgencyNormal, sound: notifySoundDefault},
+	4: {urgency: notifyUrgencyNormal, sound: notifySoundDefault},
+	5: {urgency: notifyUrgencyCritical, sound: "ms-winsoundevent:Notification.Reminder", sticky: true},
+}
+
+var (
+	// notifications tracks the toasts that are still waiting for a button click,
+	// so that "ntfy subscribe --poll --notify" does not exit too early
+	notifications sync.WaitGroup
+)
+
+// toast is the XML representation of a Windows toast notification, see
+// https://learn.microsoft.com/en-us/windows/apps/design/shell/tiles-and-notifications/adaptive-interactive-toasts
+type toast struct {
+	XMLName        xml.Name      `xml:"toast"`
+	ActivationType string        `xml:"activationType,attr,omitempty"`
+	Launch         string        `xml:"launch,attr,omitempty"`
+	Scenario       string        `xml:"scenario,attr,omitempty"`
+	Texts          []string      `xml:"visual>binding>text"`
+	Actions        *toastActions `xml:"actions,omitempty"`
+	Audio          *toastAudio   `xml:"audio,omitempty"`
+}
+
+type toastActions struct {
+	Actions []toastAction `xml:"action"`
+}
+
+type toastAudio struct {
+	Src    string `xml:"src,attr,omitempty"`
+	Silent string `xml:"silent,attr,omitempty"`
+}
+
+type toastAction struct {
+	Content        string `xml:"content,attr"`
+	Arguments      string `xml:"arguments,attr"`
+	ActivationType string `xml:"activationType,attr"`
+}
+
+// notifyMessage displays the given message as a desktop notification, and executes the "http" action
+// of the clicked button, if any. It is called asynchronously, so errors are only logged.
+//
+// Parameters:
+//   - m: The received message.
+//   - settings: The notification settings for the priority of the message.
+func notifyMessage(m *client.Message, settings *notifySettings) {
+	defer notifications.Done()
+	wait := time.Duration(0)
+	for _, action := range m.Actions {
+		if action.Action == "http" {
+			wait = toastActionTimeout
+		}
+	}
+	log.Debug("%s Displaying desktop notification", logMessagePrefix(m))
+	arguments, err := showToast(toastScript(formatToast(m, settings), settings.urgency != notifyUrgencyLow, wait))
+	if err != nil {
+		log.Warn("%s Cannot display desktop notification: %s", logMessagePrefix(m), err.Error())
+		return
+	}
+	actionID, ok := strings.CutPrefix(arguments, toastActionPrefix)
+	if !ok {
+		return
+	}
+	for _, action := range m.Actions {
+		if action.ID == actionID && action.Action == "http" {
+			log.Debug("%s Executing http action '%s'", logMessagePrefix(m), action.Label)
+			if err := runHTTPAction(action); err != nil {
+				log.Warn("%s Action '%s' failed: %s", logMessagePrefix(m), action.Label, err.Error())
+			}
+			return
+		}
+	}
+}
+
+// formatToast returns the toast XML for the given message. Clicking the notification opens the click URL of the
+// message (if any); "view" actions open their URL, and "http" actions report their ID back to the script
+// (see toastScript). Sticky notifications are displayed as reminders, i.e. they stay on screen until dismissed,
+// and critical ones as urgent notifications.
+func formatToast(m *client.Message, settings *notifySettings) string {
+	t := &toast{
+		Texts: make([]string, 0),
+	}
+	if m.Title != "" {
+		t.Texts = append(t.Texts, m.Title)
+	} else {
+		t.Texts = append(t.Texts, m.Topic)
+	}
+	t.Texts = append(t.Texts, m.Message)
+	if m.Click != "" {
+		t.ActivationType, t.Launch = "protocol", m.Click
+	}
+	if settings.sticky {
+		t.Scenario = "reminder"
+	} else if settings.urgency == notifyUrgencyCritical {
+		t.Scenario = "urgent"
+	}
+	if settings.sound == notifySoundNone {
+		t.Audio = &toastAudio{Silent: "true"}
+	} else if settings.sound != notifySoundDefault {
+		src := settings.sound
+		if !strings.Contains(src, ":") {
+			src = "ms-winsoundevent:" + src // Short form, e.g. Notification.Reminder
+		}
+		t.Audio = &toastAudio{Src: src}
+	}
+	actions := make([]toastAction, 0)
+	for _, action := range m.Actions {
+		switch action.Action {
+		case "view":
+			actions = append(actions, toastAction{Content: action.Label, Arguments: action.URL, ActivationType: "protocol"})
+		case "http":
+			actions = append(actions, toastAction{Content: action.Label, Arguments: toastActionPrefix + action.ID, ActivationType: "foreground"})
+		}
+	}
+	if t.Scenario == "reminder" && len(actions) == 0 {
+		// Reminders without buttons are displayed like regular toasts, so a dismiss button is required
+		actions = append(actions, toastAction{Content: "Dismiss", Arguments: "dismiss", ActivationType: "system"})
+	}
+	if len(actions) > 0 {
+		t.Actions = &toastActions{Actions: actions}
+	}
+	b, _ := xml.Marshal(t) // Cannot fail for this struct
+	return strings.Replace(string(b), "<binding>", `<binding template="ToastGeneric">`, 1)
+}
+
+// toastScript returns the PowerShell script that displays the given toast XML. If popup is false, the toast is
+// only added to the notification center. If wait is greater than zero, the script waits up to wait for the
+// toast to be clicked, and prints the arguments of the clicked button.
+func toastScript(toastXML string, popup bool, wait time.Duration) string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	var script strings.Builder
+	script.WriteString("$ErrorActionPreference = 'Stop'\n")
+	script.WriteString("[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null\n")
+	script.WriteString("[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null\n")
+	script.WriteString("$xml = New-Object Windows.Data.Xml.Dom.XmlDocument\n")
+	fmt.Fprintf(&script, "$xml.LoadXml(%s)\n", quote(toastXML))
+	script.WriteString("$toast = New-Object Windows.UI.Notifications.ToastNotification $xml\n")
+	if !popup {
+		script.WriteString("$toast.SuppressPopup = $true\n")
+	}
+	if wait > 0 {
+		script.WriteString("Register-ObjectEvent -InputObject $toast -EventName Activated -SourceIdentifier ntfyActivated | Out-Null\n")
+		script.WriteString("Register-ObjectEvent -InputObject $toast -EventName Dismissed -SourceIdentifier ntfyDismissed | Out-Null\n")
+	}
+	fmt.Fprintf(&script, "[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(%s).Show($toast)\n", quote(toastAppID))
+	if wait > 0 {
+		fmt.Fprintf(&script, "$event = Wait-Event -Timeout %d\n", int(wait.Seconds()))
+		script.WriteString("if ($event -and $event.SourceIdentifier -eq 'ntfyActivated') {\n")
+		script.WriteString("  Write-Output ([Windows.UI.Notifications.ToastActivatedEventArgs]$event.SourceArgs[1]).Arguments\n")
+		script.WriteString("}\n")
+	}
+	return script.String()
+}
+
+// resolveNotifySettings returns the notification settings per priority for the given subscription. The
+// subscription's settings (see client.Subscribe.Notify) override the global settings (see client.Config.Notify),
+// which override the defaults (see defaultNotifySettings). Invalid priorities are ignored, see validateNotifyOptions.
+func resolveNotifySettings(conf *client.Config, s *client.Subscribe) map[int]*notifySettings {
+	resolved := make(map[int]*notifySettings)
+	for priority, settings := range defaultNotifySettings {
+		resolved[priority] = &settings
+	}
+	overrides := []map[string]*client.NotifyOptions{conf.Notify}
+	if s != nil {
+		overrides = append(overrides, s.Notify)
+	}
+	for _, notify := range overrides {
+		for key, options := range notify {
+			priority, err := util.ParsePriority(key)
+			if err != nil || priority == 0 || options == nil {
+				continue
+			}
+			if options.Urgency != nil {
+				resolved[priority].urgency = *options.Urgency
+			}
+			if options.Sound != nil {
+				resolved[priority].sound = *options.Sound
+			}
+			if options.Sticky != nil {
+				resolved[priority].sticky = *options.Sticky
+			}
+		}
+	}
+	return resolved
+}
+
+// validateNotifyOptions checks the "notify" settings of the config file and its subscriptions,
+// so that typos are reported on startup rather than ignored.
+func validateNotifyOptions(conf *client.Config) error {
+	validate := func(notify map[string]*client.NotifyOptions) error {
+		for key, options := range notify {
+			if priority, err := util.ParsePriority(key); err != nil || priority == 0 {
+				return fmt.Errorf("invalid notify settings: %s", util.DescribeInvalidPriority(key))
+			} else if options == nil {
+				continue
+			} else if options.Urgency != nil && *options.Urgency != notifyUrgencyLow && *options.Urgency != notifyUrgencyNormal && *options.Urgency != notifyUrgencyCritical {
+				return fmt.Errorf("invalid notify settings for priority %s: urgency must be low, normal or critical", key)
+			} else if options.Sound != nil && strings.TrimSpace(*options.Sound) == "" {
+				return fmt.Errorf("invalid notify settings for priority %s: sound must be default, none, or a sound name", key)
+			}
+		}
+		return nil
+	}
+	if err := validate(conf.Notify); err != nil {
+		return err
+	}
+	for _, s := range conf.Subscribe {
+		if err := validate(s.Notify); err != nil {
+			return fmt.Errorf("subscription %s: %w", s.Topic, err)
+		}
+	}
+	return nil
+}
+
+// encodePowerShellCommand encodes the given script for powershell.exe -EncodedCommand (base64 of UTF-16LE),
+// which avoids any quoting issues on the command line.
+func encodePowerShellCommand(script string) string {
+	encoded := utf16.Encode([]rune(script))
+	b := make([]byte, len(encoded)*2)
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(b[i*2:], r)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// runHTTPAction sends the HTTP request of the given "http" action, see https://ntfy.sh/docs/publish/#send-http-request.
+func runHTTPAction(action *client.Action) error {
+	method := action.Method
+	if method == "" {
+		method = http.MethodPost // Default is POST, like in the Android app
+	}
+	req, err := http.NewRequest(method, action.URL, strings.NewReader(action.Body))
+	if err != nil {
+		return err
+	}
+	for k, v := range action.Headers {
+		req.Header.Set(k, v)
+	}
+	httpClient := &http.Client{Timeout: toastHTTPActionTimeout}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
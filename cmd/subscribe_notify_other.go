@@ -0,0 +1,14 @@
+//go:build !windows
+
+package cmd
+
+import "errors"
+
+const (
+	notifySupported = false
+)
+
+// showToast is not supported on this platform, see subscribe_notify_windows.go
+func showToast(_ string) (string, error) {
+	return "", errors.New("desktop notifications are only supported on Windows")
+}
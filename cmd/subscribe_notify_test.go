@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestFormatToast_Actions(t *testing.T) {
+	m := &client.Message{
+		Topic:    "alerts",
+		Title:    "Door <open>",
+		Message:  "Garage door is open",
+		Priority: 4,
+		Click:    "https://home.lan/garage",
+		Actions: []*client.Action{
+			{ID: "a1", Action: "view", Label: "Open camera", URL: "https://home.lan/cam?x=1&y=2"},
+			{ID: "a2", Action: "http", Label: "Close door", URL: "https://home.lan/api/close", Method: "PUT"},
+			{ID: "a3", Action: "broadcast", Label: "Android only"},
+		},
+	}
+	settings := resolveNotifySettings(client.NewConfig(), nil)
+	require.Equal(t, `<toast activationType="protocol" launch="https://home.lan/garage"><visual><binding template="ToastGeneric">`+
+		`<text>Door &lt;open&gt;</text><text>Garage door is open</text></binding></visual><actions>`+
+		`<action content="Open camera" arguments="https://home.lan/cam?x=1&amp;y=2" activationType="protocol"></action>`+
+		`<action content="Close door" arguments="ntfy-action:a2" activationType="foreground"></action>`+
+		`</actions></toast>`, formatToast(m, settings[4]))
+}
+
+func TestFormatToast_Priorities(t *testing.T) {
+	settings := resolveNotifySettings(client.NewConfig(), nil)
+	m := &client.Message{Topic: "alerts", Message: "Server down"}
+	require.Equal(t, `<toast scenario="reminder"><visual><binding template="ToastGeneric"><text>alerts</text><text>Server down</text></binding></visual>`+
+		`<actions><action content="Dismiss" arguments="dismiss" activationType="system"></action></actions>`+
+		`<audio src="ms-winsoundevent:Notification.Reminder"></audio></toast>`, formatToast(m, settings[5]))
+	require.Equal(t, `<toast><visual><binding template="ToastGeneric"><text>alerts</text><text>Server down</text></binding></visual>`+
+		`<audio silent="true"></audio></toast>`, formatToast(m, settings[1]))
+	require.Equal(t, `<toast><visual><binding template="ToastGeneric"><text>alerts</text><text>Server down</text></binding></visual></toast>`, formatToast(m, settings[3]))
+	require.Equal(t, `<toast scenario="urgent"><visual><binding template="ToastGeneric"><text>alerts</text><text>Server down</text></binding></visual>`+
+		`<audio src="ms-winsoundevent:Notification.IM"></audio></toast>`, formatToast(m, &notifySettings{urgency: notifyUrgencyCritical, sound: "Notification.IM"}))
+}
+
+func TestResolveNotifySettings(t *testing.T) {
+	conf := client.NewConfig()
+	conf.Notify = map[string]*client.NotifyOptions{
+		"high": {Sound: util.String("Notification.SMS")},
+		"5":    {Sticky: util.Bool(false)},
+	}
+	conf.Subscribe = []client.Subscribe{
+		{Topic: "alerts", Notify: map[string]*client.NotifyOptions{"urgent": {Urgency: util.String("low")}, "min": {Sound: util.String("default")}}},
+	}
+	settings := resolveNotifySettings(conf, nil)
+	require.Equal(t, notifySettings{urgency: notifyUrgencyNormal, sound: "Notification.SMS"}, *settings[4])
+	require.Equal(t, notifySettings{urgency: notifyUrgencyCritical, sound: "ms-winsoundevent:Notification.Reminder"}, *settings[5])
+
+	settings = resolveNotifySettings(conf, &conf.Subscribe[0])
+	require.Equal(t, notifySettings{urgency: notifyUrgencyLow, sound: "ms-winsoundevent:Notification.Reminder"}, *settings[5])
+	require.Equal(t, notifySettings{urgency: notifyUrgencyLow, sound: notifySoundDefault}, *settings[1])
+	require.Equal(t, notifySettings{urgency: notifyUrgencyLow, sound: notifySoundNone}, defaultNotifySettings[1]) // Defaults not modified
+
+	handler := &messageHandler{notify: settings}
+	require.Equal(t, settings[3], handler.notifySettings(0))
+}
+
+func TestValidateNotifyOptions(t *testing.T) {
+	conf := client.NewConfig()
+	conf.Notify = map[string]*client.NotifyOptions{"max": {Urgency: util.String("critical"), Sound: util.String("none")}}
+	require.Nil(t, validateNotifyOptions(conf))
+
+	conf.Notify = map[string]*client.NotifyOptions{"urgnet": {Sticky: util.Bool(true)}}
+	require.EqualError(t, validateNotifyOptions(conf), `invalid notify settings: unknown priority "urgnet", did you mean "urgent"?`)
+
+	conf.Notify = nil
+	conf.Subscribe = []client.Subscribe{{Topic: "alerts", Notify: map[string]*client.NotifyOptions{"4": {Urgency: util.String("loud")}}}}
+	require.EqualError(t, validateNotifyOptions(conf), "subscription alerts: invalid notify settings for priority 4: urgency must be low, normal or critical")
+}
+
+func TestToastScript(t *testing.T) {
+	script := toastScript(`<toast><text>it's</text></toast>`, true, 0)
+	require.Contains(t, script, `$xml.LoadXml('<toast><text>it''s</text></toast>')`)
+	require.NotContains(t, script, "Wait-Event")
+	require.NotContains(t, script, "SuppressPopup")
+
+	script = toastScript(`<toast></toast>`, false, 10*time.Minute)
+	require.Contains(t, script, "$toast.SuppressPopup = $true\n")
+	require.Contains(t, script, "Register-ObjectEvent -InputObject $toast -EventName Activated")
+	require.Contains(t, script, "$event = Wait-Event -Timeout 600\n")
+}
+
+func TestEncodePowerShellCommand(t *testing.T) {
+	decoded, err := base64.StdEncoding.DecodeString(encodePowerShellCommand("echo ü"))
+	require.Nil(t, err)
+	require.Equal(t, []byte{'e', 0, 'c', 0, 'h', 0, 'o', 0, ' ', 0, 0xfc, 0}, decoded)
+}
+
+func TestRunHTTPAction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+		require.Equal(t, `{"door":"close"}`, string(body))
+	}))
+	defer server.Close()
+
+	require.Nil(t, runHTTPAction(&client.Action{Action: "http", URL: server.URL + "/close", Headers: map[string]string{"Authorization": "Bearer abc"}, Body: `{"door":"close"}`}))
+	require.EqualError(t, runHTTPAction(&client.Action{Action: "http", URL: server.URL + "/fail", Method: "DELETE"}), "403 Forbidden")
+}
+
+func TestCLI_Subscribe_Notify_Unsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("desktop notifications are supported on Windows")
+	}
+	app, _, _, _ := newTestApp()
+	require.ErrorContains(t, app.Run([]string{"ntfy", "subscribe", "--notify", "mytopic"}), "--notify is only supported on Windows")
+}
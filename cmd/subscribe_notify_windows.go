@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"os/exec"
+	"strings"
+)
+
+const (
+	notifySupported = true
+)
+
+// showToast runs the given PowerShell script (see toastScript), and returns its output, i.e.
+// the arguments of the clicked toast button, if any.
+func showToast(script string) (string, error) {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-EncodedCommand", encodePowerShellCommand(script))
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
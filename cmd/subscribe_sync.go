@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+)
+
+const (
+	accountSyncInterval = 15 * time.Minute // Full re-sync, in case a sync event was missed
+)
+
+// accountSync keeps the subscriptions of "ntfy subscribe" in sync with the subscriptions stored in the user's
+// account on the default host, the same way the web app and the mobile apps do it: the server publishes an
+// event to the account's sync topic whenever the account changes, upon which the account is re-fetched, and
+// topics are subscribed to or unsubscribed from accordingly.
+//
+// Topics from the config file or the command line ("local topics") are added to the account at startup, and
+// are never unsubscribed from, even if they are removed from the account.
+type accountSync struct {
+	cl                      *client.Client
+	baseURL                 string
+	auth                    client.SubscribeOption
+	command                 string                   // Command for topics from the account, see Config.DefaultCommand
+	options                 []client.SubscribeOption // Subscribe options for topics from the account
+	cmds                    map[string]string        // Subscription ID -> command, shared with doSubscribe
+	local                   map[string]bool          // Topic URLs of local topics
+	synced                  map[string]string        // Topic URL -> subscription ID, for topics from the account
+	syncTopicSubscriptionID string
+}
+
+func newAccountSync(cl *client.Client, conf *client.Config, cmds map[string]string, auth client.SubscribeOption, options ...client.SubscribeOption) *accountSync {
+	return &accountSync{
+		cl:      cl,
+		baseURL: strings.TrimSuffix(conf.DefaultHost, "/"),
+		auth:    auth,
+		command: conf.DefaultCommand,
+		options: options,
+		cmds:    cmds,
+		local:   make(map[string]bool),
+		synced:  make(map[string]string),
+	}
+}
+
+// Start adds the local topics to the account, if they are not already in it, and subscribes to the topics
+// of the account and to its sync topic. Unlike Sync, it fails if the account cannot be retrieved.
+func (s *accountSync) Start(localTopics []string) error {
+	account, err := s.cl.Account(s.baseURL, s.auth)
+	if err != nil {
+		return err
+	}
+	for _, topic := range localTopics {
+		topicURL, err := s.cl.TopicURL(topic)
+		if err != nil {
+			return err
+		}
+		s.local[topicURL] = true
+		if accountHasTopic(account, topicURL) {
+			continue
+		}
+		subscription := &client.AccountSubscription{
+			BaseURL: topicURL[:strings.LastIndex(topicURL, "/")],
+			Topic:   topicURL[strings.LastIndex(topicURL, "/")+1:],
+		}
+		log.Info("%s Adding topic to account", util.ShortTopicURL(topicURL))
+		if err := s.cl.AddAccountSubscription(s.baseURL, subscription, s.auth); err != nil {
+			return err
+		}
+	}
+	if account.SyncTopic != "" {
+		subscriptionID, err := s.cl.Subscribe(s.baseURL+"/"+account.SyncTopic, s.auth)
+		if err != nil {
+			return err
+		}
+		s.syncTopicSubscriptionID = subscriptionID
+	}
+	return s.apply(account)
+}
+
+// Sync re-fetches the account, and subscribes to new topics and unsubscribes from removed topics. Errors are
+// only logged, so that a temporarily unreachable server does not stop the existing subscriptions.
+func (s *accountSync) Sync() {
+	log.Debug("%s Syncing subscriptions with account", util.ShortTopicURL(s.baseURL))
+	account, err := s.cl.Account(s.baseURL, s.auth)
+	if err != nil {
+		log.Warn("%s Cannot sync subscriptions with account: %s", util.ShortTopicURL(s.baseURL), err.Error())
+		return
+	}
+	if err := s.apply(account); err != nil {
+		log.Warn("%s Cannot sync subscriptions with account: %s", util.ShortTopicURL(s.baseURL), err.Error())
+	}
+}
+
+// IsSyncEvent returns true if the message was received on the account's sync topic
+func (s *accountSync) IsSyncEvent(m *client.Message) bool {
+	return s.syncTopicSubscriptionID != "" && m.SubscriptionID == s.syncTopicSubscriptionID
+}
+
+func (s *accountSync) apply(account *client.Account) error {
+	for topicURL, subscriptionID := range s.synced {
+		if !accountHasTopic(account, topicURL) {
+			log.Info("%s Topic was removed from account, unsubscribing", util.ShortTopicURL(topicURL))
+			s.cl.Unsubscribe(subscriptionID)
+			delete(s.cmds, subscriptionID)
+			delete(s.synced, topicURL)
+		}
+	}
+	for _, subscription := range account.Subscriptions {
+		topicURL := subscription.TopicURL()
+		if _, ok := s.synced[topicURL]; ok || s.local[topicURL] {
+			continue
+		}
+		log.Info("%s Topic was added to account, subscribing", util.ShortTopicURL(topicURL))
+		subscriptionID, err := s.cl.Subscribe(topicURL, s.options...)
+		if err != nil {
+			return err
+		}
+		s.cmds[subscriptionID] = s.command
+		s.synced[topicURL] = subscriptionID
+	}
+	return nil
+}
+
+func accountHasTopic(account *client.Account, topicURL string) bool {
+	for _, subscription := range account.Subscriptions {
+		if subscription.TopicURL() == topicURL {
+			return true
+		}
+	}
+	return false
+}
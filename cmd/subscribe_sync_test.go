@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/client"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/test"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestCLI_Subscribe_AccountSync(t *testing.T) {
+	conf := server.NewConfig()
+	conf.AuthFile = filepath.Join(t.TempDir(), "user.db")
+	conf.AuthUsers = []*user.User{
+		{Name: "philuser", Hash: "$2a$10$U4WSIYY6evyGmZaraavM2e2JeVG6EMGUKN1uUwufUeeRd4Jpg6cGC", Role: user.RoleUser}, // philuser:philpass
+	}
+	s, port := test.StartServerWithConfig(t, conf)
+	defer test.StopServer(t, s, port)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	clientConf := client.NewConfig()
+	clientConf.DefaultHost = baseURL
+	clientConf.DefaultCommand = "echo synced"
+	cl := client.New(clientConf)
+	auth := client.WithBasicAuth("philuser", "philpass")
+
+	// Topic added on the phone
+	require.Nil(t, cl.AddAccountSubscription(baseURL, &client.AccountSubscription{BaseURL: baseURL, Topic: "phonetopic"}, auth))
+
+	cmds := make(map[string]string)
+	sync := newAccountSync(cl, clientConf, cmds, auth, auth)
+	require.Nil(t, sync.Start([]string{"desktoptopic"}))
+
+	// Local topic was added to the account, account topic was subscribed to
+	account, err := cl.Account(baseURL, auth)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(account.Subscriptions))
+	require.Equal(t, baseURL+"/desktoptopic", account.Subscriptions[1].TopicURL())
+	require.Equal(t, 1, len(sync.synced))
+	subscriptionID := sync.synced[baseURL+"/phonetopic"]
+	require.Equal(t, "echo synced", cmds[subscriptionID])
+
+	time.Sleep(300 * time.Millisecond) // Wait for subscription
+	_, err = cl.Publish("phonetopic", "from the phone", auth)
+	require.Nil(t, err)
+	m := <-cl.Messages
+	for sync.IsSyncEvent(m) { // Adding the local topic may have triggered a sync event
+		m = <-cl.Messages
+	}
+	require.Equal(t, subscriptionID, m.SubscriptionID)
+	require.Equal(t, "from the phone", m.Message)
+
+	// Topic removed on the phone: the sync topic receives an event, and the topic is unsubscribed from
+	req, _ := http.NewRequest(http.MethodDelete, baseURL+"/v1/account/subscription", nil)
+	req.Header.Set("Authorization", util.BasicAuth("philuser", "philpass"))
+	req.Header.Set("X-BaseURL", baseURL)
+	req.Header.Set("X-Topic", "phonetopic")
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+
+	select {
+	case m = <-cl.Messages:
+		require.True(t, sync.IsSyncEvent(m))
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync event not received")
+	}
+	sync.Sync()
+	require.Empty(t, sync.synced)
+	require.NotContains(t, cmds, subscriptionID)
+}
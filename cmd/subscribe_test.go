@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -415,3 +416,69 @@ subscribe:
 
 	require.Equal(t, message, strings.TrimSpace(stdout.String()))
 }
+
+func TestCLI_Subscribe_CommandEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses sh syntax")
+	}
+	message := `{"id":"RXIQBFaieLVr","time":124,"expires":1124,"event":"message","topic":"mytopic","message":"triggered"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(message))
+	}))
+	defer server.Close()
+
+	t.Setenv("NTFY_TEST_ALLOWED", "allowed")
+	t.Setenv("NTFY_TEST_BLOCKED", "blocked")
+	filename := filepath.Join(t.TempDir(), "client.yml")
+	require.Nil(t, os.WriteFile(filename, []byte(fmt.Sprintf(`
+default-host: %s
+command-env:
+  - PATH
+  - NTFY_TEST_ALL*
+subscribe:
+  - topic: mytopic
+    command: 'echo "env: [$NTFY_TEST_ALLOWED] [$NTFY_TEST_BLOCKED] [$STATIC] [$m]"'
+    env:
+      STATIC: static value
+      NTFY_MESSAGE: overridden by message
+  - topic: mytopic
+    command: 'echo "override: [$NTFY_TEST_ALLOWED] [$NTFY_TEST_BLOCKED]"'
+    command-env: [NTFY_TEST_BLOCKED]
+`, server.URL)), 0600))
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "subscribe", "--poll", "--from-config", "--config=" + filename}))
+	require.Contains(t, stdout.String(), "env: [allowed] [] [static value] [triggered]")
+	require.Contains(t, stdout.String(), "override: [] [blocked]")
+}
+
+func TestCLI_Subscribe_Network_Proxy(t *testing.T) {
+	message := `{"id":"RXIQBFaieLVr","time":124,"expires":1124,"event":"message","topic":"mytopic","message":"triggered"}`
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "ntfy.invalid", r.URL.Host)
+		require.Equal(t, "/mytopic/json", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(message))
+	}))
+	defer proxy.Close()
+
+	filename := filepath.Join(t.TempDir(), "client.yml")
+	require.Nil(t, os.WriteFile(filename, []byte(fmt.Sprintf(`
+subscribe:
+  - topic: http://ntfy.invalid/mytopic
+    proxy: %s
+`, proxy.URL)), 0600))
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, app.Run([]string{"ntfy", "subscribe", "--poll", "--from-config", "--config=" + filename}))
+	require.Equal(t, message, strings.TrimSpace(stdout.String()))
+
+	// Invalid settings are reported on startup
+	require.Nil(t, os.WriteFile(filename, []byte(`
+subscribe:
+  - topic: mytopic
+    proxy: ftp://proxy.lan
+`), 0600))
+	app, _, _, _ = newTestApp()
+	require.ErrorContains(t, app.Run([]string{"ntfy", "subscribe", "--from-config", "--config=" + filename}), "subscription mytopic: invalid proxy URL")
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
+	"strings"
 )
 
 func init() {
@@ -55,6 +56,8 @@ var cmdTier = &cli.Command{
 				&cli.StringFlag{Name: "attachment-total-size-limit", Value: defaultAttachmentTotalSizeLimit, Usage: "total size limit of attachments for the user"},
 				&cli.StringFlag{Name: "attachment-expiry-duration", Value: defaultAttachmentExpiryDuration, Usage: "duration after which attachments are deleted"},
 				&cli.StringFlag{Name: "attachment-bandwidth-limit", Value: defaultAttachmentBandwidthLimit, Usage: "daily bandwidth limit for attachment uploads/downloads"},
+				&cli.StringFlag{Name: "attachment-allowed-types", Usage: "comma-separated list of allowed attachment MIME types, e.g. image/*,application/pdf (default: all)"},
+				&cli.StringFlag{Name: "attachment-denied-types", Usage: "comma-separated list of denied attachment MIME types, e.g. video/*"},
 				&cli.StringFlag{Name: "stripe-monthly-price-id", Usage: "Monthly Stripe price ID for paid tiers (e.g. price_12345)"},
 				&cli.StringFlag{Name: "stripe-yearly-price-id", Usage: "Yearly Stripe price ID for paid tiers (e.g. price_12345)"},
 				&cli.BoolFlag{Name: "ignore-exists", Usage: "if the tier already exists, perform no action and exit"},
@@ -80,6 +83,10 @@ Examples:
     --attachment-expiry-duration=12h \
     --attachment-bandwidth-limit=5G \
     pro
+  ntfy tier add \                       # Add a tier that does not allow executables or videos
+    --name="Free" \
+    --attachment-denied-types="application/vnd.microsoft.portable-executable,video/*" \
+    free
 `,
 		},
 		{
@@ -99,6 +106,8 @@ Examples:
 				&cli.StringFlag{Name: "attachment-total-size-limit", Usage: "total size limit of attachments for the user"},
 				&cli.StringFlag{Name: "attachment-expiry-duration", Usage: "duration after which attachments are deleted"},
 				&cli.StringFlag{Name: "attachment-bandwidth-limit", Usage: "daily bandwidth limit for attachment uploads/downloads"},
+				&cli.StringFlag{Name: "attachment-allowed-types", Usage: "comma-separated list of allowed attachment MIME types, or empty to allow all"},
+				&cli.StringFlag{Name: "attachment-denied-types", Usage: "comma-separated list of denied attachment MIME types, or empty to deny none"},
 				&cli.StringFlag{Name: "stripe-monthly-price-id", Usage: "Monthly Stripe price ID for paid tiers (e.g. price_12345)"},
 				&cli.StringFlag{Name: "stripe-yearly-price-id", Usage: "Yearly Stripe price ID for paid tiers (e.g. price_12345)"},
 			},
@@ -117,6 +126,7 @@ Examples:
     --stripe-monthly-price-id=price_1234 \
     --stripe-monthly-price-id=price_5678 \
     pro
+  ntfy tier change --attachment-allowed-types="image/*" free   # Only allow images
 `,
 		},
 		{
@@ -218,6 +228,14 @@ func execTierAdd(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	attachmentAllowedTypes, err := parseContentTypePatterns(c.String("attachment-allowed-types"))
+	if err != nil {
+		return err
+	}
+	attachmentDeniedTypes, err := parseContentTypePatterns(c.String("attachment-denied-types"))
+	if err != nil {
+		return err
+	}
 	tier := &user.Tier{
 		ID:                       "", // Generated
 		Code:                     code,
@@ -231,6 +249,8 @@ func execTierAdd(c *cli.Context) error {
 		AttachmentTotalSizeLimit: attachmentTotalSizeLimit,
 		AttachmentExpiryDuration: attachmentExpiryDuration,
 		AttachmentBandwidthLimit: attachmentBandwidthLimit,
+		AttachmentAllowedTypes:   attachmentAllowedTypes,
+		AttachmentDeniedTypes:    attachmentDeniedTypes,
 		StripeMonthlyPriceID:     c.String("stripe-monthly-price-id"),
 		StripeYearlyPriceID:      c.String("stripe-yearly-price-id"),
 	}
@@ -315,6 +335,18 @@ func execTierChange(c *cli.Context) error {
 			return err
 		}
 	}
+	if c.IsSet("attachment-allowed-types") {
+		tier.AttachmentAllowedTypes, err = parseContentTypePatterns(c.String("attachment-allowed-types"))
+		if err != nil {
+			return err
+		}
+	}
+	if c.IsSet("attachment-denied-types") {
+		tier.AttachmentDeniedTypes, err = parseContentTypePatterns(c.String("attachment-denied-types"))
+		if err != nil {
+			return err
+		}
+	}
 	if c.IsSet("stripe-monthly-price-id") {
 		tier.StripeMonthlyPriceID = c.String("stripe-monthly-price-id")
 	}
@@ -403,5 +435,31 @@ func printTier(c *cli.Context, tier *user.Tier) {
 	fmt.Fprintf(c.App.Writer, "- Attachment total size limit: %s\n", util.FormatSizeHuman(tier.AttachmentTotalSizeLimit))
 	fmt.Fprintf(c.App.Writer, "- Attachment expiry duration: %s (%d seconds)\n", tier.AttachmentExpiryDuration.String(), int64(tier.AttachmentExpiryDuration.Seconds()))
 	fmt.Fprintf(c.App.Writer, "- Attachment daily bandwidth limit: %s\n", util.FormatSizeHuman(tier.AttachmentBandwidthLimit))
+	fmt.Fprintf(c.App.Writer, "- Attachment allowed types: %s\n", formatContentTypePatterns(tier.AttachmentAllowedTypes, "(all)"))
+	fmt.Fprintf(c.App.Writer, "- Attachment denied types: %s\n", formatContentTypePatterns(tier.AttachmentDeniedTypes, "(none)"))
 	fmt.Fprintf(c.App.Writer, "- Stripe prices (monthly/yearly): %s\n", prices)
 }
+
+// parseContentTypePatterns parses a comma-separated list of MIME type patterns, e.g. "image/*,application/pdf".
+//
+// Parameters:
+//   - s: The comma-separated list, may be empty.
+//
+// Returns:
+//   - The list of patterns, or an error if a pattern is invalid.
+func parseContentTypePatterns(s string) ([]string, error) {
+	patterns := util.Map(util.SplitNoEmpty(strings.ToLower(s), ","), strings.TrimSpace)
+	for _, pattern := range patterns {
+		if !user.AllowedContentTypePattern(pattern) {
+			return nil, fmt.Errorf("invalid MIME type %s, must be a type like application/pdf, or a wildcard like video/*", pattern)
+		}
+	}
+	return patterns, nil
+}
+
+func formatContentTypePatterns(patterns []string, empty string) string {
+	if len(patterns) == 0 {
+		return empty
+	}
+	return strings.Join(patterns, ", ")
+}
@@ -25,6 +25,8 @@ func TestCLI_Tier_AddListChangeDelete(t *testing.T) {
 	require.Contains(t, stdout.String(), "tier pro (id: ti_")
 	require.Contains(t, stdout.String(), "- Name: Pro")
 	require.Contains(t, stdout.String(), "- Message limit: 1234")
+	require.Contains(t, stdout.String(), "- Attachment allowed types: (all)")
+	require.Contains(t, stdout.String(), "- Attachment denied types: (none)")
 
 	app, _, stdout, _ = newTestApp()
 	require.Nil(t, runTierCommand(app, conf, "change",
@@ -36,6 +38,8 @@ func TestCLI_Tier_AddListChangeDelete(t *testing.T) {
 		"--attachment-expiry-duration=1d",
 		"--attachment-total-size-limit=10G",
 		"--attachment-bandwidth-limit=100G",
+		"--attachment-allowed-types=image/*, application/pdf",
+		"--attachment-denied-types=image/svg+xml",
 		"--stripe-monthly-price-id=price_991",
 		"--stripe-yearly-price-id=price_992",
 		"pro",
@@ -47,8 +51,15 @@ func TestCLI_Tier_AddListChangeDelete(t *testing.T) {
 	require.Contains(t, stdout.String(), "- Attachment file size limit: 100.0 MB")
 	require.Contains(t, stdout.String(), "- Attachment expiry duration: 24h")
 	require.Contains(t, stdout.String(), "- Attachment total size limit: 10.0 GB")
+	require.Contains(t, stdout.String(), "- Attachment allowed types: image/*, application/pdf")
+	require.Contains(t, stdout.String(), "- Attachment denied types: image/svg+xml")
 	require.Contains(t, stdout.String(), "- Stripe prices (monthly/yearly): price_991 / price_992")
 
+	app, _, _, _ = newTestApp()
+	err = runTierCommand(app, conf, "change", "--attachment-denied-types=exe", "pro")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "invalid MIME type exe")
+
 	app, _, stdout, _ = newTestApp()
 	require.Nil(t, runTierCommand(app, conf, "remove", "pro"))
 	require.Contains(t, stdout.String(), "tier pro removed")
@@ -55,12 +55,22 @@ Examples:
 			Name:      "remove",
 			Aliases:   []string{"del", "rm"},
 			Usage:     "Removes a token",
-			UsageText: "ntfy token remove USERNAME TOKEN",
+			UsageText: "ntfy token remove USERNAME TOKEN\nntfy token remove --all [--except=TOKEN] USERNAME",
 			Action:    execTokenDel,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "all", Aliases: []string{"a"}, Usage: "remove all tokens of the user (logs out all sessions)"},
+				&cli.StringFlag{Name: "except", Aliases: []string{"e"}, Usage: "keep this token when removing all tokens"},
+			},
 			Description: `Remove a token from the ntfy user database.
 
+Removing a token revokes the corresponding web app session or API token. To log a user out 
+everywhere, pass --all. To log a user out everywhere except for one session, also pass --except.
+Provisioned tokens (defined in the server config) are never removed by --all.
+
 Example:
-  ntfy token del phil tk_th2srHVlxrANQHAso5t0HuQ1J1TjN`,
+  ntfy token del phil tk_th2srHVlxrANQHAso5t0HuQ1J1TjN                  # Remove a single token
+  ntfy token del --all phil                                             # Remove all tokens of user phil
+  ntfy token del --all --except=tk_th2srHVlxrANQHAso5t0HuQ1J1TjN phil   # Remove all other tokens`,
 		},
 		{
 			Name:    "list",
@@ -154,8 +164,13 @@ func execTokenAdd(c *cli.Context) error {
 //   - An error if the user or token does not exist, or deletion fails.
 func execTokenDel(c *cli.Context) error {
 	username, token := c.Args().Get(0), c.Args().Get(1)
-	if username == "" || token == "" {
+	all, except := c.Bool("all"), c.String("except")
+	if all && (username == "" || token != "") {
+		return errors.New("username expected, and token not allowed with --all, type 'ntfy token remove --help' for help")
+	} else if !all && (username == "" || token == "") {
 		return errors.New("username and token expected, type 'ntfy token remove --help' for help")
+	} else if !all && except != "" {
+		return errors.New("--except can only be used with --all, type 'ntfy token remove --help' for help")
 	} else if username == userEveryone || username == user.Everyone {
 		return errors.New("username not allowed")
 	}
@@ -169,6 +184,17 @@ func execTokenDel(c *cli.Context) error {
 	} else if err != nil {
 		return err
 	}
+	if all {
+		if err := manager.RemoveOtherTokens(u.ID, except); err != nil {
+			return err
+		}
+		if except != "" {
+			fmt.Fprintf(c.App.Writer, "all tokens for user %s removed, except %s\n", username, except)
+		} else {
+			fmt.Fprintf(c.App.Writer, "all tokens for user %s removed\n", username)
+		}
+		return nil
+	}
 	if err := manager.RemoveToken(u.ID, token); err != nil {
 		return err
 	}
@@ -221,10 +247,13 @@ func execTokenList(c *cli.Context) error {
 		usersWithTokens++
 		fmt.Fprintf(c.App.Writer, "user %s\n", u.Name)
 		for _, t := range tokens {
-			var label, expires, provisioned string
+			var label, expires, userAgent, provisioned string
 			if t.Label != "" {
 				label = fmt.Sprintf(" (%s)", t.Label)
 			}
+			if t.LastUserAgent != "" {
+				userAgent = fmt.Sprintf(" via %s", t.LastUserAgent)
+			}
 			if t.Expires.Unix() == 0 {
 				expires = "never expires"
 			} else {
@@ -233,7 +262,7 @@ func execTokenList(c *cli.Context) error {
 			if t.Provisioned {
 				provisioned = " (server config)"
 			}
-			fmt.Fprintf(c.App.Writer, "- %s%s, %s, accessed from %s at %s%s\n", t.Value, label, expires, t.LastOrigin.String(), t.LastAccess.Format(time.RFC822), provisioned)
+			fmt.Fprintf(c.App.Writer, "- %s%s, %s, accessed from %s%s at %s%s\n", t.Value, label, expires, t.LastOrigin.String(), userAgent, t.LastAccess.Format(time.RFC822), provisioned)
 		}
 	}
 	if usersWithTokens == 0 {
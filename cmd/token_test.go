@@ -38,6 +38,44 @@ func TestCLI_Token_AddListRemove(t *testing.T) {
 	require.Equal(t, "no users with tokens\n", stdout.String())
 }
 
+func TestCLI_Token_RemoveAll(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+
+	re := regexp.MustCompile(`tk_\w+`)
+	tokens := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		app, _, stdout, _ := newTestApp()
+		require.Nil(t, runTokenCommand(app, conf, "add", "phil"))
+		tokens = append(tokens, re.FindString(stdout.String()))
+	}
+
+	app, _, _, _ = newTestApp()
+	require.Error(t, runTokenCommand(app, conf, "remove", "--except", tokens[0], "phil", tokens[1]))
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, runTokenCommand(app, conf, "remove", "--all", "--except", tokens[0], "phil"))
+	require.Contains(t, stdout.String(), fmt.Sprintf("all tokens for user phil removed, except %s", tokens[0]))
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runTokenCommand(app, conf, "list", "phil"))
+	require.Contains(t, stdout.String(), tokens[0])
+	require.NotContains(t, stdout.String(), tokens[1])
+	require.NotContains(t, stdout.String(), tokens[2])
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runTokenCommand(app, conf, "remove", "--all", "phil"))
+	require.Contains(t, stdout.String(), "all tokens for user phil removed")
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runTokenCommand(app, conf, "list", "phil"))
+	require.Equal(t, "user phil has no access tokens\n", stdout.String())
+}
+
 func runTokenCommand(app *cli.App, conf *server.Config, args ...string) error {
 	userArgs := []string{
 		"ntfy",
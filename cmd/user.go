@@ -4,12 +4,15 @@ package cmd
 
 import (
 	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"heckel.io/ntfy/v2/server"
 	"heckel.io/ntfy/v2/user"
+	"net/mail"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"github.com/urfave/cli/v2/altsrc"
@@ -29,6 +32,8 @@ var flagsUser = append(
 	&cli.StringFlag{Name: "config", Aliases: []string{"c"}, EnvVars: []string{"NTFY_CONFIG_FILE"}, Value: server.DefaultConfigFile, DefaultText: server.DefaultConfigFile, Usage: "config file"},
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-file", Aliases: []string{"auth_file", "H"}, EnvVars: []string{"NTFY_AUTH_FILE"}, Usage: "auth database file used for access control"}),
 	altsrc.NewStringFlag(&cli.StringFlag{Name: "auth-default-access", Aliases: []string{"auth_default_access", "p"}, EnvVars: []string{"NTFY_AUTH_DEFAULT_ACCESS"}, Value: "read-write", Usage: "default permissions if no matching entries in the auth database are found"}),
+	altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "auth-access-templates", Aliases: []string{"auth_access_templates"}, EnvVars: []string{"NTFY_AUTH_ACCESS_TEMPLATES"}, Usage: "access control entries applied to new users, e.g. 'user-<username>-*:rw'"}),
+	altsrc.NewIntFlag(&cli.IntFlag{Name: "auth-bcrypt-cost", Aliases: []string{"auth_bcrypt_cost"}, EnvVars: []string{"NTFY_AUTH_BCRYPT_COST"}, Value: user.DefaultUserPasswordBcryptCost, Usage: "bcrypt cost of password hashes"}),
 )
 
 var cmdUser = &cli.Command{
@@ -43,7 +48,7 @@ var cmdUser = &cli.Command{
 			Name:      "add",
 			Aliases:   []string{"a"},
 			Usage:     "Adds a new user",
-			UsageText: "ntfy user add [--role=admin|user] USERNAME\nNTFY_PASSWORD=... ntfy user add [--role=admin|user] USERNAME\nNTFY_PASSWORD_HASH=... ntfy user add [--role=admin|user] USERNAME",
+			UsageText: "ntfy user add [--role=admin|user|ROLE] USERNAME\nNTFY_PASSWORD=... ntfy user add [--role=admin|user|ROLE] USERNAME\nNTFY_PASSWORD_HASH=... ntfy user add [--role=admin|user|ROLE] USERNAME",
 			Action:    execUserAdd,
 			Flags: []cli.Flag{
 				&cli.StringFlag{Name: "role", Aliases: []string{"r"}, Value: string(user.RoleUser), Usage: "user role"},
@@ -53,11 +58,16 @@ var cmdUser = &cli.Command{
 
 A user can be either a regular user, or an admin. A regular user has no read or write access (unless
 granted otherwise by the auth-default-access setting). An admin user has read and write access to all
-topics.
+topics. If auth-access-templates is set, new regular users are automatically granted the access defined
+in the templates (e.g. 'user-<username>-*:rw').
+
+Users may also be assigned a custom role (see 'ntfy role'). They are regular users with additional
+capabilities, e.g. to manage other users via the API.
 
 Examples:
   ntfy user add phil                          # Add regular user phil
   ntfy user add --role=admin phil             # Add admin user phil
+  ntfy user add --role=operator phil          # Add user phil with custom role "operator"
   NTFY_PASSWORD=... ntfy user add phil        # Add user, using env variable to set password (for scripts)
   NTFY_PASSWORD_HASH=... ntfy user add phil   # Add user, using env variable to set password hash (for scripts)
 
@@ -95,6 +105,40 @@ Example:
 
 You may set the NTFY_PASSWORD environment variable to pass the new password or NTFY_PASSWORD_HASH to pass
 directly the bcrypt hash. This is useful if you are updating users via scripts.
+`,
+		},
+		{
+			Name:      "expire-pass",
+			Aliases:   []string{"exp"},
+			Usage:     "Forces a user to choose a new password",
+			UsageText: "ntfy user expire-pass USERNAME",
+			Action:    execUserExpirePass,
+			Description: `Mark the password of the given user as expired.
+
+The user is logged out everywhere (all access tokens are deleted), and any further
+login with the current password is rejected. The user can then choose a new password
+via the password reset flow (if enabled), or an admin can set one via 'ntfy user change-pass'.
+
+This is useful if you suspect that a user's password has been compromised.
+
+Example:
+  ntfy user expire-pass phil
+`,
+		},
+		{
+			Name:      "change-email",
+			Aliases:   []string{"che"},
+			Usage:     "Changes the email address of a user",
+			UsageText: "ntfy user change-email USERNAME (EMAIL|-)",
+			Action:    execUserChangeEmail,
+			Description: `Change the email address of the given user.
+
+The email address is used to send password reset emails to the user, if
+enable-password-reset is set in the server config. Pass "-" to remove the address.
+
+Example:
+  ntfy user change-email phil phil@example.com   # Set email address for user phil
+  ntfy user change-email phil -                  # Remove email address from user phil
 `,
 		},
 		{
@@ -103,36 +147,65 @@ directly the bcrypt hash. This is useful if you are updating users via scripts.
 			Usage:     "Changes the role of a user",
 			UsageText: "ntfy user change-role USERNAME ROLE",
 			Action:    execUserChangeRole,
-			Description: `Change the role for the given user to admin or user.
+			Description: `Change the role for the given user to admin, user, or a custom role.
 
 This command can be used to change the role of a user either from a regular user
 to an admin user, or the other way around:
 
 - admin: an admin has read/write access to all topics
 - user: a regular user only has access to what was explicitly granted via 'ntfy access'
+- any custom role defined via 'ntfy role add': a regular user with additional capabilities
 
 When changing the role of a user to "admin", all access control entries for that 
 user are removed, since they are no longer necessary.
 
 Example:
-  ntfy user change-role phil admin   # Make user phil an admin 
-  ntfy user change-role phil user    # Remove admin role from user phil 
+  ntfy user change-role phil admin      # Make user phil an admin 
+  ntfy user change-role phil user       # Remove admin role from user phil 
+  ntfy user change-role phil auditor    # Assign custom role "auditor" to user phil
 `,
 		},
 		{
 			Name:      "change-tier",
 			Aliases:   []string{"cht"},
 			Usage:     "Changes the tier of a user",
-			UsageText: "ntfy user change-tier USERNAME (TIER|-)",
+			UsageText: "ntfy user change-tier [--expires=TIME] USERNAME (TIER|-)",
 			Action:    execUserChangeTier,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "expires", Aliases: []string{"e"}, Usage: "time at which the tier expires, e.g. '30d' or a Unix timestamp"},
+			},
 			Description: `Change the tier for the given user.
 
 This command can be used to change the tier of a user. Tiers define usage limits, such
 as messages per day, attachment file sizes, etc.
 
+If --expires is passed, the tier expires at the given time. Expired tiers are downgraded
+by the server to the tier defined in 'tier-expiry-downgrade-tier' (or removed), after the
+grace period defined in 'tier-expiry-grace-period'. Changing the tier without --expires
+removes any existing expiry.
+
+Example:
+  ntfy user change-tier phil pro                 # Change tier to "pro" for user "phil"  
+  ntfy user change-tier --expires=30d phil pro   # Change tier to "pro" for 30 days
+  ntfy user change-tier phil -                   # Remove tier from user "phil" entirely 
+`,
+		},
+		{
+			Name:      "export",
+			Usage:     "Exports all data stored about a user as JSON",
+			UsageText: "ntfy user export USERNAME",
+			Action:    execUserExport,
+			Description: `Exports all data stored about a user in the user database as JSON, e.g. to answer
+a data access request. This includes the account details, access control entries, reservations,
+invites, phone numbers and access token metadata. Password hashes and token values are not exported.
+
+Cached messages are not part of the user database, and are not exported by this command. Users can
+download a full export including the messages on their reserved topics via the API (GET /v1/account/export).
+
+To delete a user and all of their data, use 'ntfy user remove'.
+
 Example:
-  ntfy user change-tier phil pro   # Change tier to "pro" for user "phil"  
-  ntfy user change-tier phil -     # Remove tier from user "phil" entirely 
+  ntfy user export phil > phil.json
 `,
 		},
 		{
@@ -149,6 +222,26 @@ Example:
   $ ntfy user hash
   (asks for password and confirmation)
   $2a$10$YLiO8U21sX1uhZamTLJXHuxgVC0Z/GKISibrKCLohPgtG7yIxSk4C
+`,
+		},
+		{
+			Name:      "weak-hashes",
+			Usage:     "Shows users whose password hash is weaker than the configured bcrypt cost",
+			UsageText: "ntfy user weak-hashes",
+			Action:    execUserWeakHashes,
+			Description: `Shows all users whose password hash uses a lower bcrypt cost than auth-bcrypt-cost.
+
+When a user logs in successfully with a weak password hash, the password is transparently
+re-hashed with the configured cost. This command shows which users have not logged in since
+the cost was raised. Provisioned users are never re-hashed; their hash must be updated in the
+auth-users config option instead.
+
+This is a server-only command. It directly reads from user.db as defined in the server config
+file server.yml. The command only works if 'auth-file' is properly defined.
+
+Example:
+  ntfy user weak-hashes                         # Show users with a bcrypt cost below auth-bcrypt-cost
+  ntfy user --auth-bcrypt-cost=12 weak-hashes   # Show users with a bcrypt cost below 12
 `,
 		},
 		{
@@ -180,6 +273,7 @@ Examples:
   NTFY_PASSWORD=... ntfy user add phil         # As above, using env variable to set password (for scripts)
   ntfy user add --role=admin phil              # Add admin user phil
   ntfy user del phil                           # Delete user phil
+  ntfy user export phil > phil.json            # Export all data of user phil as JSON
   ntfy user change-pass phil                   # Change password for user phil
   NTFY_PASSWORD=.. ntfy user change-pass phil  # As above, using env variable to set password (for scripts)
   ntfy user change-role phil admin             # Make user phil an admin 
@@ -210,12 +304,15 @@ func execUserAdd(c *cli.Context) error {
 	} else if username == userEveryone || username == user.Everyone {
 		return errors.New("username not allowed")
 	} else if !user.AllowedRole(role) {
-		return errors.New("role must be either 'user' or 'admin'")
+		return errors.New("role must be either 'user', 'admin', or a custom role")
 	}
 	manager, err := createUserManager(c)
 	if err != nil {
 		return err
 	}
+	if err := checkRoleExists(manager, role); err != nil {
+		return err
+	}
 	if user, _ := manager.User(username); user != nil {
 		if c.Bool("ignore-exists") {
 			fmt.Fprintf(c.App.Writer, "user %s already exists (exited successfully)\n", username)
@@ -304,6 +401,126 @@ func execUserChangePass(c *cli.Context) error {
 	return nil
 }
 
+// execUserExpirePass marks a user's password as expired.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if the user does not exist or the password cannot be expired.
+func execUserExpirePass(c *cli.Context) error {
+	username := c.Args().Get(0)
+	if username == "" {
+		return errors.New("username expected, type 'ntfy user expire-pass --help' for help")
+	} else if username == userEveryone || username == user.Everyone {
+		return errors.New("username not allowed")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if _, err := manager.User(username); errors.Is(err, user.ErrUserNotFound) {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+	if err := manager.ExpirePassword(username); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "expired password for user %s\n", username)
+	return nil
+}
+
+// execUserChangeEmail updates or removes a user's email address.
+//
+// Parameters:
+//   - c: The CLI context.
+//
+// Returns:
+//   - An error if the user does not exist, the email address is invalid, or the update fails.
+func execUserExport(c *cli.Context) error {
+	username := c.Args().Get(0)
+	if username == "" {
+		return errors.New("username expected, type 'ntfy user export --help' for help")
+	} else if username == userEveryone || username == user.Everyone {
+		return errors.New("username not allowed")
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	export, err := manager.Export(username)
+	if errors.Is(err, user.ErrUserNotFound) {
+		return fmt.Errorf("user %s does not exist", username)
+	} else if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, string(b))
+	return nil
+}
+
+func execUserWeakHashes(c *cli.Context) error {
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	users, err := manager.UsersWithWeakPasswordHash()
+	if err != nil {
+		return err
+	}
+	minCost := c.Int("auth-bcrypt-cost")
+	if len(users) == 0 {
+		fmt.Fprintf(c.App.Writer, "no users with weak password hashes (bcrypt cost below %d)\n", minCost)
+		return nil
+	}
+	for _, u := range users {
+		cost, err := user.PasswordHashCost(u.Hash)
+		if err != nil {
+			return err
+		}
+		if u.Provisioned {
+			fmt.Fprintf(c.App.Writer, "user %s: bcrypt cost %d, provisioned user, update the hash in auth-users\n", u.Name, cost)
+		} else {
+			fmt.Fprintf(c.App.Writer, "user %s: bcrypt cost %d, re-hashed on next login\n", u.Name, cost)
+		}
+	}
+	fmt.Fprintf(c.App.Writer, "%d user(s) with weak password hashes (bcrypt cost below %d)\n", len(users), minCost)
+	return nil
+}
+
+func execUserChangeEmail(c *cli.Context) error {
+	username := c.Args().Get(0)
+	email := c.Args().Get(1)
+	if username == "" || email == "" {
+		return errors.New("username and email address expected, type 'ntfy user change-email --help' for help")
+	} else if username == userEveryone || username == user.Everyone {
+		return errors.New("username not allowed")
+	}
+	if email == "-" {
+		email = ""
+	} else if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return fmt.Errorf("invalid email address %s", email)
+	}
+	manager, err := createUserManager(c)
+	if err != nil {
+		return err
+	}
+	if _, err := manager.User(username); errors.Is(err, user.ErrUserNotFound) {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+	if err := manager.ChangeEmail(username, email); err != nil {
+		return err
+	}
+	if email == "" {
+		fmt.Fprintf(c.App.Writer, "removed email address for user %s\n", username)
+	} else {
+		fmt.Fprintf(c.App.Writer, "changed email address for user %s to %s\n", username, email)
+	}
+	return nil
+}
+
 // execUserChangeRole updates a user's role.
 //
 // Parameters:
@@ -326,6 +543,9 @@ func execUserChangeRole(c *cli.Context) error {
 	if _, err := manager.User(username); errors.Is(err, user.ErrUserNotFound) {
 		return fmt.Errorf("user %s does not exist", username)
 	}
+	if err := checkRoleExists(manager, role); err != nil {
+		return err
+	}
 	if err := manager.ChangeRole(username, role); err != nil {
 		return err
 	}
@@ -370,6 +590,17 @@ func execUserChangeTier(c *cli.Context) error {
 	} else if username == userEveryone || username == user.Everyone {
 		return errors.New("username not allowed")
 	}
+	var expires time.Time
+	if c.String("expires") != "" {
+		if tier == tierReset {
+			return errors.New("cannot set --expires when removing the tier")
+		}
+		var err error
+		expires, err = util.ParseFutureTime(c.String("expires"), time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid expires: %s", c.String("expires"))
+		}
+	}
 	manager, err := createUserManager(c)
 	if err != nil {
 		return err
@@ -386,7 +617,14 @@ func execUserChangeTier(c *cli.Context) error {
 		if err := manager.ChangeTier(username, tier); err != nil {
 			return err
 		}
-		fmt.Fprintf(c.App.Writer, "changed tier for user %s to %s\n", username, tier)
+		if err := manager.ChangeTierExpiry(username, expires); err != nil {
+			return err
+		}
+		if !expires.IsZero() {
+			fmt.Fprintf(c.App.Writer, "changed tier for user %s to %s, expires %s\n", username, tier, expires.Format(time.RFC1123))
+		} else {
+			fmt.Fprintf(c.App.Writer, "changed tier for user %s to %s\n", username, tier)
+		}
 	}
 	return nil
 }
@@ -430,12 +668,21 @@ func createUserManager(c *cli.Context) (*user.Manager, error) {
 	if err != nil {
 		return nil, errors.New("if set, auth-default-access must start set to 'read-write', 'read-only', 'write-only' or 'deny-all'")
 	}
+	authAccessTemplates, err := parseAccessTemplates(c.StringSlice("auth-access-templates"))
+	if err != nil {
+		return nil, err
+	}
+	authBcryptCost := c.Int("auth-bcrypt-cost")
+	if authBcryptCost < user.DefaultUserPasswordBcryptCost || authBcryptCost > user.MaxUserPasswordBcryptCost {
+		return nil, fmt.Errorf("if set, auth-bcrypt-cost must be between %d and %d", user.DefaultUserPasswordBcryptCost, user.MaxUserPasswordBcryptCost)
+	}
 	authConfig := &user.Config{
 		Filename:            authFile,
 		StartupQueries:      authStartupQueries,
 		DefaultAccess:       authDefault,
+		AccessTemplates:     authAccessTemplates,
 		ProvisionEnabled:    false, // Hack: Do not re-provision users on manager initialization
-		BcryptCost:          user.DefaultUserPasswordBcryptCost,
+		BcryptCost:          authBcryptCost,
 		QueueWriterInterval: user.DefaultUserStatsQueueWriterInterval,
 	}
 	return user.NewManager(authConfig)
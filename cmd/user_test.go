@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
 	"heckel.io/ntfy/v2/server"
@@ -83,6 +84,44 @@ func TestCLI_User_ChangePass(t *testing.T) {
 	require.Error(t, runUserCommand(app, conf, "change-pass", "philuser"))
 }
 
+func TestCLI_User_ExpirePass_ChangeEmail(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	// Add user
+	app, stdin, stdout, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+	require.Contains(t, stdout.String(), "user phil added with role user")
+
+	// Change email
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "change-email", "phil", "phil@example.com"))
+	require.Contains(t, stdout.String(), "changed email address for user phil to phil@example.com")
+
+	app, _, _, _ = newTestApp()
+	require.Error(t, runUserCommand(app, conf, "change-email", "phil", "not an email"))
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "change-email", "phil", "-"))
+	require.Contains(t, stdout.String(), "removed email address for user phil")
+
+	// Expire pass
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "expire-pass", "phil"))
+	require.Contains(t, stdout.String(), "expired password for user phil")
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "list"))
+	require.Contains(t, stdout.String(), "user phil (role: user, tier: none, password expired)")
+
+	// Expire pass of non-existing user
+	app, _, _, _ = newTestApp()
+	err := runUserCommand(app, conf, "expire-pass", "ben")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "user ben does not exist")
+}
+
 func TestCLI_User_ChangeRole(t *testing.T) {
 	s, conf, port := newTestServerWithAuth(t)
 	defer test.StopServer(t, s, port)
@@ -99,6 +138,41 @@ func TestCLI_User_ChangeRole(t *testing.T) {
 	require.Contains(t, stdout.String(), "changed role for user phil to admin")
 }
 
+func TestCLI_User_ChangeTier_Expires(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, _, _, _ := newTestApp()
+	require.Nil(t, runTierCommand(app, conf, "add", "--name", "Pro", "pro"))
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+
+	// Change tier with expiry
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "change-tier", "--expires", "30d", "phil", "pro"))
+	require.Contains(t, stdout.String(), "changed tier for user phil to pro, expires")
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "list"))
+	require.Contains(t, stdout.String(), "user phil (role: user, tier: Pro, expires ")
+
+	// Invalid expiry, and expiry without tier
+	app, _, _, _ = newTestApp()
+	require.Error(t, runUserCommand(app, conf, "change-tier", "--expires", "invalid", "phil", "pro"))
+	app, _, _, _ = newTestApp()
+	require.Error(t, runUserCommand(app, conf, "change-tier", "--expires", "30d", "phil", "-"))
+
+	// Changing the tier without expiry removes the expiry
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "change-tier", "phil", "pro"))
+	require.Contains(t, stdout.String(), "changed tier for user phil to pro\n")
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "list"))
+	require.Contains(t, stdout.String(), "user phil (role: user, tier: Pro)")
+}
+
 func TestCLI_User_Delete(t *testing.T) {
 	s, conf, port := newTestServerWithAuth(t)
 	defer test.StopServer(t, s, port)
@@ -121,6 +195,52 @@ func TestCLI_User_Delete(t *testing.T) {
 	require.Contains(t, err.Error(), "user phil does not exist")
 }
 
+func TestCLI_User_Export(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+	app, _, _, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "change-email", "phil", "phil@example.com"))
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "export", "phil"))
+	var export user.Export
+	require.Nil(t, json.Unmarshal(stdout.Bytes(), &export))
+	require.Equal(t, "phil", export.Username)
+	require.Equal(t, "phil@example.com", export.Email)
+
+	app, _, _, _ = newTestApp()
+	err := runUserCommand(app, conf, "export", "ben")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "user ben does not exist")
+}
+
+func TestCLI_User_WeakHashes(t *testing.T) {
+	s, conf, port := newTestServerWithAuth(t)
+	defer test.StopServer(t, s, port)
+
+	app, stdin, _, _ := newTestApp()
+	stdin.WriteString("mypass\nmypass")
+	require.Nil(t, runUserCommand(app, conf, "add", "phil"))
+
+	app, _, stdout, _ := newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "weak-hashes"))
+	require.Equal(t, "no users with weak password hashes (bcrypt cost below 10)\n", stdout.String())
+
+	app, _, stdout, _ = newTestApp()
+	require.Nil(t, runUserCommand(app, conf, "--auth-bcrypt-cost=11", "weak-hashes"))
+	require.Contains(t, stdout.String(), "user phil: bcrypt cost 10, re-hashed on next login")
+	require.Contains(t, stdout.String(), "1 user(s) with weak password hashes (bcrypt cost below 11)")
+
+	app, _, _, _ = newTestApp()
+	err := runUserCommand(app, conf, "--auth-bcrypt-cost=4", "weak-hashes")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "auth-bcrypt-cost must be between 10 and 31")
+}
+
 func newTestServerWithAuth(t *testing.T) (s *server.Server, conf *server.Config, port int) {
 	configFile := filepath.Join(t.TempDir(), "server-dummy.yml")
 	require.Nil(t, os.WriteFile(configFile, []byte(""), 0600)) // Dummy config file to avoid lookup of real server.yml
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+// ColorMode defines whether text log events are colorized
+type ColorMode int
+
+// Color modes
+const (
+	ColorAuto   ColorMode = iota // Colorize if the output is a terminal, and the NO_COLOR environment variable is not set
+	ColorAlways                  // Always colorize
+	ColorNever                   // Never colorize
+)
+
+// ANSI escape codes used to colorize text log events
+const (
+	colorReset   = "\x1b[0m"
+	colorBold    = "\x1b[1m"
+	colorDim     = "\x1b[2m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+	colorBoldRed = "\x1b[1;31m"
+)
+
+func (m ColorMode) String() string {
+	switch m {
+	case ColorAuto:
+		return "auto"
+	case ColorAlways:
+		return "always"
+	case ColorNever:
+		return "never"
+	}
+	return "unknown"
+}
+
+// ToColorMode converts a string to a ColorMode. It returns ColorAuto if the string
+// does not match any known color modes.
+func ToColorMode(s string) ColorMode {
+	switch strings.ToLower(s) {
+	case "always", "true", "yes":
+		return ColorAlways
+	case "never", "false", "no":
+		return ColorNever
+	default:
+		return ColorAuto
+	}
+}
+
+// colorize returns true if text log events written to an output with the given color mode should be
+// colorized. terminal defines whether the output is a terminal.
+func colorize(mode ColorMode, terminal bool) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorAuto:
+		return terminal && os.Getenv("NO_COLOR") == ""
+	default:
+		return false
+	}
+}
+
+// isTerminal returns true if the given writer is a terminal, e.g. os.Stderr if it is not redirected
+func isTerminal(w io.Writer) bool {
+	if pw, ok := w.(*peekLogWriter); ok {
+		w = pw.w
+	}
+	f, ok := w.(interface{ Fd() uintptr })
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// levelColor returns the ANSI color of the given log level
+func levelColor(l Level) string {
+	switch l {
+	case TraceLevel:
+		return colorGray
+	case DebugLevel:
+		return colorCyan
+	case InfoLevel:
+		return colorGreen
+	case WarnLevel:
+		return colorYellow
+	case ErrorLevel:
+		return colorRed
+	default:
+		return colorBoldRed
+	}
+}
@@ -0,0 +1,45 @@
+package log
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestColorMode_AlwaysNeverAuto(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	DisableDates()
+
+	Tag("manager").Info("not a terminal")
+	SetColorMode(ColorAlways)
+	Tag("manager").Warn("always colored")
+	Error("no fields")
+	SetFormat(JSONFormat)
+	Info("json is never colored")
+	SetFormat(TextFormat)
+	SetColorMode(ColorNever)
+	Info("never colored")
+
+	expected := "INFO not a terminal (tag=manager)\n" +
+		"\x1b[33mWARN\x1b[0m always colored \x1b[2m(tag=manager)\x1b[0m\n" +
+		"\x1b[31mERROR\x1b[0m no fields\n"
+	require.Equal(t, expected, out.String()[:len(expected)])
+	require.Contains(t, out.String(), `{"time":`)
+	require.Contains(t, out.String(), "\nINFO never colored\n")
+}
+
+func TestColorMode_NoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	require.False(t, colorize(ColorAuto, true))
+	require.True(t, colorize(ColorAlways, true))
+	require.False(t, colorize(ColorAuto, false))
+}
+
+func TestToColorMode(t *testing.T) {
+	require.Equal(t, ColorAuto, ToColorMode("auto"))
+	require.Equal(t, ColorAlways, ToColorMode("ALWAYS"))
+	require.Equal(t, ColorNever, ToColorMode("never"))
+	require.Equal(t, ColorAuto, ToColorMode("invalid"))
+}
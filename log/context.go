@@ -0,0 +1,35 @@
+package log
+
+import (
+	"context"
+)
+
+// loggerContextKey is the context key for the Logger attached to a context.Context
+type loggerContextKey struct{}
+
+// WithContext returns a copy of ctx that carries the given logger. This is typically a child logger with
+// request-scoped fields (e.g. a request ID), so that all log events created via FromContext while handling
+// the request contain these fields.
+//
+// Parameters:
+//   - ctx: The parent context.
+//   - logger: The logger to attach to the context.
+//
+// Returns:
+//   - A new context carrying the logger.
+func WithContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext returns the logger attached to ctx via WithContext. If no logger is attached, it returns
+// a nil Logger, which logs using the global package state.
+//
+// Parameters:
+//   - ctx: The context to read the logger from.
+//
+// Returns:
+//   - The attached logger, or nil.
+func FromContext(ctx context.Context) *Logger {
+	logger, _ := ctx.Value(loggerContextKey{}).(*Logger)
+	return logger
+}
@@ -0,0 +1,28 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestContext_WithContextFromContext(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	DisableDates()
+
+	ctx := context.Background()
+	require.Nil(t, FromContext(ctx))
+	FromContext(ctx).Info("no fields") // Nil logger logs using the global state
+
+	v := &fakeVisitor{UserID: "u_abc", IP: "1.2.3.4"}
+	ctx = WithContext(ctx, FromContext(ctx).Child(Context{"request_id": "abc123"}))
+	ctx = WithContext(ctx, FromContext(ctx).ChildWith(v))
+	FromContext(ctx).Tag("http").Info("request finished")
+	expected := `INFO no fields
+INFO request finished (request_id=abc123, tag=http, user_id=u_abc, visitor_ip=1.2.3.4)
+`
+	require.Equal(t, expected, out.String())
+}
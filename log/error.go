@@ -0,0 +1,108 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+const (
+	fieldErrorType  = "error_type"
+	fieldErrorCause = "error_cause"
+	fieldErrorStack = "error_stack"
+	maxStackDepth   = 32
+)
+
+// stackTracer is implemented by errors that carry a stack trace, see WithStack
+type stackTracer interface {
+	StackTrace() string
+}
+
+// stackError is an error that carries the stack trace of the place where it was created
+type stackError struct {
+	err   error
+	stack []uintptr
+}
+
+// WithStack wraps err with the stack trace of the caller. If the error (or an error wrapping it) is
+// logged via Event.Err, the stack trace is added to the log event as "error_stack" field.
+//
+// Parameters:
+//   - err: The error to wrap. If nil, nil is returned.
+//
+// Returns:
+//   - The wrapped error, which unwraps to err and has the same error message.
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	var st stackTracer
+	if errors.As(err, &st) {
+		return err // Keep the innermost (original) stack trace
+	}
+	stack := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(2, stack) // Skip runtime.Callers and WithStack
+	return &stackError{
+		err:   err,
+		stack: stack[:n],
+	}
+}
+
+// Error returns the message of the wrapped error
+func (e *stackError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *stackError) Unwrap() error {
+	return e.err
+}
+
+// StackTrace returns the stack trace in a format similar to runtime/debug.Stack
+func (e *stackError) StackTrace() string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		sb.WriteString(fmt.Sprintf("%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line))
+		if !more {
+			break
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// errorContexter adds the fields of an error to a log event, see Event.Err. Like all Contexters,
+// it is only evaluated if the event is actually logged.
+type errorContexter struct {
+	err error
+}
+
+// Context returns the error message, the type and message of the root cause, and the stack trace
+// (if any) as log context. If an error in the chain implements Contexter, its fields are added as well.
+func (c *errorContexter) Context() Context {
+	fields := make(Context)
+	var contexter Contexter
+	if errors.As(c.err, &contexter) {
+		fields.Merge(contexter.Context())
+	}
+	root := c.err
+	for {
+		next := errors.Unwrap(root)
+		if next == nil {
+			break
+		}
+		root = next
+	}
+	fields[fieldError] = c.err.Error()
+	fields[fieldErrorType] = fmt.Sprintf("%T", root)
+	if root != c.err && root.Error() != c.err.Error() {
+		fields[fieldErrorCause] = root.Error()
+	}
+	var st stackTracer
+	if errors.As(c.err, &st) {
+		fields[fieldErrorStack] = st.StackTrace()
+	}
+	return fields
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestErr_Simple(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	DisableDates()
+
+	Err(errors.New("some error")).Warn("Something failed")
+	Err(nil).Info("No error")
+	expected := `WARN Something failed (error=some error, error_type=*errors.errorString)
+INFO No error
+`
+	require.Equal(t, expected, out.String())
+}
+
+func TestErr_Wrapped(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetFormat(JSONFormat)
+
+	_, err := os.Open("/does/not/exist")
+	Tag("config").Err(fmt.Errorf("cannot load config: %w", err)).Error("Startup failed")
+
+	var m map[string]any
+	require.Nil(t, json.Unmarshal(out.Bytes(), &m))
+	require.Equal(t, "cannot load config: open /does/not/exist: no such file or directory", m["error"])
+	require.Equal(t, "syscall.Errno", m["error_type"])
+	require.Equal(t, "no such file or directory", m["error_cause"])
+	require.Nil(t, m["error_stack"])
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestErr_WrappedContexter(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	DisableDates()
+
+	err := fmt.Errorf("publishing failed: %w", &fakeError{Code: 123, Message: "some error"})
+	Err(err).Info("hi")
+	expected := `INFO hi (error=publishing failed: some error, error_cause=some error, error_code=123, error_type=*log.fakeError)
+`
+	require.Equal(t, expected, out.String())
+}
+
+func TestErr_WithStack(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetFormat(JSONFormat)
+
+	require.Nil(t, WithStack(nil))
+	err := WithStack(errors.New("some error"))
+	require.Equal(t, "some error", err.Error())
+	require.Same(t, err, WithStack(err))                                        // Stack is not replaced
+	wrapped := fmt.Errorf("outer: %w", WithStack(fmt.Errorf("inner: %w", err))) // Innermost stack is kept
+	Err(wrapped).Error("Something failed")
+
+	var m map[string]any
+	require.Nil(t, json.Unmarshal(out.Bytes(), &m))
+	require.Equal(t, "outer: inner: some error", m["error"])
+	require.Equal(t, "*errors.errorString", m["error_type"])
+	require.Equal(t, "some error", m["error_cause"])
+	stack := m["error_stack"].(string)
+	require.True(t, strings.HasPrefix(stack, "heckel.io/ntfy/v2/log.TestErr_WithStack\n\t"))
+	require.Contains(t, stack, "error_test.go:")
+}
+
+func TestErr_NotRenderedIfNotLogged(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetLevel(InfoLevel)
+
+	e := &countingError{}
+	Err(e).Debug("not logged")
+	require.Equal(t, 0, e.count)
+	require.Equal(t, "", out.String())
+}
+
+type countingError struct {
+	count int
+}
+
+func (e *countingError) Error() string {
+	e.count++
+	return "counting error"
+}
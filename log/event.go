@@ -27,6 +27,7 @@ type Event struct {
 	time       time.Time
 	contexters []Contexter
 	fields     Context
+	config     *loggerConfig // Config of the Logger that created this event, nil means global package state
 }
 
 // newEvent creates a new log event
@@ -89,14 +90,16 @@ func (e *Event) Timing(f func()) *Event {
 	return e.Field(fieldTimeTaken, time.Since(start).Milliseconds())
 }
 
-// Err adds an "error" field to the log event
+// Err adds the error to the log event as structured fields: the error message ("error"), the type and message
+// of the root cause of wrapped errors ("error_type" and "error_cause"), and the stack trace if the error was
+// wrapped via WithStack ("error_stack"). If the error implements Contexter, its own fields are used instead.
 func (e *Event) Err(err error) *Event {
 	if err == nil {
 		return e
 	} else if c, ok := err.(Contexter); ok {
 		return e.With(c)
 	}
-	return e.Field(fieldError, err.Error())
+	return e.With(&errorContexter{err: err})
 }
 
 // Field adds a custom field and value to the log event
@@ -139,14 +142,15 @@ func (e *Event) With(contexters ...Contexter) *Event {
 
 // Render returns the rendered log event as a string, or an empty string. The event is only rendered,
 // if either the global log level is >= l, or if the log level in one of the overrides matches
-// the level.
+// the level, and if it is not suppressed by a sampling rule (see AddSampleRule). Sensitive fields and
+// tokens are masked before rendering (see SetRedactedFields).
 //
 // If no overrides are defined (default), the Contexter array is not applied unless the event
 // is actually logged. If overrides are defined, then Contexters have to be applied in any case
 // to determine if they match. This is super complicated, but required for efficiency.
 func (e *Event) Render(l Level, message string, v ...any) string {
 	appliedContexters := e.maybeApplyContexters()
-	if !e.Loggable(l) {
+	if !e.Loggable(l) || !e.sampled(l, message) {
 		return ""
 	}
 	e.Message = fmt.Sprintf(message, v...)
@@ -155,23 +159,54 @@ func (e *Event) Render(l Level, message string, v ...any) string {
 	if !appliedContexters {
 		e.applyContexters()
 	}
-	if CurrentFormat() == JSONFormat {
+	e.redact()
+	if e.currentFormat() == JSONFormat {
 		return e.JSON()
+	} else if e.colorize() {
+		return e.ColorString()
 	}
 	return e.String()
 }
 
-// Log logs the event to the defined output, or does nothing if Render returns an empty string
+// Log logs the event to the defined output and to all additional outputs whose level matches, or does
+// nothing if Render returns an empty string
 func (e *Event) Log(l Level, message string, v ...any) *Event {
 	if m := e.Render(l, message, v...); m != "" {
-		log.Println(m)
+		if e.config != nil {
+			e.config.write(e, l, m)
+			return e
+		}
+		if e.globalLevelWithOverride() <= l {
+			if w := currentLevelWriter(); w != nil {
+				writeLevel(w, e, l, m)
+			} else {
+				log.Println(m)
+			}
+		}
+		for _, o := range currentOutputs() {
+			if e.outputLevelWithOverride(o) <= l {
+				o.write(e, l)
+			}
+		}
 	}
 	return e
 }
 
-// Loggable returns true if the given log level is lower or equal to the current log level
+// Loggable returns true if the given log level is lower or equal to the current log level, or to the
+// level of any of the additional outputs (see AddOutput)
 func (e *Event) Loggable(l Level) bool {
-	return e.globalLevelWithOverride() <= l
+	if e.config != nil {
+		return e.loggerLevelWithOverride() <= l
+	}
+	if e.globalLevelWithOverride() <= l {
+		return true
+	}
+	for _, o := range currentOutputs() {
+		if e.outputLevelWithOverride(o) <= l {
+			return true
+		}
+	}
+	return false
 }
 
 // IsTrace returns true if the current log level is TraceLevel
@@ -200,38 +235,113 @@ func (e *Event) String() string {
 	if len(e.fields) == 0 {
 		return fmt.Sprintf("%s %s", e.Level.String(), e.Message)
 	}
+	return fmt.Sprintf("%s %s (%s)", e.Level.String(), e.Message, e.fieldsString())
+}
+
+// ColorString returns the event as a string, with a colored level and dimmed fields
+func (e *Event) ColorString() string {
+	level := levelColor(e.Level) + e.Level.String() + colorReset
+	if len(e.fields) == 0 {
+		return fmt.Sprintf("%s %s", level, e.Message)
+	}
+	return fmt.Sprintf("%s %s %s(%s)%s", level, e.Message, colorDim, e.fieldsString(), colorReset)
+}
+
+func (e *Event) fieldsString() string {
 	fields := make([]string, 0)
 	for k, v := range e.fields {
 		fields = append(fields, fmt.Sprintf("%s=%v", k, v))
 	}
 	sort.Strings(fields)
-	return fmt.Sprintf("%s %s (%s)", e.Level.String(), e.Message, strings.Join(fields, ", "))
+	return strings.Join(fields, ", ")
 }
 
 func (e *Event) globalLevelWithOverride() Level {
-	mu.RLock()
-	l, ov := level, overrides
-	mu.RUnlock()
-	if e.fields == nil {
+	if l, ok := e.overrideLevel(); ok {
+		return l
+	}
+	return CurrentLevel()
+}
+
+// outputLevelWithOverride returns the level of the given output, unless one of the overrides matches.
+// Overrides apply to all outputs, so that debugging with overrides works regardless of the output.
+func (e *Event) outputLevelWithOverride(o *logOutput) Level {
+	if l, ok := e.overrideLevel(); ok {
+		return l
+	}
+	return o.level
+}
+
+// loggerLevelWithOverride returns the level of the Logger that created this event, unless one of
+// its overrides matches
+func (e *Event) loggerLevelWithOverride() Level {
+	if l, ok := e.overrideLevel(); ok {
 		return l
 	}
+	e.config.mu.RLock()
+	defer e.config.mu.RUnlock()
+	return e.config.level
+}
+
+// colorize returns true if the event is written to a colorized output (see SetColorMode)
+func (e *Event) colorize() bool {
+	if e.config == nil {
+		mu.RLock()
+		defer mu.RUnlock()
+		return colorize(colorMode, terminal)
+	}
+	e.config.mu.RLock()
+	defer e.config.mu.RUnlock()
+	return colorize(e.config.color, e.config.terminal)
+}
+
+func (e *Event) currentFormat() Format {
+	if e.config == nil {
+		return CurrentFormat()
+	}
+	e.config.mu.RLock()
+	defer e.config.mu.RUnlock()
+	return e.config.format
+}
+
+func (e *Event) overrideLevel() (Level, bool) {
+	if e.fields == nil {
+		return 0, false
+	}
+	var ov map[string][]*levelOverride
+	if e.config != nil {
+		e.config.mu.RLock()
+		ov = e.config.overrides
+		e.config.mu.RUnlock()
+	} else {
+		mu.RLock()
+		ov = overrides
+		mu.RUnlock()
+	}
 	for field, fieldOverrides := range ov {
 		value, exists := e.fields[field]
 		if exists {
 			for _, o := range fieldOverrides {
 				if o.value == "" || o.value == value || o.value == fmt.Sprintf("%v", value) {
-					return o.level
+					return o.level, true
 				}
 			}
 		}
 	}
-	return l
+	return 0, false
 }
 
 func (e *Event) maybeApplyContexters() bool {
-	mu.RLock()
-	hasOverrides := len(overrides) > 0
-	mu.RUnlock()
+	var hasOverrides bool
+	if e.config != nil {
+		e.config.mu.RLock()
+		hasOverrides = len(e.config.overrides) > 0
+		e.config.mu.RUnlock()
+	} else {
+		mu.RLock()
+		hasOverrides = len(overrides) > 0
+		mu.RUnlock()
+	}
 	if hasOverrides {
 		e.applyContexters()
 	}
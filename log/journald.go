@@ -0,0 +1,191 @@
+package log
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	journaldSocket       = "/run/systemd/journal/socket"
+	journaldMaxFieldName = 64
+	journaldFieldPrefix  = "NTFY_" // Prefix for fields that collide with journal fields, or start with a digit
+)
+
+var (
+	// journaldReservedFields are the journal fields set by the JournaldWriter itself (or by journald), which
+	// must not be overwritten by log event fields
+	journaldReservedFields = map[string]bool{
+		"MESSAGE":           true,
+		"MESSAGE_ID":        true,
+		"PRIORITY":          true,
+		"SYSLOG_IDENTIFIER": true,
+		"SYSLOG_FACILITY":   true,
+		"SYSLOG_PID":        true,
+		"SYSLOG_TIMESTAMP":  true,
+		"CODE_FILE":         true,
+		"CODE_LINE":         true,
+		"CODE_FUNC":         true,
+		"ERRNO":             true,
+	}
+)
+
+// eventWriter is an io.Writer that wants to receive the log event itself, instead of the rendered event, e.g.
+// to preserve the fields of the event. If the output implements eventWriter, WriteEvent is called instead of
+// Write or WriteLevel.
+type eventWriter interface {
+	LevelWriter
+	WriteEvent(e *Event) error
+}
+
+// JournaldWriter is a LevelWriter that sends log events to the systemd journal using its native protocol.
+// Unlike logging to stderr (which systemd captures as plain text), the fields of log events are preserved
+// as journal fields, e.g. the "visitor_ip" field can be queried via "journalctl VISITOR_IP=1.2.3.4". Log
+// levels are mapped to journal priorities, which are the same as syslog severities.
+type JournaldWriter struct {
+	address    string
+	identifier string
+	conn       net.Conn
+	mu         sync.Mutex
+}
+
+var _ eventWriter = (*JournaldWriter)(nil)
+
+// NewJournaldWriter connects to the systemd journal and returns a JournaldWriter.
+//
+// Parameters:
+//   - identifier: The syslog identifier to send with each message, e.g. "ntfy".
+//
+// Returns:
+//   - A new JournaldWriter, or an error if the journal socket is not available.
+func NewJournaldWriter(identifier string) (*JournaldWriter, error) {
+	return newJournaldWriter(journaldSocket, identifier)
+}
+
+func newJournaldWriter(address, identifier string) (*JournaldWriter, error) {
+	w := &JournaldWriter{
+		address:    address,
+		identifier: identifier,
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends the given bytes to the journal with priority "informational". This is used for
+// messages that do not come from a log event, e.g. from Go's standard library logger.
+func (w *JournaldWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(InfoLevel, p)
+}
+
+// WriteLevel sends the given bytes to the journal as message, with the priority matching the given log level
+func (w *JournaldWriter) WriteLevel(l Level, p []byte) (int, error) {
+	if err := w.send(w.entry(l, strings.TrimRight(string(p), "\n"), nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteEvent sends the given log event to the journal, with its fields as journal fields
+func (w *JournaldWriter) WriteEvent(e *Event) error {
+	return w.send(w.entry(e.Level, e.Message, e.fields))
+}
+
+// Close closes the connection to the journal
+func (w *JournaldWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// send sends the given journal entry. If sending fails, the writer reconnects once and tries again.
+func (w *JournaldWriter) send(entry []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		if _, err := w.conn.Write(entry); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.connect(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write(entry)
+	return err
+}
+
+func (w *JournaldWriter) connect() error {
+	conn, err := net.Dial("unixgram", w.address)
+	if err != nil {
+		return fmt.Errorf("cannot connect to journal: %w", err)
+	}
+	w.conn = conn
+	return nil
+}
+
+// entry renders a journal entry in the native journal protocol, see https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+func (w *JournaldWriter) entry(l Level, message string, fields Context) []byte {
+	b := make([]byte, 0, 256)
+	b = appendJournaldField(b, "MESSAGE", message)
+	b = appendJournaldField(b, "PRIORITY", fmt.Sprintf("%d", syslogSeverity(l)))
+	b = appendJournaldField(b, "SYSLOG_IDENTIFIER", w.identifier)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, ok := fields[k].(string)
+		if !ok {
+			value = fmt.Sprintf("%v", fields[k])
+		}
+		b = appendJournaldField(b, journaldFieldName(k), value)
+	}
+	return b
+}
+
+// appendJournaldField appends a field to a journal entry. Values containing newlines are length-prefixed.
+func appendJournaldField(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	if !strings.Contains(value, "\n") {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// journaldFieldName converts a log field name to a valid journal field name, which may only contain uppercase
+// letters, digits and underscores, and must not start with an underscore or digit, e.g. "visitor_ip" becomes
+// "VISITOR_IP". Names that collide with journal fields (e.g. "priority") are prefixed with "NTFY_".
+func journaldFieldName(key string) string {
+	name := strings.TrimLeft(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		} else if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, key), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') || journaldReservedFields[name] {
+		name = journaldFieldPrefix + name
+	}
+	if len(name) > journaldMaxFieldName {
+		name = name[:journaldMaxFieldName]
+	}
+	return name
+}
@@ -0,0 +1,91 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournaldWriter_Event(t *testing.T) {
+	t.Cleanup(resetState)
+	conn, w := newTestJournald(t)
+	SetOutput(w)
+	SetLevelOverride("tag", "manager", DebugLevel)
+
+	Tag("manager").
+		Fields(Context{
+			"visitor_ip": "1.2.3.4",
+			"messages":   5,
+			"priority":   "high",
+			"2fa":        true,
+		}).
+		Err(errors.New("line 1\nline 2")).
+		Debug("Publishing %s", "message")
+	expected := "MESSAGE=Publishing message\n" +
+		"PRIORITY=7\n" +
+		"SYSLOG_IDENTIFIER=ntfy\n" +
+		"NTFY_2FA=true\n" +
+		"ERROR\n" + string(binary.LittleEndian.AppendUint64(nil, 13)) + "line 1\nline 2\n" +
+		"ERROR_TYPE=*errors.errorString\n" +
+		"MESSAGES=5\n" +
+		"NTFY_PRIORITY=high\n" +
+		"TAG=manager\n" +
+		"VISITOR_IP=1.2.3.4\n"
+	require.Equal(t, expected, readJournald(t, conn))
+}
+
+func TestJournaldWriter_AdditionalOutput(t *testing.T) {
+	t.Cleanup(resetState)
+	conn, w := newTestJournald(t)
+	SetOutput(&discardWriter{})
+	AddOutput(w, TextFormat, WarnLevel)
+
+	Info("not sent")
+	Error("sent")
+	require.Equal(t, "MESSAGE=sent\nPRIORITY=3\nSYSLOG_IDENTIFIER=ntfy\n", readJournald(t, conn))
+
+	_, err := w.Write([]byte("plain message\n"))
+	require.Nil(t, err)
+	require.Equal(t, "MESSAGE=plain message\nPRIORITY=6\nSYSLOG_IDENTIFIER=ntfy\n", readJournald(t, conn))
+}
+
+func TestJournaldWriter_FieldName(t *testing.T) {
+	require.Equal(t, "VISITOR_IP", journaldFieldName("visitor_ip"))
+	require.Equal(t, "HTTP_X_FORWARDED_FOR", journaldFieldName("http.x-forwarded-for"))
+	require.Equal(t, "HIDDEN", journaldFieldName("_hidden"))
+	require.Equal(t, "NTFY_MESSAGE", journaldFieldName("message"))
+	require.Equal(t, "NTFY_1ST", journaldFieldName("1st"))
+	require.Len(t, journaldFieldName("a_very_long_field_name_that_exceeds_the_maximum_length_of_journal_fields"), journaldMaxFieldName)
+}
+
+func TestJournaldWriter_NotAvailable(t *testing.T) {
+	_, err := newJournaldWriter(filepath.Join(t.TempDir(), "does-not-exist.sock"), "ntfy")
+	require.Error(t, err)
+}
+
+func newTestJournald(t *testing.T) (*net.UnixConn, *JournaldWriter) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	w, err := newJournaldWriter(socket, "ntfy")
+	require.Nil(t, err)
+	t.Cleanup(func() { w.Close() })
+	return conn, w
+}
+
+func readJournald(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	require.Nil(t, err)
+	return string(buf[:n])
+}
+
+type discardWriter struct{}
+
+func (w *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -12,18 +12,25 @@ import (
 
 // Defaults for package level variables
 var (
-	DefaultLevel  = InfoLevel
-	DefaultFormat = TextFormat
-	DefaultOutput = &peekLogWriter{os.Stderr}
+	DefaultLevel     = InfoLevel
+	DefaultFormat    = TextFormat
+	DefaultOutput    = &peekLogWriter{os.Stderr}
+	DefaultColorMode = ColorAuto
 )
 
 var (
-	level               = DefaultLevel
-	format              = DefaultFormat
-	overrides           = make(map[string][]*levelOverride)
-	output    io.Writer = DefaultOutput
-	filename            = ""
-	mu                  = &sync.RWMutex{}
+	level                  = DefaultLevel
+	format                 = DefaultFormat
+	overrides              = make(map[string][]*levelOverride)
+	output     io.Writer   = DefaultOutput
+	levelOut   LevelWriter // Set if the output is a LevelWriter, e.g. a SyslogWriter
+	baseLevel  Level       // Level to restore after the temporary level expires, see SetTemporaryLevel
+	levelTimer *time.Timer // Non-nil while a temporary level is active
+	levelUntil time.Time   // Time at which the temporary level expires
+	colorMode  = DefaultColorMode
+	terminal   = false // True if the output is a terminal, see SetColorMode
+	filename   = ""
+	mu         = &sync.RWMutex{}
 )
 
 // init sets the default log output (including log.SetOutput)
@@ -133,6 +140,18 @@ func Tag(tag string) *Event {
 	return newEvent().Tag(tag)
 }
 
+// Err creates a new log event and adds the error to it as structured fields (message, type, root
+// cause and stack trace), see Event.Err.
+//
+// Parameters:
+//   - err: The error to add. If nil, no fields are added.
+//
+// Returns:
+//   - A new Event pointer.
+func Err(err error) *Event {
+	return newEvent().Err(err)
+}
+
 // Time creates a new log event and sets the time field.
 //
 // Parameters:
@@ -165,7 +184,7 @@ func CurrentLevel() Level {
 	return level
 }
 
-// SetLevel sets a new log level.
+// SetLevel sets a new log level. If a temporary log level is active (see SetTemporaryLevel), it is discarded.
 //
 // Parameters:
 //   - newLevel: The new log level to set.
@@ -173,6 +192,73 @@ func SetLevel(newLevel Level) {
 	mu.Lock()
 	defer mu.Unlock()
 	level = newLevel
+	stopTemporaryLevel()
+}
+
+// SetTemporaryLevel sets a new log level for the given duration, after which the previous log level is
+// restored automatically. This is useful to diagnose production issues without a restart. If a temporary log
+// level is already active, it is replaced, but the level to restore stays the same.
+//
+// Parameters:
+//   - newLevel: The temporary log level to set.
+//   - d: The duration after which the previous log level is restored.
+func SetTemporaryLevel(newLevel Level, d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if levelTimer == nil {
+		baseLevel = level
+	} else {
+		levelTimer.Stop()
+	}
+	level = newLevel
+	levelUntil = time.Now().Add(d)
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		mu.Lock()
+		if levelTimer != timer {
+			mu.Unlock()
+			return // Replaced or discarded in the meantime
+		}
+		level = baseLevel
+		stopTemporaryLevel()
+		mu.Unlock()
+		Info("Temporary log level expired, log level is %s again", baseLevel.String())
+	})
+	levelTimer = timer
+}
+
+// ResetTemporaryLevel restores the log level that was active before SetTemporaryLevel was called.
+//
+// Returns:
+//   - True if a temporary log level was active, false otherwise.
+func ResetTemporaryLevel() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if levelTimer == nil {
+		return false
+	}
+	level = baseLevel
+	stopTemporaryLevel()
+	return true
+}
+
+// TemporaryLevelUntil returns the time at which the temporary log level expires.
+//
+// Returns:
+//   - The expiry time of the temporary log level, or the zero time if no temporary log level is active.
+func TemporaryLevelUntil() time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	return levelUntil
+}
+
+// stopTemporaryLevel discards the temporary log level, if any. The caller must hold the lock.
+func stopTemporaryLevel() {
+	if levelTimer != nil {
+		levelTimer.Stop()
+	}
+	levelTimer = nil
+	levelUntil = time.Time{}
 }
 
 // SetLevelOverride adds a log override for the given field.
@@ -220,6 +306,27 @@ func SetFormat(newFormat Format) {
 	}
 }
 
+// CurrentColorMode returns the current color mode.
+//
+// Returns:
+//   - The current color mode.
+func CurrentColorMode() ColorMode {
+	mu.RLock()
+	defer mu.RUnlock()
+	return colorMode
+}
+
+// SetColorMode defines whether text log events are colorized. By default (ColorAuto), they are colorized
+// if the output is a terminal, and not colorized if the output is redirected to a file or piped.
+//
+// Parameters:
+//   - mode: The new color mode to set.
+func SetColorMode(mode ColorMode) {
+	mu.Lock()
+	defer mu.Unlock()
+	colorMode = mode
+}
+
 // SetOutput sets the log output writer.
 //
 // Parameters:
@@ -228,7 +335,9 @@ func SetOutput(w io.Writer) {
 	mu.Lock()
 	defer mu.Unlock()
 	output = &peekLogWriter{w}
-	if f, ok := w.(*os.File); ok {
+	levelOut, _ = w.(LevelWriter)
+	terminal = isTerminal(w)
+	if f, ok := w.(namedWriter); ok {
 		filename = f.Name()
 	} else {
 		filename = ""
@@ -236,6 +345,19 @@ func SetOutput(w io.Writer) {
 	log.SetOutput(output)
 }
 
+// currentLevelWriter returns the output as a LevelWriter, or nil if the output is not a LevelWriter
+func currentLevelWriter() LevelWriter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return levelOut
+}
+
+// namedWriter is an io.Writer with a filename, e.g. an os.File or a RotatingFile
+type namedWriter interface {
+	io.Writer
+	Name() string
+}
+
 // File returns the log file, if any, or an empty string otherwise.
 //
 // Returns:
@@ -261,7 +383,8 @@ func DisableDates() {
 	log.SetFlags(0)
 }
 
-// Loggable returns true if the given log level is lower or equal to the current log level.
+// Loggable returns true if the given log level is lower or equal to the current log level, or to the
+// level of any of the additional outputs (see AddOutput).
 //
 // Parameters:
 //   - l: The level to check.
@@ -269,7 +392,7 @@ func DisableDates() {
 // Returns:
 //   - True if the level is loggable.
 func Loggable(l Level) bool {
-	return CurrentLevel() <= l
+	return minOutputLevel() <= l
 }
 
 // IsTrace returns true if the current log level is TraceLevel.
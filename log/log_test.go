@@ -300,4 +300,38 @@ func resetState() {
 	SetFormat(DefaultFormat)
 	SetOutput(DefaultOutput)
 	ResetLevelOverrides()
+	ResetOutputs()
+	ResetSampleRules()
+	SetColorMode(DefaultColorMode)
+	SetRedactedFields(nil)
+}
+
+func TestLog_TemporaryLevel(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetLevel(WarnLevel)
+	require.True(t, TemporaryLevelUntil().IsZero())
+
+	SetTemporaryLevel(DebugLevel, 100*time.Millisecond)
+	SetTemporaryLevel(TraceLevel, 200*time.Millisecond) // Replaces the first one, but keeps WARN as base level
+	require.Equal(t, TraceLevel, CurrentLevel())
+	require.False(t, TemporaryLevelUntil().IsZero())
+	time.Sleep(150 * time.Millisecond)
+	require.Equal(t, TraceLevel, CurrentLevel())
+	require.Eventually(t, func() bool {
+		return CurrentLevel() == WarnLevel
+	}, time.Second, 10*time.Millisecond)
+	require.True(t, TemporaryLevelUntil().IsZero())
+
+	SetTemporaryLevel(DebugLevel, time.Hour)
+	require.True(t, ResetTemporaryLevel())
+	require.Equal(t, WarnLevel, CurrentLevel())
+	require.False(t, ResetTemporaryLevel())
+
+	SetTemporaryLevel(DebugLevel, time.Hour)
+	SetLevel(ErrorLevel) // Discards the temporary level
+	require.True(t, TemporaryLevelUntil().IsZero())
+	require.False(t, ResetTemporaryLevel())
+	require.Equal(t, ErrorLevel, CurrentLevel())
 }
@@ -0,0 +1,317 @@
+package log
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Logger is a logger with its own level, format, output and level overrides, independent of the global
+// package state. This is useful for libraries (e.g. the ntfy client) and embedded servers, which should not
+// interfere with the logging of the application they are embedded in.
+//
+// Child loggers (see Child) share the configuration of their parent, and add context fields to all of their
+// log events. A nil Logger logs using the global package state, so it can be used as an optional logger.
+type Logger struct {
+	config     *loggerConfig // Shared with child loggers, nil means global package state
+	fields     Context       // Context fields added to all log events
+	contexters []Contexter   // Contexters added to all log events, see ChildWith
+}
+
+// loggerConfig is the configuration of a Logger, shared between a Logger and its child loggers
+type loggerConfig struct {
+	level     Level
+	format    Format
+	output    io.Writer
+	overrides map[string][]*levelOverride
+	samplers  []*sampler
+	dates     bool
+	color     ColorMode
+	terminal  bool // True if the output is a terminal
+	mu        sync.RWMutex
+	writeMu   sync.Mutex // Serializes writes to the output
+}
+
+// NewLogger creates a new Logger that writes to the given output, with the default level and format.
+//
+// Parameters:
+//   - w: The io.Writer to write logs to. If it is a LevelWriter, WriteLevel is called instead of Write.
+//
+// Returns:
+//   - A new Logger pointer.
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{
+		config: &loggerConfig{
+			level:     DefaultLevel,
+			format:    DefaultFormat,
+			output:    w,
+			overrides: make(map[string][]*levelOverride),
+			dates:     true,
+			color:     DefaultColorMode,
+			terminal:  isTerminal(w),
+		},
+	}
+}
+
+// Child returns a child logger, which shares the level, format, output and overrides with this logger,
+// and adds the given fields (and the fields of this logger) to all log events.
+func (l *Logger) Child(fields Context) *Logger {
+	child := l.child()
+	child.fields.Merge(fields)
+	return child
+}
+
+// ChildWith returns a child logger, which shares the level, format, output and overrides with this logger,
+// and adds the fields of the given Contexter structs (and the fields of this logger) to all log events. Like
+// With, the Contexters are only evaluated if an event is actually logged.
+func (l *Logger) ChildWith(contexters ...Contexter) *Logger {
+	child := l.child()
+	child.contexters = append(child.contexters, contexters...)
+	return child
+}
+
+func (l *Logger) child() *Logger {
+	child := &Logger{
+		fields: make(Context),
+	}
+	if l != nil {
+		child.config = l.config
+		child.fields.Merge(l.fields)
+		child.contexters = append(child.contexters, l.contexters...)
+	}
+	return child
+}
+
+// Fatal logs the message as FATAL, and exits the program with exit code 1
+func (l *Logger) Fatal(message string, v ...any) {
+	l.newEvent().Fatal(message, v...)
+}
+
+// Error logs the message with log level error
+func (l *Logger) Error(message string, v ...any) {
+	l.newEvent().Error(message, v...)
+}
+
+// Warn logs the message with log level warn
+func (l *Logger) Warn(message string, v ...any) {
+	l.newEvent().Warn(message, v...)
+}
+
+// Info logs the message with log level info
+func (l *Logger) Info(message string, v ...any) {
+	l.newEvent().Info(message, v...)
+}
+
+// Debug logs the message with log level debug
+func (l *Logger) Debug(message string, v ...any) {
+	l.newEvent().Debug(message, v...)
+}
+
+// Trace logs the message with log level trace
+func (l *Logger) Trace(message string, v ...any) {
+	l.newEvent().Trace(message, v...)
+}
+
+// With creates a new log event and adds the fields of the given Contexter structs
+func (l *Logger) With(contexts ...Contexter) *Event {
+	return l.newEvent().With(contexts...)
+}
+
+// Field creates a new log event and adds a custom field and value to it
+func (l *Logger) Field(key string, value any) *Event {
+	return l.newEvent().Field(key, value)
+}
+
+// Fields creates a new log event and adds a map of fields to it
+func (l *Logger) Fields(fields Context) *Event {
+	return l.newEvent().Fields(fields)
+}
+
+// Tag creates a new log event and adds a "tag" field to it
+func (l *Logger) Tag(tag string) *Event {
+	return l.newEvent().Tag(tag)
+}
+
+// Err creates a new log event and adds the error to it as structured fields, see Event.Err
+func (l *Logger) Err(err error) *Event {
+	return l.newEvent().Err(err)
+}
+
+// Time creates a new log event and sets the time field
+func (l *Logger) Time(time time.Time) *Event {
+	return l.newEvent().Time(time)
+}
+
+// Timing runs f and records the time if took to execute it in "time_taken_ms"
+func (l *Logger) Timing(f func()) *Event {
+	return l.newEvent().Timing(f)
+}
+
+// Loggable returns true if the given log level is lower or equal to the current log level
+func (l *Logger) Loggable(level Level) bool {
+	if l == nil || l.config == nil {
+		return Loggable(level)
+	}
+	return l.CurrentLevel() <= level
+}
+
+// IsTrace returns true if the current log level is TraceLevel
+func (l *Logger) IsTrace() bool {
+	return l.Loggable(TraceLevel)
+}
+
+// IsDebug returns true if the current log level is DebugLevel or below
+func (l *Logger) IsDebug() bool {
+	return l.Loggable(DebugLevel)
+}
+
+// CurrentLevel returns the current log level
+func (l *Logger) CurrentLevel() Level {
+	if l == nil || l.config == nil {
+		return CurrentLevel()
+	}
+	l.config.mu.RLock()
+	defer l.config.mu.RUnlock()
+	return l.config.level
+}
+
+// SetLevel sets a new log level
+func (l *Logger) SetLevel(level Level) {
+	if l == nil || l.config == nil {
+		SetLevel(level)
+		return
+	}
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.level = level
+}
+
+// SetLevelOverride adds a log override for the given field
+func (l *Logger) SetLevelOverride(field string, value string, level Level) {
+	if l == nil || l.config == nil {
+		SetLevelOverride(field, value, level)
+		return
+	}
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.overrides[field] = append(l.config.overrides[field], &levelOverride{value: value, level: level})
+}
+
+// ResetLevelOverrides removes all log level overrides
+func (l *Logger) ResetLevelOverrides() {
+	if l == nil || l.config == nil {
+		ResetLevelOverrides()
+		return
+	}
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.overrides = make(map[string][]*levelOverride)
+}
+
+// AddSampleRule adds a sampling or rate limiting rule, see SampleRule
+func (l *Logger) AddSampleRule(rule *SampleRule) {
+	if l == nil || l.config == nil {
+		AddSampleRule(rule)
+		return
+	}
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.samplers = append(l.config.samplers, newSampler(rule))
+}
+
+// SuppressedEvents returns the number of log events that were suppressed by sampling or rate limiting rules
+func (l *Logger) SuppressedEvents() int64 {
+	if l == nil || l.config == nil {
+		return SuppressedEvents()
+	}
+	l.config.mu.RLock()
+	defer l.config.mu.RUnlock()
+	return suppressedEvents(l.config.samplers)
+}
+
+// CurrentFormat returns the current log format
+func (l *Logger) CurrentFormat() Format {
+	if l == nil || l.config == nil {
+		return CurrentFormat()
+	}
+	l.config.mu.RLock()
+	defer l.config.mu.RUnlock()
+	return l.config.format
+}
+
+// SetFormat sets a new log format. JSON log events never have a date/time prefix.
+func (l *Logger) SetFormat(format Format) {
+	if l == nil || l.config == nil {
+		SetFormat(format)
+		return
+	}
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.format = format
+}
+
+// SetOutput sets the log output writer
+func (l *Logger) SetOutput(w io.Writer) {
+	if l == nil || l.config == nil {
+		SetOutput(w)
+		return
+	}
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.output = w
+	l.config.terminal = isTerminal(w)
+}
+
+// SetColorMode defines whether text log events are colorized, see ColorMode
+func (l *Logger) SetColorMode(mode ColorMode) {
+	if l == nil || l.config == nil {
+		SetColorMode(mode)
+		return
+	}
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.color = mode
+}
+
+// DisableDates disables the date/time prefix
+func (l *Logger) DisableDates() {
+	if l == nil || l.config == nil {
+		DisableDates()
+		return
+	}
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.dates = false
+}
+
+// newEvent creates a new log event for this logger, with the logger's context fields
+func (l *Logger) newEvent() *Event {
+	e := newEvent()
+	if l != nil {
+		e.config = l.config
+		if len(l.fields) > 0 {
+			e.Fields(l.fields)
+		}
+		if len(l.contexters) > 0 {
+			e.contexters = append(make([]Contexter, 0, len(l.contexters)), l.contexters...) // Copy, events may append
+		}
+	}
+	return e
+}
+
+// write writes the rendered log event to the output, with a date/time prefix if enabled
+func (c *loggerConfig) write(e *Event, l Level, m string) {
+	c.mu.RLock()
+	w, dates := c.output, c.dates && c.format == TextFormat
+	c.mu.RUnlock()
+	if dates {
+		m = e.time.Format(outputDateFormat) + m
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if lw, ok := w.(LevelWriter); ok {
+		writeLevel(lw, e, l, m)
+	} else {
+		w.Write([]byte(m + "\n"))
+	}
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLogger_IndependentOfGlobalState(t *testing.T) {
+	t.Cleanup(resetState)
+	var global, out bytes.Buffer
+	SetOutput(&global)
+	SetLevel(ErrorLevel)
+
+	logger := NewLogger(&out)
+	logger.SetLevel(DebugLevel)
+	logger.SetFormat(JSONFormat)
+	logger.SetLevelOverride("tag", "stripe", TraceLevel)
+	require.True(t, logger.IsDebug())
+	require.False(t, logger.IsTrace())
+	require.False(t, IsDebug())
+
+	logger.Tag("mytag").Time(time.Unix(123, 0).UTC()).Debug("debug message")
+	logger.Tag("stripe").Time(time.Unix(456, 0).UTC()).Trace("trace message")
+	logger.Trace("not logged")
+	Info("not logged either")
+
+	expected := `{"time":"1970-01-01T00:02:03Z","level":"DEBUG","message":"debug message","tag":"mytag"}
+{"time":"1970-01-01T00:07:36Z","level":"TRACE","message":"trace message","tag":"stripe"}
+`
+	require.Equal(t, expected, out.String())
+	require.Equal(t, "", global.String())
+}
+
+func TestLogger_Child(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out)
+	logger.DisableDates()
+	child := logger.Child(Context{"topic": "mytopic"}).Child(Context{"visitor_ip": "1.2.3.4"})
+	child.Field("message_id", "abc").Info("message published")
+	logger.Info("no fields")
+	logger.SetLevel(WarnLevel) // Config is shared with children
+	child.Info("not logged")
+	require.Equal(t, "INFO message published (message_id=abc, topic=mytopic, visitor_ip=1.2.3.4)\nINFO no fields\n", out.String())
+}
+
+func TestLogger_Dates(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out)
+	logger.Warn("with date")
+	require.Regexp(t, regexp.MustCompile(`^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d WARN with date\n$`), out.String())
+}
+
+func TestLogger_Nil(t *testing.T) {
+	t.Cleanup(resetState)
+	var global bytes.Buffer
+	SetOutput(&global)
+	DisableDates()
+	var logger *Logger
+	logger.Child(Context{"tag": "client"}).Info("global output")
+	require.True(t, logger.IsDebug() == IsDebug())
+	require.Equal(t, "INFO global output (tag=client)\n", global.String())
+}
@@ -0,0 +1,201 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for NotifyConfig
+const (
+	DefaultNotifyInterval  = time.Minute
+	DefaultNotifyBatchWait = 5 * time.Second
+	DefaultNotifyMaxLines  = 20
+)
+
+const (
+	tagNotify            = "log_notify"
+	notifyTimeout        = 10 * time.Second
+	notifyPriorityHigh   = "4"
+	notifyPriorityUrgent = "5"
+	notifyTags           = "rotating_light"
+)
+
+// NotifyConfig defines where and how often a NotifyWriter publishes log events
+type NotifyConfig struct {
+	TopicURL  string        // URL of the ntfy topic to publish to, e.g. https://ntfy.sh/mytopic; may contain user:pass
+	Token     string        // Access token to publish with, optional
+	Interval  time.Duration // Minimum time between two notifications; events in between are batched
+	BatchWait time.Duration // Time to wait for more events before publishing a notification
+	MaxLines  int           // Maximum number of log lines per notification; the rest is only counted
+}
+
+// NotifyWriter is a LevelWriter that publishes error and fatal log events to an ntfy topic, so that operators
+// get notified when their ntfy server itself starts erroring. Events are batched (see BatchWait), and at most
+// one notification is published per Interval. Fatal events are published immediately, since the process exits
+// right after logging them.
+//
+// Other log levels are ignored, so a NotifyWriter is typically added via AddOutput with level ErrorLevel.
+type NotifyWriter struct {
+	config   *NotifyConfig
+	topic    string // Topic URL without password, for log messages
+	client   *http.Client
+	hostname string
+	lines    []string
+	dropped  int       // Number of lines not included in the next notification, see MaxLines
+	lastSent time.Time // Time of the last notification
+	timer    *time.Timer
+	mu       sync.Mutex
+}
+
+var _ LevelWriter = (*NotifyWriter)(nil)
+
+// NewNotifyWriter creates a NotifyWriter that publishes to the given topic. Zero values in the config are
+// replaced with defaults (DefaultNotifyInterval, DefaultNotifyBatchWait and DefaultNotifyMaxLines).
+//
+// Parameters:
+//   - config: The notification config. TopicURL is required.
+//
+// Returns:
+//   - A new NotifyWriter, or an error if the topic URL is invalid.
+func NewNotifyWriter(config *NotifyConfig) (*NotifyWriter, error) {
+	u, err := url.Parse(config.TopicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("invalid topic URL %s, must be e.g. https://ntfy.sh/mytopic", config.TopicURL)
+	} else if config.Interval < 0 || config.BatchWait < 0 || config.MaxLines < 0 {
+		return nil, errors.New("notification interval, batch wait and max lines must not be negative")
+	}
+	c := *config
+	if c.Interval == 0 {
+		c.Interval = DefaultNotifyInterval
+	}
+	if c.BatchWait == 0 {
+		c.BatchWait = DefaultNotifyBatchWait
+	}
+	if c.MaxLines == 0 {
+		c.MaxLines = DefaultNotifyMaxLines
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "ntfy"
+	}
+	return &NotifyWriter{
+		config:   &c,
+		topic:    u.Redacted(),
+		client:   &http.Client{Timeout: notifyTimeout},
+		hostname: hostname,
+	}, nil
+}
+
+// Write queues the given log event as an error event
+func (w *NotifyWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(ErrorLevel, p)
+}
+
+// WriteLevel queues the given log event, if it is an error or fatal event. Fatal events (and all queued
+// events) are published immediately, regardless of the interval.
+func (w *NotifyWriter) WriteLevel(l Level, p []byte) (int, error) {
+	if l < ErrorLevel {
+		return len(p), nil
+	}
+	w.mu.Lock()
+	if len(w.lines) < w.config.MaxLines {
+		w.lines = append(w.lines, strings.TrimRight(string(p), "\n"))
+	} else {
+		w.dropped++
+	}
+	if l == FatalLevel {
+		if w.timer != nil {
+			w.timer.Stop()
+			w.timer = nil
+		}
+		lines, dropped := w.takeLines()
+		w.mu.Unlock()
+		return len(p), w.publish(FatalLevel, lines, dropped)
+	}
+	if w.timer == nil {
+		wait := w.config.BatchWait
+		if next := time.Until(w.lastSent.Add(w.config.Interval)); next > wait {
+			wait = next
+		}
+		w.timer = time.AfterFunc(wait, w.flush)
+	}
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+// Close publishes all queued events
+func (w *NotifyWriter) Close() error {
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	lines, dropped := w.takeLines()
+	w.mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+	return w.publish(ErrorLevel, lines, dropped)
+}
+
+func (w *NotifyWriter) flush() {
+	w.mu.Lock()
+	w.timer = nil
+	lines, dropped := w.takeLines()
+	w.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+	if err := w.publish(ErrorLevel, lines, dropped); err != nil {
+		// Warnings are never published by this writer, so this cannot cause a loop
+		Tag(tagNotify).Err(err).Warn("Cannot publish log events to %s", w.topic)
+	}
+}
+
+// takeLines returns and resets the queued lines, and marks the current time as the time of the last
+// notification. It must be called with the lock held.
+func (w *NotifyWriter) takeLines() ([]string, int) {
+	lines, dropped := w.lines, w.dropped
+	w.lines, w.dropped = nil, 0
+	w.lastSent = time.Now()
+	return lines, dropped
+}
+
+func (w *NotifyWriter) publish(l Level, lines []string, dropped int) error {
+	count := len(lines) + dropped
+	body := strings.Join(lines, "\n")
+	if dropped > 0 {
+		body += fmt.Sprintf("\n... and %d more", dropped)
+	}
+	title := fmt.Sprintf("%s: %d error(s) logged", w.hostname, count)
+	priority := notifyPriorityHigh
+	if l == FatalLevel {
+		title = fmt.Sprintf("%s: fatal error logged", w.hostname)
+		priority = notifyPriorityUrgent
+	}
+	req, err := http.NewRequest(http.MethodPost, w.config.TopicURL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", title)
+	req.Header.Set("Priority", priority)
+	req.Header.Set("Tags", notifyTags)
+	if w.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.config.Token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from server: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package log
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifyWriter_BatchedAndRateLimited(t *testing.T) {
+	t.Cleanup(resetState)
+	server, requests := newNotifyTestServer(t)
+	w, err := NewNotifyWriter(&NotifyConfig{
+		TopicURL:  server.URL + "/alerts",
+		Token:     "tk_test",
+		Interval:  300 * time.Millisecond,
+		BatchWait: 50 * time.Millisecond,
+		MaxLines:  2,
+	})
+	require.Nil(t, err)
+	var out bytes.Buffer
+	SetOutput(&out)
+	DisableDates()
+	AddOutput(w, TextFormat, ErrorLevel)
+
+	// Errors are batched, warnings are not published
+	Tag("db").Error("Database is locked")
+	Warn("This is only a warning")
+	Error("Cannot write file %s", "a.txt")
+	Error("Cannot write file %s", "b.txt")
+	require.Eventually(t, func() bool { return len(requests()) == 1 }, time.Second, 10*time.Millisecond)
+	r := requests()[0]
+	require.Equal(t, "/alerts", r.path)
+	require.Equal(t, "Bearer tk_test", r.header.Get("Authorization"))
+	require.Equal(t, "4", r.header.Get("Priority"))
+	require.True(t, strings.HasSuffix(r.header.Get("Title"), ": 3 error(s) logged"))
+	require.Equal(t, "ERROR Database is locked (tag=db)\nERROR Cannot write file a.txt\n... and 1 more", r.body)
+
+	// Next notification waits for the interval
+	start := time.Now()
+	Error("Another error")
+	require.Eventually(t, func() bool { return len(requests()) == 2 }, time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	require.Equal(t, "ERROR Another error", requests()[1].body)
+}
+
+func TestNotifyWriter_FatalAndClose(t *testing.T) {
+	server, requests := newNotifyTestServer(t)
+	w, err := NewNotifyWriter(&NotifyConfig{
+		TopicURL: server.URL + "/alerts",
+	})
+	require.Nil(t, err)
+
+	// Fatal events are published immediately, together with queued events
+	_, err = w.WriteLevel(ErrorLevel, []byte("ERROR first\n"))
+	require.Nil(t, err)
+	_, err = w.WriteLevel(FatalLevel, []byte("FATAL second\n"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(requests()))
+	require.Equal(t, "5", requests()[0].header.Get("Priority"))
+	require.Equal(t, "ERROR first\nFATAL second", requests()[0].body)
+
+	// Close publishes queued events
+	_, err = w.Write([]byte("ERROR third\n"))
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	require.Equal(t, 2, len(requests()))
+	require.Equal(t, "ERROR third", requests()[1].body)
+	require.Nil(t, w.Close()) // Nothing queued
+	require.Equal(t, 2, len(requests()))
+}
+
+func TestNotifyWriter_Invalid(t *testing.T) {
+	_, err := NewNotifyWriter(&NotifyConfig{TopicURL: "https://ntfy.sh"})
+	require.Error(t, err)
+	_, err = NewNotifyWriter(&NotifyConfig{TopicURL: "ftp://ntfy.sh/alerts"})
+	require.Error(t, err)
+	_, err = NewNotifyWriter(&NotifyConfig{TopicURL: "https://ntfy.sh/alerts", Interval: -time.Second})
+	require.Error(t, err)
+}
+
+type notifyRequest struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+func newNotifyTestServer(t *testing.T) (*httptest.Server, func() []notifyRequest) {
+	var requests []notifyRequest
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, notifyRequest{path: r.URL.Path, header: r.Header, body: string(body)})
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []notifyRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]notifyRequest(nil), requests...)
+	}
+}
@@ -0,0 +1,100 @@
+package log
+
+import (
+	"io"
+	"log"
+	"sync"
+)
+
+const outputDateFormat = "2006/01/02 15:04:05 " // Same as the date prefix of Go's log package
+
+var (
+	outputs []*logOutput // Additional outputs, see AddOutput
+)
+
+// logOutput is an additional log output with its own format and level threshold
+type logOutput struct {
+	w      io.Writer
+	format Format
+	level  Level
+	color  bool // Colorize text events, see SetColorMode
+	mu     sync.Mutex
+}
+
+// AddOutput adds an additional log output, next to the main output (see SetOutput). Each additional output
+// has its own format and level, e.g. to write JSON to a file while still writing text to stderr. Level
+// overrides (see SetLevelOverride) apply to all outputs. Whether text events are colorized is determined
+// by the color mode (see SetColorMode) at the time the output is added.
+//
+// Parameters:
+//   - w: The io.Writer to write logs to. If it is a LevelWriter, WriteLevel is called instead of Write.
+//   - format: The format of the log events written to this output.
+//   - level: The minimum level of the log events written to this output.
+func AddOutput(w io.Writer, format Format, level Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	outputs = append(outputs, &logOutput{
+		w:      w,
+		format: format,
+		level:  level,
+		color:  colorize(colorMode, isTerminal(w)),
+	})
+}
+
+// ResetOutputs removes all additional log outputs. The main output (see SetOutput) is not affected.
+func ResetOutputs() {
+	mu.Lock()
+	defer mu.Unlock()
+	outputs = nil
+}
+
+func currentOutputs() []*logOutput {
+	mu.RLock()
+	defer mu.RUnlock()
+	return outputs
+}
+
+// minOutputLevel returns the lowest level of the main output and all additional outputs
+func minOutputLevel() Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	l := level
+	for _, o := range outputs {
+		if o.level < l {
+			l = o.level
+		}
+	}
+	return l
+}
+
+// write renders the given (already rendered) event in the output's format, and writes it. Text events
+// get the same date prefix as the main output, unless dates are disabled.
+func (o *logOutput) write(e *Event, l Level) {
+	var m string
+	if o.format == JSONFormat {
+		m = e.JSON()
+	} else if o.color {
+		m = e.ColorString()
+	} else {
+		m = e.String()
+	}
+	if o.format == TextFormat && log.Flags() != 0 {
+		m = e.time.Format(outputDateFormat) + m
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if w, ok := o.w.(LevelWriter); ok {
+		writeLevel(w, e, l, m)
+	} else {
+		o.w.Write([]byte(m + "\n"))
+	}
+}
+
+// writeLevel writes the rendered event to a LevelWriter, or the event itself if the writer is an eventWriter
+func writeLevel(w LevelWriter, e *Event, l Level, m string) {
+	if ew, ok := w.(eventWriter); ok {
+		ew.WriteEvent(e)
+	} else {
+		w.WriteLevel(l, []byte(m+"\n"))
+	}
+}
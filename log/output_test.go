@@ -0,0 +1,74 @@
+package log
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddOutput_FormatsAndLevels(t *testing.T) {
+	t.Cleanup(resetState)
+	var text, jsonOut bytes.Buffer
+	SetOutput(&text)
+	SetLevel(WarnLevel)
+	DisableDates()
+	AddOutput(&jsonOut, JSONFormat, DebugLevel)
+
+	require.True(t, IsDebug())
+	require.False(t, IsTrace())
+	Tag("mytag").Time(time.Unix(123, 0).UTC()).Info("info message")
+	Time(time.Unix(456, 0).UTC()).Warn("warn message")
+	Trace("trace message")
+
+	require.Equal(t, "WARN warn message\n", text.String())
+	expected := `{"time":"1970-01-01T00:02:03Z","level":"INFO","message":"info message","tag":"mytag"}
+{"time":"1970-01-01T00:07:36Z","level":"WARN","message":"warn message"}
+`
+	require.Equal(t, expected, jsonOut.String())
+}
+
+func TestAddOutput_LevelOverride(t *testing.T) {
+	t.Cleanup(resetState)
+	var main, extra bytes.Buffer
+	SetOutput(&main)
+	DisableDates()
+	AddOutput(&extra, TextFormat, ErrorLevel)
+	SetLevelOverride("tag", "stripe", DebugLevel)
+
+	Tag("stripe").Debug("debug message")
+	Info("info message")
+	require.Equal(t, "DEBUG debug message (tag=stripe)\nINFO info message\n", main.String())
+	require.Equal(t, "DEBUG debug message (tag=stripe)\n", extra.String())
+}
+
+func TestAddOutput_LevelWriter(t *testing.T) {
+	t.Cleanup(resetState)
+	var main bytes.Buffer
+	w := &fakeLevelWriter{}
+	SetOutput(&main)
+	flags := log.Flags()
+	t.Cleanup(func() { log.SetFlags(flags) })
+	log.SetFlags(log.LstdFlags)
+	AddOutput(w, TextFormat, InfoLevel)
+	Error("something broke")
+	require.Equal(t, []Level{ErrorLevel}, w.levels)
+	require.True(t, strings.HasSuffix(w.messages[0], " ERROR something broke\n")) // With date prefix
+}
+
+type fakeLevelWriter struct {
+	levels   []Level
+	messages []string
+}
+
+func (w *fakeLevelWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(InfoLevel, p)
+}
+
+func (w *fakeLevelWriter) WriteLevel(l Level, p []byte) (int, error) {
+	w.levels = append(w.levels, l)
+	w.messages = append(w.messages, string(p))
+	return len(p), nil
+}
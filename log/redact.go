@@ -0,0 +1,106 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// DefaultRedactedFields are the field names that are always redacted, see SetRedactedFields
+	DefaultRedactedFields = []string{"password", "token", "authorization", "auth"}
+
+	// redactTokenRegex matches ntfy access tokens (tk_...) and guest tokens (gt_...)
+	redactTokenRegex = regexp.MustCompile(`\b(tk|gt)_[-_A-Za-z0-9]{29}`)
+)
+
+var (
+	redactedFields      []string       // Lower-cased field names to redact, see SetRedactedFields
+	redactedHeaderRegex *regexp.Regexp // Matches "Name: value" lines of redacted headers, e.g. in rendered HTTP requests
+	redactedQueryRegex  *regexp.Regexp // Matches "name=value" query parameters of redacted fields, e.g. ?auth=...
+)
+
+func init() {
+	SetRedactedFields(nil)
+}
+
+// SetRedactedFields sets the names of the fields whose values are masked before log events are written, in
+// addition to DefaultRedactedFields. A field is redacted if its name matches case-insensitively, or ends with
+// "_<name>" or "-<name>" (e.g. "user_password"). The same names are used to redact "Name: value" header lines
+// and "name=value" query parameters in message strings and field values (e.g. a rendered HTTP request).
+// Independent of the field names, access tokens (tk_...) and guest tokens (gt_...) are always masked.
+//
+// Redaction applies to all log events, including those of Loggers (see NewLogger).
+//
+// Parameters:
+//   - fields: Additional field names to redact, e.g. "secret" or "api_key".
+func SetRedactedFields(fields []string) {
+	names := make([]string, 0, len(DefaultRedactedFields)+len(fields))
+	quoted := make([]string, 0, cap(names))
+	for _, name := range append(append([]string{}, DefaultRedactedFields...), fields...) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+		quoted = append(quoted, regexp.QuoteMeta(name))
+	}
+	pattern := fmt.Sprintf(`(?:[-\w]*[-_])?(?:%s)`, strings.Join(quoted, "|"))
+	headerRegex := regexp.MustCompile(fmt.Sprintf(`(?im)^(%s:[ \t]*)\S.*$`, pattern))
+	queryRegex := regexp.MustCompile(fmt.Sprintf(`(?i)([?&]%s=)[^&\s#]+`, pattern))
+	mu.Lock()
+	defer mu.Unlock()
+	redactedFields = names
+	redactedHeaderRegex = headerRegex
+	redactedQueryRegex = queryRegex
+}
+
+// CurrentRedactedFields returns the names of the fields that are redacted, including DefaultRedactedFields
+func CurrentRedactedFields() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return redactedFields
+}
+
+// redact masks the values of redacted fields, as well as tokens, redacted headers and query parameters in
+// the message and all other string fields. It is called when the event is rendered.
+func (e *Event) redact() {
+	mu.RLock()
+	fields, headerRegex, queryRegex := redactedFields, redactedHeaderRegex, redactedQueryRegex
+	mu.RUnlock()
+	e.Message = redactString(e.Message, headerRegex, queryRegex)
+	for k, v := range e.fields {
+		if redactedField(k, fields) {
+			e.fields[k] = redacted
+		} else if s, ok := v.(string); ok {
+			e.fields[k] = redactString(s, headerRegex, queryRegex)
+		}
+	}
+}
+
+// redactedField returns true if the field name matches one of the redacted field names
+func redactedField(key string, fields []string) bool {
+	key = strings.ToLower(key)
+	for _, name := range fields {
+		if key == name || strings.HasSuffix(key, "_"+name) || strings.HasSuffix(key, "-"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString masks tokens, redacted header lines and redacted query parameters in s
+func redactString(s string, headerRegex, queryRegex *regexp.Regexp) string {
+	if strings.Contains(s, "tk_") || strings.Contains(s, "gt_") {
+		s = redactTokenRegex.ReplaceAllString(s, "${1}_"+redacted)
+	}
+	if strings.Contains(s, ":") {
+		s = headerRegex.ReplaceAllString(s, "${1}"+redacted)
+	}
+	if strings.Contains(s, "=") {
+		s = queryRegex.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
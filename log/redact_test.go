@@ -0,0 +1,61 @@
+package log
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedact_Fields(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetFormat(JSONFormat)
+
+	Fields(Context{
+		"password":      "hunter2",
+		"new_password":  "hunter3",
+		"Token":         "tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2",
+		"token_label":   "my phone",
+		"user_name":     "phil",
+		"secret":        "not redacted by default",
+		"message_count": 5,
+	}).Time(time.Unix(123, 0).UTC()).Info("Changed password")
+	expected := `{"time":"1970-01-01T00:02:03Z","level":"INFO","message":"Changed password","Token":"[REDACTED]","message_count":5,"new_password":"[REDACTED]","password":"[REDACTED]","secret":"not redacted by default","token_label":"my phone","user_name":"phil"}` + "\n"
+	require.Equal(t, expected, out.String())
+
+	out.Reset()
+	SetRedactedFields([]string{"Secret"})
+	Field("secret", "s3cr3t").Field("api_secret", 123).Info("Configured")
+	require.Contains(t, out.String(), `"api_secret":"[REDACTED]","secret":"[REDACTED]"`)
+	require.Equal(t, []string{"password", "token", "authorization", "auth", "secret"}, CurrentRedactedFields())
+}
+
+func TestRedact_TokensInMessage(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	DisableDates()
+
+	Info("Authenticated with token tk_AgQdq7mVBoFD37zQVN29RhuMzNIz2 and gt_abcdefghijklmnopqrstuvwxyz012")
+	Info("Not a token: tk_short, atk_AgQdq7mVBoFD37zQVN29RhuMzNIz2")
+	expected := `INFO Authenticated with token tk_[REDACTED] and gt_[REDACTED]
+INFO Not a token: tk_short, atk_AgQdq7mVBoFD37zQVN29RhuMzNIz2
+`
+	require.Equal(t, expected, out.String())
+}
+
+func TestRedact_HeadersAndQuery(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetFormat(JSONFormat)
+
+	request := "GET /mytopic/json?poll=1&auth=QmFzaWMgcGhpbDpwaGls HTTP/1.1\nAuthorization: Basic cGhpbDpwaGls\nX-Auth-Token: abc\nUser-Agent: curl"
+	Field("http_request", request).Trace("HTTP request started")
+	Field("http_request", request).Info("HTTP request started")
+	expected := `"http_request":"GET /mytopic/json?poll=1\u0026auth=[REDACTED] HTTP/1.1\nAuthorization: [REDACTED]\nX-Auth-Token: [REDACTED]\nUser-Agent: curl"`
+	require.Contains(t, out.String(), expected)
+	require.NotContains(t, out.String(), "cGhpbDpwaGls")
+}
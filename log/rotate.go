@@ -0,0 +1,271 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rotateTimeFormat     = "20060102T150405.000"
+	rotateCompressSuffix = ".gz"
+)
+
+// RotateConfig defines when a RotatingFile is rotated, and how many rotated files are kept
+type RotateConfig struct {
+	MaxSize    int64         // Rotate if the file would grow larger than this many bytes, 0 to disable
+	MaxAge     time.Duration // Rotate if the file is older than this, 0 to disable
+	MaxBackups int           // Number of rotated files to keep, 0 to keep all
+	Compress   bool          // Compress rotated files with gzip
+}
+
+// RotatingFile is an io.Writer that writes to a log file, and rotates it when it grows too large or too old.
+// Rotated files are renamed to <filename>.<timestamp> (and optionally compressed to <filename>.<timestamp>.gz),
+// and only the newest MaxBackups rotated files are kept.
+//
+// A RotatingFile can be passed to SetOutput, just like an os.File.
+type RotatingFile struct {
+	filename string
+	config   *RotateConfig
+	file     *os.File
+	size     int64
+	opened   time.Time // Time at which the current file was started, used for age-based rotation
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	cleanMu  sync.Mutex // Ensures that only one cleanup runs at a time
+}
+
+var _ io.WriteCloser = (*RotatingFile)(nil)
+
+// NewRotatingFile opens (or creates) the given log file for appending, and rotates it according to the
+// given config.
+//
+// Parameters:
+//   - filename: The path to the log file.
+//   - config: The rotation config.
+//
+// Returns:
+//   - A new RotatingFile, or an error if the file cannot be opened.
+func NewRotatingFile(filename string, config *RotateConfig) (*RotatingFile, error) {
+	if config.MaxSize < 0 || config.MaxAge < 0 || config.MaxBackups < 0 {
+		return nil, errors.New("log rotation limits must not be negative")
+	}
+	f := &RotatingFile{
+		filename: filename,
+		config:   config,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Name returns the name of the log file
+func (f *RotatingFile) Name() string {
+	return f.filename
+}
+
+// Write writes to the log file, rotating it first if the write would exceed the max size, or if the file
+// is older than the max age. A single write larger than the max size is written to a fresh file as a whole.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate forces a rotation of the log file, regardless of its size and age
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Close closes the log file, and waits for the compression and removal of rotated files to finish
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+func (f *RotatingFile) shouldRotate(n int64) bool {
+	if f.size == 0 {
+		return false // Never rotate an empty file
+	}
+	if f.config.MaxSize > 0 && f.size+n > f.config.MaxSize {
+		return true
+	}
+	return f.config.MaxAge > 0 && time.Since(f.opened) >= f.config.MaxAge
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = stat.Size()
+	f.opened = time.Now()
+	if f.size > 0 {
+		// The current file was started when the newest backup was rotated. If there is no backup, we
+		// cannot know when the file was started, so we count from now.
+		if backups, err := f.backups(); err == nil && len(backups) > 0 {
+			f.opened = backups[0].rotated
+		}
+	}
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backup := f.backupFilename(time.Now())
+	if err := os.Rename(f.filename, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.opened = time.Now()
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.cleanup(backup)
+	}()
+	return nil
+}
+
+// backupFilename returns the filename for a rotated file, making sure not to overwrite an existing one
+func (f *RotatingFile) backupFilename(rotated time.Time) string {
+	for {
+		backup := f.filename + "." + rotated.Format(rotateTimeFormat)
+		if !fileExists(backup) && !fileExists(backup+rotateCompressSuffix) {
+			return backup
+		}
+		rotated = rotated.Add(time.Millisecond)
+	}
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// cleanup compresses the given rotated file (if enabled), and removes the oldest rotated files. Errors cannot
+// be logged here (we are the logger), so they are written to stderr.
+func (f *RotatingFile) cleanup(backup string) {
+	f.cleanMu.Lock()
+	defer f.cleanMu.Unlock()
+	if f.config.Compress {
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot compress rotated log file %s: %s\n", backup, err.Error())
+		}
+	}
+	if f.config.MaxBackups == 0 {
+		return
+	}
+	backups, err := f.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot list rotated log files: %s\n", err.Error())
+		return
+	}
+	for i := f.config.MaxBackups; i < len(backups); i++ {
+		if err := os.Remove(backups[i].filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "cannot remove rotated log file %s: %s\n", backups[i].filename, err.Error())
+		}
+	}
+}
+
+type rotatedFile struct {
+	filename string
+	rotated  time.Time
+}
+
+// backups returns all rotated files of the log file, newest first
+func (f *RotatingFile) backups() ([]*rotatedFile, error) {
+	dir, prefix := filepath.Dir(f.filename), filepath.Base(f.filename)+"."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]*rotatedFile, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), rotateCompressSuffix)
+		rotated, err := time.ParseInLocation(rotateTimeFormat, timestamp, time.Local)
+		if err != nil {
+			continue // Not one of ours
+		}
+		backups = append(backups, &rotatedFile{
+			filename: filepath.Join(dir, name),
+			rotated:  rotated,
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].rotated.After(backups[j].rotated)
+	})
+	return backups, nil
+}
+
+func compressFile(filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(filename+rotateCompressSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
@@ -0,0 +1,101 @@
+package log
+
+import (
+	"compress/gzip"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile_MaxSizeAndMaxBackups(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ntfy.log")
+	f, err := NewRotatingFile(filename, &RotateConfig{MaxSize: 10, MaxBackups: 2})
+	require.Nil(t, err)
+	for _, line := range []string{"line1\n", "line2\n", "line3\n", "line4\n"} {
+		_, err := f.Write([]byte(line))
+		require.Nil(t, err)
+	}
+	require.Nil(t, f.Close())
+
+	contents, err := os.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, "line4\n", string(contents))
+	backups := rotatedFilenames(t, filename)
+	require.Equal(t, 2, len(backups)) // "line1" was removed
+	contents, err = os.ReadFile(backups[0])
+	require.Nil(t, err)
+	require.Equal(t, "line2\n", string(contents))
+	contents, err = os.ReadFile(backups[1])
+	require.Nil(t, err)
+	require.Equal(t, "line3\n", string(contents))
+}
+
+func TestRotatingFile_MaxAge(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ntfy.log")
+	f, err := NewRotatingFile(filename, &RotateConfig{MaxAge: time.Hour})
+	require.Nil(t, err)
+	_, err = f.Write([]byte("old\n"))
+	require.Nil(t, err)
+	_, err = f.Write([]byte("still old\n"))
+	require.Nil(t, err)
+	f.opened = time.Now().Add(-2 * time.Hour)
+	_, err = f.Write([]byte("new\n"))
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	contents, err := os.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, "new\n", string(contents))
+	backups := rotatedFilenames(t, filename)
+	require.Equal(t, 1, len(backups))
+	contents, err = os.ReadFile(backups[0])
+	require.Nil(t, err)
+	require.Equal(t, "old\nstill old\n", string(contents))
+}
+
+func TestRotatingFile_Compress(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ntfy.log")
+	f, err := NewRotatingFile(filename, &RotateConfig{Compress: true})
+	require.Nil(t, err)
+	_, err = f.Write([]byte("compress me\n"))
+	require.Nil(t, err)
+	require.Nil(t, f.Rotate())
+	require.Nil(t, f.Close())
+
+	backups := rotatedFilenames(t, filename)
+	require.Equal(t, 1, len(backups))
+	require.True(t, strings.HasSuffix(backups[0], ".gz"))
+	in, err := os.Open(backups[0])
+	require.Nil(t, err)
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	require.Nil(t, err)
+	contents, err := io.ReadAll(gz)
+	require.Nil(t, err)
+	require.Equal(t, "compress me\n", string(contents))
+}
+
+func TestRotatingFile_SetOutput(t *testing.T) {
+	t.Cleanup(resetState)
+	filename := filepath.Join(t.TempDir(), "ntfy.log")
+	f, err := NewRotatingFile(filename, &RotateConfig{MaxSize: 1024})
+	require.Nil(t, err)
+	defer f.Close()
+	SetOutput(f)
+	require.True(t, IsFile())
+	require.Equal(t, filename, File())
+	Error("hi there")
+	contents, err := os.ReadFile(filename)
+	require.Nil(t, err)
+	require.Contains(t, string(contents), "ERROR hi there")
+}
+
+func rotatedFilenames(t *testing.T, filename string) []string {
+	backups, err := filepath.Glob(filename + ".*")
+	require.Nil(t, err)
+	return backups // Sorted by name, i.e. oldest first
+}
@@ -0,0 +1,158 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	fieldSuppressed            = "log_suppressed"
+	defaultSampleLimitInterval = time.Second
+)
+
+// SampleRule defines how log events matching a tag and/or a message template are sampled or rate limited.
+// This is useful for hot paths (e.g. per-message debug or trace lines), which can easily overwhelm disks
+// at high throughput. Error and fatal events are never suppressed.
+//
+// When an event is logged after matching events were suppressed, the number of suppressed events is added
+// to it in the "log_suppressed" field.
+type SampleRule struct {
+	Tag      string        // Match events with this tag, empty to match any tag
+	Message  string        // Match events with this message template (before formatting), empty to match any message
+	Every    int           // Log only 1 of every N matching events, 0 or 1 to log all events
+	Limit    int           // Log at most this many matching events per interval, 0 for no limit
+	Interval time.Duration // Interval for Limit, defaults to one second
+}
+
+// sampler holds the state of a SampleRule
+type sampler struct {
+	rule        *SampleRule
+	seen        int64     // Number of matching events, for 1-of-N sampling
+	windowStart time.Time // Start of the current rate limit window
+	windowCount int       // Number of logged events in the current rate limit window
+	pending     int64     // Number of suppressed events since the last logged event
+	suppressed  int64     // Total number of suppressed events
+	mu          sync.Mutex
+}
+
+var (
+	samplers                []*sampler // Sampling rules, see AddSampleRule
+	suppressedEventsRemoved int64      // Suppressed events of removed rules, so that the counter never decreases
+)
+
+// AddSampleRule adds a sampling or rate limiting rule. If an event matches more than one rule, only the first
+// matching rule is applied.
+//
+// Parameters:
+//   - rule: The rule to add.
+func AddSampleRule(rule *SampleRule) {
+	mu.Lock()
+	defer mu.Unlock()
+	samplers = append(samplers, newSampler(rule))
+}
+
+// ResetSampleRules removes all sampling and rate limiting rules.
+func ResetSampleRules() {
+	mu.Lock()
+	defer mu.Unlock()
+	suppressedEventsRemoved += suppressedEvents(samplers)
+	samplers = nil
+}
+
+// SuppressedEvents returns the total number of log events that were suppressed by sampling or rate limiting
+// rules, including the suppressed events of rules that have been removed since.
+//
+// Returns:
+//   - The number of suppressed log events.
+func SuppressedEvents() int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	return suppressedEvents(samplers) + suppressedEventsRemoved
+}
+
+func newSampler(rule *SampleRule) *sampler {
+	return &sampler{
+		rule: rule,
+	}
+}
+
+func suppressedEvents(samplers []*sampler) int64 {
+	var total int64
+	for _, s := range samplers {
+		s.mu.Lock()
+		total += s.suppressed
+		s.mu.Unlock()
+	}
+	return total
+}
+
+// sampled returns true if the event should be logged according to the first matching sampling rule, and
+// adds the number of suppressed events to the event if there are any. Error and fatal events are never suppressed.
+func (e *Event) sampled(l Level, message string) bool {
+	if l >= ErrorLevel {
+		return true
+	}
+	var ss []*sampler
+	if e.config != nil {
+		e.config.mu.RLock()
+		ss = e.config.samplers
+		e.config.mu.RUnlock()
+	} else {
+		mu.RLock()
+		ss = samplers
+		mu.RUnlock()
+	}
+	for _, s := range ss {
+		if s.matches(e, message) {
+			allowed, suppressed := s.allow(time.Now())
+			if allowed && suppressed > 0 {
+				e.Field(fieldSuppressed, suppressed)
+			}
+			return allowed
+		}
+	}
+	return true
+}
+
+// matches returns true if the given event (with the given message template) matches the rule
+func (s *sampler) matches(e *Event, message string) bool {
+	if s.rule.Message != "" && s.rule.Message != message {
+		return false
+	}
+	if s.rule.Tag != "" {
+		tag, ok := e.fields[fieldTag]
+		return ok && tag == s.rule.Tag
+	}
+	return true
+}
+
+// allow returns true if the next matching event should be logged, and the number of events that were suppressed
+// since the last logged event
+func (s *sampler) allow(now time.Time) (bool, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	allowed := s.rule.Every <= 1 || (s.seen-1)%int64(s.rule.Every) == 0
+	if allowed && s.rule.Limit > 0 {
+		interval := s.rule.Interval
+		if interval <= 0 {
+			interval = defaultSampleLimitInterval
+		}
+		if now.Sub(s.windowStart) >= interval {
+			s.windowStart = now
+			s.windowCount = 0
+		}
+		allowed = s.windowCount < s.rule.Limit
+		if allowed {
+			s.windowCount++
+		}
+	}
+	if !allowed {
+		s.pending++
+		s.suppressed++
+		return false, 0
+	}
+	pending := s.pending
+	s.pending = 0
+	return true, pending
+}
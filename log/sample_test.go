@@ -0,0 +1,65 @@
+package log
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampleRule_Every(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	DisableDates()
+	SetLevel(TraceLevel)
+	suppressed := SuppressedEvents()
+	AddSampleRule(&SampleRule{Tag: "publish", Every: 3})
+	for i := 1; i <= 7; i++ {
+		Tag("publish").Trace("Message %d received", i)
+	}
+	Tag("other").Trace("Not sampled")
+	expected := `TRACE Message 1 received (tag=publish)
+TRACE Message 4 received (log_suppressed=2, tag=publish)
+TRACE Message 7 received (log_suppressed=2, tag=publish)
+TRACE Not sampled (tag=other)
+`
+	require.Equal(t, expected, out.String())
+	require.Equal(t, suppressed+4, SuppressedEvents())
+}
+
+func TestSampleRule_LimitByMessageTemplate(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	SetOutput(&out)
+	DisableDates()
+	SetLevel(DebugLevel)
+	suppressed := SuppressedEvents()
+	AddSampleRule(&SampleRule{Message: "Publishing message %s", Limit: 2, Interval: time.Hour})
+	for i := 1; i <= 5; i++ {
+		Debug("Publishing message %s", strings.Repeat("x", i))
+	}
+	Error("Publishing message %s", "errors are never suppressed")
+	Trace("Publishing message %s", "not loggable, not counted")
+	require.Equal(t, "DEBUG Publishing message x\nDEBUG Publishing message xx\nERROR Publishing message errors are never suppressed\n", out.String())
+	require.Equal(t, suppressed+3, SuppressedEvents())
+
+	ResetSampleRules()
+	require.Equal(t, suppressed+3, SuppressedEvents()) // Counter never decreases
+}
+
+func TestSampleRule_Logger(t *testing.T) {
+	t.Cleanup(resetState)
+	var out bytes.Buffer
+	suppressed := SuppressedEvents()
+	logger := NewLogger(&out)
+	logger.DisableDates()
+	logger.AddSampleRule(&SampleRule{Every: 2})
+	logger.Info("one")
+	logger.Info("two")
+	logger.Info("three")
+	require.Equal(t, "INFO one\nINFO three (log_suppressed=1)\n", out.String())
+	require.Equal(t, int64(1), logger.SuppressedEvents())
+	require.Equal(t, suppressed, SuppressedEvents()) // Global counter is not affected
+}
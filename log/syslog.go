@@ -0,0 +1,182 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	syslogFacilityDaemon = 3
+	syslogTimeFormat     = "2006-01-02T15:04:05.000000Z07:00"
+	syslogDialTimeout    = 5 * time.Second
+)
+
+// Syslog severities, see RFC 5424, section 6.2.1
+const (
+	syslogSeverityCritical      = 2
+	syslogSeverityError         = 3
+	syslogSeverityWarning       = 4
+	syslogSeverityInformational = 6
+	syslogSeverityDebug         = 7
+)
+
+var (
+	// syslogLocalAddresses are the well-known syslog sockets on Linux, macOS and BSD
+	syslogLocalAddresses = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+)
+
+// LevelWriter is an io.Writer that also wants to know the level of the log event it writes, e.g.
+// to map it to a syslog severity. If the output (see SetOutput) implements LevelWriter, WriteLevel is
+// called with the rendered log event (without date/time prefix) instead of Write.
+type LevelWriter interface {
+	Write(p []byte) (int, error)
+	WriteLevel(l Level, p []byte) (int, error)
+}
+
+// SyslogWriter is a LevelWriter that sends log events to a local or remote syslog server. Log levels
+// are mapped to syslog severities, and all messages are sent with the "daemon" facility.
+//
+// Remote syslog servers (UDP or TCP) receive messages in RFC 5424 format; TCP messages are framed using
+// octet counting (RFC 6587). The local syslog socket receives messages in the traditional format that
+// local syslog daemons (rsyslog, syslog-ng, journald) expect.
+type SyslogWriter struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+	conn     net.Conn
+	mu       sync.Mutex
+}
+
+var _ LevelWriter = (*SyslogWriter)(nil)
+
+// NewSyslogWriter connects to a syslog server and returns a SyslogWriter.
+//
+// Parameters:
+//   - network: "udp" or "tcp" for a remote syslog server, "unix" or "unixgram" for a local socket,
+//     or an empty string to connect to the local syslog daemon via its well-known socket.
+//   - address: The host:port of the remote syslog server, or the path of the local socket. Ignored if
+//     network is empty.
+//   - tag: The application name to send with each message, e.g. "ntfy".
+//
+// Returns:
+//   - A new SyslogWriter, or an error if the connection fails.
+func NewSyslogWriter(network, address, tag string) (*SyslogWriter, error) {
+	if network != "" && network != "udp" && network != "tcp" && network != "unix" && network != "unixgram" {
+		return nil, fmt.Errorf("invalid syslog network %s, must be udp, tcp, unix or unixgram", network)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	w := &SyslogWriter{
+		network:  network,
+		address:  address,
+		tag:      tag,
+		hostname: hostname,
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends the given bytes to syslog with severity "informational". This is used for
+// messages that do not come from a log event, e.g. from Go's standard library logger.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(InfoLevel, p)
+}
+
+// WriteLevel sends the given log event to syslog, with the severity matching the given log level.
+// If sending fails, the writer reconnects once and tries again.
+func (w *SyslogWriter) WriteLevel(l Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	message := w.format(l, strings.TrimRight(string(p), "\n"))
+	if w.conn != nil {
+		if _, err := w.conn.Write(message); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.connect(); err != nil {
+		return 0, err
+	}
+	if _, err := w.conn.Write(message); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to the syslog server
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) connect() error {
+	if w.network != "" {
+		conn, err := net.DialTimeout(w.network, w.address, syslogDialTimeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+		return nil
+	}
+	for _, address := range syslogLocalAddresses {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.DialTimeout(network, address, syslogDialTimeout); err == nil {
+				w.conn = conn
+				return nil
+			}
+		}
+	}
+	return errors.New("cannot connect to local syslog daemon")
+}
+
+// format renders the syslog message. Remote servers get RFC 5424 messages, local sockets get
+// the traditional "<PRI>TIMESTAMP TAG[PID]: MSG" format.
+func (w *SyslogWriter) format(l Level, message string) []byte {
+	priority := syslogFacilityDaemon*8 + syslogSeverity(l)
+	if w.local() {
+		return []byte(fmt.Sprintf("<%d>%s %s[%d]: %s\n", priority, time.Now().Format(time.Stamp), w.tag, os.Getpid(), message))
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", priority, time.Now().Format(syslogTimeFormat), w.hostname, w.tag, os.Getpid(), message)
+	if w.network == "tcp" {
+		return []byte(fmt.Sprintf("%d %s", len(msg), msg)) // Octet counting, see RFC 6587, section 3.4.1
+	}
+	return []byte(msg)
+}
+
+func (w *SyslogWriter) local() bool {
+	return w.network == "" || w.network == "unix" || w.network == "unixgram"
+}
+
+// syslogSeverity maps a log level to a syslog severity. There is no trace severity in syslog,
+// so trace events are sent as debug.
+func syslogSeverity(l Level) int {
+	switch l {
+	case TraceLevel, DebugLevel:
+		return syslogSeverityDebug
+	case InfoLevel:
+		return syslogSeverityInformational
+	case WarnLevel:
+		return syslogSeverityWarning
+	case ErrorLevel:
+		return syslogSeverityError
+	default:
+		return syslogSeverityCritical
+	}
+}
@@ -0,0 +1,95 @@
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSyslogWriter_UDP(t *testing.T) {
+	t.Cleanup(resetState)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+
+	w, err := NewSyslogWriter("udp", conn.LocalAddr().String(), "ntfy")
+	require.Nil(t, err)
+	defer w.Close()
+	SetOutput(w)
+	Tag("manager").Warn("disk %s almost full", "/var")
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.Nil(t, err)
+	hostname, _ := os.Hostname()
+	re := regexp.MustCompile(fmt.Sprintf(`^<28>1 \S+ %s ntfy %d - - WARN disk /var almost full \(tag=manager\)$`, regexp.QuoteMeta(hostname), os.Getpid()))
+	require.Regexp(t, re, string(buf[:n])) // 28 = daemon (3) * 8 + warning (4)
+}
+
+func TestSyslogWriter_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			var length int
+			if _, err := fmt.Fscanf(r, "%d ", &length); err != nil {
+				return
+			}
+			msg := make([]byte, length)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	w, err := NewSyslogWriter("tcp", listener.Addr().String(), "ntfy")
+	require.Nil(t, err)
+	defer w.Close()
+	_, err = w.WriteLevel(ErrorLevel, []byte("ERROR something broke\n"))
+	require.Nil(t, err)
+	_, err = w.WriteLevel(TraceLevel, []byte("TRACE details"))
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(<-received, "<27>1 ")) // daemon (3) * 8 + error (3)
+	msg := <-received
+	require.True(t, strings.HasPrefix(msg, "<31>1 ")) // daemon (3) * 8 + debug (7)
+	require.True(t, strings.HasSuffix(msg, " - - TRACE details"))
+}
+
+func TestSyslogWriter_Local(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.Nil(t, err)
+	defer conn.Close()
+
+	w, err := NewSyslogWriter("unixgram", socket, "ntfy")
+	require.Nil(t, err)
+	defer w.Close()
+	_, err = w.WriteLevel(InfoLevel, []byte("INFO hello"))
+	require.Nil(t, err)
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	require.Nil(t, err)
+	require.Regexp(t, fmt.Sprintf(`^<30>\w{3} [ \d]\d \d\d:\d\d:\d\d ntfy\[%d\]: INFO hello\n$`, os.Getpid()), string(buf[:n]))
+}
+
+func TestSyslogWriter_InvalidNetwork(t *testing.T) {
+	_, err := NewSyslogWriter("http", "localhost:514", "ntfy")
+	require.Error(t, err)
+}
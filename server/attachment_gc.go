@@ -0,0 +1,277 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Attachment garbage collection strategies, see attachmentGC
+const (
+	AttachmentGCStrategyExpired = "expired" // Delete attachments after attachment-expiry-duration
+	AttachmentGCStrategyOrphans = "orphans" // Delete files without message, and mark attachments without file as deleted
+	AttachmentGCStrategySize    = "size"    // Evict attachments of the least recently used topics if the cache is too large
+
+	// attachmentGCOrphanGracePeriod is the minimum age of a file before it is considered an orphan. Attachment files are
+	// written before their message is added to the message cache, and messages may be written to the cache in batches.
+	attachmentGCOrphanGracePeriod = time.Hour
+
+	// attachmentGCDefaultSizeLimitPercent is the default size target of the size strategy, in percent of the
+	// attachment-total-size-limit. The headroom avoids rejecting uploads between two garbage collection runs.
+	attachmentGCDefaultSizeLimitPercent = 90
+)
+
+var (
+	// AttachmentGCStrategies is a list of all attachment garbage collection strategies
+	AttachmentGCStrategies = []string{AttachmentGCStrategyExpired, AttachmentGCStrategyOrphans, AttachmentGCStrategySize}
+
+	// attachmentGCCollectors defines the order in which the strategies are run. Strategies that free space without
+	// losing data (expired, orphans) run first, so that the size strategy only evicts attachments if still necessary.
+	attachmentGCCollectors = []struct {
+		name    string
+		collect func(gc *attachmentGC, state *attachmentGCState) ([]*AttachmentGCItem, error)
+	}{
+		{AttachmentGCStrategyExpired, (*attachmentGC).collectExpired},
+		{AttachmentGCStrategyOrphans, (*attachmentGC).collectOrphans},
+		{AttachmentGCStrategySize, (*attachmentGC).collectSize},
+	}
+
+	errAttachmentGCNoCacheDir  = errors.New("attachment-cache-dir is not set")
+	errAttachmentGCNoCacheFile = errors.New("cache-file is not set")
+)
+
+// AttachmentGCReport is the result of a garbage collection run, see CollectAttachments
+type AttachmentGCReport struct {
+	DryRun     bool                // If true, nothing was deleted
+	SizeBefore int64               // Total size of the attachment files before the run (bytes)
+	SizeAfter  int64               // Total size of the attachment files after the run (bytes)
+	Items      []*AttachmentGCItem // Deleted attachments (or attachments that would be deleted in a dry run)
+}
+
+// AttachmentGCItem is a single attachment deleted by the garbage collection
+type AttachmentGCItem struct {
+	ID       string // Message ID, also the file name in the attachment cache directory
+	Topic    string // Topic of the message, empty for orphaned files
+	Size     int64  // Size of the file (bytes), zero if the file is missing
+	Strategy string // Strategy that collected the attachment, e.g. AttachmentGCStrategySize
+	Reason   string // Human-readable reason, e.g. "expired"
+}
+
+// storedAttachment is an attachment hosted by the server, as stored in the message cache
+type storedAttachment struct {
+	ID      string
+	Topic   string
+	Time    int64
+	Size    int64
+	Expires int64
+}
+
+// attachmentGC deletes attachment files (and marks the attachments in the message cache as deleted), using one or
+// more strategies, see AttachmentGCStrategyExpired and others.
+type attachmentGC struct {
+	messageCache *messageCache
+	fileCache    *fileCache
+	strategies   []string
+	sizeLimit    int64 // Target size of the size strategy (bytes)
+}
+
+// attachmentGCState is the state of a single garbage collection run, shared by all strategies. Files that are
+// collected by a strategy are removed from the state, so that later strategies do not collect them again.
+type attachmentGCState struct {
+	now         time.Time
+	files       map[string]os.FileInfo       // Message ID -> attachment file on disk
+	attachments map[string]*storedAttachment // Message ID -> attachment in the message cache
+	size        int64                        // Total size of the remaining files
+}
+
+func newAttachmentGC(conf *Config, messageCache *messageCache, fileCache *fileCache) *attachmentGC {
+	sizeLimit := conf.AttachmentGCSizeLimit
+	if sizeLimit <= 0 {
+		sizeLimit = conf.AttachmentTotalSizeLimit * attachmentGCDefaultSizeLimitPercent / 100
+	}
+	return &attachmentGC{
+		messageCache: messageCache,
+		fileCache:    fileCache,
+		strategies:   conf.AttachmentGCStrategies,
+		sizeLimit:    sizeLimit,
+	}
+}
+
+// CollectAttachments runs the attachment garbage collection of the given server config, e.g. for the
+// "ntfy attachment-gc" command. If dryRun is true, nothing is deleted, and the report only lists what would be deleted.
+func CollectAttachments(conf *Config, dryRun bool) (*AttachmentGCReport, error) {
+	if conf.AttachmentCacheDir == "" {
+		return nil, errAttachmentGCNoCacheDir
+	} else if conf.CacheFile == "" {
+		return nil, errAttachmentGCNoCacheFile // Without cache file, all files would be considered orphans
+	}
+	messageCache, err := newSqliteCache(conf.CacheFile, conf.CacheStartupQueries, conf.CacheDuration, 0, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	defer messageCache.Close()
+	fileCache, err := newFileCache(conf.AttachmentCacheDir, conf.AttachmentTotalSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	return newAttachmentGC(conf, messageCache, fileCache).Run(dryRun)
+}
+
+// Run runs all configured strategies, and deletes the collected attachments unless dryRun is true
+func (gc *attachmentGC) Run(dryRun bool) (*AttachmentGCReport, error) {
+	state, err := gc.state()
+	if err != nil {
+		return nil, err
+	}
+	report := &AttachmentGCReport{
+		DryRun:     dryRun,
+		SizeBefore: state.size,
+		Items:      make([]*AttachmentGCItem, 0),
+	}
+	for _, strategy := range attachmentGCCollectors {
+		if !slices.Contains(gc.strategies, strategy.name) {
+			continue
+		}
+		items, err := strategy.collect(gc, state)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if file, ok := state.files[item.ID]; ok {
+				state.size -= file.Size()
+				delete(state.files, item.ID)
+			}
+			delete(state.attachments, item.ID)
+		}
+		report.Items = append(report.Items, items...)
+	}
+	report.SizeAfter = state.size
+	if dryRun || len(report.Items) == 0 {
+		return report, nil
+	}
+	ids := make([]string, len(report.Items))
+	for i, item := range report.Items {
+		ids[i] = item.ID
+	}
+	if err := gc.fileCache.Remove(ids...); err != nil {
+		return nil, err
+	}
+	if err := gc.messageCache.MarkAttachmentsDeleted(ids...); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (gc *attachmentGC) state() (*attachmentGCState, error) {
+	files, err := gc.fileCache.Files()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := gc.messageCache.AttachmentsStored()
+	if err != nil {
+		return nil, err
+	}
+	state := &attachmentGCState{
+		now:         time.Now(),
+		files:       files,
+		attachments: make(map[string]*storedAttachment),
+	}
+	for _, file := range files {
+		state.size += file.Size()
+	}
+	for _, a := range stored {
+		state.attachments[a.ID] = a
+	}
+	return state, nil
+}
+
+// collectExpired collects all attachments whose expiry time has passed
+func (gc *attachmentGC) collectExpired(state *attachmentGCState) ([]*AttachmentGCItem, error) {
+	items := make([]*AttachmentGCItem, 0)
+	for _, a := range state.attachments {
+		if a.Expires <= state.now.Unix() {
+			items = append(items, gc.item(state, a.ID, a.Topic, AttachmentGCStrategyExpired, "expired"))
+		}
+	}
+	return sortAttachmentGCItems(items), nil
+}
+
+// collectOrphans collects files that do not belong to an attachment in the message cache (e.g. left behind after
+// a crash, or after the message cache was reset), as well as attachments whose file is missing
+func (gc *attachmentGC) collectOrphans(state *attachmentGCState) ([]*AttachmentGCItem, error) {
+	items := make([]*AttachmentGCItem, 0)
+	for id, file := range state.files {
+		if _, ok := state.attachments[id]; !ok && state.now.Sub(file.ModTime()) >= attachmentGCOrphanGracePeriod {
+			items = append(items, gc.item(state, id, "", AttachmentGCStrategyOrphans, "no message"))
+		}
+	}
+	for id, a := range state.attachments {
+		if _, ok := state.files[id]; !ok {
+			items = append(items, gc.item(state, id, a.Topic, AttachmentGCStrategyOrphans, "file missing"))
+		}
+	}
+	return sortAttachmentGCItems(items), nil
+}
+
+// collectSize collects attachments until the total size of the remaining files is below the size limit. Attachments
+// are evicted by topic: all attachments of the least recently used topic go first (oldest first), then the next topic.
+func (gc *attachmentGC) collectSize(state *attachmentGCState) ([]*AttachmentGCItem, error) {
+	if state.size <= gc.sizeLimit {
+		return nil, nil
+	}
+	lastUsed, err := gc.messageCache.TopicsLastUsed()
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]*storedAttachment, 0)
+	for id, a := range state.attachments {
+		if _, ok := state.files[id]; ok {
+			candidates = append(candidates, a)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if lastUsed[a.Topic] != lastUsed[b.Topic] {
+			return lastUsed[a.Topic] < lastUsed[b.Topic]
+		} else if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		} else if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return a.ID < b.ID
+	})
+	items := make([]*AttachmentGCItem, 0)
+	size := state.size
+	for _, a := range candidates {
+		if size <= gc.sizeLimit {
+			break
+		}
+		item := gc.item(state, a.ID, a.Topic, AttachmentGCStrategySize, "cache size limit exceeded")
+		items = append(items, item)
+		size -= item.Size
+	}
+	return items, nil
+}
+
+func (gc *attachmentGC) item(state *attachmentGCState, id, topic, strategy, reason string) *AttachmentGCItem {
+	var size int64
+	if file, ok := state.files[id]; ok {
+		size = file.Size()
+	}
+	return &AttachmentGCItem{
+		ID:       id,
+		Topic:    topic,
+		Size:     size,
+		Strategy: strategy,
+		Reason:   reason,
+	}
+}
+
+func sortAttachmentGCItems(items []*AttachmentGCItem) []*AttachmentGCItem {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachmentGC_ExpiredAndOrphans(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.AttachmentGCStrategies = []string{AttachmentGCStrategyExpired, AttachmentGCStrategyOrphans}
+	c := newSqliteTestCache(t)
+	files, err := newFileCache(conf.AttachmentCacheDir, conf.AttachmentTotalSizeLimit)
+	require.Nil(t, err)
+
+	addTestAttachment(t, c, files, "mytopic", "expired00001", 100, time.Now().Add(-time.Minute))
+	addTestAttachment(t, c, files, "mytopic", "valid0000001", 200, time.Now().Add(time.Hour))
+	addTestAttachment(t, c, files, "mytopic", "missing00001", 0, time.Now().Add(time.Hour))
+	require.Nil(t, os.Remove(filepath.Join(conf.AttachmentCacheDir, "missing00001")))
+	writeTestAttachmentFile(t, conf.AttachmentCacheDir, "orphan000001", 300, time.Now().Add(-2*time.Hour))
+	writeTestAttachmentFile(t, conf.AttachmentCacheDir, "orphan000002", 400, time.Now()) // Too new, may still be uploading
+	writeTestAttachmentFile(t, conf.AttachmentCacheDir, "not-an-id.txt", 500, time.Now().Add(-2*time.Hour))
+
+	// Dry run does not delete anything
+	gc := newAttachmentGC(conf, c, files)
+	report, err := gc.Run(true)
+	require.Nil(t, err)
+	require.True(t, report.DryRun)
+	require.Equal(t, int64(1000), report.SizeBefore)
+	require.Equal(t, int64(600), report.SizeAfter)
+	require.Equal(t, 3, len(report.Items))
+	require.Equal(t, &AttachmentGCItem{ID: "expired00001", Topic: "mytopic", Size: 100, Strategy: AttachmentGCStrategyExpired, Reason: "expired"}, report.Items[0])
+	require.Equal(t, &AttachmentGCItem{ID: "missing00001", Topic: "mytopic", Size: 0, Strategy: AttachmentGCStrategyOrphans, Reason: "file missing"}, report.Items[1])
+	require.Equal(t, &AttachmentGCItem{ID: "orphan000001", Topic: "", Size: 300, Strategy: AttachmentGCStrategyOrphans, Reason: "no message"}, report.Items[2])
+	require.FileExists(t, filepath.Join(conf.AttachmentCacheDir, "expired00001"))
+	require.FileExists(t, filepath.Join(conf.AttachmentCacheDir, "orphan000001"))
+
+	// Real run
+	report, err = gc.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(report.Items))
+	require.NoFileExists(t, filepath.Join(conf.AttachmentCacheDir, "expired00001"))
+	require.NoFileExists(t, filepath.Join(conf.AttachmentCacheDir, "orphan000001"))
+	require.FileExists(t, filepath.Join(conf.AttachmentCacheDir, "valid0000001"))
+	require.FileExists(t, filepath.Join(conf.AttachmentCacheDir, "orphan000002"))
+	require.FileExists(t, filepath.Join(conf.AttachmentCacheDir, "not-an-id.txt"))
+
+	stored, err := c.AttachmentsStored()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(stored))
+	require.Equal(t, "valid0000001", stored[0].ID)
+
+	// Nothing left to do
+	report, err = gc.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(report.Items))
+}
+
+func TestAttachmentGC_SizeLeastRecentlyUsedTopic(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.AttachmentGCStrategies = []string{AttachmentGCStrategySize}
+	conf.AttachmentGCSizeLimit = 250
+	c := newSqliteTestCache(t)
+	files, err := newFileCache(conf.AttachmentCacheDir, conf.AttachmentTotalSizeLimit)
+	require.Nil(t, err)
+
+	// Topic "old" was last used before topic "new", even though "new" has the oldest attachment
+	expires := time.Now().Add(time.Hour)
+	addTestAttachmentAt(t, c, files, "new", "new000000001", 100, expires, 1000)
+	addTestAttachmentAt(t, c, files, "old", "old000000001", 100, expires, 2000)
+	addTestAttachmentAt(t, c, files, "old", "old000000002", 100, expires, 3000)
+	addTestAttachmentAt(t, c, files, "new", "new000000002", 100, expires, 5000)
+
+	report, err := newAttachmentGC(conf, c, files).Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int64(400), report.SizeBefore)
+	require.Equal(t, int64(200), report.SizeAfter)
+	require.Equal(t, 2, len(report.Items))
+	require.Equal(t, "old000000001", report.Items[0].ID)
+	require.Equal(t, "old000000002", report.Items[1].ID)
+	require.Equal(t, AttachmentGCStrategySize, report.Items[0].Strategy)
+	require.Equal(t, int64(200), files.Size())
+
+	// Below the limit, nothing is evicted
+	report, err = newAttachmentGC(conf, c, files).Run(false)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(report.Items))
+}
+
+func TestAttachmentGC_SizeDefaultLimit(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.AttachmentTotalSizeLimit = 1000
+	require.Equal(t, int64(900), newAttachmentGC(conf, nil, nil).sizeLimit)
+	conf.AttachmentGCSizeLimit = 500
+	require.Equal(t, int64(500), newAttachmentGC(conf, nil, nil).sizeLimit)
+}
+
+func TestAttachmentGC_CollectAttachmentsRequiresCacheFile(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.CacheFile = ""
+	_, err := CollectAttachments(conf, true)
+	require.Equal(t, errAttachmentGCNoCacheFile, err)
+}
+
+func addTestAttachment(t *testing.T, c *messageCache, files *fileCache, topic, id string, size int64, expires time.Time) {
+	addTestAttachmentAt(t, c, files, topic, id, size, expires, time.Now().Unix())
+}
+
+func addTestAttachmentAt(t *testing.T, c *messageCache, files *fileCache, topic, id string, size int64, expires time.Time, created int64) {
+	m := newDefaultMessage(topic, "attachment")
+	m.ID = id
+	m.Time = created
+	m.Attachment = &attachment{
+		Name:    "file.txt",
+		Size:    size,
+		Expires: expires.Unix(),
+		URL:     "https://ntfy.sh/file/" + id + ".txt",
+	}
+	require.Nil(t, c.AddMessage(m))
+	_, err := files.Write(id, strings.NewReader(strings.Repeat("x", int(size))))
+	require.Nil(t, err)
+}
+
+func writeTestAttachmentFile(t *testing.T, dir, id string, size int, modTime time.Time) {
+	filename := filepath.Join(dir, id)
+	require.Nil(t, os.WriteFile(filename, []byte(strings.Repeat("x", size)), 0600))
+	require.Nil(t, os.Chtimes(filename, modTime, modTime))
+}
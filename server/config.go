@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
 )
 
 // Defines default config settings (excluding limits, see below)
@@ -20,10 +21,14 @@ const (
 	DefaultDelayedSenderInterval                = 10 * time.Second
 	DefaultMessageDelayMin                      = 10 * time.Second
 	DefaultMessageDelayMax                      = 3 * 24 * time.Hour
-	DefaultFirebaseKeepaliveInterval            = 3 * time.Hour    // ~control topic (Android), not too frequently to save battery
-	DefaultFirebasePollInterval                 = 20 * time.Minute // ~poll topic (iOS), max. 2-3 times per hour (see docs)
-	DefaultFirebaseQuotaExceededPenaltyDuration = 10 * time.Minute // Time that over-users are locked out of Firebase if it returns "quota exceeded"
-	DefaultStripePriceCacheDuration             = 3 * time.Hour    // Time to keep Stripe prices cached in memory before a refresh is needed
+	DefaultFirebaseKeepaliveInterval            = 3 * time.Hour      // ~control topic (Android), not too frequently to save battery
+	DefaultFirebasePollInterval                 = 20 * time.Minute   // ~poll topic (iOS), max. 2-3 times per hour (see docs)
+	DefaultFirebaseQuotaExceededPenaltyDuration = 10 * time.Minute   // Time that over-users are locked out of Firebase if it returns "quota exceeded"
+	DefaultStripePriceCacheDuration             = 3 * time.Hour      // Time to keep Stripe prices cached in memory before a refresh is needed
+	DefaultPasswordResetTokenDuration           = time.Hour          // Time after which password reset links in emails expire
+	DefaultTierExpiryWarningDuration            = 3 * 24 * time.Hour // Time before a tier expires at which users are warned via email
+	DefaultLogLevelRevertAfter                  = 10 * time.Minute   // Time after which a log level changed at runtime (via signal or API) is reverted
+	DefaultHMACClockSkew                        = 5 * time.Minute    // Max. difference between the timestamp of a signed message and the server time
 )
 
 // Defines default Web Push settings
@@ -61,19 +66,43 @@ const (
 	DefaultVisitorAccountCreationLimitReplenish = 24 * time.Hour
 	DefaultVisitorAuthFailureLimitBurst         = 30
 	DefaultVisitorAuthFailureLimitReplenish     = time.Minute
+	DefaultVisitorPasswordResetLimitBurst       = 3
+	DefaultVisitorPasswordResetLimitReplenish   = time.Hour
 	DefaultVisitorAttachmentTotalSizeLimit      = 100 * 1024 * 1024 // 100 MB
 	DefaultVisitorAttachmentDailyBandwidthLimit = 500 * 1024 * 1024 // 500 MB
 	DefaultVisitorPrefixBitsIPv4                = 32                // Use the entire IPv4 address for rate limiting
 	DefaultVisitorPrefixBitsIPv6                = 64                // Use /64 for IPv6 rate limiting
+	DefaultVisitorRateLimitAlgorithm            = util.RateAlgorithmTokenBucket
 )
 
+// Defines the visitor rate limits for which the rate limiting algorithm can be selected,
+// see Config.VisitorRateLimitAlgorithms
+const (
+	VisitorRateLimitRequest         = "request"
+	VisitorRateLimitEmail           = "email"
+	VisitorRateLimitBandwidth       = "bandwidth"
+	VisitorRateLimitAccountCreation = "account-creation"
+	VisitorRateLimitAuthFailure     = "auth-failure"
+	VisitorRateLimitPasswordReset   = "password-reset"
+)
+
+// VisitorRateLimitTypes lists all visitor rate limits, see Config.VisitorRateLimitAlgorithms
+var VisitorRateLimitTypes = []string{
+	VisitorRateLimitRequest,
+	VisitorRateLimitEmail,
+	VisitorRateLimitBandwidth,
+	VisitorRateLimitAccountCreation,
+	VisitorRateLimitAuthFailure,
+	VisitorRateLimitPasswordReset,
+}
+
 var (
 	// DefaultVisitorStatsResetTime defines the time at which visitor stats are reset (wall clock only)
 	DefaultVisitorStatsResetTime = time.Date(0, 0, 0, 0, 0, 0, 0, time.UTC)
 
 	// DefaultDisallowedTopics defines the topics that are forbidden, because they are used elsewhere. This array can be
 	// extended using the server.yml config. If updated, also update in Android and web app.
-	DefaultDisallowedTopics = []string{"docs", "static", "file", "app", "metrics", "account", "settings", "signup", "login", "v1"}
+	DefaultDisallowedTopics = []string{"docs", "static", "file", "app", "metrics", "account", "settings", "signup", "login", "reset-password", "v1"}
 )
 
 // Config is the main config struct for the application. Use New to instantiate a default config struct.
@@ -82,29 +111,40 @@ type Config struct {
 	BaseURL                              string
 	ListenHTTP                           string
 	ListenHTTPS                          string
+	ListenHTTP3                          string // UDP address for HTTP/3 (QUIC), requires KeyFile and CertFile
 	ListenUnix                           string
 	ListenUnixMode                       fs.FileMode
 	KeyFile                              string
 	CertFile                             string
+	ACMEDomains                          []string // If set, TLS certificates are requested via ACME, instead of using KeyFile and CertFile
+	ACMEEmail                            string
+	ACMECacheDir                         string
+	ACMEDirectoryURL                     string // ACME directory, defaults to Let's Encrypt (production)
 	FirebaseKeyFile                      string
 	CacheFile                            string
 	CacheDuration                        time.Duration
 	CacheStartupQueries                  string
 	CacheBatchSize                       int
 	CacheBatchTimeout                    time.Duration
+	CacheExpirationEvents                bool // Send message_expired/attachment_expired events to subscribers
 	AuthFile                             string
 	AuthStartupQueries                   string
 	AuthDefault                          user.Permission
 	AuthUsers                            []*user.User
 	AuthAccess                           map[string][]*user.Grant
 	AuthTokens                           map[string][]*user.Token
+	AuthAccessTemplates                  []*user.Grant
 	AuthBcryptCost                       int
 	AuthStatsQueueWriterInterval         time.Duration
+	AuthCacheTTL                         time.Duration // Duration for which verified username/password combinations are cached, to avoid bcrypt on every request
 	AttachmentCacheDir                   string
 	AttachmentTotalSizeLimit             int64
 	AttachmentFileSizeLimit              int64
 	AttachmentExpiryDuration             time.Duration
-	TemplateDir                          string // Directory to load named templates from
+	AttachmentGCStrategies               []string // Attachment garbage collection strategies, see AttachmentGCStrategyExpired and others
+	AttachmentGCSizeLimit                int64    // Target size of the "size" strategy; defaults to 90% of AttachmentTotalSizeLimit if zero
+	TemplateDir                          string   // Directory to load named templates from
+	DefaultLanguage                      string   // Language of emails, phone calls and errors, unless the user or client asks for another one
 	KeepaliveInterval                    time.Duration
 	ManagerInterval                      time.Duration
 	DisallowedTopics                     []string
@@ -119,9 +159,16 @@ type Config struct {
 	SMTPSenderUser                       string
 	SMTPSenderPass                       string
 	SMTPSenderFrom                       string
+	EmailProviders                       []*EmailProvider // Providers for outgoing emails, in addition to SMTPSenderAddr
 	SMTPServerListen                     string
 	SMTPServerDomain                     string
 	SMTPServerAddrPrefix                 string
+	SMTPServerHTMLFormat                 string            // Format of HTML emails, see SMTPServerHTMLFormatText and SMTPServerHTMLFormatMarkdown
+	SyslogListen                         string            // UDP address of the syslog listener, e.g. :514
+	SyslogRules                          []*SyslogRule     // Maps syslog datagrams to topics, see ParseSyslogRule
+	SNMPTrapListen                       string            // UDP address of the SNMP trap listener, e.g. :162
+	SNMPTrapRules                        []*SNMPTrapRule   // Maps SNMP traps to topics, see ParseSNMPTrapRule
+	SNMPTrapOIDNames                     map[string]string // Translates OIDs to names, see ParseSNMPTrapOIDNames
 	TwilioAccount                        string
 	TwilioAuthToken                      string
 	TwilioPhoneNumber                    string
@@ -131,14 +178,24 @@ type Config struct {
 	MetricsEnable                        bool
 	MetricsListenHTTP                    string
 	ProfileListenHTTP                    string
+	LogLevelRevertAfter                  time.Duration
 	MessageDelayMin                      time.Duration
 	MessageDelayMax                      time.Duration
+	PublishRoutes                        []*PublishRoute    // Routes messages to other topics based on their content, see ParsePublishRoute
+	OverloadFanoutThreshold              int                // Pending subscriber deliveries after which low-priority messages are shed, 0 disables it
+	OverloadCacheThreshold               int                // Pending message cache writes after which low-priority messages are shed, 0 disables it
+	HMACTopics                           []*HMACTopic       // Topics that only accept signed messages, see ParseHMACTopic
+	HMACClockSkew                        time.Duration      // Max. difference between the timestamp of a signed message and the server time
+	OutboundWebhooks                     []*OutboundWebhook // Forwards the messages of a topic to other services, see ParseOutboundWebhook
 	MessageSizeLimit                     int
+	MessageChunkedSizeLimit              int // Max size of a message reassembled from chunks, 0 disables chunked messages
 	TotalTopicLimit                      int
 	TotalAttachmentSizeLimit             int64
 	VisitorSubscriptionLimit             int
 	VisitorAttachmentTotalSizeLimit      int64
 	VisitorAttachmentDailyBandwidthLimit int64
+	VisitorAttachmentAllowedTypes        []string // MIME type patterns for visitors without a tier; all types are allowed if empty
+	VisitorAttachmentDeniedTypes         []string // MIME type patterns for visitors without a tier
 	VisitorRequestLimitBurst             int
 	VisitorRequestLimitReplenish         time.Duration
 	VisitorRequestExemptPrefixes         []netip.Prefix
@@ -149,13 +206,18 @@ type Config struct {
 	VisitorAccountCreationLimitReplenish time.Duration
 	VisitorAuthFailureLimitBurst         int
 	VisitorAuthFailureLimitReplenish     time.Duration
-	VisitorStatsResetTime                time.Time      // Time of the day at which to reset visitor stats
-	VisitorSubscriberRateLimiting        bool           // Enable subscriber-based rate limiting for UnifiedPush topics
-	VisitorPrefixBitsIPv4                int            // Number of bits for IPv4 rate limiting (default: 32)
-	VisitorPrefixBitsIPv6                int            // Number of bits for IPv6 rate limiting (default: 64)
-	BehindProxy                          bool           // If true, the server will trust the proxy client IP header to determine the client IP address (IPv4 and IPv6 supported)
-	ProxyForwardedHeader                 string         // The header field to read the real/client IP address from, if BehindProxy is true, defaults to "X-Forwarded-For" (IPv4 and IPv6 supported)
-	ProxyTrustedPrefixes                 []netip.Prefix // List of trusted proxy networks (IPv4 or IPv6) that will be stripped from the Forwarded header if BehindProxy is true
+	VisitorPasswordResetLimitBurst       int
+	VisitorPasswordResetLimitReplenish   time.Duration
+	VisitorRateLimitAlgorithm            util.RateAlgorithm            // Rate limiting algorithm for all visitor rate limits, unless overridden in VisitorRateLimitAlgorithms
+	VisitorRateLimitAlgorithms           map[string]util.RateAlgorithm // Rate limiting algorithm per visitor rate limit, keyed by VisitorRateLimitRequest, ...
+	VisitorStatsResetTime                time.Time                     // Time of the day at which to reset visitor stats
+	VisitorSubscriberRateLimiting        bool                          // Enable subscriber-based rate limiting for UnifiedPush topics
+	VisitorPrefixBitsIPv4                int                           // Number of bits for IPv4 rate limiting (default: 32)
+	VisitorPrefixBitsIPv6                int                           // Number of bits for IPv6 rate limiting (default: 64)
+	BehindProxy                          bool                          // If true, the server will trust the proxy client IP header to determine the client IP address (IPv4 and IPv6 supported)
+	ProxyForwardedHeader                 string                        // The header field to read the real/client IP address from, if BehindProxy is true, defaults to "X-Forwarded-For" (IPv4 and IPv6 supported)
+	ProxyTrustedPrefixes                 []netip.Prefix                // List of trusted proxy networks (IPv4 or IPv6) that will be stripped from the Forwarded header if BehindProxy is true
+	ProxyProtocol                        bool                          // If true, the HTTP(S) and SMTP listeners accept the PROXY protocol (v1/v2) header, only from ProxyTrustedPrefixes if set
 	StripeSecretKey                      string
 	StripeWebhookKey                     string
 	StripePriceCacheDuration             time.Duration
@@ -164,6 +226,12 @@ type Config struct {
 	EnableLogin                          bool
 	RequireLogin                         bool
 	EnableReservations                   bool // Allow users with role "user" to own/reserve topics
+	EnablePasswordReset                  bool // Allow users to reset their password via email
+	PasswordResetTokenDuration           time.Duration
+	TierExpiryGracePeriod                time.Duration // Time after a tier expired before the user is downgraded
+	TierExpiryDowngradeTier              string        // Tier code users are downgraded to when their tier expires; empty removes the tier
+	TierExpiryWarningDuration            time.Duration // Time before a tier expires at which users are warned via email
+	TierExpiryWebhookURL                 string        // URL to POST tier expiry events to, e.g. for billing systems
 	EnableMetrics                        bool
 	AccessControlAllowOrigin             string // CORS header field to restrict access from web clients
 	WebPushPrivateKey                    string
@@ -183,26 +251,36 @@ func NewConfig() *Config {
 		BaseURL:                              "",
 		ListenHTTP:                           DefaultListenHTTP,
 		ListenHTTPS:                          "",
+		ListenHTTP3:                          "",
 		ListenUnix:                           "",
 		ListenUnixMode:                       0,
 		KeyFile:                              "",
 		CertFile:                             "",
+		ACMEDomains:                          nil,
+		ACMEEmail:                            "",
+		ACMECacheDir:                         "",
+		ACMEDirectoryURL:                     "",
 		FirebaseKeyFile:                      "",
 		CacheFile:                            "",
 		CacheDuration:                        DefaultCacheDuration,
 		CacheStartupQueries:                  "",
 		CacheBatchSize:                       0,
 		CacheBatchTimeout:                    0,
+		CacheExpirationEvents:                false,
 		AuthFile:                             "",
 		AuthStartupQueries:                   "",
 		AuthDefault:                          user.PermissionReadWrite,
 		AuthBcryptCost:                       user.DefaultUserPasswordBcryptCost,
 		AuthStatsQueueWriterInterval:         user.DefaultUserStatsQueueWriterInterval,
+		AuthCacheTTL:                         user.DefaultUserAuthCacheTTL,
 		AttachmentCacheDir:                   "",
 		AttachmentTotalSizeLimit:             DefaultAttachmentTotalSizeLimit,
 		AttachmentFileSizeLimit:              DefaultAttachmentFileSizeLimit,
 		AttachmentExpiryDuration:             DefaultAttachmentExpiryDuration,
+		AttachmentGCStrategies:               []string{AttachmentGCStrategyExpired},
+		AttachmentGCSizeLimit:                0,
 		TemplateDir:                          DefaultTemplateDir,
+		DefaultLanguage:                      DefaultLanguage,
 		KeepaliveInterval:                    DefaultKeepaliveInterval,
 		ManagerInterval:                      DefaultManagerInterval,
 		DisallowedTopics:                     DefaultDisallowedTopics,
@@ -220,15 +298,29 @@ func NewConfig() *Config {
 		SMTPServerListen:                     "",
 		SMTPServerDomain:                     "",
 		SMTPServerAddrPrefix:                 "",
+		SMTPServerHTMLFormat:                 SMTPServerHTMLFormatText,
+		SyslogListen:                         "",
+		SyslogRules:                          make([]*SyslogRule, 0),
+		SNMPTrapListen:                       "",
+		SNMPTrapRules:                        make([]*SNMPTrapRule, 0),
+		SNMPTrapOIDNames:                     make(map[string]string),
 		TwilioCallsBaseURL:                   "https://api.twilio.com", // Override for tests
 		TwilioAccount:                        "",
 		TwilioAuthToken:                      "",
 		TwilioPhoneNumber:                    "",
 		TwilioVerifyBaseURL:                  "https://verify.twilio.com", // Override for tests
 		TwilioVerifyService:                  "",
+		LogLevelRevertAfter:                  DefaultLogLevelRevertAfter,
 		MessageSizeLimit:                     DefaultMessageSizeLimit,
+		MessageChunkedSizeLimit:              0,
 		MessageDelayMin:                      DefaultMessageDelayMin,
 		MessageDelayMax:                      DefaultMessageDelayMax,
+		PublishRoutes:                        make([]*PublishRoute, 0),
+		OverloadFanoutThreshold:              0,
+		OverloadCacheThreshold:               0,
+		HMACTopics:                           make([]*HMACTopic, 0),
+		HMACClockSkew:                        DefaultHMACClockSkew,
+		OutboundWebhooks:                     make([]*OutboundWebhook, 0),
 		TotalTopicLimit:                      DefaultTotalTopicLimit,
 		TotalAttachmentSizeLimit:             0,
 		VisitorSubscriptionLimit:             DefaultVisitorSubscriptionLimit,
@@ -245,11 +337,16 @@ func NewConfig() *Config {
 		VisitorAccountCreationLimitReplenish: DefaultVisitorAccountCreationLimitReplenish,
 		VisitorAuthFailureLimitBurst:         DefaultVisitorAuthFailureLimitBurst,
 		VisitorAuthFailureLimitReplenish:     DefaultVisitorAuthFailureLimitReplenish,
+		VisitorPasswordResetLimitBurst:       DefaultVisitorPasswordResetLimitBurst,
+		VisitorPasswordResetLimitReplenish:   DefaultVisitorPasswordResetLimitReplenish,
+		VisitorRateLimitAlgorithm:            DefaultVisitorRateLimitAlgorithm,
+		VisitorRateLimitAlgorithms:           make(map[string]util.RateAlgorithm),
 		VisitorStatsResetTime:                DefaultVisitorStatsResetTime,
 		VisitorPrefixBitsIPv4:                DefaultVisitorPrefixBitsIPv4, // Default: use full IPv4 address
 		VisitorPrefixBitsIPv6:                DefaultVisitorPrefixBitsIPv6, // Default: use /64 for IPv6
 		BehindProxy:                          false,                        // If true, the server will trust the proxy client IP header to determine the client IP address
 		ProxyForwardedHeader:                 "X-Forwarded-For",            // Default header for reverse proxy client IPs
+		ProxyProtocol:                        false,                        // If true, the real client IP is read from the PROXY protocol header sent by TCP load balancers
 		StripeSecretKey:                      "",
 		StripeWebhookKey:                     "",
 		StripePriceCacheDuration:             DefaultStripePriceCacheDuration,
@@ -257,6 +354,12 @@ func NewConfig() *Config {
 		EnableSignup:                         false,
 		EnableLogin:                          false,
 		EnableReservations:                   false,
+		EnablePasswordReset:                  false,
+		PasswordResetTokenDuration:           DefaultPasswordResetTokenDuration,
+		TierExpiryGracePeriod:                0,
+		TierExpiryDowngradeTier:              "",
+		TierExpiryWarningDuration:            DefaultTierExpiryWarningDuration,
+		TierExpiryWebhookURL:                 "",
 		RequireLogin:                         false,
 		AccessControlAllowOrigin:             "*",
 		Version:                              "",
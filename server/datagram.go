@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+)
+
+// Helpers for the UDP listeners (syslog and SNMP traps), which receive datagrams from network devices and
+// publish them as messages. Since UDP has no way to report errors to the sender, errors are only logged.
+
+const (
+	datagramMaxSize = 64 * 1024
+)
+
+// runDatagramListener reads datagrams from the connection and passes them to the handler, until the
+// connection is closed. Datagrams are handled one at a time, which limits the load on the server.
+func runDatagramListener(conn net.PacketConn, handler func(addr net.Addr, b []byte)) error {
+	buf := make([]byte, datagramMaxSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		handler(addr, buf[:n])
+	}
+}
+
+// publishDatagram publishes a message by calling the HTTP handler, like smtpSession.publishMessage. The
+// message is published as a request from the sender's IP address, so that rate limits apply. If the token
+// is set, it is used to authenticate the request; otherwise, the request is anonymous.
+func (s *Server) publishDatagram(topic, message string, header http.Header, token string, from netip.Addr) error {
+	if len(message) > s.config.MessageSizeLimit {
+		message = strings.ToValidUTF8(message[:s.config.MessageSizeLimit], "")
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", s.config.BaseURL, topic), strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	req.RequestURI = "/" + topic                                 // just for the logs
+	req.RemoteAddr = from.String()                               // rate limiting!!
+	req.Header.Set(s.config.ProxyForwardedHeader, from.String()) // Set X-Forwarded-For header
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	s.handle(rr, req)
+	if rr.Code != http.StatusOK {
+		return errors.New("error: " + rr.Body.String())
+	}
+	return nil
+}
+
+// datagramSenderAddr returns the IP address of the sender of a datagram
+func datagramSenderAddr(addr net.Addr) netip.Addr {
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		return udpAddr.AddrPort().Addr().Unmap()
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
+
+// parseIPPrefixOrAddr parses an IP range (e.g. 10.0.0.0/8) or a single IP address (e.g. 10.0.0.1)
+func parseIPPrefixOrAddr(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// prefixesContain returns true if the address is in any of the prefixes, or if there are no prefixes
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
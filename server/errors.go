@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"heckel.io/ntfy/v2/log"
 	"net/http"
+	"strings"
 )
 
 // errHTTP is a generic HTTP error for any non-200 HTTP error
@@ -43,6 +44,22 @@ func (e errHTTP) Wrap(message string, args ...any) *errHTTP {
 	return &clone
 }
 
+// Localize returns a copy of the error with a translated message, if the translator has a translation for the
+// error code. Details appended via Wrap are kept as they are.
+func (e errHTTP) Localize(t *translator) *errHTTP {
+	translated, ok := t.catalog[fmt.Sprintf("error.%d", e.Code)]
+	if !ok {
+		return &e
+	}
+	clone := e.clone()
+	if _, details, found := strings.Cut(clone.Message, "; "); found {
+		clone.Message = fmt.Sprintf("%s; %s", translated, details)
+	} else {
+		clone.Message = translated
+	}
+	return &clone
+}
+
 func (e errHTTP) With(contexters ...log.Contexter) *errHTTP {
 	c := e.clone()
 	if c.context == nil {
@@ -125,19 +142,60 @@ var (
 	errHTTPBadRequestInvalidUsername                 = &errHTTP{40046, http.StatusBadRequest, "invalid request: invalid username", "", nil}
 	errHTTPBadRequestTemplateFileNotFound            = &errHTTP{40047, http.StatusBadRequest, "invalid request: template file not found", "https://ntfy.sh/docs/publish/#message-templating", nil}
 	errHTTPBadRequestTemplateFileInvalid             = &errHTTP{40048, http.StatusBadRequest, "invalid request: template file invalid", "https://ntfy.sh/docs/publish/#message-templating", nil}
+	errHTTPBadRequestPasswordResetTokenInvalid       = &errHTTP{40049, http.StatusBadRequest, "invalid request: password reset link invalid or expired", "", nil}
+	errHTTPBadRequestInvalidEmail                    = &errHTTP{40050, http.StatusBadRequest, "invalid request: invalid email address", "", nil}
+	errHTTPBadRequestInvalidDisplayName              = &errHTTP{40051, http.StatusBadRequest, "invalid request: display name too long or contains invalid characters", "", nil}
+	errHTTPBadRequestInvalidAvatar                   = &errHTTP{40052, http.StatusBadRequest, "invalid request: avatar must be an http(s) URL or an image data URL", "", nil}
+	errHTTPBadRequestInviteInvalid                   = &errHTTP{40053, http.StatusBadRequest, "invalid request: invite invalid, used up or expired", "https://ntfy.sh/docs/config/#invites-for-reserved-topics", nil}
+	errHTTPBadRequestImpersonateUserInvalid          = &errHTTP{40054, http.StatusBadRequest, "invalid request: user to impersonate does not exist", "https://ntfy.sh/docs/config/#impersonating-users", nil}
+	errHTTPBadRequestGuestTokenInvalid               = &errHTTP{40055, http.StatusBadRequest, "invalid request: guest token invalid", "https://ntfy.sh/docs/config/#guest-tokens", nil}
+	errHTTPBadRequestTopicSchemaInvalid              = &errHTTP{40056, http.StatusBadRequest, "invalid request: invalid JSON schema", "https://ntfy.sh/docs/config/#json-schema-validation", nil}
+	errHTTPBadRequestTopicSchemaMismatch             = &errHTTP{40057, http.StatusBadRequest, "invalid request: message does not match the JSON schema of the topic", "https://ntfy.sh/docs/config/#json-schema-validation", nil}
+	errHTTPBadRequestProtobufInvalid                 = &errHTTP{40058, http.StatusBadRequest, "invalid request: request body must be a valid protobuf message", "https://ntfy.sh/docs/publish/#publish-as-protobuf", nil}
+	errHTTPBadRequestWaitInvalid                     = &errHTTP{40059, http.StatusBadRequest, "invalid wait parameter: must be a duration up to 5m", "https://ntfy.sh/docs/subscribe/api/#long-polling", nil}
+	errHTTPBadRequestChunkInvalid                    = &errHTTP{40060, http.StatusBadRequest, "invalid request: chunk ID, index or count invalid, or chunked messages not enabled", "https://ntfy.sh/docs/publish/#large-messages", nil}
+	errHTTPBadRequestUploadInvalid                   = &errHTTP{40061, http.StatusBadRequest, "invalid request: upload length or metadata invalid", "https://ntfy.sh/docs/publish/#resumable-uploads", nil}
+	errHTTPBadRequestUploadIncomplete                = &errHTTP{40062, http.StatusBadRequest, "invalid request: upload is not complete, or cannot be combined with an external attachment", "https://ntfy.sh/docs/publish/#resumable-uploads", nil}
+	errHTTPBadRequestEphemeralTopicInvalid           = &errHTTP{40063, http.StatusBadRequest, "invalid request: TTL or message limit of ephemeral topic invalid", "https://ntfy.sh/docs/publish/#ephemeral-topics", nil}
+	errHTTPBadRequestVisibilityTimeoutInvalid        = &errHTTP{40064, http.StatusBadRequest, "invalid request: visibility timeout invalid", "https://ntfy.sh/docs/subscribe/api/#claim-and-acknowledge-messages", nil}
+	errHTTPBadRequestTagInvalid                      = &errHTTP{40065, http.StatusBadRequest, "invalid request: unknown emoji in tags", "https://ntfy.sh/docs/publish/#tags-emojis", nil}
+	errHTTPBadRequestTopicSilenceInvalid             = &errHTTP{40066, http.StatusBadRequest, "invalid request: invalid silence window", "https://ntfy.sh/docs/config/#silence-windows", nil}
+	errHTTPBadRequestTopicEscalationInvalid          = &errHTTP{40067, http.StatusBadRequest, "invalid request: invalid escalation policy", "https://ntfy.sh/docs/config/#escalation-policies", nil}
+	errHTTPBadRequestTopicMuteInvalid                = &errHTTP{40068, http.StatusBadRequest, "invalid request: mute must end in the future", "https://ntfy.sh/docs/config/#muting-topics", nil}
+	errHTTPBadRequestIdempotencyKeyInvalid           = &errHTTP{40069, http.StatusBadRequest, "invalid request: idempotency key invalid", "https://ntfy.sh/docs/publish/#idempotent-publishing", nil}
+	errHTTPBadRequestHomeAssistantTopicsMissing      = &errHTTP{40070, http.StatusBadRequest, "invalid request: no topics given, and no reserved topics found", "https://ntfy.sh/docs/config/#home-assistant", nil}
+	errHTTPBadRequestRouteInvalid                    = &errHTTP{40071, http.StatusBadRequest, "invalid request: invalid route", "https://ntfy.sh/docs/publish/#content-based-routing", nil}
+	errHTTPBadRequestMetadataInvalid                 = &errHTTP{40072, http.StatusBadRequest, "invalid request: invalid message metadata", "https://ntfy.sh/docs/publish/#message-metadata", nil}
+	errHTTPBadRequestSignatureInvalid                = &errHTTP{40073, http.StatusBadRequest, "invalid request: message signature, timestamp or nonce missing or invalid", "https://ntfy.sh/docs/publish/#signed-messages", nil}
 	errHTTPNotFound                                  = &errHTTP{40401, http.StatusNotFound, "page not found", "", nil}
+	errHTTPNotFoundUpload                            = &errHTTP{40402, http.StatusNotFound, "upload not found or expired", "https://ntfy.sh/docs/publish/#resumable-uploads", nil}
+	errHTTPNotFoundEphemeralTopic                    = &errHTTP{40403, http.StatusNotFound, "ephemeral topic not found or expired", "https://ntfy.sh/docs/publish/#ephemeral-topics", nil}
+	errHTTPNotFoundClaim                             = &errHTTP{40404, http.StatusNotFound, "claim not found, already acknowledged, or message claimed by someone else", "https://ntfy.sh/docs/subscribe/api/#claim-and-acknowledge-messages", nil}
+	errHTTPNotFoundEscalation                        = &errHTTP{40405, http.StatusNotFound, "message not found, already acknowledged, or not escalated", "https://ntfy.sh/docs/config/#escalation-policies", nil}
 	errHTTPUnauthorized                              = &errHTTP{40101, http.StatusUnauthorized, "unauthorized", "https://ntfy.sh/docs/publish/#authentication", nil}
+	errHTTPUnauthorizedPasswordExpired               = &errHTTP{40102, http.StatusUnauthorized, "unauthorized: password expired, please reset your password", "https://ntfy.sh/docs/config/#password-reset", nil}
 	errHTTPForbidden                                 = &errHTTP{40301, http.StatusForbidden, "forbidden", "https://ntfy.sh/docs/publish/#authentication", nil}
+	errHTTPForbiddenImpersonating                    = &errHTTP{40302, http.StatusForbidden, "forbidden: action not allowed while impersonating a user", "https://ntfy.sh/docs/config/#impersonating-users", nil}
+	errHTTPForbiddenSignatureMismatch                = &errHTTP{40303, http.StatusForbidden, "forbidden: message signature does not match", "https://ntfy.sh/docs/publish/#signed-messages", nil}
+	errHTTPForbiddenSignatureExpired                 = &errHTTP{40304, http.StatusForbidden, "forbidden: message timestamp is outside the allowed clock skew", "https://ntfy.sh/docs/publish/#signed-messages", nil}
 	errHTTPConflictUserExists                        = &errHTTP{40901, http.StatusConflict, "conflict: user already exists", "", nil}
 	errHTTPConflictTopicReserved                     = &errHTTP{40902, http.StatusConflict, "conflict: access control entry for topic or topic pattern already exists", "", nil}
 	errHTTPConflictSubscriptionExists                = &errHTTP{40903, http.StatusConflict, "conflict: topic subscription already exists", "", nil}
 	errHTTPConflictPhoneNumberExists                 = &errHTTP{40904, http.StatusConflict, "conflict: phone number already exists", "", nil}
 	errHTTPConflictProvisionedUserChange             = &errHTTP{40905, http.StatusConflict, "conflict: cannot change or delete provisioned user", "", nil}
 	errHTTPConflictProvisionedTokenChange            = &errHTTP{40906, http.StatusConflict, "conflict: cannot change or delete provisioned token", "", nil}
+	errHTTPConflictUploadOffset                      = &errHTTP{40907, http.StatusConflict, "conflict: upload offset does not match, or upload in progress", "https://ntfy.sh/docs/publish/#resumable-uploads", nil}
+	errHTTPConflictNonceUsed                         = &errHTTP{40908, http.StatusConflict, "conflict: nonce was already used, message may have been replayed", "https://ntfy.sh/docs/publish/#signed-messages", nil}
 	errHTTPGonePhoneVerificationExpired              = &errHTTP{41001, http.StatusGone, "phone number verification expired or does not exist", "", nil}
+	errHTTPGoneEphemeralTopic                        = &errHTTP{41002, http.StatusGone, "ephemeral topic expired or message limit reached", "https://ntfy.sh/docs/publish/#ephemeral-topics", nil}
+	errHTTPPreconditionFailedTusVersion              = &errHTTP{41201, http.StatusPreconditionFailed, "unsupported tus protocol version", "https://ntfy.sh/docs/publish/#resumable-uploads", nil}
 	errHTTPEntityTooLargeAttachment                  = &errHTTP{41301, http.StatusRequestEntityTooLarge, "attachment too large, or bandwidth limit reached", "https://ntfy.sh/docs/publish/#limitations", nil}
 	errHTTPEntityTooLargeMatrixRequest               = &errHTTP{41302, http.StatusRequestEntityTooLarge, "Matrix request is larger than the max allowed length", "", nil}
 	errHTTPEntityTooLargeJSONBody                    = &errHTTP{41303, http.StatusRequestEntityTooLarge, "JSON body too large", "", nil}
+	errHTTPEntityTooLargeProtobufBody                = &errHTTP{41304, http.StatusRequestEntityTooLarge, "protobuf body too large", "", nil}
+	errHTTPEntityTooLargeChunkedMessage              = &errHTTP{41305, http.StatusRequestEntityTooLarge, "chunk or chunked message too large", "https://ntfy.sh/docs/publish/#large-messages", nil}
+	errHTTPUnsupportedMediaTypeAttachment            = &errHTTP{41501, http.StatusUnsupportedMediaType, "attachment type not allowed", "https://ntfy.sh/docs/publish/#limitations", nil}
+	errHTTPUnsupportedMediaTypeUpload                = &errHTTP{41502, http.StatusUnsupportedMediaType, "upload content type must be application/offset+octet-stream", "https://ntfy.sh/docs/publish/#resumable-uploads", nil}
 	errHTTPTooManyRequestsLimitRequests              = &errHTTP{42901, http.StatusTooManyRequests, "limit reached: too many requests", "https://ntfy.sh/docs/publish/#limitations", nil}
 	errHTTPTooManyRequestsLimitEmails                = &errHTTP{42902, http.StatusTooManyRequests, "limit reached: too many emails", "https://ntfy.sh/docs/publish/#limitations", nil}
 	errHTTPTooManyRequestsLimitSubscriptions         = &errHTTP{42903, http.StatusTooManyRequests, "limit reached: too many active subscriptions", "https://ntfy.sh/docs/publish/#limitations", nil}
@@ -148,9 +206,15 @@ var (
 	errHTTPTooManyRequestsLimitMessages              = &errHTTP{42908, http.StatusTooManyRequests, "limit reached: daily message quota reached", "https://ntfy.sh/docs/publish/#limitations", nil}
 	errHTTPTooManyRequestsLimitAuthFailure           = &errHTTP{42909, http.StatusTooManyRequests, "limit reached: too many auth failures", "https://ntfy.sh/docs/publish/#limitations", nil} // FIXME document limit
 	errHTTPTooManyRequestsLimitCalls                 = &errHTTP{42910, http.StatusTooManyRequests, "limit reached: daily phone call quota reached", "https://ntfy.sh/docs/publish/#limitations", nil}
+	errHTTPTooManyRequestsLimitPasswordReset         = &errHTTP{42911, http.StatusTooManyRequests, "limit reached: too many password reset requests", "https://ntfy.sh/docs/config/#password-reset", nil}
+	errHTTPTooManyRequestsLimitChunkedMessages       = &errHTTP{42912, http.StatusTooManyRequests, "limit reached: too many incomplete chunked messages", "https://ntfy.sh/docs/publish/#large-messages", nil}
+	errHTTPTooManyRequestsLimitUploads               = &errHTTP{42913, http.StatusTooManyRequests, "limit reached: too many unpublished uploads", "https://ntfy.sh/docs/publish/#resumable-uploads", nil}
+	errHTTPTooManyRequestsLimitEphemeralTopics       = &errHTTP{42914, http.StatusTooManyRequests, "limit reached: too many ephemeral topics", "https://ntfy.sh/docs/publish/#ephemeral-topics", nil}
+	errHTTPTooManyRequestsLimitTopicMutes            = &errHTTP{42915, http.StatusTooManyRequests, "limit reached: too many muted topics", "https://ntfy.sh/docs/config/#muting-topics", nil}
 	errHTTPInternalError                             = &errHTTP{50001, http.StatusInternalServerError, "internal server error", "", nil}
 	errHTTPInternalErrorInvalidPath                  = &errHTTP{50002, http.StatusInternalServerError, "internal server error: invalid path", "", nil}
 	errHTTPInternalErrorMissingBaseURL               = &errHTTP{50003, http.StatusInternalServerError, "internal server error: base-url must be be configured for this feature", "https://ntfy.sh/docs/config/", nil}
 	errHTTPInternalErrorWebPushUnableToPublish       = &errHTTP{50004, http.StatusInternalServerError, "internal server error: unable to publish web push message", "", nil}
+	errHTTPServiceUnavailableOverloaded              = &errHTTP{50301, http.StatusServiceUnavailable, "service unavailable: server is overloaded", "https://ntfy.sh/docs/config/#overload-protection", nil}
 	errHTTPInsufficientStorageUnifiedPush            = &errHTTP{50701, http.StatusInsufficientStorage, "cannot publish to UnifiedPush topic without previously active subscriber", "", nil}
 )
@@ -94,6 +94,27 @@ func (c *fileCache) Remove(ids ...string) error {
 	return nil
 }
 
+// Files returns the attachment files in the cache directory by message ID. Other files and
+// directories (e.g. the uploads directory) are skipped.
+func (c *fileCache) Files() (map[string]os.FileInfo, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]os.FileInfo)
+	for _, e := range entries {
+		if e.IsDir() || !fileIDRegex.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		files[e.Name()] = info
+	}
+	return files, nil
+}
+
 func (c *fileCache) Size() int64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -117,6 +138,9 @@ func dirSize(dir string) (int64, error) {
 	}
 	var size int64
 	for _, e := range entries {
+		if e.IsDir() {
+			continue // Skip uploads dir, see uploadStore
+		}
 		info, err := e.Info()
 		if err != nil {
 			return 0, err
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"heckel.io/ntfy/v2/user"
+)
+
+// Server-rendered content (emails, phone calls, error messages) is localized using message catalogs.
+// A catalog is a flat JSON map of message keys to localized strings, which may contain {placeholders}.
+// Keys missing in a catalog fall back to English.
+
+const (
+	// DefaultLanguage is the language used if neither the user nor the client asks for a supported language
+	DefaultLanguage = "en"
+)
+
+var (
+	//go:embed i18n/*.json
+	catalogsFS embed.FS
+	catalogs   = mustLoadCatalogs()
+)
+
+// translator looks up localized strings for a single language
+type translator struct {
+	lang    string
+	catalog map[string]string
+}
+
+// newTranslator returns a translator for the given language, or for the default language
+// if the given language is not supported
+func newTranslator(lang string) *translator {
+	catalog, ok := catalogs[lang]
+	if !ok {
+		lang, catalog = DefaultLanguage, catalogs[DefaultLanguage]
+	}
+	return &translator{
+		lang:    lang,
+		catalog: catalog,
+	}
+}
+
+// T returns the localized string for the given key, replacing the {placeholders} with the given
+// name/value pairs, e.g. T("call.sender", "sender", "phil")
+func (t *translator) T(key string, args ...string) string {
+	s, ok := t.lookup(key)
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return s
+	}
+	oldnew := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		oldnew = append(oldnew, "{"+args[i]+"}", args[i+1])
+	}
+	return strings.NewReplacer(oldnew...).Replace(s)
+}
+
+func (t *translator) lookup(key string) (string, bool) {
+	if s, ok := t.catalog[key]; ok {
+		return s, true
+	}
+	s, ok := catalogs[DefaultLanguage][key]
+	return s, ok
+}
+
+// IsSupportedLanguage returns true if there is a message catalog for the given language
+func IsSupportedLanguage(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// language returns the language in which content for the given user and request should be rendered. The
+// user's language preference wins over the Accept-Language header, which wins over the configured default
+// language. Both u and r may be nil.
+func (s *Server) language(u *user.User, r *http.Request) string {
+	candidates := make([]string, 0)
+	if u != nil && u.Prefs != nil && u.Prefs.Language != nil {
+		candidates = append(candidates, *u.Prefs.Language)
+	}
+	if r != nil {
+		candidates = append(candidates, parseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+	}
+	return matchLanguage(s.config.DefaultLanguage, candidates...)
+}
+
+// matchLanguage returns the first supported language of the given candidates, or the fallback language. Candidates
+// are matched exactly first (e.g. "pt-br"), and then by their base language (e.g. "pt").
+func matchLanguage(fallback string, candidates ...string) string {
+	for _, candidate := range candidates {
+		lang := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(candidate), "_", "-"))
+		if IsSupportedLanguage(lang) {
+			return lang
+		}
+		if base, _, found := strings.Cut(lang, "-"); found && IsSupportedLanguage(base) {
+			return base
+		}
+	}
+	if IsSupportedLanguage(fallback) {
+		return fallback
+	}
+	return DefaultLanguage
+}
+
+// parseAcceptLanguage parses an Accept-Language header (e.g. "de-CH, de;q=0.9, en;q=0.8") and returns the
+// languages ordered by their quality value. Wildcards and languages with q=0 are skipped.
+func parseAcceptLanguage(header string) []string {
+	type weightedLanguage struct {
+		lang string
+		q    float64
+	}
+	weighted := make([]weightedLanguage, 0)
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.TrimSpace(lang)
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			weighted = append(weighted, weightedLanguage{lang: lang, q: q})
+		}
+	}
+	sort.SliceStable(weighted, func(i, j int) bool {
+		return weighted[i].q > weighted[j].q
+	})
+	langs := make([]string, len(weighted))
+	for i, w := range weighted {
+		langs[i] = w.lang
+	}
+	return langs
+}
+
+func mustLoadCatalogs() map[string]map[string]string {
+	entries, err := catalogsFS.ReadDir("i18n")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]map[string]string)
+	for _, entry := range entries {
+		b, err := catalogsFS.ReadFile(path.Join("i18n", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(b, &catalog); err != nil {
+			panic(fmt.Sprintf("invalid message catalog %s: %s", entry.Name(), err.Error()))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = catalog
+	}
+	return loaded
+}
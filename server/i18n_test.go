@@ -0,0 +1,107 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestI18n_CatalogsComplete(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for key := range catalogs[DefaultLanguage] {
+			_, ok := catalog[key]
+			require.True(t, ok, "key %s missing in catalog %s", key, lang)
+		}
+		for key := range catalog {
+			if !strings.HasPrefix(key, "error.") {
+				_, ok := catalogs[DefaultLanguage][key]
+				require.True(t, ok, "unknown key %s in catalog %s", key, lang)
+			}
+		}
+	}
+}
+
+func TestI18n_ParseAcceptLanguage(t *testing.T) {
+	require.Equal(t, []string{"de-CH", "fr", "de", "en"}, parseAcceptLanguage("de;q=0.8, de-CH, en;q=0.5, fr;q=0.9, *;q=0.1"))
+	require.Equal(t, []string{"en"}, parseAcceptLanguage("en, it;q=0, es;q=invalid"))
+	require.Equal(t, []string{}, parseAcceptLanguage(""))
+}
+
+func TestI18n_MatchLanguage(t *testing.T) {
+	require.Equal(t, "de", matchLanguage("en", "de-CH"))
+	require.Equal(t, "fr", matchLanguage("en", "it", "fr_FR"))
+	require.Equal(t, "de", matchLanguage("de", "it"))
+	require.Equal(t, "en", matchLanguage("xx"))
+}
+
+func TestI18n_TranslatorFallback(t *testing.T) {
+	tr := newTranslator("de")
+	require.Equal(t, "de", tr.lang)
+	require.Equal(t, "Ende der Nachricht.", tr.T("call.end"))
+	require.Equal(t, "Diese Nachricht wurde von Benutzer {phil} gesendet. Sie wird dreimal wiederholt.", tr.T("call.sender", "sender", "{phil}"))
+	require.Equal(t, "does.not.exist", tr.T("does.not.exist"))
+
+	tr = newTranslator("xx")
+	require.Equal(t, "en", tr.lang)
+	require.Equal(t, "End of message.", tr.T("call.end"))
+}
+
+func TestI18n_FormatMails(t *testing.T) {
+	actual := formatPasswordResetMail(newTranslator("de"), "https://ntfy.sh", "1.2.3.4", "ntfy@ntfy.sh", "phil@example.com", "phil", "https://ntfy.sh/reset-password?token=pr_123", time.Hour)
+	require.Contains(t, actual, "Subject: =?utf-8?b?UGFzc3dvcnQgenVyw7xja3NldHplbg==?=\n")
+	require.Contains(t, actual, "Hallo phil,\n")
+	require.Contains(t, actual, "innerhalb der nächsten 1h den folgenden Link:\n\nhttps://ntfy.sh/reset-password?token=pr_123\n")
+
+	actual = formatTierExpiryWarningMail(newTranslator("en"), "https://ntfy.sh", "ntfy@ntfy.sh", "phil@example.com", "phil", "Pro", time.Unix(1700000000, 0))
+	require.Contains(t, actual, "Subject: Your Pro plan is about to expire\n")
+	require.Contains(t, actual, "your Pro plan on ntfy.sh expires on Tue, 14 Nov 2023 22:13:20 UTC.")
+}
+
+func TestI18n_FormatCall(t *testing.T) {
+	actual := formatCall(newTranslator("fr"), &message{Topic: "alerts", Message: "disk <full>"}, "phil")
+	require.Contains(t, actual, `<Say loop="3" language="fr-FR">`)
+	require.Contains(t, actual, "Vous avez un message de notify sur le sujet alerts. Message :")
+	require.Contains(t, actual, "disk &lt;full&gt;")
+	require.Contains(t, actual, `<Say language="fr-FR">Au revoir.</Say>`)
+}
+
+func TestI18n_ErrorMessages(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	u, err := s.userManager.User("phil")
+	require.Nil(t, err)
+	require.Nil(t, s.userManager.ChangeSettings(u.ID, &user.Prefs{Language: util.String("fr")}))
+
+	response := request(t, s, "GET", "/mytopic/json?since=invalid", "", nil)
+	require.Equal(t, "invalid since parameter", toHTTPError(t, response.Body.String()).Message)
+
+	response = request(t, s, "GET", "/mytopic/json?since=invalid", "", map[string]string{
+		"Accept-Language": "de-DE,de;q=0.9",
+	})
+	require.Equal(t, 40008, toHTTPError(t, response.Body.String()).Code)
+	require.Equal(t, "invalid since parameter", toHTTPError(t, response.Body.String()).Message) // No translation, falls back to English
+
+	response = request(t, s, "PUT", "/mytopic", "hi", map[string]string{
+		"Accept-Language": "de-DE,de;q=0.9",
+		"Priority":        "invalid",
+	})
+	require.Equal(t, `ungültiger Prioritäts-Parameter; unknown priority "invalid", use 1-5, or one of min, low, default, high, max`, toHTTPError(t, response.Body.String()).Message)
+
+	// User preference wins over Accept-Language
+	response = request(t, s, "PUT", "/mytopic", "hi", map[string]string{
+		"Accept-Language": "de",
+		"Authorization":   util.BasicAuth("phil", "phil"),
+		"Priority":        "invalid",
+	})
+	require.True(t, strings.HasPrefix(toHTTPError(t, response.Body.String()).Message, "paramètre de priorité invalide; "))
+}
+
+func TestI18n_ErrorLocalizeWrapped(t *testing.T) {
+	err := errHTTPTooManyRequestsLimitMessages.Wrap("increase your limits with a paid plan, see %s", "https://ntfy.sh")
+	require.Equal(t, "Limit erreicht: tägliches Nachrichtenkontingent aufgebraucht; increase your limits with a paid plan, see https://ntfy.sh", err.Localize(newTranslator("de")).Message)
+	require.Equal(t, err.Message, err.Localize(newTranslator("en")).Message)
+}
@@ -7,6 +7,7 @@ import (
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/util"
 	"net/http"
+	"regexp"
 	"strings"
 	"unicode/utf8"
 )
@@ -18,9 +19,12 @@ const (
 	tagPublish      = "publish"
 	tagSubscribe    = "subscribe"
 	tagFirebase     = "firebase"
-	tagSMTP         = "smtp"  // Receive email
-	tagEmail        = "email" // Send email
+	tagSMTP         = "smtp"   // Receive email
+	tagSyslog       = "syslog" // Receive syslog datagrams
+	tagSNMP         = "snmp"   // Receive SNMP traps
+	tagEmail        = "email"  // Send email
 	tagTwilio       = "twilio"
+	tagWebhook      = "webhook" // Outbound webhooks
 	tagFileCache    = "file_cache"
 	tagMessageCache = "message_cache"
 	tagStripe       = "stripe"
@@ -30,16 +34,28 @@ const (
 	tagWebsocket    = "websocket"
 	tagMatrix       = "matrix"
 	tagWebPush      = "webpush"
+	tagAudit        = "audit" // Impersonated requests
+	tagUpload       = "upload"
+	tagEphemeral    = "ephemeral"
+	tagClaim        = "claim"
+)
+
+// Request IDs, see withRequestID
+const (
+	fieldRequestID  = "request_id"
+	requestIDLength = 16
 )
 
 var (
+	requestIDRegex         = regexp.MustCompile(`^[-_.A-Za-z0-9]{1,64}$`)
 	normalErrorCodes       = []int{http.StatusNotFound, http.StatusBadRequest, http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusForbidden, http.StatusInsufficientStorage}
 	rateLimitingErrorCodes = []int{http.StatusTooManyRequests, http.StatusRequestEntityTooLarge}
 )
 
-// logr creates a new log event with HTTP request fields
+// logr creates a new log event with HTTP request fields, and the fields attached to the request context
+// (request ID and visitor, see withRequestID and withLogVisitor)
 func logr(r *http.Request) *log.Event {
-	return log.Tag(tagHTTP).Fields(httpContext(r)) // Tag may be overwritten
+	return log.FromContext(r.Context()).Tag(tagHTTP).Fields(httpContext(r)) // Tag may be overwritten
 }
 
 // logv creates a new log event with visitor fields
@@ -49,6 +65,9 @@ func logv(v *visitor) *log.Event {
 
 // logvr creates a new log event with HTTP request and visitor fields
 func logvr(v *visitor, r *http.Request) *log.Event {
+	if rv, err := fromContext[*visitor](r, contextVisitor); err == nil && rv == v {
+		return logr(r) // Visitor fields are already attached to the request context
+	}
 	return logr(r).With(v)
 }
 
@@ -71,6 +90,27 @@ func logem(smtpConn *smtp.Conn) *log.Event {
 	return ev
 }
 
+// withRequestID assigns a request ID to the request, and attaches it to the request context, so that it is added
+// to all log events created via logr or log.FromContext. A valid X-Request-ID header (e.g. set by a proxy) is reused.
+// The request ID is returned to the client in the X-Request-ID response header.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	requestID := r.Header.Get("X-Request-ID")
+	if !requestIDRegex.MatchString(requestID) {
+		requestID = util.RandomString(requestIDLength)
+	}
+	w.Header().Set("X-Request-ID", requestID)
+	logger := log.FromContext(r.Context()).Child(log.Context{fieldRequestID: requestID})
+	return r.WithContext(log.WithContext(r.Context(), logger))
+}
+
+// withLogVisitor attaches the visitor to the request context, so that its fields are added to all log events
+// created via logr or log.FromContext
+func withLogVisitor(r *http.Request, v *visitor) *http.Request {
+	logger := log.FromContext(r.Context()).ChildWith(v)
+	r = r.WithContext(log.WithContext(r.Context(), logger))
+	return withContext(r, map[contextKey]any{contextVisitor: v})
+}
+
 func httpContext(r *http.Request) log.Context {
 	requestURI := r.RequestURI
 	if requestURI == "" {
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Email provider types, see EmailProvider
+const (
+	EmailProviderSMTP     = "smtp"
+	EmailProviderSES      = "ses"
+	EmailProviderMailgun  = "mailgun"
+	EmailProviderSendGrid = "sendgrid"
+)
+
+var (
+	emailProviderRegex     = regexp.MustCompile(`^(smtp|ses|mailgun|sendgrid)(?::(\S+))?((?:\s+[-a-z]+=\S+)*)\s*$`)
+	emailProviderRateRegex = regexp.MustCompile(`^(\d+)/(\S+)$`)
+)
+
+// EmailProvider configures a provider used to send outgoing emails, see ParseEmailProvider. Providers are
+// tried in order, so that a second provider can take over if the first one fails or is rate limited.
+type EmailProvider struct {
+	Type         string        // Provider type, e.g. EmailProviderSES
+	Addr         string        // SMTP server (host:port), SES region, or Mailgun domain
+	User         string        // SMTP user
+	Pass         string        // SMTP password
+	AccessKey    string        // SES access key ID
+	SecretKey    string        // SES secret access key
+	APIKey       string        // Mailgun or SendGrid API key
+	Endpoint     string        // Base URL of the API, overrides the default (e.g. Mailgun EU region, or compatible services)
+	RateLimit    int           // Max number of emails per RateInterval sent via this provider, unlimited if zero
+	RateInterval time.Duration // Interval of RateLimit
+}
+
+// mailProvider sends a formatted email (RFC 5322 message) to a single recipient
+type mailProvider interface {
+	Name() string // Name of the provider used in logs, without credentials, e.g. "ses:us-east-1"
+	Send(from, to string, message []byte) error
+}
+
+// ParseEmailProvider parses an entry of the email-providers option. Entries have the format
+// "<type>[:<addr>] [key=value ...]", e.g. "ses:us-east-1 access-key=AKIA... secret-key=... rate=14/1s".
+//
+// Supported types and keys:
+//   - smtp:<host:port> [user=..] [pass=..]
+//   - ses:<region> access-key=.. secret-key=..
+//   - mailgun:<domain> api-key=.. [region=eu]
+//   - sendgrid api-key=..
+//
+// All providers support rate=<count>/<interval> (e.g. rate=100/1h), and API-based providers support
+// endpoint=<url> to override the API base URL.
+func ParseEmailProvider(spec string) (*EmailProvider, error) {
+	m := emailProviderRegex.FindStringSubmatch(strings.TrimSpace(spec))
+	if m == nil {
+		return nil, fmt.Errorf(`invalid email provider "%s", must be "<type>[:<addr>] [key=value ...]", with type smtp, ses, mailgun or sendgrid`, spec)
+	}
+	p := &EmailProvider{
+		Type: m[1],
+		Addr: m[2],
+	}
+	for _, option := range strings.Fields(m[3]) {
+		key, value, _ := strings.Cut(option, "=")
+		switch {
+		case key == "user" && p.Type == EmailProviderSMTP:
+			p.User = value
+		case key == "pass" && p.Type == EmailProviderSMTP:
+			p.Pass = value
+		case key == "access-key" && p.Type == EmailProviderSES:
+			p.AccessKey = value
+		case key == "secret-key" && p.Type == EmailProviderSES:
+			p.SecretKey = value
+		case key == "api-key" && (p.Type == EmailProviderMailgun || p.Type == EmailProviderSendGrid):
+			p.APIKey = value
+		case key == "region" && p.Type == EmailProviderMailgun:
+			if value != "eu" && value != "us" {
+				return nil, fmt.Errorf(`invalid email provider "%s", region must be "eu" or "us"`, spec)
+			} else if value == "eu" {
+				p.Endpoint = mailgunEUEndpoint
+			}
+		case key == "endpoint" && p.Type != EmailProviderSMTP:
+			u, err := url.Parse(value)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf(`invalid email provider "%s", endpoint must be an http:// or https:// URL`, spec)
+			}
+			p.Endpoint = strings.TrimSuffix(value, "/")
+		case key == "rate":
+			rm := emailProviderRateRegex.FindStringSubmatch(value)
+			if rm == nil {
+				return nil, fmt.Errorf(`invalid email provider "%s", rate must be "<count>/<interval>", e.g. "100/1h"`, spec)
+			}
+			count, err := strconv.Atoi(rm[1])
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf(`invalid email provider "%s", rate count must be a positive number`, spec)
+			}
+			interval, err := util.ParseDuration(rm[2])
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf(`invalid email provider "%s", rate interval must be a duration, e.g. 1s or 1h`, spec)
+			}
+			p.RateLimit, p.RateInterval = count, interval
+		default:
+			return nil, fmt.Errorf(`invalid email provider "%s", unknown option "%s" for type %s`, spec, key, p.Type)
+		}
+	}
+	switch p.Type {
+	case EmailProviderSMTP:
+		if _, _, err := net.SplitHostPort(p.Addr); err != nil {
+			return nil, fmt.Errorf(`invalid email provider "%s", smtp requires a server address, e.g. "smtp:mail.example.com:587"`, spec)
+		}
+	case EmailProviderSES:
+		if p.Addr == "" || p.AccessKey == "" || p.SecretKey == "" {
+			return nil, fmt.Errorf(`invalid email provider "%s", ses requires a region, access-key and secret-key, e.g. "ses:us-east-1 access-key=... secret-key=..."`, spec)
+		}
+	case EmailProviderMailgun:
+		if p.Addr == "" || p.APIKey == "" {
+			return nil, fmt.Errorf(`invalid email provider "%s", mailgun requires a domain and api-key, e.g. "mailgun:mg.example.com api-key=..."`, spec)
+		}
+	case EmailProviderSendGrid:
+		if p.Addr != "" || p.APIKey == "" {
+			return nil, fmt.Errorf(`invalid email provider "%s", sendgrid requires an api-key, e.g. "sendgrid api-key=..."`, spec)
+		}
+	}
+	return p, nil
+}
+
+// rateLimiter returns the limiter of the provider, or nil if the provider is not rate limited
+func (p *EmailProvider) rateLimiter() *util.RateLimiter {
+	if p.RateLimit <= 0 {
+		return nil
+	}
+	return util.NewRateLimiter(rate.Every(p.RateInterval/time.Duration(p.RateLimit)), p.RateLimit)
+}
+
+func newMailProvider(p *EmailProvider) mailProvider {
+	switch p.Type {
+	case EmailProviderSES:
+		return newSESProvider(p)
+	case EmailProviderMailgun:
+		return newMailgunProvider(p)
+	case EmailProviderSendGrid:
+		return newSendGridProvider(p)
+	default:
+		return &smtpProvider{addr: p.Addr, user: p.User, pass: p.Pass}
+	}
+}
+
+// smtpProvider sends emails via an SMTP server
+type smtpProvider struct {
+	addr string
+	user string
+	pass string
+}
+
+func (p *smtpProvider) Name() string {
+	return EmailProviderSMTP + ":" + p.addr
+}
+
+func (p *smtpProvider) Send(from, to string, message []byte) error {
+	host, _, err := net.SplitHostPort(p.addr)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if p.user != "" {
+		auth = smtp.PlainAuth("", p.user, p.pass, host)
+	}
+	return smtp.SendMail(p.addr, auth, from, []string{to}, message)
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	mailProviderTimeout      = 30 * time.Second
+	mailProviderErrorMaxBody = 512 // Max number of bytes of an API error response included in the error
+
+	sesEndpointFormat   = "https://email.%s.amazonaws.com"
+	sesSendPath         = "/v2/email/outbound-emails"
+	mailgunUSEndpoint   = "https://api.mailgun.net"
+	mailgunEUEndpoint   = "https://api.eu.mailgun.net"
+	sendGridEndpoint    = "https://api.sendgrid.com"
+	sendGridSendPath    = "/v3/mail/send"
+	awsSignatureAlgo    = "AWS4-HMAC-SHA256"
+	awsSignatureService = "ses"
+)
+
+// sesProvider sends emails via the Amazon SES v2 API, see https://docs.aws.amazon.com/ses/latest/APIReference-V2/API_SendEmail.html
+type sesProvider struct {
+	region    string
+	accessKey string
+	secretKey string
+	endpoint  string
+	client    *http.Client
+}
+
+func newSESProvider(p *EmailProvider) *sesProvider {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf(sesEndpointFormat, p.Addr)
+	}
+	return &sesProvider{
+		region:    p.Addr,
+		accessKey: p.AccessKey,
+		secretKey: p.SecretKey,
+		endpoint:  endpoint,
+		client:    &http.Client{Timeout: mailProviderTimeout},
+	}
+}
+
+func (p *sesProvider) Name() string {
+	return EmailProviderSES + ":" + p.region
+}
+
+func (p *sesProvider) Send(from, to string, message []byte) error {
+	body, err := json.Marshal(map[string]any{
+		"FromEmailAddress": from,
+		"Destination": map[string]any{
+			"ToAddresses": []string{to},
+		},
+		"Content": map[string]any{
+			"Raw": map[string]any{
+				"Data": base64.StdEncoding.EncodeToString(message),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.endpoint+sesSendPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signAWSRequest(req, body, p.accessKey, p.secretKey, p.region, awsSignatureService, time.Now())
+	return doMailProviderRequest(p.client, req)
+}
+
+// mailgunProvider sends emails via the Mailgun API, see https://documentation.mailgun.com/docs/mailgun/api-reference/
+type mailgunProvider struct {
+	domain   string
+	apiKey   string
+	endpoint string
+	client   *http.Client
+}
+
+func newMailgunProvider(p *EmailProvider) *mailgunProvider {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = mailgunUSEndpoint
+	}
+	return &mailgunProvider{
+		domain:   p.Addr,
+		apiKey:   p.APIKey,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: mailProviderTimeout},
+	}
+}
+
+func (p *mailgunProvider) Name() string {
+	return EmailProviderMailgun + ":" + p.domain
+}
+
+func (p *mailgunProvider) Send(_, to string, message []byte) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("to", to); err != nil {
+		return err
+	}
+	part, err := w.CreateFormFile("message", "message.eml")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v3/%s/messages.mime", p.endpoint, p.domain), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.SetBasicAuth("api", p.apiKey)
+	return doMailProviderRequest(p.client, req)
+}
+
+// sendGridProvider sends emails via the SendGrid v3 API, see https://www.twilio.com/docs/sendgrid/api-reference/mail-send/mail-send
+//
+// Since the API does not accept raw messages, the formatted message is parsed, and only the sender name, subject
+// and (plain text) body are passed on.
+type sendGridProvider struct {
+	apiKey   string
+	endpoint string
+	client   *http.Client
+}
+
+func newSendGridProvider(p *EmailProvider) *sendGridProvider {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = sendGridEndpoint
+	}
+	return &sendGridProvider{
+		apiKey:   p.APIKey,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: mailProviderTimeout},
+	}
+}
+
+func (p *sendGridProvider) Name() string {
+	return EmailProviderSendGrid
+}
+
+func (p *sendGridProvider) Send(from, to string, message []byte) error {
+	parsed, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		return err
+	}
+	text, err := io.ReadAll(parsed.Body)
+	if err != nil {
+		return err
+	}
+	sender := map[string]string{"email": from}
+	if addr, err := mail.ParseAddress(parsed.Header.Get("From")); err == nil && addr.Name != "" {
+		sender["name"] = addr.Name
+	}
+	body, err := json.Marshal(map[string]any{
+		"personalizations": []any{
+			map[string]any{"to": []any{map[string]string{"email": to}}},
+		},
+		"from":    sender,
+		"subject": subject,
+		"content": []any{
+			map[string]string{"type": "text/plain", "value": string(text)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.endpoint+sendGridSendPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	return doMailProviderRequest(p.client, req)
+}
+
+func doMailProviderRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, mailProviderErrorMaxBody))
+		return fmt.Errorf("unexpected response %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// signAWSRequest signs the request with AWS Signature Version 4, see
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func signAWSRequest(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.Header.Get("Content-Type"), req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonicalHeaders, signedHeaders, payloadHash}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{awsSignatureAlgo, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", awsSignatureAlgo, accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEmailProvider(t *testing.T) {
+	p, err := ParseEmailProvider("smtp:mail.example.com:587 user=phil pass=secret rate=10/1m")
+	require.Nil(t, err)
+	require.Equal(t, &EmailProvider{Type: EmailProviderSMTP, Addr: "mail.example.com:587", User: "phil", Pass: "secret", RateLimit: 10, RateInterval: time.Minute}, p)
+
+	p, err = ParseEmailProvider("  ses:eu-west-1   access-key=AKIA123 secret-key=abc/def ")
+	require.Nil(t, err)
+	require.Equal(t, &EmailProvider{Type: EmailProviderSES, Addr: "eu-west-1", AccessKey: "AKIA123", SecretKey: "abc/def"}, p)
+
+	p, err = ParseEmailProvider("mailgun:mg.example.com api-key=key-123 region=eu")
+	require.Nil(t, err)
+	require.Equal(t, &EmailProvider{Type: EmailProviderMailgun, Addr: "mg.example.com", APIKey: "key-123", Endpoint: mailgunEUEndpoint}, p)
+
+	p, err = ParseEmailProvider("sendgrid api-key=SG.123 endpoint=http://127.0.0.1:1234/")
+	require.Nil(t, err)
+	require.Equal(t, &EmailProvider{Type: EmailProviderSendGrid, APIKey: "SG.123", Endpoint: "http://127.0.0.1:1234"}, p)
+
+	for _, spec := range []string{
+		"",
+		"postmark api-key=123",
+		"smtp",
+		"smtp:mail.example.com",
+		"smtp:mail.example.com:25 api-key=123",
+		"ses:us-east-1 access-key=123",
+		"mailgun api-key=123",
+		"mailgun:mg.example.com api-key=123 region=asia",
+		"sendgrid",
+		"sendgrid:something api-key=123",
+		"sendgrid api-key=123 endpoint=ftp://example.com",
+		"sendgrid api-key=123 rate=10",
+		"sendgrid api-key=123 rate=0/1s",
+		"sendgrid api-key=123 rate=10/forever",
+	} {
+		_, err := ParseEmailProvider(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestMailProvider_SES(t *testing.T) {
+	var request *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	p := newMailProvider(&EmailProvider{Type: EmailProviderSES, Addr: "us-east-1", AccessKey: "AKIA123", SecretKey: "secret", Endpoint: server.URL})
+	require.Equal(t, "ses:us-east-1", p.Name())
+	require.Nil(t, p.Send("ntfy@example.com", "phil@example.com", []byte("Subject: hi\n\nhello")))
+	require.Equal(t, "/v2/email/outbound-emails", request.URL.Path)
+	require.Regexp(t, `^AWS4-HMAC-SHA256 Credential=AKIA123/\d{8}/us-east-1/ses/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`, request.Header.Get("Authorization"))
+	require.NotEmpty(t, request.Header.Get("X-Amz-Date"))
+
+	var payload struct {
+		FromEmailAddress string
+		Destination      struct{ ToAddresses []string }
+		Content          struct{ Raw struct{ Data string } }
+	}
+	require.Nil(t, json.Unmarshal(body, &payload))
+	require.Equal(t, "ntfy@example.com", payload.FromEmailAddress)
+	require.Equal(t, []string{"phil@example.com"}, payload.Destination.ToAddresses)
+	raw, err := base64.StdEncoding.DecodeString(payload.Content.Raw.Data)
+	require.Nil(t, err)
+	require.Equal(t, "Subject: hi\n\nhello", string(raw))
+}
+
+func TestMailProvider_SignAWSRequest(t *testing.T) {
+	// Signing is deterministic for a given time, and depends on the secret key
+	sign := func(secretKey string) string {
+		req, _ := http.NewRequest(http.MethodPost, "https://email.us-east-1.amazonaws.com/v2/email/outbound-emails", nil)
+		req.Header.Set("Content-Type", "application/json")
+		signAWSRequest(req, []byte("{}"), "AKIA123", secretKey, "us-east-1", "ses", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+		require.Equal(t, "20240102T030405Z", req.Header.Get("X-Amz-Date"))
+		return req.Header.Get("Authorization")
+	}
+	require.Equal(t, sign("secret"), sign("secret"))
+	require.NotEqual(t, sign("secret"), sign("other"))
+	require.Contains(t, sign("secret"), "Credential=AKIA123/20240102/us-east-1/ses/aws4_request")
+}
+
+func TestMailProvider_Mailgun(t *testing.T) {
+	var user, pass, to, message string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v3/mg.example.com/messages.mime", r.URL.Path)
+		user, pass, _ = r.BasicAuth()
+		require.Nil(t, r.ParseMultipartForm(1024*1024))
+		to = r.FormValue("to")
+		f, _, err := r.FormFile("message")
+		require.Nil(t, err)
+		b, _ := io.ReadAll(f)
+		message = string(b)
+	}))
+	defer server.Close()
+
+	p := newMailProvider(&EmailProvider{Type: EmailProviderMailgun, Addr: "mg.example.com", APIKey: "key-123", Endpoint: server.URL})
+	require.Nil(t, p.Send("ntfy@example.com", "phil@example.com", []byte("Subject: hi\n\nhello")))
+	require.Equal(t, "api", user)
+	require.Equal(t, "key-123", pass)
+	require.Equal(t, "phil@example.com", to)
+	require.Equal(t, "Subject: hi\n\nhello", message)
+}
+
+func TestMailProvider_SendGrid(t *testing.T) {
+	var auth string
+	var payload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v3/mail/send", r.URL.Path)
+		auth = r.Header.Get("Authorization")
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	m := newDefaultMessage("alerts", "the disk is full")
+	m.Title = "Disk full 💾"
+	message, err := formatMail(newTranslator("en"), "https://ntfy.sh", "1.2.3.4", "ntfy@example.com", "phil@example.com", m)
+	require.Nil(t, err)
+
+	p := newMailProvider(&EmailProvider{Type: EmailProviderSendGrid, APIKey: "SG.123", Endpoint: server.URL})
+	require.Nil(t, p.Send("ntfy@example.com", "phil@example.com", []byte(message)))
+	require.Equal(t, "Bearer SG.123", auth)
+	require.Equal(t, "Disk full 💾", payload["subject"])
+	require.Equal(t, map[string]any{"email": "ntfy@example.com", "name": "ntfy.sh/alerts"}, payload["from"])
+	require.Equal(t, []any{map[string]any{"to": []any{map[string]any{"email": "phil@example.com"}}}}, payload["personalizations"])
+	content := payload["content"].([]any)[0].(map[string]any)
+	require.Equal(t, "text/plain", content["type"])
+	require.True(t, strings.HasPrefix(content["value"].(string), "the disk is full\n\n--\n"))
+}
+
+func TestMailSender_FailoverAndRateLimit(t *testing.T) {
+	var failing, working atomic.Int32
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failingServer.Close()
+	workingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		working.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer workingServer.Close()
+
+	conf := newTestConfig(t)
+	conf.SMTPSenderFrom = "ntfy@example.com"
+	conf.EmailProviders = []*EmailProvider{
+		{Type: EmailProviderSendGrid, APIKey: "1", Endpoint: failingServer.URL},
+		{Type: EmailProviderSendGrid, APIKey: "2", Endpoint: workingServer.URL, RateLimit: 1, RateInterval: time.Hour},
+	}
+	sender := newMailSender(conf)
+	require.Nil(t, sender.SendTierExpiryWarning("phil@example.com", "phil", "Pro", time.Now(), "en"))
+	require.Equal(t, int32(1), failing.Load())
+	require.Equal(t, int32(1), working.Load())
+
+	// Second provider is rate limited, first still fails
+	err := sender.SendTierExpiryWarning("phil@example.com", "phil", "Pro", time.Now(), "en")
+	require.ErrorContains(t, err, "sendgrid: unexpected response 503 Service Unavailable: service unavailable")
+	require.ErrorContains(t, err, "sendgrid: limit reached")
+	require.Equal(t, int32(2), failing.Load())
+	require.Equal(t, int32(1), working.Load())
+
+	total, success, failure := sender.Counts()
+	require.Equal(t, int64(2), total)
+	require.Equal(t, int64(1), success)
+	require.Equal(t, int64(1), failure)
+}
+
+func TestMailSender_SMTPSenderAddrIsFirstProvider(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.SMTPSenderAddr = "mail.example.com:25"
+	conf.EmailProviders = []*EmailProvider{{Type: EmailProviderSendGrid, APIKey: "1"}}
+	sender := newMailSender(conf)
+	require.Equal(t, 2, len(sender.providers))
+	require.Equal(t, "smtp:mail.example.com:25", sender.providers[0].Name())
+	require.Equal(t, "sendgrid", sender.providers[1].Name())
+	require.Nil(t, sender.providers[0].limiter)
+}
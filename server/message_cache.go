@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
@@ -49,7 +51,8 @@ const (
 			user TEXT NOT NULL,
 			content_type TEXT NOT NULL,
 			encoding TEXT NOT NULL,
-			published INT NOT NULL
+			published INT NOT NULL,
+			metadata TEXT NOT NULL
 		);
 		CREATE INDEX IF NOT EXISTS idx_mid ON messages (mid);
 		CREATE INDEX IF NOT EXISTS idx_time ON messages (time);
@@ -63,75 +66,163 @@ const (
 			value INT
 		);
 		INSERT INTO stats (key, value) VALUES ('messages', 0);
+		CREATE TABLE IF NOT EXISTS ephemeral_topics (
+			topic TEXT PRIMARY KEY,
+			owner TEXT NOT NULL,
+			user TEXT NOT NULL,
+			expires INT NOT NULL,
+			messages INT NOT NULL,
+			messages_limit INT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_ephemeral_topics_expires ON ephemeral_topics (expires);
+		CREATE TABLE IF NOT EXISTS claims (
+			mid TEXT PRIMARY KEY,
+			topic TEXT NOT NULL,
+			claim TEXT NOT NULL,
+			expires INT NOT NULL,
+			deliveries INT NOT NULL,
+			acked INT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_claims_topic ON claims (topic);
+		CREATE INDEX IF NOT EXISTS idx_claims_claim ON claims (claim);
+		CREATE TABLE IF NOT EXISTS escalations (
+			mid TEXT PRIMARY KEY,
+			step INT NOT NULL,
+			next INT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_escalations_next ON escalations (next);
 		COMMIT;
 	`
 	insertMessageQuery = `
-		INSERT INTO messages (mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, attachment_deleted, sender, user, content_type, encoding, published)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO messages (mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, attachment_deleted, sender, user, content_type, encoding, published, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	deleteMessageQuery                = `DELETE FROM messages WHERE mid = ?`
 	updateMessagesForTopicExpiryQuery = `UPDATE messages SET expires = ? WHERE topic = ?`
+	updateMessagesForUserExpiryQuery  = `UPDATE messages SET expires = ? WHERE user = ?`
+	updateMessagesTopicQuery          = `UPDATE messages SET topic = ? WHERE topic = ?`
 	selectRowIDFromMessageID          = `SELECT id FROM messages WHERE mid = ?` // Do not include topic, see #336 and TestServer_PollSinceID_MultipleTopics
 	selectMessagesByIDQuery           = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
 		FROM messages
 		WHERE mid = ?
 	`
 	selectMessagesSinceTimeQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
 		FROM messages
 		WHERE topic = ? AND time >= ? AND published = 1
 		ORDER BY time, id
 	`
 	selectMessagesSinceTimeIncludeScheduledQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
 		FROM messages
 		WHERE topic = ? AND time >= ?
 		ORDER BY time, id
 	`
+	selectMessagesAfterTimeAndIDQuery = `
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
+		FROM messages
+		WHERE topic = ? AND (time > ? OR (time = ? AND mid > ?)) AND published = 1
+		ORDER BY time, id
+	`
+	selectMessagesAfterTimeAndIDIncludeScheduledQuery = `
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
+		FROM messages
+		WHERE topic = ? AND (time > ? OR (time = ? AND mid > ?) OR published = 0)
+		ORDER BY time, id
+	`
 	selectMessagesSinceIDQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
 		FROM messages
 		WHERE topic = ? AND id > ? AND published = 1 
 		ORDER BY time, id
 	`
 	selectMessagesSinceIDIncludeScheduledQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
 		FROM messages
 		WHERE topic = ? AND (id > ? OR published = 0)
 		ORDER BY time, id
 	`
 	selectMessagesLatestQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
 		FROM messages
 		WHERE topic = ? AND published = 1
 		ORDER BY time DESC, id DESC
 		LIMIT 1
 	`
 	selectMessagesDueQuery = `
-		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
 		FROM messages
 		WHERE time <= ? AND published = 0
 		ORDER BY time, id
 	`
-	selectMessagesExpiredQuery      = `SELECT mid FROM messages WHERE expires <= ? AND published = 1`
+	selectMessagesExpiredQuery      = `SELECT mid, topic FROM messages WHERE expires <= ? AND published = 1`
 	updateMessagePublishedQuery     = `UPDATE messages SET published = 1 WHERE mid = ?`
 	selectMessagesCountQuery        = `SELECT COUNT(*) FROM messages`
 	selectMessageCountPerTopicQuery = `SELECT topic, COUNT(*) FROM messages GROUP BY topic`
+	selectMessagesCountBetweenQuery = `SELECT COUNT(*) FROM messages WHERE topic = ? AND time >= ? AND time < ? AND published = 1`
 	selectTopicsQuery               = `SELECT topic FROM messages GROUP BY topic`
 
 	updateAttachmentDeleted            = `UPDATE messages SET attachment_deleted = 1 WHERE mid = ?`
 	selectAttachmentsExpiredQuery      = `SELECT mid FROM messages WHERE attachment_expires > 0 AND attachment_expires <= ? AND attachment_deleted = 0`
+	selectAttachmentsStoredQuery       = `SELECT mid, topic, time, attachment_size, attachment_expires FROM messages WHERE attachment_expires > 0 AND attachment_deleted = 0`
+	selectTopicsLastUsedQuery          = `SELECT topic, MAX(time) FROM messages GROUP BY topic`
 	selectAttachmentsSizeBySenderQuery = `SELECT IFNULL(SUM(attachment_size), 0) FROM messages WHERE user = '' AND sender = ? AND attachment_expires >= ?`
 	selectAttachmentsSizeByUserIDQuery = `SELECT IFNULL(SUM(attachment_size), 0) FROM messages WHERE user = ? AND attachment_expires >= ?`
 
+	insertEphemeralTopicQuery         = `INSERT INTO ephemeral_topics (topic, owner, user, expires, messages, messages_limit) VALUES (?, ?, ?, ?, 0, ?)`
+	selectEphemeralTopicQuery         = `SELECT topic, owner, user, expires, messages, messages_limit FROM ephemeral_topics WHERE topic = ?`
+	selectEphemeralTopicsExpiredQuery = `SELECT topic, owner, user, expires, messages, messages_limit FROM ephemeral_topics WHERE expires <= ?`
+	selectEphemeralTopicsCountQuery   = `SELECT COUNT(*) FROM ephemeral_topics WHERE owner = ?`
+	updateEphemeralTopicMessageQuery  = `
+		UPDATE ephemeral_topics
+		SET
+			messages = messages + 1,
+			expires = CASE WHEN messages_limit > 0 AND messages + 1 >= messages_limit THEN MIN(expires, ?) ELSE expires END
+		WHERE topic = ? AND expires > ? AND (messages_limit = 0 OR messages < messages_limit)
+	`
+	deleteEphemeralTopicQuery = `DELETE FROM ephemeral_topics WHERE topic = ?`
+
+	selectMessageClaimableQuery = `
+		SELECT mid, time, expires, topic, message, title, priority, tags, click, icon, actions, attachment_name, attachment_type, attachment_size, attachment_expires, attachment_url, sender, user, content_type, encoding, metadata
+		FROM messages
+		WHERE topic = ? AND published = 1 AND expires > ? AND mid NOT IN (SELECT mid FROM claims WHERE topic = ? AND (acked = 1 OR expires > ?))
+		ORDER BY time, id
+		LIMIT 1
+	`
+	upsertClaimQuery = `
+		INSERT INTO claims (mid, topic, claim, expires, deliveries, acked) VALUES (?, ?, ?, ?, 1, 0)
+		ON CONFLICT (mid) DO UPDATE SET claim = excluded.claim, expires = excluded.expires, deliveries = deliveries + 1
+	`
+	selectClaimDeliveriesQuery = `SELECT deliveries FROM claims WHERE mid = ?`
+	updateClaimAckedQuery      = `UPDATE claims SET acked = 1 WHERE topic = ? AND claim = ? AND acked = 0`
+	deleteClaimQuery           = `DELETE FROM claims WHERE mid = ?`
+
+	insertEscalationQuery         = `INSERT INTO escalations (mid, step, next) VALUES (?, 0, ?) ON CONFLICT (mid) DO NOTHING`
+	selectEscalationsDueQuery     = `SELECT mid, step FROM escalations WHERE next <= ? ORDER BY next`
+	updateEscalationQuery         = `UPDATE escalations SET step = ?, next = ? WHERE mid = ?`
+	deleteEscalationQuery         = `DELETE FROM escalations WHERE mid = ?`
+	deleteEscalationForTopicQuery = `DELETE FROM escalations WHERE mid = ? AND mid IN (SELECT mid FROM messages WHERE topic = ?)`
+	deleteEscalationForClaimQuery = `DELETE FROM escalations WHERE mid IN (SELECT mid FROM claims WHERE topic = ? AND claim = ?)`
+
+	selectTopicStatsQuery = `
+		SELECT
+			COUNT(*),
+			IFNULL(SUM(CASE WHEN time >= ? THEN 1 ELSE 0 END), 0),
+			IFNULL(MAX(time), 0),
+			IFNULL(SUM(LENGTH(message) + LENGTH(title)), 0),
+			IFNULL(SUM(CASE WHEN attachment_deleted = 0 AND attachment_expires > ? THEN attachment_size ELSE 0 END), 0)
+		FROM messages
+		WHERE topic = ? AND published = 1
+	`
+
 	selectStatsQuery = `SELECT value FROM stats WHERE key = 'messages'`
 	updateStatsQuery = `UPDATE stats SET value = ? WHERE key = 'messages'`
 )
 
 // Schema management queries
 const (
-	currentSchemaVersion          = 13
+	currentSchemaVersion          = 17
 	createSchemaVersionTableQuery = `
 		CREATE TABLE IF NOT EXISTS schemaVersion (
 			id INT PRIMARY KEY,
@@ -260,6 +351,48 @@ const (
 	migrate12To13AlterMessagesTableQuery = `
 		CREATE INDEX IF NOT EXISTS idx_topic ON messages (topic);
 	`
+
+	// 13 -> 14
+	migrate13To14CreateEphemeralTopicsTableQuery = `
+		CREATE TABLE IF NOT EXISTS ephemeral_topics (
+			topic TEXT PRIMARY KEY,
+			owner TEXT NOT NULL,
+			user TEXT NOT NULL,
+			expires INT NOT NULL,
+			messages INT NOT NULL,
+			messages_limit INT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_ephemeral_topics_expires ON ephemeral_topics (expires);
+	`
+
+	// 14 -> 15
+	migrate14To15CreateClaimsTableQuery = `
+		CREATE TABLE IF NOT EXISTS claims (
+			mid TEXT PRIMARY KEY,
+			topic TEXT NOT NULL,
+			claim TEXT NOT NULL,
+			expires INT NOT NULL,
+			deliveries INT NOT NULL,
+			acked INT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_claims_topic ON claims (topic);
+		CREATE INDEX IF NOT EXISTS idx_claims_claim ON claims (claim);
+	`
+
+	// 15 -> 16
+	migrate15To16CreateEscalationsTableQuery = `
+		CREATE TABLE IF NOT EXISTS escalations (
+			mid TEXT PRIMARY KEY,
+			step INT NOT NULL,
+			next INT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_escalations_next ON escalations (next);
+	`
+
+	// 16 -> 17
+	migrate16To17AlterMessagesTableQuery = `
+		ALTER TABLE messages ADD COLUMN metadata TEXT NOT NULL DEFAULT('');
+	`
 )
 
 var (
@@ -277,14 +410,21 @@ var (
 		10: migrateFrom10,
 		11: migrateFrom11,
 		12: migrateFrom12,
+		13: migrateFrom13,
+		14: migrateFrom14,
+		15: migrateFrom15,
+		16: migrateFrom16,
 	}
 )
 
 type messageCache struct {
-	db    *sql.DB
-	queue *util.BatchingQueue[*message]
-	nop   bool
-	mu    sync.Mutex
+	db      *sql.DB
+	queue   *util.BatchingQueue[*message]
+	pending atomic.Int64 // Messages passed to AddMessage that are not yet written, see PendingWrites
+	nop     bool
+	mu      sync.Mutex
+	written map[string]chan struct{} // Message ID -> closed once the message is written, see ExpectMessage
+	wmu     sync.Mutex               // Protects written
 }
 
 // newSqliteCache creates a SQLite file-backed cache
@@ -307,9 +447,10 @@ func newSqliteCache(filename, startupQueries string, cacheDuration time.Duration
 		queue = util.NewBatchingQueue[*message](batchSize, batchTimeout)
 	}
 	cache := &messageCache{
-		db:    db,
-		queue: queue,
-		nop:   nop,
+		db:      db,
+		queue:   queue,
+		nop:     nop,
+		written: make(map[string]chan struct{}),
 	}
 	go cache.processMessageBatches()
 	return cache, nil
@@ -339,16 +480,68 @@ func createMemoryFilename() string {
 // AddMessage stores a message to the message cache synchronously, or queues it to be stored at a later date asyncronously.
 // The message is queued only if "batchSize" or "batchTimeout" are passed to the constructor.
 func (c *messageCache) AddMessage(m *message) error {
+	c.pending.Add(1)
 	if c.queue != nil {
 		c.queue.Enqueue(m)
 		return nil
 	}
+	defer c.pending.Add(-1)
 	return c.addMessages([]*message{m})
 }
 
+// ExpectMessage announces that the message with the given ID will be passed to AddMessage shortly, so that
+// WaitForMessage can wait for it to be written. Messages are sent to subscribers before they are added to the cache
+// (see handlePublishInternal), so this is called before the message is published.
+func (c *messageCache) ExpectMessage(id string) {
+	if c.nop {
+		return
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, ok := c.written[id]; !ok {
+		c.written[id] = make(chan struct{})
+	}
+}
+
+// WaitForMessage waits until an expected message (see ExpectMessage) is written to the database, or until the
+// timeout has passed. It returns immediately if the message is not expected, i.e. if it is already written, or if
+// it will never be written (e.g. "Cache: no" messages).
+func (c *messageCache) WaitForMessage(ctx context.Context, id string, timeout time.Duration) {
+	c.wmu.Lock()
+	written, ok := c.written[id]
+	c.wmu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case <-written:
+	case <-ctx.Done():
+	case <-time.After(timeout):
+	}
+}
+
+// markWritten notifies WaitForMessage that the given messages were written (or failed to be written)
+func (c *messageCache) markWritten(ms []*message) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for _, m := range ms {
+		if written, ok := c.written[m.ID]; ok {
+			close(written)
+			delete(c.written, m.ID)
+		}
+	}
+}
+
+// PendingWrites returns the number of messages that were passed to AddMessage, but are not yet written to the
+// database, either because they are waiting in the batching queue, or because the write is still in progress
+func (c *messageCache) PendingWrites() int64 {
+	return c.pending.Load()
+}
+
 // addMessages synchronously stores a match of messages. If the database is locked, the transaction waits until
 // SQLite's busy_timeout is exceeded before erroring out.
 func (c *messageCache) addMessages(ms []*message) error {
+	defer c.markWritten(ms)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.nop {
@@ -391,6 +584,14 @@ func (c *messageCache) addMessages(ms []*message) error {
 			}
 			actionsStr = string(actionsBytes)
 		}
+		var metadataStr string
+		if len(m.Metadata) > 0 {
+			metadataBytes, err := json.Marshal(m.Metadata)
+			if err != nil {
+				return err
+			}
+			metadataStr = string(metadataBytes)
+		}
 		var sender string
 		if m.Sender.IsValid() {
 			sender = m.Sender.String()
@@ -418,6 +619,7 @@ func (c *messageCache) addMessages(ms []*message) error {
 			m.ContentType,
 			m.Encoding,
 			published,
+			metadataStr,
 		)
 		if err != nil {
 			return err
@@ -463,7 +665,8 @@ func (c *messageCache) messagesSinceID(topic string, since sinceMarker, schedule
 	}
 	defer idrows.Close()
 	if !idrows.Next() {
-		return c.messagesSinceTime(topic, sinceAllMessages, scheduled)
+		// Message is gone: continue after its time if known (resume token, see resumeToken), or from the start
+		return c.messagesAfterTimeAndID(topic, since, scheduled)
 	}
 	var rowID int64
 	if err := idrows.Scan(&rowID); err != nil {
@@ -482,6 +685,25 @@ func (c *messageCache) messagesSinceID(topic string, since sinceMarker, schedule
 	return readMessages(rows)
 }
 
+// messagesAfterTimeAndID returns the messages after the time and ID of the since marker, i.e. the messages that were
+// published after the marker's second, and the messages of the same second with a greater message ID. The message
+// itself does not have to exist anymore, so that a resume token (see resumeToken) still works after its message was
+// deleted, without repeating the messages that the client already received.
+func (c *messageCache) messagesAfterTimeAndID(topic string, since sinceMarker, scheduled bool) ([]*message, error) {
+	var rows *sql.Rows
+	var err error
+	timestamp := since.Time().Unix()
+	if scheduled {
+		rows, err = c.db.Query(selectMessagesAfterTimeAndIDIncludeScheduledQuery, topic, timestamp, timestamp, since.ID())
+	} else {
+		rows, err = c.db.Query(selectMessagesAfterTimeAndIDQuery, topic, timestamp, timestamp, since.ID())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readMessages(rows)
+}
+
 func (c *messageCache) messagesLatest(topic string) ([]*message, error) {
 	rows, err := c.db.Query(selectMessagesLatestQuery, topic)
 	if err != nil {
@@ -498,25 +720,25 @@ func (c *messageCache) MessagesDue() ([]*message, error) {
 	return readMessages(rows)
 }
 
-// MessagesExpired returns a list of IDs for messages that have expires (should be deleted)
-func (c *messageCache) MessagesExpired() ([]string, error) {
+// MessagesExpired returns the IDs and topics of messages that have expired (should be deleted)
+func (c *messageCache) MessagesExpired() ([]*expiredMessage, error) {
 	rows, err := c.db.Query(selectMessagesExpiredQuery, time.Now().Unix())
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	ids := make([]string, 0)
+	expired := make([]*expiredMessage, 0)
 	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
+		m := &expiredMessage{}
+		if err := rows.Scan(&m.ID, &m.Topic); err != nil {
 			return nil, err
 		}
-		ids = append(ids, id)
+		expired = append(expired, m)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return ids, nil
+	return expired, nil
 }
 
 func (c *messageCache) Message(id string) (*message, error) {
@@ -538,6 +760,15 @@ func (c *messageCache) MarkPublished(m *message) error {
 	return err
 }
 
+// MessagesCountBetween returns the number of published messages in the given topic with a time in [start, end)
+func (c *messageCache) MessagesCountBetween(topic string, start, end time.Time) (int, error) {
+	var count int
+	if err := c.db.QueryRow(selectMessagesCountBetweenQuery, topic, start.Unix(), end.Unix()).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func (c *messageCache) MessageCounts() (map[string]int, error) {
 	rows, err := c.db.Query(selectMessageCountPerTopicQuery)
 	if err != nil {
@@ -590,6 +821,12 @@ func (c *messageCache) DeleteMessages(ids ...string) error {
 		if _, err := tx.Exec(deleteMessageQuery, id); err != nil {
 			return err
 		}
+		if _, err := tx.Exec(deleteClaimQuery, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deleteEscalationQuery, id); err != nil {
+			return err
+		}
 	}
 	return tx.Commit()
 }
@@ -610,6 +847,23 @@ func (c *messageCache) ExpireMessages(topics ...string) error {
 	return tx.Commit()
 }
 
+// RenameTopic moves all messages of a topic to a new topic, e.g. when a reserved topic is renamed
+func (c *messageCache) RenameTopic(topic, newTopic string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.db.Exec(updateMessagesTopicQuery, newTopic, topic)
+	return err
+}
+
+// ExpireMessagesByUser marks all messages published by the given user as expired, so that they (and
+// their attachments) are deleted the next time messages are pruned
+func (c *messageCache) ExpireMessagesByUser(userID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.db.Exec(updateMessagesForUserExpiryQuery, time.Now().Unix()-1, userID)
+	return err
+}
+
 func (c *messageCache) AttachmentsExpired() ([]string, error) {
 	rows, err := c.db.Query(selectAttachmentsExpiredQuery, time.Now().Unix())
 	if err != nil {
@@ -630,6 +884,50 @@ func (c *messageCache) AttachmentsExpired() ([]string, error) {
 	return ids, nil
 }
 
+// AttachmentsStored returns all attachments that are hosted by the server (i.e. not external attachments),
+// and that have not been deleted yet, including expired attachments
+func (c *messageCache) AttachmentsStored() ([]*storedAttachment, error) {
+	rows, err := c.db.Query(selectAttachmentsStoredQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := make([]*storedAttachment, 0)
+	for rows.Next() {
+		a := &storedAttachment{}
+		if err := rows.Scan(&a.ID, &a.Topic, &a.Time, &a.Size, &a.Expires); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// TopicsLastUsed returns the time of the most recent message of each topic (Unix time)
+func (c *messageCache) TopicsLastUsed() (map[string]int64, error) {
+	rows, err := c.db.Query(selectTopicsLastUsedQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lastUsed := make(map[string]int64)
+	for rows.Next() {
+		var topic string
+		var last int64
+		if err := rows.Scan(&topic, &last); err != nil {
+			return nil, err
+		}
+		lastUsed[topic] = last
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lastUsed, nil
+}
+
 func (c *messageCache) MarkAttachmentsDeleted(ids ...string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -684,6 +982,7 @@ func (c *messageCache) processMessageBatches() {
 		if err := c.addMessages(messages); err != nil {
 			log.Tag(tagMessageCache).Err(err).Error("Cannot write message batch")
 		}
+		c.pending.Add(-int64(len(messages)))
 	}
 }
 
@@ -706,7 +1005,7 @@ func readMessages(rows *sql.Rows) ([]*message, error) {
 func readMessage(rows *sql.Rows) (*message, error) {
 	var timestamp, expires, attachmentSize, attachmentExpires int64
 	var priority int
-	var id, topic, msg, title, tagsStr, click, icon, actionsStr, attachmentName, attachmentType, attachmentURL, sender, user, contentType, encoding string
+	var id, topic, msg, title, tagsStr, click, icon, actionsStr, attachmentName, attachmentType, attachmentURL, sender, user, contentType, encoding, metadataStr string
 	err := rows.Scan(
 		&id,
 		&timestamp,
@@ -728,6 +1027,7 @@ func readMessage(rows *sql.Rows) (*message, error) {
 		&user,
 		&contentType,
 		&encoding,
+		&metadataStr,
 	)
 	if err != nil {
 		return nil, err
@@ -742,6 +1042,12 @@ func readMessage(rows *sql.Rows) (*message, error) {
 			return nil, err
 		}
 	}
+	var metadata map[string]string
+	if metadataStr != "" {
+		if err := json.Unmarshal([]byte(metadataStr), &metadata); err != nil {
+			return nil, err
+		}
+	}
 	senderIP, err := netip.ParseAddr(sender)
 	if err != nil {
 		senderIP = netip.Addr{} // if no IP stored in database, return invalid address
@@ -774,9 +1080,268 @@ func readMessage(rows *sql.Rows) (*message, error) {
 		User:        user,
 		ContentType: contentType,
 		Encoding:    encoding,
+		Metadata:    metadata,
 	}, nil
 }
 
+// AddEphemeralTopic stores a new ephemeral topic, see ephemeralTopic
+func (c *messageCache) AddEphemeralTopic(t *ephemeralTopic) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.db.Exec(insertEphemeralTopicQuery, t.Topic, t.Owner, t.User, t.Expires, t.MessagesLimit)
+	return err
+}
+
+// EphemeralTopic returns the ephemeral topic with the given name, or errNoRows if the topic is not an
+// ephemeral topic (or has been deleted)
+func (c *messageCache) EphemeralTopic(topic string) (*ephemeralTopic, error) {
+	rows, err := c.db.Query(selectEphemeralTopicQuery, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, errNoRows
+	}
+	return readEphemeralTopic(rows)
+}
+
+// EphemeralTopicsCount returns the number of ephemeral topics created by the given owner
+func (c *messageCache) EphemeralTopicsCount(owner string) (int, error) {
+	rows, err := c.db.Query(selectEphemeralTopicsCountQuery, owner)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, errNoRows
+	}
+	var count int
+	if err := rows.Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// EphemeralTopicsExpired returns all ephemeral topics that have expired, and must be deleted
+func (c *messageCache) EphemeralTopicsExpired() ([]*ephemeralTopic, error) {
+	rows, err := c.db.Query(selectEphemeralTopicsExpiredQuery, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	topics := make([]*ephemeralTopic, 0)
+	for rows.Next() {
+		t, err := readEphemeralTopic(rows)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
+
+// CountEphemeralTopicMessage counts a message towards the message limit of an ephemeral topic. If the limit is
+// reached with this message, the topic expires after closedExpiry at the latest. It returns false if the topic
+// has expired or if the message limit has already been reached, i.e. if the message must not be published.
+func (c *messageCache) CountEphemeralTopicMessage(topic string, closedExpiry time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	result, err := c.db.Exec(updateEphemeralTopicMessageQuery, now.Add(closedExpiry).Unix(), topic, now.Unix())
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated > 0, nil
+}
+
+// DeleteEphemeralTopic removes the ephemeral topic. Its messages are not deleted, see ExpireMessages.
+func (c *messageCache) DeleteEphemeralTopic(topic string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.db.Exec(deleteEphemeralTopicQuery, topic)
+	return err
+}
+
+func readEphemeralTopic(rows *sql.Rows) (*ephemeralTopic, error) {
+	var t ephemeralTopic
+	if err := rows.Scan(&t.Topic, &t.Owner, &t.User, &t.Expires, &t.Messages, &t.MessagesLimit); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ClaimMessage claims the oldest message of the topic that has neither been acknowledged, nor is currently
+// claimed by someone else, until the given time (the visibility timeout). It returns the message and the number
+// of times it has been claimed (including this time), or errMessageNotFound if there is no such message.
+func (c *messageCache) ClaimMessage(topic, claim string, expires time.Time) (*message, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	rows, err := tx.Query(selectMessageClaimableQuery, topic, now, topic, now)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !rows.Next() {
+		rows.Close()
+		return nil, 0, errMessageNotFound
+	}
+	m, err := readMessage(rows)
+	rows.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := tx.Exec(upsertClaimQuery, m.ID, topic, claim, expires.Unix()); err != nil {
+		return nil, 0, err
+	}
+	var deliveries int
+	if err := tx.QueryRow(selectClaimDeliveriesQuery, m.ID).Scan(&deliveries); err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return m, deliveries, nil
+}
+
+// AckMessage acknowledges the message claimed with the given claim, so that it is never claimed again. It returns
+// false if there is no such claim, e.g. because it was already acknowledged, or because the visibility timeout
+// passed and the message was claimed by someone else in the meantime.
+func (c *messageCache) AckMessage(topic, claim string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(updateClaimAckedQuery, topic, claim)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	} else if updated == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec(deleteEscalationForClaimQuery, topic, claim); err != nil {
+		return false, err // Acknowledged messages are not escalated, see Server.escalateMessages
+	}
+	return true, tx.Commit()
+}
+
+// escalation is a pending escalation of a message, see Server.escalateMessages
+type escalation struct {
+	MessageID string
+	Step      int // Index of the next escalation step
+}
+
+// AddEscalation schedules the escalation of the given message, i.e. the first step of the escalation
+// policy of its topic, at the given time
+func (c *messageCache) AddEscalation(messageID string, next time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.db.Exec(insertEscalationQuery, messageID, next.Unix())
+	return err
+}
+
+// EscalationsDue returns all pending escalations that are due at the given time
+func (c *messageCache) EscalationsDue(now time.Time) ([]*escalation, error) {
+	rows, err := c.db.Query(selectEscalationsDueQuery, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	escalations := make([]*escalation, 0)
+	for rows.Next() {
+		var e escalation
+		if err := rows.Scan(&e.MessageID, &e.Step); err != nil {
+			return nil, err
+		}
+		escalations = append(escalations, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return escalations, nil
+}
+
+// UpdateEscalation schedules the given escalation step of the given message at the given time
+func (c *messageCache) UpdateEscalation(messageID string, step int, next time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.db.Exec(updateEscalationQuery, step, next.Unix(), messageID)
+	return err
+}
+
+// DeleteEscalation removes the pending escalation of the given message, if any
+func (c *messageCache) DeleteEscalation(messageID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.db.Exec(deleteEscalationQuery, messageID)
+	return err
+}
+
+// AckEscalation acknowledges the given message of the given topic, so that it is no longer escalated. It returns
+// false if the message has no pending escalation, e.g. because it was already acknowledged.
+func (c *messageCache) AckEscalation(topic, messageID string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, err := c.db.Exec(deleteEscalationForTopicQuery, messageID, topic)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// expiredMessage is a message that has expired, as returned by MessagesExpired
+type expiredMessage struct {
+	ID    string
+	Topic string
+}
+
+// topicStats are statistics about the cached messages of a topic, as returned by TopicStats
+type topicStats struct {
+	Topic           string
+	Messages        int   // Number of cached messages
+	MessagesLastDay int   // Number of cached messages published in the last 24 hours
+	LastMessage     int64 // Unix time of the last cached message, or 0 if there is none
+	CacheBytes      int64 // Size of the cached message bodies and titles
+	AttachmentBytes int64 // Size of the attachments that have not expired
+}
+
+// TopicStats returns statistics about the cached messages of a topic, see topicStats
+func (c *messageCache) TopicStats(topic string) (*topicStats, error) {
+	now := time.Now()
+	rows, err := c.db.Query(selectTopicStatsQuery, now.Add(-24*time.Hour).Unix(), now.Unix(), topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, errNoRows
+	}
+	stats := &topicStats{Topic: topic}
+	if err := rows.Scan(&stats.Messages, &stats.MessagesLastDay, &stats.LastMessage, &stats.CacheBytes, &stats.AttachmentBytes); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
 func (c *messageCache) UpdateStats(messages int64) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -1030,3 +1595,67 @@ func migrateFrom12(db *sql.DB, _ time.Duration) error {
 	}
 	return tx.Commit()
 }
+
+func migrateFrom13(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 13 to 14")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate13To14CreateEphemeralTopicsTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 14); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom14(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 14 to 15")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate14To15CreateClaimsTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 15); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom15(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 15 to 16")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate15To16CreateEscalationsTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 16); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom16(db *sql.DB, _ time.Duration) error {
+	log.Tag(tagMessageCache).Info("Migrating cache database schema: from 16 to 17")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate16To17AlterMessagesTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 17); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/stretchr/testify/assert"
@@ -96,6 +97,27 @@ func TestSqliteCache_MessagesLock(t *testing.T) {
 	testCacheMessagesLock(t, newSqliteTestCache(t))
 }
 
+func TestSqliteCache_MessagesMetadata(t *testing.T) {
+	testCacheMessagesMetadata(t, newSqliteTestCache(t))
+}
+
+func TestMemCache_MessagesMetadata(t *testing.T) {
+	testCacheMessagesMetadata(t, newMemTestCache(t))
+}
+
+func testCacheMessagesMetadata(t *testing.T, c *messageCache) {
+	m := newDefaultMessage("mytopic", "Deployment finished")
+	m.Metadata = map[string]string{"env": "prod", "build-id": "4711"}
+	require.Nil(t, c.AddMessage(m))
+	require.Nil(t, c.AddMessage(newDefaultMessage("mytopic", "no metadata")))
+
+	messages, err := c.Messages("mytopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, map[string]string{"env": "prod", "build-id": "4711"}, messages[0].Metadata)
+	require.Nil(t, messages[1].Metadata)
+}
+
 func TestMemCache_MessagesLock(t *testing.T) {
 	testCacheMessagesLock(t, newMemTestCache(t))
 }
@@ -292,8 +314,11 @@ func testCachePrune(t *testing.T, c *messageCache) {
 	require.Equal(t, 2, counts["mytopic"])
 	require.Equal(t, 1, counts["another_topic"])
 
-	expiredMessageIDs, err := c.MessagesExpired()
+	expiredMessages, err := c.MessagesExpired()
 	require.Nil(t, err)
+	require.Equal(t, 2, len(expiredMessages))
+	require.ElementsMatch(t, []*expiredMessage{{ID: m1.ID, Topic: "mytopic"}, {ID: m3.ID, Topic: "another_topic"}}, expiredMessages)
+	expiredMessageIDs := []string{m1.ID, m3.ID}
 	require.Nil(t, c.DeleteMessages(expiredMessageIDs...))
 
 	counts, err = c.MessageCounts()
@@ -720,6 +745,33 @@ func TestMemCache_NopCache(t *testing.T) {
 	require.Empty(t, topics)
 }
 
+func TestSqliteCache_WaitForMessage(t *testing.T) {
+	c, err := newSqliteCache(newSqliteTestCacheFile(t), "", time.Hour, 0, 300*time.Millisecond, false)
+	require.Nil(t, err)
+
+	// Expected message: waits until the batch is written
+	m := newDefaultMessage("mytopic", "cached")
+	c.ExpectMessage(m.ID)
+	require.Nil(t, c.AddMessage(m))
+	_, err = c.Message(m.ID)
+	require.Equal(t, errMessageNotFound, err) // Still in the batching queue
+	c.WaitForMessage(context.Background(), m.ID, 5*time.Second)
+	_, err = c.Message(m.ID)
+	require.Nil(t, err)
+
+	// Unexpected message (e.g. "Cache: no", or already written): returns immediately
+	start := time.Now()
+	c.WaitForMessage(context.Background(), "notcached", 5*time.Second)
+	c.WaitForMessage(context.Background(), m.ID, 5*time.Second)
+	require.True(t, time.Since(start) < 100*time.Millisecond)
+
+	// Expected message that is never written: waits until the timeout
+	c.ExpectMessage("neverwritten")
+	start = time.Now()
+	c.WaitForMessage(context.Background(), "neverwritten", 200*time.Millisecond)
+	require.True(t, time.Since(start) >= 200*time.Millisecond)
+}
+
 func newSqliteTestCache(t *testing.T) *messageCache {
 	c, err := newSqliteCache(newSqliteTestCacheFile(t), "", time.Hour, 0, 0, false)
 	if err != nil {
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Chunked messages allow publishing messages that are larger than the message size limit without turning them
+// into attachments: the publisher splits the message into chunks of at most message-size-limit bytes, and sends
+// each chunk as a separate publish request with the same chunk ID, as well as the chunk index and count (X-Chunk-ID,
+// X-Chunk-Index, X-Chunk-Count). The server holds incomplete messages in memory, and publishes the reassembled
+// message once the last missing chunk arrives. Chunks can be sent in any order, and are scoped to the topic and
+// the publishing visitor, so that chunk IDs cannot collide across publishers.
+
+const (
+	chunkedMessageTimeout          = time.Minute // Incomplete messages are discarded if no chunk arrives within this time
+	chunkedMessageChunksLimit      = 1000        // Max number of chunks per message
+	chunkedMessagesPerVisitorLimit = 10          // Max number of incomplete chunked messages per visitor
+)
+
+var (
+	chunkIDRegex = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+)
+
+// chunkParams are the chunk parameters of a publish request, see parseChunkParams
+type chunkParams struct {
+	ID    string
+	Index int // 1-based
+	Count int
+}
+
+// parseChunkParams reads the chunk parameters from the request. It returns nil if the request is not a chunk.
+func parseChunkParams(r *http.Request) (*chunkParams, *errHTTP) {
+	id := readParam(r, "x-chunk-id", "chunk-id")
+	indexStr := readParam(r, "x-chunk-index", "chunk-index")
+	countStr := readParam(r, "x-chunk-count", "chunk-count")
+	if id == "" && indexStr == "" && countStr == "" {
+		return nil, nil
+	}
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		return nil, errHTTPBadRequestChunkInvalid
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil {
+		return nil, errHTTPBadRequestChunkInvalid
+	}
+	if !chunkIDRegex.MatchString(id) || count < 1 || count > chunkedMessageChunksLimit || index < 1 || index > count {
+		return nil, errHTTPBadRequestChunkInvalid
+	}
+	return &chunkParams{
+		ID:    id,
+		Index: index,
+		Count: count,
+	}, nil
+}
+
+// chunkedMessage is an incomplete message, waiting for the remaining chunks
+type chunkedMessage struct {
+	owner      string   // User ID or IP address of the publisher
+	chunks     [][]byte // Indexed by chunk index - 1, nil if not yet received
+	received   int
+	size       int
+	lastAccess time.Time
+}
+
+// chunkStore holds incomplete chunked messages in memory, until they are complete or expire
+type chunkStore struct {
+	messages  map[string]*chunkedMessage // <topic>/<owner>/<chunk ID> -> message
+	sizeLimit int
+	mu        sync.Mutex
+}
+
+func newChunkStore(sizeLimit int) *chunkStore {
+	return &chunkStore{
+		messages:  make(map[string]*chunkedMessage),
+		sizeLimit: sizeLimit,
+	}
+}
+
+// Add stores a chunk of the message identified by topic, owner and chunk ID. If the chunk was the last missing
+// one, the message is removed from the store and the reassembled message body is returned. Otherwise, nil is
+// returned. Chunks that are sent twice replace the previous chunk with the same index.
+func (c *chunkStore) Add(topic, owner string, p *chunkParams, chunk []byte) ([]byte, *errHTTP) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := topic + "/" + owner + "/" + p.ID
+	m, ok := c.messages[key]
+	if !ok {
+		if c.countNoLock(owner) >= chunkedMessagesPerVisitorLimit {
+			return nil, errHTTPTooManyRequestsLimitChunkedMessages
+		}
+		m = &chunkedMessage{
+			owner:  owner,
+			chunks: make([][]byte, p.Count),
+		}
+		c.messages[key] = m
+	} else if len(m.chunks) != p.Count {
+		return nil, errHTTPBadRequestChunkInvalid
+	}
+	if previous := m.chunks[p.Index-1]; previous != nil {
+		m.size -= len(previous)
+	} else {
+		m.received++
+	}
+	m.chunks[p.Index-1] = chunk
+	m.size += len(chunk)
+	m.lastAccess = time.Now()
+	if m.size > c.sizeLimit {
+		delete(c.messages, key)
+		return nil, errHTTPEntityTooLargeChunkedMessage
+	} else if m.received < len(m.chunks) {
+		return nil, nil
+	}
+	delete(c.messages, key)
+	body := make([]byte, 0, m.size)
+	for _, b := range m.chunks {
+		body = append(body, b...)
+	}
+	return body, nil
+}
+
+// Prune removes all incomplete messages that have not received a chunk within chunkedMessageTimeout,
+// and returns the number of removed messages
+func (c *chunkStore) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pruned int
+	for key, m := range c.messages {
+		if time.Since(m.lastAccess) > chunkedMessageTimeout {
+			delete(c.messages, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+func (c *chunkStore) countNoLock(owner string) int {
+	var count int
+	for _, m := range c.messages {
+		if m.owner == owner {
+			count++
+		}
+	}
+	return count
+}
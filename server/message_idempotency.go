@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Idempotency keys allow publishers to safely retry a publish request, e.g. after a network error, without
+// publishing the message twice: if a request has an idempotency key (X-Idempotency-Key) that was already used
+// to publish a message, the original message is returned instead of publishing a new one. Keys are remembered
+// for idempotencyKeyDuration, and are scoped to the topic and the publishing visitor, like chunk IDs. If a
+// request with the same key is still in progress, the duplicate waits for it to finish.
+
+const (
+	idempotencyKeyDuration = time.Hour // Keys are forgotten after this time, see Prune
+)
+
+var (
+	idempotencyKeyRegex = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+)
+
+// parseIdempotencyKey reads the idempotency key from the request. It returns an empty string if the request
+// has no idempotency key.
+func parseIdempotencyKey(r *http.Request) (string, *errHTTP) {
+	key := readParam(r, "x-idempotency-key", "idempotency-key")
+	if key == "" {
+		return "", nil
+	} else if !idempotencyKeyRegex.MatchString(key) {
+		return "", errHTTPBadRequestIdempotencyKeyInvalid
+	}
+	return key, nil
+}
+
+// idempotentMessage is the message published with an idempotency key, or a pending publish request
+type idempotentMessage struct {
+	message *message      // Nil while the request is in progress
+	done    chan struct{} // Closed when the request is finished
+	expires time.Time
+}
+
+// idempotencyStore remembers the messages published with an idempotency key in memory
+type idempotencyStore struct {
+	messages map[string]*idempotentMessage // <topic>/<owner>/<key> -> message
+	mu       sync.Mutex
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{
+		messages: make(map[string]*idempotentMessage),
+	}
+}
+
+// Reserve returns the message that was published with the given key, if any. Otherwise, the key is reserved for
+// the caller, nil is returned, and the caller must call Release once the request is finished. If the key is
+// reserved by another request, Reserve waits until that request is finished, or until the context is done.
+func (c *idempotencyStore) Reserve(ctx context.Context, topic, owner, key string) (*message, error) {
+	id := topic + "/" + owner + "/" + key
+	for {
+		c.mu.Lock()
+		m, ok := c.messages[id]
+		if !ok || (m.message != nil && time.Now().After(m.expires)) {
+			c.messages[id] = &idempotentMessage{done: make(chan struct{})}
+			c.mu.Unlock()
+			return nil, nil
+		} else if m.message != nil {
+			c.mu.Unlock()
+			return m.message, nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-m.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Release finishes the request that reserved the given key. If the message was published, it is returned
+// for requests with the same key. Otherwise (if m is nil), the key is released, so that it can be retried.
+func (c *idempotencyStore) Release(topic, owner, key string, m *message) {
+	id := topic + "/" + owner + "/" + key
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending, ok := c.messages[id]
+	if !ok || pending.message != nil {
+		return
+	}
+	if m == nil {
+		delete(c.messages, id)
+	} else {
+		pending.message = m
+		pending.expires = time.Now().Add(idempotencyKeyDuration)
+	}
+	close(pending.done)
+}
+
+// Prune removes all keys that have expired, and returns the number of removed keys
+func (c *idempotencyStore) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pruned int
+	now := time.Now()
+	for id, m := range c.messages {
+		if m.message != nil && now.After(m.expires) {
+			delete(c.messages, id)
+			pruned++
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Message metadata is a small set of custom key/value fields that publishers can attach to a message, so that machine
+// consumers don't have to encode structured data in the message body. Metadata is passed as X-Meta-<key> headers
+// (or meta-<key> query parameters, or the "metadata" field when publishing as JSON), stored in the message cache,
+// delivered as the "metadata" field of the message, and can be used to filter messages when subscribing.
+//
+// Keys are case-insensitive (header names are, too), and are converted to lowercase.
+
+const (
+	metadataMax            = 16
+	metadataValueLengthMax = 256 // Bytes
+	metadataHeaderPrefix   = "x-meta-"
+	metadataParamPrefix    = "meta-"
+)
+
+var (
+	metadataKeyRegex = regexp.MustCompile(`^[-_a-z0-9]{1,32}$`)
+)
+
+// readMetadataParams reads the message metadata from the X-Meta-<key> and Meta-<key> headers and the meta-<key>
+// query parameters. Headers take precedence over query parameters. It returns nil if no metadata is set.
+func readMetadataParams(r *http.Request) (map[string]string, *errHTTP) {
+	var metadata map[string]string
+	set := func(key, value string) *errHTTP {
+		key = strings.ToLower(key)
+		if _, exists := metadata[key]; exists {
+			return nil
+		} else if !metadataKeyRegex.MatchString(key) {
+			return errHTTPBadRequestMetadataInvalid.Wrap("invalid key %q, must match %s", key, metadataKeyRegex.String())
+		} else if len(value) > metadataValueLengthMax || !utf8.ValidString(value) {
+			return errHTTPBadRequestMetadataInvalid.Wrap("value of key %q must be valid UTF-8 and at most %d bytes", key, metadataValueLengthMax)
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[key] = value
+		if len(metadata) > metadataMax {
+			return errHTTPBadRequestMetadataInvalid.Wrap("only %d keys allowed", metadataMax)
+		}
+		return nil
+	}
+	for name, values := range r.Header {
+		key, ok := metadataKey(name, metadataHeaderPrefix, strings.TrimPrefix(metadataHeaderPrefix, "x-"))
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := set(key, strings.TrimSpace(maybeDecodeHeader(name, values[0]))); err != nil {
+			return nil, err
+		}
+	}
+	for name, values := range r.URL.Query() {
+		key, ok := metadataKey(name, metadataParamPrefix)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := set(key, strings.TrimSpace(values[0])); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// metadataKey returns the metadata key of a header or query parameter name, if it starts with one of the prefixes
+func metadataKey(name string, prefixes ...string) (string, bool) {
+	lower := strings.ToLower(name)
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return strings.TrimPrefix(lower, prefix), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"heckel.io/ntfy/v2/util"
+)
+
+// HMAC topics only accept messages that are signed with a shared secret, so that a leaked topic name (or a
+// compromised proxy) is not enough to publish to them. Topics and their secrets are defined by the admin (hmac-topics
+// option, see ParseHMACTopic). A publish request to an HMAC topic must contain a timestamp (X-Timestamp, Unix time in
+// seconds), a random nonce (X-Nonce) and a signature (X-Signature), which is the hex-encoded HMAC-SHA256 of
+// "<timestamp>\n<nonce>\n<topic>\n<params>\n<body>", see messageSignature. The params are the values of the headers
+// (or URL parameters) listed in signedParams, one per line and empty if not set, so that the title, the actions,
+// the recipients, etc. of a signed message cannot be changed either.
+//
+// To prevent captured requests from being replayed, the timestamp must be within the allowed clock skew
+// (hmac-clock-skew option) of the server time, and each nonce can only be used once per topic. Nonces are remembered
+// until their timestamp is outside the allowed clock skew, after which the request would be rejected anyway. If the
+// message is rejected after the signature was verified (e.g. due to rate limiting), the nonce is released again, so
+// that the request can be retried, see releaseMessageSignature.
+//
+// Other headers (e.g. X-Markdown or X-Cache) are not signed. The message must be sent in the body (not via
+// X-Message), and chunked messages, uploads and attachments (other than X-Attach URLs) are not supported.
+//
+// Routed messages (see routeMessage) must be signed for the topic they are routed to, if that is an HMAC topic.
+
+const (
+	signaturePrefix = "sha256=" // Optional prefix of the X-Signature header, e.g. "sha256=<hex>"
+)
+
+var (
+	hmacTopicRegex = regexp.MustCompile(`^(\S+)\s+(\S+)\s*$`)
+	nonceRegex     = regexp.MustCompile(`^[-_A-Za-z0-9]{16,128}$`)
+
+	// signedParams are the headers (and URL parameters) that are part of the signature, in this order. Each entry
+	// lists the same names that are read in parsePublishParams.
+	signedParams = [][]string{
+		{"x-title", "title", "t"},
+		{"x-priority", "priority", "prio", "p"},
+		{"x-tags", "tags", "tag", "ta"},
+		{"x-click", "click"},
+		{"x-icon", "icon"},
+		{"x-actions", "actions", "action"},
+		{"x-attach", "attach", "a"},
+		{"x-email", "x-e-mail", "email", "e-mail", "mail", "e"},
+		{"x-call", "call"},
+		{"x-delay", "delay", "x-at", "at", "x-in", "in"},
+	}
+)
+
+// HMACTopic is a topic that only accepts signed messages, see ParseHMACTopic
+type HMACTopic struct {
+	Topic  string
+	Secret []byte // Shared secret used to sign and verify messages
+}
+
+// ParseHMACTopic parses an entry of the hmac-topics option. Entries have the format "<topic> <secret>", e.g.
+// "deployments 3a7c8f...". The secret should be long and random, e.g. generated with "openssl rand -hex 32".
+func ParseHMACTopic(spec string) (*HMACTopic, error) {
+	m := hmacTopicRegex.FindStringSubmatch(strings.TrimSpace(spec))
+	if m == nil || !topicRegex.MatchString(m[1]) {
+		return nil, fmt.Errorf(`invalid HMAC topic "%s", must be "<topic> <secret>"`, spec)
+	}
+	return &HMACTopic{
+		Topic:  m[1],
+		Secret: []byte(m[2]),
+	}, nil
+}
+
+// messageSignature returns the hex-encoded HMAC-SHA256 signature of a message, see HMACTopic. The params are the
+// values of the signedParams, in the same order.
+func messageSignature(secret []byte, timestamp int64, nonce, topic string, params []string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(fmt.Sprintf("%d\n%s\n%s\n", timestamp, nonce, topic)))
+	for _, param := range params {
+		h.Write([]byte(param + "\n"))
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hmacTopic returns the HMAC topic definition for the given topic ID, or nil if the topic does not require signatures
+func (s *Server) hmacTopic(topicID string) *HMACTopic {
+	for _, t := range s.config.HMACTopics {
+		if t.Topic == topicID {
+			return t
+		}
+	}
+	return nil
+}
+
+// verifyMessageSignature checks the signature, timestamp and nonce of a publish request to an HMAC topic, and marks
+// the nonce as used. The body is nil for chunked messages, and unsigned is true for uploads (and chunked messages,
+// once they are complete). It does nothing if the topic is not an HMAC topic.
+func (s *Server) verifyMessageSignature(r *http.Request, t *topic, body *util.PeekedReadCloser, unsigned bool) *errHTTP {
+	ht := s.hmacTopic(t.ID)
+	if ht == nil {
+		return nil
+	}
+	if body == nil || unsigned || body.LimitReached {
+		return errHTTPBadRequestSignatureInvalid.Wrap("chunked messages, uploads and attachments cannot be signed")
+	} else if readParam(r, "x-message", "message", "m") != "" {
+		return errHTTPBadRequestSignatureInvalid.Wrap("signed messages must be sent in the request body")
+	}
+	timestampStr, nonce := readParam(r, "x-timestamp", "timestamp"), readParam(r, "x-nonce", "nonce")
+	signature := strings.TrimPrefix(strings.ToLower(readParam(r, "x-signature", "signature")), signaturePrefix)
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		return errHTTPBadRequestSignatureInvalid.Wrap("timestamp must be a Unix timestamp in seconds")
+	} else if !nonceRegex.MatchString(nonce) {
+		return errHTTPBadRequestSignatureInvalid.Wrap("nonce must be 16-128 characters (letters, numbers, - and _)")
+	} else if signature == "" {
+		return errHTTPBadRequestSignatureInvalid.Wrap("signature missing")
+	}
+	params := make([]string, len(signedParams))
+	for i, names := range signedParams {
+		params[i] = readParam(r, names...)
+		if strings.Contains(params[i], "\n") {
+			return errHTTPBadRequestSignatureInvalid.Wrap("signed parameters must not contain line breaks")
+		}
+	}
+	expected := messageSignature(ht.Secret, timestamp, nonce, t.ID, params, body.PeekedBytes)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errHTTPForbiddenSignatureMismatch
+	}
+	sent, skew := time.Unix(timestamp, 0), s.config.HMACClockSkew
+	if time.Since(sent) > skew || time.Until(sent) > skew {
+		return errHTTPForbiddenSignatureExpired.Wrap("allowed clock skew is %s", skew.String())
+	}
+	if !s.nonces.Use(t.ID, nonce, sent.Add(skew)) {
+		return errHTTPConflictNonceUsed
+	}
+	return nil
+}
+
+// releaseMessageSignature releases the nonce of a publish request to an HMAC topic that was verified (see
+// verifyMessageSignature), but then rejected, so that the same signed request can be retried. It does nothing if the
+// topic is not an HMAC topic.
+func (s *Server) releaseMessageSignature(r *http.Request, topicID string) {
+	if s.hmacTopic(topicID) == nil {
+		return
+	}
+	s.nonces.Release(topicID, readParam(r, "x-nonce", "nonce"))
+}
+
+// nonceStore remembers the nonces of signed messages in memory, see HMACTopic
+type nonceStore struct {
+	nonces map[string]time.Time // <topic>/<nonce> -> expiry
+	mu     sync.Mutex
+}
+
+func newNonceStore() *nonceStore {
+	return &nonceStore{
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// Use marks the nonce as used until the given time, and returns false if it was already used
+func (c *nonceStore) Use(topic, nonce string, expires time.Time) bool {
+	id := topic + "/" + nonce
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.nonces[id]; ok && time.Now().Before(existing) {
+		return false
+	}
+	c.nonces[id] = expires
+	return true
+}
+
+// Release marks the nonce as unused, so that it can be used again
+func (c *nonceStore) Release(topic, nonce string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.nonces, topic+"/"+nonce)
+}
+
+// Prune removes all nonces that have expired, and returns the number of removed nonces
+func (c *nonceStore) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pruned int
+	now := time.Now()
+	for id, expires := range c.nonces {
+		if now.After(expires) {
+			delete(c.nonces, id)
+			pruned++
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHMACTopic(t *testing.T) {
+	topic, err := ParseHMACTopic("deployments  s3cr3t-s3cr3t ")
+	require.Nil(t, err)
+	require.Equal(t, "deployments", topic.Topic)
+	require.Equal(t, []byte("s3cr3t-s3cr3t"), topic.Secret)
+
+	_, err = ParseHMACTopic("deployments")
+	require.Error(t, err)
+	_, err = ParseHMACTopic("deploy/ments s3cr3t")
+	require.Error(t, err)
+	_, err = ParseHMACTopic("deployments s3cr3t extra")
+	require.Error(t, err)
+}
+
+func TestServer_PublishSigned(t *testing.T) {
+	c := newTestConfig(t)
+	c.HMACTopics = []*HMACTopic{{Topic: "deployments", Secret: []byte("s3cr3t")}}
+	s := newTestServer(t, c)
+
+	signedHeaders := func(timestamp int64, nonce, body string) map[string]string {
+		return map[string]string{
+			"X-Timestamp": fmt.Sprintf("%d", timestamp),
+			"X-Nonce":     nonce,
+			"X-Signature": messageSignature([]byte("s3cr3t"), timestamp, nonce, "deployments", make([]string, len(signedParams)), []byte(body)),
+		}
+	}
+	now := time.Now().Unix()
+
+	// Valid signature
+	response := request(t, s, "POST", "/deployments", "v1.2.3 deployed", signedHeaders(now, "nonce-0000000001", "v1.2.3 deployed"))
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "v1.2.3 deployed", toMessage(t, response.Body.String()).Message)
+
+	// Replayed request
+	response = request(t, s, "POST", "/deployments", "v1.2.3 deployed", signedHeaders(now, "nonce-0000000001", "v1.2.3 deployed"))
+	require.Equal(t, 409, response.Code)
+	require.Equal(t, 40908, toHTTPError(t, response.Body.String()).Code)
+
+	// Tampered body
+	response = request(t, s, "POST", "/deployments", "v6.6.6 deployed", signedHeaders(now, "nonce-0000000002", "v1.2.3 deployed"))
+	require.Equal(t, 403, response.Code)
+	require.Equal(t, 40303, toHTTPError(t, response.Body.String()).Code)
+
+	// Timestamp outside the clock skew, in the past and in the future
+	response = request(t, s, "POST", "/deployments", "old", signedHeaders(now-600, "nonce-0000000003", "old"))
+	require.Equal(t, 40304, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/deployments", "future", signedHeaders(now+600, "nonce-0000000004", "future"))
+	require.Equal(t, 40304, toHTTPError(t, response.Body.String()).Code)
+
+	// Missing or invalid parameters
+	response = request(t, s, "POST", "/deployments", "unsigned", nil)
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40073, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/deployments", "short nonce", signedHeaders(now, "short", "short nonce"))
+	require.Equal(t, 40073, toHTTPError(t, response.Body.String()).Code)
+	headers := signedHeaders(now, "nonce-0000000005", "")
+	headers["X-Message"] = "not signed"
+	response = request(t, s, "POST", "/deployments", "", headers)
+	require.Equal(t, 40073, toHTTPError(t, response.Body.String()).Code)
+
+	// Signature with prefix
+	headers = signedHeaders(now, "nonce-0000000006", "with prefix")
+	headers["X-Signature"] = "sha256=" + headers["X-Signature"]
+	response = request(t, s, "POST", "/deployments", "with prefix", headers)
+	require.Equal(t, 200, response.Code)
+
+	// Signed headers, and tampered headers
+	params := make([]string, len(signedParams))
+	params[0], params[1] = "Deployed", "high"
+	headers = map[string]string{
+		"X-Timestamp": fmt.Sprintf("%d", now),
+		"X-Nonce":     "nonce-0000000007",
+		"X-Signature": messageSignature([]byte("s3cr3t"), now, "nonce-0000000007", "deployments", params, []byte("with title")),
+		"X-Title":     "Deployed",
+		"X-Priority":  "high",
+	}
+	headers["X-Click"] = "https://evil.example.com"
+	response = request(t, s, "POST", "/deployments", "with title", headers)
+	require.Equal(t, 40303, toHTTPError(t, response.Body.String()).Code)
+	delete(headers, "X-Click")
+	headers["X-Title"] = "Rolled back"
+	response = request(t, s, "POST", "/deployments", "with title", headers)
+	require.Equal(t, 40303, toHTTPError(t, response.Body.String()).Code)
+	headers["X-Title"] = "Deployed"
+	response = request(t, s, "POST", "/deployments", "with title", headers)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "Deployed", toMessage(t, response.Body.String()).Title)
+
+	// Other topics are not affected
+	response = request(t, s, "POST", "/mytopic", "unsigned", nil)
+	require.Equal(t, 200, response.Code)
+
+	response = request(t, s, "GET", "/deployments/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, "v1.2.3 deployed", messages[0].Message)
+	require.Equal(t, "with prefix", messages[1].Message)
+	require.Equal(t, "with title", messages[2].Message)
+}
+
+func TestServer_PublishSigned_RetryAfterRateLimit(t *testing.T) {
+	c := newTestConfig(t)
+	c.HMACTopics = []*HMACTopic{{Topic: "deployments", Secret: []byte("s3cr3t")}}
+	c.VisitorMessageDailyLimit = 1
+	s := newTestServer(t, c)
+
+	response := request(t, s, "PUT", "/mytopic", "uses up the message limit", nil)
+	require.Equal(t, 200, response.Code)
+
+	// Rejected after the signature was verified: the nonce is not used up
+	now := time.Now().Unix()
+	headers := map[string]string{
+		"X-Timestamp": fmt.Sprintf("%d", now),
+		"X-Nonce":     "nonce-0000000001",
+		"X-Signature": messageSignature([]byte("s3cr3t"), now, "nonce-0000000001", "deployments", make([]string, len(signedParams)), []byte("v1.2.3 deployed")),
+	}
+	response = request(t, s, "PUT", "/deployments", "v1.2.3 deployed", headers)
+	require.Equal(t, 429, response.Code)
+
+	// Retry succeeds once the limit is reset, and can then not be replayed
+	s.visitor(netip.MustParseAddr("9.9.9.9"), nil).ResetStats()
+	response = request(t, s, "PUT", "/deployments", "v1.2.3 deployed", headers)
+	require.Equal(t, 200, response.Code)
+	s.visitor(netip.MustParseAddr("9.9.9.9"), nil).ResetStats()
+	response = request(t, s, "PUT", "/deployments", "v1.2.3 deployed", headers)
+	require.Equal(t, 409, response.Code)
+	require.Equal(t, 40908, toHTTPError(t, response.Body.String()).Code)
+}
+
+func TestServer_PublishSigned_Routed(t *testing.T) {
+	c := newTestConfig(t)
+	c.HMACTopics = []*HMACTopic{{Topic: "deployments", Secret: []byte("s3cr3t")}}
+	route, err := ParsePublishRoute("inbox deployments match=deployed")
+	require.Nil(t, err)
+	c.PublishRoutes = []*PublishRoute{route}
+	s := newTestServer(t, c)
+
+	// Unsigned messages cannot be routed to an HMAC topic, neither via X-Route nor via publish-routes
+	response := request(t, s, "PUT", "/foo", "unsigned", map[string]string{"X-Route": "deployments"})
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40073, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "PUT", "/inbox", "v6.6.6 deployed", nil)
+	require.Equal(t, 40073, toHTTPError(t, response.Body.String()).Code)
+
+	// Messages signed for the source topic are rejected, too
+	now := time.Now().Unix()
+	response = request(t, s, "PUT", "/foo", "signed for foo", map[string]string{
+		"X-Route":     "deployments",
+		"X-Timestamp": fmt.Sprintf("%d", now),
+		"X-Nonce":     "nonce-0000000001",
+		"X-Signature": messageSignature([]byte("s3cr3t"), now, "nonce-0000000001", "foo", make([]string, len(signedParams)), []byte("signed for foo")),
+	})
+	require.Equal(t, 403, response.Code)
+	require.Equal(t, 40303, toHTTPError(t, response.Body.String()).Code)
+
+	// Messages signed for the target topic are routed
+	response = request(t, s, "PUT", "/inbox", "v1.2.3 deployed", map[string]string{
+		"X-Timestamp": fmt.Sprintf("%d", now),
+		"X-Nonce":     "nonce-0000000002",
+		"X-Signature": messageSignature([]byte("s3cr3t"), now, "nonce-0000000002", "deployments", make([]string, len(signedParams)), []byte("v1.2.3 deployed")),
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "deployments", toMessage(t, response.Body.String()).Topic)
+
+	response = request(t, s, "GET", "/deployments/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "v1.2.3 deployed", messages[0].Message)
+}
+
+func TestNonceStore(t *testing.T) {
+	c := newNonceStore()
+	require.True(t, c.Use("mytopic", "nonce1", time.Now().Add(time.Minute)))
+	require.False(t, c.Use("mytopic", "nonce1", time.Now().Add(time.Minute)))
+	require.True(t, c.Use("othertopic", "nonce1", time.Now().Add(time.Minute)))
+	require.True(t, c.Use("mytopic", "nonce2", time.Now().Add(-time.Second)))
+	c.Release("othertopic", "nonce1")
+	require.True(t, c.Use("othertopic", "nonce1", time.Now().Add(time.Minute)))
+	require.Equal(t, 1, c.Prune())
+	require.Equal(t, 2, len(c.nonces))
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"heckel.io/ntfy/v2/user"
+)
+
+// Option configures a Server created with New, e.g. WithListenHTTP(":8080")
+type Option func(o *serverOptions)
+
+// serverOptions collects the options passed to New. Setters are applied after the base config was
+// chosen, so that the order of WithConfig and the other options does not matter.
+type serverOptions struct {
+	config  *Config
+	setters []func(conf *Config)
+}
+
+// WithConfig uses the given config as a base, instead of the defaults from NewConfig. All other options
+// are applied on top of it.
+func WithConfig(conf *Config) Option {
+	return func(o *serverOptions) {
+		o.config = conf
+	}
+}
+
+// WithListenHTTP sets the HTTP listen address, e.g. ":8080", or "127.0.0.1:0" for a random port (see
+// Server.Addr). If empty, the server does not listen on HTTP.
+func WithListenHTTP(addr string) Option {
+	return withSetter(func(conf *Config) {
+		conf.ListenHTTP = addr
+	})
+}
+
+// WithBaseURL sets the public facing base URL of the server, e.g. "https://ntfy.example.com"
+func WithBaseURL(baseURL string) Option {
+	return withSetter(func(conf *Config) {
+		conf.BaseURL = baseURL
+	})
+}
+
+// WithCacheFile sets the message cache database. If not set, messages are only cached in memory.
+func WithCacheFile(filename string) Option {
+	return withSetter(func(conf *Config) {
+		conf.CacheFile = filename
+	})
+}
+
+// WithAttachmentCacheDir sets the directory for attachments, which enables attachments
+func WithAttachmentCacheDir(dir string) Option {
+	return withSetter(func(conf *Config) {
+		conf.AttachmentCacheDir = dir
+	})
+}
+
+// WithAuthFile sets the user database and the default access permissions, which enables access control
+func WithAuthFile(filename string, defaultAccess user.Permission) Option {
+	return withSetter(func(conf *Config) {
+		conf.AuthFile = filename
+		conf.AuthDefault = defaultAccess
+	})
+}
+
+// WithVersion sets the version reported by the server, e.g. in the logs and the web app
+func WithVersion(version string) Option {
+	return withSetter(func(conf *Config) {
+		conf.Version = version
+	})
+}
+
+func withSetter(fn func(conf *Config)) Option {
+	return func(o *serverOptions) {
+		o.setters = append(o.setters, fn)
+	}
+}
@@ -0,0 +1,101 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/server"
+	"heckel.io/ntfy/v2/user"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServer_Embedded_StartPublishStop(t *testing.T) {
+	s, err := server.New(
+		server.WithListenHTTP("127.0.0.1:0"),
+		server.WithCacheFile(filepath.Join(t.TempDir(), "cache.db")),
+		server.WithAttachmentCacheDir(t.TempDir()),
+		server.WithBaseURL("http://127.0.0.1"),
+	)
+	require.Nil(t, err)
+	require.Nil(t, s.Start())
+	defer s.Stop()
+	require.NotNil(t, s.Addr())
+
+	m, err := s.Publish("mytopic", strings.NewReader("hi there"), map[string]string{"Title": "embedded", "Tags": "a,b"})
+	require.Nil(t, err)
+	require.NotEmpty(t, m.ID)
+	require.Equal(t, "mytopic", m.Topic)
+	require.Equal(t, "hi there", m.Message)
+	require.Equal(t, "embedded", m.Title)
+	require.Equal(t, []string{"a", "b"}, m.Tags)
+
+	m, err = s.Publish("mytopic", strings.NewReader("some file"), map[string]string{"Filename": "file.txt"})
+	require.Nil(t, err)
+	require.NotNil(t, m.Attachment)
+	require.Equal(t, "file.txt", m.Attachment.Name)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/mytopic/json?poll=1", s.Addr().String()))
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Equal(t, 2, len(lines))
+	var polled server.Message
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &polled))
+	require.Equal(t, "hi there", polled.Message)
+}
+
+func TestServer_Embedded_PublishErrors(t *testing.T) {
+	s, err := server.New(
+		server.WithListenHTTP(""),
+		server.WithAuthFile(filepath.Join(t.TempDir(), "user.db"), user.PermissionDenyAll),
+	)
+	require.Nil(t, err)
+	require.Nil(t, s.Start())
+	defer s.Stop()
+	require.Nil(t, s.Addr())
+
+	_, err = s.Publish("mytopic", nil, nil)
+	require.Error(t, err)
+	require.Equal(t, "forbidden", err.Error())
+	_, err = s.Publish("invalid topic!", nil, nil)
+	require.Error(t, err)
+}
+
+func TestServer_Embedded_ServeHTTP(t *testing.T) {
+	conf := server.NewConfig()
+	conf.CacheFile = filepath.Join(t.TempDir(), "cache.db")
+	s, err := server.New(server.WithConfig(conf), server.WithListenHTTP(""))
+	require.Nil(t, err)
+	require.Equal(t, "", conf.ListenHTTP) // Options are applied to the passed config
+	require.Nil(t, s.Start())
+	defer s.Stop()
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	resp, err := http.Post(ts.URL+"/mytopic", "text/plain", strings.NewReader("via handler"))
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+
+	m, err := s.Publish("mytopic", strings.NewReader("in-process"), nil)
+	require.Nil(t, err)
+	require.Equal(t, "in-process", m.Message)
+}
+
+func TestServer_Embedded_StartAddressInUse(t *testing.T) {
+	s1, err := server.New(server.WithListenHTTP("127.0.0.1:0"))
+	require.Nil(t, err)
+	require.Nil(t, s1.Start())
+	defer s1.Stop()
+
+	s2, err := server.New(server.WithListenHTTP(s1.Addr().String()))
+	require.Nil(t, err)
+	require.Error(t, s2.Start())
+}
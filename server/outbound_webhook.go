@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"heckel.io/ntfy/v2/util"
+	"heckel.io/ntfy/v2/util/sprig"
+)
+
+// Outbound webhooks forward the messages of a topic to other services via HTTP POST, e.g. to a Slack channel, a
+// Microsoft Teams channel or PagerDuty. Webhooks are defined by the admin (outbound-webhooks option, see
+// ParseOutboundWebhook). Without a template, the message is sent as JSON, in the same format as on the JSON stream.
+// With a payload template (template=<name>), the request body is rendered from a Go template instead, so that ntfy
+// can speak the native format of each downstream service. Templates are YAML files in the webhooks folder of the
+// template directory (template-dir option, e.g. /etc/ntfy/templates/webhooks/slack.yml), see webhookTemplate.
+// Built-in templates for Slack, Microsoft Teams and PagerDuty are embedded, and can be overridden the same way.
+//
+// Messages are forwarded just like they are forwarded to Firebase or Web Push, i.e. not for silenced topics, and
+// delayed messages only once they are delivered. Delivery is best effort: failed requests are logged, not retried.
+
+const (
+	webhookTemplatesDir        = "webhooks"
+	webhookTemplateContentType = "application/json"
+	webhookTimeout             = 10 * time.Second
+	webhookVarPrefix           = "var." // Prefix of template variables in outbound-webhooks entries, e.g. var.routing_key=...
+)
+
+var (
+	outboundWebhookRegex = regexp.MustCompile(`^(\S+)\s+(https?://\S+)((?:\s+[a-z][-_.a-z0-9]*=\S+)*)\s*$`)
+)
+
+// OutboundWebhook forwards the messages of a topic to a URL, see ParseOutboundWebhook
+type OutboundWebhook struct {
+	Topic    string
+	URL      string            // URL the messages are POSTed to
+	Template string            // Name of the payload template, empty to send the message as JSON
+	Vars     map[string]string // Variables passed to the template, e.g. a PagerDuty routing key
+}
+
+// ParseOutboundWebhook parses an entry of the outbound-webhooks option. Entries have the format
+// "<topic> <url> [template=<name>] [var.<key>=<value> ...]", e.g. "alerts https://hooks.slack.com/... template=slack".
+// Variables are available in the template as {{.vars.<key>}}.
+func ParseOutboundWebhook(spec string) (*OutboundWebhook, error) {
+	m := outboundWebhookRegex.FindStringSubmatch(strings.TrimSpace(spec))
+	if m == nil || !topicRegex.MatchString(m[1]) {
+		return nil, fmt.Errorf(`invalid outbound webhook "%s", must be "<topic> <url> [template=<name>] [var.<key>=<value> ...]"`, spec)
+	}
+	webhook := &OutboundWebhook{
+		Topic: m[1],
+		URL:   m[2],
+		Vars:  make(map[string]string),
+	}
+	for _, option := range strings.Fields(m[3]) {
+		key, value, _ := strings.Cut(option, "=")
+		if key == "template" && templateNameRegex.MatchString(value) {
+			webhook.Template = value
+		} else if strings.HasPrefix(key, webhookVarPrefix) && len(key) > len(webhookVarPrefix) {
+			webhook.Vars[strings.TrimPrefix(key, webhookVarPrefix)] = value
+		} else {
+			return nil, fmt.Errorf(`invalid outbound webhook "%s", invalid option "%s"`, spec, option)
+		}
+	}
+	return webhook, nil
+}
+
+// webhookTemplate is a payload template file, see OutboundWebhook. The body is a Go template (with the same functions
+// as message templates), which is executed with the message fields as data, e.g. {{.title}} or {{.priority}}.
+type webhookTemplate struct {
+	ContentType string `yaml:"content_type"` // Content-Type header of the request, application/json if empty
+	Body        string `yaml:"body"`
+	tpl         *template.Template
+}
+
+// loadWebhookTemplates loads and parses the payload templates of all outbound webhooks, so that invalid templates
+// are detected when the server starts, rather than when the first message is forwarded
+func loadWebhookTemplates(conf *Config) (map[string]*webhookTemplate, error) {
+	templates := make(map[string]*webhookTemplate)
+	for _, webhook := range conf.OutboundWebhooks {
+		if webhook.Template == "" || templates[webhook.Template] != nil {
+			continue
+		}
+		t, err := loadWebhookTemplate(conf.TemplateDir, webhook.Template)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load webhook template %s: %w", webhook.Template, err)
+		}
+		templates[webhook.Template] = t
+	}
+	return templates, nil
+}
+
+// loadWebhookTemplate reads a payload template from the template directory, or from the embedded templates
+func loadWebhookTemplate(templateDir, name string) (*webhookTemplate, error) {
+	filename := filepath.Join(webhookTemplatesDir, name+templateFileExtension)
+	content, _ := templatesFs.ReadFile(filepath.Join(templatesDir, filename)) // Read from the embedded filesystem first
+	if templateDir != "" {
+		if b, _ := os.ReadFile(filepath.Join(templateDir, filename)); len(b) > 0 {
+			content = b
+		}
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("template file %s not found", filename)
+	}
+	var t webhookTemplate
+	if err := yaml.Unmarshal(content, &t); err != nil {
+		return nil, err
+	} else if strings.TrimSpace(t.Body) == "" {
+		return nil, fmt.Errorf("template file %s has no body", filename)
+	}
+	tpl, err := template.New(name).Funcs(sprig.TxtFuncMap()).Option("missingkey=zero").Parse(t.Body)
+	if err != nil {
+		return nil, err
+	}
+	if t.ContentType == "" {
+		t.ContentType = webhookTemplateContentType
+	}
+	t.tpl = tpl
+	return &t, nil
+}
+
+// sendOutboundWebhooks forwards the message to all outbound webhooks of its topic, see OutboundWebhook
+func (s *Server) sendOutboundWebhooks(v *visitor, m *message) {
+	for _, webhook := range s.config.OutboundWebhooks {
+		if webhook.Topic != m.Topic {
+			continue
+		}
+		ev := logvm(v, m).Tag(tagWebhook).Field("webhook_host", webhookHost(webhook.URL)) // The full URL often contains a secret
+		if err := s.sendOutboundWebhook(webhook, m); err != nil {
+			ev.Err(err).Warn("Unable to forward message to outbound webhook")
+			minc(metricOutboundWebhooksFailure)
+			continue
+		}
+		ev.Debug("Forwarded message to outbound webhook")
+		minc(metricOutboundWebhooksSuccess)
+	}
+}
+
+func (s *Server) sendOutboundWebhook(webhook *OutboundWebhook, m *message) error {
+	body, contentType, err := s.renderWebhookPayload(webhook, m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "ntfy/"+s.config.Version)
+	req.Header.Set("Content-Type", contentType)
+	httpClient := &http.Client{
+		Timeout: webhookTimeout,
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("server responded with HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+// renderWebhookPayload returns the request body and content type for the message, see OutboundWebhook
+func (s *Server) renderWebhookPayload(webhook *OutboundWebhook, m *message) ([]byte, string, error) {
+	if webhook.Template == "" {
+		body, err := json.Marshal(m)
+		return body, webhookTemplateContentType, err
+	}
+	t, ok := s.webhookTemplates[webhook.Template]
+	if !ok {
+		return nil, "", fmt.Errorf("webhook template %s not loaded", webhook.Template)
+	}
+	var buf bytes.Buffer
+	limitWriter := util.NewLimitWriter(util.NewTimeoutWriter(&buf, templateMaxExecutionTime), util.NewFixedLimiter(templateMaxOutputBytes))
+	if err := t.tpl.Execute(limitWriter, s.webhookTemplateData(webhook, m)); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), t.ContentType, nil
+}
+
+// webhookHost returns the host of a webhook URL, e.g. for logging
+func webhookHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// webhookTemplateData returns the data for payload templates. Unlike the JSON representation of the message, all
+// fields are always set (e.g. an empty title, or priority 3 for the default priority), so that templates don't have
+// to check for missing fields.
+func (s *Server) webhookTemplateData(webhook *OutboundWebhook, m *message) map[string]any {
+	priority := m.Priority
+	if priority == 0 {
+		priority = 3
+	}
+	tags := m.Tags
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	return map[string]any{
+		"id":         m.ID,
+		"time":       m.Time,
+		"topic":      m.Topic,
+		"topic_url":  fmt.Sprintf("%s/%s", s.config.BaseURL, m.Topic),
+		"title":      m.Title,
+		"message":    m.Message,
+		"priority":   priority,
+		"tags":       tags,
+		"click":      m.Click,
+		"icon":       m.Icon,
+		"attachment": m.Attachment,
+		"metadata":   m.Metadata,
+		"vars":       webhook.Vars,
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutboundWebhook(t *testing.T) {
+	webhook, err := ParseOutboundWebhook("alerts  https://events.pagerduty.com/v2/enqueue template=pagerduty var.routing_key=abc123 ")
+	require.Nil(t, err)
+	require.Equal(t, "alerts", webhook.Topic)
+	require.Equal(t, "https://events.pagerduty.com/v2/enqueue", webhook.URL)
+	require.Equal(t, "pagerduty", webhook.Template)
+	require.Equal(t, map[string]string{"routing_key": "abc123"}, webhook.Vars)
+
+	webhook, err = ParseOutboundWebhook("alerts https://example.com/hook")
+	require.Nil(t, err)
+	require.Equal(t, "", webhook.Template)
+
+	_, err = ParseOutboundWebhook("alerts")
+	require.Error(t, err)
+	_, err = ParseOutboundWebhook("alerts ftp://example.com")
+	require.Error(t, err)
+	_, err = ParseOutboundWebhook("alerts https://example.com/hook template=../secret")
+	require.Error(t, err)
+	_, err = ParseOutboundWebhook("alerts https://example.com/hook unknown=1")
+	require.Error(t, err)
+}
+
+func TestServer_OutboundWebhook_Templates(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer downstream.Close()
+
+	c := newTestConfig(t)
+	for _, spec := range []string{
+		"alerts " + downstream.URL + "/raw",
+		"alerts " + downstream.URL + "/slack template=slack",
+		"alerts " + downstream.URL + "/teams template=teams",
+		"alerts " + downstream.URL + "/pagerduty template=pagerduty var.routing_key=abc123",
+	} {
+		webhook, err := ParseOutboundWebhook(spec)
+		require.Nil(t, err)
+		c.OutboundWebhooks = append(c.OutboundWebhooks, webhook)
+	}
+	s := newTestServer(t, c)
+
+	response := request(t, s, "PUT", "/alerts", "Disk full on db1", map[string]string{"Title": "Disk alert", "Priority": "urgent", "Tags": "warning"})
+	require.Equal(t, 200, response.Code)
+	request(t, s, "PUT", "/other", "not forwarded", nil)
+
+	payloads := make(map[string]map[string]any)
+	for range 4 {
+		select {
+		case r := <-requests:
+			var payload map[string]any
+			require.Nil(t, json.Unmarshal(<-bodies, &payload))
+			require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			payloads[r.URL.Path] = payload
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook not called")
+		}
+	}
+	require.Equal(t, "Disk full on db1", payloads["/raw"]["message"])
+	require.Equal(t, "Disk alert: Disk full on db1", payloads["/slack"]["text"])
+	require.Equal(t, "message", payloads["/teams"]["type"])
+	require.Equal(t, "abc123", payloads["/pagerduty"]["routing_key"])
+	require.Equal(t, "critical", payloads["/pagerduty"]["payload"].(map[string]any)["severity"])
+	require.Equal(t, "Disk alert", payloads["/pagerduty"]["payload"].(map[string]any)["summary"])
+
+	select {
+	case r := <-requests:
+		t.Fatalf("unexpected webhook call: %s", r.URL.Path)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestServer_OutboundWebhook_CustomTemplate(t *testing.T) {
+	bodies := make(chan string, 1)
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- r.Header.Get("Content-Type") + " " + string(body)
+	}))
+	defer downstream.Close()
+
+	c := newTestConfig(t)
+	require.Nil(t, os.MkdirAll(filepath.Join(c.TemplateDir, "webhooks"), 0700))
+	require.Nil(t, os.WriteFile(filepath.Join(c.TemplateDir, "webhooks", "plain.yml"), []byte(`
+content_type: text/plain
+body: "{{ .topic }}/{{ .priority }}: {{ .title }}{{ .message }}"
+`), 0600))
+	webhook, err := ParseOutboundWebhook("mytopic " + downstream.URL + " template=plain")
+	require.Nil(t, err)
+	c.OutboundWebhooks = []*OutboundWebhook{webhook}
+	s := newTestServer(t, c)
+
+	request(t, s, "PUT", "/mytopic", "hi there", nil)
+	select {
+	case body := <-bodies:
+		require.Equal(t, "text/plain mytopic/3: hi there", body) // Missing title is empty, default priority is 3
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+func TestServer_OutboundWebhook_InvalidTemplate(t *testing.T) {
+	c := newTestConfig(t)
+	c.OutboundWebhooks = []*OutboundWebhook{{Topic: "mytopic", URL: "https://example.com", Template: "doesnotexist"}}
+	_, err := New(WithConfig(c))
+	require.ErrorContains(t, err, "cannot load webhook template doesnotexist")
+
+	require.Nil(t, os.MkdirAll(filepath.Join(c.TemplateDir, "webhooks"), 0700))
+	require.Nil(t, os.WriteFile(filepath.Join(c.TemplateDir, "webhooks", "broken.yml"), []byte(`body: "{{ .message "`), 0600))
+	c.OutboundWebhooks = []*OutboundWebhook{{Topic: "mytopic", URL: "https://example.com", Template: "broken"}}
+	_, err = New(WithConfig(c))
+	require.ErrorContains(t, err, "cannot load webhook template broken")
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Protobuf encoding of messages, for bandwidth-constrained subscribers and publishers (e.g. IoT devices),
+// negotiated via "Accept: application/x-protobuf" (subscribe) and "Content-Type: application/x-protobuf"
+// (publish). Messages are encoded by hand using the protobuf wire format, so no generated code is needed.
+// The schema is documented in docs/subscribe/api.md and mirrors the JSON format:
+//
+//	message Message {
+//	  string id = 1; int64 time = 2; int64 expires = 3; string event = 4; string topic = 5;
+//	  string title = 6; string message = 7; int32 priority = 8; repeated string tags = 9;
+//	  string click = 10; string icon = 11; repeated Action actions = 12; Attachment attachment = 13;
+//	  string poll_id = 14; string content_type = 15; string encoding = 16; int32 subscribers = 17;
+//	}
+//	message Attachment { string name = 1; string type = 2; int64 size = 3; int64 expires = 4; string url = 5; }
+//	message Action {
+//	  string id = 1; string action = 2; string label = 3; bool clear = 4; string url = 5; string method = 6;
+//	  map<string, string> headers = 7; string body = 8; string intent = 9; map<string, string> extras = 10;
+//	}
+//	message PublishMessage {
+//	  string topic = 1; string title = 2; string message = 3; int32 priority = 4; repeated string tags = 5;
+//	  string click = 6; string icon = 7; repeated Action actions = 8; string attach = 9; bool markdown = 10;
+//	  string filename = 11; string email = 12; string call = 13; string cache = 14; string firebase = 15;
+//	  string delay = 16;
+//	}
+//
+// In the subscribe stream, each message is prefixed with its length as a varint (length-delimited stream).
+
+const (
+	protobufContentType = "application/x-protobuf"
+)
+
+var (
+	errProtobufInvalid = errors.New("invalid protobuf message")
+)
+
+// isProtobufContentType returns true if the given content type is the protobuf media type
+func isProtobufContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == protobufContentType || mediaType == "application/protobuf"
+}
+
+// acceptsProtobuf returns true if the client asked for protobuf-encoded messages via the Accept header
+func acceptsProtobuf(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if isProtobufContentType(strings.TrimSpace(accept)) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeProtobufMessage encodes the message in the protobuf wire format, prefixed with its length as a varint
+func encodeProtobufMessage(m *message) []byte {
+	b := appendProtobufString(nil, 1, m.ID)
+	b = appendProtobufInt(b, 2, m.Time)
+	b = appendProtobufInt(b, 3, m.Expires)
+	b = appendProtobufString(b, 4, m.Event)
+	b = appendProtobufString(b, 5, m.Topic)
+	b = appendProtobufString(b, 6, m.Title)
+	b = appendProtobufString(b, 7, m.Message)
+	b = appendProtobufInt(b, 8, int64(m.Priority))
+	for _, tag := range m.Tags {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendString(b, tag)
+	}
+	b = appendProtobufString(b, 10, m.Click)
+	b = appendProtobufString(b, 11, m.Icon)
+	for _, a := range m.Actions {
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeProtobufAction(a))
+	}
+	if m.Attachment != nil {
+		b = protowire.AppendTag(b, 13, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeProtobufAttachment(m.Attachment))
+	}
+	b = appendProtobufString(b, 14, m.PollID)
+	b = appendProtobufString(b, 15, m.ContentType)
+	b = appendProtobufString(b, 16, m.Encoding)
+	b = appendProtobufInt(b, 17, int64(m.Subscribers))
+	return protowire.AppendBytes(nil, b)
+}
+
+func encodeProtobufAttachment(a *attachment) []byte {
+	b := appendProtobufString(nil, 1, a.Name)
+	b = appendProtobufString(b, 2, a.Type)
+	b = appendProtobufInt(b, 3, a.Size)
+	b = appendProtobufInt(b, 4, a.Expires)
+	return appendProtobufString(b, 5, a.URL)
+}
+
+func encodeProtobufAction(a *action) []byte {
+	b := appendProtobufString(nil, 1, a.ID)
+	b = appendProtobufString(b, 2, a.Action)
+	b = appendProtobufString(b, 3, a.Label)
+	if a.Clear {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	b = appendProtobufString(b, 5, a.URL)
+	b = appendProtobufString(b, 6, a.Method)
+	b = appendProtobufMap(b, 7, a.Headers)
+	b = appendProtobufString(b, 8, a.Body)
+	b = appendProtobufString(b, 9, a.Intent)
+	return appendProtobufMap(b, 10, a.Extras)
+}
+
+func appendProtobufString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendProtobufInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendProtobufMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // Deterministic output
+	for _, k := range keys {
+		entry := appendProtobufString(nil, 1, k)
+		entry = appendProtobufString(entry, 2, m[k])
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// readProtobufPublishMessage reads a protobuf-encoded PublishMessage (see schema above) from the request body.
+// Unknown fields are ignored, so that older servers accept messages from newer clients.
+func readProtobufPublishMessage(r io.ReadCloser, limit int) (*publishMessage, error) {
+	defer r.Close()
+	p, err := util.Peek(r, limit)
+	if err != nil {
+		return nil, err
+	} else if p.LimitReached {
+		return nil, errHTTPEntityTooLargeProtobufBody
+	}
+	m := &publishMessage{}
+	err = consumeProtobufFields(p.PeekedBytes, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			m.Topic = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			m.Title = string(v)
+		case num == 3 && typ == protowire.BytesType:
+			m.Message = string(v)
+		case num == 4 && typ == protowire.VarintType:
+			m.Priority = int(int32(n))
+		case num == 5 && typ == protowire.BytesType:
+			m.Tags = append(m.Tags, string(v))
+		case num == 6 && typ == protowire.BytesType:
+			m.Click = string(v)
+		case num == 7 && typ == protowire.BytesType:
+			m.Icon = string(v)
+		case num == 8 && typ == protowire.BytesType:
+			a, err := decodeProtobufAction(v)
+			if err != nil {
+				return err
+			}
+			m.Actions = append(m.Actions, *a)
+		case num == 9 && typ == protowire.BytesType:
+			m.Attach = string(v)
+		case num == 10 && typ == protowire.VarintType:
+			m.Markdown = n != 0
+		case num == 11 && typ == protowire.BytesType:
+			m.Filename = string(v)
+		case num == 12 && typ == protowire.BytesType:
+			m.Email = string(v)
+		case num == 13 && typ == protowire.BytesType:
+			m.Call = string(v)
+		case num == 14 && typ == protowire.BytesType:
+			m.Cache = string(v)
+		case num == 15 && typ == protowire.BytesType:
+			m.Firebase = string(v)
+		case num == 16 && typ == protowire.BytesType:
+			m.Delay = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errHTTPBadRequestProtobufInvalid
+	}
+	return m, nil
+}
+
+func decodeProtobufAction(b []byte) (*action, error) {
+	a := newAction()
+	err := consumeProtobufFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			a.ID = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			a.Action = string(v)
+		case num == 3 && typ == protowire.BytesType:
+			a.Label = string(v)
+		case num == 4 && typ == protowire.VarintType:
+			a.Clear = n != 0
+		case num == 5 && typ == protowire.BytesType:
+			a.URL = string(v)
+		case num == 6 && typ == protowire.BytesType:
+			a.Method = string(v)
+		case num == 7 && typ == protowire.BytesType:
+			return decodeProtobufMapEntry(v, a.Headers)
+		case num == 8 && typ == protowire.BytesType:
+			a.Body = string(v)
+		case num == 9 && typ == protowire.BytesType:
+			a.Intent = string(v)
+		case num == 10 && typ == protowire.BytesType:
+			return decodeProtobufMapEntry(v, a.Extras)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func decodeProtobufMapEntry(b []byte, m map[string]string) error {
+	var key, value string
+	err := consumeProtobufFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num == 1 && typ == protowire.BytesType {
+			key = string(v)
+		} else if num == 2 && typ == protowire.BytesType {
+			value = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m[key] = value
+	return nil
+}
+
+// consumeProtobufFields parses all fields in b, and calls fn for each of them. For length-delimited fields,
+// v is the field value; for varint fields, n is the field value. Other field types are skipped.
+func consumeProtobufFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errProtobufInvalid
+		}
+		b = b[n:]
+		var v []byte
+		var varint uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errProtobufInvalid
+		}
+		b = b[n:]
+		if typ == protowire.BytesType || typ == protowire.VarintType {
+			if err := fn(num, typ, v, varint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestServer_PublishAndPollProtobuf(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	// Publish to root path, topic is part of the message
+	action := appendProtobufString(nil, 2, "view")
+	action = appendProtobufString(action, 3, "Open door")
+	action = appendProtobufString(action, 5, "https://example.com/door")
+	body := appendProtobufString(nil, 1, "mytopic")
+	body = appendProtobufString(body, 2, "Door sensor")
+	body = appendProtobufString(body, 3, "Door opened")
+	body = appendProtobufInt(body, 4, 4)
+	body = appendProtobufString(body, 5, "door")
+	body = appendProtobufString(body, 5, "warning")
+	body = protowire.AppendTag(body, 8, protowire.BytesType)
+	body = protowire.AppendBytes(body, action)
+	body = appendProtobufString(body, 99, "unknown fields are ignored")
+	response := request(t, s, "POST", "/", string(body), map[string]string{
+		"Content-Type": "application/x-protobuf",
+	})
+	require.Equal(t, 200, response.Code)
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, "mytopic", m.Topic)
+	require.Equal(t, "Door sensor", m.Title)
+	require.Equal(t, "Door opened", m.Message)
+	require.Equal(t, 4, m.Priority)
+	require.Equal(t, []string{"door", "warning"}, m.Tags)
+	require.Equal(t, 1, len(m.Actions))
+	require.Equal(t, "https://example.com/door", m.Actions[0].URL)
+
+	// Publish to topic path, topic is taken from the path
+	body = appendProtobufString(nil, 3, "Door closed")
+	response = request(t, s, "PUT", "/mytopic", string(body), map[string]string{
+		"Content-Type": "application/x-protobuf",
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "Door closed", toMessage(t, response.Body.String()).Message)
+
+	// Poll as length-delimited protobuf stream
+	response = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"Accept": "application/x-protobuf",
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "application/x-protobuf", response.Header().Get("Content-Type"))
+	b := response.Body.Bytes()
+	messages := make([]*message, 0)
+	for len(b) > 0 {
+		v, n := protowire.ConsumeBytes(b)
+		require.True(t, n > 0)
+		messages = append(messages, decodeTestProtobufMessage(t, v))
+		b = b[n:]
+	}
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, m.ID, messages[0].ID)
+	require.Equal(t, "message", messages[0].Event)
+	require.Equal(t, "Door opened", messages[0].Message)
+	require.Equal(t, 4, messages[0].Priority)
+	require.Equal(t, []string{"door", "warning"}, messages[0].Tags)
+	require.Equal(t, "Door closed", messages[1].Message)
+
+	// Without Accept header, the stream is JSON
+	response = request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
+	require.Equal(t, "application/x-ndjson; charset=utf-8", response.Header().Get("Content-Type"))
+}
+
+func TestServer_PublishProtobuf_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "POST", "/", "\xff\xff\xff", map[string]string{
+		"Content-Type": "application/x-protobuf",
+	})
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40058, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "POST", "/", string(appendProtobufString(nil, 3, "no topic")), map[string]string{
+		"Content-Type": "application/x-protobuf",
+	})
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40009, toHTTPError(t, response.Body.String()).Code)
+}
+
+func decodeTestProtobufMessage(t *testing.T, b []byte) *message {
+	m := &message{}
+	require.Nil(t, consumeProtobufFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.ID = string(v)
+		case 2:
+			m.Time = int64(n)
+		case 4:
+			m.Event = string(v)
+		case 5:
+			m.Topic = string(v)
+		case 7:
+			m.Message = string(v)
+		case 8:
+			m.Priority = int(n)
+		case 9:
+			m.Tags = append(m.Tags, string(v))
+		}
+		return nil
+	}))
+	return m
+}
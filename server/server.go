@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"embed"
 	"encoding/base64"
 	"encoding/json"
@@ -13,6 +14,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/http/pprof"
 	"net/netip"
 	"net/url"
@@ -24,13 +26,17 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 	"unicode/utf8"
 
 	"github.com/emersion/go-smtp"
 	"github.com/gorilla/websocket"
+	"github.com/pires/go-proxyproto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v2"
 	"heckel.io/ntfy/v2/log"
@@ -45,13 +51,20 @@ type Server struct {
 	config            *Config
 	httpServer        *http.Server
 	httpsServer       *http.Server
+	httpListener      net.Listener
+	httpsListener     net.Listener
+	http3Server       *http3.Server
+	http3Conn         net.PacketConn
+	acmeManager       *autocert.Manager // Might be nil!
 	httpMetricsServer *http.Server
 	httpProfileServer *http.Server
 	unixListener      net.Listener
 	smtpServer        *smtp.Server
 	smtpServerBackend *smtpBackend
 	smtpSender        mailer
-	topics            map[string]*topic
+	syslogConn        net.PacketConn
+	snmpTrapConn      net.PacketConn
+	topics            *topicRegistry      // In-memory topics, lookups do not lock s.mu
 	visitors          map[string]*visitor // ip:<ip> or user:<user>
 	firebaseClient    *firebaseClient
 	messages          int64                               // Total number of messages (persisted if messageCache enabled)
@@ -60,9 +73,18 @@ type Server struct {
 	messageCache      *messageCache                       // Database that stores the messages
 	webPush           *webPushStore                       // Database that stores web push subscriptions
 	fileCache         *fileCache                          // File system based cache that stores attachments
+	attachmentGC      *attachmentGC                       // Attachment garbage collection, might be nil!
+	chunks            *chunkStore                         // Incomplete chunked messages, might be nil!
+	idempotencyKeys   *idempotencyStore                   // Messages published with an idempotency key
+	nonces            *nonceStore                         // Nonces of signed messages, see HMACTopic
+	passwordResets    map[string]*util.RateLimiter        // User ID -> password reset e-mail limiter, see userPasswordResetAllowed
+	webhookTemplates  map[string]*webhookTemplate         // Payload templates of the outbound webhooks, by name
+	uploads           *uploadStore                        // Resumable attachment uploads (tus), might be nil!
 	stripe            stripeAPI                           // Stripe API, can be replaced with a mock
 	priceCache        *util.LookupCache[map[string]int64] // Stripe price ID -> price as cents (USD implied!)
 	metricsHandler    http.Handler                        // Handles /metrics if enable-metrics set, and listen-metrics-http not set
+	subscriberLags    *subscriberLags                     // Delivery lag of HTTP stream and WebSocket subscribers
+	overloadLevel     atomic.Int32                        // Overload level, see checkOverload
 	closeChan         chan bool
 	mu                sync.RWMutex
 }
@@ -81,6 +103,9 @@ var (
 	wsPathRegex            = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}(,[-_A-Za-z0-9]{1,64})*/ws$`)
 	authPathRegex          = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}(,[-_A-Za-z0-9]{1,64})*/auth$`)
 	publishPathRegex       = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}/(publish|send|trigger)$`)
+	claimPathRegex         = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}/claim$`)
+	ackPathRegex           = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}/ack/(cl_[A-Za-z0-9]{29}|[A-Za-z0-9]{12})$`) // Claim or message ID
+	presencePathRegex      = regexp.MustCompile(`^/[-_A-Za-z0-9]{1,64}/presence$`)
 
 	webConfigPath                                        = "/config.js"
 	webManifestPath                                      = "/manifest.webmanifest"
@@ -90,17 +115,34 @@ var (
 	matrixPushPath                                       = "/_matrix/push/v1/notify"
 	metricsPath                                          = "/metrics"
 	apiHealthPath                                        = "/v1/health"
+	apiCapabilitiesPath                                  = "/v1/capabilities"
+	apiHomeAssistantPath                                 = "/v1/homeassistant"
 	apiStatsPath                                         = "/v1/stats"
+	apiUploadsPath                                       = "/v1/uploads"
+	apiEphemeralPath                                     = "/v1/ephemeral"
 	apiWebPushPath                                       = "/v1/webpush"
 	apiTiersPath                                         = "/v1/tiers"
 	apiUsersPath                                         = "/v1/users"
 	apiUsersAccessPath                                   = "/v1/users/access"
+	apiUsersReservationsPath                             = "/v1/users/reservations"
+	apiLogLevelPath                                      = "/v1/log/level"
 	apiAccountPath                                       = "/v1/account"
+	apiAccountExportPath                                 = "/v1/account/export"
+	apiAccountStatsPath                                  = "/v1/account/stats"
+	apiAccountLimitsPath                                 = "/v1/account/limits"
 	apiAccountTokenPath                                  = "/v1/account/token"
+	apiAccountTokenOthersPath                            = "/v1/account/token/others"
 	apiAccountPasswordPath                               = "/v1/account/password"
+	apiAccountPasswordResetPath                          = "/v1/account/password/reset"
+	apiAccountPasswordResetConfirmPath                   = "/v1/account/password/reset/confirm"
+	apiAccountEmailPath                                  = "/v1/account/email"
 	apiAccountSettingsPath                               = "/v1/account/settings"
 	apiAccountSubscriptionPath                           = "/v1/account/subscription"
 	apiAccountReservationPath                            = "/v1/account/reservation"
+	apiAccountInvitePath                                 = "/v1/account/invite"
+	apiAccountInviteRedeemPath                           = "/v1/account/invite/redeem"
+	apiAccountGuestTokenPath                             = "/v1/account/guest-token"
+	apiAccountMutePath                                   = "/v1/account/mute"
 	apiAccountPhonePath                                  = "/v1/account/phone"
 	apiAccountPhoneVerifyPath                            = "/v1/account/phone/verify"
 	apiAccountBillingPortalPath                          = "/v1/account/billing/portal"
@@ -109,6 +151,17 @@ var (
 	apiAccountBillingSubscriptionCheckoutSuccessTemplate = "/v1/account/billing/subscription/success/{CHECKOUT_SESSION_ID}"
 	apiAccountBillingSubscriptionCheckoutSuccessRegex    = regexp.MustCompile(`/v1/account/billing/subscription/success/(.+)$`)
 	apiAccountReservationSingleRegex                     = regexp.MustCompile(`/v1/account/reservation/([-_A-Za-z0-9]{1,64})$`)
+	apiAccountReservationSchemaRegex                     = regexp.MustCompile(`/v1/account/reservation/([-_A-Za-z0-9]{1,64})/schema$`)
+	apiAccountReservationRenameRegex                     = regexp.MustCompile(`/v1/account/reservation/([-_A-Za-z0-9]{1,64})/rename$`)
+	apiAccountReservationAliasRegex                      = regexp.MustCompile(`/v1/account/reservation/([-_A-Za-z0-9]{1,64})/alias/([-_A-Za-z0-9]{1,64})$`)
+	apiAccountReservationEscalationRegex                 = regexp.MustCompile(`/v1/account/reservation/([-_A-Za-z0-9]{1,64})/escalation$`)
+	apiAccountReservationSilenceRegex                    = regexp.MustCompile(`/v1/account/reservation/([-_A-Za-z0-9]{1,64})/silence$`)
+	apiAccountReservationSilenceSingleRegex              = regexp.MustCompile(`/v1/account/reservation/([-_A-Za-z0-9]{1,64})/silence/(si_[A-Za-z0-9]{9})$`)
+	apiAccountInviteSingleRegex                          = regexp.MustCompile(`/v1/account/invite/(in_[a-z0-9]{29})$`)
+	apiAccountGuestTokenSingleRegex                      = regexp.MustCompile(`/v1/account/guest-token/(gt_[a-z0-9]{29})$`)
+	apiAccountMuteSingleRegex                            = regexp.MustCompile(`/v1/account/mute/([-_A-Za-z0-9]{1,64})$`)
+	apiUploadSingleRegex                                 = regexp.MustCompile(`^/v1/uploads/(up_[a-z0-9]{29})$`)
+	apiEphemeralTopicSingleRegex                         = regexp.MustCompile(`^/v1/ephemeral/(ep_[A-Za-z0-9]{29})$`)
 	staticRegex                                          = regexp.MustCompile(`^/static/.+`)
 	docsRegex                                            = regexp.MustCompile(`^/docs(|/.*)$`)
 	fileRegex                                            = regexp.MustCompile(`^/file/([-_A-Za-z0-9]{1,64})(?:\.[A-Za-z0-9]{1,16})?$`)
@@ -147,6 +200,9 @@ const (
 	unifiedPushTopicLength   = 14                        // Length of UnifiedPush topics, including the "up" part
 	messagesHistoryMax       = 10                        // Number of message count values to keep in memory
 	templateMaxExecutionTime = 100 * time.Millisecond    // Maximum time a template can take to execute, used to prevent DoS attacks
+	longPollMaxWait          = 5 * time.Minute           // Maximum wait time for long poll requests, see longPoll
+	longPollCacheWait        = time.Second               // Maximum wait time for a received message to be cached, see longPoll
+	topicSchemaMismatchTag   = "schema-mismatch"         // Tag added to messages that do not match the topic's JSON schema, see validateTopicSchema
 	templateMaxOutputBytes   = 1024 * 1024               // Maximum number of bytes a template can output, used to prevent DoS attacks
 	templateFileExtension    = ".yml"                    // Template files must end with this extension
 )
@@ -160,17 +216,34 @@ const (
 )
 
 // New instantiates a new Server. It creates the cache and adds a Firebase
-// subscriber (if configured).
+// subscriber (if configured). The server is configured with the given options, starting
+// from the defaults of NewConfig, or from the config passed via WithConfig. Call Run or
+// Start to start serving.
 //
 // Parameters:
-//   - conf: The configuration for the server.
+//   - options: The server options, e.g. WithConfig(conf) or WithListenHTTP(":8080").
 //
 // Returns:
 //   - A new Server instance, or an error if initialization fails.
-func New(conf *Config) (*Server, error) {
+func New(options ...Option) (*Server, error) {
+	o := &serverOptions{}
+	for _, option := range options {
+		option(o)
+	}
+	conf := o.config
+	if conf == nil {
+		conf = NewConfig()
+	}
+	for _, set := range o.setters {
+		set(conf)
+	}
+	return newServer(conf)
+}
+
+func newServer(conf *Config) (*Server, error) {
 	var mailer mailer
-	if conf.SMTPSenderAddr != "" {
-		mailer = &smtpSender{config: conf}
+	if conf.SMTPSenderAddr != "" || len(conf.EmailProviders) > 0 {
+		mailer = newMailSender(conf)
 	}
 	var stripe stripeAPI
 	if payments.Available && conf.StripeSecretKey != "" {
@@ -187,20 +260,31 @@ func New(conf *Config) (*Server, error) {
 			return nil, err
 		}
 	}
-	topics, err := messageCache.Topics()
+	cachedTopics, err := messageCache.Topics()
 	if err != nil {
 		return nil, err
 	}
+	topics := newTopicRegistry()
+	for _, t := range cachedTopics {
+		topics.Add(t)
+	}
 	messages, err := messageCache.Stats()
 	if err != nil {
 		return nil, err
 	}
 	var fileCache *fileCache
+	var attachmentGC *attachmentGC
+	var uploads *uploadStore
 	if conf.AttachmentCacheDir != "" {
 		fileCache, err = newFileCache(conf.AttachmentCacheDir, conf.AttachmentTotalSizeLimit)
 		if err != nil {
 			return nil, err
 		}
+		attachmentGC = newAttachmentGC(conf, messageCache, fileCache)
+		uploads, err = newUploadStore(filepath.Join(conf.AttachmentCacheDir, uploadsDirName))
+		if err != nil {
+			return nil, err
+		}
 	}
 	var userManager *user.Manager
 	if conf.AuthFile != "" {
@@ -212,8 +296,10 @@ func New(conf *Config) (*Server, error) {
 			Users:               conf.AuthUsers,
 			Access:              conf.AuthAccess,
 			Tokens:              conf.AuthTokens,
+			AccessTemplates:     conf.AuthAccessTemplates,
 			BcryptCost:          conf.AuthBcryptCost,
 			QueueWriterInterval: conf.AuthStatsQueueWriterInterval,
+			AuthCacheTTL:        conf.AuthCacheTTL,
 		}
 		userManager, err = user.NewManager(authConfig)
 		if err != nil {
@@ -234,19 +320,38 @@ func New(conf *Config) (*Server, error) {
 		}
 		firebaseClient = newFirebaseClient(sender, auther)
 	}
+	var acmeManager *autocert.Manager
+	if len(conf.ACMEDomains) > 0 {
+		acmeManager = newACMEManager(conf)
+	}
+	webhookTemplates, err := loadWebhookTemplates(conf)
+	if err != nil {
+		return nil, err
+	}
 	s := &Server{
-		config:          conf,
-		messageCache:    messageCache,
-		webPush:         webPush,
-		fileCache:       fileCache,
-		firebaseClient:  firebaseClient,
-		smtpSender:      mailer,
-		topics:          topics,
-		userManager:     userManager,
-		messages:        messages,
-		messagesHistory: []int64{messages},
-		visitors:        make(map[string]*visitor),
-		stripe:          stripe,
+		config:           conf,
+		acmeManager:      acmeManager,
+		messageCache:     messageCache,
+		webPush:          webPush,
+		fileCache:        fileCache,
+		attachmentGC:     attachmentGC,
+		uploads:          uploads,
+		firebaseClient:   firebaseClient,
+		smtpSender:       mailer,
+		topics:           topics,
+		userManager:      userManager,
+		messages:         messages,
+		messagesHistory:  []int64{messages},
+		visitors:         make(map[string]*visitor),
+		passwordResets:   make(map[string]*util.RateLimiter),
+		stripe:           stripe,
+		subscriberLags:   newSubscriberLags(),
+		idempotencyKeys:  newIdempotencyStore(),
+		nonces:           newNonceStore(),
+		webhookTemplates: webhookTemplates,
+	}
+	if conf.MessageChunkedSizeLimit > 0 {
+		s.chunks = newChunkStore(conf.MessageChunkedSizeLimit)
 	}
 	s.priceCache = util.NewLookupCache(s.fetchStripePrices, conf.StripePriceCacheDuration)
 	return s, nil
@@ -267,6 +372,35 @@ func createMessageCache(conf *Config) (*messageCache, error) {
 // Returns:
 //   - An error if the server fails to start or crashes.
 func (s *Server) Run() error {
+	errChan, err := s.start()
+	if err != nil {
+		return err
+	}
+	return <-errChan
+}
+
+// Start starts the server in the background, and returns once all listeners are bound. Unlike Run,
+// it does not block until the server exits. This is useful to embed the server in other programs,
+// or in tests. Errors that occur after startup are logged. Use Stop to stop the server.
+//
+// Returns:
+//   - An error if the server fails to start, e.g. because the listen address is already in use.
+func (s *Server) Start() error {
+	errChan, err := s.start()
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := <-errChan; err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			log.Tag(tagStartup).Err(err).Error("Server exited unexpectedly")
+		}
+	}()
+	return nil
+}
+
+// start binds all listeners and starts serving in the background. Listener errors (e.g. address in use)
+// are returned immediately, and all other errors are sent to the returned channel.
+func (s *Server) start() (<-chan error, error) {
 	var listenStr string
 	if s.config.ListenHTTP != "" {
 		listenStr += fmt.Sprintf(" %s[http]", s.config.ListenHTTP)
@@ -274,12 +408,21 @@ func (s *Server) Run() error {
 	if s.config.ListenHTTPS != "" {
 		listenStr += fmt.Sprintf(" %s[https]", s.config.ListenHTTPS)
 	}
+	if s.config.ListenHTTP3 != "" {
+		listenStr += fmt.Sprintf(" %s[http3]", s.config.ListenHTTP3)
+	}
 	if s.config.ListenUnix != "" {
 		listenStr += fmt.Sprintf(" %s[unix]", s.config.ListenUnix)
 	}
 	if s.config.SMTPServerListen != "" {
 		listenStr += fmt.Sprintf(" %s[smtp]", s.config.SMTPServerListen)
 	}
+	if s.config.SyslogListen != "" {
+		listenStr += fmt.Sprintf(" %s[syslog]", s.config.SyslogListen)
+	}
+	if s.config.SNMPTrapListen != "" {
+		listenStr += fmt.Sprintf(" %s[snmp]", s.config.SNMPTrapListen)
+	}
 	if s.config.MetricsListenHTTP != "" {
 		listenStr += fmt.Sprintf(" %s[http/metrics]", s.config.MetricsListenHTTP)
 	}
@@ -291,43 +434,51 @@ func (s *Server) Run() error {
 		fmt.Fprintf(os.Stderr, "Listening on%s, ntfy %s\n", listenStr, s.config.Version)
 		fmt.Fprintf(os.Stderr, "Logs are written to %s\n", log.File())
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.listen(); err != nil {
+		return nil, err
+	}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handle)
-	errChan := make(chan error)
-	s.mu.Lock()
+	errChan := make(chan error, 9) // Buffered, so that serving go routines can exit after the first error
 	s.closeChan = make(chan bool)
-	if s.config.ListenHTTP != "" {
-		s.httpServer = &http.Server{Addr: s.config.ListenHTTP, Handler: mux}
+	var tlsConfig *tls.Config
+	if s.httpsListener != nil || s.http3Conn != nil {
+		var err error
+		if tlsConfig, err = s.tlsConfig(); err != nil {
+			s.closeListeners()
+			return nil, err
+		}
+	}
+	if s.acmeManager != nil {
+		log.Tag(tagStartup).Info("Requesting TLS certificates via ACME for %s", strings.Join(s.config.ACMEDomains, ", "))
+	}
+	if s.httpListener != nil {
+		s.httpServer = &http.Server{Addr: s.config.ListenHTTP, Handler: s.withACMEChallenge(mux)}
 		go func() {
-			errChan <- s.httpServer.ListenAndServe()
+			errChan <- s.httpServer.Serve(s.withProxyProtocol(s.httpListener))
 		}()
 	}
-	if s.config.ListenHTTPS != "" {
-		s.httpsServer = &http.Server{Addr: s.config.ListenHTTPS, Handler: mux}
+	if s.http3Conn != nil {
+		s.http3Server = &http3.Server{
+			Addr:      s.config.ListenHTTP3,
+			Port:      s.http3Conn.LocalAddr().(*net.UDPAddr).Port,
+			Handler:   mux,
+			TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+		}
 		go func() {
-			errChan <- s.httpsServer.ListenAndServeTLS(s.config.CertFile, s.config.KeyFile)
+			errChan <- s.http3Server.Serve(s.http3Conn)
 		}()
 	}
-	if s.config.ListenUnix != "" {
+	if s.httpsListener != nil {
+		s.httpsServer = &http.Server{Addr: s.config.ListenHTTPS, Handler: s.withAltSvc(mux), TLSConfig: tlsConfig}
+		go func() {
+			errChan <- s.httpsServer.ServeTLS(s.withProxyProtocol(s.httpsListener), "", "") // Certificates are in TLSConfig
+		}()
+	}
+	if s.unixListener != nil {
 		go func() {
-			var err error
-			s.mu.Lock()
-			os.Remove(s.config.ListenUnix)
-			s.unixListener, err = net.Listen("unix", s.config.ListenUnix)
-			if err != nil {
-				s.mu.Unlock()
-				errChan <- err
-				return
-			}
-			defer s.unixListener.Close()
-			if s.config.ListenUnixMode > 0 {
-				if err := os.Chmod(s.config.ListenUnix, s.config.ListenUnixMode); err != nil {
-					s.mu.Unlock()
-					errChan <- err
-					return
-				}
-			}
-			s.mu.Unlock()
 			httpServer := &http.Server{Handler: mux}
 			errChan <- httpServer.Serve(s.unixListener)
 		}()
@@ -359,13 +510,196 @@ func (s *Server) Run() error {
 			errChan <- s.runSMTPServer()
 		}()
 	}
-	s.mu.Unlock()
+	if s.syslogConn != nil {
+		go func(conn net.PacketConn) {
+			errChan <- runDatagramListener(conn, s.handleSyslogDatagram)
+		}(s.syslogConn)
+	}
+	if s.snmpTrapConn != nil {
+		go func(conn net.PacketConn) {
+			errChan <- runDatagramListener(conn, s.handleSNMPTrap)
+		}(s.snmpTrapConn)
+	}
 	go s.runManager()
 	go s.runStatsResetter()
 	go s.runDelayedSender()
 	go s.runFirebaseKeepaliver()
+	go s.runOverloadChecker()
+	return errChan, nil
+}
 
-	return <-errChan
+// listen binds the HTTP, HTTPS and unix socket listeners, if configured. If any of them fails,
+// the listeners that were already bound are closed again. Must be called with s.mu held.
+func (s *Server) listen() error {
+	var err error
+	if s.config.ListenHTTP != "" {
+		if s.httpListener, err = net.Listen("tcp", s.config.ListenHTTP); err != nil {
+			return err
+		}
+	}
+	if s.config.ListenHTTPS != "" {
+		if s.httpsListener, err = net.Listen("tcp", s.config.ListenHTTPS); err != nil {
+			s.closeListeners()
+			return err
+		}
+	}
+	if s.config.ListenHTTP3 != "" {
+		if s.http3Conn, err = net.ListenPacket("udp", s.config.ListenHTTP3); err != nil {
+			s.closeListeners()
+			return err
+		}
+	}
+	if s.config.SyslogListen != "" {
+		if s.syslogConn, err = net.ListenPacket("udp", s.config.SyslogListen); err != nil {
+			s.closeListeners()
+			return err
+		}
+	}
+	if s.config.SNMPTrapListen != "" {
+		if s.snmpTrapConn, err = net.ListenPacket("udp", s.config.SNMPTrapListen); err != nil {
+			s.closeListeners()
+			return err
+		}
+	}
+	if s.config.ListenUnix != "" {
+		os.Remove(s.config.ListenUnix)
+		if s.unixListener, err = net.Listen("unix", s.config.ListenUnix); err != nil {
+			s.closeListeners()
+			return err
+		}
+		if s.config.ListenUnixMode > 0 {
+			if err := os.Chmod(s.config.ListenUnix, s.config.ListenUnixMode); err != nil {
+				s.closeListeners()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// closeListeners closes and resets all bound listeners. Must be called with s.mu held.
+func (s *Server) closeListeners() {
+	for _, listener := range []*net.Listener{&s.httpListener, &s.httpsListener, &s.unixListener} {
+		if *listener != nil {
+			(*listener).Close()
+			*listener = nil
+		}
+	}
+	if s.http3Conn != nil {
+		s.http3Conn.Close()
+		s.http3Conn = nil
+	}
+	for _, conn := range []*net.PacketConn{&s.syslogConn, &s.snmpTrapConn} {
+		if *conn != nil {
+			(*conn).Close()
+			*conn = nil
+		}
+	}
+}
+
+// withProxyProtocol wraps the listener to read the PROXY protocol (v1 or v2) header sent by TCP load balancers
+// (e.g. HAProxy or AWS NLB), if enabled, so that the real client IP is used for rate limiting and logging.
+// Connections without the header are accepted as usual.
+func (s *Server) withProxyProtocol(listener net.Listener) net.Listener {
+	if !s.config.ProxyProtocol {
+		return listener
+	}
+	return &proxyproto.Listener{Listener: listener, Policy: s.proxyProtocolPolicy}
+}
+
+// proxyProtocolPolicy accepts the PROXY protocol header from all hosts, or only from the trusted proxies, if they
+// are configured. Connections from other hosts that send the header are rejected, so the client IP cannot be spoofed.
+func (s *Server) proxyProtocolPolicy(upstream net.Addr) (proxyproto.Policy, error) {
+	if len(s.config.ProxyTrustedPrefixes) == 0 {
+		return proxyproto.USE, nil
+	}
+	if addrPort, err := netip.ParseAddrPort(upstream.String()); err == nil {
+		for _, prefix := range s.config.ProxyTrustedPrefixes {
+			if prefix.Contains(addrPort.Addr().Unmap()) {
+				return proxyproto.USE, nil
+			}
+		}
+	}
+	return proxyproto.REJECT, nil // Never return an error here, it stops the server (see proxyproto.Listener.Accept)
+}
+
+// withACMEChallenge wraps the HTTP handler to answer ACME HTTP-01 challenges, if ACME is enabled.
+// All other requests are passed on to the next handler.
+func (s *Server) withACMEChallenge(next http.Handler) http.Handler {
+	if s.acmeManager == nil {
+		return next
+	}
+	return s.acmeManager.HTTPHandler(next)
+}
+
+// withAltSvc wraps the HTTPS handler to advertise the HTTP/3 listener via the Alt-Svc header, so that
+// clients that support HTTP/3 (e.g. browsers) can switch to it for subsequent requests
+func (s *Server) withAltSvc(next http.Handler) http.Handler {
+	if s.http3Server == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = s.http3Server.SetQUICHeaders(w.Header()) // Fails only if the listener is not up yet
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Addr returns the address of the HTTP listener, or nil if the server is not listening on HTTP.
+// This is useful if the server was configured to listen on a random port, e.g. "127.0.0.1:0".
+func (s *Server) Addr() net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.httpListener == nil {
+		return nil
+	}
+	return s.httpListener.Addr()
+}
+
+// ServeHTTP implements http.Handler, so that the server can be mounted into an existing HTTP server, or
+// used with httptest.NewServer. Call Start (with no listeners configured) to run the background managers.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handle(w, r)
+}
+
+// Publish publishes a message to a topic in-process, without going through the network. The message is
+// handled exactly like an HTTP PUT request to the topic from localhost, i.e. headers such as "Title" or
+// "Priority" are supported, and access control and rate limits apply. Credentials may be passed via the
+// "Authorization" header.
+//
+// Parameters:
+//   - topic: The topic to publish to, e.g. "mytopic".
+//   - body: The message body, or the attachment if the "Filename" header is set. May be nil.
+//   - headers: Additional request headers, e.g. "Title", "Tags" or "Authorization". May be nil.
+//
+// Returns:
+//   - The published message, or an error if the message was rejected.
+func (s *Server) Publish(topic string, body io.Reader, headers map[string]string) (*Message, error) {
+	if body == nil {
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s", s.config.BaseURL, topic), body)
+	if err != nil {
+		return nil, err
+	}
+	req.RequestURI = "/" + topic // just for the logs
+	req.RemoteAddr = "127.0.0.1:0"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	s.handle(rr, req)
+	if rr.Code != http.StatusOK {
+		var e errHTTP
+		if err := json.NewDecoder(rr.Body).Decode(&e); err != nil || e.Message == "" {
+			return nil, fmt.Errorf("unexpected response: HTTP %d", rr.Code)
+		}
+		return nil, &e
+	}
+	var m Message
+	if err := json.NewDecoder(rr.Body).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
 }
 
 // Stop stops HTTP (+HTTPS) server and all managers.
@@ -378,14 +712,28 @@ func (s *Server) Stop() {
 	if s.httpsServer != nil {
 		s.httpsServer.Close()
 	}
+	if s.http3Server != nil {
+		s.http3Server.Close()
+	}
+	if s.http3Conn != nil {
+		s.http3Conn.Close() // Not closed by http3.Server.Close
+	}
 	if s.unixListener != nil {
 		s.unixListener.Close()
 	}
 	if s.smtpServer != nil {
 		s.smtpServer.Close()
 	}
+	if s.syslogConn != nil {
+		s.syslogConn.Close()
+	}
+	if s.snmpTrapConn != nil {
+		s.snmpTrapConn.Close()
+	}
 	s.closeDatabases()
-	close(s.closeChan)
+	if s.closeChan != nil {
+		close(s.closeChan)
+	}
 }
 
 func (s *Server) closeDatabases() {
@@ -401,11 +749,18 @@ func (s *Server) closeDatabases() {
 // handle is the main entry point for all HTTP requests.
 // It handles authentication, logging, and dispatching to specific handlers.
 func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	r = withRequestID(w, r)
 	v, err := s.maybeAuthenticate(r) // Note: Always returns v, even when error is returned
 	if err != nil {
 		s.handleError(w, r, v, err)
 		return
 	}
+	v, r, err = s.maybeImpersonate(r, v)
+	if err != nil {
+		s.handleError(w, r, v, err)
+		return
+	}
+	r = withLogVisitor(r, v)
 	ev := logvr(v, r)
 	if ev.IsTrace() {
 		ev.Field("http_request", renderHTTPRequest(r)).Trace("HTTP request started")
@@ -457,6 +812,10 @@ func (s *Server) handleError(w http.ResponseWriter, r *http.Request, v *visitor,
 			httpErr = httpErr.Wrap("increase your limits with a paid plan, see %s", s.config.BaseURL)
 		}
 	}
+	httpErr = httpErr.Localize(newTranslator(s.language(v.User(), r)))
+	if httpErr.HTTPCode == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(overloadRetryAfter.Seconds())))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", s.config.AccessControlAllowOrigin) // CORS, allow cross-origin requests
 	w.WriteHeader(httpErr.HTTPCode)
@@ -470,36 +829,64 @@ func (s *Server) handleInternal(w http.ResponseWriter, r *http.Request, v *visit
 		return s.ensureWebEnabled(s.handleEmpty)(w, r, v)
 	} else if r.Method == http.MethodGet && r.URL.Path == apiHealthPath {
 		return s.handleHealth(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiCapabilitiesPath {
+		return s.handleCapabilities(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiHomeAssistantPath {
+		return s.limitRequests(s.handleHomeAssistant)(w, r, v)
 	} else if r.Method == http.MethodGet && r.URL.Path == webConfigPath {
 		return s.ensureWebEnabled(s.handleWebConfig)(w, r, v)
 	} else if r.Method == http.MethodGet && r.URL.Path == webManifestPath {
 		return s.ensureWebPushEnabled(s.handleWebManifest)(w, r, v)
 	} else if r.Method == http.MethodGet && r.URL.Path == apiUsersPath {
-		return s.ensureAdmin(s.handleUsersGet)(w, r, v)
+		return s.ensureCapability(user.CapabilityUsersRead, s.handleUsersGet)(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == apiUsersPath {
-		return s.ensureAdmin(s.handleUsersAdd)(w, r, v)
+		return s.ensureCapability(user.CapabilityUsersWrite, s.handleUsersAdd)(w, r, v)
 	} else if r.Method == http.MethodPut && r.URL.Path == apiUsersPath {
-		return s.ensureAdmin(s.handleUsersUpdate)(w, r, v)
+		return s.ensureCapability(user.CapabilityUsersWrite, s.handleUsersUpdate)(w, r, v)
 	} else if r.Method == http.MethodDelete && r.URL.Path == apiUsersPath {
-		return s.ensureAdmin(s.handleUsersDelete)(w, r, v)
+		return s.ensureCapability(user.CapabilityUsersWrite, s.handleUsersDelete)(w, r, v)
 	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == apiUsersAccessPath {
-		return s.ensureAdmin(s.handleAccessAllow)(w, r, v)
+		return s.ensureCapability(user.CapabilityAccessWrite, s.handleAccessAllow)(w, r, v)
 	} else if r.Method == http.MethodDelete && r.URL.Path == apiUsersAccessPath {
-		return s.ensureAdmin(s.handleAccessReset)(w, r, v)
+		return s.ensureCapability(user.CapabilityAccessWrite, s.handleAccessReset)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiUsersReservationsPath {
+		return s.ensureCapability(user.CapabilityStatsRead, s.handleUsersReservationsGet)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiLogLevelPath {
+		return s.ensureCapability(user.CapabilityLogLevel, s.handleLogLevelGet)(w, r, v)
+	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == apiLogLevelPath {
+		return s.ensureCapability(user.CapabilityLogLevel, s.handleLogLevelChange)(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiLogLevelPath {
+		return s.ensureCapability(user.CapabilityLogLevel, s.handleLogLevelReset)(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountPath {
 		return s.ensureUserManager(s.handleAccountCreate)(w, r, v)
 	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountPath {
 		return s.handleAccountGet(w, r, v) // Allowed by anonymous
 	} else if r.Method == http.MethodDelete && r.URL.Path == apiAccountPath {
-		return s.ensureUser(s.withAccountSync(s.handleAccountDelete))(w, r, v)
+		return s.ensureUser(s.ensureNotImpersonating(s.withAccountSync(s.handleAccountDelete)))(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountStatsPath {
+		return s.ensureUser(s.handleAccountStats)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountLimitsPath {
+		return s.handleAccountLimits(w, r, v) // Allowed by anonymous, not rate limited to be able to debug rate limits
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountExportPath {
+		return s.ensureUser(s.handleAccountExport)(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountPasswordPath {
-		return s.ensureUser(s.handleAccountPasswordChange)(w, r, v)
+		return s.ensureUser(s.ensureNotImpersonating(s.handleAccountPasswordChange))(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountPasswordResetPath {
+		return s.ensurePasswordResetEnabled(s.handleAccountPasswordReset)(w, r, v) // Allowed by anonymous
+	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountPasswordResetConfirmPath {
+		return s.ensurePasswordResetEnabled(s.handleAccountPasswordResetConfirm)(w, r, v) // Allowed by anonymous
+	} else if r.Method == http.MethodPut && r.URL.Path == apiAccountEmailPath {
+		return s.ensureUser(s.ensureNotImpersonating(s.withAccountSync(s.handleAccountEmailChange)))(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountTokenPath {
+		return s.ensureUser(s.handleAccountTokenList)(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountTokenPath {
-		return s.ensureUser(s.withAccountSync(s.handleAccountTokenCreate))(w, r, v)
+		return s.ensureUser(s.ensureNotImpersonating(s.withAccountSync(s.handleAccountTokenCreate)))(w, r, v)
 	} else if r.Method == http.MethodPatch && r.URL.Path == apiAccountTokenPath {
-		return s.ensureUser(s.withAccountSync(s.handleAccountTokenUpdate))(w, r, v)
+		return s.ensureUser(s.ensureNotImpersonating(s.withAccountSync(s.handleAccountTokenUpdate)))(w, r, v)
 	} else if r.Method == http.MethodDelete && r.URL.Path == apiAccountTokenPath {
-		return s.ensureUser(s.withAccountSync(s.handleAccountTokenDelete))(w, r, v)
+		return s.ensureUser(s.ensureNotImpersonating(s.withAccountSync(s.handleAccountTokenDelete)))(w, r, v)
+	} else if r.Method == http.MethodDelete && r.URL.Path == apiAccountTokenOthersPath {
+		return s.ensureUser(s.ensureNotImpersonating(s.withAccountSync(s.handleAccountTokenDeleteOthers)))(w, r, v)
 	} else if r.Method == http.MethodPatch && r.URL.Path == apiAccountSettingsPath {
 		return s.ensureUser(s.withAccountSync(s.handleAccountSettingsChange))(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountSubscriptionPath {
@@ -512,16 +899,58 @@ func (s *Server) handleInternal(w http.ResponseWriter, r *http.Request, v *visit
 		return s.ensureUser(s.withAccountSync(s.handleAccountReservationAdd))(w, r, v)
 	} else if r.Method == http.MethodDelete && apiAccountReservationSingleRegex.MatchString(r.URL.Path) {
 		return s.ensureUser(s.withAccountSync(s.handleAccountReservationDelete))(w, r, v)
+	} else if r.Method == http.MethodPost && apiAccountReservationRenameRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.withAccountSync(s.handleAccountReservationRename))(w, r, v)
+	} else if r.Method == http.MethodDelete && apiAccountReservationAliasRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.withAccountSync(s.handleAccountTopicAliasDelete))(w, r, v)
+	} else if r.Method == http.MethodGet && apiAccountReservationSchemaRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicSchemaGet)(w, r, v)
+	} else if r.Method == http.MethodPut && apiAccountReservationSchemaRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicSchemaChange)(w, r, v)
+	} else if r.Method == http.MethodDelete && apiAccountReservationSchemaRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicSchemaDelete)(w, r, v)
+	} else if r.Method == http.MethodGet && apiAccountReservationEscalationRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicEscalationGet)(w, r, v)
+	} else if r.Method == http.MethodPut && apiAccountReservationEscalationRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicEscalationChange)(w, r, v)
+	} else if r.Method == http.MethodDelete && apiAccountReservationEscalationRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicEscalationDelete)(w, r, v)
+	} else if r.Method == http.MethodGet && apiAccountReservationSilenceRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicSilenceList)(w, r, v)
+	} else if r.Method == http.MethodPost && apiAccountReservationSilenceRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicSilenceAdd)(w, r, v)
+	} else if r.Method == http.MethodDelete && apiAccountReservationSilenceSingleRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountTopicSilenceDelete)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountInvitePath {
+		return s.ensureUser(s.handleAccountInviteList)(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountInvitePath {
+		return s.ensureUser(s.handleAccountInviteCreate)(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountInviteRedeemPath {
+		return s.ensureUser(s.withAccountSync(s.handleAccountInviteRedeem))(w, r, v)
+	} else if r.Method == http.MethodDelete && apiAccountInviteSingleRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountInviteDelete)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountGuestTokenPath {
+		return s.ensureUser(s.handleAccountGuestTokenList)(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountGuestTokenPath {
+		return s.ensureUser(s.ensureNotImpersonating(s.handleAccountGuestTokenCreate))(w, r, v)
+	} else if r.Method == http.MethodDelete && apiAccountGuestTokenSingleRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.handleAccountGuestTokenDelete)(w, r, v)
+	} else if r.Method == http.MethodGet && r.URL.Path == apiAccountMutePath {
+		return s.ensureUser(s.handleAccountTopicMuteList)(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountMutePath {
+		return s.ensureUser(s.withAccountSync(s.handleAccountTopicMuteAdd))(w, r, v)
+	} else if r.Method == http.MethodDelete && apiAccountMuteSingleRegex.MatchString(r.URL.Path) {
+		return s.ensureUser(s.withAccountSync(s.handleAccountTopicMuteDelete))(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountBillingSubscriptionPath {
-		return s.ensurePaymentsEnabled(s.ensureUser(s.handleAccountBillingSubscriptionCreate))(w, r, v) // Account sync via incoming Stripe webhook
+		return s.ensurePaymentsEnabled(s.ensureUser(s.ensureNotImpersonating(s.handleAccountBillingSubscriptionCreate)))(w, r, v) // Account sync via incoming Stripe webhook
 	} else if r.Method == http.MethodGet && apiAccountBillingSubscriptionCheckoutSuccessRegex.MatchString(r.URL.Path) {
 		return s.ensurePaymentsEnabled(s.ensureUserManager(s.handleAccountBillingSubscriptionCreateSuccess))(w, r, v) // No user context!
 	} else if r.Method == http.MethodPut && r.URL.Path == apiAccountBillingSubscriptionPath {
-		return s.ensurePaymentsEnabled(s.ensureStripeCustomer(s.handleAccountBillingSubscriptionUpdate))(w, r, v) // Account sync via incoming Stripe webhook
+		return s.ensurePaymentsEnabled(s.ensureStripeCustomer(s.ensureNotImpersonating(s.handleAccountBillingSubscriptionUpdate)))(w, r, v) // Account sync via incoming Stripe webhook
 	} else if r.Method == http.MethodDelete && r.URL.Path == apiAccountBillingSubscriptionPath {
-		return s.ensurePaymentsEnabled(s.ensureStripeCustomer(s.handleAccountBillingSubscriptionDelete))(w, r, v) // Account sync via incoming Stripe webhook
+		return s.ensurePaymentsEnabled(s.ensureStripeCustomer(s.ensureNotImpersonating(s.handleAccountBillingSubscriptionDelete)))(w, r, v) // Account sync via incoming Stripe webhook
 	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountBillingPortalPath {
-		return s.ensurePaymentsEnabled(s.ensureStripeCustomer(s.handleAccountBillingPortalSessionCreate))(w, r, v)
+		return s.ensurePaymentsEnabled(s.ensureStripeCustomer(s.ensureNotImpersonating(s.handleAccountBillingPortalSessionCreate)))(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == apiAccountBillingWebhookPath {
 		return s.ensurePaymentsEnabled(s.ensureUserManager(s.handleAccountBillingWebhook))(w, r, v) // This request comes from Stripe!
 	} else if r.Method == http.MethodPut && r.URL.Path == apiAccountPhoneVerifyPath {
@@ -548,8 +977,24 @@ func (s *Server) handleInternal(w http.ResponseWriter, r *http.Request, v *visit
 		return s.ensureWebEnabled(s.handleDocs)(w, r, v)
 	} else if (r.Method == http.MethodGet || r.Method == http.MethodHead) && fileRegex.MatchString(r.URL.Path) && s.config.AttachmentCacheDir != "" {
 		return s.limitRequests(s.handleFile)(w, r, v)
+	} else if r.Method == http.MethodOptions && r.URL.Path == apiUploadsPath {
+		return s.ensureUploadsEnabled(s.limitRequests(s.handleUploadOptions))(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiUploadsPath {
+		return s.ensureUploadsEnabled(s.ensureTusResumable(s.limitRequests(s.handleUploadCreate)))(w, r, v)
+	} else if r.Method == http.MethodHead && apiUploadSingleRegex.MatchString(r.URL.Path) {
+		return s.ensureUploadsEnabled(s.ensureTusResumable(s.limitRequests(s.handleUploadHead)))(w, r, v)
+	} else if r.Method == http.MethodPatch && apiUploadSingleRegex.MatchString(r.URL.Path) {
+		return s.ensureUploadsEnabled(s.ensureTusResumable(s.limitRequests(s.handleUploadPatch)))(w, r, v)
+	} else if r.Method == http.MethodDelete && apiUploadSingleRegex.MatchString(r.URL.Path) {
+		return s.ensureUploadsEnabled(s.ensureTusResumable(s.limitRequests(s.handleUploadDelete)))(w, r, v)
+	} else if r.Method == http.MethodPost && r.URL.Path == apiEphemeralPath {
+		return s.limitRequests(s.handleEphemeralTopicCreate)(w, r, v)
+	} else if r.Method == http.MethodDelete && apiEphemeralTopicSingleRegex.MatchString(r.URL.Path) {
+		return s.limitRequests(s.handleEphemeralTopicDelete)(w, r, v)
 	} else if r.Method == http.MethodOptions {
 		return s.limitRequests(s.handleOptions)(w, r, v) // Should work even if the web app is not enabled, see #598
+	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && (r.URL.Path == "/" || topicPathRegex.MatchString(r.URL.Path)) && isProtobufContentType(r.Header.Get("Content-Type")) {
+		return s.transformBodyProtobuf(s.limitRequestsWithTopic(s.authorizeTopicWrite(s.handlePublish)))(w, r, v)
 	} else if (r.Method == http.MethodPut || r.Method == http.MethodPost) && r.URL.Path == "/" {
 		return s.transformBodyJSON(s.limitRequestsWithTopic(s.authorizeTopicWrite(s.handlePublish)))(w, r, v)
 	} else if r.Method == http.MethodPost && r.URL.Path == matrixPushPath {
@@ -566,6 +1011,12 @@ func (s *Server) handleInternal(w http.ResponseWriter, r *http.Request, v *visit
 		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeRaw))(w, r, v)
 	} else if r.Method == http.MethodGet && wsPathRegex.MatchString(r.URL.Path) {
 		return s.limitRequests(s.authorizeTopicRead(s.handleSubscribeWS))(w, r, v)
+	} else if r.Method == http.MethodPost && claimPathRegex.MatchString(r.URL.Path) && s.config.CacheDuration > 0 {
+		return s.limitRequests(s.authorizeTopicRead(s.handleClaim))(w, r, v)
+	} else if r.Method == http.MethodPost && ackPathRegex.MatchString(r.URL.Path) && s.config.CacheDuration > 0 {
+		return s.limitRequests(s.authorizeTopicRead(s.handleAck))(w, r, v)
+	} else if r.Method == http.MethodGet && presencePathRegex.MatchString(r.URL.Path) && s.userManager != nil {
+		return s.limitRequests(s.authorizeTopicRead(s.handleTopicPresence))(w, r, v)
 	} else if r.Method == http.MethodGet && authPathRegex.MatchString(r.URL.Path) {
 		return s.limitRequests(s.authorizeTopicRead(s.handleTopicAuth))(w, r, v)
 	} else if r.Method == http.MethodGet && (topicPathRegex.MatchString(r.URL.Path) || externalTopicPathRegex.MatchString(r.URL.Path)) {
@@ -599,6 +1050,58 @@ func (s *Server) handleTopicAuth(w http.ResponseWriter, _ *http.Request, _ *visi
 	return s.writeJSON(w, newSuccessResponse())
 }
 
+// handleTopicPresence returns the number of subscribers currently connected to the topic. Only the owner of
+// the topic (the user that reserved it) and admins can see this, since it reveals whether anyone is listening.
+func (s *Server) handleTopicPresence(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	t, err := s.topicFromPath(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	owner, err := s.topicOwnedBy(v, t.ID)
+	if err != nil {
+		return err
+	} else if !owner {
+		return errHTTPForbidden.With(t)
+	}
+	subscribers, _ := t.Stats()
+	return s.writeJSON(w, &apiTopicPresenceResponse{
+		Topic:       t.ID,
+		Subscribers: subscribers,
+	})
+}
+
+// newOpenMessage creates the open message for a new subscription. If the subscription is for a single topic,
+// and the visitor owns that topic, the message contains the number of connected subscribers (including this one).
+func (s *Server) newOpenMessage(v *visitor, topics []*topic, topicsStr string) *message {
+	m := newOpenMessage(topicsStr)
+	if len(topics) != 1 {
+		return m
+	}
+	owner, err := s.topicOwnedBy(v, topics[0].ID)
+	if err != nil {
+		logv(v).With(topics[0]).Err(err).Warn("Cannot determine topic owner")
+	} else if owner {
+		m.Subscribers, _ = topics[0].Stats()
+	}
+	return m
+}
+
+// topicOwnedBy returns true if the visitor is the owner of the topic, i.e. if the visitor's user reserved
+// the topic, or if the user is an admin. Without access control, there are no topic owners.
+func (s *Server) topicOwnedBy(v *visitor, topic string) (bool, error) {
+	u := v.User()
+	if s.userManager == nil || u == nil {
+		return false, nil
+	} else if u.IsAdmin() {
+		return true, nil
+	}
+	ownerUserID, err := s.userManager.ReservationOwner(topic)
+	if err != nil {
+		return false, err
+	}
+	return ownerUserID == u.ID, nil
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request, _ *visitor) error {
 	response := &apiHealthResponse{
 		Healthy: true,
@@ -606,21 +1109,64 @@ func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request, _ *visitor
 	return s.writeJSON(w, response)
 }
 
+func (s *Server) handleCapabilities(w http.ResponseWriter, _ *http.Request, _ *visitor) error {
+	response := &apiCapabilitiesResponse{
+		Version:                 s.config.Version,
+		Capabilities:            s.capabilities(),
+		MessageSizeLimit:        s.config.MessageSizeLimit,
+		MessageChunkedSizeLimit: s.config.MessageChunkedSizeLimit,
+		WebPushPublicKey:        s.config.WebPushPublicKey,
+	}
+	return s.writeJSON(w, response)
+}
+
+// capabilities returns the features supported by this server, depending on the config, see apiCapabilitiesPath
+func (s *Server) capabilities() []string {
+	capabilities := []string{capabilityMarkdown, capabilityTemplates, capabilityActions, capabilityScheduled}
+	if s.fileCache != nil {
+		capabilities = append(capabilities, capabilityAttachments)
+	}
+	if s.smtpSender != nil {
+		capabilities = append(capabilities, capabilityEmail)
+	}
+	if s.config.TwilioAccount != "" && s.userManager != nil {
+		capabilities = append(capabilities, capabilityCalls)
+	}
+	if s.config.WebPushPublicKey != "" {
+		capabilities = append(capabilities, capabilityWebPush)
+	}
+	if s.userManager != nil {
+		capabilities = append(capabilities, capabilityAccessControl, capabilityPresence)
+	}
+	if s.chunks != nil {
+		capabilities = append(capabilities, capabilityChunked)
+	}
+	if s.uploads != nil && s.config.BaseURL != "" {
+		capabilities = append(capabilities, capabilityUploads)
+	}
+	if s.config.CacheDuration > 0 {
+		capabilities = append(capabilities, capabilityClaims)
+	}
+	capabilities = append(capabilities, capabilityEphemeral)
+	return capabilities
+}
+
 func (s *Server) handleWebConfig(w http.ResponseWriter, _ *http.Request, _ *visitor) error {
 	response := &apiConfigResponse{
-		BaseURL:            "", // Will translate to window.location.origin
-		AppRoot:            s.config.WebRoot,
-		EnableLogin:        s.config.EnableLogin,
-		RequireLogin:       s.config.RequireLogin,
-		EnableSignup:       s.config.EnableSignup,
-		EnablePayments:     s.config.StripeSecretKey != "",
-		EnableCalls:        s.config.TwilioAccount != "",
-		EnableEmails:       s.config.SMTPSenderFrom != "",
-		EnableReservations: s.config.EnableReservations,
-		EnableWebPush:      s.config.WebPushPublicKey != "",
-		BillingContact:     s.config.BillingContact,
-		WebPushPublicKey:   s.config.WebPushPublicKey,
-		DisallowedTopics:   s.config.DisallowedTopics,
+		BaseURL:             "", // Will translate to window.location.origin
+		AppRoot:             s.config.WebRoot,
+		EnableLogin:         s.config.EnableLogin,
+		RequireLogin:        s.config.RequireLogin,
+		EnableSignup:        s.config.EnableSignup,
+		EnablePasswordReset: s.config.EnablePasswordReset && s.smtpSender != nil,
+		EnablePayments:      s.config.StripeSecretKey != "",
+		EnableCalls:         s.config.TwilioAccount != "",
+		EnableEmails:        s.config.SMTPSenderFrom != "",
+		EnableReservations:  s.config.EnableReservations,
+		EnableWebPush:       s.config.WebPushPublicKey != "",
+		BillingContact:      s.config.BillingContact,
+		WebPushPublicKey:    s.config.WebPushPublicKey,
+		DisallowedTopics:    s.config.DisallowedTopics,
 	}
 	b, err := json.MarshalIndent(response, "", "  ")
 	if err != nil {
@@ -671,18 +1217,36 @@ func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request, _ *visitor)
 	return nil
 }
 
-// handleStats returns the publicly available server stats
-func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request, _ *visitor) error {
+// handleStats returns the publicly available server stats. Admins and users with the stats-read
+// capability additionally see the number of active topics, visitors, users and reservations.
+func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request, v *visitor) error {
 	s.mu.RLock()
 	messages, n, rate := s.messages, len(s.messagesHistory), float64(0)
 	if n > 1 {
 		rate = float64(s.messagesHistory[n-1]-s.messagesHistory[0]) / (float64(n-1) * s.config.ManagerInterval.Seconds())
 	}
+	visitors := len(s.visitors)
 	s.mu.RUnlock()
 	response := &apiStatsResponse{
 		Messages:     messages,
 		MessagesRate: rate,
 	}
+	if s.userManager != nil && v.User().HasCapability(user.CapabilityStatsRead) {
+		users, err := s.userManager.Users()
+		if err != nil {
+			return err
+		}
+		reservations, err := s.userManager.AllReservations()
+		if err != nil {
+			return err
+		}
+		response.Topics = s.topics.Len()
+		response.Visitors = visitors
+		response.Users = len(users)
+		for _, r := range reservations {
+			response.Reservations += len(r)
+		}
+	}
 	return s.writeJSON(w, response)
 }
 
@@ -766,7 +1330,7 @@ func (s *Server) handleMatrixDiscovery(w http.ResponseWriter) error {
 	return writeMatrixDiscoveryResponse(w)
 }
 
-func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, error) {
+func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (m *message, err error) {
 	start := time.Now()
 	t, err := fromContext[*topic](r, contextTopic)
 	if err != nil {
@@ -776,15 +1340,83 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 	if err != nil {
 		return nil, err
 	}
-	body, err := util.Peek(r.Body, s.config.MessageSizeLimit)
-	if err != nil {
-		return nil, err
+	chunk, e := parseChunkParams(r)
+	if e != nil {
+		return nil, e.With(t)
+	}
+	uploadID := readParam(r, "x-upload", "upload")
+	if uploadID != "" && (s.uploads == nil || chunk != nil) {
+		return nil, errHTTPBadRequestUploadIncomplete.With(t)
+	}
+	var body *util.PeekedReadCloser
+	if chunk == nil {
+		body, err = util.Peek(r.Body, s.config.MessageSizeLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e := s.verifyMessageSignature(r, t, body, uploadID != ""); e != nil {
+		return nil, e.With(t)
 	}
-	m := newDefaultMessage(t.ID, "")
+	defer func(topicID string) {
+		if err != nil {
+			s.releaseMessageSignature(r, topicID) // Message was rejected, the signed request may be retried
+		}
+	}(t.ID)
+	if chunk == nil {
+		key, e := parseIdempotencyKey(r)
+		if e != nil {
+			return nil, e.With(t)
+		} else if key != "" {
+			owner := visitorOwner(v)
+			if original, err := s.idempotencyKeys.Reserve(r.Context(), t.ID, owner, key); err != nil {
+				return nil, err
+			} else if original != nil {
+				logvr(v, r).Tag(tagPublish).With(t).Debug("Message with idempotency key %s already published as %s, not publishing again", key, original.ID)
+				return original, nil
+			}
+			defer func(topicID string) { // Topic may change if the message is routed, see routeMessage
+				if err != nil {
+					s.idempotencyKeys.Release(topicID, owner, key, nil)
+				} else {
+					s.idempotencyKeys.Release(topicID, owner, key, m)
+				}
+			}(t.ID)
+		}
+	}
+	if chunk != nil {
+		body, err = s.addMessageChunk(r, t, v, chunk)
+		if err != nil {
+			return nil, err
+		} else if body == nil {
+			return newChunkMessage(t.ID, chunk.ID), nil // Incomplete, wait for the remaining chunks
+		}
+	}
+	m = newDefaultMessage(t.ID, "")
 	cache, firebase, email, call, template, unifiedpush, e := s.parsePublishParams(r, m)
 	if e != nil {
 		return nil, e.With(t)
 	}
+	if m.PollID == "" {
+		topicID := t.ID
+		t, err = s.routeMessage(r, v, t, m, body)
+		if err != nil {
+			return nil, err
+		} else if t.ID != topicID {
+			// Routed messages must be signed for the target topic, if it is an HMAC topic
+			if e := s.verifyMessageSignature(r, t, body, uploadID != "" || chunk != nil); e != nil {
+				return nil, e.With(t)
+			}
+			defer func(topicID string) {
+				if err != nil {
+					s.releaseMessageSignature(r, topicID)
+				}
+			}(t.ID)
+		}
+		if e := s.admitMessage(m); e != nil {
+			return nil, e.With(t)
+		}
+	}
 	if unifiedpush && s.config.VisitorSubscriberRateLimiting && t.RateVisitor() == nil {
 		// UnifiedPush clients must subscribe before publishing to allow proper subscriber-based rate limiting.
 		// The 5xx response is because some app servers (in particular Mastodon) will remove
@@ -804,26 +1436,37 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 			return nil, errHTTPTooManyRequestsLimitCalls.With(t)
 		}
 	}
+	if err := s.countEphemeralTopicMessage(t); err != nil {
+		return nil, err
+	}
 	if m.PollID != "" {
 		m = newPollRequestMessage(t.ID, m.PollID)
+	} else if e := s.validateTopicSchema(r, m, body); e != nil {
+		return nil, e.With(t)
 	}
 	m.Sender = v.IP()
 	m.User = v.MaybeUserID()
 	if cache {
 		m.Expires = time.Unix(m.Time, 0).Add(v.Limits().MessageExpiryDuration).Unix()
 	}
-	if err := s.handlePublishBody(r, v, m, body, template, unifiedpush); err != nil {
+	if uploadID != "" {
+		if err := s.handleUploadAsAttachment(r, v, m, uploadID); err != nil {
+			return nil, err
+		}
+	} else if err := s.handlePublishBody(r, v, m, body, template, unifiedpush); err != nil {
 		return nil, err
 	}
 	if m.Message == "" {
 		m.Message = emptyMessageBody
 	}
 	delayed := m.Time > time.Now().Unix()
+	silenced := !delayed && s.topicSilenced(t.ID)
 	ev := logvrm(v, r, m).
 		Tag(tagPublish).
 		With(t).
 		Fields(log.Context{
 			"message_delayed":     delayed,
+			"message_silenced":    silenced,
 			"message_firebase":    firebase,
 			"message_unifiedpush": unifiedpush,
 			"message_email":       email,
@@ -835,23 +1478,34 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 		ev.Debug("Received message")
 	}
 	if !delayed {
+		if cache {
+			s.messageCache.ExpectMessage(m.ID) // Long polls wait for the message to be cached, see longPoll
+		}
 		if err := t.Publish(v, m); err != nil {
+			s.messageCache.markWritten([]*message{m})
 			return nil, err
 		}
-		if s.firebaseClient != nil && firebase {
-			go s.sendToFirebase(v, m)
-		}
-		if s.smtpSender != nil && email != "" {
-			go s.sendEmail(v, m, email)
-		}
-		if s.config.TwilioAccount != "" && call != "" {
-			go s.callPhone(v, r, m, call)
-		}
-		if s.config.UpstreamBaseURL != "" && !unifiedpush { // UP messages are not sent to upstream
-			go s.forwardPollRequest(v, m)
-		}
-		if s.config.WebPushPublicKey != "" {
-			go s.publishToWebPushEndpoints(v, m)
+		if silenced {
+			logvrm(v, r, m).Tag(tagPublish).Debug("Topic is silenced, not forwarding message")
+		} else {
+			if s.firebaseClient != nil && firebase {
+				go s.sendToFirebase(v, m)
+			}
+			if s.smtpSender != nil && email != "" {
+				go s.sendEmail(v, m, email, s.language(v.User(), r))
+			}
+			if s.config.TwilioAccount != "" && call != "" {
+				go s.callPhone(v, r, m, call)
+			}
+			if s.config.UpstreamBaseURL != "" && !unifiedpush { // UP messages are not sent to upstream
+				go s.forwardPollRequest(v, m)
+			}
+			if s.config.WebPushPublicKey != "" {
+				go s.publishToWebPushEndpoints(v, m)
+			}
+			if len(s.config.OutboundWebhooks) > 0 {
+				go s.sendOutboundWebhooks(v, m)
+			}
 		}
 	} else {
 		logvrm(v, r, m).Tag(tagPublish).Debug("Message delayed, will process later")
@@ -861,6 +1515,9 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 		if err := s.messageCache.AddMessage(m); err != nil {
 			return nil, err
 		}
+		if !delayed && !silenced {
+			s.scheduleEscalation(v, m)
+		}
 	}
 	u := v.User()
 	if s.userManager != nil && u != nil && u.Tier != nil {
@@ -876,6 +1533,29 @@ func (s *Server) handlePublishInternal(r *http.Request, v *visitor) (*message, e
 	return m, nil
 }
 
+// addMessageChunk stores the request body as a chunk of a chunked message (see chunkStore). If the message is
+// complete, the reassembled message is returned as the new body, so that it can be published like any other message.
+// Otherwise, nil is returned. Chunks may be up to message-size-limit bytes.
+func (s *Server) addMessageChunk(r *http.Request, t *topic, v *visitor, chunk *chunkParams) (*util.PeekedReadCloser, error) {
+	if s.chunks == nil {
+		return nil, errHTTPBadRequestChunkInvalid.With(t)
+	}
+	body, err := util.Peek(r.Body, s.config.MessageSizeLimit+1)
+	if err != nil {
+		return nil, err
+	} else if body.LimitReached {
+		return nil, errHTTPEntityTooLargeChunkedMessage.With(t)
+	}
+	message, e := s.chunks.Add(t.ID, visitorOwner(v), chunk, body.PeekedBytes)
+	if e != nil {
+		return nil, e.With(t)
+	} else if message == nil {
+		logvr(v, r).Tag(tagPublish).With(t).Debug("Received chunk %d/%d of chunked message %s", chunk.Index, chunk.Count, chunk.ID)
+		return nil, nil
+	}
+	return util.Peek(io.NopCloser(bytes.NewReader(message)), len(message)+1)
+}
+
 func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request, v *visitor) error {
 	m, err := s.handlePublishInternal(r, v)
 	if err != nil {
@@ -883,9 +1563,30 @@ func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request, v *visito
 		return err
 	}
 	minc(metricMessagesPublishedSuccess)
+	if err := s.maybeSetTopicRenamedHeaders(w, r); err != nil {
+		return err
+	}
 	return s.writeJSON(w, m)
 }
 
+// maybeSetTopicRenamedHeaders sets the Deprecation and Link headers if the message was published to a deprecated
+// alias of a renamed topic, telling the publisher to switch to the current topic name, see handleAccountReservationRename
+func (s *Server) maybeSetTopicRenamedHeaders(w http.ResponseWriter, r *http.Request) error {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 2 {
+		return nil
+	}
+	alias, err := s.topicAlias(parts[1])
+	if err != nil {
+		return err
+	} else if alias == nil || !alias.Deprecated {
+		return nil
+	}
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", fmt.Sprintf(`<%s/%s>; rel="successor-version"`, s.config.BaseURL, alias.Topic))
+	return nil
+}
+
 func (s *Server) handlePublishMatrix(w http.ResponseWriter, r *http.Request, v *visitor) error {
 	_, err := s.handlePublishInternal(r, v)
 	if err != nil {
@@ -912,22 +1613,28 @@ func (s *Server) handlePublishMatrix(w http.ResponseWriter, r *http.Request, v *
 }
 
 func (s *Server) sendToFirebase(v *visitor, m *message) {
-	logvm(v, m).Tag(tagFirebase).Debug("Publishing to Firebase")
-	if err := s.firebaseClient.Send(v, m); err != nil {
-		minc(metricFirebasePublishedFailure)
-		if errors.Is(err, errFirebaseTemporarilyBanned) {
-			logvm(v, m).Tag(tagFirebase).Err(err).Debug("Unable to publish to Firebase: %v", err.Error())
-		} else {
-			logvm(v, m).Tag(tagFirebase).Err(err).Warn("Unable to publish to Firebase: %v", err.Error())
+	for _, m := range s.withTopicAliasMessages(v, m) {
+		logvm(v, m).Tag(tagFirebase).Debug("Publishing to Firebase")
+		if err := s.firebaseClient.Send(v, m); err != nil {
+			minc(metricFirebasePublishedFailure)
+			if errors.Is(err, errFirebaseTemporarilyBanned) {
+				logvm(v, m).Tag(tagFirebase).Err(err).Debug("Unable to publish to Firebase: %v", err.Error())
+			} else {
+				logvm(v, m).Tag(tagFirebase).Err(err).Warn("Unable to publish to Firebase: %v", err.Error())
+			}
+			continue
 		}
-		return
+		minc(metricFirebasePublishedSuccess)
 	}
-	minc(metricFirebasePublishedSuccess)
 }
 
-func (s *Server) sendEmail(v *visitor, m *message, email string) {
+func (s *Server) sendEmail(v *visitor, m *message, email, lang string) {
+	if s.topicMutedByEmail(m.Topic, email) {
+		logvm(v, m).Tag(tagEmail).Field("email", email).Debug("Not sending email to %s, topic is muted", email)
+		return
+	}
 	logvm(v, m).Tag(tagEmail).Field("email", email).Debug("Sending email to %s", email)
-	if err := s.smtpSender.Send(v, m, email); err != nil {
+	if err := s.smtpSender.Send(v, m, email, lang); err != nil {
 		logvm(v, m).Tag(tagEmail).Field("email", email).Err(err).Warn("Unable to send email to %s: %v", email, err.Error())
 		minc(metricEmailsPublishedFailure)
 		return
@@ -1025,11 +1732,19 @@ func (s *Server) parsePublishParams(r *http.Request, m *message) (cache bool, fi
 		m.Message = messageStr
 	}
 	var e error
-	m.Priority, e = util.ParsePriority(readParam(r, "x-priority", "priority", "prio", "p"))
+	priority := readParam(r, "x-priority", "priority", "prio", "p")
+	m.Priority, e = util.ParsePriority(priority)
 	if e != nil {
-		return false, false, "", "", "", false, errHTTPBadRequestPriorityInvalid
+		return false, false, "", "", "", false, errHTTPBadRequestPriorityInvalid.Wrap("%s", util.DescribeInvalidPriority(priority))
+	}
+	m.Tags, err = readTagsParam(r, "x-tags", "tags", "tag", "ta")
+	if err != nil {
+		return false, false, "", "", "", false, err
+	}
+	m.Metadata, err = readMetadataParams(r)
+	if err != nil {
+		return false, false, "", "", "", false, err
 	}
-	m.Tags = readCommaSeparatedParam(r, "x-tags", "tags", "tag", "ta")
 	delayStr := readParam(r, "x-delay", "delay", "x-at", "at", "x-in", "in")
 	if delayStr != "" {
 		if !cache {
@@ -1077,6 +1792,39 @@ func (s *Server) parsePublishParams(r *http.Request, m *message) (cache bool, fi
 	return cache, firebase, email, call, template, unifiedpush, nil
 }
 
+// validateTopicSchema validates the message body against the JSON schema attached to the topic (see
+// handleAccountTopicSchemaChange), if the topic has a schema and the message was published with a JSON
+// content type. Depending on the schema mode, messages that do not match are rejected, or tagged with
+// topicSchemaMismatchTag. Attachments are never validated.
+func (s *Server) validateTopicSchema(r *http.Request, m *message, body *util.PeekedReadCloser) *errHTTP {
+	if s.userManager == nil || m.Attachment != nil || !isJSONContentType(r.Header.Get("Content-Type")) {
+		return nil
+	}
+	topicSchema, err := s.userManager.TopicSchema(m.Topic)
+	if errors.Is(err, user.ErrTopicSchemaNotFound) {
+		return nil
+	} else if err != nil {
+		return errHTTPInternalError.Wrap("cannot read topic schema: %s", err.Error())
+	}
+	schema, err := util.ParseJSONSchema([]byte(topicSchema.Schema))
+	if err != nil {
+		return errHTTPInternalError.Wrap("cannot parse topic schema: %s", err.Error())
+	}
+	if body.LimitReached {
+		err = errors.New("message too large")
+	} else {
+		err = schema.Validate(body.PeekedBytes)
+	}
+	if err == nil {
+		return nil
+	} else if topicSchema.Mode == user.SchemaModeTag {
+		logr(r).Tag(tagPublish).Field("topic", m.Topic).Debug("Message does not match topic schema, tagging it: %s", err.Error())
+		m.Tags = append(m.Tags, topicSchemaMismatchTag)
+		return nil
+	}
+	return errHTTPBadRequestTopicSchemaMismatch.Wrap("%s", err.Error())
+}
+
 // handlePublishBody consumes the PUT/POST body and decides whether the body is an attachment or the message.
 //
 //  1. curl -X POST -H "Poll: 1234" ntfy.sh/...
@@ -1255,9 +2003,15 @@ func (s *Server) handleBodyAsAttachment(r *http.Request, v *visitor, m *message,
 	if m.Attachment == nil {
 		m.Attachment = &attachment{}
 	}
-	var ext string
 	m.Attachment.Expires = attachmentExpiry
-	m.Attachment.Type, ext = util.DetectContentType(body.PeekedBytes, m.Attachment.Name)
+	mimeType, ext, in, err := util.SniffContentType(body, m.Attachment.Name)
+	if err != nil {
+		return err
+	}
+	m.Attachment.Type = mimeType
+	if !attachmentTypeAllowed(vinfo.Limits.AttachmentAllowedTypes, vinfo.Limits.AttachmentDeniedTypes, m.Attachment.Type) {
+		return errHTTPUnsupportedMediaTypeAttachment.Wrap("%s", m.Attachment.Type).With(m)
+	}
 	m.Attachment.URL = fmt.Sprintf("%s/file/%s%s", s.config.BaseURL, m.ID, ext)
 	if m.Attachment.Name == "" {
 		m.Attachment.Name = fmt.Sprintf("attachment%s", ext)
@@ -1270,7 +2024,7 @@ func (s *Server) handleBodyAsAttachment(r *http.Request, v *visitor, m *message,
 		util.NewFixedLimiter(vinfo.Limits.AttachmentFileSizeLimit),
 		util.NewFixedLimiter(vinfo.Stats.AttachmentTotalSizeRemaining),
 	}
-	m.Attachment.Size, err = s.fileCache.Write(m.ID, body, limiters...)
+	m.Attachment.Size, err = s.fileCache.Write(m.ID, in, limiters...)
 	if errors.Is(err, util.ErrLimitReached) {
 		return errHTTPEntityTooLargeAttachment.With(m)
 	} else if err != nil {
@@ -1280,6 +2034,12 @@ func (s *Server) handleBodyAsAttachment(r *http.Request, v *visitor, m *message,
 }
 
 func (s *Server) handleSubscribeJSON(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	if acceptsProtobuf(r) {
+		encoder := func(msg *message) (string, error) {
+			return string(encodeProtobufMessage(msg)), nil
+		}
+		return s.handleSubscribeHTTP(w, r, v, protobufContentType, encoder)
+	}
 	encoder := func(msg *message) (string, error) {
 		var buf bytes.Buffer
 		if err := json.NewEncoder(&buf).Encode(&msg); err != nil {
@@ -1299,7 +2059,7 @@ func (s *Server) handleSubscribeSSE(w http.ResponseWriter, r *http.Request, v *v
 		if msg.Event != messageEvent {
 			return fmt.Sprintf("event: %s\ndata: %s\n", msg.Event, buf.String()), nil // Browser's .onmessage() does not fire on this!
 		}
-		return fmt.Sprintf("data: %s\n", buf.String()), nil
+		return fmt.Sprintf("id: %s\ndata: %s\n", msg.Resume, buf.String()), nil // Browser sends the ID as Last-Event-ID on reconnect
 	}
 	return s.handleSubscribeHTTP(w, r, v, "text/event-stream", encoder)
 }
@@ -1325,10 +2085,18 @@ func (s *Server) handleSubscribeHTTP(w http.ResponseWriter, r *http.Request, v *
 	if err != nil {
 		return err
 	}
+	aliases, err := s.topicAliases(topicsStr)
+	if err != nil {
+		return err
+	}
 	poll, since, scheduled, filters, err := parseSubscribeParams(r)
 	if err != nil {
 		return err
 	}
+	wait, err := parseLongPollWait(r)
+	if err != nil {
+		return err
+	}
 	var wlock sync.Mutex
 	defer func() {
 		// Hack: This is the fix for a horrible data race that I have not been able to figure out in quite some time.
@@ -1337,10 +2105,18 @@ func (s *Server) handleSubscribeHTTP(w http.ResponseWriter, r *http.Request, v *
 		// data race detector. See https://github.com/binwiederhier/ntfy/issues/338#issuecomment-1163425889.
 		wlock.TryLock()
 	}()
-	sub := func(v *visitor, msg *message) error {
+	lag := s.subscriberLags.Add(subscriberProtocolHTTP)
+	defer s.subscriberLags.Remove(lag)
+	sub := func(v *visitor, msg *message) (err error) {
 		if !filters.Pass(msg) {
 			return nil
 		}
+		done := lag.Begin(msg)
+		defer func() {
+			if done(err == nil) {
+				logvrm(v, r, msg).Tag(tagSubscribe).Warn("Slow subscriber: message was written %s after it was published", time.Since(msg.published).Round(time.Millisecond))
+			}
+		}()
 		m, err := encoder(msg)
 		if err != nil {
 			return err
@@ -1355,15 +2131,22 @@ func (s *Server) handleSubscribeHTTP(w http.ResponseWriter, r *http.Request, v *
 		}
 		return nil
 	}
+	sub = withResumeTokens(withTopicAliases(sub, aliases))
 	if err := s.maybeSetRateVisitors(r, v, topics); err != nil {
 		return err
 	}
+	if contentType != protobufContentType {
+		contentType += "; charset=utf-8" // Android/Volley client needs charset!
+	}
 	w.Header().Set("Access-Control-Allow-Origin", s.config.AccessControlAllowOrigin) // CORS, allow cross-origin requests
-	w.Header().Set("Content-Type", contentType+"; charset=utf-8")                    // Android/Volley client needs charset!
-	if poll {
+	w.Header().Set("Content-Type", contentType)
+	if poll || wait > 0 {
 		for _, t := range topics {
 			t.Keepalive()
 		}
+		if wait > 0 {
+			return s.longPoll(r, v, topics, since, scheduled, filters, wait, sub)
+		}
 		return s.sendOldMessages(topics, since, scheduled, v, sub)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
@@ -1377,7 +2160,10 @@ func (s *Server) handleSubscribeHTTP(w http.ResponseWriter, r *http.Request, v *
 			topics[i].Unsubscribe(subscriberID) // Order!
 		}
 	}()
-	if err := sub(v, newOpenMessage(topicsStr)); err != nil { // Send out open message
+	if err := sub(v, s.newOpenMessage(v, topics, topicsStr)); err != nil { // Send out open message
+		return err
+	}
+	if err := sendTopicRenamedMessages(v, aliases, sub); err != nil {
 		return err
 	}
 	if err := s.sendOldMessages(topics, since, scheduled, v, sub); err != nil {
@@ -1407,6 +2193,63 @@ func (s *Server) handleSubscribeHTTP(w http.ResponseWriter, r *http.Request, v *
 	}
 }
 
+// longPoll sends all messages since the given marker, or, if there are none, waits up to the given duration for
+// the next message to arrive. This is meant for networks in which middleboxes break both HTTP streaming and
+// WebSockets. Clients continue with the next long poll, passing the ID of the last received message as since marker.
+func (s *Server) longPoll(r *http.Request, v *visitor, topics []*topic, since sinceMarker, scheduled bool, filters *queryFilter, wait time.Duration, sub subscriber) error {
+	var mu sync.Mutex
+	sent := make(map[string]bool) // Messages may be received live and from the cache, but must only be sent once
+	if since.IsID() {
+		sent[since.ID()] = true // The client already has this message, but it may still be forwarded to subscribers
+	}
+	var lastID string
+	received := make(chan struct{}, 1)
+	subOnce := func(v *visitor, msg *message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if sent[msg.ID] || !filters.Pass(msg) {
+			return nil
+		}
+		sent[msg.ID] = true
+		if err := sub(v, msg); err != nil {
+			return err
+		}
+		lastID = msg.ID
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscriberIDs := make([]int, 0)
+	for _, t := range topics {
+		subscriberIDs = append(subscriberIDs, t.Subscribe(subOnce, v.MaybeUserID(), cancel))
+	}
+	defer func() {
+		for i, subscriberID := range subscriberIDs {
+			topics[i].Unsubscribe(subscriberID) // Order!
+		}
+	}()
+	if err := s.sendOldMessages(topics, since, scheduled, v, subOnce); err != nil {
+		return err
+	}
+	select {
+	case <-received:
+		mu.Lock()
+		id := lastID
+		mu.Unlock()
+		// Without this, the client's next request with since=<id> may not find the ID in the cache, and would
+		// receive all cached messages again
+		s.messageCache.WaitForMessage(r.Context(), id, longPollCacheWait)
+	case <-ctx.Done():
+	case <-r.Context().Done():
+	case <-time.After(wait):
+	}
+	return nil
+}
+
 func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *visitor) error {
 	if strings.ToLower(r.Header.Get("Upgrade")) != "websocket" {
 		return errHTTPBadRequestWebSocketsUpgradeHeaderMissing
@@ -1421,6 +2264,10 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 	if err != nil {
 		return err
 	}
+	aliases, err := s.topicAliases(topicsStr)
+	if err != nil {
+		return err
+	}
 	poll, since, scheduled, filters, err := parseSubscribeParams(r)
 	if err != nil {
 		return err
@@ -1496,10 +2343,18 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 			}
 		}
 	})
-	sub := func(v *visitor, msg *message) error {
+	lag := s.subscriberLags.Add(subscriberProtocolWebSocket)
+	defer s.subscriberLags.Remove(lag)
+	sub := func(v *visitor, msg *message) (err error) {
 		if !filters.Pass(msg) {
 			return nil
 		}
+		done := lag.Begin(msg)
+		defer func() {
+			if done(err == nil) {
+				logvrm(v, r, msg).Tag(tagWebsocket).Warn("Slow subscriber: message was written %s after it was published", time.Since(msg.published).Round(time.Millisecond))
+			}
+		}()
 		wlock.Lock()
 		defer wlock.Unlock()
 		if err := conn.SetWriteDeadline(time.Now().Add(wsWriteWait)); err != nil {
@@ -1507,6 +2362,7 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 		}
 		return conn.WriteJSON(msg)
 	}
+	sub = withResumeTokens(withTopicAliases(sub, aliases))
 	if err := s.maybeSetRateVisitors(r, v, topics); err != nil {
 		return err
 	}
@@ -1526,7 +2382,10 @@ func (s *Server) handleSubscribeWS(w http.ResponseWriter, r *http.Request, v *vi
 			topics[i].Unsubscribe(subscriberID) // Order!
 		}
 	}()
-	if err := sub(v, newOpenMessage(topicsStr)); err != nil { // Send out open message
+	if err := sub(v, s.newOpenMessage(v, topics, topicsStr)); err != nil { // Send out open message
+		return err
+	}
+	if err := sendTopicRenamedMessages(v, aliases, sub); err != nil {
 		return err
 	}
 	if err := s.sendOldMessages(topics, since, scheduled, v, sub); err != nil {
@@ -1554,6 +2413,20 @@ func parseSubscribeParams(r *http.Request) (poll bool, since sinceMarker, schedu
 	return
 }
 
+// parseLongPollWait returns the maximum time a long poll request waits for new messages (see longPoll),
+// or zero if the request is not a long poll request
+func parseLongPollWait(r *http.Request) (time.Duration, error) {
+	waitStr := readParam(r, "x-wait", "wait")
+	if waitStr == "" {
+		return 0, nil
+	}
+	wait, err := util.ParseDuration(waitStr)
+	if err != nil || wait <= 0 || wait > longPollMaxWait {
+		return 0, errHTTPBadRequestWaitInvalid
+	}
+	return wait, nil
+}
+
 // maybeSetRateVisitors sets the rate visitor on a topic (v.SetRateVisitor), indicating that all messages published
 // to that topic will be rate limited against the rate visitor instead of the publishing visitor.
 //
@@ -1598,7 +2471,7 @@ func (s *Server) maybeSetRateVisitors(r *http.Request, v *visitor, topics []*top
 			return err
 		}
 		if ownerUserID == "" {
-			if err := s.userManager.Authorize(v.User(), t.ID, user.PermissionWrite); err == nil {
+			if err := s.authorizeVisitor(v, t.ID, user.PermissionWrite); err == nil {
 				writableRateTopics = append(writableRateTopics, t)
 			}
 		} else if ownerUserID == v.MaybeUserID() {
@@ -1633,7 +2506,7 @@ func (s *Server) sendOldMessages(topics []*topic, since sinceMarker, scheduled b
 		}
 		messages = append(messages, topicMessages...)
 	}
-	sort.Slice(messages, func(i, j int) bool {
+	sort.SliceStable(messages, func(i, j int) bool { // Stable, to keep the order of messages in the same second
 		return messages[i].Time < messages[j].Time
 	})
 	for _, m := range messages {
@@ -1651,7 +2524,10 @@ func (s *Server) sendOldMessages(topics []*topic, since sinceMarker, scheduled b
 func parseSince(r *http.Request, poll bool) (sinceMarker, error) {
 	since := readParam(r, "x-since", "since", "si")
 
-	// Easy cases (empty, all, none)
+	// Easy cases (empty, all, none); EventSource passes the last resume token as Last-Event-ID when reconnecting
+	if since == "" {
+		since = r.Header.Get("Last-Event-ID")
+	}
 	if since == "" {
 		if poll {
 			return sinceAllMessages, nil
@@ -1665,9 +2541,11 @@ func parseSince(r *http.Request, poll bool) (sinceMarker, error) {
 		return sinceNoMessages, nil
 	}
 
-	// ID, timestamp, duration
+	// ID, resume token, timestamp, duration
 	if validMessageID(since) {
 		return newSinceID(since), nil
+	} else if marker, ok := parseResumeToken(since); ok {
+		return marker, nil
 	} else if s, err := strconv.ParseInt(since, 10, 64); err == nil {
 		return newSinceTime(s), nil
 	} else if d, err := time.ParseDuration(since); err == nil {
@@ -1706,26 +2584,123 @@ func (s *Server) topicsFromPath(path string) ([]*topic, string, error) {
 	return topics, parts[1], nil
 }
 
-// topicsFromIDs returns the topics with the given IDs, creating them if they don't exist.
+// topicsFromIDs returns the topics with the given IDs, creating them if they don't exist. Aliases of
+// renamed topics are resolved to the current topic, see topicAlias.
 func (s *Server) topicsFromIDs(ids ...string) ([]*topic, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 	topics := make([]*topic, 0)
 	for _, id := range ids {
 		if util.Contains(s.config.DisallowedTopics, id) {
 			return nil, errHTTPBadRequestTopicDisallowed
 		}
-		if _, ok := s.topics[id]; !ok {
-			if len(s.topics) >= s.config.TotalTopicLimit {
-				return nil, errHTTPTooManyRequestsLimitTotalTopics
-			}
-			s.topics[id] = newTopic(id)
+		alias, err := s.topicAlias(id)
+		if err != nil {
+			return nil, err
+		} else if alias != nil {
+			id = alias.Topic
 		}
-		topics = append(topics, s.topics[id])
+		t, err := s.topics.GetOrCreate(id, s.config.TotalTopicLimit)
+		if errors.Is(err, errTopicLimitReached) {
+			return nil, errHTTPTooManyRequestsLimitTotalTopics
+		} else if err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
 	}
 	return topics, nil
 }
 
+// topicAlias returns the alias with the given name if the topic was renamed by its owner (see
+// handleAccountReservationRename), or nil if the topic is not an alias
+func (s *Server) topicAlias(id string) (*user.TopicAlias, error) {
+	if s.userManager == nil {
+		return nil, nil
+	}
+	alias, err := s.userManager.TopicAlias(id)
+	if errors.Is(err, user.ErrTopicAliasNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return alias, nil
+}
+
+// topicAliases returns the aliases among the topics in the given comma-separated list (e.g. "mytopic,mytopic2"),
+// keyed by the current topic name
+func (s *Server) topicAliases(topicsStr string) (map[string]*user.TopicAlias, error) {
+	aliases := make(map[string]*user.TopicAlias)
+	for _, id := range util.SplitNoEmpty(topicsStr, ",") {
+		alias, err := s.topicAlias(id)
+		if err != nil {
+			return nil, err
+		} else if alias != nil {
+			aliases[alias.Topic] = alias
+		}
+	}
+	return aliases, nil
+}
+
+// withTopicAliases wraps a subscriber, so that messages are delivered with the topic name the client subscribed
+// to, i.e. with the alias instead of the current topic name. Clients match messages to subscriptions by topic.
+func withTopicAliases(sub subscriber, aliases map[string]*user.TopicAlias) subscriber {
+	if len(aliases) == 0 {
+		return sub
+	}
+	return func(v *visitor, msg *message) error {
+		if alias, ok := aliases[msg.Topic]; ok {
+			m := *msg
+			m.Topic = alias.Alias
+			msg = &m
+		}
+		return sub(v, msg)
+	}
+}
+
+// withResumeTokens wraps a subscriber, so that messages are delivered with their resume token, see resumeToken
+func withResumeTokens(sub subscriber) subscriber {
+	return func(v *visitor, msg *message) error {
+		if msg.Event == messageEvent {
+			m := *msg
+			m.Resume = resumeToken(msg)
+			msg = &m
+		}
+		return sub(v, msg)
+	}
+}
+
+// withTopicAliasMessages returns the message, plus a copy of the message for every alias of the message's topic.
+// This is used for push notifications (Firebase, web push), which are addressed by topic name, so that clients
+// that are still subscribed to the old topic name receive messages after a topic was renamed.
+func (s *Server) withTopicAliasMessages(v *visitor, m *message) []*message {
+	messages := []*message{m}
+	if s.userManager == nil || m.Event != messageEvent {
+		return messages
+	}
+	aliases, err := s.userManager.AliasesForTopic(m.Topic)
+	if err != nil {
+		logvm(v, m).Err(err).Warn("Unable to read topic aliases")
+		return messages
+	}
+	for _, alias := range aliases {
+		am := *m
+		am.Topic = alias.Alias
+		messages = append(messages, &am)
+	}
+	return messages
+}
+
+// sendTopicRenamedMessages sends a topic_renamed event for every deprecated alias, telling the client
+// to subscribe to the current topic name instead
+func sendTopicRenamedMessages(v *visitor, aliases map[string]*user.TopicAlias, sub subscriber) error {
+	for _, alias := range aliases {
+		if alias.Deprecated {
+			if err := sub(v, newTopicRenamedMessage(alias)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // topicFromID returns the topic with the given ID, creating it if it doesn't exist.
 func (s *Server) topicFromID(id string) (*topic, error) {
 	topics, err := s.topicsFromIDs(id)
@@ -1737,18 +2712,17 @@ func (s *Server) topicFromID(id string) (*topic, error) {
 
 // topicsFromPattern returns a list of topics matching the given pattern, but it does not create them.
 func (s *Server) topicsFromPattern(pattern string) ([]*topic, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
 	patternRegexp, err := regexp.Compile("^" + strings.ReplaceAll(pattern, "*", ".*") + "$")
 	if err != nil {
 		return nil, err
 	}
 	topics := make([]*topic, 0)
-	for _, t := range s.topics {
+	s.topics.Range(func(t *topic) bool {
 		if patternRegexp.MatchString(t.ID) {
 			topics = append(topics, t)
 		}
-	}
+		return true
+	})
 	return topics, nil
 }
 
@@ -1760,9 +2734,16 @@ func (s *Server) runSMTPServer() error {
 	s.smtpServer.ReadTimeout = 10 * time.Second
 	s.smtpServer.WriteTimeout = 10 * time.Second
 	s.smtpServer.MaxMessageBytes = 1024 * 1024 // Must be much larger than message size (headers, multipart, etc.)
+	if s.config.AttachmentCacheDir != "" {
+		s.smtpServer.MaxMessageBytes += int(s.config.AttachmentFileSizeLimit * 4 / 3) // Attachments are base64-encoded
+	}
 	s.smtpServer.MaxRecipients = 1
 	s.smtpServer.AllowInsecureAuth = true
-	return s.smtpServer.ListenAndServe()
+	listener, err := net.Listen("tcp", s.config.SMTPServerListen)
+	if err != nil {
+		return err
+	}
+	return s.smtpServer.Serve(s.withProxyProtocol(listener))
 }
 
 func (s *Server) runManager() {
@@ -1807,7 +2788,7 @@ func (s *Server) resetStats() {
 	}
 	if s.userManager != nil {
 		if err := s.userManager.ResetStats(); err != nil {
-			log.Tag(tagResetter).Warn("Failed to write to database: %s", err.Error())
+			log.Tag(tagResetter).Err(err).Warn("Failed to write to database")
 		}
 	}
 }
@@ -1872,10 +2853,7 @@ func (s *Server) sendDelayedMessages() error {
 
 func (s *Server) sendDelayedMessage(v *visitor, m *message) error {
 	logvm(v, m).Debug("Sending delayed message")
-	s.mu.RLock()
-	t, ok := s.topics[m.Topic] // If no subscribers, just mark message as published
-	s.mu.RUnlock()
-	if ok {
+	if t := s.topics.Get(m.Topic); t != nil { // If no subscribers, just mark message as published
 		go func() {
 			// We do not rate-limit messages here, since we've rate limited them in the PUT/POST handler
 			if err := t.Publish(v, m); err != nil {
@@ -1883,7 +2861,46 @@ func (s *Server) sendDelayedMessage(v *visitor, m *message) error {
 			}
 		}()
 	}
-	if s.firebaseClient != nil { // Firebase subscribers may not show up in topics map
+	if s.topicSilenced(m.Topic) {
+		logvm(v, m).Debug("Topic is silenced, not forwarding delayed message")
+	} else {
+		s.scheduleEscalation(v, m)
+		if s.firebaseClient != nil { // Firebase subscribers may not show up in topics map
+			go s.sendToFirebase(v, m)
+		}
+		if s.config.UpstreamBaseURL != "" {
+			go s.forwardPollRequest(v, m)
+		}
+		if s.config.WebPushPublicKey != "" {
+			go s.publishToWebPushEndpoints(v, m)
+		}
+		if len(s.config.OutboundWebhooks) > 0 {
+			go s.sendOutboundWebhooks(v, m)
+		}
+	}
+	if err := s.messageCache.MarkPublished(m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// publishManagerMessage caches and publishes a message that was created by the server itself (e.g. by the manager,
+// see pruneTopicSilences and escalateMessages) rather than by a publish request. The message is forwarded via
+// Firebase, Web Push, the upstream server and outbound webhooks, unless the topic is silenced. It is not sent via email or phone call.
+func (s *Server) publishManagerMessage(v *visitor, m *message) error {
+	if err := s.messageCache.AddMessage(m); err != nil {
+		return err
+	}
+	if t := s.topics.Get(m.Topic); t != nil {
+		if err := t.Publish(v, m); err != nil {
+			return err
+		}
+	}
+	if s.topicSilenced(m.Topic) {
+		logvm(v, m).Debug("Topic is silenced, not forwarding message")
+		return nil
+	}
+	if s.firebaseClient != nil {
 		go s.sendToFirebase(v, m)
 	}
 	if s.config.UpstreamBaseURL != "" {
@@ -1892,8 +2909,8 @@ func (s *Server) sendDelayedMessage(v *visitor, m *message) error {
 	if s.config.WebPushPublicKey != "" {
 		go s.publishToWebPushEndpoints(v, m)
 	}
-	if err := s.messageCache.MarkPublished(m); err != nil {
-		return err
+	if len(s.config.OutboundWebhooks) > 0 {
+		go s.sendOutboundWebhooks(v, m)
 	}
 	return nil
 }
@@ -1906,64 +2923,95 @@ func (s *Server) transformBodyJSON(next handleFunc) handleFunc {
 		if err != nil {
 			return err
 		}
-		if !topicRegex.MatchString(m.Topic) {
-			return errHTTPBadRequestTopicInvalid
-		}
-		if m.Message == "" {
-			m.Message = emptyMessageBody
-		}
-		r.URL.Path = "/" + m.Topic
-		r.Body = io.NopCloser(strings.NewReader(m.Message))
-		if m.Title != "" {
-			r.Header.Set("X-Title", m.Title)
-		}
-		if m.Priority != 0 {
-			r.Header.Set("X-Priority", fmt.Sprintf("%d", m.Priority))
-		}
-		if len(m.Tags) > 0 {
-			r.Header.Set("X-Tags", strings.Join(m.Tags, ","))
-		}
-		if m.Attach != "" {
-			r.Header.Set("X-Attach", m.Attach)
-		}
-		if m.Filename != "" {
-			r.Header.Set("X-Filename", m.Filename)
-		}
-		if m.Click != "" {
-			r.Header.Set("X-Click", m.Click)
-		}
-		if m.Icon != "" {
-			r.Header.Set("X-Icon", m.Icon)
-		}
-		if m.Markdown {
-			r.Header.Set("X-Markdown", "yes")
-		}
-		if len(m.Actions) > 0 {
-			actionsStr, err := json.Marshal(m.Actions)
-			if err != nil {
-				return errHTTPBadRequestMessageJSONInvalid
-			}
-			r.Header.Set("X-Actions", string(actionsStr))
-		}
-		if m.Email != "" {
-			r.Header.Set("X-Email", m.Email)
-		}
-		if m.Delay != "" {
-			r.Header.Set("X-Delay", m.Delay)
+		if err := transformPublishMessage(r, m); err != nil {
+			return err
 		}
-		if m.Call != "" {
-			r.Header.Set("X-Call", m.Call)
+		return next(w, r, v)
+	}
+}
+
+// transformBodyProtobuf reads a protobuf-encoded publish message from the request body (see readProtobufPublishMessage),
+// and converts it to headers before passing it on to the next handler, just like transformBodyJSON. If the message does
+// not contain a topic, the topic from the request path is used.
+func (s *Server) transformBodyProtobuf(next handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
+		m, err := readProtobufPublishMessage(r.Body, s.config.MessageSizeLimit*2) // 2x to account for encoding overhead
+		if err != nil {
+			return err
 		}
-		if m.Cache != "" {
-			r.Header.Set("X-Cache", m.Cache)
+		if m.Topic == "" && topicPathRegex.MatchString(r.URL.Path) {
+			m.Topic = strings.TrimPrefix(r.URL.Path, "/")
 		}
-		if m.Firebase != "" {
-			r.Header.Set("X-Firebase", m.Firebase)
+		if err := transformPublishMessage(r, m); err != nil {
+			return err
 		}
 		return next(w, r, v)
 	}
 }
 
+// transformPublishMessage rewrites the request to publish the given message, i.e. it sets the request path,
+// body and headers from the message fields. This is used for publishing as JSON or protobuf.
+func transformPublishMessage(r *http.Request, m *publishMessage) error {
+	if !topicRegex.MatchString(m.Topic) {
+		return errHTTPBadRequestTopicInvalid
+	}
+	if m.Message == "" {
+		m.Message = emptyMessageBody
+	}
+	r.URL.Path = "/" + m.Topic
+	r.Body = io.NopCloser(strings.NewReader(m.Message))
+	if m.Title != "" {
+		r.Header.Set("X-Title", m.Title)
+	}
+	if m.Priority != 0 {
+		r.Header.Set("X-Priority", fmt.Sprintf("%d", m.Priority))
+	}
+	if len(m.Tags) > 0 {
+		r.Header.Set("X-Tags", strings.Join(m.Tags, ","))
+	}
+	if m.Attach != "" {
+		r.Header.Set("X-Attach", m.Attach)
+	}
+	if m.Filename != "" {
+		r.Header.Set("X-Filename", m.Filename)
+	}
+	if m.Click != "" {
+		r.Header.Set("X-Click", m.Click)
+	}
+	if m.Icon != "" {
+		r.Header.Set("X-Icon", m.Icon)
+	}
+	if m.Markdown {
+		r.Header.Set("X-Markdown", "yes")
+	}
+	if len(m.Actions) > 0 {
+		actionsStr, err := json.Marshal(m.Actions)
+		if err != nil {
+			return errHTTPBadRequestMessageJSONInvalid
+		}
+		r.Header.Set("X-Actions", string(actionsStr))
+	}
+	if m.Email != "" {
+		r.Header.Set("X-Email", m.Email)
+	}
+	if m.Delay != "" {
+		r.Header.Set("X-Delay", m.Delay)
+	}
+	if m.Call != "" {
+		r.Header.Set("X-Call", m.Call)
+	}
+	if m.Cache != "" {
+		r.Header.Set("X-Cache", m.Cache)
+	}
+	if m.Firebase != "" {
+		r.Header.Set("X-Firebase", m.Firebase)
+	}
+	for key, value := range m.Metadata {
+		r.Header.Set(metadataHeaderPrefix+key, value) // Validated in readMetadataParams
+	}
+	return nil
+}
+
 func (s *Server) transformMatrixJSON(next handleFunc) handleFunc {
 	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
 		newRequest, err := newRequestFromMatrixJSON(r, s.config.BaseURL, s.config.MessageSizeLimit)
@@ -1999,9 +3047,8 @@ func (s *Server) authorizeTopic(next handleFunc, perm user.Permission) handleFun
 		if err != nil {
 			return err
 		}
-		u := v.User()
 		for _, t := range topics {
-			if err := s.userManager.Authorize(u, t.ID, perm); err != nil {
+			if err := s.authorizeVisitor(v, t.ID, perm); err != nil {
 				logvr(v, r).With(t).Err(err).Debug("Access to topic %s not authorized", t.ID)
 				return errHTTPForbidden.With(t)
 			}
@@ -2010,6 +3057,15 @@ func (s *Server) authorizeTopic(next handleFunc, perm user.Permission) handleFun
 	}
 }
 
+// authorizeVisitor checks if the visitor has the given permission on the topic. Visitors that authenticated
+// with a guest token only have access to the topic of the guest token, regardless of the access control list.
+func (s *Server) authorizeVisitor(v *visitor, topic string, perm user.Permission) error {
+	if guest := v.Guest(); guest != nil {
+		return guest.Authorize(topic, perm)
+	}
+	return s.userManager.Authorize(v.User(), topic, perm)
+}
+
 // maybeAuthenticate reads the "Authorization" header and will try to authenticate the user
 // if it is set.
 //
@@ -2018,6 +3074,8 @@ func (s *Server) authorizeTopic(next handleFunc, perm user.Permission) handleFun
 //     an IP-based visitor is returned
 //   - If the header is set, authenticate will be called to check the username/password (Basic auth),
 //     or the token (Bearer auth), and read the user from the database
+//   - If the header contains a guest token (gt_...), a guest visitor is returned, which can only
+//     access the topic of the guest token (see authorizeTopic)
 //
 // This function will ALWAYS return a visitor, even if an error occurs (e.g. unauthorized), so
 // that subsequent logging calls still have a visitor context.
@@ -2038,8 +3096,20 @@ func (s *Server) maybeAuthenticate(r *http.Request) (*visitor, error) {
 	if !vip.AuthAllowed() {
 		return vip, errHTTPTooManyRequestsLimitAuthFailure // Always return visitor, even when error occurs!
 	}
+	if token := readGuestToken(header); token != "" {
+		guest, err := s.userManager.AuthenticateGuestToken(token)
+		if err != nil {
+			vip.AuthFailed()
+			logr(r).Err(err).Debug("Authentication with guest token failed")
+			return vip, errHTTPUnauthorized
+		}
+		return s.guestVisitor(ip, guest), nil
+	}
 	u, err := s.authenticate(r, header)
-	if err != nil {
+	if errors.Is(err, user.ErrPasswordExpired) {
+		logr(r).Err(err).Debug("Authentication failed, password expired")
+		return vip, errHTTPUnauthorizedPasswordExpired // Correct password, so don't count as auth failure
+	} else if err != nil {
 		vip.AuthFailed()
 		logr(r).Err(err).Debug("Authentication failed")
 		return vip, errHTTPUnauthorized // Always return visitor, even when error occurs!
@@ -2082,6 +3152,23 @@ func supportedAuthHeader(value string) bool {
 	return strings.HasPrefix(value, "basic ") || strings.HasPrefix(value, "bearer ")
 }
 
+// readGuestToken returns the guest token from the Authorization header value, if the header contains one
+// (either "Bearer gt_..." with a case-insensitive scheme, or Basic auth with an empty username and the guest
+// token as password), or an empty string otherwise
+func readGuestToken(header string) string {
+	if strings.HasPrefix(strings.ToLower(header), "bearer") {
+		if token := strings.TrimSpace(header[len("bearer"):]); user.ValidGuestToken(token) {
+			return token
+		}
+		return ""
+	}
+	req := &http.Request{Header: http.Header{"Authorization": []string{header}}}
+	if username, password, ok := req.BasicAuth(); ok && username == "" && user.ValidGuestToken(password) {
+		return password
+	}
+	return ""
+}
+
 func (s *Server) authenticateBasicAuth(r *http.Request, value string) (user *user.User, err error) {
 	r.Header.Set("Authorization", value)
 	username, password, ok := r.BasicAuth()
@@ -2100,8 +3187,9 @@ func (s *Server) authenticateBearerAuth(r *http.Request, token string) (*user.Us
 	}
 	ip := extractIPAddress(r, s.config.BehindProxy, s.config.ProxyForwardedHeader, s.config.ProxyTrustedPrefixes)
 	go s.userManager.EnqueueTokenUpdate(token, &user.TokenUpdate{
-		LastAccess: time.Now(),
-		LastOrigin: ip,
+		LastAccess:    time.Now(),
+		LastOrigin:    ip,
+		LastUserAgent: r.UserAgent(),
 	})
 	return u, nil
 }
@@ -2120,6 +3208,19 @@ func (s *Server) visitor(ip netip.Addr, user *user.User) *visitor {
 	return v
 }
 
+func (s *Server) guestVisitor(ip netip.Addr, guest *user.GuestToken) *visitor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := guestVisitorID(guest)
+	v, exists := s.visitors[id]
+	if !exists {
+		s.visitors[id] = newGuestVisitor(s.config, s.messageCache, s.userManager, ip, guest)
+		return s.visitors[id]
+	}
+	v.Keepalive()
+	return v
+}
+
 func (s *Server) writeJSON(w http.ResponseWriter, v any) error {
 	return s.writeJSONWithContentType(w, v, "application/json")
 }
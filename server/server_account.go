@@ -3,11 +3,16 @@ package server
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
+	"math"
 	"net/http"
+	"net/mail"
 	"net/netip"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -66,6 +71,8 @@ func (s *Server) handleAccountGet(w http.ResponseWriter, r *http.Request, v *vis
 			AttachmentFileSize:       limits.AttachmentFileSizeLimit,
 			AttachmentExpiryDuration: int64(limits.AttachmentExpiryDuration.Seconds()),
 			AttachmentBandwidth:      limits.AttachmentBandwidthLimit,
+			AttachmentAllowedTypes:   limits.AttachmentAllowedTypes,
+			AttachmentDeniedTypes:    limits.AttachmentDeniedTypes,
 		},
 		Stats: &apiAccountStats{
 			Messages:                     stats.Messages,
@@ -84,12 +91,24 @@ func (s *Server) handleAccountGet(w http.ResponseWriter, r *http.Request, v *vis
 	if u != nil {
 		response.Username = u.Name
 		response.Role = string(u.Role)
+		if len(u.Capabilities) > 0 {
+			response.Capabilities = util.Map(u.Capabilities, func(c user.Capability) string { return string(c) })
+		}
 		response.SyncTopic = u.SyncTopic
 		response.Provisioned = u.Provisioned
+		response.Email = u.Email
 		if u.Prefs != nil {
 			if u.Prefs.Language != nil {
 				response.Language = *u.Prefs.Language
 			}
+			if u.Prefs.Profile != nil {
+				if u.Prefs.Profile.DisplayName != nil {
+					response.DisplayName = *u.Prefs.Profile.DisplayName
+				}
+				if u.Prefs.Profile.Avatar != nil {
+					response.Avatar = *u.Prefs.Profile.Avatar
+				}
+			}
 			if u.Prefs.Notification != nil {
 				response.Notification = u.Prefs.Notification
 			}
@@ -102,6 +121,9 @@ func (s *Server) handleAccountGet(w http.ResponseWriter, r *http.Request, v *vis
 				Code: u.Tier.Code,
 				Name: u.Tier.Name,
 			}
+			if !u.TierExpires.IsZero() {
+				response.Tier.Expires = u.TierExpires.Unix()
+			}
 		}
 		if u.Billing.StripeCustomerID != "" {
 			response.Billing = &apiAccountBilling{
@@ -126,6 +148,20 @@ func (s *Server) handleAccountGet(w http.ResponseWriter, r *http.Request, v *vis
 						Everyone: r.Everyone.String(),
 					})
 				}
+				aliases, err := s.userManager.TopicAliases(u.Name)
+				if err != nil {
+					return err
+				}
+				for _, alias := range aliases {
+					for _, r := range response.Reservations {
+						if r.Topic == alias.Topic {
+							r.Aliases = append(r.Aliases, &apiAccountTopicAlias{
+								Alias:      alias.Alias,
+								Deprecated: alias.Deprecated,
+							})
+						}
+					}
+				}
 			}
 		}
 		tokens, err := s.userManager.Tokens(u.ID)
@@ -135,18 +171,7 @@ func (s *Server) handleAccountGet(w http.ResponseWriter, r *http.Request, v *vis
 		if len(tokens) > 0 {
 			response.Tokens = make([]*apiAccountTokenResponse, 0)
 			for _, t := range tokens {
-				var lastOrigin string
-				if t.LastOrigin != netip.IPv4Unspecified() {
-					lastOrigin = t.LastOrigin.String()
-				}
-				response.Tokens = append(response.Tokens, &apiAccountTokenResponse{
-					Token:       t.Value,
-					Label:       t.Label,
-					LastAccess:  t.LastAccess.Unix(),
-					LastOrigin:  lastOrigin,
-					Expires:     t.Expires.Unix(),
-					Provisioned: t.Provisioned,
-				})
+				response.Tokens = append(response.Tokens, newAccountTokenResponse(t, u.Token))
 			}
 		}
 		if s.config.TwilioAccount != "" {
@@ -158,6 +183,13 @@ func (s *Server) handleAccountGet(w http.ResponseWriter, r *http.Request, v *vis
 				response.PhoneNumbers = phoneNumbers
 			}
 		}
+		mutes, err := s.userManager.TopicMutes(u.ID)
+		if err != nil {
+			return err
+		}
+		if len(mutes) > 0 {
+			response.Mutes = newTopicMutesResponse(mutes)
+		}
 	} else {
 		response.Username = user.Everyone
 		response.Role = string(user.RoleAnonymous)
@@ -196,6 +228,10 @@ func (s *Server) handleAccountDelete(w http.ResponseWriter, r *http.Request, v *
 	if err := s.maybeRemoveMessagesAndExcessReservations(r, v, u, 0); err != nil {
 		return err
 	}
+	if err := s.messageCache.ExpireMessagesByUser(u.ID); err != nil {
+		return err
+	}
+	go s.pruneMessages()
 	logvr(v, r).Tag(tagAccount).Info("Marking user %s as deleted", u.Name)
 	if err := s.userManager.MarkUserRemoved(u); err != nil {
 		return err
@@ -203,6 +239,145 @@ func (s *Server) handleAccountDelete(w http.ResponseWriter, r *http.Request, v *
 	return s.writeJSON(w, newSuccessResponse())
 }
 
+// handleAccountExport returns all data stored about the user, i.e. everything in the user database (see
+// user.Manager.Export), plus all cached messages on the user's reserved topics.
+func (s *Server) handleAccountExport(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u := v.User()
+	export, err := s.userManager.Export(u.Name)
+	if err != nil {
+		return err
+	}
+	messages := make([]*message, 0)
+	for _, reservation := range export.Reservations {
+		topicMessages, err := s.messageCache.Messages(reservation.Topic, sinceAllMessages, true)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, topicMessages...)
+	}
+	logvr(v, r).Tag(tagAccount).Info("Exporting account data of user %s", u.Name)
+	return s.writeJSON(w, &apiAccountExportResponse{
+		Export:   export,
+		Messages: messages,
+	})
+}
+
+// handleAccountStats returns statistics for the topics reserved by the user, e.g. to find topics that are no
+// longer used, or that use up a lot of the attachment storage. Only cached messages are taken into account.
+func (s *Server) handleAccountStats(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u := v.User()
+	reservations, err := s.userManager.Reservations(u.Name)
+	if err != nil {
+		return err
+	}
+	response := &apiAccountStatsResponse{
+		Topics: make([]*apiAccountTopicStats, 0),
+	}
+	for _, reservation := range reservations {
+		stats, err := s.messageCache.TopicStats(reservation.Topic)
+		if err != nil {
+			return err
+		}
+		topicStats := &apiAccountTopicStats{
+			Topic:           reservation.Topic,
+			Messages:        stats.Messages,
+			MessagesPerDay:  stats.MessagesLastDay,
+			LastActivity:    stats.LastMessage,
+			CacheBytes:      stats.CacheBytes,
+			AttachmentBytes: stats.AttachmentBytes,
+		}
+		if t := s.topics.Get(reservation.Topic); t != nil { // Do not create the topic, see topicsFromIDs
+			subscribers, lastAccess := t.Stats()
+			topicStats.Subscribers = subscribers
+			topicStats.LastActivity = max(topicStats.LastActivity, lastAccess.Unix())
+		}
+		response.Topics = append(response.Topics, topicStats)
+	}
+	logvr(v, r).Tag(tagAccount).Debug("Retrieving topic stats of user %s", u.Name)
+	return s.writeJSON(w, response)
+}
+
+// handleAccountLimits returns the current state of the visitor's limiters, i.e. the remaining requests, messages,
+// emails, etc., and when they are replenished, as well as temporary bans. This helps debug HTTP 429 responses.
+func (s *Server) handleAccountLimits(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	info, err := v.Info()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	statsReset := util.NextOccurrenceUTC(s.config.VisitorStatsResetTime, now).Unix()
+	limiters := v.Limiters()
+	response := &apiAccountLimitsResponse{
+		Visitor:  limiters.ID,
+		Basis:    string(info.Limits.Basis),
+		Exempt:   limiters.Exempt,
+		Requests: rateLimitStatus(limiters.Request, now),
+		Messages: &apiAccountLimitStatus{
+			Limit:     info.Limits.MessageLimit,
+			Used:      info.Stats.Messages,
+			Remaining: info.Stats.MessagesRemaining,
+			Reset:     statsReset,
+		},
+		Emails: rateLimitStatus(limiters.Emails, now),
+		Calls: &apiAccountLimitStatus{
+			Limit:     info.Limits.CallLimit,
+			Used:      info.Stats.Calls,
+			Remaining: info.Stats.CallsRemaining,
+			Reset:     statsReset,
+		},
+		Subscriptions: &apiAccountLimitStatus{
+			Limit:     limiters.Subscriptions.Limit(),
+			Used:      limiters.Subscriptions.Value(),
+			Remaining: zeroIfNegative(limiters.Subscriptions.Limit() - limiters.Subscriptions.Value()),
+		},
+		AttachmentBandwidth: rateLimitStatus(limiters.Bandwidth, now),
+	}
+	if limiters.Auth != nil {
+		response.AuthFailures = rateLimitStatus(limiters.Auth, now)
+	}
+	banned := &apiAccountLimitBans{}
+	if limiters.FirebaseUntil.After(now) {
+		banned.Firebase = limiters.FirebaseUntil.Unix()
+	}
+	if limiters.Auth != nil && !v.AuthAllowed() {
+		banned.Login = now.Add(rateLimitReplenishDuration(limiters.Auth, 1) + time.Second).Unix() // AuthAllowed requires more than one token
+	}
+	if banned.Firebase > 0 || banned.Login > 0 {
+		response.Banned = banned
+	}
+	logvr(v, r).Tag(tagAccount).Debug("Retrieving visitor limits")
+	return s.writeJSON(w, response)
+}
+
+// rateLimitStatus returns the status of a rate limiter. Next and Reset are derived from the remaining tokens and
+// the rate, which is exact for the token bucket algorithm, and an approximation for the other algorithms.
+func rateLimitStatus(l *util.RateLimiter, now time.Time) *apiAccountLimitStatus {
+	tokens := l.Tokens()
+	status := &apiAccountLimitStatus{
+		Limit:     int64(l.Burst()),
+		Used:      l.Value(),
+		Remaining: int64(math.Max(0, math.Floor(tokens))),
+		Algorithm: string(l.Algorithm()),
+	}
+	if d := rateLimitReplenishDuration(l, 1); d > 0 {
+		status.Next = now.Add(d).Unix()
+	}
+	if d := rateLimitReplenishDuration(l, float64(l.Burst())); d > 0 {
+		status.Reset = now.Add(d).Unix()
+	}
+	return status
+}
+
+// rateLimitReplenishDuration returns the time until the limiter has the given number of tokens, rounded
+// up to the next second, or zero if the limiter already has enough tokens, or is never replenished
+func rateLimitReplenishDuration(l *util.RateLimiter, tokens float64) time.Duration {
+	missing := tokens - l.Tokens()
+	if missing <= 0 || l.Limit() <= 0 || l.Limit() == rate.Inf {
+		return 0
+	}
+	return time.Duration(math.Ceil(missing/float64(l.Limit()))) * time.Second
+}
+
 func (s *Server) handleAccountPasswordChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
 	req, err := readJSONWithLimit[apiAccountPasswordChangeRequest](r.Body, jsonBodyBytesLimit, false)
 	if err != nil {
@@ -224,6 +399,109 @@ func (s *Server) handleAccountPasswordChange(w http.ResponseWriter, r *http.Requ
 	return s.writeJSON(w, newSuccessResponse())
 }
 
+func (s *Server) handleAccountPasswordReset(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiAccountPasswordResetRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if req.Username == "" {
+		return errHTTPBadRequest
+	}
+	if !v.PasswordResetAllowed() {
+		return errHTTPTooManyRequestsLimitPasswordReset
+	}
+	// Always respond with success, so that the endpoint cannot be used to figure out
+	// which users exist, or which users have an email address attached to them.
+	u, err := s.userManager.User(req.Username)
+	if errors.Is(err, user.ErrUserNotFound) {
+		logvr(v, r).Tag(tagAccount).Field("user_name", req.Username).Debug("Password reset requested for unknown user %s, ignoring", req.Username)
+		return s.writeJSON(w, newSuccessResponse())
+	} else if err != nil {
+		return err
+	} else if u.Deleted || u.Provisioned || u.Email == "" {
+		logvr(v, r).Tag(tagAccount).Field("user_name", u.Name).Debug("Password reset for user %s not possible (deleted, provisioned or no email address), ignoring", u.Name)
+		return s.writeJSON(w, newSuccessResponse())
+	}
+	if !s.userPasswordResetAllowed(u) {
+		// Not an error response, so that the endpoint cannot be used to figure out which users exist (see above)
+		logvr(v, r).Tag(tagAccount).Field("user_name", u.Name).Info("Too many password reset emails for user %s, ignoring", u.Name)
+		return s.writeJSON(w, newSuccessResponse())
+	}
+	token, err := s.userManager.CreatePasswordResetToken(u.ID, time.Now().Add(s.config.PasswordResetTokenDuration))
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.config.BaseURL, token)
+	logvr(v, r).Tag(tagAccount).Field("user_name", u.Name).Info("Sending password reset email to user %s", u.Name)
+	if err := s.smtpSender.SendPasswordReset(v, u.Email, u.Name, link, s.language(u, r)); err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// userPasswordResetAllowed returns true if a password reset email can be sent to the given user, and decreases the
+// user's limiter. In addition to the limit per visitor, the same limit applies per user, so that the emails to a
+// single user cannot be flooded by requesting them from many different IP addresses.
+func (s *Server) userPasswordResetAllowed(u *user.User) bool {
+	s.mu.Lock()
+	limiter, ok := s.passwordResets[u.ID]
+	if !ok {
+		algorithm := s.config.VisitorRateLimitAlgorithm
+		if a, ok := s.config.VisitorRateLimitAlgorithms[VisitorRateLimitPasswordReset]; ok {
+			algorithm = a
+		}
+		limiter = util.NewRateLimiterWithAlgorithm(algorithm, rate.Every(s.config.VisitorPasswordResetLimitReplenish), s.config.VisitorPasswordResetLimitBurst, 0)
+		s.passwordResets[u.ID] = limiter
+	}
+	s.mu.Unlock()
+	return limiter.Allow()
+}
+
+func (s *Server) handleAccountPasswordResetConfirm(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiAccountPasswordResetConfirmRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if req.Token == "" || req.Password == "" {
+		return errHTTPBadRequest
+	}
+	if !v.AuthAllowed() {
+		return errHTTPTooManyRequestsLimitAuthFailure
+	}
+	u, err := s.userManager.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, user.ErrPasswordResetTokenNotFound) {
+		v.AuthFailed()
+		return errHTTPBadRequestPasswordResetTokenInvalid
+	} else if errors.Is(err, user.ErrProvisionedUserChange) {
+		return errHTTPConflictProvisionedUserChange
+	} else if err != nil {
+		return err
+	}
+	logvr(v, r).Tag(tagAccount).Field("user_name", u.Name).Info("Password for user %s was reset", u.Name)
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func (s *Server) handleAccountEmailChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiAccountEmailChangeRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if req.Password == "" {
+		return errHTTPBadRequest
+	}
+	if req.Email != "" {
+		if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+			return errHTTPBadRequestInvalidEmail
+		}
+	}
+	u := v.User()
+	if _, err := s.userManager.Authenticate(u.Name, req.Password); err != nil {
+		return errHTTPBadRequestIncorrectPasswordConfirmation
+	}
+	logvr(v, r).Tag(tagAccount).Debug("Changing email address for user %s", u.Name)
+	if err := s.userManager.ChangeEmail(u.Name, req.Email); err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
 func (s *Server) handleAccountTokenCreate(w http.ResponseWriter, r *http.Request, v *visitor) error {
 	req, err := readJSONWithLimit[apiAccountTokenIssueRequest](r.Body, jsonBodyBytesLimit, true) // Allow empty body!
 	if err != nil {
@@ -249,12 +527,32 @@ func (s *Server) handleAccountTokenCreate(w http.ResponseWriter, r *http.Request
 	if err != nil {
 		return err
 	}
+	token.LastUserAgent = r.UserAgent()
+	s.userManager.EnqueueTokenUpdate(token.Value, &user.TokenUpdate{
+		LastAccess:    token.LastAccess,
+		LastOrigin:    token.LastOrigin,
+		LastUserAgent: token.LastUserAgent,
+	})
 	response := &apiAccountTokenResponse{
-		Token:      token.Value,
-		Label:      token.Label,
-		LastAccess: token.LastAccess.Unix(),
-		LastOrigin: token.LastOrigin.String(),
-		Expires:    token.Expires.Unix(),
+		Token:         token.Value,
+		Label:         token.Label,
+		LastAccess:    token.LastAccess.Unix(),
+		LastOrigin:    token.LastOrigin.String(),
+		LastUserAgent: token.LastUserAgent,
+		Expires:       token.Expires.Unix(),
+	}
+	return s.writeJSON(w, response)
+}
+
+func (s *Server) handleAccountTokenList(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u := v.User()
+	tokens, err := s.userManager.Tokens(u.ID)
+	if err != nil {
+		return err
+	}
+	response := make([]*apiAccountTokenResponse, 0)
+	for _, t := range tokens {
+		response = append(response, newAccountTokenResponse(t, u.Token))
 	}
 	return s.writeJSON(w, response)
 }
@@ -322,6 +620,45 @@ func (s *Server) handleAccountTokenDelete(w http.ResponseWriter, r *http.Request
 	return s.writeJSON(w, newSuccessResponse())
 }
 
+// handleAccountTokenDeleteOthers removes all tokens of the user except the one used to authenticate the
+// request, effectively logging out all other sessions. If the request was authenticated with a password,
+// all tokens are removed. Provisioned tokens are never removed.
+func (s *Server) handleAccountTokenDeleteOthers(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u := v.User()
+	if err := s.userManager.RemoveOtherTokens(u.ID, u.Token); err != nil {
+		return err
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Debug("Deleted all other tokens for user %s", u.Name)
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// nilIfEmpty returns nil if the string is empty, so that cleared profile fields are removed from the prefs
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func newAccountTokenResponse(t *user.Token, currentToken string) *apiAccountTokenResponse {
+	var lastOrigin string
+	if t.LastOrigin != netip.IPv4Unspecified() {
+		lastOrigin = t.LastOrigin.String()
+	}
+	return &apiAccountTokenResponse{
+		Token:         t.Value,
+		Label:         t.Label,
+		LastAccess:    t.LastAccess.Unix(),
+		LastOrigin:    lastOrigin,
+		LastUserAgent: t.LastUserAgent,
+		Expires:       t.Expires.Unix(),
+		Current:       currentToken != "" && t.Value == currentToken,
+		Provisioned:   t.Provisioned,
+	}
+}
+
 func (s *Server) handleAccountSettingsChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
 	newPrefs, err := readJSONWithLimit[user.Prefs](r.Body, jsonBodyBytesLimit, false)
 	if err != nil {
@@ -335,6 +672,23 @@ func (s *Server) handleAccountSettingsChange(w http.ResponseWriter, r *http.Requ
 	if newPrefs.Language != nil {
 		prefs.Language = newPrefs.Language
 	}
+	if newPrefs.Profile != nil {
+		if prefs.Profile == nil {
+			prefs.Profile = &user.ProfilePrefs{}
+		}
+		if newPrefs.Profile.DisplayName != nil {
+			if !user.AllowedDisplayName(*newPrefs.Profile.DisplayName) {
+				return errHTTPBadRequestInvalidDisplayName
+			}
+			prefs.Profile.DisplayName = nilIfEmpty(strings.TrimSpace(*newPrefs.Profile.DisplayName))
+		}
+		if newPrefs.Profile.Avatar != nil {
+			if *newPrefs.Profile.Avatar != "" && !user.AllowedAvatar(*newPrefs.Profile.Avatar) {
+				return errHTTPBadRequestInvalidAvatar
+			}
+			prefs.Profile.Avatar = nilIfEmpty(*newPrefs.Profile.Avatar)
+		}
+	}
 	if newPrefs.Notification != nil {
 		if prefs.Notification == nil {
 			prefs.Notification = &user.NotificationPrefs{}
@@ -449,24 +803,8 @@ func (s *Server) handleAccountReservationAdd(w http.ResponseWriter, r *http.Requ
 	if err != nil {
 		return errHTTPBadRequestPermissionInvalid
 	}
-	// Check if we are allowed to reserve this topic
-	if u.IsUser() && u.Tier == nil {
-		return errHTTPUnauthorized
-	} else if err := s.userManager.AllowReservation(u.Name, req.Topic); err != nil {
-		return errHTTPConflictTopicReserved
-	} else if u.IsUser() {
-		hasReservation, err := s.userManager.HasReservation(u.Name, req.Topic)
-		if err != nil {
-			return err
-		}
-		if !hasReservation {
-			reservations, err := s.userManager.ReservationsCount(u.Name)
-			if err != nil {
-				return err
-			} else if reservations >= u.Tier.ReservationLimit {
-				return errHTTPTooManyRequestsLimitReservations
-			}
-		}
+	if err := s.checkReservationAllowed(u, req.Topic); err != nil {
+		return err
 	}
 	// Actually add the reservation
 	logvr(v, r).
@@ -488,6 +826,30 @@ func (s *Server) handleAccountReservationAdd(w http.ResponseWriter, r *http.Requ
 	return s.writeJSON(w, newSuccessResponse())
 }
 
+// checkReservationAllowed checks if the user is allowed to reserve the topic, i.e. if it is not reserved by someone
+// else, and if the user's tier has reservations left. Admins can always reserve a topic that is not reserved yet.
+func (s *Server) checkReservationAllowed(u *user.User, topic string) error {
+	if u.IsUser() && u.Tier == nil {
+		return errHTTPUnauthorized
+	} else if err := s.userManager.AllowReservation(u.Name, topic); err != nil {
+		return errHTTPConflictTopicReserved
+	} else if u.IsUser() {
+		hasReservation, err := s.userManager.HasReservation(u.Name, topic)
+		if err != nil {
+			return err
+		}
+		if !hasReservation {
+			reservations, err := s.userManager.ReservationsCount(u.Name)
+			if err != nil {
+				return err
+			} else if reservations >= u.Tier.ReservationLimit {
+				return errHTTPTooManyRequestsLimitReservations
+			}
+		}
+	}
+	return nil
+}
+
 // handleAccountReservationDelete deletes a topic reservation if it is owned by the current user
 func (s *Server) handleAccountReservationDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
 	matches := apiAccountReservationSingleRegex.FindStringSubmatch(r.URL.Path)
@@ -525,22 +887,419 @@ func (s *Server) handleAccountReservationDelete(w http.ResponseWriter, r *http.R
 	return s.writeJSON(w, newSuccessResponse())
 }
 
+// handleAccountReservationRename renames a topic reserved by the current user. The old topic name is kept as
+// an alias of the new topic, so that existing publish and subscribe URLs keep working (see topicsFromIDs).
+// Cached messages are moved to the new topic, and subscribers of the old topic are disconnected, so that
+// they reconnect to the new topic. If the alias is deprecated, clients using it are told to switch.
+func (s *Server) handleAccountReservationRename(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	matches := apiAccountReservationRenameRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return errHTTPInternalErrorInvalidPath
+	}
+	topic := matches[1]
+	req, err := readJSONWithLimit[apiAccountReservationRenameRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if !topicRegex.MatchString(topic) || !topicRegex.MatchString(req.Topic) || topic == req.Topic {
+		return errHTTPBadRequestTopicInvalid
+	} else if util.Contains(s.config.DisallowedTopics, req.Topic) {
+		return errHTTPBadRequestTopicDisallowed
+	}
+	u := v.User()
+	authorized, err := s.userManager.HasReservation(u.Name, topic)
+	if err != nil {
+		return err
+	} else if !authorized {
+		return errHTTPUnauthorized
+	}
+	if err := s.userManager.AllowReservation(u.Name, req.Topic); err != nil {
+		return errHTTPConflictTopicReserved
+	} else if reserved, err := s.userManager.HasReservation(u.Name, req.Topic); err != nil {
+		return err
+	} else if reserved {
+		return errHTTPConflictTopicReserved
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":      topic,
+			"new_topic":  req.Topic,
+			"deprecated": req.Deprecated,
+		}).
+		Debug("Renaming topic reservation %s to %s", topic, req.Topic)
+	if err := s.userManager.RenameReservation(u.Name, topic, req.Topic, req.Deprecated); err != nil {
+		return err
+	}
+	if err := s.messageCache.RenameTopic(topic, req.Topic); err != nil {
+		return err
+	}
+	if t := s.topics.Get(topic); t != nil {
+		t.CancelSubscribers()
+	}
+	t, err := s.topicFromID(req.Topic)
+	if err != nil {
+		return err
+	}
+	t.CancelSubscribersExceptUser(u.ID)
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// handleAccountTopicAliasDelete removes an alias of a topic renamed by the current user. Publishing to and
+// subscribing to the alias then no longer reaches the renamed topic, and the alias can be reserved again.
+func (s *Server) handleAccountTopicAliasDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	matches := apiAccountReservationAliasRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 3 {
+		return errHTTPInternalErrorInvalidPath
+	}
+	topic, aliasName := matches[1], matches[2]
+	alias, err := s.userManager.TopicAlias(aliasName)
+	if errors.Is(err, user.ErrTopicAliasNotFound) {
+		return errHTTPNotFound
+	} else if err != nil {
+		return err
+	} else if alias.Topic != topic {
+		return errHTTPNotFound
+	}
+	logvr(v, r).Tag(tagAccount).Fields(log.Context{"topic": topic, "alias": aliasName}).Debug("Removing alias %s of topic %s", aliasName, topic)
+	if err := s.userManager.RemoveTopicAlias(v.User().Name, aliasName); errors.Is(err, user.ErrTopicAliasNotFound) {
+		return errHTTPNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// handleAccountTopicSchemaGet returns the JSON schema attached to a topic reserved by the current user
+func (s *Server) handleAccountTopicSchemaGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationSchemaRegex)
+	if err != nil {
+		return err
+	}
+	topicSchema, err := s.userManager.TopicSchema(topic)
+	if errors.Is(err, user.ErrTopicSchemaNotFound) {
+		return errHTTPNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, &apiAccountTopicSchemaResponse{
+		Topic:  topicSchema.Topic,
+		Schema: json.RawMessage(topicSchema.Schema),
+		Mode:   string(topicSchema.Mode),
+	})
+}
+
+// handleAccountTopicSchemaChange attaches a JSON schema to a topic reserved by the current user, replacing
+// any existing schema. Messages published to the topic with a JSON content type are validated against it,
+// see validateTopicSchema.
+func (s *Server) handleAccountTopicSchemaChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationSchemaRegex)
+	if err != nil {
+		return err
+	}
+	req, err := readJSONWithLimit[apiAccountTopicSchemaRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if len(req.Schema) == 0 {
+		return errHTTPBadRequestTopicSchemaInvalid.Wrap("schema is required")
+	}
+	mode := user.SchemaModeReject
+	if req.Mode != "" {
+		mode = user.SchemaMode(req.Mode)
+		if !mode.Valid() {
+			return errHTTPBadRequestTopicSchemaInvalid.Wrap("mode must be %s or %s", user.SchemaModeReject, user.SchemaModeTag)
+		}
+	}
+	if _, err := util.ParseJSONSchema(req.Schema); err != nil {
+		return errHTTPBadRequestTopicSchemaInvalid.Wrap("%s", err.Error())
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":       topic,
+			"schema_mode": mode,
+		}).
+		Debug("Setting JSON schema for topic %s", topic)
+	if err := s.userManager.SetTopicSchema(v.User().Name, topic, string(req.Schema), mode); err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// handleAccountTopicSchemaDelete removes the JSON schema from a topic reserved by the current user
+func (s *Server) handleAccountTopicSchemaDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationSchemaRegex)
+	if err != nil {
+		return err
+	}
+	logvr(v, r).Tag(tagAccount).Field("topic", topic).Debug("Removing JSON schema for topic %s", topic)
+	if err := s.userManager.RemoveTopicSchema(v.User().Name, topic); errors.Is(err, user.ErrTopicSchemaNotFound) {
+		return errHTTPNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// readReservedTopic reads the topic from the first group of the given endpoint path regex (e.g. the
+// schema or silence endpoint), and ensures that it is reserved by the current user
+func (s *Server) readReservedTopic(r *http.Request, v *visitor, re *regexp.Regexp) (string, error) {
+	matches := re.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		return "", errHTTPInternalErrorInvalidPath
+	}
+	topic := matches[1]
+	if !topicRegex.MatchString(topic) {
+		return "", errHTTPBadRequestTopicInvalid
+	}
+	authorized, err := s.userManager.HasReservation(v.User().Name, topic)
+	if err != nil {
+		return "", err
+	} else if !authorized {
+		return "", errHTTPUnauthorized
+	}
+	return topic, nil
+}
+
+// handleAccountInviteList returns all invites created by the current user
+func (s *Server) handleAccountInviteList(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	invites, err := s.userManager.Invites(v.User().Name)
+	if err != nil {
+		return err
+	}
+	response := make([]*apiAccountInviteResponse, 0)
+	for _, invite := range invites {
+		response = append(response, newAccountInviteResponse(invite))
+	}
+	return s.writeJSON(w, response)
+}
+
+// handleAccountInviteCreate creates an invite for a topic reserved by the current user. Other users
+// can redeem the invite to get access to the topic, see handleAccountInviteRedeem.
+func (s *Server) handleAccountInviteCreate(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u := v.User()
+	req, err := readJSONWithLimit[apiAccountInviteRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if !topicRegex.MatchString(req.Topic) {
+		return errHTTPBadRequestTopicInvalid
+	} else if req.Uses < 0 {
+		return errHTTPBadRequest.Wrap("uses must be positive")
+	}
+	permission, err := user.ParsePermission(req.Permission)
+	if err != nil || permission == user.PermissionDenyAll {
+		return errHTTPBadRequestPermissionInvalid
+	}
+	uses := req.Uses
+	if uses == 0 {
+		uses = 1
+	}
+	var expires time.Time
+	if req.Expires != 0 {
+		expires = time.Unix(req.Expires, 0)
+		if !expires.After(time.Now()) {
+			return errHTTPBadRequest.Wrap("expires must be in the future")
+		}
+	}
+	hasReservation, err := s.userManager.HasReservation(u.Name, req.Topic)
+	if err != nil {
+		return err
+	} else if !hasReservation {
+		return errHTTPUnauthorized
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":             req.Topic,
+			"invite_permission": permission.String(),
+			"invite_uses_limit": uses,
+			"invite_expires":    req.Expires,
+		}).
+		Debug("Creating invite for topic %s", req.Topic)
+	invite, err := s.userManager.CreateInvite(u.Name, req.Topic, permission, uses, expires)
+	if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newAccountInviteResponse(invite))
+}
+
+// handleAccountInviteDelete deletes an invite created by the current user. Access that was already
+// granted by the invite is not revoked.
+func (s *Server) handleAccountInviteDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	matches := apiAccountInviteSingleRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return errHTTPInternalErrorInvalidPath
+	}
+	u := v.User()
+	logvr(v, r).Tag(tagAccount).Debug("Deleting invite")
+	if err := s.userManager.RemoveInvite(u.Name, matches[1]); errors.Is(err, user.ErrInviteNotFound) {
+		return errHTTPBadRequestInviteInvalid
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// handleAccountInviteRedeem redeems an invite, and grants the current user access to the topic
+// as defined in the invite.
+func (s *Server) handleAccountInviteRedeem(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u := v.User()
+	req, err := readJSONWithLimit[apiAccountInviteRedeemRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	invite, err := s.userManager.RedeemInvite(u.Name, req.Token)
+	if errors.Is(err, user.ErrInviteNotFound) || errors.Is(err, user.ErrInvalidArgument) {
+		return errHTTPBadRequestInviteInvalid
+	} else if err != nil {
+		return err
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":             invite.Topic,
+			"invite_permission": invite.Permission.String(),
+		}).
+		Info("Redeemed invite, granted %s access to topic %s", invite.Permission, invite.Topic)
+	return s.writeJSON(w, newAccountInviteResponse(invite))
+}
+
+func (s *Server) handleAccountGuestTokenList(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	guests, err := s.userManager.GuestTokens(v.User().Name)
+	if err != nil {
+		return err
+	}
+	response := make([]*apiAccountGuestTokenResponse, 0)
+	for _, guest := range guests {
+		response = append(response, newAccountGuestTokenResponse(guest))
+	}
+	return s.writeJSON(w, response)
+}
+
+// handleAccountGuestTokenCreate creates a guest token for a topic reserved by the current user. Devices can
+// use the guest token to publish to (or subscribe to) this one topic, without a user account of their own.
+func (s *Server) handleAccountGuestTokenCreate(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u := v.User()
+	req, err := readJSONWithLimit[apiAccountGuestTokenRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if !topicRegex.MatchString(req.Topic) {
+		return errHTTPBadRequestTopicInvalid
+	} else if req.MessagesLimit < 0 {
+		return errHTTPBadRequest.Wrap("messages limit must be positive")
+	}
+	permission := user.PermissionWrite
+	if req.Permission != "" {
+		permission, err = user.ParsePermission(req.Permission)
+		if err != nil || permission == user.PermissionDenyAll {
+			return errHTTPBadRequestPermissionInvalid
+		}
+	}
+	messagesLimit := req.MessagesLimit
+	if messagesLimit == 0 {
+		messagesLimit = user.DefaultGuestTokenMessageLimit
+	}
+	if limit := v.Limits().MessageLimit; messagesLimit > limit {
+		return errHTTPBadRequest.Wrap("messages limit must not exceed your own daily message limit of %d", limit)
+	}
+	var expires time.Time
+	if req.Expires != 0 {
+		expires = time.Unix(req.Expires, 0)
+		if !expires.After(time.Now()) {
+			return errHTTPBadRequest.Wrap("expires must be in the future")
+		}
+	}
+	hasReservation, err := s.userManager.HasReservation(u.Name, req.Topic)
+	if err != nil {
+		return err
+	} else if !hasReservation {
+		return errHTTPUnauthorized
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":                req.Topic,
+			"guest_permission":     permission.String(),
+			"guest_messages_limit": messagesLimit,
+			"guest_expires":        req.Expires,
+		}).
+		Debug("Creating guest token for topic %s", req.Topic)
+	guest, err := s.userManager.CreateGuestToken(u.Name, req.Topic, permission, req.Label, messagesLimit, expires)
+	if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newAccountGuestTokenResponse(guest))
+}
+
+// handleAccountGuestTokenDelete deletes a guest token created by the current user
+func (s *Server) handleAccountGuestTokenDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	matches := apiAccountGuestTokenSingleRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return errHTTPInternalErrorInvalidPath
+	}
+	u := v.User()
+	logvr(v, r).Tag(tagAccount).Debug("Deleting guest token")
+	if err := s.userManager.RemoveGuestToken(u.Name, matches[1]); errors.Is(err, user.ErrGuestTokenNotFound) {
+		return errHTTPBadRequestGuestTokenInvalid
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+func newAccountGuestTokenResponse(guest *user.GuestToken) *apiAccountGuestTokenResponse {
+	var expires int64
+	if !guest.Expires.IsZero() {
+		expires = guest.Expires.Unix()
+	}
+	return &apiAccountGuestTokenResponse{
+		Token:         guest.Token,
+		Topic:         guest.Topic,
+		Permission:    guest.Permission.String(),
+		Label:         guest.Label,
+		MessagesLimit: guest.MessageLimit,
+		Expires:       expires,
+		Created:       guest.Created.Unix(),
+	}
+}
+
+func newAccountInviteResponse(invite *user.Invite) *apiAccountInviteResponse {
+	var expires int64
+	if !invite.Expires.IsZero() {
+		expires = invite.Expires.Unix()
+	}
+	return &apiAccountInviteResponse{
+		Token:      invite.Token,
+		Topic:      invite.Topic,
+		Permission: invite.Permission.String(),
+		Uses:       invite.Uses,
+		UsesLimit:  invite.UsesLimit,
+		Expires:    expires,
+		Created:    invite.Created.Unix(),
+	}
+}
+
 // maybeRemoveMessagesAndExcessReservations deletes topic reservations for the given user (if too many for tier),
 // and marks associated messages for the topics as deleted. This also eventually deletes attachments.
 // The process relies on the manager to perform the actual deletions (see runManager).
 func (s *Server) maybeRemoveMessagesAndExcessReservations(r *http.Request, v *visitor, u *user.User, reservationsLimit int64) error {
+	return s.removeMessagesAndExcessReservations(logvr(v, r).Tag(tagAccount), u, reservationsLimit)
+}
+
+// removeMessagesAndExcessReservations is like maybeRemoveMessagesAndExcessReservations, but can be used outside
+// of an HTTP request, e.g. from the manager, by passing the log event to use.
+func (s *Server) removeMessagesAndExcessReservations(ev *log.Event, u *user.User, reservationsLimit int64) error {
 	reservations, err := s.userManager.Reservations(u.Name)
 	if err != nil {
 		return err
 	} else if int64(len(reservations)) <= reservationsLimit {
-		logvr(v, r).Tag(tagAccount).Debug("No excess reservations to remove")
+		ev.Debug("No excess reservations to remove")
 		return nil
 	}
 	topics := make([]string, 0)
 	for i := int64(len(reservations)) - 1; i >= reservationsLimit; i-- {
 		topics = append(topics, reservations[i].Topic)
 	}
-	logvr(v, r).Tag(tagAccount).Info("Removing excess reservations for topics %s", strings.Join(topics, ", "))
+	ev.Info("Removing excess reservations for topics %s", strings.Join(topics, ", "))
 	if err := s.userManager.RemoveReservations(u.Name, topics...); err != nil {
 		return err
 	}
@@ -7,6 +7,8 @@ import (
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/netip"
 	"path/filepath"
 	"strings"
@@ -199,6 +201,59 @@ func TestAccount_ChangeSettings(t *testing.T) {
 	require.Nil(t, account.Notification.MinPriority) // Not set
 }
 
+func TestAccount_ChangeSettings_Profile(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("admin", "admin", user.RoleAdmin, false))
+
+	rr := request(t, s, "PATCH", "/v1/account/settings", `{"profile": {"display_name": "Phil Heckel", "avatar": "https://example.com/phil.png"}}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "PATCH", "/v1/account/settings", `{"profile": {"display_name": "Phil\nHeckel"}}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40051, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "PATCH", "/v1/account/settings", `{"profile": {"avatar": "javascript:alert(1)"}}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40052, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	account, _ := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Equal(t, "Phil Heckel", account.DisplayName)
+	require.Equal(t, "https://example.com/phil.png", account.Avatar)
+
+	rr = request(t, s, "GET", "/v1/users", "", map[string]string{
+		"Authorization": util.BasicAuth("admin", "admin"),
+	})
+	require.Equal(t, 200, rr.Code)
+	require.Contains(t, rr.Body.String(), `"display_name":"Phil Heckel"`)
+
+	// Clear display name, keep avatar
+	rr = request(t, s, "PATCH", "/v1/account/settings", `{"profile": {"display_name": ""}}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	account, _ = util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Equal(t, "", account.DisplayName)
+	require.Equal(t, "https://example.com/phil.png", account.Avatar)
+}
+
 func TestAccount_Subscription_AddUpdateDelete(t *testing.T) {
 	s := newTestServer(t, newTestConfigWithAuthFile(t))
 	defer s.closeDatabases()
@@ -301,6 +356,177 @@ func TestAccount_ChangePassword_NoAccount(t *testing.T) {
 	require.Equal(t, 401, rr.Code)
 }
 
+func TestAccount_ChangeEmail(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+
+	rr := request(t, s, "PUT", "/v1/account/email", `{"password": "WRONG", "email": "phil@example.com"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40026, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "PUT", "/v1/account/email", `{"password": "phil", "email": "Phil <phil@example.com>"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40050, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "PUT", "/v1/account/email", `{"password": "phil", "email": "phil@example.com"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	account, _ := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Equal(t, "phil@example.com", account.Email)
+}
+
+func TestAccount_PasswordReset_Success(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.BaseURL = "https://ntfy.example.com"
+	conf.EnableLogin = true
+	conf.EnablePasswordReset = true
+	s := newTestServer(t, conf)
+	defer s.closeDatabases()
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeEmail("phil", "phil@example.com"))
+	u, err := s.userManager.User("phil")
+	require.Nil(t, err)
+	token, err := s.userManager.CreateToken(u.ID, "", time.Unix(0, 0), netip.IPv4Unspecified(), false)
+	require.Nil(t, err)
+
+	rr := request(t, s, "GET", "/config.js", "", nil)
+	require.Equal(t, 200, rr.Code)
+	require.Contains(t, rr.Body.String(), `"enable_password_reset": true`)
+
+	// Unknown user: success, but no email
+	rr = request(t, s, "POST", "/v1/account/password/reset", `{"username": "unknown"}`, nil)
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, 0, mailer.Count())
+
+	// Known user
+	rr = request(t, s, "POST", "/v1/account/password/reset", `{"username": "phil"}`, nil)
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, 1, mailer.Count())
+	require.Equal(t, "phil@example.com", mailer.lastTo)
+	require.True(t, strings.HasPrefix(mailer.lastLink, "https://ntfy.example.com/reset-password?token=pr_"))
+	resetToken := strings.TrimPrefix(mailer.lastLink, "https://ntfy.example.com/reset-password?token=")
+
+	// Invalid token
+	rr = request(t, s, "POST", "/v1/account/password/reset/confirm", `{"token": "pr_invalid", "password": "new password"}`, nil)
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40049, toHTTPError(t, rr.Body.String()).Code)
+
+	// Valid token
+	rr = request(t, s, "POST", "/v1/account/password/reset/confirm", fmt.Sprintf(`{"token": "%s", "password": "new password"}`, resetToken), nil)
+	require.Equal(t, 200, rr.Code)
+
+	// Token cannot be reused
+	rr = request(t, s, "POST", "/v1/account/password/reset/confirm", fmt.Sprintf(`{"token": "%s", "password": "another password"}`, resetToken), nil)
+	require.Equal(t, 400, rr.Code)
+
+	// Old password and access tokens are gone, new password works
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 401, rr.Code)
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BearerAuth(token.Value),
+	})
+	require.Equal(t, 401, rr.Code)
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "new password"),
+	})
+	require.Equal(t, 200, rr.Code)
+}
+
+func TestAccount_PasswordReset_RateLimit(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.BaseURL = "https://ntfy.example.com"
+	conf.EnablePasswordReset = true
+	s := newTestServer(t, conf)
+	defer s.closeDatabases()
+	s.smtpSender = &testMailer{}
+
+	for i := 0; i < 3; i++ {
+		rr := request(t, s, "POST", "/v1/account/password/reset", `{"username": "phil"}`, nil)
+		require.Equal(t, 200, rr.Code)
+	}
+	rr := request(t, s, "POST", "/v1/account/password/reset", `{"username": "phil"}`, nil)
+	require.Equal(t, 429, rr.Code)
+	require.Equal(t, 42911, toHTTPError(t, rr.Body.String()).Code)
+}
+
+func TestAccount_PasswordReset_RateLimitPerUser(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.BaseURL = "https://ntfy.example.com"
+	conf.EnablePasswordReset = true
+	s := newTestServer(t, conf)
+	defer s.closeDatabases()
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeEmail("phil", "phil@example.com"))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeEmail("ben", "ben@example.com"))
+
+	// Requests from different IPs are limited per user, and still succeed, so that they don't reveal the user
+	for i := 0; i < 5; i++ {
+		rr := request(t, s, "POST", "/v1/account/password/reset", `{"username": "phil"}`, nil, func(r *http.Request) {
+			r.RemoteAddr = fmt.Sprintf("1.2.3.%d:1234", i)
+		})
+		require.Equal(t, 200, rr.Code)
+	}
+	require.Equal(t, 3, mailer.Count())
+
+	// Other users are not affected
+	rr := request(t, s, "POST", "/v1/account/password/reset", `{"username": "ben"}`, nil, func(r *http.Request) {
+		r.RemoteAddr = "1.2.3.100:1234"
+	})
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, 4, mailer.Count())
+	require.Equal(t, "ben@example.com", mailer.lastTo)
+}
+
+func TestAccount_PasswordReset_Disabled(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+	s.smtpSender = &testMailer{}
+
+	rr := request(t, s, "POST", "/v1/account/password/reset", `{"username": "phil"}`, nil)
+	require.Equal(t, 404, rr.Code)
+}
+
+func TestAccount_PasswordExpired(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ExpirePassword("phil"))
+
+	rr := request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 401, rr.Code)
+	require.Equal(t, 40102, toHTTPError(t, rr.Body.String()).Code)
+
+	require.Nil(t, s.userManager.ChangePassword("phil", "new password", false))
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "new password"),
+	})
+	require.Equal(t, 200, rr.Code)
+}
+
 func TestAccount_ExtendToken(t *testing.T) {
 	t.Parallel()
 	s := newTestServer(t, newTestConfigWithAuthFile(t))
@@ -391,6 +617,65 @@ func TestAccount_DeleteToken(t *testing.T) {
 	require.Equal(t, 401, rr.Code)
 }
 
+func TestAccount_Token_ListAndDeleteOthers(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthStatsQueueWriterInterval = 100 * time.Millisecond
+	s := newTestServer(t, conf)
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+
+	tokens := make([]string, 0)
+	for _, userAgent := range []string{"Mozilla/5.0 (Android 14)", "Mozilla/5.0 (X11; Linux x86_64)"} {
+		rr := request(t, s, "POST", "/v1/account/token", "", map[string]string{
+			"Authorization": util.BasicAuth("phil", "phil"),
+			"User-Agent":    userAgent,
+		})
+		require.Equal(t, 200, rr.Code)
+		token, err := util.UnmarshalJSON[apiAccountTokenResponse](io.NopCloser(rr.Body))
+		require.Nil(t, err)
+		require.Equal(t, userAgent, token.LastUserAgent)
+		tokens = append(tokens, token.Token)
+	}
+	time.Sleep(300 * time.Millisecond) // Wait for token updates to be written
+
+	rr := request(t, s, "GET", "/v1/account/token", "", map[string]string{
+		"Authorization": util.BearerAuth(tokens[1]),
+	})
+	require.Equal(t, 200, rr.Code)
+	list, err := util.UnmarshalJSON[[]*apiAccountTokenResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 2, len(*list))
+	for _, token := range *list {
+		if token.Token == tokens[0] {
+			require.Equal(t, "Mozilla/5.0 (Android 14)", token.LastUserAgent)
+			require.False(t, token.Current)
+		} else {
+			require.Equal(t, "Mozilla/5.0 (X11; Linux x86_64)", token.LastUserAgent)
+			require.True(t, token.Current)
+		}
+	}
+
+	// Log out all other sessions
+	rr = request(t, s, "DELETE", "/v1/account/token/others", "", map[string]string{
+		"Authorization": util.BearerAuth(tokens[1]),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BearerAuth(tokens[0]),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BearerAuth(tokens[1]),
+	})
+	require.Equal(t, 200, rr.Code)
+	account, _ := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Equal(t, 1, len(account.Tokens))
+	require.Equal(t, tokens[1], account.Tokens[0].Token)
+}
+
 func TestAccount_Delete_Success(t *testing.T) {
 	conf := newTestConfigWithAuthFile(t)
 	conf.EnableSignup = true
@@ -441,6 +726,192 @@ func TestAccount_Delete_Not_Allowed(t *testing.T) {
 	require.Equal(t, 40026, toHTTPError(t, rr.Body.String()).Code)
 }
 
+func TestAccount_Export(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro", MessageLimit: 10, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "mytopic", user.PermissionDenyAll))
+
+	rr := request(t, s, "PUT", "/mytopic", "reserved message", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/othertopic", "other message", nil)
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/account/export", "", nil)
+	require.Equal(t, 401, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/account/export", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	export, err := util.UnmarshalJSON[apiAccountExportResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "phil", export.Username)
+	require.Equal(t, "pro", export.Tier)
+	require.Equal(t, 1, len(export.Reservations))
+	require.Equal(t, 1, len(export.Messages))
+	require.Equal(t, "mytopic", export.Messages[0].Topic)
+	require.Equal(t, "reserved message", export.Messages[0].Message)
+}
+
+func TestAccount_Limits_Anonymous(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.VisitorRequestLimitBurst = 3
+	conf.VisitorRequestLimitReplenish = 10 * time.Second
+	conf.VisitorMessageDailyLimit = 100
+	s := newTestServer(t, conf)
+	defer s.closeDatabases()
+
+	for i := 0; i < 3; i++ {
+		rr := request(t, s, "POST", "/mytopic", "hi", nil)
+		require.Equal(t, 200, rr.Code)
+	}
+	rr := request(t, s, "POST", "/mytopic", "hi", nil)
+	require.Equal(t, 429, rr.Code)
+
+	// Endpoint is not rate limited itself, and explains the 429
+	now := time.Now().Unix()
+	rr = request(t, s, "GET", "/v1/account/limits", "", nil)
+	require.Equal(t, 200, rr.Code)
+	limits, _ := util.UnmarshalJSON[apiAccountLimitsResponse](io.NopCloser(rr.Body))
+	require.Equal(t, "ip:9.9.9.9", limits.Visitor)
+	require.Equal(t, "ip", limits.Basis)
+	require.False(t, limits.Exempt)
+	require.Equal(t, int64(3), limits.Requests.Limit)
+	require.Equal(t, int64(0), limits.Requests.Remaining)
+	require.Equal(t, "token-bucket", limits.Requests.Algorithm)
+	require.InDelta(t, now+10, limits.Requests.Next, 2)
+	require.InDelta(t, now+30, limits.Requests.Reset, 2)
+	require.Equal(t, int64(100), limits.Messages.Limit)
+	require.Equal(t, int64(3), limits.Messages.Used)
+	require.Equal(t, int64(97), limits.Messages.Remaining)
+	require.Greater(t, limits.Messages.Reset, now)
+	require.Equal(t, int64(conf.VisitorEmailLimitBurst), limits.Emails.Remaining)
+	require.Equal(t, int64(0), limits.Emails.Reset) // Fully replenished
+	require.Equal(t, int64(conf.VisitorSubscriptionLimit), limits.Subscriptions.Remaining)
+	require.NotNil(t, limits.AuthFailures)
+	require.Nil(t, limits.Banned)
+}
+
+func TestAccount_Limits_UserWithTier_Banned(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.VisitorRequestExemptPrefixes = []netip.Prefix{netip.MustParsePrefix("9.9.9.0/24")}
+	s := newTestServer(t, conf)
+	defer s.closeDatabases()
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro", MessageLimit: 1000, EmailLimit: 50}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+
+	rr := request(t, s, "POST", "/mytopic", "hi", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	u, err := s.userManager.User("phil")
+	require.Nil(t, err)
+	s.visitor(netip.MustParseAddr("9.9.9.9"), u).FirebaseTemporarilyDeny()
+
+	rr = request(t, s, "GET", "/v1/account/limits", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	limits, _ := util.UnmarshalJSON[apiAccountLimitsResponse](io.NopCloser(rr.Body))
+	require.Equal(t, "user:"+u.ID, limits.Visitor)
+	require.Equal(t, "tier", limits.Basis)
+	require.True(t, limits.Exempt)
+	require.Equal(t, int64(1000), limits.Messages.Limit)
+	require.Equal(t, int64(0), limits.Messages.Used) // Messages of exempt visitors are not counted
+	require.Equal(t, int64(16), limits.Emails.Limit) // 20% of the tier's email limit, but at least visitor-email-limit-burst
+	require.Nil(t, limits.AuthFailures)              // Users are already logged in
+	require.NotNil(t, limits.Banned)
+	require.Greater(t, limits.Banned.Firebase, time.Now().Unix())
+	require.Equal(t, int64(0), limits.Banned.Login)
+}
+
+func TestAccount_Stats(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro", MessageLimit: 10, ReservationLimit: 2, AttachmentFileSizeLimit: 1000, AttachmentTotalSizeLimit: 10000, AttachmentExpiryDuration: time.Hour, AttachmentBandwidthLimit: 10000}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "mytopic", user.PermissionDenyAll))
+	require.Nil(t, s.userManager.AddReservation("phil", "unused", user.PermissionDenyAll))
+
+	rr := request(t, s, "PUT", "/mytopic", "reserved message", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"Title":         "title",
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/mytopic", "some attachment", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"Filename":      "file.txt",
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/othertopic", "other message", nil)
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/account/stats", "", nil)
+	require.Equal(t, 401, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/account/stats", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	stats, err := util.UnmarshalJSON[apiAccountStatsResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 2, len(stats.Topics))
+	require.Equal(t, "mytopic", stats.Topics[0].Topic)
+	require.Equal(t, 2, stats.Topics[0].Messages)
+	require.Equal(t, 2, stats.Topics[0].MessagesPerDay)
+	require.InDelta(t, time.Now().Unix(), stats.Topics[0].LastActivity, 2)
+	require.Equal(t, int64(len("reserved message")+len("title")+len("You received a file: file.txt")), stats.Topics[0].CacheBytes)
+	require.Equal(t, int64(len("some attachment")), stats.Topics[0].AttachmentBytes)
+	require.Equal(t, "unused", stats.Topics[1].Topic)
+	require.Equal(t, 0, stats.Topics[1].Messages)
+	require.Equal(t, int64(0), stats.Topics[1].LastActivity)
+}
+
+func TestAccount_Delete_RemovesMessages(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro", MessageLimit: 10, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "mytopic", user.PermissionDenyAll))
+
+	rr := request(t, s, "PUT", "/mytopic", "reserved message", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/othertopic", "message by phil", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/othertopic", "message by someone else", nil)
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "DELETE", "/v1/account", `{"password":"phil"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// Messages on reserved topics and messages published by the user are removed
+	s.pruneMessages()
+	messages, err := s.messageCache.Messages("mytopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(messages))
+	messages, err = s.messageCache.Messages("othertopic", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "message by someone else", messages[0].Message)
+}
+
 func TestAccount_Reservation_AddWithoutTierFails(t *testing.T) {
 	conf := newTestConfigWithAuthFile(t)
 	conf.EnableSignup = true
@@ -593,6 +1064,409 @@ func TestAccount_Reservation_AddRemoveUserWithTierSuccess(t *testing.T) {
 	require.Equal(t, "mytopic", account.Reservations[0].Topic)
 }
 
+func TestAccount_Reservation_Invites(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthDefault = user.PermissionDenyAll
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "mytopic", user.PermissionDenyAll))
+
+	// Cannot create invites for topics not reserved by the user, or with invalid permissions
+	rr := request(t, s, "POST", "/v1/account/invite", `{"topic": "mytopic", "permission": "read-only"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+	rr = request(t, s, "POST", "/v1/account/invite", `{"topic": "mytopic", "permission": "deny-all"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	// Create invite
+	rr = request(t, s, "POST", "/v1/account/invite", `{"topic": "mytopic", "permission": "read-only"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	invite, err := util.UnmarshalJSON[apiAccountInviteResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "mytopic", invite.Topic)
+	require.Equal(t, "read-only", invite.Permission)
+	require.Equal(t, int64(0), invite.Uses)
+	require.Equal(t, int64(1), invite.UsesLimit)
+
+	rr = request(t, s, "GET", "/v1/account/invite", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	invites, err := util.UnmarshalJSON[[]apiAccountInviteResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(*invites))
+	require.Equal(t, invite.Token, (*invites)[0].Token)
+
+	// Ben cannot read before redeeming, but can afterwards
+	rr = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 403, rr.Code)
+	rr = request(t, s, "POST", "/v1/account/invite/redeem", fmt.Sprintf(`{"token": "%s"}`, invite.Token), map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, rr.Code)
+	redeemed, err := util.UnmarshalJSON[apiAccountInviteResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "mytopic", redeemed.Topic)
+	require.Equal(t, int64(1), redeemed.Uses)
+	rr = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/mytopic", "hi", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 403, rr.Code)
+
+	// Invite is used up
+	rr = request(t, s, "POST", "/v1/account/invite/redeem", fmt.Sprintf(`{"token": "%s"}`, invite.Token), map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40053, toHTTPError(t, rr.Body.String()).Code)
+
+	// Delete invite
+	rr = request(t, s, "POST", "/v1/account/invite", `{"topic": "mytopic", "permission": "rw", "uses": 3}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	invite, err = util.UnmarshalJSON[apiAccountInviteResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, int64(3), invite.UsesLimit)
+	rr = request(t, s, "DELETE", "/v1/account/invite/"+invite.Token, "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 400, rr.Code)
+	rr = request(t, s, "DELETE", "/v1/account/invite/"+invite.Token, "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "POST", "/v1/account/invite/redeem", fmt.Sprintf(`{"token": "%s"}`, invite.Token), map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	// Removing the reservation revokes the access granted by the invite
+	rr = request(t, s, "DELETE", "/v1/account/reservation/mytopic", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 403, rr.Code)
+}
+
+func TestAccount_Reservation_GuestTokens(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthDefault = user.PermissionReadWrite
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", MessageLimit: 100, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "sensors", user.PermissionDenyAll))
+
+	// Cannot create guest tokens for topics not reserved by the user, or above the user's own limits
+	rr := request(t, s, "POST", "/v1/account/guest-token", `{"topic": "sensors"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+	rr = request(t, s, "POST", "/v1/account/guest-token", `{"topic": "sensors", "messages_limit": 101}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	// Create guest token
+	rr = request(t, s, "POST", "/v1/account/guest-token", `{"topic": "sensors", "label": "thermometer", "messages_limit": 2}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	guest, err := util.UnmarshalJSON[apiAccountGuestTokenResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "sensors", guest.Topic)
+	require.Equal(t, "write-only", guest.Permission)
+	require.Equal(t, "thermometer", guest.Label)
+	require.Equal(t, int64(2), guest.MessagesLimit)
+
+	rr = request(t, s, "GET", "/v1/account/guest-token", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	guests, err := util.UnmarshalJSON[[]apiAccountGuestTokenResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(*guests))
+	require.Equal(t, guest.Token, (*guests)[0].Token)
+
+	// Guest can only publish to its topic, even though other topics are writable by everyone
+	rr = request(t, s, "PUT", "/sensors", "21.5", map[string]string{
+		"Authorization": util.BearerAuth(guest.Token),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/sensors", "21.7", map[string]string{
+		"Authorization": util.BasicAuth("", guest.Token),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/othertopic", "hi", map[string]string{
+		"Authorization": util.BearerAuth(guest.Token),
+	})
+	require.Equal(t, 403, rr.Code)
+	rr = request(t, s, "GET", "/sensors/json?poll=1", "", map[string]string{
+		"Authorization": util.BearerAuth(guest.Token),
+	})
+	require.Equal(t, 403, rr.Code)
+	rr = request(t, s, "POST", "/v1/account/guest-token", `{"topic": "sensors"}`, map[string]string{
+		"Authorization": util.BearerAuth(guest.Token),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Guest has its own message limit
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BearerAuth(guest.Token),
+	})
+	require.Equal(t, 200, rr.Code)
+	account, err := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "guest", account.Limits.Basis)
+	require.Equal(t, int64(2), account.Limits.Messages)
+	require.Equal(t, int64(0), account.Limits.Emails)
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": "bearer " + guest.Token, // Scheme is case-insensitive
+	})
+	require.Equal(t, 200, rr.Code)
+	account, err = util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "guest", account.Limits.Basis)
+	rr = request(t, s, "PUT", "/sensors", "21.9", map[string]string{
+		"Authorization": util.BearerAuth(guest.Token),
+	})
+	require.Equal(t, 429, rr.Code)
+
+	// Delete guest token
+	rr = request(t, s, "DELETE", "/v1/account/guest-token/"+guest.Token, "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40055, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "DELETE", "/v1/account/guest-token/"+guest.Token, "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/sensors", "22.0", map[string]string{
+		"Authorization": util.BearerAuth(guest.Token),
+	})
+	require.Equal(t, 401, rr.Code)
+}
+
+func TestAccount_Reservation_TopicSchema(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthDefault = user.PermissionReadWrite
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", MessageLimit: 100, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "sensors", user.PermissionReadWrite))
+
+	// Only the topic owner can attach a schema, and the schema must be valid
+	schema := `{"type": "object", "required": ["temperature"], "properties": {"temperature": {"type": "number"}}}`
+	rr := request(t, s, "PUT", "/v1/account/reservation/sensors/schema", `{"schema": `+schema+`}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+	rr = request(t, s, "PUT", "/v1/account/reservation/sensors/schema", `{"schema": {"type": "float"}}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40056, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "PUT", "/v1/account/reservation/sensors/schema", `{"schema": `+schema+`, "mode": "drop"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+	rr = request(t, s, "GET", "/v1/account/reservation/sensors/schema", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 404, rr.Code)
+
+	rr = request(t, s, "PUT", "/v1/account/reservation/sensors/schema", `{"schema": `+schema+`}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/account/reservation/sensors/schema", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	topicSchema, err := util.UnmarshalJSON[apiAccountTopicSchemaResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "sensors", topicSchema.Topic)
+	require.Equal(t, "reject", topicSchema.Mode)
+	require.JSONEq(t, schema, string(topicSchema.Schema))
+
+	// JSON messages are validated, other messages are not
+	rr = request(t, s, "PUT", "/sensors", `{"temperature": 21.5}`, map[string]string{
+		"Content-Type": "application/json",
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/sensors", `{"temperature": "hot"}`, map[string]string{
+		"Content-Type": "application/json; charset=utf-8",
+	})
+	require.Equal(t, 400, rr.Code)
+	httpErr := toHTTPError(t, rr.Body.String())
+	require.Equal(t, 40057, httpErr.Code)
+	require.Equal(t, "invalid request: message does not match the JSON schema of the topic; $.temperature: must be of type number", httpErr.Message)
+	rr = request(t, s, "PUT", "/sensors", "not json", map[string]string{
+		"Content-Type": "application/json",
+	})
+	require.Equal(t, 400, rr.Code)
+	rr = request(t, s, "PUT", "/sensors", "hot", nil)
+	require.Equal(t, 200, rr.Code)
+
+	// In tag mode, messages that do not match are accepted, but tagged
+	rr = request(t, s, "PUT", "/v1/account/reservation/sensors/schema", `{"schema": `+schema+`, "mode": "tag"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/sensors", `{"humidity": 50}`, map[string]string{
+		"Content-Type": "application/json",
+		"Tags":         "house",
+	})
+	require.Equal(t, 200, rr.Code)
+	m := toMessage(t, rr.Body.String())
+	require.Equal(t, []string{"house", "schema-mismatch"}, m.Tags)
+	rr = request(t, s, "PUT", "/sensors", `{"temperature": 22}`, map[string]string{
+		"Content-Type": "application/json",
+	})
+	require.Equal(t, 200, rr.Code)
+	require.Empty(t, toMessage(t, rr.Body.String()).Tags)
+
+	// Remove schema
+	rr = request(t, s, "DELETE", "/v1/account/reservation/sensors/schema", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "DELETE", "/v1/account/reservation/sensors/schema", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 404, rr.Code)
+	rr = request(t, s, "PUT", "/sensors", `{"temperature": "hot"}`, map[string]string{
+		"Content-Type": "application/json",
+	})
+	require.Equal(t, 200, rr.Code)
+}
+
+func TestAccount_Reservation_Rename(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthDefault = user.PermissionReadWrite
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", MessageLimit: 100, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.ChangeTier("ben", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "alerts", user.PermissionReadWrite))
+	require.Nil(t, s.userManager.AddReservation("ben", "bens_alerts", user.PermissionDenyAll))
+
+	rr := request(t, s, "PUT", "/alerts", "before rename", nil)
+	require.Equal(t, 200, rr.Code)
+
+	// Only the owner can rename the topic, and only to a topic that is not reserved
+	rr = request(t, s, "POST", "/v1/account/reservation/alerts/rename", `{"topic": "alerts2"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+	rr = request(t, s, "POST", "/v1/account/reservation/alerts/rename", `{"topic": "bens_alerts"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 409, rr.Code)
+	rr = request(t, s, "POST", "/v1/account/reservation/alerts/rename", `{"topic": "alerts2", "deprecated": true}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// Cached messages were moved to the new topic
+	rr = request(t, s, "GET", "/alerts2/json?poll=1", "", nil)
+	require.Equal(t, 200, rr.Code)
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "before rename", messages[0].Message)
+	require.Equal(t, "alerts2", messages[0].Topic)
+
+	// Subscribers of the old topic name receive messages published to the new topic, with the old topic name
+	subscribeRR := httptest.NewRecorder()
+	subscribeCancel := subscribe(t, s, "/alerts/json", subscribeRR)
+
+	// Publishing to the old topic name publishes to the new topic, and tells the publisher to switch
+	rr = request(t, s, "PUT", "/alerts", "after rename", nil)
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, "alerts2", toMessage(t, rr.Body.String()).Topic)
+	require.Equal(t, "true", rr.Header().Get("Deprecation"))
+	require.Equal(t, `<http://127.0.0.1:12345/alerts2>; rel="successor-version"`, rr.Header().Get("Link"))
+	rr = request(t, s, "PUT", "/alerts2", "new topic", nil)
+	require.Equal(t, 200, rr.Code)
+	require.Empty(t, rr.Header().Get("Deprecation"))
+
+	subscribeCancel()
+	messages = toMessages(t, subscribeRR.Body.String())
+	require.Equal(t, 4, len(messages))
+	require.Equal(t, openEvent, messages[0].Event)
+	require.Equal(t, "alerts", messages[0].Topic)
+	require.Equal(t, renamedEvent, messages[1].Event)
+	require.Equal(t, "Topic alerts was renamed to alerts2, please subscribe to alerts2 instead", messages[1].Message)
+	received := make([]string, 0) // Fan-out is asynchronous, so the order of the messages is not guaranteed
+	for _, m := range messages[2:] {
+		received = append(received, m.Topic+": "+m.Message)
+	}
+	require.ElementsMatch(t, []string{"alerts: after rename", "alerts: new topic"}, received)
+
+	// Aliases are listed with the reservation, and the old topic name cannot be reserved by others
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	account, err := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(account.Reservations))
+	require.Equal(t, "alerts2", account.Reservations[0].Topic)
+	require.Equal(t, []*apiAccountTopicAlias{{Alias: "alerts", Deprecated: true}}, account.Reservations[0].Aliases)
+	rr = request(t, s, "POST", "/v1/account/reservation", `{"topic": "alerts", "everyone": "deny-all"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 409, rr.Code)
+
+	// Removing the alias detaches the old topic name
+	rr = request(t, s, "DELETE", "/v1/account/reservation/alerts2/alias/alerts", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 404, rr.Code)
+	rr = request(t, s, "DELETE", "/v1/account/reservation/alerts2/alias/alerts", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "PUT", "/alerts", "old topic", nil)
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, "alerts", toMessage(t, rr.Body.String()).Topic)
+	rr = request(t, s, "POST", "/v1/account/reservation", `{"topic": "alerts", "everyone": "deny-all"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, rr.Code)
+}
 func TestAccount_Reservation_PublishByAnonymousFails(t *testing.T) {
 	conf := newTestConfigWithAuthFile(t)
 	conf.AuthDefault = user.PermissionReadWrite
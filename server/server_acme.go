@@ -0,0 +1,40 @@
+package server
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newACMEManager creates an ACME manager that requests and renews TLS certificates for the configured
+// domains (e.g. from Let's Encrypt). Certificates are stored in the cache dir, so they survive restarts.
+// Challenges are answered via HTTP-01 on the HTTP listener (see Server.withACMEChallenge), and via
+// TLS-ALPN-01 on the HTTPS listener (handled by the manager's tls.Config).
+func newACMEManager(conf *Config) *autocert.Manager {
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(conf.ACMEDomains...),
+		Email:      conf.ACMEEmail,
+	}
+	if conf.ACMECacheDir != "" {
+		manager.Cache = autocert.DirCache(conf.ACMECacheDir)
+	}
+	if conf.ACMEDirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: conf.ACMEDirectoryURL}
+	}
+	return manager
+}
+
+// tlsConfig returns the TLS config for the HTTPS and HTTP/3 listeners, either backed by the ACME manager,
+// or by the configured key and cert file
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if s.acmeManager != nil {
+		return s.acmeManager.TLSConfig(), nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.config.CertFile, s.config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
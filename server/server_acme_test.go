@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ACME(t *testing.T) {
+	var acmeRequests atomic.Int32
+	acmeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acmeRequests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer acmeServer.Close()
+
+	// Pre-populate the cache, so that no certificate needs to be requested
+	conf := newTestConfig(t)
+	conf.ListenHTTP = "127.0.0.1:0"
+	conf.ListenHTTPS = "127.0.0.1:0"
+	conf.ACMEDomains = []string{"ntfy.example.com"}
+	conf.ACMECacheDir = t.TempDir()
+	conf.ACMEDirectoryURL = acmeServer.URL
+	certPEM, keyPEM := newTestCertificatePEM(t, "ntfy.example.com", 90*24*time.Hour)
+	require.Nil(t, os.WriteFile(filepath.Join(conf.ACMECacheDir, "ntfy.example.com"), append(keyPEM, certPEM...), 0600))
+	s := newTestServer(t, conf)
+	require.Nil(t, s.Start())
+	defer s.Stop()
+
+	// HTTP-01 challenges are answered by the ACME manager, everything else is served as usual
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/.well-known/acme-challenge/sometoken", s.Addr().String()), nil)
+	require.Nil(t, err)
+	req.Host = "ntfy.example.com"
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 404, resp.StatusCode) // Unknown token
+	req.Host = "other.example.com"
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 403, resp.StatusCode) // Not in acme-domains
+	resp, err = http.Get(fmt.Sprintf("http://%s/v1/health", s.Addr().String()))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	// Certificate is served from the cache
+	conn, err := tls.Dial("tcp", s.httpsListener.Addr().String(), &tls.Config{ServerName: "ntfy.example.com", InsecureSkipVerify: true})
+	require.Nil(t, err)
+	require.Equal(t, []string{"ntfy.example.com"}, conn.ConnectionState().PeerCertificates[0].DNSNames)
+	conn.Close()
+
+	// Certificates are never requested for other domains
+	_, err = tls.Dial("tcp", s.httpsListener.Addr().String(), &tls.Config{ServerName: "other.example.com", InsecureSkipVerify: true})
+	require.Error(t, err)
+	require.Equal(t, int32(0), acmeRequests.Load())
+}
@@ -2,8 +2,16 @@ package server
 
 import (
 	"errors"
+	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
 	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	logLevelRevertAfterMax = 24 * time.Hour // Max. duration of a log level change via the API
 )
 
 func (s *Server) handleUsersGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
@@ -17,22 +25,30 @@ func (s *Server) handleUsersGet(w http.ResponseWriter, r *http.Request, v *visit
 	}
 	usersResponse := make([]*apiUserResponse, len(users))
 	for i, u := range users {
-		tier := ""
+		tier, tierExpires := "", int64(0)
 		if u.Tier != nil {
 			tier = u.Tier.Code
 		}
+		if !u.TierExpires.IsZero() {
+			tierExpires = u.TierExpires.Unix()
+		}
 		userGrants := make([]*apiUserGrantResponse, len(grants[u.ID]))
 		for i, g := range grants[u.ID] {
 			userGrants[i] = &apiUserGrantResponse{
 				Topic:      g.TopicPattern,
 				Permission: g.Permission.String(),
 			}
+			if !g.Expires.IsZero() {
+				userGrants[i].Expires = g.Expires.Unix()
+			}
 		}
 		usersResponse[i] = &apiUserResponse{
-			Username: u.Name,
-			Role:     string(u.Role),
-			Tier:     tier,
-			Grants:   userGrants,
+			Username:    u.Name,
+			DisplayName: u.DisplayName(),
+			Role:        string(u.Role),
+			Tier:        tier,
+			TierExpires: tierExpires,
+			Grants:      userGrants,
 		}
 	}
 	return s.writeJSON(w, usersResponse)
@@ -44,6 +60,8 @@ func (s *Server) handleUsersAdd(w http.ResponseWriter, r *http.Request, v *visit
 		return err
 	} else if !user.AllowedUsername(req.Username) || (req.Password == "" && req.Hash == "") {
 		return errHTTPBadRequest.Wrap("username invalid, or password/password_hash missing")
+	} else if req.TierExpires != 0 && req.Tier == "" {
+		return errHTTPBadRequest.Wrap("tier_expires requires tier")
 	}
 	u, err := s.userManager.User(req.Username)
 	if err != nil && !errors.Is(err, user.ErrUserNotFound) {
@@ -71,6 +89,9 @@ func (s *Server) handleUsersAdd(w http.ResponseWriter, r *http.Request, v *visit
 		if err := s.userManager.ChangeTier(req.Username, req.Tier); err != nil {
 			return err
 		}
+		if err := s.changeTierExpiry(req.Username, req.TierExpires); err != nil {
+			return err
+		}
 	}
 	return s.writeJSON(w, newSuccessResponse())
 }
@@ -81,14 +102,16 @@ func (s *Server) handleUsersUpdate(w http.ResponseWriter, r *http.Request, v *vi
 		return err
 	} else if !user.AllowedUsername(req.Username) {
 		return errHTTPBadRequest.Wrap("username invalid")
-	} else if req.Password == "" && req.Hash == "" && req.Tier == "" {
-		return errHTTPBadRequest.Wrap("need to provide at least one of \"password\", \"password_hash\" or \"tier\"")
+	} else if req.Password == "" && req.Hash == "" && req.Tier == "" && req.TierExpires == 0 {
+		return errHTTPBadRequest.Wrap("need to provide at least one of \"password\", \"password_hash\", \"tier\" or \"tier_expires\"")
 	}
 	u, err := s.userManager.User(req.Username)
 	if err != nil && !errors.Is(err, user.ErrUserNotFound) {
 		return err
+	} else if req.TierExpires != 0 && req.Tier == "" && (u == nil || u.Tier == nil) {
+		return errHTTPBadRequest.Wrap("tier_expires requires tier")
 	} else if u != nil {
-		if u.IsAdmin() {
+		if !canManageUser(v.User(), u) {
 			return errHTTPForbidden
 		}
 		if req.Hash != "" {
@@ -118,6 +141,13 @@ func (s *Server) handleUsersUpdate(w http.ResponseWriter, r *http.Request, v *vi
 		if err := s.userManager.ChangeTier(req.Username, req.Tier); err != nil {
 			return err
 		}
+		if err := s.changeTierExpiry(req.Username, req.TierExpires); err != nil { // Changing the tier resets the expiry
+			return err
+		}
+	} else if req.TierExpires != 0 {
+		if err := s.changeTierExpiry(req.Username, req.TierExpires); err != nil {
+			return err
+		}
 	}
 	return s.writeJSON(w, newSuccessResponse())
 }
@@ -134,6 +164,8 @@ func (s *Server) handleUsersDelete(w http.ResponseWriter, r *http.Request, v *vi
 		return err
 	} else if !u.IsUser() {
 		return errHTTPUnauthorized.Wrap("can only remove regular users from API")
+	} else if !canManageUser(v.User(), u) {
+		return errHTTPForbidden
 	}
 	if err := s.userManager.RemoveUser(req.Username); err != nil {
 		return err
@@ -159,7 +191,14 @@ func (s *Server) handleAccessAllow(w http.ResponseWriter, r *http.Request, v *vi
 	if err != nil {
 		return errHTTPBadRequestPermissionInvalid
 	}
-	if err := s.userManager.AllowAccess(req.Username, req.Topic, permission); err != nil {
+	var expires time.Time
+	if req.Expires != 0 {
+		expires = time.Unix(req.Expires, 0)
+		if !expires.After(time.Now()) {
+			return errHTTPBadRequest.Wrap("expires must be in the future")
+		}
+	}
+	if err := s.userManager.AllowAccessUntil(req.Username, req.Topic, permission, expires); err != nil {
 		return err
 	}
 	return s.writeJSON(w, newSuccessResponse())
@@ -183,6 +222,84 @@ func (s *Server) handleAccessReset(w http.ResponseWriter, r *http.Request, v *vi
 	return s.writeJSON(w, newSuccessResponse())
 }
 
+func (s *Server) handleUsersReservationsGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	users, err := s.userManager.Users()
+	if err != nil {
+		return err
+	}
+	reservations, err := s.userManager.AllReservations()
+	if err != nil {
+		return err
+	}
+	reservationsResponse := make([]*apiUserReservationResponse, 0)
+	for _, u := range users {
+		for _, r := range reservations[u.ID] {
+			reservationsResponse = append(reservationsResponse, &apiUserReservationResponse{
+				Username: u.Name,
+				Topic:    r.Topic,
+				Everyone: r.Everyone.String(),
+			})
+		}
+	}
+	return s.writeJSON(w, reservationsResponse)
+}
+
+func (s *Server) handleLogLevelGet(w http.ResponseWriter, _ *http.Request, _ *visitor) error {
+	return s.writeJSON(w, newLogLevelResponse())
+}
+
+func (s *Server) handleLogLevelChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiLogLevelRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	level := log.ToLevel(req.Level)
+	if !strings.EqualFold(level.String(), req.Level) || level == log.FatalLevel {
+		return errHTTPBadRequest.Wrap("invalid log level, must be trace, debug, info, warn or error")
+	}
+	duration := s.config.LogLevelRevertAfter
+	if req.Duration != "" {
+		duration, err = util.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 || duration > logLevelRevertAfterMax {
+			return errHTTPBadRequest.Wrap("invalid duration, must be between 1s and %s", util.FormatDuration(logLevelRevertAfterMax))
+		}
+	}
+	log.SetTemporaryLevel(level, duration)
+	logvr(v, r).
+		Tag(tagManager).
+		Info("Log level temporarily set to %s for %s", level.String(), util.FormatDuration(duration))
+	return s.writeJSON(w, newLogLevelResponse())
+}
+
+func (s *Server) handleLogLevelReset(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	if log.ResetTemporaryLevel() {
+		logvr(v, r).
+			Tag(tagManager).
+			Info("Temporary log level reverted, log level is %s again", log.CurrentLevel().String())
+	}
+	return s.writeJSON(w, newLogLevelResponse())
+}
+
+func newLogLevelResponse() *apiLogLevelResponse {
+	response := &apiLogLevelResponse{
+		Level: strings.ToLower(log.CurrentLevel().String()),
+	}
+	if until := log.TemporaryLevelUntil(); !until.IsZero() {
+		response.Expires = until.Unix()
+	}
+	return response
+}
+
+// canManageUser returns true if the actor may change or delete the target user. Admins cannot be changed
+// via the API at all, and users with a custom role may only manage regular users without a custom role,
+// so that they cannot take over accounts with the same (or other) capabilities.
+func canManageUser(actor, target *user.User) bool {
+	if target.IsAdmin() {
+		return false
+	}
+	return actor.IsAdmin() || target.Role == user.RoleUser
+}
+
 func (s *Server) killUserSubscriber(u *user.User, topicPattern string) error {
 	topics, err := s.topicsFromPattern(topicPattern)
 	if err != nil {
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
+	"io"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -399,3 +402,244 @@ func TestAccess_AllowReset_KillConnection(t *testing.T) {
 		return timeTaken.Load() >= 500
 	})
 }
+
+func TestAccess_AllowWithExpiry(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+
+	// Expiry in the past is rejected
+	rr := request(t, s, "POST", "/v1/users/access", `{"username": "ben", "topic":"incident", "permission":"ro", "expires": 1}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	// Grant temporary access
+	expires := time.Now().Add(2 * time.Second).Unix()
+	rr = request(t, s, "POST", "/v1/users/access", fmt.Sprintf(`{"username": "ben", "topic":"incident", "permission":"ro", "expires": %d}`, expires), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/users", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	users, err := util.UnmarshalJSON[[]apiUserResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "ben", (*users)[1].Username)
+	require.Equal(t, 1, len((*users)[1].Grants))
+	require.Equal(t, expires, (*users)[1].Grants[0].Expires)
+
+	// Subscribe while access is still valid
+	start, timeTaken := time.Now(), atomic.Int64{}
+	go func() {
+		rr := request(t, s, "GET", "/incident/json", "", map[string]string{
+			"Authorization": util.BasicAuth("ben", "ben"),
+		})
+		require.Equal(t, 200, rr.Code)
+		timeTaken.Store(time.Since(start).Milliseconds())
+	}()
+
+	// Wait for expiry, and have the background job revoke the access
+	waitFor(t, func() bool {
+		return time.Now().Unix() > expires
+	})
+	s.pruneAccess()
+	waitFor(t, func() bool {
+		return timeTaken.Load() > 0
+	})
+	grants, err := s.userManager.Grants("ben")
+	require.Nil(t, err)
+	require.Empty(t, grants)
+
+	rr = request(t, s, "GET", "/incident/json?poll=1", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 403, rr.Code)
+}
+
+func TestUser_CustomRoles(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	// Create roles and users
+	require.Nil(t, s.userManager.AddRole(&user.CustomRole{Name: "auditor", Capabilities: []user.Capability{user.CapabilityUsersRead}}))
+	require.Nil(t, s.userManager.AddRole(&user.CustomRole{Name: "operator", Capabilities: []user.Capability{user.CapabilityUsersWrite, user.CapabilityAccessWrite}}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin, false))
+	require.Nil(t, s.userManager.AddUser("alice", "alice", "auditor", false))
+	require.Nil(t, s.userManager.AddUser("olivia", "olivia", "operator", false))
+	require.Nil(t, s.userManager.AddUser("oscar", "oscar", "operator", false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+
+	// Auditor can list users, but not change them or their access
+	rr := request(t, s, "GET", "/v1/users", "", map[string]string{
+		"Authorization": util.BasicAuth("alice", "alice"),
+	})
+	require.Equal(t, 200, rr.Code)
+	users, err := util.UnmarshalJSON[[]apiUserResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 6, len(*users))
+
+	rr = request(t, s, "POST", "/v1/users", `{"username": "emma", "password":"emma"}`, map[string]string{
+		"Authorization": util.BasicAuth("alice", "alice"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	rr = request(t, s, "PUT", "/v1/users/access", `{"username": "ben", "topic":"gold", "permission":"rw"}`, map[string]string{
+		"Authorization": util.BasicAuth("alice", "alice"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Operator can add users and grant access, but not list users
+	rr = request(t, s, "GET", "/v1/users", "", map[string]string{
+		"Authorization": util.BasicAuth("olivia", "olivia"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	rr = request(t, s, "POST", "/v1/users", `{"username": "emma", "password":"emma"}`, map[string]string{
+		"Authorization": util.BasicAuth("olivia", "olivia"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "PUT", "/v1/users/access", `{"username": "ben", "topic":"gold", "permission":"rw"}`, map[string]string{
+		"Authorization": util.BasicAuth("olivia", "olivia"),
+	})
+	require.Equal(t, 200, rr.Code)
+	ben, err := s.userManager.User("ben")
+	require.Nil(t, err)
+	require.Nil(t, s.userManager.Authorize(ben, "gold", user.PermissionWrite))
+
+	// Operator cannot change or delete other users with a custom role, but admins can
+	rr = request(t, s, "PUT", "/v1/users", `{"username": "oscar", "password":"hijacked"}`, map[string]string{
+		"Authorization": util.BasicAuth("olivia", "olivia"),
+	})
+	require.Equal(t, 403, rr.Code)
+
+	rr = request(t, s, "DELETE", "/v1/users", `{"username": "oscar"}`, map[string]string{
+		"Authorization": util.BasicAuth("olivia", "olivia"),
+	})
+	require.Equal(t, 403, rr.Code)
+
+	rr = request(t, s, "DELETE", "/v1/users", `{"username": "oscar"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// Account endpoint shows capabilities
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("olivia", "olivia"),
+	})
+	require.Equal(t, 200, rr.Code)
+	account, err := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "operator", account.Role)
+	require.Equal(t, []string{"users-write", "access-write"}, account.Capabilities)
+}
+
+func TestUser_CustomRoles_StatsRead(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+
+	require.Nil(t, s.userManager.AddRole(&user.CustomRole{Name: "auditor", Capabilities: []user.Capability{user.CapabilityStatsRead}}))
+	require.Nil(t, s.userManager.AddUser("alice", "alice", "auditor", false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddReservation("ben", "mytopic", user.PermissionRead))
+
+	// Auditor can list all reservations, but regular users cannot
+	rr := request(t, s, "GET", "/v1/users/reservations", "", map[string]string{
+		"Authorization": util.BasicAuth("alice", "alice"),
+	})
+	require.Equal(t, 200, rr.Code)
+	reservations, err := util.UnmarshalJSON[[]apiUserReservationResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, []apiUserReservationResponse{{Username: "ben", Topic: "mytopic", Everyone: "read-only"}}, *reservations)
+
+	rr = request(t, s, "GET", "/v1/users/reservations", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Auditor cannot list users
+	rr = request(t, s, "GET", "/v1/users", "", map[string]string{
+		"Authorization": util.BasicAuth("alice", "alice"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Auditor sees detailed stats, regular users only see the public stats
+	rr = request(t, s, "GET", "/v1/stats", "", map[string]string{
+		"Authorization": util.BasicAuth("alice", "alice"),
+	})
+	require.Equal(t, 200, rr.Code)
+	stats, err := util.UnmarshalJSON[apiStatsResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 3, stats.Users) // Includes everyone user
+	require.Equal(t, 1, stats.Reservations)
+
+	rr = request(t, s, "GET", "/v1/stats", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, rr.Code)
+	require.NotContains(t, rr.Body.String(), "reservations")
+}
+
+func TestLogLevel_ChangeReset(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	defer s.closeDatabases()
+	defer log.SetLevel(log.CurrentLevel())
+
+	require.Nil(t, s.userManager.AddRole(&user.CustomRole{Name: "oncall", Capabilities: []user.Capability{user.CapabilityLogLevel}}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", "oncall", false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	log.SetLevel(log.ErrorLevel)
+
+	// Regular users cannot change the log level
+	rr := request(t, s, "PUT", "/v1/log/level", `{"level":"debug"}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Invalid level or duration
+	rr = request(t, s, "PUT", "/v1/log/level", `{"level":"verbose"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+	rr = request(t, s, "PUT", "/v1/log/level", `{"level":"debug", "duration":"2d"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	// Change log level temporarily
+	rr = request(t, s, "PUT", "/v1/log/level", `{"level":"debug", "duration":"30m"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	response, err := util.UnmarshalJSON[apiLogLevelResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "debug", response.Level)
+	require.InDelta(t, time.Now().Add(30*time.Minute).Unix(), response.Expires, 2)
+	require.Equal(t, log.DebugLevel, log.CurrentLevel())
+
+	rr = request(t, s, "GET", "/v1/log/level", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	response, err = util.UnmarshalJSON[apiLogLevelResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "debug", response.Level)
+
+	// Revert
+	rr = request(t, s, "DELETE", "/v1/log/level", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	response, err = util.UnmarshalJSON[apiLogLevelResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "error", response.Level)
+	require.Equal(t, int64(0), response.Expires)
+	require.Equal(t, log.ErrorLevel, log.CurrentLevel())
+}
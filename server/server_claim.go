@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Claims allow using a topic as a lightweight work queue with at-least-once delivery: instead of (or in addition
+// to) subscribing, workers claim the oldest unacknowledged message of a topic via POST /<topic>/claim, and
+// acknowledge it via POST /<topic>/ack/<claim> once it has been processed. A claimed message is hidden from other
+// workers until its visibility timeout passes; if it is not acknowledged by then, it is handed out again.
+//
+// Claims are stored in the message cache, so claiming only works for messages that are still cached. Regular
+// subscribers are not affected by claims, they receive all messages as usual.
+
+const (
+	claimIDPrefix                 = "cl_"
+	claimIDLength                 = 32
+	claimVisibilityTimeoutDefault = 30 * time.Second
+	claimVisibilityTimeoutMax     = 12 * time.Hour
+)
+
+// handleClaim claims the oldest message of the topic that has not been acknowledged, and that is not currently
+// claimed by someone else. It returns 204 No Content if there is no such message.
+func (s *Server) handleClaim(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	t, err := s.topicFromPath(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	visibilityTimeout := claimVisibilityTimeoutDefault
+	if value := readParam(r, "x-visibility-timeout", "visibility-timeout", "visibility"); value != "" {
+		visibilityTimeout, err = util.ParseDuration(value)
+		if err != nil || visibilityTimeout <= 0 || visibilityTimeout > claimVisibilityTimeoutMax {
+			return errHTTPBadRequestVisibilityTimeoutInvalid
+		}
+	}
+	claim := util.RandomStringPrefix(claimIDPrefix, claimIDLength)
+	expires := time.Now().Add(visibilityTimeout)
+	m, deliveries, err := s.messageCache.ClaimMessage(t.ID, claim, expires)
+	if errors.Is(err, errMessageNotFound) {
+		w.Header().Set("Access-Control-Allow-Origin", s.config.AccessControlAllowOrigin) // CORS, allow cross-origin requests
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	logvr(v, r).
+		Tag(tagClaim).
+		With(t).
+		Fields(log.Context{
+			"message_id": m.ID,
+			"deliveries": deliveries,
+			"expires":    expires.Unix(),
+		}).
+		Debug("Message claimed")
+	return s.writeJSON(w, &apiClaimResponse{
+		Claim:      claim,
+		Expires:    expires.Unix(),
+		Deliveries: deliveries,
+		Message:    m,
+	})
+}
+
+// handleAck acknowledges a claimed message, so that it is never handed out again. Instead of a claim, the path
+// may also contain a message ID, in which case the pending escalation of the message is stopped, see
+// escalateMessages. Acknowledging a claim also stops the escalation of the claimed message.
+func (s *Server) handleAck(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	t, err := s.topicFromPath(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	matches := ackPathRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return errHTTPInternalErrorInvalidPath
+	}
+	if !strings.HasPrefix(matches[1], claimIDPrefix) {
+		acked, err := s.messageCache.AckEscalation(t.ID, matches[1])
+		if err != nil {
+			return err
+		} else if !acked {
+			return errHTTPNotFoundEscalation.With(t)
+		}
+		logvr(v, r).Tag(tagClaim).With(t).Field("message_id", matches[1]).Debug("Message acknowledged, stopping escalation")
+		return s.writeJSON(w, newSuccessResponse())
+	}
+	acked, err := s.messageCache.AckMessage(t.ID, matches[1])
+	if err != nil {
+		return err
+	} else if !acked {
+		return errHTTPNotFoundClaim.With(t)
+	}
+	logvr(v, r).Tag(tagClaim).With(t).Debug("Message acknowledged")
+	return s.writeJSON(w, newSuccessResponse())
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Claim_AckAndRedeliver(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "PUT", "/jobs", "job 1", nil)
+	job1 := toMessage(t, response.Body.String())
+	request(t, s, "PUT", "/jobs", "job 2", nil)
+
+	// Workers get different messages
+	response = request(t, s, "POST", "/jobs/claim", "", nil)
+	require.Equal(t, 200, response.Code)
+	claim1 := toClaim(t, response.Body.String())
+	require.Regexp(t, `^cl_[A-Za-z0-9]{29}$`, claim1.Claim)
+	require.Equal(t, job1.ID, claim1.Message.ID)
+	require.Equal(t, "job 1", claim1.Message.Message)
+	require.Equal(t, 1, claim1.Deliveries)
+	require.InDelta(t, time.Now().Add(claimVisibilityTimeoutDefault).Unix(), claim1.Expires, 2)
+
+	response = request(t, s, "POST", "/jobs/claim", "", map[string]string{"X-Visibility-Timeout": "1h"})
+	claim2 := toClaim(t, response.Body.String())
+	require.Equal(t, "job 2", claim2.Message.Message)
+
+	response = request(t, s, "POST", "/jobs/claim", "", nil)
+	require.Equal(t, 204, response.Code)
+
+	// Acknowledged messages are never redelivered, unacknowledged messages are redelivered after the timeout
+	response = request(t, s, "POST", "/jobs/ack/"+claim1.Claim, "", nil)
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "POST", "/jobs/ack/"+claim1.Claim, "", nil)
+	require.Equal(t, 404, response.Code)
+	require.Equal(t, 40404, toHTTPError(t, response.Body.String()).Code)
+
+	_, err := s.messageCache.db.Exec(`UPDATE claims SET expires = ? WHERE claim = ?`, time.Now().Unix()-1, claim2.Claim)
+	require.Nil(t, err)
+	response = request(t, s, "POST", "/jobs/claim", "", nil)
+	claim3 := toClaim(t, response.Body.String())
+	require.Equal(t, "job 2", claim3.Message.Message)
+	require.Equal(t, 2, claim3.Deliveries)
+	require.NotEqual(t, claim2.Claim, claim3.Claim)
+
+	// The first claim is void once the message was handed out again
+	response = request(t, s, "POST", "/jobs/ack/"+claim2.Claim, "", nil)
+	require.Equal(t, 404, response.Code)
+	response = request(t, s, "POST", "/jobs/ack/"+claim3.Claim, "", nil)
+	require.Equal(t, 200, response.Code)
+
+	// Regular subscribers are not affected
+	response = request(t, s, "GET", "/jobs/json?poll=1", "", nil)
+	require.Equal(t, 2, len(toMessages(t, response.Body.String())))
+}
+
+func TestServer_Claim_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	request(t, s, "PUT", "/jobs", "job 1", nil)
+
+	response := request(t, s, "POST", "/jobs/claim?visibility=13h", "", nil)
+	require.Equal(t, 40064, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/jobs/ack/cl_doesnotexist1234567890abcdefg", "", nil)
+	require.Equal(t, 404, response.Code)
+
+	// Claims are per topic
+	response = request(t, s, "POST", "/jobs/claim", "", nil)
+	claim := toClaim(t, response.Body.String())
+	response = request(t, s, "POST", "/otherjobs/ack/"+claim.Claim, "", nil)
+	require.Equal(t, 404, response.Code)
+}
+
+func TestServer_Claim_CacheDisabled(t *testing.T) {
+	c := newTestConfig(t)
+	c.CacheDuration = 0
+	s := newTestServer(t, c)
+
+	response := request(t, s, "POST", "/jobs/claim", "", nil)
+	require.Equal(t, 404, response.Code)
+}
+
+func toClaim(t *testing.T, s string) *apiClaimResponse {
+	var claim apiClaimResponse
+	require.Nil(t, json.Unmarshal([]byte(s), &claim))
+	return &claim
+}
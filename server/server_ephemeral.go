@@ -0,0 +1,169 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Ephemeral topics are short-lived topics with a random name, e.g. for sharing a link for a few minutes, or for
+// the notifications of a single CI job. They are created via POST /v1/ephemeral, and deleted automatically after
+// their TTL, or shortly after the configured number of messages has been published. Deleting an ephemeral topic
+// deletes its cached messages and attachments, as well as its reservation (if the topic was reserved).
+//
+// Ephemeral topics are stored in the message cache, and are otherwise regular topics: subscribing to them and
+// publishing to them works the same way as for any other topic.
+
+const (
+	ephemeralTopicPrefix           = "ep_"
+	ephemeralTopicLength           = 32
+	ephemeralTopicTTLDefault       = time.Hour
+	ephemeralTopicTTLMax           = 7 * 24 * time.Hour
+	ephemeralTopicClosedExpiry     = 5 * time.Minute // Once the message limit is reached, subscribers have this long to fetch the messages
+	ephemeralTopicsPerOwnerLimit   = 50
+	ephemeralTopicMessagesLimitMax = 1000
+)
+
+// ephemeralTopic is an ephemeral topic, as stored in the message cache
+type ephemeralTopic struct {
+	Topic         string
+	Owner         string // User ID or IP address of the creator, see visitorOwner
+	User          string // Name of the user the topic is reserved for, if any
+	Expires       int64
+	Messages      int
+	MessagesLimit int // 0 means unlimited
+}
+
+// handleEphemeralTopicCreate creates an ephemeral topic with a random name. If "everyone" is set, the topic is
+// reserved for the user (requires a user with reservations left), so that access for everyone else can be limited.
+func (s *Server) handleEphemeralTopicCreate(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiEphemeralTopicRequest](r.Body, jsonBodyBytesLimit, true)
+	if err != nil {
+		return err
+	}
+	ttl := ephemeralTopicTTLDefault
+	if req.TTL != "" {
+		ttl, err = util.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > ephemeralTopicTTLMax {
+			return errHTTPBadRequestEphemeralTopicInvalid
+		}
+	}
+	if req.Messages < 0 || req.Messages > ephemeralTopicMessagesLimitMax {
+		return errHTTPBadRequestEphemeralTopicInvalid
+	}
+	owner := visitorOwner(v)
+	count, err := s.messageCache.EphemeralTopicsCount(owner)
+	if err != nil {
+		return err
+	} else if count >= ephemeralTopicsPerOwnerLimit {
+		return errHTTPTooManyRequestsLimitEphemeralTopics
+	}
+	t := &ephemeralTopic{
+		Topic:         util.RandomStringPrefix(ephemeralTopicPrefix, ephemeralTopicLength),
+		Owner:         owner,
+		Expires:       time.Now().Add(ttl).Unix(),
+		MessagesLimit: req.Messages,
+	}
+	if req.Everyone != "" {
+		if err := s.reserveEphemeralTopic(v, t, req.Everyone); err != nil {
+			return err
+		}
+	}
+	if err := s.messageCache.AddEphemeralTopic(t); err != nil {
+		return err
+	}
+	logvr(v, r).
+		Tag(tagEphemeral).
+		Fields(log.Context{
+			"topic":          t.Topic,
+			"expires":        t.Expires,
+			"messages_limit": t.MessagesLimit,
+		}).
+		Debug("Created ephemeral topic")
+	return s.writeJSON(w, &apiEphemeralTopicResponse{
+		Topic:         t.Topic,
+		Expires:       t.Expires,
+		MessagesLimit: t.MessagesLimit,
+	})
+}
+
+// handleEphemeralTopicDelete deletes an ephemeral topic before it expires. Only its creator can delete it.
+func (s *Server) handleEphemeralTopicDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	matches := apiEphemeralTopicSingleRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return errHTTPInternalErrorInvalidPath
+	}
+	t, err := s.messageCache.EphemeralTopic(matches[1])
+	if errors.Is(err, errNoRows) {
+		return errHTTPNotFoundEphemeralTopic
+	} else if err != nil {
+		return err
+	} else if t.Owner != visitorOwner(v) {
+		return errHTTPNotFoundEphemeralTopic
+	}
+	logvr(v, r).Tag(tagEphemeral).Field("topic", t.Topic).Debug("Deleting ephemeral topic")
+	if err := s.deleteEphemeralTopic(t); err != nil {
+		return err
+	}
+	s.pruneMessages()
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// countEphemeralTopicMessage counts a message published to the topic towards the message limit of the topic,
+// if it is an ephemeral topic. It returns an error if the topic has expired or if its message limit is reached.
+func (s *Server) countEphemeralTopicMessage(t *topic) error {
+	if !strings.HasPrefix(t.ID, ephemeralTopicPrefix) {
+		return nil // Fast path, avoids a database query for regular topics
+	}
+	if _, err := s.messageCache.EphemeralTopic(t.ID); errors.Is(err, errNoRows) {
+		return nil // Not an ephemeral topic, just a regular topic with the same prefix
+	} else if err != nil {
+		return err
+	}
+	allowed, err := s.messageCache.CountEphemeralTopicMessage(t.ID, ephemeralTopicClosedExpiry)
+	if err != nil {
+		return err
+	} else if !allowed {
+		return errHTTPGoneEphemeralTopic.With(t)
+	}
+	return nil
+}
+
+// reserveEphemeralTopic reserves the topic for the user, with the given permission for everyone else
+func (s *Server) reserveEphemeralTopic(v *visitor, t *ephemeralTopic, everyoneStr string) error {
+	u := v.User()
+	if s.userManager == nil || u == nil {
+		return errHTTPUnauthorized
+	}
+	everyone, err := user.ParsePermission(everyoneStr)
+	if err != nil {
+		return errHTTPBadRequestPermissionInvalid
+	}
+	if err := s.checkReservationAllowed(u, t.Topic); err != nil {
+		return err
+	}
+	if err := s.userManager.AddReservation(u.Name, t.Topic, everyone); err != nil {
+		return err
+	}
+	t.User = u.Name
+	return nil
+}
+
+// deleteEphemeralTopic expires the messages of the topic (which deletes them and their attachments the next
+// time messages are pruned), removes its reservation, and then the topic itself
+func (s *Server) deleteEphemeralTopic(t *ephemeralTopic) error {
+	if err := s.messageCache.ExpireMessages(t.Topic); err != nil {
+		return err
+	}
+	if t.User != "" && s.userManager != nil {
+		if err := s.userManager.RemoveReservations(t.User, t.Topic); err != nil {
+			log.Tag(tagEphemeral).Field("topic", t.Topic).Err(err).Warn("Error removing reservation of ephemeral topic")
+		}
+	}
+	return s.messageCache.DeleteEphemeralTopic(t.Topic)
+}
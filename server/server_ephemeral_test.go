@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_Ephemeral_MessageLimitAndExpiry(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "POST", "/v1/ephemeral", `{"ttl":"2h","messages":2}`, nil)
+	require.Equal(t, 200, response.Code)
+	var topic apiEphemeralTopicResponse
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&topic))
+	require.Regexp(t, `^ep_[A-Za-z0-9]{29}$`, topic.Topic)
+	require.Equal(t, 2, topic.MessagesLimit)
+	require.InDelta(t, time.Now().Add(2*time.Hour).Unix(), topic.Expires, 5)
+
+	// Message limit
+	response = request(t, s, "PUT", "/"+topic.Topic, "first", nil)
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "PUT", "/"+topic.Topic, "second", nil)
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "PUT", "/"+topic.Topic, "third", nil)
+	require.Equal(t, 410, response.Code)
+	require.Equal(t, 41002, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "GET", "/"+topic.Topic+"/json?poll=1", "", nil)
+	require.Equal(t, 2, len(toMessages(t, response.Body.String())))
+
+	// Closed topics expire shortly after the last message
+	et, err := s.messageCache.EphemeralTopic(topic.Topic)
+	require.Nil(t, err)
+	require.Equal(t, 2, et.Messages)
+	require.InDelta(t, time.Now().Add(ephemeralTopicClosedExpiry).Unix(), et.Expires, 5)
+
+	// Expired topics are deleted along with their messages
+	_, err = s.messageCache.db.Exec(`UPDATE ephemeral_topics SET expires = ?`, time.Now().Unix()-1)
+	require.Nil(t, err)
+	s.execManager()
+	_, err = s.messageCache.EphemeralTopic(topic.Topic)
+	require.Equal(t, errNoRows, err)
+	response = request(t, s, "GET", "/"+topic.Topic+"/json?poll=1", "", nil)
+	require.Empty(t, toMessages(t, response.Body.String()))
+}
+
+func TestServer_Ephemeral_ReservedAndDeleted(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", MessageLimit: 10, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	auth := map[string]string{"Authorization": util.BasicAuth("phil", "phil")}
+
+	// Anonymous users cannot reserve ephemeral topics
+	response := request(t, s, "POST", "/v1/ephemeral", `{"everyone":"deny-all"}`, nil)
+	require.Equal(t, 401, response.Code)
+
+	response = request(t, s, "POST", "/v1/ephemeral", `{"everyone":"deny-all"}`, auth)
+	require.Equal(t, 200, response.Code)
+	var topic apiEphemeralTopicResponse
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&topic))
+	require.Equal(t, 0, topic.MessagesLimit)
+
+	response = request(t, s, "PUT", "/"+topic.Topic, "secret", nil)
+	require.Equal(t, 403, response.Code)
+	response = request(t, s, "PUT", "/"+topic.Topic, "secret", auth)
+	require.Equal(t, 200, response.Code)
+
+	// Only the creator can delete it; deleting removes the reservation and the messages
+	response = request(t, s, "DELETE", "/v1/ephemeral/"+topic.Topic, "", nil)
+	require.Equal(t, 404, response.Code)
+	response = request(t, s, "DELETE", "/v1/ephemeral/"+topic.Topic, "", auth)
+	require.Equal(t, 200, response.Code)
+
+	reservations, err := s.userManager.Reservations("phil")
+	require.Nil(t, err)
+	require.Empty(t, reservations)
+	response = request(t, s, "GET", "/"+topic.Topic+"/json?poll=1", "", auth)
+	require.Empty(t, toMessages(t, response.Body.String()))
+}
+
+func TestServer_Ephemeral_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "POST", "/v1/ephemeral", `{"ttl":"30d"}`, nil)
+	require.Equal(t, 40063, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/v1/ephemeral", `{"messages":-1}`, nil)
+	require.Equal(t, 40063, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/v1/ephemeral", `{"everyone":"read-only"}`, nil)
+	require.Equal(t, 401, response.Code)
+	response = request(t, s, "DELETE", "/v1/ephemeral/ep_doesnotexist1234567890abcdefg", "", nil)
+	require.Equal(t, 404, response.Code)
+
+	// Regular topics with the same prefix are not affected
+	response = request(t, s, "PUT", "/ep_mytopic", "hi", nil)
+	require.Equal(t, 200, response.Code)
+}
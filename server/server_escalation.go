@@ -0,0 +1,292 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Escalation policies turn a reserved topic into a lightweight on-call pager: if a message published to the topic
+// is not acknowledged in time, it is re-published with a higher priority and/or to an escalation topic, and/or sent
+// via email or phone call. A policy consists of up to escalationStepsMax steps, each of which is executed a given
+// duration after the message was published, unless the message was acknowledged before.
+//
+// Messages are acknowledged via POST /<topic>/ack/<message-id> (the escalated messages have an "Acknowledge"
+// action button for that), or by acknowledging a claim of the message (see handleAck). Pending escalations are
+// stored in the message cache, and executed by the manager, see escalateMessages. Policies are managed by the
+// topic owner via /v1/account/reservation/<topic>/escalation, and are stored in the user database.
+
+const (
+	escalationStepsMax = 5
+	escalationTag      = "rotating_light"
+	escalationAckLabel = "Acknowledge"
+)
+
+// handleAccountTopicEscalationGet returns the escalation policy of a topic reserved by the current user
+func (s *Server) handleAccountTopicEscalationGet(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationEscalationRegex)
+	if err != nil {
+		return err
+	}
+	escalation, err := s.userManager.TopicEscalation(topic)
+	if errors.Is(err, user.ErrTopicEscalationNotFound) {
+		return errHTTPNotFound
+	} else if err != nil {
+		return err
+	}
+	steps := make([]*apiAccountTopicEscalationStep, 0, len(escalation.Steps))
+	for _, step := range escalation.Steps {
+		steps = append(steps, &apiAccountTopicEscalationStep{
+			After:    step.After.String(),
+			Priority: step.Priority,
+			Topic:    step.Topic,
+			Email:    step.Email,
+			Call:     step.Call,
+		})
+	}
+	return s.writeJSON(w, &apiAccountTopicEscalationResponse{
+		Topic:       escalation.Topic,
+		MinPriority: escalation.MinPriority,
+		Steps:       steps,
+	})
+}
+
+// handleAccountTopicEscalationChange sets the escalation policy of a topic reserved by the current user,
+// replacing any existing policy. Pending escalations of earlier messages use the new policy.
+func (s *Server) handleAccountTopicEscalationChange(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationEscalationRegex)
+	if err != nil {
+		return err
+	}
+	req, err := readJSONWithLimit[apiAccountTopicEscalationRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	minPriority := 1
+	if req.MinPriority != 0 {
+		minPriority = req.MinPriority
+	}
+	if minPriority < 1 || minPriority > 5 {
+		return errHTTPBadRequestTopicEscalationInvalid.Wrap("min_priority must be between 1 and 5")
+	} else if len(req.Steps) == 0 || len(req.Steps) > escalationStepsMax {
+		return errHTTPBadRequestTopicEscalationInvalid.Wrap("between 1 and %d steps are required", escalationStepsMax)
+	}
+	steps := make([]*user.EscalationStep, 0, len(req.Steps))
+	for i, reqStep := range req.Steps {
+		step, e := s.parseEscalationStep(v.User(), reqStep)
+		if e != nil {
+			return e
+		} else if i > 0 && step.After <= steps[i-1].After {
+			return errHTTPBadRequestTopicEscalationInvalid.Wrap("steps must be ordered by 'after'")
+		}
+		steps = append(steps, step)
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":                   topic,
+			"escalation_min_priority": minPriority,
+			"escalation_steps":        len(steps),
+		}).
+		Debug("Setting escalation policy for topic %s", topic)
+	if err := s.userManager.SetTopicEscalation(v.User().Name, topic, minPriority, steps); err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// handleAccountTopicEscalationDelete removes the escalation policy from a topic reserved by the current user.
+// Pending escalations are dropped the next time they are due.
+func (s *Server) handleAccountTopicEscalationDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationEscalationRegex)
+	if err != nil {
+		return err
+	}
+	logvr(v, r).Tag(tagAccount).Field("topic", topic).Debug("Removing escalation policy for topic %s", topic)
+	if err := s.userManager.RemoveTopicEscalation(v.User().Name, topic); errors.Is(err, user.ErrTopicEscalationNotFound) {
+		return errHTTPNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// parseEscalationStep validates an escalation step of the given topic owner. The owner must be allowed to publish
+// to the escalation topic, and phone calls can only be made to verified phone numbers of the owner.
+func (s *Server) parseEscalationStep(u *user.User, req *apiAccountTopicEscalationStep) (*user.EscalationStep, *errHTTP) {
+	after, err := util.ParseDuration(req.After)
+	if err != nil || after <= 0 {
+		return nil, errHTTPBadRequestTopicEscalationInvalid.Wrap("invalid 'after' duration: %s", req.After)
+	} else if s.config.CacheDuration > 0 && after > s.config.CacheDuration {
+		return nil, errHTTPBadRequestTopicEscalationInvalid.Wrap("'after' must not be longer than the cache duration (%s)", s.config.CacheDuration)
+	} else if req.Priority < 0 || req.Priority > 5 {
+		return nil, errHTTPBadRequestTopicEscalationInvalid.Wrap("priority must be between 1 and 5")
+	} else if req.Priority == 0 && req.Topic == "" && req.Email == "" && req.Call == "" {
+		return nil, errHTTPBadRequestTopicEscalationInvalid.Wrap("step must set priority, topic, email or call")
+	}
+	step := &user.EscalationStep{
+		After:    after,
+		Priority: req.Priority,
+		Topic:    req.Topic,
+		Email:    req.Email,
+	}
+	if req.Topic != "" {
+		if !topicRegex.MatchString(req.Topic) || util.Contains(s.config.DisallowedTopics, req.Topic) {
+			return nil, errHTTPBadRequestTopicInvalid
+		} else if err := s.userManager.Authorize(u, req.Topic, user.PermissionWrite); err != nil {
+			return nil, errHTTPForbidden
+		}
+	}
+	if req.Email != "" && s.smtpSender == nil {
+		return nil, errHTTPBadRequestEmailDisabled
+	}
+	if req.Call != "" {
+		if s.config.TwilioAccount == "" {
+			return nil, errHTTPBadRequestPhoneCallsDisabled
+		}
+		call, e := s.convertPhoneNumber(u, req.Call)
+		if e != nil {
+			return nil, e
+		}
+		step.Call = call
+	}
+	return step, nil
+}
+
+// scheduleEscalation schedules the first escalation step of the given message, if its topic has an escalation
+// policy and the message priority is high enough
+func (s *Server) scheduleEscalation(v *visitor, m *message) {
+	if s.userManager == nil || m.Event != messageEvent {
+		return
+	}
+	escalation, err := s.userManager.TopicEscalation(m.Topic)
+	if errors.Is(err, user.ErrTopicEscalationNotFound) {
+		return
+	} else if err != nil {
+		logvm(v, m).Tag(tagPublish).Err(err).Warn("Cannot read escalation policy")
+		return
+	} else if effectivePriority(m.Priority) < escalation.MinPriority {
+		return
+	}
+	next := time.Unix(m.Time, 0).Add(escalation.Steps[0].After)
+	logvm(v, m).Tag(tagPublish).Field("escalation_next", next.Unix()).Debug("Scheduling escalation of message")
+	if err := s.messageCache.AddEscalation(m.ID, next); err != nil {
+		logvm(v, m).Tag(tagPublish).Err(err).Warn("Cannot schedule escalation of message")
+	}
+}
+
+// escalateMessages executes all escalation steps that are due, and schedules the next step (if any). Pending
+// escalations of messages that were deleted, or of topics without escalation policy, are dropped.
+func (s *Server) escalateMessages() {
+	if s.userManager == nil {
+		return
+	}
+	log.
+		Tag(tagManager).
+		Timing(func() {
+			escalations, err := s.messageCache.EscalationsDue(time.Now())
+			if err != nil {
+				log.Tag(tagManager).Err(err).Warn("Error retrieving due escalations")
+				return
+			}
+			for _, e := range escalations {
+				if err := s.escalateMessage(e); err != nil {
+					log.Tag(tagManager).Field("message_id", e.MessageID).Err(err).Warn("Error escalating message")
+				}
+			}
+		}).
+		Debug("Checked for due escalations")
+}
+
+func (s *Server) escalateMessage(e *escalation) error {
+	m, err := s.messageCache.Message(e.MessageID)
+	if errors.Is(err, errMessageNotFound) {
+		return s.messageCache.DeleteEscalation(e.MessageID)
+	} else if err != nil {
+		return err
+	}
+	policy, err := s.userManager.TopicEscalation(m.Topic)
+	if errors.Is(err, user.ErrTopicEscalationNotFound) || (err == nil && e.Step >= len(policy.Steps)) {
+		return s.messageCache.DeleteEscalation(e.MessageID)
+	} else if err != nil {
+		return err
+	}
+	u, err := s.userManager.User(policy.Owner)
+	if err != nil {
+		return err
+	}
+	v := s.visitor(netip.IPv4Unspecified(), u)
+	step := policy.Steps[e.Step]
+	escalated := s.newEscalatedMessage(m, step)
+	escalated.User = u.ID
+	escalated.Expires = time.Unix(escalated.Time, 0).Add(v.Limits().MessageExpiryDuration).Unix()
+	logvm(v, m).
+		Tag(tagManager).
+		Fields(log.Context{
+			"escalation_step":  e.Step,
+			"escalation_topic": escalated.Topic,
+		}).
+		Info("Message was not acknowledged, escalating (step %d of %d)", e.Step+1, len(policy.Steps))
+	if err := s.publishManagerMessage(v, escalated); err != nil {
+		return err
+	}
+	if !s.topicSilenced(escalated.Topic) {
+		if s.smtpSender != nil && step.Email != "" {
+			go s.sendEmail(v, escalated, step.Email, s.language(u, nil))
+		}
+		if s.config.TwilioAccount != "" && step.Call != "" {
+			go s.callPhone(v, nil, escalated, step.Call)
+		}
+	}
+	if e.Step+1 < len(policy.Steps) {
+		return s.messageCache.UpdateEscalation(m.ID, e.Step+1, time.Unix(m.Time, 0).Add(policy.Steps[e.Step+1].After))
+	}
+	return s.messageCache.DeleteEscalation(m.ID)
+}
+
+// newEscalatedMessage creates a copy of the given message for the given escalation step. Attachments are not
+// copied. If the base URL is set, an "Acknowledge" action button is added that acknowledges the original message.
+func (s *Server) newEscalatedMessage(m *message, step *user.EscalationStep) *message {
+	topic := m.Topic
+	if step.Topic != "" {
+		topic = step.Topic
+	}
+	escalated := newDefaultMessage(topic, m.Message)
+	escalated.Title = m.Title
+	escalated.Priority = m.Priority
+	if step.Priority > 0 {
+		escalated.Priority = step.Priority
+	}
+	escalated.Tags = append(append(make([]string, 0, len(m.Tags)+1), m.Tags...), escalationTag)
+	escalated.Click = m.Click
+	escalated.Icon = m.Icon
+	escalated.ContentType = m.ContentType
+	escalated.Encoding = m.Encoding
+	escalated.Metadata = m.Metadata
+	escalated.Actions = append(make([]*action, 0, len(m.Actions)+1), m.Actions...)
+	if s.config.BaseURL != "" && len(escalated.Actions) < actionsMax {
+		escalated.Actions = append(escalated.Actions, &action{
+			ID:     util.RandomString(actionIDLength),
+			Action: actionHTTP,
+			Label:  escalationAckLabel,
+			URL:    fmt.Sprintf("%s/%s/ack/%s", s.config.BaseURL, m.Topic, m.ID),
+			Method: http.MethodPost,
+			Clear:  true,
+		})
+	}
+	return escalated
+}
+
+// effectivePriority returns the priority of a message, taking into account that zero means default priority
+func effectivePriority(priority int) int {
+	if priority == 0 {
+		return 3
+	}
+	return priority
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_TopicEscalation_ChangeGetDelete(t *testing.T) {
+	s := newTestServerWithEscalation(t)
+
+	// Only the owner can set the policy, and steps are validated
+	rr := request(t, s, "PUT", "/v1/account/reservation/alerts/escalation", `{"steps":[{"after":"5m","priority":5}]}`, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+	for _, body := range []string{
+		`{"steps":[]}`,
+		`{"min_priority":6,"steps":[{"after":"5m","priority":5}]}`,
+		`{"steps":[{"after":"5m"}]}`,
+		`{"steps":[{"after":"invalid","priority":5}]}`,
+		`{"steps":[{"after":"10m","priority":5},{"after":"5m","priority":5}]}`,
+	} {
+		rr = request(t, s, "PUT", "/v1/account/reservation/alerts/escalation", body, map[string]string{
+			"Authorization": util.BasicAuth("phil", "phil"),
+		})
+		require.Equal(t, 40067, toHTTPError(t, rr.Body.String()).Code, body)
+	}
+	rr = request(t, s, "PUT", "/v1/account/reservation/alerts/escalation", `{"steps":[{"after":"5m","topic":"bens_topic"}]}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 403, rr.Code)
+
+	rr = request(t, s, "PUT", "/v1/account/reservation/alerts/escalation", `{"min_priority":4,"steps":[{"after":"5m","priority":5},{"after":"15m","topic":"oncall"}]}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/account/reservation/alerts/escalation", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	escalation, err := util.UnmarshalJSON[apiAccountTopicEscalationResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 4, escalation.MinPriority)
+	require.Equal(t, 2, len(escalation.Steps))
+	require.Equal(t, "5m0s", escalation.Steps[0].After)
+	require.Equal(t, 5, escalation.Steps[0].Priority)
+	require.Equal(t, "oncall", escalation.Steps[1].Topic)
+
+	rr = request(t, s, "DELETE", "/v1/account/reservation/alerts/escalation", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/account/reservation/alerts/escalation", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 404, rr.Code)
+}
+
+func TestServer_TopicEscalation_EscalateAndAck(t *testing.T) {
+	s := newTestServerWithEscalation(t)
+	rr := request(t, s, "PUT", "/v1/account/reservation/alerts/escalation", `{"min_priority":4,"steps":[{"after":"5m","priority":5},{"after":"15m","topic":"oncall"}]}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// Messages below the minimum priority are not escalated
+	low := toMessage(t, request(t, s, "PUT", "/alerts", "disk at 80%", nil).Body.String())
+	rr = request(t, s, "POST", "/alerts/ack/"+low.ID, "", nil)
+	require.Equal(t, 40405, toHTTPError(t, rr.Body.String()).Code)
+
+	// First step: re-published to the same topic with higher priority and an "Acknowledge" action
+	m := toMessage(t, request(t, s, "PUT", "/alerts", "disk full", map[string]string{"Priority": "4", "Title": "Backup server"}).Body.String())
+	require.Nil(t, s.messageCache.UpdateEscalation(m.ID, 0, time.Now()))
+	s.escalateMessages()
+	messages := toMessages(t, request(t, s, "GET", "/alerts/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 3, len(messages))
+	escalated := messages[2]
+	require.Equal(t, "disk full", escalated.Message)
+	require.Equal(t, "Backup server", escalated.Title)
+	require.Equal(t, 5, escalated.Priority)
+	require.Equal(t, []string{escalationTag}, escalated.Tags)
+	require.Equal(t, 1, len(escalated.Actions))
+	require.Equal(t, fmt.Sprintf("%s/alerts/ack/%s", s.config.BaseURL, m.ID), escalated.Actions[0].URL)
+
+	// Escalated messages are not escalated themselves, and the next step is not due yet
+	s.escalateMessages()
+	require.Equal(t, 3, len(toMessages(t, request(t, s, "GET", "/alerts/json?poll=1", "", nil).Body.String())))
+
+	// Second step: re-published to the escalation topic, then the escalation is done
+	require.Nil(t, s.messageCache.UpdateEscalation(m.ID, 1, time.Now()))
+	s.escalateMessages()
+	messages = toMessages(t, request(t, s, "GET", "/oncall/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "disk full", messages[0].Message)
+	require.Equal(t, 4, messages[0].Priority)
+	rr = request(t, s, "POST", "/alerts/ack/"+m.ID, "", nil)
+	require.Equal(t, 404, rr.Code)
+
+	// Acknowledged messages are not escalated
+	m = toMessage(t, request(t, s, "PUT", "/alerts", "disk full again", map[string]string{"Priority": "5"}).Body.String())
+	rr = request(t, s, "POST", "/alerts/ack/"+m.ID, "", nil)
+	require.Equal(t, 200, rr.Code)
+	escalations, err := s.messageCache.EscalationsDue(time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	require.Empty(t, escalations)
+
+	// Acknowledging a claim of the message stops the escalation as well
+	m = toMessage(t, request(t, s, "PUT", "/alerts", "disk full once more", map[string]string{"Priority": "5"}).Body.String())
+	claim, err := util.UnmarshalJSON[apiClaimResponse](io.NopCloser(request(t, s, "POST", "/alerts/claim", "", nil).Body))
+	require.Nil(t, err)
+	for claim.Message.ID != m.ID {
+		require.Equal(t, 200, request(t, s, "POST", "/alerts/ack/"+claim.Claim, "", nil).Code)
+		claim, err = util.UnmarshalJSON[apiClaimResponse](io.NopCloser(request(t, s, "POST", "/alerts/claim", "", nil).Body))
+		require.Nil(t, err)
+	}
+	require.Equal(t, 200, request(t, s, "POST", "/alerts/ack/"+claim.Claim, "", nil).Code)
+	escalations, err = s.messageCache.EscalationsDue(time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	require.Empty(t, escalations)
+}
+
+func newTestServerWithEscalation(t *testing.T) *Server {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthDefault = user.PermissionReadWrite
+	conf.EnableReservations = true
+	conf.BaseURL = "http://ntfy.example.com"
+	s := newTestServer(t, conf)
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", MessageLimit: 100, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.ChangeTier("ben", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "alerts", user.PermissionReadWrite))
+	require.Nil(t, s.userManager.AddReservation("ben", "bens_topic", user.PermissionDenyAll))
+	return s
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"heckel.io/ntfy/v2/user"
+)
+
+// Home Assistant discovery lets smart home users set up ntfy in Home Assistant without writing the YAML by hand.
+// The descriptor at /v1/homeassistant describes the given topics (or the user's reserved topics) both as notify
+// services (publishing, via the "rest" notify platform) and as event sources (subscribing). Home Assistant
+// integrations can read the JSON descriptor, and users can paste the YAML variant (?format=yaml) into their
+// configuration.yaml. Tokens are never included in the descriptor, see docs.
+
+const (
+	homeAssistantEventType        = "ntfy_message"
+	homeAssistantNotifyPlatform   = "rest"
+	homeAssistantNotifyMethod     = "POST_JSON"
+	homeAssistantFormatYAML       = "yaml"
+	homeAssistantYAMLContentType  = "text/yaml; charset=utf-8"
+	homeAssistantSensorValue      = "{{ value_json.message }}"
+	homeAssistantSensorScanPeriod = 30 // seconds
+)
+
+var (
+	homeAssistantSensorAttributes = []string{"id", "time", "title", "tags", "priority", "click"}
+)
+
+// handleHomeAssistant returns the Home Assistant descriptor for the topics in the "topics" query parameter,
+// or for the reserved topics of the current user if the parameter is not set. The visitor must be allowed
+// to read all topics.
+func (s *Server) handleHomeAssistant(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	if s.config.BaseURL == "" {
+		return errHTTPInternalErrorMissingBaseURL
+	}
+	topics, err := s.homeAssistantTopics(r, v)
+	if err != nil {
+		return err
+	}
+	logvr(v, r).Debug("Generating Home Assistant descriptor for topics %s", strings.Join(topics, ", "))
+	response := newHomeAssistantResponse(s.config.BaseURL, topics)
+	if readQueryParam(r, "format") == homeAssistantFormatYAML {
+		b, err := yaml.Marshal(response.configuration())
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", homeAssistantYAMLContentType)
+		w.Header().Set("Access-Control-Allow-Origin", s.config.AccessControlAllowOrigin) // CORS, allow cross-origin requests
+		_, err = w.Write(b)
+		return err
+	}
+	return s.writeJSON(w, response)
+}
+
+// homeAssistantTopics returns the topics to describe, and checks that the visitor may read them
+func (s *Server) homeAssistantTopics(r *http.Request, v *visitor) ([]string, error) {
+	var topics []string
+	if param := readQueryParam(r, "topics", "topic"); param != "" {
+		for _, topic := range strings.Split(param, ",") {
+			topic = strings.TrimSpace(topic)
+			if !topicRegex.MatchString(topic) {
+				return nil, errHTTPBadRequestTopicInvalid
+			}
+			topics = append(topics, topic)
+		}
+	} else if u := v.User(); u != nil && s.userManager != nil {
+		reservations, err := s.userManager.Reservations(u.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range reservations {
+			topics = append(topics, reservation.Topic)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, errHTTPBadRequestHomeAssistantTopicsMissing
+	}
+	if s.userManager != nil {
+		for _, topic := range topics {
+			if err := s.authorizeVisitor(v, topic, user.PermissionRead); err != nil {
+				return nil, errHTTPForbidden
+			}
+		}
+	}
+	return topics, nil
+}
+
+func newHomeAssistantResponse(baseURL string, topics []string) *apiHomeAssistantResponse {
+	response := &apiHomeAssistantResponse{
+		BaseURL: baseURL,
+		Notify:  make([]*apiHomeAssistantNotify, 0, len(topics)),
+		Events:  make([]*apiHomeAssistantEvent, 0, len(topics)),
+	}
+	for _, topic := range topics {
+		topicURL := fmt.Sprintf("%s/%s", baseURL, topic)
+		response.Notify = append(response.Notify, &apiHomeAssistantNotify{
+			Name:             homeAssistantServiceName(topic),
+			Platform:         homeAssistantNotifyPlatform,
+			Resource:         baseURL,
+			Method:           homeAssistantNotifyMethod,
+			MessageParamName: "message",
+			TitleParamName:   "title",
+			Data:             map[string]string{"topic": topic},
+		})
+		response.Events = append(response.Events, &apiHomeAssistantEvent{
+			Topic:     topic,
+			EventType: homeAssistantEventType,
+			SSEURL:    topicURL + "/sse",
+			JSONURL:   topicURL + "/json",
+			PollURL:   topicURL + "/json?poll=1&since=latest",
+		})
+	}
+	return response
+}
+
+// configuration returns the descriptor as Home Assistant configuration. Since Home Assistant cannot subscribe
+// to a stream without an integration, each topic is polled by a REST sensor with the latest message as its state.
+func (r *apiHomeAssistantResponse) configuration() *homeAssistantConfiguration {
+	config := &homeAssistantConfiguration{
+		Notify: r.Notify,
+	}
+	for _, event := range r.Events {
+		config.Rest = append(config.Rest, &homeAssistantRestConfig{
+			Resource:     event.PollURL,
+			ScanInterval: homeAssistantSensorScanPeriod,
+			Sensor: []*homeAssistantSensorConfig{
+				{
+					Name:           "ntfy " + event.Topic,
+					UniqueID:       homeAssistantServiceName(event.Topic),
+					ValueTemplate:  homeAssistantSensorValue,
+					JSONAttributes: homeAssistantSensorAttributes,
+				},
+			},
+		})
+	}
+	return config
+}
+
+// homeAssistantServiceName returns the name of the notify service, e.g. "ntfy_mytopic". Home Assistant only
+// allows lowercase letters, digits and underscores in service names.
+func homeAssistantServiceName(topic string) string {
+	return "ntfy_" + strings.ReplaceAll(strings.ToLower(topic), "-", "_")
+}
+
+// homeAssistantConfiguration is the configuration.yaml snippet returned with ?format=yaml
+type homeAssistantConfiguration struct {
+	Notify []*apiHomeAssistantNotify  `yaml:"notify"`
+	Rest   []*homeAssistantRestConfig `yaml:"rest"`
+}
+
+type homeAssistantRestConfig struct {
+	Resource     string                       `yaml:"resource"`
+	ScanInterval int                          `yaml:"scan_interval"`
+	Sensor       []*homeAssistantSensorConfig `yaml:"sensor"`
+}
+
+type homeAssistantSensorConfig struct {
+	Name           string   `yaml:"name"`
+	UniqueID       string   `yaml:"unique_id"`
+	ValueTemplate  string   `yaml:"value_template"`
+	JSONAttributes []string `yaml:"json_attributes"`
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_HomeAssistant_Topics(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	rr := request(t, s, "GET", "/v1/homeassistant?topics=alerts,front-door", "", nil)
+	require.Equal(t, 200, rr.Code)
+	var response apiHomeAssistantResponse
+	require.Nil(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Equal(t, "http://127.0.0.1:12345", response.BaseURL)
+	require.Equal(t, 2, len(response.Notify))
+	require.Equal(t, &apiHomeAssistantNotify{
+		Name:             "ntfy_front_door",
+		Platform:         "rest",
+		Resource:         "http://127.0.0.1:12345",
+		Method:           "POST_JSON",
+		MessageParamName: "message",
+		TitleParamName:   "title",
+		Data:             map[string]string{"topic": "front-door"},
+	}, response.Notify[1])
+	require.Equal(t, 2, len(response.Events))
+	require.Equal(t, &apiHomeAssistantEvent{
+		Topic:     "alerts",
+		EventType: "ntfy_message",
+		SSEURL:    "http://127.0.0.1:12345/alerts/sse",
+		JSONURL:   "http://127.0.0.1:12345/alerts/json",
+		PollURL:   "http://127.0.0.1:12345/alerts/json?poll=1&since=latest",
+	}, response.Events[0])
+
+	rr = request(t, s, "GET", "/v1/homeassistant?topics=alerts,invalid/topic", "", nil)
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40009, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "GET", "/v1/homeassistant", "", nil)
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40070, toHTTPError(t, rr.Body.String()).Code)
+}
+
+func TestServer_HomeAssistant_YAML(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	rr := request(t, s, "GET", "/v1/homeassistant?topics=alerts&format=yaml", "", nil)
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, "text/yaml; charset=utf-8", rr.Header().Get("Content-Type"))
+	var config homeAssistantConfiguration
+	require.Nil(t, yaml.Unmarshal(rr.Body.Bytes(), &config))
+	require.Equal(t, 1, len(config.Notify))
+	require.Equal(t, "ntfy_alerts", config.Notify[0].Name)
+	require.Equal(t, "alerts", config.Notify[0].Data["topic"])
+	require.Equal(t, 1, len(config.Rest))
+	require.Equal(t, "http://127.0.0.1:12345/alerts/json?poll=1&since=latest", config.Rest[0].Resource)
+	require.Equal(t, "{{ value_json.message }}", config.Rest[0].Sensor[0].ValueTemplate)
+}
+
+func TestServer_HomeAssistant_ReservationsAndAccess(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	c.EnableReservations = true
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "garage", user.PermissionDenyAll))
+	require.Nil(t, s.userManager.AddReservation("phil", "doorbell", user.PermissionDenyAll))
+
+	rr := request(t, s, "GET", "/v1/homeassistant", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	var response apiHomeAssistantResponse
+	require.Nil(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Equal(t, 2, len(response.Events))
+	require.ElementsMatch(t, []string{"garage", "doorbell"}, []string{response.Events[0].Topic, response.Events[1].Topic})
+
+	rr = request(t, s, "GET", "/v1/homeassistant?topics=garage", "", nil) // Anonymous
+	require.Equal(t, 403, rr.Code)
+}
+
+func TestServer_HomeAssistant_NoBaseURL(t *testing.T) {
+	c := newTestConfig(t)
+	c.BaseURL = ""
+	s := newTestServer(t, c)
+	rr := request(t, s, "GET", "/v1/homeassistant?topics=alerts", "", nil)
+	require.Equal(t, 500, rr.Code)
+}
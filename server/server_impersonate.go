@@ -0,0 +1,56 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+)
+
+// maybeImpersonate checks if the request asks to act on behalf of another user (X-Impersonate header, or
+// ?impersonate=... query param), and if so, returns a visitor for the impersonated user, as well as a request
+// that carries the impersonating user in its context.
+//
+// Only users with the "impersonate" capability (i.e. admins, or users with a matching custom role) may impersonate
+// other users. The same rules as for managing users apply (see canManageUser): admins cannot be impersonated at all,
+// and users with a custom role can only be impersonated by admins, so that impersonation cannot be used to gain
+// additional capabilities. Every impersonated request, as well as every rejected impersonation attempt, is recorded
+// in the audit log (log tag "audit").
+func (s *Server) maybeImpersonate(r *http.Request, v *visitor) (*visitor, *http.Request, error) {
+	username := readParam(r, "x-impersonate", "impersonate")
+	if username == "" || s.userManager == nil {
+		return v, r, nil
+	}
+	impersonator := v.User()
+	if impersonator == nil {
+		return v, r, errHTTPUnauthorized
+	}
+	ev := logvr(v, r).Tag(tagAudit).Fields(log.Context{
+		"impersonator_name": impersonator.Name,
+		"impersonate_name":  username,
+	})
+	if !impersonator.HasCapability(user.CapabilityImpersonate) {
+		ev.Info("Impersonation of user %s by user %s rejected, missing capability", username, impersonator.Name)
+		return v, r, errHTTPForbidden
+	}
+	u, err := s.userManager.User(username)
+	if errors.Is(err, user.ErrUserNotFound) {
+		ev.Info("Impersonation of user %s by user %s rejected, user does not exist", username, impersonator.Name)
+		return v, r, errHTTPBadRequestImpersonateUserInvalid
+	} else if err != nil {
+		return v, r, err
+	} else if u.ID == impersonator.ID || !canManageUser(impersonator, u) {
+		ev.Info("Impersonation of user %s by user %s rejected, user cannot be impersonated", username, impersonator.Name)
+		return v, r, errHTTPForbidden
+	}
+	vu := s.visitor(v.IP(), u)
+	logvr(vu, r).
+		Tag(tagAudit).
+		Fields(log.Context{
+			"impersonator_id":   impersonator.ID,
+			"impersonator_name": impersonator.Name,
+		}).
+		Info("User %s is impersonating user %s: %s %s", impersonator.Name, u.Name, r.Method, r.URL.Path)
+	return vu, withContext(r, map[contextKey]any{contextImpersonator: impersonator}), nil
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_Impersonate_Reservations(t *testing.T) {
+	var out syncBuffer
+	log.SetOutput(&out)
+	log.SetFormat(log.JSONFormat)
+	log.SetLevelOverride("tag", tagAudit, log.InfoLevel)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFormat(log.TextFormat)
+		log.ResetLevelOverrides()
+	}()
+
+	conf := newTestConfigWithAuthFile(t)
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro", MessageLimit: 10, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("ben", "pro"))
+	require.Nil(t, s.userManager.AddReservation("ben", "mytopic", user.PermissionDenyAll))
+
+	// Admin sees ben's account and reservations
+	rr := request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Impersonate": "ben",
+	})
+	require.Equal(t, 200, rr.Code)
+	account, err := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "ben", account.Username)
+	require.Equal(t, 1, len(account.Reservations))
+	require.Equal(t, "mytopic", account.Reservations[0].Topic)
+
+	// Admin can act on behalf of ben, e.g. publish to and poll ben's reserved topic
+	rr = request(t, s, "PUT", "/mytopic?impersonate=ben", "hi from phil", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// Every impersonated request is audit logged
+	lines := out.AuditLines()
+	require.Equal(t, 2, len(lines))
+	require.Equal(t, "phil", lines[0]["impersonator_name"])
+	require.Equal(t, "ben", lines[0]["user_name"])
+	require.Equal(t, "/v1/account", lines[0]["http_path"])
+	require.Equal(t, "/mytopic", lines[1]["http_path"])
+}
+
+func TestServer_Impersonate_NotAllowed(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddRole(&user.CustomRole{Name: "auditor", Capabilities: []user.Capability{user.CapabilityUsersRead}}))
+	require.Nil(t, s.userManager.AddRole(&user.CustomRole{Name: "support", Capabilities: []user.Capability{user.CapabilityImpersonate}}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("nina", "nina", "auditor", false))
+	require.Nil(t, s.userManager.AddUser("susan", "susan", "support", false))
+
+	// Anonymous and regular users cannot impersonate anyone
+	rr := request(t, s, "GET", "/v1/account", "", map[string]string{
+		"X-Impersonate": "ben",
+	})
+	require.Equal(t, 401, rr.Code)
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+		"X-Impersonate": "nina",
+	})
+	require.Equal(t, 403, rr.Code) // Valid credentials, but missing capability
+	require.Equal(t, 40301, toHTTPError(t, rr.Body.String()).Code)
+
+	// Custom role with capability can impersonate regular users, but not other custom roles or admins
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("susan", "susan"),
+		"X-Impersonate": "ben",
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("susan", "susan"),
+		"X-Impersonate": "nina",
+	})
+	require.Equal(t, 403, rr.Code)
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("susan", "susan"),
+		"X-Impersonate": "phil",
+	})
+	require.Equal(t, 403, rr.Code)
+
+	// Admins can impersonate custom roles, but not unknown users
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Impersonate": "nina",
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Impersonate": "doesnotexist",
+	})
+	require.Equal(t, 400, rr.Code)
+	require.Equal(t, 40054, toHTTPError(t, rr.Body.String()).Code)
+
+	// Account takeover actions are not allowed while impersonating
+	rr = request(t, s, "POST", "/v1/account/token", "{}", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Impersonate": "ben",
+	})
+	require.Equal(t, 403, rr.Code)
+	require.Equal(t, 40302, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "PUT", "/v1/account/email", `{"email": "phil@example.com"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+		"X-Impersonate": "ben",
+	})
+	require.Equal(t, 403, rr.Code)
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use, since the server logs from many goroutines
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// AuditLines returns all JSON log lines with the "audit" tag
+func (b *syncBuffer) AuditLines() []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := make([]map[string]any, 0)
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			continue
+		}
+		if m["tag"] == tagAudit {
+			lines = append(lines, m)
+		}
+	}
+	return lines
+}
+
+// RequestLines returns all JSON log lines with the given request ID
+func (b *syncBuffer) RequestLines(requestID string) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := make([]map[string]any, 0)
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			continue
+		}
+		if m["request_id"] == requestID {
+			lines = append(lines, m)
+		}
+	}
+	return lines
+}
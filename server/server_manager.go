@@ -1,9 +1,10 @@
 package server
 
 import (
+	"net/netip"
+
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/util"
-	"strings"
 )
 
 func (s *Server) execManager() {
@@ -13,8 +14,17 @@ func (s *Server) execManager() {
 	// Prune all the things
 	s.pruneVisitors()
 	s.pruneTokens()
+	s.pruneAccess()
+	s.expireTiers()
+	s.pruneTopicSilences()
+	s.escalateMessages()
+	s.pruneEphemeralTopics()
 	s.pruneAttachments()
 	s.pruneMessages()
+	s.pruneChunkedMessages()
+	s.pruneIdempotencyKeys()
+	s.pruneNonces()
+	s.pruneUploads()
 	s.pruneAndNotifyWebPushSubscriptions()
 
 	// Message count per topic
@@ -33,27 +43,28 @@ func (s *Server) execManager() {
 	log.
 		Tag(tagManager).
 		Timing(func() {
-			s.mu.Lock()
-			defer s.mu.Unlock()
-			for _, t := range s.topics {
+			s.topics.Range(func(t *topic) bool {
 				subs, lastAccess := t.Stats()
 				ev := log.Tag(tagManager).With(t)
-				if t.Stale() {
+				if s.topics.DeleteIf(t, (*topic).Stale) {
 					if ev.IsTrace() {
 						ev.Trace("- topic %s: Deleting stale topic (%d subscribers, accessed %s)", t.ID, subs, util.FormatTime(lastAccess))
 					}
 					emptyTopics++
-					delete(s.topics, t.ID)
 				} else {
 					if ev.IsTrace() {
 						ev.Trace("- topic %s: %d subscribers, accessed %s", t.ID, subs, util.FormatTime(lastAccess))
 					}
 					subscribers += subs
 				}
-			}
+				return true
+			})
 		}).
 		Debug("Removed %d empty topic(s)", emptyTopics)
 
+	// Delivery lag of subscriber connections
+	subscriberLagMax, subscribersLagging := s.subscriberLags.Stats()
+
 	// Mail stats
 	var receivedMailTotal, receivedMailSuccess, receivedMailFailure int64
 	if s.smtpServerBackend != nil {
@@ -73,9 +84,12 @@ func (s *Server) execManager() {
 		}
 	}
 
+	// Log events suppressed by sampling rules
+	logEventsSuppressed := log.SuppressedEvents()
+
 	// Print stats
 	s.mu.RLock()
-	messagesCount, topicsCount, visitorsCount := s.messages, len(s.topics), len(s.visitors)
+	messagesCount, topicsCount, visitorsCount := s.messages, s.topics.Len(), len(s.visitors)
 	s.mu.RUnlock()
 
 	// Update stats
@@ -89,6 +103,8 @@ func (s *Server) execManager() {
 			"messages_cached":         messagesCached,
 			"topics_active":           topicsCount,
 			"subscribers":             subscribers,
+			"subscribers_lagging":     subscribersLagging,
+			"subscriber_lag_max_ms":   subscriberLagMax.Milliseconds(),
 			"visitors":                visitorsCount,
 			"users":                   usersCount,
 			"emails_received":         receivedMailTotal,
@@ -97,13 +113,17 @@ func (s *Server) execManager() {
 			"emails_sent":             sentMailTotal,
 			"emails_sent_success":     sentMailSuccess,
 			"emails_sent_failure":     sentMailFailure,
+			"log_events_suppressed":   logEventsSuppressed,
 		}).
 		Info("Server stats")
 	mset(metricMessagesCached, messagesCached)
 	mset(metricVisitors, visitorsCount)
 	mset(metricUsers, usersCount)
 	mset(metricSubscribers, subscribers)
+	mset(metricSubscriberLagMax, subscriberLagMax.Seconds())
+	mset(metricSubscribersLagging, subscribersLagging)
 	mset(metricTopics, topicsCount)
+	mset(metricLogEventsSuppressed, logEventsSuppressed)
 }
 
 func (s *Server) pruneVisitors() {
@@ -120,6 +140,11 @@ func (s *Server) pruneVisitors() {
 					staleVisitors++
 				}
 			}
+			for userID, limiter := range s.passwordResets {
+				if limiter.Tokens() >= float64(limiter.Burst()) {
+					delete(s.passwordResets, userID) // Fully replenished, same as a new limiter
+				}
+			}
 		}).
 		Field("stale_visitors", staleVisitors).
 		Debug("Deleted %d stale visitor(s)", staleVisitors)
@@ -136,46 +161,101 @@ func (s *Server) pruneTokens() {
 				if err := s.userManager.RemoveDeletedUsers(); err != nil {
 					log.Tag(tagManager).Err(err).Warn("Error deleting soft-deleted users")
 				}
+				if err := s.userManager.RemoveExpiredPasswordResetTokens(); err != nil {
+					log.Tag(tagManager).Err(err).Warn("Error expiring password reset tokens")
+				}
+				if err := s.userManager.RemoveExpiredInvites(); err != nil {
+					log.Tag(tagManager).Err(err).Warn("Error expiring invites")
+				}
+				if err := s.userManager.RemoveExpiredGuestTokens(); err != nil {
+					log.Tag(tagManager).Err(err).Warn("Error expiring guest tokens")
+				}
+				if err := s.userManager.RemoveExpiredTopicMutes(); err != nil {
+					log.Tag(tagManager).Err(err).Warn("Error expiring topic mutes")
+				}
 			}).
 			Debug("Removed expired tokens and users")
 	}
 }
 
+// pruneAccess removes expired access control entries, and cancels active subscriptions of the affected
+// users to the affected topics, so that temporary access is actually revoked.
+func (s *Server) pruneAccess() {
+	if s.userManager != nil {
+		log.
+			Tag(tagManager).
+			Timing(func() {
+				grants, err := s.userManager.RemoveExpiredAccess()
+				if err != nil {
+					log.Tag(tagManager).Err(err).Warn("Error removing expired access control entries")
+					return
+				}
+				for userID, userGrants := range grants {
+					for _, grant := range userGrants {
+						log.Tag(tagManager).Fields(log.Context{
+							"user_id":       userID,
+							"topic_pattern": grant.TopicPattern,
+						}).Info("Access control entry for topic %s expired, revoking %s access", grant.TopicPattern, grant.Permission)
+						topics, err := s.topicsFromPattern(grant.TopicPattern)
+						if err != nil {
+							log.Tag(tagManager).Err(err).Warn("Error retrieving topics for pattern %s", grant.TopicPattern)
+							continue
+						}
+						for _, t := range topics {
+							t.CancelSubscriberUser(userID)
+						}
+					}
+				}
+			}).
+			Debug("Removed expired access control entries")
+	}
+}
+
 func (s *Server) pruneAttachments() {
-	if s.fileCache == nil {
+	if s.attachmentGC == nil {
 		return
 	}
 	log.
 		Tag(tagManager).
 		Timing(func() {
-			ids, err := s.messageCache.AttachmentsExpired()
+			report, err := s.attachmentGC.Run(false)
 			if err != nil {
-				log.Tag(tagManager).Err(err).Warn("Error retrieving expired attachments")
-			} else if len(ids) > 0 {
-				if log.Tag(tagManager).IsDebug() {
-					log.Tag(tagManager).Debug("Deleting attachments %s", strings.Join(ids, ", "))
-				}
-				if err := s.fileCache.Remove(ids...); err != nil {
-					log.Tag(tagManager).Err(err).Warn("Error deleting attachments")
-				}
-				if err := s.messageCache.MarkAttachmentsDeleted(ids...); err != nil {
-					log.Tag(tagManager).Err(err).Warn("Error marking attachments deleted")
+				log.Tag(tagManager).Err(err).Warn("Error deleting attachments")
+			} else if len(report.Items) > 0 {
+				for _, item := range report.Items {
+					log.
+						Tag(tagManager).
+						Fields(log.Context{
+							"message_id":             item.ID,
+							"topic":                  item.Topic,
+							"attachment_size":        item.Size,
+							"attachment_gc_strategy": item.Strategy,
+						}).
+						Debug("Deleted attachment (%s)", item.Reason)
+					if item.Topic != "" {
+						s.sendExpiredEvent(attachmentExpiredEvent, item.Topic, item.ID)
+					}
 				}
+				log.Tag(tagManager).Debug("Deleted %d attachment(s), attachment cache size reduced from %s to %s", len(report.Items), util.FormatSize(report.SizeBefore), util.FormatSize(report.SizeAfter))
 			} else {
-				log.Tag(tagManager).Debug("No expired attachments to delete")
+				log.Tag(tagManager).Debug("No attachments to delete")
 			}
 		}).
-		Debug("Deleted expired attachments")
+		Debug("Pruned attachments")
 }
 
 func (s *Server) pruneMessages() {
 	log.
 		Tag(tagManager).
 		Timing(func() {
-			expiredMessageIDs, err := s.messageCache.MessagesExpired()
+			expiredMessages, err := s.messageCache.MessagesExpired()
 			if err != nil {
 				log.Tag(tagManager).Err(err).Warn("Error retrieving expired messages")
-			} else if len(expiredMessageIDs) > 0 {
+			} else if len(expiredMessages) > 0 {
+				expiredMessageIDs := make([]string, len(expiredMessages))
+				for i, m := range expiredMessages {
+					expiredMessageIDs[i] = m.ID
+				}
 				if s.fileCache != nil {
 					if err := s.fileCache.Remove(expiredMessageIDs...); err != nil {
 						log.Tag(tagManager).Err(err).Warn("Error deleting attachments for expired messages")
@@ -183,6 +263,10 @@ func (s *Server) pruneMessages() {
 				}
 				if err := s.messageCache.DeleteMessages(expiredMessageIDs...); err != nil {
 					log.Tag(tagManager).Err(err).Warn("Error marking attachments deleted")
+				} else {
+					for _, m := range expiredMessages {
+						s.sendExpiredEvent(messageExpiredEvent, m.Topic, m.ID)
+					}
 				}
 			} else {
 				log.Tag(tagManager).Debug("No expired messages to delete")
@@ -190,3 +274,80 @@ func (s *Server) pruneMessages() {
 		}).
 		Debug("Pruned messages")
 }
+
+// sendExpiredEvent sends a message_expired or attachment_expired event to the subscribers of the topic, if
+// cache-expiration-events is enabled. The event is only sent to connected subscribers, and never cached.
+func (s *Server) sendExpiredEvent(event, topic, expiredID string) {
+	if !s.config.CacheExpirationEvents {
+		return
+	}
+	t := s.topics.Get(topic)
+	if t == nil {
+		return
+	}
+	v := s.visitor(netip.IPv4Unspecified(), nil)
+	m := newExpiredMessage(event, topic, expiredID)
+	logvm(v, m).Tag(tagManager).Field("expired_id", expiredID).Debug("Sending %s event", event)
+	if err := t.Publish(v, m); err != nil {
+		logvm(v, m).Tag(tagManager).Err(err).Warn("Error sending %s event", event)
+	}
+}
+
+// pruneEphemeralTopics deletes expired ephemeral topics. Their messages are expired, and deleted right after
+// in pruneMessages.
+func (s *Server) pruneEphemeralTopics() {
+	log.
+		Tag(tagManager).
+		Timing(func() {
+			topics, err := s.messageCache.EphemeralTopicsExpired()
+			if err != nil {
+				log.Tag(tagManager).Err(err).Warn("Error retrieving expired ephemeral topics")
+				return
+			}
+			for _, t := range topics {
+				log.Tag(tagManager).Field("topic", t.Topic).Debug("Deleting expired ephemeral topic")
+				if err := s.deleteEphemeralTopic(t); err != nil {
+					log.Tag(tagManager).Field("topic", t.Topic).Err(err).Warn("Error deleting ephemeral topic")
+				}
+			}
+		}).
+		Debug("Deleted expired ephemeral topics")
+}
+
+func (s *Server) pruneChunkedMessages() {
+	if s.chunks == nil {
+		return
+	}
+	pruned := s.chunks.Prune()
+	log.
+		Tag(tagManager).
+		Field("chunked_messages_pruned", pruned).
+		Debug("Deleted %d incomplete chunked message(s)", pruned)
+}
+
+func (s *Server) pruneIdempotencyKeys() {
+	pruned := s.idempotencyKeys.Prune()
+	log.
+		Tag(tagManager).
+		Field("idempotency_keys_pruned", pruned).
+		Debug("Deleted %d expired idempotency key(s)", pruned)
+}
+
+func (s *Server) pruneNonces() {
+	pruned := s.nonces.Prune()
+	log.
+		Tag(tagManager).
+		Field("nonces_pruned", pruned).
+		Debug("Deleted %d expired nonce(s)", pruned)
+}
+
+func (s *Server) pruneUploads() {
+	if s.uploads == nil {
+		return
+	}
+	pruned := s.uploads.Prune()
+	log.
+		Tag(tagManager).
+		Field("uploads_pruned", pruned).
+		Debug("Deleted %d expired upload(s)", pruned)
+}
@@ -1,8 +1,13 @@
 package server
 
 import (
-	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/util"
 )
 
 func TestServer_Manager_Prune_Messages_Without_Attachments_DoesNotPanic(t *testing.T) {
@@ -26,3 +31,58 @@ func TestServer_Manager_Prune_Messages_Without_Attachments_DoesNotPanic(t *testi
 	_, err := s.messageCache.Message(m.ID)
 	require.Equal(t, errMessageNotFound, err)
 }
+
+func TestServer_Manager_Prune_Messages_ExpirationEvents(t *testing.T) {
+	c := newTestConfig(t)
+	c.CacheExpirationEvents = true
+	c.AttachmentExpiryDuration = time.Millisecond // Hack
+	s := newTestServer(t, c)
+
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/mytopic/json", rr)
+	m1 := toMessage(t, request(t, s, "POST", "/mytopic", "hi", nil).Body.String())
+	m2 := toMessage(t, request(t, s, "PUT", "/mytopic", util.RandomString(5000), nil).Body.String()) // > 4096, attachment
+	require.NotNil(t, m2.Attachment)
+
+	// Expire attachment, then both messages
+	file := filepath.Join(s.config.AttachmentCacheDir, m2.ID)
+	waitFor(t, func() bool {
+		s.pruneAttachments() // May run many times
+		return !util.FileExists(file)
+	})
+	require.Nil(t, s.messageCache.ExpireMessages("mytopic"))
+	s.pruneMessages()
+	time.Sleep(200 * time.Millisecond) // Events are sent asynchronously
+	cancel()
+
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 6, len(messages))
+	events := make(map[string][]string) // Event -> message IDs, messages are delivered concurrently
+	for _, m := range messages[1:] {
+		require.Equal(t, "mytopic", m.Topic)
+		if m.Event == messageEvent {
+			events[m.Event] = append(events[m.Event], m.ID)
+		} else {
+			events[m.Event] = append(events[m.Event], m.ExpiredID)
+		}
+	}
+	require.ElementsMatch(t, []string{m1.ID, m2.ID}, events[messageEvent])
+	require.Equal(t, []string{m2.ID}, events[attachmentExpiredEvent])
+	require.ElementsMatch(t, []string{m1.ID, m2.ID}, events[messageExpiredEvent])
+}
+
+func TestServer_Manager_Prune_Messages_ExpirationEventsDisabled(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	rr := httptest.NewRecorder()
+	cancel := subscribe(t, s, "/mytopic/json", rr)
+	request(t, s, "POST", "/mytopic", "hi", nil)
+	require.Nil(t, s.messageCache.ExpireMessages("mytopic"))
+	s.pruneMessages()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, messageEvent, messages[1].Event)
+}
@@ -9,6 +9,13 @@ var (
 	metricMessagesPublishedFailure     prometheus.Counter
 	metricMessagesCached               prometheus.Gauge
 	metricMessagePublishDurationMillis prometheus.Gauge
+	metricMessageDeliveryLatency       *prometheus.HistogramVec
+	metricSubscriberLagMax             prometheus.Gauge
+	metricSubscribersLagging           prometheus.Gauge
+	metricOverloadLevel                prometheus.Gauge
+	metricOverloadFanoutPending        prometheus.Gauge
+	metricOverloadCachePending         prometheus.Gauge
+	metricOverloadMessagesShed         prometheus.Counter
 	metricFirebasePublishedSuccess     prometheus.Counter
 	metricFirebasePublishedFailure     prometheus.Counter
 	metricEmailsPublishedSuccess       prometheus.Counter
@@ -17,6 +24,8 @@ var (
 	metricEmailsReceivedFailure        prometheus.Counter
 	metricCallsMadeSuccess             prometheus.Counter
 	metricCallsMadeFailure             prometheus.Counter
+	metricOutboundWebhooksSuccess      prometheus.Counter
+	metricOutboundWebhooksFailure      prometheus.Counter
 	metricUnifiedPushPublishedSuccess  prometheus.Counter
 	metricMatrixPublishedSuccess       prometheus.Counter
 	metricMatrixPublishedFailure       prometheus.Counter
@@ -26,6 +35,7 @@ var (
 	metricTopics                       prometheus.Gauge
 	metricUsers                        prometheus.Gauge
 	metricHTTPRequests                 *prometheus.CounterVec
+	metricLogEventsSuppressed          prometheus.Gauge
 )
 
 func initMetrics() {
@@ -41,6 +51,28 @@ func initMetrics() {
 	metricMessagePublishDurationMillis = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "ntfy_message_publish_duration_ms",
 	})
+	metricMessageDeliveryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ntfy_message_delivery_latency_seconds",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"protocol"})
+	metricSubscriberLagMax = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ntfy_subscriber_lag_max_seconds",
+	})
+	metricSubscribersLagging = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ntfy_subscribers_lagging_total",
+	})
+	metricOverloadLevel = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ntfy_overload_level",
+	})
+	metricOverloadFanoutPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ntfy_overload_fanout_pending",
+	})
+	metricOverloadCachePending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ntfy_overload_cache_pending",
+	})
+	metricOverloadMessagesShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ntfy_overload_messages_shed",
+	})
 	metricFirebasePublishedSuccess = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "ntfy_firebase_published_success",
 	})
@@ -65,6 +97,12 @@ func initMetrics() {
 	metricCallsMadeFailure = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "ntfy_calls_made_failure",
 	})
+	metricOutboundWebhooksSuccess = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ntfy_outbound_webhooks_success",
+	})
+	metricOutboundWebhooksFailure = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ntfy_outbound_webhooks_failure",
+	})
 	metricUnifiedPushPublishedSuccess = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "ntfy_unifiedpush_published_success",
 	})
@@ -92,11 +130,21 @@ func initMetrics() {
 	metricHTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "ntfy_http_requests_total",
 	}, []string{"http_code", "ntfy_code", "http_method"})
+	metricLogEventsSuppressed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ntfy_log_events_suppressed_total",
+	})
 	prometheus.MustRegister(
 		metricMessagesPublishedSuccess,
 		metricMessagesPublishedFailure,
 		metricMessagesCached,
 		metricMessagePublishDurationMillis,
+		metricMessageDeliveryLatency,
+		metricSubscriberLagMax,
+		metricSubscribersLagging,
+		metricOverloadLevel,
+		metricOverloadFanoutPending,
+		metricOverloadCachePending,
+		metricOverloadMessagesShed,
 		metricFirebasePublishedSuccess,
 		metricFirebasePublishedFailure,
 		metricEmailsPublishedSuccess,
@@ -105,6 +153,8 @@ func initMetrics() {
 		metricEmailsReceivedFailure,
 		metricCallsMadeSuccess,
 		metricCallsMadeFailure,
+		metricOutboundWebhooksSuccess,
+		metricOutboundWebhooksFailure,
 		metricUnifiedPushPublishedSuccess,
 		metricMatrixPublishedSuccess,
 		metricMatrixPublishedFailure,
@@ -114,6 +164,7 @@ func initMetrics() {
 		metricSubscribers,
 		metricTopics,
 		metricHTTPRequests,
+		metricLogEventsSuppressed,
 	)
 }
 
@@ -3,6 +3,7 @@ package server
 import (
 	"net/http"
 
+	"heckel.io/ntfy/v2/user"
 	"heckel.io/ntfy/v2/util"
 )
 
@@ -12,6 +13,8 @@ const (
 	contextRateVisitor contextKey = iota + 2586
 	contextTopic
 	contextMatrixPushKey
+	contextImpersonator
+	contextVisitor
 )
 
 func (s *Server) limitRequests(next handleFunc) handleFunc {
@@ -85,15 +88,26 @@ func (s *Server) ensureUser(next handleFunc) handleFunc {
 	})
 }
 
-func (s *Server) ensureAdmin(next handleFunc) handleFunc {
+func (s *Server) ensureCapability(capability user.Capability, next handleFunc) handleFunc {
 	return s.ensureUserManager(func(w http.ResponseWriter, r *http.Request, v *visitor) error {
-		if !v.User().IsAdmin() {
+		if !v.User().HasCapability(capability) {
 			return errHTTPUnauthorized
 		}
 		return next(w, r, v)
 	})
 }
 
+// ensureNotImpersonating rejects the request if an admin is acting on behalf of the user, so that
+// impersonation cannot be used to take over an account (e.g. by creating tokens or changing the password)
+func (s *Server) ensureNotImpersonating(next handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
+		if _, err := fromContext[*user.User](r, contextImpersonator); err == nil {
+			return errHTTPForbiddenImpersonating
+		}
+		return next(w, r, v)
+	}
+}
+
 func (s *Server) ensureCallsEnabled(next handleFunc) handleFunc {
 	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
 		if s.config.TwilioAccount == "" || s.userManager == nil {
@@ -103,6 +117,15 @@ func (s *Server) ensureCallsEnabled(next handleFunc) handleFunc {
 	}
 }
 
+func (s *Server) ensurePasswordResetEnabled(next handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
+		if !s.config.EnablePasswordReset || s.userManager == nil || s.smtpSender == nil {
+			return errHTTPNotFound
+		}
+		return next(w, r, v)
+	}
+}
+
 func (s *Server) ensurePaymentsEnabled(next handleFunc) handleFunc {
 	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
 		if s.config.StripeSecretKey == "" || s.stripe == nil {
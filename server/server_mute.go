@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+)
+
+// Muting lets a user stop notifications of a topic for themselves until a given time, e.g. while on vacation,
+// without unsubscribing or affecting other subscribers. While a topic is muted, its messages are still cached
+// and delivered to the user's subscriptions (e.g. in the web app), but they are not sent to the user's Web Push
+// subscriptions or e-mail address. Firebase and upstream server messages are sent per topic and are not affected.
+//
+// Mutes are managed via /v1/account/mute, are stored in the user database, and are removed when they expire.
+
+// handleAccountTopicMuteList returns all topics muted by the current user
+func (s *Server) handleAccountTopicMuteList(w http.ResponseWriter, _ *http.Request, v *visitor) error {
+	mutes, err := s.userManager.TopicMutes(v.User().ID)
+	if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newTopicMutesResponse(mutes))
+}
+
+// handleAccountTopicMuteAdd mutes a topic for the current user until the given time, or changes the end of an
+// existing mute. The user must be allowed to read the topic.
+func (s *Server) handleAccountTopicMuteAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	req, err := readJSONWithLimit[apiAccountTopicMuteRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	} else if !topicRegex.MatchString(req.Topic) {
+		return errHTTPBadRequestTopicInvalid
+	}
+	until := time.Unix(req.Until, 0)
+	if !until.After(time.Now()) {
+		return errHTTPBadRequestTopicMuteInvalid
+	}
+	u := v.User()
+	if err := s.userManager.Authorize(u, req.Topic, user.PermissionRead); err != nil {
+		return errHTTPForbidden
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":      req.Topic,
+			"mute_until": until.Unix(),
+		}).
+		Debug("Muting topic %s", req.Topic)
+	if err := s.userManager.MuteTopic(u.ID, req.Topic, until); errors.Is(err, user.ErrTooManyTopicMutes) {
+		return errHTTPTooManyRequestsLimitTopicMutes
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// handleAccountTopicMuteDelete unmutes a topic for the current user
+func (s *Server) handleAccountTopicMuteDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	matches := apiAccountMuteSingleRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		return errHTTPInternalErrorInvalidPath
+	}
+	topic := matches[1]
+	logvr(v, r).Tag(tagAccount).Field("topic", topic).Debug("Unmuting topic %s", topic)
+	if err := s.userManager.UnmuteTopic(v.User().ID, topic); errors.Is(err, user.ErrTopicMuteNotFound) {
+		return errHTTPNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// topicMutedUserIDs returns the IDs of the users that currently mute the given topic. Their Web Push
+// subscriptions are skipped when publishing messages to the topic.
+func (s *Server) topicMutedUserIDs(topic string) []string {
+	if s.userManager == nil {
+		return nil
+	}
+	userIDs, err := s.userManager.TopicMutedUserIDs(topic)
+	if err != nil {
+		log.Tag(tagWebPush).Field("topic", topic).Err(err).Warn("Cannot read topic mutes, not muting topic")
+		return nil
+	}
+	return userIDs
+}
+
+// topicMutedByEmail returns true if the user with the given e-mail address currently mutes the given topic,
+// in which case no e-mail is sent to the address
+func (s *Server) topicMutedByEmail(topic, email string) bool {
+	if s.userManager == nil {
+		return false
+	}
+	muted, err := s.userManager.TopicMutedByEmail(topic, email)
+	if err != nil {
+		log.Tag(tagEmail).Field("topic", topic).Err(err).Warn("Cannot read topic mutes, not muting topic")
+		return false
+	}
+	return muted
+}
+
+func newTopicMutesResponse(mutes []*user.TopicMute) []*apiAccountTopicMute {
+	response := make([]*apiAccountTopicMute, 0, len(mutes))
+	for _, mute := range mutes {
+		response = append(response, &apiAccountTopicMute{
+			Topic: mute.Topic,
+			Until: mute.Until.Unix(),
+		})
+	}
+	return response
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_TopicMute_AddListDelete(t *testing.T) {
+	s := newTestServerWithMutes(t)
+	until := time.Now().Add(time.Hour).Unix()
+
+	// Mutes must end in the future, and the user must be able to read the topic
+	rr := request(t, s, "POST", "/v1/account/mute", fmt.Sprintf(`{"topic":"alerts","until":%d}`, time.Now().Add(-time.Minute).Unix()), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40068, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "POST", "/v1/account/mute", fmt.Sprintf(`{"topic":"bens_topic","until":%d}`, until), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 403, rr.Code)
+	rr = request(t, s, "POST", "/v1/account/mute", fmt.Sprintf(`{"topic":"alerts","until":%d}`, until), nil)
+	require.Equal(t, 401, rr.Code)
+
+	rr = request(t, s, "POST", "/v1/account/mute", fmt.Sprintf(`{"topic":"alerts","until":%d}`, until), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "GET", "/v1/account/mute", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	mutes, err := util.UnmarshalJSON[[]*apiAccountTopicMute](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(*mutes))
+	require.Equal(t, "alerts", (*mutes)[0].Topic)
+	require.Equal(t, until, (*mutes)[0].Until)
+
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	account, err := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(account.Mutes))
+	require.Equal(t, "alerts", account.Mutes[0].Topic)
+
+	rr = request(t, s, "DELETE", "/v1/account/mute/alerts", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "DELETE", "/v1/account/mute/alerts", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 404, rr.Code)
+}
+
+func TestServer_TopicMute_WebPush(t *testing.T) {
+	s := newTestServerWithMutes(t)
+	phil, err := s.userManager.User("phil")
+	require.Nil(t, err)
+	ben, err := s.userManager.User("ben")
+	require.Nil(t, err)
+
+	var mu sync.Mutex
+	var received []string
+	var count atomic.Int32
+	pushService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		mu.Lock()
+		received = append(received, r.URL.Path)
+		mu.Unlock()
+		count.Add(1)
+	}))
+	defer pushService.Close()
+
+	for _, u := range []*user.User{phil, ben} {
+		require.Nil(t, s.webPush.UpsertSubscription(pushService.URL+"/"+u.Name, "kSC3T8aN1JCQxxPdrFLrZg", "BMKKbxdUU_xLS7G1Wh5AN8PvWOjCzkCuKZYb8apcqYrDxjOF_2piggBnoJLQYx9IeSD70fNuwawI3e9Y8m3S3PE", u.ID, netip.MustParseAddr("1.2.3.4"), []string{"alerts"}))
+	}
+	rr := request(t, s, "POST", "/v1/account/mute", fmt.Sprintf(`{"topic":"alerts","until":%d}`, time.Now().Add(time.Hour).Unix()), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// Messages are still cached, but only sent to the subscription of the user that did not mute the topic
+	request(t, s, "PUT", "/alerts", "disk full", nil)
+	waitFor(t, func() bool {
+		return count.Load() == 1
+	})
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	require.Equal(t, []string{"/ben"}, received)
+	mu.Unlock()
+	require.Equal(t, 1, len(toMessages(t, request(t, s, "GET", "/alerts/json?poll=1", "", nil).Body.String())))
+}
+
+func TestServer_TopicMute_Email(t *testing.T) {
+	s := newTestServerWithMutes(t)
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+	require.Nil(t, s.userManager.ChangeEmail("phil", "phil@example.com"))
+	rr := request(t, s, "POST", "/v1/account/mute", fmt.Sprintf(`{"topic":"alerts","until":%d}`, time.Now().Add(time.Hour).Unix()), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// No e-mail to the address of the user that muted the topic, but to other addresses
+	require.Equal(t, 200, request(t, s, "PUT", "/alerts", "disk full", map[string]string{"Email": "PHIL@example.com"}).Code)
+	require.Equal(t, 200, request(t, s, "PUT", "/alerts", "disk full", map[string]string{"Email": "ben@example.com"}).Code)
+	waitFor(t, func() bool {
+		mailer.mu.Lock()
+		defer mailer.mu.Unlock()
+		return mailer.count == 1
+	})
+	time.Sleep(100 * time.Millisecond)
+	mailer.mu.Lock()
+	require.Equal(t, 1, mailer.count)
+	mailer.mu.Unlock()
+}
+
+func newTestServerWithMutes(t *testing.T) *Server {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthDefault = user.PermissionReadWrite
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	require.Nil(t, err)
+	conf.WebPushFile = filepath.Join(t.TempDir(), "webpush.db")
+	conf.WebPushEmailAddress = "testing@example.com"
+	conf.WebPushPrivateKey = privateKey
+	conf.WebPushPublicKey = publicKey
+	s := newTestServer(t, conf)
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.AllowAccess("phil", "bens_topic", user.PermissionDenyAll))
+	return s
+}
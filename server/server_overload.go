@@ -0,0 +1,116 @@
+package server
+
+import (
+	"time"
+
+	"heckel.io/ntfy/v2/log"
+)
+
+// Overload protection (admission control) sheds low-priority publish traffic when the server cannot keep up, so that
+// important messages still get through. Once per overloadCheckInterval, the backlog of the fan-out to subscribers
+// (messages waiting to be written to HTTP stream and WebSocket connections, see subscriberLags) and of the message
+// cache (messages waiting to be written to the database, see messageCache.PendingWrites) is compared to the
+// overload-fanout-threshold and overload-cache-threshold options. If either backlog reaches its threshold, only high
+// and urgent messages are accepted; at twice the threshold, only urgent messages are accepted. All other messages are
+// rejected with a 503 and a Retry-After header. Urgent messages are always accepted.
+
+const (
+	overloadCheckInterval = time.Second
+	overloadRetryAfter    = 10 * time.Second
+)
+
+// Overload levels, see checkOverload
+const (
+	overloadLevelNormal   = iota // All messages are accepted
+	overloadLevelHigh            // Only high and urgent priority messages are accepted
+	overloadLevelCritical        // Only urgent priority messages are accepted
+)
+
+var overloadLevelNames = map[int32]string{
+	overloadLevelNormal:   "normal",
+	overloadLevelHigh:     "high",
+	overloadLevelCritical: "critical",
+}
+
+// overloadMinPriority is the minimum priority of messages that are accepted at the given overload level
+var overloadMinPriority = map[int32]int{
+	overloadLevelNormal:   1,
+	overloadLevelHigh:     4,
+	overloadLevelCritical: 5,
+}
+
+// overloadProtectionEnabled returns true if any of the overload thresholds is set
+func (s *Server) overloadProtectionEnabled() bool {
+	return s.config.OverloadFanoutThreshold > 0 || s.config.OverloadCacheThreshold > 0
+}
+
+// runOverloadChecker periodically updates the overload level, see checkOverload
+func (s *Server) runOverloadChecker() {
+	if !s.overloadProtectionEnabled() {
+		return
+	}
+	for {
+		select {
+		case <-time.After(overloadCheckInterval):
+			s.checkOverload()
+		case <-s.closeChan:
+			return
+		}
+	}
+}
+
+// checkOverload determines the overload level from the fan-out and message cache backlogs, and updates the metrics
+func (s *Server) checkOverload() {
+	fanoutPending := s.subscriberLags.Pending()
+	cachePending := s.messageCache.PendingWrites()
+	level := max(
+		overloadLevelFor(int64(fanoutPending), int64(s.config.OverloadFanoutThreshold)),
+		overloadLevelFor(cachePending, int64(s.config.OverloadCacheThreshold)),
+	)
+	previous := s.overloadLevel.Swap(level)
+	mset(metricOverloadLevel, int(level))
+	mset(metricOverloadFanoutPending, fanoutPending)
+	mset(metricOverloadCachePending, cachePending)
+	if level != previous {
+		ev := log.Tag(tagPublish).Fields(log.Context{
+			"overload_level":          overloadLevelNames[level],
+			"overload_fanout_pending": fanoutPending,
+			"overload_cache_pending":  cachePending,
+		})
+		if level > previous {
+			ev.Warn("Server overloaded, only accepting messages with priority %d or higher", overloadMinPriority[level])
+		} else if level == overloadLevelNormal {
+			ev.Info("Server no longer overloaded, accepting all messages again")
+		} else {
+			ev.Info("Server less overloaded, accepting messages with priority %d or higher", overloadMinPriority[level])
+		}
+	}
+}
+
+// overloadLevelFor returns the overload level for a backlog and its threshold; a zero threshold disables the check
+func overloadLevelFor(pending, threshold int64) int32 {
+	if threshold <= 0 || pending < threshold {
+		return overloadLevelNormal
+	} else if pending < 2*threshold {
+		return overloadLevelHigh
+	}
+	return overloadLevelCritical
+}
+
+// admitMessage returns an error if the message must be shed because the server is overloaded, see checkOverload
+func (s *Server) admitMessage(m *message) *errHTTP {
+	level := s.overloadLevel.Load()
+	if level == overloadLevelNormal {
+		return nil
+	}
+	priority := m.Priority
+	if priority == 0 {
+		priority = 3
+	}
+	minPriority := overloadMinPriority[level]
+	if priority >= minPriority {
+		return nil
+	}
+	minc(metricOverloadMessagesShed)
+	return errHTTPServiceUnavailableOverloaded.Wrap("only messages with priority %d or higher are accepted", minPriority)
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Overload_AdmitMessage(t *testing.T) {
+	c := newTestConfig(t)
+	c.OverloadCacheThreshold = 10
+	s := newTestServer(t, c)
+
+	// Normal: all messages are accepted
+	response := request(t, s, "PUT", "/mytopic", "min", map[string]string{"Priority": "min"})
+	require.Equal(t, 200, response.Code)
+
+	// High: only high and urgent messages are accepted
+	s.overloadLevel.Store(overloadLevelHigh)
+	response = request(t, s, "PUT", "/mytopic", "default", nil)
+	require.Equal(t, 503, response.Code)
+	require.Equal(t, 50301, toHTTPError(t, response.Body.String()).Code)
+	require.Equal(t, "10", response.Header().Get("Retry-After"))
+	response = request(t, s, "PUT", "/mytopic", "high", map[string]string{"Priority": "high"})
+	require.Equal(t, 200, response.Code)
+
+	// Critical: only urgent messages are accepted
+	s.overloadLevel.Store(overloadLevelCritical)
+	response = request(t, s, "PUT", "/mytopic", "high", map[string]string{"Priority": "high"})
+	require.Equal(t, 503, response.Code)
+	response = request(t, s, "PUT", "/mytopic?priority=urgent", "urgent", nil)
+	require.Equal(t, 200, response.Code)
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, "min", messages[0].Message)
+	require.Equal(t, "high", messages[1].Message)
+	require.Equal(t, "urgent", messages[2].Message)
+}
+
+func TestServer_Overload_CheckOverload(t *testing.T) {
+	c := newTestConfig(t)
+	c.OverloadFanoutThreshold = 2
+	c.OverloadCacheThreshold = 10
+	s := newTestServer(t, c)
+
+	s.checkOverload()
+	require.Equal(t, int32(overloadLevelNormal), s.overloadLevel.Load())
+
+	// Cache backlog
+	s.messageCache.pending.Add(10)
+	s.checkOverload()
+	require.Equal(t, int32(overloadLevelHigh), s.overloadLevel.Load())
+	s.messageCache.pending.Add(10)
+	s.checkOverload()
+	require.Equal(t, int32(overloadLevelCritical), s.overloadLevel.Load())
+	s.messageCache.pending.Add(-20)
+	s.checkOverload()
+	require.Equal(t, int32(overloadLevelNormal), s.overloadLevel.Load())
+
+	// Fan-out backlog
+	lag := s.subscriberLags.Add(subscriberProtocolHTTP)
+	defer s.subscriberLags.Remove(lag)
+	for _, id := range []string{"m1", "m2"} {
+		m := newDefaultMessage("mytopic", "hi")
+		m.ID = id
+		m.published = time.Now() // Published live, so the message is tracked
+		lag.Begin(m)
+	}
+	require.Equal(t, 2, s.subscriberLags.Pending())
+	s.checkOverload()
+	require.Equal(t, int32(overloadLevelHigh), s.overloadLevel.Load())
+}
+
+func TestOverloadLevelFor(t *testing.T) {
+	require.Equal(t, int32(overloadLevelNormal), overloadLevelFor(100, 0))
+	require.Equal(t, int32(overloadLevelNormal), overloadLevelFor(9, 10))
+	require.Equal(t, int32(overloadLevelHigh), overloadLevelFor(10, 10))
+	require.Equal(t, int32(overloadLevelHigh), overloadLevelFor(19, 10))
+	require.Equal(t, int32(overloadLevelCritical), overloadLevelFor(20, 10))
+}
+
+func TestMessageCache_PendingWrites(t *testing.T) {
+	c, err := newSqliteCache(newSqliteTestCacheFile(t), "", 0, 10, 0, false)
+	require.Nil(t, err)
+	require.Nil(t, c.AddMessage(newDefaultMessage("mytopic", "hi")))
+	require.Equal(t, int64(1), c.PendingWrites()) // Waiting in the batching queue
+
+	c, err = newSqliteCache(newSqliteTestCacheFile(t), "", 0, 0, 0, false)
+	require.Nil(t, err)
+	require.Nil(t, c.AddMessage(newDefaultMessage("mytopic", "hi")))
+	require.Equal(t, int64(0), c.PendingWrites()) // Written synchronously
+}
@@ -485,7 +485,7 @@ func (s *Server) fetchStripePrices() (map[string]int64, error) {
 	priceMap := make(map[string]int64)
 	prices, err := s.stripe.ListPrices(&stripe.PriceListParams{Active: stripe.Bool(true)})
 	if err != nil {
-		log.Warn("Fetching Stripe prices failed: %s", err.Error())
+		log.Tag(tagStripe).Err(err).Warn("Fetching Stripe prices failed")
 		return nil, err
 	}
 	for _, p := range prices {
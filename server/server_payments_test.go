@@ -387,7 +387,7 @@ func TestPayments_Checkout_Success_And_Increase_Rate_Limits_Reset_Visitor(t *tes
 
 	// Now let's test the message limiter by faking a ridiculously generous rate limiter
 	v := s.visitor(netip.MustParseAddr("9.9.9.9"), u)
-	v.requestLimiter = rate.NewLimiter(rate.Every(time.Millisecond), 1000000)
+	v.requestLimiter = util.NewRateLimiter(rate.Every(time.Millisecond), 1000000)
 
 	var wg sync.WaitGroup
 	for i := 0; i < 209; i++ {
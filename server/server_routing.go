@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Publish routes let a single inbound topic distribute messages to other topics based on their content, so that
+// senders that can only be configured with one hardcoded URL (webhooks, appliances, scripts, ...) can still reach
+// the right audience. Routes are either defined by the admin for a source topic (publish-routes option, see
+// ParsePublishRoute), or passed along with the message in the X-Route header. Header routes are evaluated before
+// the admin-defined routes, and the first matching route wins. Messages that match no route stay in the topic they
+// were published to.
+//
+// Routed messages are published on behalf of the sender, so the sender must be allowed to write to the target topic.
+
+const (
+	routeHeaderSeparator = ";"
+)
+
+var (
+	publishRouteRegex = regexp.MustCompile(`^(\S+)\s+(\S+)((?:\s+[a-z]+=\S+)*)\s*$`)
+	routeHeaderRegex  = regexp.MustCompile(`^(\S+)((?:\s+[a-z]+=\S+)*)\s*$`)
+)
+
+// PublishRoute routes messages published to a topic to another topic, see ParsePublishRoute
+type PublishRoute struct {
+	Topic       string         // Source topic, empty for routes passed in the X-Route header
+	TargetTopic string         // Topic the matching messages are published to
+	Message     *regexp.Regexp // Matches the message body, all messages if nil
+	Title       *regexp.Regexp // Matches the message title, all messages if nil
+	Tags        []string       // Tags the message must have (all of them), all messages if empty
+}
+
+// ParsePublishRoute parses an entry of the publish-routes option. Entries have the format
+// "<source-topic> <target-topic> [key=value ...]", e.g. "alerts alerts-db match=(?i)postgres|mysql".
+//
+// Supported keys:
+//   - match=<regex>: matches the message body (before templating), default: all messages
+//   - title=<regex>: matches the message title, default: all messages
+//   - tags=<tag>[,...]: the message must have all of these tags, default: all messages
+func ParsePublishRoute(spec string) (*PublishRoute, error) {
+	m := publishRouteRegex.FindStringSubmatch(strings.TrimSpace(spec))
+	if m == nil || !topicRegex.MatchString(m[1]) || !topicRegex.MatchString(m[2]) {
+		return nil, fmt.Errorf(`invalid publish route "%s", must be "<source-topic> <target-topic> [key=value ...]"`, spec)
+	} else if m[1] == m[2] {
+		return nil, fmt.Errorf(`invalid publish route "%s", source and target topic must be different`, spec)
+	}
+	route := &PublishRoute{
+		Topic:       m[1],
+		TargetTopic: m[2],
+	}
+	if err := route.parseOptions(m[3]); err != nil {
+		return nil, fmt.Errorf(`invalid publish route "%s", %s`, spec, err.Error())
+	}
+	return route, nil
+}
+
+// parseRouteHeader parses the X-Route header, which contains one or more routes separated by semicolons. Each route
+// has the format "<target-topic> [key=value ...]", with the same keys as in ParsePublishRoute.
+func parseRouteHeader(value string) ([]*PublishRoute, error) {
+	routes := make([]*PublishRoute, 0)
+	for _, spec := range strings.Split(value, routeHeaderSeparator) {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		m := routeHeaderRegex.FindStringSubmatch(strings.TrimSpace(spec))
+		if m == nil || !topicRegex.MatchString(m[1]) {
+			return nil, fmt.Errorf(`invalid route "%s", must be "<target-topic> [key=value ...]"`, spec)
+		}
+		route := &PublishRoute{
+			TargetTopic: m[1],
+		}
+		if err := route.parseOptions(m[2]); err != nil {
+			return nil, fmt.Errorf(`invalid route "%s", %s`, spec, err.Error())
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func (r *PublishRoute) parseOptions(options string) error {
+	for _, option := range strings.Fields(options) {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "match", "title":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return fmt.Errorf("%s is not a valid regular expression: %s", key, err.Error())
+			}
+			if key == "match" {
+				r.Message = re
+			} else {
+				r.Title = re
+			}
+		case "tags":
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					r.Tags = append(r.Tags, tag)
+				}
+			}
+		default:
+			return fmt.Errorf(`unknown option "%s"`, key)
+		}
+	}
+	return nil
+}
+
+// matches returns true if the route matches the given message and message body
+func (r *PublishRoute) matches(m *message, body string) bool {
+	if r.Message != nil && !r.Message.MatchString(body) {
+		return false
+	}
+	if r.Title != nil && !r.Title.MatchString(m.Title) {
+		return false
+	}
+	for _, tag := range r.Tags {
+		if !util.Contains(m.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// routeMessage returns the topic the message is published to: the target topic of the first matching route (see
+// PublishRoute), or the original topic if no route matches. The message's topic is updated accordingly.
+func (s *Server) routeMessage(r *http.Request, v *visitor, t *topic, m *message, body *util.PeekedReadCloser) (*topic, error) {
+	routes, err := parseRouteHeader(readParam(r, "x-route", "route"))
+	if err != nil {
+		return nil, errHTTPBadRequestRouteInvalid.Wrap("%s", err.Error())
+	}
+	for _, route := range s.config.PublishRoutes {
+		if route.Topic == t.ID {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == 0 {
+		return t, nil
+	}
+	text := m.Message
+	if text == "" && !body.LimitReached && utf8.Valid(body.PeekedBytes) {
+		text = string(body.PeekedBytes)
+	}
+	for _, route := range routes {
+		if !route.matches(m, text) {
+			continue
+		} else if route.TargetTopic == t.ID {
+			return t, nil
+		}
+		if s.userManager != nil {
+			if err := s.authorizeVisitor(v, route.TargetTopic, user.PermissionWrite); err != nil {
+				return nil, errHTTPForbidden.With(t)
+			}
+		}
+		target, err := s.topicFromID(route.TargetTopic)
+		if err != nil {
+			return nil, err
+		}
+		logvr(v, r).Tag(tagPublish).With(t).Debug("Routing message to topic %s", target.ID)
+		m.Topic = target.ID
+		return target, nil
+	}
+	return t, nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestParsePublishRoute(t *testing.T) {
+	route, err := ParsePublishRoute("  alerts alerts-db match=(?i)postgres|mysql title=^DB tags=db,critical ")
+	require.Nil(t, err)
+	require.Equal(t, "alerts", route.Topic)
+	require.Equal(t, "alerts-db", route.TargetTopic)
+	require.True(t, route.Message.MatchString("PostgreSQL is down"))
+	require.True(t, route.Title.MatchString("DB alert"))
+	require.Equal(t, []string{"db", "critical"}, route.Tags)
+
+	route, err = ParsePublishRoute("alerts everything")
+	require.Nil(t, err)
+	require.Nil(t, route.Message)
+	require.Nil(t, route.Title)
+	require.Empty(t, route.Tags)
+
+	for _, spec := range []string{
+		"",
+		"alerts",
+		"alerts alerts",
+		"alerts invalid/topic",
+		"alerts alerts-db match=(",
+		"alerts alerts-db unknown=1",
+		"alerts alerts-db match",
+	} {
+		_, err := ParsePublishRoute(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestParseRouteHeader(t *testing.T) {
+	routes, err := parseRouteHeader("alerts-db match=postgres; ; alerts-web title=nginx tags=web")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(routes))
+	require.Equal(t, "", routes[0].Topic)
+	require.Equal(t, "alerts-db", routes[0].TargetTopic)
+	require.Equal(t, "alerts-web", routes[1].TargetTopic)
+	require.Equal(t, []string{"web"}, routes[1].Tags)
+
+	routes, err = parseRouteHeader("")
+	require.Nil(t, err)
+	require.Empty(t, routes)
+
+	_, err = parseRouteHeader("alerts-db match=(")
+	require.Error(t, err)
+}
+
+func TestServer_PublishRoutes(t *testing.T) {
+	c := newTestConfig(t)
+	c.PublishRoutes = []*PublishRoute{
+		mustParsePublishRoute(t, "alerts alerts-db match=(?i)postgres"),
+		mustParsePublishRoute(t, "alerts alerts-oncall tags=critical"),
+		mustParsePublishRoute(t, "other alerts-db"),
+	}
+	s := newTestServer(t, c)
+
+	response := request(t, s, "PUT", "/alerts", "PostgreSQL is down", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "alerts-db", toMessage(t, response.Body.String()).Topic)
+
+	response = request(t, s, "PUT", "/alerts?tags=warning,critical", "Disk full", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "alerts-oncall", toMessage(t, response.Body.String()).Topic)
+
+	response = request(t, s, "PUT", "/alerts", "Something else", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "alerts", toMessage(t, response.Body.String()).Topic)
+
+	response = request(t, s, "GET", "/alerts-db/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "PostgreSQL is down", messages[0].Message)
+
+	response = request(t, s, "GET", "/alerts/json?poll=1", "", nil)
+	messages = toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "Something else", messages[0].Message)
+}
+
+func TestServer_PublishRoutes_Header(t *testing.T) {
+	c := newTestConfig(t)
+	c.PublishRoutes = []*PublishRoute{
+		mustParsePublishRoute(t, "alerts alerts-db match=postgres"),
+	}
+	s := newTestServer(t, c)
+
+	// Header routes are evaluated before server routes
+	response := request(t, s, "PUT", "/alerts", "postgres is down", map[string]string{
+		"X-Route": "alerts-web match=nginx; alerts-urgent match=down",
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "alerts-urgent", toMessage(t, response.Body.String()).Topic)
+
+	response = request(t, s, "PUT", "/alerts?route=alerts-web+title=nginx", "postgres is slow", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "alerts-db", toMessage(t, response.Body.String()).Topic)
+
+	response = request(t, s, "PUT", "/alerts", "hi", map[string]string{
+		"X-Route": "invalid/topic",
+	})
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40071, toHTTPError(t, response.Body.String()).Code)
+}
+
+func TestServer_PublishRoutes_TargetAccess(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionReadWrite
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AllowAccess(user.Everyone, "secret", user.PermissionDenyAll))
+	require.Nil(t, s.userManager.AllowAccess("phil", "secret", user.PermissionReadWrite))
+
+	response := request(t, s, "PUT", "/alerts", "hi", map[string]string{
+		"X-Route": "secret",
+	})
+	require.Equal(t, 403, response.Code)
+
+	response = request(t, s, "PUT", "/alerts", "hi", map[string]string{
+		"X-Route":       "secret",
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "secret", toMessage(t, response.Body.String()).Topic)
+}
+
+func mustParsePublishRoute(t *testing.T, spec string) *PublishRoute {
+	route, err := ParsePublishRoute(spec)
+	require.Nil(t, err)
+	return route
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+)
+
+// Silence windows are time windows of a reserved topic (e.g. nightly maintenance) during which messages are
+// still cached and delivered to subscribers, but not forwarded via Firebase, Web Push, the upstream server,
+// email or phone calls. Windows can repeat daily or weekly. If requested, a summary message with the number
+// of messages published during the window is published to the topic when the window ends, see pruneTopicSilences.
+//
+// Silence windows are managed by the topic owner via /v1/account/reservation/<topic>/silence, and are stored
+// in the user database.
+
+const (
+	silenceSummaryTitle = "Silence window ended"
+	silenceSummaryTag   = "zzz"
+)
+
+// handleAccountTopicSilenceList returns all silence windows of a topic reserved by the current user
+func (s *Server) handleAccountTopicSilenceList(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationSilenceRegex)
+	if err != nil {
+		return err
+	}
+	silences, err := s.userManager.TopicSilences(topic)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	response := make([]*apiAccountTopicSilenceResponse, 0, len(silences))
+	for _, silence := range silences {
+		response = append(response, newTopicSilenceResponse(silence, now))
+	}
+	return s.writeJSON(w, response)
+}
+
+// handleAccountTopicSilenceAdd adds a silence window to a topic reserved by the current user. The start
+// defaults to the current time. Repeating windows must be shorter than the repeat interval.
+func (s *Server) handleAccountTopicSilenceAdd(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationSilenceRegex)
+	if err != nil {
+		return err
+	}
+	req, err := readJSONWithLimit[apiAccountTopicSilenceRequest](r.Body, jsonBodyBytesLimit, false)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if req.Start > 0 {
+		start = time.Unix(req.Start, 0)
+	}
+	end := time.Unix(req.End, 0)
+	repeat := user.SilenceRepeat(req.Repeat)
+	if !repeat.Valid() {
+		return errHTTPBadRequestTopicSilenceInvalid.Wrap("repeat must be empty, %s or %s", user.SilenceRepeatDaily, user.SilenceRepeatWeekly)
+	} else if !end.After(start) {
+		return errHTTPBadRequestTopicSilenceInvalid.Wrap("end must be after start")
+	} else if interval := repeat.Interval(); interval > 0 && end.Sub(start) >= interval {
+		return errHTTPBadRequestTopicSilenceInvalid.Wrap("window must be shorter than the repeat interval")
+	}
+	logvr(v, r).
+		Tag(tagAccount).
+		Fields(log.Context{
+			"topic":          topic,
+			"silence_start":  start.Unix(),
+			"silence_end":    end.Unix(),
+			"silence_repeat": repeat,
+		}).
+		Debug("Adding silence window for topic %s", topic)
+	silence, err := s.userManager.AddTopicSilence(v.User().Name, topic, start, end, repeat, req.Summary)
+	if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newTopicSilenceResponse(silence, time.Now()))
+}
+
+// handleAccountTopicSilenceDelete removes a silence window from a topic reserved by the current user
+func (s *Server) handleAccountTopicSilenceDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	topic, err := s.readReservedTopic(r, v, apiAccountReservationSilenceSingleRegex)
+	if err != nil {
+		return err
+	}
+	id := apiAccountReservationSilenceSingleRegex.FindStringSubmatch(r.URL.Path)[2]
+	logvr(v, r).Tag(tagAccount).Fields(log.Context{"topic": topic, "silence_id": id}).Debug("Removing silence window %s of topic %s", id, topic)
+	if err := s.userManager.RemoveTopicSilence(v.User().Name, topic, id); errors.Is(err, user.ErrTopicSilenceNotFound) {
+		return errHTTPNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.writeJSON(w, newSuccessResponse())
+}
+
+// topicSilenced returns true if any of the silence windows of the given topic is active. In that case,
+// messages are not forwarded via Firebase, Web Push, the upstream server, email or phone calls.
+func (s *Server) topicSilenced(topic string) bool {
+	if s.userManager == nil {
+		return false
+	}
+	silences, err := s.userManager.TopicSilences(topic)
+	if err != nil {
+		log.Tag(tagPublish).Field("topic", topic).Err(err).Warn("Cannot read silence windows, not silencing topic")
+		return false
+	}
+	now := time.Now()
+	for _, silence := range silences {
+		if silence.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneTopicSilences publishes a summary message for silence windows that have ended (if requested), and
+// removes non-repeating windows that have ended.
+func (s *Server) pruneTopicSilences() {
+	if s.userManager == nil {
+		return
+	}
+	log.
+		Tag(tagManager).
+		Timing(func() {
+			now := time.Now()
+			silences, err := s.userManager.TopicSilencesWithSummary(now)
+			if err != nil {
+				log.Tag(tagManager).Err(err).Warn("Error retrieving silence windows")
+				return
+			}
+			for _, silence := range silences {
+				end := silence.LastEnd(now)
+				if end.IsZero() || !end.After(silence.Summarized) {
+					continue
+				}
+				if end.After(silence.Created) { // Do not summarize windows that ended before the window was added
+					if err := s.publishTopicSilenceSummary(silence, end); err != nil {
+						log.Tag(tagManager).Fields(log.Context{"topic": silence.Topic, "silence_id": silence.ID}).Err(err).Warn("Error publishing silence window summary")
+						continue
+					}
+				}
+				if err := s.userManager.MarkTopicSilenceSummarized(silence.ID, end); err != nil {
+					log.Tag(tagManager).Field("silence_id", silence.ID).Err(err).Warn("Error marking silence window as summarized")
+				}
+			}
+			if err := s.userManager.RemoveExpiredTopicSilences(); err != nil {
+				log.Tag(tagManager).Err(err).Warn("Error removing expired silence windows")
+			}
+		}).
+		Debug("Checked for ended silence windows")
+}
+
+// publishTopicSilenceSummary publishes a message with the number of messages published to the topic during
+// the occurrence of the silence window that ended at the given time. The message is published on behalf of
+// the topic owner, see publishManagerMessage. No summary is published if no messages were published during
+// the window.
+func (s *Server) publishTopicSilenceSummary(silence *user.TopicSilence, end time.Time) error {
+	start := end.Add(-silence.End.Sub(silence.Start))
+	count, err := s.messageCache.MessagesCountBetween(silence.Topic, start, end)
+	if err != nil {
+		return err
+	} else if count == 0 {
+		return nil
+	}
+	u, err := s.userManager.User(silence.Owner)
+	if err != nil {
+		return err
+	}
+	v := s.visitor(netip.IPv4Unspecified(), u)
+	m := newDefaultMessage(silence.Topic, fmt.Sprintf("%d message(s) were published between %s and %s while notifications were silenced", count, start.Format(time.RFC3339), end.Format(time.RFC3339)))
+	m.Title = silenceSummaryTitle
+	m.Tags = []string{silenceSummaryTag}
+	m.User = u.ID
+	m.Expires = time.Unix(m.Time, 0).Add(v.Limits().MessageExpiryDuration).Unix()
+	logvm(v, m).Tag(tagManager).Field("silence_id", silence.ID).Debug("Publishing silence window summary for topic %s", silence.Topic)
+	return s.publishManagerMessage(v, m)
+}
+
+func newTopicSilenceResponse(silence *user.TopicSilence, now time.Time) *apiAccountTopicSilenceResponse {
+	return &apiAccountTopicSilenceResponse{
+		ID:      silence.ID,
+		Topic:   silence.Topic,
+		Start:   silence.Start.Unix(),
+		End:     silence.End.Unix(),
+		Repeat:  string(silence.Repeat),
+		Summary: silence.Summary,
+		Active:  silence.Active(now),
+	}
+}
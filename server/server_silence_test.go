@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_TopicSilence_AddListDelete(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthDefault = user.PermissionReadWrite
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", MessageLimit: 100, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "alerts", user.PermissionReadWrite))
+
+	// Only the owner can add silence windows
+	end := time.Now().Add(time.Hour).Unix()
+	rr := request(t, s, "POST", "/v1/account/reservation/alerts/silence", fmt.Sprintf(`{"end": %d}`, end), map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+
+	// Invalid windows are rejected
+	rr = request(t, s, "POST", "/v1/account/reservation/alerts/silence", fmt.Sprintf(`{"end": %d, "repeat": "monthly"}`, end), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40066, toHTTPError(t, rr.Body.String()).Code)
+	rr = request(t, s, "POST", "/v1/account/reservation/alerts/silence", fmt.Sprintf(`{"start": %d, "end": %d, "repeat": "daily"}`, end-2*86400, end), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 40066, toHTTPError(t, rr.Body.String()).Code)
+
+	rr = request(t, s, "POST", "/v1/account/reservation/alerts/silence", fmt.Sprintf(`{"end": %d, "repeat": "daily", "summary": true}`, end), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	silence, err := util.UnmarshalJSON[apiAccountTopicSilenceResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "alerts", silence.Topic)
+	require.Equal(t, end, silence.End)
+	require.Equal(t, "daily", silence.Repeat)
+	require.True(t, silence.Summary)
+	require.True(t, silence.Active)
+
+	rr = request(t, s, "GET", "/v1/account/reservation/alerts/silence", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	silences, err := util.UnmarshalJSON[[]*apiAccountTopicSilenceResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(*silences))
+	require.Equal(t, silence.ID, (*silences)[0].ID)
+
+	// Delete
+	rr = request(t, s, "DELETE", "/v1/account/reservation/alerts/silence/"+silence.ID, "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 401, rr.Code)
+	rr = request(t, s, "DELETE", "/v1/account/reservation/alerts/silence/"+silence.ID, "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	rr = request(t, s, "DELETE", "/v1/account/reservation/alerts/silence/"+silence.ID, "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 404, rr.Code)
+}
+
+func TestServer_TopicSilence_SuppressForwardingAndSummarize(t *testing.T) {
+	conf := newTestConfigWithAuthFile(t)
+	conf.AuthDefault = user.PermissionReadWrite
+	conf.EnableReservations = true
+	s := newTestServer(t, conf)
+	sender := newTestFirebaseSender(10)
+	s.firebaseClient = newFirebaseClient(sender, &testAuther{Allow: true})
+
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", MessageLimit: 100, ReservationLimit: 2}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "alerts", user.PermissionReadWrite))
+
+	end := time.Now().Add(2 * time.Second).Unix()
+	rr := request(t, s, "POST", "/v1/account/reservation/alerts/silence", fmt.Sprintf(`{"end": %d, "summary": true}`, end), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	// Messages are cached, but not forwarded while the topic is silenced
+	require.Equal(t, 200, request(t, s, "PUT", "/alerts", "maintenance 1", nil).Code)
+	require.Equal(t, 200, request(t, s, "PUT", "/alerts", "maintenance 2", nil).Code)
+	time.Sleep(100 * time.Millisecond) // Firebase publishing happens
+	require.Equal(t, 0, len(sender.Messages()))
+	rr = request(t, s, "GET", "/alerts/json?poll=1", "", nil)
+	require.Equal(t, 2, len(toMessages(t, rr.Body.String())))
+
+	// Summary is published once the window has ended, and the window is removed
+	time.Sleep(time.Until(time.Unix(end, 0)))
+	s.pruneTopicSilences()
+	s.pruneTopicSilences() // Only once
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 1, len(sender.Messages()))
+	rr = request(t, s, "GET", "/alerts/json?poll=1", "", nil)
+	messages := toMessages(t, rr.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, silenceSummaryTitle, messages[2].Title)
+	require.Contains(t, messages[2].Message, "2 message(s) were published")
+	silences, err := s.userManager.TopicSilences("alerts")
+	require.Nil(t, err)
+	require.Empty(t, silences)
+
+	// Messages are forwarded again
+	require.Equal(t, 200, request(t, s, "PUT", "/alerts", "back to normal", nil).Code)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 2, len(sender.Messages()))
+}
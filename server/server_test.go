@@ -3,20 +3,31 @@ package server
 import (
 	"bufio"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	_ "embed"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"github.com/pires/go-proxyproto"
+	"github.com/quic-go/quic-go/http3"
 	"golang.org/x/crypto/bcrypt"
 	"heckel.io/ntfy/v2/user"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -55,10 +66,12 @@ func TestServer_PublishAndPoll(t *testing.T) {
 
 	response = request(t, s, "GET", "/mytopic/sse?poll=1&since=all", "", nil)
 	lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
-	require.Equal(t, 3, len(lines))
-	require.Equal(t, "my first message", toMessage(t, strings.TrimPrefix(lines[0], "data: ")).Message)
-	require.Equal(t, "", lines[1])
-	require.Equal(t, "my second\n\nmessage", toMessage(t, strings.TrimPrefix(lines[2], "data: ")).Message)
+	require.Equal(t, 5, len(lines))
+	require.Equal(t, "id: "+messages[0].Resume, lines[0])
+	require.Equal(t, "my first message", toMessage(t, strings.TrimPrefix(lines[1], "data: ")).Message)
+	require.Equal(t, "", lines[2])
+	require.Equal(t, "id: "+messages[1].Resume, lines[3])
+	require.Equal(t, "my second\n\nmessage", toMessage(t, strings.TrimPrefix(lines[4], "data: ")).Message)
 
 	response = request(t, s, "GET", "/mytopic/raw?poll=1", "", nil)
 	lines = strings.Split(strings.TrimSpace(response.Body.String()), "\n")
@@ -126,6 +139,30 @@ func TestServer_PublishWithFirebase_WithoutUsers_AndWithoutPanic(t *testing.T) {
 	require.Equal(t, "my first message", toMessage(t, response.Body.String()).Message)
 }
 
+func TestServer_Capabilities(t *testing.T) {
+	c := newTestConfig(t)
+	c.Version = "1.2.3"
+	s := newTestServer(t, c)
+
+	response := request(t, s, "GET", "/v1/capabilities", "", nil)
+	require.Equal(t, 200, response.Code)
+	capabilities, _ := util.UnmarshalJSON[apiCapabilitiesResponse](io.NopCloser(response.Body))
+	require.Equal(t, "1.2.3", capabilities.Version)
+	require.Equal(t, []string{"markdown", "templates", "actions", "scheduled", "attachments", "uploads", "claims", "ephemeral"}, capabilities.Capabilities)
+	require.Equal(t, 4096, capabilities.MessageSizeLimit)
+	require.Equal(t, 0, capabilities.MessageChunkedSizeLimit)
+
+	c = newTestConfigWithAuthFile(t)
+	c.AttachmentCacheDir = ""
+	c.SMTPSenderAddr = "localhost:25"
+	c.MessageChunkedSizeLimit = 65536
+	s = newTestServer(t, c)
+	response = request(t, s, "GET", "/v1/capabilities", "", nil)
+	capabilities, _ = util.UnmarshalJSON[apiCapabilitiesResponse](io.NopCloser(response.Body))
+	require.Equal(t, []string{"markdown", "templates", "actions", "scheduled", "email", "access-control", "presence", "chunked", "claims", "ephemeral"}, capabilities.Capabilities)
+	require.Equal(t, 65536, capabilities.MessageChunkedSizeLimit)
+}
+
 func TestServer_SubscribeOpenAndKeepalive(t *testing.T) {
 	t.Parallel()
 	c := newTestConfig(t)
@@ -290,6 +327,176 @@ func TestServer_PublishLargeMessage(t *testing.T) {
 	require.Equal(t, 400, response.Code)
 }
 
+func TestServer_PublishChunkedMessage(t *testing.T) {
+	c := newTestConfig(t)
+	c.MessageChunkedSizeLimit = 16 * 1024
+	s := newTestServer(t, c)
+
+	// Chunks can arrive in any order, and may be as large as the message size limit
+	body := strings.Repeat("this is a large log line\n", 400)
+	chunks := []string{body[:4096], body[4096:8192], body[8192:]}
+	for _, index := range []int{3, 1} {
+		response := request(t, s, "PUT", "/mytopic", chunks[index-1], map[string]string{
+			"X-Chunk-ID":    "abc123",
+			"X-Chunk-Index": strconv.Itoa(index),
+			"X-Chunk-Count": "3",
+			"Title":         "Ignored",
+		})
+		require.Equal(t, 200, response.Code)
+		m := toMessage(t, response.Body.String())
+		require.Equal(t, "chunk", m.Event)
+		require.Equal(t, "abc123", m.ID)
+	}
+	response := request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
+	require.Equal(t, "", response.Body.String())
+
+	// The last missing chunk publishes the message, using its own parameters
+	response = request(t, s, "PUT", "/mytopic?chunk-id=abc123&chunk-index=2&chunk-count=3", chunks[1], map[string]string{
+		"Title": "Server logs",
+	})
+	require.Equal(t, 200, response.Code)
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, "message", m.Event)
+	require.Equal(t, "Server logs", m.Title)
+	require.Equal(t, strings.TrimSpace(body), m.Message)
+	require.Nil(t, m.Attachment)
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, m.ID, messages[0].ID)
+	require.Equal(t, strings.TrimSpace(body), messages[0].Message)
+}
+
+func TestServer_PublishChunkedMessage_Invalid(t *testing.T) {
+	chunkHeaders := func(id string, index, count int) map[string]string {
+		return map[string]string{
+			"X-Chunk-ID":    id,
+			"X-Chunk-Index": strconv.Itoa(index),
+			"X-Chunk-Count": strconv.Itoa(count),
+		}
+	}
+
+	// Disabled by default
+	s := newTestServer(t, newTestConfig(t))
+	response := request(t, s, "PUT", "/mytopic", "chunk", chunkHeaders("abc", 1, 2))
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40060, toHTTPError(t, response.Body.String()).Code)
+
+	c := newTestConfig(t)
+	c.MessageChunkedSizeLimit = 8192
+	s = newTestServer(t, c)
+
+	// Invalid parameters
+	for _, headers := range []map[string]string{
+		chunkHeaders("abc", 0, 2),
+		chunkHeaders("abc", 3, 2),
+		chunkHeaders("abc", 1, 1001),
+		chunkHeaders("invalid id!", 1, 2),
+		{"X-Chunk-ID": "abc"},
+	} {
+		response = request(t, s, "PUT", "/mytopic", "chunk", headers)
+		require.Equal(t, 40060, toHTTPError(t, response.Body.String()).Code)
+	}
+
+	// Chunk count must not change
+	response = request(t, s, "PUT", "/mytopic", "chunk", chunkHeaders("abc", 1, 2))
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "PUT", "/mytopic", "chunk", chunkHeaders("abc", 2, 3))
+	require.Equal(t, 40060, toHTTPError(t, response.Body.String()).Code)
+
+	// Chunks must not be larger than the message size limit
+	response = request(t, s, "PUT", "/mytopic", strings.Repeat("x", 4097), chunkHeaders("def", 1, 2))
+	require.Equal(t, 413, response.Code)
+	require.Equal(t, 41305, toHTTPError(t, response.Body.String()).Code)
+
+	// The reassembled message must not be larger than the chunked size limit
+	for i := 1; i <= 2; i++ {
+		response = request(t, s, "PUT", "/mytopic", strings.Repeat("x", 4096), chunkHeaders("ghi", i, 3))
+		require.Equal(t, 200, response.Code)
+	}
+	response = request(t, s, "PUT", "/mytopic", "x", chunkHeaders("ghi", 3, 3))
+	require.Equal(t, 41305, toHTTPError(t, response.Body.String()).Code)
+
+	// Too many incomplete messages
+	for i := 0; i < chunkedMessagesPerVisitorLimit-1; i++ {
+		response = request(t, s, "PUT", "/mytopic", "chunk", chunkHeaders(fmt.Sprintf("msg%d", i), 1, 2))
+		require.Equal(t, 200, response.Code)
+	}
+	response = request(t, s, "PUT", "/mytopic", "chunk", chunkHeaders("onetoomany", 1, 2))
+	require.Equal(t, 429, response.Code)
+	require.Equal(t, 42912, toHTTPError(t, response.Body.String()).Code)
+
+	// Expired messages are pruned
+	for _, m := range s.chunks.messages {
+		m.lastAccess = time.Now().Add(-2 * chunkedMessageTimeout)
+	}
+	require.Equal(t, chunkedMessagesPerVisitorLimit, s.chunks.Prune())
+	response = request(t, s, "PUT", "/mytopic", "chunk", chunkHeaders("onetoomany", 1, 2))
+	require.Equal(t, 200, response.Code)
+}
+
+func TestServer_PublishIdempotencyKey(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	// Retrying with the same key returns the original message
+	response := request(t, s, "PUT", "/mytopic", "hi there", map[string]string{
+		"X-Idempotency-Key": "abc-123",
+	})
+	require.Equal(t, 200, response.Code)
+	m1 := toMessage(t, response.Body.String())
+	response = request(t, s, "PUT", "/mytopic?idempotency-key=abc-123", "hi there", nil)
+	require.Equal(t, 200, response.Code)
+	m2 := toMessage(t, response.Body.String())
+	require.Equal(t, m1.ID, m2.ID)
+	require.Equal(t, m1.Time, m2.Time)
+
+	// Keys are scoped to the topic
+	response = request(t, s, "PUT", "/othertopic", "hi there", map[string]string{
+		"X-Idempotency-Key": "abc-123",
+	})
+	require.NotEqual(t, m1.ID, toMessage(t, response.Body.String()).ID)
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, m1.ID, messages[0].ID)
+
+	// Keys are forgotten after a while
+	for _, m := range s.idempotencyKeys.messages {
+		m.expires = time.Now().Add(-time.Second)
+	}
+	require.Equal(t, 2, s.idempotencyKeys.Prune())
+	response = request(t, s, "PUT", "/mytopic", "hi there", map[string]string{
+		"X-Idempotency-Key": "abc-123",
+	})
+	require.NotEqual(t, m1.ID, toMessage(t, response.Body.String()).ID)
+
+	// Invalid key
+	response = request(t, s, "PUT", "/mytopic", "hi there", map[string]string{
+		"X-Idempotency-Key": "invalid key!",
+	})
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40069, toHTTPError(t, response.Body.String()).Code)
+}
+
+func TestServer_PublishIdempotencyKey_FailedRequestCanBeRetried(t *testing.T) {
+	c := newTestConfig(t)
+	c.MessageSizeLimit = 4096
+	c.AttachmentCacheDir = "" // Disable attachments
+	s := newTestServer(t, c)
+
+	response := request(t, s, "PUT", "/mytopic", strings.Repeat("x", 5000), map[string]string{
+		"X-Idempotency-Key": "abc",
+	})
+	require.Equal(t, 400, response.Code)
+	response = request(t, s, "PUT", "/mytopic", "hi there", map[string]string{
+		"X-Idempotency-Key": "abc",
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "hi there", toMessage(t, response.Body.String()).Message)
+}
+
 func TestServer_PublishPriority(t *testing.T) {
 	s := newTestServer(t, newTestConfig(t))
 
@@ -321,6 +528,36 @@ func TestServer_PublishPriority(t *testing.T) {
 	require.Equal(t, 40007, toHTTPError(t, response.Body.String()).Code)
 }
 
+func TestServer_PublishPriority_Aliases(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "PUT", "/mytopic", "test", map[string]string{"Priority": "Meh"})
+	require.Equal(t, 2, toMessage(t, response.Body.String()).Priority)
+
+	response = request(t, s, "PUT", "/mytopic", "test", map[string]string{"Priority": "critical"})
+	require.Equal(t, 5, toMessage(t, response.Body.String()).Priority)
+
+	response = request(t, s, "PUT", "/mytopic", "test", map[string]string{"Priority": "urgnet"})
+	err := toHTTPError(t, response.Body.String())
+	require.Equal(t, 40007, err.Code)
+	require.Equal(t, `invalid priority parameter; unknown priority "urgnet", did you mean "urgent"?`, err.Message)
+}
+
+func TestServer_PublishTags_Normalized(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "PUT", "/mytopic", "test", map[string]string{"Tags": " warning   :Skull:  backup "})
+	require.Equal(t, []string{"warning", "skull", "backup"}, toMessage(t, response.Body.String()).Tags)
+
+	response = request(t, s, "PUT", "/mytopic", "test", map[string]string{"Tags": ":tada:, backup server ,,"})
+	require.Equal(t, []string{"tada", "backup server"}, toMessage(t, response.Body.String()).Tags)
+
+	response = request(t, s, "PUT", "/mytopic", "test", map[string]string{"Tags": ":warnign:"})
+	err := toHTTPError(t, response.Body.String())
+	require.Equal(t, 40065, err.Code)
+	require.Equal(t, `invalid request: unknown emoji in tags; unknown emoji ":warnign:", did you mean ":warning:"?`, err.Message)
+}
+
 func TestServer_PublishPriority_SpecialHTTPHeader(t *testing.T) {
 	s := newTestServer(t, newTestConfig(t))
 
@@ -595,6 +832,82 @@ func TestServer_PublishAndPollSince(t *testing.T) {
 	require.Equal(t, 40008, toHTTPError(t, response.Body.String()).Code)
 }
 
+func TestServer_PublishAndLongPoll_CacheBatching(t *testing.T) {
+	t.Parallel()
+	c := newTestConfig(t)
+	c.CacheBatchTimeout = 300 * time.Millisecond
+	s := newTestServer(t, c)
+
+	msg1 := toMessage(t, request(t, s, "PUT", "/mytopic", "test 1", nil).Body.String())
+	waitFor(t, func() bool {
+		return s.messageCache.PendingWrites() == 0
+	})
+
+	// The long poll returns only once the message is cached, so the next poll finds the since ID
+	longPoll := make(chan string)
+	go func() {
+		longPoll <- request(t, s, "GET", "/mytopic/json?poll=1&since="+msg1.ID+"&wait=30s", "", nil).Body.String()
+	}()
+	time.Sleep(200 * time.Millisecond)
+	request(t, s, "PUT", "/mytopic", "test 2", nil)
+	messages := toMessages(t, <-longPoll)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "test 2", messages[0].Message)
+	response := request(t, s, "GET", "/mytopic/json?poll=1&since="+messages[0].ID, "", nil)
+	require.Empty(t, response.Body.String())
+}
+
+func TestServer_PublishAndLongPoll(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, newTestConfig(t))
+
+	// Cached messages are returned immediately
+	msg1 := toMessage(t, request(t, s, "PUT", "/mytopic", "test 1", nil).Body.String())
+	start := time.Now()
+	response := request(t, s, "GET", "/mytopic/json?poll=1&since=all&wait=10s", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "test 1", messages[0].Message)
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	// No new messages, request waits and returns an empty response
+	start = time.Now()
+	response = request(t, s, "GET", "/mytopic/json?poll=1&since="+msg1.ID+"&wait=500ms", "", nil)
+	require.Equal(t, 200, response.Code)
+	require.Empty(t, response.Body.String())
+	require.True(t, time.Since(start) >= 500*time.Millisecond)
+
+	// Request waits for the next message, and returns it
+	longPollRR := httptest.NewRecorder()
+	longPollCancel := subscribe(t, s, "/mytopic/json?since="+msg1.ID+"&wait=30s", longPollRR)
+	request(t, s, "PUT", "/mytopic", "test 2", nil)
+	longPollCancel()
+	messages = toMessages(t, longPollRR.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "test 2", messages[0].Message)
+
+	// Uncached messages end the long poll right away
+	done := make(chan time.Time)
+	go func() {
+		request(t, s, "GET", "/mytopic/json?poll=1&since="+msg1.ID+"&wait=30s", "", nil)
+		done <- time.Now()
+	}()
+	time.Sleep(200 * time.Millisecond)
+	start = time.Now()
+	request(t, s, "PUT", "/mytopic", "not cached", map[string]string{"Cache": "no"})
+	select {
+	case end := <-done:
+		require.True(t, end.Sub(start) < longPollCacheWait)
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll did not return")
+	}
+
+	// Invalid wait durations
+	response = request(t, s, "GET", "/mytopic/json?poll=1&wait=10m", "", nil)
+	require.Equal(t, 40059, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "GET", "/mytopic/json?poll=1&wait=soon", "", nil)
+	require.Equal(t, 40059, toHTTPError(t, response.Body.String()).Code)
+}
 func newMessageWithTimestamp(topic, message string, timestamp int64) *message {
 	m := newDefaultMessage(topic, message)
 	m.Time = timestamp
@@ -642,6 +955,83 @@ func TestServer_PollSinceID_MultipleTopics_IDDoesNotMatch(t *testing.T) {
 	require.Equal(t, "test 6", messages[3].Message)
 }
 
+func TestServer_PollSinceResumeToken(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	require.Nil(t, s.messageCache.AddMessage(newMessageWithTimestamp("mytopic", "test 1", 1655740277)))
+	require.Nil(t, s.messageCache.AddMessage(newMessageWithTimestamp("mytopic", "test 2", 1655740283)))
+	require.Nil(t, s.messageCache.AddMessage(newMessageWithTimestamp("mytopic", "test 3", 1655740289)))
+
+	response := request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, resumeToken(messages[0]), messages[0].Resume)
+
+	// Resume right after the given message
+	response = request(t, s, "GET", "/mytopic/json?poll=1&since="+messages[0].Resume, "", nil)
+	resumed := toMessages(t, response.Body.String())
+	require.Equal(t, 2, len(resumed))
+	require.Equal(t, "test 2", resumed[0].Message)
+	require.Equal(t, "test 3", resumed[1].Message)
+
+	// EventSource passes the last token as Last-Event-ID header
+	response = request(t, s, "GET", "/mytopic/sse?poll=1", "", map[string]string{"Last-Event-ID": messages[1].Resume})
+	require.Equal(t, 1, strings.Count(response.Body.String(), "data: "))
+	require.Contains(t, response.Body.String(), `"message":"test 3"`)
+
+	// Message is gone from the cache: resume with the messages published after it
+	gone := newMessageWithTimestamp("mytopic", "deleted", 1655740280)
+	response = request(t, s, "GET", "/mytopic/json?poll=1&since="+resumeToken(gone), "", nil)
+	resumed = toMessages(t, response.Body.String())
+	require.Equal(t, 2, len(resumed))
+	require.Equal(t, "test 2", resumed[0].Message)
+	require.Equal(t, "test 3", resumed[1].Message)
+}
+
+func TestServer_PollSinceResumeToken_MessageDeletedSameSecond(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	// Messages in the same second are ordered by ID when the token's message is gone
+	for _, m := range []struct{ id, message string }{{"aaaaaaaaaaaa", "a"}, {"bbbbbbbbbbbb", "b"}, {"cccccccccccc", "c"}} {
+		msg := newMessageWithTimestamp("mytopic", m.message, 1655740277)
+		msg.ID = m.id
+		require.Nil(t, s.messageCache.AddMessage(msg))
+	}
+	require.Nil(t, s.messageCache.AddMessage(newMessageWithTimestamp("mytopic", "next second", 1655740278)))
+
+	response := request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 4, len(messages))
+	require.Equal(t, "b", messages[1].Message)
+
+	// The client received "a" and "b", and "b" is deleted before it resumes: "a" and "b" are not sent again
+	require.Nil(t, s.messageCache.DeleteMessages(messages[1].ID))
+	response = request(t, s, "GET", "/mytopic/json?poll=1&since="+messages[1].Resume, "", nil)
+	resumed := toMessages(t, response.Body.String())
+	require.Equal(t, 2, len(resumed))
+	require.Equal(t, "c", resumed[0].Message)
+	require.Equal(t, "next second", resumed[1].Message)
+
+	// Same for scheduled messages
+	response = request(t, s, "GET", "/mytopic/json?poll=1&scheduled=1&since="+messages[1].Resume, "", nil)
+	require.Equal(t, 2, len(toMessages(t, response.Body.String())))
+}
+
+func TestParseResumeToken(t *testing.T) {
+	m := newMessageWithTimestamp("mytopic", "test", 1655740277)
+	since, ok := parseResumeToken(resumeToken(m))
+	require.True(t, ok)
+	require.Equal(t, m.ID, since.ID())
+	require.Equal(t, int64(1655740277), since.Time().Unix())
+
+	_, ok = parseResumeToken(m.ID)
+	require.False(t, ok)
+	_, ok = parseResumeToken("1655740277")
+	require.False(t, ok)
+	_, ok = parseResumeToken(base64.RawURLEncoding.EncodeToString([]byte("1655740277:tooshort")))
+	require.False(t, ok)
+}
+
 func TestServer_PublishViaGET(t *testing.T) {
 	s := newTestServer(t, newTestConfig(t))
 
@@ -914,6 +1304,49 @@ func TestServer_Auth_ViaQuery(t *testing.T) {
 	require.Equal(t, 401, response.Code)
 }
 
+func TestServer_TopicPresence(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddReservation("phil", "mytopic", user.PermissionReadWrite))
+
+	response := request(t, s, "GET", "/mytopic/presence", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, `{"topic":"mytopic","subscribers":0}`+"\n", response.Body.String())
+
+	// Anonymous subscriber does not see the number of subscribers
+	rr1 := httptest.NewRecorder()
+	cancel1 := subscribe(t, s, "/mytopic/json", rr1)
+
+	// The owner sees the number of subscribers in the open event, and via the presence endpoint
+	rr2 := httptest.NewRecorder()
+	cancel2 := subscribe(t, s, fmt.Sprintf("/mytopic/json?auth=%s", base64.RawURLEncoding.EncodeToString([]byte(util.BasicAuth("phil", "phil")))), rr2)
+
+	response = request(t, s, "GET", "/mytopic/presence", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, `{"topic":"mytopic","subscribers":2}`+"\n", response.Body.String())
+
+	// Other users cannot see it
+	response = request(t, s, "GET", "/mytopic/presence", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 403, response.Code)
+	response = request(t, s, "GET", "/mytopic/presence", "", nil)
+	require.Equal(t, 403, response.Code)
+
+	cancel1()
+	cancel2()
+	open1 := toMessage(t, strings.Split(rr1.Body.String(), "\n")[0])
+	require.Equal(t, openEvent, open1.Event)
+	require.Equal(t, 0, open1.Subscribers)
+	open2 := toMessage(t, strings.Split(rr2.Body.String(), "\n")[0])
+	require.Equal(t, openEvent, open2.Event)
+	require.Equal(t, 2, open2.Subscribers)
+}
+
 func TestServer_Auth_NonBasicHeader(t *testing.T) {
 	s := newTestServer(t, newTestConfigWithAuthFile(t))
 
@@ -1124,17 +1557,36 @@ func TestServer_DailyMessageQuotaFromDatabase(t *testing.T) {
 }
 
 type testMailer struct {
-	count int
-	mu    sync.Mutex
+	count    int
+	lastTo   string
+	lastLink string
+	mu       sync.Mutex
 }
 
-func (t *testMailer) Send(v *visitor, m *message, to string) error {
+func (t *testMailer) Send(v *visitor, m *message, to, lang string) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.count++
 	return nil
 }
 
+func (t *testMailer) SendPasswordReset(v *visitor, to, username, link, lang string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count++
+	t.lastTo = to
+	t.lastLink = link
+	return nil
+}
+
+func (t *testMailer) SendTierExpiryWarning(to, username, tierName string, expires time.Time, lang string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count++
+	t.lastTo = to
+	return nil
+}
+
 func (t *testMailer) Counts() (total int64, success int64, failure int64) {
 	return 0, 0, 0
 }
@@ -1198,6 +1650,27 @@ func TestServer_PublishTooManyRequests_IPv6_Slash48(t *testing.T) {
 	require.Equal(t, 429, response.Code)
 }
 
+func TestServer_PublishTooManyRequests_RateLimitAlgorithms(t *testing.T) {
+	for _, algorithm := range util.RateAlgorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			c := newTestConfig(t)
+			c.VisitorRequestLimitBurst = 3
+			c.VisitorRateLimitAlgorithms = map[string]util.RateAlgorithm{VisitorRateLimitRequest: algorithm}
+			s := newTestServer(t, c)
+			for i := 0; i < 3; i++ {
+				response := request(t, s, "PUT", "/mytopic", fmt.Sprintf("message %d", i), nil)
+				require.Equal(t, 200, response.Code)
+			}
+			response := request(t, s, "PUT", "/mytopic", "message", nil)
+			require.Equal(t, 429, response.Code)
+
+			v := s.visitor(netip.MustParseAddr("9.9.9.9"), nil)
+			require.Equal(t, algorithm, v.requestLimiter.Algorithm())
+			require.Equal(t, c.VisitorRateLimitAlgorithm, v.emailsLimiter.Algorithm())
+		})
+	}
+}
+
 func TestServer_PublishTooManyRequests_Defaults_ExemptHosts(t *testing.T) {
 	c := newTestConfig(t)
 	c.VisitorRequestLimitBurst = 3
@@ -1343,10 +1816,8 @@ func TestServer_PublishAndExpungeTopicAfter16Hours(t *testing.T) {
 	})
 	require.Equal(t, 200, response.Code)
 	waitFor(t, func() bool {
-		s.mu.Lock()
-		tp, exists := s.topics["mytopic"]
-		s.mu.Unlock()
-		if !exists {
+		tp := s.topics.Get("mytopic")
+		if tp == nil {
 			return false
 		}
 		// .lastAccess set in t.Publish() -> t.Keepalive() in Goroutine
@@ -1361,20 +1832,20 @@ func TestServer_PublishAndExpungeTopicAfter16Hours(t *testing.T) {
 
 	// Topic won't get pruned
 	s.execManager()
-	require.NotNil(t, s.topics["mytopic"])
+	require.NotNil(t, s.topics.Get("mytopic"))
 
 	// Fudge with last access, but subscribe, and see that it won't get pruned (because of subscriber)
-	subID := s.topics["mytopic"].Subscribe(subFn, "", func() {})
-	s.topics["mytopic"].mu.Lock()
-	s.topics["mytopic"].lastAccess = time.Now().Add(-17 * time.Hour)
-	s.topics["mytopic"].mu.Unlock()
+	subID := s.topics.Get("mytopic").Subscribe(subFn, "", func() {})
+	s.topics.Get("mytopic").mu.Lock()
+	s.topics.Get("mytopic").lastAccess = time.Now().Add(-17 * time.Hour)
+	s.topics.Get("mytopic").mu.Unlock()
 	s.execManager()
-	require.NotNil(t, s.topics["mytopic"])
+	require.NotNil(t, s.topics.Get("mytopic"))
 
 	// It'll finally get pruned now that there are no subscribers and last access is 17 hours ago
-	s.topics["mytopic"].Unsubscribe(subID)
+	s.topics.Get("mytopic").Unsubscribe(subID)
 	s.execManager()
-	require.Nil(t, s.topics["mytopic"])
+	require.Nil(t, s.topics.Get("mytopic"))
 }
 
 func TestServer_TopicKeepaliveOnPoll(t *testing.T) {
@@ -1386,13 +1857,13 @@ func TestServer_TopicKeepaliveOnPoll(t *testing.T) {
 	require.Equal(t, 200, response.Code)
 
 	// Mess with last access time
-	s.topics["mytopic"].lastAccess = time.Now().Add(-17 * time.Hour)
+	s.topics.Get("mytopic").lastAccess = time.Now().Add(-17 * time.Hour)
 
 	// Poll again and check keepalive time
 	response = request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
 	require.Equal(t, 200, response.Code)
-	require.True(t, s.topics["mytopic"].lastAccess.Unix() >= time.Now().Unix()-2)
-	require.True(t, s.topics["mytopic"].lastAccess.Unix() <= time.Now().Unix()+2)
+	require.True(t, s.topics.Get("mytopic").lastAccess.Unix() >= time.Now().Unix()-2)
+	require.True(t, s.topics.Get("mytopic").lastAccess.Unix() <= time.Now().Unix()+2)
 }
 
 func TestServer_UnifiedPushDiscovery(t *testing.T) {
@@ -1526,10 +1997,10 @@ func TestServer_MatrixGateway_Push_Failure_NoSubscriber_After13Hours(t *testing.
 	response := request(t, s, "POST", "/_matrix/push/v1/notify", notification, nil)
 	require.Equal(t, 507, response.Code)
 	require.Equal(t, 50701, toHTTPError(t, response.Body.String()).Code)
-	require.Nil(t, s.topics["mytopic"].rateVisitor)
+	require.Nil(t, s.topics.Get("mytopic").rateVisitor)
 
 	// Fake: This topic has been around for 13 hours without a rate visitor
-	s.topics["mytopic"].lastAccess = time.Now().Add(-13 * time.Hour)
+	s.topics.Get("mytopic").lastAccess = time.Now().Add(-13 * time.Hour)
 
 	// Same request should now return HTTP 200 with a rejected pushkey
 	response = request(t, s, "POST", "/_matrix/push/v1/notify", notification, nil)
@@ -1537,9 +2008,9 @@ func TestServer_MatrixGateway_Push_Failure_NoSubscriber_After13Hours(t *testing.
 	require.Equal(t, `{"rejected":["http://127.0.0.1:12345/mytopic?up=1"]}`, strings.TrimSpace(response.Body.String()))
 
 	// Slightly unrelated: Test that topic is pruned after 16 hours
-	s.topics["mytopic"].lastAccess = time.Now().Add(-17 * time.Hour)
+	s.topics.Get("mytopic").lastAccess = time.Now().Add(-17 * time.Hour)
 	s.execManager()
-	require.Nil(t, s.topics["mytopic"])
+	require.Nil(t, s.topics.Get("mytopic"))
 }
 
 func TestServer_MatrixGateway_Push_Failure_InvalidPushkey(t *testing.T) {
@@ -2136,6 +2607,99 @@ func TestServer_PublishAttachmentWithTierBasedLimits(t *testing.T) {
 	require.Equal(t, 41301, toHTTPError(t, response.Body.String()).Code)
 }
 
+func TestServer_PublishAttachmentWithTierBasedTypeRestrictions(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddTier(&user.Tier{
+		Code:                     "free",
+		MessageLimit:             100,
+		AttachmentFileSizeLimit:  50_000,
+		AttachmentTotalSizeLimit: 200_000,
+		AttachmentExpiryDuration: time.Hour,
+		AttachmentBandwidthLimit: 1_000_000,
+		AttachmentDeniedTypes:    []string{"video/*", "application/vnd.microsoft.portable-executable"},
+	}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "free"))
+	content := util.RandomString(5000) // > 4096
+	video := "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom" + content
+	executable := "MZ" + content
+
+	// Text attachment is allowed
+	response := request(t, s, "PUT", "/mytopic?f=notes.txt", content, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, response.Code)
+
+	// Denied types are rejected, regardless of the filename
+	response = request(t, s, "PUT", "/mytopic?f=movie.mp4", video, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 415, response.Code)
+	require.Equal(t, 41501, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "PUT", "/mytopic?f=harmless.txt", executable, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 415, response.Code)
+
+	// Anonymous users are not affected by tier restrictions
+	response = request(t, s, "PUT", "/mytopic?f=movie.mp4", video, nil)
+	require.Equal(t, 200, response.Code)
+
+	// Only allow images
+	require.Nil(t, s.userManager.AddTier(&user.Tier{
+		Code:                     "images",
+		MessageLimit:             100,
+		AttachmentFileSizeLimit:  50_000,
+		AttachmentTotalSizeLimit: 200_000,
+		AttachmentExpiryDuration: time.Hour,
+		AttachmentBandwidthLimit: 1_000_000,
+		AttachmentAllowedTypes:   []string{"image/*"},
+	}))
+	require.Nil(t, s.userManager.ChangeTier("phil", "images"))
+
+	response = request(t, s, "PUT", "/mytopic?f=notes.txt", content, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 415, response.Code)
+}
+
+func TestServer_PublishAttachmentWithConfigBasedTypeRestrictions(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionReadWrite
+	c.VisitorAttachmentDeniedTypes = []string{"video/*"}
+	s := newTestServer(t, c)
+	require.Nil(t, s.userManager.AddTier(&user.Tier{
+		Code:                     "pro",
+		MessageLimit:             100,
+		AttachmentFileSizeLimit:  50_000,
+		AttachmentTotalSizeLimit: 200_000,
+		AttachmentExpiryDuration: time.Hour,
+		AttachmentBandwidthLimit: 1_000_000,
+	}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AddUser("ben", "ben", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	content := util.RandomString(5000) // > 4096
+	video := "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom" + content
+
+	// Anonymous users and users without a tier are restricted by the server config
+	response := request(t, s, "PUT", "/mytopic?f=notes.txt", content, nil)
+	require.Equal(t, 200, response.Code)
+	response = request(t, s, "PUT", "/mytopic?f=movie.mp4", video, nil)
+	require.Equal(t, 415, response.Code)
+	require.Equal(t, 41501, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "PUT", "/mytopic?f=movie.mp4", video, map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 415, response.Code)
+
+	// Tier restrictions replace the config-based ones
+	response = request(t, s, "PUT", "/mytopic?f=movie.mp4", video, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, response.Code)
+}
+
 func TestServer_PublishAttachmentBandwidthLimit(t *testing.T) {
 	content := util.RandomString(5000) // > 4096
 
@@ -2332,7 +2896,7 @@ func TestServer_PublishWhileUpdatingStatsWithLotsOfMessages(t *testing.T) {
 	messages := make([]*message, 0)
 	for i := 0; i < count; i++ {
 		topicID := fmt.Sprintf("topic%d", i)
-		_, err := s.topicsFromIDs(topicID) // Add topic to internal s.topics array
+		_, err := s.topicsFromIDs(topicID) // Add topic to the topic registry (s.topics)
 		require.Nil(t, err)
 		messages = append(messages, newDefaultMessage(topicID, "some message"))
 	}
@@ -2412,7 +2976,7 @@ func TestServer_SubscriberRateLimiting_Success(t *testing.T) {
 	rr := request(t, s, "GET", "/upAAAAAAAAAAAA/json?poll=1", "", nil, subscriber1Fn)
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Equal(t, "1.2.3.4", s.topics["upAAAAAAAAAAAA"].rateVisitor.ip.String())
+	require.Equal(t, "1.2.3.4", s.topics.Get("upAAAAAAAAAAAA").rateVisitor.ip.String())
 
 	// "Register" visitor 8.7.7.1 to topic "up012345678912" as a rate limit visitor (implicitly via topic name)
 	subscriber2Fn := func(r *http.Request) {
@@ -2421,7 +2985,7 @@ func TestServer_SubscriberRateLimiting_Success(t *testing.T) {
 	rr = request(t, s, "GET", "/up012345678912/json?poll=1", "", nil, subscriber2Fn)
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Equal(t, "8.7.7.1", s.topics["up012345678912"].rateVisitor.ip.String())
+	require.Equal(t, "8.7.7.1", s.topics.Get("up012345678912").rateVisitor.ip.String())
 
 	// Publish 2 messages to "subscriber1topic" as visitor 9.9.9.9. It'd be 3 normally, but the
 	// GET request before is also counted towards the request limiter.
@@ -2464,9 +3028,9 @@ func TestServer_SubscriberRateLimiting_NotWrongTopic(t *testing.T) {
 	rr := request(t, s, "GET", "/alerts,upAAAAAAAAAAAA,upBBBBBBBBBBBB/json?poll=1", "", nil, subscriberFn)
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Nil(t, s.topics["alerts"].rateVisitor)
-	require.Equal(t, "1.2.3.4", s.topics["upAAAAAAAAAAAA"].rateVisitor.ip.String())
-	require.Equal(t, "1.2.3.4", s.topics["upBBBBBBBBBBBB"].rateVisitor.ip.String())
+	require.Nil(t, s.topics.Get("alerts").rateVisitor)
+	require.Equal(t, "1.2.3.4", s.topics.Get("upAAAAAAAAAAAA").rateVisitor.ip.String())
+	require.Equal(t, "1.2.3.4", s.topics.Get("upBBBBBBBBBBBB").rateVisitor.ip.String())
 }
 
 func TestServer_SubscriberRateLimiting_NotEnabled_Failed(t *testing.T) {
@@ -2483,7 +3047,7 @@ func TestServer_SubscriberRateLimiting_NotEnabled_Failed(t *testing.T) {
 	})
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Nil(t, s.topics["upAAAAAAAAAAAA"].rateVisitor)
+	require.Nil(t, s.topics.Get("upAAAAAAAAAAAA").rateVisitor)
 
 	// Registering visitor 8.7.7.1 to topic has no effect
 	rr = request(t, s, "GET", "/up012345678912/json?poll=1", "", nil, func(r *http.Request) {
@@ -2491,7 +3055,7 @@ func TestServer_SubscriberRateLimiting_NotEnabled_Failed(t *testing.T) {
 	})
 	require.Equal(t, 200, rr.Code)
 	require.Equal(t, "", rr.Body.String())
-	require.Nil(t, s.topics["up012345678912"].rateVisitor)
+	require.Nil(t, s.topics.Get("up012345678912").rateVisitor)
 
 	// Publish 3 messages to "upAAAAAAAAAAAA" as visitor 9.9.9.9
 	for i := 0; i < 3; i++ {
@@ -2568,15 +3132,15 @@ func TestServer_SubscriberRateLimiting_VisitorExpiration(t *testing.T) {
 	}
 	rr := request(t, s, "GET", "/upAAAAAAAAAAAA/json?poll=1", "", nil, subscriberFn)
 	require.Equal(t, 200, rr.Code)
-	require.Equal(t, "1.2.3.4", s.topics["upAAAAAAAAAAAA"].rateVisitor.ip.String())
-	require.Equal(t, s.visitors["ip:1.2.3.4"], s.topics["upAAAAAAAAAAAA"].rateVisitor)
+	require.Equal(t, "1.2.3.4", s.topics.Get("upAAAAAAAAAAAA").rateVisitor.ip.String())
+	require.Equal(t, s.visitors["ip:1.2.3.4"], s.topics.Get("upAAAAAAAAAAAA").rateVisitor)
 
 	// Publish message, observe rate visitor tokens being decreased
 	response := request(t, s, "POST", "/upAAAAAAAAAAAA", "some message", nil)
 	require.Equal(t, 200, response.Code)
 	require.Equal(t, int64(0), s.visitors["ip:9.9.9.9"].messagesLimiter.Value())
-	require.Equal(t, int64(1), s.topics["upAAAAAAAAAAAA"].rateVisitor.messagesLimiter.Value())
-	require.Equal(t, s.visitors["ip:1.2.3.4"], s.topics["upAAAAAAAAAAAA"].rateVisitor)
+	require.Equal(t, int64(1), s.topics.Get("upAAAAAAAAAAAA").rateVisitor.messagesLimiter.Value())
+	require.Equal(t, s.visitors["ip:1.2.3.4"], s.topics.Get("upAAAAAAAAAAAA").rateVisitor)
 
 	// Expire visitor
 	s.visitors["ip:1.2.3.4"].seen = time.Now().Add(-1 * 25 * time.Hour)
@@ -2586,7 +3150,7 @@ func TestServer_SubscriberRateLimiting_VisitorExpiration(t *testing.T) {
 	response = request(t, s, "POST", "/upAAAAAAAAAAAA", "some message", nil)
 	require.Equal(t, 200, response.Code)
 	require.Equal(t, int64(1), s.visitors["ip:9.9.9.9"].messagesLimiter.Value())
-	require.Nil(t, s.topics["upAAAAAAAAAAAA"].rateVisitor)
+	require.Nil(t, s.topics.Get("upAAAAAAAAAAAA").rateVisitor)
 	require.Nil(t, s.visitors["ip:1.2.3.4"])
 }
 
@@ -2606,8 +3170,8 @@ func TestServer_SubscriberRateLimiting_ProtectedTopics_WithDefaultReadWrite(t *t
 		r.RemoteAddr = "1.2.3.4:1234"
 	})
 	require.Equal(t, 200, rr.Code)
-	require.Equal(t, "1.2.3.4", s.topics["up123456789012"].rateVisitor.ip.String())
-	require.Nil(t, s.topics["announcements"].rateVisitor)
+	require.Equal(t, "1.2.3.4", s.topics.Get("up123456789012").rateVisitor.ip.String())
+	require.Nil(t, s.topics.Get("announcements").rateVisitor)
 }
 
 func TestServer_MessageHistoryAndStatsEndpoint(t *testing.T) {
@@ -3209,6 +3773,47 @@ func TestServer_MessageTemplate_Until100_000(t *testing.T) {
 	require.Contains(t, toHTTPError(t, response.Body.String()).Message, "too many iterations")
 }
 
+func TestServer_RequestID(t *testing.T) {
+	var out syncBuffer
+	log.SetOutput(&out)
+	log.SetFormat(log.JSONFormat)
+	log.SetLevel(log.DebugLevel)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFormat(log.TextFormat)
+		log.SetLevel(log.InfoLevel)
+	}()
+
+	s := newTestServer(t, newTestConfig(t))
+
+	// Request ID is generated, and returned in the response
+	rr := request(t, s, "PUT", "/mytopic", "hi", nil)
+	require.Equal(t, 200, rr.Code)
+	requestID := rr.Header().Get("X-Request-ID")
+	require.Len(t, requestID, requestIDLength)
+
+	// Valid request ID is reused, invalid one is replaced
+	rr = request(t, s, "PUT", "/mytopic", "hi", map[string]string{
+		"X-Request-ID": "proxy-1234.abc",
+	})
+	require.Equal(t, 200, rr.Code)
+	require.Equal(t, "proxy-1234.abc", rr.Header().Get("X-Request-ID"))
+	rr = request(t, s, "PUT", "/mytopic", "hi", map[string]string{
+		"X-Request-ID": "not valid!",
+	})
+	require.Equal(t, 200, rr.Code)
+	require.Len(t, rr.Header().Get("X-Request-ID"), requestIDLength)
+
+	// All log events of the request carry the request ID and visitor fields
+	lines := out.RequestLines(requestID)
+	require.GreaterOrEqual(t, len(lines), 2)
+	for _, line := range lines {
+		require.Equal(t, "9.9.9.9", line["visitor_ip"])
+	}
+	require.Equal(t, "HTTP request finished", lines[len(lines)-1]["message"])
+	require.NotEmpty(t, out.RequestLines("proxy-1234.abc"))
+}
+
 func newTestConfig(t *testing.T) *Config {
 	conf := NewConfig()
 	conf.BaseURL = "http://127.0.0.1:12345"
@@ -3233,7 +3838,7 @@ func newTestConfigWithAuthFile(t *testing.T) *Config {
 }
 
 func newTestServer(t *testing.T, config *Config) *Server {
-	server, err := New(config)
+	server, err := New(WithConfig(config))
 	require.Nil(t, err)
 	return server
 }
@@ -3318,3 +3923,195 @@ func waitForWithMaxWait(t *testing.T, maxWait time.Duration, f func() bool) {
 	}
 	t.Fatalf("Function f did not succeed after %v: %v", maxWait, string(debug.Stack()))
 }
+
+func TestServer_HTTP3(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.CertFile, conf.KeyFile = newTestCertificate(t)
+	conf.ListenHTTPS = "127.0.0.1:0"
+	conf.ListenHTTP3 = "127.0.0.1:0"
+	s := newTestServer(t, conf)
+	require.Nil(t, s.Start())
+	defer s.Stop()
+
+	// Publish and poll via HTTP/3
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+	baseURL := fmt.Sprintf("https://%s", s.http3Conn.LocalAddr().String())
+	resp, err := client.Post(baseURL+"/mytopic", "text/plain", strings.NewReader("via quic"))
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, "HTTP/3.0", resp.Proto)
+	resp.Body.Close()
+
+	resp, err = client.Get(baseURL + "/mytopic/json?poll=1")
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, "via quic", toMessage(t, string(body)).Message)
+
+	// HTTPS listener advertises the HTTP/3 listener
+	httpsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err = httpsClient.Get(fmt.Sprintf("https://%s/v1/health", s.httpsListener.Addr().String()))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, fmt.Sprintf(`h3=":%d"; ma=2592000`, s.http3Conn.LocalAddr().(*net.UDPAddr).Port), resp.Header.Get("Alt-Svc"))
+}
+
+func TestServer_ProxyProtocol(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.ListenHTTP = "127.0.0.1:0"
+	conf.ProxyProtocol = true
+	s := newTestServer(t, conf)
+	require.Nil(t, s.Start())
+	defer s.Stop()
+
+	// PROXY protocol v1 and v2 headers determine the visitor IP
+	require.Equal(t, 200, publishWithProxyHeader(t, s.Addr().String(), []byte("PROXY TCP4 1.2.3.4 127.0.0.1 5678 80\r\n")))
+	header, err := proxyproto.HeaderProxyFromAddrs(2, &net.TCPAddr{IP: net.ParseIP("5.6.7.8"), Port: 5678}, s.Addr()).Format()
+	require.Nil(t, err)
+	require.Equal(t, 200, publishWithProxyHeader(t, s.Addr().String(), header))
+	require.Equal(t, 200, publishWithProxyHeader(t, s.Addr().String(), nil)) // Header is optional
+	s.mu.RLock()
+	require.Contains(t, s.visitors, "ip:1.2.3.4")
+	require.Contains(t, s.visitors, "ip:5.6.7.8")
+	require.Contains(t, s.visitors, "ip:127.0.0.1")
+	s.mu.RUnlock()
+}
+
+func TestServer_ProxyProtocol_UntrustedProxy(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.ListenHTTP = "127.0.0.1:0"
+	conf.ProxyProtocol = true
+	conf.ProxyTrustedPrefixes = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	s := newTestServer(t, conf)
+	require.Nil(t, s.Start())
+	defer s.Stop()
+
+	// 127.0.0.1 is not a trusted proxy, so it must not send a PROXY header
+	require.Equal(t, 400, publishWithProxyHeader(t, s.Addr().String(), []byte("PROXY TCP4 1.2.3.4 127.0.0.1 5678 80\r\n")))
+	require.Equal(t, 200, publishWithProxyHeader(t, s.Addr().String(), nil))
+	s.mu.RLock()
+	require.NotContains(t, s.visitors, "ip:1.2.3.4")
+	require.Contains(t, s.visitors, "ip:127.0.0.1")
+	s.mu.RUnlock()
+}
+
+// publishWithProxyHeader sends the given PROXY protocol header (if any), followed by a publish request, and returns
+// the response status code, or 0 if the connection was closed without a response
+func publishWithProxyHeader(t *testing.T, addr string, header []byte) int {
+	conn, err := net.Dial("tcp", addr)
+	require.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write(append(header, "PUT /mytopic HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\nConnection: close\r\n\r\nhi"...))
+	require.Nil(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// newTestCertificate writes a self-signed certificate for 127.0.0.1 to a temporary directory, and returns
+// the certificate and key file names
+func newTestCertificate(t *testing.T) (certFile, keyFile string) {
+	certPEM, keyPEM := newTestCertificatePEM(t, "127.0.0.1", time.Hour)
+	certFile, keyFile = filepath.Join(t.TempDir(), "cert.pem"), filepath.Join(t.TempDir(), "key.pem")
+	require.Nil(t, os.WriteFile(certFile, certPEM, 0600))
+	require.Nil(t, os.WriteFile(keyFile, keyPEM, 0600))
+	return certFile, keyFile
+}
+
+// newTestCertificatePEM creates a self-signed certificate for the given IP address or domain, valid for
+// the given duration, and returns the PEM-encoded certificate and key
+func newTestCertificatePEM(t *testing.T, host string, validity time.Duration) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+	return certPEM, keyPEM
+}
+
+func TestServer_PublishWithMetadata(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "PUT", "/mytopic?meta-region=eu-west", "Deployment finished", map[string]string{
+		"X-Meta-Env":      "prod",
+		"X-Meta-Build-ID": "4711",
+		"Meta-Region":     "us-east", // Headers take precedence over query parameters
+	})
+	require.Equal(t, 200, response.Code)
+	msg := toMessage(t, response.Body.String())
+	require.Equal(t, map[string]string{"env": "prod", "build-id": "4711", "region": "us-east"}, msg.Metadata)
+
+	response = request(t, s, "POST", "/", `{"topic":"mytopic","message":"Deployment failed","metadata":{"env":"staging"}}`, nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, map[string]string{"env": "staging"}, toMessage(t, response.Body.String()).Metadata)
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1", "", nil)
+	messages := toMessages(t, response.Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "4711", messages[0].Metadata["build-id"])
+	require.Equal(t, "staging", messages[1].Metadata["env"])
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1&meta-env=staging", "", nil)
+	messages = toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "Deployment failed", messages[0].Message)
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1", "", map[string]string{
+		"X-Meta-Env":    "prod",
+		"X-Meta-Region": "us-east",
+	})
+	messages = toMessages(t, response.Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "Deployment finished", messages[0].Message)
+
+	response = request(t, s, "GET", "/mytopic/json?poll=1&meta-env=dev", "", nil)
+	require.Empty(t, toMessages(t, response.Body.String()))
+}
+
+func TestServer_PublishWithMetadata_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+
+	response := request(t, s, "PUT", "/mytopic", "hi", map[string]string{
+		"X-Meta-" + strings.Repeat("a", 33): "value",
+	})
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40072, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "PUT", "/mytopic", "hi", map[string]string{
+		"X-Meta-Env": strings.Repeat("a", 257),
+	})
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40072, toHTTPError(t, response.Body.String()).Code)
+
+	headers := make(map[string]string)
+	for i := 0; i < 17; i++ {
+		headers[fmt.Sprintf("X-Meta-Key%d", i)] = "value"
+	}
+	response = request(t, s, "PUT", "/mytopic", "hi", headers)
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40072, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "POST", "/", `{"topic":"mytopic","message":"hi","metadata":{"in valid":"x"}}`, nil)
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40072, toHTTPError(t, response.Body.String()).Code)
+}
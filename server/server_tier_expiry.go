@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/user"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+const (
+	tierExpiryEventExpiring   = "tier_expiring"
+	tierExpiryEventDowngraded = "tier_downgraded"
+)
+
+// expireTiers warns users whose tier is about to expire, and downgrades users whose tier has expired
+// (after the configured grace period) to the configured downgrade tier, or removes their tier entirely.
+// Both events are also sent to the tier expiry webhook (if configured), so that billing systems can react.
+func (s *Server) expireTiers() {
+	if s.userManager == nil {
+		return
+	}
+	log.
+		Tag(tagManager).
+		Timing(func() {
+			now := time.Now()
+			users, err := s.userManager.UsersWithTierExpiringBefore(now.Add(s.config.TierExpiryWarningDuration))
+			if err != nil {
+				log.Tag(tagManager).Err(err).Warn("Error retrieving users with expiring tiers")
+				return
+			}
+			for _, u := range users {
+				if !u.TierExpires.Add(s.config.TierExpiryGracePeriod).After(now) {
+					if err := s.downgradeExpiredTier(u); err != nil {
+						log.Tag(tagManager).Field("user_name", u.Name).Err(err).Warn("Error downgrading user with expired tier")
+					}
+				} else if !u.TierExpiryWarned && u.TierExpires.After(now) {
+					if err := s.warnTierExpiring(u); err != nil {
+						log.Tag(tagManager).Field("user_name", u.Name).Err(err).Warn("Error warning user about expiring tier")
+					}
+				}
+			}
+		}).
+		Debug("Checked for expiring tiers")
+}
+
+// warnTierExpiring sends an email (if possible) and a webhook event about the upcoming tier expiry,
+// and then marks the user as warned, so that the warning is only sent once.
+func (s *Server) warnTierExpiring(u *user.User) error {
+	ev := log.Tag(tagManager).Field("user_name", u.Name).With(u.Tier)
+	ev.Info("Tier %s of user %s expires at %s, warning user", u.Tier.Code, u.Name, u.TierExpires.Format(time.RFC3339))
+	if s.smtpSender != nil && u.Email != "" {
+		if err := s.smtpSender.SendTierExpiryWarning(u.Email, u.Name, u.Tier.Name, u.TierExpires, s.language(u, nil)); err != nil {
+			ev.Err(err).Warn("Unable to send tier expiry warning email")
+		}
+	}
+	go s.sendTierExpiryWebhook(&apiTierExpiryWebhookEvent{
+		Event:    tierExpiryEventExpiring,
+		Time:     time.Now().Unix(),
+		Username: u.Name,
+		Tier:     u.Tier.Code,
+		Expires:  u.TierExpires.Unix(),
+	})
+	return s.userManager.MarkTierExpiryWarned(u.Name)
+}
+
+// downgradeExpiredTier changes the tier of the user to the configured downgrade tier, or removes the tier
+// if no downgrade tier is configured. Excess reservations are removed, just like when a subscription is canceled.
+func (s *Server) downgradeExpiredTier(u *user.User) error {
+	var newTier *user.Tier
+	if s.config.TierExpiryDowngradeTier != "" {
+		var err error
+		newTier, err = s.userManager.Tier(s.config.TierExpiryDowngradeTier)
+		if err != nil {
+			return fmt.Errorf("cannot load downgrade tier %s: %w", s.config.TierExpiryDowngradeTier, err)
+		}
+	}
+	ev := log.Tag(tagManager).Field("user_name", u.Name).With(u.Tier)
+	reservationsLimit := visitorDefaultReservationsLimit
+	if newTier != nil {
+		reservationsLimit = newTier.ReservationLimit
+	}
+	if err := s.removeMessagesAndExcessReservations(ev, u, reservationsLimit); err != nil {
+		return err
+	}
+	if newTier == nil {
+		ev.Info("Tier %s of user %s expired, removing tier", u.Tier.Code, u.Name)
+		if err := s.userManager.ResetTier(u.Name); err != nil {
+			return err
+		}
+	} else {
+		ev.Info("Tier %s of user %s expired, downgrading to tier %s", u.Tier.Code, u.Name, newTier.Code)
+		if err := s.userManager.ChangeTier(u.Name, newTier.Code); err != nil {
+			return err
+		}
+		if err := s.userManager.ChangeTierExpiry(u.Name, time.Time{}); err != nil {
+			return err
+		}
+	}
+	go s.sendTierExpiryWebhook(&apiTierExpiryWebhookEvent{
+		Event:    tierExpiryEventDowngraded,
+		Time:     time.Now().Unix(),
+		Username: u.Name,
+		Tier:     u.Tier.Code,
+		NewTier:  s.config.TierExpiryDowngradeTier,
+		Expires:  u.TierExpires.Unix(),
+	})
+	u, err := s.userManager.User(u.Name)
+	if err != nil {
+		return err
+	}
+	s.publishSyncEventAsync(s.visitor(netip.IPv4Unspecified(), u))
+	return nil
+}
+
+// changeTierExpiry sets the tier expiry of the given user to the given Unix timestamp, or removes
+// the expiry if the timestamp is zero.
+func (s *Server) changeTierExpiry(username string, expires int64) error {
+	if expires == 0 {
+		return s.userManager.ChangeTierExpiry(username, time.Time{})
+	}
+	return s.userManager.ChangeTierExpiry(username, time.Unix(expires, 0))
+}
+
+// sendTierExpiryWebhook POSTs the given event as JSON to the tier expiry webhook URL, if configured.
+// Errors are logged, but otherwise ignored. This is called in a goroutine (like sendOutboundWebhooks), so that
+// a slow or unreachable webhook does not hold up the manager loop.
+func (s *Server) sendTierExpiryWebhook(event *apiTierExpiryWebhookEvent) {
+	if s.config.TierExpiryWebhookURL == "" {
+		return
+	}
+	ev := log.Tag(tagManager).Fields(log.Context{
+		"user_name":           event.Username,
+		"tier_expiry_event":   event.Event,
+		"tier_expiry_webhook": s.config.TierExpiryWebhookURL,
+	})
+	body, err := json.Marshal(event)
+	if err != nil {
+		ev.Err(err).Warn("Unable to marshal tier expiry webhook event")
+		return
+	}
+	req, err := http.NewRequest("POST", s.config.TierExpiryWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		ev.Err(err).Warn("Unable to send tier expiry webhook")
+		return
+	}
+	req.Header.Set("User-Agent", "ntfy/"+s.config.Version)
+	req.Header.Set("Content-Type", "application/json")
+	var httpClient = &http.Client{
+		Timeout: time.Second * 10,
+	}
+	response, err := httpClient.Do(req)
+	if err != nil {
+		ev.Err(err).Warn("Unable to send tier expiry webhook")
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		ev.Warn("Unable to send tier expiry webhook, server responded with HTTP %s", response.Status)
+		return
+	}
+	ev.Debug("Sent tier expiry webhook")
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_TierExpiry_WarnAndDowngrade(t *testing.T) {
+	var mu sync.Mutex
+	events := make([]*apiTierExpiryWebhookEvent, 0)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event apiTierExpiryWebhookEvent
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&event))
+		mu.Lock()
+		events = append(events, &event)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	conf := newTestConfigWithAuthFile(t)
+	conf.TierExpiryWarningDuration = 24 * time.Hour
+	conf.TierExpiryGracePeriod = time.Hour
+	conf.TierExpiryDowngradeTier = "free"
+	conf.TierExpiryWebhookURL = webhook.URL
+	s := newTestServer(t, conf)
+	mailer := &testMailer{}
+	s.smtpSender = mailer
+
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "free", Name: "Free", ReservationLimit: 1}))
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro", ReservationLimit: 3}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeEmail("phil", "phil@example.com"))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.AddReservation("phil", "mytopic1", user.PermissionDenyAll))
+	require.Nil(t, s.userManager.AddReservation("phil", "mytopic2", user.PermissionDenyAll))
+
+	// Not yet within the warning window
+	require.Nil(t, s.userManager.ChangeTierExpiry("phil", time.Now().Add(48*time.Hour)))
+	s.expireTiers()
+	require.Equal(t, 0, mailer.Count())
+
+	// Within warning window: warn once
+	expires := time.Now().Add(2 * time.Hour)
+	require.Nil(t, s.userManager.ChangeTierExpiry("phil", expires))
+	s.expireTiers()
+	s.expireTiers()
+	require.Equal(t, 1, mailer.Count())
+	require.Equal(t, "phil@example.com", mailer.lastTo)
+	waitFor(t, func() bool { // Webhooks are sent asynchronously
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 1
+	})
+
+	// Expired, but within grace period: nothing happens
+	require.Nil(t, s.userManager.ChangeTierExpiry("phil", time.Now().Add(-30*time.Minute)))
+	require.Nil(t, s.userManager.MarkTierExpiryWarned("phil"))
+	s.expireTiers()
+	u, err := s.userManager.User("phil")
+	require.Nil(t, err)
+	require.Equal(t, "pro", u.Tier.Code)
+
+	// Grace period over: downgrade, and remove excess reservations
+	require.Nil(t, s.userManager.ChangeTierExpiry("phil", time.Now().Add(-2*time.Hour)))
+	s.expireTiers()
+	u, err = s.userManager.User("phil")
+	require.Nil(t, err)
+	require.Equal(t, "free", u.Tier.Code)
+	require.True(t, u.TierExpires.IsZero())
+	reservations, err := s.userManager.Reservations("phil")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(reservations))
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 2
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, "tier_expiring", events[0].Event)
+	require.Equal(t, "phil", events[0].Username)
+	require.Equal(t, "pro", events[0].Tier)
+	require.Equal(t, expires.Unix(), events[0].Expires)
+	require.Equal(t, "tier_downgraded", events[1].Event)
+	require.Equal(t, "pro", events[1].Tier)
+	require.Equal(t, "free", events[1].NewTier)
+}
+
+func TestServer_TierExpiry_SlowWebhook(t *testing.T) {
+	unblock := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer webhook.Close()
+	defer close(unblock)
+
+	conf := newTestConfigWithAuthFile(t)
+	conf.TierExpiryWebhookURL = webhook.URL
+	s := newTestServer(t, conf)
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro"}))
+	for _, username := range []string{"phil", "ben"} {
+		require.Nil(t, s.userManager.AddUser(username, username, user.RoleUser, false))
+		require.Nil(t, s.userManager.ChangeTier(username, "pro"))
+		require.Nil(t, s.userManager.ChangeTierExpiry(username, time.Now().Add(-time.Minute)))
+	}
+
+	// The webhook does not respond, but the manager is not held up by it
+	start := time.Now()
+	s.expireTiers()
+	require.True(t, time.Since(start) < time.Second)
+	for _, username := range []string{"phil", "ben"} {
+		u, err := s.userManager.User(username)
+		require.Nil(t, err)
+		require.Nil(t, u.Tier)
+	}
+}
+
+func TestServer_TierExpiry_ResetTier(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro"}))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.ChangeTier("phil", "pro"))
+	require.Nil(t, s.userManager.ChangeTierExpiry("phil", time.Now().Add(-time.Minute)))
+
+	s.expireTiers()
+	u, err := s.userManager.User("phil")
+	require.Nil(t, err)
+	require.Nil(t, u.Tier)
+	require.True(t, u.TierExpires.IsZero())
+}
+
+func TestServer_TierExpiry_UsersAPI(t *testing.T) {
+	s := newTestServer(t, newTestConfigWithAuthFile(t))
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleAdmin, false))
+	require.Nil(t, s.userManager.AddTier(&user.Tier{Code: "pro", Name: "Pro"}))
+	expires := time.Now().Add(72 * time.Hour).Unix()
+
+	// Expiry without tier is rejected
+	rr := request(t, s, "POST", "/v1/users", `{"username": "ben", "password": "ben", "tier_expires": 1}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 400, rr.Code)
+
+	// Add user with tier and expiry
+	rr = request(t, s, "POST", "/v1/users", fmt.Sprintf(`{"username": "ben", "password": "ben", "tier": "pro", "tier_expires": %d}`, expires), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+
+	rr = request(t, s, "GET", "/v1/users", "", map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	users, err := util.UnmarshalJSON[[]apiUserResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, "ben", (*users)[1].Username)
+	require.Equal(t, expires, (*users)[1].TierExpires)
+
+	rr = request(t, s, "GET", "/v1/account", "", map[string]string{
+		"Authorization": util.BasicAuth("ben", "ben"),
+	})
+	require.Equal(t, 200, rr.Code)
+	account, err := util.UnmarshalJSON[apiAccountResponse](io.NopCloser(rr.Body))
+	require.Nil(t, err)
+	require.Equal(t, expires, account.Tier.Expires)
+
+	// Extend expiry only
+	rr = request(t, s, "PUT", "/v1/users", fmt.Sprintf(`{"username": "ben", "tier_expires": %d}`, expires+3600), map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	u, err := s.userManager.User("ben")
+	require.Nil(t, err)
+	require.Equal(t, expires+3600, u.TierExpires.Unix())
+
+	// Changing the tier without expiry removes the expiry
+	rr = request(t, s, "PUT", "/v1/users", `{"username": "ben", "tier": "pro"}`, map[string]string{
+		"Authorization": util.BasicAuth("phil", "phil"),
+	})
+	require.Equal(t, 200, rr.Code)
+	u, err = s.userManager.User("ben")
+	require.Nil(t, err)
+	require.True(t, u.TierExpires.IsZero())
+}
@@ -17,18 +17,18 @@ const (
 	twilioCallFormat = `
 <Response>
 	<Pause length="1"/>
-	<Say loop="3">
-		You have a message from notify on topic %s. Message:
+	<Say loop="3" language="{language}">
+		{intro}
 		<break time="1s"/>
-		%s
+		{message}
 		<break time="1s"/>
-		End of message.
+		{end}
 		<break time="1s"/>
-		This message was sent by user %s. It will be repeated three times.
-		To unsubscribe from calls like this, remove your phone number in the notify web app.
+		{sender}
+		{unsubscribe}
 		<break time="3s"/>
 	</Say>
-	<Say>Goodbye.</Say>
+	<Say language="{language}">{goodbye}</Say>
 </Response>`
 )
 
@@ -59,18 +59,22 @@ func (s *Server) convertPhoneNumber(u *user.User, phoneNumber string) (string, *
 }
 
 // callPhone calls the Twilio API to make a phone call to the given phone number, using the given message.
-// Failures will be logged, but not returned to the caller.
+// Failures will be logged, but not returned to the caller. The request may be nil.
 func (s *Server) callPhone(v *visitor, r *http.Request, m *message, to string) {
 	u, sender := v.User(), m.Sender.String()
 	if u != nil {
 		sender = u.Name
 	}
-	body := fmt.Sprintf(twilioCallFormat, xmlEscapeText(m.Topic), xmlEscapeText(m.Message), xmlEscapeText(sender))
+	body := formatCall(newTranslator(s.language(u, r)), m, sender)
 	data := url.Values{}
 	data.Set("From", s.config.TwilioPhoneNumber)
 	data.Set("To", to)
 	data.Set("Twiml", body)
-	ev := logvrm(v, r, m).Tag(tagTwilio).Field("twilio_to", to).FieldIf("twilio_body", body, log.TraceLevel).Debug("Sending Twilio request")
+	ev := logvm(v, m)
+	if r != nil { // Calls made by the manager (see escalateMessages) have no request
+		ev = logvrm(v, r, m)
+	}
+	ev = ev.Tag(tagTwilio).Field("twilio_to", to).FieldIf("twilio_body", body, log.TraceLevel).Debug("Sending Twilio request")
 	response, err := s.callPhoneInternal(data)
 	if err != nil {
 		ev.Field("twilio_response", response).Err(err).Warn("Error sending Twilio request")
@@ -81,6 +85,19 @@ func (s *Server) callPhone(v *visitor, r *http.Request, m *message, to string) {
 	minc(metricCallsMadeSuccess)
 }
 
+// formatCall renders the TwiML for a phone call in the language of the given translator
+func formatCall(tr *translator, m *message, sender string) string {
+	return strings.NewReplacer(
+		"{language}", tr.T("call.language"),
+		"{intro}", xmlEscapeText(tr.T("call.intro", "topic", m.Topic)),
+		"{message}", xmlEscapeText(m.Message),
+		"{end}", xmlEscapeText(tr.T("call.end")),
+		"{sender}", xmlEscapeText(tr.T("call.sender", "sender", sender)),
+		"{unsubscribe}", xmlEscapeText(tr.T("call.unsubscribe")),
+		"{goodbye}", xmlEscapeText(tr.T("call.goodbye")),
+	).Replace(twilioCallFormat)
+}
+
 func (s *Server) callPhoneInternal(data url.Values) (string, error) {
 	requestURL := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Calls.json", s.config.TwilioCallsBaseURL, s.config.TwilioAccount)
 	req, err := http.NewRequest(http.MethodPost, requestURL, strings.NewReader(data.Encode()))
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+)
+
+// handleUploadOptions handles the tus discovery request, see https://tus.io/protocols/resumable-upload#options
+func (s *Server) handleUploadOptions(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	if err := s.handleOptions(w, r, v); err != nil {
+		return err
+	}
+	s.setTusHeaders(w)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(v.Limits().AttachmentFileSizeLimit, 10))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// handleUploadCreate creates a new upload of the length given in the Upload-Length header. The upload must
+// fit into the attachment limits of the visitor. The filename can be passed in the Upload-Metadata header.
+func (s *Server) handleUploadCreate(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return errHTTPBadRequestUploadInvalid
+	}
+	filename, err := parseUploadFilename(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return errHTTPBadRequestUploadInvalid
+	}
+	vinfo, err := v.Info()
+	if err != nil {
+		return err
+	}
+	if length > vinfo.Limits.AttachmentFileSizeLimit || length > vinfo.Stats.AttachmentTotalSizeRemaining || length > s.fileCache.Remaining() {
+		return errHTTPEntityTooLargeAttachment.Fields(log.Context{
+			"upload_length":                   length,
+			"attachment_total_size_remaining": vinfo.Stats.AttachmentTotalSizeRemaining,
+			"attachment_file_size_limit":      vinfo.Limits.AttachmentFileSizeLimit,
+		})
+	}
+	u, err := s.uploads.Create(visitorOwner(v), filename, length)
+	if err != nil {
+		return err
+	}
+	logvr(v, r).
+		Tag(tagUpload).
+		Fields(log.Context{
+			"upload_id":     u.ID,
+			"upload_length": u.Length,
+		}).
+		Debug("Created upload")
+	s.setTusHeaders(w)
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", apiUploadsPath, u.ID)) // Relative, so it works regardless of base-url
+	w.Header().Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// handleUploadHead returns the current offset of an upload, so that the client can resume it
+func (s *Server) handleUploadHead(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	u, err := s.uploads.Get(uploadIDFromPath(r.URL.Path), visitorOwner(v))
+	if err != nil {
+		return err
+	}
+	s.setTusHeaders(w)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	w.Header().Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// handleUploadPatch appends the request body to an upload at the offset given in the Upload-Offset header
+func (s *Server) handleUploadPatch(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	if r.Header.Get("Content-Type") != tusContentType {
+		return errHTTPUnsupportedMediaTypeUpload
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return errHTTPConflictUploadOffset
+	}
+	id := uploadIDFromPath(r.URL.Path)
+	u, err := s.uploads.Append(id, visitorOwner(v), offset, r.Body)
+	if err != nil {
+		logvr(v, r).Tag(tagUpload).Field("upload_id", id).Err(err).Debug("Appending to upload failed")
+		return err
+	}
+	logvr(v, r).
+		Tag(tagUpload).
+		Fields(log.Context{
+			"upload_id":     u.ID,
+			"upload_offset": u.Offset,
+			"upload_length": u.Length,
+		}).
+		Debug("Received %d byte(s) of upload", u.Offset-offset)
+	s.setTusHeaders(w)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// handleUploadDelete deletes an upload, see https://tus.io/protocols/resumable-upload#termination
+func (s *Server) handleUploadDelete(w http.ResponseWriter, r *http.Request, v *visitor) error {
+	if err := s.uploads.Remove(uploadIDFromPath(r.URL.Path), visitorOwner(v)); err != nil {
+		return err
+	}
+	s.setTusHeaders(w)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// handleUploadAsAttachment uses a complete upload as the attachment of the message, as if the uploaded file had
+// been the request body. The upload is deleted once it has been stored as attachment.
+func (s *Server) handleUploadAsAttachment(r *http.Request, v *visitor, m *message, uploadID string) error {
+	owner := visitorOwner(v)
+	u, err := s.uploads.Get(uploadID, owner)
+	if err != nil {
+		return err
+	} else if m.Attachment != nil && m.Attachment.URL != "" {
+		return errHTTPBadRequestUploadIncomplete.With(m)
+	}
+	f, err := s.uploads.Open(uploadID, owner)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	body, err := util.Peek(f, s.config.MessageSizeLimit)
+	if err != nil {
+		return err
+	}
+	if m.Attachment == nil {
+		m.Attachment = &attachment{}
+	}
+	if m.Attachment.Name == "" {
+		m.Attachment.Name = u.Filename
+	}
+	if err := s.handleBodyAsAttachment(r, v, m, body); err != nil {
+		return err
+	}
+	return s.uploads.Remove(uploadID, owner)
+}
+
+// ensureTusResumable checks the Tus-Resumable header, which is required for all tus requests except OPTIONS
+func (s *Server) ensureTusResumable(next handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			return errHTTPPreconditionFailedTusVersion
+		}
+		return next(w, r, v)
+	}
+}
+
+func (s *Server) ensureUploadsEnabled(next handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, v *visitor) error {
+		if s.uploads == nil {
+			return errHTTPNotFound
+		}
+		return next(w, r, v)
+	}
+}
+
+func (s *Server) setTusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Access-Control-Allow-Origin", s.config.AccessControlAllowOrigin) // CORS, allow cross-origin requests
+	w.Header().Set("Access-Control-Expose-Headers", tusExposedHeadersForCORS)
+}
+
+// parseUploadFilename reads the "filename" key from the Upload-Metadata header, which is a comma-separated
+// list of key/value pairs, with the value being base64-encoded, e.g. "filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg=="
+func parseUploadFilename(metadata string) (string, error) {
+	if len(metadata) > uploadMetadataMaxLength {
+		return "", errHTTPBadRequestUploadInvalid
+	}
+	for _, pair := range util.SplitNoEmpty(metadata, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key != "filename" {
+			continue
+		}
+		filename, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(filename) > uploadFilenameMaxLength || !utf8.Valid(filename) {
+			return "", errHTTPBadRequestUploadInvalid
+		}
+		return string(filename), nil
+	}
+	return "", nil
+}
+
+func uploadIDFromPath(path string) string {
+	return strings.TrimPrefix(path, apiUploadsPath+"/")
+}
+
+// visitorOwner returns the user ID of the visitor, or its IP address for anonymous visitors. It is used to
+// scope state that spans multiple requests (e.g. chunked messages or uploads) to the visitor that created it.
+func visitorOwner(v *visitor) string {
+	if owner := v.MaybeUserID(); owner != "" {
+		return owner
+	}
+	return v.IP().String()
+}
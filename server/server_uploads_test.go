@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/util"
+)
+
+func TestServer_Upload_ResumeAndPublish(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	content := "resumable file " + util.RandomString(9985) // 10000 bytes
+
+	// Discovery
+	response := request(t, s, "OPTIONS", "/v1/uploads", "", nil)
+	require.Equal(t, 204, response.Code)
+	require.Equal(t, "1.0.0", response.Header().Get("Tus-Version"))
+	require.Equal(t, "creation,expiration,termination", response.Header().Get("Tus-Extension"))
+	require.Equal(t, "15728640", response.Header().Get("Tus-Max-Size"))
+
+	// Create
+	response = request(t, s, "POST", "/v1/uploads", "", map[string]string{
+		"Tus-Resumable":   "1.0.0",
+		"Upload-Length":   "10000",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("backup.txt")),
+	})
+	require.Equal(t, 201, response.Code)
+	location := response.Header().Get("Location")
+	require.Regexp(t, `^/v1/uploads/up_[a-z0-9]{29}$`, location)
+	path := location
+
+	// First part, then resume at the offset reported by HEAD
+	response = request(t, s, "PATCH", path, content[:6000], map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Offset": "0",
+		"Content-Type":  "application/offset+octet-stream",
+	})
+	require.Equal(t, 204, response.Code)
+	require.Equal(t, "6000", response.Header().Get("Upload-Offset"))
+
+	response = request(t, s, "HEAD", path, "", map[string]string{
+		"Tus-Resumable": "1.0.0",
+	})
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "6000", response.Header().Get("Upload-Offset"))
+	require.Equal(t, "10000", response.Header().Get("Upload-Length"))
+
+	// Incomplete uploads cannot be published
+	uploadID := strings.TrimPrefix(path, "/v1/uploads/")
+	response = request(t, s, "PUT", "/mytopic", "", map[string]string{
+		"X-Upload": uploadID,
+	})
+	require.Equal(t, 400, response.Code)
+	require.Equal(t, 40062, toHTTPError(t, response.Body.String()).Code)
+
+	response = request(t, s, "PATCH", path, content[6000:], map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Offset": "6000",
+		"Content-Type":  "application/offset+octet-stream",
+	})
+	require.Equal(t, 204, response.Code)
+	require.Equal(t, "10000", response.Header().Get("Upload-Offset"))
+
+	// Publish
+	response = request(t, s, "PUT", "/mytopic", "", map[string]string{
+		"X-Upload": uploadID,
+		"X-Title":  "Backup done",
+	})
+	require.Equal(t, 200, response.Code)
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, "Backup done", m.Title)
+	require.Equal(t, "backup.txt", m.Attachment.Name)
+	require.Equal(t, "text/plain; charset=utf-8", m.Attachment.Type)
+	require.Equal(t, int64(10000), m.Attachment.Size)
+	require.FileExists(t, filepath.Join(s.config.AttachmentCacheDir, m.ID))
+
+	response = request(t, s, "GET", strings.TrimPrefix(m.Attachment.URL, "http://127.0.0.1:12345"), "", nil)
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, content, response.Body.String())
+
+	// Published uploads are removed
+	response = request(t, s, "HEAD", path, "", map[string]string{
+		"Tus-Resumable": "1.0.0",
+	})
+	require.Equal(t, 404, response.Code)
+	require.NoFileExists(t, filepath.Join(s.config.AttachmentCacheDir, uploadsDirName, uploadID))
+}
+
+func TestServer_Upload_Invalid(t *testing.T) {
+	s := newTestServer(t, newTestConfig(t))
+	tusHeaders := map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Offset": "0",
+		"Content-Type":  "application/offset+octet-stream",
+	}
+
+	// Tus-Resumable header is required
+	response := request(t, s, "POST", "/v1/uploads", "", map[string]string{
+		"Upload-Length": "100",
+	})
+	require.Equal(t, 412, response.Code)
+	require.Equal(t, "1.0.0", response.Header().Get("Tus-Version"))
+
+	// Invalid or too large length
+	response = request(t, s, "POST", "/v1/uploads", "", map[string]string{
+		"Tus-Resumable": "1.0.0",
+	})
+	require.Equal(t, 40061, toHTTPError(t, response.Body.String()).Code)
+	response = request(t, s, "POST", "/v1/uploads", "", map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Length": "20000000",
+	})
+	require.Equal(t, 413, response.Code)
+
+	response = request(t, s, "POST", "/v1/uploads", "", map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Length": "100",
+	})
+	require.Equal(t, 201, response.Code)
+	path := response.Header().Get("Location")
+
+	// Offset must match, content type must be set
+	response = request(t, s, "PATCH", path, "some data", map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Offset": "5",
+		"Content-Type":  "application/offset+octet-stream",
+	})
+	require.Equal(t, 409, response.Code)
+	response = request(t, s, "PATCH", path, "some data", map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Offset": "0",
+	})
+	require.Equal(t, 415, response.Code)
+
+	// Uploads belong to the visitor that created them
+	response = request(t, s, "PATCH", path, "some data", tusHeaders, func(r *http.Request) {
+		r.RemoteAddr = "1.2.3.4:1234"
+	})
+	require.Equal(t, 404, response.Code)
+
+	// Delete
+	response = request(t, s, "DELETE", path, "", tusHeaders)
+	require.Equal(t, 204, response.Code)
+	response = request(t, s, "PATCH", path, "some data", tusHeaders)
+	require.Equal(t, 404, response.Code)
+
+	// Unknown uploads cannot be published
+	response = request(t, s, "PUT", "/mytopic", "", map[string]string{
+		"X-Upload": "up_doesnotexist",
+	})
+	require.Equal(t, 404, response.Code)
+}
+
+func TestServer_Upload_Disabled(t *testing.T) {
+	c := newTestConfig(t)
+	c.AttachmentCacheDir = ""
+	s := newTestServer(t, c)
+	response := request(t, s, "POST", "/v1/uploads", "", map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Length": "100",
+	})
+	require.Equal(t, 404, response.Code)
+	require.NotContains(t, s.capabilities(), capabilityUploads)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/SherClockHolmes/webpush-go"
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/user"
+	"heckel.io/ntfy/v2/util"
 )
 
 const (
@@ -57,9 +58,8 @@ func (s *Server) handleWebPushUpdate(w http.ResponseWriter, r *http.Request, v *
 		return err
 	}
 	if s.userManager != nil {
-		u := v.User()
 		for _, t := range topics {
-			if err := s.userManager.Authorize(u, t.ID, user.PermissionRead); err != nil {
+			if err := s.authorizeVisitor(v, t.ID, user.PermissionRead); err != nil {
 				logvr(v, r).With(t).Err(err).Debug("Access to topic %s not authorized", t.ID)
 				return errHTTPForbidden.With(t)
 			}
@@ -83,6 +83,12 @@ func (s *Server) handleWebPushDelete(w http.ResponseWriter, r *http.Request, _ *
 }
 
 func (s *Server) publishToWebPushEndpoints(v *visitor, m *message) {
+	for _, m := range s.withTopicAliasMessages(v, m) {
+		s.publishToWebPushEndpointsForTopic(v, m)
+	}
+}
+
+func (s *Server) publishToWebPushEndpointsForTopic(v *visitor, m *message) {
 	subscriptions, err := s.webPush.SubscriptionsForTopic(m.Topic)
 	if err != nil {
 		logvm(v, m).Err(err).With(v, m).Warn("Unable to publish web push messages")
@@ -94,7 +100,12 @@ func (s *Server) publishToWebPushEndpoints(v *visitor, m *message) {
 		log.Tag(tagWebPush).Err(err).With(v, m).Warn("Unable to marshal expiring payload")
 		return
 	}
+	mutedUserIDs := s.topicMutedUserIDs(m.Topic)
 	for _, subscription := range subscriptions {
+		if subscription.UserID != "" && util.Contains(mutedUserIDs, subscription.UserID) {
+			log.Tag(tagWebPush).With(v, m, subscription).Debug("Not publishing web push message, topic is muted by user")
+			continue
+		}
 		if err := s.sendWebPushNotification(subscription, payload, v, m); err != nil {
 			log.Tag(tagWebPush).Err(err).With(v, m, subscription).Warn("Unable to publish web push message")
 		}
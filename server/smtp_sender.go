@@ -3,10 +3,9 @@ package server
 import (
 	_ "embed" // required by go:embed
 	"encoding/json"
+	"errors"
 	"fmt"
 	"mime"
-	"net"
-	"net/smtp"
 	"strings"
 	"sync"
 	"time"
@@ -16,59 +15,122 @@ import (
 )
 
 type mailer interface {
-	Send(v *visitor, m *message, to string) error
+	Send(v *visitor, m *message, to, lang string) error
+	SendPasswordReset(v *visitor, to, username, link, lang string) error
+	SendTierExpiryWarning(to, username, tierName string, expires time.Time, lang string) error
 	Counts() (total int64, success int64, failure int64)
 }
 
-type smtpSender struct {
-	config  *Config
-	success int64
-	failure int64
-	mu      sync.Mutex
+// mailSender formats emails and sends them via one or more providers, see EmailProvider. Providers are tried
+// in order: if a provider fails or its rate limit is reached, the next provider is used.
+type mailSender struct {
+	config    *Config
+	providers []*mailSenderProvider
+	success   int64
+	failure   int64
+	mu        sync.Mutex
 }
 
-func (s *smtpSender) Send(v *visitor, m *message, to string) error {
-	return s.withCount(v, m, func() error {
-		host, _, err := net.SplitHostPort(s.config.SMTPSenderAddr)
-		if err != nil {
-			return err
-		}
-		message, err := formatMail(s.config.BaseURL, v.ip.String(), s.config.SMTPSenderFrom, to, m)
+type mailSenderProvider struct {
+	mailProvider
+	limiter *util.RateLimiter // Might be nil!
+}
+
+// newMailSender creates a mail sender for the SMTP server (smtp-sender-addr) and the providers (email-providers)
+// in the config. The SMTP server, if set, is the first provider.
+func newMailSender(conf *Config) *mailSender {
+	providers := make([]*EmailProvider, 0)
+	if conf.SMTPSenderAddr != "" {
+		providers = append(providers, &EmailProvider{
+			Type: EmailProviderSMTP,
+			Addr: conf.SMTPSenderAddr,
+			User: conf.SMTPSenderUser,
+			Pass: conf.SMTPSenderPass,
+		})
+	}
+	providers = append(providers, conf.EmailProviders...)
+	s := &mailSender{
+		config:    conf,
+		providers: make([]*mailSenderProvider, 0),
+	}
+	for _, p := range providers {
+		s.providers = append(s.providers, &mailSenderProvider{
+			mailProvider: newMailProvider(p),
+			limiter:      p.rateLimiter(),
+		})
+	}
+	return s
+}
+
+func (s *mailSender) Send(v *visitor, m *message, to, lang string) error {
+	ev := logvm(v, m)
+	return s.withCount(ev, func() error {
+		message, err := formatMail(newTranslator(lang), s.config.BaseURL, v.ip.String(), s.config.SMTPSenderFrom, to, m)
 		if err != nil {
 			return err
 		}
-		var auth smtp.Auth
-		if s.config.SMTPSenderUser != "" {
-			auth = smtp.PlainAuth("", s.config.SMTPSenderUser, s.config.SMTPSenderPass, host)
+		return s.sendMail(ev, to, message)
+	})
+}
+
+func (s *mailSender) SendPasswordReset(v *visitor, to, username, link, lang string) error {
+	ev := logv(v).Field("user_name", username)
+	return s.withCount(ev, func() error {
+		message := formatPasswordResetMail(newTranslator(lang), s.config.BaseURL, v.ip.String(), s.config.SMTPSenderFrom, to, username, link, s.config.PasswordResetTokenDuration)
+		return s.sendMail(ev, to, message)
+	})
+}
+
+func (s *mailSender) SendTierExpiryWarning(to, username, tierName string, expires time.Time, lang string) error {
+	ev := log.Tag(tagManager).Field("user_name", username)
+	return s.withCount(ev, func() error {
+		message := formatTierExpiryWarningMail(newTranslator(lang), s.config.BaseURL, s.config.SMTPSenderFrom, to, username, tierName, expires)
+		return s.sendMail(ev, to, message)
+	})
+}
+
+func (s *mailSender) sendMail(ev *log.Event, to, message string) error {
+	errs := make([]error, 0)
+	for _, p := range s.providers {
+		if p.limiter != nil && !p.limiter.Allow() {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), util.ErrLimitReached))
+			continue
 		}
-		ev := logvm(v, m).
+		pev := ev.
 			Tag(tagEmail).
 			Fields(log.Context{
-				"email_via":  s.config.SMTPSenderAddr,
-				"email_user": s.config.SMTPSenderUser,
-				"email_to":   to,
+				"email_via": p.Name(),
+				"email_to":  to,
 			})
-		if ev.IsTrace() {
-			ev.Field("email_body", message).Trace("Sending email")
-		} else if ev.IsDebug() {
-			ev.Debug("Sending email")
+		if pev.IsTrace() {
+			pev.Field("email_body", message).Trace("Sending email")
+		} else if pev.IsDebug() {
+			pev.Debug("Sending email")
 		}
-		return smtp.SendMail(s.config.SMTPSenderAddr, auth, s.config.SMTPSenderFrom, []string{to}, []byte(message))
-	})
+		if err := p.Send(s.config.SMTPSenderFrom, to, []byte(message)); err != nil {
+			if len(s.providers) > 1 {
+				pev.Err(err).Warn("Sending email via %s failed, trying next provider", p.Name())
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		return nil
+	}
+	return errors.Join(errs...)
 }
 
-func (s *smtpSender) Counts() (total int64, success int64, failure int64) {
+func (s *mailSender) Counts() (total int64, success int64, failure int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.success + s.failure, s.success, s.failure
 }
 
-func (s *smtpSender) withCount(v *visitor, m *message, fn func() error) error {
+func (s *mailSender) withCount(ev *log.Event, fn func() error) error {
 	err := fn()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if err != nil {
-		logvm(v, m).Err(err).Debug("Sending mail failed")
+		ev.Err(err).Debug("Sending mail failed")
 		s.failure++
 	} else {
 		s.success++
@@ -76,7 +138,7 @@ func (s *smtpSender) withCount(v *visitor, m *message, fn func() error) error {
 	return err
 }
 
-func formatMail(baseURL, senderIP, from, to string, m *message) (string, error) {
+func formatMail(tr *translator, baseURL, senderIP, from, to string, m *message) (string, error) {
 	topicURL := baseURL + "/" + m.Topic
 	subject := m.Title
 	if subject == "" {
@@ -94,7 +156,7 @@ func formatMail(baseURL, senderIP, from, to string, m *message) (string, error)
 			subject = strings.Join(emojis, " ") + " " + subject
 		}
 		if len(tags) > 0 {
-			trailer = "Tags: " + strings.Join(tags, ", ")
+			trailer = tr.T("email.message.tags", "tags", strings.Join(tags, ", "))
 		}
 	}
 	if m.Priority != 0 && m.Priority != 3 {
@@ -105,13 +167,14 @@ func formatMail(baseURL, senderIP, from, to string, m *message) (string, error)
 		if trailer != "" {
 			trailer += "\n"
 		}
-		trailer += fmt.Sprintf("Priority: %s", priority)
+		trailer += tr.T("email.message.priority", "priority", priority)
 	}
 	if trailer != "" {
 		message += "\n\n" + trailer
 	}
 	date := time.Unix(m.Time, 0).UTC().Format(time.RFC1123Z)
 	subject = mime.BEncoding.Encode("utf-8", subject)
+	footer := tr.T("email.message.footer", "ip", senderIP, "time", time.Unix(m.Time, 0).UTC().Format(time.RFC1123), "topicURL", topicURL)
 	body := `From: "{shortTopicURL}" <{from}>
 To: {to}
 Date: {date}
@@ -121,27 +184,78 @@ Content-Type: text/plain; charset="utf-8"
 {message}
 
 --
-This message was sent by {ip} at {time} via {topicURL}`
+{footer}`
 	body = strings.ReplaceAll(body, "{from}", from)
 	body = strings.ReplaceAll(body, "{to}", to)
 	body = strings.ReplaceAll(body, "{date}", date)
 	body = strings.ReplaceAll(body, "{subject}", subject)
-	body = strings.ReplaceAll(body, "{message}", message)
-	body = strings.ReplaceAll(body, "{topicURL}", topicURL)
 	body = strings.ReplaceAll(body, "{shortTopicURL}", util.ShortTopicURL(topicURL))
-	body = strings.ReplaceAll(body, "{time}", time.Unix(m.Time, 0).UTC().Format(time.RFC1123))
-	body = strings.ReplaceAll(body, "{ip}", senderIP)
+	body = strings.ReplaceAll(body, "{footer}", footer)
+	body = strings.ReplaceAll(body, "{message}", message)
 	return body, nil
 }
 
+func formatPasswordResetMail(tr *translator, baseURL, senderIP, from, to, username, link string, expiry time.Duration) string {
+	subject := tr.T("email.password_reset.subject")
+	message := tr.T("email.password_reset.body",
+		"username", username,
+		"link", link,
+		"expiry", util.FormatDuration(expiry),
+		"baseURL", baseURL,
+		"shortBaseURL", util.ShortTopicURL(baseURL),
+		"time", time.Now().UTC().Format(time.RFC1123),
+		"ip", senderIP,
+	)
+	return formatPlainMail(baseURL, from, to, subject, message)
+}
+
+func formatTierExpiryWarningMail(tr *translator, baseURL, from, to, username, tierName string, expires time.Time) string {
+	subject := tr.T("email.tier_expiry.subject", "tier", tierName)
+	message := tr.T("email.tier_expiry.body",
+		"username", username,
+		"tier", tierName,
+		"expires", expires.UTC().Format(time.RFC1123),
+		"baseURL", baseURL,
+		"shortBaseURL", util.ShortTopicURL(baseURL),
+	)
+	return formatPlainMail(baseURL, from, to, subject, message)
+}
+
+func formatPlainMail(baseURL, from, to, subject, message string) string {
+	date := time.Now().UTC().Format(time.RFC1123Z)
+	body := `From: "{shortBaseURL}" <{from}>
+To: {to}
+Date: {date}
+Subject: {subject}
+Content-Type: text/plain; charset="utf-8"
+
+{message}`
+	body = strings.ReplaceAll(body, "{from}", from)
+	body = strings.ReplaceAll(body, "{to}", to)
+	body = strings.ReplaceAll(body, "{date}", date)
+	body = strings.ReplaceAll(body, "{shortBaseURL}", util.ShortTopicURL(baseURL))
+	body = strings.ReplaceAll(body, "{subject}", mime.BEncoding.Encode("utf-8", subject))
+	body = strings.ReplaceAll(body, "{message}", message)
+	return body
+}
+
 var (
 	//go:embed "mailer_emoji_map.json"
 	emojisJSON string
+
+	// loadEmojis parses the emoji map (tag name -> emoji) once, and returns it
+	loadEmojis = sync.OnceValues(func() (map[string]string, error) {
+		var emojiMap map[string]string
+		if err := json.Unmarshal([]byte(emojisJSON), &emojiMap); err != nil {
+			return nil, err
+		}
+		return emojiMap, nil
+	})
 )
 
 func toEmojis(tags []string) (emojisOut []string, tagsOut []string, err error) {
-	var emojiMap map[string]string
-	if err = json.Unmarshal([]byte(emojisJSON), &emojiMap); err != nil {
+	emojiMap, err := loadEmojis()
+	if err != nil {
 		return nil, nil, err
 	}
 	tagsOut = make([]string, 0)
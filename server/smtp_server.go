@@ -33,6 +33,13 @@ var (
 var (
 	onlySpacesRegex          = regexp.MustCompile(`(?m)^\s+$`)
 	consecutiveNewLinesRegex = regexp.MustCompile(`\n{3,}`)
+	mailXPriorityRegex       = regexp.MustCompile(`^\s*([1-5])\b`)
+)
+
+// Formats of HTML emails, see Config.SMTPServerHTMLFormat
+const (
+	SMTPServerHTMLFormatText     = "text"     // Strip all HTML tags
+	SMTPServerHTMLFormatMarkdown = "markdown" // Convert to Markdown, and publish as Markdown message
 )
 
 const (
@@ -150,7 +157,11 @@ func (s *smtpSession) Data(r io.Reader) error {
 		if err != nil {
 			return err
 		}
-		body, err := readMailBody(msg.Body, msg.Header)
+		content, err := readMailBody(msg.Body, msg.Header)
+		if err != nil {
+			return err
+		}
+		body, markdown, err := content.text(conf.SMTPServerHTMLFormat)
 		if err != nil {
 			return err
 		}
@@ -159,6 +170,10 @@ func (s *smtpSession) Data(r io.Reader) error {
 			body = body[:conf.MessageSizeLimit]
 		}
 		m := newDefaultMessage(s.topic, body)
+		m.Priority = mailPriority(msg.Header)
+		if markdown {
+			m.ContentType = "text/markdown"
+		}
 		subject := strings.TrimSpace(msg.Header.Get("Subject"))
 		if subject != "" {
 			dec := mime.WordDecoder{}
@@ -172,7 +187,11 @@ func (s *smtpSession) Data(r io.Reader) error {
 			m.Message = m.Title // Flip them, this makes more sense
 			m.Title = ""
 		}
-		if err := s.publishMessage(m); err != nil {
+		if content.attachment != nil && conf.AttachmentCacheDir == "" {
+			ev.Debug("Ignoring email attachment %s, attachments are disabled", content.attachment.name)
+			content.attachment = nil
+		}
+		if err := s.publishMessage(m, content.attachment); err != nil {
 			return err
 		}
 		s.backend.mu.Lock()
@@ -183,7 +202,9 @@ func (s *smtpSession) Data(r io.Reader) error {
 	})
 }
 
-func (s *smtpSession) publishMessage(m *message) error {
+// publishMessage publishes the message by calling the HTTP handler. If the email had an attachment, it is
+// uploaded as the request body, and the message text is passed in the Message header.
+func (s *smtpSession) publishMessage(m *message, a *mailAttachment) error {
 	// Extract remote address (for rate limiting)
 	remoteAddr, _, err := net.SplitHostPort(s.conn.Conn().RemoteAddr().String())
 	if err != nil {
@@ -191,7 +212,11 @@ func (s *smtpSession) publishMessage(m *message) error {
 	}
 	// Call HTTP handler with fake HTTP request
 	url := fmt.Sprintf("%s/%s", s.backend.config.BaseURL, m.Topic)
-	req, err := http.NewRequest("POST", url, strings.NewReader(m.Message))
+	body := io.Reader(strings.NewReader(m.Message))
+	if a != nil {
+		body = bytes.NewReader(a.data)
+	}
+	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
 		return err
 	}
@@ -201,6 +226,18 @@ func (s *smtpSession) publishMessage(m *message) error {
 	if m.Title != "" {
 		req.Header.Set("Title", m.Title)
 	}
+	if m.Priority != 0 {
+		req.Header.Set("Priority", fmt.Sprintf("%d", m.Priority))
+	}
+	if m.ContentType == "text/markdown" {
+		req.Header.Set("Markdown", "yes")
+	}
+	if a != nil {
+		req.Header.Set("Filename", a.name)
+		if m.Message != "" {
+			req.Header.Set("Message", m.Message)
+		}
+	}
 	if s.token != "" {
 		req.Header.Add("Authorization", "Bearer "+s.token)
 	} else if s.basicAuth != "" {
@@ -241,36 +278,71 @@ func (s *smtpSession) withFailCount(fn func() error) error {
 	return err
 }
 
-func readMailBody(body io.Reader, header mail.Header) (string, error) {
+// mailBody is the parsed body of an incoming email, see readMailBody
+type mailBody struct {
+	parts      map[string]string // Decoded text parts, keyed by content type (text/plain or text/html)
+	attachment *mailAttachment   // First attachment of the email, if any (a message can only have one attachment)
+}
+
+// mailAttachment is a file attached to an incoming email
+type mailAttachment struct {
+	name string
+	data []byte
+}
+
+// text returns the message text of the email. The plain text part is preferred over the HTML part, unless
+// HTML is to be converted to Markdown (see Config.SMTPServerHTMLFormat), in which case markdown is true.
+func (b *mailBody) text(htmlFormat string) (text string, markdown bool, err error) {
+	plain, hasPlain := b.parts["text/plain"]
+	html, hasHTML := b.parts["text/html"]
+	if hasHTML && htmlFormat == SMTPServerHTMLFormatMarkdown {
+		text, err := htmlToMarkdown(html)
+		if err != nil {
+			return "", false, err
+		}
+		return text, true, nil
+	} else if hasPlain {
+		return plain, false, nil
+	} else if hasHTML {
+		return stripHTML(html), false, nil
+	}
+	return "", false, nil
+}
+
+func readMailBody(body io.Reader, header mail.Header) (*mailBody, error) {
+	b := &mailBody{parts: make(map[string]string)}
 	if header.Get("Content-Type") == "" {
-		return readPlainTextMailBody(body, header.Get("Content-Transfer-Encoding"))
+		s, err := readPlainTextMailBody(body, header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return nil, err
+		}
+		b.parts["text/plain"] = s
+		return b, nil
 	}
 	contentType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	canonicalContentType := strings.ToLower(contentType)
 	if canonicalContentType == "text/plain" || canonicalContentType == "text/html" {
-		return readTextMailBody(body, canonicalContentType, header.Get("Content-Transfer-Encoding"))
+		s, err := readPlainTextMailBody(body, header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return nil, err
+		}
+		b.parts[canonicalContentType] = s
+		return b, nil
 	} else if strings.HasPrefix(canonicalContentType, "multipart/") {
-		return readMultipartMailBody(body, params)
-	}
-	return "", errUnsupportedContentType
-}
-
-func readMultipartMailBody(body io.Reader, params map[string]string) (string, error) {
-	parts := make(map[string]string)
-	if err := readMultipartMailBodyParts(body, params, 0, parts); err != nil && err != io.EOF {
-		return "", err
-	} else if s, ok := parts["text/plain"]; ok {
-		return s, nil
-	} else if s, ok := parts["text/html"]; ok {
-		return s, nil
+		if err := readMultipartMailBodyParts(body, params, 0, b); err != nil && err != io.EOF {
+			return nil, err
+		} else if len(b.parts) == 0 && b.attachment == nil {
+			return nil, io.EOF
+		}
+		return b, nil
 	}
-	return "", io.EOF
+	return nil, errUnsupportedContentType
 }
 
-func readMultipartMailBodyParts(body io.Reader, params map[string]string, depth int, parts map[string]string) error {
+func readMultipartMailBodyParts(body io.Reader, params map[string]string, depth int, b *mailBody) error {
 	if depth >= maxMultipartDepth {
 		return errMultipartNestedTooDeep
 	}
@@ -285,14 +357,27 @@ func readMultipartMailBodyParts(body io.Reader, params map[string]string, depth
 			return err
 		}
 		canonicalPartContentType := strings.ToLower(partContentType)
-		if canonicalPartContentType == "text/plain" || canonicalPartContentType == "text/html" {
-			s, err := readTextMailBody(part, canonicalPartContentType, part.Header.Get("Content-Transfer-Encoding"))
+		if isMailAttachment(part, canonicalPartContentType, partParams) {
+			if b.attachment != nil {
+				continue // Only the first attachment is kept
+			}
+			a, err := readMailAttachment(part, partParams)
+			if err != nil {
+				return err
+			}
+			if len(a.data) > 0 {
+				b.attachment = a
+			}
+		} else if canonicalPartContentType == "text/plain" || canonicalPartContentType == "text/html" {
+			s, err := readPlainTextMailBody(part, part.Header.Get("Content-Transfer-Encoding"))
 			if err != nil {
 				return err
 			}
-			parts[canonicalPartContentType] = s
-		} else if strings.HasPrefix(strings.ToLower(partContentType), "multipart/") {
-			if err := readMultipartMailBodyParts(part, partParams, depth+1, parts); err != nil {
+			if _, ok := b.parts[canonicalPartContentType]; !ok {
+				b.parts[canonicalPartContentType] = s // The first part wins, later parts may be footers (e.g. mailing lists)
+			}
+		} else if strings.HasPrefix(canonicalPartContentType, "multipart/") {
+			if err := readMultipartMailBodyParts(part, partParams, depth+1, b); err != nil && err != io.EOF {
 				return err
 			}
 		}
@@ -300,38 +385,80 @@ func readMultipartMailBodyParts(body io.Reader, params map[string]string, depth
 	}
 }
 
-func readTextMailBody(reader io.Reader, contentType, transferEncoding string) (string, error) {
-	if contentType == "text/plain" {
-		return readPlainTextMailBody(reader, transferEncoding)
-	} else if contentType == "text/html" {
-		return readHTMLMailBody(reader, transferEncoding)
+// isMailAttachment returns true if the multipart part is a file attachment, i.e. if it is explicitly marked
+// as an attachment, or if it has a file name and is not a text or multipart part (e.g. an inline image)
+func isMailAttachment(part *multipart.Part, contentType string, params map[string]string) bool {
+	disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if strings.ToLower(disposition) == "attachment" {
+		return true
 	}
-	return "", fmt.Errorf("unsupported content type: %s", contentType)
+	isTextOrMultipart := contentType == "text/plain" || contentType == "text/html" || strings.HasPrefix(contentType, "multipart/")
+	hasFileName := part.FileName() != "" || params["name"] != ""
+	return hasFileName && !isTextOrMultipart
 }
 
-func readPlainTextMailBody(reader io.Reader, transferEncoding string) (string, error) {
-	if strings.ToLower(transferEncoding) == "base64" {
-		reader = base64.NewDecoder(base64.StdEncoding, reader)
-	} else if strings.ToLower(transferEncoding) == "quoted-printable" {
-		reader = quotedprintable.NewReader(reader)
+func readMailAttachment(part *multipart.Part, params map[string]string) (*mailAttachment, error) {
+	name := part.FileName()
+	if name == "" {
+		name = params["name"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = decoded
 	}
-	body, err := io.ReadAll(reader)
+	if name == "" {
+		name = "attachment"
+	}
+	data, err := io.ReadAll(newMailBodyDecoder(part, part.Header.Get("Content-Transfer-Encoding")))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return string(body), nil
+	return &mailAttachment{name: name, data: data}, nil
 }
 
-func readHTMLMailBody(reader io.Reader, transferEncoding string) (string, error) {
-	body, err := readPlainTextMailBody(reader, transferEncoding)
+func readPlainTextMailBody(reader io.Reader, transferEncoding string) (string, error) {
+	body, err := io.ReadAll(newMailBodyDecoder(reader, transferEncoding))
 	if err != nil {
 		return "", err
 	}
+	return string(body), nil
+}
+
+func newMailBodyDecoder(reader io.Reader, transferEncoding string) io.Reader {
+	if strings.ToLower(transferEncoding) == "base64" {
+		return base64.NewDecoder(base64.StdEncoding, reader)
+	} else if strings.ToLower(transferEncoding) == "quoted-printable" {
+		return quotedprintable.NewReader(reader)
+	}
+	return reader
+}
+
+func stripHTML(body string) string {
 	stripped := bluemonday.
 		StrictPolicy().
 		AddSpaceWhenStrippingTag(true).
 		Sanitize(body)
-	return removeExtraEmptyLines(stripped), nil
+	return removeExtraEmptyLines(stripped)
+}
+
+// mailPriority returns the message priority of an incoming email, based on the X-Priority, Importance
+// and Priority headers, or 0 (default priority) if none of these headers is set
+func mailPriority(header mail.Header) int {
+	if m := mailXPriorityRegex.FindStringSubmatch(header.Get("X-Priority")); m != nil {
+		return 6 - int(m[1][0]-'0') // "1 (Highest)" is the most important in emails, 5 is the most important in ntfy
+	}
+	switch strings.ToLower(strings.TrimSpace(header.Get("Importance"))) {
+	case "high":
+		return 4
+	case "low":
+		return 2
+	}
+	switch strings.ToLower(strings.TrimSpace(header.Get("Priority"))) {
+	case "urgent":
+		return 5
+	case "non-urgent":
+		return 2
+	}
+	return 0
 }
 
 func removeExtraEmptyLines(s string) string {
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	markdownWhitespaceRegex = regexp.MustCompile(`\s+`)
+	markdownLinkSchemeRegex = regexp.MustCompile(`^(?i)(https?|mailto):`)
+)
+
+// htmlToMarkdown converts the HTML body of an incoming email to Markdown. Only the elements that are
+// common in emails are converted (headings, paragraphs, emphasis, links, lists, quotes, code), all other
+// tags are stripped, and scripts, styles and images are dropped entirely.
+func htmlToMarkdown(s string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	w := &markdownWriter{}
+	w.writeNode(doc)
+	return strings.TrimSpace(removeExtraEmptyLines(w.buf.String())), nil
+}
+
+// markdownWriter renders an HTML node tree as Markdown, see htmlToMarkdown
+type markdownWriter struct {
+	buf    bytes.Buffer
+	lists  []int // Stack of open lists, with the next item number for ordered lists, or -1 for unordered lists
+	pre    bool  // Inside a <pre> element, whitespace is preserved
+	inline bool  // Rendering the children of an inline element that does not start at the beginning of a line
+}
+
+func (w *markdownWriter) writeNode(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.writeText(n.Data)
+		return
+	case html.ElementNode:
+		// Handled below
+	default:
+		w.writeChildren(n)
+		return
+	}
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Title, atom.Img:
+		// Skip entirely
+	case atom.Br:
+		w.trimTrailingSpaces()
+		w.write("  \n") // Hard line break
+	case atom.Hr:
+		w.block()
+		w.write("---")
+		w.block()
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.block()
+		w.write(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+		w.writeChildren(n)
+		w.block()
+	case atom.P, atom.Div, atom.Table, atom.Section, atom.Article, atom.Header, atom.Footer:
+		w.block()
+		w.writeChildren(n)
+		w.block()
+	case atom.Tr:
+		w.newline()
+		w.writeChildren(n)
+		w.newline()
+	case atom.Td, atom.Th:
+		w.write(" ")
+		w.writeChildren(n)
+		w.write(" ")
+	case atom.B, atom.Strong:
+		w.writeWrapped(n, "**")
+	case atom.I, atom.Em:
+		w.writeWrapped(n, "_")
+	case atom.Code:
+		if w.pre {
+			w.writeChildren(n)
+		} else {
+			w.writeWrapped(n, "`")
+		}
+	case atom.Pre:
+		w.block()
+		w.write("```\n")
+		w.pre = true
+		w.writeChildren(n)
+		w.pre = false
+		w.newline()
+		w.write("```")
+		w.block()
+	case atom.A:
+		w.writeLink(n)
+	case atom.Ul, atom.Ol:
+		next := -1
+		if n.DataAtom == atom.Ol {
+			next = 1
+		}
+		if len(w.lists) == 0 {
+			w.block()
+		} else {
+			w.newline()
+		}
+		w.lists = append(w.lists, next)
+		w.writeChildren(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		if len(w.lists) == 0 {
+			w.block()
+		}
+	case atom.Li:
+		w.writeListItem(n)
+	case atom.Blockquote:
+		w.writeBlockquote(n)
+	default:
+		w.writeChildren(n)
+	}
+}
+
+func (w *markdownWriter) writeChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.writeNode(c)
+	}
+}
+
+func (w *markdownWriter) writeText(s string) {
+	if w.pre {
+		w.write(s)
+		return
+	}
+	s = markdownWhitespaceRegex.ReplaceAllString(s, " ")
+	if w.atLineStart() {
+		s = strings.TrimLeft(s, " ")
+	}
+	w.write(s)
+}
+
+// writeWrapped writes the children of n, surrounded by the given Markdown marker, e.g. "**" for bold text.
+// Markers are placed around the text without surrounding whitespace, since "** bold**" is not bold in Markdown.
+func (w *markdownWriter) writeWrapped(n *html.Node, marker string) {
+	inner := w.render(n)
+	trimmed := strings.TrimSpace(inner)
+	if trimmed == "" {
+		w.writeText(inner)
+		return
+	}
+	if strings.HasPrefix(inner, " ") && !w.atLineStart() && !bytes.HasSuffix(w.buf.Bytes(), []byte(" ")) {
+		w.write(" ")
+	}
+	w.write(marker + trimmed + marker)
+	if strings.HasSuffix(inner, " ") {
+		w.write(" ")
+	}
+}
+
+func (w *markdownWriter) writeLink(n *html.Node) {
+	href := ""
+	for _, attr := range n.Attr {
+		if attr.Key == "href" {
+			href = strings.TrimSpace(attr.Val)
+		}
+	}
+	text := strings.TrimSpace(w.render(n))
+	if !markdownLinkSchemeRegex.MatchString(href) {
+		w.writeText(text) // Relative links and javascript: links are useless in a notification
+	} else if text == "" || text == href || "mailto:"+text == href {
+		w.write(href)
+	} else {
+		w.write(fmt.Sprintf("[%s](%s)", text, href))
+	}
+}
+
+func (w *markdownWriter) writeListItem(n *html.Node) {
+	w.newline()
+	depth := len(w.lists)
+	marker := "- "
+	if depth > 0 && w.lists[depth-1] > 0 {
+		marker = fmt.Sprintf("%d. ", w.lists[depth-1])
+		w.lists[depth-1]++
+	}
+	if depth > 1 {
+		w.write(strings.Repeat("  ", depth-1))
+	}
+	w.write(marker)
+	w.writeChildren(n)
+	w.newline()
+}
+
+func (w *markdownWriter) writeBlockquote(n *html.Node) {
+	quoted := strings.TrimSpace(w.render(n))
+	if quoted == "" {
+		return
+	}
+	w.block()
+	lines := strings.Split(removeExtraEmptyLines(quoted), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	w.write(strings.Join(lines, "\n"))
+	w.block()
+}
+
+// render renders the children of n with a separate writer, so that the result can be post-processed,
+// e.g. to wrap it in Markdown markers
+func (w *markdownWriter) render(n *html.Node) string {
+	inner := &markdownWriter{lists: w.lists, pre: w.pre, inline: !w.atLineStart()}
+	inner.writeChildren(n)
+	return inner.buf.String()
+}
+
+func (w *markdownWriter) write(s string) {
+	w.buf.WriteString(s)
+}
+
+// newline starts a new line, unless the writer is already at the start of a line
+func (w *markdownWriter) newline() {
+	if !w.atLineStart() {
+		w.trimTrailingSpaces()
+		w.write("\n")
+	}
+}
+
+// block separates block elements by an empty line. Extra empty lines are removed in htmlToMarkdown.
+func (w *markdownWriter) block() {
+	if w.buf.Len() > 0 {
+		w.trimTrailingSpaces()
+		w.write("\n\n")
+	}
+}
+
+func (w *markdownWriter) trimTrailingSpaces() {
+	w.buf.Truncate(len(bytes.TrimRight(w.buf.Bytes(), " ")))
+}
+
+func (w *markdownWriter) atLineStart() bool {
+	b := bytes.TrimRight(w.buf.Bytes(), " ")
+	if len(b) == 0 {
+		return !w.inline
+	}
+	return b[len(b)-1] == '\n'
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/mail"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -1408,6 +1410,202 @@ what's up
 	writeAndReadUntilLine(t, email, c, scanner, "250 2.0.0 OK: queued")
 }
 
+func TestSmtpBackend_MultipartWithAttachment(t *testing.T) {
+	email := `EHLO example.com
+MAIL FROM: phil@example.com
+RCPT TO: ntfy-mytopic@ntfy.sh
+DATA
+MIME-Version: 1.0
+Subject: Backup report
+From: Phil <phil@example.com>
+To: ntfy-mytopic@ntfy.sh
+Content-Type: multipart/mixed; boundary="mixedboundary"
+
+--mixedboundary
+Content-Type: multipart/alternative; boundary="altboundary"
+
+--altboundary
+Content-Type: text/plain; charset="UTF-8"
+
+Backup completed,
+see attached log
+
+--altboundary
+Content-Type: text/html; charset="UTF-8"
+
+<div>Backup completed, see attached log</div>
+
+--altboundary--
+
+--mixedboundary
+Content-Type: text/plain; name="backup.log"
+Content-Disposition: attachment; filename="backup.log"
+Content-Transfer-Encoding: base64
+
+YmFja3VwIGxvZyBjb250ZW50cw==
+
+--mixedboundary
+Content-Type: image/png; name="second.png"
+Content-Disposition: attachment; filename="second.png"
+Content-Transfer-Encoding: base64
+
+iVBORw0KGgo=
+
+--mixedboundary--
+.
+`
+	s, c, _, scanner := newTestSMTPServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/mytopic", r.URL.Path)
+		require.Equal(t, "Backup report", r.Header.Get("Title"))
+		require.Equal(t, "backup.log", r.Header.Get("Filename"))
+		require.Equal(t, "Backup completed,\nsee attached log", r.Header.Get("Message"))
+		require.Equal(t, "backup log contents", readAll(t, r.Body))
+	})
+	defer s.Close()
+	defer c.Close()
+	writeAndReadUntilLine(t, email, c, scanner, "250 2.0.0 OK: queued")
+}
+
+func TestSmtpBackend_AttachmentOnly_RealServer(t *testing.T) {
+	email := `EHLO example.com
+MAIL FROM: phil@example.com
+RCPT TO: ntfy-mytopic@ntfy.sh
+DATA
+MIME-Version: 1.0
+Subject: Camera snapshot
+X-Priority: 1 (Highest)
+Content-Type: multipart/mixed; boundary="mixedboundary"
+
+--mixedboundary
+Content-Type: image/jpeg; name="=?UTF-8?B?ZnJvbnQtZG9vci5qcGc=?="
+Content-Transfer-Encoding: base64
+
+/9j/4AAQSkZJRgABAQ==
+
+--mixedboundary--
+.
+`
+	var srv *Server
+	s, c, conf, scanner := newTestSMTPServer(t, func(w http.ResponseWriter, r *http.Request) {
+		srv.handle(w, r)
+	})
+	srv = newTestServer(t, conf)
+	defer s.Close()
+	defer c.Close()
+	writeAndReadUntilLine(t, email, c, scanner, "250 2.0.0 OK: queued")
+
+	response := request(t, srv, "GET", "/mytopic/json?poll=1", "", nil)
+	m := toMessage(t, response.Body.String())
+	require.Equal(t, "Camera snapshot", m.Message) // Subject is used as message
+	require.Equal(t, "", m.Title)
+	require.Equal(t, 5, m.Priority)
+	require.NotNil(t, m.Attachment)
+	require.Equal(t, "front-door.jpg", m.Attachment.Name)
+	require.Equal(t, int64(13), m.Attachment.Size)
+	require.Equal(t, "image/jpeg", m.Attachment.Type)
+	require.FileExists(t, filepath.Join(conf.AttachmentCacheDir, m.ID))
+}
+
+func TestSmtpBackend_Attachment_AttachmentsDisabled(t *testing.T) {
+	email := `EHLO example.com
+MAIL FROM: phil@example.com
+RCPT TO: ntfy-mytopic@ntfy.sh
+DATA
+Subject: Report
+Content-Type: multipart/mixed; boundary="mixedboundary"
+
+--mixedboundary
+Content-Type: text/plain; charset="UTF-8"
+
+See attachment
+
+--mixedboundary
+Content-Type: application/pdf; name="report.pdf"
+Content-Disposition: attachment; filename="report.pdf"
+Content-Transfer-Encoding: base64
+
+JVBERi0xLjQ=
+
+--mixedboundary--
+.
+`
+	s, c, conf, scanner := newTestSMTPServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "", r.Header.Get("Filename"))
+		require.Equal(t, "See attachment", readAll(t, r.Body))
+	})
+	conf.AttachmentCacheDir = ""
+	defer s.Close()
+	defer c.Close()
+	writeAndReadUntilLine(t, email, c, scanner, "250 2.0.0 OK: queued")
+}
+
+func TestSmtpBackend_HTMLEmail_Markdown(t *testing.T) {
+	email := `EHLO example.com
+MAIL FROM: phil@example.com
+RCPT TO: ntfy-mytopic@ntfy.sh
+DATA
+Subject: Build failed
+Importance: high
+Content-Type: multipart/alternative; boundary="altboundary"
+
+--altboundary
+Content-Type: text/plain; charset="UTF-8"
+
+Build #42 failed
+
+--altboundary
+Content-Type: text/html; charset="UTF-8"
+Content-Transfer-Encoding: quoted-printable
+
+<html><head><style>p { color: red; }</style></head><body>
+<h2>Build #42 failed</h2>
+<p>The <b>test</b> stage failed, see <a href=3D"https://ci.example.com/42">the logs</a>.</p>
+<ul><li>TestFoo</li><li>TestBar &amp; TestBaz</li></ul>
+</body></html>
+
+--altboundary--
+.
+`
+	s, c, conf, scanner := newTestSMTPServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Build failed", r.Header.Get("Title"))
+		require.Equal(t, "4", r.Header.Get("Priority"))
+		require.Equal(t, "yes", r.Header.Get("Markdown"))
+		require.Equal(t, "## Build #42 failed\n\nThe **test** stage failed, see [the logs](https://ci.example.com/42).\n\n- TestFoo\n- TestBar & TestBaz", readAll(t, r.Body))
+	})
+	conf.SMTPServerHTMLFormat = SMTPServerHTMLFormatMarkdown
+	defer s.Close()
+	defer c.Close()
+	writeAndReadUntilLine(t, email, c, scanner, "250 2.0.0 OK: queued")
+}
+
+func TestSmtpBackend_MailPriority(t *testing.T) {
+	require.Equal(t, 5, mailPriority(mail.Header{"X-Priority": {"1 (Highest)"}}))
+	require.Equal(t, 4, mailPriority(mail.Header{"X-Priority": {"2"}}))
+	require.Equal(t, 3, mailPriority(mail.Header{"X-Priority": {"3 (Normal)"}}))
+	require.Equal(t, 1, mailPriority(mail.Header{"X-Priority": {"5 (Lowest)"}}))
+	require.Equal(t, 2, mailPriority(mail.Header{"Importance": {"Low"}}))
+	require.Equal(t, 4, mailPriority(mail.Header{"Importance": {"high"}}))
+	require.Equal(t, 5, mailPriority(mail.Header{"Priority": {"urgent"}}))
+	require.Equal(t, 2, mailPriority(mail.Header{"Priority": {"non-urgent"}}))
+	require.Equal(t, 5, mailPriority(mail.Header{"X-Priority": {"1"}, "Importance": {"low"}})) // X-Priority wins
+	require.Equal(t, 0, mailPriority(mail.Header{"Importance": {"normal"}}))
+	require.Equal(t, 0, mailPriority(mail.Header{"X-Priority": {"urgent"}}))
+	require.Equal(t, 0, mailPriority(mail.Header{}))
+}
+
+func TestHTMLToMarkdown(t *testing.T) {
+	markdown, err := htmlToMarkdown(`<p>Hello <i>there</i>,<br>second line</p>
+<blockquote><p>quoted <strong> bold </strong>text</p></blockquote>
+<ol><li>one</li><li>two<ul><li>nested</li></ul></li></ol>
+<pre><code>line 1
+  line 2</code></pre>
+<p><a href="mailto:phil@example.com">phil@example.com</a> <a href="/relative">relative</a> <img src="https://example.com/pixel.gif" alt="pixel"></p>
+<script>alert("hi")</script>`)
+	require.Nil(t, err)
+	expected := "Hello _there_,  \nsecond line\n\n> quoted **bold** text\n\n1. one\n2. two\n  - nested\n\n```\nline 1\n  line 2\n```\n\nmailto:phil@example.com relative"
+	require.Equal(t, expected, markdown)
+}
+
 type smtpHandlerFunc func(http.ResponseWriter, *http.Request)
 
 func newTestSMTPServer(t *testing.T, handler smtpHandlerFunc) (s *smtp.Server, c net.Conn, conf *Config, scanner *bufio.Scanner) {
@@ -0,0 +1,537 @@
+package server
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"heckel.io/ntfy/v2/log"
+)
+
+// The SNMP trap listener accepts SNMPv1 and SNMPv2c traps via UDP, and publishes them as messages, so that legacy
+// infrastructure monitoring (UPSes, PDUs, switches, ...) can notify humans. Traps are mapped to topics via trap rules
+// (see ParseSNMPTrapRule), which match the trap OID, community and sender. The first matching rule wins; traps that
+// match no rule are dropped. The trap OID is translated to a title via the OID name table (see
+// ParseSNMPTrapOIDNames), and each variable binding is added to the message as "<name> = <value>".
+//
+// Traps are decoded with a minimal BER decoder, since only a small part of SNMP is needed. SNMPv3 traps and
+// inform requests (which require a response) are not supported.
+
+const (
+	snmpVersion1  = 0
+	snmpVersion2c = 1
+
+	berTagInteger     = 0x02
+	berTagOctetString = 0x04
+	berTagNull        = 0x05
+	berTagOID         = 0x06
+	berTagSequence    = 0x30
+	berTagIPAddress   = 0x40
+	berTagCounter32   = 0x41
+	berTagGauge32     = 0x42
+	berTagTimeTicks   = 0x43
+	berTagCounter64   = 0x46
+	berTagNoSuchObj   = 0x80
+	berTagNoSuchInst  = 0x81
+	berTagEndOfMIB    = 0x82
+	snmpTagTrapV1     = 0xa4
+	snmpTagTrapV2     = 0xa7
+	snmpMaxOIDLength  = 128
+	snmpSysUpTimeOID  = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOIDOID    = "1.3.6.1.6.3.1.1.4.1.0"
+	snmpStdTrapPrefix = "1.3.6.1.6.3.1.1.5" // Generic traps, see RFC 3584, section 3.1
+)
+
+var (
+	snmpTrapRuleRegex = regexp.MustCompile(`^(\S+)((?:\s+[-a-z]+=\S+)*)\s*$`)
+	snmpOIDRegex      = regexp.MustCompile(`^\.?([0-2](?:\.\d+)+)$`)
+)
+
+var (
+	errSNMPInvalidPacket      = errors.New("invalid SNMP packet")
+	errSNMPUnsupportedVersion = errors.New("unsupported SNMP version, only v1 and v2c are supported")
+	errSNMPUnsupportedPDU     = errors.New("unsupported SNMP PDU, only traps are supported")
+)
+
+// snmpDefaultOIDNames are the names of the generic traps (RFC 3418) and of common variables, used in addition to
+// the names configured in SNMPTrapOIDNames
+var snmpDefaultOIDNames = map[string]string{
+	"1.3.6.1.6.3.1.1.5.1":     "coldStart",
+	"1.3.6.1.6.3.1.1.5.2":     "warmStart",
+	"1.3.6.1.6.3.1.1.5.3":     "linkDown",
+	"1.3.6.1.6.3.1.1.5.4":     "linkUp",
+	"1.3.6.1.6.3.1.1.5.5":     "authenticationFailure",
+	"1.3.6.1.6.3.1.1.5.6":     "egpNeighborLoss",
+	"1.3.6.1.2.1.1.5":         "sysName",
+	"1.3.6.1.2.1.2.2.1.1":     "ifIndex",
+	"1.3.6.1.2.1.2.2.1.2":     "ifDescr",
+	"1.3.6.1.2.1.2.2.1.7":     "ifAdminStatus",
+	"1.3.6.1.2.1.2.2.1.8":     "ifOperStatus",
+	"1.3.6.1.2.1.31.1.1.1.1":  "ifName",
+	"1.3.6.1.2.1.31.1.1.1.18": "ifAlias",
+}
+
+// SNMPTrapRule maps SNMP traps to a topic, see ParseSNMPTrapRule
+type SNMPTrapRule struct {
+	Topic     string
+	OIDs      []string       // Trap OIDs (or prefixes) the rule matches, all traps if empty
+	Community string         // Community the rule matches, all communities if empty
+	From      []netip.Prefix // Sender IP addresses the rule matches, all senders if empty
+	Priority  int            // Message priority, default priority if zero
+	Token     string         // Access token used to publish to the topic, if the topic is protected
+}
+
+// ParseSNMPTrapRule parses an entry of the snmp-trap-rules option. Entries have the format
+// "<topic> [key=value ...]", e.g. "ups oid=1.3.6.1.4.1.318 community=public from=10.0.0.0/8 priority=5".
+//
+// Supported keys:
+//   - oid=<oid>[,...]: the trap OIDs, or OID prefixes (e.g. an enterprise OID), default: all
+//   - community=<community>: the community string, default: all
+//   - from=<ip|cidr>[,...]: the sender IP addresses or ranges, default: all
+//   - priority=<1-5>: the message priority, default: 3
+//   - token=<token>: the access token used to publish, if the topic is protected
+func ParseSNMPTrapRule(spec string) (*SNMPTrapRule, error) {
+	m := snmpTrapRuleRegex.FindStringSubmatch(strings.TrimSpace(spec))
+	if m == nil || !topicRegex.MatchString(m[1]) {
+		return nil, fmt.Errorf(`invalid SNMP trap rule "%s", must be "<topic> [key=value ...]"`, spec)
+	}
+	rule := &SNMPTrapRule{
+		Topic: m[1],
+	}
+	for _, option := range strings.Fields(m[2]) {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "oid":
+			for _, oid := range strings.Split(value, ",") {
+				om := snmpOIDRegex.FindStringSubmatch(oid)
+				if om == nil {
+					return nil, fmt.Errorf(`invalid SNMP trap rule "%s", oid must be a numeric OID, e.g. 1.3.6.1.4.1.318`, spec)
+				}
+				rule.OIDs = append(rule.OIDs, om[1])
+			}
+		case "community":
+			rule.Community = value
+		case "from":
+			for _, from := range strings.Split(value, ",") {
+				prefix, err := parseIPPrefixOrAddr(from)
+				if err != nil {
+					return nil, fmt.Errorf(`invalid SNMP trap rule "%s", from must be an IP address or range, e.g. 10.0.0.0/8`, spec)
+				}
+				rule.From = append(rule.From, prefix)
+			}
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil || priority < 1 || priority > 5 {
+				return nil, fmt.Errorf(`invalid SNMP trap rule "%s", priority must be between 1 and 5`, spec)
+			}
+			rule.Priority = priority
+		case "token":
+			rule.Token = value
+		default:
+			return nil, fmt.Errorf(`invalid SNMP trap rule "%s", unknown option "%s"`, spec, key)
+		}
+	}
+	return rule, nil
+}
+
+// ParseSNMPTrapOIDNames parses the entries of the snmp-trap-oid-names option. Entries have the format
+// "<oid>=<name>", e.g. "1.3.6.1.4.1.318.0.5=UPS on battery". Names are used as message title for trap OIDs, and
+// as variable names in the message body. OIDs that are not in the table are translated via their longest prefix
+// in the table, e.g. 1.3.6.1.2.1.2.2.1.1.3 to "ifIndex.3".
+func ParseSNMPTrapOIDNames(specs []string) (map[string]string, error) {
+	names := make(map[string]string)
+	for _, spec := range specs {
+		oid, name, ok := strings.Cut(spec, "=")
+		om := snmpOIDRegex.FindStringSubmatch(strings.TrimSpace(oid))
+		if !ok || om == nil || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf(`invalid SNMP OID name "%s", must be "<oid>=<name>", e.g. "1.3.6.1.4.1.318.0.5=UPS on battery"`, spec)
+		}
+		names[om[1]] = strings.TrimSpace(name)
+	}
+	return names, nil
+}
+
+// matches returns true if the rule matches the given trap and sender
+func (r *SNMPTrapRule) matches(trap *snmpTrap, from netip.Addr) bool {
+	if r.Community != "" && r.Community != trap.community {
+		return false
+	}
+	if len(r.OIDs) > 0 {
+		matched := false
+		for _, oid := range r.OIDs {
+			if trap.oid == oid || strings.HasPrefix(trap.oid, oid+".") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return prefixesContain(r.From, from)
+}
+
+// snmpTrap is a decoded SNMP trap, see parseSNMPTrap
+type snmpTrap struct {
+	version   int
+	community string
+	oid       string     // Trap OID; for v1 traps, translated as per RFC 3584, section 3.1
+	agent     netip.Addr // Agent address of v1 traps, invalid for v2c traps
+	variables []*snmpVariable
+}
+
+// snmpVariable is a variable binding of a trap
+type snmpVariable struct {
+	oid   string
+	value string
+}
+
+// parseSNMPTrap decodes an SNMPv1 or SNMPv2c trap
+func parseSNMPTrap(b []byte) (*snmpTrap, error) {
+	tag, message, _, err := readBER(b)
+	if err != nil || tag != berTagSequence {
+		return nil, errSNMPInvalidPacket
+	}
+	version, message, err := readBERInteger(message)
+	if err != nil {
+		return nil, err
+	} else if version != snmpVersion1 && version != snmpVersion2c {
+		return nil, errSNMPUnsupportedVersion
+	}
+	tag, community, message, err := readBER(message)
+	if err != nil || tag != berTagOctetString {
+		return nil, errSNMPInvalidPacket
+	}
+	tag, pdu, _, err := readBER(message)
+	if err != nil {
+		return nil, err
+	}
+	trap := &snmpTrap{
+		version:   int(version),
+		community: string(community),
+	}
+	switch {
+	case version == snmpVersion1 && tag == snmpTagTrapV1:
+		err = trap.parseV1(pdu)
+	case version == snmpVersion2c && tag == snmpTagTrapV2:
+		err = trap.parseV2(pdu)
+	default:
+		return nil, errSNMPUnsupportedPDU
+	}
+	if err != nil {
+		return nil, err
+	}
+	return trap, nil
+}
+
+// parseV1 decodes a Trap-PDU: enterprise, agent-addr, generic-trap, specific-trap, time-stamp, variable-bindings
+func (t *snmpTrap) parseV1(pdu []byte) error {
+	tag, enterprise, pdu, err := readBER(pdu)
+	if err != nil || tag != berTagOID {
+		return errSNMPInvalidPacket
+	}
+	tag, agent, pdu, err := readBER(pdu)
+	if err != nil || tag != berTagIPAddress {
+		return errSNMPInvalidPacket
+	}
+	if addr, ok := netip.AddrFromSlice(agent); ok && !addr.IsUnspecified() {
+		t.agent = addr
+	}
+	generic, pdu, err := readBERInteger(pdu)
+	if err != nil {
+		return err
+	}
+	specific, pdu, err := readBERInteger(pdu)
+	if err != nil {
+		return err
+	}
+	if _, _, pdu, err = readBER(pdu); err != nil { // time-stamp
+		return err
+	}
+	enterpriseOID, err := decodeOID(enterprise)
+	if err != nil {
+		return err
+	}
+	if generic >= 0 && generic < 6 {
+		t.oid = fmt.Sprintf("%s.%d", snmpStdTrapPrefix, generic+1)
+	} else {
+		t.oid = fmt.Sprintf("%s.0.%d", enterpriseOID, specific)
+	}
+	t.variables, err = readSNMPVariables(pdu)
+	return err
+}
+
+// parseV2 decodes an SNMPv2-Trap-PDU: request-id, error-status, error-index, variable-bindings. The trap
+// OID is the value of the snmpTrapOID.0 variable.
+func (t *snmpTrap) parseV2(pdu []byte) error {
+	for i := 0; i < 3; i++ {
+		var err error
+		if _, pdu, err = readBERInteger(pdu); err != nil {
+			return err
+		}
+	}
+	variables, err := readSNMPVariables(pdu)
+	if err != nil {
+		return err
+	}
+	for _, v := range variables {
+		if v.oid == snmpTrapOIDOID {
+			t.oid = v.value
+		} else if v.oid != snmpSysUpTimeOID {
+			t.variables = append(t.variables, v)
+		}
+	}
+	if t.oid == "" {
+		return errSNMPInvalidPacket
+	}
+	return nil
+}
+
+// title returns the message title, e.g. "linkDown from 10.0.0.1"
+func (t *snmpTrap) title(names map[string]string, from netip.Addr) string {
+	if t.agent.IsValid() {
+		from = t.agent
+	}
+	return fmt.Sprintf("%s from %s", snmpOIDName(names, t.oid), from)
+}
+
+// message returns the message body, with one line per variable binding, or an empty string if there are none
+func (t *snmpTrap) message(names map[string]string) string {
+	lines := make([]string, 0, len(t.variables))
+	for _, v := range t.variables {
+		lines = append(lines, fmt.Sprintf("%s = %s", snmpOIDName(names, v.oid), v.value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleSNMPTrap publishes a trap to the topic of the first matching rule. Errors are only logged,
+// since there is no way to report them to the sender.
+func (s *Server) handleSNMPTrap(addr net.Addr, b []byte) {
+	from := datagramSenderAddr(addr)
+	ev := log.Tag(tagSNMP).Field("snmp_remote_addr", from.String())
+	if ev.IsTrace() {
+		ev.Field("snmp_data", hex.EncodeToString(b)).Trace("Received SNMP datagram")
+	}
+	trap, err := parseSNMPTrap(b)
+	if err != nil {
+		ev.Err(err).Debug("Ignoring invalid SNMP trap")
+		return
+	}
+	ev.Fields(log.Context{
+		"snmp_version":  trap.version,
+		"snmp_trap_oid": trap.oid,
+	})
+	var rule *SNMPTrapRule
+	for _, r := range s.config.SNMPTrapRules {
+		if r.matches(trap, from) {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		ev.Debug("Ignoring SNMP trap, no rule matches")
+		return
+	}
+	title, message := trap.title(s.config.SNMPTrapOIDNames, from), trap.message(s.config.SNMPTrapOIDNames)
+	header := http.Header{}
+	if message == "" {
+		message = title
+	} else {
+		header.Set("Title", title)
+	}
+	if rule.Priority > 0 {
+		header.Set("Priority", strconv.Itoa(rule.Priority))
+	}
+	if err := s.publishDatagram(rule.Topic, message, header, rule.Token, from); err != nil {
+		ev.Field("topic", rule.Topic).Err(err).Debug("Cannot publish SNMP trap")
+		return
+	}
+	ev.Field("topic", rule.Topic).Debug("Published SNMP trap")
+}
+
+// snmpOIDName translates an OID via the longest matching OID in the configured or default names, and appends
+// the remaining sub-identifiers, e.g. 1.3.6.1.2.1.2.2.1.1.3 to "ifIndex.3". If there is no match, the OID is
+// returned as is.
+func snmpOIDName(names map[string]string, oid string) string {
+	for prefix := oid; prefix != ""; {
+		name, ok := names[prefix]
+		if !ok {
+			name, ok = snmpDefaultOIDNames[prefix]
+		}
+		if ok {
+			return name + strings.TrimPrefix(oid, prefix)
+		}
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return oid
+}
+
+func readSNMPVariables(b []byte) ([]*snmpVariable, error) {
+	tag, list, _, err := readBER(b)
+	if err != nil || tag != berTagSequence {
+		return nil, errSNMPInvalidPacket
+	}
+	variables := make([]*snmpVariable, 0)
+	for len(list) > 0 {
+		var binding []byte
+		tag, binding, list, err = readBER(list)
+		if err != nil || tag != berTagSequence {
+			return nil, errSNMPInvalidPacket
+		}
+		tag, oid, binding, err := readBER(binding)
+		if err != nil || tag != berTagOID {
+			return nil, errSNMPInvalidPacket
+		}
+		tag, value, _, err := readBER(binding)
+		if err != nil {
+			return nil, err
+		}
+		oidStr, err := decodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		valueStr, err := formatSNMPValue(tag, value)
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, &snmpVariable{oid: oidStr, value: valueStr})
+	}
+	return variables, nil
+}
+
+func formatSNMPValue(tag byte, value []byte) (string, error) {
+	switch tag {
+	case berTagInteger:
+		i, err := decodeBERInteger(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+	case berTagCounter32, berTagGauge32, berTagTimeTicks, berTagCounter64:
+		if len(value) > 9 {
+			return "", errSNMPInvalidPacket
+		}
+		var u uint64
+		for _, b := range value {
+			u = u<<8 | uint64(b)
+		}
+		return strconv.FormatUint(u, 10), nil
+	case berTagOctetString:
+		if utf8.Valid(value) && strings.IndexFunc(string(value), func(r rune) bool { return !unicode.IsPrint(r) && !unicode.IsSpace(r) }) == -1 {
+			return string(value), nil
+		}
+		return formatHexBytes(value), nil
+	case berTagOID:
+		return decodeOID(value)
+	case berTagIPAddress:
+		addr, ok := netip.AddrFromSlice(value)
+		if !ok {
+			return "", errSNMPInvalidPacket
+		}
+		return addr.String(), nil
+	case berTagNull:
+		return "", nil
+	case berTagNoSuchObj:
+		return "noSuchObject", nil
+	case berTagNoSuchInst:
+		return "noSuchInstance", nil
+	case berTagEndOfMIB:
+		return "endOfMibView", nil
+	default:
+		return formatHexBytes(value), nil
+	}
+}
+
+// readBER reads a BER-encoded TLV with a single-byte tag, and returns the tag, value and the remaining bytes
+func readBER(b []byte) (tag byte, value []byte, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errSNMPInvalidPacket
+	}
+	tag, length, offset := b[0], int(b[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 || len(b) < 2+n {
+			return 0, nil, nil, errSNMPInvalidPacket
+		}
+		length = 0
+		for _, c := range b[2 : 2+n] {
+			length = length<<8 | int(c)
+		}
+		offset += n
+	}
+	if len(b)-offset < length {
+		return 0, nil, nil, errSNMPInvalidPacket
+	}
+	return tag, b[offset : offset+length], b[offset+length:], nil
+}
+
+func readBERInteger(b []byte) (int64, []byte, error) {
+	tag, value, rest, err := readBER(b)
+	if err != nil || tag != berTagInteger {
+		return 0, nil, errSNMPInvalidPacket
+	}
+	i, err := decodeBERInteger(value)
+	if err != nil {
+		return 0, nil, err
+	}
+	return i, rest, nil
+}
+
+func decodeBERInteger(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, errSNMPInvalidPacket
+	}
+	i := int64(int8(b[0])) // Sign extension
+	for _, c := range b[1:] {
+		i = i<<8 | int64(c)
+	}
+	return i, nil
+}
+
+func decodeOID(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", errSNMPInvalidPacket
+	}
+	ids := make([]string, 0)
+	var id uint64
+	for i, c := range b {
+		id = id<<7 | uint64(c&0x7f)
+		if c&0x80 != 0 {
+			if i == len(b)-1 || id > 1<<32 {
+				return "", errSNMPInvalidPacket
+			}
+			continue
+		}
+		if len(ids) == 0 {
+			first := min(id/40, 2)
+			ids = append(ids, strconv.FormatUint(first, 10), strconv.FormatUint(id-40*first, 10))
+		} else {
+			ids = append(ids, strconv.FormatUint(id, 10))
+		}
+		if len(ids) > snmpMaxOIDLength {
+			return "", errSNMPInvalidPacket
+		}
+		id = 0
+	}
+	return strings.Join(ids, "."), nil
+}
+
+func formatHexBytes(b []byte) string {
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(parts, ":")
+}
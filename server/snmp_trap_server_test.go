@@ -0,0 +1,271 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSNMPTrapRule(t *testing.T) {
+	rule, err := ParseSNMPTrapRule("ups oid=.1.3.6.1.4.1.318,1.3.6.1.6.3.1.1.5.1 community=private from=10.0.0.0/8 priority=5 token=tk_abc")
+	require.Nil(t, err)
+	require.Equal(t, "ups", rule.Topic)
+	require.Equal(t, []string{"1.3.6.1.4.1.318", "1.3.6.1.6.3.1.1.5.1"}, rule.OIDs)
+	require.Equal(t, "private", rule.Community)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, rule.From)
+	require.Equal(t, 5, rule.Priority)
+	require.Equal(t, "tk_abc", rule.Token)
+
+	for _, spec := range []string{
+		"",
+		"invalid/topic",
+		"ups oid=linkDown",
+		"ups oid=1",
+		"ups from=nope",
+		"ups priority=0",
+		"ups unknown=1",
+	} {
+		_, err := ParseSNMPTrapRule(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestParseSNMPTrapOIDNames(t *testing.T) {
+	names, err := ParseSNMPTrapOIDNames([]string{"1.3.6.1.4.1.318.0.5=UPS on battery", " .1.3.6.1.6.3.1.1.5.3 = Link down "})
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"1.3.6.1.4.1.318.0.5": "UPS on battery", "1.3.6.1.6.3.1.1.5.3": "Link down"}, names)
+
+	require.Equal(t, "Link down", snmpOIDName(names, "1.3.6.1.6.3.1.1.5.3"))
+	require.Equal(t, "linkUp", snmpOIDName(names, "1.3.6.1.6.3.1.1.5.4"))
+	require.Equal(t, "ifDescr.12", snmpOIDName(names, "1.3.6.1.2.1.2.2.1.2.12"))
+	require.Equal(t, "1.3.6.1.4.1.9999.1", snmpOIDName(names, "1.3.6.1.4.1.9999.1"))
+
+	for _, spec := range []string{"1.3.6.1", "1.3.6.1=", "linkDown=Link down"} {
+		_, err := ParseSNMPTrapOIDNames([]string{spec})
+		require.Error(t, err, spec)
+	}
+}
+
+func TestParseSNMPTrap_V1(t *testing.T) {
+	// Generic linkDown trap
+	trap, err := parseSNMPTrap(testSNMPTrapV1("public", "1.3.6.1.4.1.9", "10.0.0.5", 2, 0,
+		testSNMPVariable("1.3.6.1.2.1.2.2.1.1.3", berTagInteger, testBERInteger(3)),
+		testSNMPVariable("1.3.6.1.2.1.2.2.1.2.3", berTagOctetString, []byte("GigabitEthernet0/3")),
+	))
+	require.Nil(t, err)
+	require.Equal(t, 0, trap.version)
+	require.Equal(t, "public", trap.community)
+	require.Equal(t, "1.3.6.1.6.3.1.1.5.3", trap.oid)
+	require.Equal(t, netip.MustParseAddr("10.0.0.5"), trap.agent)
+	require.Equal(t, "linkDown from 10.0.0.5", trap.title(nil, netip.MustParseAddr("1.2.3.4")))
+	require.Equal(t, "ifIndex.3 = 3\nifDescr.3 = GigabitEthernet0/3", trap.message(nil))
+
+	// Enterprise-specific trap
+	trap, err = parseSNMPTrap(testSNMPTrapV1("public", "1.3.6.1.4.1.318", "0.0.0.0", 6, 5))
+	require.Nil(t, err)
+	require.Equal(t, "1.3.6.1.4.1.318.0.5", trap.oid)
+	require.False(t, trap.agent.IsValid())
+	require.Equal(t, "UPS on battery from 1.2.3.4", trap.title(map[string]string{"1.3.6.1.4.1.318.0.5": "UPS on battery"}, netip.MustParseAddr("1.2.3.4")))
+	require.Equal(t, "", trap.message(nil))
+}
+
+func TestParseSNMPTrap_V2c(t *testing.T) {
+	trap, err := parseSNMPTrap(testSNMPTrapV2c("private", "1.3.6.1.4.1.8072.2.3.0.1",
+		testSNMPVariable("1.3.6.1.4.1.8072.2.3.2.1", berTagInteger, testBERInteger(-42)),
+		testSNMPVariable("1.3.6.1.4.1.8072.2.3.2.2", berTagOctetString, []byte{0x00, 0x1a, 0xff}),
+		testSNMPVariable("1.3.6.1.4.1.8072.2.3.2.3", berTagIPAddress, []byte{192, 168, 1, 1}),
+		testSNMPVariable("1.3.6.1.4.1.8072.2.3.2.4", berTagCounter32, []byte{0x00, 0xff, 0xff, 0xff, 0xff}),
+		testSNMPVariable("1.3.6.1.4.1.8072.2.3.2.5", berTagOID, testBEROID("1.3.6.1.6.3.1.1.5.4")),
+		testSNMPVariable("1.3.6.1.4.1.8072.2.3.2.6", berTagNull, nil),
+	))
+	require.Nil(t, err)
+	require.Equal(t, 1, trap.version)
+	require.Equal(t, "private", trap.community)
+	require.Equal(t, "1.3.6.1.4.1.8072.2.3.0.1", trap.oid)
+	require.Equal(t, "1.3.6.1.4.1.8072.2.3.0.1 from 10.1.1.1", trap.title(nil, netip.MustParseAddr("10.1.1.1")))
+	names := map[string]string{"1.3.6.1.4.1.8072.2.3.2": "netSnmpExample"}
+	require.Equal(t, strings.Join([]string{
+		"netSnmpExample.1 = -42",
+		"netSnmpExample.2 = 00:1a:ff",
+		"netSnmpExample.3 = 192.168.1.1",
+		"netSnmpExample.4 = 4294967295",
+		"netSnmpExample.5 = 1.3.6.1.6.3.1.1.5.4",
+		"netSnmpExample.6 = ",
+	}, "\n"), trap.message(names))
+}
+
+func TestParseSNMPTrap_Invalid(t *testing.T) {
+	valid := testSNMPTrapV2c("public", "1.3.6.1.6.3.1.1.5.1")
+	for i := 0; i < len(valid); i++ {
+		_, err := parseSNMPTrap(valid[:i])
+		require.Error(t, err, "truncated at %d", i)
+	}
+	_, err := parseSNMPTrap([]byte("not a trap"))
+	require.Error(t, err)
+
+	// SNMPv3
+	_, err = parseSNMPTrap(testBER(berTagSequence, testConcat(testBER(berTagInteger, testBERInteger(3)), testBER(berTagSequence, nil))))
+	require.Equal(t, errSNMPUnsupportedVersion, err)
+
+	// Get request instead of trap
+	get := testBER(berTagSequence, testConcat(
+		testBER(berTagInteger, testBERInteger(1)),
+		testBER(berTagOctetString, []byte("public")),
+		testBER(0xa0, testConcat(testBER(berTagInteger, testBERInteger(1)), testBER(berTagInteger, testBERInteger(0)), testBER(berTagInteger, testBERInteger(0)), testBER(berTagSequence, nil))),
+	))
+	_, err = parseSNMPTrap(get)
+	require.Equal(t, errSNMPUnsupportedPDU, err)
+
+	// v2c trap without snmpTrapOID.0
+	_, err = parseSNMPTrap(testBER(berTagSequence, testConcat(
+		testBER(berTagInteger, testBERInteger(1)),
+		testBER(berTagOctetString, []byte("public")),
+		testBER(snmpTagTrapV2, testConcat(testBER(berTagInteger, testBERInteger(1)), testBER(berTagInteger, testBERInteger(0)), testBER(berTagInteger, testBERInteger(0)), testBER(berTagSequence, nil))),
+	)))
+	require.Equal(t, errSNMPInvalidPacket, err)
+}
+
+func TestServer_SNMPTrap_Rules(t *testing.T) {
+	c := newTestConfig(t)
+	c.SNMPTrapRules = []*SNMPTrapRule{
+		mustParseSNMPTrapRule(t, "ups oid=1.3.6.1.4.1.318 community=private priority=5"),
+		mustParseSNMPTrapRule(t, "network oid=1.3.6.1.6.3.1.1.5 from=10.0.0.0/8"),
+	}
+	c.SNMPTrapOIDNames = map[string]string{"1.3.6.1.4.1.318.0.5": "UPS on battery"}
+	s := newTestServer(t, c)
+	lan := &net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 162}
+	wan := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 162}
+
+	s.handleSNMPTrap(wan, testSNMPTrapV1("private", "1.3.6.1.4.1.318", "0.0.0.0", 6, 5,
+		testSNMPVariable("1.3.6.1.4.1.318.2.1", berTagOctetString, []byte("Battery at 80%")))) // -> ups
+	s.handleSNMPTrap(wan, testSNMPTrapV1("public", "1.3.6.1.4.1.318", "0.0.0.0", 6, 5)) // Wrong community -> dropped
+	s.handleSNMPTrap(lan, testSNMPTrapV2c("public", "1.3.6.1.6.3.1.1.5.3"))             // -> network
+	s.handleSNMPTrap(wan, testSNMPTrapV2c("public", "1.3.6.1.6.3.1.1.5.3"))             // Wrong sender -> dropped
+	s.handleSNMPTrap(lan, testSNMPTrapV2c("public", "1.3.6.1.4.1.9.9.41.2.0.1"))        // No rule -> dropped
+	s.handleSNMPTrap(lan, []byte("garbage"))                                            // Invalid -> dropped
+
+	messages := toMessages(t, request(t, s, "GET", "/ups/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "UPS on battery from 1.2.3.4", messages[0].Title)
+	require.Equal(t, "1.3.6.1.4.1.318.2.1 = Battery at 80%", messages[0].Message)
+	require.Equal(t, 5, messages[0].Priority)
+
+	messages = toMessages(t, request(t, s, "GET", "/network/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "", messages[0].Title)
+	require.Equal(t, "linkDown from 10.1.2.3", messages[0].Message)
+}
+
+func TestServer_SNMPTrapListener(t *testing.T) {
+	c := newTestConfig(t)
+	c.SNMPTrapListen = "127.0.0.1:0"
+	c.SNMPTrapRules = []*SNMPTrapRule{mustParseSNMPTrapRule(t, "alerts")}
+	s := newTestServer(t, c)
+	require.Nil(t, s.listen())
+	go runDatagramListener(s.snmpTrapConn, s.handleSNMPTrap)
+	defer s.closeListeners()
+
+	conn, err := net.Dial("udp", s.snmpTrapConn.LocalAddr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write(testSNMPTrapV2c("public", "1.3.6.1.6.3.1.1.5.1"))
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		messages, err := s.messageCache.Messages("alerts", sinceAllMessages, false)
+		return err == nil && len(messages) == 1 && messages[0].Message == "coldStart from 127.0.0.1"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func mustParseSNMPTrapRule(t *testing.T, spec string) *SNMPTrapRule {
+	rule, err := ParseSNMPTrapRule(spec)
+	require.Nil(t, err)
+	return rule
+}
+
+func testSNMPTrapV1(community, enterprise, agent string, generic, specific int64, variables ...[]byte) []byte {
+	return testBER(berTagSequence, testConcat(
+		testBER(berTagInteger, testBERInteger(0)),
+		testBER(berTagOctetString, []byte(community)),
+		testBER(snmpTagTrapV1, testConcat(
+			testBER(berTagOID, testBEROID(enterprise)),
+			testBER(berTagIPAddress, netip.MustParseAddr(agent).AsSlice()),
+			testBER(berTagInteger, testBERInteger(generic)),
+			testBER(berTagInteger, testBERInteger(specific)),
+			testBER(berTagTimeTicks, testBERInteger(12345)),
+			testBER(berTagSequence, testConcat(variables...)),
+		)),
+	))
+}
+
+func testSNMPTrapV2c(community, trapOID string, variables ...[]byte) []byte {
+	variables = append([][]byte{
+		testSNMPVariable(snmpSysUpTimeOID, berTagTimeTicks, testBERInteger(12345)),
+		testSNMPVariable(snmpTrapOIDOID, berTagOID, testBEROID(trapOID)),
+	}, variables...)
+	return testBER(berTagSequence, testConcat(
+		testBER(berTagInteger, testBERInteger(1)),
+		testBER(berTagOctetString, []byte(community)),
+		testBER(snmpTagTrapV2, testConcat(
+			testBER(berTagInteger, testBERInteger(1234)),
+			testBER(berTagInteger, testBERInteger(0)),
+			testBER(berTagInteger, testBERInteger(0)),
+			testBER(berTagSequence, testConcat(variables...)),
+		)),
+	))
+}
+
+func testSNMPVariable(oid string, tag byte, value []byte) []byte {
+	return testBER(berTagSequence, testConcat(testBER(berTagOID, testBEROID(oid)), testBER(tag, value)))
+}
+
+func testBER(tag byte, value []byte) []byte {
+	if len(value) < 0x80 {
+		return testConcat([]byte{tag, byte(len(value))}, value)
+	}
+	return testConcat([]byte{tag, 0x82, byte(len(value) >> 8), byte(len(value))}, value)
+}
+
+func testBERInteger(i int64) []byte {
+	b := []byte{byte(i)}
+	for i >>= 8; i != 0 && i != -1; i >>= 8 {
+		b = append([]byte{byte(i)}, b...)
+	}
+	if i == 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	} else if i == -1 && b[0]&0x80 == 0 {
+		b = append([]byte{0xff}, b...)
+	}
+	return b
+}
+
+func testBEROID(oid string) []byte {
+	parts := strings.Split(oid, ".")
+	ids := make([]uint64, len(parts))
+	for i, part := range parts {
+		ids[i], _ = strconv.ParseUint(part, 10, 64)
+	}
+	ids = append([]uint64{ids[0]*40 + ids[1]}, ids[2:]...)
+	var b []byte
+	for _, id := range ids {
+		enc := []byte{byte(id & 0x7f)}
+		for id >>= 7; id > 0; id >>= 7 {
+			enc = append([]byte{byte(id&0x7f) | 0x80}, enc...)
+		}
+		b = append(b, enc...)
+	}
+	return b
+}
+
+func testConcat(parts ...[]byte) []byte {
+	var b []byte
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
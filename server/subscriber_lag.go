@@ -0,0 +1,129 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// subscriberLagThreshold is the delivery lag after which a subscriber connection is considered lagging,
+	// i.e. it does not read messages as fast as they are published (slow consumer)
+	subscriberLagThreshold = 5 * time.Second
+
+	subscriberProtocolHTTP      = "http"
+	subscriberProtocolWebSocket = "ws"
+)
+
+// subscriberLags keeps track of the delivery lag of all HTTP stream and WebSocket subscriber connections.
+// The lag of a connection is the time its oldest message has been waiting to be written to the connection.
+type subscriberLags struct {
+	subscribers map[*subscriberLag]struct{}
+	mu          sync.Mutex
+}
+
+// subscriberLag tracks the messages that are waiting to be written to a single subscriber connection
+type subscriberLag struct {
+	protocol string               // Protocol of the connection (http or ws), used as metric label
+	pending  map[string]time.Time // Message ID -> time the message was published
+	lagging  bool                 // True if the connection exceeded subscriberLagThreshold, see Begin
+	mu       sync.Mutex
+}
+
+func newSubscriberLags() *subscriberLags {
+	return &subscriberLags{
+		subscribers: make(map[*subscriberLag]struct{}),
+	}
+}
+
+// Add registers a new subscriber connection with the given protocol
+func (l *subscriberLags) Add(protocol string) *subscriberLag {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sl := &subscriberLag{
+		protocol: protocol,
+		pending:  make(map[string]time.Time),
+	}
+	l.subscribers[sl] = struct{}{}
+	return sl
+}
+
+// Remove unregisters a subscriber connection, e.g. when the connection is closed
+func (l *subscriberLags) Remove(sl *subscriberLag) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.subscribers, sl)
+}
+
+// Stats returns the maximum lag of all subscriber connections, and the number of connections
+// whose lag exceeds subscriberLagThreshold
+func (l *subscriberLags) Stats() (maxLag time.Duration, lagging int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for sl := range l.subscribers {
+		lag := sl.Lag()
+		if lag > maxLag {
+			maxLag = lag
+		}
+		if lag >= subscriberLagThreshold {
+			lagging++
+		}
+	}
+	return maxLag, lagging
+}
+
+// Pending returns the total number of messages that are waiting to be written to any subscriber connection,
+// i.e. the backlog of the fan-out, see checkOverload
+func (l *subscriberLags) Pending() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pending := 0
+	for sl := range l.subscribers {
+		sl.mu.Lock()
+		pending += len(sl.pending)
+		sl.mu.Unlock()
+	}
+	return pending
+}
+
+// Begin marks the given message as waiting to be written to the connection, and returns a function that must be
+// called once the write completed. The returned function records the delivery latency (time between publishing
+// and writing the message), and returns true if the connection just started lagging, so the caller can log it once.
+//
+// Messages that were not published live (e.g. messages from the cache, or keepalive messages) are not tracked.
+func (sl *subscriberLag) Begin(m *message) (done func(delivered bool) (startedLagging bool)) {
+	if m.published.IsZero() {
+		return func(bool) bool { return false }
+	}
+	sl.mu.Lock()
+	sl.pending[m.ID] = m.published
+	sl.mu.Unlock()
+	return func(delivered bool) bool {
+		latency := time.Since(m.published)
+		if delivered && metricMessageDeliveryLatency != nil {
+			metricMessageDeliveryLatency.WithLabelValues(sl.protocol).Observe(latency.Seconds())
+		}
+		sl.mu.Lock()
+		defer sl.mu.Unlock()
+		delete(sl.pending, m.ID)
+		wasLagging := sl.lagging
+		sl.lagging = latency >= subscriberLagThreshold
+		return sl.lagging && !wasLagging
+	}
+}
+
+// Lag returns the time the oldest pending message has been waiting to be written to the connection,
+// or zero if no messages are pending
+func (sl *subscriberLag) Lag() time.Duration {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	var oldest time.Time
+	for _, published := range sl.pending {
+		if oldest.IsZero() || published.Before(oldest) {
+			oldest = published
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
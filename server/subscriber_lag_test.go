@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriberLag_PendingMessages(t *testing.T) {
+	lags := newSubscriberLags()
+	sl := lags.Add(subscriberProtocolHTTP)
+
+	old := &message{ID: "old", published: time.Now().Add(-10 * time.Second)}
+	recent := &message{ID: "recent", published: time.Now().Add(-time.Second)}
+	doneOld := sl.Begin(old)
+	doneRecent := sl.Begin(recent)
+	require.True(t, sl.Lag() >= 10*time.Second)
+
+	maxLag, lagging := lags.Stats()
+	require.True(t, maxLag >= 10*time.Second)
+	require.Equal(t, 1, lagging)
+
+	require.True(t, doneOld(true))     // Connection started lagging
+	require.False(t, doneRecent(true)) // Caught up
+	require.Equal(t, time.Duration(0), sl.Lag())
+
+	maxLag, lagging = lags.Stats()
+	require.Equal(t, time.Duration(0), maxLag)
+	require.Equal(t, 0, lagging)
+
+	lags.Remove(sl)
+	require.Empty(t, lags.subscribers)
+}
+
+func TestSubscriberLag_UntrackedMessages(t *testing.T) {
+	sl := newSubscriberLags().Add(subscriberProtocolWebSocket)
+	done := sl.Begin(newKeepaliveMessage("mytopic")) // Not published via topic.Publish
+	require.Empty(t, sl.pending)
+	require.False(t, done(true))
+}
+
+func TestServer_SubscriberLag_Registered(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, newTestConfig(t))
+
+	subscribeRR := httptest.NewRecorder()
+	subscribeCancel := subscribe(t, s, "/mytopic/json", subscribeRR)
+	waitFor(t, func() bool {
+		s.subscriberLags.mu.Lock()
+		defer s.subscriberLags.mu.Unlock()
+		return len(s.subscriberLags.subscribers) == 1
+	})
+
+	response := request(t, s, "PUT", "/mytopic", "my first message", nil)
+	require.Equal(t, 200, response.Code)
+	time.Sleep(500 * time.Millisecond) // Publishing is done asynchronously, this avoids races
+	maxLag, lagging := s.subscriberLags.Stats()
+	require.Equal(t, time.Duration(0), maxLag)
+	require.Equal(t, 0, lagging)
+
+	subscribeCancel()
+	require.Equal(t, 2, len(toMessages(t, subscribeRR.Body.String())))
+	waitFor(t, func() bool {
+		s.subscriberLags.mu.Lock()
+		defer s.subscriberLags.mu.Unlock()
+		return len(s.subscriberLags.subscribers) == 0
+	})
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+)
+
+// The syslog listener accepts syslog datagrams (RFC 3164 and RFC 5424) or plain text via UDP, and publishes them
+// as messages, so that network gear that can only send syslog (switches, firewalls, UPSes, ...) can notify humans.
+// Datagrams are mapped to topics via syslog rules (see ParseSyslogRule), which match the facility and severity of
+// a datagram and the IP address of the sender. The first matching rule wins; datagrams that match no rule are dropped.
+//
+// Datagrams are published like regular requests from the sender's IP address, so that rate limits and access
+// control apply. Datagrams without a PRI part (plain text) are treated as user.notice, see RFC 3164, section 4.3.3.
+
+const (
+	syslogDefaultFacility  = 1 // user
+	syslogDefaultSeverity  = 5 // notice
+	syslogLowestSeverity   = 7 // debug
+	syslogMaxFacilityValue = 23
+)
+
+var (
+	syslogRuleRegex       = regexp.MustCompile(`^(\S+)((?:\s+[-a-z]+=\S+)*)\s*$`)
+	syslogPRIRegex        = regexp.MustCompile(`^<(\d{1,3})>`)
+	syslogRFC5424Regex    = regexp.MustCompile(`^[1-9]\d? (\S+) (\S+) (\S+) (\S+) (\S+) `)
+	syslogRFC3164Regex    = regexp.MustCompile(`^(?:[A-Z][a-z]{2} [ 0-9]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) (\S+) `)
+	syslogRFC3164TagRegex = regexp.MustCompile(`^([^\s:\[\]]{1,48})(?:\[[^\]]*\])?: `)
+)
+
+// syslogFacilities are the names of the syslog facilities, see RFC 5424, section 6.2.1. Facilities
+// 12-15 have no widely agreed upon names, and can only be referred to by number.
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverities are the names of the syslog severities, the index is the severity (0 = most severe)
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// syslogSeverityPriorities maps the syslog severities to message priorities, unless a rule sets the priority
+var syslogSeverityPriorities = []int{5, 5, 4, 4, 3, 3, 2, 1}
+
+// SyslogRule maps syslog datagrams to a topic, see ParseSyslogRule
+type SyslogRule struct {
+	Topic      string
+	Facilities []int          // Facilities the rule matches, all facilities if empty
+	Severity   int            // Least severe severity the rule matches, e.g. 4 (warning) matches emerg to warning
+	From       []netip.Prefix // Sender IP addresses the rule matches, all senders if empty
+	Priority   int            // Message priority, derived from the severity if zero
+	Token      string         // Access token used to publish to the topic, if the topic is protected
+}
+
+// ParseSyslogRule parses an entry of the syslog-rules option. Entries have the format
+// "<topic> [key=value ...]", e.g. "network-alerts facility=local0,local1 severity=warning from=10.0.0.0/8".
+//
+// Supported keys:
+//   - facility=<facility>[,...]: facility names (e.g. kern, daemon, local0) or numbers (0-23), default: all
+//   - severity=<severity>: the least severe severity (emerg, alert, crit, err, warning, notice, info, debug) or
+//     number (0-7); the rule matches this and all more severe severities, default: debug (all)
+//   - from=<ip|cidr>[,...]: the sender IP addresses or ranges, default: all
+//   - priority=<1-5>: the message priority, default: derived from the severity
+//   - token=<token>: the access token used to publish, if the topic is protected
+func ParseSyslogRule(spec string) (*SyslogRule, error) {
+	m := syslogRuleRegex.FindStringSubmatch(strings.TrimSpace(spec))
+	if m == nil || !topicRegex.MatchString(m[1]) {
+		return nil, fmt.Errorf(`invalid syslog rule "%s", must be "<topic> [key=value ...]"`, spec)
+	}
+	rule := &SyslogRule{
+		Topic:    m[1],
+		Severity: syslogLowestSeverity,
+	}
+	for _, option := range strings.Fields(m[2]) {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "facility":
+			for _, name := range strings.Split(value, ",") {
+				facility, err := parseSyslogFacility(name)
+				if err != nil {
+					return nil, fmt.Errorf(`invalid syslog rule "%s", %s`, spec, err.Error())
+				}
+				rule.Facilities = append(rule.Facilities, facility)
+			}
+		case "severity":
+			severity, err := parseSyslogSeverity(value)
+			if err != nil {
+				return nil, fmt.Errorf(`invalid syslog rule "%s", %s`, spec, err.Error())
+			}
+			rule.Severity = severity
+		case "from":
+			for _, from := range strings.Split(value, ",") {
+				prefix, err := parseIPPrefixOrAddr(from)
+				if err != nil {
+					return nil, fmt.Errorf(`invalid syslog rule "%s", from must be an IP address or range, e.g. 10.0.0.0/8`, spec)
+				}
+				rule.From = append(rule.From, prefix)
+			}
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil || priority < 1 || priority > 5 {
+				return nil, fmt.Errorf(`invalid syslog rule "%s", priority must be between 1 and 5`, spec)
+			}
+			rule.Priority = priority
+		case "token":
+			rule.Token = value
+		default:
+			return nil, fmt.Errorf(`invalid syslog rule "%s", unknown option "%s"`, spec, key)
+		}
+	}
+	return rule, nil
+}
+
+// matches returns true if the rule matches the given datagram and sender
+func (r *SyslogRule) matches(m *syslogMessage, from netip.Addr) bool {
+	if m.severity > r.Severity {
+		return false
+	}
+	if len(r.Facilities) > 0 && !util.Contains(r.Facilities, m.facility) {
+		return false
+	}
+	return prefixesContain(r.From, from)
+}
+
+// syslogMessage is a parsed syslog datagram, see parseSyslogMessage
+type syslogMessage struct {
+	facility int
+	severity int
+	hostname string // Empty if not set
+	app      string // Empty if not set
+	message  string
+}
+
+// parseSyslogMessage parses a syslog datagram in the RFC 5424 or RFC 3164 (BSD) format. Since many devices do not
+// follow RFC 3164 closely, the timestamp, hostname and tag are optional; anything that cannot be parsed is treated as
+// part of the message. Datagrams without a PRI part are treated as plain text.
+func parseSyslogMessage(b []byte) *syslogMessage {
+	s := strings.TrimRight(strings.ToValidUTF8(string(b), string(utf8.RuneError)), "\r\n\x00")
+	m := &syslogMessage{
+		facility: syslogDefaultFacility,
+		severity: syslogDefaultSeverity,
+	}
+	pri := syslogPRIRegex.FindStringSubmatch(s)
+	if pri == nil {
+		m.message = strings.TrimSpace(s)
+		return m
+	}
+	value, _ := strconv.Atoi(pri[1])
+	if value>>3 > syslogMaxFacilityValue {
+		m.message = strings.TrimSpace(s)
+		return m
+	}
+	m.facility, m.severity = value>>3, value&7
+	s = s[len(pri[0]):]
+	if header := syslogRFC5424Regex.FindStringSubmatch(s); header != nil {
+		m.hostname, m.app = syslogNilValue(header[2]), syslogNilValue(header[3])
+		m.message = strings.TrimSpace(strings.TrimPrefix(strings.TrimLeft(skipSyslogStructuredData(s[len(header[0]):]), " "), "\uFEFF"))
+		return m
+	}
+	if header := syslogRFC3164Regex.FindStringSubmatch(s); header != nil {
+		m.hostname = header[1]
+		s = s[len(header[0]):]
+	}
+	if tag := syslogRFC3164TagRegex.FindStringSubmatch(s); tag != nil {
+		m.app = tag[1]
+		s = s[len(tag[0]):]
+	}
+	m.message = strings.TrimSpace(s)
+	return m
+}
+
+// title returns the message title, e.g. "sshd on switch01"
+func (m *syslogMessage) title() string {
+	if m.app != "" && m.hostname != "" {
+		return fmt.Sprintf("%s on %s", m.app, m.hostname)
+	} else if m.app != "" {
+		return m.app
+	}
+	return m.hostname
+}
+
+// tags returns the facility and severity names as message tags, e.g. "daemon,warning"
+func (m *syslogMessage) tags() string {
+	tags := []string{syslogSeverities[m.severity]}
+	for name, facility := range syslogFacilities {
+		if facility == m.facility {
+			tags = []string{name, syslogSeverities[m.severity]}
+			break
+		}
+	}
+	return strings.Join(tags, ",")
+}
+
+// handleSyslogDatagram publishes a datagram to the topic of the first matching rule. Errors are only logged,
+// since there is no way to report them to the sender.
+func (s *Server) handleSyslogDatagram(addr net.Addr, b []byte) {
+	m := parseSyslogMessage(b)
+	from := datagramSenderAddr(addr)
+	ev := log.Tag(tagSyslog).Fields(log.Context{
+		"syslog_remote_addr": from.String(),
+		"syslog_facility":    m.facility,
+		"syslog_severity":    m.severity,
+	})
+	if ev.IsTrace() {
+		ev.Field("syslog_data", string(b)).Trace("Received syslog datagram")
+	}
+	if m.message == "" {
+		ev.Debug("Ignoring empty syslog datagram")
+		return
+	}
+	var rule *SyslogRule
+	for _, r := range s.config.SyslogRules {
+		if r.matches(m, from) {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		ev.Debug("Ignoring syslog datagram, no rule matches")
+		return
+	}
+	if err := s.publishSyslogMessage(rule, m, from); err != nil {
+		ev.Field("topic", rule.Topic).Err(err).Debug("Cannot publish syslog datagram")
+		return
+	}
+	ev.Field("topic", rule.Topic).Debug("Published syslog datagram")
+}
+
+// publishSyslogMessage publishes the message to the topic of the rule, see publishDatagram
+func (s *Server) publishSyslogMessage(rule *SyslogRule, m *syslogMessage, from netip.Addr) error {
+	priority := rule.Priority
+	if priority == 0 {
+		priority = syslogSeverityPriorities[m.severity]
+	}
+	header := http.Header{}
+	if title := m.title(); title != "" {
+		header.Set("Title", title)
+	}
+	header.Set("Priority", strconv.Itoa(priority))
+	header.Set("Tags", m.tags())
+	return s.publishDatagram(rule.Topic, m.message, header, rule.Token, from)
+}
+
+func parseSyslogFacility(s string) (int, error) {
+	if facility, ok := syslogFacilities[s]; ok {
+		return facility, nil
+	} else if facility, err := strconv.Atoi(s); err == nil && facility >= 0 && facility <= syslogMaxFacilityValue {
+		return facility, nil
+	}
+	return 0, fmt.Errorf("unknown facility %s, must be a name (e.g. daemon or local0) or a number between 0 and 23", s)
+}
+
+func parseSyslogSeverity(s string) (int, error) {
+	for severity, name := range syslogSeverities {
+		if s == name {
+			return severity, nil
+		}
+	}
+	if severity, err := strconv.Atoi(s); err == nil && severity >= 0 && severity <= syslogLowestSeverity {
+		return severity, nil
+	}
+	return 0, fmt.Errorf("unknown severity %s, must be one of %s, or a number between 0 and 7", s, strings.Join(syslogSeverities, ", "))
+}
+
+// skipSyslogStructuredData removes the STRUCTURED-DATA part of an RFC 5424 message, which is either "-" or a
+// list of elements like [id key="value"], in which ']' may be escaped as '\]'
+func skipSyslogStructuredData(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return s[1:]
+	}
+	inValue, escaped := false, false
+	depth := 0
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && inValue:
+			escaped = true
+		case c == '"':
+			inValue = !inValue
+		case c == '[' && !inValue:
+			depth++
+		case c == ']' && !inValue:
+			depth--
+		case depth == 0:
+			return s[i:]
+		}
+	}
+	return ""
+}
+
+func syslogNilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
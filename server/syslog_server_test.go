@@ -0,0 +1,160 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"heckel.io/ntfy/v2/user"
+)
+
+func TestParseSyslogRule(t *testing.T) {
+	rule, err := ParseSyslogRule("network-alerts facility=local0,daemon,3 severity=warning from=10.0.0.0/8,192.168.1.1 priority=5 token=tk_abc")
+	require.Nil(t, err)
+	require.Equal(t, "network-alerts", rule.Topic)
+	require.Equal(t, []int{16, 3, 3}, rule.Facilities)
+	require.Equal(t, 4, rule.Severity)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.1/32")}, rule.From)
+	require.Equal(t, 5, rule.Priority)
+	require.Equal(t, "tk_abc", rule.Token)
+
+	rule, err = ParseSyslogRule("  alerts  ")
+	require.Nil(t, err)
+	require.Equal(t, "alerts", rule.Topic)
+	require.Nil(t, rule.Facilities)
+	require.Equal(t, 7, rule.Severity)
+	require.Equal(t, 0, rule.Priority)
+
+	for _, spec := range []string{
+		"",
+		"invalid/topic",
+		"alerts facility=nope",
+		"alerts facility=24",
+		"alerts severity=fatal",
+		"alerts severity=8",
+		"alerts from=10.0.0.0/33",
+		"alerts from=example.com",
+		"alerts priority=6",
+		"alerts unknown=1",
+		"alerts severity",
+	} {
+		_, err := ParseSyslogRule(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestParseSyslogMessage(t *testing.T) {
+	// RFC 3164
+	m := parseSyslogMessage([]byte("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8\n"))
+	require.Equal(t, &syslogMessage{facility: 4, severity: 2, hostname: "mymachine", app: "su", message: "'su root' failed for lonvick on /dev/pts/8"}, m)
+	require.Equal(t, "su on mymachine", m.title())
+	require.Equal(t, "auth,crit", m.tags())
+
+	// RFC 3164 without timestamp and hostname, as sent by many devices
+	m = parseSyslogMessage([]byte("<131>ifmgr: WAN link down"))
+	require.Equal(t, &syslogMessage{facility: 16, severity: 3, app: "ifmgr", message: "WAN link down"}, m)
+	require.Equal(t, "ifmgr", m.title())
+
+	// RFC 5424, with structured data and BOM
+	m = parseSyslogMessage([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App\]lication"] ` + "\uFEFFAn application event log entry"))
+	require.Equal(t, &syslogMessage{facility: 20, severity: 5, hostname: "mymachine.example.com", app: "evntslog", message: "An application event log entry"}, m)
+
+	// RFC 5424, without structured data and app name
+	m = parseSyslogMessage([]byte("<14>1 2003-10-11T22:14:15.003Z ups01 - - - - Battery low"))
+	require.Equal(t, &syslogMessage{facility: 1, severity: 6, hostname: "ups01", message: "Battery low"}, m)
+	require.Equal(t, "ups01", m.title())
+
+	// Plain text, and invalid PRI
+	m = parseSyslogMessage([]byte("Backup failed: disk full\r\n"))
+	require.Equal(t, &syslogMessage{facility: 1, severity: 5, message: "Backup failed: disk full"}, m)
+	require.Equal(t, "", m.title())
+	require.Equal(t, "user,notice", m.tags())
+	m = parseSyslogMessage([]byte("<999>Not really syslog"))
+	require.Equal(t, &syslogMessage{facility: 1, severity: 5, message: "<999>Not really syslog"}, m)
+}
+
+func TestServer_SyslogDatagram_Rules(t *testing.T) {
+	c := newTestConfig(t)
+	c.SyslogRules = []*SyslogRule{
+		mustParseSyslogRule(t, "lan facility=local0 severity=warning from=10.0.0.0/8"),
+		mustParseSyslogRule(t, "pager severity=crit priority=2"),
+	}
+	s := newTestServer(t, c)
+	lan := &net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 514}
+	wan := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 514}
+
+	s.handleSyslogDatagram(lan, []byte("<132>Oct 11 22:14:15 switch01 stp: Topology change"))      // local0.warning -> lan
+	s.handleSyslogDatagram(lan, []byte("<133>Oct 11 22:14:15 switch01 stp: Port up"))              // local0.notice -> dropped
+	s.handleSyslogDatagram(wan, []byte("<132>Oct 11 22:14:15 switch02 stp: Topology change"))      // Wrong sender -> dropped
+	s.handleSyslogDatagram(wan, []byte("<130>Oct 11 22:14:15 switch02 kernel: Fan failure"))       // local0.crit -> pager
+	s.handleSyslogDatagram(lan, []byte("<3>Oct 11 22:14:15 switch01 kernel: Out of memory"))       // kern.err -> dropped
+	s.handleSyslogDatagram(lan, []byte("<128>Oct 11 22:14:15 switch01 kernel:    \n"))             // Empty -> dropped
+	s.handleSyslogDatagram(wan, []byte("<8>1 2003-10-11T22:14:15.003Z fw01 - - - - Under attack")) // user.emerg -> pager
+
+	messages := toMessages(t, request(t, s, "GET", "/lan/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "Topology change", messages[0].Message)
+	require.Equal(t, "stp on switch01", messages[0].Title)
+	require.Equal(t, 3, messages[0].Priority)
+	require.Equal(t, []string{"local0", "warning"}, messages[0].Tags)
+
+	messages = toMessages(t, request(t, s, "GET", "/pager/json?poll=1", "", nil).Body.String())
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "Fan failure", messages[0].Message)
+	require.Equal(t, 2, messages[0].Priority)
+	require.Equal(t, "Under attack", messages[1].Message)
+	require.Equal(t, "fw01", messages[1].Title)
+}
+
+func TestServer_SyslogDatagram_Token(t *testing.T) {
+	c := newTestConfigWithAuthFile(t)
+	c.AuthDefault = user.PermissionDenyAll
+	s := newTestServer(t, c)
+	defer s.closeDatabases()
+	require.Nil(t, s.userManager.AddUser("phil", "phil", user.RoleUser, false))
+	require.Nil(t, s.userManager.AllowAccess("phil", "alerts", user.PermissionReadWrite))
+	u, err := s.userManager.User("phil")
+	require.Nil(t, err)
+	token, err := s.userManager.CreateToken(u.ID, "", time.Unix(0, 0), netip.IPv4Unspecified(), false)
+	require.Nil(t, err)
+	addr := &net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 514}
+
+	s.config.SyslogRules = []*SyslogRule{mustParseSyslogRule(t, "alerts")}
+	s.handleSyslogDatagram(addr, []byte("Anonymous, rejected"))
+	s.config.SyslogRules = []*SyslogRule{mustParseSyslogRule(t, "alerts token="+token.Value)}
+	s.handleSyslogDatagram(addr, []byte("With token"))
+
+	messages, err := s.messageCache.Messages("alerts", sinceAllMessages, false)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, "With token", messages[0].Message)
+}
+
+func TestServer_SyslogListener(t *testing.T) {
+	c := newTestConfig(t)
+	c.SyslogListen = "127.0.0.1:0"
+	c.SyslogRules = []*SyslogRule{mustParseSyslogRule(t, "alerts")}
+	s := newTestServer(t, c)
+	require.Nil(t, s.listen())
+	go runDatagramListener(s.syslogConn, s.handleSyslogDatagram)
+	defer s.closeListeners()
+
+	conn, err := net.Dial("udp", s.syslogConn.LocalAddr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("<11>Oct 11 22:14:15 nas01 backup: Backup failed"))
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		messages, err := s.messageCache.Messages("alerts", sinceAllMessages, false)
+		return err == nil && len(messages) == 1 && messages[0].Message == "Backup failed"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func mustParseSyslogRule(t *testing.T, spec string) *SyslogRule {
+	rule, err := ParseSyslogRule(spec)
+	require.Nil(t, err)
+	return rule
+}
@@ -104,6 +104,7 @@ func (t *topic) Unsubscribe(id int) {
 
 // Publish asynchronously publishes to all subscribers
 func (t *topic) Publish(v *visitor, m *message) error {
+	m.published = time.Now()
 	go func() {
 		// We want to lock the topic as short as possible, so we make a shallow copy of the
 		// subscribers map here. Actually sending out the messages then doesn't have to lock.
@@ -152,6 +153,15 @@ func (t *topic) CancelSubscribersExceptUser(exceptUserID string) {
 	}
 }
 
+// CancelSubscribers calls the cancel function for all subscribers, forcing them to reconnect
+func (t *topic) CancelSubscribers() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.subscribers {
+		t.cancelUserSubscriber(s)
+	}
+}
+
 // CancelSubscriberUser kills the subscriber with the given user ID
 func (t *topic) CancelSubscriberUser(userID string) {
 	t.mu.RLock()
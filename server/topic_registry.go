@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// topicRegistryShards is the number of shards of the topic registry. Creating and deleting topics locks
+	// only a single shard, so concurrent subscribers to new topics rarely wait for each other.
+	topicRegistryShards = 64
+)
+
+var (
+	errTopicLimitReached = errors.New("total topic limit reached")
+)
+
+// topicRegistry holds all in-memory topics of the server, see topic. It is sharded by topic ID to support
+// hundreds of thousands of topics without lock contention: lookups of existing topics (the hot path when
+// publishing and subscribing) are lock-free, and only creating and deleting topics locks the topic's shard.
+type topicRegistry struct {
+	shards [topicRegistryShards]*topicRegistryShard
+	count  atomic.Int64
+}
+
+type topicRegistryShard struct {
+	topics sync.Map   // Topic ID -> *topic
+	mu     sync.Mutex // Serializes creating and deleting topics in this shard
+}
+
+func newTopicRegistry() *topicRegistry {
+	r := &topicRegistry{}
+	for i := range r.shards {
+		r.shards[i] = &topicRegistryShard{}
+	}
+	return r
+}
+
+// Get returns the topic with the given ID, or nil if it does not exist. It does not lock.
+func (r *topicRegistry) Get(id string) *topic {
+	if t, ok := r.shard(id).topics.Load(id); ok {
+		return t.(*topic)
+	}
+	return nil
+}
+
+// GetOrCreate returns the topic with the given ID, creating it if it does not exist. If limit is greater than
+// zero, and the registry already holds limit topics, no new topic is created and errTopicLimitReached is returned.
+func (r *topicRegistry) GetOrCreate(id string, limit int) (*topic, error) {
+	if t := r.Get(id); t != nil {
+		return t, nil
+	}
+	shard := r.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if t, ok := shard.topics.Load(id); ok {
+		return t.(*topic), nil // Created concurrently
+	}
+	if count := r.count.Add(1); limit > 0 && count > int64(limit) {
+		r.count.Add(-1)
+		return nil, errTopicLimitReached
+	}
+	t := newTopic(id)
+	shard.topics.Store(id, t)
+	return t, nil
+}
+
+// Add adds the given topic to the registry, replacing an existing topic with the same ID
+func (r *topicRegistry) Add(t *topic) {
+	shard := r.shard(t.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, loaded := shard.topics.Swap(t.ID, t); !loaded {
+		r.count.Add(1)
+	}
+}
+
+// DeleteIf removes the given topic from the registry if the given function returns true. The function is called
+// while the topic's shard is locked, so the topic cannot be replaced or deleted concurrently.
+func (r *topicRegistry) DeleteIf(t *topic, f func(t *topic) bool) bool {
+	shard := r.shard(t.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if !f(t) {
+		return false
+	}
+	if shard.topics.CompareAndDelete(t.ID, t) {
+		r.count.Add(-1)
+		return true
+	}
+	return false
+}
+
+// Range calls f for every topic in the registry, until f returns false. Topics that are created or deleted
+// while iterating may or may not be visited.
+func (r *topicRegistry) Range(f func(t *topic) bool) {
+	for _, shard := range r.shards {
+		stopped := false
+		shard.topics.Range(func(_, t any) bool {
+			if !f(t.(*topic)) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Len returns the number of topics in the registry
+func (r *topicRegistry) Len() int {
+	return int(r.count.Load())
+}
+
+// shard returns the shard of the given topic ID, using the FNV-1a hash of the ID
+func (r *topicRegistry) shard(id string) *topicRegistryShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		hash ^= uint32(id[i])
+		hash *= 16777619
+	}
+	return r.shards[hash%topicRegistryShards]
+}
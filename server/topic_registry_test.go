@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicRegistry_GetOrCreate(t *testing.T) {
+	r := newTopicRegistry()
+	require.Nil(t, r.Get("mytopic"))
+
+	t1, err := r.GetOrCreate("mytopic", 2)
+	require.Nil(t, err)
+	t2, err := r.GetOrCreate("mytopic", 2)
+	require.Nil(t, err)
+	require.Same(t, t1, t2)
+	require.Same(t, t1, r.Get("mytopic"))
+
+	_, err = r.GetOrCreate("othertopic", 2)
+	require.Nil(t, err)
+	_, err = r.GetOrCreate("thirdtopic", 2)
+	require.Equal(t, errTopicLimitReached, err)
+	require.Nil(t, r.Get("thirdtopic"))
+	require.Equal(t, 2, r.Len())
+
+	_, err = r.GetOrCreate("mytopic", 2) // Existing topics are returned even if the limit is reached
+	require.Nil(t, err)
+}
+
+func TestTopicRegistry_Concurrent(t *testing.T) {
+	r := newTopicRegistry()
+	var wg sync.WaitGroup
+	created := make([]*topic, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := r.GetOrCreate(fmt.Sprintf("topic%d", j), 0)
+				require.Nil(t, err)
+			}
+			created[i], _ = r.GetOrCreate("shared", 0)
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 101, r.Len())
+	for _, t1 := range created {
+		require.Same(t, created[0], t1)
+	}
+}
+
+func TestTopicRegistry_AddDeleteRange(t *testing.T) {
+	r := newTopicRegistry()
+	for i := 0; i < 10; i++ {
+		r.Add(newTopic(fmt.Sprintf("topic%d", i)))
+	}
+	replaced := newTopic("topic0")
+	r.Add(replaced)
+	require.Equal(t, 10, r.Len())
+	require.Same(t, replaced, r.Get("topic0"))
+
+	visited := 0
+	r.Range(func(t *topic) bool {
+		visited++
+		return visited < 3
+	})
+	require.Equal(t, 3, visited)
+
+	require.False(t, r.DeleteIf(replaced, func(t *topic) bool { return false }))
+	require.False(t, r.DeleteIf(newTopic("topic1"), func(t *topic) bool { return true })) // Not the registered topic
+	require.True(t, r.DeleteIf(replaced, func(t *topic) bool { return true }))
+	require.Nil(t, r.Get("topic0"))
+	require.Equal(t, 9, r.Len())
+}
@@ -1,8 +1,13 @@
 package server
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 
 	"heckel.io/ntfy/v2/log"
@@ -12,36 +17,48 @@ import (
 
 // List of possible events
 const (
-	openEvent        = "open"
-	keepaliveEvent   = "keepalive"
-	messageEvent     = "message"
-	pollRequestEvent = "poll_request"
+	openEvent              = "open"
+	keepaliveEvent         = "keepalive"
+	messageEvent           = "message"
+	pollRequestEvent       = "poll_request"
+	chunkEvent             = "chunk"
+	renamedEvent           = "topic_renamed"
+	messageExpiredEvent    = "message_expired"
+	attachmentExpiredEvent = "attachment_expired"
 )
 
 const (
 	messageIDLength = 12
 )
 
+// Message is a message as published to a topic, see Server.Publish
+type Message = message
+
 // message represents a message published to a topic
 type message struct {
-	ID          string      `json:"id"`                // Random message ID
-	Time        int64       `json:"time"`              // Unix time in seconds
-	Expires     int64       `json:"expires,omitempty"` // Unix time in seconds (not required for open/keepalive)
-	Event       string      `json:"event"`             // One of the above
-	Topic       string      `json:"topic"`
-	Title       string      `json:"title,omitempty"`
-	Message     string      `json:"message,omitempty"`
-	Priority    int         `json:"priority,omitempty"`
-	Tags        []string    `json:"tags,omitempty"`
-	Click       string      `json:"click,omitempty"`
-	Icon        string      `json:"icon,omitempty"`
-	Actions     []*action   `json:"actions,omitempty"`
-	Attachment  *attachment `json:"attachment,omitempty"`
-	PollID      string      `json:"poll_id,omitempty"`
-	ContentType string      `json:"content_type,omitempty"` // text/plain by default (if empty), or text/markdown
-	Encoding    string      `json:"encoding,omitempty"`     // empty for raw UTF-8, or "base64" for encoded bytes
-	Sender      netip.Addr  `json:"-"`                      // IP address of uploader, used for rate limiting
-	User        string      `json:"-"`                      // UserID of the uploader, used to associated attachments
+	ID          string            `json:"id"`                // Random message ID
+	Time        int64             `json:"time"`              // Unix time in seconds
+	Expires     int64             `json:"expires,omitempty"` // Unix time in seconds (not required for open/keepalive)
+	Event       string            `json:"event"`             // One of the above
+	Topic       string            `json:"topic"`
+	Title       string            `json:"title,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Priority    int               `json:"priority,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Click       string            `json:"click,omitempty"`
+	Icon        string            `json:"icon,omitempty"`
+	Actions     []*action         `json:"actions,omitempty"`
+	Attachment  *attachment       `json:"attachment,omitempty"`
+	PollID      string            `json:"poll_id,omitempty"`
+	ContentType string            `json:"content_type,omitempty"` // text/plain by default (if empty), or text/markdown
+	Encoding    string            `json:"encoding,omitempty"`     // empty for raw UTF-8, or "base64" for encoded bytes
+	Subscribers int               `json:"subscribers,omitempty"`  // Number of connected subscribers (open event only, for topic owners)
+	ExpiredID   string            `json:"expired_id,omitempty"`   // ID of the expired message (message_expired/attachment_expired events only)
+	Metadata    map[string]string `json:"metadata,omitempty"`     // Custom key/value fields, see readMetadataParams
+	Resume      string            `json:"resume,omitempty"`       // Resume token (message event on subscribe streams only), see resumeToken
+	Sender      netip.Addr        `json:"-"`                      // IP address of uploader, used for rate limiting
+	User        string            `json:"-"`                      // UserID of the uploader, used to associated attachments
+	published   time.Time         // Time the message was handed to the topic's subscribers, used for delivery latency metrics
 }
 
 func (m *message) Context() log.Context {
@@ -91,22 +108,23 @@ func newAction() *action {
 
 // publishMessage is used as input when publishing as JSON
 type publishMessage struct {
-	Topic    string   `json:"topic"`
-	Title    string   `json:"title"`
-	Message  string   `json:"message"`
-	Priority int      `json:"priority"`
-	Tags     []string `json:"tags"`
-	Click    string   `json:"click"`
-	Icon     string   `json:"icon"`
-	Actions  []action `json:"actions"`
-	Attach   string   `json:"attach"`
-	Markdown bool     `json:"markdown"`
-	Filename string   `json:"filename"`
-	Email    string   `json:"email"`
-	Call     string   `json:"call"`
-	Cache    string   `json:"cache"`    // use string as it defaults to true (or use &bool instead)
-	Firebase string   `json:"firebase"` // use string as it defaults to true (or use &bool instead)
-	Delay    string   `json:"delay"`
+	Topic    string            `json:"topic"`
+	Title    string            `json:"title"`
+	Message  string            `json:"message"`
+	Priority int               `json:"priority"`
+	Tags     []string          `json:"tags"`
+	Click    string            `json:"click"`
+	Icon     string            `json:"icon"`
+	Actions  []action          `json:"actions"`
+	Attach   string            `json:"attach"`
+	Markdown bool              `json:"markdown"`
+	Filename string            `json:"filename"`
+	Email    string            `json:"email"`
+	Call     string            `json:"call"`
+	Cache    string            `json:"cache"`    // use string as it defaults to true (or use &bool instead)
+	Firebase string            `json:"firebase"` // use string as it defaults to true (or use &bool instead)
+	Delay    string            `json:"delay"`
+	Metadata map[string]string `json:"metadata"`
 }
 
 // messageEncoder is a function that knows how to encode a message
@@ -138,6 +156,28 @@ func newDefaultMessage(topic, msg string) *message {
 	return newMessage(messageEvent, topic, msg)
 }
 
+// newChunkMessage creates a message that confirms the receipt of a chunk of an incomplete chunked message.
+// It is only returned to the publisher, and never published or cached.
+func newChunkMessage(topic, chunkID string) *message {
+	m := newMessage(chunkEvent, topic, "")
+	m.ID = chunkID
+	return m
+}
+
+// newTopicRenamedMessage creates a message that tells subscribers of a deprecated topic alias to switch to the
+// new topic name, see Server.sendTopicRenamedMessages
+func newTopicRenamedMessage(alias *user.TopicAlias) *message {
+	return newMessage(renamedEvent, alias.Alias, fmt.Sprintf("Topic %s was renamed to %s, please subscribe to %s instead", alias.Alias, alias.Topic, alias.Topic))
+}
+
+// newExpiredMessage creates a message_expired or attachment_expired event, which tells subscribers that a message
+// (or its attachment) was deleted from the cache, see Config.ExpirationEvents. It is never cached.
+func newExpiredMessage(event, topic, expiredID string) *message {
+	m := newMessage(event, topic, "")
+	m.ExpiredID = expiredID
+	return m
+}
+
 // newPollRequestMessage is a convenience method to create a poll request message
 func newPollRequestMessage(topic, pollID string) *message {
 	m := newMessage(pollRequestEvent, topic, newMessageBody)
@@ -162,6 +202,31 @@ func newSinceID(id string) sinceMarker {
 	return sinceMarker{time.Unix(0, 0), id}
 }
 
+// resumeToken returns the opaque resume token of a message, which encodes its position in the topic (time and ID).
+// Clients pass the token of the last received message as since=<token> (or, for EventSource, as Last-Event-ID
+// header) to continue right after that message. Unlike a plain message ID, the token still works once the message
+// has been deleted from the cache, in which case the stream continues with the messages published since its time.
+func resumeToken(m *message) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", m.Time, m.ID)))
+}
+
+// parseResumeToken returns the since marker for a resume token (see resumeToken), or false if it is not a valid token
+func parseResumeToken(token string) (sinceMarker, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return sinceNoMessages, false
+	}
+	timestampStr, id, ok := strings.Cut(string(b), ":")
+	if !ok || !validMessageID(id) {
+		return sinceNoMessages, false
+	}
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil || timestamp < 0 {
+		return sinceNoMessages, false
+	}
+	return sinceMarker{time.Unix(timestamp, 0), id}, true
+}
+
 func (t sinceMarker) IsAll() bool {
 	return t == sinceAllMessages
 }
@@ -198,6 +263,7 @@ type queryFilter struct {
 	Title    string
 	Tags     []string
 	Priority []int
+	Metadata map[string]string
 }
 
 func parseQueryFilters(r *http.Request) (*queryFilter, error) {
@@ -213,12 +279,17 @@ func parseQueryFilters(r *http.Request) (*queryFilter, error) {
 		}
 		priorityFilter = append(priorityFilter, priority)
 	}
+	metadataFilter, err := readMetadataParams(r)
+	if err != nil {
+		return nil, err
+	}
 	return &queryFilter{
 		ID:       idFilter,
 		Message:  messageFilter,
 		Title:    titleFilter,
 		Tags:     tagsFilter,
 		Priority: priorityFilter,
+		Metadata: metadataFilter,
 	}, nil
 }
 
@@ -242,6 +313,11 @@ func (q *queryFilter) Pass(msg *message) bool {
 	if len(q.Tags) > 0 && !util.ContainsAll(msg.Tags, q.Tags) {
 		return false
 	}
+	for key, value := range q.Metadata {
+		if msg.Metadata[key] != value {
+			return false
+		}
+	}
 	return true
 }
 
@@ -294,29 +370,97 @@ type apiHealthResponse struct {
 	Healthy bool `json:"healthy"`
 }
 
+// Capabilities advertised via /v1/capabilities. Clients use them to leave out options that the server does not
+// support. Once added, a capability must never be renamed, since old clients rely on it.
+const (
+	capabilityAttachments   = "attachments"    // File attachments can be uploaded (attachment-cache-dir is set)
+	capabilityEmail         = "email"          // Messages can be forwarded via email (X-Email)
+	capabilityCalls         = "calls"          // Messages can be delivered via phone calls (X-Call)
+	capabilityMarkdown      = "markdown"       // Messages can be formatted as Markdown (X-Markdown)
+	capabilityTemplates     = "templates"      // Messages can be rendered from JSON via templates (X-Template)
+	capabilityActions       = "actions"        // Messages can have action buttons (X-Actions)
+	capabilityScheduled     = "scheduled"      // Messages can be scheduled for later delivery (X-Delay)
+	capabilityWebPush       = "web-push"       // Browsers can subscribe via web push
+	capabilityAccessControl = "access-control" // Topics can be protected via users, tokens and ACLs
+	capabilityChunked       = "chunked"        // Large messages can be published in chunks (X-Chunk-ID)
+	capabilityUploads       = "uploads"        // Attachments can be uploaded resumably via tus (X-Upload)
+	capabilityEphemeral     = "ephemeral"      // Ephemeral topics can be created via /v1/ephemeral
+	capabilityClaims        = "claims"         // Messages can be claimed and acknowledged (/<topic>/claim), requires the message cache
+	capabilityPresence      = "presence"       // Topic owners can see the number of subscribers (/<topic>/presence)
+)
+
+type apiCapabilitiesResponse struct {
+	Version                 string   `json:"version"`
+	Capabilities            []string `json:"capabilities"`
+	MessageSizeLimit        int      `json:"message_size_limit"`
+	MessageChunkedSizeLimit int      `json:"message_chunked_size_limit,omitempty"`
+	WebPushPublicKey        string   `json:"web_push_public_key,omitempty"`
+}
+
+// apiHomeAssistantResponse describes topics as Home Assistant notify services and event sources, see /v1/homeassistant
+type apiHomeAssistantResponse struct {
+	BaseURL string                    `json:"base_url"`
+	Notify  []*apiHomeAssistantNotify `json:"notify"`
+	Events  []*apiHomeAssistantEvent  `json:"events"`
+}
+
+// apiHomeAssistantNotify is a notify service using the Home Assistant "rest" notify platform
+type apiHomeAssistantNotify struct {
+	Name             string            `json:"name" yaml:"name"`
+	Platform         string            `json:"platform" yaml:"platform"`
+	Resource         string            `json:"resource" yaml:"resource"`
+	Method           string            `json:"method" yaml:"method"`
+	MessageParamName string            `json:"message_param_name" yaml:"message_param_name"`
+	TitleParamName   string            `json:"title_param_name" yaml:"title_param_name"`
+	Data             map[string]string `json:"data" yaml:"data"`
+}
+
+// apiHomeAssistantEvent describes how to subscribe to a topic, and which Home Assistant event to fire for each message
+type apiHomeAssistantEvent struct {
+	Topic     string `json:"topic"`
+	EventType string `json:"event_type"`
+	SSEURL    string `json:"sse_url"`
+	JSONURL   string `json:"json_url"`
+	PollURL   string `json:"poll_url"`
+}
+
 type apiStatsResponse struct {
 	Messages     int64   `json:"messages"`
-	MessagesRate float64 `json:"messages_rate"` // Average number of messages per second
+	MessagesRate float64 `json:"messages_rate"`          // Average number of messages per second
+	Topics       int     `json:"topics,omitempty"`       // Only with stats-read capability
+	Visitors     int     `json:"visitors,omitempty"`     // Only with stats-read capability
+	Users        int     `json:"users,omitempty"`        // Only with stats-read capability
+	Reservations int     `json:"reservations,omitempty"` // Only with stats-read capability
 }
 
 type apiUserAddOrUpdateRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Hash     string `json:"hash"`
-	Tier     string `json:"tier"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Hash        string `json:"hash"`
+	Tier        string `json:"tier"`
+	TierExpires int64  `json:"tier_expires,omitempty"` // Unix timestamp at which the tier expires, only valid if a tier is set
 	// Do not add 'role' here. We don't want to add admins via the API.
 }
 
 type apiUserResponse struct {
-	Username string                  `json:"username"`
-	Role     string                  `json:"role"`
-	Tier     string                  `json:"tier,omitempty"`
-	Grants   []*apiUserGrantResponse `json:"grants,omitempty"`
+	Username    string                  `json:"username"`
+	DisplayName string                  `json:"display_name,omitempty"`
+	Role        string                  `json:"role"`
+	Tier        string                  `json:"tier,omitempty"`
+	TierExpires int64                   `json:"tier_expires,omitempty"`
+	Grants      []*apiUserGrantResponse `json:"grants,omitempty"`
+}
+
+type apiUserReservationResponse struct {
+	Username string `json:"username"`
+	Topic    string `json:"topic"`
+	Everyone string `json:"everyone"`
 }
 
 type apiUserGrantResponse struct {
 	Topic      string `json:"topic"` // This may be a pattern
 	Permission string `json:"permission"`
+	Expires    int64  `json:"expires,omitempty"`
 }
 
 type apiUserDeleteRequest struct {
@@ -327,6 +471,7 @@ type apiAccessAllowRequest struct {
 	Username   string `json:"username"`
 	Topic      string `json:"topic"` // This may be a pattern
 	Permission string `json:"permission"`
+	Expires    int64  `json:"expires,omitempty"` // Unix timestamp after which the grant is revoked, 0 for never
 }
 
 type apiAccessResetRequest struct {
@@ -334,6 +479,16 @@ type apiAccessResetRequest struct {
 	Topic    string `json:"topic"`
 }
 
+type apiLogLevelRequest struct {
+	Level    string `json:"level"`
+	Duration string `json:"duration,omitempty"` // Time after which the log level is reverted, e.g. "30m"
+}
+
+type apiLogLevelResponse struct {
+	Level   string `json:"level"`
+	Expires int64  `json:"expires,omitempty"` // Unix timestamp at which a temporary log level is reverted
+}
+
 type apiAccountCreateRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -344,6 +499,20 @@ type apiAccountPasswordChangeRequest struct {
 	NewPassword string `json:"new_password"`
 }
 
+type apiAccountPasswordResetRequest struct {
+	Username string `json:"username"`
+}
+
+type apiAccountPasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type apiAccountEmailChangeRequest struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
 type apiAccountDeleteRequest struct {
 	Password string `json:"password"`
 }
@@ -360,12 +529,14 @@ type apiAccountTokenUpdateRequest struct {
 }
 
 type apiAccountTokenResponse struct {
-	Token       string `json:"token"`
-	Label       string `json:"label,omitempty"`
-	LastAccess  int64  `json:"last_access,omitempty"`
-	LastOrigin  string `json:"last_origin,omitempty"`
-	Expires     int64  `json:"expires,omitempty"`     // Unix timestamp
-	Provisioned bool   `json:"provisioned,omitempty"` // True if this token was provisioned by the server config
+	Token         string `json:"token"`
+	Label         string `json:"label,omitempty"`
+	LastAccess    int64  `json:"last_access,omitempty"`
+	LastOrigin    string `json:"last_origin,omitempty"`
+	LastUserAgent string `json:"last_user_agent,omitempty"`
+	Expires       int64  `json:"expires,omitempty"`     // Unix timestamp
+	Current       bool   `json:"current,omitempty"`     // True if this token was used to authenticate the request
+	Provisioned   bool   `json:"provisioned,omitempty"` // True if this token was provisioned by the server config
 }
 
 type apiAccountPhoneNumberVerifyRequest struct {
@@ -379,21 +550,24 @@ type apiAccountPhoneNumberAddRequest struct {
 }
 
 type apiAccountTier struct {
-	Code string `json:"code"`
-	Name string `json:"name"`
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Expires int64  `json:"expires,omitempty"` // Unix timestamp at which the tier expires, if any
 }
 
 type apiAccountLimits struct {
-	Basis                    string `json:"basis,omitempty"` // "ip" or "tier"
-	Messages                 int64  `json:"messages"`
-	MessagesExpiryDuration   int64  `json:"messages_expiry_duration"`
-	Emails                   int64  `json:"emails"`
-	Calls                    int64  `json:"calls"`
-	Reservations             int64  `json:"reservations"`
-	AttachmentTotalSize      int64  `json:"attachment_total_size"`
-	AttachmentFileSize       int64  `json:"attachment_file_size"`
-	AttachmentExpiryDuration int64  `json:"attachment_expiry_duration"`
-	AttachmentBandwidth      int64  `json:"attachment_bandwidth"`
+	Basis                    string   `json:"basis,omitempty"` // "ip", "tier" or "guest"
+	Messages                 int64    `json:"messages"`
+	MessagesExpiryDuration   int64    `json:"messages_expiry_duration"`
+	Emails                   int64    `json:"emails"`
+	Calls                    int64    `json:"calls"`
+	Reservations             int64    `json:"reservations"`
+	AttachmentTotalSize      int64    `json:"attachment_total_size"`
+	AttachmentFileSize       int64    `json:"attachment_file_size"`
+	AttachmentExpiryDuration int64    `json:"attachment_expiry_duration"`
+	AttachmentBandwidth      int64    `json:"attachment_bandwidth"`
+	AttachmentAllowedTypes   []string `json:"attachment_allowed_types,omitempty"`
+	AttachmentDeniedTypes    []string `json:"attachment_denied_types,omitempty"`
 }
 
 type apiAccountStats struct {
@@ -409,9 +583,58 @@ type apiAccountStats struct {
 	AttachmentTotalSizeRemaining int64 `json:"attachment_total_size_remaining"`
 }
 
+// apiAccountLimitsResponse is the current rate limiting state of the calling visitor, to help debug HTTP 429 errors
+type apiAccountLimitsResponse struct {
+	Visitor             string                 `json:"visitor"` // Visitor ID, e.g. "ip:1.2.3.4" or "user:u_..."
+	Basis               string                 `json:"basis"`   // Basis of the limits: ip, tier or guest
+	Exempt              bool                   `json:"exempt,omitempty"`
+	Requests            *apiAccountLimitStatus `json:"requests"`
+	Messages            *apiAccountLimitStatus `json:"messages"`
+	Emails              *apiAccountLimitStatus `json:"emails"`
+	Calls               *apiAccountLimitStatus `json:"calls"`
+	Subscriptions       *apiAccountLimitStatus `json:"subscriptions"`
+	AttachmentBandwidth *apiAccountLimitStatus `json:"attachment_bandwidth"`
+	AuthFailures        *apiAccountLimitStatus `json:"auth_failures,omitempty"`
+	Banned              *apiAccountLimitBans   `json:"banned,omitempty"`
+}
+
+type apiAccountLimitStatus struct {
+	Limit     int64  `json:"limit"`               // Daily limit, or burst of rate limits
+	Used      int64  `json:"used"`                // Used since the last daily reset
+	Remaining int64  `json:"remaining"`           // Number of events currently allowed
+	Algorithm string `json:"algorithm,omitempty"` // Only set for rate limits
+	Next      int64  `json:"next,omitempty"`      // Unix time at which the next event is allowed, only set if remaining is zero
+	Reset     int64  `json:"reset,omitempty"`     // Unix time at which the limit is reset (daily limits), or fully replenished (rate limits)
+}
+
+type apiAccountLimitBans struct {
+	Firebase int64 `json:"firebase,omitempty"` // Unix time until which messages are not forwarded to Firebase
+	Login    int64 `json:"login,omitempty"`    // Unix time until which logins are blocked after too many failed attempts
+}
+
 type apiAccountReservation struct {
-	Topic    string `json:"topic"`
-	Everyone string `json:"everyone"`
+	Topic    string                  `json:"topic"`
+	Everyone string                  `json:"everyone"`
+	Aliases  []*apiAccountTopicAlias `json:"aliases,omitempty"` // Former names of the topic, see handleAccountReservationRename
+}
+
+type apiAccountTopicAlias struct {
+	Alias      string `json:"alias"`
+	Deprecated bool   `json:"deprecated,omitempty"`
+}
+
+type apiAccountTopicStats struct {
+	Topic           string `json:"topic"`
+	Messages        int    `json:"messages"`
+	MessagesPerDay  int    `json:"messages_per_day"`
+	LastActivity    int64  `json:"last_activity,omitempty"`
+	CacheBytes      int64  `json:"cache_bytes"`
+	AttachmentBytes int64  `json:"attachment_bytes"`
+	Subscribers     int    `json:"subscribers"`
+}
+
+type apiAccountStatsResponse struct {
+	Topics []*apiAccountTopicStats `json:"topics"`
 }
 
 type apiAccountBilling struct {
@@ -423,17 +646,27 @@ type apiAccountBilling struct {
 	CancelAt     int64  `json:"cancel_at,omitempty"`
 }
 
+type apiAccountExportResponse struct {
+	*user.Export
+	Messages []*message `json:"messages"` // Cached messages on reserved topics
+}
+
 type apiAccountResponse struct {
 	Username      string                     `json:"username"`
 	Role          string                     `json:"role,omitempty"`
+	Capabilities  []string                   `json:"capabilities,omitempty"`
 	SyncTopic     string                     `json:"sync_topic,omitempty"`
 	Provisioned   bool                       `json:"provisioned,omitempty"`
+	Email         string                     `json:"email,omitempty"`
+	DisplayName   string                     `json:"display_name,omitempty"`
+	Avatar        string                     `json:"avatar,omitempty"`
 	Language      string                     `json:"language,omitempty"`
 	Notification  *user.NotificationPrefs    `json:"notification,omitempty"`
 	Subscriptions []*user.Subscription       `json:"subscriptions,omitempty"`
 	Reservations  []*apiAccountReservation   `json:"reservations,omitempty"`
 	Tokens        []*apiAccountTokenResponse `json:"tokens,omitempty"`
 	PhoneNumbers  []string                   `json:"phone_numbers,omitempty"`
+	Mutes         []*apiAccountTopicMute     `json:"mutes,omitempty"`
 	Tier          *apiAccountTier            `json:"tier,omitempty"`
 	Limits        *apiAccountLimits          `json:"limits,omitempty"`
 	Stats         *apiAccountStats           `json:"stats,omitempty"`
@@ -445,20 +678,146 @@ type apiAccountReservationRequest struct {
 	Everyone string `json:"everyone"`
 }
 
+type apiAccountReservationRenameRequest struct {
+	Topic      string `json:"topic"`                // New topic name
+	Deprecated bool   `json:"deprecated,omitempty"` // Tell clients using the old topic name to switch
+}
+
+type apiEphemeralTopicRequest struct {
+	TTL      string `json:"ttl"`      // Duration, e.g. "1h" or "2d"
+	Messages int    `json:"messages"` // Max number of messages, 0 means unlimited
+	Everyone string `json:"everyone"` // If set, the topic is reserved for the user, see apiAccountReservationRequest
+}
+
+type apiEphemeralTopicResponse struct {
+	Topic         string `json:"topic"`
+	Expires       int64  `json:"expires"`
+	MessagesLimit int    `json:"messages_limit,omitempty"`
+}
+
+type apiTopicPresenceResponse struct {
+	Topic       string `json:"topic"`
+	Subscribers int    `json:"subscribers"`
+}
+
+type apiClaimResponse struct {
+	Claim      string   `json:"claim"`
+	Expires    int64    `json:"expires"`
+	Deliveries int      `json:"deliveries"`
+	Message    *message `json:"message"`
+}
+
+type apiAccountInviteRequest struct {
+	Topic      string `json:"topic"`
+	Permission string `json:"permission"`
+	Uses       int64  `json:"uses,omitempty"`    // Number of times the invite can be redeemed, defaults to 1
+	Expires    int64  `json:"expires,omitempty"` // Unix timestamp
+}
+
+type apiAccountInviteResponse struct {
+	Token      string `json:"token"`
+	Topic      string `json:"topic"`
+	Permission string `json:"permission"`
+	Uses       int64  `json:"uses"`
+	UsesLimit  int64  `json:"uses_limit"`
+	Expires    int64  `json:"expires,omitempty"` // Unix timestamp
+	Created    int64  `json:"created"`           // Unix timestamp
+}
+
+type apiAccountInviteRedeemRequest struct {
+	Token string `json:"token"`
+}
+
+type apiAccountGuestTokenRequest struct {
+	Topic         string `json:"topic"`
+	Permission    string `json:"permission,omitempty"` // Defaults to write-only
+	Label         string `json:"label,omitempty"`
+	MessagesLimit int64  `json:"messages_limit,omitempty"` // Messages per day, defaults to user.DefaultGuestTokenMessageLimit
+	Expires       int64  `json:"expires,omitempty"`        // Unix timestamp
+}
+
+type apiAccountGuestTokenResponse struct {
+	Token         string `json:"token"`
+	Topic         string `json:"topic"`
+	Permission    string `json:"permission"`
+	Label         string `json:"label,omitempty"`
+	MessagesLimit int64  `json:"messages_limit"`
+	Expires       int64  `json:"expires,omitempty"` // Unix timestamp
+	Created       int64  `json:"created"`           // Unix timestamp
+}
+
+type apiAccountTopicSchemaRequest struct {
+	Schema json.RawMessage `json:"schema"`
+	Mode   string          `json:"mode,omitempty"` // Defaults to "reject"
+}
+
+type apiAccountTopicSchemaResponse struct {
+	Topic  string          `json:"topic"`
+	Schema json.RawMessage `json:"schema"`
+	Mode   string          `json:"mode"`
+}
+
+type apiAccountTopicEscalationRequest struct {
+	MinPriority int                              `json:"min_priority,omitempty"` // Defaults to 1, i.e. all messages
+	Steps       []*apiAccountTopicEscalationStep `json:"steps"`
+}
+
+type apiAccountTopicEscalationStep struct {
+	After    string `json:"after"` // Duration after publishing, e.g. "5m"
+	Priority int    `json:"priority,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Call     string `json:"call,omitempty"` // Phone number, or "yes" for the first verified phone number
+}
+
+type apiAccountTopicEscalationResponse struct {
+	Topic       string                           `json:"topic"`
+	MinPriority int                              `json:"min_priority"`
+	Steps       []*apiAccountTopicEscalationStep `json:"steps"`
+}
+
+type apiAccountTopicSilenceRequest struct {
+	Start   int64  `json:"start,omitempty"`  // Unix timestamp, defaults to now
+	End     int64  `json:"end"`              // Unix timestamp
+	Repeat  string `json:"repeat,omitempty"` // "daily" or "weekly", empty if the window does not repeat
+	Summary bool   `json:"summary,omitempty"`
+}
+
+type apiAccountTopicSilenceResponse struct {
+	ID      string `json:"id"`
+	Topic   string `json:"topic"`
+	Start   int64  `json:"start"` // Unix timestamp
+	End     int64  `json:"end"`   // Unix timestamp
+	Repeat  string `json:"repeat,omitempty"`
+	Summary bool   `json:"summary,omitempty"`
+	Active  bool   `json:"active"`
+}
+
+type apiAccountTopicMuteRequest struct {
+	Topic string `json:"topic"`
+	Until int64  `json:"until"` // Unix timestamp
+}
+
+type apiAccountTopicMute struct {
+	Topic string `json:"topic"`
+	Until int64  `json:"until"` // Unix timestamp
+}
+
 type apiConfigResponse struct {
-	BaseURL            string   `json:"base_url"`
-	AppRoot            string   `json:"app_root"`
-	EnableLogin        bool     `json:"enable_login"`
-	RequireLogin       bool     `json:"require_login"`
-	EnableSignup       bool     `json:"enable_signup"`
-	EnablePayments     bool     `json:"enable_payments"`
-	EnableCalls        bool     `json:"enable_calls"`
-	EnableEmails       bool     `json:"enable_emails"`
-	EnableReservations bool     `json:"enable_reservations"`
-	EnableWebPush      bool     `json:"enable_web_push"`
-	BillingContact     string   `json:"billing_contact"`
-	WebPushPublicKey   string   `json:"web_push_public_key"`
-	DisallowedTopics   []string `json:"disallowed_topics"`
+	BaseURL             string   `json:"base_url"`
+	AppRoot             string   `json:"app_root"`
+	EnableLogin         bool     `json:"enable_login"`
+	RequireLogin        bool     `json:"require_login"`
+	EnableSignup        bool     `json:"enable_signup"`
+	EnablePayments      bool     `json:"enable_payments"`
+	EnableCalls         bool     `json:"enable_calls"`
+	EnableEmails        bool     `json:"enable_emails"`
+	EnableReservations  bool     `json:"enable_reservations"`
+	EnablePasswordReset bool     `json:"enable_password_reset"`
+	EnableWebPush       bool     `json:"enable_web_push"`
+	BillingContact      string   `json:"billing_contact"`
+	WebPushPublicKey    string   `json:"web_push_public_key"`
+	DisallowedTopics    []string `json:"disallowed_topics"`
 }
 
 type apiAccountBillingPrices struct {
@@ -490,6 +849,15 @@ type apiAccountSyncTopicResponse struct {
 	Event string `json:"event"`
 }
 
+type apiTierExpiryWebhookEvent struct {
+	Event    string `json:"event"` // "tier_expiring" or "tier_downgraded"
+	Time     int64  `json:"time"`
+	Username string `json:"username"`
+	Tier     string `json:"tier"`               // Code of the (expiring or expired) tier
+	NewTier  string `json:"new_tier,omitempty"` // Code of the tier the user was downgraded to, if any
+	Expires  int64  `json:"expires"`
+}
+
 type apiSuccessResponse struct {
 	Success bool `json:"success"`
 }
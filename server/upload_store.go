@@ -0,0 +1,222 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"heckel.io/ntfy/v2/log"
+	"heckel.io/ntfy/v2/util"
+)
+
+// Resumable uploads implement the tus protocol (https://tus.io/protocols/resumable-upload), so that large
+// attachments can be uploaded over flaky connections: the client creates an upload of a known length, and
+// then sends the file in one or more PATCH requests. If a request fails, the client asks the server for the
+// current offset, and continues from there. Once the upload is complete, the client publishes a message with
+// the X-Upload header, and the server turns the uploaded file into the attachment of the message.
+//
+// Incomplete uploads are stored in a subdirectory of the attachment cache dir, and are not counted towards
+// the attachment limits until they are published. Upload metadata is held in memory only, so uploads do
+// not survive a server restart.
+
+const (
+	uploadIDPrefix           = "up_"
+	uploadIDLength           = 32
+	uploadsDirName           = "uploads"
+	uploadExpiryDuration     = 24 * time.Hour // Incomplete or unpublished uploads are deleted after this time
+	uploadsPerVisitorLimit   = 10             // Max number of unpublished uploads per visitor
+	uploadMetadataMaxLength  = 2048           // Max length of the Upload-Metadata header
+	uploadFilenameMaxLength  = 255
+	tusVersion               = "1.0.0"
+	tusExtensions            = "creation,expiration,termination"
+	tusContentType           = "application/offset+octet-stream"
+	tusExposedHeadersForCORS = "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires"
+)
+
+// upload is an incomplete or unpublished resumable upload, see uploadStore
+type upload struct {
+	ID       string
+	Owner    string // User ID or IP address of the uploader
+	Filename string // From the Upload-Metadata header, may be empty
+	Length   int64
+	Offset   int64
+	Expires  time.Time
+	writing  bool // True while a PATCH request is appending to the upload
+}
+
+// Complete returns true if all bytes of the upload have been received
+func (u *upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// uploadStore holds the metadata of resumable uploads in memory, and their content in a directory
+type uploadStore struct {
+	dir     string
+	uploads map[string]*upload
+	mu      sync.Mutex
+}
+
+// newUploadStore creates the upload directory. Since upload metadata is not persisted, leftover uploads
+// from a previous run are removed.
+func newUploadStore(dir string) (*uploadStore, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &uploadStore{
+		dir:     dir,
+		uploads: make(map[string]*upload),
+	}, nil
+}
+
+// Create creates an empty upload of the given length for the owner
+func (s *uploadStore) Create(owner, filename string, length int64) (*upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.countNoLock(owner) >= uploadsPerVisitorLimit {
+		return nil, errHTTPTooManyRequestsLimitUploads
+	}
+	u := &upload{
+		ID:       util.RandomLowerStringPrefix(uploadIDPrefix, uploadIDLength),
+		Owner:    owner,
+		Filename: filename,
+		Length:   length,
+		Expires:  time.Now().Add(uploadExpiryDuration),
+	}
+	f, err := os.OpenFile(s.file(u.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	s.uploads[u.ID] = u
+	return u.copy(), nil
+}
+
+// Get returns a copy of the upload with the given ID, if it belongs to the owner
+func (s *uploadStore) Get(id, owner string) (*upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.getNoLock(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	return u.copy(), nil
+}
+
+// Append appends the content of in to the upload, if offset matches the current offset of the upload. Reading
+// stops at the length of the upload. If reading fails halfway, the bytes received so far are kept, so that the
+// client can resume from the new offset. It returns a copy of the updated upload.
+func (s *uploadStore) Append(id, owner string, offset int64, in io.Reader) (*upload, error) {
+	s.mu.Lock()
+	u, err := s.getNoLock(id, owner)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	} else if u.writing || u.Offset != offset {
+		s.mu.Unlock()
+		return nil, errHTTPConflictUploadOffset
+	}
+	u.writing = true
+	remaining := u.Length - u.Offset
+	s.mu.Unlock()
+	written, err := s.append(id, in, remaining)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.writing = false
+	u.Offset += written
+	if err != nil {
+		return nil, err
+	}
+	return u.copy(), nil
+}
+
+func (s *uploadStore) append(id string, in io.Reader, remaining int64) (int64, error) {
+	f, err := os.OpenFile(s.file(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	written, err := io.Copy(f, io.LimitReader(in, remaining))
+	if err != nil {
+		return written, err
+	}
+	return written, f.Close()
+}
+
+// Open opens the content of a complete upload for reading
+func (s *uploadStore) Open(id, owner string) (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.getNoLock(id, owner)
+	if err != nil {
+		return nil, err
+	} else if u.writing || !u.Complete() {
+		return nil, errHTTPBadRequestUploadIncomplete
+	}
+	return os.Open(s.file(id))
+}
+
+// Remove deletes the upload and its content, if it belongs to the owner
+func (s *uploadStore) Remove(id, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.getNoLock(id, owner); err != nil {
+		return err
+	}
+	s.removeNoLock(id)
+	return nil
+}
+
+// Prune deletes all expired uploads, and returns the number of deleted uploads
+func (s *uploadStore) Prune() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pruned int
+	for id, u := range s.uploads {
+		if !u.writing && time.Now().After(u.Expires) {
+			s.removeNoLock(id)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+func (s *uploadStore) getNoLock(id, owner string) (*upload, error) {
+	u, ok := s.uploads[id]
+	if !ok || u.Owner != owner || time.Now().After(u.Expires) {
+		return nil, errHTTPNotFoundUpload
+	}
+	return u, nil
+}
+
+func (s *uploadStore) removeNoLock(id string) {
+	delete(s.uploads, id)
+	if err := os.Remove(s.file(id)); err != nil {
+		log.Tag(tagFileCache).Field("upload_id", id).Err(err).Debug("Error deleting upload")
+	}
+}
+
+func (s *uploadStore) countNoLock(owner string) int {
+	var count int
+	for _, u := range s.uploads {
+		if u.Owner == owner {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *uploadStore) file(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (u *upload) copy() *upload {
+	c := *u
+	return &c
+}
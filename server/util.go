@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"mime"
 	"net/http"
 	"net/netip"
@@ -46,11 +47,31 @@ func toBool(value string) bool {
 	return value == "1" || value == "yes" || value == "true"
 }
 
-func readCommaSeparatedParam(r *http.Request, names ...string) []string {
-	if paramStr := readParam(r, names...); paramStr != "" {
-		return util.Map(util.SplitNoEmpty(paramStr, ","), strings.TrimSpace)
+// readTagsParam reads a list of tags, separated by commas or whitespace (see util.SplitTags), and converts emoji
+// shortcodes like ":tada:" to their tag name ("tada"), so that clients can render them. Unknown shortcodes are
+// rejected, suggesting the closest emoji name.
+func readTagsParam(r *http.Request, names ...string) ([]string, *errHTTP) {
+	tags := util.SplitTags(readParam(r, names...))
+	if len(tags) == 0 {
+		return tags, nil
 	}
-	return []string{}
+	emojiMap, err := loadEmojis()
+	if err != nil {
+		return nil, errHTTPInternalError
+	}
+	for i, tag := range tags {
+		if len(tag) > 2 && strings.HasPrefix(tag, ":") && strings.HasSuffix(tag, ":") {
+			name := strings.ToLower(strings.Trim(tag, ":"))
+			if _, ok := emojiMap[name]; ok {
+				tags[i] = name
+			} else if suggestion := util.ClosestMatch(name, maps.Keys(emojiMap), 2); suggestion != "" {
+				return nil, errHTTPBadRequestTagInvalid.Wrap("unknown emoji %q, did you mean \":%s:\"?", tag, suggestion)
+			} else {
+				return nil, errHTTPBadRequestTagInvalid.Wrap("unknown emoji %q", tag)
+			}
+		}
+	}
+	return tags, nil
 }
 
 func readParam(r *http.Request, names ...string) string {
@@ -196,3 +217,40 @@ func maybeIgnoreSpecialHeader(name, value string) string {
 	}
 	return value
 }
+
+// attachmentTypeAllowed returns true if the given attachment content type (e.g. "image/png", or
+// "text/plain; charset=utf-8") is allowed by the given MIME type patterns. If allowed is empty, all types
+// are allowed unless denied. Patterns may use a wildcard subtype, e.g. "video/*".
+func attachmentTypeAllowed(allowed, denied []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if len(allowed) > 0 && !contentTypeMatchesAny(allowed, mediaType) {
+		return false
+	}
+	return !contentTypeMatchesAny(denied, mediaType)
+}
+
+func contentTypeMatchesAny(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if pattern == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONContentType returns true if the given content type is a JSON media type, e.g. "application/json",
+// "application/json; charset=utf-8" or "application/geo+json"
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
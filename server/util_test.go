@@ -162,3 +162,15 @@ func TestVisitorID(t *testing.T) {
 	require.Equal(t, "ip:1.2.0.0", visitorID(netip.MustParseAddr("1.2.3.4"), nil, confWithShortenedPrefixes))
 	require.Equal(t, "ip:2a01:599:b26:2300::", visitorID(netip.MustParseAddr("2a01:599:b26:2397:dbe7:5aa2:95ce:1e83"), nil, confWithShortenedPrefixes))
 }
+
+func TestAttachmentTypeAllowed(t *testing.T) {
+	require.True(t, attachmentTypeAllowed(nil, nil, "video/mp4"))
+	require.True(t, attachmentTypeAllowed([]string{"image/*", "application/pdf"}, nil, "image/png"))
+	require.True(t, attachmentTypeAllowed([]string{"image/*", "application/pdf"}, nil, "application/pdf"))
+	require.False(t, attachmentTypeAllowed([]string{"image/*", "application/pdf"}, nil, "application/zip"))
+	require.False(t, attachmentTypeAllowed(nil, []string{"video/*"}, "video/mp4"))
+	require.True(t, attachmentTypeAllowed(nil, []string{"video/*"}, "text/plain; charset=utf-8"))
+	require.False(t, attachmentTypeAllowed(nil, []string{"text/plain"}, "text/plain; charset=utf-8"))
+	require.False(t, attachmentTypeAllowed([]string{"image/*"}, []string{"image/svg+xml"}, "image/svg+xml"))
+	require.False(t, attachmentTypeAllowed([]string{"image/*"}, nil, "imagex/png"))
+}
@@ -42,6 +42,14 @@ const (
 	visitorMessageToRequestLimitReplenishFactor = 2
 )
 
+// Constants used to convert a guest token's MessageLimit (see user.GuestToken) into request limiter values.
+// Unlike for tiers, these values are only used to decrease the values in server.yml, never increase them.
+const (
+	visitorGuestRequestLimitBurstRate       = 0.1
+	visitorGuestRequestLimitBurstMin        = 10
+	visitorGuestRequestLimitReplenishFactor = 2
+)
+
 // Constants used to convert a tier-user's EmailLimit (see user.Tier) into adequate email limiter
 // values (token bucket). Example: Assuming a user.Tier's EmailLimit is 200, the allowed burst is
 // 40 (= 200 * 20%), which is <150 (the max).
@@ -52,22 +60,38 @@ const (
 
 // visitor represents an API user, and its associated rate.Limiter used for rate limiting
 type visitor struct {
-	config              *Config
-	messageCache        *messageCache
-	userManager         *user.Manager      // May be nil
-	ip                  netip.Addr         // Visitor IP address
-	user                *user.User         // Only set if authenticated user, otherwise nil
-	requestLimiter      *rate.Limiter      // Rate limiter for (almost) all requests (including messages)
-	messagesLimiter     *util.FixedLimiter // Rate limiter for messages
-	emailsLimiter       *util.RateLimiter  // Rate limiter for emails
-	callsLimiter        *util.FixedLimiter // Rate limiter for calls
-	subscriptionLimiter *util.FixedLimiter // Fixed limiter for active subscriptions (ongoing connections)
-	bandwidthLimiter    *util.RateLimiter  // Limiter for attachment bandwidth downloads
-	accountLimiter      *rate.Limiter      // Rate limiter for account creation, may be nil
-	authLimiter         *rate.Limiter      // Limiter for incorrect login attempts, may be nil
-	firebase            time.Time          // Next allowed Firebase message
-	seen                time.Time          // Last seen time of this visitor (needed for removal of stale visitors)
-	mu                  sync.RWMutex
+	config               *Config
+	messageCache         *messageCache
+	userManager          *user.Manager      // May be nil
+	ip                   netip.Addr         // Visitor IP address
+	user                 *user.User         // Only set if authenticated user, otherwise nil
+	guest                *user.GuestToken   // Only set if authenticated with a guest token, otherwise nil
+	requestLimiter       *util.RateLimiter  // Rate limiter for (almost) all requests (including messages)
+	messagesLimiter      *util.FixedLimiter // Rate limiter for messages
+	emailsLimiter        *util.RateLimiter  // Rate limiter for emails
+	callsLimiter         *util.FixedLimiter // Rate limiter for calls
+	subscriptionLimiter  *util.FixedLimiter // Fixed limiter for active subscriptions (ongoing connections)
+	bandwidthLimiter     *util.RateLimiter  // Limiter for attachment bandwidth downloads
+	accountLimiter       *util.RateLimiter  // Rate limiter for account creation, may be nil
+	authLimiter          *util.RateLimiter  // Limiter for incorrect login attempts, may be nil
+	passwordResetLimiter *util.RateLimiter  // Rate limiter for password reset emails, may be nil
+	firebase             time.Time          // Next allowed Firebase message
+	seen                 time.Time          // Last seen time of this visitor (needed for removal of stale visitors)
+	mu                   sync.RWMutex
+}
+
+// visitorLimiters is a snapshot of a visitor's limiters, see visitor.Limiters
+type visitorLimiters struct {
+	ID            string
+	Exempt        bool // Visitor is exempt from request and message limits, see Config.VisitorRequestExemptPrefixes
+	Request       *util.RateLimiter
+	Messages      *util.FixedLimiter
+	Emails        *util.RateLimiter
+	Calls         *util.FixedLimiter
+	Subscriptions *util.FixedLimiter
+	Bandwidth     *util.RateLimiter
+	Auth          *util.RateLimiter // May be nil
+	FirebaseUntil time.Time         // Firebase messages are not forwarded until this time, see FirebaseTemporarilyDeny
 }
 
 type visitorInfo struct {
@@ -90,6 +114,8 @@ type visitorLimits struct {
 	AttachmentFileSizeLimit  int64
 	AttachmentExpiryDuration time.Duration
 	AttachmentBandwidthLimit int64
+	AttachmentAllowedTypes   []string // MIME type patterns; all types are allowed if empty
+	AttachmentDeniedTypes    []string // MIME type patterns
 }
 
 type visitorStats struct {
@@ -106,12 +132,13 @@ type visitorStats struct {
 }
 
 // visitorLimitBasis describes how the visitor limits were derived, either from a user's
-// IP address (default config), or from its tier
+// IP address (default config), from its tier, or from a guest token
 type visitorLimitBasis string
 
 const (
-	visitorLimitBasisIP   = visitorLimitBasis("ip")
-	visitorLimitBasisTier = visitorLimitBasis("tier")
+	visitorLimitBasisIP    = visitorLimitBasis("ip")
+	visitorLimitBasisTier  = visitorLimitBasis("tier")
+	visitorLimitBasisGuest = visitorLimitBasis("guest")
 )
 
 func newVisitor(conf *Config, messageCache *messageCache, userManager *user.Manager, ip netip.Addr, user *user.User) *visitor {
@@ -122,26 +149,36 @@ func newVisitor(conf *Config, messageCache *messageCache, userManager *user.Mana
 		calls = user.Stats.Calls
 	}
 	v := &visitor{
-		config:              conf,
-		messageCache:        messageCache,
-		userManager:         userManager, // May be nil
-		ip:                  ip,
-		user:                user,
-		firebase:            time.Unix(0, 0),
-		seen:                time.Now(),
-		subscriptionLimiter: util.NewFixedLimiter(int64(conf.VisitorSubscriptionLimit)),
-		requestLimiter:      nil, // Set in resetLimiters
-		messagesLimiter:     nil, // Set in resetLimiters, may be nil
-		emailsLimiter:       nil, // Set in resetLimiters
-		callsLimiter:        nil, // Set in resetLimiters, may be nil
-		bandwidthLimiter:    nil, // Set in resetLimiters
-		accountLimiter:      nil, // Set in resetLimiters, may be nil
-		authLimiter:         nil, // Set in resetLimiters, may be nil
+		config:               conf,
+		messageCache:         messageCache,
+		userManager:          userManager, // May be nil
+		ip:                   ip,
+		user:                 user,
+		firebase:             time.Unix(0, 0),
+		seen:                 time.Now(),
+		subscriptionLimiter:  util.NewFixedLimiter(int64(conf.VisitorSubscriptionLimit)),
+		requestLimiter:       nil, // Set in resetLimiters
+		messagesLimiter:      nil, // Set in resetLimiters, may be nil
+		emailsLimiter:        nil, // Set in resetLimiters
+		callsLimiter:         nil, // Set in resetLimiters, may be nil
+		bandwidthLimiter:     nil, // Set in resetLimiters
+		accountLimiter:       nil, // Set in resetLimiters, may be nil
+		authLimiter:          nil, // Set in resetLimiters, may be nil
+		passwordResetLimiter: nil, // Set in resetLimiters, may be nil
 	}
 	v.resetLimitersNoLock(messages, emails, calls, false)
 	return v
 }
 
+func newGuestVisitor(conf *Config, messageCache *messageCache, userManager *user.Manager, ip netip.Addr, guest *user.GuestToken) *visitor {
+	v := newVisitor(conf, messageCache, userManager, ip, nil)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.guest = guest
+	v.resetLimitersNoLock(0, 0, 0, false)
+	return v
+}
+
 func (v *visitor) Context() log.Context {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
@@ -151,7 +188,7 @@ func (v *visitor) Context() log.Context {
 func (v *visitor) contextNoLock() log.Context {
 	info := v.infoLightNoLock()
 	fields := log.Context{
-		"visitor_id":                     visitorID(v.ip, v.user, v.config),
+		"visitor_id":                     v.idNoLock(),
 		"visitor_ip":                     v.ip.String(),
 		"visitor_seen":                   util.FormatTime(v.seen),
 		"visitor_messages":               info.Stats.Messages,
@@ -160,6 +197,9 @@ func (v *visitor) contextNoLock() log.Context {
 		"visitor_request_limiter_limit":  v.requestLimiter.Limit(),
 		"visitor_request_limiter_tokens": v.requestLimiter.Tokens(),
 	}
+	if algorithm := v.requestLimiter.Algorithm(); algorithm != util.RateAlgorithmTokenBucket {
+		fields["visitor_request_limiter_algorithm"] = algorithm
+	}
 	if v.config.SMTPSenderFrom != "" {
 		fields["visitor_emails"] = info.Stats.Emails
 		fields["visitor_emails_limit"] = info.Limits.EmailLimit
@@ -174,6 +214,11 @@ func (v *visitor) contextNoLock() log.Context {
 		fields["visitor_auth_limiter_limit"] = v.authLimiter.Limit()
 		fields["visitor_auth_limiter_tokens"] = v.authLimiter.Tokens()
 	}
+	if v.guest != nil {
+		for field, value := range v.guest.Context() {
+			fields[field] = value
+		}
+	}
 	if v.user != nil {
 		fields["user_id"] = v.user.ID
 		fields["user_name"] = v.user.Name
@@ -283,6 +328,16 @@ func (v *visitor) AccountCreated() {
 	}
 }
 
+// PasswordResetAllowed returns true if a password reset email can be requested, and decreases the limiter
+func (v *visitor) PasswordResetAllowed() bool {
+	v.mu.RLock() // limiters could be replaced!
+	defer v.mu.RUnlock()
+	if v.passwordResetLimiter == nil {
+		return false
+	}
+	return v.passwordResetLimiter.Allow()
+}
+
 func (v *visitor) BandwidthAllowed(bytes int64) bool {
 	v.mu.RLock() // limiters could be replaced!
 	defer v.mu.RUnlock()
@@ -307,6 +362,25 @@ func (v *visitor) BandwidthLimiter() util.Limiter {
 	return v.bandwidthLimiter
 }
 
+// Limiters returns a snapshot of the visitor's limiters. The limiters themselves are safe for concurrent
+// use, but they may be replaced when the visitor's user or tier changes (see resetLimitersNoLock).
+func (v *visitor) Limiters() *visitorLimiters {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return &visitorLimiters{
+		ID:            v.idNoLock(),
+		Exempt:        util.ContainsIP(v.config.VisitorRequestExemptPrefixes, v.ip),
+		Request:       v.requestLimiter,
+		Messages:      v.messagesLimiter,
+		Emails:        v.emailsLimiter,
+		Calls:         v.callsLimiter,
+		Subscriptions: v.subscriptionLimiter,
+		Bandwidth:     v.bandwidthLimiter,
+		Auth:          v.authLimiter,
+		FirebaseUntil: v.firebase,
+	}
+}
+
 func (v *visitor) Stale() bool {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
@@ -338,6 +412,13 @@ func (v *visitor) User() *user.User {
 	return v.user // May be nil
 }
 
+// Guest returns the guest token the visitor authenticated with, or nil if there is none
+func (v *visitor) Guest() *user.GuestToken {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.guest // May be nil
+}
+
 // IP returns the visitor IP address
 func (v *visitor) IP() netip.Addr {
 	v.mu.RLock()
@@ -380,17 +461,23 @@ func (v *visitor) MaybeUserID() string {
 
 func (v *visitor) resetLimitersNoLock(messages, emails, calls int64, enqueueUpdate bool) {
 	limits := v.limitsNoLock()
-	v.requestLimiter = rate.NewLimiter(limits.RequestLimitReplenish, limits.RequestLimitBurst)
+	v.requestLimiter = util.NewRateLimiterWithAlgorithm(v.rateAlgorithm(VisitorRateLimitRequest), limits.RequestLimitReplenish, limits.RequestLimitBurst, 0)
 	v.messagesLimiter = util.NewFixedLimiterWithValue(limits.MessageLimit, messages)
-	v.emailsLimiter = util.NewRateLimiterWithValue(limits.EmailLimitReplenish, limits.EmailLimitBurst, emails)
+	v.emailsLimiter = util.NewRateLimiterWithAlgorithm(v.rateAlgorithm(VisitorRateLimitEmail), limits.EmailLimitReplenish, limits.EmailLimitBurst, emails)
 	v.callsLimiter = util.NewFixedLimiterWithValue(limits.CallLimit, calls)
-	v.bandwidthLimiter = util.NewBytesLimiter(int(limits.AttachmentBandwidthLimit), oneDay)
-	if v.user == nil {
-		v.accountLimiter = rate.NewLimiter(rate.Every(v.config.VisitorAccountCreationLimitReplenish), v.config.VisitorAccountCreationLimitBurst)
-		v.authLimiter = rate.NewLimiter(rate.Every(v.config.VisitorAuthFailureLimitReplenish), v.config.VisitorAuthFailureLimitBurst)
+	v.bandwidthLimiter = util.NewBytesLimiterWithAlgorithm(v.rateAlgorithm(VisitorRateLimitBandwidth), int(limits.AttachmentBandwidthLimit), oneDay)
+	if v.guest != nil {
+		v.accountLimiter = nil       // Guests cannot create accounts
+		v.authLimiter = nil          // Guests are already authenticated
+		v.passwordResetLimiter = nil // Guests do not have a password
+	} else if v.user == nil {
+		v.accountLimiter = util.NewRateLimiterWithAlgorithm(v.rateAlgorithm(VisitorRateLimitAccountCreation), rate.Every(v.config.VisitorAccountCreationLimitReplenish), v.config.VisitorAccountCreationLimitBurst, 0)
+		v.authLimiter = util.NewRateLimiterWithAlgorithm(v.rateAlgorithm(VisitorRateLimitAuthFailure), rate.Every(v.config.VisitorAuthFailureLimitReplenish), v.config.VisitorAuthFailureLimitBurst, 0)
+		v.passwordResetLimiter = util.NewRateLimiterWithAlgorithm(v.rateAlgorithm(VisitorRateLimitPasswordReset), rate.Every(v.config.VisitorPasswordResetLimitReplenish), v.config.VisitorPasswordResetLimitBurst, 0)
 	} else {
-		v.accountLimiter = nil // Users cannot create accounts when logged in
-		v.authLimiter = nil    // Users are already logged in, no need to limit requests
+		v.accountLimiter = nil       // Users cannot create accounts when logged in
+		v.authLimiter = nil          // Users are already logged in, no need to limit requests
+		v.passwordResetLimiter = nil // Users are already logged in, they can change their password
 	}
 	if enqueueUpdate && v.user != nil {
 		go v.userManager.EnqueueUserStats(v.user.ID, &user.Stats{
@@ -402,6 +489,14 @@ func (v *visitor) resetLimitersNoLock(messages, emails, calls int64, enqueueUpda
 	log.Fields(v.contextNoLock()).Debug("Rate limiters reset for visitor") // Must be after function, because contextNoLock() describes rate limiters
 }
 
+// rateAlgorithm returns the rate limiting algorithm for the given visitor rate limit, e.g. VisitorRateLimitRequest
+func (v *visitor) rateAlgorithm(limit string) util.RateAlgorithm {
+	if algorithm, ok := v.config.VisitorRateLimitAlgorithms[limit]; ok {
+		return algorithm
+	}
+	return v.config.VisitorRateLimitAlgorithm
+}
+
 func (v *visitor) Limits() *visitorLimits {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
@@ -409,7 +504,9 @@ func (v *visitor) Limits() *visitorLimits {
 }
 
 func (v *visitor) limitsNoLock() *visitorLimits {
-	if v.user != nil && v.user.Tier != nil {
+	if v.guest != nil {
+		return guestBasedVisitorLimits(v.config, v.guest)
+	} else if v.user != nil && v.user.Tier != nil {
 		return tierBasedVisitorLimits(v.config, v.user.Tier)
 	}
 	return configBasedVisitorLimits(v.config)
@@ -431,6 +528,29 @@ func tierBasedVisitorLimits(conf *Config, tier *user.Tier) *visitorLimits {
 		AttachmentFileSizeLimit:  tier.AttachmentFileSizeLimit,
 		AttachmentExpiryDuration: tier.AttachmentExpiryDuration,
 		AttachmentBandwidthLimit: tier.AttachmentBandwidthLimit,
+		AttachmentAllowedTypes:   tier.AttachmentAllowedTypes,
+		AttachmentDeniedTypes:    tier.AttachmentDeniedTypes,
+	}
+}
+
+// guestBasedVisitorLimits returns the limits for a visitor that authenticated with a guest token. Guests can
+// only publish a few messages per day, and cannot send emails, make calls, reserve topics or upload attachments.
+func guestBasedVisitorLimits(conf *Config, guest *user.GuestToken) *visitorLimits {
+	return &visitorLimits{
+		Basis:                    visitorLimitBasisGuest,
+		RequestLimitBurst:        util.MinMax(int(float64(guest.MessageLimit)*visitorGuestRequestLimitBurstRate), util.Min(visitorGuestRequestLimitBurstMin, conf.VisitorRequestLimitBurst), conf.VisitorRequestLimitBurst),
+		RequestLimitReplenish:    util.Min(rate.Every(conf.VisitorRequestLimitReplenish), dailyLimitToRate(guest.MessageLimit*visitorGuestRequestLimitReplenishFactor)),
+		MessageLimit:             guest.MessageLimit,
+		MessageExpiryDuration:    conf.CacheDuration,
+		EmailLimit:               0,
+		EmailLimitBurst:          0,
+		EmailLimitReplenish:      0,
+		CallLimit:                0,
+		ReservationsLimit:        0,
+		AttachmentTotalSizeLimit: 0,
+		AttachmentFileSizeLimit:  0,
+		AttachmentExpiryDuration: conf.AttachmentExpiryDuration,
+		AttachmentBandwidthLimit: 0,
 	}
 }
 
@@ -454,6 +574,8 @@ func configBasedVisitorLimits(conf *Config) *visitorLimits {
 		AttachmentFileSizeLimit:  conf.AttachmentFileSizeLimit,
 		AttachmentExpiryDuration: conf.AttachmentExpiryDuration,
 		AttachmentBandwidthLimit: conf.VisitorAttachmentDailyBandwidthLimit,
+		AttachmentAllowedTypes:   conf.VisitorAttachmentAllowedTypes,
+		AttachmentDeniedTypes:    conf.VisitorAttachmentDeniedTypes,
 	}
 }
 
@@ -524,6 +646,19 @@ func dailyLimitToRate(limit int64) rate.Limit {
 	return rate.Limit(limit) * rate.Every(oneDay)
 }
 
+func (v *visitor) idNoLock() string {
+	if v.guest != nil {
+		return guestVisitorID(v.guest)
+	}
+	return visitorID(v.ip, v.user, v.config)
+}
+
+// guestVisitorID returns a unique identifier for a visitor that authenticated with a guest token. All devices
+// using the same guest token share one visitor, and thereby one set of rate limits.
+func guestVisitorID(guest *user.GuestToken) string {
+	return fmt.Sprintf("guest:%s", guest.ID)
+}
+
 // visitorID returns a unique identifier for a visitor based on user or IP, using configurable prefix bits for IPv4/IPv6
 func visitorID(ip netip.Addr, u *user.User, conf *Config) string {
 	if u != nil && u.Tier != nil {
@@ -20,7 +20,7 @@ func StartServerWithConfig(t *testing.T, conf *server.Config) (*server.Server, i
 	conf.ListenHTTP = fmt.Sprintf(":%d", port)
 	conf.AttachmentCacheDir = t.TempDir()
 	conf.CacheFile = filepath.Join(t.TempDir(), "cache.db")
-	s, err := server.New(conf)
+	s, err := server.New(server.WithConfig(conf))
 	if err != nil {
 		t.Fatal(err)
 	}
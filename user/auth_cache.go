@@ -0,0 +1,119 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// authCacheMaxEntries is the number of entries after which expired entries are pruned from the cache
+const authCacheMaxEntries = 1000
+
+// authCache is an in-memory cache of successfully verified username/password combinations. It allows
+// high-rate publishers using basic auth to skip the (intentionally slow) bcrypt comparison on every request.
+//
+// The cache never stores the plaintext password. Entries are keyed by a SHA-256 hash of the credentials,
+// and hold the bcrypt hash of the user at the time of verification. A cache hit is only valid if the
+// user's current password hash still matches, so password changes invalidate entries implicitly.
+type authCache struct {
+	ttl     time.Duration
+	entries map[string]*authCacheEntry // Credentials hash -> entry
+	mu      sync.Mutex
+}
+
+type authCacheEntry struct {
+	userID   string
+	username string
+	hash     string // Password hash (bcrypt) of the user at the time of verification
+	expires  time.Time
+}
+
+func newAuthCache(ttl time.Duration) *authCache {
+	return &authCache{
+		ttl:     ttl,
+		entries: make(map[string]*authCacheEntry),
+	}
+}
+
+// Verified returns true if the given credentials were recently verified for a user with the given
+// password hash, i.e. if the bcrypt comparison can be skipped.
+func (c *authCache) Verified(username, password, hash string) bool {
+	if c.ttl <= 0 {
+		return false
+	}
+	key := authCacheKey(username, password)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return false
+	} else if entry.hash != hash || time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return false
+	}
+	return true
+}
+
+// Add remembers the given credentials as verified for the given user.
+func (c *authCache) Add(user *User, password string) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= authCacheMaxEntries {
+		c.pruneExpired()
+	}
+	c.entries[authCacheKey(user.Name, password)] = &authCacheEntry{
+		userID:   user.ID,
+		username: user.Name,
+		hash:     user.Hash,
+		expires:  time.Now().Add(c.ttl),
+	}
+}
+
+// RemoveUser removes all entries of the user with the given username.
+func (c *authCache) RemoveUser(username string) {
+	c.remove(func(entry *authCacheEntry) bool {
+		return entry.username == username
+	})
+}
+
+// RemoveUserID removes all entries of the user with the given user ID.
+func (c *authCache) RemoveUserID(userID string) {
+	c.remove(func(entry *authCacheEntry) bool {
+		return entry.userID == userID
+	})
+}
+
+// Size returns the number of entries in the cache, including expired ones.
+func (c *authCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *authCache) remove(matches func(entry *authCacheEntry) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if matches(entry) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *authCache) pruneExpired() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func authCacheKey(username, password string) string {
+	h := sha256.Sum256([]byte(username + "\x00" + password))
+	return hex.EncodeToString(h[:])
+}
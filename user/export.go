@@ -0,0 +1,193 @@
+package user
+
+import (
+	"time"
+)
+
+// Export is a machine-readable copy of all data stored about a user in the user database, e.g. to answer
+// data access or portability requests. Secrets (password hash, token values, invite and guest tokens) are not included.
+type Export struct {
+	Exported     int64                `json:"exported"`
+	Username     string               `json:"username"`
+	Role         string               `json:"role"`
+	Email        string               `json:"email,omitempty"`
+	Tier         string               `json:"tier,omitempty"`
+	TierExpires  int64                `json:"tier_expires,omitempty"`
+	Prefs        *Prefs               `json:"prefs,omitempty"`
+	Stats        *ExportStats         `json:"stats"`
+	Billing      *ExportBilling       `json:"billing,omitempty"`
+	Access       []*ExportGrant       `json:"access,omitempty"`
+	Reservations []*ExportReservation `json:"reservations,omitempty"`
+	Invites      []*ExportInvite      `json:"invites,omitempty"`
+	Tokens       []*ExportToken       `json:"tokens,omitempty"`
+	GuestTokens  []*ExportGuestToken  `json:"guest_tokens,omitempty"`
+	PhoneNumbers []string             `json:"phone_numbers,omitempty"`
+}
+
+// ExportStats contains the daily usage counters of a user
+type ExportStats struct {
+	Messages int64 `json:"messages"`
+	Emails   int64 `json:"emails"`
+	Calls    int64 `json:"calls"`
+}
+
+// ExportBilling contains the payment provider references of a user
+type ExportBilling struct {
+	StripeCustomerID     string `json:"stripe_customer_id,omitempty"`
+	StripeSubscriptionID string `json:"stripe_subscription_id,omitempty"`
+	Status               string `json:"status,omitempty"`
+	PaidUntil            int64  `json:"paid_until,omitempty"`
+}
+
+// ExportGrant is an access control entry of a user
+type ExportGrant struct {
+	Topic      string `json:"topic"`
+	Permission string `json:"permission"`
+	Expires    int64  `json:"expires,omitempty"`
+}
+
+// ExportReservation is a topic reserved by a user
+type ExportReservation struct {
+	Topic    string `json:"topic"`
+	Everyone string `json:"everyone"`
+}
+
+// ExportInvite is an invite created by a user, without the invite token itself
+type ExportInvite struct {
+	Topic      string `json:"topic"`
+	Permission string `json:"permission"`
+	Uses       int64  `json:"uses"`
+	UsesLimit  int64  `json:"uses_limit"`
+	Expires    int64  `json:"expires,omitempty"`
+	Created    int64  `json:"created"`
+}
+
+// ExportGuestToken is the metadata of a guest token created by a user, without the token value itself
+type ExportGuestToken struct {
+	Topic        string `json:"topic"`
+	Permission   string `json:"permission"`
+	Label        string `json:"label,omitempty"`
+	MessageLimit int64  `json:"messages_limit"`
+	Expires      int64  `json:"expires,omitempty"`
+	Created      int64  `json:"created"`
+}
+
+// ExportToken is the metadata of an access token of a user, without the token value itself
+type ExportToken struct {
+	Label         string `json:"label,omitempty"`
+	LastAccess    int64  `json:"last_access,omitempty"`
+	LastOrigin    string `json:"last_origin,omitempty"`
+	LastUserAgent string `json:"last_user_agent,omitempty"`
+	Expires       int64  `json:"expires,omitempty"`
+	Provisioned   bool   `json:"provisioned,omitempty"`
+}
+
+// Export collects all data stored about the given user in the user database. Messages are not
+// part of the user database, so they have to be added by the caller, if needed.
+//
+// Parameters:
+//   - username: The username of the user to export.
+//
+// Returns:
+//   - The Export, or an error (ErrUserNotFound if the user does not exist).
+func (a *Manager) Export(username string) (*Export, error) {
+	u, err := a.User(username)
+	if err != nil {
+		return nil, err
+	}
+	export := &Export{
+		Exported: time.Now().Unix(),
+		Username: u.Name,
+		Role:     string(u.Role),
+		Email:    u.Email,
+		Prefs:    u.Prefs,
+		Stats: &ExportStats{
+			Messages: u.Stats.Messages,
+			Emails:   u.Stats.Emails,
+			Calls:    u.Stats.Calls,
+		},
+	}
+	if u.Tier != nil {
+		export.Tier = u.Tier.Code
+		export.TierExpires = unixOrZeroInt64(u.TierExpires)
+	}
+	if u.Billing.StripeCustomerID != "" {
+		export.Billing = &ExportBilling{
+			StripeCustomerID:     u.Billing.StripeCustomerID,
+			StripeSubscriptionID: u.Billing.StripeSubscriptionID,
+			Status:               string(u.Billing.StripeSubscriptionStatus),
+			PaidUntil:            unixOrZeroInt64(u.Billing.StripeSubscriptionPaidUntil),
+		}
+	}
+	grants, err := a.Grants(username)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		export.Access = append(export.Access, &ExportGrant{
+			Topic:      g.TopicPattern,
+			Permission: g.Permission.String(),
+			Expires:    unixOrZeroInt64(g.Expires),
+		})
+	}
+	reservations, err := a.Reservations(username)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reservations {
+		export.Reservations = append(export.Reservations, &ExportReservation{
+			Topic:    r.Topic,
+			Everyone: r.Everyone.String(),
+		})
+	}
+	invites, err := a.Invites(username)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range invites {
+		export.Invites = append(export.Invites, &ExportInvite{
+			Topic:      i.Topic,
+			Permission: i.Permission.String(),
+			Uses:       i.Uses,
+			UsesLimit:  i.UsesLimit,
+			Expires:    unixOrZeroInt64(i.Expires),
+			Created:    i.Created.Unix(),
+		})
+	}
+	guests, err := a.GuestTokens(username)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range guests {
+		export.GuestTokens = append(export.GuestTokens, &ExportGuestToken{
+			Topic:        g.Topic,
+			Permission:   g.Permission.String(),
+			Label:        g.Label,
+			MessageLimit: g.MessageLimit,
+			Expires:      unixOrZeroInt64(g.Expires),
+			Created:      g.Created.Unix(),
+		})
+	}
+	tokens, err := a.Tokens(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		token := &ExportToken{
+			Label:         t.Label,
+			LastAccess:    unixOrZeroInt64(t.LastAccess),
+			LastUserAgent: t.LastUserAgent,
+			Expires:       unixOrZeroInt64(t.Expires),
+			Provisioned:   t.Provisioned,
+		}
+		if t.LastOrigin.IsValid() {
+			token.LastOrigin = t.LastOrigin.String()
+		}
+		export.Tokens = append(export.Tokens, token)
+	}
+	export.PhoneNumbers, err = a.PhoneNumbers(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
@@ -31,6 +31,21 @@ const (
 	tokenPrefix                     = "tk_"
 	tokenLength                     = 32
 	tokenMaxCount                   = 60 // Only keep this many tokens in the table per user
+	passwordResetTokenPrefix        = "pr_"
+	passwordResetTokenLength        = 32
+	inviteTokenPrefix               = "in_"
+	inviteTokenLength               = 32
+	inviteMaxCount                  = 60 // Only keep this many invites in the table per user
+	guestTokenPrefix                = "gt_"
+	guestTokenLength                = 32
+	guestTokenIDPrefix              = "g_"
+	guestTokenIDLength              = 12
+	guestTokenMaxCount              = 60 // Only keep this many guest tokens in the table per user
+	topicSilenceIDPrefix            = "si_"
+	topicSilenceIDLength            = 12
+	topicSilenceMaxCount            = 60  // Only keep this many silence windows in the table per user
+	topicMuteMaxCount               = 100 // Max number of muted topics per user
+	accessTemplateUsername          = "<username>"
 	tag                             = "user_manager"
 )
 
@@ -38,6 +53,9 @@ const (
 const (
 	DefaultUserStatsQueueWriterInterval = 33 * time.Second
 	DefaultUserPasswordBcryptCost       = 10
+	MaxUserPasswordBcryptCost           = bcrypt.MaxCost
+	DefaultUserAuthCacheTTL             = time.Minute
+	DefaultGuestTokenMessageLimit       = 100 // Messages per day, if not specified when creating a guest token
 )
 
 var (
@@ -63,18 +81,24 @@ const (
 			attachment_total_size_limit INT NOT NULL,
 			attachment_expiry_duration INT NOT NULL,
 			attachment_bandwidth_limit INT NOT NULL,
+			attachment_allowed_types TEXT NOT NULL DEFAULT (''),
+			attachment_denied_types TEXT NOT NULL DEFAULT (''),
 			stripe_monthly_price_id TEXT,
 			stripe_yearly_price_id TEXT
 		);
 		CREATE UNIQUE INDEX idx_tier_code ON tier (code);
 		CREATE UNIQUE INDEX idx_tier_stripe_monthly_price_id ON tier (stripe_monthly_price_id);
 		CREATE UNIQUE INDEX idx_tier_stripe_yearly_price_id ON tier (stripe_yearly_price_id);
+		CREATE TABLE IF NOT EXISTS role (
+			name TEXT PRIMARY KEY,
+			capabilities TEXT NOT NULL
+		);
 		CREATE TABLE IF NOT EXISTS user (
 		    id TEXT PRIMARY KEY,
 			tier_id TEXT,
 			user TEXT NOT NULL,
 			pass TEXT NOT NULL,
-			role TEXT CHECK (role IN ('anonymous', 'admin', 'user')) NOT NULL,
+			role TEXT NOT NULL,
 			prefs JSON NOT NULL DEFAULT '{}',
 			sync_topic TEXT NOT NULL,
 			provisioned INT NOT NULL,
@@ -89,6 +113,10 @@ const (
 			stripe_subscription_cancel_at INT,
 			created INT NOT NULL,
 			deleted INT,
+			email TEXT,
+			pass_expired INT NOT NULL DEFAULT (0),
+			tier_expires INT,
+			tier_expiry_warned INT NOT NULL DEFAULT (0),
 		    FOREIGN KEY (tier_id) REFERENCES tier (id)
 		);
 		CREATE UNIQUE INDEX idx_user ON user (user);
@@ -101,6 +129,7 @@ const (
 			write INT NOT NULL,
 			owner_user_id INT,
 			provisioned INT NOT NULL,
+			expires INT NOT NULL DEFAULT (0),
 			PRIMARY KEY (user_id, topic),
 			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
 		    FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
@@ -113,6 +142,7 @@ const (
 			last_origin TEXT NOT NULL,
 			expires INT NOT NULL,
 			provisioned INT NOT NULL,
+			last_user_agent TEXT NOT NULL DEFAULT (''),
 			PRIMARY KEY (user_id, token),
 			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
 		);
@@ -123,6 +153,91 @@ const (
 			PRIMARY KEY (user_id, phone_number),
 			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
 		);
+		CREATE TABLE IF NOT EXISTS user_password_reset (
+			token TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			expires INT NOT NULL,
+			PRIMARY KEY (token),
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS user_invite (
+			token TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			read INT NOT NULL,
+			write INT NOT NULL,
+			uses INT NOT NULL,
+			uses_limit INT NOT NULL,
+			expires INT NOT NULL,
+			created INT NOT NULL,
+			PRIMARY KEY (token),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS user_guest_token (
+			id TEXT NOT NULL,
+			token TEXT NOT NULL,
+			owner_user_id TEXT,
+			topic TEXT NOT NULL,
+			read INT NOT NULL,
+			write INT NOT NULL,
+			label TEXT NOT NULL,
+			messages_limit INT NOT NULL,
+			expires INT NOT NULL,
+			created INT NOT NULL,
+			PRIMARY KEY (id),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE UNIQUE INDEX idx_user_guest_token ON user_guest_token (token);
+		CREATE TABLE IF NOT EXISTS user_topic_schema (
+			topic TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			schema TEXT NOT NULL,
+			mode TEXT NOT NULL,
+			updated INT NOT NULL,
+			PRIMARY KEY (topic),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS user_topic_alias (
+			alias TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			deprecated INT NOT NULL,
+			created INT NOT NULL,
+			PRIMARY KEY (alias),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE INDEX idx_user_topic_alias_topic ON user_topic_alias (topic);
+		CREATE TABLE IF NOT EXISTS user_topic_silence (
+			id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			starts INT NOT NULL,
+			ends INT NOT NULL,
+			repeat TEXT NOT NULL,
+			summary INT NOT NULL,
+			summarized INT NOT NULL,
+			created INT NOT NULL,
+			PRIMARY KEY (id),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE INDEX idx_user_topic_silence_topic ON user_topic_silence (topic);
+		CREATE TABLE IF NOT EXISTS user_topic_escalation (
+			topic TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			min_priority INT NOT NULL,
+			steps TEXT NOT NULL,
+			updated INT NOT NULL,
+			PRIMARY KEY (topic),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS user_topic_mute (
+			user_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			until INT NOT NULL,
+			PRIMARY KEY (user_id, topic),
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE INDEX idx_user_topic_mute_topic ON user_topic_mute (topic);
 		CREATE TABLE IF NOT EXISTS schemaVersion (
 			id INT PRIMARY KEY,
 			version INT NOT NULL
@@ -138,35 +253,39 @@ const (
 	`
 
 	selectUserByIDQuery = `
-		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.provisioned, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
+		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.provisioned, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, u.email, u.pass_expired, u.tier_expires, u.tier_expiry_warned, r.capabilities, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.attachment_allowed_types, t.attachment_denied_types, t.stripe_monthly_price_id, t.stripe_yearly_price_id
 		FROM user u
 		LEFT JOIN tier t on t.id = u.tier_id
+		LEFT JOIN role r on r.name = u.role
 		WHERE u.id = ?
 	`
 	selectUserByNameQuery = `
-		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.provisioned, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
+		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.provisioned, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, u.email, u.pass_expired, u.tier_expires, u.tier_expiry_warned, r.capabilities, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.attachment_allowed_types, t.attachment_denied_types, t.stripe_monthly_price_id, t.stripe_yearly_price_id
 		FROM user u
 		LEFT JOIN tier t on t.id = u.tier_id
+		LEFT JOIN role r on r.name = u.role
 		WHERE user = ?
 	`
 	selectUserByTokenQuery = `
-		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.provisioned, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
+		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.provisioned, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, u.email, u.pass_expired, u.tier_expires, u.tier_expiry_warned, r.capabilities, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.attachment_allowed_types, t.attachment_denied_types, t.stripe_monthly_price_id, t.stripe_yearly_price_id
 		FROM user u
 		JOIN user_token tk on u.id = tk.user_id
 		LEFT JOIN tier t on t.id = u.tier_id
+		LEFT JOIN role r on r.name = u.role
 		WHERE tk.token = ? AND (tk.expires = 0 OR tk.expires >= ?)
 	`
 	selectUserByStripeCustomerIDQuery = `
-		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.provisioned, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.stripe_monthly_price_id, t.stripe_yearly_price_id
+		SELECT u.id, u.user, u.pass, u.role, u.prefs, u.sync_topic, u.provisioned, u.stats_messages, u.stats_emails, u.stats_calls, u.stripe_customer_id, u.stripe_subscription_id, u.stripe_subscription_status, u.stripe_subscription_interval, u.stripe_subscription_paid_until, u.stripe_subscription_cancel_at, deleted, u.email, u.pass_expired, u.tier_expires, u.tier_expiry_warned, r.capabilities, t.id, t.code, t.name, t.messages_limit, t.messages_expiry_duration, t.emails_limit, t.calls_limit, t.reservations_limit, t.attachment_file_size_limit, t.attachment_total_size_limit, t.attachment_expiry_duration, t.attachment_bandwidth_limit, t.attachment_allowed_types, t.attachment_denied_types, t.stripe_monthly_price_id, t.stripe_yearly_price_id
 		FROM user u
 		LEFT JOIN tier t on t.id = u.tier_id
+		LEFT JOIN role r on r.name = u.role
 		WHERE u.stripe_customer_id = ?
 	`
 	selectTopicPermsQuery = `
 		SELECT read, write
 		FROM user_access a
 		JOIN user u ON u.id = a.user_id
-		WHERE (u.user = ? OR u.user = ?) AND ? LIKE a.topic ESCAPE '\'
+		WHERE (u.user = ? OR u.user = ?) AND ? LIKE a.topic ESCAPE '\' AND (a.expires = 0 OR a.expires > ?)
 		ORDER BY u.user DESC, LENGTH(a.topic) DESC, a.write DESC
 	`
 
@@ -186,7 +305,10 @@ const (
 	`
 	selectUserCountQuery          = `SELECT COUNT(*) FROM user`
 	selectUserIDFromUsernameQuery = `SELECT id FROM user WHERE user = ?`
-	updateUserPassQuery           = `UPDATE user SET pass = ? WHERE user = ?`
+	updateUserPassQuery           = `UPDATE user SET pass = ?, pass_expired = 0 WHERE user = ?`
+	updateUserPassHashQuery       = `UPDATE user SET pass = ? WHERE user = ? AND pass = ?`
+	updateUserPassExpiredQuery    = `UPDATE user SET pass_expired = 1 WHERE user = ?`
+	updateUserEmailQuery          = `UPDATE user SET email = ? WHERE user = ?`
 	updateUserRoleQuery           = `UPDATE user SET role = ? WHERE user = ?`
 	updateUserProvisionedQuery    = `UPDATE user SET provisioned = ? WHERE user = ?`
 	updateUserPrefsQuery          = `UPDATE user SET prefs = ? WHERE id = ?`
@@ -197,20 +319,27 @@ const (
 	deleteUserQuery               = `DELETE FROM user WHERE user = ?`
 
 	upsertUserAccessQuery = `
-		INSERT INTO user_access (user_id, topic, read, write, owner_user_id, provisioned)
-		VALUES ((SELECT id FROM user WHERE user = ?), ?, ?, ?, (SELECT IIF(?='',NULL,(SELECT id FROM user WHERE user=?))), ?)
+		INSERT INTO user_access (user_id, topic, read, write, owner_user_id, provisioned, expires)
+		VALUES ((SELECT id FROM user WHERE user = ?), ?, ?, ?, (SELECT IIF(?='',NULL,(SELECT id FROM user WHERE user=?))), ?, ?)
 		ON CONFLICT (user_id, topic)
-		DO UPDATE SET read=excluded.read, write=excluded.write, owner_user_id=excluded.owner_user_id, provisioned=excluded.provisioned
+		DO UPDATE SET read=excluded.read, write=excluded.write, owner_user_id=excluded.owner_user_id, provisioned=excluded.provisioned, expires=excluded.expires
+	`
+	insertUserAccessIfNotExistsQuery = `
+		INSERT INTO user_access (user_id, topic, read, write, owner_user_id, provisioned, expires)
+		VALUES ((SELECT id FROM user WHERE user = ?), ?, ?, ?, (SELECT IIF(?='',NULL,(SELECT id FROM user WHERE user=?))), ?, ?)
+		ON CONFLICT (user_id, topic) DO NOTHING
 	`
 	selectUserAllAccessQuery = `
-		SELECT user_id, topic, read, write, provisioned
+		SELECT user_id, topic, read, write, provisioned, expires
 		FROM user_access
+		WHERE expires = 0 OR expires > ?
 		ORDER BY LENGTH(topic) DESC, write DESC, read DESC, topic
 	`
 	selectUserAccessQuery = `
-		SELECT topic, read, write, provisioned
+		SELECT topic, read, write, provisioned, expires
 		FROM user_access
 		WHERE user_id = (SELECT id FROM user WHERE user = ?)
+		  AND (expires = 0 OR expires > ?)
 		ORDER BY LENGTH(topic) DESC, write DESC, read DESC, topic
 	`
 	selectUserReservationsQuery = `
@@ -221,6 +350,13 @@ const (
 		  AND a_user.owner_user_id = (SELECT id FROM user WHERE user = ?)
 		ORDER BY a_user.topic
 	`
+	selectUserAllReservationsQuery = `
+		SELECT a_user.user_id, a_user.topic, a_user.read, a_user.write, a_everyone.read AS everyone_read, a_everyone.write AS everyone_write
+		FROM user_access a_user
+		LEFT JOIN  user_access a_everyone ON a_user.topic = a_everyone.topic AND a_everyone.user_id = (SELECT id FROM user WHERE user = ?)
+		WHERE a_user.user_id = a_user.owner_user_id
+		ORDER BY a_user.topic
+	`
 	selectUserReservationsCountQuery = `
 		SELECT COUNT(*)
 		FROM user_access
@@ -253,6 +389,8 @@ const (
 		   OR owner_user_id = (SELECT id FROM user WHERE user = ?)
 	`
 	deleteUserAccessProvisionedQuery = `DELETE FROM user_access WHERE provisioned = 1`
+	selectExpiredAccessQuery         = `SELECT user_id, topic, read, write, expires FROM user_access WHERE expires > 0 AND expires <= ?`
+	deleteExpiredAccessQuery         = `DELETE FROM user_access WHERE expires > 0 AND expires <= ?`
 	deleteTopicAccessQuery           = `
 		DELETE FROM user_access
 	   	WHERE (user_id = (SELECT id FROM user WHERE user = ?) OR owner_user_id = (SELECT id FROM user WHERE user = ?))
@@ -260,9 +398,9 @@ const (
   	`
 
 	selectTokenCountQuery           = `SELECT COUNT(*) FROM user_token WHERE user_id = ?`
-	selectTokensQuery               = `SELECT token, label, last_access, last_origin, expires, provisioned FROM user_token WHERE user_id = ?`
-	selectTokenQuery                = `SELECT token, label, last_access, last_origin, expires, provisioned FROM user_token WHERE user_id = ? AND token = ?`
-	selectAllProvisionedTokensQuery = `SELECT token, label, last_access, last_origin, expires, provisioned FROM user_token WHERE provisioned = 1`
+	selectTokensQuery               = `SELECT token, label, last_access, last_origin, last_user_agent, expires, provisioned FROM user_token WHERE user_id = ?`
+	selectTokenQuery                = `SELECT token, label, last_access, last_origin, last_user_agent, expires, provisioned FROM user_token WHERE user_id = ? AND token = ?`
+	selectAllProvisionedTokensQuery = `SELECT token, label, last_access, last_origin, last_user_agent, expires, provisioned FROM user_token WHERE provisioned = 1`
 	upsertTokenQuery                = `
 		INSERT INTO user_token (user_id, token, label, last_access, last_origin, expires, provisioned)
 		VALUES (?, ?, ?, ?, ?, ?, ?)
@@ -271,8 +409,9 @@ const (
 	`
 	updateTokenExpiryQuery      = `UPDATE user_token SET expires = ? WHERE user_id = ? AND token = ?`
 	updateTokenLabelQuery       = `UPDATE user_token SET label = ? WHERE user_id = ? AND token = ?`
-	updateTokenLastAccessQuery  = `UPDATE user_token SET last_access = ?, last_origin = ? WHERE token = ?`
+	updateTokenLastAccessQuery  = `UPDATE user_token SET last_access = ?, last_origin = ?, last_user_agent = ? WHERE token = ?`
 	deleteTokenQuery            = `DELETE FROM user_token WHERE user_id = ? AND token = ?`
+	deleteOtherTokensQuery      = `DELETE FROM user_token WHERE user_id = ? AND token != ? AND provisioned = 0`
 	deleteProvisionedTokenQuery = `DELETE FROM user_token WHERE token = ?`
 	deleteAllTokenQuery         = `DELETE FROM user_token WHERE user_id = ?`
 	deleteExpiredTokensQuery    = `DELETE FROM user_token WHERE expires > 0 AND expires < ?`
@@ -288,37 +427,232 @@ const (
 		)
 	`
 
+	insertPasswordResetTokenQuery         = `INSERT INTO user_password_reset (token, user_id, expires) VALUES (?, ?, ?)`
+	selectPasswordResetTokenUserIDQuery   = `SELECT user_id FROM user_password_reset WHERE token = ? AND expires >= ?`
+	deletePasswordResetTokensQuery        = `DELETE FROM user_password_reset WHERE user_id = ?`
+	deleteExpiredPasswordResetTokensQuery = `DELETE FROM user_password_reset WHERE expires < ?`
+
+	insertInviteQuery = `
+		INSERT INTO user_invite (token, owner_user_id, topic, read, write, uses, uses_limit, expires, created)
+		VALUES (?, (SELECT id FROM user WHERE user = ?), ?, ?, ?, 0, ?, ?, ?)
+	`
+	selectInvitesQuery = `
+		SELECT token, topic, read, write, uses, uses_limit, expires, created
+		FROM user_invite
+		WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)
+		ORDER BY created, topic
+	`
+	selectInviteCountQuery = `SELECT COUNT(*) FROM user_invite WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)`
+	selectValidInviteQuery = `
+		SELECT u.user, i.topic, i.read, i.write, i.uses, i.uses_limit, i.expires, i.created
+		FROM user_invite i
+		JOIN user u ON u.id = i.owner_user_id
+		WHERE i.token = ? AND i.uses < i.uses_limit AND (i.expires = 0 OR i.expires > ?)
+	`
+	updateInviteUsesQuery    = `UPDATE user_invite SET uses = uses + 1 WHERE token = ?`
+	deleteInviteQuery        = `DELETE FROM user_invite WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND token = ?`
+	deleteTopicInvitesQuery  = `DELETE FROM user_invite WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	deleteExcessInvitesQuery = `
+		DELETE FROM user_invite
+		WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)
+		  AND token NOT IN (
+			SELECT token
+			FROM user_invite
+			WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)
+			ORDER BY created DESC
+			LIMIT ?
+		)
+	`
+	deleteExpiredInvitesQuery = `DELETE FROM user_invite WHERE (expires > 0 AND expires <= ?) OR uses >= uses_limit`
+	deleteAllInvitesQuery     = `DELETE FROM user_invite WHERE owner_user_id = ?`
+
+	insertGuestTokenQuery = `
+		INSERT INTO user_guest_token (id, token, owner_user_id, topic, read, write, label, messages_limit, expires, created)
+		VALUES (?, ?, (SELECT id FROM user WHERE user = ?), ?, ?, ?, ?, ?, ?, ?)
+	`
+	selectGuestTokensQuery = `
+		SELECT g.id, g.token, COALESCE(u.user, ''), g.topic, g.read, g.write, g.label, g.messages_limit, g.expires, g.created
+		FROM user_guest_token g
+		LEFT JOIN user u ON u.id = g.owner_user_id
+		ORDER BY g.created, g.topic
+	`
+	selectGuestTokensByOwnerQuery = `
+		SELECT g.id, g.token, u.user, g.topic, g.read, g.write, g.label, g.messages_limit, g.expires, g.created
+		FROM user_guest_token g
+		JOIN user u ON u.id = g.owner_user_id
+		WHERE u.user = ?
+		ORDER BY g.created, g.topic
+	`
+	selectValidGuestTokenQuery = `
+		SELECT g.id, g.token, COALESCE(u.user, ''), g.topic, g.read, g.write, g.label, g.messages_limit, g.expires, g.created
+		FROM user_guest_token g
+		LEFT JOIN user u ON u.id = g.owner_user_id
+		WHERE g.token = ? AND (g.expires = 0 OR g.expires > ?)
+	`
+	selectGuestTokenCountQuery   = `SELECT COUNT(*) FROM user_guest_token WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)`
+	deleteGuestTokenQuery        = `DELETE FROM user_guest_token WHERE token = ?`
+	deleteOwnGuestTokenQuery     = `DELETE FROM user_guest_token WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND token = ?`
+	deleteTopicGuestTokensQuery  = `DELETE FROM user_guest_token WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	deleteExcessGuestTokensQuery = `
+		DELETE FROM user_guest_token
+		WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)
+		  AND id NOT IN (
+			SELECT id
+			FROM user_guest_token
+			WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)
+			ORDER BY created DESC
+			LIMIT ?
+		)
+	`
+	deleteExpiredGuestTokensQuery = `DELETE FROM user_guest_token WHERE expires > 0 AND expires <= ?`
+	deleteAllGuestTokensQuery     = `DELETE FROM user_guest_token WHERE owner_user_id = ?`
+
+	upsertTopicSchemaQuery = `
+		INSERT INTO user_topic_schema (topic, owner_user_id, schema, mode, updated)
+		VALUES (?, (SELECT id FROM user WHERE user = ?), ?, ?, ?)
+		ON CONFLICT (topic) DO UPDATE SET owner_user_id = excluded.owner_user_id, schema = excluded.schema, mode = excluded.mode, updated = excluded.updated
+	`
+	selectTopicSchemaQuery = `SELECT topic, schema, mode FROM user_topic_schema WHERE topic = ?`
+	deleteTopicSchemaQuery = `DELETE FROM user_topic_schema WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	renameTopicSchemaQuery = `UPDATE user_topic_schema SET topic = ? WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+
+	insertTopicAliasQuery = `
+		INSERT INTO user_topic_alias (alias, topic, owner_user_id, deprecated, created)
+		VALUES (?, ?, (SELECT id FROM user WHERE user = ?), ?, ?)
+	`
+	selectTopicAliasQuery   = `SELECT alias, topic, deprecated, created FROM user_topic_alias WHERE alias = ?`
+	selectTopicAliasesQuery = `
+		SELECT alias, topic, deprecated, created
+		FROM user_topic_alias
+		WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)
+		ORDER BY alias
+	`
+	selectTopicAliasesForTopicQuery = `SELECT alias, topic, deprecated, created FROM user_topic_alias WHERE topic = ? ORDER BY alias`
+	selectOtherTopicAliasCountQuery = `SELECT COUNT(*) FROM user_topic_alias WHERE alias = ? AND owner_user_id != (SELECT id FROM user WHERE user = ?)`
+	renameTopicAliasesQuery         = `UPDATE user_topic_alias SET topic = ? WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	deleteTopicAliasQuery           = `DELETE FROM user_topic_alias WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND alias = ?`
+	deleteTopicAliasesQuery         = `DELETE FROM user_topic_alias WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	renameTopicAccessQuery          = `UPDATE user_access SET topic = ? WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	renameTopicInvitesQuery         = `UPDATE user_invite SET topic = ? WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	renameTopicGuestTokensQuery     = `UPDATE user_guest_token SET topic = ? WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+
+	insertTopicSilenceQuery = `
+		INSERT INTO user_topic_silence (id, topic, owner_user_id, starts, ends, repeat, summary, summarized, created)
+		VALUES (?, ?, (SELECT id FROM user WHERE user = ?), ?, ?, ?, ?, 0, ?)
+	`
+	selectTopicSilencesQuery = `
+		SELECT s.id, u.user, s.topic, s.starts, s.ends, s.repeat, s.summary, s.summarized, s.created
+		FROM user_topic_silence s
+		JOIN user u ON u.id = s.owner_user_id
+		WHERE s.topic = ?
+		ORDER BY s.starts, s.id
+	`
+	selectTopicSilencesWithSummaryQuery = `
+		SELECT s.id, u.user, s.topic, s.starts, s.ends, s.repeat, s.summary, s.summarized, s.created
+		FROM user_topic_silence s
+		JOIN user u ON u.id = s.owner_user_id
+		WHERE s.summary = 1 AND s.starts <= ?
+		ORDER BY s.starts, s.id
+	`
+	updateTopicSilenceSummarizedQuery = `UPDATE user_topic_silence SET summarized = ? WHERE id = ?`
+	deleteTopicSilenceQuery           = `DELETE FROM user_topic_silence WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ? AND id = ?`
+	deleteTopicSilencesQuery          = `DELETE FROM user_topic_silence WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	deleteExpiredTopicSilencesQuery   = `DELETE FROM user_topic_silence WHERE repeat = '' AND ends <= ? AND (summary = 0 OR summarized >= ends)`
+	deleteExcessTopicSilencesQuery    = `
+		DELETE FROM user_topic_silence
+		WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)
+		  AND id NOT IN (
+			SELECT id
+			FROM user_topic_silence
+			WHERE owner_user_id = (SELECT id FROM user WHERE user = ?)
+			ORDER BY created DESC
+			LIMIT ?
+		)
+	`
+	renameTopicSilencesQuery = `UPDATE user_topic_silence SET topic = ? WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+
+	upsertTopicEscalationQuery = `
+		INSERT INTO user_topic_escalation (topic, owner_user_id, min_priority, steps, updated)
+		VALUES (?, (SELECT id FROM user WHERE user = ?), ?, ?, ?)
+		ON CONFLICT (topic) DO UPDATE SET owner_user_id = excluded.owner_user_id, min_priority = excluded.min_priority, steps = excluded.steps, updated = excluded.updated
+	`
+	selectTopicEscalationQuery = `
+		SELECT e.topic, u.user, e.min_priority, e.steps
+		FROM user_topic_escalation e
+		JOIN user u ON u.id = e.owner_user_id
+		WHERE e.topic = ?
+	`
+	deleteTopicEscalationQuery = `DELETE FROM user_topic_escalation WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+	renameTopicEscalationQuery = `UPDATE user_topic_escalation SET topic = ? WHERE owner_user_id = (SELECT id FROM user WHERE user = ?) AND topic = ?`
+
+	upsertTopicMuteQuery = `
+		INSERT INTO user_topic_mute (user_id, topic, until)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id, topic) DO UPDATE SET until = excluded.until
+	`
+	selectTopicMutesQuery        = `SELECT user_id, topic, until FROM user_topic_mute WHERE user_id = ? AND until > ? ORDER BY topic`
+	selectTopicMutesCountQuery   = `SELECT COUNT(*) FROM user_topic_mute WHERE user_id = ? AND topic != ? AND until > ?`
+	selectTopicMutedUserIDsQuery = `SELECT user_id FROM user_topic_mute WHERE topic = ? AND until > ?`
+	selectTopicMutedByEmailQuery = `
+		SELECT COUNT(*)
+		FROM user_topic_mute m
+		JOIN user u ON u.id = m.user_id
+		WHERE m.topic = ? AND m.until > ? AND u.email = ? COLLATE NOCASE
+	`
+	deleteTopicMuteQuery         = `DELETE FROM user_topic_mute WHERE user_id = ? AND topic = ?`
+	deleteExpiredTopicMutesQuery = `DELETE FROM user_topic_mute WHERE until <= ?`
+
 	selectPhoneNumbersQuery = `SELECT phone_number FROM user_phone WHERE user_id = ?`
 	insertPhoneNumberQuery  = `INSERT INTO user_phone (user_id, phone_number) VALUES (?, ?)`
 	deletePhoneNumberQuery  = `DELETE FROM user_phone WHERE user_id = ? AND phone_number = ?`
+	deletePhoneNumbersQuery = `DELETE FROM user_phone WHERE user_id = ?`
 
 	insertTierQuery = `
-		INSERT INTO tier (id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO tier (id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, attachment_allowed_types, attachment_denied_types, stripe_monthly_price_id, stripe_yearly_price_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	updateTierQuery = `
 		UPDATE tier
-		SET name = ?, messages_limit = ?, messages_expiry_duration = ?, emails_limit = ?, calls_limit = ?, reservations_limit = ?, attachment_file_size_limit = ?, attachment_total_size_limit = ?, attachment_expiry_duration = ?, attachment_bandwidth_limit = ?, stripe_monthly_price_id = ?, stripe_yearly_price_id = ?
+		SET name = ?, messages_limit = ?, messages_expiry_duration = ?, emails_limit = ?, calls_limit = ?, reservations_limit = ?, attachment_file_size_limit = ?, attachment_total_size_limit = ?, attachment_expiry_duration = ?, attachment_bandwidth_limit = ?, attachment_allowed_types = ?, attachment_denied_types = ?, stripe_monthly_price_id = ?, stripe_yearly_price_id = ?
 		WHERE code = ?
 	`
 	selectTiersQuery = `
-		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
+		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, attachment_allowed_types, attachment_denied_types, stripe_monthly_price_id, stripe_yearly_price_id
 		FROM tier
 	`
 	selectTierByCodeQuery = `
-		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
+		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, attachment_allowed_types, attachment_denied_types, stripe_monthly_price_id, stripe_yearly_price_id
 		FROM tier
 		WHERE code = ?
 	`
 	selectTierByPriceIDQuery = `
-		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, stripe_monthly_price_id, stripe_yearly_price_id
+		SELECT id, code, name, messages_limit, messages_expiry_duration, emails_limit, calls_limit, reservations_limit, attachment_file_size_limit, attachment_total_size_limit, attachment_expiry_duration, attachment_bandwidth_limit, attachment_allowed_types, attachment_denied_types, stripe_monthly_price_id, stripe_yearly_price_id
 		FROM tier
 		WHERE (stripe_monthly_price_id = ? OR stripe_yearly_price_id = ?)
 	`
 	updateUserTierQuery = `UPDATE user SET tier_id = (SELECT id FROM tier WHERE code = ?) WHERE user = ?`
-	deleteUserTierQuery = `UPDATE user SET tier_id = null WHERE user = ?`
+	deleteUserTierQuery = `UPDATE user SET tier_id = null, tier_expires = null, tier_expiry_warned = 0 WHERE user = ?`
 	deleteTierQuery     = `DELETE FROM tier WHERE code = ?`
 
+	updateUserTierExpiresQuery       = `UPDATE user SET tier_expires = ?, tier_expiry_warned = 0 WHERE user = ?`
+	updateUserTierExpiryWarnedQuery  = `UPDATE user SET tier_expiry_warned = 1 WHERE user = ?`
+	selectUsernamesTierExpiringQuery = `
+		SELECT user
+		FROM user
+		WHERE tier_id IS NOT NULL
+		  AND tier_expires IS NOT NULL
+		  AND tier_expires < ?
+		  AND deleted IS NULL
+		ORDER BY tier_expires
+	`
+
+	insertRoleQuery          = `INSERT INTO role (name, capabilities) VALUES (?, ?)`
+	updateRoleQuery          = `UPDATE role SET capabilities = ? WHERE name = ?`
+	selectRolesQuery         = `SELECT name, capabilities FROM role ORDER BY name`
+	selectRoleQuery          = `SELECT name, capabilities FROM role WHERE name = ?`
+	selectRoleUserCountQuery = `SELECT COUNT(*) FROM user WHERE role = ?`
+	deleteRoleQuery          = `DELETE FROM role WHERE name = ?`
+
 	updateBillingQuery = `
 		UPDATE user
 		SET stripe_customer_id = ?, stripe_subscription_id = ?, stripe_subscription_status = ?, stripe_subscription_interval = ?, stripe_subscription_paid_until = ?, stripe_subscription_cancel_at = ?
@@ -328,7 +662,7 @@ const (
 
 // Schema management queries.
 const (
-	currentSchemaVersion     = 6
+	currentSchemaVersion     = 19
 	insertSchemaVersion      = `INSERT INTO schemaVersion VALUES (1, ?)`
 	updateSchemaVersion      = `UPDATE schemaVersion SET version = ? WHERE id = 1`
 	selectSchemaVersionQuery = `SELECT version FROM schemaVersion WHERE id = 1`
@@ -537,15 +871,218 @@ const (
 		-- Re-enable foreign keys
 		PRAGMA foreign_keys=on;
 	`
+
+	// 6 -> 7
+	migrate6To7UpdateQueries = `
+		ALTER TABLE user ADD COLUMN email TEXT;
+		ALTER TABLE user ADD COLUMN pass_expired INT NOT NULL DEFAULT (0);
+		CREATE TABLE IF NOT EXISTS user_password_reset (
+			token TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			expires INT NOT NULL,
+			PRIMARY KEY (token),
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+	`
+
+	// 7 -> 8
+	migrate7To8UpdateQueries = `
+		ALTER TABLE user_token ADD COLUMN last_user_agent TEXT NOT NULL DEFAULT ('');
+	`
+
+	// 8 -> 9
+	migrate8To9UpdateQueries = `
+		PRAGMA foreign_keys=off;
+
+		-- Add role table for custom roles
+		CREATE TABLE IF NOT EXISTS role (
+			name TEXT PRIMARY KEY,
+			capabilities TEXT NOT NULL
+		);
+
+		-- Alter user table: Remove CHECK constraint on role column. The new table is renamed
+		-- (instead of the old one) so that foreign keys in other tables still point to "user".
+		CREATE TABLE user_new (
+		    id TEXT PRIMARY KEY,
+			tier_id TEXT,
+			user TEXT NOT NULL,
+			pass TEXT NOT NULL,
+			role TEXT NOT NULL,
+			prefs JSON NOT NULL DEFAULT '{}',
+			sync_topic TEXT NOT NULL,
+			provisioned INT NOT NULL,
+			stats_messages INT NOT NULL DEFAULT (0),
+			stats_emails INT NOT NULL DEFAULT (0),
+			stats_calls INT NOT NULL DEFAULT (0),
+			stripe_customer_id TEXT,
+			stripe_subscription_id TEXT,
+			stripe_subscription_status TEXT,
+			stripe_subscription_interval TEXT,
+			stripe_subscription_paid_until INT,
+			stripe_subscription_cancel_at INT,
+			created INT NOT NULL,
+			deleted INT,
+			email TEXT,
+			pass_expired INT NOT NULL DEFAULT (0),
+		    FOREIGN KEY (tier_id) REFERENCES tier (id)
+		);
+		INSERT INTO user_new SELECT * FROM user;
+		DROP TABLE user;
+		ALTER TABLE user_new RENAME TO user;
+
+		-- Recreate indices
+		CREATE UNIQUE INDEX idx_user ON user (user);
+		CREATE UNIQUE INDEX idx_user_stripe_customer_id ON user (stripe_customer_id);
+		CREATE UNIQUE INDEX idx_user_stripe_subscription_id ON user (stripe_subscription_id);
+
+		-- Re-enable foreign keys
+		PRAGMA foreign_keys=on;
+	`
+
+	// 9 -> 10
+	migrate9To10UpdateQueries = `
+		ALTER TABLE user ADD COLUMN tier_expires INT;
+		ALTER TABLE user ADD COLUMN tier_expiry_warned INT NOT NULL DEFAULT (0);
+	`
+
+	// 10 -> 11
+	migrate10To11UpdateQueries = `
+		ALTER TABLE tier ADD COLUMN attachment_allowed_types TEXT NOT NULL DEFAULT ('');
+		ALTER TABLE tier ADD COLUMN attachment_denied_types TEXT NOT NULL DEFAULT ('');
+	`
+
+	// 11 -> 12
+	migrate11To12UpdateQueries = `
+		ALTER TABLE user_access ADD COLUMN expires INT NOT NULL DEFAULT (0);
+	`
+
+	// 12 -> 13
+	migrate12To13UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS user_invite (
+			token TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			read INT NOT NULL,
+			write INT NOT NULL,
+			uses INT NOT NULL,
+			uses_limit INT NOT NULL,
+			expires INT NOT NULL,
+			created INT NOT NULL,
+			PRIMARY KEY (token),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+	`
+
+	// 13 -> 14
+	migrate13To14UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS user_guest_token (
+			id TEXT NOT NULL,
+			token TEXT NOT NULL,
+			owner_user_id TEXT,
+			topic TEXT NOT NULL,
+			read INT NOT NULL,
+			write INT NOT NULL,
+			label TEXT NOT NULL,
+			messages_limit INT NOT NULL,
+			expires INT NOT NULL,
+			created INT NOT NULL,
+			PRIMARY KEY (id),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE UNIQUE INDEX idx_user_guest_token ON user_guest_token (token);
+	`
+
+	// 14 -> 15
+	migrate14To15UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS user_topic_schema (
+			topic TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			schema TEXT NOT NULL,
+			mode TEXT NOT NULL,
+			updated INT NOT NULL,
+			PRIMARY KEY (topic),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+	`
+
+	// 15 -> 16
+	migrate15To16UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS user_topic_alias (
+			alias TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			deprecated INT NOT NULL,
+			created INT NOT NULL,
+			PRIMARY KEY (alias),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE INDEX idx_user_topic_alias_topic ON user_topic_alias (topic);
+	`
+
+	// 16 -> 17
+	migrate16To17UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS user_topic_silence (
+			id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			starts INT NOT NULL,
+			ends INT NOT NULL,
+			repeat TEXT NOT NULL,
+			summary INT NOT NULL,
+			summarized INT NOT NULL,
+			created INT NOT NULL,
+			PRIMARY KEY (id),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE INDEX idx_user_topic_silence_topic ON user_topic_silence (topic);
+	`
+
+	// 17 -> 18
+	migrate17To18UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS user_topic_escalation (
+			topic TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			min_priority INT NOT NULL,
+			steps TEXT NOT NULL,
+			updated INT NOT NULL,
+			PRIMARY KEY (topic),
+			FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+	`
+
+	// 18 -> 19
+	migrate18To19UpdateQueries = `
+		CREATE TABLE IF NOT EXISTS user_topic_mute (
+			user_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			until INT NOT NULL,
+			PRIMARY KEY (user_id, topic),
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE INDEX idx_user_topic_mute_topic ON user_topic_mute (topic);
+	`
 )
 
 var (
 	migrations = map[int]func(db *sql.DB) error{
-		1: migrateFrom1,
-		2: migrateFrom2,
-		3: migrateFrom3,
-		4: migrateFrom4,
-		5: migrateFrom5,
+		1:  migrateFrom1,
+		2:  migrateFrom2,
+		3:  migrateFrom3,
+		4:  migrateFrom4,
+		5:  migrateFrom5,
+		6:  migrateFrom6,
+		7:  migrateFrom7,
+		8:  migrateFrom8,
+		9:  migrateFrom9,
+		10: migrateFrom10,
+		11: migrateFrom11,
+		12: migrateFrom12,
+		13: migrateFrom13,
+		14: migrateFrom14,
+		15: migrateFrom15,
+		16: migrateFrom16,
+		17: migrateFrom17,
+		18: migrateFrom18,
 	}
 )
 
@@ -556,6 +1093,7 @@ type Manager struct {
 	db         *sql.DB
 	statsQueue map[string]*Stats       // "Queue" to asynchronously write user stats to the database (UserID -> Stats)
 	tokenQueue map[string]*TokenUpdate // "Queue" to asynchronously write token access stats to the database (Token ID -> TokenUpdate)
+	authCache  *authCache              // Cache of recently verified credentials, to avoid bcrypt on every request
 	mu         sync.Mutex
 }
 
@@ -568,8 +1106,10 @@ type Config struct {
 	Users               []*User             // Predefined users to create on startup
 	Access              map[string][]*Grant // Predefined access grants to create on startup (username -> []*Grant)
 	Tokens              map[string][]*Token // Predefined users to create on startup (username -> []*Token)
+	AccessTemplates     []*Grant            // Access grants applied to every new user; "<username>" in the topic pattern is replaced with the username
 	QueueWriterInterval time.Duration       // Interval for the async queue writer to flush stats and token updates to the database
 	BcryptCost          int                 // Cost of generated passwords; lowering makes testing faster
+	AuthCacheTTL        time.Duration       // Duration for which verified username/password combinations are cached; zero disables the cache
 }
 
 var _ Auther = (*Manager)(nil)
@@ -610,6 +1150,7 @@ func NewManager(config *Config) (*Manager, error) {
 		config:     config,
 		statsQueue: make(map[string]*Stats),
 		tokenQueue: make(map[string]*TokenUpdate),
+		authCache:  newAuthCache(config.AuthCacheTTL),
 	}
 	if err := manager.maybeProvisionUsersAccessAndTokens(); err != nil {
 		return nil, err
@@ -620,7 +1161,8 @@ func NewManager(config *Config) (*Manager, error) {
 
 // Authenticate checks username and password and returns a User if correct, and the user has not been
 // marked as deleted. The method returns in constant-ish time, regardless of whether the user exists or
-// the password is correct or incorrect.
+// the password is correct or incorrect. Credentials that were recently verified are cached in memory (see
+// Config.AuthCacheTTL), so that clients publishing at a high rate don't pay the full bcrypt cost every time.
 //
 // Parameters:
 //   - username: The username to check.
@@ -641,13 +1183,44 @@ func (a *Manager) Authenticate(username, password string) (*User, error) {
 		log.Tag(tag).Field("user_name", username).Trace("Authentication of user failed (2): user marked deleted")
 		bcrypt.CompareHashAndPassword([]byte(userAuthIntentionalSlowDownHash), []byte("intentional slow-down to avoid timing attacks"))
 		return nil, ErrUnauthenticated
+	} else if a.authCache.Verified(username, password, user.Hash) {
+		log.Tag(tag).Field("user_name", username).Trace("Credentials of user verified via auth cache")
 	} else if err := bcrypt.CompareHashAndPassword([]byte(user.Hash), []byte(password)); err != nil {
 		log.Tag(tag).Field("user_name", username).Err(err).Trace("Authentication of user failed (3)")
 		return nil, ErrUnauthenticated
+	} else {
+		a.maybeRehashPassword(user, password)
+		a.authCache.Add(user, password)
+	}
+	if user.PasswordExpired {
+		log.Tag(tag).Field("user_name", username).Trace("Authentication of user failed (4): password expired")
+		return nil, ErrPasswordExpired
 	}
 	return user, nil
 }
 
+// maybeRehashPassword transparently re-hashes the password of the user with the configured bcrypt cost, if the
+// stored hash uses a lower cost, e.g. because the cost was raised after the user was created. It must only be called
+// after the password was verified. Provisioned users are skipped, since their hash is defined in the config file.
+// Errors are logged, but otherwise ignored, since the user is authenticated either way.
+func (a *Manager) maybeRehashPassword(user *User, password string) {
+	if user.Provisioned || !weakPasswordHash(user.Hash, a.config.BcryptCost) {
+		return
+	}
+	hash, err := hashPassword(password, a.config.BcryptCost)
+	if err != nil {
+		log.Tag(tag).Field("user_name", user.Name).Err(err).Warn("Unable to re-hash password of user")
+		return
+	}
+	// The old hash is part of the WHERE clause, so that a concurrent password change is not overwritten
+	if _, err := a.db.Exec(updateUserPassHashQuery, hash, user.Name, user.Hash); err != nil {
+		log.Tag(tag).Field("user_name", user.Name).Err(err).Warn("Unable to re-hash password of user")
+		return
+	}
+	log.Tag(tag).Field("user_name", user.Name).Info("Re-hashed password of user %s with bcrypt cost %d", user.Name, a.config.BcryptCost)
+	user.Hash = hash
+}
+
 // AuthenticateToken checks if the token exists and returns the associated User if it does.
 // The method sets the User.Token value to the token that was used for authentication.
 //
@@ -785,13 +1358,13 @@ func (a *Manager) Token(userID, token string) (*Token, error) {
 }
 
 func (a *Manager) readToken(rows *sql.Rows) (*Token, error) {
-	var token, label, lastOrigin string
+	var token, label, lastOrigin, lastUserAgent string
 	var lastAccess, expires int64
 	var provisioned bool
 	if !rows.Next() {
 		return nil, ErrTokenNotFound
 	}
-	if err := rows.Scan(&token, &label, &lastAccess, &lastOrigin, &expires, &provisioned); err != nil {
+	if err := rows.Scan(&token, &label, &lastAccess, &lastOrigin, &lastUserAgent, &expires, &provisioned); err != nil {
 		return nil, err
 	} else if err := rows.Err(); err != nil {
 		return nil, err
@@ -801,12 +1374,13 @@ func (a *Manager) readToken(rows *sql.Rows) (*Token, error) {
 		lastOriginIP = netip.IPv4Unspecified()
 	}
 	return &Token{
-		Value:       token,
-		Label:       label,
-		LastAccess:  time.Unix(lastAccess, 0),
-		LastOrigin:  lastOriginIP,
-		Expires:     time.Unix(expires, 0),
-		Provisioned: provisioned,
+		Value:         token,
+		Label:         label,
+		LastAccess:    time.Unix(lastAccess, 0),
+		LastOrigin:    lastOriginIP,
+		LastUserAgent: lastUserAgent,
+		Expires:       time.Unix(expires, 0),
+		Provisioned:   provisioned,
 	}, nil
 }
 
@@ -875,6 +1449,25 @@ func (a *Manager) removeTokenTx(tx *sql.Tx, userID, token string) error {
 	return nil
 }
 
+// RemoveOtherTokens deletes all tokens of the user with the given user ID, except for the given token.
+// This is used to log out all other sessions of a user. If the token is empty, all tokens are removed.
+// Cached credentials of the user are forgotten as well, so the next basic auth request is fully verified.
+// Provisioned tokens are never removed.
+//
+// Parameters:
+//   - userID: The ID of the user.
+//   - token: The token string to keep, may be empty.
+//
+// Returns:
+//   - An error if the tokens cannot be removed.
+func (a *Manager) RemoveOtherTokens(userID, token string) error {
+	defer a.authCache.RemoveUserID(userID)
+	if _, err := a.db.Exec(deleteOtherTokensQuery, userID, token); err != nil {
+		return err
+	}
+	return nil
+}
+
 // CanChangeToken checks if the token can be changed. If the token is provisioned, it cannot be changed.
 //
 // Parameters:
@@ -1105,15 +1698,15 @@ func (a *Manager) writeTokenUpdateQueue() error {
 	log.Tag(tag).Debug("Writing token update queue for %d token(s)", len(tokenQueue))
 	for tokenID, update := range tokenQueue {
 		log.Tag(tag).Trace("Updating token %s with last access time %v", tokenID, update.LastAccess.Unix())
-		if err := a.updateTokenLastAccessTx(tx, tokenID, update.LastAccess.Unix(), update.LastOrigin.String()); err != nil {
+		if err := a.updateTokenLastAccessTx(tx, tokenID, update.LastAccess.Unix(), update.LastOrigin.String(), update.LastUserAgent); err != nil {
 			return err
 		}
 	}
 	return tx.Commit()
 }
 
-func (a *Manager) updateTokenLastAccessTx(tx *sql.Tx, token string, lastAccess int64, lastOrigin string) error {
-	if _, err := tx.Exec(updateTokenLastAccessQuery, lastAccess, lastOrigin, token); err != nil {
+func (a *Manager) updateTokenLastAccessTx(tx *sql.Tx, token string, lastAccess int64, lastOrigin, lastUserAgent string) error {
+	if _, err := tx.Exec(updateTokenLastAccessQuery, lastAccess, lastOrigin, lastUserAgent, token); err != nil {
 		return err
 	}
 	return nil
@@ -1141,7 +1734,7 @@ func (a *Manager) Authorize(user *User, topic string, perm Permission) error {
 	// - The query may return two rows (one for everyone, and one for the user), but prioritizes the user.
 	// - Furthermore, the query prioritizes more specific permissions (longer!) over more generic ones, e.g. "test*" > "*"
 	// - It also prioritizes write permissions over read permissions
-	rows, err := a.db.Query(selectTopicPermsQuery, Everyone, username, topic)
+	rows, err := a.db.Query(selectTopicPermsQuery, Everyone, username, topic, time.Now().Unix())
 	if err != nil {
 		return err
 	}
@@ -1187,6 +1780,8 @@ func (a *Manager) AddUser(username, password string, role Role, hashed bool) err
 func (a *Manager) addUserTx(tx *sql.Tx, username, password string, role Role, hashed, provisioned bool) error {
 	if !AllowedUsername(username) || !AllowedRole(role) {
 		return ErrInvalidArgument
+	} else if err := a.checkRoleExistsTx(tx, role); err != nil {
+		return err
 	}
 	var hash string
 	var err error = nil
@@ -1209,6 +1804,28 @@ func (a *Manager) addUserTx(tx *sql.Tx, username, password string, role Role, ha
 		}
 		return err
 	}
+	if role != RoleAdmin {
+		if err := a.applyAccessTemplatesTx(tx, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyAccessTemplatesTx creates the access control entries defined in the config's access templates for
+// the given user. Templates that do not result in a valid topic pattern (e.g. because the username contains
+// characters that are not allowed in topics) are skipped.
+func (a *Manager) applyAccessTemplatesTx(tx *sql.Tx, username string) error {
+	for _, template := range a.config.AccessTemplates {
+		topicPattern := expandAccessTemplate(template.TopicPattern, username)
+		if !AllowedTopicPattern(topicPattern) {
+			log.Tag(tag).Field("user_name", username).Warn("Skipping access template %s, resulting topic pattern %s is invalid", template.TopicPattern, topicPattern)
+			continue
+		}
+		if err := a.allowAccessTx(tx, username, topicPattern, template.Permission, false, time.Time{}); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -1224,6 +1841,7 @@ func (a *Manager) RemoveUser(username string) error {
 	if err := a.CanChangeUser(username); err != nil {
 		return err
 	}
+	defer a.authCache.RemoveUser(username)
 	return execTx(a.db, func(tx *sql.Tx) error {
 		return a.removeUserTx(tx, username)
 	})
@@ -1240,8 +1858,9 @@ func (a *Manager) removeUserTx(tx *sql.Tx, username string) error {
 	return nil
 }
 
-// MarkUserRemoved sets the deleted flag on the user, and deletes all access tokens. This prevents
-// successful auth via Authenticate. A background process will delete the user at a later date.
+// MarkUserRemoved sets the deleted flag on the user, and deletes all access control entries, access tokens,
+// invites, guest tokens, phone numbers and password reset tokens. This prevents successful auth via Authenticate. A background
+// process will delete the user at a later date.
 //
 // Parameters:
 //   - user: The user to mark as removed.
@@ -1252,6 +1871,7 @@ func (a *Manager) MarkUserRemoved(user *User) error {
 	if !AllowedUsername(user.Name) {
 		return ErrInvalidArgument
 	}
+	defer a.authCache.RemoveUserID(user.ID)
 	tx, err := a.db.Begin()
 	if err != nil {
 		return err
@@ -1263,12 +1883,43 @@ func (a *Manager) MarkUserRemoved(user *User) error {
 	if _, err := tx.Exec(deleteAllTokenQuery, user.ID); err != nil {
 		return err
 	}
+	if _, err := tx.Exec(deleteAllInvitesQuery, user.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deleteAllGuestTokensQuery, user.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deletePhoneNumbersQuery, user.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deletePasswordResetTokensQuery, user.ID); err != nil {
+		return err
+	}
 	if _, err := tx.Exec(updateUserDeletedQuery, time.Now().Add(userHardDeleteAfterDuration).Unix(), user.ID); err != nil {
 		return err
 	}
 	return tx.Commit()
 }
 
+// UsersWithWeakPasswordHash returns all users whose password hash uses a lower bcrypt cost than the configured
+// cost. The passwords of these users are re-hashed the next time they log in (unless they are provisioned users).
+//
+// Returns:
+//   - A list of Users or an error.
+func (a *Manager) UsersWithWeakPasswordHash() ([]*User, error) {
+	users, err := a.Users()
+	if err != nil {
+		return nil, err
+	}
+	weak := make([]*User, 0)
+	for _, u := range users {
+		if u.Name != Everyone && weakPasswordHash(u.Hash, a.config.BcryptCost) {
+			weak = append(weak, u)
+		}
+	}
+	return weak, nil
+}
+
 // Users returns a list of users. It always also returns the Everyone user ("*").
 //
 // Returns:
@@ -1378,26 +2029,27 @@ func (a *Manager) userByToken(token string) (*User, error) {
 func (a *Manager) readUser(rows *sql.Rows) (*User, error) {
 	defer rows.Close()
 	var id, username, hash, role, prefs, syncTopic string
-	var provisioned bool
-	var stripeCustomerID, stripeSubscriptionID, stripeSubscriptionStatus, stripeSubscriptionInterval, stripeMonthlyPriceID, stripeYearlyPriceID, tierID, tierCode, tierName sql.NullString
+	var provisioned, passwordExpired, tierExpiryWarned bool
+	var email, capabilities, attachmentAllowedTypes, attachmentDeniedTypes, stripeCustomerID, stripeSubscriptionID, stripeSubscriptionStatus, stripeSubscriptionInterval, stripeMonthlyPriceID, stripeYearlyPriceID, tierID, tierCode, tierName sql.NullString
 	var messages, emails, calls int64
-	var messagesLimit, messagesExpiryDuration, emailsLimit, callsLimit, reservationsLimit, attachmentFileSizeLimit, attachmentTotalSizeLimit, attachmentExpiryDuration, attachmentBandwidthLimit, stripeSubscriptionPaidUntil, stripeSubscriptionCancelAt, deleted sql.NullInt64
+	var messagesLimit, messagesExpiryDuration, emailsLimit, callsLimit, reservationsLimit, attachmentFileSizeLimit, attachmentTotalSizeLimit, attachmentExpiryDuration, attachmentBandwidthLimit, stripeSubscriptionPaidUntil, stripeSubscriptionCancelAt, deleted, tierExpires sql.NullInt64
 	if !rows.Next() {
 		return nil, ErrUserNotFound
 	}
-	if err := rows.Scan(&id, &username, &hash, &role, &prefs, &syncTopic, &provisioned, &messages, &emails, &calls, &stripeCustomerID, &stripeSubscriptionID, &stripeSubscriptionStatus, &stripeSubscriptionInterval, &stripeSubscriptionPaidUntil, &stripeSubscriptionCancelAt, &deleted, &tierID, &tierCode, &tierName, &messagesLimit, &messagesExpiryDuration, &emailsLimit, &callsLimit, &reservationsLimit, &attachmentFileSizeLimit, &attachmentTotalSizeLimit, &attachmentExpiryDuration, &attachmentBandwidthLimit, &stripeMonthlyPriceID, &stripeYearlyPriceID); err != nil {
+	if err := rows.Scan(&id, &username, &hash, &role, &prefs, &syncTopic, &provisioned, &messages, &emails, &calls, &stripeCustomerID, &stripeSubscriptionID, &stripeSubscriptionStatus, &stripeSubscriptionInterval, &stripeSubscriptionPaidUntil, &stripeSubscriptionCancelAt, &deleted, &email, &passwordExpired, &tierExpires, &tierExpiryWarned, &capabilities, &tierID, &tierCode, &tierName, &messagesLimit, &messagesExpiryDuration, &emailsLimit, &callsLimit, &reservationsLimit, &attachmentFileSizeLimit, &attachmentTotalSizeLimit, &attachmentExpiryDuration, &attachmentBandwidthLimit, &attachmentAllowedTypes, &attachmentDeniedTypes, &stripeMonthlyPriceID, &stripeYearlyPriceID); err != nil {
 		return nil, err
 	} else if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	user := &User{
-		ID:          id,
-		Name:        username,
-		Hash:        hash,
-		Role:        Role(role),
-		Prefs:       &Prefs{},
-		SyncTopic:   syncTopic,
-		Provisioned: provisioned,
+		ID:           id,
+		Name:         username,
+		Hash:         hash,
+		Role:         Role(role),
+		Capabilities: parseCapabilities(capabilities.String), // May be empty
+		Prefs:        &Prefs{},
+		SyncTopic:    syncTopic,
+		Provisioned:  provisioned,
 		Stats: &Stats{
 			Messages: messages,
 			Emails:   emails,
@@ -1411,7 +2063,13 @@ func (a *Manager) readUser(rows *sql.Rows) (*User, error) {
 			StripeSubscriptionPaidUntil: time.Unix(stripeSubscriptionPaidUntil.Int64, 0),                    // May be zero
 			StripeSubscriptionCancelAt:  time.Unix(stripeSubscriptionCancelAt.Int64, 0),                     // May be zero
 		},
-		Deleted: deleted.Valid,
+		Email:            email.String, // May be empty
+		PasswordExpired:  passwordExpired,
+		TierExpiryWarned: tierExpiryWarned,
+		Deleted:          deleted.Valid,
+	}
+	if tierExpires.Valid {
+		user.TierExpires = time.Unix(tierExpires.Int64, 0)
 	}
 	if err := json.Unmarshal([]byte(prefs), user.Prefs); err != nil {
 		return nil, err
@@ -1431,8 +2089,10 @@ func (a *Manager) readUser(rows *sql.Rows) (*User, error) {
 			AttachmentTotalSizeLimit: attachmentTotalSizeLimit.Int64,
 			AttachmentExpiryDuration: time.Duration(attachmentExpiryDuration.Int64) * time.Second,
 			AttachmentBandwidthLimit: attachmentBandwidthLimit.Int64,
-			StripeMonthlyPriceID:     stripeMonthlyPriceID.String, // May be empty
-			StripeYearlyPriceID:      stripeYearlyPriceID.String,  // May be empty
+			AttachmentAllowedTypes:   parseContentTypes(attachmentAllowedTypes.String), // May be empty
+			AttachmentDeniedTypes:    parseContentTypes(attachmentDeniedTypes.String),  // May be empty
+			StripeMonthlyPriceID:     stripeMonthlyPriceID.String,                      // May be empty
+			StripeYearlyPriceID:      stripeYearlyPriceID.String,                       // May be empty
 		}
 	}
 	return user, nil
@@ -1443,7 +2103,7 @@ func (a *Manager) readUser(rows *sql.Rows) (*User, error) {
 // Returns:
 //   - A map of userID to a list of Grants, or an error.
 func (a *Manager) AllGrants() (map[string][]Grant, error) {
-	rows, err := a.db.Query(selectUserAllAccessQuery)
+	rows, err := a.db.Query(selectUserAllAccessQuery, time.Now().Unix())
 	if err != nil {
 		return nil, err
 	}
@@ -1452,7 +2112,8 @@ func (a *Manager) AllGrants() (map[string][]Grant, error) {
 	for rows.Next() {
 		var userID, topic string
 		var read, write, provisioned bool
-		if err := rows.Scan(&userID, &topic, &read, &write, &provisioned); err != nil {
+		var expires int64
+		if err := rows.Scan(&userID, &topic, &read, &write, &provisioned, &expires); err != nil {
 			return nil, err
 		} else if err := rows.Err(); err != nil {
 			return nil, err
@@ -1464,6 +2125,7 @@ func (a *Manager) AllGrants() (map[string][]Grant, error) {
 			TopicPattern: fromSQLWildcard(topic),
 			Permission:   NewPermission(read, write),
 			Provisioned:  provisioned,
+			Expires:      unixOrZero(expires),
 		})
 	}
 	return grants, nil
@@ -1477,7 +2139,7 @@ func (a *Manager) AllGrants() (map[string][]Grant, error) {
 // Returns:
 //   - A list of Grants or an error.
 func (a *Manager) Grants(username string) ([]Grant, error) {
-	rows, err := a.db.Query(selectUserAccessQuery, username)
+	rows, err := a.db.Query(selectUserAccessQuery, username, time.Now().Unix())
 	if err != nil {
 		return nil, err
 	}
@@ -1486,7 +2148,8 @@ func (a *Manager) Grants(username string) ([]Grant, error) {
 	for rows.Next() {
 		var topic string
 		var read, write, provisioned bool
-		if err := rows.Scan(&topic, &read, &write, &provisioned); err != nil {
+		var expires int64
+		if err := rows.Scan(&topic, &read, &write, &provisioned, &expires); err != nil {
 			return nil, err
 		} else if err := rows.Err(); err != nil {
 			return nil, err
@@ -1495,6 +2158,7 @@ func (a *Manager) Grants(username string) ([]Grant, error) {
 			TopicPattern: fromSQLWildcard(topic),
 			Permission:   NewPermission(read, write),
 			Provisioned:  provisioned,
+			Expires:      unixOrZero(expires),
 		})
 	}
 	return grants, nil
@@ -1532,23 +2196,52 @@ func (a *Manager) Reservations(username string) ([]Reservation, error) {
 	return reservations, nil
 }
 
-// HasReservation returns true if the given topic access is owned by the user.
-//
-// Parameters:
-//   - username: The username.
-//   - topic: The topic to check.
+// AllReservations returns the reservations of all users, mapped to their respective user IDs.
 //
 // Returns:
-//   - True if the user owns the reservation, false otherwise.
-func (a *Manager) HasReservation(username, topic string) (bool, error) {
-	rows, err := a.db.Query(selectUserHasReservationQuery, username, escapeUnderscore(topic))
+//   - A map of userID to a list of Reservations, or an error.
+func (a *Manager) AllReservations() (map[string][]Reservation, error) {
+	rows, err := a.db.Query(selectUserAllReservationsQuery, Everyone)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer rows.Close()
-	if !rows.Next() {
-		return false, errNoRows
-	}
+	reservations := make(map[string][]Reservation)
+	for rows.Next() {
+		var userID, topic string
+		var ownerRead, ownerWrite bool
+		var everyoneRead, everyoneWrite sql.NullBool
+		if err := rows.Scan(&userID, &topic, &ownerRead, &ownerWrite, &everyoneRead, &everyoneWrite); err != nil {
+			return nil, err
+		} else if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		reservations[userID] = append(reservations[userID], Reservation{
+			Topic:    unescapeUnderscore(topic),
+			Owner:    NewPermission(ownerRead, ownerWrite),
+			Everyone: NewPermission(everyoneRead.Bool, everyoneWrite.Bool), // false if null
+		})
+	}
+	return reservations, nil
+}
+
+// HasReservation returns true if the given topic access is owned by the user.
+//
+// Parameters:
+//   - username: The username.
+//   - topic: The topic to check.
+//
+// Returns:
+//   - True if the user owns the reservation, false otherwise.
+func (a *Manager) HasReservation(username, topic string) (bool, error) {
+	rows, err := a.db.Query(selectUserHasReservationQuery, username, escapeUnderscore(topic))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return false, errNoRows
+	}
 	var count int64
 	if err := rows.Scan(&count); err != nil {
 		return false, err
@@ -1616,6 +2309,7 @@ func (a *Manager) ChangePassword(username, password string, hashed bool) error {
 	if err := a.CanChangeUser(username); err != nil {
 		return err
 	}
+	defer a.authCache.RemoveUser(username)
 	return execTx(a.db, func(tx *sql.Tx) error {
 		return a.changePasswordTx(tx, username, password, hashed)
 	})
@@ -1659,8 +2353,125 @@ func (a *Manager) changePasswordTx(tx *sql.Tx, username, password string, hashed
 	return nil
 }
 
-// ChangeRole changes a user's role. When a role is changed from RoleUser to RoleAdmin,
-// all existing access control entries (Grant) are removed, since they are no longer needed.
+// ExpirePassword marks the password of the given user as expired, and removes all of the user's access
+// tokens. Users with an expired password cannot log in until they reset their password, e.g. via
+// ResetPassword, or until the password is changed by an admin.
+//
+// Parameters:
+//   - username: The username.
+//
+// Returns:
+//   - An error if the user does not exist, is provisioned, or the update fails.
+func (a *Manager) ExpirePassword(username string) error {
+	u, err := a.User(username)
+	if err != nil {
+		return err
+	} else if u.Provisioned {
+		return ErrProvisionedUserChange
+	}
+	defer a.authCache.RemoveUserID(u.ID)
+	return execTx(a.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(updateUserPassExpiredQuery, username); err != nil {
+			return err
+		}
+		_, err := tx.Exec(deleteAllTokenQuery, u.ID)
+		return err
+	})
+}
+
+// ChangeEmail changes the email address of a user. The email address is used to send password
+// reset emails. An empty email address removes it.
+//
+// Parameters:
+//   - username: The username.
+//   - email: The new email address, or an empty string.
+//
+// Returns:
+//   - An error if the update fails.
+func (a *Manager) ChangeEmail(username, email string) error {
+	if _, err := a.db.Exec(updateUserEmailQuery, nullString(email), username); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreatePasswordResetToken generates a random password reset token for the given user and returns it.
+// Any previously issued reset tokens for the user are removed, so that only the latest token is valid.
+//
+// Parameters:
+//   - userID: The ID of the user.
+//   - expires: The expiration time for the token.
+//
+// Returns:
+//   - The password reset token, or an error.
+func (a *Manager) CreatePasswordResetToken(userID string, expires time.Time) (string, error) {
+	token := util.RandomLowerStringPrefix(passwordResetTokenPrefix, passwordResetTokenLength)
+	err := execTx(a.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deletePasswordResetTokensQuery, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(insertPasswordResetTokenQuery, token, userID, expires.Unix())
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPassword sets a new password for the user the given password reset token belongs to. If successful,
+// the reset token as well as all access tokens of the user are removed, and the expired flag is cleared.
+//
+// Parameters:
+//   - token: The password reset token.
+//   - password: The new password.
+//
+// Returns:
+//   - The user whose password was reset, or ErrPasswordResetTokenNotFound if the token is invalid or expired.
+func (a *Manager) ResetPassword(token, password string) (*User, error) {
+	var userID string
+	if err := a.db.QueryRow(selectPasswordResetTokenUserIDQuery, token, time.Now().Unix()).Scan(&userID); errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPasswordResetTokenNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	u, err := a.UserByID(userID)
+	if err != nil {
+		return nil, err
+	} else if u.Provisioned {
+		return nil, ErrProvisionedUserChange
+	}
+	defer a.authCache.RemoveUserID(userID)
+	err = execTx(a.db, func(tx *sql.Tx) error {
+		if err := a.changePasswordTx(tx, u.Name, password, false); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deletePasswordResetTokensQuery, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(deleteAllTokenQuery, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// RemoveExpiredPasswordResetTokens deletes all expired password reset tokens from the database.
+//
+// Returns:
+//   - An error if the deletion fails.
+func (a *Manager) RemoveExpiredPasswordResetTokens() error {
+	if _, err := a.db.Exec(deleteExpiredPasswordResetTokensQuery, time.Now().Unix()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ChangeRole changes a user's role. When a role is changed to RoleAdmin, all existing access
+// control entries (Grant) are removed, since they are no longer needed. Custom roles must exist,
+// see AddRole.
 //
 // Parameters:
 //   - username: The username.
@@ -1680,6 +2491,8 @@ func (a *Manager) ChangeRole(username string, role Role) error {
 func (a *Manager) changeRoleTx(tx *sql.Tx, username string, role Role) error {
 	if !AllowedUsername(username) || !AllowedRole(role) {
 		return ErrInvalidArgument
+	} else if err := a.checkRoleExistsTx(tx, role); err != nil {
+		return err
 	}
 	if _, err := tx.Exec(updateUserRoleQuery, string(role), username); err != nil {
 		return err
@@ -1743,6 +2556,82 @@ func (a *Manager) ResetTier(username string) error {
 	return err
 }
 
+// ChangeTierExpiry sets the time at which the user's tier expires. Once expired (and after an optional grace
+// period), the server downgrades the user, see UsersWithTierExpiringBefore. Passing a zero time removes the
+// expiry. Changing the expiry also resets the warning flag, so that users are warned again before the new date.
+//
+// Parameters:
+//   - username: The username.
+//   - expires: The expiry time, or zero to remove the expiry.
+//
+// Returns:
+//   - An error if the update fails.
+func (a *Manager) ChangeTierExpiry(username string, expires time.Time) error {
+	if !AllowedUsername(username) {
+		return ErrInvalidArgument
+	}
+	var tierExpires sql.NullInt64
+	if !expires.IsZero() {
+		tierExpires = sql.NullInt64{Int64: expires.Unix(), Valid: true}
+	}
+	if _, err := a.db.Exec(updateUserTierExpiresQuery, tierExpires, username); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkTierExpiryWarned marks that the user has been warned about the upcoming expiry of their tier,
+// so that the warning is only sent once.
+//
+// Parameters:
+//   - username: The username.
+//
+// Returns:
+//   - An error if the update fails.
+func (a *Manager) MarkTierExpiryWarned(username string) error {
+	if _, err := a.db.Exec(updateUserTierExpiryWarnedQuery, username); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UsersWithTierExpiringBefore returns all users that have a tier that expires before the given time,
+// ordered by expiry date. Users that are marked as deleted are not returned.
+//
+// Parameters:
+//   - before: The time before which the tiers expire.
+//
+// Returns:
+//   - A list of Users or an error.
+func (a *Manager) UsersWithTierExpiringBefore(before time.Time) ([]*User, error) {
+	rows, err := a.db.Query(selectUsernamesTierExpiringQuery, before.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usernames := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	users := make([]*User, 0)
+	for _, username := range usernames {
+		user, err := a.User(username)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
 func (a *Manager) checkReservationsLimit(username string, reservationsLimit int64) error {
 	u, err := a.User(username)
 	if err != nil {
@@ -1760,7 +2649,8 @@ func (a *Manager) checkReservationsLimit(username string, reservationsLimit int6
 }
 
 // AllowReservation tests if a user may create an access control entry for the given topic.
-// If there are any ACL entries that are not owned by the user, an error is returned.
+// If there are any ACL entries that are not owned by the user, or if the topic is an alias of a
+// topic renamed by another user (see RenameReservation), an error is returned.
 //
 // Parameters:
 //   - username: The username.
@@ -1787,6 +2677,11 @@ func (a *Manager) AllowReservation(username string, topic string) error {
 	if otherCount > 0 {
 		return errTopicOwnedByOthers
 	}
+	if err := a.db.QueryRow(selectOtherTopicAliasCountQuery, topic, username).Scan(&otherCount); err != nil {
+		return err
+	} else if otherCount > 0 {
+		return errTopicOwnedByOthers
+	}
 	return nil
 }
 
@@ -1802,24 +2697,87 @@ func (a *Manager) AllowReservation(username string, topic string) error {
 // Returns:
 //   - An error if the update fails.
 func (a *Manager) AllowAccess(username string, topicPattern string, permission Permission) error {
+	return a.AllowAccessUntil(username, topicPattern, permission, time.Time{})
+}
+
+// AllowAccessUntil is like AllowAccess, but the access control entry expires at the given time, after which
+// it no longer has any effect and is removed by RemoveExpiredAccess. This is useful to grant temporary access,
+// e.g. read-only access to an incident topic for 24 hours. A zero expires time means the entry never expires.
+//
+// Parameters:
+//   - username: The username.
+//   - topicPattern: The topic pattern (e.g. "mytopic*").
+//   - permission: The permission to grant.
+//   - expires: The time at which the entry expires, or zero.
+//
+// Returns:
+//   - An error if the expiry is in the past, or if the update fails.
+func (a *Manager) AllowAccessUntil(username string, topicPattern string, permission Permission, expires time.Time) error {
+	if !expires.IsZero() && !expires.After(time.Now()) {
+		return ErrInvalidArgument
+	}
 	return execTx(a.db, func(tx *sql.Tx) error {
-		return a.allowAccessTx(tx, username, topicPattern, permission, false)
+		return a.allowAccessTx(tx, username, topicPattern, permission, false, expires)
 	})
 }
 
-func (a *Manager) allowAccessTx(tx *sql.Tx, username string, topicPattern string, permission Permission, provisioned bool) error {
+func (a *Manager) allowAccessTx(tx *sql.Tx, username string, topicPattern string, permission Permission, provisioned bool, expires time.Time) error {
 	if !AllowedUsername(username) && username != Everyone {
 		return ErrInvalidArgument
 	} else if !AllowedTopicPattern(topicPattern) {
 		return ErrInvalidArgument
 	}
 	owner := ""
-	if _, err := tx.Exec(upsertUserAccessQuery, username, toSQLWildcard(topicPattern), permission.IsRead(), permission.IsWrite(), owner, owner, provisioned); err != nil {
+	if _, err := tx.Exec(upsertUserAccessQuery, username, toSQLWildcard(topicPattern), permission.IsRead(), permission.IsWrite(), owner, owner, provisioned, unixOrZeroInt64(expires)); err != nil {
 		return err
 	}
 	return nil
 }
 
+// RemoveExpiredAccess deletes all access control entries that have expired, and returns them, so that
+// the caller can cancel active subscriptions of the affected users.
+//
+// Returns:
+//   - A map of user ID to the removed Grants, or an error if the deletion fails.
+func (a *Manager) RemoveExpiredAccess() (map[string][]Grant, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	rows, err := tx.Query(selectExpiredAccessQuery, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	grants := make(map[string][]Grant)
+	for rows.Next() {
+		var userID, topic string
+		var read, write bool
+		var expires int64
+		if err := rows.Scan(&userID, &topic, &read, &write, &expires); err != nil {
+			return nil, err
+		}
+		grants[userID] = append(grants[userID], Grant{
+			TopicPattern: fromSQLWildcard(topic),
+			Permission:   NewPermission(read, write),
+			Expires:      unixOrZero(expires),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if _, err := tx.Exec(deleteExpiredAccessQuery, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
 // ResetAccess removes an access control list entry for a specific username/topic, or (if topic is
 // empty) for an entire user. The parameter topicPattern may include wildcards (*).
 //
@@ -1872,12 +2830,15 @@ func (a *Manager) AddReservation(username string, topic string, everyone Permiss
 		return err
 	}
 	defer tx.Rollback()
-	if _, err := tx.Exec(upsertUserAccessQuery, username, escapeUnderscore(topic), true, true, username, username, false); err != nil {
+	if _, err := tx.Exec(upsertUserAccessQuery, username, escapeUnderscore(topic), true, true, username, username, false, 0); err != nil {
 		return err
 	}
-	if _, err := tx.Exec(upsertUserAccessQuery, Everyone, escapeUnderscore(topic), everyone.IsRead(), everyone.IsWrite(), username, username, false); err != nil {
+	if _, err := tx.Exec(upsertUserAccessQuery, Everyone, escapeUnderscore(topic), everyone.IsRead(), everyone.IsWrite(), username, username, false, 0); err != nil {
 		return err
 	}
+	if _, err := tx.Exec(deleteTopicAliasQuery, username, topic); err != nil {
+		return err // Reserving a former topic name again removes the alias
+	}
 	return tx.Commit()
 }
 
@@ -1911,46 +2872,1009 @@ func (a *Manager) RemoveReservations(username string, topics ...string) error {
 		if _, err := tx.Exec(deleteTopicAccessQuery, Everyone, Everyone, escapeUnderscore(topic)); err != nil {
 			return err
 		}
+		if _, err := tx.Exec(deleteTopicInvitesQuery, username, topic); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deleteTopicGuestTokensQuery, username, topic); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deleteTopicSchemaQuery, username, topic); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deleteTopicAliasesQuery, username, topic); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deleteTopicSilencesQuery, username, topic); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(deleteTopicEscalationQuery, username, topic); err != nil {
+			return err
+		}
 	}
 	return tx.Commit()
 }
 
-// DefaultAccess returns the default read/write access if no access control entry matches.
-//
-// Returns:
-//   - The default permission.
-func (a *Manager) DefaultAccess() Permission {
-	return a.config.DefaultAccess
-}
-
-// AddTier creates a new tier in the database.
+// CreateInvite creates an invite token for a topic reserved by the given user. When redeemed (see RedeemInvite),
+// the invite grants the redeeming user the given permission to the topic. The access control entry is owned by
+// the topic owner, so it is removed along with the reservation. Only the newest invites of a user are kept.
 //
 // Parameters:
-//   - tier: The tier to add.
+//   - username: The username of the topic owner.
+//   - topic: The reserved topic.
+//   - permission: The permission to grant; must allow reading or writing.
+//   - usesLimit: The number of times the invite can be redeemed.
+//   - expires: The time at which the invite expires, or zero if it does not expire.
 //
 // Returns:
-//   - An error if the tier cannot be added.
-func (a *Manager) AddTier(tier *Tier) error {
-	if tier.ID == "" {
-		tier.ID = util.RandomStringPrefix(tierIDPrefix, tierIDLength)
-	}
-	if _, err := a.db.Exec(insertTierQuery, tier.ID, tier.Code, tier.Name, tier.MessageLimit, int64(tier.MessageExpiryDuration.Seconds()), tier.EmailLimit, tier.CallLimit, tier.ReservationLimit, tier.AttachmentFileSizeLimit, tier.AttachmentTotalSizeLimit, int64(tier.AttachmentExpiryDuration.Seconds()), tier.AttachmentBandwidthLimit, nullString(tier.StripeMonthlyPriceID), nullString(tier.StripeYearlyPriceID)); err != nil {
-		return err
+//   - The new Invite, ErrUnauthorized if the user does not own the topic, or an error if the creation fails.
+func (a *Manager) CreateInvite(username, topic string, permission Permission, usesLimit int64, expires time.Time) (*Invite, error) {
+	if !AllowedUsername(username) || username == Everyone || !AllowedTopic(topic) {
+		return nil, ErrInvalidArgument
+	} else if permission == PermissionDenyAll || usesLimit <= 0 {
+		return nil, ErrInvalidArgument
+	} else if !expires.IsZero() && !expires.After(time.Now()) {
+		return nil, ErrInvalidArgument
+	}
+	invite := &Invite{
+		Token:      util.RandomLowerStringPrefix(inviteTokenPrefix, inviteTokenLength),
+		Topic:      topic,
+		Permission: permission,
+		UsesLimit:  usesLimit,
+		Expires:    expires,
+		Created:    time.Unix(time.Now().Unix(), 0),
+	}
+	err := execTx(a.db, func(tx *sql.Tx) error {
+		var reserved int
+		if err := tx.QueryRow(selectUserHasReservationQuery, username, escapeUnderscore(topic)).Scan(&reserved); err != nil {
+			return err
+		} else if reserved == 0 {
+			return ErrUnauthorized
+		}
+		if _, err := tx.Exec(insertInviteQuery, invite.Token, username, topic, permission.IsRead(), permission.IsWrite(), usesLimit, unixOrZeroInt64(expires), invite.Created.Unix()); err != nil {
+			return err
+		}
+		var inviteCount int
+		if err := tx.QueryRow(selectInviteCountQuery, username).Scan(&inviteCount); err != nil {
+			return err
+		} else if inviteCount > inviteMaxCount {
+			if _, err := tx.Exec(deleteExcessInvitesQuery, username, username, inviteMaxCount); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return invite, nil
 }
 
-// UpdateTier updates a tier's properties in the database.
+// Invites returns all invites created by the given user, including used up and expired ones that have
+// not been removed yet.
 //
 // Parameters:
-//   - tier: The tier to update.
+//   - username: The username of the topic owner.
 //
 // Returns:
-//   - An error if the update fails.
-func (a *Manager) UpdateTier(tier *Tier) error {
-	if _, err := a.db.Exec(updateTierQuery, tier.Name, tier.MessageLimit, int64(tier.MessageExpiryDuration.Seconds()), tier.EmailLimit, tier.CallLimit, tier.ReservationLimit, tier.AttachmentFileSizeLimit, tier.AttachmentTotalSizeLimit, int64(tier.AttachmentExpiryDuration.Seconds()), tier.AttachmentBandwidthLimit, nullString(tier.StripeMonthlyPriceID), nullString(tier.StripeYearlyPriceID), tier.Code); err != nil {
-		return err
-	}
+//   - A list of Invites or an error.
+func (a *Manager) Invites(username string) ([]*Invite, error) {
+	rows, err := a.db.Query(selectInvitesQuery, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invites := make([]*Invite, 0)
+	for rows.Next() {
+		var token, topic string
+		var read, write bool
+		var uses, usesLimit, expires, created int64
+		if err := rows.Scan(&token, &topic, &read, &write, &uses, &usesLimit, &expires, &created); err != nil {
+			return nil, err
+		}
+		invites = append(invites, &Invite{
+			Token:      token,
+			Topic:      topic,
+			Permission: NewPermission(read, write),
+			Uses:       uses,
+			UsesLimit:  usesLimit,
+			Expires:    unixOrZero(expires),
+			Created:    time.Unix(created, 0),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// RemoveInvite deletes the invite with the given token, if it was created by the given user. Access that
+// was already granted by redeeming the invite is not affected.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - token: The invite token.
+//
+// Returns:
+//   - ErrInviteNotFound if the invite does not exist, or an error if the deletion fails.
+func (a *Manager) RemoveInvite(username, token string) error {
+	result, err := a.db.Exec(deleteInviteQuery, username, token)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// RedeemInvite redeems the invite with the given token for the given user, and grants the user access to the
+// topic as defined in the invite. The invite must not be used up or expired, and the topic must still be
+// reserved by the user who created the invite. If the user already has a grant for the topic (e.g. one with more
+// permissions, or one set by an admin or by the config), the grant is left unchanged.
+//
+// Parameters:
+//   - username: The username of the user redeeming the invite.
+//   - token: The invite token.
+//
+// Returns:
+//   - The redeemed Invite, ErrInviteNotFound if the invite is invalid, used up or expired, or an error.
+func (a *Manager) RedeemInvite(username, token string) (*Invite, error) {
+	if !AllowedUsername(username) || username == Everyone {
+		return nil, ErrInvalidArgument
+	}
+	invite := &Invite{Token: token}
+	err := execTx(a.db, func(tx *sql.Tx) error {
+		var owner string
+		var read, write bool
+		var expires, created int64
+		err := tx.QueryRow(selectValidInviteQuery, token, time.Now().Unix()).Scan(&owner, &invite.Topic, &read, &write, &invite.Uses, &invite.UsesLimit, &expires, &created)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInviteNotFound
+		} else if err != nil {
+			return err
+		} else if owner == username {
+			return ErrInvalidArgument
+		}
+		var reserved int
+		if err := tx.QueryRow(selectUserHasReservationQuery, owner, escapeUnderscore(invite.Topic)).Scan(&reserved); err != nil {
+			return err
+		} else if reserved == 0 {
+			return ErrInviteNotFound
+		}
+		invite.Permission = NewPermission(read, write)
+		invite.Expires = unixOrZero(expires)
+		invite.Created = time.Unix(created, 0)
+		if _, err := tx.Exec(insertUserAccessIfNotExistsQuery, username, escapeUnderscore(invite.Topic), read, write, owner, owner, false, 0); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(updateInviteUsesQuery, token); err != nil {
+			return err
+		}
+		invite.Uses++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// RemoveExpiredInvites deletes all invites that are expired or used up.
+//
+// Returns:
+//   - An error if the deletion fails.
+func (a *Manager) RemoveExpiredInvites() error {
+	if _, err := a.db.Exec(deleteExpiredInvitesQuery, time.Now().Unix()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateGuestToken creates an anonymous guest token that grants the given permission to exactly one topic. Guest
+// tokens are meant for devices that should not have a full user account. If an owner is given, the owner must have
+// the topic reserved, and the token is removed along with the reservation. If no owner is given (e.g. when created
+// by an admin via the CLI), the token is not tied to a reservation. Only the newest guest tokens of a user are kept.
+//
+// Parameters:
+//   - owner: The username of the topic owner, or an empty string.
+//   - topic: The topic the guest token grants access to.
+//   - permission: The permission the guest has on the topic.
+//   - label: A label for the guest token.
+//   - messageLimit: The number of messages the guest can publish per day.
+//   - expires: The time at which the token expires, or zero if it does not expire.
+//
+// Returns:
+//   - The new GuestToken, ErrUnauthorized if the owner does not own the topic, or an error if the creation fails.
+func (a *Manager) CreateGuestToken(owner, topic string, permission Permission, label string, messageLimit int64, expires time.Time) (*GuestToken, error) {
+	if owner != "" && (!AllowedUsername(owner) || owner == Everyone) {
+		return nil, ErrInvalidArgument
+	} else if !AllowedTopic(topic) || permission == PermissionDenyAll || messageLimit <= 0 {
+		return nil, ErrInvalidArgument
+	} else if !expires.IsZero() && !expires.After(time.Now()) {
+		return nil, ErrInvalidArgument
+	}
+	guest := &GuestToken{
+		ID:           util.RandomStringPrefix(guestTokenIDPrefix, guestTokenIDLength),
+		Token:        util.RandomLowerStringPrefix(guestTokenPrefix, guestTokenLength),
+		Owner:        owner,
+		Topic:        topic,
+		Permission:   permission,
+		Label:        label,
+		MessageLimit: messageLimit,
+		Expires:      expires,
+		Created:      time.Unix(time.Now().Unix(), 0),
+	}
+	err := execTx(a.db, func(tx *sql.Tx) error {
+		if owner != "" {
+			var reserved int
+			if err := tx.QueryRow(selectUserHasReservationQuery, owner, escapeUnderscore(topic)).Scan(&reserved); err != nil {
+				return err
+			} else if reserved == 0 {
+				return ErrUnauthorized
+			}
+		}
+		if _, err := tx.Exec(insertGuestTokenQuery, guest.ID, guest.Token, owner, topic, permission.IsRead(), permission.IsWrite(), label, messageLimit, unixOrZeroInt64(expires), guest.Created.Unix()); err != nil {
+			return err
+		}
+		if owner == "" {
+			return nil
+		}
+		var guestTokenCount int
+		if err := tx.QueryRow(selectGuestTokenCountQuery, owner).Scan(&guestTokenCount); err != nil {
+			return err
+		} else if guestTokenCount > guestTokenMaxCount {
+			if _, err := tx.Exec(deleteExcessGuestTokensQuery, owner, owner, guestTokenMaxCount); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return guest, nil
+}
+
+// GuestTokens returns all guest tokens created by the given user, including expired ones that have not been
+// removed yet.
+//
+// Parameters:
+//   - owner: The username of the topic owner.
+//
+// Returns:
+//   - A list of GuestTokens or an error.
+func (a *Manager) GuestTokens(owner string) ([]*GuestToken, error) {
+	rows, err := a.db.Query(selectGuestTokensByOwnerQuery, owner)
+	if err != nil {
+		return nil, err
+	}
+	return readGuestTokens(rows)
+}
+
+// AllGuestTokens returns all guest tokens, regardless of who created them.
+//
+// Returns:
+//   - A list of GuestTokens or an error.
+func (a *Manager) AllGuestTokens() ([]*GuestToken, error) {
+	rows, err := a.db.Query(selectGuestTokensQuery)
+	if err != nil {
+		return nil, err
+	}
+	return readGuestTokens(rows)
+}
+
+// RemoveGuestToken deletes the guest token with the given token value. If an owner is given, the token
+// is only deleted if it was created by that user.
+//
+// Parameters:
+//   - owner: The username of the topic owner, or an empty string to delete any guest token.
+//   - token: The guest token.
+//
+// Returns:
+//   - ErrGuestTokenNotFound if the guest token does not exist, or an error if the deletion fails.
+func (a *Manager) RemoveGuestToken(owner, token string) error {
+	var result sql.Result
+	var err error
+	if owner == "" {
+		result, err = a.db.Exec(deleteGuestTokenQuery, token)
+	} else {
+		result, err = a.db.Exec(deleteOwnGuestTokenQuery, owner, token)
+	}
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrGuestTokenNotFound
+	}
+	return nil
+}
+
+// AuthenticateGuestToken checks if the guest token exists and is not expired, and returns it if it does.
+//
+// Parameters:
+//   - token: The guest token.
+//
+// Returns:
+//   - The GuestToken or ErrUnauthenticated.
+func (a *Manager) AuthenticateGuestToken(token string) (*GuestToken, error) {
+	if !ValidGuestToken(token) {
+		return nil, ErrUnauthenticated
+	}
+	rows, err := a.db.Query(selectValidGuestTokenQuery, token, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	guests, err := readGuestTokens(rows)
+	if err != nil {
+		return nil, err
+	} else if len(guests) == 0 {
+		return nil, ErrUnauthenticated
+	}
+	return guests[0], nil
+}
+
+// RemoveExpiredGuestTokens deletes all guest tokens that are expired.
+//
+// Returns:
+//   - An error if the deletion fails.
+func (a *Manager) RemoveExpiredGuestTokens() error {
+	if _, err := a.db.Exec(deleteExpiredGuestTokensQuery, time.Now().Unix()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readGuestTokens(rows *sql.Rows) ([]*GuestToken, error) {
+	defer rows.Close()
+	guests := make([]*GuestToken, 0)
+	for rows.Next() {
+		var id, token, owner, topic, label string
+		var read, write bool
+		var messageLimit, expires, created int64
+		if err := rows.Scan(&id, &token, &owner, &topic, &read, &write, &label, &messageLimit, &expires, &created); err != nil {
+			return nil, err
+		}
+		guests = append(guests, &GuestToken{
+			ID:           id,
+			Token:        token,
+			Owner:        owner,
+			Topic:        topic,
+			Permission:   NewPermission(read, write),
+			Label:        label,
+			MessageLimit: messageLimit,
+			Expires:      unixOrZero(expires),
+			Created:      time.Unix(created, 0),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return guests, nil
+}
+
+// SetTopicSchema attaches a JSON schema to a topic reserved by the given user, replacing any existing schema.
+// Messages published to the topic with a JSON content type are validated against the schema. The schema is
+// removed along with the reservation. The schema itself is not validated here, see util.ParseJSONSchema.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - topic: The reserved topic.
+//   - schema: The JSON schema document.
+//   - mode: What to do with messages that do not match the schema.
+//
+// Returns:
+//   - ErrUnauthorized if the user does not own the topic, or an error if the update fails.
+func (a *Manager) SetTopicSchema(username, topic, schema string, mode SchemaMode) error {
+	if !AllowedUsername(username) || username == Everyone || !AllowedTopic(topic) || schema == "" || !mode.Valid() {
+		return ErrInvalidArgument
+	}
+	return execTx(a.db, func(tx *sql.Tx) error {
+		var reserved int
+		if err := tx.QueryRow(selectUserHasReservationQuery, username, escapeUnderscore(topic)).Scan(&reserved); err != nil {
+			return err
+		} else if reserved == 0 {
+			return ErrUnauthorized
+		}
+		_, err := tx.Exec(upsertTopicSchemaQuery, topic, username, schema, string(mode), time.Now().Unix())
+		return err
+	})
+}
+
+// TopicSchema returns the JSON schema attached to the given topic.
+//
+// Parameters:
+//   - topic: The topic.
+//
+// Returns:
+//   - The TopicSchema, ErrTopicSchemaNotFound if the topic has no schema, or an error if the query fails.
+func (a *Manager) TopicSchema(topic string) (*TopicSchema, error) {
+	var schema TopicSchema
+	var mode string
+	if err := a.db.QueryRow(selectTopicSchemaQuery, topic).Scan(&schema.Topic, &schema.Schema, &mode); errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTopicSchemaNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	schema.Mode = SchemaMode(mode)
+	return &schema, nil
+}
+
+// RemoveTopicSchema removes the JSON schema from a topic reserved by the given user.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - topic: The reserved topic.
+//
+// Returns:
+//   - ErrTopicSchemaNotFound if the topic has no schema owned by the user, or an error if the deletion fails.
+func (a *Manager) RemoveTopicSchema(username, topic string) error {
+	result, err := a.db.Exec(deleteTopicSchemaQuery, username, topic)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrTopicSchemaNotFound
+	}
+	return nil
+}
+
+// RenameReservation renames a topic reserved by the given user. The access control entries, invites, guest
+// tokens, silence windows, the escalation policy and the JSON schema of the topic are moved to the new topic, and the old topic name is kept as an
+// alias of the new topic (see TopicAlias), so that existing publish and subscribe URLs keep working. Aliases
+// of the old topic are updated to point to the new topic.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - topic: The reserved topic.
+//   - newTopic: The new topic name; it must not be reserved or be an alias of another topic.
+//   - deprecated: Whether the alias is deprecated, i.e. whether clients using it should be told to switch.
+//
+// Returns:
+//   - ErrUnauthorized if the user does not own the topic, errTopicOwnedByOthers if the new topic is
+//     already taken, or an error if the update fails.
+func (a *Manager) RenameReservation(username, topic, newTopic string, deprecated bool) error {
+	if !AllowedUsername(username) || username == Everyone || !AllowedTopic(topic) || !AllowedTopic(newTopic) || topic == newTopic {
+		return ErrInvalidArgument
+	}
+	return execTx(a.db, func(tx *sql.Tx) error {
+		var reserved, taken int
+		if err := tx.QueryRow(selectUserHasReservationQuery, username, escapeUnderscore(topic)).Scan(&reserved); err != nil {
+			return err
+		} else if reserved == 0 {
+			return ErrUnauthorized
+		}
+		if err := tx.QueryRow(selectOtherAccessCountQuery, escapeUnderscore(newTopic), escapeUnderscore(newTopic), username).Scan(&taken); err != nil {
+			return err
+		} else if taken > 0 {
+			return errTopicOwnedByOthers
+		}
+		if err := tx.QueryRow(selectOtherTopicAliasCountQuery, newTopic, username).Scan(&taken); err != nil {
+			return err
+		} else if taken > 0 {
+			return errTopicOwnedByOthers
+		}
+		if err := tx.QueryRow(selectUserHasReservationQuery, username, escapeUnderscore(newTopic)).Scan(&taken); err != nil {
+			return err
+		} else if taken > 0 {
+			return errTopicOwnedByOthers
+		}
+		if _, err := tx.Exec(renameTopicAccessQuery, escapeUnderscore(newTopic), username, escapeUnderscore(topic)); err != nil {
+			return err
+		}
+		for _, query := range []string{renameTopicInvitesQuery, renameTopicGuestTokensQuery, renameTopicSchemaQuery, renameTopicAliasesQuery, renameTopicSilencesQuery, renameTopicEscalationQuery} {
+			if _, err := tx.Exec(query, newTopic, username, topic); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(deleteTopicAliasQuery, username, newTopic); err != nil {
+			return err // Renaming a topic back to a former name removes that alias
+		}
+		_, err := tx.Exec(insertTopicAliasQuery, topic, newTopic, username, deprecated, time.Now().Unix())
+		return err
+	})
+}
+
+// TopicAlias returns the alias with the given name, i.e. the former name of a renamed topic.
+//
+// Parameters:
+//   - alias: The alias (former topic name).
+//
+// Returns:
+//   - The TopicAlias, ErrTopicAliasNotFound if there is no such alias, or an error if the query fails.
+func (a *Manager) TopicAlias(alias string) (*TopicAlias, error) {
+	rows, err := a.db.Query(selectTopicAliasQuery, alias)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, ErrTopicAliasNotFound
+	}
+	return a.readTopicAlias(rows)
+}
+
+// TopicAliases returns all aliases of topics renamed by the given user.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//
+// Returns:
+//   - A list of aliases, or an error if the query fails.
+func (a *Manager) TopicAliases(username string) ([]*TopicAlias, error) {
+	rows, err := a.db.Query(selectTopicAliasesQuery, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return a.readTopicAliases(rows)
+}
+
+// AliasesForTopic returns all aliases of the given topic, i.e. its former names.
+//
+// Parameters:
+//   - topic: The current topic name.
+//
+// Returns:
+//   - A list of aliases, or an error if the query fails.
+func (a *Manager) AliasesForTopic(topic string) ([]*TopicAlias, error) {
+	rows, err := a.db.Query(selectTopicAliasesForTopicQuery, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return a.readTopicAliases(rows)
+}
+
+func (a *Manager) readTopicAliases(rows *sql.Rows) ([]*TopicAlias, error) {
+	aliases := make([]*TopicAlias, 0)
+	for rows.Next() {
+		alias, err := a.readTopicAlias(rows)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (a *Manager) readTopicAlias(rows *sql.Rows) (*TopicAlias, error) {
+	var alias, topic string
+	var deprecated bool
+	var created int64
+	if err := rows.Scan(&alias, &topic, &deprecated, &created); err != nil {
+		return nil, err
+	}
+	return &TopicAlias{
+		Alias:      alias,
+		Topic:      topic,
+		Deprecated: deprecated,
+		Created:    time.Unix(created, 0),
+	}, nil
+}
+
+// RemoveTopicAlias removes an alias of a topic renamed by the given user. The old topic name can then
+// be reserved again.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - alias: The alias (former topic name).
+//
+// Returns:
+//   - ErrTopicAliasNotFound if the user has no such alias, or an error if the deletion fails.
+func (a *Manager) RemoveTopicAlias(username, alias string) error {
+	result, err := a.db.Exec(deleteTopicAliasQuery, username, alias)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrTopicAliasNotFound
+	}
+	return nil
+}
+
+// AddTopicSilence adds a silence window to a topic reserved by the given user, e.g. for nightly maintenance.
+// While the window is active (see TopicSilence.Active), messages are cached and delivered to subscribers,
+// but not forwarded via push notifications, email or phone calls. Only the newest windows of a user are kept.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - topic: The reserved topic.
+//   - start: The start of the (first) window.
+//   - end: The end of the (first) window; repeating windows must be shorter than the repeat interval.
+//   - repeat: Whether and how often the window repeats.
+//   - summary: Whether a summary message is published when the window ends.
+//
+// Returns:
+//   - The created TopicSilence, ErrUnauthorized if the user does not own the topic, or an error if the insert fails.
+func (a *Manager) AddTopicSilence(username, topic string, start, end time.Time, repeat SilenceRepeat, summary bool) (*TopicSilence, error) {
+	if !AllowedUsername(username) || username == Everyone || !AllowedTopic(topic) || !repeat.Valid() || !end.After(start) {
+		return nil, ErrInvalidArgument
+	} else if interval := repeat.Interval(); interval > 0 && end.Sub(start) >= interval {
+		return nil, ErrInvalidArgument
+	}
+	silence := &TopicSilence{
+		ID:      util.RandomStringPrefix(topicSilenceIDPrefix, topicSilenceIDLength),
+		Owner:   username,
+		Topic:   topic,
+		Start:   time.Unix(start.Unix(), 0),
+		End:     time.Unix(end.Unix(), 0),
+		Repeat:  repeat,
+		Summary: summary,
+		Created: time.Unix(time.Now().Unix(), 0),
+	}
+	err := execTx(a.db, func(tx *sql.Tx) error {
+		var reserved int
+		if err := tx.QueryRow(selectUserHasReservationQuery, username, escapeUnderscore(topic)).Scan(&reserved); err != nil {
+			return err
+		} else if reserved == 0 {
+			return ErrUnauthorized
+		}
+		if _, err := tx.Exec(insertTopicSilenceQuery, silence.ID, topic, username, silence.Start.Unix(), silence.End.Unix(), string(repeat), summary, silence.Created.Unix()); err != nil {
+			return err
+		}
+		_, err := tx.Exec(deleteExcessTopicSilencesQuery, username, username, topicSilenceMaxCount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return silence, nil
+}
+
+// TopicSilences returns all silence windows of the given topic.
+//
+// Parameters:
+//   - topic: The topic.
+//
+// Returns:
+//   - A list of silence windows, or an error if the query fails.
+func (a *Manager) TopicSilences(topic string) ([]*TopicSilence, error) {
+	rows, err := a.db.Query(selectTopicSilencesQuery, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return a.readTopicSilences(rows)
+}
+
+// TopicSilencesWithSummary returns all silence windows that started before the given time and for which
+// a summary message is to be published when they end. See also MarkTopicSilenceSummarized.
+//
+// Parameters:
+//   - now: The current time.
+//
+// Returns:
+//   - A list of silence windows, or an error if the query fails.
+func (a *Manager) TopicSilencesWithSummary(now time.Time) ([]*TopicSilence, error) {
+	rows, err := a.db.Query(selectTopicSilencesWithSummaryQuery, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return a.readTopicSilences(rows)
+}
+
+func (a *Manager) readTopicSilences(rows *sql.Rows) ([]*TopicSilence, error) {
+	silences := make([]*TopicSilence, 0)
+	for rows.Next() {
+		var id, owner, topic, repeat string
+		var starts, ends, summarized, created int64
+		var summary bool
+		if err := rows.Scan(&id, &owner, &topic, &starts, &ends, &repeat, &summary, &summarized, &created); err != nil {
+			return nil, err
+		}
+		silence := &TopicSilence{
+			ID:      id,
+			Owner:   owner,
+			Topic:   topic,
+			Start:   time.Unix(starts, 0),
+			End:     time.Unix(ends, 0),
+			Repeat:  SilenceRepeat(repeat),
+			Summary: summary,
+			Created: time.Unix(created, 0),
+		}
+		if summarized > 0 {
+			silence.Summarized = time.Unix(summarized, 0)
+		}
+		silences = append(silences, silence)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return silences, nil
+}
+
+// MarkTopicSilenceSummarized records that a summary was published for the occurrence of the given
+// silence window that ended at the given time, so that it is only published once.
+//
+// Parameters:
+//   - id: The ID of the silence window.
+//   - end: The end of the summarized occurrence of the window.
+//
+// Returns:
+//   - An error if the update fails.
+func (a *Manager) MarkTopicSilenceSummarized(id string, end time.Time) error {
+	_, err := a.db.Exec(updateTopicSilenceSummarizedQuery, end.Unix(), id)
+	return err
+}
+
+// RemoveTopicSilence removes a silence window from a topic reserved by the given user.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - topic: The reserved topic.
+//   - id: The ID of the silence window.
+//
+// Returns:
+//   - ErrTopicSilenceNotFound if the user has no such silence window, or an error if the deletion fails.
+func (a *Manager) RemoveTopicSilence(username, topic, id string) error {
+	result, err := a.db.Exec(deleteTopicSilenceQuery, username, topic, id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrTopicSilenceNotFound
+	}
+	return nil
+}
+
+// RemoveExpiredTopicSilences removes all non-repeating silence windows that have ended, and for
+// which the summary (if any) has been published.
+//
+// Returns:
+//   - An error if the deletion fails.
+func (a *Manager) RemoveExpiredTopicSilences() error {
+	_, err := a.db.Exec(deleteExpiredTopicSilencesQuery, time.Now().Unix())
+	return err
+}
+
+// SetTopicEscalation sets the escalation policy of a topic reserved by the given user, replacing any existing
+// policy. Messages published to the topic that are not acknowledged in time are re-published according to the
+// steps of the policy. The policy is removed along with the reservation. The steps are not validated here.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - topic: The reserved topic.
+//   - minPriority: The minimum priority of messages to escalate (1-5).
+//   - steps: The escalation steps, in the order in which they are executed.
+//
+// Returns:
+//   - ErrUnauthorized if the user does not own the topic, or an error if the update fails.
+func (a *Manager) SetTopicEscalation(username, topic string, minPriority int, steps []*EscalationStep) error {
+	if !AllowedUsername(username) || username == Everyone || !AllowedTopic(topic) || minPriority < 1 || minPriority > 5 || len(steps) == 0 {
+		return ErrInvalidArgument
+	}
+	stepsJSON, err := json.Marshal(steps)
+	if err != nil {
+		return err
+	}
+	return execTx(a.db, func(tx *sql.Tx) error {
+		var reserved int
+		if err := tx.QueryRow(selectUserHasReservationQuery, username, escapeUnderscore(topic)).Scan(&reserved); err != nil {
+			return err
+		} else if reserved == 0 {
+			return ErrUnauthorized
+		}
+		_, err := tx.Exec(upsertTopicEscalationQuery, topic, username, minPriority, string(stepsJSON), time.Now().Unix())
+		return err
+	})
+}
+
+// TopicEscalation returns the escalation policy of the given topic.
+//
+// Parameters:
+//   - topic: The topic.
+//
+// Returns:
+//   - The TopicEscalation, ErrTopicEscalationNotFound if the topic has no policy, or an error if the query fails.
+func (a *Manager) TopicEscalation(topic string) (*TopicEscalation, error) {
+	var escalation TopicEscalation
+	var steps string
+	if err := a.db.QueryRow(selectTopicEscalationQuery, topic).Scan(&escalation.Topic, &escalation.Owner, &escalation.MinPriority, &steps); errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTopicEscalationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(steps), &escalation.Steps); err != nil {
+		return nil, err
+	}
+	return &escalation, nil
+}
+
+// RemoveTopicEscalation removes the escalation policy from a topic reserved by the given user.
+//
+// Parameters:
+//   - username: The username of the topic owner.
+//   - topic: The reserved topic.
+//
+// Returns:
+//   - ErrTopicEscalationNotFound if the topic has no policy owned by the user, or an error if the deletion fails.
+func (a *Manager) RemoveTopicEscalation(username, topic string) error {
+	result, err := a.db.Exec(deleteTopicEscalationQuery, username, topic)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrTopicEscalationNotFound
+	}
+	return nil
+}
+
+// MuteTopic mutes a topic for the given user until the given time, replacing an existing mute of the topic.
+// While a topic is muted, its messages are still cached and delivered to subscribers, but not sent to the user's
+// Web Push subscriptions or e-mail address.
+//
+// Parameters:
+//   - userID: The ID of the user.
+//   - topic: The topic to mute.
+//   - until: The time until which the topic is muted, must be in the future.
+//
+// Returns:
+//   - ErrTooManyTopicMutes if the user has muted too many topics, or an error if the insert fails.
+func (a *Manager) MuteTopic(userID, topic string, until time.Time) error {
+	now := time.Now()
+	if userID == "" || userID == everyoneID || !AllowedTopic(topic) || !until.After(now) {
+		return ErrInvalidArgument
+	}
+	return execTx(a.db, func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow(selectTopicMutesCountQuery, userID, topic, now.Unix()).Scan(&count); err != nil {
+			return err
+		} else if count >= topicMuteMaxCount {
+			return ErrTooManyTopicMutes
+		}
+		_, err := tx.Exec(upsertTopicMuteQuery, userID, topic, until.Unix())
+		return err
+	})
+}
+
+// TopicMutes returns the topics muted by the given user that have not expired, sorted by topic.
+//
+// Parameters:
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - A list of TopicMute, or an error if the query fails.
+func (a *Manager) TopicMutes(userID string) ([]*TopicMute, error) {
+	rows, err := a.db.Query(selectTopicMutesQuery, userID, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mutes := make([]*TopicMute, 0)
+	for rows.Next() {
+		var mute TopicMute
+		var until int64
+		if err := rows.Scan(&mute.UserID, &mute.Topic, &until); err != nil {
+			return nil, err
+		}
+		mute.Until = time.Unix(until, 0)
+		mutes = append(mutes, &mute)
+	}
+	return mutes, rows.Err()
+}
+
+// TopicMutedUserIDs returns the IDs of the users that currently mute the given topic.
+//
+// Parameters:
+//   - topic: The topic.
+//
+// Returns:
+//   - A list of user IDs, or an error if the query fails.
+func (a *Manager) TopicMutedUserIDs(topic string) ([]string, error) {
+	rows, err := a.db.Query(selectTopicMutedUserIDsQuery, topic, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	userIDs := make([]string, 0)
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// TopicMutedByEmail returns true if a user with the given e-mail address currently mutes the given topic.
+//
+// Parameters:
+//   - topic: The topic.
+//   - email: The e-mail address, compared case-insensitively.
+//
+// Returns:
+//   - True if the topic is muted for the e-mail address, or an error if the query fails.
+func (a *Manager) TopicMutedByEmail(topic, email string) (bool, error) {
+	var count int
+	if err := a.db.QueryRow(selectTopicMutedByEmailQuery, topic, time.Now().Unix(), email).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// UnmuteTopic removes the mute of a topic for the given user.
+//
+// Parameters:
+//   - userID: The ID of the user.
+//   - topic: The muted topic.
+//
+// Returns:
+//   - ErrTopicMuteNotFound if the user has not muted the topic, or an error if the deletion fails.
+func (a *Manager) UnmuteTopic(userID, topic string) error {
+	result, err := a.db.Exec(deleteTopicMuteQuery, userID, topic)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrTopicMuteNotFound
+	}
+	return nil
+}
+
+// RemoveExpiredTopicMutes deletes all topic mutes that have expired.
+//
+// Returns:
+//   - An error if the deletion fails.
+func (a *Manager) RemoveExpiredTopicMutes() error {
+	_, err := a.db.Exec(deleteExpiredTopicMutesQuery, time.Now().Unix())
+	return err
+}
+
+// DefaultAccess returns the default read/write access if no access control entry matches.
+//
+// Returns:
+//   - The default permission.
+func (a *Manager) DefaultAccess() Permission {
+	return a.config.DefaultAccess
+}
+
+// AddTier creates a new tier in the database.
+//
+// Parameters:
+//   - tier: The tier to add.
+//
+// Returns:
+//   - An error if the tier cannot be added.
+func (a *Manager) AddTier(tier *Tier) error {
+	if tier.ID == "" {
+		tier.ID = util.RandomStringPrefix(tierIDPrefix, tierIDLength)
+	}
+	if _, err := a.db.Exec(insertTierQuery, tier.ID, tier.Code, tier.Name, tier.MessageLimit, int64(tier.MessageExpiryDuration.Seconds()), tier.EmailLimit, tier.CallLimit, tier.ReservationLimit, tier.AttachmentFileSizeLimit, tier.AttachmentTotalSizeLimit, int64(tier.AttachmentExpiryDuration.Seconds()), tier.AttachmentBandwidthLimit, formatContentTypes(tier.AttachmentAllowedTypes), formatContentTypes(tier.AttachmentDeniedTypes), nullString(tier.StripeMonthlyPriceID), nullString(tier.StripeYearlyPriceID)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateTier updates a tier's properties in the database.
+//
+// Parameters:
+//   - tier: The tier to update.
+//
+// Returns:
+//   - An error if the update fails.
+func (a *Manager) UpdateTier(tier *Tier) error {
+	if _, err := a.db.Exec(updateTierQuery, tier.Name, tier.MessageLimit, int64(tier.MessageExpiryDuration.Seconds()), tier.EmailLimit, tier.CallLimit, tier.ReservationLimit, tier.AttachmentFileSizeLimit, tier.AttachmentTotalSizeLimit, int64(tier.AttachmentExpiryDuration.Seconds()), tier.AttachmentBandwidthLimit, formatContentTypes(tier.AttachmentAllowedTypes), formatContentTypes(tier.AttachmentDeniedTypes), nullString(tier.StripeMonthlyPriceID), nullString(tier.StripeYearlyPriceID), tier.Code); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1979,100 +3903,277 @@ func (a *Manager) RemoveTier(code string) error {
 //   - billing: The billing information.
 //
 // Returns:
-//   - An error if the update fails.
-func (a *Manager) ChangeBilling(username string, billing *Billing) error {
-	if _, err := a.db.Exec(updateBillingQuery, nullString(billing.StripeCustomerID), nullString(billing.StripeSubscriptionID), nullString(string(billing.StripeSubscriptionStatus)), nullString(string(billing.StripeSubscriptionInterval)), nullInt64(billing.StripeSubscriptionPaidUntil.Unix()), nullInt64(billing.StripeSubscriptionCancelAt.Unix()), username); err != nil {
-		return err
+//   - An error if the update fails.
+func (a *Manager) ChangeBilling(username string, billing *Billing) error {
+	if _, err := a.db.Exec(updateBillingQuery, nullString(billing.StripeCustomerID), nullString(billing.StripeSubscriptionID), nullString(string(billing.StripeSubscriptionStatus)), nullString(string(billing.StripeSubscriptionInterval)), nullInt64(billing.StripeSubscriptionPaidUntil.Unix()), nullInt64(billing.StripeSubscriptionCancelAt.Unix()), username); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tiers returns a list of all Tier structs.
+//
+// Returns:
+//   - A list of Tiers or an error.
+func (a *Manager) Tiers() ([]*Tier, error) {
+	rows, err := a.db.Query(selectTiersQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tiers := make([]*Tier, 0)
+	for {
+		tier, err := a.readTier(rows)
+		if errors.Is(err, ErrTierNotFound) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+// Tier returns a Tier based on the code, or ErrTierNotFound if it does not exist.
+//
+// Parameters:
+//   - code: The tier code.
+//
+// Returns:
+//   - The Tier or ErrTierNotFound.
+func (a *Manager) Tier(code string) (*Tier, error) {
+	rows, err := a.db.Query(selectTierByCodeQuery, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return a.readTier(rows)
+}
+
+// TierByStripePrice returns a Tier based on the Stripe price ID, or ErrTierNotFound if it does not exist.
+//
+// Parameters:
+//   - priceID: The Stripe price ID.
+//
+// Returns:
+//   - The Tier or ErrTierNotFound.
+func (a *Manager) TierByStripePrice(priceID string) (*Tier, error) {
+	rows, err := a.db.Query(selectTierByPriceIDQuery, priceID, priceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return a.readTier(rows)
+}
+
+func (a *Manager) readTier(rows *sql.Rows) (*Tier, error) {
+	var id, code, name string
+	var attachmentAllowedTypes, attachmentDeniedTypes, stripeMonthlyPriceID, stripeYearlyPriceID sql.NullString
+	var messagesLimit, messagesExpiryDuration, emailsLimit, callsLimit, reservationsLimit, attachmentFileSizeLimit, attachmentTotalSizeLimit, attachmentExpiryDuration, attachmentBandwidthLimit sql.NullInt64
+	if !rows.Next() {
+		return nil, ErrTierNotFound
+	}
+	if err := rows.Scan(&id, &code, &name, &messagesLimit, &messagesExpiryDuration, &emailsLimit, &callsLimit, &reservationsLimit, &attachmentFileSizeLimit, &attachmentTotalSizeLimit, &attachmentExpiryDuration, &attachmentBandwidthLimit, &attachmentAllowedTypes, &attachmentDeniedTypes, &stripeMonthlyPriceID, &stripeYearlyPriceID); err != nil {
+		return nil, err
+	} else if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// When changed, note readUser() as well
+	return &Tier{
+		ID:                       id,
+		Code:                     code,
+		Name:                     name,
+		MessageLimit:             messagesLimit.Int64,
+		MessageExpiryDuration:    time.Duration(messagesExpiryDuration.Int64) * time.Second,
+		EmailLimit:               emailsLimit.Int64,
+		CallLimit:                callsLimit.Int64,
+		ReservationLimit:         reservationsLimit.Int64,
+		AttachmentFileSizeLimit:  attachmentFileSizeLimit.Int64,
+		AttachmentTotalSizeLimit: attachmentTotalSizeLimit.Int64,
+		AttachmentExpiryDuration: time.Duration(attachmentExpiryDuration.Int64) * time.Second,
+		AttachmentBandwidthLimit: attachmentBandwidthLimit.Int64,
+		AttachmentAllowedTypes:   parseContentTypes(attachmentAllowedTypes.String), // May be empty
+		AttachmentDeniedTypes:    parseContentTypes(attachmentDeniedTypes.String),  // May be empty
+		StripeMonthlyPriceID:     stripeMonthlyPriceID.String,                      // May be empty
+		StripeYearlyPriceID:      stripeYearlyPriceID.String,                       // May be empty
+	}, nil
+}
+
+// AddRole creates a new custom role with the given capabilities. Built-in roles (admin, user) cannot be added.
+//
+// Parameters:
+//   - role: The custom role to add.
+//
+// Returns:
+//   - ErrRoleExists if the role already exists, or another error if the role cannot be added.
+func (a *Manager) AddRole(role *CustomRole) error {
+	if err := validateCustomRole(role); err != nil {
+		return err
+	}
+	if _, err := a.db.Exec(insertRoleQuery, role.Name, formatCapabilities(role.Capabilities)); err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey || sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique) {
+			return ErrRoleExists
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateRole replaces the capabilities of an existing custom role.
+//
+// Parameters:
+//   - role: The custom role to update.
+//
+// Returns:
+//   - ErrRoleNotFound if the role does not exist, or another error if the update fails.
+func (a *Manager) UpdateRole(role *CustomRole) error {
+	if err := validateCustomRole(role); err != nil {
+		return err
+	}
+	result, err := a.db.Exec(updateRoleQuery, formatCapabilities(role.Capabilities), role.Name)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// RemoveRole deletes the custom role with the given name. A role cannot be removed while it
+// is still assigned to users.
+//
+// Parameters:
+//   - name: The name of the custom role.
+//
+// Returns:
+//   - ErrRoleInUse if users still have the role, or another error if deletion fails.
+func (a *Manager) RemoveRole(name Role) error {
+	if !AllowedCustomRole(name) {
+		return ErrInvalidArgument
 	}
-	return nil
+	return execTx(a.db, func(tx *sql.Tx) error {
+		var count int64
+		if err := tx.QueryRow(selectRoleUserCountQuery, name).Scan(&count); err != nil {
+			return err
+		} else if count > 0 {
+			return ErrRoleInUse
+		}
+		if _, err := tx.Exec(deleteRoleQuery, name); err != nil {
+			return err
+		}
+		return nil
+	})
 }
 
-// Tiers returns a list of all Tier structs.
+// Roles returns a list of all custom roles. The built-in roles are not included.
 //
 // Returns:
-//   - A list of Tiers or an error.
-func (a *Manager) Tiers() ([]*Tier, error) {
-	rows, err := a.db.Query(selectTiersQuery)
+//   - A list of CustomRoles or an error.
+func (a *Manager) Roles() ([]*CustomRole, error) {
+	rows, err := a.db.Query(selectRolesQuery)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	tiers := make([]*Tier, 0)
+	roles := make([]*CustomRole, 0)
 	for {
-		tier, err := a.readTier(rows)
-		if errors.Is(err, ErrTierNotFound) {
+		role, err := a.readRole(rows)
+		if errors.Is(err, ErrRoleNotFound) {
 			break
 		} else if err != nil {
 			return nil, err
 		}
-		tiers = append(tiers, tier)
-	}
-	return tiers, nil
-}
-
-// Tier returns a Tier based on the code, or ErrTierNotFound if it does not exist.
-//
-// Parameters:
-//   - code: The tier code.
-//
-// Returns:
-//   - The Tier or ErrTierNotFound.
-func (a *Manager) Tier(code string) (*Tier, error) {
-	rows, err := a.db.Query(selectTierByCodeQuery, code)
-	if err != nil {
-		return nil, err
+		roles = append(roles, role)
 	}
-	defer rows.Close()
-	return a.readTier(rows)
+	return roles, nil
 }
 
-// TierByStripePrice returns a Tier based on the Stripe price ID, or ErrTierNotFound if it does not exist.
+// Role returns the custom role with the given name, or ErrRoleNotFound if it does not exist.
 //
 // Parameters:
-//   - priceID: The Stripe price ID.
+//   - name: The name of the custom role.
 //
 // Returns:
-//   - The Tier or ErrTierNotFound.
-func (a *Manager) TierByStripePrice(priceID string) (*Tier, error) {
-	rows, err := a.db.Query(selectTierByPriceIDQuery, priceID, priceID)
+//   - The CustomRole or ErrRoleNotFound.
+func (a *Manager) Role(name Role) (*CustomRole, error) {
+	rows, err := a.db.Query(selectRoleQuery, name)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	return a.readTier(rows)
+	return a.readRole(rows)
 }
 
-func (a *Manager) readTier(rows *sql.Rows) (*Tier, error) {
-	var id, code, name string
-	var stripeMonthlyPriceID, stripeYearlyPriceID sql.NullString
-	var messagesLimit, messagesExpiryDuration, emailsLimit, callsLimit, reservationsLimit, attachmentFileSizeLimit, attachmentTotalSizeLimit, attachmentExpiryDuration, attachmentBandwidthLimit sql.NullInt64
+func (a *Manager) readRole(rows *sql.Rows) (*CustomRole, error) {
+	var name, capabilities string
 	if !rows.Next() {
-		return nil, ErrTierNotFound
+		return nil, ErrRoleNotFound
 	}
-	if err := rows.Scan(&id, &code, &name, &messagesLimit, &messagesExpiryDuration, &emailsLimit, &callsLimit, &reservationsLimit, &attachmentFileSizeLimit, &attachmentTotalSizeLimit, &attachmentExpiryDuration, &attachmentBandwidthLimit, &stripeMonthlyPriceID, &stripeYearlyPriceID); err != nil {
+	if err := rows.Scan(&name, &capabilities); err != nil {
 		return nil, err
 	} else if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	// When changed, note readUser() as well
-	return &Tier{
-		ID:                       id,
-		Code:                     code,
-		Name:                     name,
-		MessageLimit:             messagesLimit.Int64,
-		MessageExpiryDuration:    time.Duration(messagesExpiryDuration.Int64) * time.Second,
-		EmailLimit:               emailsLimit.Int64,
-		CallLimit:                callsLimit.Int64,
-		ReservationLimit:         reservationsLimit.Int64,
-		AttachmentFileSizeLimit:  attachmentFileSizeLimit.Int64,
-		AttachmentTotalSizeLimit: attachmentTotalSizeLimit.Int64,
-		AttachmentExpiryDuration: time.Duration(attachmentExpiryDuration.Int64) * time.Second,
-		AttachmentBandwidthLimit: attachmentBandwidthLimit.Int64,
-		StripeMonthlyPriceID:     stripeMonthlyPriceID.String, // May be empty
-		StripeYearlyPriceID:      stripeYearlyPriceID.String,  // May be empty
+	return &CustomRole{
+		Name:         Role(name),
+		Capabilities: parseCapabilities(capabilities),
 	}, nil
 }
 
+// checkRoleExistsTx returns ErrRoleNotFound if the given role is neither a built-in role,
+// nor a custom role defined in the database.
+func (a *Manager) checkRoleExistsTx(tx *sql.Tx, role Role) error {
+	if role == RoleAdmin || role == RoleUser {
+		return nil
+	}
+	rows, err := tx.Query(selectRoleQuery, role)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return ErrRoleNotFound
+	}
+	return rows.Err()
+}
+
+func validateCustomRole(role *CustomRole) error {
+	if !AllowedCustomRole(role.Name) {
+		return ErrInvalidArgument
+	}
+	for _, capability := range role.Capabilities {
+		if !AllowedCapability(capability) {
+			return ErrInvalidArgument
+		}
+	}
+	return nil
+}
+
+func formatCapabilities(capabilities []Capability) string {
+	return strings.Join(util.Map(capabilities, func(c Capability) string { return string(c) }), ",")
+}
+
+func parseCapabilities(s string) []Capability {
+	if s == "" {
+		return []Capability{}
+	}
+	return util.Map(strings.Split(s, ","), func(c string) Capability { return Capability(c) })
+}
+
+func formatContentTypes(contentTypes []string) string {
+	return strings.Join(contentTypes, ",")
+}
+
+func parseContentTypes(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
 // Close closes the underlying database.
 //
 // Returns:
@@ -2176,7 +4277,7 @@ func (a *Manager) maybeProvisionGrants(tx *sql.Tx) error {
 			if err := a.resetAccessTx(tx, username, grant.TopicPattern); err != nil {
 				return fmt.Errorf("failed to reset access for user %s and topic %s: %v", username, grant.TopicPattern, err)
 			}
-			if err := a.allowAccessTx(tx, username, grant.TopicPattern, grant.Permission, true); err != nil {
+			if err := a.allowAccessTx(tx, username, grant.TopicPattern, grant.Permission, true, time.Time{}); err != nil {
 				return err
 			}
 		}
@@ -2409,6 +4510,214 @@ func migrateFrom5(db *sql.DB) error {
 	return tx.Commit()
 }
 
+func migrateFrom6(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 6 to 7")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate6To7UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 7); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom7(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 7 to 8")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate7To8UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 8); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom8(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 8 to 9")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate8To9UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 9); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom9(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 9 to 10")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate9To10UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 10); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom10(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 10 to 11")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate10To11UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 11); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom11(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 11 to 12")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate11To12UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 12); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom12(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 12 to 13")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate12To13UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 13); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom13(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 13 to 14")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate13To14UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 14); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom14(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 14 to 15")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate14To15UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 15); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom15(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 15 to 16")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate15To16UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 16); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom16(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 16 to 17")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate16To17UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 17); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom17(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 17 to 18")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate17To18UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 18); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateFrom18(db *sql.DB) error {
+	log.Tag(tag).Info("Migrating user database schema: from 18 to 19")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(migrate18To19UpdateQueries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(updateSchemaVersion, 19); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func nullString(s string) sql.NullString {
 	if s == "" {
 		return sql.NullString{}
@@ -2423,6 +4732,22 @@ func nullInt64(v int64) sql.NullInt64 {
 	return sql.NullInt64{Int64: v, Valid: true}
 }
 
+// unixOrZero converts a Unix timestamp to a time.Time, treating 0 as "not set" (zero time)
+func unixOrZero(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
+
+// unixOrZeroInt64 converts a time.Time to a Unix timestamp, treating the zero time as 0 ("not set")
+func unixOrZeroInt64(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
 // execTx executes a function in a transaction. If the function returns an error, the transaction is rolled back.
 func execTx(db *sql.DB, f func(tx *sql.Tx) error) error {
 	tx, err := db.Begin()
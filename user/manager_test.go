@@ -2,6 +2,7 @@ package user
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
@@ -51,10 +52,10 @@ func TestManager_FullScenario_Default_DenyAll(t *testing.T) {
 	benGrants, err := a.Grants("ben")
 	require.Nil(t, err)
 	require.Equal(t, []Grant{
-		{"everyonewrite", PermissionDenyAll, false},
-		{"mytopic", PermissionReadWrite, false},
-		{"writeme", PermissionWrite, false},
-		{"readme", PermissionRead, false},
+		{"everyonewrite", PermissionDenyAll, false, time.Time{}},
+		{"mytopic", PermissionReadWrite, false, time.Time{}},
+		{"writeme", PermissionWrite, false, time.Time{}},
+		{"readme", PermissionRead, false, time.Time{}},
 	}, benGrants)
 
 	john, err := a.Authenticate("john", "john")
@@ -66,10 +67,10 @@ func TestManager_FullScenario_Default_DenyAll(t *testing.T) {
 	johnGrants, err := a.Grants("john")
 	require.Nil(t, err)
 	require.Equal(t, []Grant{
-		{"mytopic_deny*", PermissionDenyAll, false},
-		{"mytopic_ro*", PermissionRead, false},
-		{"mytopic*", PermissionReadWrite, false},
-		{"*", PermissionRead, false},
+		{"mytopic_deny*", PermissionDenyAll, false, time.Time{}},
+		{"mytopic_ro*", PermissionRead, false, time.Time{}},
+		{"mytopic*", PermissionReadWrite, false, time.Time{}},
+		{"*", PermissionRead, false, time.Time{}},
 	}, johnGrants)
 
 	notben, err := a.Authenticate("ben", "this is wrong")
@@ -147,7 +148,9 @@ func TestManager_Access_Order_LengthWriteRead(t *testing.T) {
 func TestManager_AddUser_Invalid(t *testing.T) {
 	a := newTestManager(t, PermissionDenyAll)
 	require.Equal(t, ErrInvalidArgument, a.AddUser("  invalid  ", "pass", RoleAdmin, false))
-	require.Equal(t, ErrInvalidArgument, a.AddUser("validuser", "pass", "invalid-role", false))
+	require.Equal(t, ErrInvalidArgument, a.AddUser("validuser", "pass", "Invalid Role", false))
+	require.Equal(t, ErrInvalidArgument, a.AddUser("validuser", "pass", RoleAnonymous, false))
+	require.Equal(t, ErrRoleNotFound, a.AddUser("validuser", "pass", "unknown-role", false))
 }
 
 func TestManager_AddUser_Timing(t *testing.T) {
@@ -276,10 +279,10 @@ func TestManager_UserManagement(t *testing.T) {
 	benGrants, err := a.Grants("ben")
 	require.Nil(t, err)
 	require.Equal(t, []Grant{
-		{"everyonewrite", PermissionDenyAll, false},
-		{"mytopic", PermissionReadWrite, false},
-		{"writeme", PermissionWrite, false},
-		{"readme", PermissionRead, false},
+		{"everyonewrite", PermissionDenyAll, false, time.Time{}},
+		{"mytopic", PermissionReadWrite, false, time.Time{}},
+		{"writeme", PermissionWrite, false, time.Time{}},
+		{"readme", PermissionRead, false, time.Time{}},
 	}, benGrants)
 
 	everyone, err := a.User(Everyone)
@@ -291,8 +294,8 @@ func TestManager_UserManagement(t *testing.T) {
 	everyoneGrants, err := a.Grants(Everyone)
 	require.Nil(t, err)
 	require.Equal(t, []Grant{
-		{"everyonewrite", PermissionReadWrite, false},
-		{"announcements", PermissionRead, false},
+		{"everyonewrite", PermissionReadWrite, false, time.Time{}},
+		{"announcements", PermissionRead, false, time.Time{}},
 	}, everyoneGrants)
 
 	// Ben: Before revoking
@@ -360,6 +363,252 @@ func TestManager_ChangePassword(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestManager_ExpirePassword(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.False(t, ben.PasswordExpired)
+	token, err := a.CreateToken(ben.ID, "", time.Unix(0, 0), netip.IPv4Unspecified(), false)
+	require.Nil(t, err)
+
+	require.Nil(t, a.ExpirePassword("ben"))
+	ben, err = a.User("ben")
+	require.Nil(t, err)
+	require.True(t, ben.PasswordExpired)
+	_, err = a.Authenticate("ben", "ben")
+	require.Equal(t, ErrPasswordExpired, err)
+	_, err = a.Authenticate("ben", "incorrect")
+	require.Equal(t, ErrUnauthenticated, err)
+	_, err = a.AuthenticateToken(token.Value)
+	require.Equal(t, ErrUnauthenticated, err)
+
+	// Changing the password clears the flag
+	require.Nil(t, a.ChangePassword("ben", "newpass", false))
+	_, err = a.Authenticate("ben", "newpass")
+	require.Nil(t, err)
+
+	require.Equal(t, ErrUserNotFound, a.ExpirePassword("doesnotexist"))
+}
+
+func TestManager_Authenticate_AuthCache(t *testing.T) {
+	a, err := NewManager(&Config{
+		Filename:            filepath.Join(t.TempDir(), "user.db"),
+		DefaultAccess:       PermissionDenyAll,
+		BcryptCost:          bcrypt.MinCost,
+		QueueWriterInterval: DefaultUserStatsQueueWriterInterval,
+		AuthCacheTTL:        time.Minute,
+	})
+	require.Nil(t, err)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+
+	// Only successful authentications are cached
+	_, err = a.Authenticate("ben", "incorrect")
+	require.Equal(t, ErrUnauthenticated, err)
+	require.Equal(t, 0, a.authCache.Size())
+	u, err := a.Authenticate("ben", "ben")
+	require.Nil(t, err)
+	require.Equal(t, "ben", u.Name)
+	require.Equal(t, 1, a.authCache.Size())
+	u, err = a.Authenticate("ben", "ben")
+	require.Nil(t, err)
+	require.Equal(t, "ben", u.Name)
+	require.Equal(t, 1, a.authCache.Size())
+
+	// Changing the password invalidates the cache
+	require.Nil(t, a.ChangePassword("ben", "newpass", false))
+	require.Equal(t, 0, a.authCache.Size())
+	_, err = a.Authenticate("ben", "ben")
+	require.Equal(t, ErrUnauthenticated, err)
+	_, err = a.Authenticate("ben", "newpass")
+	require.Nil(t, err)
+	require.Equal(t, 1, a.authCache.Size())
+
+	// Cached entries are not used if the password hash changed behind the cache's back
+	a.authCache.Add(&User{ID: u.ID, Name: "ben", Hash: "old hash"}, "oldpass")
+	_, err = a.Authenticate("ben", "oldpass")
+	require.Equal(t, ErrUnauthenticated, err)
+
+	// Logging out all sessions, expiring the password, and removing the user invalidates the cache
+	require.Nil(t, a.RemoveOtherTokens(u.ID, ""))
+	require.Equal(t, 0, a.authCache.Size())
+	_, err = a.Authenticate("ben", "newpass")
+	require.Nil(t, err)
+	require.Nil(t, a.ExpirePassword("ben"))
+	require.Equal(t, 0, a.authCache.Size())
+	_, err = a.Authenticate("ben", "newpass")
+	require.Equal(t, ErrPasswordExpired, err)
+	require.Nil(t, a.ChangePassword("ben", "newpass2", false))
+	_, err = a.Authenticate("ben", "newpass2")
+	require.Nil(t, err)
+	require.Equal(t, 1, a.authCache.Size())
+	require.Nil(t, a.RemoveUser("ben"))
+	require.Equal(t, 0, a.authCache.Size())
+	_, err = a.Authenticate("ben", "newpass2")
+	require.Equal(t, ErrUnauthenticated, err)
+}
+
+func TestManager_Authenticate_AuthCacheExpired(t *testing.T) {
+	a, err := NewManager(&Config{
+		Filename:            filepath.Join(t.TempDir(), "user.db"),
+		DefaultAccess:       PermissionDenyAll,
+		BcryptCost:          bcrypt.MinCost,
+		QueueWriterInterval: DefaultUserStatsQueueWriterInterval,
+		AuthCacheTTL:        100 * time.Millisecond,
+	})
+	require.Nil(t, err)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	u, err := a.User("ben")
+	require.Nil(t, err)
+
+	_, err = a.Authenticate("ben", "ben")
+	require.Nil(t, err)
+	require.True(t, a.authCache.Verified("ben", "ben", u.Hash))
+	require.False(t, a.authCache.Verified("ben", "incorrect", u.Hash))
+	time.Sleep(150 * time.Millisecond)
+	require.False(t, a.authCache.Verified("ben", "ben", u.Hash))
+	require.Equal(t, 0, a.authCache.Size())
+}
+
+func TestManager_Authenticate_RehashWeakPassword(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "user.db")
+	a := newTestManagerFromFile(t, filename, "", PermissionDenyAll, bcrypt.MinCost, DefaultUserStatsQueueWriterInterval)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.Close())
+
+	// Raise the cost: both users have weak hashes now
+	a = newTestManagerFromFile(t, filename, "", PermissionDenyAll, bcrypt.MinCost+1, DefaultUserStatsQueueWriterInterval)
+	weak, err := a.UsersWithWeakPasswordHash()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(weak))
+
+	// Failed login does not re-hash
+	_, err = a.Authenticate("phil", "INCORRECT")
+	require.Equal(t, ErrUnauthenticated, err)
+	u, err := a.User("phil")
+	require.Nil(t, err)
+	cost, err := PasswordHashCost(u.Hash)
+	require.Nil(t, err)
+	require.Equal(t, bcrypt.MinCost, cost)
+
+	// Successful login re-hashes transparently
+	u, err = a.Authenticate("phil", "phil")
+	require.Nil(t, err)
+	cost, err = PasswordHashCost(u.Hash)
+	require.Nil(t, err)
+	require.Equal(t, bcrypt.MinCost+1, cost)
+	u, err = a.User("phil")
+	require.Nil(t, err)
+	cost, err = PasswordHashCost(u.Hash)
+	require.Nil(t, err)
+	require.Equal(t, bcrypt.MinCost+1, cost)
+	_, err = a.Authenticate("phil", "phil")
+	require.Nil(t, err)
+
+	weak, err = a.UsersWithWeakPasswordHash()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(weak))
+	require.Equal(t, "ben", weak[0].Name)
+}
+
+func TestManager_AllowAccessUntil(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AllowAccess("ben", "permanent", PermissionReadWrite))
+	expires := time.Now().Add(time.Hour)
+	require.Nil(t, a.AllowAccessUntil("ben", "incident*", PermissionRead, expires))
+	require.Equal(t, ErrInvalidArgument, a.AllowAccessUntil("ben", "incident*", PermissionRead, time.Now().Add(-time.Minute)))
+
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.Nil(t, a.Authorize(ben, "incident1", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "incident1", PermissionWrite))
+	grants, err := a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, []Grant{
+		{"permanent", PermissionReadWrite, false, time.Time{}},
+		{"incident*", PermissionRead, false, time.Unix(expires.Unix(), 0)},
+	}, grants)
+
+	// Nothing expired yet
+	removed, err := a.RemoveExpiredAccess()
+	require.Nil(t, err)
+	require.Empty(t, removed)
+
+	// Let the grant expire: it has no effect anymore, and is removed
+	_, err = a.db.Exec(`UPDATE user_access SET expires = ? WHERE topic = 'incident%'`, time.Now().Add(-time.Minute).Unix())
+	require.Nil(t, err)
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "incident1", PermissionRead))
+	grants, err = a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(grants))
+	allGrants, err := a.AllGrants()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(allGrants[ben.ID]))
+
+	removed, err = a.RemoveExpiredAccess()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(removed[ben.ID]))
+	require.Equal(t, "incident*", removed[ben.ID][0].TopicPattern)
+	require.Equal(t, PermissionRead, removed[ben.ID][0].Permission)
+	removed, err = a.RemoveExpiredAccess()
+	require.Nil(t, err)
+	require.Empty(t, removed)
+
+	// Granting permanent access removes the expiry
+	require.Nil(t, a.AllowAccessUntil("ben", "incident*", PermissionRead, time.Now().Add(time.Hour)))
+	require.Nil(t, a.AllowAccess("ben", "incident*", PermissionRead))
+	grants, err = a.Grants("ben")
+	require.Nil(t, err)
+	require.True(t, grants[1].Expires.IsZero())
+}
+
+func TestManager_ResetPassword(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.ChangeEmail("ben", "ben@example.com"))
+	require.Nil(t, a.ExpirePassword("ben"))
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.Equal(t, "ben@example.com", ben.Email)
+
+	token1, err := a.CreatePasswordResetToken(ben.ID, time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(token1, "pr_"))
+	token2, err := a.CreatePasswordResetToken(ben.ID, time.Now().Add(time.Hour))
+	require.Nil(t, err)
+
+	// Only the latest token is valid
+	_, err = a.ResetPassword(token1, "newpass")
+	require.Equal(t, ErrPasswordResetTokenNotFound, err)
+	u, err := a.ResetPassword(token2, "newpass")
+	require.Nil(t, err)
+	require.Equal(t, "ben", u.Name)
+	_, err = a.Authenticate("ben", "newpass")
+	require.Nil(t, err)
+
+	// Token can only be used once
+	_, err = a.ResetPassword(token2, "newpass2")
+	require.Equal(t, ErrPasswordResetTokenNotFound, err)
+
+	// Expired tokens are not valid, and are pruned
+	token3, err := a.CreatePasswordResetToken(ben.ID, time.Now().Add(-time.Minute))
+	require.Nil(t, err)
+	_, err = a.ResetPassword(token3, "newpass3")
+	require.Equal(t, ErrPasswordResetTokenNotFound, err)
+	require.Nil(t, a.RemoveExpiredPasswordResetTokens())
+	var count int
+	require.Nil(t, a.db.QueryRow(`SELECT COUNT(*) FROM user_password_reset`).Scan(&count))
+	require.Equal(t, 0, count)
+
+	// Remove email
+	require.Nil(t, a.ChangeEmail("ben", ""))
+	ben, err = a.User("ben")
+	require.Nil(t, err)
+	require.Equal(t, "", ben.Email)
+}
+
 func TestManager_ChangeRole(t *testing.T) {
 	a := newTestManager(t, PermissionDenyAll)
 	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
@@ -385,6 +634,559 @@ func TestManager_ChangeRole(t *testing.T) {
 	require.Equal(t, 0, len(benGrants))
 }
 
+func TestManager_Invites(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddUser("marian", "marian", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "alerts_x", PermissionDenyAll))
+
+	// Only topic owners can create invites
+	_, err := a.CreateInvite("ben", "alerts_x", PermissionRead, 1, time.Time{})
+	require.Equal(t, ErrUnauthorized, err)
+	_, err = a.CreateInvite("phil", "alerts_x", PermissionDenyAll, 1, time.Time{})
+	require.Equal(t, ErrInvalidArgument, err)
+	_, err = a.CreateInvite("phil", "alerts_x", PermissionRead, 0, time.Time{})
+	require.Equal(t, ErrInvalidArgument, err)
+
+	invite, err := a.CreateInvite("phil", "alerts_x", PermissionRead, 1, time.Time{})
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(invite.Token, "in_"))
+	require.Equal(t, 32, len(invite.Token))
+	invites, err := a.Invites("phil")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(invites))
+	require.Equal(t, invite, invites[0])
+
+	// Redeem invite: ben gets read-only access
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "alerts_x", PermissionRead))
+	_, err = a.RedeemInvite("phil", invite.Token) // Owner cannot redeem own invite
+	require.Equal(t, ErrInvalidArgument, err)
+	redeemed, err := a.RedeemInvite("ben", invite.Token)
+	require.Nil(t, err)
+	require.Equal(t, "alerts_x", redeemed.Topic)
+	require.Equal(t, PermissionRead, redeemed.Permission)
+	require.Equal(t, int64(1), redeemed.Uses)
+	require.Nil(t, a.Authorize(ben, "alerts_x", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "alerts_x", PermissionWrite))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "alertsXx", PermissionRead)) // _ is not a wildcard
+
+	// Invite is used up, and redeeming the invite does not count as a reservation
+	_, err = a.RedeemInvite("marian", invite.Token)
+	require.Equal(t, ErrInviteNotFound, err)
+	count, err := a.ReservationsCount("ben")
+	require.Nil(t, err)
+	require.Equal(t, int64(0), count)
+	require.Nil(t, a.RemoveExpiredInvites())
+	invites, err = a.Invites("phil")
+	require.Nil(t, err)
+	require.Empty(t, invites)
+
+	// Multi-use invite, deleted by owner
+	invite, err = a.CreateInvite("phil", "alerts_x", PermissionReadWrite, 5, time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	_, err = a.RedeemInvite("marian", invite.Token)
+	require.Nil(t, err)
+	require.Equal(t, ErrInviteNotFound, a.RemoveInvite("ben", invite.Token))
+	require.Nil(t, a.RemoveInvite("phil", invite.Token))
+	_, err = a.RedeemInvite("ben", invite.Token)
+	require.Equal(t, ErrInviteNotFound, err)
+
+	// Removing the reservation removes granted access and invites
+	_, err = a.CreateInvite("phil", "alerts_x", PermissionRead, 5, time.Time{})
+	require.Nil(t, err)
+	require.Nil(t, a.RemoveReservations("phil", "alerts_x"))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "alerts_x", PermissionRead))
+	invites, err = a.Invites("phil")
+	require.Nil(t, err)
+	require.Empty(t, invites)
+}
+
+func TestManager_Invites_ExistingGrant(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddUser("marian", "marian", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "mytopic", PermissionDenyAll))
+
+	// Ben has a stronger, time-limited grant, and marian has a provisioned grant
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.Nil(t, a.AllowAccessUntil("ben", "mytopic", PermissionReadWrite, expires))
+	require.Nil(t, a.AllowAccess("marian", "mytopic", PermissionReadWrite))
+	_, err := a.db.Exec(`UPDATE user_access SET provisioned = 1 WHERE user_id = (SELECT id FROM user WHERE user = 'marian')`)
+	require.Nil(t, err)
+
+	// Redeeming a read-only invite leaves the existing grants unchanged
+	invite, err := a.CreateInvite("phil", "mytopic", PermissionRead, 5, time.Time{})
+	require.Nil(t, err)
+	_, err = a.RedeemInvite("ben", invite.Token)
+	require.Nil(t, err)
+	_, err = a.RedeemInvite("marian", invite.Token)
+	require.Nil(t, err)
+	benGrants, err := a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, []Grant{{TopicPattern: "mytopic", Permission: PermissionReadWrite, Expires: expires}}, benGrants)
+	marianGrants, err := a.Grants("marian")
+	require.Nil(t, err)
+	require.Equal(t, []Grant{{TopicPattern: "mytopic", Permission: PermissionReadWrite, Provisioned: true}}, marianGrants)
+
+	// The existing grants are not owned by the reservation, so they are not removed with it
+	require.Nil(t, a.RemoveReservations("phil", "mytopic"))
+	benGrants, err = a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(benGrants))
+	marianGrants, err = a.Grants("marian")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(marianGrants))
+}
+
+func TestManager_Invites_Expired(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "mytopic", PermissionDenyAll))
+
+	_, err := a.CreateInvite("phil", "mytopic", PermissionRead, 1, time.Now().Add(-time.Minute))
+	require.Equal(t, ErrInvalidArgument, err)
+	invite, err := a.CreateInvite("phil", "mytopic", PermissionRead, 1, time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	_, err = a.db.Exec(`UPDATE user_invite SET expires = ?`, time.Now().Add(-time.Minute).Unix())
+	require.Nil(t, err)
+	_, err = a.RedeemInvite("ben", invite.Token)
+	require.Equal(t, ErrInviteNotFound, err)
+	require.Nil(t, a.RemoveExpiredInvites())
+	invites, err := a.Invites("phil")
+	require.Nil(t, err)
+	require.Empty(t, invites)
+}
+
+func TestManager_Invites_MaxCount(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "mytopic", PermissionDenyAll))
+	for i := 0; i < inviteMaxCount+5; i++ {
+		_, err := a.CreateInvite("phil", "mytopic", PermissionRead, 1, time.Time{})
+		require.Nil(t, err)
+	}
+	invites, err := a.Invites("phil")
+	require.Nil(t, err)
+	require.Equal(t, inviteMaxCount, len(invites))
+}
+
+func TestManager_GuestTokens(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "sensors", PermissionDenyAll))
+
+	// Only topic owners can create guest tokens
+	_, err := a.CreateGuestToken("ben", "sensors", PermissionWrite, "", 10, time.Time{})
+	require.Equal(t, ErrUnauthorized, err)
+	_, err = a.CreateGuestToken("phil", "sensors", PermissionDenyAll, "", 10, time.Time{})
+	require.Equal(t, ErrInvalidArgument, err)
+	_, err = a.CreateGuestToken("phil", "sensors", PermissionWrite, "", 0, time.Time{})
+	require.Equal(t, ErrInvalidArgument, err)
+	_, err = a.CreateGuestToken("phil", "sensors", PermissionWrite, "", 10, time.Now().Add(-time.Minute))
+	require.Equal(t, ErrInvalidArgument, err)
+
+	guest, err := a.CreateGuestToken("phil", "sensors", PermissionWrite, "thermometer", 10, time.Time{})
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(guest.Token, "gt_"))
+	require.Equal(t, 32, len(guest.Token))
+	require.True(t, ValidGuestToken(guest.Token))
+	require.False(t, ValidToken(guest.Token))
+	guests, err := a.GuestTokens("phil")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(guests))
+	require.Equal(t, guest, guests[0])
+
+	// Guest token only grants access to exactly one topic
+	authenticated, err := a.AuthenticateGuestToken(guest.Token)
+	require.Nil(t, err)
+	require.Equal(t, "phil", authenticated.Owner)
+	require.Nil(t, authenticated.Authorize("sensors", PermissionWrite))
+	require.Equal(t, ErrUnauthorized, authenticated.Authorize("sensors", PermissionRead))
+	require.Equal(t, ErrUnauthorized, authenticated.Authorize("sensors2", PermissionWrite))
+	_, err = a.AuthenticateGuestToken("gt_doesnotexist")
+	require.Equal(t, ErrUnauthenticated, err)
+
+	// Guest token can only be removed by owner (or without owner, by an admin)
+	require.Equal(t, ErrGuestTokenNotFound, a.RemoveGuestToken("ben", guest.Token))
+	require.Nil(t, a.RemoveGuestToken("phil", guest.Token))
+	_, err = a.AuthenticateGuestToken(guest.Token)
+	require.Equal(t, ErrUnauthenticated, err)
+
+	// Guest tokens without owner are not tied to a reservation
+	guest, err = a.CreateGuestToken("", "anytopic", PermissionReadWrite, "", 10, time.Time{})
+	require.Nil(t, err)
+	guests, err = a.AllGuestTokens()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(guests))
+	require.Equal(t, "", guests[0].Owner)
+	require.Nil(t, a.RemoveGuestToken("", guest.Token))
+
+	// Removing the reservation removes the guest tokens
+	_, err = a.CreateGuestToken("phil", "sensors", PermissionWrite, "", 10, time.Time{})
+	require.Nil(t, err)
+	require.Nil(t, a.RemoveReservations("phil", "sensors"))
+	guests, err = a.GuestTokens("phil")
+	require.Nil(t, err)
+	require.Empty(t, guests)
+}
+
+func TestManager_TopicSchema(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "sensors", PermissionDenyAll))
+
+	// Only topic owners can attach a schema
+	require.Equal(t, ErrUnauthorized, a.SetTopicSchema("ben", "sensors", `{"type":"object"}`, SchemaModeReject))
+	require.Equal(t, ErrInvalidArgument, a.SetTopicSchema("phil", "sensors", `{"type":"object"}`, SchemaMode("drop")))
+	_, err := a.TopicSchema("sensors")
+	require.Equal(t, ErrTopicSchemaNotFound, err)
+
+	require.Nil(t, a.SetTopicSchema("phil", "sensors", `{"type":"object"}`, SchemaModeReject))
+	require.Nil(t, a.SetTopicSchema("phil", "sensors", `{"type":"array"}`, SchemaModeTag))
+	schema, err := a.TopicSchema("sensors")
+	require.Nil(t, err)
+	require.Equal(t, &TopicSchema{Topic: "sensors", Schema: `{"type":"array"}`, Mode: SchemaModeTag}, schema)
+
+	// Schema can only be removed by owner
+	require.Equal(t, ErrTopicSchemaNotFound, a.RemoveTopicSchema("ben", "sensors"))
+	require.Nil(t, a.RemoveTopicSchema("phil", "sensors"))
+	require.Equal(t, ErrTopicSchemaNotFound, a.RemoveTopicSchema("phil", "sensors"))
+
+	// Removing the reservation removes the schema
+	require.Nil(t, a.SetTopicSchema("phil", "sensors", `{"type":"object"}`, SchemaModeReject))
+	require.Nil(t, a.RemoveReservations("phil", "sensors"))
+	_, err = a.TopicSchema("sensors")
+	require.Equal(t, ErrTopicSchemaNotFound, err)
+}
+
+func TestManager_RenameReservation(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "alerts", PermissionRead))
+	require.Nil(t, a.AddReservation("ben", "bens_topic", PermissionDenyAll))
+	require.Nil(t, a.SetTopicSchema("phil", "alerts", `{"type":"object"}`, SchemaModeReject))
+	invite, err := a.CreateInvite("phil", "alerts", PermissionRead, 1, time.Time{})
+	require.Nil(t, err)
+
+	// Only the owner can rename, and only to a free topic
+	require.Equal(t, ErrUnauthorized, a.RenameReservation("ben", "alerts", "alerts2", false))
+	require.Equal(t, errTopicOwnedByOthers, a.RenameReservation("phil", "alerts", "bens_topic", false))
+	require.Equal(t, ErrInvalidArgument, a.RenameReservation("phil", "alerts", "alerts", false))
+	require.Nil(t, a.RenameReservation("phil", "alerts", "alerts2", true))
+
+	// Reservation, permissions, schema and invites moved to new topic
+	reservations, err := a.Reservations("phil")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(reservations))
+	require.Equal(t, "alerts2", reservations[0].Topic)
+	require.Equal(t, PermissionRead, reservations[0].Everyone)
+	schema, err := a.TopicSchema("alerts2")
+	require.Nil(t, err)
+	require.Equal(t, `{"type":"object"}`, schema.Schema)
+	redeemed, err := a.RedeemInvite("ben", invite.Token)
+	require.Nil(t, err)
+	require.Equal(t, "alerts2", redeemed.Topic)
+
+	// Old name is an alias, and cannot be reserved by others
+	alias, err := a.TopicAlias("alerts")
+	require.Nil(t, err)
+	require.Equal(t, "alerts2", alias.Topic)
+	require.True(t, alias.Deprecated)
+	require.Equal(t, errTopicOwnedByOthers, a.AllowReservation("ben", "alerts"))
+	require.Nil(t, a.AllowReservation("phil", "alerts"))
+
+	// Renaming again updates existing aliases
+	require.Nil(t, a.RenameReservation("phil", "alerts2", "alerts3", false))
+	aliases, err := a.TopicAliases("phil")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(aliases))
+	require.Equal(t, "alerts", aliases[0].Alias)
+	require.Equal(t, "alerts3", aliases[0].Topic)
+	require.Equal(t, "alerts2", aliases[1].Alias)
+	require.Equal(t, "alerts3", aliases[1].Topic)
+	require.False(t, aliases[1].Deprecated)
+
+	// Aliases can only be removed by the owner
+	require.Equal(t, ErrTopicAliasNotFound, a.RemoveTopicAlias("ben", "alerts2"))
+	require.Nil(t, a.RemoveTopicAlias("phil", "alerts2"))
+	_, err = a.TopicAlias("alerts2")
+	require.Equal(t, ErrTopicAliasNotFound, err)
+
+	// Removing the reservation removes the aliases
+	require.Nil(t, a.RemoveReservations("phil", "alerts3"))
+	aliases, err = a.TopicAliases("phil")
+	require.Nil(t, err)
+	require.Empty(t, aliases)
+	require.Nil(t, a.AllowReservation("ben", "alerts"))
+}
+
+func TestManager_TopicSilences(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "alerts", PermissionRead))
+
+	// Only the owner can add silence windows, and repeating windows must be shorter than the interval
+	start := time.Now().Add(-time.Hour)
+	_, err := a.AddTopicSilence("ben", "alerts", start, start.Add(2*time.Hour), SilenceRepeatNone, false)
+	require.Equal(t, ErrUnauthorized, err)
+	_, err = a.AddTopicSilence("phil", "alerts", start, start, SilenceRepeatNone, false)
+	require.Equal(t, ErrInvalidArgument, err)
+	_, err = a.AddTopicSilence("phil", "alerts", start, start.Add(25*time.Hour), SilenceRepeatDaily, false)
+	require.Equal(t, ErrInvalidArgument, err)
+	silence, err := a.AddTopicSilence("phil", "alerts", start, start.Add(2*time.Hour), SilenceRepeatNone, true)
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(silence.ID, "si_"))
+	require.True(t, silence.Active(time.Now()))
+
+	silences, err := a.TopicSilences("alerts")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(silences))
+	require.Equal(t, silence.ID, silences[0].ID)
+	require.Equal(t, "phil", silences[0].Owner)
+	require.Equal(t, start.Unix(), silences[0].Start.Unix())
+	require.True(t, silences[0].Summary)
+	require.True(t, silences[0].Summarized.IsZero())
+
+	// Ended windows are only removed once summarized
+	_, err = a.db.Exec(`UPDATE user_topic_silence SET ends = ?`, time.Now().Add(-time.Minute).Unix())
+	require.Nil(t, err)
+	require.Nil(t, a.RemoveExpiredTopicSilences())
+	silences, err = a.TopicSilencesWithSummary(time.Now())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(silences))
+	require.Nil(t, a.MarkTopicSilenceSummarized(silence.ID, silences[0].End))
+	require.Nil(t, a.RemoveExpiredTopicSilences())
+	silences, err = a.TopicSilences("alerts")
+	require.Nil(t, err)
+	require.Empty(t, silences)
+
+	// Silence windows are moved on rename, and removed along with the reservation
+	silence, err = a.AddTopicSilence("phil", "alerts", start, start.Add(time.Hour), SilenceRepeatWeekly, false)
+	require.Nil(t, err)
+	require.Nil(t, a.RenameReservation("phil", "alerts", "alerts2", false))
+	silences, err = a.TopicSilences("alerts2")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(silences))
+	require.Equal(t, ErrTopicSilenceNotFound, a.RemoveTopicSilence("ben", "alerts2", silence.ID))
+	require.Nil(t, a.RemoveReservations("phil", "alerts2"))
+	silences, err = a.TopicSilences("alerts2")
+	require.Nil(t, err)
+	require.Empty(t, silences)
+}
+
+func TestTopicSilence_Active_LastEnd(t *testing.T) {
+	start := time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)
+	silence := &TopicSilence{
+		Start:  start,
+		End:    start.Add(2 * time.Hour),
+		Repeat: SilenceRepeatDaily,
+	}
+	require.False(t, silence.Active(start.Add(-time.Minute)))
+	require.True(t, silence.Active(start))
+	require.True(t, silence.Active(start.Add(72*time.Hour+time.Hour)))
+	require.False(t, silence.Active(start.Add(72*time.Hour+2*time.Hour)))
+	require.True(t, silence.LastEnd(start.Add(time.Hour)).IsZero())
+	require.Equal(t, start.Add(2*time.Hour), silence.LastEnd(start.Add(3*time.Hour)))
+	require.Equal(t, start.Add(50*time.Hour), silence.LastEnd(start.Add(72*time.Hour+time.Hour)))
+
+	silence.Repeat = SilenceRepeatNone
+	require.False(t, silence.Active(start.Add(24*time.Hour)))
+	require.Equal(t, start.Add(2*time.Hour), silence.LastEnd(start.Add(72*time.Hour)))
+}
+
+func TestManager_TopicEscalation(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "alerts", PermissionRead))
+
+	steps := []*EscalationStep{
+		{After: 5 * time.Minute, Priority: 5},
+		{After: 15 * time.Minute, Topic: "oncall", Email: "phil@example.com", Call: "+12223334444"},
+	}
+	require.Equal(t, ErrUnauthorized, a.SetTopicEscalation("ben", "alerts", 4, steps))
+	require.Equal(t, ErrInvalidArgument, a.SetTopicEscalation("phil", "alerts", 6, steps))
+	require.Equal(t, ErrInvalidArgument, a.SetTopicEscalation("phil", "alerts", 4, nil))
+	require.Nil(t, a.SetTopicEscalation("phil", "alerts", 4, steps))
+
+	escalation, err := a.TopicEscalation("alerts")
+	require.Nil(t, err)
+	require.Equal(t, "phil", escalation.Owner)
+	require.Equal(t, 4, escalation.MinPriority)
+	require.Equal(t, steps, escalation.Steps)
+
+	// Moved on rename, removed along with the reservation
+	require.Nil(t, a.RenameReservation("phil", "alerts", "alerts2", false))
+	_, err = a.TopicEscalation("alerts")
+	require.Equal(t, ErrTopicEscalationNotFound, err)
+	require.Equal(t, ErrTopicEscalationNotFound, a.RemoveTopicEscalation("ben", "alerts2"))
+	require.Nil(t, a.RemoveReservations("phil", "alerts2"))
+	_, err = a.TopicEscalation("alerts2")
+	require.Equal(t, ErrTopicEscalationNotFound, err)
+}
+
+func TestManager_TopicMutes(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.ChangeEmail("phil", "Phil@example.com"))
+	phil, err := a.User("phil")
+	require.Nil(t, err)
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.Equal(t, ErrInvalidArgument, a.MuteTopic(phil.ID, "alerts", time.Now().Add(-time.Minute)))
+	require.Equal(t, ErrInvalidArgument, a.MuteTopic(phil.ID, "invalid topic", until))
+	require.Nil(t, a.MuteTopic(phil.ID, "alerts", time.Now().Add(time.Minute)))
+	require.Nil(t, a.MuteTopic(phil.ID, "alerts", until)) // Replaces the existing mute
+	require.Nil(t, a.MuteTopic(phil.ID, "backups", until))
+	require.Nil(t, a.MuteTopic(ben.ID, "alerts", until))
+
+	mutes, err := a.TopicMutes(phil.ID)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(mutes))
+	require.Equal(t, "alerts", mutes[0].Topic)
+	require.Equal(t, until, mutes[0].Until)
+	require.Equal(t, "backups", mutes[1].Topic)
+
+	userIDs, err := a.TopicMutedUserIDs("alerts")
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{phil.ID, ben.ID}, userIDs)
+	muted, err := a.TopicMutedByEmail("backups", "phil@EXAMPLE.com")
+	require.Nil(t, err)
+	require.True(t, muted)
+	muted, err = a.TopicMutedByEmail("mytopic", "phil@example.com")
+	require.Nil(t, err)
+	require.False(t, muted)
+
+	// Unmute, and expired mutes are ignored and removed
+	require.Nil(t, a.UnmuteTopic(phil.ID, "backups"))
+	require.Equal(t, ErrTopicMuteNotFound, a.UnmuteTopic(phil.ID, "backups"))
+	_, err = a.db.Exec(`UPDATE user_topic_mute SET until = ? WHERE user_id = ?`, time.Now().Add(-time.Minute).Unix(), ben.ID)
+	require.Nil(t, err)
+	userIDs, err = a.TopicMutedUserIDs("alerts")
+	require.Nil(t, err)
+	require.Equal(t, []string{phil.ID}, userIDs)
+	require.Nil(t, a.RemoveExpiredTopicMutes())
+	mutes, err = a.TopicMutes(ben.ID)
+	require.Nil(t, err)
+	require.Empty(t, mutes)
+
+	// Limit
+	for i := 0; i < topicMuteMaxCount-1; i++ {
+		require.Nil(t, a.MuteTopic(phil.ID, fmt.Sprintf("topic%d", i), until))
+	}
+	require.Equal(t, ErrTooManyTopicMutes, a.MuteTopic(phil.ID, "onetoomany", until))
+	require.Nil(t, a.MuteTopic(phil.ID, "alerts", until.Add(time.Hour))) // Existing mutes can be changed
+}
+
+func TestManager_GuestTokens_Expired(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	guest, err := a.CreateGuestToken("", "mytopic", PermissionWrite, "", 10, time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	_, err = a.AuthenticateGuestToken(guest.Token)
+	require.Nil(t, err)
+	_, err = a.db.Exec(`UPDATE user_guest_token SET expires = ?`, time.Now().Add(-time.Minute).Unix())
+	require.Nil(t, err)
+	_, err = a.AuthenticateGuestToken(guest.Token)
+	require.Equal(t, ErrUnauthenticated, err)
+	require.Nil(t, a.RemoveExpiredGuestTokens())
+	guests, err := a.AllGuestTokens()
+	require.Nil(t, err)
+	require.Empty(t, guests)
+}
+
+func TestManager_GuestTokens_MaxCount(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "mytopic", PermissionDenyAll))
+	for i := 0; i < guestTokenMaxCount+5; i++ {
+		_, err := a.CreateGuestToken("phil", "mytopic", PermissionWrite, "", 10, time.Time{})
+		require.Nil(t, err)
+	}
+	guests, err := a.GuestTokens("phil")
+	require.Nil(t, err)
+	require.Equal(t, guestTokenMaxCount, len(guests))
+}
+
+func TestManager_Export(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddTier(&Tier{Code: "pro", Name: "Pro"}))
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.ChangeTier("phil", "pro"))
+	require.Nil(t, a.ChangeEmail("phil", "phil@example.com"))
+	require.Nil(t, a.AllowAccess("phil", "announcements", PermissionRead))
+	require.Nil(t, a.AddReservation("phil", "mytopic", PermissionRead))
+	_, err := a.CreateInvite("phil", "mytopic", PermissionReadWrite, 3, time.Time{})
+	require.Nil(t, err)
+	u, err := a.User("phil")
+	require.Nil(t, err)
+	token, err := a.CreateToken(u.ID, "laptop", time.Time{}, netip.MustParseAddr("1.2.3.4"), false)
+	require.Nil(t, err)
+	require.Nil(t, a.AddPhoneNumber(u.ID, "+1234567890"))
+
+	export, err := a.Export("phil")
+	require.Nil(t, err)
+	require.Equal(t, "phil", export.Username)
+	require.Equal(t, "user", export.Role)
+	require.Equal(t, "phil@example.com", export.Email)
+	require.Equal(t, "pro", export.Tier)
+	require.Nil(t, export.Billing)
+	require.Equal(t, 2, len(export.Access))
+	require.Equal(t, 1, len(export.Reservations))
+	require.Equal(t, "mytopic", export.Reservations[0].Topic)
+	require.Equal(t, "read-only", export.Reservations[0].Everyone)
+	require.Equal(t, 1, len(export.Invites))
+	require.Equal(t, int64(3), export.Invites[0].UsesLimit)
+	require.Equal(t, 1, len(export.Tokens))
+	require.Equal(t, "laptop", export.Tokens[0].Label)
+	require.Equal(t, []string{"+1234567890"}, export.PhoneNumbers)
+
+	// Secrets are never exported
+	b, err := json.Marshal(export)
+	require.Nil(t, err)
+	require.NotContains(t, string(b), token.Value)
+	require.NotContains(t, string(b), u.Hash)
+	require.NotContains(t, string(b), "in_")
+
+	_, err = a.Export("doesnotexist")
+	require.Equal(t, ErrUserNotFound, err)
+}
+
+func TestManager_MarkUserRemoved_RemovesInvitesAndPhoneNumbers(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddReservation("phil", "mytopic", PermissionDenyAll))
+	_, err := a.CreateInvite("phil", "mytopic", PermissionRead, 1, time.Time{})
+	require.Nil(t, err)
+	guest, err := a.CreateGuestToken("phil", "mytopic", PermissionWrite, "", 10, time.Time{})
+	require.Nil(t, err)
+	u, err := a.User("phil")
+	require.Nil(t, err)
+	require.Nil(t, a.AddPhoneNumber(u.ID, "+1234567890"))
+
+	require.Nil(t, a.MarkUserRemoved(u))
+	invites, err := a.Invites("phil")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(invites))
+	_, err = a.AuthenticateGuestToken(guest.Token)
+	require.Equal(t, ErrUnauthenticated, err)
+	phoneNumbers, err := a.PhoneNumbers(u.ID)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(phoneNumbers))
+}
+
 func TestManager_Reservations(t *testing.T) {
 	a := newTestManager(t, PermissionDenyAll)
 	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
@@ -435,6 +1237,13 @@ func TestManager_Reservations(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, int64(0), count)
 
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	all, err := a.AllReservations()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(all))
+	require.Equal(t, reservations, all[ben.ID])
+
 	err = a.AllowReservation("phil", "readme")
 	require.Equal(t, errTopicOwnedByOthers, err)
 
@@ -652,6 +1461,63 @@ func TestManager_Token_Extend(t *testing.T) {
 	require.True(t, time.Now().Add(99*time.Hour).Unix() < extendedToken.Expires.Unix())
 }
 
+func TestManager_Token_RemoveOthers(t *testing.T) {
+	conf := &Config{
+		Filename:            filepath.Join(t.TempDir(), "user.db"),
+		DefaultAccess:       PermissionDenyAll,
+		ProvisionEnabled:    true,
+		BcryptCost:          bcrypt.MinCost,
+		QueueWriterInterval: DefaultUserStatsQueueWriterInterval,
+		Users: []*User{
+			{Name: "phil", Hash: "$2a$10$YLiO8U21sX1uhZamTLJXHuxgVC0Z/GKISibrKCLohPgtG7yIxSk4C", Role: RoleUser},
+		},
+		Tokens: map[string][]*Token{
+			"phil": {
+				{Value: "tk_op56p8lz5bf3cxkz9je99v9oc37lo", Label: "Provisioned token"},
+			},
+		},
+	}
+	a, err := NewManager(conf)
+	require.Nil(t, err)
+	u, err := a.User("phil")
+	require.Nil(t, err)
+
+	token1, err := a.CreateToken(u.ID, "", time.Now().Add(72*time.Hour), netip.IPv4Unspecified(), false)
+	require.Nil(t, err)
+	_, err = a.CreateToken(u.ID, "", time.Now().Add(72*time.Hour), netip.IPv4Unspecified(), false)
+	require.Nil(t, err)
+	_, err = a.CreateToken(u.ID, "backups", time.Unix(0, 0), netip.IPv4Unspecified(), false)
+	require.Nil(t, err)
+
+	// Update user agent
+	a.EnqueueTokenUpdate(token1.Value, &TokenUpdate{
+		LastAccess:    time.Now(),
+		LastOrigin:    netip.MustParseAddr("1.2.3.4"),
+		LastUserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0",
+	})
+	require.Nil(t, a.writeTokenUpdateQueue())
+	token, err := a.Token(u.ID, token1.Value)
+	require.Nil(t, err)
+	require.Equal(t, "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0", token.LastUserAgent)
+	require.Equal(t, netip.MustParseAddr("1.2.3.4"), token.LastOrigin)
+
+	// Remove all tokens except token1, provisioned tokens are kept
+	require.Nil(t, a.RemoveOtherTokens(u.ID, token1.Value))
+	tokens, err := a.Tokens(u.ID)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(tokens))
+	values := []string{tokens[0].Value, tokens[1].Value}
+	require.Contains(t, values, token1.Value)
+	require.Contains(t, values, "tk_op56p8lz5bf3cxkz9je99v9oc37lo")
+
+	// Remove all tokens
+	require.Nil(t, a.RemoveOtherTokens(u.ID, ""))
+	tokens, err = a.Tokens(u.ID)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(tokens))
+	require.True(t, tokens[0].Provisioned)
+}
+
 func TestManager_Token_MaxCount_AutoDelete(t *testing.T) {
 	// Tests that tokens are automatically deleted when the maximum number of tokens is reached
 
@@ -984,6 +1850,34 @@ func TestManager_Tier_Create_Update_List_Delete(t *testing.T) {
 	require.Equal(t, "pro", tiers[0].Code)
 }
 
+func TestManager_Tier_AttachmentTypes(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddTier(&Tier{
+		Code:                  "free",
+		Name:                  "Free",
+		AttachmentDeniedTypes: []string{"video/*", "application/vnd.microsoft.portable-executable"},
+	}))
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.ChangeTier("phil", "free"))
+
+	ti, err := a.Tier("free")
+	require.Nil(t, err)
+	require.Equal(t, []string{}, ti.AttachmentAllowedTypes)
+	require.Equal(t, []string{"video/*", "application/vnd.microsoft.portable-executable"}, ti.AttachmentDeniedTypes)
+
+	u, err := a.User("phil")
+	require.Nil(t, err)
+	require.Equal(t, ti, u.Tier)
+
+	ti.AttachmentAllowedTypes = []string{"image/*"}
+	ti.AttachmentDeniedTypes = nil
+	require.Nil(t, a.UpdateTier(ti))
+	ti, err = a.Tier("free")
+	require.Nil(t, err)
+	require.Equal(t, []string{"image/*"}, ti.AttachmentAllowedTypes)
+	require.Equal(t, []string{}, ti.AttachmentDeniedTypes)
+}
+
 func TestAccount_Tier_Create_With_ID(t *testing.T) {
 	a := newTestManager(t, PermissionDenyAll)
 
@@ -1034,6 +1928,141 @@ func TestManager_Tier_Change_And_Reset(t *testing.T) {
 	require.Nil(t, a.ResetTier("phil"))
 }
 
+func TestManager_Role_Create_Update_List_Delete(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+
+	// Built-in roles and invalid capabilities are rejected
+	require.Equal(t, ErrInvalidArgument, a.AddRole(&CustomRole{Name: RoleAdmin}))
+	require.Equal(t, ErrInvalidArgument, a.AddRole(&CustomRole{Name: RoleAnonymous}))
+	require.Equal(t, ErrInvalidArgument, a.AddRole(&CustomRole{Name: "operator", Capabilities: []Capability{"launch-rockets"}}))
+
+	// Add roles
+	require.Nil(t, a.AddRole(&CustomRole{Name: "operator", Capabilities: []Capability{CapabilityUsersRead, CapabilityAccessWrite}}))
+	require.Nil(t, a.AddRole(&CustomRole{Name: "auditor", Capabilities: []Capability{CapabilityUsersRead}}))
+	require.Equal(t, ErrRoleExists, a.AddRole(&CustomRole{Name: "auditor"}))
+
+	roles, err := a.Roles()
+	require.Nil(t, err)
+	require.Len(t, roles, 2)
+	require.Equal(t, Role("auditor"), roles[0].Name)
+	require.Equal(t, []Capability{CapabilityUsersRead}, roles[0].Capabilities)
+	require.Equal(t, Role("operator"), roles[1].Name)
+	require.Equal(t, []Capability{CapabilityUsersRead, CapabilityAccessWrite}, roles[1].Capabilities)
+
+	// Assign role to user, and check capabilities
+	require.Nil(t, a.AddUser("ben", "ben", "operator", false))
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.Equal(t, Role("operator"), ben.Role)
+	require.True(t, ben.IsUser())
+	require.False(t, ben.IsAdmin())
+	require.True(t, ben.HasCapability(CapabilityUsersRead))
+	require.True(t, ben.HasCapability(CapabilityAccessWrite))
+	require.False(t, ben.HasCapability(CapabilityUsersWrite))
+
+	// Users with custom roles are subject to ACLs like regular users
+	require.Nil(t, a.AllowAccess("ben", "mytopic", PermissionRead))
+	require.Nil(t, a.Authorize(ben, "mytopic", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "mytopic", PermissionWrite))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "othertopic", PermissionRead))
+
+	// Update role, changes are reflected in the user
+	require.Nil(t, a.UpdateRole(&CustomRole{Name: "operator", Capabilities: []Capability{CapabilityUsersWrite}}))
+	require.Equal(t, ErrRoleNotFound, a.UpdateRole(&CustomRole{Name: "doesnotexist"}))
+	ben, err = a.User("ben")
+	require.Nil(t, err)
+	require.False(t, ben.HasCapability(CapabilityUsersRead))
+	require.True(t, ben.HasCapability(CapabilityUsersWrite))
+
+	// Admins have all capabilities, regular users have none
+	require.Nil(t, a.AddUser("phil", "phil", RoleAdmin, false))
+	require.Nil(t, a.AddUser("john", "john", RoleUser, false))
+	phil, err := a.User("phil")
+	require.Nil(t, err)
+	require.True(t, phil.HasCapability(CapabilityUsersWrite))
+	john, err := a.User("john")
+	require.Nil(t, err)
+	require.False(t, john.HasCapability(CapabilityUsersRead))
+	require.Equal(t, ErrRoleNotFound, a.ChangeRole("john", "doesnotexist"))
+	require.Nil(t, a.ChangeRole("john", "auditor"))
+	john, err = a.User("john")
+	require.Nil(t, err)
+	require.True(t, john.HasCapability(CapabilityUsersRead))
+
+	// Roles cannot be removed while they are in use
+	require.Equal(t, ErrRoleInUse, a.RemoveRole("operator"))
+	require.Nil(t, a.ChangeRole("ben", RoleUser))
+	require.Nil(t, a.RemoveRole("operator"))
+	_, err = a.Role("operator")
+	require.Equal(t, ErrRoleNotFound, err)
+	role, err := a.Role("auditor")
+	require.Nil(t, err)
+	require.Equal(t, []Capability{CapabilityUsersRead}, role.Capabilities)
+}
+
+func TestManager_Role_AccessTemplates(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	a.config.AccessTemplates = []*Grant{{TopicPattern: "user-<username>-*", Permission: PermissionReadWrite}}
+	require.Nil(t, a.AddRole(&CustomRole{Name: "operator", Capabilities: []Capability{CapabilityAccessWrite}}))
+	require.Nil(t, a.AddUser("ben", "ben", "operator", false))
+	grants, err := a.Grants("ben")
+	require.Nil(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, "user-ben-*", grants[0].TopicPattern)
+}
+
+func TestManager_Tier_Expiry(t *testing.T) {
+	a := newTestManager(t, PermissionDenyAll)
+	require.Nil(t, a.AddTier(&Tier{Code: "pro", Name: "Pro"}))
+	require.Nil(t, a.AddUser("phil", "phil", RoleUser, false))
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddUser("john", "john", RoleUser, false))
+	require.Nil(t, a.ChangeTier("phil", "pro"))
+	require.Nil(t, a.ChangeTier("ben", "pro"))
+
+	// Set expiry; john has no tier, so his expiry is ignored
+	now := time.Now()
+	require.Nil(t, a.ChangeTierExpiry("phil", now.Add(time.Hour)))
+	require.Nil(t, a.ChangeTierExpiry("ben", now.Add(48*time.Hour)))
+	require.Nil(t, a.ChangeTierExpiry("john", now.Add(time.Hour)))
+
+	phil, err := a.User("phil")
+	require.Nil(t, err)
+	require.Equal(t, now.Add(time.Hour).Unix(), phil.TierExpires.Unix())
+	require.False(t, phil.TierExpiryWarned)
+
+	users, err := a.UsersWithTierExpiringBefore(now.Add(24 * time.Hour))
+	require.Nil(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "phil", users[0].Name)
+
+	users, err = a.UsersWithTierExpiringBefore(now.Add(72 * time.Hour))
+	require.Nil(t, err)
+	require.Len(t, users, 2)
+	require.Equal(t, "phil", users[0].Name)
+	require.Equal(t, "ben", users[1].Name)
+
+	// Mark warned, changing the expiry resets the flag
+	require.Nil(t, a.MarkTierExpiryWarned("phil"))
+	phil, err = a.User("phil")
+	require.Nil(t, err)
+	require.True(t, phil.TierExpiryWarned)
+	require.Nil(t, a.ChangeTierExpiry("phil", now.Add(2*time.Hour)))
+	phil, err = a.User("phil")
+	require.Nil(t, err)
+	require.False(t, phil.TierExpiryWarned)
+
+	// Removing the expiry or the tier clears it
+	require.Nil(t, a.ChangeTierExpiry("phil", time.Time{}))
+	require.Nil(t, a.ResetTier("ben"))
+	users, err = a.UsersWithTierExpiringBefore(now.Add(72 * time.Hour))
+	require.Nil(t, err)
+	require.Len(t, users, 0)
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.True(t, ben.TierExpires.IsZero())
+}
+
 func TestUser_PhoneNumberAddListRemove(t *testing.T) {
 	a := newTestManager(t, PermissionDenyAll)
 
@@ -1095,6 +2124,47 @@ func TestManager_Topic_Wildcard_With_Underscore(t *testing.T) {
 	require.Equal(t, ErrUnauthorized, a.Authorize(nil, "mytopicX", PermissionWrite))
 }
 
+func TestManager_AddUser_WithAccessTemplates(t *testing.T) {
+	conf := &Config{
+		Filename:      filepath.Join(t.TempDir(), "user.db"),
+		DefaultAccess: PermissionDenyAll,
+		BcryptCost:    bcrypt.MinCost,
+		AccessTemplates: []*Grant{
+			{TopicPattern: "user-<username>-*", Permission: PermissionReadWrite},
+			{TopicPattern: "alerts-<username>", Permission: PermissionRead},
+		},
+	}
+	a, err := NewManager(conf)
+	require.Nil(t, err)
+	require.Nil(t, a.AddUser("ben", "ben", RoleUser, false))
+	require.Nil(t, a.AddUser("phil", "phil", RoleAdmin, false))
+	require.Nil(t, a.AddUser("phil@example.com", "phil", RoleUser, false)) // Username not valid in topic
+
+	grants, err := a.Grants("ben")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(grants))
+	require.Equal(t, "user-ben-*", grants[0].TopicPattern)
+	require.Equal(t, PermissionReadWrite, grants[0].Permission)
+	require.False(t, grants[0].Provisioned)
+	require.Equal(t, "alerts-ben", grants[1].TopicPattern)
+	require.Equal(t, PermissionRead, grants[1].Permission)
+
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.Nil(t, a.Authorize(ben, "user-ben-stuff", PermissionWrite))
+	require.Nil(t, a.Authorize(ben, "alerts-ben", PermissionRead))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "alerts-ben", PermissionWrite))
+	require.Equal(t, ErrUnauthorized, a.Authorize(ben, "user-phil-stuff", PermissionRead))
+
+	grants, err = a.Grants("phil")
+	require.Nil(t, err)
+	require.Empty(t, grants)
+
+	grants, err = a.Grants("phil@example.com")
+	require.Nil(t, err)
+	require.Empty(t, grants)
+}
+
 func TestManager_WithProvisionedUsers(t *testing.T) {
 	f := filepath.Join(t.TempDir(), "user.db")
 	conf := &Config{
@@ -1155,7 +2225,7 @@ func TestManager_WithProvisionedUsers(t *testing.T) {
 	lastAccessTime := time.Now().Add(time.Hour)
 	lastOrigin := netip.MustParseAddr("1.1.9.9")
 	err = execTx(a.db, func(tx *sql.Tx) error {
-		return a.updateTokenLastAccessTx(tx, tokens[0].Value, lastAccessTime.Unix(), lastOrigin.String())
+		return a.updateTokenLastAccessTx(tx, tokens[0].Value, lastAccessTime.Unix(), lastOrigin.String(), "ntfy/1.0")
 	})
 	require.Nil(t, err)
 
@@ -1204,6 +2274,7 @@ func TestManager_WithProvisionedUsers(t *testing.T) {
 	require.Equal(t, "Alerts token updated", tokens[0].Label)
 	require.Equal(t, lastAccessTime.Unix(), tokens[0].LastAccess.Unix())
 	require.Equal(t, lastOrigin, tokens[0].LastOrigin)
+	require.Equal(t, "ntfy/1.0", tokens[0].LastUserAgent)
 	require.True(t, tokens[0].Provisioned)
 	require.Equal(t, "tk_u48wqendnkx9er21pqqcadlytbutx", tokens[1].Value)
 	require.Equal(t, "Another token", tokens[1].Label)
@@ -1571,6 +2642,105 @@ func TestMigrationFrom4(t *testing.T) {
 	require.Nil(t, a.Authorize(nil, "up", PermissionRead)) // % matches 0 or more characters
 }
 
+func TestMigrationFrom8(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "user.db")
+	db, err := sql.Open("sqlite3", filename)
+	require.Nil(t, err)
+
+	// Create "version 8" schema (only tables relevant to this migration)
+	_, err = db.Exec(`
+		BEGIN;
+		CREATE TABLE IF NOT EXISTS tier (
+			id TEXT PRIMARY KEY,
+			code TEXT NOT NULL,
+			name TEXT NOT NULL,
+			messages_limit INT NOT NULL,
+			messages_expiry_duration INT NOT NULL,
+			emails_limit INT NOT NULL,
+			calls_limit INT NOT NULL,
+			reservations_limit INT NOT NULL,
+			attachment_file_size_limit INT NOT NULL,
+			attachment_total_size_limit INT NOT NULL,
+			attachment_expiry_duration INT NOT NULL,
+			attachment_bandwidth_limit INT NOT NULL,
+			stripe_monthly_price_id TEXT,
+			stripe_yearly_price_id TEXT
+		);
+		CREATE TABLE IF NOT EXISTS user (
+		    id TEXT PRIMARY KEY,
+			tier_id TEXT,
+			user TEXT NOT NULL,
+			pass TEXT NOT NULL,
+			role TEXT CHECK (role IN ('anonymous', 'admin', 'user')) NOT NULL,
+			prefs JSON NOT NULL DEFAULT '{}',
+			sync_topic TEXT NOT NULL,
+			provisioned INT NOT NULL,
+			stats_messages INT NOT NULL DEFAULT (0),
+			stats_emails INT NOT NULL DEFAULT (0),
+			stats_calls INT NOT NULL DEFAULT (0),
+			stripe_customer_id TEXT,
+			stripe_subscription_id TEXT,
+			stripe_subscription_status TEXT,
+			stripe_subscription_interval TEXT,
+			stripe_subscription_paid_until INT,
+			stripe_subscription_cancel_at INT,
+			created INT NOT NULL,
+			deleted INT,
+			email TEXT,
+			pass_expired INT NOT NULL DEFAULT (0),
+		    FOREIGN KEY (tier_id) REFERENCES tier (id)
+		);
+		CREATE UNIQUE INDEX idx_user ON user (user);
+		CREATE UNIQUE INDEX idx_user_stripe_customer_id ON user (stripe_customer_id);
+		CREATE UNIQUE INDEX idx_user_stripe_subscription_id ON user (stripe_subscription_id);
+		CREATE TABLE IF NOT EXISTS user_access (
+			user_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			read INT NOT NULL,
+			write INT NOT NULL,
+			owner_user_id INT,
+			provisioned INT NOT NULL,
+			PRIMARY KEY (user_id, topic),
+			FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+		    FOREIGN KEY (owner_user_id) REFERENCES user (id) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS schemaVersion (
+			id INT PRIMARY KEY,
+			version INT NOT NULL
+		);
+		INSERT INTO user (id, user, pass, role, sync_topic, provisioned, created)
+		VALUES ('u_everyone', '*', '', 'anonymous', '', false, UNIXEPOCH());
+		INSERT INTO user (id, user, pass, role, sync_topic, provisioned, created)
+		VALUES ('u_1234', 'ben', '$2a$10$YFCQvqQDwIIwnJM1xkAYOeih0dg17UVGanaTStnrSzC8NCWxcLDwy', 'user', 'st_1234', false, UNIXEPOCH());
+		INSERT INTO user_access (user_id, topic, read, write, provisioned) VALUES ('u_1234', 'mytopic', 1, 0, 0);
+		INSERT INTO schemaVersion (id, version) VALUES (1, 8);
+		COMMIT;
+	`)
+	require.Nil(t, err)
+
+	// Create manager to trigger migration
+	a := newTestManagerFromFile(t, filename, "", PermissionDenyAll, bcrypt.MinCost, DefaultUserStatsQueueWriterInterval)
+	checkSchemaVersion(t, a.db)
+
+	// Existing users and grants survive the migration
+	ben, err := a.User("ben")
+	require.Nil(t, err)
+	require.Equal(t, RoleUser, ben.Role)
+	require.Nil(t, a.Authorize(ben, "mytopic", PermissionRead))
+
+	// Foreign keys still point to the user table
+	var table string
+	require.Nil(t, db.QueryRow(`SELECT "table" FROM pragma_foreign_key_list('user_access') LIMIT 1`).Scan(&table))
+	require.Equal(t, "user", table)
+
+	// Custom roles can be assigned
+	require.Nil(t, a.AddRole(&CustomRole{Name: "operator", Capabilities: []Capability{CapabilityAccessWrite}}))
+	require.Nil(t, a.ChangeRole("ben", "operator"))
+	ben, err = a.User("ben")
+	require.Nil(t, err)
+	require.True(t, ben.HasCapability(CapabilityAccessWrite))
+}
+
 func checkSchemaVersion(t *testing.T, db *sql.DB) {
 	rows, err := db.Query(`SELECT version FROM schemaVersion`)
 	require.Nil(t, err)
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"heckel.io/ntfy/v2/log"
 	"heckel.io/ntfy/v2/payments"
+	"heckel.io/ntfy/v2/util"
 	"net/netip"
 	"strings"
 	"time"
@@ -11,18 +12,23 @@ import (
 
 // User is a struct that represents a user.
 type User struct {
-	ID          string
-	Name        string
-	Hash        string // Password hash (bcrypt)
-	Token       string // Only set if token was used to log in
-	Role        Role
-	Prefs       *Prefs
-	Tier        *Tier
-	Stats       *Stats
-	Billing     *Billing
-	SyncTopic   string
-	Provisioned bool // Whether the user was provisioned by the config file
-	Deleted     bool // Whether the user was soft-deleted
+	ID               string
+	Name             string
+	Hash             string // Password hash (bcrypt)
+	Token            string // Only set if token was used to log in
+	Role             Role
+	Capabilities     []Capability // Capabilities of the user's custom role, if any; admins implicitly have all capabilities
+	Prefs            *Prefs
+	Tier             *Tier
+	Stats            *Stats
+	Billing          *Billing
+	SyncTopic        string
+	Email            string    // Email address used for password resets, may be empty
+	PasswordExpired  bool      // Whether the password was force-expired, and must be reset
+	TierExpires      time.Time // Time at which the tier expires, zero if the tier does not expire
+	TierExpiryWarned bool      // Whether the user was warned about the upcoming tier expiry
+	Provisioned      bool      // Whether the user was provisioned by the config file
+	Deleted          bool      // Whether the user was soft-deleted
 }
 
 // TierID returns the ID of the User.Tier, or an empty string if the user has no tier,
@@ -45,12 +51,40 @@ func (u *User) IsAdmin() bool {
 	return u != nil && u.Role == RoleAdmin
 }
 
-// IsUser returns true if the user is a regular user, not an admin.
+// IsUser returns true if the user is a regular user, not an admin. Users with a custom role are
+// regular users as well; they are subject to access control and tier limits like any other user.
 //
 // Returns:
 //   - True if the user is a regular user, false otherwise.
 func (u *User) IsUser() bool {
-	return u != nil && u.Role == RoleUser
+	return u != nil && u.Role != RoleAdmin && u.Role != RoleAnonymous
+}
+
+// HasCapability returns true if the user's role grants the given capability. Admins have all capabilities.
+//
+// Parameters:
+//   - capability: The capability to check.
+//
+// Returns:
+//   - True if the user has the capability, false otherwise.
+func (u *User) HasCapability(capability Capability) bool {
+	if u == nil {
+		return false
+	} else if u.IsAdmin() {
+		return true
+	}
+	return util.Contains(u.Capabilities, capability)
+}
+
+// DisplayName returns the display name of the user as defined in the profile, or an empty string if it is not set.
+//
+// Returns:
+//   - The display name, or an empty string.
+func (u *User) DisplayName() string {
+	if u == nil || u.Prefs == nil || u.Prefs.Profile == nil || u.Prefs.Profile.DisplayName == nil {
+		return ""
+	}
+	return *u.Prefs.Profile.DisplayName
 }
 
 // Auther is an interface for authentication and authorization.
@@ -67,27 +101,36 @@ type Auther interface {
 
 // Token represents a user token, including expiry date.
 type Token struct {
-	Value       string
-	Label       string
-	LastAccess  time.Time
-	LastOrigin  netip.Addr
-	Expires     time.Time
-	Provisioned bool
+	Value         string
+	Label         string
+	LastAccess    time.Time
+	LastOrigin    netip.Addr
+	LastUserAgent string // User-Agent header of the last request, used to identify the device
+	Expires       time.Time
+	Provisioned   bool
 }
 
-// TokenUpdate holds information about the last access time and origin IP address of a token.
+// TokenUpdate holds information about the last access time, origin IP address and user agent of a token.
 type TokenUpdate struct {
-	LastAccess time.Time
-	LastOrigin netip.Addr
+	LastAccess    time.Time
+	LastOrigin    netip.Addr
+	LastUserAgent string
 }
 
 // Prefs represents a user's configuration settings.
 type Prefs struct {
 	Language      *string            `json:"language,omitempty"`
+	Profile       *ProfilePrefs      `json:"profile,omitempty"`
 	Notification  *NotificationPrefs `json:"notification,omitempty"`
 	Subscriptions []*Subscription    `json:"subscriptions,omitempty"`
 }
 
+// ProfilePrefs represents a user's profile, which clients can use to show a friendlier identity than the username.
+type ProfilePrefs struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	Avatar      *string `json:"avatar,omitempty"` // Avatar image, either an http(s) URL or a base64-encoded data URL
+}
+
 // Tier represents a user's account type, including its account limits.
 type Tier struct {
 	ID                       string        // Tier identifier (ti_...)
@@ -102,6 +145,8 @@ type Tier struct {
 	AttachmentTotalSizeLimit int64         // Total file size for all files of this user (bytes)
 	AttachmentExpiryDuration time.Duration // Duration after which attachments will be deleted
 	AttachmentBandwidthLimit int64         // Daily bandwidth limit for the user
+	AttachmentAllowedTypes   []string      // Allowed attachment MIME types (e.g. image/*); all types are allowed if empty
+	AttachmentDeniedTypes    []string      // Denied attachment MIME types (e.g. video/*), checked after AttachmentAllowedTypes
 	StripeMonthlyPriceID     string        // Monthly price ID for paid tiers (price_...)
 	StripeYearlyPriceID      string        // Yearly price ID for paid tiers (price_...)
 }
@@ -165,7 +210,8 @@ type Billing struct {
 type Grant struct {
 	TopicPattern string // May include wildcard (*)
 	Permission   Permission
-	Provisioned  bool // Whether the grant was provisioned by the config file
+	Provisioned  bool      // Whether the grant was provisioned by the config file
+	Expires      time.Time // Time at which the grant expires, zero if the grant does not expire
 }
 
 // Reservation is a struct that represents the ownership over a topic by a user.
@@ -175,6 +221,180 @@ type Reservation struct {
 	Everyone Permission
 }
 
+// Invite represents an invite token for a reserved topic. When redeemed, it grants the redeeming user
+// access to the topic, without the need for an admin to change the access control list.
+type Invite struct {
+	Token      string
+	Topic      string
+	Permission Permission // Permission granted to the redeeming user
+	Uses       int64      // Number of times the invite was redeemed
+	UsesLimit  int64      // Number of times the invite can be redeemed
+	Expires    time.Time  // Time at which the invite expires, zero if the invite does not expire
+	Created    time.Time
+}
+
+// GuestToken represents an anonymous, topic-scoped token. It allows devices to publish to (or subscribe to)
+// exactly one topic without a user account, with its own, typically very low, rate limits.
+type GuestToken struct {
+	ID           string
+	Token        string
+	Owner        string // Username of the topic owner who created the token, empty if created by an admin
+	Topic        string
+	Permission   Permission // Permission the guest has on the topic
+	Label        string
+	MessageLimit int64     // Number of messages the guest can publish per day
+	Expires      time.Time // Time at which the token expires, zero if the token does not expire
+	Created      time.Time
+}
+
+// TopicSchema is a JSON schema attached to a reserved topic by its owner. Messages published to the topic
+// with a JSON content type are validated against it.
+type TopicSchema struct {
+	Topic  string
+	Schema string // JSON schema document
+	Mode   SchemaMode
+}
+
+// TopicAlias is the former name of a reserved topic that was renamed by its owner. Publishing to or
+// subscribing to the alias is the same as publishing to or subscribing to the topic.
+type TopicAlias struct {
+	Alias      string // Former topic name
+	Topic      string // Current topic name
+	Deprecated bool   // Clients using the alias are told to switch to the current topic name
+	Created    time.Time
+}
+
+// TopicSilence is a silence window of a reserved topic, e.g. for nightly maintenance. While the window is
+// active, messages are cached and delivered to subscribers, but not forwarded via push notifications, email
+// or phone calls.
+type TopicSilence struct {
+	ID         string
+	Owner      string // Username of the topic owner
+	Topic      string
+	Start      time.Time // Start of the first window
+	End        time.Time // End of the first window
+	Repeat     SilenceRepeat
+	Summary    bool      // Whether a summary message is published when the window ends
+	Summarized time.Time // End of the last window for which a summary was published, zero if none
+	Created    time.Time
+}
+
+// Active returns true if the given time is within the silence window, or within any of its repetitions
+func (s *TopicSilence) Active(now time.Time) bool {
+	if now.Before(s.Start) {
+		return false
+	}
+	interval := s.Repeat.Interval()
+	if interval == 0 {
+		return now.Before(s.End)
+	}
+	return now.Sub(s.Start)%interval < s.End.Sub(s.Start)
+}
+
+// LastEnd returns the end of the last occurrence of the silence window that ended at or before the
+// given time, or the zero time if the window has not ended yet
+func (s *TopicSilence) LastEnd(now time.Time) time.Time {
+	if now.Before(s.End) {
+		return time.Time{}
+	}
+	interval := s.Repeat.Interval()
+	if interval == 0 {
+		return s.End
+	}
+	return s.End.Add(now.Sub(s.End) / interval * interval)
+}
+
+// TopicEscalation is the escalation policy of a reserved topic. Messages published to the topic that are not
+// acknowledged in time are re-published, e.g. with a higher priority or to another topic, and/or sent via
+// email or phone calls, turning the topic into a lightweight on-call pager.
+type TopicEscalation struct {
+	Topic       string
+	Owner       string // Username of the topic owner
+	MinPriority int    // Only messages with at least this priority are escalated
+	Steps       []*EscalationStep
+}
+
+// EscalationStep is a single step of an escalation policy. It is executed if the message has not been
+// acknowledged the given duration after it was published.
+type EscalationStep struct {
+	After    time.Duration `json:"after"`              // Duration after publishing the message
+	Priority int           `json:"priority,omitempty"` // Priority of the re-published message, zero to keep the priority
+	Topic    string        `json:"topic,omitempty"`    // Topic to re-publish the message to, empty for the same topic
+	Email    string        `json:"email,omitempty"`    // E-mail address to send the message to, if any
+	Call     string        `json:"call,omitempty"`     // Verified phone number of the owner to call, if any
+}
+
+// TopicMute is a topic muted by a user until a given time. While muted, the messages of the topic are not sent
+// to the user's Web Push subscriptions or e-mail address, but they are still cached and delivered to subscribers.
+type TopicMute struct {
+	UserID string
+	Topic  string
+	Until  time.Time
+}
+
+// SilenceRepeat defines whether and how often a silence window repeats
+type SilenceRepeat string
+
+// Silence window repeat intervals.
+const (
+	SilenceRepeatNone   = SilenceRepeat("")       // The window does not repeat
+	SilenceRepeatDaily  = SilenceRepeat("daily")  // The window repeats every 24 hours
+	SilenceRepeatWeekly = SilenceRepeat("weekly") // The window repeats every 7 days
+)
+
+// Valid returns true if the repeat interval is known
+func (r SilenceRepeat) Valid() bool {
+	return r == SilenceRepeatNone || r == SilenceRepeatDaily || r == SilenceRepeatWeekly
+}
+
+// Interval returns the duration after which the window repeats, or zero if it does not repeat
+func (r SilenceRepeat) Interval() time.Duration {
+	switch r {
+	case SilenceRepeatDaily:
+		return 24 * time.Hour
+	case SilenceRepeatWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// SchemaMode defines what happens to messages that do not match a topic's JSON schema
+type SchemaMode string
+
+// Schema modes.
+const (
+	SchemaModeReject = SchemaMode("reject") // Reject the message
+	SchemaModeTag    = SchemaMode("tag")    // Accept the message, but tag it as not matching the schema
+)
+
+// Valid returns true if the schema mode is known
+func (m SchemaMode) Valid() bool {
+	return m == SchemaModeReject || m == SchemaModeTag
+}
+
+// Authorize returns nil if the guest token grants the given permission to the given topic, and
+// ErrUnauthorized otherwise. Guest tokens never grant access to any other topic.
+func (g *GuestToken) Authorize(topic string, perm Permission) error {
+	if topic != g.Topic {
+		return ErrUnauthorized
+	} else if perm == PermissionRead && !g.Permission.IsRead() {
+		return ErrUnauthorized
+	} else if perm == PermissionWrite && !g.Permission.IsWrite() {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Context returns a log context for the guest token
+func (g *GuestToken) Context() log.Context {
+	return log.Context{
+		"guest_id":    g.ID,
+		"guest_topic": g.Topic,
+		"guest_owner": g.Owner,
+	}
+}
+
 // Permission represents a read or write permission to a topic.
 type Permission uint8
 
@@ -266,7 +486,7 @@ func (p Permission) String() string {
 	return "deny-all"
 }
 
-// Role represents a user's role, either admin or regular user.
+// Role represents a user's role, either admin, regular user, or a custom role defined in the user database.
 type Role string
 
 // User roles.
@@ -276,6 +496,36 @@ const (
 	RoleAnonymous = Role("anonymous")
 )
 
+// CustomRole is a role defined in the user database. Users with a custom role are regular users (see User.IsUser)
+// with additional capabilities, e.g. an "operator" that may manage topic access, but not users.
+type CustomRole struct {
+	Name         Role
+	Capabilities []Capability
+}
+
+// Capability represents a privileged action that a custom role may be allowed to perform.
+type Capability string
+
+// Capabilities that can be granted to custom roles. Admins implicitly have all capabilities.
+const (
+	CapabilityUsersRead   = Capability("users-read")   // List users, their tiers and access control entries
+	CapabilityUsersWrite  = Capability("users-write")  // Add, change and remove regular users
+	CapabilityAccessWrite = Capability("access-write") // Grant and revoke access to topics for any user
+	CapabilityImpersonate = Capability("impersonate")  // Act on behalf of regular users (every request is audit logged)
+	CapabilityLogLevel    = Capability("log-level")    // Temporarily change the server's log level
+	CapabilityStatsRead   = Capability("stats-read")   // View detailed server stats and list the reservations of all users
+)
+
+// Capabilities is the list of all known capabilities.
+var Capabilities = []Capability{
+	CapabilityUsersRead,
+	CapabilityUsersWrite,
+	CapabilityAccessWrite,
+	CapabilityImpersonate,
+	CapabilityLogLevel,
+	CapabilityStatsRead,
+}
+
 // Everyone is a special username representing anonymous users.
 const (
 	Everyone   = "*"
@@ -284,18 +534,31 @@ const (
 
 // Error constants used by the package.
 var (
-	ErrUnauthenticated        = errors.New("unauthenticated")
-	ErrUnauthorized           = errors.New("unauthorized")
-	ErrInvalidArgument        = errors.New("invalid argument")
-	ErrUserNotFound           = errors.New("user not found")
-	ErrUserExists             = errors.New("user already exists")
-	ErrPasswordHashInvalid    = errors.New("password hash must be a bcrypt hash, use 'ntfy user hash' to generate")
-	ErrPasswordHashWeak       = errors.New("password hash too weak, use 'ntfy user hash' to generate")
-	ErrTierNotFound           = errors.New("tier not found")
-	ErrTokenNotFound          = errors.New("token not found")
-	ErrPhoneNumberNotFound    = errors.New("phone number not found")
-	ErrTooManyReservations    = errors.New("new tier has lower reservation limit")
-	ErrPhoneNumberExists      = errors.New("phone number already exists")
-	ErrProvisionedUserChange  = errors.New("cannot change or delete provisioned user")
-	ErrProvisionedTokenChange = errors.New("cannot change or delete provisioned token")
+	ErrUnauthenticated            = errors.New("unauthenticated")
+	ErrUnauthorized               = errors.New("unauthorized")
+	ErrInvalidArgument            = errors.New("invalid argument")
+	ErrUserNotFound               = errors.New("user not found")
+	ErrUserExists                 = errors.New("user already exists")
+	ErrPasswordHashInvalid        = errors.New("password hash must be a bcrypt hash, use 'ntfy user hash' to generate")
+	ErrPasswordHashWeak           = errors.New("password hash too weak, use 'ntfy user hash' to generate")
+	ErrTierNotFound               = errors.New("tier not found")
+	ErrTokenNotFound              = errors.New("token not found")
+	ErrPhoneNumberNotFound        = errors.New("phone number not found")
+	ErrTooManyReservations        = errors.New("new tier has lower reservation limit")
+	ErrPhoneNumberExists          = errors.New("phone number already exists")
+	ErrProvisionedUserChange      = errors.New("cannot change or delete provisioned user")
+	ErrProvisionedTokenChange     = errors.New("cannot change or delete provisioned token")
+	ErrPasswordExpired            = errors.New("password expired")
+	ErrPasswordResetTokenNotFound = errors.New("password reset token not found or expired")
+	ErrRoleNotFound               = errors.New("role not found")
+	ErrRoleExists                 = errors.New("role already exists")
+	ErrRoleInUse                  = errors.New("role is still assigned to users")
+	ErrInviteNotFound             = errors.New("invite not found, used up or expired")
+	ErrGuestTokenNotFound         = errors.New("guest token not found")
+	ErrTopicSchemaNotFound        = errors.New("topic schema not found")
+	ErrTopicAliasNotFound         = errors.New("topic alias not found")
+	ErrTopicSilenceNotFound       = errors.New("topic silence window not found")
+	ErrTopicEscalationNotFound    = errors.New("topic escalation policy not found")
+	ErrTopicMuteNotFound          = errors.New("topic mute not found")
+	ErrTooManyTopicMutes          = errors.New("too many muted topics")
 )
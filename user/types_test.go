@@ -2,6 +2,7 @@ package user
 
 import (
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -73,3 +74,41 @@ func TestUsernameRegex(t *testing.T) {
 	require.True(t, AllowedUsername(usernameEmailAlias))
 	require.False(t, AllowedUsername(usernameInvalid))
 }
+
+func TestAllowedDisplayName(t *testing.T) {
+	require.True(t, AllowedDisplayName(""))
+	require.True(t, AllowedDisplayName("Phil"))
+	require.True(t, AllowedDisplayName("Philipp C. Heckel 🎉"))
+	require.True(t, AllowedDisplayName(strings.Repeat("ä", 64)))
+	require.False(t, AllowedDisplayName(strings.Repeat("ä", 65)))
+	require.False(t, AllowedDisplayName("Phil\nHeckel"))
+	require.False(t, AllowedDisplayName("Phil\x00"))
+}
+
+func TestAllowedAvatar(t *testing.T) {
+	require.True(t, AllowedAvatar("https://example.com/avatar.png"))
+	require.True(t, AllowedAvatar("http://example.com/avatar?size=64"))
+	require.True(t, AllowedAvatar("data:image/png;base64,iVBORw0KGgo="))
+	require.False(t, AllowedAvatar(""))
+	require.False(t, AllowedAvatar("ftp://example.com/avatar.png"))
+	require.False(t, AllowedAvatar("https://example.com/avatar with spaces.png"))
+	require.False(t, AllowedAvatar("javascript:alert(1)"))
+	require.False(t, AllowedAvatar("data:text/html;base64,PGh0bWw+"))
+	require.False(t, AllowedAvatar("data:image/png;base64,"+strings.Repeat("A", 65536)))
+}
+
+func TestAllowedRole(t *testing.T) {
+	require.True(t, AllowedRole(RoleUser))
+	require.True(t, AllowedRole(RoleAdmin))
+	require.True(t, AllowedRole("operator"))
+	require.True(t, AllowedRole("read-only_2"))
+	require.False(t, AllowedRole(RoleAnonymous))
+	require.False(t, AllowedRole(""))
+	require.False(t, AllowedRole("Operator"))
+	require.False(t, AllowedRole("op erator"))
+	require.False(t, AllowedCustomRole(RoleUser))
+	require.False(t, AllowedCustomRole(RoleAdmin))
+	require.True(t, AllowedCustomRole("auditor"))
+	require.True(t, AllowedCapability(CapabilityUsersRead))
+	require.False(t, AllowedCapability("launch-rockets"))
+}
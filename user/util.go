@@ -1,10 +1,13 @@
 package user
 
 import (
+	"errors"
 	"golang.org/x/crypto/bcrypt"
 	"heckel.io/ntfy/v2/util"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -12,10 +15,23 @@ var (
 	allowedTopicRegex        = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)  // No '*'
 	allowedTopicPatternRegex = regexp.MustCompile(`^[-_*A-Za-z0-9]{1,64}$`) // Adds '*' for wildcards!
 	allowedTierRegex         = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+	allowedContentTypeRegex  = regexp.MustCompile(`^[-+.a-z0-9]+/([-+.a-z0-9]+|\*)$`) // Allows wildcard subtype, e.g. image/*
+	allowedRoleRegex         = regexp.MustCompile(`^[-_a-z0-9]{1,64}$`)
 	allowedTokenRegex        = regexp.MustCompile(`^tk_[-_A-Za-z0-9]{29}$`) // Must be tokenLength-len(tokenPrefix)
+	allowedGuestTokenRegex   = regexp.MustCompile(`^gt_[a-z0-9]{29}$`)      // Must be guestTokenLength-len(guestTokenPrefix)
+	allowedAvatarURLRegex    = regexp.MustCompile(`^https?://\S+$`)
+	allowedAvatarDataRegex   = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,[A-Za-z0-9+/]+={0,2}$`)
 )
 
-// AllowedRole returns true if the given role can be used for new users.
+const (
+	displayNameMaxLength = 64
+	avatarURLMaxLength   = 2048
+	avatarDataMaxLength  = 65536
+)
+
+// AllowedRole returns true if the given role can be used for new users. Apart from the built-in
+// roles RoleUser and RoleAdmin, this includes any valid custom role name. Whether a custom role
+// actually exists is checked by the Manager when the role is assigned.
 //
 // Parameters:
 //   - role: The role to check.
@@ -23,7 +39,30 @@ var (
 // Returns:
 //   - True if the role is valid.
 func AllowedRole(role Role) bool {
-	return role == RoleUser || role == RoleAdmin
+	return role != RoleAnonymous && allowedRoleRegex.MatchString(string(role))
+}
+
+// AllowedCustomRole returns true if the given role can be used as the name of a custom role,
+// i.e. if it is a valid role name that does not clash with one of the built-in roles.
+//
+// Parameters:
+//   - role: The role name to check.
+//
+// Returns:
+//   - True if the role name is valid.
+func AllowedCustomRole(role Role) bool {
+	return AllowedRole(role) && role != RoleUser && role != RoleAdmin
+}
+
+// AllowedCapability returns true if the given capability is known, see Capabilities.
+//
+// Parameters:
+//   - capability: The capability to check.
+//
+// Returns:
+//   - True if the capability is valid.
+func AllowedCapability(capability Capability) bool {
+	return util.Contains(Capabilities, capability)
 }
 
 // AllowedUsername returns true if the given username is valid.
@@ -37,6 +76,36 @@ func AllowedUsername(username string) bool {
 	return allowedUsernameRegex.MatchString(username)
 }
 
+// AllowedDisplayName returns true if the given display name is valid, i.e. if it is not longer than
+// 64 characters and does not contain any control characters (e.g. newlines).
+//
+// Parameters:
+//   - displayName: The display name to check.
+//
+// Returns:
+//   - True if the display name is valid.
+func AllowedDisplayName(displayName string) bool {
+	if utf8.RuneCountInString(displayName) > displayNameMaxLength || !utf8.ValidString(displayName) {
+		return false
+	}
+	return !strings.ContainsFunc(displayName, unicode.IsControl)
+}
+
+// AllowedAvatar returns true if the given avatar is valid. An avatar can either be an http(s) URL,
+// or a small base64-encoded PNG, JPEG, GIF or WebP data URL.
+//
+// Parameters:
+//   - avatar: The avatar URL or data URL to check.
+//
+// Returns:
+//   - True if the avatar is valid.
+func AllowedAvatar(avatar string) bool {
+	if strings.HasPrefix(avatar, "data:") {
+		return len(avatar) <= avatarDataMaxLength && allowedAvatarDataRegex.MatchString(avatar)
+	}
+	return len(avatar) <= avatarURLMaxLength && allowedAvatarURLRegex.MatchString(avatar)
+}
+
 // AllowedTopic returns true if the given topic name is valid.
 //
 // Parameters:
@@ -59,6 +128,30 @@ func AllowedTopicPattern(topic string) bool {
 	return allowedTopicPatternRegex.MatchString(topic)
 }
 
+// AllowedAccessTemplate returns true if the given topic pattern is a valid access template, i.e. a valid
+// topic pattern that may contain the "<username>" placeholder.
+//
+// Parameters:
+//   - topicPattern: The topic pattern to check, e.g. "user-<username>-*".
+//
+// Returns:
+//   - True if the access template is valid.
+func AllowedAccessTemplate(topicPattern string) bool {
+	return AllowedTopicPattern(expandAccessTemplate(topicPattern, "user"))
+}
+
+// AllowedContentTypePattern returns true if the given MIME type pattern can be used to restrict the attachment
+// types of a tier, e.g. "application/pdf", or "video/*" to match all video types.
+//
+// Parameters:
+//   - pattern: The MIME type pattern to check.
+//
+// Returns:
+//   - True if the pattern is valid.
+func AllowedContentTypePattern(pattern string) bool {
+	return allowedContentTypeRegex.MatchString(pattern)
+}
+
 // AllowedTier returns true if the given tier name is valid.
 //
 // Parameters:
@@ -91,6 +184,22 @@ func ValidPasswordHash(hash string, minCost int) error {
 	return nil
 }
 
+// PasswordHashCost returns the bcrypt cost of the given password hash.
+//
+// Parameters:
+//   - hash: The bcrypt password hash.
+//
+// Returns:
+//   - The cost, or an error if the hash is not a valid bcrypt hash.
+func PasswordHashCost(hash string) (int, error) {
+	return bcrypt.Cost([]byte(hash))
+}
+
+// weakPasswordHash returns true if the given hash is a valid bcrypt hash, but uses a lower cost than minCost
+func weakPasswordHash(hash string, minCost int) bool {
+	return errors.Is(ValidPasswordHash(hash, minCost), ErrPasswordHashWeak)
+}
+
 // ValidToken returns true if the given token matches the naming convention.
 //
 // Parameters:
@@ -102,6 +211,17 @@ func ValidToken(token string) bool {
 	return allowedTokenRegex.MatchString(token)
 }
 
+// ValidGuestToken returns true if the given guest token matches the naming convention.
+//
+// Parameters:
+//   - token: The guest token string to check.
+//
+// Returns:
+//   - True if the guest token is valid.
+func ValidGuestToken(token string) bool {
+	return allowedGuestTokenRegex.MatchString(token)
+}
+
 // GenerateToken generates a new token with a prefix and a fixed length.
 // Lowercase only to support "<topic>+<token>@<domain>" email addresses.
 //
@@ -129,3 +249,8 @@ func hashPassword(password string, cost int) (string, error) {
 	}
 	return string(hash), nil
 }
+
+// expandAccessTemplate replaces the "<username>" placeholder in the given topic pattern with the username
+func expandAccessTemplate(topicPattern, username string) string {
+	return strings.ReplaceAll(topicPattern, accessTemplateUsername, username)
+}
@@ -0,0 +1,428 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// JSONSchema is a compiled JSON Schema, used to validate JSON documents, see ParseJSONSchema.
+//
+// Only the validation keywords that are commonly used to describe message payloads are supported: type, enum,
+// const, properties, required, additionalProperties, items, minItems, maxItems, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength, pattern, allOf, anyOf, oneOf and not.
+// Annotations such as title, description or format are ignored. References ($ref) are not supported.
+type JSONSchema struct {
+	boolean              *bool // For the "true" and "false" schemas
+	types                []string
+	enum                 []any
+	constValue           any
+	hasConst             bool
+	properties           map[string]*JSONSchema
+	required             []string
+	additionalProperties *JSONSchema
+	items                *JSONSchema
+	minItems             *int
+	maxItems             *int
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	multipleOf           *float64
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	allOf                []*JSONSchema
+	anyOf                []*JSONSchema
+	oneOf                []*JSONSchema
+	not                  *JSONSchema
+}
+
+var jsonSchemaTypes = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// ParseJSONSchema parses and compiles a JSON Schema.
+//
+// Parameters:
+//   - b: The JSON Schema document, e.g. {"type":"object","required":["temperature"]}.
+//
+// Returns:
+//   - The compiled JSONSchema, or an error if the schema is invalid or uses unsupported keywords.
+func ParseJSONSchema(b []byte) (*JSONSchema, error) {
+	var schema any
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return compileJSONSchema(schema, "#")
+}
+
+// Validate validates a JSON document against the schema. The returned error describes the first mismatch,
+// including the path to the invalid value, e.g. "$.readings[2]: must be of type number".
+func (s *JSONSchema) Validate(b []byte) error {
+	var value any
+	if err := json.Unmarshal(b, &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.validate(value, "$")
+}
+
+func compileJSONSchema(schema any, path string) (*JSONSchema, error) {
+	if b, ok := schema.(bool); ok {
+		return &JSONSchema{boolean: &b}, nil
+	}
+	m, ok := schema.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid JSON schema at %s: must be an object or a boolean", path)
+	}
+	s := &JSONSchema{}
+	var err error
+	for keyword, value := range m {
+		keywordPath := path + "/" + keyword
+		switch keyword {
+		case "$ref", "$dynamicRef", "$recursiveRef":
+			return nil, fmt.Errorf("invalid JSON schema at %s: references are not supported", keywordPath)
+		case "type":
+			if s.types, err = jsonSchemaTypeList(value, keywordPath); err != nil {
+				return nil, err
+			}
+		case "enum":
+			enum, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("invalid JSON schema at %s: must be an array", keywordPath)
+			}
+			s.enum = enum
+		case "const":
+			s.constValue, s.hasConst = value, true
+		case "properties":
+			properties, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("invalid JSON schema at %s: must be an object", keywordPath)
+			}
+			s.properties = make(map[string]*JSONSchema)
+			for name, property := range properties {
+				if s.properties[name], err = compileJSONSchema(property, keywordPath+"/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			if s.required, err = jsonSchemaStringList(value, keywordPath); err != nil {
+				return nil, err
+			}
+		case "additionalProperties":
+			if s.additionalProperties, err = compileJSONSchema(value, keywordPath); err != nil {
+				return nil, err
+			}
+		case "items":
+			if s.items, err = compileJSONSchema(value, keywordPath); err != nil {
+				return nil, err
+			}
+		case "minItems", "maxItems", "minLength", "maxLength":
+			n, ok := value.(float64)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				return nil, fmt.Errorf("invalid JSON schema at %s: must be a non-negative integer", keywordPath)
+			}
+			i := int(n)
+			switch keyword {
+			case "minItems":
+				s.minItems = &i
+			case "maxItems":
+				s.maxItems = &i
+			case "minLength":
+				s.minLength = &i
+			case "maxLength":
+				s.maxLength = &i
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf":
+			n, ok := value.(float64)
+			if !ok || (keyword == "multipleOf" && n <= 0) {
+				return nil, fmt.Errorf("invalid JSON schema at %s: must be a number", keywordPath)
+			}
+			switch keyword {
+			case "minimum":
+				s.minimum = &n
+			case "maximum":
+				s.maximum = &n
+			case "exclusiveMinimum":
+				s.exclusiveMinimum = &n
+			case "exclusiveMaximum":
+				s.exclusiveMaximum = &n
+			case "multipleOf":
+				s.multipleOf = &n
+			}
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid JSON schema at %s: must be a string", keywordPath)
+			}
+			if s.pattern, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid JSON schema at %s: %w", keywordPath, err)
+			}
+		case "allOf", "anyOf", "oneOf":
+			list, ok := value.([]any)
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("invalid JSON schema at %s: must be a non-empty array", keywordPath)
+			}
+			schemas := make([]*JSONSchema, len(list))
+			for i, item := range list {
+				if schemas[i], err = compileJSONSchema(item, keywordPath+"/"+strconv.Itoa(i)); err != nil {
+					return nil, err
+				}
+			}
+			switch keyword {
+			case "allOf":
+				s.allOf = schemas
+			case "anyOf":
+				s.anyOf = schemas
+			case "oneOf":
+				s.oneOf = schemas
+			}
+		case "not":
+			if s.not, err = compileJSONSchema(value, keywordPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *JSONSchema) validate(value any, path string) error {
+	if s.boolean != nil {
+		if !*s.boolean {
+			return fmt.Errorf("%s: not allowed", path)
+		}
+		return nil
+	}
+	if len(s.types) > 0 && !jsonSchemaTypeMatches(s.types, value) {
+		return fmt.Errorf("%s: must be of type %s", path, joinOr(s.types))
+	}
+	if s.enum != nil && !jsonSchemaContains(s.enum, value) {
+		return fmt.Errorf("%s: must be one of the enum values", path)
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constValue, value) {
+		return fmt.Errorf("%s: must be equal to the const value", path)
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		if err := s.validateObject(v, path); err != nil {
+			return err
+		}
+	case []any:
+		if err := s.validateArray(v, path); err != nil {
+			return err
+		}
+	case float64:
+		if err := s.validateNumber(v, path); err != nil {
+			return err
+		}
+	case string:
+		if err := s.validateString(v, path); err != nil {
+			return err
+		}
+	}
+	for _, schema := range s.allOf {
+		if err := schema.validate(value, path); err != nil {
+			return err
+		}
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, schema := range s.anyOf {
+			if schema.validate(value, path) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: must match at least one schema in anyOf", path)
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, schema := range s.oneOf {
+			if schema.validate(value, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: must match exactly one schema in oneOf, but matches %d", path, matches)
+		}
+	}
+	if s.not != nil && s.not.validate(value, path) == nil {
+		return fmt.Errorf("%s: must not match the schema in not", path)
+	}
+	return nil
+}
+
+func (s *JSONSchema) validateObject(v map[string]any, path string) error {
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			return fmt.Errorf("%s: missing required property %s", path, name)
+		}
+	}
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Deterministic error messages
+	for _, name := range names {
+		if property, ok := s.properties[name]; ok {
+			if err := property.validate(v[name], path+"."+name); err != nil {
+				return err
+			}
+		} else if s.additionalProperties != nil {
+			if s.additionalProperties.boolean != nil && !*s.additionalProperties.boolean {
+				return fmt.Errorf("%s: additional property %s is not allowed", path, name)
+			} else if err := s.additionalProperties.validate(v[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *JSONSchema) validateArray(v []any, path string) error {
+	if s.minItems != nil && len(v) < *s.minItems {
+		return fmt.Errorf("%s: must have at least %d items", path, *s.minItems)
+	} else if s.maxItems != nil && len(v) > *s.maxItems {
+		return fmt.Errorf("%s: must have at most %d items", path, *s.maxItems)
+	}
+	if s.items != nil {
+		for i, item := range v {
+			if err := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *JSONSchema) validateNumber(v float64, path string) error {
+	if s.minimum != nil && v < *s.minimum {
+		return fmt.Errorf("%s: must be >= %v", path, *s.minimum)
+	} else if s.maximum != nil && v > *s.maximum {
+		return fmt.Errorf("%s: must be <= %v", path, *s.maximum)
+	} else if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+		return fmt.Errorf("%s: must be > %v", path, *s.exclusiveMinimum)
+	} else if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+		return fmt.Errorf("%s: must be < %v", path, *s.exclusiveMaximum)
+	} else if s.multipleOf != nil {
+		if q := v / *s.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			return fmt.Errorf("%s: must be a multiple of %v", path, *s.multipleOf)
+		}
+	}
+	return nil
+}
+
+func (s *JSONSchema) validateString(v string, path string) error {
+	length := utf8.RuneCountInString(v)
+	if s.minLength != nil && length < *s.minLength {
+		return fmt.Errorf("%s: must be at least %d characters long", path, *s.minLength)
+	} else if s.maxLength != nil && length > *s.maxLength {
+		return fmt.Errorf("%s: must be at most %d characters long", path, *s.maxLength)
+	} else if s.pattern != nil && !s.pattern.MatchString(v) {
+		return fmt.Errorf("%s: must match pattern %s", path, s.pattern.String())
+	}
+	return nil
+}
+
+func jsonSchemaTypeList(value any, path string) ([]string, error) {
+	var types []string
+	switch v := value.(type) {
+	case string:
+		types = []string{v}
+	case []any:
+		for _, t := range v {
+			s, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid JSON schema at %s: must be a string or an array of strings", path)
+			}
+			types = append(types, s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid JSON schema at %s: must be a string or an array of strings", path)
+	}
+	for _, t := range types {
+		if !Contains(jsonSchemaTypes, t) {
+			return nil, fmt.Errorf("invalid JSON schema at %s: unknown type %s", path, t)
+		}
+	}
+	return types, nil
+}
+
+func jsonSchemaStringList(value any, path string) ([]string, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid JSON schema at %s: must be an array of strings", path)
+	}
+	strs := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid JSON schema at %s: must be an array of strings", path)
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+func jsonSchemaTypeMatches(types []string, value any) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonSchemaContains(values []any, value any) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinOr(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	s := ""
+	for i, v := range values {
+		if i == len(values)-1 {
+			s += " or " + v
+		} else if i > 0 {
+			s += ", " + v
+		} else {
+			s += v
+		}
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestJSONSchema_Validate(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "Sensor reading",
+		"type": "object",
+		"required": ["sensor", "temperature"],
+		"additionalProperties": false,
+		"properties": {
+			"sensor": {"type": "string", "pattern": "^[a-z]+-[0-9]+$", "maxLength": 16},
+			"temperature": {"type": "number", "minimum": -50, "maximum": 100},
+			"unit": {"enum": ["C", "F"]},
+			"readings": {"type": "array", "items": {"type": "integer"}, "maxItems": 3},
+			"battery": {"type": ["integer", "null"], "exclusiveMinimum": 0, "multipleOf": 5}
+		}
+	}`))
+	require.Nil(t, err)
+
+	require.Nil(t, schema.Validate([]byte(`{"sensor":"kitchen-1","temperature":21.5}`)))
+	require.Nil(t, schema.Validate([]byte(`{"sensor":"kitchen-1","temperature":21.5,"unit":"C","readings":[1,2,3],"battery":null}`)))
+	require.Nil(t, schema.Validate([]byte(`{"sensor":"kitchen-1","temperature":-50,"battery":95}`)))
+
+	for doc, expected := range map[string]string{
+		`{"sensor":"kitchen-1"}`:                                      "$: missing required property temperature",
+		`{"sensor":"kitchen-1","temperature":"hot"}`:                  "$.temperature: must be of type number",
+		`{"sensor":"kitchen-1","temperature":101}`:                    "$.temperature: must be <= 100",
+		`{"sensor":"Kitchen","temperature":1}`:                        "$.sensor: must match pattern ^[a-z]+-[0-9]+$",
+		`{"sensor":"kitchen-1","temperature":1,"unit":"K"}`:           "$.unit: must be one of the enum values",
+		`{"sensor":"kitchen-1","temperature":1,"readings":[1,2.5]}`:   "$.readings[1]: must be of type integer",
+		`{"sensor":"kitchen-1","temperature":1,"readings":[1,2,3,4]}`: "$.readings: must have at most 3 items",
+		`{"sensor":"kitchen-1","temperature":1,"battery":0}`:          "$.battery: must be > 0",
+		`{"sensor":"kitchen-1","temperature":1,"battery":42}`:         "$.battery: must be a multiple of 5",
+		`{"sensor":"kitchen-1","temperature":1,"battery":"full"}`:     "$.battery: must be of type integer or null",
+		`{"sensor":"kitchen-1","temperature":1,"humidity":50}`:        "$: additional property humidity is not allowed",
+		`["kitchen-1"]`: "$: must be of type object",
+	} {
+		require.EqualError(t, schema.Validate([]byte(doc)), expected, doc)
+	}
+	require.ErrorContains(t, schema.Validate([]byte(`not json`)), "invalid JSON")
+}
+
+func TestJSONSchema_Combinators(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{
+		"anyOf": [{"type": "string", "minLength": 3}, {"type": "number"}],
+		"not": {"const": "forbidden"}
+	}`))
+	require.Nil(t, err)
+	require.Nil(t, schema.Validate([]byte(`"abc"`)))
+	require.Nil(t, schema.Validate([]byte(`12`)))
+	require.EqualError(t, schema.Validate([]byte(`"ab"`)), "$: must match at least one schema in anyOf")
+	require.EqualError(t, schema.Validate([]byte(`"forbidden"`)), "$: must not match the schema in not")
+
+	schema, err = ParseJSONSchema([]byte(`{"oneOf": [{"type": "integer"}, {"minimum": 10}], "allOf": [{"maximum": 100}]}`))
+	require.Nil(t, err)
+	require.Nil(t, schema.Validate([]byte(`5`)))
+	require.Nil(t, schema.Validate([]byte(`10.5`)))
+	require.EqualError(t, schema.Validate([]byte(`20`)), "$: must match exactly one schema in oneOf, but matches 2")
+	require.EqualError(t, schema.Validate([]byte(`101.5`)), "$: must be <= 100")
+
+	schema, err = ParseJSONSchema([]byte(`false`))
+	require.Nil(t, err)
+	require.EqualError(t, schema.Validate([]byte(`{}`)), "$: not allowed")
+}
+
+func TestParseJSONSchema_Invalid(t *testing.T) {
+	for schema, expected := range map[string]string{
+		`{"type": "float"}`:                      "invalid JSON schema at #/type: unknown type float",
+		`{"properties": {"a": {"$ref": "#/b"}}}`: "invalid JSON schema at #/properties/a/$ref: references are not supported",
+		`{"required": "a"}`:                      "invalid JSON schema at #/required: must be an array of strings",
+		`{"minLength": -1}`:                      "invalid JSON schema at #/minLength: must be a non-negative integer",
+		`{"anyOf": []}`:                          "invalid JSON schema at #/anyOf: must be a non-empty array",
+		`{"items": [{"type": "string"}]}`:        "invalid JSON schema at #/items: must be an object or a boolean",
+		`{"pattern": "("}`:                       "invalid JSON schema at #/pattern: error parsing regexp: missing closing ): `(`",
+		`[]`:                                     "invalid JSON schema at #: must be an object or a boolean",
+	} {
+		_, err := ParseJSONSchema([]byte(schema))
+		require.EqualError(t, err, expected, schema)
+	}
+	_, err := ParseJSONSchema([]byte(`{`))
+	require.ErrorContains(t, err, "invalid JSON schema")
+}
@@ -74,6 +74,13 @@ func (l *FixedLimiter) Value() int64 {
 	return l.value
 }
 
+// Limit returns the limit of the limiter
+func (l *FixedLimiter) Limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
 // Reset sets the limiter's value back to zero
 func (l *FixedLimiter) Reset() {
 	l.mu.Lock()
@@ -81,13 +88,15 @@ func (l *FixedLimiter) Reset() {
 	l.value = 0
 }
 
-// RateLimiter is a Limiter that wraps a rate.Limiter, allowing a floating time-based limit.
+// RateLimiter is a Limiter that wraps a RateAlgorithmLimiter (by default a rate.Limiter), allowing a floating
+// time-based limit.
 type RateLimiter struct {
-	r       rate.Limit
-	b       int
-	value   int64
-	limiter *rate.Limiter
-	mu      sync.Mutex
+	algorithm RateAlgorithm
+	r         rate.Limit
+	b         int
+	value     int64
+	limiter   RateAlgorithmLimiter
+	mu        sync.Mutex
 }
 
 var _ Limiter = (*RateLimiter)(nil)
@@ -102,18 +111,33 @@ func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
 // Note that the starting value only has informational value. It does not impact the underlying
 // value of the rate.Limiter.
 func NewRateLimiterWithValue(r rate.Limit, b int, value int64) *RateLimiter {
+	return NewRateLimiterWithAlgorithm(DefaultRateAlgorithm, r, b, value)
+}
+
+// NewRateLimiterWithAlgorithm creates a new RateLimiter that uses the given algorithm (see RateAlgorithm),
+// with the given starting value. As with NewRateLimiterWithValue, the starting value is only informational.
+func NewRateLimiterWithAlgorithm(algorithm RateAlgorithm, r rate.Limit, b int, value int64) *RateLimiter {
+	if algorithm == "" {
+		algorithm = DefaultRateAlgorithm
+	}
 	return &RateLimiter{
-		r:       r,
-		b:       b,
-		value:   value,
-		limiter: rate.NewLimiter(r, b),
+		algorithm: algorithm,
+		r:         r,
+		b:         b,
+		value:     value,
+		limiter:   NewRateAlgorithmLimiter(algorithm, r, b),
 	}
 }
 
 // NewBytesLimiter creates a RateLimiter that is meant to be used for a bytes-per-interval limit,
 // e.g. 250 MB per day. And example of the underlying idea can be found here: https://go.dev/play/p/0ljgzIZQ6dJ
 func NewBytesLimiter(bytes int, interval time.Duration) *RateLimiter {
-	return NewRateLimiter(rate.Limit(bytes)*rate.Every(interval), bytes)
+	return NewBytesLimiterWithAlgorithm(DefaultRateAlgorithm, bytes, interval)
+}
+
+// NewBytesLimiterWithAlgorithm is like NewBytesLimiter, but uses the given algorithm (see RateAlgorithm)
+func NewBytesLimiterWithAlgorithm(algorithm RateAlgorithm, bytes int, interval time.Duration) *RateLimiter {
+	return NewRateLimiterWithAlgorithm(algorithm, rate.Limit(bytes)*rate.Every(interval), bytes, 0)
 }
 
 // Allow adds one to the limiters internal value, but only if the limit has not been reached. If the limit was
@@ -144,11 +168,33 @@ func (l *RateLimiter) Value() int64 {
 	return l.value
 }
 
-// Reset sets the limiter's value back to zero, and resets the underlying rate.Limiter
+// Tokens returns the number of events that are currently allowed, i.e. the remaining burst
+func (l *RateLimiter) Tokens() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limiter.TokensAt(time.Now())
+}
+
+// Limit returns the rate of the limiter, in events per second
+func (l *RateLimiter) Limit() rate.Limit {
+	return l.r
+}
+
+// Burst returns the burst of the limiter, i.e. the max number of events allowed at once
+func (l *RateLimiter) Burst() int {
+	return l.b
+}
+
+// Algorithm returns the algorithm of the limiter
+func (l *RateLimiter) Algorithm() RateAlgorithm {
+	return l.algorithm
+}
+
+// Reset sets the limiter's value back to zero, and resets the underlying rate limiting algorithm
 func (l *RateLimiter) Reset() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.limiter = rate.NewLimiter(l.r, l.b)
+	l.limiter = NewRateAlgorithmLimiter(l.algorithm, l.r, l.b)
 	l.value = 0
 }
 
@@ -0,0 +1,174 @@
+package util
+
+import (
+	"fmt"
+	"golang.org/x/time/rate"
+	"math"
+	"strings"
+	"time"
+)
+
+// RateAlgorithm is the algorithm used by a RateLimiter to decide whether an event is allowed, see
+// NewRateAlgorithmLimiter. All algorithms are configured with a rate (events per second) and a burst.
+type RateAlgorithm string
+
+// Rate limiting algorithms supported by NewRateAlgorithmLimiter
+const (
+	// RateAlgorithmTokenBucket allows up to burst events at once, and replenishes one token per 1/rate seconds
+	RateAlgorithmTokenBucket = RateAlgorithm("token-bucket")
+
+	// RateAlgorithmSlidingWindow allows up to burst events within any window of burst/rate seconds
+	RateAlgorithmSlidingWindow = RateAlgorithm("sliding-window")
+
+	// RateAlgorithmGCRA (generic cell rate algorithm) spaces events 1/rate seconds apart, but tolerates up to
+	// burst events ahead of schedule
+	RateAlgorithmGCRA = RateAlgorithm("gcra")
+)
+
+// DefaultRateAlgorithm is the algorithm used by NewRateLimiter
+const DefaultRateAlgorithm = RateAlgorithmTokenBucket
+
+// RateAlgorithms lists all supported rate limiting algorithms
+var RateAlgorithms = []RateAlgorithm{RateAlgorithmTokenBucket, RateAlgorithmSlidingWindow, RateAlgorithmGCRA}
+
+// ParseRateAlgorithm converts a string to a RateAlgorithm, e.g. "gcra" or "sliding-window". Underscores
+// are accepted in place of dashes, and case is ignored.
+func ParseRateAlgorithm(s string) (RateAlgorithm, error) {
+	algorithm := RateAlgorithm(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "_", "-"))
+	for _, a := range RateAlgorithms {
+		if a == algorithm {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("invalid rate limiting algorithm %s, must be one of token-bucket, sliding-window or gcra", s)
+}
+
+// RateAlgorithmLimiter is the interface implemented by the rate limiting algorithms, see RateAlgorithm. It is
+// implemented by rate.Limiter (token bucket), which is why it uses the same method signatures. Implementations
+// are not safe for concurrent use, unless stated otherwise.
+type RateAlgorithmLimiter interface {
+	// AllowN reports whether n events may happen at time t, and consumes them if so
+	AllowN(t time.Time, n int) bool
+
+	// TokensAt returns the number of events that may happen at time t
+	TokensAt(t time.Time) float64
+}
+
+// NewRateAlgorithmLimiter creates a RateAlgorithmLimiter using the given algorithm.
+//
+// If the rate is zero (only the burst is allowed, ever) or infinite (everything is allowed), all algorithms
+// behave the same, so a token bucket is used.
+//
+// Parameters:
+//   - algorithm: The rate limiting algorithm, e.g. RateAlgorithmGCRA. If empty, DefaultRateAlgorithm is used.
+//   - r: The rate, in events per second.
+//   - b: The burst, i.e. the number of events allowed at once.
+//
+// Returns:
+//   - A new RateAlgorithmLimiter, with the full burst available.
+func NewRateAlgorithmLimiter(algorithm RateAlgorithm, r rate.Limit, b int) RateAlgorithmLimiter {
+	if r <= 0 || r == rate.Inf {
+		return rate.NewLimiter(r, b)
+	}
+	switch algorithm {
+	case RateAlgorithmSlidingWindow:
+		return newSlidingWindowLimiter(r, b)
+	case RateAlgorithmGCRA:
+		return newGCRALimiter(r, b)
+	default:
+		return rate.NewLimiter(r, b)
+	}
+}
+
+// slidingWindowLimiter implements RateAlgorithmSlidingWindow. To avoid storing the time of every event, it
+// approximates the number of events in the sliding window from the counts of the current and the previous
+// fixed window, weighting the previous count by how much of it still overlaps with the sliding window.
+type slidingWindowLimiter struct {
+	window      time.Duration
+	burst       int
+	start       time.Time // Start of the current fixed window
+	current     int
+	previous    int
+	initialized bool
+}
+
+func newSlidingWindowLimiter(r rate.Limit, b int) *slidingWindowLimiter {
+	return &slidingWindowLimiter{
+		window: time.Duration(float64(b) / float64(r) * float64(time.Second)),
+		burst:  b,
+	}
+}
+
+func (l *slidingWindowLimiter) AllowN(t time.Time, n int) bool {
+	if float64(n) > l.TokensAt(t) {
+		return false
+	}
+	l.current += n
+	return true
+}
+
+func (l *slidingWindowLimiter) TokensAt(t time.Time) float64 {
+	if l.window <= 0 {
+		return 0
+	}
+	l.advance(t)
+	elapsed := float64(t.Sub(l.start)) / float64(l.window)
+	count := float64(l.previous)*(1-elapsed) + float64(l.current)
+	return math.Max(0, float64(l.burst)-count)
+}
+
+// advance moves the current fixed window forward, so that it contains t
+func (l *slidingWindowLimiter) advance(t time.Time) {
+	if !l.initialized {
+		l.start, l.initialized = t, true
+		return
+	} else if t.Before(l.start) {
+		return // Time went backwards; keep counting in the current window
+	}
+	windows := t.Sub(l.start) / l.window
+	if windows == 0 {
+		return
+	} else if windows == 1 {
+		l.previous, l.current = l.current, 0
+	} else {
+		l.previous, l.current = 0, 0
+	}
+	l.start = l.start.Add(windows * l.window)
+}
+
+// gcraLimiter implements RateAlgorithmGCRA. It tracks the theoretical arrival time (TAT) of the next event:
+// each event moves it 1/rate seconds into the future, and an event is allowed as long as the TAT does not
+// move more than burst/rate seconds ahead of the current time.
+type gcraLimiter struct {
+	interval  float64 // Emission interval in seconds, i.e. 1/rate
+	tolerance float64 // Burst tolerance in seconds, i.e. burst/rate
+	tat       time.Time
+}
+
+func newGCRALimiter(r rate.Limit, b int) *gcraLimiter {
+	return &gcraLimiter{
+		interval:  1 / float64(r),
+		tolerance: float64(b) / float64(r),
+	}
+}
+
+func (l *gcraLimiter) AllowN(t time.Time, n int) bool {
+	tat := l.tat
+	if tat.Before(t) {
+		tat = t
+	}
+	next := tat.Add(time.Duration(float64(n) * l.interval * float64(time.Second)))
+	if next.Sub(t).Seconds() > l.tolerance+1e-9 {
+		return false
+	}
+	l.tat = next
+	return true
+}
+
+func (l *gcraLimiter) TokensAt(t time.Time) float64 {
+	ahead := 0.0
+	if l.tat.After(t) {
+		ahead = l.tat.Sub(t).Seconds()
+	}
+	return math.Max(0, (l.tolerance-ahead)/l.interval)
+}
@@ -0,0 +1,102 @@
+package util
+
+import (
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func TestParseRateAlgorithm(t *testing.T) {
+	a, err := ParseRateAlgorithm("GCRA")
+	require.Nil(t, err)
+	require.Equal(t, RateAlgorithmGCRA, a)
+	a, err = ParseRateAlgorithm("sliding_window")
+	require.Nil(t, err)
+	require.Equal(t, RateAlgorithmSlidingWindow, a)
+	a, err = ParseRateAlgorithm(" token-bucket ")
+	require.Nil(t, err)
+	require.Equal(t, RateAlgorithmTokenBucket, a)
+	_, err = ParseRateAlgorithm("leaky-bucket")
+	require.Error(t, err)
+}
+
+func TestRateAlgorithmLimiter_Burst(t *testing.T) {
+	now := time.Now()
+	for _, algorithm := range RateAlgorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			l := NewRateAlgorithmLimiter(algorithm, rate.Every(time.Second), 5) // 5 at once, then 1 per second
+			require.Equal(t, float64(5), l.TokensAt(now))
+			require.True(t, l.AllowN(now, 3))
+			require.True(t, l.AllowN(now, 2))
+			require.False(t, l.AllowN(now, 1))
+			require.Equal(t, float64(0), l.TokensAt(now))
+		})
+	}
+}
+
+func TestRateAlgorithmLimiter_TokenBucketAndGCRA_Replenish(t *testing.T) {
+	now := time.Now()
+	for _, algorithm := range []RateAlgorithm{RateAlgorithmTokenBucket, RateAlgorithmGCRA} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			l := NewRateAlgorithmLimiter(algorithm, rate.Every(time.Second), 5)
+			require.True(t, l.AllowN(now, 5))
+			require.False(t, l.AllowN(now.Add(500*time.Millisecond), 1))
+			require.True(t, l.AllowN(now.Add(time.Second), 1))
+			require.False(t, l.AllowN(now.Add(time.Second), 1))
+			require.InDelta(t, 2, l.TokensAt(now.Add(3*time.Second)), 0.001)
+			require.InDelta(t, 5, l.TokensAt(now.Add(time.Minute)), 0.001) // Never more than the burst
+		})
+	}
+}
+
+func TestRateAlgorithmLimiter_SlidingWindow(t *testing.T) {
+	now := time.Now()
+	l := NewRateAlgorithmLimiter(RateAlgorithmSlidingWindow, rate.Every(time.Second), 10) // 10 per 10 seconds
+	require.True(t, l.AllowN(now, 10))
+	require.False(t, l.AllowN(now.Add(time.Second), 1))
+
+	// Half-way into the next window, half of the previous window still counts
+	require.InDelta(t, 5, l.TokensAt(now.Add(15*time.Second)), 0.001)
+	require.True(t, l.AllowN(now.Add(15*time.Second), 5))
+	require.False(t, l.AllowN(now.Add(15*time.Second), 1))
+
+	// Two windows later, everything is forgotten
+	require.Equal(t, float64(10), l.TokensAt(now.Add(time.Minute)))
+}
+
+func TestRateAlgorithmLimiter_ZeroRate(t *testing.T) {
+	now := time.Now()
+	for _, algorithm := range RateAlgorithms {
+		l := NewRateAlgorithmLimiter(algorithm, 0, 2) // Only the burst, ever
+		require.True(t, l.AllowN(now, 2))
+		require.False(t, l.AllowN(now.Add(time.Hour), 1))
+		l = NewRateAlgorithmLimiter(algorithm, 0, 0) // Nothing
+		require.False(t, l.AllowN(now, 1))
+	}
+}
+
+func TestRateLimiter_Algorithm(t *testing.T) {
+	l := NewRateLimiterWithAlgorithm(RateAlgorithmGCRA, rate.Every(time.Hour), 2, 10)
+	require.Equal(t, RateAlgorithmGCRA, l.Algorithm())
+	require.Equal(t, rate.Every(time.Hour), l.Limit())
+	require.Equal(t, int64(10), l.Value())
+	require.True(t, l.Allow())
+	require.True(t, l.Allow())
+	require.False(t, l.Allow())
+	require.Equal(t, int64(12), l.Value())
+	require.Less(t, l.Tokens(), 0.01)
+
+	l.Reset()
+	require.Equal(t, int64(0), l.Value())
+	require.InDelta(t, 2, l.Tokens(), 0.01)
+	require.Equal(t, DefaultRateAlgorithm, NewRateLimiter(1, 1).Algorithm())
+}
+
+func TestBytesLimiter_SlidingWindow(t *testing.T) {
+	l := NewBytesLimiterWithAlgorithm(RateAlgorithmSlidingWindow, 1000, 24*time.Hour)
+	require.True(t, l.AllowN(600))
+	require.False(t, l.AllowN(500))
+	require.True(t, l.AllowN(400))
+	require.Equal(t, int64(1000), l.Value())
+}
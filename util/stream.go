@@ -0,0 +1,128 @@
+package util
+
+import (
+	"io"
+	"sync"
+)
+
+// sniffLimit is the number of bytes used to detect the content type of a stream, see SniffContentType.
+// This matches the default read limit of the mimetype library.
+const sniffLimit = 3072
+
+// ProgressFunc is called by a ProgressReader after each read, with the number of bytes transferred so far
+// and the total number of bytes. If the total is not known, it is -1.
+type ProgressFunc func(transferred, total int64)
+
+// ProgressReader is an io.ReadCloser that reports the progress of reading the underlying reader, e.g. to
+// display the progress of an attachment upload. It can be used as the body of an http.Request.
+type ProgressReader struct {
+	r           io.Reader
+	total       int64
+	transferred int64
+	fn          ProgressFunc
+	done        bool // True if fn was called with transferred == total
+}
+
+// NewProgressReader creates a new ProgressReader that calls fn after each read of r. The total may be
+// -1 if it is not known. The last call always has transferred == total: when r is exhausted and the
+// total is not known (or was wrong), fn is called with the final number of bytes as total.
+func NewProgressReader(r io.Reader, total int64, fn ProgressFunc) *ProgressReader {
+	return &ProgressReader{
+		r:     r,
+		total: total,
+		fn:    fn,
+	}
+}
+
+// Read reads from the underlying reader and reports the progress
+func (r *ProgressReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.transferred += int64(n)
+	if n > 0 && (err != io.EOF || r.total >= 0) {
+		r.fn(r.transferred, r.total)
+		r.done = r.transferred == r.total
+	}
+	if err == io.EOF && !r.done {
+		r.done = true
+		r.fn(r.transferred, r.transferred)
+	}
+	return
+}
+
+// Close closes the underlying reader, if it is an io.Closer
+func (r *ProgressReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// LimitTeeReader is like io.TeeReader: everything read from the underlying reader is written to w. Unlike
+// io.TeeReader, it stops reading with ErrLimitReached once any of the limiters' limit is reached, e.g. to
+// stream an upload into a file while capping its size. Unlike io.LimitReader, exceeding the limit is an
+// error, and not a silent EOF.
+type LimitTeeReader struct {
+	r        io.Reader
+	w        io.Writer
+	limiters []Limiter
+	mu       sync.Mutex
+}
+
+// NewLimitTeeReader creates a new LimitTeeReader. If w is nil, the read bytes are only counted.
+func NewLimitTeeReader(r io.Reader, w io.Writer, limiters ...Limiter) *LimitTeeReader {
+	return &LimitTeeReader{
+		r:        r,
+		w:        w,
+		limiters: limiters,
+	}
+}
+
+// Read reads from the underlying reader and writes the read bytes to w, until any of the limiters' limit
+// is reached, at which point Read returns ErrLimitReached
+func (r *LimitTeeReader) Read(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err = r.r.Read(p)
+	if n > 0 {
+		for i := 0; i < len(r.limiters); i++ {
+			if !r.limiters[i].AllowN(int64(n)) {
+				for j := i - 1; j >= 0; j-- {
+					r.limiters[j].AllowN(-int64(n)) // Revert limiters limits if not allowed
+				}
+				return 0, ErrLimitReached
+			}
+		}
+		if r.w != nil {
+			if _, err := r.w.Write(p[:n]); err != nil {
+				return n, err
+			}
+		}
+	}
+	return
+}
+
+// SniffContentType detects the content type and file extension of a stream (see DetectContentType), without
+// consuming it. The returned reader yields the full stream, including the bytes used for detection. If r is
+// a PeekedReadCloser that has already peeked enough bytes, no additional bytes are read.
+//
+// Parameters:
+//   - r: The stream to detect the content type of.
+//   - filename: The filename of the stream, if known, used to detect special types such as APKs.
+//
+// Returns:
+//   - The mime type, e.g. "image/png".
+//   - The file extension including the dot, e.g. ".png".
+//   - A reader that yields the full stream.
+//   - An error if reading the stream fails.
+func SniffContentType(r io.ReadCloser, filename string) (mimeType string, ext string, rc io.ReadCloser, err error) {
+	if peeked, ok := r.(*PeekedReadCloser); ok && (len(peeked.PeekedBytes) >= sniffLimit || !peeked.LimitReached) {
+		mimeType, ext = DetectContentType(peeked.PeekedBytes, filename)
+		return mimeType, ext, peeked, nil
+	}
+	peeked, err := Peek(r, sniffLimit)
+	if err != nil {
+		return "", "", nil, err
+	}
+	mimeType, ext = DetectContentType(peeked.PeekedBytes, filename)
+	return mimeType, ext, peeked, nil
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProgressReader_KnownTotal(t *testing.T) {
+	var calls [][2]int64
+	r := NewProgressReader(strings.NewReader("1234567890"), 10, func(transferred, total int64) {
+		calls = append(calls, [2]int64{transferred, total})
+	})
+	buf := make([]byte, 4)
+	for {
+		if _, err := r.Read(buf); err == io.EOF {
+			break
+		}
+	}
+	require.Equal(t, [][2]int64{{4, 10}, {8, 10}, {10, 10}}, calls)
+	require.Nil(t, r.Close())
+}
+
+func TestProgressReader_UnknownTotal(t *testing.T) {
+	var last [2]int64
+	r := NewProgressReader(io.NopCloser(strings.NewReader("1234567890")), -1, func(transferred, total int64) {
+		last = [2]int64{transferred, total}
+	})
+	all, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "1234567890", string(all))
+	require.Equal(t, [2]int64{10, 10}, last) // Total is known at EOF
+}
+
+func TestLimitTeeReader_UnderLimit(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewLimitTeeReader(strings.NewReader("1234567890"), &buf, NewFixedLimiter(10))
+	all, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "1234567890", string(all))
+	require.Equal(t, "1234567890", buf.String())
+}
+
+func TestLimitTeeReader_LimitReached(t *testing.T) {
+	var buf bytes.Buffer
+	lenient, strict := NewFixedLimiter(100), NewFixedLimiter(9)
+	r := NewLimitTeeReader(strings.NewReader("1234567890"), &buf, lenient, strict)
+	_, err := io.ReadAll(r)
+	require.Equal(t, ErrLimitReached, err)
+	require.Equal(t, "", buf.String())
+	require.Equal(t, int64(0), lenient.Value()) // Reverted
+}
+
+func TestSniffContentType_Reader(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("x", 5000)
+	mimeType, ext, r, err := SniffContentType(io.NopCloser(strings.NewReader(png)), "")
+	require.Nil(t, err)
+	require.Equal(t, "image/png", mimeType)
+	require.Equal(t, ".png", ext)
+	all, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, png, string(all))
+}
+
+func TestSniffContentType_PeekedReadCloser(t *testing.T) {
+	peeked, err := Peek(io.NopCloser(strings.NewReader("PK\x03\x04 not really a zip")), 4096)
+	require.Nil(t, err)
+	mimeType, ext, r, err := SniffContentType(peeked, "app.apk")
+	require.Nil(t, err)
+	require.Equal(t, "application/vnd.android.package-archive", mimeType)
+	require.Equal(t, ".apk", ext)
+	require.Same(t, peeked, r) // Not peeked again
+
+	// Not enough bytes peeked
+	peeked, err = Peek(io.NopCloser(strings.NewReader("some text, longer than the peek limit")), 4)
+	require.Nil(t, err)
+	mimeType, _, r, err = SniffContentType(peeked, "")
+	require.Nil(t, err)
+	require.Equal(t, "text/plain; charset=utf-8", mimeType)
+	all, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "some text, longer than the peek limit", string(all))
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"maps"
 	"math"
 	"math/rand"
 	"net/netip"
@@ -25,6 +27,8 @@ import (
 const (
 	randomStringCharset          = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	randomStringLowerCaseCharset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	secretFilePrefix             = "file://"
+	secretEnvPrefix              = "env://"
 )
 
 var (
@@ -122,6 +126,76 @@ func SplitNoEmpty(s string, sep string) []string {
 	return res
 }
 
+// SplitTags splits a list of tags, separated either by commas (e.g. "warning, skull"), or, if there are no
+// commas, by whitespace (e.g. "warning skull"). Tags are trimmed, and empty tags are removed.
+//
+// Parameters:
+//   - s: The list of tags.
+//
+// Returns:
+//   - A slice of non-empty tags.
+func SplitTags(s string) []string {
+	var parts []string
+	if strings.Contains(s, ",") {
+		parts = strings.Split(s, ",")
+	} else {
+		parts = strings.Fields(s)
+	}
+	tags := make([]string, 0, len(parts))
+	for _, tag := range parts {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ClosestMatch returns the candidate with the smallest edit distance (Levenshtein distance) to s, if that
+// distance is at most maxDistance. It is used to suggest corrections for typos. If multiple candidates are
+// equally close, the alphabetically first one is returned.
+//
+// Parameters:
+//   - s: The (misspelled) string.
+//   - candidates: The valid values.
+//   - maxDistance: The maximum number of edits.
+//
+// Returns:
+//   - The closest candidate, or an empty string if none is close enough.
+func ClosestMatch(s string, candidates iter.Seq[string], maxDistance int) string {
+	closest, closestDistance := "", maxDistance+1
+	for candidate := range candidates {
+		distance := levenshtein(s, candidate)
+		if distance < closestDistance || (distance == closestDistance && candidate < closest) {
+			closest, closestDistance = candidate, distance
+		}
+	}
+	if closestDistance > maxDistance {
+		return ""
+	}
+	return closest
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
 // SplitKV splits a string into a key/value pair using a separator, and trimming space. If the separator
 // is not found, key is empty.
 //
@@ -261,7 +335,28 @@ func ValidRandomString(s string, length int) bool {
 	return true
 }
 
-// ParsePriority parses a priority string into its equivalent integer value.
+// priorityNames maps the names and human-friendly aliases of priorities to their integer value
+var priorityNames = map[string]int{
+	"min":       1,
+	"minimum":   1,
+	"lowest":    1,
+	"quiet":     1,
+	"low":       2,
+	"meh":       2,
+	"default":   3,
+	"normal":    3,
+	"medium":    3,
+	"high":      4,
+	"important": 4,
+	"max":       5,
+	"maximum":   5,
+	"urgent":    5,
+	"critical":  5,
+	"emergency": 5,
+}
+
+// ParsePriority parses a priority string into its equivalent integer value. Besides the numbers 1-5, it accepts
+// the priority names (min, low, default, high, max) and a few human-friendly aliases, e.g. "urgent" or "meh".
 //
 // Parameters:
 //   - priority: The priority string (e.g. "high", "5").
@@ -271,22 +366,30 @@ func ValidRandomString(s string, length int) bool {
 //   - An error if invalid.
 func ParsePriority(priority string) (int, error) {
 	p := strings.TrimSpace(strings.ToLower(priority))
-	switch p {
-	case "":
+	if p == "" {
 		return 0, nil
-	case "1", "min":
-		return 1, nil
-	case "2", "low":
-		return 2, nil
-	case "3", "default":
-		return 3, nil
-	case "4", "high":
-		return 4, nil
-	case "5", "max", "urgent":
-		return 5, nil
-	default:
-		return 0, errInvalidPriority
+	} else if len(p) == 1 && p[0] >= '1' && p[0] <= '5' {
+		return int(p[0] - '0'), nil
+	} else if value, ok := priorityNames[p]; ok {
+		return value, nil
 	}
+	return 0, errInvalidPriority
+}
+
+// DescribeInvalidPriority returns a human-readable explanation of why the given priority is invalid,
+// suggesting the closest priority name if the priority looks like a typo, e.g. "urgnet".
+//
+// Parameters:
+//   - priority: The invalid priority string.
+//
+// Returns:
+//   - The explanation, e.g. `unknown priority "urgnet", did you mean "urgent"?`.
+func DescribeInvalidPriority(priority string) string {
+	p := strings.TrimSpace(strings.ToLower(priority))
+	if suggestion := ClosestMatch(p, maps.Keys(priorityNames), 2); suggestion != "" {
+		return fmt.Sprintf("unknown priority %q, did you mean %q?", priority, suggestion)
+	}
+	return fmt.Sprintf("unknown priority %q, use 1-5, or one of min, low, default, high, max", priority)
 }
 
 // PriorityString converts a priority number to a string.
@@ -491,6 +594,34 @@ func BearerAuth(token string) string {
 	return fmt.Sprintf("Bearer %s", token)
 }
 
+// ResolveSecret resolves a reference to a secret, so that credentials don't have to appear literally in config
+// files: "file://<path>" is replaced by the contents of the file (without trailing newlines), e.g. a Docker secret
+// like file:///run/secrets/ntfy_token, and "env://<name>" is replaced by the value of the environment variable. Other
+// values are returned as is.
+//
+// Parameters:
+//   - value: The secret, or a reference to it.
+//
+// Returns:
+//   - The resolved secret.
+//   - An error if the file cannot be read, or the environment variable is not set.
+func ResolveSecret(value string) (string, error) {
+	if path, ok := strings.CutPrefix(value, secretFilePrefix); ok {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read secret file: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	} else if name, ok := strings.CutPrefix(value, secretEnvPrefix); ok {
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	}
+	return value, nil
+}
+
 // MaybeMarshalJSON returns a JSON string of the given object, or "<cannot serialize>" if serialization failed.
 // This is useful for logging purposes where a failure doesn't matter that much.
 //
@@ -633,6 +764,21 @@ func Max[T int | int64 | rate.Limit](a, b T) T {
 	return b
 }
 
+// Min returns the minimum value of the two given values.
+//
+// Parameters:
+//   - a: The first value.
+//   - b: The second value.
+//
+// Returns:
+//   - The smaller of the two values.
+func Min[T int | int64 | rate.Limit](a, b T) T {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 // String turns a string into a pointer of a string.
 //
 // Parameters:
@@ -655,6 +801,17 @@ func Int(v int) *int {
 	return &v
 }
 
+// Bool turns a bool into a pointer of a bool.
+//
+// Parameters:
+//   - v: The bool value.
+//
+// Returns:
+//   - A pointer to the bool.
+func Bool(v bool) *bool {
+	return &v
+}
+
 // Time turns a time.Time into a pointer.
 //
 // Parameters:
@@ -6,6 +6,7 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -87,6 +88,39 @@ func TestParsePriority_Invalid(t *testing.T) {
 	}
 }
 
+func TestParsePriority_Aliases(t *testing.T) {
+	priorities := []string{"urgent", "Critical", "important", "normal", "meh", "quiet"}
+	expected := []int{5, 5, 4, 3, 2, 1}
+	for i, priority := range priorities {
+		actual, err := ParsePriority(priority)
+		require.Nil(t, err)
+		require.Equal(t, expected[i], actual)
+	}
+}
+
+func TestDescribeInvalidPriority(t *testing.T) {
+	require.Equal(t, `unknown priority "urgnet", did you mean "urgent"?`, DescribeInvalidPriority("urgnet"))
+	require.Equal(t, `unknown priority "HIHG", did you mean "high"?`, DescribeInvalidPriority("HIHG"))
+	require.Equal(t, `unknown priority "whatever", use 1-5, or one of min, low, default, high, max`, DescribeInvalidPriority("whatever"))
+}
+
+func TestSplitTags(t *testing.T) {
+	require.Equal(t, []string{"warning", "skull"}, SplitTags("warning,skull"))
+	require.Equal(t, []string{"warning", "skull"}, SplitTags(" warning ,, skull ,"))
+	require.Equal(t, []string{"warning", "skull", ":tada:"}, SplitTags("warning  skull\t:tada:"))
+	require.Equal(t, []string{"backup server", "nightly"}, SplitTags("backup server, nightly"))
+	require.Equal(t, []string{}, SplitTags("  "))
+}
+
+func TestClosestMatch(t *testing.T) {
+	candidates := slices.Values([]string{"warning", "skull", "tada"})
+	require.Equal(t, "warning", ClosestMatch("warnign", candidates, 2))
+	require.Equal(t, "tada", ClosestMatch("tad", candidates, 2))
+	require.Equal(t, "", ClosestMatch("rotating_light", candidates, 2))
+	require.Equal(t, 3, levenshtein("kitten", "sitting"))
+	require.Equal(t, 1, levenshtein("🎉", "🥳"))
+}
+
 func TestPriorityString(t *testing.T) {
 	priorities := []int{0, 1, 2, 3, 4, 5}
 	expected := []string{"default", "min", "low", "default", "high", "max"}
@@ -181,6 +215,27 @@ func TestBearerAuth(t *testing.T) {
 	require.Equal(t, "Bearer sometoken", BearerAuth("sometoken"))
 }
 
+func TestResolveSecret(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "secret")
+	require.Nil(t, os.WriteFile(filename, []byte("s3cr3t\n"), 0600))
+	t.Setenv("TEST_NTFY_SECRET", "from env")
+
+	secret, err := ResolveSecret("file://" + filename)
+	require.Nil(t, err)
+	require.Equal(t, "s3cr3t", secret)
+	secret, err = ResolveSecret("env://TEST_NTFY_SECRET")
+	require.Nil(t, err)
+	require.Equal(t, "from env", secret)
+	secret, err = ResolveSecret("literal")
+	require.Nil(t, err)
+	require.Equal(t, "literal", secret)
+
+	_, err = ResolveSecret("file://" + filename + ".does-not-exist")
+	require.ErrorContains(t, err, "cannot read secret file")
+	_, err = ResolveSecret("env://TEST_NTFY_SECRET_NOT_SET")
+	require.ErrorContains(t, err, "TEST_NTFY_SECRET_NOT_SET is not set")
+}
+
 type testJSON struct {
 	Name      string `json:"name"`
 	Something int    `json:"something"`
@@ -258,6 +313,12 @@ func TestMax(t *testing.T) {
 	require.Equal(t, rate.Every(time.Minute), Max(rate.Every(time.Hour), rate.Every(time.Minute)))
 }
 
+func TestMin(t *testing.T) {
+	require.Equal(t, 1, Min(1, 9))
+	require.Equal(t, 1, Min(9, 1))
+	require.Equal(t, rate.Every(time.Hour), Min(rate.Every(time.Hour), rate.Every(time.Minute)))
+}
+
 func TestPointerFunctions(t *testing.T) {
 	i, s, ti := Int(99), String("abc"), Time(time.Unix(99, 0))
 	require.Equal(t, 99, *i)
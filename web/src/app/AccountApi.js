@@ -2,6 +2,9 @@ import i18n from "i18next";
 import {
   accountBillingPortalUrl,
   accountBillingSubscriptionUrl,
+  accountEmailUrl,
+  accountPasswordResetConfirmUrl,
+  accountPasswordResetUrl,
   accountPasswordUrl,
   accountPhoneUrl,
   accountPhoneVerifyUrl,
@@ -9,6 +12,7 @@ import {
   accountReservationUrl,
   accountSettingsUrl,
   accountSubscriptionUrl,
+  accountTokenOthersUrl,
   accountTokenUrl,
   accountUrl,
   maybeWithBearerAuth,
@@ -115,6 +119,34 @@ class AccountApi {
     });
   }
 
+  async requestPasswordReset(username) {
+    const url = accountPasswordResetUrl(config.base_url);
+    console.log(`[AccountApi] Requesting password reset ${url}`);
+    await fetchOrThrow(url, {
+      method: "POST",
+      body: JSON.stringify({ username }),
+    });
+  }
+
+  async resetPassword(token, password) {
+    const url = accountPasswordResetConfirmUrl(config.base_url);
+    console.log(`[AccountApi] Resetting password ${url}`);
+    await fetchOrThrow(url, {
+      method: "POST",
+      body: JSON.stringify({ token, password }),
+    });
+  }
+
+  async changeEmail(password, email) {
+    const url = accountEmailUrl(config.base_url);
+    console.log(`[AccountApi] Changing account email address ${url}`);
+    await fetchOrThrow(url, {
+      method: "PUT",
+      headers: withBearerAuth({}, session.token()),
+      body: JSON.stringify({ password, email }),
+    });
+  }
+
   async createToken(label, expires) {
     const url = accountTokenUrl(config.base_url);
     const body = {
@@ -164,6 +196,15 @@ class AccountApi {
     });
   }
 
+  async deleteOtherTokens() {
+    const url = accountTokenOthersUrl(config.base_url);
+    console.log(`[AccountApi] Deleting all other user access tokens ${url}`);
+    await fetchOrThrow(url, {
+      method: "DELETE",
+      headers: withBearerAuth({}, session.token()),
+    });
+  }
+
   async updateSettings(payload) {
     const url = accountSettingsUrl(config.base_url);
     const body = JSON.stringify(payload);
@@ -403,8 +444,13 @@ class AccountApi {
 export const Role = {
   ADMIN: "admin",
   USER: "user",
+  ANONYMOUS: "anonymous",
 };
 
+// Users with a custom role (e.g. "operator") are regular users with additional capabilities,
+// so they are subject to the same limits as users with the "user" role
+export const isRegularUser = (account) => !!account && account.role !== Role.ADMIN && account.role !== Role.ANONYMOUS;
+
 // Maps to server.visitorLimitBasis in server/visitor.go
 export const LimitBasis = {
   IP: "ip",
@@ -56,7 +56,7 @@ class Connection {
           console.log(`[Connection, ${this.shortUrl}, ${this.connectionId}] Unexpected message. Ignoring.`);
           return;
         }
-        this.since = data.id;
+        this.since = data.resume || data.id; // Resume token, or message ID for older servers
         this.onNotification(this.subscriptionId, data);
       } catch (e) {
         console.log(`[Connection, ${this.shortUrl}, ${this.connectionId}] Error handling message: ${e}`);
@@ -47,9 +47,37 @@ export class IncorrectPasswordError extends Error {
   }
 }
 
+export class PasswordResetLimitReachedError extends Error {
+  static CODE = 42911; // errHTTPTooManyRequestsLimitPasswordReset
+
+  constructor() {
+    super("Password reset limit reached");
+  }
+}
+
+export class PasswordExpiredError extends Error {
+  static CODE = 40102; // errHTTPUnauthorizedPasswordExpired
+
+  constructor() {
+    super("Password expired");
+  }
+}
+
+export class PasswordResetTokenInvalidError extends Error {
+  static CODE = 40049; // errHTTPBadRequestPasswordResetTokenInvalid
+
+  constructor() {
+    super("Password reset link invalid or expired");
+  }
+}
+
 export const throwAppError = async (response) => {
   if (response.status === 401 || response.status === 403) {
     console.log(`[Error] HTTP ${response.status}`, response);
+    const error = await maybeToJson(response);
+    if (error?.code === PasswordExpiredError.CODE) {
+      throw new PasswordExpiredError();
+    }
     throw new UnauthorizedError();
   }
   const error = await maybeToJson(response);
@@ -63,6 +91,10 @@ export const throwAppError = async (response) => {
       throw new AccountCreateLimitReachedError();
     } else if (error.code === IncorrectPasswordError.CODE) {
       throw new IncorrectPasswordError();
+    } else if (error.code === PasswordResetTokenInvalidError.CODE) {
+      throw new PasswordResetTokenInvalidError();
+    } else if (error.code === PasswordResetLimitReachedError.CODE) {
+      throw new PasswordResetLimitReachedError();
     } else if (error?.error) {
       throw new Error(`Error ${error.code}: ${error.error}`);
     }
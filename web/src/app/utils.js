@@ -24,7 +24,11 @@ export const topicShortUrl = (baseUrl, topic) => shortUrl(topicUrl(baseUrl, topi
 export const webPushUrl = (baseUrl) => `${baseUrl}/v1/webpush`;
 export const accountUrl = (baseUrl) => `${baseUrl}/v1/account`;
 export const accountPasswordUrl = (baseUrl) => `${baseUrl}/v1/account/password`;
+export const accountPasswordResetUrl = (baseUrl) => `${baseUrl}/v1/account/password/reset`;
+export const accountPasswordResetConfirmUrl = (baseUrl) => `${baseUrl}/v1/account/password/reset/confirm`;
+export const accountEmailUrl = (baseUrl) => `${baseUrl}/v1/account/email`;
 export const accountTokenUrl = (baseUrl) => `${baseUrl}/v1/account/token`;
+export const accountTokenOthersUrl = (baseUrl) => `${baseUrl}/v1/account/token/others`;
 export const accountSettingsUrl = (baseUrl) => `${baseUrl}/v1/account/settings`;
 export const accountSubscriptionUrl = (baseUrl) => `${baseUrl}/v1/account/subscription`;
 export const accountReservationUrl = (baseUrl) => `${baseUrl}/v1/account/reservation`;
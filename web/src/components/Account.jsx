@@ -2,6 +2,7 @@ import * as React from "react";
 import { useContext, useState } from "react";
 import {
   Alert,
+  Avatar,
   CardActions,
   CardContent,
   Chip,
@@ -46,7 +47,7 @@ import { ContentCopy, Public } from "@mui/icons-material";
 import AddIcon from "@mui/icons-material/Add";
 import routes from "./routes";
 import { copyToClipboard, formatBytes, formatShortDate, formatShortDateTime, openUrl } from "../app/utils";
-import accountApi, { LimitBasis, Role, SubscriptionInterval, SubscriptionStatus } from "../app/AccountApi";
+import accountApi, { isRegularUser, LimitBasis, Role, SubscriptionInterval, SubscriptionStatus } from "../app/AccountApi";
 import { Pref, PrefGroup } from "./Pref";
 import db from "../app/db";
 import UpgradeDialog from "./UpgradeDialog";
@@ -83,7 +84,9 @@ const Basics = () => {
       </Typography>
       <PrefGroup>
         <Username />
+        <Profile />
         <ChangePassword />
+        {config.enable_password_reset && <ChangeEmail />}
         <PhoneNumbers />
         <AccountType />
       </PrefGroup>
@@ -113,6 +116,101 @@ const Username = () => {
   );
 };
 
+const Profile = () => {
+  const { t } = useTranslation();
+  const [dialogKey, setDialogKey] = useState(0);
+  const [dialogOpen, setDialogOpen] = useState(false);
+  const { account } = useContext(AccountContext);
+  const labelId = "prefProfile";
+
+  const handleDialogOpen = () => {
+    setDialogKey((prev) => prev + 1);
+    setDialogOpen(true);
+  };
+
+  const handleDialogClose = () => {
+    setDialogOpen(false);
+  };
+
+  return (
+    <Pref labelId={labelId} title={t("account_basics_profile_title")} description={t("account_basics_profile_description")}>
+      <div aria-labelledby={labelId} style={{ display: "flex", alignItems: "center" }}>
+        {account?.avatar && <Avatar src={account.avatar} sx={{ width: 32, height: 32, mr: 1 }} />}
+        <Typography>{account?.display_name || <em>{t("account_basics_profile_no_display_name")}</em>}</Typography>
+        <IconButton onClick={handleDialogOpen} aria-label={t("account_basics_profile_description")}>
+          <EditIcon />
+        </IconButton>
+      </div>
+      <ProfileDialog key={`profileDialog${dialogKey}`} account={account} open={dialogOpen} onClose={handleDialogClose} />
+    </Pref>
+  );
+};
+
+const ProfileDialog = (props) => {
+  const theme = useTheme();
+  const { t } = useTranslation();
+  const [error, setError] = useState("");
+  const [displayName, setDisplayName] = useState(props.account?.display_name || "");
+  const [avatar, setAvatar] = useState(props.account?.avatar || "");
+  const fullScreen = useMediaQuery(theme.breakpoints.down("sm"));
+
+  const handleDialogSubmit = async () => {
+    try {
+      console.debug(`[Account] Updating profile`);
+      await accountApi.updateSettings({
+        profile: {
+          display_name: displayName.trim(),
+          avatar: avatar.trim(),
+        },
+      });
+      props.onClose();
+    } catch (e) {
+      console.log(`[Account] Error updating profile`, e);
+      if (e instanceof UnauthorizedError) {
+        await session.resetAndRedirect(routes.login);
+      } else {
+        setError(e.message);
+      }
+    }
+  };
+
+  return (
+    <Dialog open={props.open} onClose={props.onCancel} fullScreen={fullScreen}>
+      <DialogTitle>{t("account_basics_profile_dialog_title")}</DialogTitle>
+      <DialogContent>
+        <DialogContentText>{t("account_basics_profile_dialog_description")}</DialogContentText>
+        <TextField
+          margin="dense"
+          id="display-name"
+          label={t("account_basics_profile_dialog_display_name_label")}
+          aria-label={t("account_basics_profile_dialog_display_name_label")}
+          value={displayName}
+          onChange={(ev) => setDisplayName(ev.target.value)}
+          inputProps={{ maxLength: 64 }}
+          fullWidth
+          variant="standard"
+        />
+        <TextField
+          margin="dense"
+          id="avatar"
+          label={t("account_basics_profile_dialog_avatar_label")}
+          aria-label={t("account_basics_profile_dialog_avatar_label")}
+          placeholder="https://..."
+          type="url"
+          value={avatar}
+          onChange={(ev) => setAvatar(ev.target.value)}
+          fullWidth
+          variant="standard"
+        />
+      </DialogContent>
+      <DialogFooter status={error}>
+        <Button onClick={props.onClose}>{t("common_cancel")}</Button>
+        <Button onClick={handleDialogSubmit}>{t("common_save")}</Button>
+      </DialogFooter>
+    </Dialog>
+  );
+};
+
 const ChangePassword = () => {
   const { t } = useTranslation();
   const [dialogKey, setDialogKey] = useState(0);
@@ -231,6 +329,108 @@ const ChangePasswordDialog = (props) => {
   );
 };
 
+const ChangeEmail = () => {
+  const { t } = useTranslation();
+  const [dialogKey, setDialogKey] = useState(0);
+  const [dialogOpen, setDialogOpen] = useState(false);
+  const { account } = useContext(AccountContext);
+  const labelId = "prefChangeEmail";
+
+  const handleDialogOpen = () => {
+    setDialogKey((prev) => prev + 1);
+    setDialogOpen(true);
+  };
+
+  const handleDialogClose = () => {
+    setDialogOpen(false);
+  };
+
+  return (
+    <Pref labelId={labelId} title={t("account_basics_email_title")} description={t("account_basics_email_description")}>
+      <div aria-labelledby={labelId}>
+        <Typography sx={{ float: "left", lineHeight: "2.5" }}>{account?.email || t("account_basics_email_none")}</Typography>
+        {!account?.provisioned ? (
+          <IconButton onClick={handleDialogOpen} aria-label={t("account_basics_email_description")}>
+            <EditIcon />
+          </IconButton>
+        ) : (
+          <Tooltip title={t("account_basics_cannot_edit_or_delete_provisioned_user")}>
+            <span>
+              <IconButton disabled>
+                <EditIcon />
+              </IconButton>
+            </span>
+          </Tooltip>
+        )}
+      </div>
+      <ChangeEmailDialog key={`changeEmailDialog${dialogKey}`} email={account?.email} open={dialogOpen} onClose={handleDialogClose} />
+    </Pref>
+  );
+};
+
+const ChangeEmailDialog = (props) => {
+  const theme = useTheme();
+  const { t } = useTranslation();
+  const [error, setError] = useState("");
+  const [email, setEmail] = useState(props.email || "");
+  const [password, setPassword] = useState("");
+  const fullScreen = useMediaQuery(theme.breakpoints.down("sm"));
+
+  const handleDialogSubmit = async () => {
+    try {
+      console.debug(`[Account] Changing email address`);
+      await accountApi.changeEmail(password, email);
+      props.onClose();
+    } catch (e) {
+      console.log(`[Account] Error changing email address`, e);
+      if (e instanceof IncorrectPasswordError) {
+        setError(t("account_basics_password_dialog_current_password_incorrect"));
+      } else if (e instanceof UnauthorizedError) {
+        await session.resetAndRedirect(routes.login);
+      } else {
+        setError(e.message);
+      }
+    }
+  };
+
+  return (
+    <Dialog open={props.open} onClose={props.onCancel} fullScreen={fullScreen}>
+      <DialogTitle>{t("account_basics_email_dialog_title")}</DialogTitle>
+      <DialogContent>
+        <DialogContentText>{t("account_basics_email_dialog_description")}</DialogContentText>
+        <TextField
+          margin="dense"
+          id="email"
+          label={t("account_basics_email_dialog_email_label")}
+          aria-label={t("account_basics_email_dialog_email_label")}
+          type="email"
+          value={email}
+          onChange={(ev) => setEmail(ev.target.value.trim())}
+          fullWidth
+          variant="standard"
+        />
+        <TextField
+          margin="dense"
+          id="current-password"
+          label={t("account_basics_password_dialog_current_password_label")}
+          aria-label={t("account_basics_password_dialog_current_password_label")}
+          type="password"
+          value={password}
+          onChange={(ev) => setPassword(ev.target.value)}
+          fullWidth
+          variant="standard"
+        />
+      </DialogContent>
+      <DialogFooter status={error}>
+        <Button onClick={props.onClose}>{t("common_cancel")}</Button>
+        <Button onClick={handleDialogSubmit} disabled={password.length === 0}>
+          {t("common_save")}
+        </Button>
+      </DialogFooter>
+    </Dialog>
+  );
+};
+
 const AccountType = () => {
   const { t, i18n } = useTranslation();
   const { account } = useContext(AccountContext);
@@ -282,7 +482,7 @@ const AccountType = () => {
 
   return (
     <Pref
-      alignTop={account.billing?.status === SubscriptionStatus.PAST_DUE || account.billing?.cancel_at > 0}
+      alignTop={account.billing?.status === SubscriptionStatus.PAST_DUE || account.billing?.cancel_at > 0 || account.tier?.expires > 0}
       title={t("account_basics_tier_title")}
       description={t("account_basics_tier_description")}
     >
@@ -299,7 +499,7 @@ const AccountType = () => {
             </span>
           </Tooltip>
         )}
-        {config.enable_payments && account.role === Role.USER && !account.billing?.subscription && (
+        {config.enable_payments && isRegularUser(account) && !account.billing?.subscription && (
           <Button
             variant="outlined"
             size="small"
@@ -310,12 +510,12 @@ const AccountType = () => {
             {t("account_basics_tier_upgrade_button")}
           </Button>
         )}
-        {config.enable_payments && account.role === Role.USER && account.billing?.subscription && (
+        {config.enable_payments && isRegularUser(account) && account.billing?.subscription && (
           <Button variant="outlined" size="small" onClick={handleUpgradeClick} sx={{ ml: 1 }}>
             {t("account_basics_tier_change_button")}
           </Button>
         )}
-        {config.enable_payments && account.role === Role.USER && account.billing?.customer && (
+        {config.enable_payments && isRegularUser(account) && account.billing?.customer && (
           <Button variant="outlined" size="small" onClick={handleManageBilling} sx={{ ml: 1 }}>
             {t("account_basics_tier_manage_billing_button")}
           </Button>
@@ -340,6 +540,13 @@ const AccountType = () => {
           })}
         </Alert>
       )}
+      {account.tier?.expires > 0 && !account.billing?.cancel_at && (
+        <Alert severity="info" sx={{ mt: 1 }}>
+          {t("account_basics_tier_expires", {
+            date: formatShortDate(account.tier.expires, i18n.language),
+          })}
+        </Alert>
+      )}
       <Portal>
         <Snackbar
           open={showPortalError}
@@ -586,7 +793,7 @@ const Stats = () => {
                 {account.stats.reservations.toLocaleString()}
               </Typography>
               <Typography variant="body2" sx={{ float: "right" }}>
-                {account.role === Role.USER
+                {isRegularUser(account)
                   ? t("account_usage_of_limit", {
                       limit: account.limits.reservations.toLocaleString(),
                     })
@@ -596,7 +803,7 @@ const Stats = () => {
             <LinearProgress
               variant="determinate"
               value={
-                account.role === Role.USER && account.limits.reservations > 0
+                isRegularUser(account) && account.limits.reservations > 0
                   ? normalize(account.stats.reservations, account.limits.reservations)
                   : 100
               }
@@ -620,7 +827,7 @@ const Stats = () => {
               {account.stats.messages.toLocaleString()}
             </Typography>
             <Typography variant="body2" sx={{ float: "right" }}>
-              {account.role === Role.USER
+              {isRegularUser(account)
                 ? t("account_usage_of_limit", {
                     limit: account.limits.messages.toLocaleString(),
                   })
@@ -629,7 +836,7 @@ const Stats = () => {
           </div>
           <LinearProgress
             variant="determinate"
-            value={account.role === Role.USER ? normalize(account.stats.messages, account.limits.messages) : 100}
+            value={isRegularUser(account) ? normalize(account.stats.messages, account.limits.messages) : 100}
           />
         </Pref>
         {config.enable_emails && (
@@ -650,7 +857,7 @@ const Stats = () => {
                 {account.stats.emails.toLocaleString()}
               </Typography>
               <Typography variant="body2" sx={{ float: "right" }}>
-                {account.role === Role.USER
+                {isRegularUser(account)
                   ? t("account_usage_of_limit", {
                       limit: account.limits.emails.toLocaleString(),
                     })
@@ -659,7 +866,7 @@ const Stats = () => {
             </div>
             <LinearProgress
               variant="determinate"
-              value={account.role === Role.USER ? normalize(account.stats.emails, account.limits.emails) : 100}
+              value={isRegularUser(account) ? normalize(account.stats.emails, account.limits.emails) : 100}
             />
           </Pref>
         )}
@@ -681,7 +888,7 @@ const Stats = () => {
                 {account.stats.calls.toLocaleString()}
               </Typography>
               <Typography variant="body2" sx={{ float: "right" }}>
-                {account.role === Role.USER
+                {isRegularUser(account)
                   ? t("account_usage_of_limit", {
                       limit: account.limits.calls.toLocaleString(),
                     })
@@ -690,7 +897,7 @@ const Stats = () => {
             </div>
             <LinearProgress
               variant="determinate"
-              value={account.role === Role.USER && account.limits.calls > 0 ? normalize(account.stats.calls, account.limits.calls) : 100}
+              value={isRegularUser(account) && account.limits.calls > 0 ? normalize(account.stats.calls, account.limits.calls) : 100}
             />
           </Pref>
         )}
@@ -710,7 +917,7 @@ const Stats = () => {
               {formatBytes(account.stats.attachment_total_size)}
             </Typography>
             <Typography variant="body2" sx={{ float: "right" }}>
-              {account.role === Role.USER
+              {isRegularUser(account)
                 ? t("account_usage_of_limit", {
                     limit: formatBytes(account.limits.attachment_total_size),
                   })
@@ -719,10 +926,10 @@ const Stats = () => {
           </div>
           <LinearProgress
             variant="determinate"
-            value={account.role === Role.USER ? normalize(account.stats.attachment_total_size, account.limits.attachment_total_size) : 100}
+            value={isRegularUser(account) ? normalize(account.stats.attachment_total_size, account.limits.attachment_total_size) : 100}
           />
         </Pref>
-        {config.enable_reservations && account.role === Role.USER && account.limits.reservations === 0 && (
+        {config.enable_reservations && isRegularUser(account) && account.limits.reservations === 0 && (
           <Pref
             title={
               <>
@@ -734,7 +941,7 @@ const Stats = () => {
             <em>{t("account_usage_reservations_none")}</em>
           </Pref>
         )}
-        {config.enable_calls && account.role === Role.USER && account.limits.calls === 0 && (
+        {config.enable_calls && isRegularUser(account) && account.limits.calls === 0 && (
           <Pref
             title={
               <>
@@ -747,7 +954,7 @@ const Stats = () => {
           </Pref>
         )}
       </PrefGroup>
-      {account.role === Role.USER && account.limits.basis === LimitBasis.IP && (
+      {isRegularUser(account) && account.limits.basis === LimitBasis.IP && (
         <Typography variant="body1">{t("account_usage_basis_ip_description")}</Typography>
       )}
     </Card>
@@ -781,6 +988,17 @@ const Tokens = () => {
     setDialogOpen(false);
   };
 
+  const handleLogoutOthersClick = async () => {
+    try {
+      await accountApi.deleteOtherTokens();
+    } catch (e) {
+      console.log(`[Account] Error deleting other tokens`, e);
+      if (e instanceof UnauthorizedError) {
+        await session.resetAndRedirect(routes.login);
+      }
+    }
+  };
+
   return (
     <Card sx={{ padding: 1 }} aria-label={t("prefs_users_title")}>
       <CardContent sx={{ paddingBottom: 1 }}>
@@ -799,6 +1017,9 @@ const Tokens = () => {
       </CardContent>
       <CardActions>
         <Button onClick={handleCreateClick}>{t("account_tokens_table_create_token_button")}</Button>
+        {tokens.filter((token) => token.token !== session.token() && !token.provisioned).length > 0 && (
+          <Button onClick={handleLogoutOthersClick}>{t("account_tokens_table_logout_others_button")}</Button>
+        )}
       </CardActions>
       <TokenDialog key={`tokenDialogCreate${dialogKey}`} open={dialogOpen} onClose={handleDialogClose} />
     </Card>
@@ -886,9 +1107,16 @@ const TokensTable = (props) => {
               <div style={{ display: "flex", alignItems: "center" }}>
                 <span>{formatShortDateTime(token.last_access, i18n.language)}</span>
                 <Tooltip
-                  title={t("account_tokens_table_last_origin_tooltip", {
-                    ip: token.last_origin,
-                  })}
+                  title={
+                    token.last_user_agent
+                      ? t("account_tokens_table_last_origin_user_agent_tooltip", {
+                          ip: token.last_origin,
+                          userAgent: token.last_user_agent,
+                        })
+                      : t("account_tokens_table_last_origin_tooltip", {
+                          ip: token.last_origin,
+                        })
+                  }
                 >
                   <IconButton onClick={() => openUrl(`https://whatismyipaddress.com/ip/${token.last_origin}`)}>
                     <Public />
@@ -1,7 +1,7 @@
-import { AppBar, Toolbar, IconButton, Typography, Box, MenuItem, Button, Divider, ListItemIcon, useTheme } from "@mui/material";
+import { AppBar, Toolbar, IconButton, Typography, Box, MenuItem, Button, Divider, ListItemIcon, useTheme, Avatar } from "@mui/material";
 import MenuIcon from "@mui/icons-material/Menu";
 import * as React from "react";
-import { useState } from "react";
+import { useContext, useState } from "react";
 import { useLocation, useNavigate } from "react-router-dom";
 import MoreVertIcon from "@mui/icons-material/MoreVert";
 import NotificationsIcon from "@mui/icons-material/Notifications";
@@ -20,6 +20,7 @@ import accountApi from "../app/AccountApi";
 import PopupMenu from "./PopupMenu";
 import { SubscriptionPopup } from "./SubscriptionPopup";
 import { useIsLaunchedPWA } from "./hooks";
+import { AccountContext } from "./App";
 
 const ActionBar = (props) => {
   const theme = useTheme();
@@ -126,6 +127,7 @@ const SettingsIcons = (props) => {
 
 const ProfileIcon = () => {
   const { t } = useTranslation();
+  const { account } = useContext(AccountContext);
   const [anchorEl, setAnchorEl] = useState(null);
   const open = Boolean(anchorEl);
   const navigate = useNavigate();
@@ -151,7 +153,11 @@ const ProfileIcon = () => {
     <>
       {session.exists() && (
         <IconButton color="inherit" size="large" edge="end" onClick={handleClick} aria-label={t("action_bar_profile_title")}>
-          <AccountCircleIcon />
+          {account?.avatar ? (
+            <Avatar src={account.avatar} alt={account.display_name || session.username()} sx={{ width: 28, height: 28 }} />
+          ) : (
+            <AccountCircleIcon />
+          )}
         </IconButton>
       )}
       {!session.exists() && config.enable_login && (
@@ -169,7 +175,7 @@ const ProfileIcon = () => {
           <ListItemIcon>
             <Person />
           </ListItemIcon>
-          <b>{session.username()}</b>
+          <b>{account?.display_name || session.username()}</b>
         </MenuItem>
         <Divider />
         <MenuItem onClick={() => navigate(routes.settings)}>
@@ -19,6 +19,7 @@ import PublishDialog from "./PublishDialog";
 import Messaging from "./Messaging";
 import Login from "./Login";
 import Signup from "./Signup";
+import ResetPassword from "./ResetPassword";
 import Account from "./Account";
 import initI18n from "../app/i18n"; // Translations!
 import prefs, { THEME } from "../app/Prefs";
@@ -61,7 +62,8 @@ const App = () => {
   }, [i18n.language, languageDir]);
 
   useEffect(() => {
-    if (!session.exists() && config.require_login && window.location.pathname !== routes.login) {
+    const publicPaths = [routes.login, routes.resetPassword];
+    if (!session.exists() && config.require_login && !publicPaths.includes(window.location.pathname)) {
       window.location.href = routes.login;
     }
   }, []);
@@ -77,6 +79,7 @@ const App = () => {
                 <Routes>
                   <Route path={routes.login} element={<Login />} />
                   <Route path={routes.signup} element={<Signup />} />
+                  <Route path={routes.resetPassword} element={<ResetPassword />} />
                   <Route element={<Layout />}>
                     <Route path={routes.app} element={<AllSubscriptions />} />
                     <Route path={routes.account} element={<Account />} />
@@ -9,7 +9,7 @@ import accountApi from "../app/AccountApi";
 import AvatarBox from "./AvatarBox";
 import session from "../app/Session";
 import routes from "./routes";
-import { UnauthorizedError } from "../app/errors";
+import { PasswordExpiredError, UnauthorizedError } from "../app/errors";
 
 const Login = () => {
   const { t } = useTranslation();
@@ -28,7 +28,9 @@ const Login = () => {
       window.location.href = routes.app;
     } catch (e) {
       console.log(`[Login] User auth for user ${user.username} failed`, e);
-      if (e instanceof UnauthorizedError) {
+      if (e instanceof PasswordExpiredError) {
+        setError(t("login_error_password_expired"));
+      } else if (e instanceof UnauthorizedError) {
         setError(t("Login failed: Invalid username or password"));
       } else {
         setError(e.message);
@@ -100,7 +102,13 @@ const Login = () => {
           </Box>
         )}
         <Box sx={{ width: "100%" }}>
-          {/* This is where the password reset link would go */}
+          {config.enable_password_reset && (
+            <div style={{ float: "left" }}>
+              <NavLink to={routes.resetPassword} variant="body1">
+                {t("login_link_reset_password")}
+              </NavLink>
+            </div>
+          )}
           {config.enable_signup && (
             <div style={{ float: "right" }}>
               <NavLink to={routes.signup} variant="body1">
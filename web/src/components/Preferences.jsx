@@ -39,7 +39,7 @@ import userManager from "../app/UserManager";
 import { playSound, shortUrl, shuffle, sounds, validUrl } from "../app/utils";
 import session from "../app/Session";
 import routes from "./routes";
-import accountApi, { Permission, Role } from "../app/AccountApi";
+import accountApi, { isRegularUser, Permission } from "../app/AccountApi";
 import { Pref, PrefGroup } from "./Pref";
 import { AccountContext } from "./App";
 import { Paragraph } from "./styles";
@@ -613,7 +613,7 @@ const Reservations = () => {
     return <></>;
   }
   const reservations = account.reservations || [];
-  const limitReached = account.role === Role.USER && account.stats.reservations_remaining === 0;
+  const limitReached = isRegularUser(account) && account.stats.reservations_remaining === 0;
 
   const handleAddClick = () => {
     setDialogKey((prev) => prev + 1);
@@ -0,0 +1,186 @@
+import * as React from "react";
+import { useState } from "react";
+import { TextField, Button, Box, Typography, InputAdornment, IconButton } from "@mui/material";
+import { NavLink, useSearchParams } from "react-router-dom";
+import { useTranslation } from "react-i18next";
+import WarningAmberIcon from "@mui/icons-material/WarningAmber";
+import { Visibility, VisibilityOff } from "@mui/icons-material";
+import accountApi from "../app/AccountApi";
+import AvatarBox from "./AvatarBox";
+import routes from "./routes";
+import { PasswordResetLimitReachedError, PasswordResetTokenInvalidError } from "../app/errors";
+
+const ResetPassword = () => {
+  const { t } = useTranslation();
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get("token");
+
+  if (!config.enable_password_reset) {
+    return (
+      <AvatarBox>
+        <Typography sx={{ typography: "h6" }}>{t("reset_password_disabled")}</Typography>
+      </AvatarBox>
+    );
+  }
+  return token ? <ResetPasswordConfirm token={token} /> : <ResetPasswordRequest />;
+};
+
+const ResetPasswordRequest = () => {
+  const { t } = useTranslation();
+  const [error, setError] = useState("");
+  const [sent, setSent] = useState(false);
+  const [username, setUsername] = useState("");
+
+  const handleSubmit = async (event) => {
+    event.preventDefault();
+    try {
+      await accountApi.requestPasswordReset(username);
+      console.log(`[ResetPassword] Password reset for user ${username} requested`);
+      setSent(true);
+    } catch (e) {
+      console.log(`[ResetPassword] Password reset request for user ${username} failed`, e);
+      if (e instanceof PasswordResetLimitReachedError) {
+        setError(t("reset_password_error_limit_reached"));
+      } else {
+        setError(e.message);
+      }
+    }
+  };
+
+  return (
+    <AvatarBox>
+      <Typography sx={{ typography: "h6" }}>{t("reset_password_title")}</Typography>
+      {sent ? (
+        <Typography sx={{ mt: 2, mb: 2, textAlign: "center" }}>{t("reset_password_sent")}</Typography>
+      ) : (
+        <Box component="form" onSubmit={handleSubmit} noValidate sx={{ mt: 1 }}>
+          <Typography sx={{ mb: 1 }}>{t("reset_password_description")}</Typography>
+          <TextField
+            margin="dense"
+            required
+            fullWidth
+            id="username"
+            label={t("signup_form_username")}
+            name="username"
+            value={username}
+            onChange={(ev) => setUsername(ev.target.value.trim())}
+            autoFocus
+          />
+          <Button type="submit" fullWidth variant="contained" disabled={username === ""} sx={{ mt: 2, mb: 2 }}>
+            {t("reset_password_form_button_submit")}
+          </Button>
+          {error && <ResetPasswordError error={error} />}
+        </Box>
+      )}
+      <BackToLogin />
+    </AvatarBox>
+  );
+};
+
+const ResetPasswordConfirm = (props) => {
+  const { t } = useTranslation();
+  const [error, setError] = useState("");
+  const [success, setSuccess] = useState(false);
+  const [password, setPassword] = useState("");
+  const [confirm, setConfirm] = useState("");
+  const [showPassword, setShowPassword] = useState(false);
+
+  const handleSubmit = async (event) => {
+    event.preventDefault();
+    try {
+      await accountApi.resetPassword(props.token, password);
+      console.log(`[ResetPassword] Password reset successful`);
+      setSuccess(true);
+    } catch (e) {
+      console.log(`[ResetPassword] Password reset failed`, e);
+      if (e instanceof PasswordResetTokenInvalidError) {
+        setError(t("reset_password_error_token_invalid"));
+      } else {
+        setError(e.message);
+      }
+    }
+  };
+
+  return (
+    <AvatarBox>
+      <Typography sx={{ typography: "h6" }}>{t("reset_password_new_title")}</Typography>
+      {success ? (
+        <Typography sx={{ mt: 2, mb: 2, textAlign: "center" }}>{t("reset_password_success")}</Typography>
+      ) : (
+        <Box component="form" onSubmit={handleSubmit} noValidate sx={{ mt: 1 }}>
+          <TextField
+            margin="dense"
+            required
+            fullWidth
+            name="password"
+            label={t("signup_form_password")}
+            type={showPassword ? "text" : "password"}
+            id="password"
+            autoComplete="new-password"
+            value={password}
+            onChange={(ev) => setPassword(ev.target.value.trim())}
+            autoFocus
+            InputProps={{
+              endAdornment: (
+                <InputAdornment position="end">
+                  <IconButton
+                    aria-label={t("signup_form_toggle_password_visibility")}
+                    onClick={() => setShowPassword(!showPassword)}
+                    onMouseDown={(ev) => ev.preventDefault()}
+                    edge="end"
+                  >
+                    {showPassword ? <VisibilityOff /> : <Visibility />}
+                  </IconButton>
+                </InputAdornment>
+              ),
+            }}
+          />
+          <TextField
+            margin="dense"
+            required
+            fullWidth
+            name="confirm"
+            label={t("signup_form_confirm_password")}
+            type={showPassword ? "text" : "password"}
+            id="confirm"
+            autoComplete="new-password"
+            value={confirm}
+            onChange={(ev) => setConfirm(ev.target.value.trim())}
+          />
+          <Button type="submit" fullWidth variant="contained" disabled={password === "" || password !== confirm} sx={{ mt: 2, mb: 2 }}>
+            {t("reset_password_new_form_button_submit")}
+          </Button>
+          {error && <ResetPasswordError error={error} />}
+        </Box>
+      )}
+      <BackToLogin />
+    </AvatarBox>
+  );
+};
+
+const ResetPasswordError = (props) => (
+  <Box
+    sx={{
+      mb: 1,
+      display: "flex",
+      flexGrow: 1,
+      justifyContent: "center",
+    }}
+  >
+    <WarningAmberIcon color="error" sx={{ mr: 1 }} />
+    <Typography sx={{ color: "error.main" }}>{props.error}</Typography>
+  </Box>
+);
+
+const BackToLogin = () => {
+  const { t } = useTranslation();
+  return (
+    <Typography sx={{ mb: 4 }}>
+      <NavLink to={routes.login} variant="body1">
+        {t("reset_password_back_to_login")}
+      </NavLink>
+    </Typography>
+  );
+};
+
+export default ResetPassword;
@@ -24,7 +24,7 @@ import poller from "../app/Poller";
 import DialogFooter from "./DialogFooter";
 import session from "../app/Session";
 import routes from "./routes";
-import accountApi, { Permission, Role } from "../app/AccountApi";
+import accountApi, { isRegularUser, Permission, Role } from "../app/AccountApi";
 import ReserveTopicSelect from "./ReserveTopicSelect";
 import { AccountContext } from "./App";
 import { TopicReservedError, UnauthorizedError } from "../app/errors";
@@ -97,7 +97,7 @@ const SubscribePage = (props) => {
   );
   const showReserveTopicCheckbox = config.enable_reservations && !anotherServerVisible && (config.enable_payments || account);
   const reserveTopicEnabled =
-    session.exists() && (account?.role === Role.ADMIN || (account?.role === Role.USER && (account?.stats.reservations_remaining || 0) > 0));
+    session.exists() && (account?.role === Role.ADMIN || (isRegularUser(account) && (account?.stats.reservations_remaining || 0) > 0));
 
   const webPushEnabled = useLiveQuery(() => prefs.webPushEnabled());
 
@@ -4,6 +4,7 @@ import { shortUrl } from "../app/utils";
 const routes = {
   login: "/login",
   signup: "/signup",
+  resetPassword: "/reset-password",
   app: config.app_root,
   account: "/account",
   settings: "/settings",